@@ -16,7 +16,7 @@ along with this program.  If not, see <https://www.gnu.org/licenses/>.
 */
 
 // Package branding centralises Mulga/Spinifex visual identity constants used
-// by the installer TUI.
+// by the installer TUI and the spx dashboard.
 //
 // TODO: Replace placeholder values with official Mulga/Spinifex assets once
 // the brand guide and logo files are located.
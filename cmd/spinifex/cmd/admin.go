@@ -104,6 +104,33 @@ Each phase waits for all nodes to ACK before proceeding to the next.`,
 	Run: runClusterShutdown,
 }
 
+var clusterReloadCmd = &cobra.Command{
+	Use:   "reload",
+	Short: "Reload every node's config without restarting",
+	Long: `Have every daemon re-read spinifex.toml and apply the settings that can change
+while it runs: credentials, quotas, log level and other daemon limits. Changes to
+any other setting are reported and left for the next restart. Sending a daemon
+SIGHUP reloads that node alone.`,
+	Run: runClusterReload,
+}
+
+var nodeCmd = &cobra.Command{
+	Use:   "node",
+	Short: "Node operations",
+	Long:  `Administrative operations on a single node, such as draining it for maintenance.`,
+}
+
+var nodeDrainCmd = &cobra.Command{
+	Use:   "drain <node>",
+	Short: "Drain a node for maintenance and stop its daemon",
+	Long: `Drain a node: it stops taking launches, waits for those in flight, stops its
+instances and unmounts their volumes, persists its state and exits.
+Without --evacuate the instances are relaunched when the node's daemon starts again.
+With --evacuate they are stopped as by StopInstances and can be started on other nodes.`,
+	Args: cobra.ExactArgs(1),
+	Run:  runNodeDrain,
+}
+
 var adminInitCmd = &cobra.Command{
 	Use:   "init",
 	Short: "Initialize Spinifex platform configuration",
@@ -220,6 +247,32 @@ func init() {
 	clusterShutdownCmd.Flags().Bool("force", false, "Force shutdown even if nodes don't respond")
 	clusterShutdownCmd.Flags().Duration("timeout", 120*time.Second, "Maximum time to wait per phase")
 	clusterShutdownCmd.Flags().Bool("dry-run", false, "Print phase plan without executing")
+	clusterCmd.AddCommand(clusterReloadCmd)
+
+	adminCmd.AddCommand(nodeCmd)
+	nodeCmd.AddCommand(nodeDrainCmd)
+	nodeDrainCmd.Flags().Bool("evacuate", false, "Stop instances so they can be started on other nodes")
+	nodeDrainCmd.Flags().Duration("timeout", 0, "Maximum time to drain (default: the node's drain_timeout_seconds)")
+
+	adminCmd.AddCommand(instanceCmd)
+	instanceCmd.AddCommand(instanceForceTerminateCmd)
+	instanceForceTerminateCmd.Flags().Bool("yes", false, "Terminate without prompting")
+
+	adminCmd.AddCommand(stateCmd)
+	stateCmd.AddCommand(stateExportCmd)
+	stateCmd.AddCommand(stateImportCmd)
+	stateExportCmd.Flags().String("key", "", "Have a daemon write the archive to this key in the Predastore bucket")
+	stateImportCmd.Flags().String("key", "", "Have a daemon restore the archive at this key in the Predastore bucket")
+	stateImportCmd.Flags().Bool("replace", false, "Clear the state the cluster holds before restoring")
+	stateImportCmd.Flags().Bool("yes", false, "Replace without prompting")
+	addOutputFlag(stateCmd)
+
+	adminCmd.AddCommand(jetStreamCmd)
+	adminCmd.AddCommand(eventsCmd)
+	eventsCmd.Flags().Duration("since", 0, "Replay the events kept from this long ago before tailing")
+	addOutputFlag(instanceCmd)
+	addOutputFlag(jetStreamCmd)
+	addOutputFlag(eventsCmd)
 
 	adminCmd.AddCommand(imagesCmd)
 	imagesCmd.AddCommand(imagesImportCmd)
@@ -0,0 +1,338 @@
+/*
+Copyright © 2026 Mulga Defense Corporation
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/daemon"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+var instanceCmd = &cobra.Command{
+	Use:   "instance",
+	Short: "Operate on instances outside the EC2 API",
+	Long:  `Operate on instances the EC2 API cannot reach, such as those left behind on a lost node.`,
+}
+
+var instanceForceTerminateCmd = &cobra.Command{
+	Use:   "force-terminate <instance-id>",
+	Short: "Terminate an orphaned instance",
+	Long: `Terminate an instance left in the state of a node that is lost or has left
+the cluster, or stranded in the shared stopped KV. Its volumes, public IP and
+network interface are cleaned up as by TerminateInstances, and termination
+protection is ignored. Instances on a node that is up are refused; terminate
+those with TerminateInstances.`,
+	Args: cobra.ExactArgs(1),
+	Run:  runInstanceForceTerminate,
+}
+
+var jetStreamCmd = &cobra.Command{
+	Use:     "jetstream [bucket]",
+	Aliases: []string{"js"},
+	Short:   "Inspect JetStream state",
+	Long: `List the JetStream streams and KV buckets with their message counts and sizes.
+Given a KV bucket, list its keys with their revisions and sizes; with
+--output json the values are included.`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  runJetStream,
+}
+
+var eventsCmd = &cobra.Command{
+	Use:   "events",
+	Short: "Tail the event stream",
+	Long: `Print instance and volume events as the daemons publish them, until
+interrupted. With --since, first replay the events the stream kept from that
+long ago. With --output json, each event is printed as one line of JSON.`,
+	Run: runEvents,
+}
+
+// forceTerminateTimeout bounds the wait for a force-terminate, which deletes
+// the instance's volumes one by one.
+const forceTerminateTimeout = 2 * time.Minute
+
+func runInstanceForceTerminate(cmd *cobra.Command, args []string) {
+	instanceID := args[0]
+	yes, _ := cmd.Flags().GetBool("yes")
+
+	if !yes {
+		fmt.Printf("Force-terminate %s? Its volumes marked DeleteOnTermination are deleted. [y/N] ", instanceID)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		answer = strings.TrimSpace(strings.ToLower(answer))
+		if answer != "y" && answer != "yes" {
+			fmt.Println("Aborted.")
+			return
+		}
+	}
+
+	_, nc, err := loadConfigAndConnect()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer nc.Close()
+
+	resp, err := utils.NATSRequest[daemon.ForceTerminateResponse](nc, subjects.ForceTerminate,
+		daemon.ForceTerminateRequest{InstanceID: instanceID}, forceTerminateTimeout, utils.GlobalAccountID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", describeError(err))
+		os.Exit(1)
+	}
+
+	if jsonOutput(cmd) {
+		printJSON(resp)
+		return
+	}
+	if resp.Node != "" {
+		fmt.Printf("Instance %s terminated (was on %s)\n", resp.InstanceID, resp.Node)
+	} else {
+		fmt.Printf("Instance %s terminated\n", resp.InstanceID)
+	}
+}
+
+// describeError returns err's message with the detail of an AWS error
+// appended, as its Error method gives the bare code.
+func describeError(err error) string {
+	var awsErr *awserrors.Error
+	if errors.As(err, &awsErr) && awsErr.Message != "" {
+		return awsErr.Code + ": " + awsErr.Message
+	}
+	return err.Error()
+}
+
+// jetStreamInfo is a JetStream stream or KV bucket as spx admin jetstream
+// lists it.
+type jetStreamInfo struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	Messages  uint64 `json:"messages"`
+	Bytes     uint64 `json:"bytes"`
+	Replicas  int    `json:"replicas"`
+	Consumers int    `json:"consumers"`
+}
+
+// kvStreamPrefix is the prefix of the streams that back KV buckets.
+const kvStreamPrefix = "KV_"
+
+// newJetStreamInfo describes the stream in info, naming a KV bucket's stream
+// after the bucket.
+func newJetStreamInfo(info *nats.StreamInfo) jetStreamInfo {
+	s := jetStreamInfo{
+		Name:      info.Config.Name,
+		Kind:      "stream",
+		Messages:  info.State.Msgs,
+		Bytes:     info.State.Bytes,
+		Replicas:  info.Config.Replicas,
+		Consumers: info.State.Consumers,
+	}
+	if bucket, ok := strings.CutPrefix(s.Name, kvStreamPrefix); ok {
+		s.Name = bucket
+		s.Kind = "kv"
+	}
+	return s
+}
+
+// kvKeyInfo is one key of a KV bucket. Value holds the key's value when it
+// is JSON, as the buckets the daemons write are.
+type kvKeyInfo struct {
+	Key      string          `json:"key"`
+	Revision uint64          `json:"revision"`
+	Bytes    int             `json:"bytes"`
+	Updated  time.Time       `json:"updated"`
+	Value    json.RawMessage `json:"value,omitempty"`
+}
+
+func runJetStream(cmd *cobra.Command, args []string) {
+	_, nc, err := loadConfigAndConnect()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer nc.Close()
+
+	js, err := nc.JetStream()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(args) == 1 {
+		keys, err := listKVKeys(js, args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if jsonOutput(cmd) {
+			printJSON(keys)
+			return
+		}
+		tableData := pterm.TableData{{"KEY", "REVISION", "BYTES", "UPDATED"}}
+		for _, k := range keys {
+			tableData = append(tableData, []string{
+				k.Key,
+				strconv.FormatUint(k.Revision, 10),
+				strconv.Itoa(k.Bytes),
+				k.Updated.Format(time.RFC3339),
+			})
+		}
+		printTable(tableData)
+		return
+	}
+
+	streams := []jetStreamInfo{}
+	for info := range js.StreamsInfo() {
+		streams = append(streams, newJetStreamInfo(info))
+	}
+	sort.Slice(streams, func(i, j int) bool {
+		if streams[i].Kind != streams[j].Kind {
+			return streams[i].Kind < streams[j].Kind
+		}
+		return streams[i].Name < streams[j].Name
+	})
+
+	if jsonOutput(cmd) {
+		printJSON(streams)
+		return
+	}
+	tableData := pterm.TableData{{"NAME", "KIND", "MESSAGES", "BYTES", "REPLICAS", "CONSUMERS"}}
+	for _, s := range streams {
+		tableData = append(tableData, []string{
+			s.Name,
+			s.Kind,
+			strconv.FormatUint(s.Messages, 10),
+			strconv.FormatUint(s.Bytes, 10),
+			strconv.Itoa(s.Replicas),
+			strconv.Itoa(s.Consumers),
+		})
+	}
+	printTable(tableData)
+}
+
+// listKVKeys returns the keys of a KV bucket, sorted, with their latest
+// values.
+func listKVKeys(js nats.JetStreamContext, bucket string) ([]kvKeyInfo, error) {
+	kv, err := js.KeyValue(bucket)
+	if err != nil {
+		return nil, fmt.Errorf("open bucket %s: %w", bucket, err)
+	}
+	names, err := kv.Keys()
+	if err != nil && !errors.Is(err, nats.ErrNoKeysFound) {
+		return nil, fmt.Errorf("list keys of %s: %w", bucket, err)
+	}
+	sort.Strings(names)
+
+	keys := []kvKeyInfo{}
+	for _, name := range names {
+		entry, err := kv.Get(name)
+		if err != nil {
+			if errors.Is(err, nats.ErrKeyNotFound) {
+				continue // deleted since it was listed
+			}
+			return nil, fmt.Errorf("get %s: %w", name, err)
+		}
+		k := kvKeyInfo{
+			Key:      name,
+			Revision: entry.Revision(),
+			Bytes:    len(entry.Value()),
+			Updated:  entry.Created(),
+		}
+		if json.Valid(entry.Value()) {
+			k.Value = entry.Value()
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+func runEvents(cmd *cobra.Command, args []string) {
+	since, _ := cmd.Flags().GetDuration("since")
+	asJSON := jsonOutput(cmd)
+
+	_, nc, err := loadConfigAndConnect()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer nc.Close()
+
+	// Events arrive on the NATS client's goroutine, one at a time, so lines
+	// are never interleaved.
+	handler := func(msg *nats.Msg) {
+		if asJSON {
+			fmt.Println(string(msg.Data))
+			return
+		}
+		var event types.Event
+		if err := json.Unmarshal(msg.Data, &event); err != nil {
+			return
+		}
+		fmt.Println(formatEvent(event))
+	}
+
+	subject := utils.Subject(subjects.Events)
+	var sub *nats.Subscription
+	if since > 0 {
+		js, jsErr := nc.JetStream()
+		if jsErr != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", jsErr)
+			os.Exit(1)
+		}
+		sub, err = js.Subscribe(subject, handler, nats.OrderedConsumer(), nats.StartTime(time.Now().Add(-since)))
+	} else {
+		sub, err = nc.Subscribe(subject, handler)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to subscribe to events: %v\n", err)
+		os.Exit(1)
+	}
+	defer sub.Unsubscribe()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+}
+
+// formatEvent renders an event as one line: its time, type, account and
+// resources, then its detail as JSON.
+func formatEvent(e types.Event) string {
+	resources := "-"
+	if len(e.Resources) > 0 {
+		resources = strings.Join(e.Resources, ",")
+	}
+	detail, err := json.Marshal(e.Detail)
+	if err != nil {
+		detail = []byte("-")
+	}
+	return fmt.Sprintf("%s  %-36s %s  %s  %s", e.Time, e.DetailType, e.Account, resources, detail)
+}
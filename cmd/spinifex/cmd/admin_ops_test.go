@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOutput(t *testing.T) {
+	for format, want := range map[string]bool{"": false, "table": false, "json": true} {
+		got, err := parseOutput(format)
+		require.NoError(t, err, format)
+		assert.Equal(t, want, got, format)
+	}
+	_, err := parseOutput("yaml")
+	assert.Error(t, err)
+}
+
+func TestNewJetStreamInfo(t *testing.T) {
+	info := &nats.StreamInfo{
+		Config: nats.StreamConfig{Name: "KV_spinifex-instance-state", Replicas: 3},
+		State:  nats.StreamState{Msgs: 4, Bytes: 2048, Consumers: 1},
+	}
+	assert.Equal(t, jetStreamInfo{Name: "spinifex-instance-state", Kind: "kv", Messages: 4, Bytes: 2048, Replicas: 3, Consumers: 1}, newJetStreamInfo(info))
+
+	info.Config.Name = "spinifex-events"
+	assert.Equal(t, "stream", newJetStreamInfo(info).Kind)
+	assert.Equal(t, "spinifex-events", newJetStreamInfo(info).Name)
+}
+
+func TestFormatEvent(t *testing.T) {
+	line := formatEvent(types.Event{
+		DetailType: "EC2 Instance State-change Notification",
+		Account:    "000000000001",
+		Time:       "2026-03-04T05:06:07Z",
+		Resources:  []string{"arn:aws:ec2:ap-southeast-2:000000000001:instance/i-1"},
+		Detail:     types.InstanceStateChangeDetail{InstanceID: "i-1", State: "running", PreviousState: "pending"},
+	})
+	assert.Contains(t, line, "2026-03-04T05:06:07Z  EC2 Instance State-change Notification")
+	assert.Contains(t, line, "000000000001  arn:aws:ec2:ap-southeast-2:000000000001:instance/i-1")
+	assert.Contains(t, line, `"instance-id":"i-1"`)
+
+	assert.Contains(t, formatEvent(types.Event{DetailType: "test"}), "  -  null")
+}
+
+func TestDescribeError(t *testing.T) {
+	err := &awserrors.Error{Code: awserrors.ErrorIncorrectInstanceState, Message: "instance i-1 is on node node1, which is up"}
+	assert.Equal(t, "IncorrectInstanceState: instance i-1 is on node node1, which is up", describeError(err))
+	assert.Equal(t, "IncorrectInstanceState", describeError(&awserrors.Error{Code: awserrors.ErrorIncorrectInstanceState}))
+	assert.Equal(t, "no responders", describeError(errors.New("no responders")))
+}
@@ -0,0 +1,255 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mulgadc/spinifex/spinifex/admin"
+	"github.com/mulgadc/spinifex/spinifex/backup"
+	"github.com/mulgadc/spinifex/spinifex/config"
+	"github.com/mulgadc/spinifex/spinifex/daemon"
+	"github.com/mulgadc/spinifex/spinifex/objectstore"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/spf13/cobra"
+)
+
+var stateCmd = &cobra.Command{
+	Use:   "state",
+	Short: "Back up and restore the cluster state",
+	Long: `Export the cluster state to a versioned JSON archive and restore it on a
+fresh cluster. The archive holds the Spinifex JetStream KV buckets (instances,
+reservations, volumes, snapshots, VPC and IAM state) with their schema
+versions, and the resource tags, key pairs and volume, snapshot and image
+metadata in Predastore. Block data stays in Predastore; back it up separately.`,
+}
+
+var stateExportCmd = &cobra.Command{
+	Use:   "export [file]",
+	Short: "Export the cluster state to an archive",
+	Long: `Write the cluster state to file, or to standard output when file is "-".
+With --key, a daemon writes the archive to that key in the Predastore bucket
+instead. An existing file is not overwritten. The archive holds credentials:
+keep it as safe as the cluster.`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  runStateExport,
+}
+
+var stateImportCmd = &cobra.Command{
+	Use:   "import [file]",
+	Short: "Restore the cluster state from an archive",
+	Long: `Restore an archive written by export, from file ("-" for standard input) or,
+with --key, from that key in the Predastore bucket. The archive's version and
+each bucket's schema version are checked first; an archive from a newer
+release is refused, and one from an older release is migrated when the
+services next start.
+
+Only empty buckets are restored into unless --replace is given, which clears
+the state the cluster holds first. Restart the services on every node once
+the restore is done to load the restored state.`,
+	Args: cobra.MaximumNArgs(1),
+	Run:  runStateImport,
+}
+
+// stateBackupTimeout bounds an export or import through a daemon.
+const stateBackupTimeout = 5 * time.Minute
+
+func runStateExport(cmd *cobra.Command, args []string) {
+	key, _ := cmd.Flags().GetString("key")
+	file, err := stateArchiveArg(args, key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	cfg, nc, err := loadConfigAndConnect()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer nc.Close()
+
+	if key != "" {
+		resp, err := utils.NATSRequest[daemon.StateBackupResponse](nc, subjects.StateExport,
+			daemon.StateExportRequest{Key: key}, stateBackupTimeout, utils.GlobalAccountID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", describeError(err))
+			os.Exit(1)
+		}
+		if jsonOutput(cmd) {
+			printJSON(resp)
+			return
+		}
+		fmt.Printf("Exported %s to s3://%s/%s\n", describeSummary(resp.Summary), resp.Bucket, resp.Key)
+		return
+	}
+
+	js, err := nc.JetStream()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	store, bucket, err := predastoreStore(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	archive, err := backup.Export(js, store, bucket)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if file == "-" {
+		if err := archive.Write(os.Stdout); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if err := writeStateArchive(file, archive); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if jsonOutput(cmd) {
+		printJSON(archive.Summary())
+		return
+	}
+	fmt.Printf("Exported %s to %s\n", describeSummary(archive.Summary()), file)
+}
+
+func runStateImport(cmd *cobra.Command, args []string) {
+	key, _ := cmd.Flags().GetString("key")
+	replace, _ := cmd.Flags().GetBool("replace")
+	yes, _ := cmd.Flags().GetBool("yes")
+	file, err := stateArchiveArg(args, key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if replace && !yes {
+		fmt.Print("Replace the cluster's state with the archive? State not in the archive is lost. [y/N] ")
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		answer = strings.TrimSpace(strings.ToLower(answer))
+		if answer != "y" && answer != "yes" {
+			fmt.Println("Aborted.")
+			return
+		}
+	}
+
+	cfg, nc, err := loadConfigAndConnect()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer nc.Close()
+
+	var summary backup.Summary
+	if key != "" {
+		resp, err := utils.NATSRequest[daemon.StateBackupResponse](nc, subjects.StateImport,
+			daemon.StateImportRequest{Key: key, Replace: replace}, stateBackupTimeout, utils.GlobalAccountID)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s\n", describeError(err))
+			os.Exit(1)
+		}
+		summary = resp.Summary
+	} else {
+		archive, err := readStateArchive(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		js, err := nc.JetStream()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		store, bucket, err := predastoreStore(cfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		summary, err = backup.Import(js, store, bucket, archive, backup.ImportOptions{
+			Replicas: len(cfg.Nodes),
+			Replace:  replace,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if jsonOutput(cmd) {
+		printJSON(summary)
+		return
+	}
+	fmt.Printf("Restored %s.\nRestart the services on every node to load it: sudo systemctl restart spinifex.target\n", describeSummary(summary))
+}
+
+// stateArchiveArg returns the archive file named in args, requiring exactly
+// one of a file and a Predastore key.
+func stateArchiveArg(args []string, key string) (string, error) {
+	switch {
+	case len(args) == 1 && key != "":
+		return "", errors.New("give a file or --key, not both")
+	case len(args) == 0 && key == "":
+		return "", errors.New("give a file, or --key for an archive in the Predastore bucket")
+	case len(args) == 1:
+		return args[0], nil
+	}
+	return "", nil
+}
+
+// predastoreStore returns the object store and bucket of this node's
+// Predastore.
+func predastoreStore(cfg *config.ClusterConfig) (objectstore.ObjectStore, string, error) {
+	predastore := cfg.Nodes[cfg.Node].Predastore
+	storeCfg := predastore.ObjectStore()
+	storeCfg.Endpoint = admin.DialTarget(storeCfg.Endpoint)
+	store, err := objectstore.New(storeCfg)
+	if err != nil {
+		return nil, "", err
+	}
+	return store, predastore.Bucket, nil
+}
+
+// writeStateArchive writes archive to path, readable only by its owner as it
+// holds credentials.
+func writeStateArchive(path string, archive *backup.Archive) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600) //nolint:gosec // operator-chosen path
+	if err != nil {
+		return err
+	}
+	if err := archive.Write(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readStateArchive reads and checks the archive at path, or on standard
+// input for "-".
+func readStateArchive(path string) (*backup.Archive, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path) //nolint:gosec // operator-chosen path
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	return backup.Read(r)
+}
+
+// describeSummary renders what an archive holds, as "3 buckets (120 keys)
+// and 14 objects".
+func describeSummary(s backup.Summary) string {
+	return fmt.Sprintf("%d buckets (%d keys) and %d objects", s.Buckets, s.Entries, s.Objects)
+}
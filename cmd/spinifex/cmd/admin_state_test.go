@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mulgadc/spinifex/spinifex/backup"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStateArchiveArg(t *testing.T) {
+	file, err := stateArchiveArg([]string{"state.json"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "state.json", file)
+
+	file, err = stateArchiveArg(nil, "backups/state/a.json")
+	require.NoError(t, err)
+	assert.Empty(t, file)
+
+	_, err = stateArchiveArg([]string{"state.json"}, "backups/state/a.json")
+	assert.Error(t, err)
+	_, err = stateArchiveArg(nil, "")
+	assert.Error(t, err)
+}
+
+func TestWriteReadStateArchive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	archive := &backup.Archive{Format: backup.Format, Version: backup.Version, Buckets: []backup.Bucket{{
+		Name: "spinifex-vpc-vpcs", SchemaVersion: 1, History: 1,
+		Entries: []backup.Entry{{Key: "000000000001.vpc-1", Value: []byte(`{}`)}},
+	}}}
+	require.NoError(t, writeStateArchive(path, archive))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm(), "archives hold credentials")
+	assert.Error(t, writeStateArchive(path, archive), "an existing archive is not overwritten")
+
+	read, err := readStateArchive(path)
+	require.NoError(t, err)
+	assert.Equal(t, archive.Buckets, read.Buckets)
+	assert.Equal(t, "1 buckets (1 keys) and 0 objects", describeSummary(read.Summary()))
+}
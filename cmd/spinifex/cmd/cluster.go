@@ -3,11 +3,16 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/mulgadc/spinifex/spinifex/config"
 	"github.com/mulgadc/spinifex/spinifex/daemon"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/nats-io/nats.go"
 	"github.com/spf13/cobra"
 )
@@ -93,7 +98,7 @@ func runClusterShutdown(cmd *cobra.Command, args []string) {
 		if phase == "infra" {
 			// INFRA is fire-and-forget — NATS is going down, no ACKs possible
 			fmt.Printf("[INFRA] Sending final shutdown to all nodes...\n")
-			if err := nc.Publish(topic, reqData); err != nil {
+			if err := nc.Publish(utils.Subject(topic), reqData); err != nil {
 				fmt.Fprintf(os.Stderr, "Error publishing infra shutdown: %v\n", err)
 			}
 			nc.Flush()
@@ -106,7 +111,7 @@ func runClusterShutdown(cmd *cobra.Command, args []string) {
 		// For DRAIN phase, subscribe to progress updates
 		var progressSub *nats.Subscription
 		if phase == "drain" {
-			progressSub, err = nc.Subscribe("spinifex.cluster.shutdown.progress", func(msg *nats.Msg) {
+			progressSub, err = nc.Subscribe(utils.Subject("spinifex.cluster.shutdown.progress"), func(msg *nats.Msg) {
 				var progress daemon.ShutdownProgress
 				if err := json.Unmarshal(msg.Data, &progress); err != nil {
 					return
@@ -160,8 +165,70 @@ func runClusterShutdown(cmd *cobra.Command, args []string) {
 	fmt.Printf("Cluster shutdown complete (%s)\n", time.Since(start).Round(time.Millisecond))
 }
 
+// nodeDrainGrace is how long runNodeDrain waits for a node's answer beyond
+// its drain timeout.
+const nodeDrainGrace = 30 * time.Second
+
+// runNodeDrain drains one node and reports what happened to its instances.
+func runNodeDrain(cmd *cobra.Command, args []string) {
+	node := args[0]
+	evacuate, _ := cmd.Flags().GetBool("evacuate")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+
+	cfg, nc, err := loadConfigAndConnect()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer nc.Close()
+
+	wait := timeout
+	if wait == 0 {
+		wait = config.DefaultDrainTimeout
+		if nodeCfg, ok := cfg.Nodes[node]; ok {
+			wait = nodeCfg.Daemon.DrainTimeout()
+		}
+	}
+
+	reqData, err := json.Marshal(daemon.NodeDrainRequest{Evacuate: evacuate, Timeout: int(timeout.Seconds())})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error marshaling request: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Draining %s (timeout %s)...\n", node, wait)
+	msg, err := nc.Request(utils.Subject(subjects.NodeDrain(node)), reqData, wait+nodeDrainGrace)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: node %s did not answer: %v\n", node, err)
+		os.Exit(1)
+	}
+
+	var resp daemon.NodeDrainResponse
+	if err := json.Unmarshal(msg.Data, &resp); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: invalid response from %s: %v\n", node, err)
+		os.Exit(1)
+	}
+	if len(resp.Stopped) > 0 {
+		fmt.Printf("  Stopped: %s\n", strings.Join(resp.Stopped, ", "))
+	}
+	if len(resp.Evacuated) > 0 {
+		fmt.Printf("  Evacuated: %s\n", strings.Join(resp.Evacuated, ", "))
+	}
+	if resp.Error != "" {
+		fmt.Fprintf(os.Stderr, "Node %s drained with errors: %s\n", resp.Node, resp.Error)
+		os.Exit(1)
+	}
+	fmt.Printf("Node %s drained, daemon exiting\n", resp.Node)
+}
+
 // collectShutdownACKs publishes a shutdown request and collects ACKs from nodes.
 func collectShutdownACKs(nc *nats.Conn, topic string, reqData []byte, nodeCount int, timeout time.Duration) ([]daemon.ShutdownACK, error) {
+	return collectNodeReplies[daemon.ShutdownACK](nc, topic, reqData, nodeCount, timeout)
+}
+
+// collectNodeReplies publishes a request on a fan-out subject and collects
+// up to nodeCount replies, skipping any that do not decode as T.
+func collectNodeReplies[T any](nc *nats.Conn, topic string, reqData []byte, nodeCount int, timeout time.Duration) ([]T, error) {
 	inbox := nats.NewInbox()
 	sub, err := nc.SubscribeSync(inbox)
 	if err != nil {
@@ -169,14 +236,14 @@ func collectShutdownACKs(nc *nats.Conn, topic string, reqData []byte, nodeCount
 	}
 	defer sub.Unsubscribe()
 
-	if err := nc.PublishRequest(topic, inbox, reqData); err != nil {
+	if err := nc.PublishRequest(utils.Subject(topic), inbox, reqData); err != nil {
 		return nil, fmt.Errorf("failed to publish request: %w", err)
 	}
 	nc.Flush()
 
-	var acks []daemon.ShutdownACK
+	var replies []T
 	deadline := time.Now().Add(timeout)
-	for len(acks) < nodeCount {
+	for len(replies) < nodeCount {
 		remaining := time.Until(deadline)
 		if remaining <= 0 {
 			break
@@ -185,11 +252,61 @@ func collectShutdownACKs(nc *nats.Conn, topic string, reqData []byte, nodeCount
 		if err != nil {
 			break
 		}
-		var ack daemon.ShutdownACK
-		if err := json.Unmarshal(msg.Data, &ack); err != nil {
+		var reply T
+		if err := json.Unmarshal(msg.Data, &reply); err != nil {
+			continue
+		}
+		replies = append(replies, reply)
+	}
+	return replies, nil
+}
+
+// configReloadTimeout is how long runClusterReload waits for the nodes to
+// answer.
+const configReloadTimeout = 10 * time.Second
+
+// runClusterReload has every daemon re-read its config file and reports the
+// settings each applied and rejected.
+func runClusterReload(cmd *cobra.Command, args []string) {
+	cfg, nc, err := loadConfigAndConnect()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer nc.Close()
+
+	nodeCount := len(cfg.Nodes)
+	replies, err := collectNodeReplies[daemon.ConfigReloadResponse](nc, subjects.ConfigReload, []byte("{}"), nodeCount, configReloadTimeout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	failed := false
+	answered := make(map[string]bool, len(replies))
+	for _, r := range replies {
+		answered[r.Node] = true
+		if r.Error != "" {
+			failed = true
+			fmt.Printf("%s: reload failed: %s\n", r.Node, r.Error)
 			continue
 		}
-		acks = append(acks, ack)
+		if len(r.Applied) == 0 {
+			fmt.Printf("%s: no changes applied\n", r.Node)
+		} else {
+			fmt.Printf("%s: applied %s\n", r.Node, strings.Join(r.Applied, ", "))
+		}
+		if len(r.Rejected) > 0 {
+			fmt.Printf("%s: restart required for %s\n", r.Node, strings.Join(r.Rejected, ", "))
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(cfg.Nodes)) {
+		if !answered[name] {
+			failed = true
+			fmt.Printf("%s: no response\n", name)
+		}
+	}
+	if failed {
+		os.Exit(1)
 	}
-	return acks, nil
 }
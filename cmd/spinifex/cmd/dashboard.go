@@ -0,0 +1,648 @@
+/*
+Copyright © 2026 Mulga Defense Corporation
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mulgadc/spinifex/cmd/installer/branding"
+	"github.com/mulgadc/spinifex/spinifex/daemon"
+	gateway_ec2_instance "github.com/mulgadc/spinifex/spinifex/gateway/ec2/instance"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/nats-io/nats.go"
+	"github.com/spf13/cobra"
+)
+
+var dashboardCmd = &cobra.Command{
+	Use:     "dashboard",
+	Aliases: []string{"tui"},
+	Short:   "Live terminal dashboard of the cluster",
+	Long: `Show the cluster's nodes, instances, volumes and events in a terminal UI that
+refreshes itself, with keys to start, stop and terminate instances. It talks
+to the daemons over NATS, so it works where the web UI is not deployed.
+
+Keys: tab/shift+tab or 1-4 switch panes, up/down or j/k move, s starts,
+x stops and t terminates the selected instance, r refreshes, q quits.`,
+	Run: runDashboard,
+}
+
+func init() {
+	rootCmd.AddCommand(dashboardCmd)
+	dashboardCmd.Flags().Duration("interval", 5*time.Second, "How often to refresh nodes and instances")
+	dashboardCmd.Flags().Duration("timeout", 2*time.Second, "Timeout for collecting responses from nodes")
+}
+
+// dashboardEventBuffer is how many events the dashboard keeps.
+const dashboardEventBuffer = 200
+
+func runDashboard(cmd *cobra.Command, args []string) {
+	interval, _ := cmd.Flags().GetDuration("interval")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+
+	cfg, nc, err := loadConfigAndConnect()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer nc.Close()
+
+	src := &natsDashboardSource{nc: nc, nodeCount: len(cfg.Nodes), timeout: timeout}
+	if jsm, err := daemon.NewJetStreamManager(nc, 1); err == nil && jsm.BindKVBucket() == nil {
+		src.jsm = jsm
+	}
+
+	// Events are dropped rather than block the NATS client when the
+	// dashboard falls behind.
+	events := make(chan types.Event, dashboardEventBuffer)
+	sub, err := nc.Subscribe(utils.Subject(subjects.Events), func(msg *nats.Msg) {
+		var event types.Event
+		if err := json.Unmarshal(msg.Data, &event); err != nil {
+			return
+		}
+		select {
+		case events <- event:
+		default:
+		}
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to subscribe to events: %v\n", err)
+		os.Exit(1)
+	}
+	defer sub.Unsubscribe()
+
+	p := tea.NewProgram(newDashboardModel(src, events, interval), tea.WithAltScreen())
+	if _, err := p.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// ── Source ────────────────────────────────────────────────────────────────────
+
+// dashboardInstance is an instance as the dashboard lists it. Node is empty
+// for an instance stopped in the shared KV.
+type dashboardInstance struct {
+	types.VMInfo
+	Node string
+}
+
+// dashboardSnapshot is the cluster's state as read at one refresh.
+type dashboardSnapshot struct {
+	Nodes     []types.NodeStatusResponse
+	Instances []dashboardInstance
+}
+
+// instanceAction is a lifecycle action the dashboard takes on an instance.
+type instanceAction string
+
+const (
+	actionStart     instanceAction = "start"
+	actionStop      instanceAction = "stop"
+	actionTerminate instanceAction = "terminate"
+)
+
+// dashboardSource reads the cluster's state and acts on its instances.
+type dashboardSource interface {
+	Snapshot() (dashboardSnapshot, error)
+	Act(action instanceAction, instance dashboardInstance) error
+}
+
+// natsDashboardSource reads the cluster's state from the daemons' fan-out
+// subjects and the shared stopped KV, and acts on instances as the gateway
+// does for their owning account.
+type natsDashboardSource struct {
+	nc        *nats.Conn
+	jsm       *daemon.JetStreamManager
+	nodeCount int
+	timeout   time.Duration
+}
+
+func (s *natsDashboardSource) Snapshot() (dashboardSnapshot, error) {
+	var snap dashboardSnapshot
+
+	nodes, err := collectNodeReplies[types.NodeStatusResponse](s.nc, subjects.NodeStatus, nil, s.nodeCount, s.timeout)
+	if err != nil {
+		return snap, err
+	}
+	snap.Nodes = nodes
+
+	vms, err := collectNodeReplies[types.NodeVMsResponse](s.nc, "spinifex.node.vms", nil, s.nodeCount, s.timeout)
+	if err != nil {
+		return snap, err
+	}
+	for _, resp := range vms {
+		for _, v := range resp.VMs {
+			snap.Instances = append(snap.Instances, dashboardInstance{VMInfo: v, Node: resp.Node})
+		}
+	}
+
+	if s.jsm != nil {
+		stopped, err := s.jsm.ListStoppedInstances()
+		if err != nil {
+			return snap, fmt.Errorf("list stopped instances: %w", err)
+		}
+		for _, v := range stopped {
+			snap.Instances = append(snap.Instances, dashboardInstance{VMInfo: stoppedVMInfo(v)})
+		}
+	}
+	return snap, nil
+}
+
+// stoppedVMInfo describes an instance from the shared stopped KV as the
+// daemons describe the instances they run.
+func stoppedVMInfo(v *vm.VM) types.VMInfo {
+	return types.VMInfo{
+		InstanceID:   v.ID,
+		Status:       string(v.Status),
+		InstanceType: v.InstanceType,
+		ManagedBy:    v.ManagedBy,
+		AccountID:    v.AccountID,
+		Volumes:      v.AttachedVolumes(),
+	}
+}
+
+func (s *natsDashboardSource) Act(action instanceAction, instance dashboardInstance) error {
+	accountID := instance.AccountID
+	if accountID == "" {
+		accountID = utils.GlobalAccountID
+	}
+	ids := []*string{aws.String(instance.InstanceID)}
+
+	var err error
+	switch action {
+	case actionStart:
+		_, err = gateway_ec2_instance.StartInstances(&ec2.StartInstancesInput{InstanceIds: ids}, s.nc, accountID)
+	case actionStop:
+		_, err = gateway_ec2_instance.StopInstances(&ec2.StopInstancesInput{InstanceIds: ids}, s.nc, accountID)
+	case actionTerminate:
+		_, err = gateway_ec2_instance.TerminateInstances(&ec2.TerminateInstancesInput{InstanceIds: ids}, s.nc, accountID)
+	default:
+		err = fmt.Errorf("unknown action %q", action)
+	}
+	return err
+}
+
+// ── Model ─────────────────────────────────────────────────────────────────────
+
+// dashboardPane is one of the dashboard's tabs.
+type dashboardPane int
+
+const (
+	paneNodes dashboardPane = iota
+	paneInstances
+	paneVolumes
+	paneEvents
+	paneCount
+)
+
+var paneTitles = [paneCount]string{"Nodes", "Instances", "Volumes", "Events"}
+
+type (
+	dashboardTickMsg     struct{}
+	dashboardEventMsg    types.Event
+	dashboardSnapshotMsg struct {
+		snap dashboardSnapshot
+		err  error
+		at   time.Time
+	}
+	dashboardActionMsg struct {
+		action   instanceAction
+		instance string
+		err      error
+	}
+)
+
+// dashboardModel is the bubbletea model of spx dashboard.
+type dashboardModel struct {
+	src      dashboardSource
+	events   <-chan types.Event
+	interval time.Duration
+
+	pane   dashboardPane
+	cursor [paneCount]int
+	width  int
+	height int
+
+	snap       dashboardSnapshot
+	volumes    [][]string
+	eventLog   []types.Event // newest first
+	refreshed  time.Time
+	refreshErr error
+
+	// confirm is the action awaiting y/n, on confirmTarget.
+	confirm       instanceAction
+	confirmTarget dashboardInstance
+	status        string
+}
+
+func newDashboardModel(src dashboardSource, events <-chan types.Event, interval time.Duration) dashboardModel {
+	return dashboardModel{src: src, events: events, interval: interval}
+}
+
+func (m dashboardModel) Init() tea.Cmd {
+	return tea.Batch(m.refresh(), m.tick(), m.waitForEvent())
+}
+
+// refresh reads a new snapshot from the source.
+func (m dashboardModel) refresh() tea.Cmd {
+	src := m.src
+	return func() tea.Msg {
+		snap, err := src.Snapshot()
+		return dashboardSnapshotMsg{snap: snap, err: err, at: time.Now()}
+	}
+}
+
+func (m dashboardModel) tick() tea.Cmd {
+	return tea.Tick(m.interval, func(time.Time) tea.Msg { return dashboardTickMsg{} })
+}
+
+// waitForEvent delivers the next event from the events channel.
+func (m dashboardModel) waitForEvent() tea.Cmd {
+	events := m.events
+	if events == nil {
+		return nil
+	}
+	return func() tea.Msg {
+		event, ok := <-events
+		if !ok {
+			return nil
+		}
+		return dashboardEventMsg(event)
+	}
+}
+
+// act runs action on instance in the background.
+func (m dashboardModel) act(action instanceAction, instance dashboardInstance) tea.Cmd {
+	src := m.src
+	return func() tea.Msg {
+		return dashboardActionMsg{action: action, instance: instance.InstanceID, err: src.Act(action, instance)}
+	}
+}
+
+func (m dashboardModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+		m.height = msg.Height
+		return m, nil
+
+	case dashboardTickMsg:
+		return m, tea.Batch(m.refresh(), m.tick())
+
+	case dashboardSnapshotMsg:
+		m.refreshErr = msg.err
+		if msg.err == nil {
+			m.setSnapshot(msg.snap)
+			m.refreshed = msg.at
+		}
+		return m, nil
+
+	case dashboardEventMsg:
+		m.eventLog = append([]types.Event{types.Event(msg)}, m.eventLog...)
+		if len(m.eventLog) > dashboardEventBuffer {
+			m.eventLog = m.eventLog[:dashboardEventBuffer]
+		}
+		if m.cursor[paneEvents] > 0 {
+			m.cursor[paneEvents]++ // stay on the selected event
+		}
+		m.clampCursor(paneEvents)
+		// An event means an instance or volume changed; show it now rather
+		// than at the next tick.
+		return m, tea.Batch(m.refresh(), m.waitForEvent())
+
+	case dashboardActionMsg:
+		if msg.err != nil {
+			m.status = fmt.Sprintf("%s %s failed: %s", msg.action, msg.instance, describeError(msg.err))
+		} else {
+			m.status = fmt.Sprintf("%s %s requested", msg.action, msg.instance)
+		}
+		return m, m.refresh()
+
+	case tea.KeyMsg:
+		return m.handleKey(msg)
+	}
+	return m, nil
+}
+
+func (m dashboardModel) handleKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	key := msg.String()
+	if key == "ctrl+c" {
+		return m, tea.Quit
+	}
+
+	if m.confirm != "" {
+		action, target := m.confirm, m.confirmTarget
+		m.confirm = ""
+		if key == "y" || key == "Y" {
+			m.status = fmt.Sprintf("%s %s...", action, target.InstanceID)
+			return m, m.act(action, target)
+		}
+		m.status = "cancelled"
+		return m, nil
+	}
+
+	switch key {
+	case "q", "esc":
+		return m, tea.Quit
+	case "tab", "right", "l":
+		m.pane = (m.pane + 1) % paneCount
+	case "shift+tab", "left", "h":
+		m.pane = (m.pane + paneCount - 1) % paneCount
+	case "1", "2", "3", "4":
+		m.pane = dashboardPane(key[0] - '1')
+	case "up", "k":
+		m.cursor[m.pane]--
+		m.clampCursor(m.pane)
+	case "down", "j":
+		m.cursor[m.pane]++
+		m.clampCursor(m.pane)
+	case "home", "g":
+		m.cursor[m.pane] = 0
+	case "end", "G":
+		m.cursor[m.pane] = m.rowCount(m.pane) - 1
+		m.clampCursor(m.pane)
+	case "r":
+		m.status = "refreshing..."
+		return m, m.refresh()
+	case "s", "x", "t":
+		instance, ok := m.selectedInstance()
+		if !ok {
+			m.status = "select an instance in the Instances pane first"
+			return m, nil
+		}
+		switch key {
+		case "s":
+			m.status = fmt.Sprintf("start %s...", instance.InstanceID)
+			return m, m.act(actionStart, instance)
+		case "x":
+			m.confirm = actionStop
+		case "t":
+			m.confirm = actionTerminate
+		}
+		m.confirmTarget = instance
+	}
+	return m, nil
+}
+
+// setSnapshot replaces the dashboard's state with snap, sorted for display.
+func (m *dashboardModel) setSnapshot(snap dashboardSnapshot) {
+	sort.Slice(snap.Nodes, func(i, j int) bool { return snap.Nodes[i].Node < snap.Nodes[j].Node })
+	// Instances on nodes first, by node, then those stopped in the shared KV.
+	sort.Slice(snap.Instances, func(i, j int) bool {
+		a, b := snap.Instances[i], snap.Instances[j]
+		if (a.Node == "") != (b.Node == "") {
+			return b.Node == ""
+		}
+		if a.Node != b.Node {
+			return a.Node < b.Node
+		}
+		return a.InstanceID < b.InstanceID
+	})
+	m.snap = snap
+	m.volumes = volumeRows(snap.Instances)
+	for pane := range paneCount {
+		m.clampCursor(pane)
+	}
+}
+
+// selectedInstance returns the instance under the cursor in the Instances
+// pane.
+func (m dashboardModel) selectedInstance() (dashboardInstance, bool) {
+	if m.pane != paneInstances || len(m.snap.Instances) == 0 {
+		return dashboardInstance{}, false
+	}
+	return m.snap.Instances[m.cursor[paneInstances]], true
+}
+
+func (m dashboardModel) rowCount(pane dashboardPane) int {
+	switch pane {
+	case paneNodes:
+		return len(m.snap.Nodes)
+	case paneInstances:
+		return len(m.snap.Instances)
+	case paneVolumes:
+		return len(m.volumes)
+	case paneEvents:
+		return len(m.eventLog)
+	}
+	return 0
+}
+
+func (m *dashboardModel) clampCursor(pane dashboardPane) {
+	m.cursor[pane] = max(0, min(m.cursor[pane], m.rowCount(pane)-1))
+}
+
+// ── View ──────────────────────────────────────────────────────────────────────
+
+var (
+	dashTitleStyle = lipgloss.NewStyle().
+			Foreground(branding.ColorPrimary).
+			Bold(true)
+
+	dashTabStyle = lipgloss.NewStyle().
+			Foreground(branding.ColorMuted).
+			Padding(0, 1)
+
+	dashActiveTabStyle = lipgloss.NewStyle().
+				Foreground(branding.ColorBackground).
+				Background(branding.ColorPrimary).
+				Bold(true).
+				Padding(0, 1)
+
+	dashHeaderStyle = lipgloss.NewStyle().
+			Foreground(branding.ColorAccent).
+			Bold(true)
+
+	dashSelectedStyle = lipgloss.NewStyle().
+				Foreground(branding.ColorBackground).
+				Background(branding.ColorPrimary)
+
+	dashMutedStyle = lipgloss.NewStyle().
+			Foreground(branding.ColorMuted)
+
+	dashWarningStyle = lipgloss.NewStyle().
+				Foreground(branding.ColorWarning).
+				Bold(true)
+
+	dashErrorStyle = lipgloss.NewStyle().
+			Foreground(branding.ColorError)
+)
+
+// dashboardChromeLines is how many lines the title, tabs and footer take.
+const dashboardChromeLines = 6
+
+func (m dashboardModel) View() string {
+	var b strings.Builder
+
+	title := dashTitleStyle.Render("Spinifex")
+	summary := fmt.Sprintf("%d nodes · %d instances", len(m.snap.Nodes), len(m.snap.Instances))
+	if !m.refreshed.IsZero() {
+		summary += " · refreshed " + m.refreshed.Format(time.TimeOnly)
+	}
+	b.WriteString(title + "  " + dashMutedStyle.Render(summary) + "\n")
+
+	tabs := make([]string, 0, paneCount)
+	for pane, name := range paneTitles {
+		label := fmt.Sprintf("%d %s", pane+1, name)
+		if dashboardPane(pane) == m.pane {
+			tabs = append(tabs, dashActiveTabStyle.Render(label))
+		} else {
+			tabs = append(tabs, dashTabStyle.Render(label))
+		}
+	}
+	b.WriteString(lipgloss.JoinHorizontal(lipgloss.Top, tabs...) + "\n\n")
+
+	header, rows := m.paneTable(m.pane)
+	height := m.height - dashboardChromeLines
+	if m.height == 0 {
+		height = 20
+	}
+	b.WriteString(renderDashboardTable(header, rows, m.cursor[m.pane], max(height, 1)))
+	b.WriteString("\n")
+
+	switch {
+	case m.confirm != "":
+		b.WriteString(dashWarningStyle.Render(fmt.Sprintf("%s %s? (y/n)", m.confirm, m.confirmTarget.InstanceID)))
+	case m.refreshErr != nil:
+		b.WriteString(dashErrorStyle.Render("refresh failed: " + m.refreshErr.Error()))
+	default:
+		b.WriteString(m.status)
+	}
+	b.WriteString("\n")
+	b.WriteString(dashMutedStyle.Render("tab/1-4 pane · ↑↓ move · s start · x stop · t terminate · r refresh · q quit"))
+	return b.String()
+}
+
+// paneTable returns the header and rows of pane.
+func (m dashboardModel) paneTable(pane dashboardPane) (header []string, rows [][]string) {
+	switch pane {
+	case paneNodes:
+		header = []string{"NAME", "STATUS", "IP", "CPU", "MEM", "VMs", "UPTIME"}
+		for _, n := range m.snap.Nodes {
+			rows = append(rows, []string{
+				n.Node,
+				n.Status,
+				n.Host,
+				fmt.Sprintf("%d/%d", n.AllocVCPU, n.TotalVCPU),
+				formatMemGB(n.AllocMemGB) + "/" + formatMemGB(n.TotalMemGB),
+				strconv.Itoa(n.VMCount),
+				formatUptime(n.Uptime),
+			})
+		}
+	case paneInstances:
+		header = []string{"INSTANCE", "STATE", "TYPE", "NODE", "ACCOUNT", "VCPU", "MEM"}
+		for _, i := range m.snap.Instances {
+			rows = append(rows, []string{
+				i.InstanceID,
+				i.Status,
+				i.InstanceType,
+				orDash(i.Node),
+				orDash(i.AccountID),
+				strconv.Itoa(i.VCPU),
+				formatMemGB(i.MemoryGB),
+			})
+		}
+	case paneVolumes:
+		header = []string{"VOLUME", "INSTANCE", "NODE", "DEVICE", "BOOT", "DELETE ON TERMINATION"}
+		rows = m.volumes
+	case paneEvents:
+		header = []string{"TIME", "TYPE", "RESOURCES", "DETAIL"}
+		for _, e := range m.eventLog {
+			detail, _ := json.Marshal(e.Detail)
+			rows = append(rows, []string{e.Time, e.DetailType, orDash(strings.Join(e.Resources, ",")), string(detail)})
+		}
+	}
+	return header, rows
+}
+
+// volumeRows lists the volumes attached to instances, one row per volume.
+func volumeRows(instances []dashboardInstance) [][]string {
+	var rows [][]string
+	for _, i := range instances {
+		for _, v := range i.Volumes {
+			rows = append(rows, []string{
+				v.VolumeID,
+				i.InstanceID,
+				orDash(i.Node),
+				orDash(v.DeviceName),
+				strconv.FormatBool(v.Boot),
+				strconv.FormatBool(v.DeleteOnTermination),
+			})
+		}
+	}
+	return rows
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// renderDashboardTable renders header and rows in aligned columns, showing
+// at most height lines and scrolling to keep the cursor row in view.
+func renderDashboardTable(header []string, rows [][]string, cursor, height int) string {
+	widths := make([]int, len(header))
+	for c, h := range header {
+		widths[c] = lipgloss.Width(h)
+	}
+	for _, row := range rows {
+		for c, cell := range row {
+			widths[c] = max(widths[c], lipgloss.Width(cell))
+		}
+	}
+	line := func(cells []string) string {
+		padded := make([]string, len(cells))
+		for c, cell := range cells {
+			padded[c] = cell + strings.Repeat(" ", widths[c]-lipgloss.Width(cell))
+		}
+		return strings.TrimRight(strings.Join(padded, "  "), " ")
+	}
+
+	var b strings.Builder
+	b.WriteString(dashHeaderStyle.Render(line(header)) + "\n")
+	if len(rows) == 0 {
+		b.WriteString(dashMutedStyle.Render("(none)") + "\n")
+		return b.String()
+	}
+
+	visible := max(height-1, 1)
+	start := max(0, cursor-visible+1)
+	end := min(len(rows), start+visible)
+	for r := start; r < end; r++ {
+		text := line(rows[r])
+		if r == cursor {
+			text = dashSelectedStyle.Render(text)
+		}
+		b.WriteString(text + "\n")
+	}
+	return b.String()
+}
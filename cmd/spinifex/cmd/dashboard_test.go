@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeDashboardSource struct {
+	snap  dashboardSnapshot
+	err   error
+	acted []string
+}
+
+func (f *fakeDashboardSource) Snapshot() (dashboardSnapshot, error) {
+	return f.snap, f.err
+}
+
+func (f *fakeDashboardSource) Act(action instanceAction, instance dashboardInstance) error {
+	f.acted = append(f.acted, string(action)+" "+instance.InstanceID+" "+instance.AccountID)
+	return f.err
+}
+
+func testDashboardSnapshot() dashboardSnapshot {
+	return dashboardSnapshot{
+		Nodes: []types.NodeStatusResponse{{Node: "node2"}, {Node: "node1"}},
+		Instances: []dashboardInstance{
+			{VMInfo: types.VMInfo{InstanceID: "i-stopped", Status: "stopped", AccountID: "111111111111"}},
+			{VMInfo: types.VMInfo{InstanceID: "i-b", Status: "running", AccountID: "222222222222"}, Node: "node1"},
+			{VMInfo: types.VMInfo{InstanceID: "i-a", Status: "running", Volumes: []types.VMVolume{
+				{VolumeID: "vol-root", DeviceName: "/dev/sda", Boot: true, DeleteOnTermination: true},
+			}}, Node: "node2"},
+		},
+	}
+}
+
+// press sends key to m and returns the updated model and command.
+func press(m dashboardModel, key string) (dashboardModel, tea.Cmd) {
+	var msg tea.KeyMsg
+	switch key {
+	case "tab":
+		msg = tea.KeyMsg{Type: tea.KeyTab}
+	case "shift+tab":
+		msg = tea.KeyMsg{Type: tea.KeyShiftTab}
+	case "down":
+		msg = tea.KeyMsg{Type: tea.KeyDown}
+	case "up":
+		msg = tea.KeyMsg{Type: tea.KeyUp}
+	default:
+		msg = tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(key)}
+	}
+	next, cmd := m.Update(msg)
+	return next.(dashboardModel), cmd
+}
+
+// loaded returns a dashboard model over src that has taken its snapshot.
+func loaded(t *testing.T, src *fakeDashboardSource) dashboardModel {
+	t.Helper()
+	m := newDashboardModel(src, nil, time.Second)
+	next, _ := m.Update(m.refresh()())
+	return next.(dashboardModel)
+}
+
+func TestDashboard_Snapshot(t *testing.T) {
+	m := loaded(t, &fakeDashboardSource{snap: testDashboardSnapshot()})
+
+	assert.Equal(t, "node1", m.snap.Nodes[0].Node)
+	var ids []string
+	for _, i := range m.snap.Instances {
+		ids = append(ids, i.InstanceID)
+	}
+	assert.Equal(t, []string{"i-b", "i-a", "i-stopped"}, ids)
+	assert.Equal(t, [][]string{{"vol-root", "i-a", "node2", "/dev/sda", "true", "true"}}, m.volumes)
+	assert.False(t, m.refreshed.IsZero())
+}
+
+func TestDashboard_SnapshotError(t *testing.T) {
+	src := &fakeDashboardSource{snap: testDashboardSnapshot()}
+	m := loaded(t, src)
+
+	src.err = errors.New("nats: timeout")
+	next, _ := m.Update(m.refresh()())
+	m = next.(dashboardModel)
+	assert.EqualError(t, m.refreshErr, "nats: timeout")
+	assert.Len(t, m.snap.Instances, 3, "keeps the last good snapshot")
+	assert.Contains(t, m.View(), "refresh failed: nats: timeout")
+}
+
+func TestDashboard_Navigation(t *testing.T) {
+	m := loaded(t, &fakeDashboardSource{snap: testDashboardSnapshot()})
+
+	m, _ = press(m, "tab")
+	assert.Equal(t, paneInstances, m.pane)
+	m, _ = press(m, "shift+tab")
+	m, _ = press(m, "shift+tab")
+	assert.Equal(t, paneEvents, m.pane)
+	m, _ = press(m, "2")
+	assert.Equal(t, paneInstances, m.pane)
+
+	for range 5 {
+		m, _ = press(m, "down")
+	}
+	assert.Equal(t, 2, m.cursor[paneInstances], "cursor stops at the last row")
+	m, _ = press(m, "up")
+	assert.Equal(t, 1, m.cursor[paneInstances])
+	assert.Equal(t, 0, m.cursor[paneNodes], "each pane has its own cursor")
+}
+
+func TestDashboard_Actions(t *testing.T) {
+	src := &fakeDashboardSource{snap: testDashboardSnapshot()}
+	m := loaded(t, src)
+
+	// Actions need an instance selected.
+	m, cmd := press(m, "s")
+	assert.Nil(t, cmd)
+	assert.Contains(t, m.status, "Instances pane")
+
+	m, _ = press(m, "2")
+	m, cmd = press(m, "s")
+	require.NotNil(t, cmd)
+	next, _ := m.Update(cmd())
+	m = next.(dashboardModel)
+	assert.Equal(t, []string{"start i-b 222222222222"}, src.acted)
+	assert.Equal(t, "start i-b requested", m.status)
+
+	// Stop and terminate wait for y.
+	m, _ = press(m, "down")
+	m, cmd = press(m, "t")
+	assert.Nil(t, cmd)
+	assert.Equal(t, actionTerminate, m.confirm)
+	assert.Contains(t, m.View(), "terminate i-a? (y/n)")
+	m, cmd = press(m, "n")
+	assert.Nil(t, cmd)
+	assert.Equal(t, "cancelled", m.status)
+	assert.Len(t, src.acted, 1)
+
+	m, _ = press(m, "x")
+	m, cmd = press(m, "y")
+	require.NotNil(t, cmd)
+	src.err = &awserrors.Error{Code: awserrors.ErrorIncorrectInstanceState, Message: "instance is stopping"}
+	next, _ = m.Update(cmd())
+	m = next.(dashboardModel)
+	assert.Equal(t, "stop i-a ", src.acted[1])
+	assert.Equal(t, "stop i-a failed: IncorrectInstanceState: instance is stopping", m.status)
+}
+
+func TestDashboard_Events(t *testing.T) {
+	m := loaded(t, &fakeDashboardSource{snap: testDashboardSnapshot()})
+	m, _ = press(m, "4")
+
+	for _, id := range []string{"i-1", "i-2"} {
+		next, cmd := m.Update(dashboardEventMsg(types.Event{DetailType: "EC2 Instance State-change Notification", Resources: []string{id}}))
+		m = next.(dashboardModel)
+		assert.NotNil(t, cmd, "an event refreshes the dashboard")
+	}
+	require.Len(t, m.eventLog, 2)
+	assert.Equal(t, []string{"i-2"}, m.eventLog[0].Resources, "newest first")
+
+	m, _ = press(m, "down")
+	next, _ := m.Update(dashboardEventMsg(types.Event{Resources: []string{"i-3"}}))
+	m = next.(dashboardModel)
+	assert.Equal(t, 2, m.cursor[paneEvents], "cursor stays on the selected event")
+
+	for range dashboardEventBuffer {
+		next, _ = m.Update(dashboardEventMsg(types.Event{}))
+		m = next.(dashboardModel)
+	}
+	assert.Len(t, m.eventLog, dashboardEventBuffer)
+}
+
+func TestRenderDashboardTable(t *testing.T) {
+	rows := [][]string{{"a", "1"}, {"bb", "2"}, {"c", "3"}, {"d", "4"}}
+
+	out := renderDashboardTable([]string{"NAME", "N"}, rows, 3, 3)
+	assert.NotContains(t, out, "a     1")
+	assert.NotContains(t, out, "bb    2")
+	assert.Contains(t, out, "c     3")
+	assert.Contains(t, out, "d")
+
+	assert.Contains(t, renderDashboardTable([]string{"NAME"}, nil, 0, 10), "(none)")
+}
@@ -28,6 +28,7 @@ import (
 
 	"github.com/mulgadc/spinifex/spinifex/admin"
 	"github.com/mulgadc/spinifex/spinifex/config"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
 	"github.com/mulgadc/spinifex/spinifex/types"
 	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/nats-io/nats.go"
@@ -49,6 +50,15 @@ var getNodesCmd = &cobra.Command{
 	Run:   runGetNodes,
 }
 
+var getHostsCmd = &cobra.Command{
+	Use:   "hosts",
+	Short: "Display the node registry",
+	Long: `Display every node the node registry has heard heartbeats from, with its
+version and capacity. Nodes that stopped sending heartbeats show as lost,
+with the instances that were running on them.`,
+	Run: runGetHosts,
+}
+
 var getVMsCmd = &cobra.Command{
 	Use:     "vms",
 	Aliases: []string{"instances"},
@@ -60,9 +70,11 @@ var getVMsCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(getCmd)
 	getCmd.AddCommand(getNodesCmd)
+	getCmd.AddCommand(getHostsCmd)
 	getCmd.AddCommand(getVMsCmd)
 
 	getCmd.PersistentFlags().Duration("timeout", 3*time.Second, "Timeout for collecting responses from nodes")
+	addOutputFlag(getCmd)
 }
 
 // loadConfigAndConnect loads the cluster config and connects to NATS.
@@ -91,6 +103,7 @@ func loadConfigAndConnect() (*config.ClusterConfig, *nats.Conn, error) {
 	}
 
 	nodeConfig := cfg.Nodes[cfg.Node]
+	utils.SetSubjectPrefix(nodeConfig.NATS.SubjectPrefix)
 	nc, err := utils.ConnectNATS(admin.DialTarget(nodeConfig.NATS.Host), nodeConfig.NATS.ACL.Token, nodeConfig.NATS.CACert)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to connect to NATS: %w", err)
@@ -108,7 +121,7 @@ func collectResponses(nc *nats.Conn, topic string, timeout time.Duration) ([][]b
 	}
 	defer sub.Unsubscribe()
 
-	if err := nc.PublishRequest(topic, inbox, nil); err != nil {
+	if err := nc.PublishRequest(utils.Subject(topic), inbox, nil); err != nil {
 		return nil, fmt.Errorf("failed to publish request: %w", err)
 	}
 	nc.Flush()
@@ -168,6 +181,19 @@ func formatMemGB(gb float64) string {
 	return fmt.Sprintf("%dMi", int(gb*1024))
 }
 
+// formatCPUCredits shows a burstable instance's credit balance, marking it
+// when standard mode is holding the instance to its baseline.
+func formatCPUCredits(v types.VMInfo) string {
+	switch {
+	case v.CPUCreditMode == "":
+		return "-"
+	case v.CPUThrottled:
+		return fmt.Sprintf("%.1f (throttled)", v.CPUCreditBalance)
+	default:
+		return fmt.Sprintf("%.1f", v.CPUCreditBalance)
+	}
+}
+
 func runGetNodes(cmd *cobra.Command, args []string) {
 	cfg, nc, err := loadConfigAndConnect()
 	if err != nil {
@@ -177,7 +203,7 @@ func runGetNodes(cmd *cobra.Command, args []string) {
 	defer nc.Close()
 
 	timeout, _ := cmd.Flags().GetDuration("timeout")
-	responses, err := collectResponses(nc, "spinifex.node.status", timeout)
+	responses, err := collectResponses(nc, subjects.NodeStatus, timeout)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
@@ -193,11 +219,6 @@ func runGetNodes(cmd *cobra.Command, args []string) {
 		respondedNodes[resp.Node] = resp
 	}
 
-	// Build table: union of config-known nodes + NATS responders
-	tableData := pterm.TableData{
-		{"NAME", "STATUS", "ROLES", "IP", "REGION", "AZ", "UPTIME", "VMs", "SERVICES"},
-	}
-
 	// Collect all node names: config + responded (union)
 	nodeSet := make(map[string]struct{})
 	for name := range cfg.Nodes {
@@ -212,6 +233,30 @@ func runGetNodes(cmd *cobra.Command, args []string) {
 	}
 	sort.Strings(nodeNames)
 
+	if jsonOutput(cmd) {
+		nodes := make([]types.NodeStatusResponse, 0, len(nodeNames))
+		for _, name := range nodeNames {
+			resp, ok := respondedNodes[name]
+			if !ok {
+				nodeCfg := cfg.Nodes[name]
+				resp = types.NodeStatusResponse{
+					Node:     name,
+					Status:   "NotReady",
+					Host:     nodeCfg.Host,
+					Region:   nodeCfg.Region,
+					AZ:       nodeCfg.AZ,
+					Services: nodeCfg.GetServices(),
+				}
+			}
+			nodes = append(nodes, resp)
+		}
+		printJSON(nodes)
+		return
+	}
+
+	tableData := pterm.TableData{
+		{"NAME", "STATUS", "ROLES", "IP", "REGION", "AZ", "UPTIME", "VMs", "SERVICES"},
+	}
 	for _, name := range nodeNames {
 		nodeCfg := cfg.Nodes[name]
 		if resp, ok := respondedNodes[name]; ok {
@@ -241,7 +286,50 @@ func runGetNodes(cmd *cobra.Command, args []string) {
 		}
 	}
 
-	pterm.DefaultTable.WithHasHeader().WithLeftAlignment().WithData(tableData).Render()
+	printTable(tableData)
+}
+
+func runGetHosts(cmd *cobra.Command, args []string) {
+	_, nc, err := loadConfigAndConnect()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer nc.Close()
+
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	out, err := utils.NATSRequest[types.DescribeHostsOutput](nc, subjects.DescribeHosts, struct{}{}, timeout, utils.GlobalAccountID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if jsonOutput(cmd) {
+		printJSON(out.Hosts)
+		return
+	}
+
+	tableData := pterm.TableData{
+		{"NAME", "STATE", "VERSION", "LAST HEARTBEAT", "VCPU", "MEMORY", "RUNNING", "IMPAIRED"},
+	}
+	for _, h := range out.Hosts {
+		impaired := "-"
+		if len(h.ImpairedInstances) > 0 {
+			impaired = strings.Join(h.ImpairedInstances, ",")
+		}
+		tableData = append(tableData, []string{
+			h.Node,
+			h.State,
+			h.Version,
+			time.Since(h.LastHeartbeat).Round(time.Second).String() + " ago",
+			fmt.Sprintf("%d/%d", h.AllocVCPU, h.TotalVCPU),
+			formatMemGB(h.AllocMemGB) + "/" + formatMemGB(h.TotalMemGB),
+			strconv.Itoa(h.RunningInstances),
+			impaired,
+		})
+	}
+
+	printTable(tableData)
 }
 
 func runGetVMs(cmd *cobra.Command, args []string) {
@@ -262,8 +350,8 @@ func runGetVMs(cmd *cobra.Command, args []string) {
 	type vmRow struct {
 		types.VMInfo
 
-		Node string
-		Host string
+		Node string `json:"node"`
+		Host string `json:"host"`
 	}
 
 	var allVMs []vmRow
@@ -277,11 +365,6 @@ func runGetVMs(cmd *cobra.Command, args []string) {
 		}
 	}
 
-	if len(allVMs) == 0 {
-		fmt.Println("No VMs found.")
-		return
-	}
-
 	// Sort by node then instance ID
 	sort.Slice(allVMs, func(i, j int) bool {
 		if allVMs[i].Node != allVMs[j].Node {
@@ -290,8 +373,21 @@ func runGetVMs(cmd *cobra.Command, args []string) {
 		return allVMs[i].InstanceID < allVMs[j].InstanceID
 	})
 
+	if jsonOutput(cmd) {
+		if allVMs == nil {
+			allVMs = []vmRow{}
+		}
+		printJSON(allVMs)
+		return
+	}
+
+	if len(allVMs) == 0 {
+		fmt.Println("No VMs found.")
+		return
+	}
+
 	tableData := pterm.TableData{
-		{"INSTANCE", "STATUS", "TYPE", "VCPU", "MEM", "NODE", "IP", "AGE"},
+		{"INSTANCE", "STATUS", "TYPE", "VCPU", "MEM", "CREDITS", "NODE", "IP", "AGE"},
 	}
 
 	for _, v := range allVMs {
@@ -305,11 +401,12 @@ func runGetVMs(cmd *cobra.Command, args []string) {
 			v.InstanceType,
 			strconv.Itoa(v.VCPU),
 			formatMemGB(v.MemoryGB),
+			formatCPUCredits(v.VMInfo),
 			v.Node,
 			v.Host,
 			age,
 		})
 	}
 
-	pterm.DefaultTable.WithHasHeader().WithLeftAlignment().WithData(tableData).Render()
+	printTable(tableData)
 }
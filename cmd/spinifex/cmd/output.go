@@ -0,0 +1,70 @@
+/*
+Copyright © 2026 Mulga Defense Corporation
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU Affero General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU Affero General Public License for more details.
+
+You should have received a copy of the GNU Affero General Public License
+along with this program.  If not, see <https://www.gnu.org/licenses/>.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/pterm/pterm"
+	"github.com/spf13/cobra"
+)
+
+// addOutputFlag adds the --output flag to cmd and its subcommands.
+func addOutputFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringP("output", "o", "table", "Output format: table or json")
+}
+
+// parseOutput reports whether format, an --output value, asks for JSON.
+func parseOutput(format string) (bool, error) {
+	switch format {
+	case "", "table":
+		return false, nil
+	case "json":
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown output format %q (want table or json)", format)
+	}
+}
+
+// jsonOutput reports whether cmd was run with --output json, exiting on an
+// unknown format.
+func jsonOutput(cmd *cobra.Command) bool {
+	format, _ := cmd.Flags().GetString("output")
+	asJSON, err := parseOutput(format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	return asJSON
+}
+
+// printJSON writes v to stdout as indented JSON.
+func printJSON(v any) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(string(data))
+}
+
+// printTable renders table, whose first row is the header.
+func printTable(table pterm.TableData) {
+	pterm.DefaultTable.WithHasHeader().WithLeftAlignment().WithData(table).Render()
+}
@@ -24,6 +24,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/mulgadc/spinifex/spinifex/subjects"
 	"github.com/mulgadc/spinifex/spinifex/types"
 	"github.com/pterm/pterm"
 	"github.com/spf13/cobra"
@@ -47,6 +48,7 @@ func init() {
 	topCmd.AddCommand(topNodesCmd)
 
 	topCmd.PersistentFlags().Duration("timeout", 3*time.Second, "Timeout for collecting responses from nodes")
+	addOutputFlag(topCmd)
 }
 
 func runTopNodes(cmd *cobra.Command, args []string) {
@@ -58,7 +60,7 @@ func runTopNodes(cmd *cobra.Command, args []string) {
 	defer nc.Close()
 
 	timeout, _ := cmd.Flags().GetDuration("timeout")
-	responses, err := collectResponses(nc, "spinifex.node.status", timeout)
+	responses, err := collectResponses(nc, subjects.NodeStatus, timeout)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
@@ -87,6 +89,17 @@ func runTopNodes(cmd *cobra.Command, args []string) {
 	}
 	sort.Strings(nodeNames)
 
+	if jsonOutput(cmd) {
+		nodes := make([]types.NodeStatusResponse, 0, len(respondedNodes))
+		for _, name := range nodeNames {
+			if resp, ok := respondedNodes[name]; ok {
+				nodes = append(nodes, resp)
+			}
+		}
+		printJSON(nodes)
+		return
+	}
+
 	nodeTable := pterm.TableData{
 		{"NAME", "CPU (used/total)", "MEM (used/total)", "VMs"},
 	}
@@ -124,7 +137,7 @@ func runTopNodes(cmd *cobra.Command, args []string) {
 		}
 	}
 
-	pterm.DefaultTable.WithHasHeader().WithLeftAlignment().WithData(nodeTable).Render()
+	printTable(nodeTable)
 
 	// Instance type capacity summary
 	if len(capacityMap) == 0 {
@@ -153,7 +166,7 @@ func runTopNodes(cmd *cobra.Command, args []string) {
 		})
 	}
 
-	pterm.DefaultTable.WithHasHeader().WithLeftAlignment().WithData(capTable).Render()
+	printTable(capTable)
 }
 
 type aggregatedCap struct {
@@ -0,0 +1,191 @@
+// Package audit records the mutating API calls the gateway serves: who made
+// each call and from where, its parameters, the resources it touched and the
+// error it failed with, if any. Records are published to the audit stream,
+// which Lookup queries, and can also be archived to an S3 bucket.
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/mulgadc/spinifex/spinifex/objectstore"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+)
+
+// redactedValue replaces the value of a sensitive request parameter.
+const redactedValue = "HIDDEN_DUE_TO_SECURITY_REASONS"
+
+// archiveQueueSize bounds the events waiting to be archived. When the
+// archive falls behind further than this, events are only kept in the stream.
+const archiveQueueSize = 1024
+
+// Event is the record of one mutating API call.
+type Event struct {
+	EventID           string            `json:"event_id"`
+	RequestID         string            `json:"request_id,omitempty"` // The API request ID returned to the caller
+	EventTime         time.Time         `json:"event_time"`
+	EventSource       string            `json:"event_source"` // The service called, e.g. "ec2" or "iam"
+	EventName         string            `json:"event_name"`   // The action, e.g. "RunInstances"
+	Region            string            `json:"region"`
+	SourceIPAddress   string            `json:"source_ip_address"`
+	UserAgent         string            `json:"user_agent,omitempty"`
+	UserIdentity      UserIdentity      `json:"user_identity"`
+	RequestParameters map[string]string `json:"request_parameters,omitempty"`
+	Resources         []string          `json:"resources,omitempty"` // Resource IDs and ARNs the call named or created
+	ErrorCode         string            `json:"error_code,omitempty"`
+}
+
+// UserIdentity is the caller of an audited API call.
+type UserIdentity struct {
+	Type        string `json:"type"` // "IAMUser" or "AssumedRole"
+	AccountID   string `json:"account_id"`
+	UserName    string `json:"user_name"` // The user, or "assumed-role/<role>/<session>"
+	AccessKeyID string `json:"access_key_id"`
+}
+
+// alwaysRecorded lists read-style actions that are audited anyway because
+// they issue credentials.
+var alwaysRecorded = map[string]bool{
+	"GetSessionToken": true,
+}
+
+// IsMutating reports whether action changes state and so is audited. Reads
+// (Describe*, Get*, List* and Lookup*) are not, except those in
+// alwaysRecorded.
+func IsMutating(action string) bool {
+	if action == "" {
+		return false
+	}
+	if alwaysRecorded[action] {
+		return true
+	}
+	for _, prefix := range []string{"Describe", "Get", "List", "Lookup"} {
+		if strings.HasPrefix(action, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// sensitiveParams are the case-insensitive substrings that mark a request
+// parameter whose value must not be kept, e.g. "Password",
+// "UserData" or "LaunchTemplateData.UserData".
+var sensitiveParams = []string{"password", "secret", "privatekey", "userdata", "sessiontoken"}
+
+// omittedParams are protocol parameters that carry nothing about the call
+// itself; the action is already the event name.
+var omittedParams = map[string]bool{"Action": true, "Version": true}
+
+// RequestParameters returns the parameters of a call to record, with
+// sensitive values redacted and protocol and signing parameters left out.
+func RequestParameters(args map[string]string) map[string]string {
+	params := make(map[string]string, len(args))
+	for key, value := range args {
+		if omittedParams[key] || strings.HasPrefix(key, "X-Amz-") {
+			continue
+		}
+		lower := strings.ToLower(key)
+		for _, s := range sensitiveParams {
+			if strings.Contains(lower, s) {
+				value = redactedValue
+				break
+			}
+		}
+		params[key] = value
+	}
+	if len(params) == 0 {
+		return nil
+	}
+	return params
+}
+
+// Recorder publishes audit events to the audit stream and, given an
+// archive, writes each one to the archive bucket as well.
+type Recorder struct {
+	nc      *nats.Conn
+	archive objectstore.ObjectStore
+	bucket  string
+
+	queue chan *Event
+	wg    sync.WaitGroup
+}
+
+// NewRecorder returns a Recorder publishing on nc. When archive is not nil,
+// events are also written to bucket in the background; call Close to flush
+// them on shutdown.
+func NewRecorder(nc *nats.Conn, archive objectstore.ObjectStore, bucket string) *Recorder {
+	r := &Recorder{nc: nc, archive: archive, bucket: bucket}
+	if archive != nil {
+		r.queue = make(chan *Event, archiveQueueSize)
+		r.wg.Add(1)
+		go r.archiveLoop()
+	}
+	return r
+}
+
+// Record publishes event. Auditing is best effort: a failure is logged and
+// does not affect the call being audited.
+func (r *Recorder) Record(event *Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("Failed to marshal audit event", "eventName", event.EventName, "err", err)
+		return
+	}
+	if err := r.nc.Publish(utils.Subject(subjects.AuditEvent(event.UserIdentity.AccountID)), data); err != nil {
+		slog.Warn("Failed to publish audit event", "eventName", event.EventName, "err", err)
+	}
+
+	if r.queue == nil {
+		return
+	}
+	select {
+	case r.queue <- event:
+	default:
+		slog.Warn("Audit archive queue full, event not archived", "eventID", event.EventID)
+	}
+}
+
+// Close stops the archive writer once the queued events are written.
+func (r *Recorder) Close() {
+	if r.queue != nil {
+		close(r.queue)
+		r.wg.Wait()
+	}
+}
+
+func (r *Recorder) archiveLoop() {
+	defer r.wg.Done()
+	for event := range r.queue {
+		data, err := json.Marshal(event)
+		if err != nil {
+			continue
+		}
+		_, err = r.archive.PutObject(&s3.PutObjectInput{
+			Bucket:      aws.String(r.bucket),
+			Key:         aws.String(ArchiveKey(event)),
+			Body:        bytes.NewReader(data),
+			ContentType: aws.String("application/json"),
+		})
+		if err != nil {
+			slog.Warn("Failed to archive audit event", "eventID", event.EventID, "bucket", r.bucket, "err", err)
+		}
+	}
+}
+
+// ArchiveKey is the object key event is archived under, partitioned by
+// account and day so a period's events can be listed by prefix:
+// audit/<account>/<yyyy>/<mm>/<dd>/<time>_<event-id>.json.
+func ArchiveKey(event *Event) string {
+	t := event.EventTime.UTC()
+	return path.Join("audit", event.UserIdentity.AccountID, t.Format("2006/01/02"),
+		t.Format("20060102T150405Z")+"_"+event.EventID+".json")
+}
@@ -0,0 +1,126 @@
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/mulgadc/spinifex/spinifex/config"
+	"github.com/mulgadc/spinifex/spinifex/objectstore"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/testutil"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testEvent(accountID, eventName, userName string, at time.Time, resources ...string) *Event {
+	return &Event{
+		EventID:     eventName + "-" + at.Format("150405"),
+		EventTime:   at,
+		EventSource: "ec2",
+		EventName:   eventName,
+		UserIdentity: UserIdentity{
+			Type:        "IAMUser",
+			AccountID:   accountID,
+			UserName:    userName,
+			AccessKeyID: "AKIAEXAMPLE",
+		},
+		Resources: resources,
+	}
+}
+
+func TestIsMutating(t *testing.T) {
+	for action, want := range map[string]bool{
+		"RunInstances":      true,
+		"CreateUser":        true,
+		"AssumeRole":        true,
+		"GetSessionToken":   true,
+		"DescribeInstances": false,
+		"GetUser":           false,
+		"ListRoles":         false,
+		"LookupEvents":      false,
+		"":                  false,
+	} {
+		assert.Equal(t, want, IsMutating(action), action)
+	}
+}
+
+func TestRequestParameters(t *testing.T) {
+	params := RequestParameters(map[string]string{
+		"Action":                         "RunInstances",
+		"Version":                        "2016-11-15",
+		"ImageId":                        "ami-0123456789abcdef0",
+		"UserData":                       "IyEvYmluL2Jhc2g=",
+		"LaunchTemplateData.UserData":    "IyEvYmluL2Jhc2g=",
+		"Password":                       "hunter2",
+		"X-Amz-Signature":                "abc",
+		"TagSpecification.1.Tag.1.Key":   "Name",
+		"TagSpecification.1.Tag.1.Value": "web",
+	})
+	assert.Equal(t, map[string]string{
+		"ImageId":                        "ami-0123456789abcdef0",
+		"UserData":                       redactedValue,
+		"LaunchTemplateData.UserData":    redactedValue,
+		"Password":                       redactedValue,
+		"TagSpecification.1.Tag.1.Key":   "Name",
+		"TagSpecification.1.Tag.1.Value": "web",
+	}, params)
+
+	assert.Nil(t, RequestParameters(map[string]string{"Action": "CreateVpc"}))
+}
+
+func TestRecorder_Publish(t *testing.T) {
+	_, nc := testutil.StartTestNATS(t)
+	sub, err := nc.SubscribeSync(utils.Subject(subjects.Audit))
+	require.NoError(t, err)
+
+	r := NewRecorder(nc, nil, "")
+	defer r.Close()
+	r.Record(testEvent("000000000001", "RunInstances", "alice", time.Now().UTC(), "i-0123"))
+
+	msg, err := sub.NextMsg(5 * time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, utils.Subject(subjects.AuditEvent("000000000001")), msg.Subject)
+	var event Event
+	require.NoError(t, json.Unmarshal(msg.Data, &event))
+	assert.Equal(t, "RunInstances", event.EventName)
+	assert.Equal(t, []string{"i-0123"}, event.Resources)
+}
+
+func TestRecorder_Archive(t *testing.T) {
+	for _, backend := range []string{"memory", "filesystem"} {
+		t.Run(backend, func(t *testing.T) {
+			_, nc := testutil.StartTestNATS(t)
+			store, err := objectstore.New(config.ObjectStoreConfig{Backend: backend, Dir: t.TempDir()})
+			require.NoError(t, err)
+
+			r := NewRecorder(nc, store, "audit-logs")
+			event := testEvent("000000000001", "CreateVolume", "alice", time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC))
+			r.Record(event)
+			r.Close()
+
+			key := ArchiveKey(event)
+			assert.Equal(t, "audit/000000000001/2026/03/04/20260304T050607Z_CreateVolume-050607.json", key)
+			out, err := store.GetObject(&s3.GetObjectInput{Bucket: aws.String("audit-logs"), Key: aws.String(key)})
+			require.NoError(t, err)
+			defer out.Body.Close()
+			data, err := io.ReadAll(out.Body)
+			require.NoError(t, err)
+			var archived Event
+			require.NoError(t, json.Unmarshal(data, &archived))
+			assert.Equal(t, event.EventID, archived.EventID)
+
+			listed, err := store.ListObjectsV2(&s3.ListObjectsV2Input{
+				Bucket: aws.String("audit-logs"),
+				Prefix: aws.String("audit/000000000001/2026/03/"),
+			})
+			require.NoError(t, err)
+			require.Len(t, listed.Contents, 1)
+			assert.Equal(t, key, aws.StringValue(listed.Contents[0].Key))
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// Stream is the JetStream stream that keeps the audit events published
+	// on subjects.Audit.
+	Stream = "spinifex-audit"
+	// DefaultRetention is how long Stream keeps an event unless configured
+	// otherwise, as CloudTrail's event history does.
+	DefaultRetention = 90 * 24 * time.Hour
+
+	// MaxLookupResults is the most events one Lookup returns, and the
+	// default.
+	MaxLookupResults = 50
+	// lookupScanLimit bounds the events one Lookup reads. A lookup whose
+	// filters match little of the stream returns what it found so far with a
+	// NextToken to carry on from.
+	lookupScanLimit = 5000
+)
+
+// ErrInvalidNextToken is returned by Lookup for a NextToken it did not issue.
+var ErrInvalidNextToken = errors.New("invalid next token")
+
+// InitStream creates the audit stream if it doesn't exist, or updates its
+// retention if that has been reconfigured. Events are published with core
+// NATS, so the gateway keeps serving, unaudited, if the stream is
+// unavailable.
+func InitStream(js nats.JetStreamContext, replicas int, retention time.Duration) error {
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+
+	info, err := js.StreamInfo(Stream)
+	if err == nil {
+		if info.Config.MaxAge == retention {
+			slog.Debug("Connected to existing JetStream stream", "stream", Stream)
+			return nil
+		}
+		cfg := info.Config
+		cfg.MaxAge = retention
+		slog.Info("Updating audit stream retention", "stream", Stream, "retention", retention)
+		_, err = js.UpdateStream(&cfg)
+		return err
+	}
+	if !errors.Is(err, nats.ErrStreamNotFound) {
+		return err
+	}
+
+	slog.Debug("Creating JetStream stream", "stream", Stream, "replicas", replicas)
+	_, err = js.AddStream(&nats.StreamConfig{
+		Name:        Stream,
+		Description: "Spinifex API audit log",
+		Subjects:    []string{utils.Subject(subjects.Audit)},
+		MaxAge:      retention,
+		Replicas:    replicas,
+	})
+	return err
+}
+
+// LookupInput filters the events Lookup returns. Zero fields don't filter.
+type LookupInput struct {
+	AccountID    string
+	EventName    string
+	UserName     string
+	ResourceName string // A resource ID or ARN the event names
+	StartTime    time.Time
+	EndTime      time.Time
+	MaxResults   int
+	NextToken    string
+}
+
+// LookupOutput is the response for LookupEvents.
+type LookupOutput struct {
+	Events    []Event `json:"events"`
+	NextToken string  `json:"next_token,omitempty"`
+}
+
+// Lookup returns the audit events matching input, newest first.
+func Lookup(js nats.JetStreamContext, input *LookupInput) (*LookupOutput, error) {
+	maxResults := input.MaxResults
+	if maxResults <= 0 || maxResults > MaxLookupResults {
+		maxResults = MaxLookupResults
+	}
+
+	info, err := js.StreamInfo(Stream)
+	if err != nil {
+		return nil, err
+	}
+	first, seq := info.State.FirstSeq, info.State.LastSeq
+	if input.NextToken != "" {
+		seq, err = strconv.ParseUint(input.NextToken, 10, 64)
+		if err != nil || seq == 0 || seq > info.State.LastSeq {
+			return nil, ErrInvalidNextToken
+		}
+	}
+
+	output := &LookupOutput{Events: []Event{}}
+	if info.State.Msgs == 0 {
+		return output, nil
+	}
+	for scanned := 0; seq >= first && seq > 0; seq-- {
+		if scanned == lookupScanLimit || len(output.Events) == maxResults {
+			output.NextToken = strconv.FormatUint(seq, 10)
+			break
+		}
+		scanned++
+
+		msg, err := js.GetMsg(Stream, seq)
+		if errors.Is(err, nats.ErrMsgNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var event Event
+		if err := json.Unmarshal(msg.Data, &event); err != nil {
+			slog.Warn("Skipping malformed audit event", "seq", seq, "err", err)
+			continue
+		}
+		// The stream is in publish order, so nothing further back is in range.
+		if !input.StartTime.IsZero() && event.EventTime.Before(input.StartTime) {
+			break
+		}
+		if input.matches(&event) {
+			output.Events = append(output.Events, event)
+		}
+	}
+	return output, nil
+}
+
+func (input *LookupInput) matches(event *Event) bool {
+	if !input.EndTime.IsZero() && event.EventTime.After(input.EndTime) {
+		return false
+	}
+	if input.AccountID != "" && event.UserIdentity.AccountID != input.AccountID {
+		return false
+	}
+	if input.EventName != "" && event.EventName != input.EventName {
+		return false
+	}
+	if input.UserName != "" && event.UserIdentity.UserName != input.UserName {
+		return false
+	}
+	if input.ResourceName != "" {
+		for _, resource := range event.Resources {
+			if resource == input.ResourceName || strings.HasSuffix(resource, "/"+input.ResourceName) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+package audit
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/testutil"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupTestStream starts JetStream with the audit stream and stores events
+// in it, in order.
+func setupTestStream(t *testing.T, events ...*Event) nats.JetStreamContext {
+	t.Helper()
+	_, _, js := testutil.StartTestJetStream(t)
+	require.NoError(t, InitStream(js, 1, 0))
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		require.NoError(t, err)
+		_, err = js.Publish(utils.Subject(subjects.AuditEvent(event.UserIdentity.AccountID)), data)
+		require.NoError(t, err)
+	}
+	return js
+}
+
+func eventNames(events []Event) []string {
+	names := make([]string, len(events))
+	for i, event := range events {
+		names[i] = event.EventName
+	}
+	return names
+}
+
+func TestInitStream(t *testing.T) {
+	js := setupTestStream(t)
+
+	info, err := js.StreamInfo(Stream)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultRetention, info.Config.MaxAge)
+
+	// Idempotent, and a reconfigured retention is applied.
+	require.NoError(t, InitStream(js, 1, 0))
+	require.NoError(t, InitStream(js, 1, 7*24*time.Hour))
+	info, err = js.StreamInfo(Stream)
+	require.NoError(t, err)
+	assert.Equal(t, 7*24*time.Hour, info.Config.MaxAge)
+}
+
+func TestLookup_Filters(t *testing.T) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	js := setupTestStream(t,
+		testEvent("000000000001", "CreateVpc", "alice", base, "vpc-0001"),
+		testEvent("000000000002", "RunInstances", "bob", base.Add(time.Minute), "i-0002"),
+		testEvent("000000000001", "RunInstances", "alice", base.Add(2*time.Minute), "i-0003", "arn:aws:ec2:ap-southeast-2:000000000001:instance/i-0004"),
+		testEvent("000000000001", "TerminateInstances", "carol", base.Add(3*time.Minute), "i-0003"),
+	)
+
+	tests := map[string]struct {
+		input LookupInput
+		want  []string
+	}{
+		"all, newest first": {LookupInput{}, []string{"TerminateInstances", "RunInstances", "RunInstances", "CreateVpc"}},
+		"account":           {LookupInput{AccountID: "000000000002"}, []string{"RunInstances"}},
+		"event name":        {LookupInput{EventName: "RunInstances"}, []string{"RunInstances", "RunInstances"}},
+		"user name":         {LookupInput{UserName: "alice"}, []string{"RunInstances", "CreateVpc"}},
+		"resource ID":       {LookupInput{ResourceName: "i-0003"}, []string{"TerminateInstances", "RunInstances"}},
+		"ID within ARN":     {LookupInput{ResourceName: "i-0004"}, []string{"RunInstances"}},
+		"time range": {
+			LookupInput{StartTime: base.Add(time.Minute), EndTime: base.Add(2 * time.Minute)},
+			[]string{"RunInstances", "RunInstances"},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			out, err := Lookup(js, &tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, eventNames(out.Events))
+			assert.Empty(t, out.NextToken)
+		})
+	}
+}
+
+func TestLookup_Pagination(t *testing.T) {
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var events []*Event
+	for i := range 5 {
+		events = append(events, testEvent("000000000001", "CreateTags", "alice", base.Add(time.Duration(i)*time.Minute)))
+	}
+	js := setupTestStream(t, events...)
+
+	var seen []time.Time
+	input := &LookupInput{MaxResults: 2}
+	for page := 0; ; page++ {
+		require.Less(t, page, 5, "pagination did not terminate")
+		out, err := Lookup(js, input)
+		require.NoError(t, err)
+		for _, event := range out.Events {
+			seen = append(seen, event.EventTime)
+		}
+		if out.NextToken == "" {
+			break
+		}
+		input.NextToken = out.NextToken
+	}
+	require.Len(t, seen, 5)
+	for i := range seen[1:] {
+		assert.True(t, seen[i].After(seen[i+1]), "events newest first")
+	}
+}
+
+func TestLookup_InvalidNextToken(t *testing.T) {
+	js := setupTestStream(t, testEvent("000000000001", "CreateVpc", "alice", time.Now().UTC()))
+
+	for _, token := range []string{"abc", "0", "99"} {
+		_, err := Lookup(js, &LookupInput{NextToken: token})
+		assert.ErrorIs(t, err, ErrInvalidNextToken, token)
+	}
+}
+
+func TestLookup_EmptyStream(t *testing.T) {
+	js := setupTestStream(t)
+
+	out, err := Lookup(js, &LookupInput{})
+	require.NoError(t, err)
+	assert.Empty(t, out.Events)
+	assert.Empty(t, out.NextToken)
+}
@@ -7,6 +7,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // ErrSliceTooLarge is returned when a list exceeds maxSliceLen entries.
@@ -70,8 +71,14 @@ func setStructFields(v reflect.Value, params map[string]string, prefix string) e
 		// Try the field name, locationName, and title-cased locationName.
 		// AWS query params use title case (e.g. "ResourceId") but some SDK
 		// structs use camelCase locationName (e.g. "resourceId" in DeleteTagsInput
-		// vs "ResourceId" in CreateTagsInput).
-		queryKeys := []string{prefix + fieldName}
+		// vs "ResourceId" in CreateTagsInput). A queryName tag, the model's
+		// ec2QueryName, is the name the EC2 query protocol sends and is tried
+		// first.
+		var queryKeys []string
+		if queryName := fieldType.Tag.Get("queryName"); queryName != "" && queryName != fieldName {
+			queryKeys = append(queryKeys, prefix+queryName)
+		}
+		queryKeys = append(queryKeys, prefix+fieldName)
 		if locationName != "" && locationName != fieldName {
 			queryKeys = append(queryKeys, prefix+locationName)
 			titled := strings.ToUpper(locationName[:1]) + locationName[1:]
@@ -147,7 +154,19 @@ func setStructFields(v reflect.Value, params map[string]string, prefix string) e
 	return nil
 }
 
+var timeType = reflect.TypeFor[time.Time]()
+
 func setFieldValue(field reflect.Value, value string) error {
+	// Query timestamps are ISO 8601, e.g. 2026-10-16T12:00:00.000Z.
+	if field.Type() == timeType {
+		ts, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(ts))
+		return nil
+	}
+
 	switch field.Kind() {
 	case reflect.Slice:
 		elem := field.Type().Elem()
@@ -3,6 +3,7 @@ package awsec2query
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
@@ -425,6 +426,19 @@ func TestQueryParamsToStruct_InvalidIntValue(t *testing.T) {
 	assert.Contains(t, err.Error(), "error setting field MinCount")
 }
 
+func TestQueryParamsToStruct_Timestamp(t *testing.T) {
+	input := &ec2.ModifyInstanceEventStartTimeInput{}
+	require.NoError(t, QueryParamsToStruct(map[string]string{
+		"InstanceId": "i-1234567890abcdef0",
+		"NotBefore":  "2026-10-16T12:30:00.000Z",
+	}, input))
+	require.NotNil(t, input.NotBefore)
+	assert.Equal(t, time.Date(2026, 10, 16, 12, 30, 0, 0, time.UTC), input.NotBefore.UTC())
+
+	err := QueryParamsToStruct(map[string]string{"NotBefore": "yesterday"}, &ec2.ModifyInstanceEventStartTimeInput{})
+	assert.ErrorContains(t, err, "error setting field NotBefore")
+}
+
 func TestQueryParamsToStruct_InvalidBoolValue(t *testing.T) {
 	args := map[string]string{
 		"InstanceId.1": "i-1234567890abcdef0",
@@ -649,3 +663,15 @@ func TestQueryParamsToStruct_SparseHugeIndexNoOp(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Empty(t, input.Filters)
 }
+
+func TestQueryParamsToStruct_QueryName(t *testing.T) {
+	// queryName is the EC2 query protocol's name for a field whose
+	// locationName is its XML element name.
+	type input struct {
+		Addresses []*string `locationName:"addressSet" queryName:"Address" locationNameList:"item" type:"list"`
+	}
+	in := &input{}
+	require.NoError(t, QueryParamsToStruct(map[string]string{"Address.1": "10.0.0.1", "Address.2": "10.0.0.2"}, in))
+	assert.Equal(t, []*string{aws.String("10.0.0.1"), aws.String("10.0.0.2")}, in.Addresses)
+
+}
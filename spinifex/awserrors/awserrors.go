@@ -1,5 +1,7 @@
 package awserrors
 
+import "errors"
+
 type ErrorMessage struct {
 	HTTPCode int
 	Message  string
@@ -64,6 +66,7 @@ var (
 	ErrorInstanceCreditSpecificationNotSupported               = "InstanceCreditSpecification.NotSupported"
 	ErrorInstanceEventStartTimeCannotChange                    = "InstanceEventStartTimeCannotChange"
 	ErrorInstanceLimitExceeded                                 = "InstanceLimitExceeded"
+	ErrorInstanceScheduleLimitExceeded                         = "InstanceScheduleLimitExceeded"
 	ErrorInstanceTpmEkPubNotFound                              = "InstanceTpmEkPubNotFound"
 	ErrorInsufficientAddressCapacity                           = "InsufficientAddressCapacity"
 	ErrorInsufficientCapacity                                  = "InsufficientCapacity"
@@ -178,6 +181,8 @@ var (
 	ErrorInvalidInstanceIDMalformed                            = "InvalidInstanceID.Malformed"
 	ErrorInvalidInstanceIDNotFound                             = "InvalidInstanceID.NotFound"
 	ErrorInvalidInstanceIDNotLinkable                          = "InvalidInstanceID.NotLinkable"
+	ErrorInvalidInstanceScheduleIDMalformed                    = "InvalidInstanceScheduleID.Malformed"
+	ErrorInvalidInstanceScheduleIDNotFound                     = "InvalidInstanceScheduleID.NotFound"
 	ErrorInvalidInstanceState                                  = "InvalidInstanceState"
 	ErrorInvalidInstanceType                                   = "InvalidInstanceType"
 	ErrorInvalidInterfaceIpAddressLimitExceeded                = "InvalidInterface.IpAddressLimitExceeded"
@@ -435,6 +440,9 @@ var (
 	ErrorIAMMalformedPolicyDocument = "MalformedPolicyDocument"
 	ErrorAccessDenied               = "AccessDenied"
 
+	// STS-specific error codes
+	ErrorSTSExpiredToken = "ExpiredToken"
+
 	// ELBv2-specific error codes
 	ErrorELBv2LoadBalancerNotFound         = "LoadBalancerNotFound"
 	ErrorELBv2TargetGroupNotFound          = "TargetGroupNotFound"
@@ -453,6 +461,10 @@ var (
 	ErrorELBv2SubnetNotFound               = "SubnetNotFound"
 	ErrorELBv2AvailabilityZoneNotSupported = "AvailabilityZoneNotSupported"
 	ErrorELBv2InvalidConfigurationRequest  = "InvalidConfigurationRequest"
+
+	// Auto Scaling-specific error codes
+	ErrorAutoScalingAlreadyExists             = "AlreadyExists"
+	ErrorAutoScalingScalingActivityInProgress = "ScalingActivityInProgress"
 )
 
 // ValidErrorCode returns the error code if it exists in ErrorLookup,
@@ -465,6 +477,37 @@ func ValidErrorCode(code string) string {
 	return ErrorServerInternal
 }
 
+// DetailedError is an AWS error code carrying a client-safe detail message
+// appended to the standard error text. Error() returns the bare code so
+// existing code comparisons and ErrorLookup keep working.
+type DetailedError struct {
+	Code   string
+	Detail string
+}
+
+func (e *DetailedError) Error() string {
+	return e.Code
+}
+
+// WithDetail returns an error for code with detail attached. Detail must
+// already be redacted; it is sent to clients verbatim.
+func WithDetail(code, detail string) error {
+	return &DetailedError{Code: code, Detail: detail}
+}
+
+// Detail returns the detail message attached to err, or "" if none.
+func Detail(err error) string {
+	var detailed *DetailedError
+	if errors.As(err, &detailed) {
+		return detailed.Detail
+	}
+	var awsErr *Error
+	if errors.As(err, &awsErr) {
+		return awsErr.Message
+	}
+	return ""
+}
+
 var ErrorLookup = map[string]ErrorMessage{
 	ErrorAccountDisabled: {HTTPCode: 400, Message: "The functionality you have requested has been administratively disabled for this account."},
 	ErrorActiveVpcPeeringConnectionPerVpcLimitExceeded:         {HTTPCode: 400, Message: "You've reached the limit on the number of active VPC peering connections you can have for the specified VPC."},
@@ -524,6 +567,7 @@ var ErrorLookup = map[string]ErrorMessage{
 	ErrorInstanceCreditSpecificationNotSupported:               {HTTPCode: 400, Message: "The specified instance does not use CPU credits for CPU usage; only T2 instances use CPU credits for CPU usage."},
 	ErrorInstanceEventStartTimeCannotChange:                    {HTTPCode: 400, Message: "The specified scheduled event start time does not meet the requirements for rescheduling a scheduled event. For more information, see Limitations."},
 	ErrorInstanceLimitExceeded:                                 {HTTPCode: 400, Message: "You've reached the limit on the number of instances you can run concurrently. This error can occur if you are launching an instance or if you are creating a Capacity Reservation. Capacity Reservations count towards your On-Demand Instance limits. If your request fails due to limit constraints, increase your On-Demand Instance limit for the required instance type and try again. For more information, see EC2 On-Demand instance limits."},
+	ErrorInstanceScheduleLimitExceeded:                         {HTTPCode: 400, Message: "You've reached the limit on the number of schedules you can create for an instance."},
 	ErrorInstanceTpmEkPubNotFound:                              {HTTPCode: 400, Message: "The public Trusted Platform Module (TPM) Endorsement Key (EK) cannot be found."},
 	ErrorInsufficientAddressCapacity:                           {HTTPCode: 503, Message: "Not enough available addresses to satisfy your minimum request. Reduce the number of addresses you are requesting or wait for additional capacity to become available."},
 	ErrorInsufficientCapacity:                                  {HTTPCode: 503, Message: "There is not enough capacity to fulfill your import instance request. You can wait for additional capacity to become available."},
@@ -638,6 +682,8 @@ var ErrorLookup = map[string]ErrorMessage{
 	ErrorInvalidInstanceIDMalformed:                            {HTTPCode: 400, Message: "The specified instance ID is malformed. Ensure that you provide the full instance ID in the request, in the form i-xxxxxxxx or i-xxxxxxxxxxxxxxxxx."},
 	ErrorInvalidInstanceIDNotFound:                             {HTTPCode: 404, Message: "The specified instance does not exist. This error might occur because the ID of a recently created instance has not propagated through the system. For more information, see Ensuring idempotency."},
 	ErrorInvalidInstanceIDNotLinkable:                          {HTTPCode: 400, Message: "The specified instance cannot be linked to the specified VPC. This error may also occur if the instance was recently launched, and its ID has not yet propagated through the system. Wait a few minutes, or wait until the instance is in the running state, and then try again."},
+	ErrorInvalidInstanceScheduleIDMalformed:                    {HTTPCode: 400, Message: "The specified instance schedule ID is malformed."},
+	ErrorInvalidInstanceScheduleIDNotFound:                     {HTTPCode: 404, Message: "The specified instance schedule does not exist."},
 	ErrorInvalidInstanceState:                                  {HTTPCode: 400, Message: "The instance is not in an appropriate state to complete the request. If you're modifying the instance placement, the instance must be in the stopped state."},
 	ErrorInvalidInstanceType:                                   {HTTPCode: 400, Message: "The instance type is not supported for this request. For example, you can only bundle instance store-backed Windows instances."},
 	ErrorInvalidInterfaceIpAddressLimitExceeded:                {HTTPCode: 400, Message: "The number of private IP addresses for a specified network interface exceeds the limit for the type of instance you are trying to launch. For more information, see IP addresses per network interface per instance type."},
@@ -894,6 +940,9 @@ var ErrorLookup = map[string]ErrorMessage{
 	ErrorIAMMalformedPolicyDocument: {HTTPCode: 400, Message: "The policy document is malformed."},
 	ErrorAccessDenied:               {HTTPCode: 403, Message: "User is not authorized to perform this action."},
 
+	// STS error codes
+	ErrorSTSExpiredToken: {HTTPCode: 400, Message: "The security token included in the request is expired."},
+
 	// ELBv2 error codes
 	ErrorELBv2LoadBalancerNotFound:         {HTTPCode: 400, Message: "One or more load balancers not found."},
 	ErrorELBv2TargetGroupNotFound:          {HTTPCode: 400, Message: "One or more target groups not found."},
@@ -912,4 +961,8 @@ var ErrorLookup = map[string]ErrorMessage{
 	ErrorELBv2SubnetNotFound:               {HTTPCode: 400, Message: "The specified subnet does not exist."},
 	ErrorELBv2AvailabilityZoneNotSupported: {HTTPCode: 400, Message: "The specified Availability Zone is not supported."},
 	ErrorELBv2InvalidConfigurationRequest:  {HTTPCode: 400, Message: "Security groups are not supported for load balancers with type 'network'."},
+
+	// Auto Scaling error codes
+	ErrorAutoScalingAlreadyExists:             {HTTPCode: 400, Message: "An Auto Scaling group with the same name already exists."},
+	ErrorAutoScalingScalingActivityInProgress: {HTTPCode: 400, Message: "You cannot delete an Auto Scaling group while there are instances or scaling activities in progress for that group."},
 }
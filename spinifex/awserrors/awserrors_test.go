@@ -1,6 +1,10 @@
 package awserrors
 
-import "testing"
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
 
 func TestErrorLookup(t *testing.T) {
 	expected := []struct {
@@ -66,6 +70,7 @@ func TestErrorLookup(t *testing.T) {
 		{code: "InstanceCreditSpecification.NotSupported", http: 400, message: "The specified instance does not use CPU credits for CPU usage; only T2 instances use CPU credits for CPU usage."},
 		{code: "InstanceEventStartTimeCannotChange", http: 400, message: "The specified scheduled event start time does not meet the requirements for rescheduling a scheduled event. For more information, see Limitations."},
 		{code: "InstanceLimitExceeded", http: 400, message: "You've reached the limit on the number of instances you can run concurrently. This error can occur if you are launching an instance or if you are creating a Capacity Reservation. Capacity Reservations count towards your On-Demand Instance limits. If your request fails due to limit constraints, increase your On-Demand Instance limit for the required instance type and try again. For more information, see EC2 On-Demand instance limits."},
+		{code: "InstanceScheduleLimitExceeded", http: 400, message: "You've reached the limit on the number of schedules you can create for an instance."},
 		{code: "InstanceTpmEkPubNotFound", http: 400, message: "The public Trusted Platform Module (TPM) Endorsement Key (EK) cannot be found."},
 		{code: "InsufficientAddressCapacity", http: 503, message: "Not enough available addresses to satisfy your minimum request. Reduce the number of addresses you are requesting or wait for additional capacity to become available."},
 		{code: "InsufficientCapacity", http: 503, message: "There is not enough capacity to fulfill your import instance request. You can wait for additional capacity to become available."},
@@ -180,6 +185,8 @@ func TestErrorLookup(t *testing.T) {
 		{code: "InvalidInstanceID.Malformed", http: 400, message: "The specified instance ID is malformed. Ensure that you provide the full instance ID in the request, in the form i-xxxxxxxx or i-xxxxxxxxxxxxxxxxx."},
 		{code: "InvalidInstanceID.NotFound", http: 404, message: "The specified instance does not exist. This error might occur because the ID of a recently created instance has not propagated through the system. For more information, see Ensuring idempotency."},
 		{code: "InvalidInstanceID.NotLinkable", http: 400, message: "The specified instance cannot be linked to the specified VPC. This error may also occur if the instance was recently launched, and its ID has not yet propagated through the system. Wait a few minutes, or wait until the instance is in the running state, and then try again."},
+		{code: "InvalidInstanceScheduleID.Malformed", http: 400, message: "The specified instance schedule ID is malformed."},
+		{code: "InvalidInstanceScheduleID.NotFound", http: 404, message: "The specified instance schedule does not exist."},
 		{code: "InvalidInstanceState", http: 400, message: "The instance is not in an appropriate state to complete the request. If you're modifying the instance placement, the instance must be in the stopped state."},
 		{code: "InvalidInstanceType", http: 400, message: "The instance type is not supported for this request. For example, you can only bundle instance store-backed Windows instances."},
 		{code: "InvalidInterface.IpAddressLimitExceeded", http: 400, message: "The number of private IP addresses for a specified network interface exceeds the limit for the type of instance you are trying to launch. For more information, see IP addresses per network interface per instance type."},
@@ -435,6 +442,8 @@ func TestErrorLookup(t *testing.T) {
 		{code: "LimitExceeded", http: 409, message: "The request was rejected because it attempted to create resources beyond the current AWS account limits."},
 		{code: "MalformedPolicyDocument", http: 400, message: "The policy document is malformed."},
 		{code: "AccessDenied", http: 403, message: "User is not authorized to perform this action."},
+		// STS error codes
+		{code: "ExpiredToken", http: 400, message: "The security token included in the request is expired."},
 		// ELBv2 error codes
 		{code: "LoadBalancerNotFound", http: 400, message: "One or more load balancers not found."},
 		{code: "TargetGroupNotFound", http: 400, message: "One or more target groups not found."},
@@ -453,6 +462,9 @@ func TestErrorLookup(t *testing.T) {
 		{code: "SubnetNotFound", http: 400, message: "The specified subnet does not exist."},
 		{code: "AvailabilityZoneNotSupported", http: 400, message: "The specified Availability Zone is not supported."},
 		{code: "InvalidConfigurationRequest", http: 400, message: "Security groups are not supported for load balancers with type 'network'."},
+		// Auto Scaling error codes
+		{code: "AlreadyExists", http: 400, message: "An Auto Scaling group with the same name already exists."},
+		{code: "ScalingActivityInProgress", http: 400, message: "You cannot delete an Auto Scaling group while there are instances or scaling activities in progress for that group."},
 	}
 
 	if len(ErrorLookup) != len(expected) {
@@ -494,3 +506,76 @@ func TestValidErrorCode(t *testing.T) {
 		})
 	}
 }
+
+func TestWithDetail(t *testing.T) {
+	err := WithDetail(ErrorIncorrectState, "block node still in use")
+	if err.Error() != ErrorIncorrectState {
+		t.Errorf("Error() = %q, want bare code %q", err.Error(), ErrorIncorrectState)
+	}
+	if got := Detail(fmt.Errorf("wrapped: %w", err)); got != "block node still in use" {
+		t.Errorf("Detail(wrapped) = %q", got)
+	}
+	if got := Detail(errors.New(ErrorIncorrectState)); got != "" {
+		t.Errorf("Detail(plain) = %q, want empty", got)
+	}
+}
+
+func TestToError(t *testing.T) {
+	got := ToError(WithDetail(ErrorIncorrectState, "volume is attached"), "req-1")
+	if got.Code != ErrorIncorrectState || got.Message != "volume is attached" || got.RequestID != "req-1" {
+		t.Errorf("ToError(detailed) = %+v", got)
+	}
+	if got := ToError(errors.New("dial tcp: connection refused"), "req-1"); got.Code != ErrorServerInternal || got.Message != "" {
+		t.Errorf("ToError(raw) = %+v, want bare InternalError", got)
+	}
+	if got := ToError(&Error{Code: ErrorAuthFailure, RequestID: "req-0"}, "req-1"); got.RequestID != "req-0" {
+		t.Errorf("ToError kept request ID %q, want req-0", got.RequestID)
+	}
+}
+
+func TestReplyRoundTrip(t *testing.T) {
+	kind, data, err := ResultReply(map[string]string{"status": "running"}).Body()
+	if err != nil || kind != ReplyResult {
+		t.Fatalf("Body() = %q, %v", kind, err)
+	}
+	reply, err := ParseReply(kind, data)
+	if err != nil {
+		t.Fatalf("ParseReply(result) error: %v", err)
+	}
+	var out map[string]string
+	if err := reply.Decode(&out); err != nil || out["status"] != "running" {
+		t.Errorf("Decode() = %v, %v", out, err)
+	}
+
+	kind, data, err = ErrorReply(WithDetail(ErrorInvalidVolumeNotFound, "vol-1"), "req-1").Body()
+	if err != nil || kind != ReplyError {
+		t.Fatalf("Body() = %q, %v", kind, err)
+	}
+	if string(data) != `{"Code":"InvalidVolume.NotFound","Message":"vol-1","RequestId":"req-1"}` {
+		t.Errorf("error body = %s", data)
+	}
+	reply, err = ParseReply(kind, data)
+	if err != nil {
+		t.Fatalf("ParseReply(error) error: %v", err)
+	}
+	var replyErr *Error
+	if err := reply.Decode(&out); !errors.As(err, &replyErr) || replyErr.Code != ErrorInvalidVolumeNotFound || replyErr.RequestID != "req-1" {
+		t.Errorf("Decode() error = %v", err)
+	}
+	if Detail(reply.Err) != "vol-1" {
+		t.Errorf("Detail(reply.Err) = %q", Detail(reply.Err))
+	}
+}
+
+func TestParseReply_Malformed(t *testing.T) {
+	if _, err := ParseReply("bogus", nil); err == nil {
+		t.Error("ParseReply(unknown kind) succeeded")
+	}
+	if _, err := ParseReply(ReplyError, []byte("not-json")); err == nil {
+		t.Error("ParseReply(bad error body) succeeded")
+	}
+	reply, err := ParseReply(ReplyError, []byte(`{}`))
+	if err != nil || reply.Err.Code != ErrorServerInternal {
+		t.Errorf("ParseReply(empty error) = %+v, %v", reply.Err, err)
+	}
+}
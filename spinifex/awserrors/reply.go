@@ -0,0 +1,111 @@
+package awserrors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ReplyHeader is the NATS header that marks a reply as a Reply envelope. Its
+// value says which side of the envelope the body holds: ReplyResult or
+// ReplyError. Replies without it come from services that predate the
+// envelope.
+const ReplyHeader = "Spinifex-Reply"
+
+const (
+	ReplyResult = "result"
+	ReplyError  = "error"
+)
+
+// Error is an AWS error as it crosses NATS: the error code, a client-safe
+// detail message and the ID of the API request that failed. Error() returns
+// the bare code so existing code comparisons and ErrorLookup keep working.
+type Error struct {
+	Code      string `json:"Code"`
+	Message   string `json:"Message,omitempty"`
+	RequestID string `json:"RequestId,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Code
+}
+
+// ToError converts err into an *Error for the request requestID. An err that
+// is not an AWS error code becomes InternalError, so raw Go errors never
+// reach clients; an *Error keeps its own request ID unless it has none.
+func ToError(err error, requestID string) *Error {
+	var awsErr *Error
+	if errors.As(err, &awsErr) {
+		out := *awsErr
+		out.Code = ValidErrorCode(out.Code)
+		if out.RequestID == "" {
+			out.RequestID = requestID
+		}
+		return &out
+	}
+	return &Error{Code: ValidErrorCode(err.Error()), Message: Detail(err), RequestID: requestID}
+}
+
+// Reply is the envelope every daemon handler answers a NATS request with:
+// the JSON result of a request that succeeded, or the error it failed with.
+// Exactly one of the two is set.
+type Reply struct {
+	Result json.RawMessage
+	Err    *Error
+}
+
+// ResultReply returns a Reply carrying v marshalled as JSON, or an
+// InternalError reply when v cannot be marshalled.
+func ResultReply(v any) Reply {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return Reply{Err: &Error{Code: ErrorServerInternal}}
+	}
+	return Reply{Result: data}
+}
+
+// ErrorReply returns a Reply carrying err as an *Error for requestID.
+func ErrorReply(err error, requestID string) Reply {
+	return Reply{Err: ToError(err, requestID)}
+}
+
+// Body returns the reply's NATS message body and the ReplyHeader value that
+// goes with it.
+func (r Reply) Body() (kind string, data []byte, err error) {
+	if r.Err != nil {
+		data, err = json.Marshal(r.Err)
+		return ReplyError, data, err
+	}
+	return ReplyResult, r.Result, nil
+}
+
+// ParseReply decodes a reply body marked with ReplyHeader value kind.
+func ParseReply(kind string, data []byte) (Reply, error) {
+	switch kind {
+	case ReplyResult:
+		return Reply{Result: data}, nil
+	case ReplyError:
+		var e Error
+		if err := json.Unmarshal(data, &e); err != nil {
+			return Reply{}, fmt.Errorf("decode error reply: %w", err)
+		}
+		if e.Code == "" {
+			e.Code = ErrorServerInternal
+		}
+		return Reply{Err: &e}, nil
+	default:
+		return Reply{}, fmt.Errorf("unknown reply kind %q", kind)
+	}
+}
+
+// Decode returns the reply's error, if it has one, or unmarshals its result
+// into out.
+func (r Reply) Decode(out any) error {
+	if r.Err != nil {
+		return r.Err
+	}
+	if err := json.Unmarshal(r.Result, out); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,448 @@
+// Package backup exports the cluster's state to a versioned JSON archive and
+// restores it, for backup and disaster recovery.
+//
+// An archive holds the latest value of every key in the Spinifex KV buckets,
+// with each bucket's schema version, and the resource tags, key pairs and
+// volume, snapshot and image metadata kept in the Predastore bucket. Block
+// data stays in Predastore and is backed up with it.
+package backup
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/mulgadc/spinifex/spinifex/objectstore"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// Format identifies a Spinifex state archive.
+	Format = "spinifex-state"
+	// Version is the archive layout this release writes and reads.
+	Version = 1
+)
+
+// ErrRefused wraps the reasons Import refuses an archive. It is returned
+// before anything is written.
+var ErrRefused = errors.New("restore refused")
+
+// bucketPrefix names the KV buckets Spinifex owns.
+const bucketPrefix = "spinifex-"
+
+// excludedBuckets hold state that only means something to the cluster that
+// wrote it, and that a restored cluster rebuilds for itself.
+var excludedBuckets = map[string]bool{
+	"spinifex-cluster-state":  true, // node heartbeats, shutdown markers, service manifests
+	"spinifex-vpcd-reconcile": true, // vpcd leader lease
+	"spinifex-iam-sessions":   true, // temporary credentials
+}
+
+// ObjectPrefixes are the prefixes of the Predastore bucket an archive keeps:
+// resource tags and key pairs.
+var ObjectPrefixes = []string{"tags/", "keys/"}
+
+// MetadataPrefixes are the prefixes of the volume, snapshot and image
+// objects in the Predastore bucket. An archive keeps each resource's
+// top-level MetadataFiles but not its block data, which sits below them.
+var MetadataPrefixes = []string{"vol-", "snap-", "ami-"}
+
+// MetadataFiles name the resource metadata objects an archive keeps.
+var MetadataFiles = []string{"config.json", "metadata.json", "performance.json", "local.json", "encryption.json"}
+
+// archivedPrefixes are all the prefixes an archive covers.
+func archivedPrefixes() []string {
+	return slices.Concat(ObjectPrefixes, MetadataPrefixes)
+}
+
+// Archive is a snapshot of the cluster state.
+type Archive struct {
+	Format  string    `json:"format"`
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	Buckets []Bucket  `json:"buckets"`
+	Objects []Entry   `json:"objects,omitempty"`
+}
+
+// Bucket is a KV bucket's settings, schema version and latest values. The
+// schema version is the bucket's _version key, which Entries leaves out.
+type Bucket struct {
+	Name          string        `json:"name"`
+	SchemaVersion int           `json:"schema_version"`
+	History       int64         `json:"history"`
+	TTL           time.Duration `json:"ttl,omitempty"`
+	Entries       []Entry       `json:"entries"`
+}
+
+// Entry is a KV key or an object with its value.
+type Entry struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// Summary counts what an export or import covered.
+type Summary struct {
+	Buckets int `json:"buckets"`
+	Entries int `json:"entries"`
+	Objects int `json:"objects"`
+}
+
+// Summary counts the archive's buckets, KV entries and objects.
+func (a *Archive) Summary() Summary {
+	s := Summary{Buckets: len(a.Buckets), Objects: len(a.Objects)}
+	for _, b := range a.Buckets {
+		s.Entries += len(b.Entries)
+	}
+	return s
+}
+
+// Write encodes the archive as JSON.
+func (a *Archive) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(a)
+}
+
+// Read decodes an archive and checks this release can restore it.
+func Read(r io.Reader) (*Archive, error) {
+	var a Archive
+	if err := json.NewDecoder(r).Decode(&a); err != nil {
+		return nil, fmt.Errorf("decode archive: %w", err)
+	}
+	if err := a.validate(); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// validate checks the archive's format and version.
+func (a *Archive) validate() error {
+	if a.Format != Format {
+		return fmt.Errorf("%w: not a Spinifex state archive (format %q)", ErrRefused, a.Format)
+	}
+	if a.Version < 1 || a.Version > Version {
+		return fmt.Errorf("%w: archive version %d is not supported by this release (supports %d)", ErrRefused, a.Version, Version)
+	}
+	return nil
+}
+
+// Export snapshots the Spinifex KV buckets and, when store is set, the
+// ObjectPrefixes and resource metadata of bucket. Keys written during the export may or may not
+// be included, so export from a quiet cluster for a consistent archive.
+func Export(js nats.JetStreamContext, store objectstore.ObjectStore, bucket string) (*Archive, error) {
+	a := &Archive{Format: Format, Version: Version, Created: time.Now().UTC(), Buckets: []Bucket{}}
+
+	var names []string
+	for name := range js.KeyValueStoreNames() {
+		if strings.HasPrefix(name, bucketPrefix) && !excludedBuckets[name] {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		b, err := exportBucket(js, name)
+		if err != nil {
+			return nil, err
+		}
+		a.Buckets = append(a.Buckets, *b)
+	}
+
+	if store != nil {
+		for _, prefix := range archivedPrefixes() {
+			objects, err := exportObjects(store, bucket, prefix)
+			if err != nil {
+				return nil, err
+			}
+			a.Objects = append(a.Objects, objects...)
+		}
+	}
+	return a, nil
+}
+
+func exportBucket(js nats.JetStreamContext, name string) (*Bucket, error) {
+	kv, err := js.KeyValue(name)
+	if err != nil {
+		return nil, fmt.Errorf("open bucket %s: %w", name, err)
+	}
+	status, err := kv.Status()
+	if err != nil {
+		return nil, fmt.Errorf("status of %s: %w", name, err)
+	}
+	version, err := utils.ReadVersion(kv)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	keys, err := kv.Keys()
+	if err != nil && !errors.Is(err, nats.ErrNoKeysFound) {
+		return nil, fmt.Errorf("list keys of %s: %w", name, err)
+	}
+	slices.Sort(keys)
+
+	b := &Bucket{Name: name, SchemaVersion: version, History: status.History(), TTL: status.TTL(), Entries: []Entry{}}
+	for _, key := range keys {
+		if key == utils.VersionKey {
+			continue
+		}
+		entry, err := kv.Get(key)
+		if err != nil {
+			if errors.Is(err, nats.ErrKeyNotFound) {
+				continue // deleted since it was listed
+			}
+			return nil, fmt.Errorf("get %s from %s: %w", key, name, err)
+		}
+		b.Entries = append(b.Entries, Entry{Key: key, Value: entry.Value()})
+	}
+	return b, nil
+}
+
+func exportObjects(store objectstore.ObjectStore, bucket, prefix string) ([]Entry, error) {
+	keys, err := archivedKeys(store, bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []Entry
+	for _, key := range keys {
+		out, err := store.GetObject(&s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+		if err != nil {
+			if objectstore.IsNoSuchKeyError(err) {
+				continue // deleted since it was listed
+			}
+			return nil, fmt.Errorf("get object %s: %w", key, err)
+		}
+		data, err := io.ReadAll(out.Body)
+		_ = out.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read object %s: %w", key, err)
+		}
+		objects = append(objects, Entry{Key: key, Value: data})
+	}
+	return objects, nil
+}
+
+// archivedKeys returns the keys under prefix that an archive keeps, sorted:
+// every key under an ObjectPrefixes entry, and the MetadataFiles of each
+// resource under a MetadataPrefixes entry.
+func archivedKeys(store objectstore.ObjectStore, bucket, prefix string) ([]string, error) {
+	if !slices.Contains(MetadataPrefixes, prefix) {
+		keys, _, err := listObjects(store, bucket, prefix, "")
+		return keys, err
+	}
+
+	_, resources, err := listObjects(store, bucket, prefix, "/")
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, resource := range resources {
+		files, _, err := listObjects(store, bucket, resource, "/")
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range files {
+			if slices.Contains(MetadataFiles, strings.TrimPrefix(key, resource)) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	slices.Sort(keys)
+	return keys, nil
+}
+
+// listObjects returns the keys and, with a delimiter, the common prefixes
+// under prefix, sorted.
+func listObjects(store objectstore.ObjectStore, bucket, prefix, delimiter string) ([]string, []string, error) {
+	var keys, prefixes []string
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(bucket), Prefix: aws.String(prefix)}
+	if delimiter != "" {
+		input.Delimiter = aws.String(delimiter)
+	}
+	for {
+		out, err := store.ListObjectsV2(input)
+		if err != nil {
+			return nil, nil, fmt.Errorf("list objects under %s: %w", prefix, err)
+		}
+		for _, obj := range out.Contents {
+			keys = append(keys, aws.StringValue(obj.Key))
+		}
+		for _, p := range out.CommonPrefixes {
+			prefixes = append(prefixes, aws.StringValue(p.Prefix))
+		}
+		if !aws.BoolValue(out.IsTruncated) || out.NextContinuationToken == nil {
+			break
+		}
+		input.ContinuationToken = out.NextContinuationToken
+	}
+	slices.Sort(keys)
+	slices.Sort(prefixes)
+	return keys, prefixes, nil
+}
+
+// ImportOptions control a restore.
+type ImportOptions struct {
+	// Replicas is the replication of the buckets Import creates.
+	Replicas int
+	// Replace clears buckets and object prefixes that already hold state.
+	// Without it, Import only restores into empty ones.
+	Replace bool
+}
+
+// Import restores an archive. Everything is checked before anything is
+// written: the archive's format and version, that no bucket's schema is
+// newer than the cluster's, and that the destination is empty unless
+// opts.Replace is set. Buckets are restored at the archive's schema
+// version, so an older archive is migrated when the services next start.
+func Import(js nats.JetStreamContext, store objectstore.ObjectStore, bucket string, a *Archive, opts ImportOptions) (Summary, error) {
+	if err := a.validate(); err != nil {
+		return Summary{}, err
+	}
+	if len(a.Objects) > 0 && store == nil {
+		return Summary{}, fmt.Errorf("%w: archive has objects but no object store was given", ErrRefused)
+	}
+
+	existing := make(map[string]nats.KeyValue)
+	for _, b := range a.Buckets {
+		if !strings.HasPrefix(b.Name, bucketPrefix) || excludedBuckets[b.Name] {
+			return Summary{}, fmt.Errorf("%w: archive bucket %s is not restorable", ErrRefused, b.Name)
+		}
+		kv, err := js.KeyValue(b.Name)
+		if errors.Is(err, nats.ErrBucketNotFound) {
+			continue
+		}
+		if err != nil {
+			return Summary{}, fmt.Errorf("open bucket %s: %w", b.Name, err)
+		}
+		if err := checkBucket(kv, b, opts.Replace); err != nil {
+			return Summary{}, err
+		}
+		existing[b.Name] = kv
+	}
+	if store != nil && !opts.Replace {
+		for _, prefix := range archivedPrefixes() {
+			keys, err := archivedKeys(store, bucket, prefix)
+			if err != nil {
+				return Summary{}, err
+			}
+			if len(keys) > 0 {
+				return Summary{}, fmt.Errorf("%w: object store already holds objects under %s", ErrRefused, prefix)
+			}
+		}
+	}
+
+	for _, b := range a.Buckets {
+		kv, ok := existing[b.Name]
+		if !ok {
+			var err error
+			kv, err = js.CreateKeyValue(&nats.KeyValueConfig{
+				Bucket:   b.Name,
+				History:  uint8(min(max(b.History, 1), 64)),
+				TTL:      b.TTL,
+				Replicas: max(opts.Replicas, 1),
+			})
+			if err != nil {
+				return Summary{}, fmt.Errorf("create bucket %s: %w", b.Name, err)
+			}
+		}
+		if err := restoreBucket(kv, b, opts.Replace && ok); err != nil {
+			return Summary{}, err
+		}
+	}
+
+	if store != nil && len(a.Objects) > 0 {
+		if err := restoreObjects(store, bucket, a.Objects, opts.Replace); err != nil {
+			return Summary{}, err
+		}
+	}
+	return a.Summary(), nil
+}
+
+// checkBucket checks the archived bucket b can be restored into kv.
+func checkBucket(kv nats.KeyValue, b Bucket, replace bool) error {
+	current, err := utils.ReadVersion(kv)
+	if err != nil {
+		return fmt.Errorf("%s: %w", b.Name, err)
+	}
+	if current > 0 && b.SchemaVersion > current {
+		return fmt.Errorf("%w: bucket %s has schema version %d in the archive but %d in this cluster; restore with the release that wrote the archive",
+			ErrRefused, b.Name, b.SchemaVersion, current)
+	}
+	if replace {
+		return nil
+	}
+	keys, err := kv.Keys()
+	if err != nil && !errors.Is(err, nats.ErrNoKeysFound) {
+		return fmt.Errorf("list keys of %s: %w", b.Name, err)
+	}
+	for _, key := range keys {
+		if key != utils.VersionKey {
+			return fmt.Errorf("%w: bucket %s already holds state", ErrRefused, b.Name)
+		}
+	}
+	return nil
+}
+
+// restoreBucket writes b's entries and schema version to kv, first purging
+// the keys kv holds when purge is set.
+func restoreBucket(kv nats.KeyValue, b Bucket, purge bool) error {
+	if purge {
+		keys, err := kv.Keys()
+		if err != nil && !errors.Is(err, nats.ErrNoKeysFound) {
+			return fmt.Errorf("list keys of %s: %w", b.Name, err)
+		}
+		for _, key := range keys {
+			if err := kv.Purge(key); err != nil {
+				return fmt.Errorf("purge %s from %s: %w", key, b.Name, err)
+			}
+		}
+	}
+	for _, e := range b.Entries {
+		if _, err := kv.Put(e.Key, e.Value); err != nil {
+			return fmt.Errorf("put %s in %s: %w", e.Key, b.Name, err)
+		}
+	}
+	// Stamped directly rather than with utils.WriteVersion, which never
+	// lowers a version: an older archive must be migrated on startup.
+	if b.SchemaVersion > 0 {
+		if _, err := kv.PutString(utils.VersionKey, strconv.Itoa(b.SchemaVersion)); err != nil {
+			return fmt.Errorf("stamp version on %s: %w", b.Name, err)
+		}
+	}
+	return nil
+}
+
+func restoreObjects(store objectstore.ObjectStore, bucket string, objects []Entry, replace bool) error {
+	if replace {
+		for _, prefix := range archivedPrefixes() {
+			keys, err := archivedKeys(store, bucket, prefix)
+			if err != nil {
+				return err
+			}
+			for _, key := range keys {
+				if _, err := store.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}); err != nil {
+					return fmt.Errorf("delete object %s: %w", key, err)
+				}
+			}
+		}
+	}
+	for _, o := range objects {
+		if _, err := store.PutObject(&s3.PutObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(o.Key),
+			Body:   bytes.NewReader(o.Value),
+		}); err != nil {
+			return fmt.Errorf("put object %s: %w", o.Key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+package backup
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/mulgadc/spinifex/spinifex/objectstore"
+	"github.com/mulgadc/spinifex/spinifex/testutil"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testBucket = "spinifex"
+
+// seedCluster writes state to a cluster as its services would.
+func seedCluster(t *testing.T, js nats.JetStreamContext, store objectstore.ObjectStore) {
+	t.Helper()
+	kv := testutil.SeedKV(t, js, "spinifex-instance-state", map[string][]byte{
+		"node.node1": []byte(`{"i-0123":{"id":"i-0123"}}`),
+	})
+	require.NoError(t, utils.WriteVersion(kv, 1))
+
+	kv, err := js.CreateKeyValue(&nats.KeyValueConfig{Bucket: "spinifex-terminated-instances", History: 1, TTL: time.Hour})
+	require.NoError(t, err)
+	_, err = kv.Put("i-0456", []byte(`{"id":"i-0456"}`))
+	require.NoError(t, err)
+
+	kv = testutil.SeedKV(t, js, "spinifex-vpc-vpcs", map[string][]byte{
+		"000000000001.vpc-1": []byte(`{"vpc_id":"vpc-1"}`),
+		"000000000001.vpc-2": []byte(`{"vpc_id":"vpc-2"}`),
+	})
+	require.NoError(t, utils.WriteVersion(kv, 2))
+
+	// Not exported: cluster-local or not Spinifex's
+	testutil.SeedKV(t, js, "spinifex-cluster-state", map[string][]byte{"heartbeat.node1": []byte(`{}`)})
+	testutil.SeedKV(t, js, "other-app", map[string][]byte{"k": []byte("v")})
+
+	for key, body := range map[string]string{
+		"tags/000000000001/vol-1.json": `{"Name":"data"}`,
+		"keys/000000000001/key-1.json": `{"KeyName":"ops"}`,
+		"vol-1/config.json":            `{"VolumeName":"vol-1"}`,
+		"vol-1/performance.json":       `{"Iops":3000}`,
+		"snap-1/metadata.json":         `{"SnapshotID":"snap-1"}`,
+		"ami-1/config.json":            `{"ImageID":"ami-1"}`,
+		// Not exported: block data and other objects
+		"vol-1/chunks/chunk.00000001.bin": "block",
+		"snap-1/checkpoints/blocks.json":  `{}`,
+		"backups/state/old-backup.json":   `{}`,
+	} {
+		_, err := store.PutObject(&s3.PutObjectInput{Bucket: aws.String(testBucket), Key: aws.String(key), Body: strings.NewReader(body)})
+		require.NoError(t, err)
+	}
+}
+
+func TestExport(t *testing.T) {
+	_, _, js := testutil.StartTestJetStream(t)
+	store := objectstore.NewMemoryObjectStore()
+	seedCluster(t, js, store)
+
+	a, err := Export(js, store, testBucket)
+	require.NoError(t, err)
+	assert.Equal(t, Format, a.Format)
+	assert.Equal(t, Version, a.Version)
+
+	names := make([]string, len(a.Buckets))
+	for i, b := range a.Buckets {
+		names[i] = b.Name
+	}
+	assert.Equal(t, []string{"spinifex-instance-state", "spinifex-terminated-instances", "spinifex-vpc-vpcs"}, names)
+
+	vpcs := a.Buckets[2]
+	assert.Equal(t, 2, vpcs.SchemaVersion)
+	assert.Equal(t, []Entry{
+		{Key: "000000000001.vpc-1", Value: []byte(`{"vpc_id":"vpc-1"}`)},
+		{Key: "000000000001.vpc-2", Value: []byte(`{"vpc_id":"vpc-2"}`)},
+	}, vpcs.Entries, "entries are sorted and _version is left out")
+	assert.Equal(t, time.Hour, a.Buckets[1].TTL)
+	assert.Equal(t, 0, a.Buckets[1].SchemaVersion)
+
+	keys := make([]string, len(a.Objects))
+	for i, o := range a.Objects {
+		keys[i] = o.Key
+	}
+	assert.Equal(t, []string{
+		"tags/000000000001/vol-1.json", "keys/000000000001/key-1.json",
+		"vol-1/config.json", "vol-1/performance.json", "snap-1/metadata.json", "ami-1/config.json",
+	}, keys)
+	assert.Equal(t, Summary{Buckets: 3, Entries: 4, Objects: 6}, a.Summary())
+}
+
+func TestExportImport_RoundTrip(t *testing.T) {
+	_, _, srcJS := testutil.StartTestJetStream(t)
+	srcStore := objectstore.NewMemoryObjectStore()
+	seedCluster(t, srcJS, srcStore)
+
+	exported, err := Export(srcJS, srcStore, testBucket)
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, exported.Write(&buf))
+
+	// A fresh cluster whose services created one of the buckets already
+	_, _, dstJS := testutil.StartTestJetStream(t)
+	dstStore := objectstore.NewMemoryObjectStore()
+	kv := testutil.SeedKV(t, dstJS, "spinifex-vpc-vpcs", nil)
+	require.NoError(t, utils.WriteVersion(kv, 2))
+
+	archive, err := Read(&buf)
+	require.NoError(t, err)
+	summary, err := Import(dstJS, dstStore, testBucket, archive, ImportOptions{Replicas: 1})
+	require.NoError(t, err)
+	assert.Equal(t, Summary{Buckets: 3, Entries: 4, Objects: 6}, summary)
+
+	reexported, err := Export(dstJS, dstStore, testBucket)
+	require.NoError(t, err)
+	assert.Equal(t, exported.Buckets, reexported.Buckets)
+	assert.Equal(t, exported.Objects, reexported.Objects)
+}
+
+func TestImport_OlderSchemaIsMigratedOnStartup(t *testing.T) {
+	_, _, js := testutil.StartTestJetStream(t)
+	kv := testutil.SeedKV(t, js, "spinifex-vpc-vpcs", nil)
+	require.NoError(t, utils.WriteVersion(kv, 3))
+
+	a := &Archive{Format: Format, Version: Version, Buckets: []Bucket{{
+		Name: "spinifex-vpc-vpcs", SchemaVersion: 2, History: 1,
+		Entries: []Entry{{Key: "000000000001.vpc-1", Value: []byte(`{}`)}},
+	}}}
+	_, err := Import(js, nil, "", a, ImportOptions{})
+	require.NoError(t, err)
+
+	version, err := utils.ReadVersion(kv)
+	require.NoError(t, err)
+	assert.Equal(t, 2, version, "the archive's version is restored so migrations run from it")
+}
+
+func TestImport_Refused(t *testing.T) {
+	archive := func(buckets ...Bucket) *Archive {
+		return &Archive{Format: Format, Version: Version, Buckets: buckets}
+	}
+	vpcs := Bucket{Name: "spinifex-vpc-vpcs", SchemaVersion: 2, History: 1, Entries: []Entry{{Key: "000000000001.vpc-1", Value: []byte(`{}`)}}}
+
+	tests := []struct {
+		name    string
+		archive *Archive
+		seed    func(t *testing.T, js nats.JetStreamContext, store objectstore.ObjectStore)
+		wantErr string
+	}{
+		{
+			name:    "newer archive version",
+			archive: &Archive{Format: Format, Version: Version + 1},
+			wantErr: "not supported by this release",
+		},
+		{
+			name:    "wrong format",
+			archive: &Archive{Format: "something-else", Version: 1},
+			wantErr: "not a Spinifex state archive",
+		},
+		{
+			name:    "excluded bucket",
+			archive: archive(Bucket{Name: "spinifex-cluster-state"}),
+			wantErr: "not restorable",
+		},
+		{
+			name:    "foreign bucket",
+			archive: archive(Bucket{Name: "other-app"}),
+			wantErr: "not restorable",
+		},
+		{
+			name:    "newer bucket schema",
+			archive: archive(vpcs),
+			seed: func(t *testing.T, js nats.JetStreamContext, _ objectstore.ObjectStore) {
+				require.NoError(t, utils.WriteVersion(testutil.SeedKV(t, js, "spinifex-vpc-vpcs", nil), 1))
+			},
+			wantErr: "schema version 2 in the archive but 1 in this cluster",
+		},
+		{
+			name:    "bucket holds state",
+			archive: archive(vpcs),
+			seed: func(t *testing.T, js nats.JetStreamContext, _ objectstore.ObjectStore) {
+				testutil.SeedKV(t, js, "spinifex-vpc-vpcs", map[string][]byte{"000000000001.vpc-9": []byte(`{}`)})
+			},
+			wantErr: "bucket spinifex-vpc-vpcs already holds state",
+		},
+		{
+			name:    "object store holds tags",
+			archive: archive(vpcs),
+			seed: func(t *testing.T, _ nats.JetStreamContext, store objectstore.ObjectStore) {
+				_, err := store.PutObject(&s3.PutObjectInput{Bucket: aws.String(testBucket), Key: aws.String("tags/000000000001/vol-9.json"), Body: strings.NewReader(`{}`)})
+				require.NoError(t, err)
+			},
+			wantErr: "already holds objects under tags/",
+		},
+		{
+			name:    "object store holds volume metadata",
+			archive: archive(vpcs),
+			seed: func(t *testing.T, _ nats.JetStreamContext, store objectstore.ObjectStore) {
+				_, err := store.PutObject(&s3.PutObjectInput{Bucket: aws.String(testBucket), Key: aws.String("vol-9/config.json"), Body: strings.NewReader(`{}`)})
+				require.NoError(t, err)
+			},
+			wantErr: "already holds objects under vol-",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, js := testutil.StartTestJetStream(t)
+			store := objectstore.NewMemoryObjectStore()
+			if tt.seed != nil {
+				tt.seed(t, js, store)
+			}
+
+			_, err := Import(js, store, testBucket, tt.archive, ImportOptions{})
+			require.ErrorIs(t, err, ErrRefused)
+			assert.Contains(t, err.Error(), tt.wantErr)
+
+			// Nothing was written
+			_, err = js.KeyValue("spinifex-vpc-vpcs")
+			if tt.seed == nil {
+				assert.ErrorIs(t, err, nats.ErrBucketNotFound)
+			}
+		})
+	}
+}
+
+func TestImport_Replace(t *testing.T) {
+	_, _, js := testutil.StartTestJetStream(t)
+	store := objectstore.NewMemoryObjectStore()
+	kv := testutil.SeedKV(t, js, "spinifex-vpc-vpcs", map[string][]byte{"000000000001.vpc-9": []byte(`{}`)})
+	for _, key := range []string{"tags/000000000001/vol-9.json", "vol-9/config.json", "vol-9/chunks/chunk.00000001.bin"} {
+		_, err := store.PutObject(&s3.PutObjectInput{Bucket: aws.String(testBucket), Key: aws.String(key), Body: strings.NewReader(`{}`)})
+		require.NoError(t, err)
+	}
+
+	a := &Archive{Format: Format, Version: Version,
+		Buckets: []Bucket{{Name: "spinifex-vpc-vpcs", SchemaVersion: 1, History: 1, Entries: []Entry{{Key: "000000000001.vpc-1", Value: []byte(`{}`)}}}},
+		Objects: []Entry{{Key: "tags/000000000001/vol-1.json", Value: []byte(`{"Name":"data"}`)}},
+	}
+	_, err := Import(js, store, testBucket, a, ImportOptions{Replace: true})
+	require.NoError(t, err)
+
+	keys, err := kv.Keys()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"000000000001.vpc-1", utils.VersionKey}, keys)
+
+	_, err = store.GetObject(&s3.GetObjectInput{Bucket: aws.String(testBucket), Key: aws.String("tags/000000000001/vol-9.json")})
+	assert.True(t, objectstore.IsNoSuchKeyError(err))
+	_, err = store.GetObject(&s3.GetObjectInput{Bucket: aws.String(testBucket), Key: aws.String("vol-9/config.json")})
+	assert.True(t, objectstore.IsNoSuchKeyError(err))
+	_, err = store.GetObject(&s3.GetObjectInput{Bucket: aws.String(testBucket), Key: aws.String("vol-9/chunks/chunk.00000001.bin")})
+	assert.NoError(t, err, "block data is left alone")
+	out, err := store.GetObject(&s3.GetObjectInput{Bucket: aws.String(testBucket), Key: aws.String("tags/000000000001/vol-1.json")})
+	require.NoError(t, err)
+	data, _ := io.ReadAll(out.Body)
+	assert.JSONEq(t, `{"Name":"data"}`, string(data))
+}
+
+func TestRead(t *testing.T) {
+	_, err := Read(strings.NewReader(`{"format":"spinifex-state","version":2,"buckets":[]}`))
+	assert.ErrorContains(t, err, "archive version 2 is not supported")
+
+	_, err = Read(strings.NewReader(`not json`))
+	assert.ErrorContains(t, err, "decode archive")
+
+	a, err := Read(strings.NewReader(`{"format":"spinifex-state","version":1,"buckets":[{"name":"spinifex-vpc-vpcs","schema_version":1,"history":1,"entries":[{"key":"k","value":"e30="}]}]}`))
+	require.NoError(t, err)
+	assert.Equal(t, []byte(`{}`), a.Buckets[0].Entries[0].Value)
+}
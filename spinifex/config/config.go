@@ -3,9 +3,12 @@ package config
 import (
 	"fmt"
 	"log/slog"
+	"net"
 	"os"
+	"path/filepath"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -46,6 +49,14 @@ type NetworkConfig struct {
 	ExternalMode  string         `mapstructure:"external_mode"`  // "pool" or "" (disabled)
 	ExternalDHCP  bool           `mapstructure:"external_dhcp"`  // Gateway IP obtained via DHCP (pool/dhcp source)
 	ExternalPools []ExternalPool `mapstructure:"external_pools"` // One or more IP pools
+
+	// MACOUI is the 3-octet prefix (e.g. "0a:5f:00") for ENI MAC addresses.
+	// It must be locally administered and unicast. Empty keeps the default
+	// 02:xx:xx:xx:xx:xx scheme, which has more hash bits and so fewer
+	// collisions; set it when DHCP reservations or licensing need a stable,
+	// recognisable prefix. It is cluster-wide so every node derives the
+	// same MAC for an ENI.
+	MACOUI string `mapstructure:"mac_oui"`
 }
 
 // BootstrapConfig holds the default VPC infrastructure IDs written by admin init.
@@ -73,12 +84,52 @@ type Config struct {
 	DataDir     string   `json:"DataDir" mapstructure:"data_dir"`
 	Services    []string `json:"Services" mapstructure:"services"` // Which services this node runs locally
 
+	// MACOUI is copied from the cluster's network.mac_oui on load so the
+	// services that build ENIs can read it from their node config.
+	MACOUI string `json:"MACOUI" mapstructure:"-"`
+
+	// VolumeBackends maps EBS volume types to the storage backend that holds
+	// them on this node, e.g. {"gp3": "viperblock", "io2": "local"}. Types
+	// not listed are not offered here. Empty offers gp3 on viperblock only.
+	VolumeBackends map[string]string `json:"VolumeBackends" mapstructure:"volume_backends"`
+	LocalVolumes   LocalVolumeConfig `json:"LocalVolumes" mapstructure:"local_volumes"`
+
+	// VolumeTrim sets, per EBS volume type, whether new volumes pass guest
+	// discards (fstrim) through to storage, e.g. {"gp3": true, "io2": false}.
+	// Types not listed have it only for gp3, whose thin-provisioned
+	// viperblock volumes reclaim the space. Volumes can override it with
+	// the vm.TrimTag tag.
+	VolumeTrim map[string]bool `json:"VolumeTrim" mapstructure:"volume_trim"`
+
+	// MaxVolumeSizeGiB caps the size ModifyVolume grows a volume to. Zero
+	// means the EBS limit of 16384 GiB.
+	MaxVolumeSizeGiB uint64 `json:"MaxVolumeSizeGiB" mapstructure:"max_volume_size_gib"`
+
+	// MaxVolumeIOPS caps the IOPS CreateVolume and ModifyVolume provision
+	// for one volume on this node. Zero means the volume type's EBS limit.
+	MaxVolumeIOPS int `json:"MaxVolumeIOPS" mapstructure:"max_volume_iops"`
+
+	// KMSKeyDir is where earlier releases kept each node's KMS keys. The
+	// keys are now cluster-wide in JetStream; any found here are imported
+	// at daemon start. Empty means config/kms under BaseDir.
+	KMSKeyDir string `json:"KMSKeyDir" mapstructure:"kms_key_dir"`
+
+	// ImageImportDir is the only directory ImportVolume and ImportSnapshot
+	// read local image paths from. Empty means imports under BaseDir.
+	ImageImportDir string `json:"ImageImportDir" mapstructure:"image_import_dir"`
+
 	Daemon     DaemonConfig     `json:"Daemon" mapstructure:"daemon"`
 	NATS       NATSConfig       `json:"NATS" mapstructure:"nats"`
 	Predastore PredastoreConfig `json:"Predastore" mapstructure:"predastore"`
-	Viperblock ViperblockConfig `json:"Viperblock" mapstructure:"viperblock"`
-	AWSGW      AWSGWConfig      `json:"AWSGW" mapstructure:"awsgw"`
-	VPCD       VPCDConfig       `json:"VPCD" mapstructure:"vpcd"`
+	// ObjectStore is the object store the daemon keeps volume, snapshot,
+	// image, key pair and tag metadata in, under the Predastore bucket name.
+	// An unset backend means the node's Predastore. Block data is always
+	// on Predastore.
+	ObjectStore ObjectStoreConfig `json:"ObjectStore" mapstructure:"object_store"`
+	Viperblock  ViperblockConfig  `json:"Viperblock" mapstructure:"viperblock"`
+	AWSGW       AWSGWConfig       `json:"AWSGW" mapstructure:"awsgw"`
+	VPCD        VPCDConfig        `json:"VPCD" mapstructure:"vpcd"`
+	Tracing     TracingConfig     `json:"Tracing" mapstructure:"tracing"`
 
 	BaseDir string `json:"BaseDir" mapstructure:"base_dir"`
 	WalDir  string `json:"WalDir" mapstructure:"wal_dir"`
@@ -92,6 +143,37 @@ type AWSGWConfig struct {
 
 	Debug         bool `json:"Debug" mapstructure:"debug"`
 	ExpectedNodes int  `json:"ExpectedNodes" mapstructure:"expected_nodes"` // TODO: Replace with root cluster config
+
+	// Audit log. Mutating API calls are kept in the audit stream for
+	// AuditRetentionDays (0 = 90 days) and, when AuditBucket is set, also
+	// archived to that bucket.
+	AuditRetentionDays int    `json:"AuditRetentionDays" mapstructure:"audit_retention_days"`
+	AuditBucket        string `json:"AuditBucket" mapstructure:"audit_bucket"`
+	// AuditStore is the object store AuditBucket lives in. An unset
+	// backend means the node's Predastore.
+	AuditStore ObjectStoreConfig `json:"AuditStore" mapstructure:"audit_store"`
+}
+
+// ObjectStoreConfig selects an object store backend registered with the
+// objectstore package and its settings. Built in are "s3", for Predastore
+// and other S3-compatible endpoints such as MinIO or Ceph RGW,
+// "filesystem", which keeps each bucket as a directory under Dir, and
+// "memory", which keeps nothing across restarts.
+type ObjectStoreConfig struct {
+	Backend   string `json:"Backend" mapstructure:"backend"`
+	Endpoint  string `json:"Endpoint" mapstructure:"endpoint"` // s3
+	Region    string `json:"Region" mapstructure:"region"`     // s3
+	AccessKey string `json:"AccessKey" mapstructure:"accesskey"`
+	SecretKey string `json:"SecretKey" mapstructure:"secretkey"`
+	Dir       string `json:"Dir" mapstructure:"dir"` // filesystem
+}
+
+// LocalVolumeConfig configures the "local" volume backend, which keeps each
+// volume as a sparse raw file on node-local disk (typically NVMe) and hands
+// it to QEMU directly instead of through viperblock's NBD server.
+type LocalVolumeConfig struct {
+	Dir         string `json:"Dir" mapstructure:"dir"`
+	CapacityGiB uint64 `json:"CapacityGiB" mapstructure:"capacity_gib"` // 0 = limited only by the filesystem
 }
 
 type ViperblockConfig struct {
@@ -113,6 +195,28 @@ type VPCDConfig struct {
 	BridgeMode     string `json:"BridgeMode" mapstructure:"bridge_mode"` // "direct" or "veth" (auto-detected if empty)
 }
 
+// TracingConfig sends OpenTelemetry traces of the node's gateway and daemon
+// to an OTLP/HTTP collector.
+type TracingConfig struct {
+	// Endpoint is the collector's host:port, e.g. "127.0.0.1:4318". Empty
+	// disables tracing.
+	Endpoint string `json:"Endpoint" mapstructure:"endpoint"`
+	// Insecure sends spans over plain HTTP instead of HTTPS.
+	Insecure bool `json:"Insecure" mapstructure:"insecure"`
+	// SampleRatio is the fraction of traces started on this node that are
+	// sampled, from 0 to 1. Zero samples all of them. Traces started
+	// elsewhere follow the caller's decision.
+	SampleRatio float64 `json:"SampleRatio" mapstructure:"sample_ratio"`
+}
+
+// validate rejects a sample ratio outside 0 to 1.
+func (t TracingConfig) validate() error {
+	if t.SampleRatio < 0 || t.SampleRatio > 1 {
+		return fmt.Errorf("tracing.sample_ratio must be between 0 and 1")
+	}
+	return nil
+}
+
 type PredastoreConfig struct {
 	Host      string `json:"Host" mapstructure:"host"`
 	Bucket    string `json:"Bucket" mapstructure:"bucket"`
@@ -123,6 +227,17 @@ type PredastoreConfig struct {
 	NodeID    int    `json:"NodeID" mapstructure:"node_id"`
 }
 
+// ObjectStore returns the settings of an s3 object store on this Predastore.
+func (p PredastoreConfig) ObjectStore() ObjectStoreConfig {
+	return ObjectStoreConfig{
+		Backend:   "s3",
+		Endpoint:  p.Host,
+		Region:    p.Region,
+		AccessKey: p.AccessKey,
+		SecretKey: p.SecretKey,
+	}
+}
+
 // DaemonConfig holds the daemon configuration
 type DaemonConfig struct {
 	Host          string `json:"Host" mapstructure:"host"`
@@ -130,6 +245,453 @@ type DaemonConfig struct {
 	TLSCert       string `json:"TLSCert" mapstructure:"tlscert"`
 	DevNetworking bool   `json:"DevNetworking" mapstructure:"dev_networking"` // VPC instances get both TAP + hostfwd for SSH dev access
 	MgmtBridge    string `json:"MgmtBridge" mapstructure:"mgmt_bridge"`       // Linux bridge for system instance control plane (default "br-mgmt")
+	VirtioRNG     *bool  `json:"VirtioRNG" mapstructure:"virtio_rng"`         // Give guests a virtio-rng device fed from host /dev/urandom (default true when nil)
+	// HostnamePattern sets the guest hostname for instances without a Name
+	// tag. "{ip}" expands to the dashed private IP and "{id}" to the instance
+	// ID suffix, e.g. "ip-{ip}" gives "ip-10-0-0-5". Empty keeps "spinifex-vm-{id}".
+	HostnamePattern string `json:"HostnamePattern" mapstructure:"hostname_pattern"`
+	// AutoEnableIO mirrors the EC2 volume attribute: on a volume I/O error the
+	// guest is resumed so I/O is retried. When false (the default) the guest
+	// is paused until an operator intervenes.
+	AutoEnableIO bool `json:"AutoEnableIO" mapstructure:"auto_enable_io"`
+	// NUMAPinning pins instances with 8 or more vCPUs to one host NUMA node
+	// on multi-node hosts: their memory is bound to the node and each vCPU
+	// gets a dedicated host CPU. Instances that fit no single node, and
+	// smaller ones, run unpinned.
+	NUMAPinning bool `json:"NUMAPinning" mapstructure:"numa_pinning"`
+	// SRIOV gives instances whose type has dedicated network bandwidth an
+	// SR-IOV virtual function of a host NIC instead of a tap on br-int.
+	SRIOV SRIOVConfig `json:"SRIOV" mapstructure:"sriov"`
+	// EBSThroughputFloors override the baseline EBS throughput guaranteed to
+	// EBS-optimized instance types. Types not listed use their EbsInfo baseline.
+	EBSThroughputFloors []EBSThroughputFloor `json:"EBSThroughputFloors" mapstructure:"ebs_throughput_floors"`
+	// DNSZone is the domain instances are named under, e.g.
+	// "compute.internal" gives "ip-10-0-0-5.compute.internal". Guests get the
+	// FQDN as their cloud-init fqdn and it resolves in the instance's VPC
+	// while the instance exists. Empty leaves instances with bare hostnames.
+	DNSZone string `json:"DNSZone" mapstructure:"dns_zone"`
+	// DefaultTags are merged onto every instance, volume and snapshot created
+	// on this node. Tags given at creation win over defaults with the same key.
+	DefaultTags []DefaultTag `json:"DefaultTags" mapstructure:"default_tags"`
+	// Hooks are operator commands run on this host around instance launch
+	// and termination.
+	Hooks LifecycleHooks `json:"Hooks" mapstructure:"hooks"`
+	// BootOversubscription is what the daemon does on startup when the
+	// instances it was running need more capacity than the host now has,
+	// e.g. after a memory downgrade: "stop" (the default) stops the
+	// lowest-priority instances until the rest fit, "refuse" fails startup
+	// with a report of the shortfall.
+	BootOversubscription string `json:"BootOversubscription" mapstructure:"boot_oversubscription"`
+	// LaunchWorkers caps how many RunInstances and start requests this node
+	// processes at once; further requests queue until a worker is free.
+	// Zero uses DefaultLaunchWorkers.
+	LaunchWorkers int `json:"LaunchWorkers" mapstructure:"launch_workers"`
+	// RebootGraceSeconds is how long RebootInstances waits for the guest to
+	// shut down after an ACPI power button press before resetting it.
+	// Zero uses DefaultRebootGrace.
+	RebootGraceSeconds int `json:"RebootGraceSeconds" mapstructure:"reboot_grace_seconds"`
+	// DrainTimeoutSeconds bounds how long draining the node, on SIGTERM or
+	// by spx admin node drain, waits for launches to finish and instances
+	// to stop before the daemon exits. Zero uses DefaultDrainTimeout.
+	DrainTimeoutSeconds int `json:"DrainTimeoutSeconds" mapstructure:"drain_timeout_seconds"`
+	// RescheduleLostInstances has the node registry stop the instances of a
+	// node that misses its heartbeats and start them on the remaining nodes.
+	// Only safe where a silent node is known to be down, not partitioned:
+	// instances still running there would then run twice.
+	RescheduleLostInstances bool `json:"RescheduleLostInstances" mapstructure:"reschedule_lost_instances"`
+	// IMDSListen is the address the instance metadata service listens on,
+	// e.g. "169.254.169.254:80" on the host interface guest traffic to the
+	// metadata address is routed to. Guests are told apart by source
+	// address. Empty disables the service.
+	IMDSListen string `json:"IMDSListen" mapstructure:"imds_listen"`
+	// MetricsListen is the address the daemon serves Prometheus metrics on
+	// at /metrics, e.g. "127.0.0.1:9101". Empty disables the endpoint.
+	MetricsListen string `json:"MetricsListen" mapstructure:"metrics_listen"`
+	// Quotas cap what each account may hold across the cluster. Every node
+	// checks the launches, volumes and addresses it serves, so set the same
+	// quotas on all nodes.
+	Quotas []AccountQuota `json:"Quotas" mapstructure:"quotas"`
+	// LogLevel is the daemon's minimum log level: "debug", "info" (the
+	// default), "warn" or "error".
+	LogLevel string `json:"LogLevel" mapstructure:"log_level"`
+}
+
+// DefaultLaunchWorkers is the launch concurrency of a node that sets no
+// launch_workers.
+const DefaultLaunchWorkers = 4
+
+// LaunchWorkerCount returns how many launches the node processes at once.
+func (d DaemonConfig) LaunchWorkerCount() int {
+	if d.LaunchWorkers > 0 {
+		return d.LaunchWorkers
+	}
+	return DefaultLaunchWorkers
+}
+
+// DefaultRebootGrace is the reboot grace period of a node that sets no
+// reboot_grace_seconds.
+const DefaultRebootGrace = 30 * time.Second
+
+// RebootGrace returns how long a reboot waits for a clean guest shutdown.
+func (d DaemonConfig) RebootGrace() time.Duration {
+	if d.RebootGraceSeconds > 0 {
+		return time.Duration(d.RebootGraceSeconds) * time.Second
+	}
+	return DefaultRebootGrace
+}
+
+// DefaultDrainTimeout is the drain timeout of a node that sets no
+// drain_timeout_seconds.
+const DefaultDrainTimeout = 120 * time.Second
+
+// DrainTimeout returns how long draining the node may take.
+func (d DaemonConfig) DrainTimeout() time.Duration {
+	if d.DrainTimeoutSeconds > 0 {
+		return time.Duration(d.DrainTimeoutSeconds) * time.Second
+	}
+	return DefaultDrainTimeout
+}
+
+// SlogLevel returns the daemon's minimum log level.
+func (d DaemonConfig) SlogLevel() slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(d.LogLevel)); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+// validateLogLevel rejects log levels slog does not know.
+func (d DaemonConfig) validateLogLevel() error {
+	if d.LogLevel == "" {
+		return nil
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(d.LogLevel)); err != nil {
+		return fmt.Errorf("log_level must be %q, %q, %q or %q", "debug", "info", "warn", "error")
+	}
+	return nil
+}
+
+// Boot oversubscription policies.
+const (
+	BootOversubscriptionStop   = "stop"
+	BootOversubscriptionRefuse = "refuse"
+)
+
+// LifecycleHooks are host commands the daemon runs around an instance's
+// lifecycle. Each hook gets the instance's metadata as SPINIFEX_*
+// environment variables and as JSON on stdin.
+type LifecycleHooks struct {
+	// PreLaunch hooks run in order before the instance's QEMU process is
+	// started, on launch and on start after a stop.
+	PreLaunch []LifecycleHook `json:"PreLaunch" mapstructure:"pre_launch"`
+	// PostTerminate hooks run in order once the instance is terminated.
+	// Failures are logged and never hold up teardown.
+	PostTerminate []LifecycleHook `json:"PostTerminate" mapstructure:"post_terminate"`
+}
+
+// Hook failure policies.
+const (
+	HookOnFailureAbort    = "abort"
+	HookOnFailureContinue = "continue"
+)
+
+// DefaultHookTimeout bounds a hook that sets no timeout_seconds.
+const DefaultHookTimeout = 30 * time.Second
+
+// LifecycleHook is one command run at a lifecycle event.
+type LifecycleHook struct {
+	// Command is the program and its arguments, run without a shell.
+	Command        []string `json:"Command" mapstructure:"command"`
+	TimeoutSeconds int      `json:"TimeoutSeconds" mapstructure:"timeout_seconds"`
+	// OnFailure is what a failing or timed-out pre-launch hook does to the
+	// launch: "abort" (the default) fails it, "continue" logs and goes on.
+	OnFailure string `json:"OnFailure" mapstructure:"on_failure"`
+}
+
+// Timeout returns how long the hook may run before it is killed.
+func (h LifecycleHook) Timeout() time.Duration {
+	if h.TimeoutSeconds > 0 {
+		return time.Duration(h.TimeoutSeconds) * time.Second
+	}
+	return DefaultHookTimeout
+}
+
+// validateHooks rejects hooks that could never run as configured.
+func (d DaemonConfig) validateHooks() error {
+	events := []struct {
+		name  string
+		hooks []LifecycleHook
+	}{{"pre_launch", d.Hooks.PreLaunch}, {"post_terminate", d.Hooks.PostTerminate}}
+	for _, event := range events {
+		for i, h := range event.hooks {
+			if len(h.Command) == 0 || h.Command[0] == "" {
+				return fmt.Errorf("hooks.%s[%d]: command is required", event.name, i)
+			}
+			if h.TimeoutSeconds < 0 {
+				return fmt.Errorf("hooks.%s[%d]: timeout_seconds must not be negative", event.name, i)
+			}
+			switch h.OnFailure {
+			case "", HookOnFailureAbort, HookOnFailureContinue:
+			default:
+				return fmt.Errorf("hooks.%s[%d]: on_failure must be %q or %q", event.name, i, HookOnFailureAbort, HookOnFailureContinue)
+			}
+		}
+	}
+	return nil
+}
+
+// DefaultTag is a tag applied to new resources, either cluster-wide or, when
+// AccountID is set, only to that account's resources. Account tags win over
+// cluster-wide tags with the same key.
+type DefaultTag struct {
+	AccountID string `json:"AccountID" mapstructure:"account_id"`
+	Key       string `json:"Key" mapstructure:"key"`
+	Value     string `json:"Value" mapstructure:"value"`
+}
+
+// AccountQuota limits the resources an account may hold, either every
+// account or, when AccountID is set, only that account. An account's quota
+// overrides the cluster-wide quota for each limit it sets. Zero is no limit.
+type AccountQuota struct {
+	AccountID string `json:"AccountID" mapstructure:"account_id"`
+	// MaxVCPUs and MaxInstances count instances that are not stopped or
+	// terminated.
+	MaxVCPUs     int `json:"MaxVCPUs" mapstructure:"max_vcpus"`
+	MaxInstances int `json:"MaxInstances" mapstructure:"max_instances"`
+	// MaxVolumes and MaxVolumeGiB count every volume, root volumes included.
+	MaxVolumes   int `json:"MaxVolumes" mapstructure:"max_volumes"`
+	MaxVolumeGiB int `json:"MaxVolumeGiB" mapstructure:"max_volume_gib"`
+	MaxAddresses int `json:"MaxAddresses" mapstructure:"max_addresses"`
+	// MaxProvisionedIOPS counts the IOPS provisioned on io1 and io2
+	// volumes; gp3's included 3000 IOPS don't count.
+	MaxProvisionedIOPS int `json:"MaxProvisionedIOPS" mapstructure:"max_provisioned_iops"`
+}
+
+// EBSThroughputFloor is the combined volume throughput, in MB/s, an instance
+// type is never throttled below.
+type EBSThroughputFloor struct {
+	InstanceType string  `json:"InstanceType" mapstructure:"instance_type"`
+	MBps         float64 `json:"MBps" mapstructure:"mbps"`
+}
+
+// SRIOVConfig selects the host NICs whose virtual functions are handed to
+// instances. A VF sits on the physical network rather than the OVN overlay,
+// so only ENIs in subnets mapped to a VLAN get one: the subnet's router and
+// DHCP must be served on that VLAN outside OVN, and security groups are not
+// enforced on the VF.
+type SRIOVConfig struct {
+	// Interfaces are the physical functions, e.g. ["enp59s0f0"], whose VFs
+	// have been created (sriov_numvfs) before the daemon starts.
+	Interfaces []string `json:"Interfaces" mapstructure:"interfaces"`
+	// SubnetVLANs maps subnet IDs to the VLAN their VFs are tagged with;
+	// 0 leaves the VF untagged.
+	SubnetVLANs map[string]int `json:"SubnetVLANs" mapstructure:"subnet_vlans"`
+}
+
+// validateSRIOV rejects VLAN IDs outside 0-4094.
+func (d DaemonConfig) validateSRIOV() error {
+	for subnet, vlan := range d.SRIOV.SubnetVLANs {
+		if vlan < 0 || vlan > 4094 {
+			return fmt.Errorf("sriov.subnet_vlans: %s: vlan %d must be between 0 and 4094", subnet, vlan)
+		}
+	}
+	return nil
+}
+
+// VirtioRNGEnabled reports whether new instances get a virtio-rng device.
+func (d DaemonConfig) VirtioRNGEnabled() bool {
+	return d.VirtioRNG == nil || *d.VirtioRNG
+}
+
+// validateBootOversubscription rejects unknown boot oversubscription policies.
+func (d DaemonConfig) validateBootOversubscription() error {
+	switch d.BootOversubscription {
+	case "", BootOversubscriptionStop, BootOversubscriptionRefuse:
+		return nil
+	}
+	return fmt.Errorf("boot_oversubscription must be %q or %q", BootOversubscriptionStop, BootOversubscriptionRefuse)
+}
+
+// validateLaunchWorkers rejects a negative worker count.
+func (d DaemonConfig) validateLaunchWorkers() error {
+	if d.LaunchWorkers < 0 {
+		return fmt.Errorf("launch_workers must not be negative")
+	}
+	return nil
+}
+
+// validateDrainTimeout rejects a negative drain timeout.
+func (d DaemonConfig) validateDrainTimeout() error {
+	if d.DrainTimeoutSeconds < 0 {
+		return fmt.Errorf("drain_timeout_seconds must not be negative")
+	}
+	return nil
+}
+
+// validateRebootGrace rejects a negative reboot grace period.
+func (d DaemonConfig) validateRebootGrace() error {
+	if d.RebootGraceSeconds < 0 {
+		return fmt.Errorf("reboot_grace_seconds must not be negative")
+	}
+	return nil
+}
+
+// validateEBSThroughputFloors rejects floors without a type or a positive rate.
+func (d DaemonConfig) validateEBSThroughputFloors() error {
+	for _, f := range d.EBSThroughputFloors {
+		if f.InstanceType == "" {
+			return fmt.Errorf("ebs_throughput_floors: instance_type is required")
+		}
+		if f.MBps <= 0 {
+			return fmt.Errorf("ebs_throughput_floors: %s: mbps must be positive", f.InstanceType)
+		}
+	}
+	return nil
+}
+
+// EBSThroughputFloor returns the configured throughput floor for
+// instanceType in MB/s, or 0 when the EbsInfo baseline applies.
+func (d DaemonConfig) EBSThroughputFloor(instanceType string) float64 {
+	for _, f := range d.EBSThroughputFloors {
+		if f.InstanceType == instanceType {
+			return f.MBps
+		}
+	}
+	return 0
+}
+
+// validateDNSZone rejects zones that aren't valid DNS names. A trailing dot
+// is allowed since zones are often written fully qualified.
+func (d DaemonConfig) validateDNSZone() error {
+	if d.DNSZone == "" {
+		return nil
+	}
+	zone := strings.TrimSuffix(d.DNSZone, ".")
+	// Leave room for a hostname label in front of the zone.
+	if len(zone) > 253-64 {
+		return fmt.Errorf("dns_zone %q: too long", d.DNSZone)
+	}
+	for label := range strings.SplitSeq(zone, ".") {
+		if !validDNSLabel(label) {
+			return fmt.Errorf("dns_zone %q: invalid label %q", d.DNSZone, label)
+		}
+	}
+	return nil
+}
+
+// ValidDomainName reports whether name is a valid DNS domain name made of
+// LDH labels, such as a DHCP options set's domain-name.
+func ValidDomainName(name string) bool {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" || len(name) > 253 {
+		return false
+	}
+	for label := range strings.SplitSeq(name, ".") {
+		if !validDNSLabel(label) {
+			return false
+		}
+	}
+	return true
+}
+
+// validDNSLabel reports whether label is a valid LDH hostname label.
+func validDNSLabel(label string) bool {
+	if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+		return false
+	}
+	for _, c := range strings.ToLower(label) {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// validateDefaultTags rejects default tags EC2 wouldn't accept.
+func (d DaemonConfig) validateDefaultTags() error {
+	for _, t := range d.DefaultTags {
+		if t.Key == "" || len(t.Key) > 128 || strings.HasPrefix(strings.ToLower(t.Key), "aws:") {
+			return fmt.Errorf("default_tags: invalid key %q", t.Key)
+		}
+		if len(t.Value) > 256 {
+			return fmt.Errorf("default_tags: %s: value longer than 256 characters", t.Key)
+		}
+	}
+	return nil
+}
+
+// DefaultTagsFor returns the default tags for resources created by
+// accountID, or nil when there are none.
+func (d DaemonConfig) DefaultTagsFor(accountID string) map[string]string {
+	var tags map[string]string
+	for _, scoped := range []bool{false, true} {
+		for _, t := range d.DefaultTags {
+			if (t.AccountID != "") != scoped || (scoped && t.AccountID != accountID) {
+				continue
+			}
+			if tags == nil {
+				tags = make(map[string]string)
+			}
+			tags[t.Key] = t.Value
+		}
+	}
+	return tags
+}
+
+// validateQuotas rejects negative limits and repeated quotas.
+func (d DaemonConfig) validateQuotas() error {
+	seen := make(map[string]bool, len(d.Quotas))
+	for _, q := range d.Quotas {
+		name := q.AccountID
+		if name == "" {
+			name = "cluster-wide quota"
+		}
+		if seen[q.AccountID] {
+			return fmt.Errorf("quotas: %s given more than once", name)
+		}
+		seen[q.AccountID] = true
+		if q.MaxVCPUs < 0 || q.MaxInstances < 0 || q.MaxVolumes < 0 || q.MaxVolumeGiB < 0 || q.MaxAddresses < 0 ||
+			q.MaxProvisionedIOPS < 0 {
+			return fmt.Errorf("quotas: %s: limits must not be negative", name)
+		}
+	}
+	return nil
+}
+
+// QuotaFor returns the limits that apply to accountID.
+func (d DaemonConfig) QuotaFor(accountID string) AccountQuota {
+	quota := AccountQuota{AccountID: accountID}
+	for _, scoped := range []bool{false, true} {
+		for _, q := range d.Quotas {
+			if (q.AccountID != "") != scoped || (scoped && q.AccountID != accountID) {
+				continue
+			}
+			for dst, v := range map[*int]int{
+				&quota.MaxVCPUs:           q.MaxVCPUs,
+				&quota.MaxInstances:       q.MaxInstances,
+				&quota.MaxVolumes:         q.MaxVolumes,
+				&quota.MaxVolumeGiB:       q.MaxVolumeGiB,
+				&quota.MaxAddresses:       q.MaxAddresses,
+				&quota.MaxProvisionedIOPS: q.MaxProvisionedIOPS,
+			} {
+				if v > 0 {
+					*dst = v
+				}
+			}
+		}
+	}
+	return quota
+}
+
+// FQDN qualifies hostname with the configured DNS zone, or returns "" when
+// no zone is set.
+func (d DaemonConfig) FQDN(hostname string) string {
+	if d.DNSZone == "" || hostname == "" {
+		return ""
+	}
+	return hostname + "." + strings.ToLower(strings.TrimSuffix(d.DNSZone, "."))
 }
 
 // NATSConfig holds the NATS configuration
@@ -138,6 +700,30 @@ type NATSConfig struct {
 	CACert string  `json:"CACert" mapstructure:"cacert"`
 	ACL    NATSACL `json:"ACL" mapstructure:"acl"`
 	Sub    NATSSub `json:"Sub" mapstructure:"sub"`
+	// SubjectPrefix is prepended to every NATS subject the cluster uses
+	// (e.g. "acme" gives acme.ec2.RunInstances), so several clusters can
+	// share one NATS system. Every node of a cluster must use the same
+	// prefix. Empty for none.
+	SubjectPrefix string `json:"SubjectPrefix" mapstructure:"subject_prefix"`
+}
+
+// validateSubjectPrefix rejects prefixes that aren't plain NATS subject
+// tokens: wildcards, whitespace and empty tokens.
+func (n NATSConfig) validateSubjectPrefix() error {
+	if n.SubjectPrefix == "" {
+		return nil
+	}
+	for token := range strings.SplitSeq(n.SubjectPrefix, ".") {
+		if token == "" {
+			return fmt.Errorf("nats subject_prefix %q: empty token", n.SubjectPrefix)
+		}
+		for _, c := range token {
+			if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '-' && c != '_' {
+				return fmt.Errorf("nats subject_prefix %q: invalid character %q", n.SubjectPrefix, c)
+			}
+		}
+	}
+	return nil
 }
 
 // NATSACL holds the NATS ACL configuration
@@ -168,6 +754,21 @@ func (cc *ClusterConfig) NodeBaseDir() string {
 	return node.BaseDir
 }
 
+// GuestDNSServers returns the cluster's guest resolvers, which VPCs using
+// AmazonProvidedDNS hand out: the unscoped external pool's dns_servers, or
+// nil when none is set and guests keep whatever their DHCP lease gives them.
+func (cc *ClusterConfig) GuestDNSServers() []string {
+	if cc == nil {
+		return nil
+	}
+	for _, p := range cc.Network.ExternalPools {
+		if p.Region == "" && p.AZ == "" && len(p.DNSServers) > 0 {
+			return p.DNSServers
+		}
+	}
+	return nil
+}
+
 // AllServices is the default service list when Services is empty (backward compat).
 var AllServices = []string{"nats", "predastore", "viperblock", "daemon", "awsgw", "vpcd", "ui"}
 
@@ -189,6 +790,125 @@ func (c Config) GetServices() []string {
 	return c.Services
 }
 
+// ParseMACOUI parses a 3-octet OUI such as "0a:5f:00". The OUI must have the
+// locally-administered bit set and the multicast bit clear so derived MACs
+// cannot clash with vendor-assigned addresses.
+func ParseMACOUI(s string) (net.HardwareAddr, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid MAC OUI %q: expected 3 colon-separated octets", s)
+	}
+	oui, err := net.ParseMAC(s + ":00:00:00")
+	if err != nil {
+		return nil, fmt.Errorf("invalid MAC OUI %q: %w", s, err)
+	}
+	oui = oui[:3]
+	if oui[0]&0x01 != 0 {
+		return nil, fmt.Errorf("invalid MAC OUI %q: multicast bit is set", s)
+	}
+	if oui[0]&0x02 == 0 {
+		return nil, fmt.Errorf("invalid MAC OUI %q: locally-administered bit is not set", s)
+	}
+	return oui, nil
+}
+
+// MACPrefix returns the parsed MACOUI, or nil if unset or invalid.
+// LoadConfig rejects invalid values, so nil here means "use the default".
+func (c *Config) MACPrefix() net.HardwareAddr {
+	if c == nil || c.MACOUI == "" {
+		return nil
+	}
+	oui, err := ParseMACOUI(c.MACOUI)
+	if err != nil {
+		return nil
+	}
+	return oui
+}
+
+// Volume storage backends selectable through Config.VolumeBackends.
+const (
+	VolumeBackendViperblock = "viperblock"
+	VolumeBackendLocal      = "local"
+)
+
+// DefaultVolumeType is the EBS volume type used when a request names none.
+const DefaultVolumeType = "gp3"
+
+// VolumeBackend returns the backend that stores volumeType on this node, or
+// "" if the node does not offer that type. An empty volumeType means gp3.
+func (c *Config) VolumeBackend(volumeType string) string {
+	if volumeType == "" {
+		volumeType = DefaultVolumeType
+	}
+	if len(c.VolumeBackends) == 0 {
+		if volumeType == DefaultVolumeType {
+			return VolumeBackendViperblock
+		}
+		return ""
+	}
+	backend := c.VolumeBackends[volumeType]
+	if backend == VolumeBackendLocal && c.LocalVolumes.Dir == "" {
+		return ""
+	}
+	return backend
+}
+
+// VolumeTrimEnabled reports whether volumes of volumeType pass guest discards
+// through unless tagged otherwise. An empty volumeType means gp3.
+func (c *Config) VolumeTrimEnabled(volumeType string) bool {
+	if volumeType == "" {
+		volumeType = DefaultVolumeType
+	}
+	if enabled, ok := c.VolumeTrim[volumeType]; ok {
+		return enabled
+	}
+	return volumeType == DefaultVolumeType
+}
+
+// LocalVolumePath returns the raw file backing volumeID on the local backend.
+func (c *Config) LocalVolumePath(volumeID string) string {
+	return filepath.Join(c.LocalVolumes.Dir, volumeID+".raw")
+}
+
+// KMSDir returns the directory earlier releases kept the node's KMS keys in.
+func (c *Config) KMSDir() string {
+	if c.KMSKeyDir != "" {
+		return c.KMSKeyDir
+	}
+	return filepath.Join(c.BaseDir, "config", "kms")
+}
+
+// MasterKeyPath returns the cluster's master key, which seals the secrets
+// kept in JetStream.
+func (c *Config) MasterKeyPath() string {
+	return filepath.Join(c.BaseDir, "config", "master.key")
+}
+
+// ImportDir returns the directory local images are imported from.
+func (c *Config) ImportDir() string {
+	if c.ImageImportDir != "" {
+		return c.ImageImportDir
+	}
+	return filepath.Join(c.BaseDir, "imports")
+}
+
+// validateVolumeBackends rejects unknown backend names and a local backend
+// with nowhere to put its files.
+func (c *Config) validateVolumeBackends() error {
+	for volType, backend := range c.VolumeBackends {
+		switch backend {
+		case VolumeBackendViperblock:
+		case VolumeBackendLocal:
+			if c.LocalVolumes.Dir == "" {
+				return fmt.Errorf("volume type %s uses the local backend but local_volumes.dir is not set", volType)
+			}
+		default:
+			return fmt.Errorf("volume type %s: unknown storage backend %q", volType, backend)
+		}
+	}
+	return nil
+}
+
 // LoadConfig loads the configuration from file and environment variables
 func LoadConfig(configPath string) (*ClusterConfig, error) {
 	// Set environment variable prefix
@@ -217,6 +937,61 @@ func LoadConfig(configPath string) (*ClusterConfig, error) {
 		return nil, fmt.Errorf("error unmarshaling config: %w", err)
 	}
 
+	for name, node := range config.Nodes {
+		if err := node.validateVolumeBackends(); err != nil {
+			return nil, fmt.Errorf("node %s: %w", name, err)
+		}
+		if err := node.Daemon.validateEBSThroughputFloors(); err != nil {
+			return nil, fmt.Errorf("node %s: %w", name, err)
+		}
+		if err := node.Daemon.validateSRIOV(); err != nil {
+			return nil, fmt.Errorf("node %s: %w", name, err)
+		}
+		if err := node.Daemon.validateDNSZone(); err != nil {
+			return nil, fmt.Errorf("node %s: %w", name, err)
+		}
+		if err := node.Daemon.validateDefaultTags(); err != nil {
+			return nil, fmt.Errorf("node %s: %w", name, err)
+		}
+		if err := node.Daemon.validateBootOversubscription(); err != nil {
+			return nil, fmt.Errorf("node %s: %w", name, err)
+		}
+		if err := node.Daemon.validateLaunchWorkers(); err != nil {
+			return nil, fmt.Errorf("node %s: %w", name, err)
+		}
+		if err := node.Daemon.validateRebootGrace(); err != nil {
+			return nil, fmt.Errorf("node %s: %w", name, err)
+		}
+		if err := node.Daemon.validateDrainTimeout(); err != nil {
+			return nil, fmt.Errorf("node %s: %w", name, err)
+		}
+		if err := node.Daemon.validateHooks(); err != nil {
+			return nil, fmt.Errorf("node %s: %w", name, err)
+		}
+		if err := node.Daemon.validateQuotas(); err != nil {
+			return nil, fmt.Errorf("node %s: %w", name, err)
+		}
+		if err := node.Daemon.validateLogLevel(); err != nil {
+			return nil, fmt.Errorf("node %s: %w", name, err)
+		}
+		if err := node.Tracing.validate(); err != nil {
+			return nil, fmt.Errorf("node %s: %w", name, err)
+		}
+		if err := node.NATS.validateSubjectPrefix(); err != nil {
+			return nil, fmt.Errorf("node %s: %w", name, err)
+		}
+	}
+
+	if config.Network.MACOUI != "" {
+		if _, err := ParseMACOUI(config.Network.MACOUI); err != nil {
+			return nil, fmt.Errorf("network: %w", err)
+		}
+	}
+	for name, node := range config.Nodes {
+		node.MACOUI = config.Network.MACOUI
+		config.Nodes[name] = node
+	}
+
 	// Normalize the local node's bind address: 0.0.0.0 means "listen on all
 	// interfaces" but is not a valid connect address. Only rewrite for the
 	// local node — remote nodes use real IPs that must not be changed.
@@ -1,9 +1,12 @@
 package config
 
 import (
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
@@ -517,3 +520,387 @@ shardwal = true
 	require.NotNil(t, n.Viperblock.ShardWAL)
 	assert.True(t, *n.Viperblock.ShardWAL)
 }
+
+func TestParseMACOUI(t *testing.T) {
+	oui, err := ParseMACOUI("0a:5f:00")
+	require.NoError(t, err)
+	assert.Equal(t, "0a:5f:00", oui.String())
+
+	for _, bad := range []string{"", "0a:5f", "0a:5f:00:01", "zz:00:00", "00:50:56", "03:00:00"} {
+		_, err := ParseMACOUI(bad)
+		assert.Error(t, err, "OUI %q should be rejected", bad)
+	}
+}
+
+func TestLoadConfig_MACOUI(t *testing.T) {
+	resetViper(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "spinifex.toml")
+
+	toml := `
+node = "n1"
+
+[network]
+mac_oui = "0a:5f:00"
+
+[nodes.n1]
+region = "us-east-1"
+
+[nodes.n2]
+region = "us-east-1"
+`
+	require.NoError(t, os.WriteFile(path, []byte(toml), 0600))
+
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+
+	// Every node derives ENI MACs under the cluster's OUI
+	for _, name := range []string{"n1", "n2"} {
+		n := cfg.Nodes[name]
+		assert.Equal(t, "0a:5f:00", n.MACOUI)
+		assert.Equal(t, "0a:5f:00", n.MACPrefix().String())
+	}
+}
+
+func TestLoadConfig_MACOUI_Invalid(t *testing.T) {
+	resetViper(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "spinifex.toml")
+
+	// 00:50:56 is a vendor (universally administered) OUI
+	toml := `
+node = "n1"
+
+[network]
+mac_oui = "00:50:56"
+
+[nodes.n1]
+region = "us-east-1"
+`
+	require.NoError(t, os.WriteFile(path, []byte(toml), 0600))
+
+	_, err := LoadConfig(path)
+	assert.ErrorContains(t, err, "locally-administered")
+}
+
+func TestLoadConfig_ObjectStore(t *testing.T) {
+	resetViper(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "spinifex.toml")
+
+	toml := `
+node = "n1"
+
+[nodes.n1]
+region = "us-east-1"
+
+[nodes.n1.object_store]
+backend = "filesystem"
+dir = "/var/lib/spinifex/objects"
+
+[nodes.n2]
+region = "us-east-1"
+`
+	require.NoError(t, os.WriteFile(path, []byte(toml), 0600))
+
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, ObjectStoreConfig{Backend: "filesystem", Dir: "/var/lib/spinifex/objects"}, cfg.Nodes["n1"].ObjectStore)
+	// Unset: the daemon uses the node's Predastore
+	assert.Empty(t, cfg.Nodes["n2"].ObjectStore.Backend)
+}
+
+func TestLoadConfig_DaemonVirtioRNG(t *testing.T) {
+	resetViper(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "spinifex.toml")
+
+	toml := `
+node = "n1"
+
+[nodes.n1]
+region = "us-east-1"
+
+[nodes.n2]
+region = "us-east-1"
+
+[nodes.n2.daemon]
+virtio_rng = false
+`
+	require.NoError(t, os.WriteFile(path, []byte(toml), 0600))
+
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+
+	n1 := cfg.Nodes["n1"]
+	assert.Nil(t, n1.Daemon.VirtioRNG)
+	assert.True(t, n1.Daemon.VirtioRNGEnabled(), "virtio-rng should default to enabled")
+
+	n2 := cfg.Nodes["n2"]
+	require.NotNil(t, n2.Daemon.VirtioRNG)
+	assert.False(t, n2.Daemon.VirtioRNGEnabled())
+}
+
+func TestLoadConfig_EBSThroughputFloors(t *testing.T) {
+	resetViper(t)
+	path := filepath.Join(t.TempDir(), "spinifex.toml")
+
+	toml := `
+node = "n1"
+
+[nodes.n1.daemon]
+ebs_throughput_floors = [
+  { instance_type = "m5.large", mbps = 200 },
+]
+`
+	require.NoError(t, os.WriteFile(path, []byte(toml), 0600))
+
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+	d := cfg.Nodes["n1"].Daemon
+	assert.Equal(t, 200.0, d.EBSThroughputFloor("m5.large"))
+	assert.Zero(t, d.EBSThroughputFloor("m5.xlarge"))
+
+	resetViper(t)
+	require.NoError(t, os.WriteFile(path, []byte("node = \"n1\"\n\n[nodes.n1.daemon]\nebs_throughput_floors = [{ instance_type = \"m5.large\", mbps = 0 }]\n"), 0600))
+	_, err = LoadConfig(path)
+	assert.ErrorContains(t, err, "mbps must be positive")
+}
+
+func TestDaemonConfig_DNSZone(t *testing.T) {
+	for _, zone := range []string{"", "compute.internal", "Example.COM.", "a-b.c1"} {
+		assert.NoError(t, DaemonConfig{DNSZone: zone}.validateDNSZone(), zone)
+	}
+	for _, zone := range []string{".", "bad..zone", "-lead.example", "trail-.example", "under_score.example", "sp ace", strings.Repeat("a", 64) + ".example"} {
+		assert.Error(t, DaemonConfig{DNSZone: zone}.validateDNSZone(), zone)
+	}
+
+	assert.Equal(t, "web-1.example.com", DaemonConfig{DNSZone: "Example.COM."}.FQDN("web-1"))
+	assert.Empty(t, DaemonConfig{}.FQDN("web-1"))
+	assert.Empty(t, DaemonConfig{DNSZone: "example.com"}.FQDN(""))
+}
+
+func TestLoadConfig_DefaultTags(t *testing.T) {
+	resetViper(t)
+	path := filepath.Join(t.TempDir(), "spinifex.toml")
+	toml := `
+node = "n1"
+
+[nodes.n1.daemon]
+default_tags = [
+  { key = "owner", value = "platform" },
+  { key = "cost-centre", value = "1000" },
+  { account_id = "000000000002", key = "owner", value = "data" },
+]
+`
+	require.NoError(t, os.WriteFile(path, []byte(toml), 0600))
+
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+
+	d := cfg.Nodes["n1"].Daemon
+	assert.Equal(t, map[string]string{"owner": "platform", "cost-centre": "1000"}, d.DefaultTagsFor("000000000001"))
+	assert.Equal(t, map[string]string{"owner": "data", "cost-centre": "1000"}, d.DefaultTagsFor("000000000002"))
+	assert.Nil(t, DaemonConfig{}.DefaultTagsFor("000000000001"))
+
+	for _, tag := range []DefaultTag{{Key: ""}, {Key: "aws:cloudformation"}, {Key: strings.Repeat("k", 129)}, {Key: "k", Value: strings.Repeat("v", 257)}} {
+		assert.Error(t, DaemonConfig{DefaultTags: []DefaultTag{tag}}.validateDefaultTags(), tag.Key)
+	}
+}
+
+func TestLoadConfig_Quotas(t *testing.T) {
+	resetViper(t)
+	path := filepath.Join(t.TempDir(), "spinifex.toml")
+	toml := `
+node = "n1"
+
+[nodes.n1.daemon]
+quotas = [
+  { max_vcpus = 32, max_instances = 20, max_volumes = 50 },
+  { account_id = "000000000002", max_vcpus = 128, max_addresses = 2, max_provisioned_iops = 64000 },
+]
+`
+	require.NoError(t, os.WriteFile(path, []byte(toml), 0600))
+
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+
+	d := cfg.Nodes["n1"].Daemon
+	assert.Equal(t, AccountQuota{AccountID: "000000000001", MaxVCPUs: 32, MaxInstances: 20, MaxVolumes: 50}, d.QuotaFor("000000000001"))
+	assert.Equal(t, AccountQuota{AccountID: "000000000002", MaxVCPUs: 128, MaxInstances: 20, MaxVolumes: 50, MaxAddresses: 2, MaxProvisionedIOPS: 64000}, d.QuotaFor("000000000002"))
+	assert.Equal(t, AccountQuota{AccountID: "000000000001"}, DaemonConfig{}.QuotaFor("000000000001"))
+
+	assert.ErrorContains(t, DaemonConfig{Quotas: []AccountQuota{{MaxVCPUs: -1}}}.validateQuotas(), "must not be negative")
+	assert.ErrorContains(t, DaemonConfig{Quotas: []AccountQuota{{AccountID: "000000000002"}, {AccountID: "000000000002"}}}.validateQuotas(), "more than once")
+}
+
+func TestDaemonConfig_Hooks(t *testing.T) {
+	hooks := func(h LifecycleHook) DaemonConfig {
+		return DaemonConfig{Hooks: LifecycleHooks{PreLaunch: []LifecycleHook{h}}}
+	}
+	assert.NoError(t, hooks(LifecycleHook{Command: []string{"/usr/local/bin/net-alloc", "--vlan"}}).validateHooks())
+	assert.NoError(t, hooks(LifecycleHook{Command: []string{"/bin/true"}, OnFailure: HookOnFailureContinue}).validateHooks())
+	assert.ErrorContains(t, hooks(LifecycleHook{}).validateHooks(), "hooks.pre_launch[0]: command is required")
+	assert.Error(t, hooks(LifecycleHook{Command: []string{"/bin/true"}, TimeoutSeconds: -1}).validateHooks())
+	assert.Error(t, hooks(LifecycleHook{Command: []string{"/bin/true"}, OnFailure: "retry"}).validateHooks())
+	assert.ErrorContains(t, DaemonConfig{Hooks: LifecycleHooks{PostTerminate: []LifecycleHook{{Command: []string{""}}}}}.validateHooks(), "hooks.post_terminate[0]")
+
+	assert.Equal(t, DefaultHookTimeout, LifecycleHook{}.Timeout())
+	assert.Equal(t, 5*time.Second, LifecycleHook{TimeoutSeconds: 5}.Timeout())
+}
+
+func TestNATSConfig_SubjectPrefix(t *testing.T) {
+	for _, prefix := range []string{"", "acme", "acme.prod", "tenant_01-eu"} {
+		assert.NoError(t, NATSConfig{SubjectPrefix: prefix}.validateSubjectPrefix(), prefix)
+	}
+	for _, prefix := range []string{".", "acme.", ".acme", "acme..prod", "acme.*", "acme.>", "acme prod"} {
+		assert.Error(t, NATSConfig{SubjectPrefix: prefix}.validateSubjectPrefix(), prefix)
+	}
+}
+
+func TestDaemonConfig_BootOversubscription(t *testing.T) {
+	for _, policy := range []string{"", BootOversubscriptionStop, BootOversubscriptionRefuse} {
+		assert.NoError(t, DaemonConfig{BootOversubscription: policy}.validateBootOversubscription(), policy)
+	}
+	assert.ErrorContains(t, DaemonConfig{BootOversubscription: "overcommit"}.validateBootOversubscription(), "boot_oversubscription")
+}
+
+func TestDaemonConfig_LaunchWorkers(t *testing.T) {
+	assert.Equal(t, DefaultLaunchWorkers, DaemonConfig{}.LaunchWorkerCount())
+	assert.Equal(t, 2, DaemonConfig{LaunchWorkers: 2}.LaunchWorkerCount())
+	assert.NoError(t, DaemonConfig{}.validateLaunchWorkers())
+	assert.ErrorContains(t, DaemonConfig{LaunchWorkers: -1}.validateLaunchWorkers(), "launch_workers")
+}
+
+func TestDaemonConfig_SRIOV(t *testing.T) {
+	assert.NoError(t, DaemonConfig{}.validateSRIOV())
+	assert.NoError(t, DaemonConfig{SRIOV: SRIOVConfig{SubnetVLANs: map[string]int{"subnet-a": 0, "subnet-b": 4094}}}.validateSRIOV())
+	assert.ErrorContains(t, DaemonConfig{SRIOV: SRIOVConfig{SubnetVLANs: map[string]int{"subnet-a": 4095}}}.validateSRIOV(), "sriov.subnet_vlans")
+}
+
+func TestDaemonConfig_RebootGrace(t *testing.T) {
+	assert.Equal(t, DefaultRebootGrace, DaemonConfig{}.RebootGrace())
+	assert.Equal(t, 5*time.Second, DaemonConfig{RebootGraceSeconds: 5}.RebootGrace())
+	assert.NoError(t, DaemonConfig{}.validateRebootGrace())
+	assert.ErrorContains(t, DaemonConfig{RebootGraceSeconds: -1}.validateRebootGrace(), "reboot_grace_seconds")
+}
+
+func TestDaemonConfig_DrainTimeout(t *testing.T) {
+	assert.Equal(t, DefaultDrainTimeout, DaemonConfig{}.DrainTimeout())
+	assert.Equal(t, 30*time.Second, DaemonConfig{DrainTimeoutSeconds: 30}.DrainTimeout())
+	assert.NoError(t, DaemonConfig{}.validateDrainTimeout())
+	assert.ErrorContains(t, DaemonConfig{DrainTimeoutSeconds: -1}.validateDrainTimeout(), "drain_timeout_seconds")
+}
+
+func TestDaemonConfig_LogLevel(t *testing.T) {
+	assert.Equal(t, slog.LevelInfo, DaemonConfig{}.SlogLevel())
+	assert.Equal(t, slog.LevelDebug, DaemonConfig{LogLevel: "debug"}.SlogLevel())
+	assert.Equal(t, slog.LevelWarn, DaemonConfig{LogLevel: "WARN"}.SlogLevel())
+	for _, level := range []string{"", "debug", "info", "warn", "error"} {
+		assert.NoError(t, DaemonConfig{LogLevel: level}.validateLogLevel(), level)
+	}
+	assert.ErrorContains(t, DaemonConfig{LogLevel: "verbose"}.validateLogLevel(), "log_level")
+}
+
+func TestTracingConfig_Validate(t *testing.T) {
+	for _, ratio := range []float64{0, 0.25, 1} {
+		assert.NoError(t, TracingConfig{SampleRatio: ratio}.validate(), ratio)
+	}
+	assert.ErrorContains(t, TracingConfig{SampleRatio: 1.5}.validate(), "sample_ratio")
+	assert.ErrorContains(t, TracingConfig{SampleRatio: -0.1}.validate(), "sample_ratio")
+}
+
+func TestGuestDNSServers(t *testing.T) {
+	var nilCfg *ClusterConfig
+	assert.Nil(t, nilCfg.GuestDNSServers())
+
+	cfg := &ClusterConfig{Network: NetworkConfig{ExternalPools: []ExternalPool{
+		{Name: "az", AZ: "us-east-1a", DNSServers: []string{"10.9.9.9"}},
+		{Name: "wan"},
+	}}}
+	assert.Nil(t, cfg.GuestDNSServers(), "scoped pools and pools without dns_servers are ignored")
+
+	cfg.Network.ExternalPools[1].DNSServers = []string{"192.168.1.1"}
+	assert.Equal(t, []string{"192.168.1.1"}, cfg.GuestDNSServers())
+}
+
+func TestLoadConfig_VolumeBackends(t *testing.T) {
+	resetViper(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "spinifex.toml")
+
+	toml := `
+node = "n1"
+
+[nodes.n1]
+region = "us-east-1"
+
+[nodes.n1.volume_backends]
+gp3 = "viperblock"
+io2 = "local"
+
+[nodes.n1.local_volumes]
+dir = "/mnt/nvme/volumes"
+capacity_gib = 500
+`
+	require.NoError(t, os.WriteFile(path, []byte(toml), 0600))
+
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+
+	n := cfg.Nodes["n1"]
+	assert.Equal(t, VolumeBackendViperblock, n.VolumeBackend("gp3"))
+	assert.Equal(t, VolumeBackendViperblock, n.VolumeBackend(""))
+	assert.Equal(t, VolumeBackendLocal, n.VolumeBackend("io2"))
+	assert.Empty(t, n.VolumeBackend("st1"))
+	assert.Equal(t, uint64(500), n.LocalVolumes.CapacityGiB)
+	assert.Equal(t, "/mnt/nvme/volumes/vol-1.raw", n.LocalVolumePath("vol-1"))
+}
+
+func TestVolumeTrimEnabled(t *testing.T) {
+	var c Config
+	assert.True(t, c.VolumeTrimEnabled("gp3"))
+	assert.True(t, c.VolumeTrimEnabled(""))
+	assert.False(t, c.VolumeTrimEnabled("io2"))
+
+	c.VolumeTrim = map[string]bool{"gp3": false, "io2": true}
+	assert.False(t, c.VolumeTrimEnabled(""))
+	assert.True(t, c.VolumeTrimEnabled("io2"))
+	assert.False(t, c.VolumeTrimEnabled("st1"))
+}
+
+func TestLoadConfig_VolumeBackends_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		toml    string
+		wantErr string
+	}{
+		{
+			name:    "unknown backend",
+			toml:    "[nodes.n1.volume_backends]\ngp3 = \"ceph\"\n",
+			wantErr: "unknown storage backend",
+		},
+		{
+			name:    "local without dir",
+			toml:    "[nodes.n1.volume_backends]\nio2 = \"local\"\n",
+			wantErr: "local_volumes.dir",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resetViper(t)
+			path := filepath.Join(t.TempDir(), "spinifex.toml")
+			require.NoError(t, os.WriteFile(path, []byte("node = \"n1\"\n\n"+tt.toml), 0600))
+
+			_, err := LoadConfig(path)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestVolumeBackend_Defaults(t *testing.T) {
+	var c Config
+	assert.Equal(t, VolumeBackendViperblock, c.VolumeBackend(""))
+	assert.Equal(t, VolumeBackendViperblock, c.VolumeBackend("gp3"))
+	assert.Empty(t, c.VolumeBackend("io2"))
+}
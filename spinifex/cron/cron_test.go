@@ -0,0 +1,101 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"1,,2 * * * *",
+		"* * * FOO *",
+		"@often",
+	} {
+		_, err := Parse(expr, nil)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestNext(t *testing.T) {
+	// Friday 17 October 2026, 19:30 UTC
+	from := time.Date(2026, 10, 17, 19, 30, 0, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"0 20 * * *", time.Date(2026, 10, 17, 20, 0, 0, 0, time.UTC)},
+		{"30 19 * * *", time.Date(2026, 10, 18, 19, 30, 0, 0, time.UTC)},
+		{"*/20 * * * *", time.Date(2026, 10, 17, 19, 40, 0, 0, time.UTC)},
+		{"0 8 * * MON-FRI", time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)},
+		{"0 8 * * 1-5", time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 9 1 * *", time.Date(2026, 11, 1, 9, 0, 0, 0, time.UTC)},
+		{"0 9 1 jan *", time.Date(2027, 1, 1, 9, 0, 0, 0, time.UTC)},
+		{"15 8-18/5 * * *", time.Date(2026, 10, 18, 8, 15, 0, 0, time.UTC)},
+		{"0 12 29 2 *", time.Date(2028, 2, 29, 12, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: the 20th or any Monday
+		{"0 0 20 * MON", time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)},
+		// A day-of-month step starting with * still defers to the weekday
+		{"0 0 */2 * SUN", time.Date(2026, 10, 25, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			s, err := Parse(tt.expr, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, s.Next(from))
+		})
+	}
+}
+
+func TestNext_Never(t *testing.T) {
+	s, err := Parse("0 0 31 2 *", nil)
+	require.NoError(t, err)
+	assert.True(t, s.Next(time.Now()).IsZero())
+}
+
+func TestNext_TimeZone(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone database:", err)
+	}
+	s, err := Parse("0 20 * * *", loc)
+	require.NoError(t, err)
+	assert.Equal(t, loc, s.Location())
+
+	// 20:00 EDT is 00:00 UTC the next day
+	next := s.Next(time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC))
+	assert.Equal(t, time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC), next.UTC())
+
+	// 02:30 doesn't exist when clocks go forward on 8 March 2026
+	s, err = Parse("30 2 * * *", loc)
+	require.NoError(t, err)
+	next = s.Next(time.Date(2026, 3, 8, 0, 0, 0, 0, loc))
+	assert.Equal(t, time.Date(2026, 3, 9, 2, 30, 0, 0, loc), next)
+
+	// 01:30 repeats when clocks go back on 1 November 2026 and fires once
+	s, err = Parse("30 1 * * *", loc)
+	require.NoError(t, err)
+	first := s.Next(time.Date(2026, 11, 1, 0, 0, 0, 0, loc))
+	assert.Equal(t, time.Date(2026, 11, 1, 5, 30, 0, 0, time.UTC), first.UTC())
+	assert.Equal(t, time.Date(2026, 11, 2, 1, 30, 0, 0, loc), s.Next(first))
+
+	// Schedules for every hour fire in both passes
+	s, err = Parse("30 * * * *", loc)
+	require.NoError(t, err)
+	second := s.Next(first)
+	assert.Equal(t, time.Date(2026, 11, 1, 6, 30, 0, 0, time.UTC), second.UTC())
+}
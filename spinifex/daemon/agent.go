@@ -0,0 +1,131 @@
+package daemon
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+)
+
+// The Spinifex agent channel is a virtio-serial port the guest writes
+// newline-delimited JSON messages to. The daemon answers each message with
+// one line: {"ok":true}, or {"error":"..."} when the message was rejected.
+//
+// {"password_data":"<base64>"} posts the guest's generated password,
+// encrypted with the instance key pair (RSA PKCS#1 v1.5, as on EC2), for
+// GetPasswordData.
+
+const (
+	// agentReconnectInterval is how long the daemon waits before reopening
+	// the agent channel after QEMU closed it or it couldn't be opened.
+	agentReconnectInterval = 5 * time.Second
+
+	// maxPasswordData bounds the decoded password data: RSA-4096 ciphertext
+	// is 512 bytes.
+	maxPasswordData = 1024
+
+	// maxAgentMessage bounds a single agent channel message.
+	maxAgentMessage = 64 * 1024
+)
+
+// agentMessage is a message the guest posts on the agent channel.
+type agentMessage struct {
+	PasswordData string `json:"password_data,omitempty"`
+}
+
+// agentReply is the daemon's answer to an agent message.
+type agentReply struct {
+	OK    bool   `json:"ok,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// runAgentChannel serves the instance's agent channel until the instance
+// stops running. QEMU serves the socket, so the daemon reconnects whenever
+// the connection drops.
+func (d *Daemon) runAgentChannel(instance *vm.VM) {
+	socket := instance.Config.AgentSocket
+	for {
+		d.Instances.Mu.Lock()
+		status := instance.Status
+		d.Instances.Mu.Unlock()
+		if status == vm.StateStopping || status == vm.StateStopped || status == vm.StateShuttingDown || status == vm.StateTerminated || status == vm.StateError {
+			slog.Debug("Agent channel closing - instance not running", "instance", instance.ID, "status", status)
+			return
+		}
+
+		conn, err := net.DialTimeout("unix", socket, guestAgentTimeout)
+		if err != nil {
+			slog.Debug("Agent channel unavailable", "instance", instance.ID, "err", err)
+		} else {
+			d.serveAgentConn(instance, conn)
+			_ = conn.Close()
+		}
+
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-time.After(agentReconnectInterval):
+		}
+	}
+}
+
+// serveAgentConn handles agent messages on conn until it closes.
+func (d *Daemon) serveAgentConn(instance *vm.VM, conn io.ReadWriter) {
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), maxAgentMessage)
+	encoder := json.NewEncoder(conn)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		reply := agentReply{OK: true}
+		if err := d.handleAgentMessage(instance, scanner.Bytes()); err != nil {
+			slog.Warn("Rejected agent message", "instance", instance.ID, "err", err)
+			reply = agentReply{Error: err.Error()}
+		}
+		if err := encoder.Encode(reply); err != nil {
+			slog.Debug("Agent channel write failed", "instance", instance.ID, "err", err)
+			return
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		slog.Debug("Agent channel read failed", "instance", instance.ID, "err", err)
+	}
+}
+
+// handleAgentMessage applies one agent message to the instance.
+func (d *Daemon) handleAgentMessage(instance *vm.VM, data []byte) error {
+	var msg agentMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return errors.New("malformed message")
+	}
+	if msg.PasswordData == "" {
+		return errors.New("unsupported message")
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(msg.PasswordData)
+	if err != nil {
+		return errors.New("password_data is not base64")
+	}
+	if len(decoded) == 0 || len(decoded) > maxPasswordData {
+		return errors.New("password_data has an invalid length")
+	}
+
+	d.Instances.Mu.Lock()
+	instance.PasswordData = msg.PasswordData
+	instance.PasswordDataTime = utils.Now()
+	d.Instances.Mu.Unlock()
+
+	if err := d.WriteState(); err != nil {
+		slog.Error("Failed to persist password data", "instance", instance.ID, "err", err)
+	}
+	slog.Info("Guest agent posted password data", "instance", instance.ID)
+	return nil
+}
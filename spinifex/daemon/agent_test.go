@@ -0,0 +1,93 @@
+package daemon
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeAgentConn(t *testing.T) {
+	d := &Daemon{Instances: vm.Instances{VMS: make(map[string]*vm.VM)}}
+	instance := &vm.VM{ID: "i-agent", Status: vm.StateRunning}
+	d.Instances.VMS[instance.ID] = instance
+
+	guest, host := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		d.serveAgentConn(instance, host)
+		close(done)
+	}()
+
+	replies := bufio.NewScanner(guest)
+	post := func(line string) agentReply {
+		t.Helper()
+		require.NoError(t, guest.SetDeadline(time.Now().Add(5*time.Second)))
+		_, err := guest.Write([]byte(line + "\n"))
+		require.NoError(t, err)
+		require.True(t, replies.Scan())
+		var reply agentReply
+		require.NoError(t, json.Unmarshal(replies.Bytes(), &reply))
+		return reply
+	}
+
+	assert.NotEmpty(t, post(`not json`).Error)
+	assert.NotEmpty(t, post(`{"unknown":1}`).Error)
+	assert.NotEmpty(t, post(`{"password_data":"not base64!"}`).Error)
+	assert.Empty(t, instance.PasswordData)
+
+	assert.Equal(t, agentReply{OK: true}, post(`{"password_data":"ZW5jcnlwdGVk"}`))
+	d.Instances.Mu.Lock()
+	assert.Equal(t, "ZW5jcnlwdGVk", instance.PasswordData)
+	assert.False(t, instance.PasswordDataTime.IsZero())
+	d.Instances.Mu.Unlock()
+
+	require.NoError(t, guest.Close())
+	<-done
+}
+
+func TestHandleEC2GetStoppedInstancePasswordData(t *testing.T) {
+	daemon := createFullTestDaemonWithJetStream(t, sharedJSNATSURL)
+
+	instanceID := "i-password-stopped-001"
+	posted := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, daemon.jsManager.WriteStoppedInstance(instanceID, &vm.VM{
+		ID:               instanceID,
+		Status:           vm.StateStopped,
+		AccountID:        testAccountID,
+		Instance:         &ec2.Instance{InstanceId: aws.String(instanceID)},
+		PasswordData:     "ZW5jcnlwdGVk",
+		PasswordDataTime: posted,
+	}))
+	t.Cleanup(func() { _ = daemon.jsManager.DeleteStoppedInstance(instanceID) })
+
+	subject := "ec2.GetStoppedInstancePasswordData"
+	sub, err := daemon.natsConn.QueueSubscribe(subject, "spinifex-workers", daemon.handleEC2GetStoppedInstancePasswordData)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	get := func(id string) []byte {
+		t.Helper()
+		reqData, _ := json.Marshal(types.EC2InstanceCommand{ID: id, Attributes: types.EC2CommandAttributes{GetPasswordData: true}})
+		reply, err := natsRequest(daemon.natsConn, subject, reqData, 5*time.Second)
+		require.NoError(t, err)
+		return reply.Data
+	}
+
+	var output ec2.GetPasswordDataOutput
+	require.NoError(t, json.Unmarshal(get(instanceID), &output))
+	assert.Equal(t, instanceID, aws.StringValue(output.InstanceId))
+	assert.Equal(t, "ZW5jcnlwdGVk", aws.StringValue(output.PasswordData))
+	assert.True(t, posted.Equal(aws.TimeValue(output.Timestamp)))
+
+	assert.Contains(t, string(get("i-password-missing")), awserrors.ErrorInvalidInstanceIDNotFound)
+}
@@ -0,0 +1,118 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_autoscaling "github.com/mulgadc/spinifex/spinifex/handlers/autoscaling"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	autoScalingInterval      = 30 * time.Second
+	autoScalingLaunchTimeout = 5 * time.Minute
+)
+
+// startAutoScaling runs the Auto Scaling reconciliation loop. Every daemon
+// runs the ticker, but only the JetStream meta-leader acts on a tick so each
+// group is reconciled by one node at a time. Group state lives in KV, so a
+// new leader carries on where the previous one stopped.
+func (d *Daemon) startAutoScaling() {
+	ticker := time.NewTicker(autoScalingInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-d.ctx.Done():
+				return
+			case <-ticker.C:
+				if d.queryNATSRole() != roleLeader {
+					continue
+				}
+				d.autoScalingService.Reconcile(&autoScalingController{d: d}, utils.Now())
+			}
+		}
+	}()
+}
+
+// autoScalingController launches and terminates group instances through the
+// same NATS subjects as the public API.
+type autoScalingController struct {
+	d *Daemon
+}
+
+var _ handlers_autoscaling.InstanceController = (*autoScalingController)(nil)
+
+// LaunchInstance sends the launch to any node with capacity for the
+// instance type; the per-type queue group picks the node.
+func (c *autoScalingController) LaunchInstance(input *ec2.RunInstancesInput, accountID string) (*ec2.Instance, error) {
+	subject := subjects.RunInstances(aws.StringValue(input.InstanceType))
+	reservation, err := utils.NATSRequest[ec2.Reservation](c.d.natsConn, subject, input, autoScalingLaunchTimeout, accountID)
+	if err != nil {
+		if errors.Is(err, nats.ErrNoResponders) {
+			return nil, errors.New(awserrors.ErrorInsufficientInstanceCapacity)
+		}
+		return nil, err
+	}
+	if len(reservation.Instances) == 0 {
+		return nil, fmt.Errorf("launch on %s returned no instances", subject)
+	}
+	return reservation.Instances[0], nil
+}
+
+// TerminateInstance terminates the instance as TerminateInstances would.
+func (c *autoScalingController) TerminateInstance(instanceID, accountID string) error {
+	err := c.d.sendInstanceCommand(accountID, types.EC2InstanceCommand{
+		ID: instanceID,
+		Attributes: types.EC2CommandAttributes{
+			StopInstance:      true,
+			TerminateInstance: true,
+		},
+	})
+	if !errors.Is(err, nats.ErrNoResponders) {
+		return err
+	}
+
+	// Stopped instances have no owning node; any daemon can terminate them
+	// from shared KV.
+	data, err := json.Marshal(terminateStoppedInstanceRequest{InstanceID: instanceID})
+	if err != nil {
+		return fmt.Errorf("marshal terminate request: %w", err)
+	}
+	reqMsg := nats.NewMsg(utils.Subject("ec2.terminate"))
+	reqMsg.Data = data
+	reqMsg.Header.Set(utils.AccountIDHeader, accountID)
+	resp, err := c.d.natsConn.RequestMsg(reqMsg, instanceEventCommandTimeout)
+	if err != nil {
+		return err
+	}
+	if replyErr := utils.DecodeReply(resp).Err; replyErr != nil {
+		return replyErr
+	}
+	return nil
+}
+
+// InstanceStates reports every instance the cluster knows about by its EC2 state name.
+func (c *autoScalingController) InstanceStates() (map[string]string, error) {
+	if c.d.jsManager == nil {
+		return nil, errors.New("JetStream not available")
+	}
+	states, err := c.d.jsManager.ListInstanceStates()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(states))
+	for id, state := range states {
+		names[id] = vm.EC2StateCodes[state].Name
+	}
+	return names, nil
+}
@@ -0,0 +1,146 @@
+package daemon
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/config"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+)
+
+// bootPlan is the result of fitting the instances restored as running onto
+// the host's schedulable capacity.
+type bootPlan struct {
+	// evict holds the instances that don't fit, lowest priority last.
+	evict     []*vm.VM
+	needVCPU  int
+	needMemGB float64
+	haveVCPU  int
+	haveMemGB float64
+}
+
+// report describes the shortfall for logs and the refuse policy's error.
+func (p bootPlan) report() string {
+	evicted := make([]string, len(p.evict))
+	for i, instance := range p.evict {
+		evicted[i] = fmt.Sprintf("%s (%s, priority %d)", instance.ID, instance.InstanceType, instance.BootPriority())
+	}
+	return fmt.Sprintf("restored instances need %d vCPU and %.1f GiB but the host has %d vCPU and %.1f GiB schedulable; %d instance(s) don't fit: %s",
+		p.needVCPU, p.needMemGB, p.haveVCPU, p.haveMemGB, len(p.evict), strings.Join(evicted, ", "))
+}
+
+// planBootCapacity fits the instances that restore will run onto the host's
+// schedulable capacity and returns the ones that don't fit.
+//
+// Instances whose QEMU survived the restart are placed first and never
+// evicted: they already hold the host's resources, and stopping them would
+// cut power to a live guest. The rest are placed by BootPriority, highest
+// first, then by launch time, longest running first.
+func (d *Daemon) planBootCapacity(instances []*vm.VM) bootPlan {
+	type candidate struct {
+		instance     *vm.VM
+		instanceType *ec2.InstanceTypeInfo
+		alive        bool
+		priority     int
+		launched     time.Time
+	}
+
+	var candidates []candidate
+	for _, instance := range instances {
+		switch instance.Status {
+		case vm.StateRunning, vm.StatePending, vm.StateProvisioning:
+		default:
+			continue
+		}
+		instanceType, ok := d.resourceMgr.instanceTypes[instance.InstanceType]
+		if !ok {
+			continue
+		}
+		c := candidate{
+			instance:     instance,
+			instanceType: instanceType,
+			alive:        d.isInstanceProcessRunning(instance),
+			priority:     instance.BootPriority(),
+		}
+		if instance.Instance != nil && instance.Instance.LaunchTime != nil {
+			c.launched = *instance.Instance.LaunchTime
+		}
+		candidates = append(candidates, c)
+	}
+
+	slices.SortFunc(candidates, func(a, b candidate) int {
+		if a.alive != b.alive {
+			if a.alive {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Or(
+			cmp.Compare(b.priority, a.priority),
+			a.launched.Compare(b.launched),
+			strings.Compare(a.instance.ID, b.instance.ID),
+		)
+	})
+
+	rm := d.resourceMgr
+	rm.mu.RLock()
+	plan := bootPlan{
+		haveVCPU:  rm.hostVCPU - rm.reservedVCPU,
+		haveMemGB: rm.hostMemGB - rm.reservedMem,
+		needVCPU:  rm.allocatedVCPU,
+		needMemGB: rm.allocatedMem,
+	}
+	rm.mu.RUnlock()
+
+	usedVCPU, usedMemGB := plan.needVCPU, plan.needMemGB
+	for _, c := range candidates {
+		vCPUs := instanceTypeVCPUs(c.instanceType)
+		memMiB := instanceTypeMemoryMiB(c.instanceType)
+		memGB := float64(memMiB) / 1024.0
+		plan.needVCPU += int(vCPUs)
+		plan.needMemGB += memGB
+
+		if !c.alive && canAllocateCount(plan.haveVCPU, usedVCPU, plan.haveMemGB, usedMemGB, vCPUs, memMiB, 1) < 1 {
+			plan.evict = append(plan.evict, c.instance)
+			continue
+		}
+		usedVCPU += int(vCPUs)
+		usedMemGB += memGB
+	}
+	return plan
+}
+
+// checkBootCapacity applies the boot oversubscription policy to the loaded
+// instances. It returns the IDs of the instances restore must stop so the
+// rest fit, or an error when the policy refuses to start oversubscribed.
+func (d *Daemon) checkBootCapacity(instances []*vm.VM) (map[string]bool, error) {
+	plan := d.planBootCapacity(instances)
+	if len(plan.evict) == 0 {
+		return nil, nil
+	}
+
+	if d.config.Daemon.BootOversubscription == config.BootOversubscriptionRefuse {
+		return nil, fmt.Errorf("host is oversubscribed: %s", plan.report())
+	}
+
+	slog.Warn("Host is oversubscribed, stopping lowest-priority instances", "report", plan.report())
+	evict := make(map[string]bool, len(plan.evict))
+	for _, instance := range plan.evict {
+		evict[instance.ID] = true
+	}
+	return evict, nil
+}
+
+// stopRestoredInstance moves an instance restore can't run to stopped, with
+// an insufficient-capacity state reason, and hands it to the shared KV so
+// it can be started on any node.
+func (d *Daemon) stopRestoredInstance(instance *vm.VM, message string) {
+	instance.Status = vm.StateStopped
+	d.setStateReason(instance, stateReasonInsufficientCapacity, message)
+	d.migrateStoppedToSharedKV(instance)
+}
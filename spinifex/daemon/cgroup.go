@@ -0,0 +1,159 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/mulgadc/spinifex/spinifex/vm"
+)
+
+// instanceCgroupRoot is the cgroup v2 directory holding one child cgroup per
+// running instance. Variable so tests can point it at a temp dir.
+var instanceCgroupRoot = "/sys/fs/cgroup/spinifex"
+
+const (
+	// cpuCgroupPeriod is the cgroup v2 CPU bandwidth period, in microseconds.
+	cpuCgroupPeriod = 100000
+
+	// cpuWeightPerVCPU is the cpu.weight each vCPU gives an instance, so
+	// under contention instances share the host in proportion to their
+	// size. 100 is the kernel's default weight.
+	cpuWeightPerVCPU = 100
+
+	// qemuMemoryOverheadMiB is the memory QEMU itself may use on top of the
+	// guest's RAM (device emulation, page tables, I/O buffers) before the
+	// instance's cgroup reclaims and, past that, OOM-kills it.
+	qemuMemoryOverheadMiB = 512
+)
+
+// cgroupLimits are the resource limits of an instance's cgroup.
+type cgroupLimits struct {
+	// cpuWeight is the instance's share of contended CPU (cpu.weight).
+	cpuWeight int
+	// cpus caps the CPU time the instance's QEMU process may use, in
+	// CPUs (cpu.max). Zero lifts the cap.
+	cpus float64
+	// memoryMaxMiB caps the QEMU process's memory (memory.max).
+	memoryMaxMiB int
+	// numa, when set, confines the process to its placement's CPUs and
+	// host node (cpuset.cpus, cpuset.mems).
+	numa *vm.NUMAPlacement
+}
+
+// instanceCgroupLimits returns the limits for an instance with vCPUs vCPUs,
+// started with cfg. The QEMU process may use as much CPU as its vCPUs, and
+// the memory the guest can grow to (cfg.MaxMemory when it was started with
+// room to hot-plug) plus qemuMemoryOverheadMiB. A pinned instance is kept to
+// its NUMA placement.
+func instanceCgroupLimits(vCPUs int, cfg vm.Config) cgroupLimits {
+	return cgroupLimits{
+		cpuWeight:    min(max(vCPUs*cpuWeightPerVCPU, 1), 10000),
+		cpus:         float64(vCPUs),
+		memoryMaxMiB: max(cfg.Memory, cfg.MaxMemory) + qemuMemoryOverheadMiB,
+		numa:         cfg.NUMA,
+	}
+}
+
+// placeInstanceCgroup moves pid into the instance's cgroup, creating it if
+// needed, and applies limits.
+func placeInstanceCgroup(instanceID string, pid int, limits cgroupLimits) error {
+	dir, err := instanceCgroupDir(instanceID, "+cpu +cpuset +memory")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cpu.weight"), []byte(strconv.Itoa(limits.cpuWeight)), 0o644); err != nil {
+		return fmt.Errorf("write cpu.weight: %w", err)
+	}
+	if err := writeCPUMax(dir, limits.cpus); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "memory.max"), []byte(strconv.Itoa(limits.memoryMaxMiB<<20)), 0o644); err != nil {
+		return fmt.Errorf("write memory.max: %w", err)
+	}
+	if limits.numa != nil {
+		if err := os.WriteFile(filepath.Join(dir, "cpuset.cpus"), []byte(limits.numa.CPUList()), 0o644); err != nil {
+			return fmt.Errorf("write cpuset.cpus: %w", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "cpuset.mems"), []byte(strconv.Itoa(limits.numa.HostNode)), 0o644); err != nil {
+			return fmt.Errorf("write cpuset.mems: %w", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0o644); err != nil {
+		return fmt.Errorf("move pid %d into cgroup: %w", pid, err)
+	}
+	return nil
+}
+
+// instanceCgroupDir creates the instance's cgroup under instanceCgroupRoot
+// and returns its path. Children only get a controller's files once the
+// parent delegates it; controllers may already be enabled, and a real
+// failure shows up when the caller writes them.
+func instanceCgroupDir(instanceID, controllers string) (string, error) {
+	if err := os.MkdirAll(instanceCgroupRoot, 0o755); err != nil {
+		return "", fmt.Errorf("create cgroup root: %w", err)
+	}
+	_ = os.WriteFile(filepath.Join(instanceCgroupRoot, "cgroup.subtree_control"), []byte(controllers), 0o644)
+
+	dir := filepath.Join(instanceCgroupRoot, instanceID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("create cgroup: %w", err)
+	}
+	return dir, nil
+}
+
+// writeCPUMax limits the cgroup at dir to cpus CPUs, or lifts the limit
+// when cpus is 0.
+func writeCPUMax(dir string, cpus float64) error {
+	quota := "max"
+	if cpus > 0 {
+		quota = strconv.Itoa(max(int(cpus*cpuCgroupPeriod), 1000))
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cpu.max"), fmt.Appendf(nil, "%s %d", quota, cpuCgroupPeriod), 0o644); err != nil {
+		return fmt.Errorf("write cpu.max: %w", err)
+	}
+	return nil
+}
+
+// applyInstanceCgroup places a running instance's QEMU process in its cgroup
+// with the limits of its current type. A burstable instance that is out of
+// credits stays capped at its baseline. Failures leave the process in
+// whatever cgroup it was in, so they are logged rather than returned.
+func (d *Daemon) applyInstanceCgroup(instance *vm.VM, pid int) {
+	d.Instances.Mu.Lock()
+	instanceType := instance.InstanceType
+	cfg := instance.Config
+	throttled := instance.CPUCredits != nil && instance.CPUCredits.Throttled
+	d.Instances.Mu.Unlock()
+
+	limits := instanceCgroupLimits(d.instanceVCPUs(instanceType), cfg)
+	if throttled {
+		limits.cpus = d.baselineVCPUs(instanceType)
+	}
+	if err := placeInstanceCgroup(instance.ID, pid, limits); err != nil {
+		slog.Warn("Failed to place instance in its cgroup", "instanceId", instance.ID, "pid", pid, "err", err)
+		return
+	}
+	slog.Debug("Placed instance in its cgroup", "instanceId", instance.ID, "pid", pid,
+		"cpuWeight", limits.cpuWeight, "cpus", limits.cpus, "memoryMaxMiB", limits.memoryMaxMiB)
+}
+
+// instanceVCPUs returns the vCPUs of instanceType, or 0 if it is unknown.
+func (d *Daemon) instanceVCPUs(instanceType string) int {
+	info, ok := d.resourceMgr.instanceTypes[instanceType]
+	if !ok {
+		return 0
+	}
+	return int(instanceTypeVCPUs(info))
+}
+
+// removeInstanceCgroup removes the instance's cgroup once its QEMU process
+// has exited.
+func removeInstanceCgroup(instanceID string) {
+	if err := os.Remove(filepath.Join(instanceCgroupRoot, instanceID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Debug("Failed to remove instance cgroup", "instanceId", instanceID, "err", err)
+	}
+}
@@ -0,0 +1,58 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstanceCgroupLimits(t *testing.T) {
+	assert.Equal(t, cgroupLimits{cpuWeight: 200, cpus: 2, memoryMaxMiB: 8192 + 512},
+		instanceCgroupLimits(2, vm.Config{CPUCount: 2, Memory: 8192}))
+	assert.Equal(t, cgroupLimits{cpuWeight: 10000, cpus: 192, memoryMaxMiB: 32768 + 512},
+		instanceCgroupLimits(192, vm.Config{Memory: 8192, MaxMemory: 32768}), "weight is capped and hot-plug room is allowed for")
+}
+
+func TestApplyInstanceCgroup(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "spinifex")
+	oldRoot := instanceCgroupRoot
+	instanceCgroupRoot = root
+	t.Cleanup(func() { instanceCgroupRoot = oldRoot })
+
+	d := &Daemon{resourceMgr: &ResourceManager{instanceTypes: map[string]*ec2.InstanceTypeInfo{
+		"t3.large": resizeTestType("t3.large", 2, 8192),
+	}}}
+	instance := &vm.VM{ID: "i-cgroup", InstanceType: "t3.large", Config: vm.Config{CPUCount: 2, Memory: 8192}}
+	read := func(name string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(root, instance.ID, name))
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	d.applyInstanceCgroup(instance, 4242)
+	subtree, err := os.ReadFile(filepath.Join(root, "cgroup.subtree_control"))
+	require.NoError(t, err)
+	assert.Equal(t, "+cpu +cpuset +memory", string(subtree))
+	assert.Equal(t, "200", read("cpu.weight"))
+	assert.Equal(t, "200000 100000", read("cpu.max"))
+	assert.Equal(t, strconv.Itoa((8192+512)<<20), read("memory.max"))
+	assert.Equal(t, "4242", read("cgroup.procs"))
+
+	// An instance out of CPU credits keeps its baseline cap.
+	instance.CPUCredits = &vm.CPUCredits{Throttled: true}
+	d.applyInstanceCgroup(instance, 4242)
+	assert.Equal(t, strconv.Itoa(int(d.baselineVCPUs("t3.large")*cpuCgroupPeriod))+" 100000", read("cpu.max"))
+
+	// A pinned instance is confined to its NUMA placement.
+	instance.Config.NUMA = &vm.NUMAPlacement{HostNode: 1, CPUs: []int{12, 13}}
+	d.applyInstanceCgroup(instance, 4242)
+	assert.Equal(t, "12,13", read("cpuset.cpus"))
+	assert.Equal(t, "1", read("cpuset.mems"))
+}
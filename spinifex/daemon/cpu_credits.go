@@ -0,0 +1,254 @@
+package daemon
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mulgadc/spinifex/spinifex/instancetypes"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+)
+
+const (
+	cpuCreditInterval = time.Minute
+
+	// cpuCreditAccrualHours caps the balance at this many hours of earnings,
+	// as AWS does.
+	cpuCreditAccrualHours = 24
+
+	// cpuCreditResumeBalance is the balance a throttled standard instance
+	// must earn back before it may burst again, so it isn't released and
+	// capped again on alternate samples.
+	cpuCreditResumeBalance = 1.0
+
+	// clockTicksPerSecond is the unit of utime and stime in /proc/<pid>/stat
+	// (USER_HZ, which is 100 on every Linux platform we run on).
+	clockTicksPerSecond = 100
+)
+
+// procRoot is where QEMU's CPU time is read from. Variable for tests.
+var procRoot = "/proc"
+
+// startCPUCreditAccounting samples the CPU time of this node's burstable
+// instances every cpuCreditInterval and charges it against their credits.
+func (d *Daemon) startCPUCreditAccounting() {
+	ticker := time.NewTicker(cpuCreditInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-d.ctx.Done():
+				return
+			case <-ticker.C:
+				d.accountCPUCredits(utils.Now())
+			}
+		}
+	}()
+}
+
+// accountCPUCredits charges every running burstable instance for the CPU
+// its QEMU process used since the last sample, and writes the balances to
+// the node's state so they survive a daemon restart.
+func (d *Daemon) accountCPUCredits(now time.Time) {
+	charged := false
+	for _, instance := range d.Instances.ListVMs() {
+		var burstable bool
+		d.Instances.WithVM(instance.ID, func(v *vm.VM) {
+			burstable = v.CPUCredits != nil && v.Status == vm.StateRunning
+		})
+		if !burstable {
+			continue
+		}
+
+		pid, err := utils.ReadPidFile(instance.ID)
+		if err != nil || pid <= 0 {
+			continue
+		}
+		cpuSeconds, err := processCPUSeconds(pid)
+		if err != nil {
+			slog.Debug("Failed to read instance CPU time", "instanceId", instance.ID, "pid", pid, "err", err)
+			continue
+		}
+		d.chargeCPUCredits(instance, pid, cpuSeconds, now)
+		charged = true
+	}
+	if !charged {
+		return
+	}
+	if err := d.WriteState(); err != nil {
+		slog.Warn("Failed to persist CPU credit balances", "err", err)
+	}
+}
+
+// chargeCPUCredits updates an instance's credits from a CPU time sample of
+// its QEMU process and applies the cgroup cap when the sample moves a
+// standard instance into or out of throttling.
+func (d *Daemon) chargeCPUCredits(instance *vm.VM, pid int, cpuSeconds float64, now time.Time) {
+	baselineVCPUs := d.baselineVCPUs(instance.InstanceType)
+	if baselineVCPUs <= 0 {
+		return
+	}
+
+	var apply, throttled bool
+	d.Instances.WithVM(instance.ID, func(v *vm.VM) {
+		if v.CPUCredits == nil {
+			return
+		}
+		apply = accrueCPUCredits(v.CPUCredits, baselineVCPUs, pid, cpuSeconds, now)
+		throttled = v.CPUCredits.Throttled
+	})
+	if apply {
+		d.applyCPUCap(instance.ID, pid, throttled, baselineVCPUs)
+	}
+}
+
+// baselineVCPUs returns how many vCPUs' worth of CPU a burstable type may
+// use indefinitely, which is also its earning rate in credits a minute.
+// It returns 0 for types that don't use CPU credits.
+func (d *Daemon) baselineVCPUs(instanceType string) float64 {
+	baseline, ok := instancetypes.BaselineCPUUtilization(instanceType)
+	if !ok {
+		return 0
+	}
+	info, ok := d.resourceMgr.instanceTypes[instanceType]
+	if !ok {
+		return 0
+	}
+	return baseline * float64(instanceTypeVCPUs(info))
+}
+
+// retypeCPUCredits returns the credit state of an instance changed to
+// instanceType: nil when the type doesn't use CPU credits, a fresh state in
+// the type's default mode when the instance didn't use them before, and c
+// otherwise.
+func retypeCPUCredits(c *vm.CPUCredits, instanceType string) *vm.CPUCredits {
+	mode, ok := instancetypes.DefaultCPUCredits(instanceType)
+	switch {
+	case !ok:
+		return nil
+	case c == nil:
+		return &vm.CPUCredits{Mode: mode}
+	default:
+		return c
+	}
+}
+
+// accrueCPUCredits charges a CPU time sample against c: the instance earns
+// baselineVCPUs credits a minute and spends one per vCPU-minute used. In
+// standard mode the balance stops at zero and the instance is throttled
+// until it has earned some back; in unlimited mode spending past zero runs
+// up a surplus. The first sample of a QEMU process only sets the starting
+// point. It reports whether the cgroup cap needs applying: when Throttled
+// changes, or when a restarted QEMU process has yet to inherit the cap.
+func accrueCPUCredits(c *vm.CPUCredits, baselineVCPUs float64, pid int, cpuSeconds float64, now time.Time) bool {
+	last, lastCPU := c.SampledAt, c.CPUSeconds
+	fresh := c.PID != pid || cpuSeconds < lastCPU || last.IsZero()
+	c.PID, c.CPUSeconds, c.SampledAt = pid, cpuSeconds, now
+	if fresh {
+		return c.Throttled
+	}
+	if !now.After(last) {
+		return false
+	}
+
+	earned := baselineVCPUs * now.Sub(last).Minutes()
+	spent := (cpuSeconds - lastCPU) / 60
+
+	repaid := min(c.Surplus, earned)
+	c.Surplus -= repaid
+	c.Balance += earned - repaid - spent
+	if c.Balance < 0 {
+		if c.Mode == instancetypes.CPUCreditsUnlimited {
+			c.Surplus -= c.Balance
+		}
+		c.Balance = 0
+	}
+	c.Balance = min(c.Balance, baselineVCPUs*60*cpuCreditAccrualHours)
+
+	return updateCPUThrottle(c)
+}
+
+// updateCPUThrottle sets Throttled from the mode and balance and reports
+// whether it changed.
+func updateCPUThrottle(c *vm.CPUCredits) bool {
+	throttle := c.Throttled
+	switch {
+	case c.Mode != instancetypes.CPUCreditsStandard:
+		throttle = false
+	case c.Balance <= 0:
+		throttle = true
+	case c.Balance >= cpuCreditResumeBalance:
+		throttle = false
+	}
+	changed := throttle != c.Throttled
+	c.Throttled = throttle
+	return changed
+}
+
+// applyCPUCap holds the instance's QEMU process to baselineVCPUs through its
+// cgroup when throttled, and returns it to its full vCPUs otherwise.
+// Failures leave the guest at its previous cap, so they are logged rather
+// than returned.
+func (d *Daemon) applyCPUCap(instanceID string, pid int, throttled bool, baselineVCPUs float64) {
+	var instanceType string
+	d.Instances.WithVM(instanceID, func(v *vm.VM) { instanceType = v.InstanceType })
+	limit := float64(d.instanceVCPUs(instanceType))
+	if throttled {
+		limit = baselineVCPUs
+	}
+	if err := setCPUMax(instanceID, pid, limit); err != nil {
+		slog.Warn("Failed to update instance CPU cap", "instanceId", instanceID, "throttled", throttled, "err", err)
+		return
+	}
+	slog.Info("Updated instance CPU cap", "instanceId", instanceID, "throttled", throttled, "baselineVCPUs", baselineVCPUs)
+}
+
+// setCPUMax moves pid into the instance's cgroup and limits it to vcpus
+// CPUs, or lifts the limit when vcpus is 0. The pid is moved too so a QEMU
+// process that was restarted since it was placed picks up the cap.
+func setCPUMax(instanceID string, pid int, vcpus float64) error {
+	dir, err := instanceCgroupDir(instanceID, "+cpu")
+	if err != nil {
+		return err
+	}
+	if err := writeCPUMax(dir, vcpus); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0o644); err != nil {
+		return fmt.Errorf("move pid %d into cgroup: %w", pid, err)
+	}
+	return nil
+}
+
+// processCPUSeconds returns the user and system CPU time pid has used.
+func processCPUSeconds(pid int) (float64, error) {
+	data, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return 0, err
+	}
+	// The command name is parenthesised and may contain spaces, so fields
+	// are counted from after it: state is field 3, utime 14 and stime 15.
+	stat := string(data)
+	idx := strings.LastIndex(stat, ") ")
+	if idx < 0 {
+		return 0, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+	fields := strings.Fields(stat[idx+2:])
+	if len(fields) < 13 {
+		return 0, fmt.Errorf("malformed stat for pid %d", pid)
+	}
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse utime: %w", err)
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse stime: %w", err)
+	}
+	return float64(utime+stime) / clockTicksPerSecond, nil
+}
@@ -0,0 +1,216 @@
+package daemon
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/instancetypes"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccrueCPUCredits(t *testing.T) {
+	// A t3.micro: 2 vCPUs at a 10% baseline earn 0.2 credits a minute.
+	const baseline = 0.2
+	const pid = 4242
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minutes float64) time.Time { return start.Add(time.Duration(minutes * float64(time.Minute))) }
+
+	c := &vm.CPUCredits{Mode: instancetypes.CPUCreditsStandard}
+
+	// The first sample only sets the starting point.
+	assert.False(t, accrueCPUCredits(c, baseline, pid, 100, at(0)))
+	assert.Zero(t, c.Balance)
+
+	// Ten idle minutes earn two credits.
+	assert.False(t, accrueCPUCredits(c, baseline, pid, 100, at(10)))
+	assert.InDelta(t, 2.0, c.Balance, 1e-9)
+
+	// Ten minutes flat out on both vCPUs spends 20 and exhausts the balance.
+	assert.True(t, accrueCPUCredits(c, baseline, pid, 100+2*600, at(20)), "standard instance should be throttled")
+	assert.True(t, c.Throttled)
+	assert.Zero(t, c.Balance)
+	assert.Zero(t, c.Surplus, "standard mode never runs up a surplus")
+
+	// Still throttled until a whole credit is earned back.
+	assert.False(t, accrueCPUCredits(c, baseline, pid, 1300, at(22)))
+	assert.True(t, c.Throttled)
+	assert.True(t, accrueCPUCredits(c, baseline, pid, 1300, at(25)))
+	assert.False(t, c.Throttled)
+	assert.InDelta(t, 1.0, c.Balance, 1e-9)
+
+	// A restarted QEMU process starts a new sample without charging.
+	assert.False(t, accrueCPUCredits(c, baseline, pid+1, 5, at(26)))
+	assert.InDelta(t, 1.0, c.Balance, 1e-9)
+
+	// Two idle days stop earning at 24 hours' worth.
+	accrueCPUCredits(c, baseline, pid+1, 5, at(26+2*24*60))
+	assert.InDelta(t, baseline*60*24, c.Balance, 1e-9)
+}
+
+func TestAccrueCPUCredits_Unlimited(t *testing.T) {
+	const baseline = 0.2
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	c := &vm.CPUCredits{Mode: instancetypes.CPUCreditsUnlimited, Balance: 1}
+	accrueCPUCredits(c, baseline, 1, 0, start)
+
+	// Spending 6 credits against 1 banked plus 1 earned leaves a surplus of 4.
+	assert.False(t, accrueCPUCredits(c, baseline, 1, 360, start.Add(5*time.Minute)))
+	assert.False(t, c.Throttled, "unlimited instances are never throttled")
+	assert.Zero(t, c.Balance)
+	assert.InDelta(t, 4.0, c.Surplus, 1e-9)
+
+	// Earnings repay the surplus before they bank.
+	accrueCPUCredits(c, baseline, 1, 360, start.Add(30*time.Minute))
+	assert.Zero(t, c.Surplus)
+	assert.InDelta(t, 1.0, c.Balance, 1e-9)
+}
+
+func TestRetypeCPUCredits(t *testing.T) {
+	credits := &vm.CPUCredits{Mode: instancetypes.CPUCreditsStandard, Balance: 12}
+
+	assert.Nil(t, retypeCPUCredits(credits, "m7i.large"))
+	assert.Same(t, credits, retypeCPUCredits(credits, "t3.large"))
+	assert.Equal(t, &vm.CPUCredits{Mode: instancetypes.CPUCreditsUnlimited}, retypeCPUCredits(nil, "t3.large"))
+	assert.Equal(t, &vm.CPUCredits{Mode: instancetypes.CPUCreditsStandard}, retypeCPUCredits(nil, "t2.micro"))
+}
+
+func TestProcessCPUSeconds(t *testing.T) {
+	root := t.TempDir()
+	oldRoot := procRoot
+	procRoot = root
+	t.Cleanup(func() { procRoot = oldRoot })
+
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "77"), 0o755))
+	stat := "77 (qemu system) S 1 77 77 0 -1 4194560 1 0 0 0 1234 566 0 0 20 0 3 0 100 0 0\n"
+	require.NoError(t, os.WriteFile(filepath.Join(root, "77", "stat"), []byte(stat), 0o644))
+
+	got, err := processCPUSeconds(77)
+	require.NoError(t, err)
+	assert.InDelta(t, 18.0, got, 1e-9)
+
+	_, err = processCPUSeconds(78)
+	assert.Error(t, err)
+}
+
+func TestHandleEC2ModifyInstanceCreditSpecification_ModeSwitch(t *testing.T) {
+	d, cleanup := newTestDaemon(t)
+	defer cleanup()
+
+	var burstType string
+	for name := range d.resourceMgr.instanceTypes {
+		if _, ok := instancetypes.BaselineCPUUtilization(name); ok {
+			burstType = name
+			break
+		}
+	}
+	if burstType == "" {
+		t.Skip("no burstable instance types on this host")
+	}
+
+	cgroupRoot := filepath.Join(t.TempDir(), "spinifex")
+	oldRoot := instanceCgroupRoot
+	instanceCgroupRoot = cgroupRoot
+	t.Cleanup(func() { instanceCgroupRoot = oldRoot })
+
+	runDir := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", runDir)
+
+	instanceID := "i-credits-001"
+	require.NoError(t, os.WriteFile(filepath.Join(runDir, instanceID+".pid"), []byte(strconv.Itoa(os.Getpid())), 0o644))
+	d.Instances.VMS[instanceID] = &vm.VM{
+		ID:           instanceID,
+		Status:       vm.StateRunning,
+		InstanceType: burstType,
+		AccountID:    testAccountID,
+		CPUCredits:   &vm.CPUCredits{Mode: instancetypes.CPUCreditsUnlimited, Surplus: 3},
+	}
+	d.Instances.VMS["i-fixed-001"] = &vm.VM{ID: "i-fixed-001", Status: vm.StateRunning, InstanceType: "m7i.large", AccountID: testAccountID}
+
+	topic := "test.ec2.ModifyInstanceCreditSpecification." + t.Name()
+	sub, err := d.natsConn.Subscribe(topic, d.handleEC2ModifyInstanceCreditSpecification)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	modify := func(specs ...*ec2.InstanceCreditSpecificationRequest) *ec2.ModifyInstanceCreditSpecificationOutput {
+		t.Helper()
+		reqData, _ := json.Marshal(&ec2.ModifyInstanceCreditSpecificationInput{InstanceCreditSpecifications: specs})
+		reply, err := natsRequest(d.natsConn, topic, reqData, 5*time.Second)
+		require.NoError(t, err)
+		var output ec2.ModifyInstanceCreditSpecificationOutput
+		require.NoError(t, json.Unmarshal(reply.Data, &output))
+		return &output
+	}
+	cpuMax := func() string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(cgroupRoot, instanceID, "cpu.max"))
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	// Switching to standard with no balance forgives the surplus and caps
+	// the guest at its baseline straight away.
+	output := modify(
+		&ec2.InstanceCreditSpecificationRequest{InstanceId: aws.String(instanceID), CpuCredits: aws.String(instancetypes.CPUCreditsStandard)},
+		&ec2.InstanceCreditSpecificationRequest{InstanceId: aws.String("i-fixed-001"), CpuCredits: aws.String(instancetypes.CPUCreditsStandard)},
+		&ec2.InstanceCreditSpecificationRequest{InstanceId: aws.String("i-elsewhere"), CpuCredits: aws.String(instancetypes.CPUCreditsStandard)},
+	)
+	require.Len(t, output.SuccessfulInstanceCreditSpecifications, 1)
+	assert.Equal(t, instanceID, *output.SuccessfulInstanceCreditSpecifications[0].InstanceId)
+	require.Len(t, output.UnsuccessfulInstanceCreditSpecifications, 1, "instances on other nodes are left to them")
+	assert.Equal(t, "InstanceCreditSpecification.NotSupported", *output.UnsuccessfulInstanceCreditSpecifications[0].Error.Code)
+
+	credits := d.Instances.VMS[instanceID].CPUCredits
+	assert.Equal(t, instancetypes.CPUCreditsStandard, credits.Mode)
+	assert.Zero(t, credits.Surplus)
+	assert.True(t, credits.Throttled)
+	quota := int(d.baselineVCPUs(burstType) * cpuCgroupPeriod)
+	assert.Equal(t, strconv.Itoa(max(quota, 1000))+" 100000", cpuMax())
+
+	// Switching back to unlimited returns the guest to its full vCPUs.
+	output = modify(&ec2.InstanceCreditSpecificationRequest{InstanceId: aws.String(instanceID), CpuCredits: aws.String(instancetypes.CPUCreditsUnlimited)})
+	require.Len(t, output.SuccessfulInstanceCreditSpecifications, 1)
+	assert.False(t, credits.Throttled)
+	assert.Equal(t, strconv.Itoa(d.instanceVCPUs(burstType)*cpuCgroupPeriod)+" 100000", cpuMax())
+
+	// Bad modes are refused per instance.
+	output = modify(&ec2.InstanceCreditSpecificationRequest{InstanceId: aws.String(instanceID), CpuCredits: aws.String("turbo")})
+	require.Len(t, output.UnsuccessfulInstanceCreditSpecifications, 1)
+	assert.Equal(t, "InvalidCpuCredits", *output.UnsuccessfulInstanceCreditSpecifications[0].Error.Code)
+	assert.Equal(t, instancetypes.CPUCreditsUnlimited, credits.Mode)
+}
+
+func TestAccountCPUCredits_PersistsBalance(t *testing.T) {
+	d := createFullTestDaemonWithJetStream(t, sharedJSNATSURL)
+
+	runDir := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", runDir)
+
+	instanceID := "i-credits-persist"
+	require.NoError(t, os.WriteFile(filepath.Join(runDir, instanceID+".pid"), []byte(strconv.Itoa(os.Getpid())), 0o644))
+	d.Instances.VMS[instanceID] = &vm.VM{
+		ID:           instanceID,
+		Status:       vm.StateRunning,
+		InstanceType: "t3.micro",
+		CPUCredits:   &vm.CPUCredits{Mode: instancetypes.CPUCreditsStandard, Balance: 60},
+	}
+
+	d.accountCPUCredits(time.Now())
+
+	// The sample and balance survive a reload of the node's state.
+	loaded, err := d.jsManager.LoadState(d.node)
+	require.NoError(t, err)
+	require.Contains(t, loaded.VMS, instanceID)
+	credits := loaded.VMS[instanceID].CPUCredits
+	require.NotNil(t, credits)
+	assert.Equal(t, os.Getpid(), credits.PID)
+	assert.InDelta(t, 60.0, credits.Balance, 1e-9)
+}
@@ -17,6 +17,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"runtime/debug"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -32,13 +33,17 @@ import (
 	"github.com/mulgadc/spinifex/spinifex/admin"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
 	"github.com/mulgadc/spinifex/spinifex/config"
+	handlers_autoscaling "github.com/mulgadc/spinifex/spinifex/handlers/autoscaling"
 	handlers_ec2_account "github.com/mulgadc/spinifex/spinifex/handlers/ec2/account"
 	handlers_ec2_eigw "github.com/mulgadc/spinifex/spinifex/handlers/ec2/eigw"
 	handlers_ec2_eip "github.com/mulgadc/spinifex/spinifex/handlers/ec2/eip"
 	handlers_ec2_igw "github.com/mulgadc/spinifex/spinifex/handlers/ec2/igw"
 	handlers_ec2_image "github.com/mulgadc/spinifex/spinifex/handlers/ec2/image"
 	handlers_ec2_instance "github.com/mulgadc/spinifex/spinifex/handlers/ec2/instance"
+	handlers_ec2_instanceevent "github.com/mulgadc/spinifex/spinifex/handlers/ec2/instanceevent"
+	handlers_ec2_instanceschedule "github.com/mulgadc/spinifex/spinifex/handlers/ec2/instanceschedule"
 	handlers_ec2_key "github.com/mulgadc/spinifex/spinifex/handlers/ec2/key"
+	handlers_ec2_launchtemplate "github.com/mulgadc/spinifex/spinifex/handlers/ec2/launchtemplate"
 	handlers_ec2_natgw "github.com/mulgadc/spinifex/spinifex/handlers/ec2/natgw"
 	handlers_ec2_placementgroup "github.com/mulgadc/spinifex/spinifex/handlers/ec2/placementgroup"
 	handlers_ec2_routetable "github.com/mulgadc/spinifex/spinifex/handlers/ec2/routetable"
@@ -50,12 +55,15 @@ import (
 	"github.com/mulgadc/spinifex/spinifex/instancetypes"
 	"github.com/mulgadc/spinifex/spinifex/objectstore"
 	"github.com/mulgadc/spinifex/spinifex/qmp"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
 	"github.com/mulgadc/spinifex/spinifex/tags"
+	"github.com/mulgadc/spinifex/spinifex/tracing"
 	"github.com/mulgadc/spinifex/spinifex/types"
 	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/mulgadc/spinifex/spinifex/vm"
 	"github.com/mulgadc/viperblock/viperblock"
 	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type BlockDeviceMapping struct {
@@ -95,6 +103,18 @@ type ResourceManager struct {
 	allocatedVCPU int
 	allocatedMem  float64
 	instanceTypes map[string]*ec2.InstanceTypeInfo
+	// numa is the host's NUMA topology, nil on single-node hosts.
+	numa *numaTopology
+	// cordoned is set while the node drains. A cordoned node reports no
+	// free capacity and takes no RunInstances requests.
+	cordoned bool
+
+	// availableTypes caches GetAvailableInstanceTypeInfos(false) until
+	// availableTypesExpiry. allocate, deallocate and resize expire it;
+	// changes to instanceTypes or the reserve clear it with
+	// invalidateAvailableTypes.
+	availableTypes       []*ec2.InstanceTypeInfo
+	availableTypesExpiry time.Time
 
 	// Dynamic instance-type subscription management
 	subsMu       sync.Mutex
@@ -106,30 +126,34 @@ type ResourceManager struct {
 
 // Daemon represents the main daemon service
 type Daemon struct {
-	node                  string
-	clusterConfig         *config.ClusterConfig
-	config                *config.Config
-	natsConn              *nats.Conn
-	resourceMgr           *ResourceManager
-	instanceService       *handlers_ec2_instance.InstanceServiceImpl
-	keyService            *handlers_ec2_key.KeyServiceImpl
-	imageService          *handlers_ec2_image.ImageServiceImpl
-	volumeService         *handlers_ec2_volume.VolumeServiceImpl
-	accountService        *handlers_ec2_account.AccountSettingsServiceImpl
-	snapshotService       *handlers_ec2_snapshot.SnapshotServiceImpl
-	tagsService           *handlers_ec2_tags.TagsServiceImpl
-	eigwService           *handlers_ec2_eigw.EgressOnlyIGWServiceImpl
-	igwService            *handlers_ec2_igw.IGWServiceImpl
-	placementGroupService *handlers_ec2_placementgroup.PlacementGroupServiceImpl
-	vpcService            *handlers_ec2_vpc.VPCServiceImpl
-	eipService            *handlers_ec2_eip.EIPServiceImpl
-	elbv2Service          *handlers_elbv2.ELBv2ServiceImpl
-	routeTableService     *handlers_ec2_routetable.RouteTableServiceImpl
-	natGatewayService     *handlers_ec2_natgw.NatGatewayServiceImpl
-	externalIPAM          *handlers_ec2_vpc.ExternalIPAM
-	ctx                   context.Context
-	cancel                context.CancelFunc
-	shutdownWg            sync.WaitGroup
+	node                    string
+	clusterConfig           *config.ClusterConfig
+	config                  *config.Config
+	natsConn                *nats.Conn
+	resourceMgr             *ResourceManager
+	instanceService         *handlers_ec2_instance.InstanceServiceImpl
+	keyService              *handlers_ec2_key.KeyServiceImpl
+	launchTemplateService   *handlers_ec2_launchtemplate.LaunchTemplateServiceImpl
+	imageService            *handlers_ec2_image.ImageServiceImpl
+	volumeService           *handlers_ec2_volume.VolumeServiceImpl
+	accountService          *handlers_ec2_account.AccountSettingsServiceImpl
+	snapshotService         *handlers_ec2_snapshot.SnapshotServiceImpl
+	tagsService             *handlers_ec2_tags.TagsServiceImpl
+	eigwService             *handlers_ec2_eigw.EgressOnlyIGWServiceImpl
+	igwService              *handlers_ec2_igw.IGWServiceImpl
+	placementGroupService   *handlers_ec2_placementgroup.PlacementGroupServiceImpl
+	instanceEventService    *handlers_ec2_instanceevent.InstanceEventServiceImpl
+	instanceScheduleService *handlers_ec2_instanceschedule.InstanceScheduleServiceImpl
+	vpcService              *handlers_ec2_vpc.VPCServiceImpl
+	eipService              *handlers_ec2_eip.EIPServiceImpl
+	elbv2Service            *handlers_elbv2.ELBv2ServiceImpl
+	autoScalingService      *handlers_autoscaling.AutoScalingServiceImpl
+	routeTableService       *handlers_ec2_routetable.RouteTableServiceImpl
+	natGatewayService       *handlers_ec2_natgw.NatGatewayServiceImpl
+	externalIPAM            *handlers_ec2_vpc.ExternalIPAM
+	ctx                     context.Context
+	cancel                  context.CancelFunc
+	shutdownWg              sync.WaitGroup
 
 	// Local VM Instances
 	Instances vm.Instances
@@ -142,6 +166,15 @@ type Daemon struct {
 	startTime     time.Time
 	configPath    string
 
+	// Instance metadata service, when daemon.imds_listen is set
+	imdsServer *http.Server
+
+	// Prometheus metrics endpoint, when daemon.metrics_listen is set
+	metricsServer *http.Server
+
+	// Flushes and stops the trace exporter, when tracing.endpoint is set
+	tracingShutdown func(context.Context) error
+
 	// System credentials for ALB agent SigV4 auth (loaded from system-credentials.json)
 	systemAccessKey string
 	systemSecretKey string
@@ -149,15 +182,35 @@ type Daemon struct {
 	// JetStream manager for KV state storage (nil if JetStream disabled)
 	jsManager *JetStreamManager
 
+	// Object store of the Predastore bucket, set when services are created
+	// from the node's object_store config
+	objectStore objectstore.ObjectStore
+
 	// Delay after QMP device_del before blockdev-del (default 1s, 0 in tests)
 	detachDelay time.Duration
 
 	// NATS connect retry options (nil uses defaults: 5min max, 500ms initial delay)
 	natsRetryOpts []utils.RetryOption
 
+	// natsToken is the token the NATS connection presents when it
+	// reconnects, swapped by a config reload that rotates it.
+	natsToken atomic.Pointer[string]
+
+	// reloadMu serializes config reloads.
+	reloadMu sync.Mutex
+
 	// NetworkPlumber handles tap device lifecycle for VPC networking
 	networkPlumber NetworkPlumber
 
+	// sriov hands out the host's SR-IOV virtual functions; nil when none
+	// are configured. vfPlumber configures them for instances.
+	sriov     *sriovPool
+	vfPlumber VFPlumber
+
+	// metadataFirewall blocks the metadata service for instances with
+	// their metadata endpoint disabled
+	metadataFirewall MetadataFirewall
+
 	// Management NIC infrastructure: bridge IP + IP allocator for system instances.
 	// Populated at startup when br-mgmt is detected; nil/empty otherwise.
 	mgmtBridgeIP    string
@@ -171,6 +224,39 @@ type Daemon struct {
 	// crash handlers bail out, and setupShutdown skips redundant VM stops.
 	shuttingDown atomic.Bool
 
+	// draining is set once the node starts draining, on SIGTERM or a drain
+	// request. drainOnce runs the drain a single time and drainResult holds
+	// its outcome for every caller.
+	draining    atomic.Bool
+	drainOnce   sync.Once
+	drainResult *NodeDrainResponse
+
+	// exitCh is closed when a drain request asks the daemon to exit.
+	exitCh   chan struct{}
+	exitOnce sync.Once
+
+	// registry tracks every node's heartbeats to list hosts and notice the
+	// nodes that stop sending them.
+	registry *nodeRegistry
+
+	// rebooting holds the IDs of instances whose reboot is waiting for the
+	// guest to shut down.
+	rebooting sync.Map
+
+	// imageBuilds holds the IDs of instances CreateImage is imaging.
+	imageBuilds sync.Map
+
+	// agentProbes holds the IDs of instances whose guest agent the
+	// heartbeat is waiting on.
+	agentProbes sync.Map
+
+	// metrics holds the CloudWatch metric samples of this node's instances.
+	metrics instanceMetrics
+
+	// launchPool bounds how many RunInstances and start requests the node
+	// processes at once.
+	launchPool *workerPool
+
 	// ready is set to true once NATS connection, JetStream, and all services
 	// are fully initialized. The health endpoint reports "starting" until ready.
 	ready atomic.Bool
@@ -260,13 +346,23 @@ func NewResourceManager() (*ResourceManager, error) {
 		"schedulableVCPU", numCPU-reservedVCPU, "schedulableMemGB", totalMemGB-reservedMem,
 		"instanceTypes", len(instanceTypes))
 
-	return &ResourceManager{
+	rm := &ResourceManager{
 		hostVCPU:      numCPU,
 		hostMemGB:     totalMemGB,
 		reservedVCPU:  reservedVCPU,
 		reservedMem:   reservedMem,
 		instanceTypes: instanceTypes,
-	}, nil
+	}
+
+	// NUMA pinning only matters with more than one node to choose from.
+	nodes, err := detectNUMATopology()
+	if err != nil {
+		slog.Warn("Failed to detect NUMA topology, instances will not be pinned", "err", err)
+	} else if len(nodes) > 1 {
+		rm.numa = newNUMATopology(nodes, reservedVCPU, reservedMem)
+		slog.Info("NUMA topology detected", "nodes", len(nodes))
+	}
+	return rm, nil
 }
 
 // instanceTypeVCPUs returns the default vCPU count for an instance type, or 0 if unavailable.
@@ -300,13 +396,53 @@ func (rm *ResourceManager) GetInstanceTypeInfos() []*ec2.InstanceTypeInfo {
 	return infos
 }
 
+// availableTypesTTL is how long GetAvailableInstanceTypeInfos reuses the
+// type list for polling clients. Admission checks live capacity, so a list
+// a few seconds behind the allocations is harmless.
+const availableTypesTTL = 5 * time.Second
+
 // GetAvailableInstanceTypeInfos returns instance types based on total host capacity.
 // If showCapacity is true, it returns multiple entries representing available slots.
-// If showCapacity is false, it returns each supported type only once.
+// If showCapacity is false, it returns each supported type only once, from a
+// short-lived cache.
 func (rm *ResourceManager) GetAvailableInstanceTypeInfos(showCapacity bool) []*ec2.InstanceTypeInfo {
+	// The capacity view lists one entry per free slot, so it is always
+	// computed from the live allocation.
+	if showCapacity {
+		rm.mu.RLock()
+		defer rm.mu.RUnlock()
+		return rm.availableInstanceTypeInfos(true)
+	}
+
 	rm.mu.RLock()
-	defer rm.mu.RUnlock()
+	if utils.Now().Before(rm.availableTypesExpiry) {
+		infos := slices.Clone(rm.availableTypes)
+		rm.mu.RUnlock()
+		return infos
+	}
+	rm.mu.RUnlock()
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	infos := rm.availableInstanceTypeInfos(false)
+	rm.availableTypes = infos
+	rm.availableTypesExpiry = utils.Now().Add(availableTypesTTL)
+	return slices.Clone(infos)
+}
+
+// invalidateAvailableTypes drops the cached type list. instanceTypes and the
+// reserve are set when the resource manager is created; whatever changes
+// them afterwards, such as a config reload, must call it.
+func (rm *ResourceManager) invalidateAvailableTypes() {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.availableTypes = nil
+	rm.availableTypesExpiry = time.Time{}
+}
 
+// availableInstanceTypeInfos computes GetAvailableInstanceTypeInfos.
+// Callers must hold rm.mu.
+func (rm *ResourceManager) availableInstanceTypeInfos(showCapacity bool) []*ec2.InstanceTypeInfo {
 	var infos []*ec2.InstanceTypeInfo
 
 	for name, it := range rm.instanceTypes {
@@ -369,6 +505,9 @@ func (rm *ResourceManager) GetResourceStats() (totalVCPU int, totalMemGB float64
 			"remainingVCPU", remainingVCPU, "remainingMem", remainingMem)
 	}
 
+	if rm.cordoned {
+		return totalVCPU, totalMemGB, reservedVCPU, reservedMemGB, allocVCPU, allocMemGB, nil
+	}
 	for name, it := range rm.instanceTypes {
 		if instancetypes.IsSystemType(name) {
 			continue
@@ -414,11 +553,34 @@ func NewDaemon(cfg *config.ClusterConfig) (*Daemon, error) {
 		cancel:            cancel,
 		Instances:         vm.Instances{VMS: make(map[string]*vm.VM)},
 		natsSubscriptions: make(map[string]*nats.Subscription),
-		startTime:         time.Now(),
+		startTime:         utils.Now(),
 		detachDelay:       1 * time.Second,
+		launchPool:        newWorkerPool(config.Daemon.LaunchWorkerCount(), rejectLaunch),
+		exitCh:            make(chan struct{}),
+		registry:          newNodeRegistry(),
 	}, nil
 }
 
+// launchDrainTimeout bounds how long shutdown waits for in-flight launches
+// before stopping instances.
+const launchDrainTimeout = 60 * time.Second
+
+// rejectLaunch answers a launch request still queued when the node shuts down.
+func rejectLaunch(msg *nats.Msg) {
+	respondWithServiceError(msg, awserrors.WithDetail(awserrors.ErrorInsufficientInstanceCapacity, "node is shutting down"))
+}
+
+// drainLaunches stops taking launch requests and waits for the ones in
+// flight, so shutdown stops the instances they start.
+func (d *Daemon) drainLaunches() {
+	if d.launchPool == nil {
+		return
+	}
+	if !d.launchPool.drain(launchDrainTimeout) {
+		slog.Warn("Timed out waiting for in-flight launches", "timeout", launchDrainTimeout)
+	}
+}
+
 // natsSub defines a single NATS subscription entry for the table-driven setup.
 type natsSub struct {
 	topic      string
@@ -435,6 +597,12 @@ func (d *Daemon) subscribeAll() error {
 		{"ec2.DeleteKeyPair", d.handleEC2DeleteKeyPair, "spinifex-workers"},
 		{"ec2.DescribeKeyPairs", d.handleEC2DescribeKeyPairs, "spinifex-workers"},
 		{"ec2.ImportKeyPair", d.handleEC2ImportKeyPair, "spinifex-workers"},
+		{"ec2.CreateLaunchTemplate", d.handleEC2CreateLaunchTemplate, "spinifex-workers"},
+		{"ec2.CreateLaunchTemplateVersion", d.handleEC2CreateLaunchTemplateVersion, "spinifex-workers"},
+		{"ec2.ModifyLaunchTemplate", d.handleEC2ModifyLaunchTemplate, "spinifex-workers"},
+		{"ec2.DeleteLaunchTemplate", d.handleEC2DeleteLaunchTemplate, "spinifex-workers"},
+		{"ec2.DescribeLaunchTemplates", d.handleEC2DescribeLaunchTemplates, "spinifex-workers"},
+		{"ec2.DescribeLaunchTemplateVersions", d.handleEC2DescribeLaunchTemplateVersions, "spinifex-workers"},
 		{"ec2.DescribeImages", d.handleEC2DescribeImages, "spinifex-workers"},
 		{"ec2.CreateImage", d.handleEC2CreateImage, ""},
 		{"ec2.DeregisterImage", d.handleEC2DeregisterImage, "spinifex-workers"},
@@ -449,13 +617,21 @@ func (d *Daemon) subscribeAll() error {
 		{"ec2.DeleteVolume", d.handleEC2DeleteVolume, "spinifex-workers"},
 		{"ec2.DescribeVolumeStatus", d.handleEC2DescribeVolumeStatus, "spinifex-workers"},
 		{"ec2.DescribeVolumesModifications", d.handleEC2DescribeVolumesModifications, "spinifex-workers"},
+		{"ec2.ImportVolume", d.handleEC2ImportVolume, "spinifex-workers"},
+		{"ec2.ImportSnapshot", d.handleEC2ImportSnapshot, "spinifex-workers"},
+		{"ec2.DescribeConversionTasks", d.handleEC2DescribeConversionTasks, "spinifex-workers"},
+		{"ec2.DescribeImportSnapshotTasks", d.handleEC2DescribeImportSnapshotTasks, "spinifex-workers"},
 		{"ec2.CreateSnapshot", d.handleEC2CreateSnapshot, "spinifex-workers"},
 		{"ec2.DescribeSnapshots", d.handleEC2DescribeSnapshots, "spinifex-workers"},
 		{"ec2.DeleteSnapshot", d.handleEC2DeleteSnapshot, "spinifex-workers"},
 		{"ec2.CopySnapshot", d.handleEC2CopySnapshot, "spinifex-workers"},
+		{"ec2.DescribeSnapshotTree", d.handleEC2DescribeSnapshotTree, "spinifex-workers"},
+		{"ec2.CreateSnapshotsByTag", d.handleEC2CreateSnapshotsByTag, "spinifex-workers"},
 		{"ec2.CreateTags", d.handleEC2CreateTags, "spinifex-workers"},
 		{"ec2.DeleteTags", d.handleEC2DeleteTags, "spinifex-workers"},
 		{"ec2.DescribeTags", d.handleEC2DescribeTags, "spinifex-workers"},
+		{"ec2.BatchCreateTags", d.handleEC2BatchCreateTags, "spinifex-workers"},
+		{"ec2.BatchDeleteTags", d.handleEC2BatchDeleteTags, "spinifex-workers"},
 		{"ec2.CreateEgressOnlyInternetGateway", d.handleEC2CreateEgressOnlyInternetGateway, "spinifex-workers"},
 		{"ec2.DeleteEgressOnlyInternetGateway", d.handleEC2DeleteEgressOnlyInternetGateway, "spinifex-workers"},
 		{"ec2.DescribeEgressOnlyInternetGateways", d.handleEC2DescribeEgressOnlyInternetGateways, "spinifex-workers"},
@@ -473,6 +649,13 @@ func (d *Daemon) subscribeAll() error {
 		{"ec2.RemoveInstanceFromPlacementGroup", d.handleEC2RemoveInstanceFromPlacementGroup, "spinifex-workers"},
 		{"ec2.ReserveClusterNode", d.handleEC2ReserveClusterNode, "spinifex-workers"},
 		{"ec2.FinalizeClusterInstances", d.handleEC2FinalizeClusterInstances, "spinifex-workers"},
+		// Fan-out: only the node running the instance responds
+		{"ec2.ScheduleInstanceEvent", d.handleEC2ScheduleInstanceEvent, ""},
+		{"ec2.DescribeInstanceEvents", d.handleEC2DescribeInstanceEvents, "spinifex-workers"},
+		{"ec2.ModifyInstanceEventStartTime", d.handleEC2ModifyInstanceEventStartTime, "spinifex-workers"},
+		{"ec2.CreateInstanceSchedule", d.handleEC2CreateInstanceSchedule, "spinifex-workers"},
+		{"ec2.DescribeInstanceSchedules", d.handleEC2DescribeInstanceSchedules, "spinifex-workers"},
+		{"ec2.DeleteInstanceSchedule", d.handleEC2DeleteInstanceSchedule, "spinifex-workers"},
 		{"ec2.CreateNatGateway", d.handleEC2CreateNatGateway, "spinifex-workers"},
 		{"ec2.DeleteNatGateway", d.handleEC2DeleteNatGateway, "spinifex-workers"},
 		{"ec2.DescribeNatGateways", d.handleEC2DescribeNatGateways, "spinifex-workers"},
@@ -494,6 +677,10 @@ func (d *Daemon) subscribeAll() error {
 		{"ec2.ModifySubnetAttribute", d.handleEC2ModifySubnetAttribute, "spinifex-workers"},
 		{"ec2.ModifyVpcAttribute", d.handleEC2ModifyVpcAttribute, "spinifex-workers"},
 		{"ec2.DescribeVpcAttribute", d.handleEC2DescribeVpcAttribute, "spinifex-workers"},
+		{"ec2.CreateDhcpOptions", d.handleEC2CreateDhcpOptions, "spinifex-workers"},
+		{"ec2.DeleteDhcpOptions", d.handleEC2DeleteDhcpOptions, "spinifex-workers"},
+		{"ec2.DescribeDhcpOptions", d.handleEC2DescribeDhcpOptions, "spinifex-workers"},
+		{"ec2.AssociateDhcpOptions", d.handleEC2AssociateDhcpOptions, "spinifex-workers"},
 		{"ec2.CreateNetworkInterface", d.handleEC2CreateNetworkInterface, "spinifex-workers"},
 		{"ec2.DeleteNetworkInterface", d.handleEC2DeleteNetworkInterface, "spinifex-workers"},
 		{"ec2.DescribeNetworkInterfaces", d.handleEC2DescribeNetworkInterfaces, "spinifex-workers"},
@@ -507,19 +694,32 @@ func (d *Daemon) subscribeAll() error {
 		{"ec2.RevokeSecurityGroupEgress", d.handleEC2RevokeSecurityGroupEgress, "spinifex-workers"},
 		{"ec2.ModifyInstanceAttribute", d.handleEC2ModifyInstanceAttribute, "spinifex-workers"},
 		{"ec2.DescribeInstanceAttribute", d.handleEC2DescribeInstanceAttribute, "spinifex-workers"},
-		{"ec2.start", d.handleEC2StartStoppedInstance, "spinifex-workers"},
+		{"ec2.start", d.launchPool.handler(d.handleEC2StartStoppedInstance), "spinifex-workers"},
 		{"ec2.terminate", d.handleEC2TerminateStoppedInstance, "spinifex-workers"},
 		{"ec2.DescribeStoppedInstances", d.handleEC2DescribeStoppedInstances, "spinifex-workers"},
 		{"ec2.DescribeTerminatedInstances", d.handleEC2DescribeTerminatedInstances, "spinifex-workers"},
-		// these 2 fan out to all nodes and gateway aggregates the results
+		{"ec2.DescribeStoppedInstanceCreditSpecifications", d.handleEC2DescribeStoppedInstanceCreditSpecifications, "spinifex-workers"},
+		{"ec2.ModifyStoppedInstanceCreditSpecification", d.handleEC2ModifyStoppedInstanceCreditSpecification, "spinifex-workers"},
+		{"ec2.ModifyStoppedInstanceMetadataOptions", d.handleEC2ModifyStoppedInstanceMetadataOptions, "spinifex-workers"},
+		{"ec2.ModifyStoppedInstanceMaintenanceOptions", d.handleEC2ModifyStoppedInstanceMaintenanceOptions, "spinifex-workers"},
+		{"ec2.GetStoppedInstancePasswordData", d.handleEC2GetStoppedInstancePasswordData, "spinifex-workers"},
+		// these fan out to all nodes and gateway aggregates the results
 		{"ec2.DescribeInstances", d.handleEC2DescribeInstances, ""},
 		{"ec2.DescribeInstanceTypes", d.handleEC2DescribeInstanceTypes, ""},
+		{"ec2.GetInstanceTypesFromInstanceRequirements", d.handleEC2GetInstanceTypesFromInstanceRequirements, ""},
+		{"ec2.DescribeInstanceBootStatus", d.handleEC2DescribeInstanceBootStatus, ""},
+		{"cloudwatch.GetInstanceMetrics", d.handleCloudWatchGetInstanceMetrics, ""},
+		{"ec2.DescribeInstanceCreditSpecifications", d.handleEC2DescribeInstanceCreditSpecifications, ""},
+		{"ec2.ModifyInstanceCreditSpecification", d.handleEC2ModifyInstanceCreditSpecification, ""},
+		// fans out too, but only the node hosting the instance replies
+		{"ec2.PhoneHome", d.handleEC2PhoneHome, ""},
 		{"ec2.EnableEbsEncryptionByDefault", d.handleEC2EnableEbsEncryptionByDefault, "spinifex-workers"},
 		{"ec2.DisableEbsEncryptionByDefault", d.handleEC2DisableEbsEncryptionByDefault, "spinifex-workers"},
 		{"ec2.GetEbsEncryptionByDefault", d.handleEC2GetEbsEncryptionByDefault, "spinifex-workers"},
 		{"ec2.GetSerialConsoleAccessStatus", d.handleEC2GetSerialConsoleAccessStatus, "spinifex-workers"},
 		{"ec2.EnableSerialConsoleAccess", d.handleEC2EnableSerialConsoleAccess, "spinifex-workers"},
 		{"ec2.DisableSerialConsoleAccess", d.handleEC2DisableSerialConsoleAccess, "spinifex-workers"},
+		{"ec2.DescribeAccountQuotas", d.handleEC2DescribeAccountQuotas, "spinifex-workers"},
 		// ELBv2 operations
 		{"elbv2.CreateLoadBalancer", d.handleELBv2CreateLoadBalancer, "spinifex-workers"},
 		{"elbv2.DeleteLoadBalancer", d.handleELBv2DeleteLoadBalancer, "spinifex-workers"},
@@ -540,9 +740,22 @@ func (d *Daemon) subscribeAll() error {
 		{"elbv2.DescribeTargetGroupAttributes", d.handleELBv2DescribeTargetGroupAttributes, "spinifex-workers"},
 		{"elbv2.ModifyLoadBalancerAttributes", d.handleELBv2ModifyLoadBalancerAttributes, "spinifex-workers"},
 		{"elbv2.DescribeLoadBalancerAttributes", d.handleELBv2DescribeLoadBalancerAttributes, "spinifex-workers"},
-		{fmt.Sprintf("spinifex.admin.%s.health", d.node), d.handleHealthCheck, ""},
+		{"autoscaling.CreateAutoScalingGroup", d.handleAutoScalingCreateAutoScalingGroup, "spinifex-workers"},
+		{"autoscaling.UpdateAutoScalingGroup", d.handleAutoScalingUpdateAutoScalingGroup, "spinifex-workers"},
+		{"autoscaling.SetDesiredCapacity", d.handleAutoScalingSetDesiredCapacity, "spinifex-workers"},
+		{"autoscaling.DeleteAutoScalingGroup", d.handleAutoScalingDeleteAutoScalingGroup, "spinifex-workers"},
+		{"autoscaling.DescribeAutoScalingGroups", d.handleAutoScalingDescribeAutoScalingGroups, "spinifex-workers"},
+		{subjects.NodeHealth(d.node), d.handleHealthCheck, ""},
+		{subjects.ReclaimCapacity(d.node), d.handleReclaimCapacity, ""},
+		{subjects.NodeDrain(d.node), d.handleNodeDrain, ""},
 		{"spinifex.nodes.discover", d.handleNodeDiscover, ""},
-		{"spinifex.node.status", d.handleNodeStatus, ""},
+		{subjects.NodeHeartbeat, d.handleNodeHeartbeat, ""},
+		{subjects.DescribeHosts, d.handleDescribeHosts, "spinifex-workers"},
+		{subjects.ConfigReload, d.handleConfigReload, ""},
+		{subjects.ForceTerminate, d.handleForceTerminate, "spinifex-workers"},
+		{subjects.StateExport, d.handleStateExport, "spinifex-workers"},
+		{subjects.StateImport, d.handleStateImport, "spinifex-workers"},
+		{subjects.NodeStatus, d.handleNodeStatus, ""},
 		{"spinifex.node.vms", d.handleNodeVMs, ""},
 		{"spinifex.storage.config", d.handleStorageConfig, ""},
 		// Account creation → create default VPC for new account
@@ -572,9 +785,9 @@ func (d *Daemon) subscribeAll() error {
 		var sub *nats.Subscription
 		var err error
 		if s.queueGroup != "" {
-			sub, err = d.natsConn.QueueSubscribe(s.topic, s.queueGroup, s.handler)
+			sub, err = d.natsConn.QueueSubscribe(utils.Subject(s.topic), s.queueGroup, timeNATSHandler(s.topic, s.handler))
 		} else {
-			sub, err = d.natsConn.Subscribe(s.topic, s.handler)
+			sub, err = d.natsConn.Subscribe(utils.Subject(s.topic), timeNATSHandler(s.topic, s.handler))
 		}
 		if err != nil {
 			return fmt.Errorf("failed to subscribe to %s: %w", s.topic, err)
@@ -587,6 +800,14 @@ func (d *Daemon) subscribeAll() error {
 
 // Start initializes and starts the daemon
 func (d *Daemon) Start() error {
+	slog.SetLogLoggerLevel(d.config.Daemon.SlogLevel())
+
+	tracingShutdown, err := tracing.Init("spinifex-daemon", d.node, d.config.Tracing)
+	if err != nil {
+		return fmt.Errorf("failed to initialize tracing: %w", err)
+	}
+	d.tracingShutdown = tracingShutdown
+
 	if err := d.connectNATS(); err != nil {
 		return fmt.Errorf("failed to connect to NATS: %w", err)
 	}
@@ -597,6 +818,14 @@ func (d *Daemon) Start() error {
 		return fmt.Errorf("failed to start cluster manager: %w", err)
 	}
 
+	if err := d.startIMDS(); err != nil {
+		return fmt.Errorf("failed to start instance metadata service: %w", err)
+	}
+
+	if err := d.startMetricsServer(); err != nil {
+		return fmt.Errorf("failed to start metrics endpoint: %w", err)
+	}
+
 	if err := d.initJetStream(); err != nil {
 		return fmt.Errorf("failed to initialize JetStream: %w", err)
 	}
@@ -614,17 +843,27 @@ func (d *Daemon) Start() error {
 	}
 
 	// Create services before loading/launching instances, since LaunchInstance depends on them
-	store := objectstore.NewS3ObjectStoreFromConfig(admin.DialTarget(d.config.Predastore.Host), d.config.Predastore.Region, d.config.Predastore.AccessKey, d.config.Predastore.SecretKey)
+	storeCfg := d.config.ObjectStore
+	if storeCfg.Backend == "" {
+		storeCfg = d.config.Predastore.ObjectStore()
+		storeCfg.Endpoint = admin.DialTarget(storeCfg.Endpoint)
+	}
+	store, err := objectstore.New(storeCfg)
+	if err != nil {
+		return fmt.Errorf("failed to create object store: %w", err)
+	}
+	d.objectStore = store
 	d.instanceService = handlers_ec2_instance.NewInstanceServiceImpl(d.config, d.resourceMgr.instanceTypes, d.natsConn, &d.Instances, store)
-	d.keyService = handlers_ec2_key.NewKeyServiceImpl(d.config)
-	d.imageService = handlers_ec2_image.NewImageServiceImpl(d.config, d.natsConn)
+	d.keyService = handlers_ec2_key.NewKeyServiceImpl(d.config, store)
+	d.launchTemplateService = handlers_ec2_launchtemplate.NewLaunchTemplateServiceImpl(store, d.config.Predastore.Bucket)
+	d.imageService = handlers_ec2_image.NewImageServiceImpl(d.config, d.natsConn, store)
 
 	type snapResult struct {
 		svc *handlers_ec2_snapshot.SnapshotServiceImpl
 		kv  nats.KeyValue
 	}
 	snap, err := initServiceWithRetry("snapshot service", func() (snapResult, error) {
-		svc, kv, err := handlers_ec2_snapshot.NewSnapshotServiceImplWithNATS(d.config, d.natsConn)
+		svc, kv, err := handlers_ec2_snapshot.NewSnapshotServiceImplWithNATS(d.config, d.natsConn, store)
 		return snapResult{svc, kv}, err
 	})
 	if err != nil {
@@ -632,8 +871,10 @@ func (d *Daemon) Start() error {
 	}
 	d.snapshotService = snap.svc
 
-	d.volumeService = handlers_ec2_volume.NewVolumeServiceImpl(d.config, d.natsConn, snap.kv)
-	d.tagsService = handlers_ec2_tags.NewTagsServiceImpl(d.config)
+	d.volumeService = handlers_ec2_volume.NewVolumeServiceImpl(d.config, d.natsConn, store, snap.kv, d.openKMSStore())
+	d.tagsService = handlers_ec2_tags.NewTagsServiceImpl(d.config, store)
+	d.tagsService.SetVolumeTagWriter(d.volumeService.SetVolumeTags)
+	d.tagsService.SetResourceLookup(d.lookupTaggedResource)
 
 	d.eigwService, err = initServiceWithRetry("EIGW service", func() (*handlers_ec2_eigw.EgressOnlyIGWServiceImpl, error) {
 		return handlers_ec2_eigw.NewEgressOnlyIGWServiceImplWithNATS(d.config, d.natsConn)
@@ -656,6 +897,28 @@ func (d *Daemon) Start() error {
 		return fmt.Errorf("failed to initialize placement group service: %w", err)
 	}
 
+	d.instanceEventService, err = initServiceWithRetry("instance event service", func() (*handlers_ec2_instanceevent.InstanceEventServiceImpl, error) {
+		return handlers_ec2_instanceevent.NewInstanceEventServiceImplWithNATS(d.config, d.natsConn)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to initialize instance event service: %w", err)
+	}
+
+	d.instanceScheduleService, err = initServiceWithRetry("instance schedule service", func() (*handlers_ec2_instanceschedule.InstanceScheduleServiceImpl, error) {
+		return handlers_ec2_instanceschedule.NewInstanceScheduleServiceImplWithNATS(d.config, d.natsConn)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to initialize instance schedule service: %w", err)
+	}
+
+	d.autoScalingService, err = initServiceWithRetry("Auto Scaling service", func() (*handlers_autoscaling.AutoScalingServiceImpl, error) {
+		return handlers_autoscaling.NewAutoScalingServiceImplWithNATS(d.config, d.natsConn)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to initialize Auto Scaling service: %w", err)
+	}
+	d.autoScalingService.LaunchTemplates = d.launchTemplateService
+
 	d.vpcService, err = initServiceWithRetry("VPC service", func() (*handlers_ec2_vpc.VPCServiceImpl, error) {
 		return handlers_ec2_vpc.NewVPCServiceImplWithNATS(d.config, d.natsConn)
 	})
@@ -843,6 +1106,21 @@ func (d *Daemon) Start() error {
 	if d.networkPlumber == nil {
 		d.networkPlumber = &OVSNetworkPlumber{}
 	}
+	if d.metadataFirewall == nil {
+		d.metadataFirewall = &NFTMetadataFirewall{}
+	}
+	if interfaces := d.config.Daemon.SRIOV.Interfaces; d.sriov == nil && len(interfaces) > 0 {
+		vfs, err := detectSRIOVVFs(interfaces)
+		if err != nil {
+			slog.Warn("Failed to detect SR-IOV virtual functions, instances will use taps", "interfaces", interfaces, "err", err)
+		} else {
+			d.sriov = newSRIOVPool(vfs)
+			slog.Info("SR-IOV virtual functions detected", "interfaces", interfaces, "vfs", len(vfs))
+		}
+	}
+	if d.vfPlumber == nil {
+		d.vfPlumber = &IPLinkVFPlumber{}
+	}
 
 	// Protect daemon from OOM killer (prefer killing QEMU VMs instead)
 	if err := utils.SetOOMScore(os.Getpid(), -500); err != nil {
@@ -851,7 +1129,9 @@ func (d *Daemon) Start() error {
 
 	d.waitForClusterReady()
 	d.upgradeJetStreamReplicas()
-	d.restoreInstances()
+	if err := d.restoreInstances(); err != nil {
+		return fmt.Errorf("failed to restore instances: %w", err)
+	}
 
 	// Rebuild mgmt IP allocator from restored VMs so we don't re-allocate IPs
 	// that are already in use by running system instances.
@@ -869,15 +1149,23 @@ func (d *Daemon) Start() error {
 	// Initialize dynamic per-instance-type subscriptions for capacity-aware routing.
 	// Each instance type gets its own NATS topic (ec2.RunInstances.{type}) so requests
 	// are only routed to nodes with available capacity.
-	d.resourceMgr.initSubscriptions(d.natsConn, d.handleEC2RunInstances, d.node)
+	// Launches on every subject share the node's launch workers.
+	d.resourceMgr.initSubscriptions(d.natsConn, d.launchPool.handler(d.handleEC2RunInstances), d.node)
 
 	d.startHeartbeat()
 	d.startPendingWatchdog()
+	d.startInstanceEventScheduler()
+	d.startInstanceScheduler()
+	d.startInterruptionScheduler()
+	d.startAutoScaling()
+	d.startCPUCreditAccounting()
+	d.startMetricsCollection()
 
 	d.ready.Store(true)
 	slog.Info("Daemon fully initialized", "node", d.node, "startupTime", time.Since(d.startTime).Round(time.Second))
 
 	d.setupShutdown()
+	d.setupReload()
 	d.awaitShutdown()
 
 	return nil
@@ -888,7 +1176,11 @@ func (d *Daemon) Start() error {
 // be ready immediately after daemon start (e.g. if start-dev.sh is still
 // launching services). This retries for up to 5 minutes before giving up.
 func (d *Daemon) connectNATS() error {
-	nc, err := utils.ConnectNATSWithRetry(admin.DialTarget(d.config.NATS.Host), d.config.NATS.ACL.Token, d.config.NATS.CACert, d.natsRetryOpts...)
+	utils.SetSubjectPrefix(d.config.NATS.SubjectPrefix)
+	token := d.config.NATS.ACL.Token
+	d.natsToken.Store(&token)
+	opts := append([]utils.RetryOption{utils.WithTokenSource(d.natsTokenSource)}, d.natsRetryOpts...)
+	nc, err := utils.ConnectNATSWithRetry(admin.DialTarget(d.config.NATS.Host), token, d.config.NATS.CACert, opts...)
 	if err != nil {
 		return err
 	}
@@ -922,6 +1214,14 @@ func (d *Daemon) initJetStream() error {
 			err = d.jsManager.InitTerminatedInstanceBucket()
 		}
 
+		if err == nil {
+			err = d.jsManager.InitEventStream()
+		}
+
+		if err == nil {
+			err = d.jsManager.InitMetricsStream()
+		}
+
 		if err == nil {
 			slog.Info("JetStream KV stores initialized successfully", "replicas", 1, "attempts", attempt, "elapsed", time.Since(start).Round(time.Second))
 			break
@@ -1061,7 +1361,7 @@ func (d *Daemon) migrateInstanceToKV(instance *vm.VM, writeFn func(string, *vm.V
 			"instance", instance.ID, "bucket", label, "err", err)
 		return false
 	}
-	delete(d.Instances.VMS, instance.ID)
+	d.Instances.DeleteVM(instance.ID)
 	slog.Info("Migrated instance to KV", "instance", instance.ID, "bucket", label)
 	return true
 }
@@ -1078,8 +1378,10 @@ func (d *Daemon) migrateTerminatedToKV(instance *vm.VM) bool {
 const maxConcurrentRecovery = 2
 
 // restoreInstances loads persisted VM state and re-launches instances that are
-// neither terminated nor flagged as user-stopped.
-func (d *Daemon) restoreInstances() {
+// neither terminated nor flagged as user-stopped. When they no longer fit the
+// host, the boot oversubscription policy either stops the lowest-priority
+// ones or fails the restore, before any instance is touched.
+func (d *Daemon) restoreInstances() error {
 	// Check for clean shutdown marker
 	cleanShutdown := false
 	if d.jsManager != nil {
@@ -1100,22 +1402,34 @@ func (d *Daemon) restoreInstances() {
 	err := d.LoadState()
 	if err != nil {
 		slog.Warn("Failed to load state, continuing with empty state", "error", err)
-		return
+		return nil
 	}
 
-	slog.Info("Loaded state", "instance count", len(d.Instances.VMS))
+	// The state just loaded no longer holds the instances rescheduled off
+	// this node while it was lost, so it can rejoin.
+	if fenced, err := d.jsManager.ReadFenceMarker(d.node); err == nil && fenced {
+		slog.Warn("Node was fenced while lost, lifting the fence on restart")
+		if err := d.jsManager.DeleteFenceMarker(d.node); err != nil {
+			slog.Error("Failed to lift fence", "err", err)
+		}
+	}
 
 	// Ensure mutexes and QMP clients are usable after deserialization
 	d.Instances.Mu = sync.Mutex{}
 
+	slog.Info("Loaded state", "instance count", d.Instances.Len())
+
+	evict, err := d.checkBootCapacity(d.Instances.ListVMs())
+	if err != nil {
+		return err
+	}
+
 	// Phase 1: Reconnect running QEMU, finalize transitional states, collect VMs to relaunch
 	var toLaunch []*vm.VM
 
-	for i := range d.Instances.VMS {
-		d.Instances.VMS[i].EBSRequests.Mu = sync.Mutex{}
-		d.Instances.VMS[i].QMPClient = &qmp.QMPClient{}
-
-		instance := d.Instances.VMS[i]
+	for _, instance := range d.Instances.ListVMs() {
+		instance.EBSRequests.Mu = sync.Mutex{}
+		instance.QMPClient = &qmp.QMPClient{}
 
 		if instance.Status == vm.StateTerminated {
 			if !d.migrateTerminatedToKV(instance) {
@@ -1138,14 +1452,14 @@ func (d *Daemon) restoreInstances() {
 		if !ok && instance.InstanceType != "" {
 			slog.Warn("Instance type not available on this node, moving to stopped",
 				"instanceId", instance.ID, "instanceType", instance.InstanceType)
-			instance.Status = vm.StateStopped
-			if instance.Instance != nil {
-				instance.Instance.StateReason = &ec2.StateReason{}
-				instance.Instance.StateReason.SetCode("Server.InsufficientInstanceCapacity")
-				instance.Instance.StateReason.SetMessage(
-					fmt.Sprintf("instance type %s is not available on this node", instance.InstanceType))
-			}
-			d.migrateStoppedToSharedKV(instance)
+			d.stopRestoredInstance(instance, fmt.Sprintf("instance type %s is not available on this node", instance.InstanceType))
+			continue
+		}
+
+		if evict[instance.ID] {
+			slog.Warn("Insufficient host capacity to restore instance, moving to stopped",
+				"instanceId", instance.ID, "bootPriority", instance.BootPriority())
+			d.stopRestoredInstance(instance, "insufficient host capacity to restore instance; higher-priority instances were restored first")
 			continue
 		}
 
@@ -1154,14 +1468,7 @@ func (d *Daemon) restoreInstances() {
 			if err := d.resourceMgr.allocate(instanceType); err != nil {
 				slog.Error("Failed to re-allocate resources for instance on startup, moving to stopped",
 					"instanceId", instance.ID, "err", err)
-				instance.Status = vm.StateStopped
-				if instance.Instance != nil {
-					instance.Instance.StateReason = &ec2.StateReason{}
-					instance.Instance.StateReason.SetCode("Server.InsufficientInstanceCapacity")
-					instance.Instance.StateReason.SetMessage(
-						fmt.Sprintf("insufficient resources to restore instance: %v", err))
-				}
-				d.migrateStoppedToSharedKV(instance)
+				d.stopRestoredInstance(instance, fmt.Sprintf("insufficient resources to restore instance: %v", err))
 				continue
 			}
 		}
@@ -1221,6 +1528,9 @@ func (d *Daemon) restoreInstances() {
 				continue
 			}
 
+			if instance.Status == vm.StateTerminated {
+				d.runPostTerminateHooks(instance)
+			}
 			if instance.Status == vm.StateTerminated && d.migrateTerminatedToKV(instance) {
 				continue
 			}
@@ -1240,7 +1550,7 @@ func (d *Daemon) restoreInstances() {
 		// Reset LaunchTime so the pending watchdog gives a fresh timeout window.
 		// Without this, the stale LaunchTime from the original launch causes the
 		// watchdog to immediately mark the instance as failed after a prolonged outage.
-		now := time.Now()
+		now := utils.Now()
 		if instance.Instance != nil {
 			instance.Instance.LaunchTime = &now
 		}
@@ -1255,7 +1565,7 @@ func (d *Daemon) restoreInstances() {
 		// unreachable via ec2.cmd.<id> and TerminateInstances fails.
 		d.mu.Lock()
 		for _, instance := range toLaunch {
-			sub, subErr := d.natsConn.Subscribe(fmt.Sprintf("ec2.cmd.%s", instance.ID), d.handleEC2Events)
+			sub, subErr := d.natsConn.Subscribe(utils.Subject(subjects.InstanceCmd(instance.ID)), d.handleEC2Events)
 			if subErr != nil {
 				slog.Error("Failed to early-subscribe during recovery", "instanceId", instance.ID, "err", subErr)
 			} else {
@@ -1302,6 +1612,7 @@ func (d *Daemon) restoreInstances() {
 	if err := d.WriteState(); err != nil {
 		slog.Error("Failed to persist state after restore", "error", err)
 	}
+	return nil
 }
 
 // isInstanceProcessRunning checks if the QEMU process for an instance is still alive.
@@ -1322,10 +1633,7 @@ func (d *Daemon) isInstanceProcessRunning(instance *vm.VM) bool {
 // because viperblock may restart with sockets at the same paths — the file
 // exists but no process is listening on the old fd that QEMU holds.
 func (d *Daemon) areVolumeSocketsValid(instance *vm.VM) bool {
-	instance.EBSRequests.Mu.Lock()
-	defer instance.EBSRequests.Mu.Unlock()
-
-	for _, req := range instance.EBSRequests.Requests {
+	for _, req := range instance.SnapshotEBSRequests() {
 		if req.NBDURI == "" {
 			continue
 		}
@@ -1350,9 +1658,13 @@ func (d *Daemon) reconnectInstance(instance *vm.VM) error {
 	if err := d.CreateQMPClient(instance); err != nil {
 		return fmt.Errorf("failed to reconnect QMP: %w", err)
 	}
+	d.resourceMgr.restoreNUMA(instance.ID, instance.Config.NUMA, int64(instance.Config.Memory))
+	if instance.SRIOVVF != "" && d.sriov != nil && d.sriov.claim(instance.ENIId, instance.SRIOVVF) == nil {
+		slog.Warn("SR-IOV VF of running instance is no longer on the host", "instanceId", instance.ID, "pci", instance.SRIOVVF)
+	}
 
 	d.mu.Lock()
-	sub, err := d.natsConn.Subscribe(fmt.Sprintf("ec2.cmd.%s", instance.ID), d.handleEC2Events)
+	sub, err := d.natsConn.Subscribe(utils.Subject(subjects.InstanceCmd(instance.ID)), d.handleEC2Events)
 	if err != nil {
 		d.mu.Unlock()
 		if instance.QMPClient != nil && instance.QMPClient.Conn != nil {
@@ -1363,7 +1675,7 @@ func (d *Daemon) reconnectInstance(instance *vm.VM) error {
 	}
 	d.natsSubscriptions[instance.ID] = sub
 
-	consoleSub, err := d.natsConn.Subscribe(fmt.Sprintf("ec2.%s.GetConsoleOutput", instance.ID), d.handleEC2GetConsoleOutput)
+	consoleSub, err := d.natsConn.Subscribe(utils.Subject(subjects.ConsoleOutput(instance.ID)), d.handleEC2GetConsoleOutput)
 	if err != nil {
 		d.mu.Unlock()
 		return fmt.Errorf("failed to subscribe to console output NATS: %w", err)
@@ -1464,7 +1776,7 @@ func (d *Daemon) ClusterManager() error {
 			Status:        status,
 			ConfigHash:    configHash,
 			Epoch:         d.clusterConfig.Epoch,
-			Uptime:        int64(time.Since(d.startTime).Seconds()),
+			Uptime:        int64(utils.Now().Sub(d.startTime).Seconds()),
 			Services:      d.config.GetServices(),
 			ServiceHealth: serviceHealth,
 		}
@@ -1526,11 +1838,16 @@ func (d *Daemon) ClusterManager() error {
 }
 
 // WriteState writes the instance state to JetStream KV store (required).
-// It acquires d.Instances.Mu internally.
+// It acquires d.Instances.Mu and every VM's EBSRequests.Mu internally, so the
+// caller must hold neither.
 func (d *Daemon) WriteState() error {
 	if d.jsManager == nil {
 		return fmt.Errorf("JetStream manager not initialized - cannot write state")
 	}
+	if err := d.checkFence(); err != nil {
+		slog.Error("Refusing to write state", "err", err)
+		return err
+	}
 	if err := d.jsManager.WriteState(d.node, &d.Instances); err != nil {
 		slog.Error("JetStream write failed", "error", err)
 		return fmt.Errorf("failed to write state to JetStream: %w", err)
@@ -1555,7 +1872,15 @@ func (d *Daemon) LoadState() error {
 	return nil
 }
 
-func (d *Daemon) SendQMPCommand(q *qmp.QMPClient, cmd qmp.QMPCommand, instanceId string) (*qmp.QMPResponse, error) {
+func (d *Daemon) SendQMPCommand(q *qmp.QMPClient, cmd qmp.QMPCommand, instanceId string) (_ *qmp.QMPResponse, err error) {
+	_, span := tracing.StartInstance(instanceId, "qmp "+cmd.Execute, true, attribute.String("qmp.command", cmd.Execute))
+	defer func() {
+		if err != nil {
+			countQMPError(err)
+		}
+		tracing.End(span, err)
+	}()
+
 	// Confirm QMP client is initialized
 	if q == nil || q.Encoder == nil || q.Decoder == nil {
 		return nil, fmt.Errorf("QMP client is not initialized")
@@ -1581,11 +1906,13 @@ func (d *Daemon) SendQMPCommand(q *qmp.QMPClient, cmd qmp.QMPCommand, instanceId
 			return nil, fmt.Errorf("decode error: %w", err)
 		}
 
-		if _, ok := msg["event"]; ok {
+		if event, ok := msg["event"]; ok {
 			// QMP events are informational only — state transitions are driven
 			// by the command handlers that initiate the action, avoiding races
-			// between event-driven and command-driven transitions.
-			slog.Info("QMP event", "event", msg["event"], "instanceId", instanceId)
+			// between event-driven and command-driven transitions. The exception
+			// is WATCHDOG, which QEMU raises on its own when the guest hangs.
+			slog.Info("QMP event", "event", event, "instanceId", instanceId)
+			d.handleQMPEvent(instanceId, msg)
 			// Extend deadline after receiving an event (QEMU is alive, just chatty)
 			if err := q.Conn.SetReadDeadline(time.Now().Add(30 * time.Second)); err != nil {
 				return nil, fmt.Errorf("set read deadline: %w", err)
@@ -1593,7 +1920,9 @@ func (d *Daemon) SendQMPCommand(q *qmp.QMPClient, cmd qmp.QMPCommand, instanceId
 			continue
 		}
 		if errObj, ok := msg["error"].(map[string]any); ok {
-			return nil, fmt.Errorf("QMP error: %s: %s", errObj["class"], errObj["desc"])
+			class, _ := errObj["class"].(string)
+			desc, _ := errObj["desc"].(string)
+			return nil, &qmp.QMPError{Class: class, Desc: desc}
 		}
 		if _, ok := msg["return"]; ok {
 			respBytes, err := json.Marshal(msg)
@@ -1609,9 +1938,17 @@ func (d *Daemon) SendQMPCommand(q *qmp.QMPClient, cmd qmp.QMPCommand, instanceId
 	}
 }
 
-func (d *Daemon) stopInstance(instances map[string]*vm.VM, deleteVolume bool) error {
+// stopInstance shuts down the instances and releases their resources,
+// deleting volumes when terminating. Cleanup runs to completion for every
+// instance, and QEMU is down for all of them when it returns. What it
+// returns is only the volume teardown failures, joined: callers still
+// finish the instances' state transitions and report these separately, as
+// a volume left mounted or undeleted doesn't make the stop itself fail.
+func (d *Daemon) stopInstance(instances []*vm.VM, deleteVolume bool) error {
 	// Signal to shutdown each VM
 	var wg sync.WaitGroup
+	var teardownMu sync.Mutex
+	var teardownErrs []error
 
 	// Run asynchronously within a worker group
 	for _, instance := range instances {
@@ -1643,80 +1980,35 @@ func (d *Daemon) stopInstance(instances map[string]*vm.VM, deleteVolume bool) er
 				}
 			}
 
-			// Unmount all EBS volumes
-			instance.EBSRequests.Mu.Lock()
-			defer instance.EBSRequests.Mu.Unlock()
-
-			for _, ebsRequest := range instance.EBSRequests.Requests {
-				// Send the volume payload as JSON
-				ebsUnMountRequest, err := json.Marshal(ebsRequest)
-
-				if err != nil {
-					slog.Error("Failed to marshal volume payload", "err", err)
-					continue
-				}
-
-				msg, err := d.natsConn.Request(d.ebsTopic("unmount"), ebsUnMountRequest, 30*time.Second)
-				if err != nil {
-					slog.Error("Failed to unmount volume", "name", ebsRequest.Name, "id", instance.ID, "err", err)
-				} else {
-					slog.Info("Unmounted Viperblock volume", "id", instance.ID, "data", string(msg.Data))
-				}
-
-				// Update volume state to "available" for all user-visible volumes (boot + hot-attached)
-				if !ebsRequest.EFI && !ebsRequest.CloudInit {
-					if err := d.volumeService.UpdateVolumeState(ebsRequest.Name, "available", "", ""); err != nil {
-						slog.Error("Failed to update volume state to available", "volumeId", ebsRequest.Name, "err", err)
-					}
-				}
-			}
-
-			// If flagged for termination, clean up volumes
-			if deleteVolume {
-				for _, ebsRequest := range instance.EBSRequests.Requests {
-					// Internal volumes (EFI, cloud-init) are always cleaned up via ebs.delete
-					// to stop viperblockd processes. S3 data cleanup happens via DeleteVolume
-					// on the parent root volume (which deletes -efi/ and -cloudinit/ prefixes).
-					if ebsRequest.EFI || ebsRequest.CloudInit {
-						ebsDeleteData, err := json.Marshal(types.EBSDeleteRequest{Volume: ebsRequest.Name})
-						if err != nil {
-							slog.Error("Failed to marshal ebs.delete request for internal volume", "name", ebsRequest.Name, "err", err)
-							continue
-						}
-						deleteMsg, err := d.natsConn.Request("ebs.delete", ebsDeleteData, 30*time.Second)
-						if err != nil {
-							slog.Warn("Failed to send ebs.delete for internal volume", "name", ebsRequest.Name, "id", instance.ID, "err", err)
-						} else {
-							slog.Info("Sent ebs.delete for internal volume", "name", ebsRequest.Name, "id", instance.ID, "data", string(deleteMsg.Data))
-						}
-						continue
-					}
-
-					// User-visible volumes: respect DeleteOnTermination flag
-					if !ebsRequest.DeleteOnTermination {
-						slog.Info("Volume has DeleteOnTermination=false, skipping deletion", "name", ebsRequest.Name, "id", instance.ID)
-						continue
-					}
-
-					// DeleteVolume handles: NATS ebs.delete notification + S3 cleanup
-					// (including -efi/ and -cloudinit/ sub-prefixes)
-					slog.Info("Deleting volume with DeleteOnTermination=true", "name", ebsRequest.Name, "id", instance.ID)
-					_, err := d.volumeService.DeleteVolume(&ec2.DeleteVolumeInput{
-						VolumeId: &ebsRequest.Name,
-					}, instance.AccountID)
-					if err != nil {
-						slog.Error("Failed to delete volume on termination", "name", ebsRequest.Name, "id", instance.ID, "err", err)
-					} else {
-						slog.Info("Deleted volume on termination", "name", ebsRequest.Name, "id", instance.ID)
-					}
-				}
+			// The QEMU process is gone, so its cgroup is empty and its
+			// NUMA node CPUs are free.
+			removeInstanceCgroup(instance.ID)
+			d.resourceMgr.releaseNUMA(instance.ID)
+
+			// Release the instance's volumes. teardownVolumes returns only once
+			// every unmount and delete has been answered, so the volumes are
+			// free by the time stopInstance returns. Failures are reported
+			// after the rest of the cleanup has run.
+			if err := d.teardownVolumes(instance, deleteVolume); err != nil {
+				slog.Error("Volume teardown failed", "id", instance.ID, "err", err)
+				teardownMu.Lock()
+				teardownErrs = append(teardownErrs, fmt.Errorf("instance %s: %w", instance.ID, err))
+				teardownMu.Unlock()
 			}
 
-			// Clean up VPC tap device if present
+			// Clean up VPC tap device or SR-IOV VF if present
 			if instance.ENIId != "" && d.networkPlumber != nil {
-				if err := d.networkPlumber.CleanupTapDevice(instance.ENIId); err != nil {
+				taps := metadataTaps(instance)
+				if instance.SRIOVVF != "" {
+					d.releasePrimaryVF(instance)
+				} else if err := d.networkPlumber.CleanupTapDevice(instance.ENIId); err != nil {
 					slog.Warn("Failed to clean up tap device", "eni", instance.ENIId, "err", err)
 				}
+				if metadataEndpointDisabled(instance) && d.metadataFirewall != nil {
+					if err := d.setMetadataFirewall(taps, false); err != nil {
+						slog.Warn("Failed to remove metadata firewall", "eni", instance.ENIId, "err", err)
+					}
+				}
 				// Clean up any extra ENI tap devices (multi-subnet ALB VMs).
 				d.cleanupExtraENITaps(instance)
 			}
@@ -1784,6 +2076,11 @@ func (d *Daemon) stopInstance(instances map[string]*vm.VM, deleteVolume bool) er
 				// DeleteLoadBalancer via its own lb.ENIs loop — the daemon
 				// doesn't duplicate that teardown here.
 			}
+			// Interfaces attached with AttachNetworkInterface outlive the
+			// instance, as on AWS.
+			if deleteVolume && d.vpcService != nil {
+				d.detachAttachedENIs(instance)
+			}
 
 			// Deallocate resources
 			instanceType := d.resourceMgr.instanceTypes[instance.InstanceType]
@@ -1819,31 +2116,175 @@ func (d *Daemon) stopInstance(instances map[string]*vm.VM, deleteVolume bool) er
 			d.mu.Unlock()
 		}
 	}
+	return errors.Join(teardownErrs...)
+}
+
+// maxConcurrentVolumeTeardown bounds how many of an instance's volume
+// requests teardownVolumes has in flight at once.
+const maxConcurrentVolumeTeardown = 8
+
+// teardownVolumes unmounts every volume of a stopped instance and, when
+// terminating, deletes its internal volumes and those flagged
+// DeleteOnTermination. Each phase runs its requests concurrently and waits
+// for all of them to be answered or time out before the next starts:
+// unmounts, then internal volume deletes, then user volume deletes, whose S3
+// cleanup removes the internal volumes' data. A failing volume doesn't stop
+// the others being cleaned up; the failures are returned joined. Work is
+// done from a snapshot: each request is a NATS round trip, and WriteState
+// waits on EBSRequests.Mu.
+func (d *Daemon) teardownVolumes(instance *vm.VM, deleteVolume bool) error {
+	ebsRequests := instance.SnapshotEBSRequests()
+
+	var mu sync.Mutex
+	var errs []error
+	forEach := func(match func(types.EBSRequest) bool, fn func(*vm.VM, types.EBSRequest) error) {
+		sem := make(chan struct{}, maxConcurrentVolumeTeardown)
+		var wg sync.WaitGroup
+		for _, ebsRequest := range ebsRequests {
+			if !match(ebsRequest) {
+				continue
+			}
+			sem <- struct{}{} // acquire
+			wg.Go(func() {
+				defer func() { <-sem }() // release
+				if err := fn(instance, ebsRequest); err != nil {
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+				}
+			})
+		}
+		wg.Wait()
+	}
+	internal := func(r types.EBSRequest) bool { return r.EFI || r.CloudInit }
+
+	forEach(func(types.EBSRequest) bool { return true }, d.unmountInstanceVolume)
+	if deleteVolume {
+		forEach(internal, d.deleteInstanceVolume)
+		forEach(func(r types.EBSRequest) bool { return !internal(r) }, d.deleteInstanceVolume)
+	}
+	return errors.Join(errs...)
+}
+
+// unmountInstanceVolume unmounts one volume of a stopped instance and marks
+// user-visible volumes (boot and hot-attached) available again. No responder
+// on the node's unmount topic means nothing is serving the volume, so there
+// is nothing to unmount.
+func (d *Daemon) unmountInstanceVolume(instance *vm.VM, ebsRequest types.EBSRequest) error {
+	ebsUnMountRequest, err := json.Marshal(ebsRequest)
+	if err != nil {
+		slog.Error("Failed to marshal volume payload", "err", err)
+		return fmt.Errorf("unmount %s: %w", ebsRequest.Name, err)
+	}
+
+	var unmountErr error
+	msg, err := d.natsConn.Request(utils.Subject(subjects.EBSUnmount(d.node)), ebsUnMountRequest, 30*time.Second)
+	switch {
+	case errors.Is(err, nats.ErrNoResponders):
+		slog.Warn("No viperblockd to unmount volume", "name", ebsRequest.Name, "id", instance.ID)
+	case err != nil:
+		slog.Error("Failed to unmount volume", "name", ebsRequest.Name, "id", instance.ID, "err", err)
+		unmountErr = fmt.Errorf("unmount %s: %w", ebsRequest.Name, err)
+	default:
+		var resp types.EBSUnMountResponse
+		if json.Unmarshal(msg.Data, &resp) == nil && resp.Error != "" {
+			slog.Error("Failed to unmount volume", "name", ebsRequest.Name, "id", instance.ID, "err", resp.Error)
+			unmountErr = fmt.Errorf("unmount %s: %s", ebsRequest.Name, resp.Error)
+		} else {
+			slog.Info("Unmounted Viperblock volume", "id", instance.ID, "data", string(msg.Data))
+		}
+	}
+
+	if !ebsRequest.EFI && !ebsRequest.CloudInit {
+		if err := d.volumeService.UpdateVolumeState(ebsRequest.Name, "available", "", ""); err != nil {
+			slog.Error("Failed to update volume state to available", "volumeId", ebsRequest.Name, "err", err)
+		}
+	}
+	return unmountErr
+}
+
+// deleteInstanceVolume cleans up one volume of a terminated instance.
+// Internal volumes (EFI, cloud-init) are always sent ebs.delete to stop their
+// viperblockd processes; their S3 data goes with the parent root volume's
+// DeleteVolume, which removes the -efi/ and -cloudinit/ prefixes. User-visible
+// volumes are deleted only when flagged DeleteOnTermination. Volumes no
+// viperblockd is serving, or already deleted, are not failures.
+func (d *Daemon) deleteInstanceVolume(instance *vm.VM, ebsRequest types.EBSRequest) error {
+	if ebsRequest.EFI || ebsRequest.CloudInit {
+		ebsDeleteData, err := json.Marshal(types.EBSDeleteRequest{Volume: ebsRequest.Name})
+		if err != nil {
+			slog.Error("Failed to marshal ebs.delete request for internal volume", "name", ebsRequest.Name, "err", err)
+			return fmt.Errorf("delete %s: %w", ebsRequest.Name, err)
+		}
+		deleteMsg, err := d.natsConn.Request(utils.Subject("ebs.delete"), ebsDeleteData, 30*time.Second)
+		switch {
+		case errors.Is(err, nats.ErrNoResponders):
+			slog.Warn("No viperblockd to delete internal volume", "name", ebsRequest.Name, "id", instance.ID)
+		case err != nil:
+			slog.Warn("Failed to send ebs.delete for internal volume", "name", ebsRequest.Name, "id", instance.ID, "err", err)
+			return fmt.Errorf("delete %s: %w", ebsRequest.Name, err)
+		default:
+			var resp types.EBSDeleteResponse
+			if json.Unmarshal(deleteMsg.Data, &resp) == nil && resp.Error != "" {
+				slog.Error("ebs.delete failed for internal volume", "name", ebsRequest.Name, "id", instance.ID, "err", resp.Error)
+				return fmt.Errorf("delete %s: %s", ebsRequest.Name, resp.Error)
+			}
+			slog.Info("Sent ebs.delete for internal volume", "name", ebsRequest.Name, "id", instance.ID, "data", string(deleteMsg.Data))
+		}
+		return nil
+	}
+
+	if !ebsRequest.DeleteOnTermination {
+		slog.Info("Volume has DeleteOnTermination=false, skipping deletion", "name", ebsRequest.Name, "id", instance.ID)
+		return nil
+	}
+
+	// DeleteVolume handles: NATS ebs.delete notification + S3 cleanup
+	// (including -efi/ and -cloudinit/ sub-prefixes)
+	slog.Info("Deleting volume with DeleteOnTermination=true", "name", ebsRequest.Name, "id", instance.ID)
+	_, err := d.volumeService.DeleteVolume(&ec2.DeleteVolumeInput{
+		VolumeId: &ebsRequest.Name,
+	}, instance.AccountID)
+	switch {
+	case err != nil && err.Error() == awserrors.ErrorInvalidVolumeNotFound:
+		slog.Warn("Volume already deleted on termination", "name", ebsRequest.Name, "id", instance.ID)
+	case err != nil:
+		slog.Error("Failed to delete volume on termination", "name", ebsRequest.Name, "id", instance.ID, "err", err)
+		return fmt.Errorf("delete %s: %w", ebsRequest.Name, err)
+	default:
+		slog.Info("Deleted volume on termination", "name", ebsRequest.Name, "id", instance.ID)
+	}
 	return nil
 }
 
 func (d *Daemon) setupShutdown() {
 	d.shutdownWg.Go(func() {
 		sigChan := make(chan os.Signal, 1)
-		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
-		<-sigChan
-		slog.Info("Received shutdown signal, cleaning up...")
+		select {
+		case <-sigChan:
+			slog.Info("Received shutdown signal, cleaning up...")
+		case <-d.exitCh:
+			slog.Info("Node drained, cleaning up...")
+		}
 
 		// Cancel context to stop heartbeat and other goroutines
 		d.cancel()
 
-		// If coordinated shutdown already handled VMs (DRAIN phase), skip stopInstance.
-		// Otherwise, set the flag now so crash handlers and restart schedulers
-		// know to bail out during SIGTERM-based shutdown.
-		if d.shuttingDown.Load() {
+		// If coordinated shutdown already handled VMs (DRAIN phase), skip the
+		// drain. Otherwise drain the node, which sets the flag so crash
+		// handlers and restart schedulers know to bail out during
+		// SIGTERM-based shutdown. A drain already under way is waited for.
+		cleanShutdown := true
+		if d.shuttingDown.Load() && !d.draining.Load() {
 			slog.Info("Coordinated shutdown in progress, skipping VM stop (already handled by DRAIN phase)")
 		} else {
-			d.shuttingDown.Store(true)
-			// Pass instances to terminate
-			if err := d.stopInstance(d.Instances.VMS, false); err != nil {
-				slog.Error("Failed to stop instances during shutdown", "err", err)
+			result := d.drain(false, d.config.Daemon.DrainTimeout())
+			if result.Error != "" {
+				slog.Error("Failed to drain node during shutdown", "err", result.Error)
 			}
+			cleanShutdown = !result.TimedOut
 		}
 
 		// Stop ELBv2 background goroutines
@@ -1860,8 +2301,10 @@ func (d *Daemon) setupShutdown() {
 			}
 		}
 
-		// Write shutdown marker to cluster state KV
-		if d.jsManager != nil {
+		// Write shutdown marker to cluster state KV. A drain that timed out
+		// may leave instances half stopped, so the next start checks them as
+		// it would after a crash.
+		if d.jsManager != nil && cleanShutdown {
 			if err := d.jsManager.WriteShutdownMarker(d.node); err != nil {
 				slog.Error("Failed to write shutdown marker", "err", err)
 			}
@@ -1876,6 +2319,25 @@ func (d *Daemon) setupShutdown() {
 		// Close NATS connection
 		d.natsConn.Close()
 
+		if d.imdsServer != nil {
+			slog.Info("Shutting down instance metadata service...")
+			if err := d.imdsServer.Shutdown(context.Background()); err != nil {
+				slog.Error("Error shutting down instance metadata service", "err", err)
+			}
+		}
+
+		if d.metricsServer != nil {
+			if err := d.metricsServer.Shutdown(context.Background()); err != nil {
+				slog.Error("Error shutting down metrics endpoint", "err", err)
+			}
+		}
+
+		if d.tracingShutdown != nil {
+			if err := d.tracingShutdown(context.Background()); err != nil {
+				slog.Error("Error flushing traces", "err", err)
+			}
+		}
+
 		// Shutdown cluster manager
 		if d.clusterServer != nil {
 			slog.Info("Shutting down cluster manager...")
@@ -1897,6 +2359,11 @@ func (d *Daemon) CreateQMPClient(instance *vm.VM) (err error) {
 		return err
 	}
 
+	// Health checks start over with each QEMU process
+	d.Instances.Mu.Lock()
+	instance.Reachability = vm.Reachability{}
+	d.Instances.Mu.Unlock()
+
 	// Send qmp_capabilities handshake to init
 	_, err = d.SendQMPCommand(instance.QMPClient, qmp.QMPCommand{Execute: "qmp_capabilities"}, instance.ID)
 	if err != nil {
@@ -1927,18 +2394,17 @@ func (d *Daemon) CreateQMPClient(instance *vm.VM) (err error) {
 			}
 
 			slog.Debug("QMP heartbeat", "instance", instance.ID)
-			qmpStatus, err := d.SendQMPCommand(instance.QMPClient, qmp.QMPCommand{Execute: "query-status"}, instance.ID)
-
-			if err != nil {
-				slog.Warn("QMP heartbeat failed", "instance", instance.ID, "err", err)
-				// Don't exit on transient errors - let the status check above handle terminal states
-				continue
-			}
-
-			slog.Debug("QMP status", "instance", instance.ID, "status", string(qmpStatus.Return))
+			// Failures don't exit the heartbeat - they're reported by
+			// DescribeInstanceStatus, and the status check above handles
+			// terminal states
+			d.checkReachability(instance)
 		}
 	}()
 
+	if instance.Config.AgentSocket != "" {
+		go d.runAgentChannel(instance)
+	}
+
 	return nil
 }
 
@@ -1960,6 +2426,14 @@ func (d *Daemon) launchStillValid(instance *vm.VM) bool {
 }
 
 func (d *Daemon) LaunchInstance(instance *vm.VM) (err error) {
+	// Steps of the launch add their spans to this one through the instance.
+	ctx, span := tracing.StartInstance(instance.ID, "LaunchInstance", false)
+	tracing.SetInstance(ctx, instance.ID)
+	defer func() {
+		tracing.End(span, err)
+		tracing.ClearInstance(instance.ID)
+	}()
+
 	// Abort if instance is no longer in a launchable state. A concurrent
 	// terminate request that flipped status to shutting-down/terminated
 	// owns the cleanup lifecycle; this path is an expected race outcome,
@@ -1986,6 +2460,11 @@ func (d *Daemon) LaunchInstance(instance *vm.VM) (err error) {
 		}
 	}
 
+	// Operator pre-launch hooks, e.g. to prepare host networking
+	if err := d.runPreLaunchHooks(instance); err != nil {
+		return err
+	}
+
 	// Loop through each volume in volumes
 	err = d.MountVolumes(instance)
 
@@ -2018,6 +2497,7 @@ func (d *Daemon) LaunchInstance(instance *vm.VM) (err error) {
 		slog.Error("Failed to create QMP client", "err", err)
 		return err
 	}
+	d.pinVCPUs(instance)
 
 	// Step 8: Subscribe to start/stop/shutdown events
 	d.mu.Lock()
@@ -2032,22 +2512,20 @@ func (d *Daemon) LaunchInstance(instance *vm.VM) (err error) {
 		_ = existing.Unsubscribe()
 	}
 
-	d.natsSubscriptions[instance.ID], err = d.natsConn.Subscribe(fmt.Sprintf("ec2.cmd.%s", instance.ID), d.handleEC2Events)
+	d.natsSubscriptions[instance.ID], err = d.natsConn.Subscribe(utils.Subject(subjects.InstanceCmd(instance.ID)), d.handleEC2Events)
 	if err != nil {
 		slog.Error("failed to subscribe to NATS", "err", err)
 		return err
 	}
 
-	d.natsSubscriptions[consoleSubKey], err = d.natsConn.Subscribe(fmt.Sprintf("ec2.%s.GetConsoleOutput", instance.ID), d.handleEC2GetConsoleOutput)
+	d.natsSubscriptions[consoleSubKey], err = d.natsConn.Subscribe(utils.Subject(subjects.ConsoleOutput(instance.ID)), d.handleEC2GetConsoleOutput)
 	if err != nil {
 		slog.Error("failed to subscribe to console output NATS topic", "err", err)
 		return err
 	}
 
 	// Step 9: Update the instance metadata for running state and volume attached
-	d.Instances.Mu.Lock()
-	d.Instances.VMS[instance.ID] = instance
-	d.Instances.Mu.Unlock()
+	d.Instances.UpsertVM(instance)
 
 	// Final race check — QEMU is up, but if a terminate fired during
 	// StartInstance/CreateQMPClient, the concurrent goroutine has already
@@ -2063,15 +2541,13 @@ func (d *Daemon) LaunchInstance(instance *vm.VM) (err error) {
 	}
 
 	// Step 10: Mark boot volumes as "in-use" now that instance is confirmed running
-	instance.EBSRequests.Mu.Lock()
-	for _, ebsReq := range instance.EBSRequests.Requests {
+	for _, ebsReq := range instance.SnapshotEBSRequests() {
 		if ebsReq.Boot {
 			if err := d.volumeService.UpdateVolumeState(ebsReq.Name, "in-use", instance.ID, ""); err != nil {
 				slog.Error("Failed to update volume state to in-use", "volumeId", ebsReq.Name, "err", err)
 			}
 		}
 	}
-	instance.EBSRequests.Mu.Unlock()
 
 	return nil
 }
@@ -2093,11 +2569,7 @@ func (d *Daemon) markInstanceFailed(instance *vm.VM, reason string) {
 	}
 
 	// Set state reason before transition
-	if instance.Instance != nil {
-		instance.Instance.StateReason = &ec2.StateReason{}
-		instance.Instance.StateReason.SetCode("Server.InternalError")
-		instance.Instance.StateReason.SetMessage(reason)
-	}
+	d.setStateReason(instance, stateReasonInternalError, reason)
 	d.Instances.Mu.Unlock()
 
 	if err := d.TransitionState(instance, vm.StateShuttingDown); err != nil {
@@ -2122,13 +2594,8 @@ func (d *Daemon) markInstanceFailed(instance *vm.VM, reason string) {
 // transitions to terminated, writes to the terminated KV bucket, and removes
 // the instance from local state.
 func (d *Daemon) finalizeTermination(instance *vm.VM) {
-	stopErr := d.stopInstance(map[string]*vm.VM{instance.ID: instance}, true)
-	if stopErr != nil {
-		slog.Error("Failed to cleanup failed instance", "err", stopErr, "id", instance.ID)
-		if err := d.TransitionState(instance, vm.StateError); err != nil {
-			slog.Error("Failed to transition to error state", "instanceId", instance.ID, "err", err)
-		}
-		return
+	if err := d.stopInstance([]*vm.VM{instance}, true); err != nil {
+		slog.Error("Volume teardown incomplete for failed instance, instance is down", "err", err, "id", instance.ID)
 	}
 
 	d.Instances.Mu.Lock()
@@ -2150,25 +2617,16 @@ func (d *Daemon) finalizeTermination(instance *vm.VM) {
 	}
 
 	// Guard + delete: another handler may have reclaimed this instance.
-	d.Instances.Mu.Lock()
-	current, exists := d.Instances.VMS[instance.ID]
-	if !exists || current != instance {
-		d.Instances.Mu.Unlock()
+	if !d.Instances.DeleteVMIfCurrent(instance) {
 		slog.Info("Instance was reclaimed by another handler, skipping local cleanup",
 			"instanceId", instance.ID, "state", "terminated")
 		return
 	}
-	delete(d.Instances.VMS, instance.ID)
-	d.Instances.Mu.Unlock()
 
 	if err := d.WriteState(); err != nil {
 		slog.Error("Failed to persist state after terminating failed instance, re-adding to local map",
 			"instanceId", instance.ID, "err", err)
-		d.Instances.Mu.Lock()
-		if _, occupied := d.Instances.VMS[instance.ID]; !occupied {
-			d.Instances.VMS[instance.ID] = instance
-		}
-		d.Instances.Mu.Unlock()
+		d.Instances.InsertVM(instance)
 	} else {
 		slog.Info("Released failed instance ownership to KV",
 			"instanceId", instance.ID, "lastNode", d.node)
@@ -2189,21 +2647,11 @@ func (d *Daemon) startPendingWatchdog() {
 			case <-d.ctx.Done():
 				return
 			case <-ticker.C:
-				d.Instances.Mu.Lock()
-				var stuck []*vm.VM
-				for _, instance := range d.Instances.VMS {
-					if (instance.Status == vm.StatePending || instance.Status == vm.StateProvisioning) &&
-						instance.Instance != nil && instance.Instance.LaunchTime != nil &&
-						time.Since(*instance.Instance.LaunchTime) > pendingWatchdogTimeout {
-						stuck = append(stuck, instance)
-					}
-				}
-				d.Instances.Mu.Unlock()
-
-				for _, instance := range stuck {
+				now := utils.Now()
+				for _, instance := range d.stuckPendingInstances(now) {
 					slog.Warn("Instance stuck in pending, marking failed",
 						"instanceId", instance.ID, "status", instance.Status,
-						"elapsed", time.Since(*instance.Instance.LaunchTime))
+						"elapsed", now.Sub(*instance.Instance.LaunchTime))
 					d.markInstanceFailed(instance, "launch_timeout")
 				}
 			}
@@ -2211,7 +2659,26 @@ func (d *Daemon) startPendingWatchdog() {
 	}()
 }
 
-func (d *Daemon) StartInstance(instance *vm.VM) error {
+// stuckPendingInstances returns the pending or provisioning instances launched
+// more than pendingWatchdogTimeout before now.
+func (d *Daemon) stuckPendingInstances(now time.Time) []*vm.VM {
+	d.Instances.Mu.Lock()
+	defer d.Instances.Mu.Unlock()
+	var stuck []*vm.VM
+	for _, instance := range d.Instances.VMS {
+		if (instance.Status == vm.StatePending || instance.Status == vm.StateProvisioning) &&
+			instance.Instance != nil && instance.Instance.LaunchTime != nil &&
+			now.Sub(*instance.Instance.LaunchTime) > pendingWatchdogTimeout {
+			stuck = append(stuck, instance)
+		}
+	}
+	return stuck
+}
+
+func (d *Daemon) StartInstance(instance *vm.VM) (err error) {
+	_, span := tracing.StartInstance(instance.ID, "qemu launch", true)
+	defer func() { tracing.End(span, err) }()
+
 	pidFile, err := utils.GeneratePidFile(instance.ID)
 
 	if err != nil {
@@ -2237,35 +2704,72 @@ func (d *Daemon) StartInstance(instance *vm.VM) error {
 	serialSocket := filepath.Join(runtimeDir, fmt.Sprintf("serial-%s.sock", instance.ID))
 
 	instance.Config = buildBaseVMConfig(instance.ID, pidFile, consoleLogPath, serialSocket, architecture, vCPUs, int(memoryMiB))
+	instance.Config.VNCSocket = filepath.Join(runtimeDir, fmt.Sprintf("vnc-%s.sock", instance.ID))
+	// Large instances on multi-node hosts get dedicated CPUs on one NUMA
+	// node. Their CPUs and memory are sized at launch, so only unpinned
+	// instances get room to be resized while running; QEMU hot-plugs vCPUs
+	// only into x86 guests.
+	if d.config.Daemon.NUMAPinning {
+		instance.Config.NUMA = d.resourceMgr.placeNUMA(instance.ID, instanceType)
+		defer func() {
+			if err != nil {
+				d.resourceMgr.releaseNUMA(instance.ID)
+			}
+		}()
+	}
+	if architecture == "x86_64" && instance.Config.NUMA == nil {
+		instance.Config.MaxCPUCount, instance.Config.MaxMemory = d.resourceMgr.hotplugLimits(instanceType)
+	}
+	instance.Config.WatchdogAction = instance.WatchdogAction
+	instance.Config.VirtioRNG = instance.VirtioRNG
+	instance.Config.QEMUOptions = instance.QEMUOptions
 
 	// Build QEMU drives from EBS volume requests.
 	instance.EBSRequests.Mu.Lock()
-	drives, iothreads, devices, err := buildDrives(instance.EBSRequests.Requests, vCPUs)
+	drives, iothreads, devices, err := buildDrives(instance.EBSRequests.Requests, vCPUs, d.config.LocalVolumePath)
 	instance.EBSRequests.Mu.Unlock()
 	if err != nil {
 		return err
 	}
+	// EBS volumes share one throttle group so together they get at least
+	// the type's EBS-optimized baseline but can't burst past its maximum.
+	if group := d.instanceThrottleGroup(instance); group != nil {
+		instance.Config.ThrottleGroups = []vm.ThrottleGroup{*group}
+		for i := range drives {
+			if drives[i].ID != "cloudinit" {
+				drives[i].ThrottleGroup = group.ID
+			}
+		}
+	}
 	instance.Config.Drives = append(instance.Config.Drives, drives...)
 	instance.Config.IOThreads = append(instance.Config.IOThreads, iothreads...)
+
+	// Encrypted volumes are opened with their data keys
+	for _, req := range instance.SnapshotEBSRequests() {
+		if !req.Encrypted {
+			continue
+		}
+		secret, err := d.volumeSecret(req.Name, d.volumeTarget(req))
+		if err != nil {
+			slog.Error("Failed to unlock encrypted volume", "volumeId", req.Name, "err", err)
+			return fmt.Errorf("unlock volume %s: %w", req.Name, err)
+		}
+		instance.Config.Secrets = append(instance.Config.Secrets, secret)
+	}
 	instance.Config.Devices = append(instance.Config.Devices, devices...)
 
-	// VPC tap networking vs user-mode fallback
+	// VPC tap or SR-IOV VF networking vs user-mode fallback
 	if instance.ENIId != "" && d.networkPlumber != nil {
-		// VPC mode: create tap device and add to OVS br-int
-		if err := d.networkPlumber.SetupTapDevice(instance.ENIId, instance.ENIMac); err != nil {
-			slog.Error("Failed to set up tap device", "eni", instance.ENIId, "err", err)
-			return fmt.Errorf("setup tap device: %w", err)
+		usesVF, err := d.setupPrimaryVF(instance, instanceType)
+		if err != nil {
+			slog.Error("Failed to set up SR-IOV VF", "eni", instance.ENIId, "err", err)
+			return err
+		}
+		if !usesVF {
+			if err := d.setupPrimaryTap(instance); err != nil {
+				return err
+			}
 		}
-
-		tapName := TapDeviceName(instance.ENIId)
-		instance.Config.NetDevs = append(instance.Config.NetDevs, vm.NetDev{
-			Value: fmt.Sprintf("tap,id=net0,ifname=%s,script=no,downscript=no", tapName),
-		})
-		instance.Config.Devices = append(instance.Config.Devices, vm.Device{
-			Value: fmt.Sprintf("virtio-net-pci,netdev=net0,mac=%s", instance.ENIMac),
-		})
-
-		slog.Info("VPC networking configured", "tap", tapName, "eni", instance.ENIId, "mac", instance.ENIMac)
 
 		// Additional VPC NICs for multi-subnet system VMs (e.g. ALBs with
 		// subnets across multiple AZs).
@@ -2373,6 +2877,26 @@ func (d *Daemon) StartInstance(instance *vm.VM) error {
 
 	instance.Config.QMPSocket = qmpSocket
 
+	// Guest agent channel, for the instance reachability check
+	qgaSocket, err := utils.GenerateSocketFile(fmt.Sprintf("qga-%s", instance.ID))
+
+	if err != nil {
+		slog.Error("Failed to generate guest agent socket", "err", err)
+		return err
+	}
+
+	instance.Config.GuestAgentSocket = qgaSocket
+
+	// Spinifex agent channel, for data the guest posts such as its password
+	agentSocket, err := utils.GenerateSocketFile(fmt.Sprintf("agent-%s", instance.ID))
+
+	if err != nil {
+		slog.Error("Failed to generate agent socket", "err", err)
+		return err
+	}
+
+	instance.Config.AgentSocket = agentSocket
+
 	// Temp, wait for nbdkit to start
 	// TODO: Improve, confirm nbdkit started for each volume
 	time.Sleep(2 * time.Second)
@@ -2406,6 +2930,8 @@ func (d *Daemon) StartInstance(instance *vm.VM) error {
 		}
 
 		err = cmd.Start()
+		// QEMU holds its own copies of the secret pipes
+		vm.CloseFiles(cmd.ExtraFiles)
 
 		if err != nil {
 			slog.Error("Failed to start VM", "err", err)
@@ -2420,6 +2946,9 @@ func (d *Daemon) StartInstance(instance *vm.VM) error {
 			slog.Warn("Failed to set QEMU OOM score", "pid", cmd.Process.Pid, "err", err)
 		}
 
+		// Isolate QEMU in its own cgroup, limited to what its type buys.
+		d.applyInstanceCgroup(instance, cmd.Process.Pid)
+
 		// Log QEMU stdout (serial output is captured via chardev logfile, not stdout)
 		go func() {
 			scanner := bufio.NewScanner(VMstdout)
@@ -2465,6 +2994,9 @@ func (d *Daemon) StartInstance(instance *vm.VM) error {
 			d.handleInstanceCrash(instance, waitErr)
 		} else {
 			slog.Info("VM process exited cleanly", "instance", instance.ID)
+			// A watchdog poweroff makes QEMU exit cleanly right after emitting
+			// WATCHDOG, usually before the heartbeat reads it.
+			d.drainQMPEvents(instance)
 		}
 	}()
 
@@ -2535,8 +3067,9 @@ func buildBaseVMConfig(instanceID, pidFile, consoleLogPath, serialSocket, archit
 }
 
 // buildDrives converts EBS volume requests into QEMU drive, iothread, and device
-// configurations. Returns an error if any non-EFI volume is missing its NBDURI.
-func buildDrives(requests []types.EBSRequest, cpuCount int) ([]vm.Drive, []vm.IOThread, []vm.Device, error) {
+// configurations. Local-backend volumes are opened by the file localPath
+// names; every other non-EFI volume must have its NBDURI set.
+func buildDrives(requests []types.EBSRequest, cpuCount int, localPath func(volumeID string) string) ([]vm.Drive, []vm.IOThread, []vm.Device, error) {
 	var drives []vm.Drive
 	var iothreads []vm.IOThread
 	var devices []vm.Device
@@ -2547,12 +3080,15 @@ func buildDrives(requests []types.EBSRequest, cpuCount int) ([]vm.Drive, []vm.IO
 			continue
 		}
 
-		if v.NBDURI == "" {
+		var drive vm.Drive
+		if v.Backend == config.VolumeBackendLocal {
+			drive = vm.Drive{File: localPath(v.Name), Format: "raw"}
+		} else if v.NBDURI == "" {
 			return nil, nil, nil, fmt.Errorf("NBDURI not set for volume %s - was volume mounted?", v.Name)
+		} else {
+			drive = vm.Drive{File: v.NBDURI}
 		}
 
-		drive := vm.Drive{File: v.NBDURI}
-
 		if v.Boot {
 			drive.Format = "raw"
 			drive.If = "none"
@@ -2573,28 +3109,53 @@ func buildDrives(requests []types.EBSRequest, cpuCount int) ([]vm.Drive, []vm.IO
 			drive.If = "virtio"
 			drive.Media = "cdrom"
 			drive.ID = "cloudinit"
+		} else {
+			if v.CacheMode != "" {
+				drive.Cache = v.CacheMode
+			}
+			drive.Discard = v.Trim
 		}
 
-		slog.Info("Using NBD URI for drive", "volume", v.Name, "uri", v.NBDURI)
+		if v.Encrypted {
+			drive.Format = "luks"
+			drive.KeySecret = volumeSecretID(v.Name)
+		}
+
+		slog.Info("Using drive", "volume", v.Name, "file", drive.File)
 		drives = append(drives, drive)
 	}
 
 	return drives, iothreads, devices, nil
 }
 
-// ebsTopic returns a node-specific EBS NATS topic, e.g. "ebs.node1.mount".
-// This ensures mount/unmount requests are routed to the viperblock instance
-// running on the same node as the daemon (NBD sockets are local).
-func (d *Daemon) ebsTopic(action string) string {
-	return fmt.Sprintf("ebs.%s.%s", d.node, action)
-}
+// MountVolumes mounts the volumes for an instance. Mounts are requested from a
+// snapshot so EBSRequests.Mu is not held across NATS round trips; the NBD URIs
+// of the volumes that mounted are recorded on return, even on failure.
+func (d *Daemon) MountVolumes(instance *vm.VM) (err error) {
+	_, span := tracing.StartInstance(instance.ID, "MountVolumes", true)
+	defer func() { tracing.End(span, err) }()
 
-// MountVolumes mounts the volumes for an instance
-func (d *Daemon) MountVolumes(instance *vm.VM) error {
-	instance.EBSRequests.Mu.Lock()
-	defer instance.EBSRequests.Mu.Unlock()
+	if err := d.checkFence(); err != nil {
+		slog.Error("Refusing to mount volumes", "instanceId", instance.ID, "err", err)
+		return err
+	}
+
+	nbdURIs := make(map[string]string)
+	defer func() {
+		instance.EBSRequests.Mu.Lock()
+		defer instance.EBSRequests.Mu.Unlock()
+		for k, req := range instance.EBSRequests.Requests {
+			if uri, ok := nbdURIs[req.Name]; ok {
+				instance.EBSRequests.Requests[k].NBDURI = uri
+			}
+		}
+	}()
+
+	for _, v := range instance.SnapshotEBSRequests() {
+		if v.Backend == config.VolumeBackendLocal {
+			continue
+		}
 
-	for k, v := range instance.EBSRequests.Requests {
 		// Send the volume payload as JSON
 		ebsMountRequest, err := json.Marshal(v)
 
@@ -2603,12 +3164,13 @@ func (d *Daemon) MountVolumes(instance *vm.VM) error {
 			return err
 		}
 
-		reply, err := d.natsConn.Request(d.ebsTopic("mount"), ebsMountRequest, 30*time.Second)
+		reply, err := d.natsConn.Request(utils.Subject(subjects.EBSMount(d.node)), ebsMountRequest, 30*time.Second)
 
 		slog.Info("Mounting volume", "Vol", v.Name, "NBDURI", v.NBDURI)
 
 		// TODO: Improve timeout handling
 		if err != nil {
+			countNBDMount(false)
 			slog.Error("Failed to request EBS mount", "err", err)
 			return err
 		}
@@ -2618,15 +3180,17 @@ func (d *Daemon) MountVolumes(instance *vm.VM) error {
 		err = json.Unmarshal(reply.Data, &ebsMountResponse)
 
 		if err != nil {
+			countNBDMount(false)
 			slog.Error("Failed to unmarshal volume response:", "err", err)
 			return err
 		}
+		countNBDMount(ebsMountResponse.Error == "")
 
 		if ebsMountResponse.Error == "" {
 			slog.Debug("Mounted volume successfully", "response", ebsMountResponse.URI)
 
 			// Append the NBD URI to the request
-			instance.EBSRequests.Requests[k].NBDURI = ebsMountResponse.URI
+			nbdURIs[v.Name] = ebsMountResponse.URI
 		} else {
 			slog.Error("Failed to mount volume", "error", ebsMountResponse.Error)
 			return fmt.Errorf("failed to mount volume: %s", ebsMountResponse.Error)
@@ -2639,12 +3203,15 @@ func (d *Daemon) MountVolumes(instance *vm.VM) error {
 // rollbackEBSMount sends an ebs.unmount request to undo a previously successful ebs.mount.
 // Rollback failures are logged but not propagated; callers treat this as best-effort cleanup.
 func (d *Daemon) rollbackEBSMount(req types.EBSRequest) {
+	if req.Backend == config.VolumeBackendLocal {
+		return // opened directly by QEMU, nothing mounted
+	}
 	data, err := json.Marshal(req)
 	if err != nil {
 		slog.Error("rollbackEBSMount: failed to marshal unmount request", "volume", req.Name, "err", err)
 		return
 	}
-	msg, err := d.natsConn.Request(d.ebsTopic("unmount"), data, 10*time.Second)
+	msg, err := d.natsConn.Request(utils.Subject(subjects.EBSUnmount(d.node)), data, 10*time.Second)
 	if err != nil {
 		slog.Error("rollbackEBSMount: ebs.unmount NATS request failed", "volume", req.Name, "err", err)
 		return
@@ -2673,7 +3240,7 @@ func (d *Daemon) respondWithVolumeAttachment(msg *nats.Msg, volumeID, instanceID
 		InstanceId:          aws.String(instanceID),
 		Device:              aws.String(device),
 		State:               aws.String(state),
-		AttachTime:          aws.Time(time.Now()),
+		AttachTime:          aws.Time(utils.Now()),
 		DeleteOnTermination: aws.Bool(false),
 	}
 
@@ -2684,13 +3251,15 @@ func (d *Daemon) respondWithVolumeAttachment(msg *nats.Msg, volumeID, instanceID
 		return
 	}
 
-	if err := msg.Respond(jsonResp); err != nil {
+	if err := utils.Respond(msg, awserrors.Reply{Result: jsonResp}); err != nil {
 		slog.Error("Failed to respond to NATS request", "err", err)
 	}
 }
 
 // nextAvailableDevice finds the next available /dev/sd[f-p] device name for an instance.
 // It checks both EBSRequests and BlockDeviceMappings to avoid conflicts.
+// The caller must hold Instances.Mu and instance.EBSRequests.Mu (see
+// Instances.WithVolumes).
 func nextAvailableDevice(instance *vm.VM) string {
 	usedDevices := make(map[string]bool)
 
@@ -2704,13 +3273,11 @@ func nextAvailableDevice(instance *vm.VM) string {
 	}
 
 	// Collect devices from EBSRequests (may not yet be in BlockDeviceMappings)
-	instance.EBSRequests.Mu.Lock()
 	for _, req := range instance.EBSRequests.Requests {
 		if req.DeviceName != "" {
 			usedDevices[req.DeviceName] = true
 		}
 	}
-	instance.EBSRequests.Mu.Unlock()
 
 	// AWS convention: /dev/sd[f-p] for attached volumes
 	for c := 'f'; c <= 'p'; c++ {
@@ -2738,14 +3305,37 @@ func (rm *ResourceManager) canAllocate(instanceType *ec2.InstanceTypeInfo, count
 	)
 }
 
-// allocate reserves resources for an instance and updates NATS subscriptions
+// remaining returns the schedulable vCPUs and memory not yet allocated.
+func (rm *ResourceManager) remaining() (vcpu int, memGB float64) {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+	return rm.hostVCPU - rm.reservedVCPU - rm.allocatedVCPU, rm.hostMemGB - rm.reservedMem - rm.allocatedMem
+}
+
+// shortfall returns nil if count instances of the given type fit, or a
+// *capacityShortfallError naming the binding resource.
+func (rm *ResourceManager) shortfall(instanceType *ec2.InstanceTypeInfo, count int) error {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	if err := capacityShortfall(
+		rm.hostVCPU-rm.reservedVCPU, rm.allocatedVCPU,
+		rm.hostMemGB-rm.reservedMem, rm.allocatedMem,
+		aws.StringValue(instanceType.InstanceType),
+		instanceTypeVCPUs(instanceType),
+		instanceTypeMemoryMiB(instanceType),
+		count,
+	); err != nil {
+		return err
+	}
+	return nil
+}
+
+// allocate reserves resources for an instance and updates NATS subscriptions.
+// When the instance doesn't fit it returns a *capacityShortfallError.
 func (rm *ResourceManager) allocate(instanceType *ec2.InstanceTypeInfo) error {
-	if rm.canAllocate(instanceType, 1) < 1 {
-		instanceTypeName := ""
-		if instanceType.InstanceType != nil {
-			instanceTypeName = *instanceType.InstanceType
-		}
-		return fmt.Errorf("insufficient resources for instance type %s", instanceTypeName)
+	if err := rm.shortfall(instanceType, 1); err != nil {
+		return err
 	}
 
 	rm.mu.Lock()
@@ -2753,6 +3343,7 @@ func (rm *ResourceManager) allocate(instanceType *ec2.InstanceTypeInfo) error {
 	memoryGB := float64(instanceTypeMemoryMiB(instanceType)) / 1024.0
 	rm.allocatedVCPU += int(vCPUs)
 	rm.allocatedMem += memoryGB
+	rm.availableTypesExpiry = time.Time{}
 	rm.mu.Unlock()
 
 	rm.updateInstanceSubscriptions()
@@ -2766,11 +3357,67 @@ func (rm *ResourceManager) deallocate(instanceType *ec2.InstanceTypeInfo) {
 	memoryGB := float64(instanceTypeMemoryMiB(instanceType)) / 1024.0
 	rm.allocatedVCPU -= int(vCPUs)
 	rm.allocatedMem -= memoryGB
+	rm.availableTypesExpiry = time.Time{}
 	rm.mu.Unlock()
 
 	rm.updateInstanceSubscriptions()
 }
 
+// resize moves an instance's allocation from one instance type to another.
+// A larger type must fit in the capacity left once from is released; when it
+// doesn't, resize returns a *capacityShortfallError and changes nothing.
+func (rm *ResourceManager) resize(from, to *ec2.InstanceTypeInfo) error {
+	fromVCPUs, toVCPUs := instanceTypeVCPUs(from), instanceTypeVCPUs(to)
+	fromMemGB := float64(instanceTypeMemoryMiB(from)) / 1024.0
+	toMemGB := float64(instanceTypeMemoryMiB(to)) / 1024.0
+
+	rm.mu.Lock()
+	if toVCPUs > fromVCPUs || toMemGB > fromMemGB {
+		if err := capacityShortfall(
+			rm.hostVCPU-rm.reservedVCPU, rm.allocatedVCPU-int(fromVCPUs),
+			rm.hostMemGB-rm.reservedMem, rm.allocatedMem-fromMemGB,
+			aws.StringValue(to.InstanceType), toVCPUs, instanceTypeMemoryMiB(to), 1,
+		); err != nil {
+			rm.mu.Unlock()
+			return err
+		}
+	}
+	rm.allocatedVCPU += int(toVCPUs - fromVCPUs)
+	rm.allocatedMem += toMemGB - fromMemGB
+	rm.availableTypesExpiry = time.Time{}
+	rm.mu.Unlock()
+
+	rm.updateInstanceSubscriptions()
+	return nil
+}
+
+// hotplugLimits returns the vCPUs and memory (MiB) to start an instance of
+// instanceType with room for, so it can be resized while running. They are
+// the largest size of its family, capped at what the host can schedule;
+// zero means the instance cannot grow past its boot size.
+func (rm *ResourceManager) hotplugLimits(instanceType *ec2.InstanceTypeInfo) (maxVCPUs, maxMemMiB int) {
+	ceilVCPUs, ceilMemMiB, ok := instancetypes.HotplugCeiling(aws.StringValue(instanceType.InstanceType))
+	if !ok {
+		return 0, 0
+	}
+
+	rm.mu.RLock()
+	hostVCPUs := rm.hostVCPU - rm.reservedVCPU
+	// Whole GiB keeps the virtio-mem region aligned to its block size.
+	hostMemMiB := int64(rm.hostMemGB-rm.reservedMem) * 1024
+	rm.mu.RUnlock()
+
+	maxVCPUs = min(ceilVCPUs, hostVCPUs)
+	maxMemMiB = int(min(ceilMemMiB, hostMemMiB))
+	if maxVCPUs <= int(instanceTypeVCPUs(instanceType)) {
+		maxVCPUs = 0
+	}
+	if maxMemMiB <= int(instanceTypeMemoryMiB(instanceType)) {
+		maxMemMiB = 0
+	}
+	return maxVCPUs, maxMemMiB
+}
+
 // initSubscriptions sets up dynamic per-instance-type NATS subscriptions.
 // Called once during daemon startup after NATS is connected.
 func (rm *ResourceManager) initSubscriptions(nc *nats.Conn, handler nats.MsgHandler, nodeID string) {
@@ -2781,6 +3428,23 @@ func (rm *ResourceManager) initSubscriptions(nc *nats.Conn, handler nats.MsgHand
 	rm.updateInstanceSubscriptions()
 }
 
+// cordon stops the node taking RunInstances requests, leaving them to the
+// other nodes, and reports no free capacity from then on.
+func (rm *ResourceManager) cordon() {
+	rm.mu.Lock()
+	rm.cordoned = true
+	rm.mu.Unlock()
+
+	rm.updateInstanceSubscriptions()
+}
+
+// isCordoned reports whether the node is draining.
+func (rm *ResourceManager) isCordoned() bool {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+	return rm.cordoned
+}
+
 // updateInstanceSubscriptions recalculates which instance types can fit on this
 // node and subscribes/unsubscribes from the corresponding NATS topics. Each type
 // gets two topics:
@@ -2796,18 +3460,19 @@ func (rm *ResourceManager) updateInstanceSubscriptions() {
 	rm.subsMu.Lock()
 	defer rm.subsMu.Unlock()
 
+	cordoned := rm.isCordoned()
 	for typeName, typeInfo := range rm.instanceTypes {
 		// System types (sys.micro, etc.) are internal-only — not routable via customer API.
 		if instancetypes.IsSystemType(typeName) {
 			continue
 		}
-		queueTopic := fmt.Sprintf("ec2.RunInstances.%s", typeName)
-		canFit := rm.canAllocate(typeInfo, 1) >= 1
+		queueTopic := subjects.RunInstances(typeName)
+		canFit := !cordoned && rm.canAllocate(typeInfo, 1) >= 1
 
 		// Queue group subscription (load-balanced across nodes)
 		_, subscribed := rm.instanceSubs[queueTopic]
 		if canFit && !subscribed {
-			sub, err := rm.natsConn.QueueSubscribe(queueTopic, "spinifex-workers", rm.handler)
+			sub, err := rm.natsConn.QueueSubscribe(utils.Subject(queueTopic), "spinifex-workers", rm.handler)
 			if err != nil {
 				slog.Error("Failed to subscribe to instance type topic", "topic", queueTopic, "err", err)
 				continue
@@ -2819,15 +3484,15 @@ func (rm *ResourceManager) updateInstanceSubscriptions() {
 				slog.Error("Failed to unsubscribe from instance type topic", "topic", queueTopic, "err", err)
 			}
 			delete(rm.instanceSubs, queueTopic)
-			slog.Info("Unsubscribed from instance type (capacity full)", "topic", queueTopic)
+			slog.Info("Unsubscribed from instance type (capacity full or draining)", "topic", queueTopic)
 		}
 
 		// Node-specific subscription (targeted routing for multi-node distribution)
 		if rm.nodeID != "" {
-			nodeTopic := fmt.Sprintf("ec2.RunInstances.%s.%s", typeName, rm.nodeID)
+			nodeTopic := subjects.RunInstancesOnNode(typeName, rm.nodeID)
 			_, nodeSubscribed := rm.instanceSubs[nodeTopic]
 			if canFit && !nodeSubscribed {
-				sub, err := rm.natsConn.Subscribe(nodeTopic, rm.handler)
+				sub, err := rm.natsConn.Subscribe(utils.Subject(nodeTopic), rm.handler)
 				if err != nil {
 					slog.Error("Failed to subscribe to node-specific topic", "topic", nodeTopic, "err", err)
 					continue
@@ -2839,7 +3504,7 @@ func (rm *ResourceManager) updateInstanceSubscriptions() {
 					slog.Error("Failed to unsubscribe from node-specific topic", "topic", nodeTopic, "err", err)
 				}
 				delete(rm.instanceSubs, nodeTopic)
-				slog.Info("Unsubscribed from node-specific instance type (capacity full)", "topic", nodeTopic)
+				slog.Info("Unsubscribed from node-specific instance type (capacity full or draining)", "topic", nodeTopic)
 			}
 		}
 	}
@@ -2926,6 +3591,19 @@ func (d *Daemon) wireLBAgentConfig() {
 		gatewayURL := "https://" + net.JoinHostPort(gatewayHost, gatewayPort)
 		d.elbv2Service.GatewayURL = gatewayURL
 		slog.Info("LB agent gateway URL configured", "url", gatewayURL)
+		// Customer instances have no mgmt NIC. When the gateway is only
+		// reachable over the mgmt host route they phone home to this
+		// node's metadata service instead, if it runs. Those with the
+		// metadata endpoint disabled then can't report boot completion.
+		switch {
+		case d.mgmtRouteVia == "":
+			d.instanceService.PhoneHomeURL = gatewayURL + "/phone-home"
+		case d.config.Daemon.IMDSListen != "":
+			d.instanceService.PhoneHomeURL = "http://" + imdsIPv4 + imdsPhoneHomePath
+			d.instanceService.PhoneHomeViaIMDS = true
+		default:
+			slog.Warn("Instances can't reach the gateway and the metadata service is off; boot completion won't be reported")
+		}
 	} else {
 		slog.Error("LB agent gateway URL not configured: no reachable host found — CreateLoadBalancer will fail until --advertise or br-mgmt is configured",
 			"awsgwBindIP", awsgwBindIP, "mgmtBridgeIP", d.mgmtBridgeIP, "advertiseIP", advertiseIP)
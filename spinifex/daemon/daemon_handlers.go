@@ -2,6 +2,7 @@ package daemon
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
@@ -17,23 +18,50 @@ import (
 	"github.com/nats-io/nats.go"
 )
 
-// respondWithError sends an error payload for the given error code on the NATS message.
+// respondWithError sends an error reply for the given error code on the NATS message.
 func respondWithError(msg *nats.Msg, errCode string) {
-	if err := msg.Respond(utils.GenerateErrorPayload(errCode)); err != nil {
+	respondWithServiceError(msg, errors.New(errCode))
+}
+
+// respondWithServiceError responds with err's error code, and with its detail
+// when err carries one. Errors that are not AWS error codes are sent as
+// InternalError.
+func respondWithServiceError(msg *nats.Msg, err error) {
+	requestLogger(msg).Debug("Responding with error", "subject", msg.Subject, "code", awserrors.ValidErrorCode(err.Error()))
+	if err := utils.RespondError(msg, err); err != nil {
 		slog.Error("Failed to respond to NATS request", "err", err)
 	}
 }
 
-// respondWithJSON marshals data to JSON and sends it as a NATS response.
+// requestLogger returns the logger for the handling of msg, which names the
+// API request msg serves when the gateway passed its ID on.
+func requestLogger(msg *nats.Msg) *slog.Logger {
+	if requestID := utils.RequestIDFromMsg(msg); requestID != "" {
+		return slog.With("requestId", requestID)
+	}
+	return slog.Default()
+}
+
+// respondWithCapacityError responds with InsufficientInstanceCapacity. When
+// err is a *capacityShortfallError, the binding resource and shortfall go in
+// the error's detail.
+func respondWithCapacityError(msg *nats.Msg, err error) {
+	var shortfall *capacityShortfallError
+	if !errors.As(err, &shortfall) {
+		respondWithError(msg, awserrors.ErrorInsufficientInstanceCapacity)
+		return
+	}
+	respondWithServiceError(msg, awserrors.WithDetail(awserrors.ErrorInsufficientInstanceCapacity, shortfall.detail()))
+}
+
+// respondWithJSON marshals data to JSON and sends it as the result reply.
 // On marshal failure it responds with an internal server error.
 func respondWithJSON(msg *nats.Msg, data any) {
-	jsonResponse, err := json.Marshal(data)
-	if err != nil {
-		slog.Error("Failed to marshal response", "type", fmt.Sprintf("%T", data), "err", err)
-		respondWithError(msg, awserrors.ErrorServerInternal)
-		return
+	reply := awserrors.ResultReply(data)
+	if reply.Err != nil {
+		slog.Error("Failed to marshal response", "type", fmt.Sprintf("%T", data))
 	}
-	if err := msg.Respond(jsonResponse); err != nil {
+	if err := utils.Respond(msg, reply); err != nil {
 		slog.Error("Failed to respond to NATS request", "err", err)
 	}
 }
@@ -44,14 +72,12 @@ func handleNATSRequest[I any, O any](msg *nats.Msg, serviceFn func(*I, string) (
 	accountID := utils.AccountIDFromMsg(msg)
 	input := new(I)
 	if errResp := utils.UnmarshalJsonPayload(input, msg.Data); errResp != nil {
-		if err := msg.Respond(errResp); err != nil {
-			slog.Error("Failed to respond to NATS request", "err", err)
-		}
+		respondWithError(msg, awserrors.ErrorValidationError)
 		return
 	}
 	output, err := serviceFn(input, accountID)
 	if err != nil {
-		respondWithError(msg, awserrors.ValidErrorCode(err.Error()))
+		respondWithServiceError(msg, err)
 		return
 	}
 	respondWithJSON(msg, output)
@@ -69,9 +95,7 @@ func (d *Daemon) handleEC2Events(msg *nats.Msg) {
 
 	slog.Debug("Received message", "subject", msg.Subject, "data", string(msg.Data))
 
-	d.Instances.Mu.Lock()
-	instance, ok := d.Instances.VMS[command.ID]
-	d.Instances.Mu.Unlock()
+	instance, ok := d.Instances.GetVM(command.ID)
 
 	if !ok {
 		slog.Warn("Instance is not running on this node", "id", command.ID)
@@ -89,10 +113,32 @@ func (d *Daemon) handleEC2Events(msg *nats.Msg) {
 		d.handleAttachVolume(msg, command, instance)
 	case command.Attributes.DetachVolume:
 		d.handleDetachVolume(msg, command, instance)
+	case command.Attributes.ResizeVolume:
+		d.handleResizeVolume(msg, command, instance)
+	case command.Attributes.AttachENI:
+		d.handleAttachENI(msg, command, instance)
+	case command.Attributes.DetachENI:
+		d.handleDetachENI(msg, command, instance)
+	case command.Attributes.ModifyENI:
+		d.handleModifyENI(msg, command, instance)
+	case command.Attributes.ResizeInstance:
+		d.handleResizeInstance(msg, command, instance)
 	case command.Attributes.StartInstance:
 		d.handleStartInstance(msg, command, instance)
 	case command.Attributes.RebootInstance:
 		d.handleRebootInstance(msg, command, instance)
+	case command.Attributes.ModifyMetadataOptions:
+		d.handleModifyMetadataOptions(msg, command, instance)
+	case command.Attributes.ModifyProtection:
+		d.handleModifyProtection(msg, command)
+	case command.Attributes.ModifyMaintenanceOptions:
+		d.handleModifyMaintenanceOptions(msg, command)
+	case command.Attributes.ConsoleScreenshot:
+		d.handleConsoleScreenshot(msg, command, instance)
+	case command.Attributes.GetPasswordData:
+		d.handleGetPasswordData(msg, command, instance)
+	case command.Attributes.OpenConsole:
+		d.handleOpenConsole(msg, command, instance)
 	case command.Attributes.StopInstance, command.Attributes.TerminateInstance:
 		d.handleStopOrTerminateInstance(msg, command, instance)
 	default:
@@ -121,7 +167,7 @@ func (d *Daemon) handleHealthCheck(msg *nats.Msg) {
 		Status:     status,
 		ConfigHash: configHash,
 		Epoch:      d.clusterConfig.Epoch,
-		Uptime:     int64(time.Since(d.startTime).Seconds()),
+		Uptime:     int64(utils.Now().Sub(d.startTime).Seconds()),
 	}
 
 	respondWithJSON(msg, response)
@@ -167,13 +213,21 @@ func (d *Daemon) handleNodeStatus(msg *nats.Msg) {
 	}
 	d.Instances.Mu.Unlock()
 
+	freeVCPU, freeMem := d.interruptibleUsage()
+	addReclaimable(caps, totalVCPU-reservedVCPU-allocVCPU, totalMemGB-reservedMemGB-allocMemGB, freeVCPU, freeMem)
+
+	status := "Ready"
+	if d.resourceMgr.isCordoned() {
+		status = "Draining"
+	}
+
 	resp := types.NodeStatusResponse{
 		Node:          d.node,
-		Status:        "Ready",
+		Status:        status,
 		Host:          d.daemonIP(),
 		Region:        d.config.Region,
 		AZ:            d.config.AZ,
-		Uptime:        int64(time.Since(d.startTime).Seconds()),
+		Uptime:        int64(utils.Now().Sub(d.startTime).Seconds()),
 		Services:      d.config.GetServices(),
 		TotalVCPU:     totalVCPU,
 		TotalMemGB:    totalMemGB,
@@ -296,6 +350,8 @@ func (d *Daemon) handleNodeVMs(msg *nats.Msg) {
 			Status:       string(v.Status),
 			InstanceType: v.InstanceType,
 			ManagedBy:    v.ManagedBy,
+			AccountID:    v.AccountID,
+			Volumes:      v.AttachedVolumes(),
 		}
 		// Get vCPU/memory from the resource manager's instance type info
 		if it, ok := d.resourceMgr.instanceTypes[v.InstanceType]; ok {
@@ -305,6 +361,11 @@ func (d *Daemon) handleNodeVMs(msg *nats.Msg) {
 		if v.Instance != nil && v.Instance.LaunchTime != nil {
 			info.LaunchTime = v.Instance.LaunchTime.Unix()
 		}
+		if v.CPUCredits != nil {
+			info.CPUCreditMode = v.CPUCredits.Mode
+			info.CPUCreditBalance = v.CPUCredits.Balance
+			info.CPUThrottled = v.CPUCredits.Throttled
+		}
 		vms = append(vms, info)
 	}
 	d.Instances.Mu.Unlock()
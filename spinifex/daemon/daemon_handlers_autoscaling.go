@@ -0,0 +1,25 @@
+package daemon
+
+import (
+	"github.com/nats-io/nats.go"
+)
+
+func (d *Daemon) handleAutoScalingCreateAutoScalingGroup(msg *nats.Msg) {
+	handleNATSRequest(msg, d.autoScalingService.CreateAutoScalingGroup)
+}
+
+func (d *Daemon) handleAutoScalingUpdateAutoScalingGroup(msg *nats.Msg) {
+	handleNATSRequest(msg, d.autoScalingService.UpdateAutoScalingGroup)
+}
+
+func (d *Daemon) handleAutoScalingSetDesiredCapacity(msg *nats.Msg) {
+	handleNATSRequest(msg, d.autoScalingService.SetDesiredCapacity)
+}
+
+func (d *Daemon) handleAutoScalingDeleteAutoScalingGroup(msg *nats.Msg) {
+	handleNATSRequest(msg, d.autoScalingService.DeleteAutoScalingGroup)
+}
+
+func (d *Daemon) handleAutoScalingDescribeAutoScalingGroups(msg *nats.Msg) {
+	handleNATSRequest(msg, d.autoScalingService.DescribeAutoScalingGroups)
+}
@@ -1,17 +1,33 @@
 package daemon
 
 import (
+	"bytes"
 	"encoding/base64"
+	"errors"
+	"io"
+	"io/fs"
 	"log/slog"
+	"net"
 	"os"
+	"path/filepath"
+	"sync"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/qmp"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/types"
 	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
 	"github.com/nats-io/nats.go"
 )
 
+// maxConsoleOutput is the most console output GetConsoleOutput returns, the
+// AWS limit. The log of a long-running instance can be far larger.
+const maxConsoleOutput = 64 * 1024
+
 // handleEC2GetConsoleOutput reads the console log file for an instance and returns
 // base64-encoded output matching the AWS GetConsoleOutput API response format.
 func (d *Daemon) handleEC2GetConsoleOutput(msg *nats.Msg) {
@@ -19,9 +35,7 @@ func (d *Daemon) handleEC2GetConsoleOutput(msg *nats.Msg) {
 
 	var input ec2.GetConsoleOutputInput
 	if errResp := utils.UnmarshalJsonPayload(&input, msg.Data); errResp != nil {
-		if err := msg.Respond(errResp); err != nil {
-			slog.Error("Failed to respond to NATS request", "err", err)
-		}
+		respondWithError(msg, awserrors.ErrorValidationError)
 		return
 	}
 
@@ -33,9 +47,7 @@ func (d *Daemon) handleEC2GetConsoleOutput(msg *nats.Msg) {
 	instanceID := *input.InstanceId
 
 	// Find the instance on this node
-	d.Instances.Mu.Lock()
-	instance, exists := d.Instances.VMS[instanceID]
-	d.Instances.Mu.Unlock()
+	instance, exists := d.Instances.GetVM(instanceID)
 
 	if !exists {
 		respondWithError(msg, awserrors.ErrorInvalidInstanceIDNotFound)
@@ -52,21 +64,14 @@ func (d *Daemon) handleEC2GetConsoleOutput(msg *nats.Msg) {
 	var modTime time.Time
 
 	if logPath != "" {
-		info, err := os.Stat(logPath)
-		if err == nil {
-			modTime = info.ModTime()
-
-			data, err := os.ReadFile(logPath)
-			if err != nil {
+		data, mtime, err := readConsoleTail(logPath, maxConsoleOutput)
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
 				slog.Error("Failed to read console log", "path", logPath, "err", err)
-			} else {
-				// Return last 64KB (AWS limit)
-				const maxConsoleOutput = 64 * 1024
-				if len(data) > maxConsoleOutput {
-					data = data[len(data)-maxConsoleOutput:]
-				}
-				outputData = data
 			}
+		} else {
+			outputData = data
+			modTime = mtime
 		}
 	}
 
@@ -76,9 +81,8 @@ func (d *Daemon) handleEC2GetConsoleOutput(msg *nats.Msg) {
 		encodedOutput = base64.StdEncoding.EncodeToString(outputData)
 	}
 
-	now := time.Now()
 	if modTime.IsZero() {
-		modTime = now
+		modTime = utils.Now()
 	}
 
 	output := &ec2.GetConsoleOutputOutput{
@@ -90,3 +94,221 @@ func (d *Daemon) handleEC2GetConsoleOutput(msg *nats.Msg) {
 	respondWithJSON(msg, output)
 	slog.Info("handleEC2GetConsoleOutput completed", "instance_id", instanceID, "output_bytes", len(outputData))
 }
+
+// readConsoleTail returns the last limit bytes of the console log at path and
+// its modification time. Only the tail is read, as QEMU appends to the log for
+// the life of the instance.
+func readConsoleTail(path string, limit int64) ([]byte, time.Time, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	offset := max(info.Size()-limit, 0)
+	data, err := io.ReadAll(io.NewSectionReader(f, offset, info.Size()-offset))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	return data, info.ModTime(), nil
+}
+
+// handleConsoleScreenshot captures the display of a running instance with a
+// QMP screendump and returns it as a base64-encoded PNG, matching the AWS
+// GetConsoleScreenshot response. QEMU writes the image beside the console
+// log, so the file is on this node and removed once read.
+func (d *Daemon) handleConsoleScreenshot(msg *nats.Msg, command types.EC2InstanceCommand, instance *vm.VM) {
+	d.Instances.Mu.Lock()
+	status := instance.Status
+	d.Instances.Mu.Unlock()
+
+	if status != vm.StateRunning {
+		slog.Error("ConsoleScreenshot: instance not in running state", "instanceId", command.ID, "status", status)
+		respondWithError(msg, awserrors.ErrorIncorrectInstanceState)
+		return
+	}
+
+	dir := os.TempDir()
+	if instance.Config.ConsoleLogPath != "" {
+		dir = filepath.Dir(instance.Config.ConsoleLogPath)
+	}
+	f, err := os.CreateTemp(dir, command.ID+"-screenshot-*.png")
+	if err != nil {
+		slog.Error("ConsoleScreenshot: failed to create screenshot file", "instanceId", command.ID, "err", err)
+		respondWithError(msg, awserrors.ErrorServerInternal)
+		return
+	}
+	path := f.Name()
+	_ = f.Close()
+	defer os.Remove(path)
+
+	_, err = d.SendQMPCommand(instance.QMPClient, qmp.QMPCommand{
+		Execute:   "screendump",
+		Arguments: map[string]any{"filename": path, "format": "png"},
+	}, command.ID)
+	if err != nil {
+		slog.Error("ConsoleScreenshot: QMP screendump failed", "instanceId", command.ID, "err", err)
+		respondWithQMPError(msg, err)
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		slog.Error("ConsoleScreenshot: failed to read screenshot", "path", path, "err", err)
+		respondWithError(msg, awserrors.ErrorServerInternal)
+		return
+	}
+
+	respondWithJSON(msg, &ec2.GetConsoleScreenshotOutput{
+		InstanceId: aws.String(command.ID),
+		ImageData:  aws.String(base64.StdEncoding.EncodeToString(data)),
+	})
+	slog.Info("Captured console screenshot", "instanceId", command.ID, "bytes", len(data))
+}
+
+// consoleIdleTimeout ends a console session the gateway has sent nothing on,
+// not even a keepalive, for this long: the gateway or its client is gone.
+var consoleIdleTimeout = 90 * time.Second
+
+// consoleReadSize is the most console output relayed in one message.
+const consoleReadSize = 32 * 1024
+
+// handleOpenConsole connects to the serial or VNC socket of a running
+// instance and relays it to the gateway's websocket proxy over the session's
+// NATS subjects, replying once the relay is up. The session ends when either
+// side closes it, QEMU closes the socket or the gateway goes quiet.
+func (d *Daemon) handleOpenConsole(msg *nats.Msg, command types.EC2InstanceCommand, instance *vm.VM) {
+	session := command.ConsoleSession
+	if session == nil || session.SessionID == "" {
+		respondWithError(msg, awserrors.ErrorMissingParameter)
+		return
+	}
+
+	d.Instances.Mu.Lock()
+	status := instance.Status
+	socket := instance.Config.SerialSocket
+	if session.Type == types.ConsoleVNC {
+		socket = instance.Config.VNCSocket
+	}
+	d.Instances.Mu.Unlock()
+
+	if session.Type != types.ConsoleSerial && session.Type != types.ConsoleVNC {
+		respondWithError(msg, awserrors.ErrorInvalidParameterValue)
+		return
+	}
+	if status != vm.StateRunning {
+		slog.Error("OpenConsole: instance not in running state", "instanceId", command.ID, "status", status)
+		respondWithError(msg, awserrors.ErrorIncorrectInstanceState)
+		return
+	}
+	if socket == "" {
+		// Instances launched before the console was exposed have no socket
+		slog.Error("OpenConsole: instance has no console socket", "instanceId", command.ID, "type", session.Type)
+		respondWithError(msg, awserrors.ErrorUnsupportedOperation)
+		return
+	}
+
+	conn, err := net.DialTimeout("unix", socket, 5*time.Second)
+	if err != nil {
+		slog.Error("OpenConsole: failed to connect to console socket", "instanceId", command.ID, "socket", socket, "err", err)
+		respondWithError(msg, awserrors.ErrorServerInternal)
+		return
+	}
+
+	relay := &consoleRelay{
+		nc:        d.natsConn,
+		conn:      conn,
+		outbound:  utils.Subject(subjects.ConsoleOut(session.SessionID)),
+		idle:      time.NewTimer(consoleIdleTimeout),
+		closed:    make(chan struct{}),
+		sessionID: session.SessionID,
+	}
+	relay.sub, err = d.natsConn.Subscribe(utils.Subject(subjects.ConsoleIn(session.SessionID)), relay.input)
+	if err != nil {
+		_ = conn.Close()
+		slog.Error("OpenConsole: failed to subscribe to console input", "instanceId", command.ID, "err", err)
+		respondWithError(msg, awserrors.ErrorServerInternal)
+		return
+	}
+
+	respondWithJSON(msg, struct{}{})
+	slog.Info("Opened console session", "instanceId", command.ID, "type", session.Type, "session", session.SessionID)
+
+	go relay.pump()
+	go func() {
+		select {
+		case <-relay.idle.C:
+			slog.Info("Console session idle, closing", "session", session.SessionID)
+			relay.close(true)
+		case <-relay.closed:
+		}
+	}()
+}
+
+// consoleRelay copies one console session between a QEMU socket and NATS.
+type consoleRelay struct {
+	nc        *nats.Conn
+	conn      net.Conn
+	sub       *nats.Subscription
+	outbound  string
+	idle      *time.Timer
+	sessionID string
+
+	once   sync.Once
+	closed chan struct{}
+}
+
+// input writes the gateway's input to the console.
+func (r *consoleRelay) input(msg *nats.Msg) {
+	r.idle.Reset(consoleIdleTimeout)
+	if msg.Header.Get(types.ConsoleCloseHeader) != "" {
+		r.close(false)
+		return
+	}
+	if len(msg.Data) == 0 {
+		return
+	}
+	if _, err := r.conn.Write(msg.Data); err != nil {
+		slog.Warn("Console session write failed", "session", r.sessionID, "err", err)
+		r.close(true)
+	}
+}
+
+// pump publishes the console's output until the socket closes.
+func (r *consoleRelay) pump() {
+	buf := make([]byte, consoleReadSize)
+	for {
+		n, err := r.conn.Read(buf)
+		if n > 0 {
+			if pubErr := r.nc.Publish(r.outbound, bytes.Clone(buf[:n])); pubErr != nil {
+				slog.Warn("Console session publish failed", "session", r.sessionID, "err", pubErr)
+				r.close(false)
+				return
+			}
+		}
+		if err != nil {
+			r.close(true)
+			return
+		}
+	}
+}
+
+// close ends the session once, telling the gateway when it didn't end it.
+func (r *consoleRelay) close(notify bool) {
+	r.once.Do(func() {
+		close(r.closed)
+		r.idle.Stop()
+		_ = r.sub.Unsubscribe()
+		_ = r.conn.Close()
+		if notify {
+			msg := nats.NewMsg(r.outbound)
+			msg.Header.Set(types.ConsoleCloseHeader, "1")
+			_ = r.nc.PublishMsg(msg)
+		}
+		slog.Info("Closed console session", "session", r.sessionID)
+	})
+}
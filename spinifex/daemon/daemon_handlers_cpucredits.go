@@ -0,0 +1,241 @@
+package daemon
+
+import (
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/instancetypes"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/nats-io/nats.go"
+)
+
+// handleEC2DescribeInstanceCreditSpecifications reports the credit mode of
+// the caller's burstable instances running on this node. It fans out to all
+// nodes; stopped instances are answered from shared KV by
+// handleEC2DescribeStoppedInstanceCreditSpecifications.
+func (d *Daemon) handleEC2DescribeInstanceCreditSpecifications(msg *nats.Msg) {
+	input, wanted, ok := parseDescribeCreditInput(msg)
+	if !ok {
+		return
+	}
+	accountID := utils.AccountIDFromMsg(msg)
+
+	output := &ec2.DescribeInstanceCreditSpecificationsOutput{InstanceCreditSpecifications: []*ec2.InstanceCreditSpecification{}}
+	for _, instance := range d.Instances.ListVMs() {
+		if len(wanted) > 0 && !wanted[instance.ID] {
+			continue
+		}
+		d.Instances.WithVM(instance.ID, func(v *vm.VM) {
+			if spec := creditSpecification(v, accountID); spec != nil {
+				output.InstanceCreditSpecifications = append(output.InstanceCreditSpecifications, spec)
+			}
+		})
+	}
+
+	slog.Debug("handleEC2DescribeInstanceCreditSpecifications completed", "requested", len(input.InstanceIds), "count", len(output.InstanceCreditSpecifications))
+	respondWithJSON(msg, output)
+}
+
+// handleEC2DescribeStoppedInstanceCreditSpecifications reports the credit
+// mode of the caller's stopped burstable instances from shared KV.
+func (d *Daemon) handleEC2DescribeStoppedInstanceCreditSpecifications(msg *nats.Msg) {
+	_, wanted, ok := parseDescribeCreditInput(msg)
+	if !ok {
+		return
+	}
+	if d.jsManager == nil {
+		respondWithError(msg, awserrors.ErrorServerInternal)
+		return
+	}
+	accountID := utils.AccountIDFromMsg(msg)
+
+	instances, err := d.jsManager.ListStoppedInstances()
+	if err != nil {
+		slog.Error("handleEC2DescribeStoppedInstanceCreditSpecifications: failed to list instances", "err", err)
+		respondWithError(msg, awserrors.ErrorServerInternal)
+		return
+	}
+
+	output := &ec2.DescribeInstanceCreditSpecificationsOutput{InstanceCreditSpecifications: []*ec2.InstanceCreditSpecification{}}
+	for _, instance := range instances {
+		if len(wanted) > 0 && !wanted[instance.ID] {
+			continue
+		}
+		if spec := creditSpecification(instance, accountID); spec != nil {
+			output.InstanceCreditSpecifications = append(output.InstanceCreditSpecifications, spec)
+		}
+	}
+	respondWithJSON(msg, output)
+}
+
+func parseDescribeCreditInput(msg *nats.Msg) (*ec2.DescribeInstanceCreditSpecificationsInput, map[string]bool, bool) {
+	input := &ec2.DescribeInstanceCreditSpecificationsInput{}
+	if errResp := utils.UnmarshalJsonPayload(input, msg.Data); errResp != nil {
+		respondWithError(msg, awserrors.ErrorValidationError)
+		return nil, nil, false
+	}
+	wanted := make(map[string]bool, len(input.InstanceIds))
+	for _, id := range input.InstanceIds {
+		if id != nil {
+			wanted[*id] = true
+		}
+	}
+	return input, wanted, true
+}
+
+// creditSpecification returns the credit specification of a burstable
+// instance visible to accountID, or nil.
+func creditSpecification(instance *vm.VM, accountID string) *ec2.InstanceCreditSpecification {
+	if instance.CPUCredits == nil || !isInstanceVisible(accountID, instance.AccountID) {
+		return nil
+	}
+	return &ec2.InstanceCreditSpecification{
+		InstanceId: aws.String(instance.ID),
+		CpuCredits: aws.String(instance.CPUCredits.Mode),
+	}
+}
+
+// handleEC2ModifyInstanceCreditSpecification switches the credit mode of
+// the caller's burstable instances running on this node. It fans out to all
+// nodes and reports only the instances this node runs; the gateway sends
+// the rest to handleEC2ModifyStoppedInstanceCreditSpecification.
+func (d *Daemon) handleEC2ModifyInstanceCreditSpecification(msg *nats.Msg) {
+	input := &ec2.ModifyInstanceCreditSpecificationInput{}
+	if errResp := utils.UnmarshalJsonPayload(input, msg.Data); errResp != nil {
+		respondWithError(msg, awserrors.ErrorValidationError)
+		return
+	}
+	accountID := utils.AccountIDFromMsg(msg)
+
+	output := newModifyCreditOutput()
+	for _, spec := range input.InstanceCreditSpecifications {
+		instanceID := aws.StringValue(spec.InstanceId)
+		mode := aws.StringValue(spec.CpuCredits)
+
+		var apply bool
+		found, errCode := d.modifyLocalInstance(instanceID, accountID, func(v *vm.VM) string {
+			if errCode := modifyCPUCredits(v, mode); errCode != "" {
+				return errCode
+			}
+			apply = setCPUCreditMode(v.CPUCredits, mode)
+			return ""
+		})
+		if !found {
+			continue
+		}
+		if errCode != "" {
+			addUnsuccessfulCreditItem(output, instanceID, errCode)
+			continue
+		}
+		if apply {
+			d.reapplyCPUCap(instanceID)
+		}
+		output.SuccessfulInstanceCreditSpecifications = append(output.SuccessfulInstanceCreditSpecifications,
+			&ec2.SuccessfulInstanceCreditSpecificationItem{InstanceId: aws.String(instanceID)})
+		slog.Info("Modified instance CPU credit mode", "instanceId", instanceID, "mode", mode)
+	}
+
+	respondWithJSON(msg, output)
+}
+
+// handleEC2ModifyStoppedInstanceCreditSpecification switches the credit
+// mode of the caller's stopped burstable instances in shared KV. Instances
+// that aren't there are reported as not found.
+func (d *Daemon) handleEC2ModifyStoppedInstanceCreditSpecification(msg *nats.Msg) {
+	input := &ec2.ModifyInstanceCreditSpecificationInput{}
+	if errResp := utils.UnmarshalJsonPayload(input, msg.Data); errResp != nil {
+		respondWithError(msg, awserrors.ErrorValidationError)
+		return
+	}
+	if d.jsManager == nil {
+		respondWithError(msg, awserrors.ErrorServerInternal)
+		return
+	}
+	accountID := utils.AccountIDFromMsg(msg)
+
+	output := newModifyCreditOutput()
+	for _, spec := range input.InstanceCreditSpecifications {
+		instanceID := aws.StringValue(spec.InstanceId)
+		mode := aws.StringValue(spec.CpuCredits)
+
+		// The cap, if any, is applied to the new QEMU process on start.
+		if _, errCode := d.modifyStoppedInstance(instanceID, accountID, func(v *vm.VM) string {
+			if errCode := modifyCPUCredits(v, mode); errCode != "" {
+				return errCode
+			}
+			setCPUCreditMode(v.CPUCredits, mode)
+			return ""
+		}); errCode != "" {
+			addUnsuccessfulCreditItem(output, instanceID, errCode)
+			continue
+		}
+		output.SuccessfulInstanceCreditSpecifications = append(output.SuccessfulInstanceCreditSpecifications,
+			&ec2.SuccessfulInstanceCreditSpecificationItem{InstanceId: aws.String(instanceID)})
+		slog.Info("Modified stopped instance CPU credit mode", "instanceId", instanceID, "mode", mode)
+	}
+
+	respondWithJSON(msg, output)
+}
+
+// modifyCPUCredits checks that instance can switch to mode and returns the
+// error code to report when it can't.
+func modifyCPUCredits(instance *vm.VM, mode string) string {
+	if !instancetypes.ValidCPUCredits(mode) {
+		return awserrors.ErrorInvalidCpuCredits
+	}
+	if instance.CPUCredits == nil {
+		return awserrors.ErrorInstanceCreditSpecificationNotSupported
+	}
+	return ""
+}
+
+// setCPUCreditMode switches c to mode and reports whether the cgroup cap
+// needs applying. A standard instance with no balance is throttled at once,
+// and switching to standard forgives any surplus, which AWS would bill.
+func setCPUCreditMode(c *vm.CPUCredits, mode string) bool {
+	c.Mode = mode
+	if mode == instancetypes.CPUCreditsStandard {
+		c.Surplus = 0
+	}
+	return updateCPUThrottle(c)
+}
+
+// reapplyCPUCap applies a running instance's current throttle state to its
+// QEMU process.
+func (d *Daemon) reapplyCPUCap(instanceID string) {
+	instance, ok := d.Instances.GetVM(instanceID)
+	if !ok {
+		return
+	}
+	pid, err := utils.ReadPidFile(instanceID)
+	if err != nil || pid <= 0 {
+		// Not started yet: the first sample applies the cap.
+		return
+	}
+	var throttled bool
+	d.Instances.WithVM(instanceID, func(v *vm.VM) {
+		throttled = v.CPUCredits != nil && v.CPUCredits.Throttled
+	})
+	d.applyCPUCap(instanceID, pid, throttled, d.baselineVCPUs(instance.InstanceType))
+}
+
+func newModifyCreditOutput() *ec2.ModifyInstanceCreditSpecificationOutput {
+	return &ec2.ModifyInstanceCreditSpecificationOutput{
+		SuccessfulInstanceCreditSpecifications:   []*ec2.SuccessfulInstanceCreditSpecificationItem{},
+		UnsuccessfulInstanceCreditSpecifications: []*ec2.UnsuccessfulInstanceCreditSpecificationItem{},
+	}
+}
+
+func addUnsuccessfulCreditItem(output *ec2.ModifyInstanceCreditSpecificationOutput, instanceID, code string) {
+	output.UnsuccessfulInstanceCreditSpecifications = append(output.UnsuccessfulInstanceCreditSpecifications,
+		&ec2.UnsuccessfulInstanceCreditSpecificationItem{
+			InstanceId: aws.String(instanceID),
+			Error: &ec2.UnsuccessfulInstanceCreditSpecificationItemError{
+				Code:    aws.String(code),
+				Message: aws.String(awserrors.ErrorLookup[code].Message),
+			},
+		})
+}
@@ -1,9 +1,18 @@
 package daemon
 
-import "github.com/nats-io/nats.go"
+import (
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/quota"
+	"github.com/nats-io/nats.go"
+)
 
 func (d *Daemon) handleEC2AllocateAddress(msg *nats.Msg) {
-	handleNATSRequest(msg, d.eipService.AllocateAddress)
+	handleNATSRequest(msg, func(input *ec2.AllocateAddressInput, accountID string) (*ec2.AllocateAddressOutput, error) {
+		if err := d.checkQuota(accountID, quota.Usage{Addresses: 1}); err != nil {
+			return nil, err
+		}
+		return d.eipService.AllocateAddress(input, accountID)
+	})
 }
 
 func (d *Daemon) handleEC2ReleaseAddress(msg *nats.Msg) {
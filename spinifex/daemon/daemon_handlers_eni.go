@@ -0,0 +1,407 @@
+package daemon
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/qmp"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/nats-io/nats.go"
+)
+
+// handleAttachENI hot-plugs a network interface into a running instance:
+//
+//	Phase 1: tap device on br-int  (bound to the ENI's OVN port, with the
+//	         instance's metadata firewall applied)
+//	Phase 2: QMP netdev_add        (rolls back Phase 1)
+//	Phase 3: QMP device_add        (rolls back Phase 2 + Phase 1)
+//	Phase 4: ENI record in-use     (rolls back all of the above)
+func (d *Daemon) handleAttachENI(msg *nats.Msg, command types.EC2InstanceCommand, instance *vm.VM) {
+	data := command.AttachENIData
+	if data == nil || data.NetworkInterfaceID == "" {
+		slog.Error("AttachNetworkInterface: missing attach data")
+		respondWithError(msg, awserrors.ErrorInvalidParameterValue)
+		return
+	}
+	eniID := data.NetworkInterfaceID
+
+	d.Instances.Mu.Lock()
+	status := instance.Status
+	d.Instances.Mu.Unlock()
+	if status != vm.StateRunning {
+		slog.Error("AttachNetworkInterface: instance not running", "instanceId", command.ID, "status", status)
+		respondWithError(msg, awserrors.ErrorIncorrectInstanceState)
+		return
+	}
+
+	// Only VPC instances have a br-int to plug into
+	if instance.ENIId == "" || d.vpcService == nil || d.networkPlumber == nil {
+		slog.Error("AttachNetworkInterface: instance has no VPC networking", "instanceId", command.ID)
+		respondWithError(msg, awserrors.ErrorInvalidParameterCombination)
+		return
+	}
+
+	accountID := utils.AccountIDFromMsg(msg)
+	out, err := d.vpcService.DescribeNetworkInterfaces(&ec2.DescribeNetworkInterfacesInput{
+		NetworkInterfaceIds: []*string{aws.String(eniID)},
+	}, accountID)
+	if err != nil {
+		slog.Error("AttachNetworkInterface: failed to describe ENI", "eniId", eniID, "err", err)
+		respondWithError(msg, awserrors.ValidErrorCode(err.Error()))
+		return
+	}
+	if len(out.NetworkInterfaces) == 0 {
+		respondWithError(msg, awserrors.ErrorInvalidNetworkInterfaceIDNotFound)
+		return
+	}
+	eni := out.NetworkInterfaces[0]
+	if aws.StringValue(eni.Status) == "in-use" {
+		respondWithError(msg, awserrors.ErrorInvalidNetworkInterfaceInUse)
+		return
+	}
+	if az := aws.StringValue(eni.AvailabilityZone); az != "" && d.config.AZ != "" && az != d.config.AZ {
+		slog.Error("AttachNetworkInterface: ENI and instance are in different AZs",
+			"eniId", eniID, "eniAZ", az, "instanceAZ", d.config.AZ)
+		respondWithError(msg, awserrors.ErrorInvalidParameterValue)
+		return
+	}
+
+	var indexTaken bool
+	d.Instances.Mu.Lock()
+	indexTaken = data.DeviceIndex == 0 || extraENIAtIndex(instance, data.DeviceIndex) != nil
+	d.Instances.Mu.Unlock()
+	if indexTaken {
+		slog.Error("AttachNetworkInterface: device index in use", "instanceId", command.ID, "deviceIndex", data.DeviceIndex)
+		respondWithError(msg, awserrors.ErrorInvalidParameterValue)
+		return
+	}
+
+	mac := aws.StringValue(eni.MacAddress)
+	netdevID := ENINetdevID(eniID)
+	deviceID := ENIDeviceID(eniID)
+
+	// Phase 1: tap device
+	if err := d.networkPlumber.SetupTapDevice(eniID, mac); err != nil {
+		slog.Error("AttachNetworkInterface: failed to set up tap device", "eniId", eniID, "err", err)
+		respondWithError(msg, awserrors.ErrorServerInternal)
+		return
+	}
+
+	// Fail closed: the guest must not reach a disabled metadata endpoint
+	// through its new interface.
+	d.Instances.Mu.Lock()
+	metadataDisabled := metadataEndpointDisabled(instance)
+	d.Instances.Mu.Unlock()
+	if d.metadataFirewall != nil {
+		if err := d.setMetadataFirewall([]string{TapDeviceName(eniID)}, metadataDisabled); err != nil {
+			slog.Error("AttachNetworkInterface: failed to apply metadata firewall", "eniId", eniID, "err", err)
+			d.rollbackENITap(eniID)
+			respondWithError(msg, awserrors.ErrorServerInternal)
+			return
+		}
+	}
+
+	// Phase 2: QMP netdev_add
+	_, err = d.SendQMPCommand(instance.QMPClient, qmp.NetdevAdd(netdevID, TapDeviceName(eniID)), instance.ID)
+	if err != nil {
+		slog.Error("AttachNetworkInterface: QMP netdev_add failed", "eniId", eniID, "err", err)
+		d.rollbackENITap(eniID)
+		respondWithQMPError(msg, err)
+		return
+	}
+
+	// Phase 3: QMP device_add
+	_, err = d.SendQMPCommand(instance.QMPClient, qmp.DeviceAddNIC(deviceID, netdevID, mac), instance.ID)
+	if err != nil {
+		slog.Error("AttachNetworkInterface: QMP device_add failed", "eniId", eniID, "err", err)
+		d.rollbackENINetdev(instance, eniID)
+		d.rollbackENITap(eniID)
+		respondWithQMPError(msg, err)
+		return
+	}
+
+	// Phase 4: record the attachment. This also catches a concurrent attach
+	// of the same ENI from another instance.
+	attachmentID, err := d.vpcService.AttachENI(accountID, eniID, instance.ID, data.DeviceIndex)
+	if err != nil {
+		slog.Error("AttachNetworkInterface: failed to record attachment", "eniId", eniID, "err", err)
+		d.rollbackENIDevice(instance, eniID)
+		d.rollbackENINetdev(instance, eniID)
+		d.rollbackENITap(eniID)
+		respondWithError(msg, awserrors.ValidErrorCode(err.Error()))
+		return
+	}
+
+	now := utils.Now()
+	d.Instances.Mu.Lock()
+	instance.ExtraENIs = append(instance.ExtraENIs, vm.ExtraENI{
+		ENIID:        eniID,
+		ENIMac:       mac,
+		ENIIP:        aws.StringValue(eni.PrivateIpAddress),
+		SubnetID:     aws.StringValue(eni.SubnetId),
+		DeviceIndex:  data.DeviceIndex,
+		AttachmentID: attachmentID,
+	})
+	if instance.Instance != nil {
+		instance.Instance.NetworkInterfaces = append(instance.Instance.NetworkInterfaces, &ec2.InstanceNetworkInterface{
+			NetworkInterfaceId: eni.NetworkInterfaceId,
+			PrivateIpAddress:   eni.PrivateIpAddress,
+			MacAddress:         eni.MacAddress,
+			SubnetId:           eni.SubnetId,
+			VpcId:              eni.VpcId,
+			Status:             aws.String("in-use"),
+			Attachment: &ec2.InstanceNetworkInterfaceAttachment{
+				AttachmentId:        aws.String(attachmentID),
+				AttachTime:          aws.Time(now),
+				DeleteOnTermination: aws.Bool(false),
+				DeviceIndex:         aws.Int64(data.DeviceIndex),
+				Status:              aws.String("attached"),
+			},
+		})
+	}
+	// ModifyInstanceMetadataOptions only sees the tap from here on, so
+	// catch up with a change made while the interface was being plugged.
+	changed := metadataEndpointDisabled(instance) != metadataDisabled
+	metadataDisabled = metadataEndpointDisabled(instance)
+	d.Instances.Mu.Unlock()
+	if changed && d.metadataFirewall != nil {
+		if err := d.setMetadataFirewall([]string{TapDeviceName(eniID)}, metadataDisabled); err != nil {
+			slog.Error("AttachNetworkInterface: failed to update metadata firewall", "eniId", eniID, "err", err)
+		}
+	}
+
+	if err := d.WriteState(); err != nil {
+		slog.Error("AttachNetworkInterface: failed to write state", "err", err)
+	}
+
+	respondWithJSON(msg, &ec2.AttachNetworkInterfaceOutput{
+		AttachmentId:     aws.String(attachmentID),
+		NetworkCardIndex: aws.Int64(0),
+	})
+	slog.Info("Network interface attached", "eniId", eniID, "instanceId", instance.ID,
+		"attachmentId", attachmentID, "deviceIndex", data.DeviceIndex)
+}
+
+// handleDetachENI hot-unplugs a network interface attached to a running
+// instance (reverse of attach): QMP device_del, QMP netdev_del, tap device,
+// then the ENI record. The primary interface cannot be detached.
+func (d *Daemon) handleDetachENI(msg *nats.Msg, command types.EC2InstanceCommand, instance *vm.VM) {
+	data := command.DetachENIData
+	if data == nil || data.NetworkInterfaceID == "" {
+		slog.Error("DetachNetworkInterface: missing detach data")
+		respondWithError(msg, awserrors.ErrorInvalidParameterValue)
+		return
+	}
+	eniID := data.NetworkInterfaceID
+
+	d.Instances.Mu.Lock()
+	status := instance.Status
+	var attachmentID string
+	if extra := extraENIByID(instance, eniID); extra != nil {
+		attachmentID = extra.AttachmentID
+	}
+	d.Instances.Mu.Unlock()
+
+	if eniID == instance.ENIId {
+		slog.Error("DetachNetworkInterface: cannot detach primary interface", "eniId", eniID, "instanceId", command.ID)
+		respondWithError(msg, awserrors.ErrorOperationNotPermitted)
+		return
+	}
+	if attachmentID == "" || (data.AttachmentID != "" && data.AttachmentID != attachmentID) {
+		// Interfaces a system VM was launched with have no attachment of
+		// their own and are managed by the load balancer.
+		slog.Error("DetachNetworkInterface: attachment not found", "eniId", eniID, "attachmentId", data.AttachmentID, "instanceId", command.ID)
+		respondWithError(msg, awserrors.ErrorInvalidAttachmentIDNotFound)
+		return
+	}
+	if status != vm.StateRunning {
+		slog.Error("DetachNetworkInterface: instance not running", "instanceId", command.ID, "status", status)
+		respondWithError(msg, awserrors.ErrorIncorrectInstanceState)
+		return
+	}
+
+	// Phase 1: QMP device_del. A device already gone means a previous
+	// detach got this far.
+	_, err := d.SendQMPCommand(instance.QMPClient, qmp.DeviceDel(ENIDeviceID(eniID)), instance.ID)
+	switch {
+	case err == nil:
+	case isQMPDeviceNotFound(err):
+		slog.Info("DetachNetworkInterface: guest NIC already removed (resuming detach)", "eniId", eniID, "err", err)
+	case data.Force:
+		slog.Warn("DetachNetworkInterface: QMP device_del failed (force=true, continuing)", "eniId", eniID, "err", err)
+	default:
+		slog.Error("DetachNetworkInterface: QMP device_del failed", "eniId", eniID, "err", err)
+		respondWithQMPError(msg, err)
+		return
+	}
+
+	// Brief pause for guest to acknowledge PCI removal
+	time.Sleep(d.detachDelay)
+
+	// Phase 2 + 3: netdev and tap. Leftovers only cost a stale host
+	// interface, and the next start rebuilds the NIC list without them.
+	d.rollbackENINetdev(instance, eniID)
+	d.rollbackENITap(eniID)
+
+	// Phase 4: release the ENI
+	if err := d.vpcService.DetachENI(utils.AccountIDFromMsg(msg), eniID); err != nil {
+		slog.Error("DetachNetworkInterface: failed to update ENI record", "eniId", eniID, "err", err)
+	}
+
+	d.Instances.Mu.Lock()
+	for i, extra := range instance.ExtraENIs {
+		if extra.ENIID == eniID {
+			instance.ExtraENIs = append(instance.ExtraENIs[:i], instance.ExtraENIs[i+1:]...)
+			break
+		}
+	}
+	if instance.Instance != nil {
+		for i, ni := range instance.Instance.NetworkInterfaces {
+			if aws.StringValue(ni.NetworkInterfaceId) == eniID {
+				instance.Instance.NetworkInterfaces = append(instance.Instance.NetworkInterfaces[:i], instance.Instance.NetworkInterfaces[i+1:]...)
+				break
+			}
+		}
+	}
+	d.Instances.Mu.Unlock()
+
+	if err := d.WriteState(); err != nil {
+		slog.Error("DetachNetworkInterface: failed to write state", "err", err)
+	}
+
+	respondWithJSON(msg, &ec2.DetachNetworkInterfaceOutput{})
+	slog.Info("Network interface detached", "eniId", eniID, "instanceId", instance.ID, "attachmentId", attachmentID)
+}
+
+// handleModifyENI sets whether an interface attached with
+// AttachNetworkInterface is deleted when the instance terminates, in the ENI
+// record and in the instance's NetworkInterfaces. The instance need not be
+// running.
+func (d *Daemon) handleModifyENI(msg *nats.Msg, command types.EC2InstanceCommand, instance *vm.VM) {
+	data := command.ModifyENIData
+	if data == nil || data.NetworkInterfaceID == "" || data.AttachmentID == "" {
+		slog.Error("ModifyNetworkInterfaceAttribute: missing attachment data")
+		respondWithError(msg, awserrors.ErrorInvalidParameterValue)
+		return
+	}
+	eniID := data.NetworkInterfaceID
+	if eniID == instance.ENIId {
+		respondWithServiceError(msg, awserrors.WithDetail(awserrors.ErrorOperationNotPermitted,
+			"the primary network interface is always deleted with its instance"))
+		return
+	}
+
+	d.Instances.Mu.Lock()
+	extra := extraENIByID(instance, eniID)
+	attached := extra != nil && extra.AttachmentID == data.AttachmentID
+	d.Instances.Mu.Unlock()
+	if !attached {
+		slog.Error("ModifyNetworkInterfaceAttribute: attachment not found", "eniId", eniID, "attachmentId", data.AttachmentID, "instanceId", command.ID)
+		respondWithError(msg, awserrors.ErrorInvalidAttachmentIDNotFound)
+		return
+	}
+
+	if err := d.vpcService.SetENIDeleteOnTermination(utils.AccountIDFromMsg(msg), eniID, data.AttachmentID, data.DeleteOnTermination); err != nil {
+		slog.Error("ModifyNetworkInterfaceAttribute: failed to update ENI record", "eniId", eniID, "err", err)
+		respondWithServiceError(msg, err)
+		return
+	}
+
+	d.Instances.Mu.Lock()
+	if extra := extraENIByID(instance, eniID); extra != nil {
+		extra.DeleteOnTermination = data.DeleteOnTermination
+	}
+	if instance.Instance != nil {
+		for _, ni := range instance.Instance.NetworkInterfaces {
+			if aws.StringValue(ni.NetworkInterfaceId) == eniID && ni.Attachment != nil {
+				ni.Attachment.DeleteOnTermination = aws.Bool(data.DeleteOnTermination)
+			}
+		}
+	}
+	d.Instances.Mu.Unlock()
+
+	if err := d.WriteState(); err != nil {
+		slog.Error("ModifyNetworkInterfaceAttribute: failed to write state", "err", err)
+	}
+
+	respondWithJSON(msg, &ec2.ModifyNetworkInterfaceAttributeOutput{})
+	slog.Info("Network interface attachment modified", "eniId", eniID, "instanceId", instance.ID,
+		"attachmentId", data.AttachmentID, "deleteOnTermination", data.DeleteOnTermination)
+}
+
+// detachAttachedENIs releases the interfaces AttachNetworkInterface added to
+// a terminating instance, leaving them available for reuse, and deletes
+// those set to be deleted on termination.
+func (d *Daemon) detachAttachedENIs(instance *vm.VM) {
+	for _, extra := range instance.ExtraENIs {
+		if extra.AttachmentID == "" {
+			continue
+		}
+		if err := d.vpcService.DetachENI(instance.AccountID, extra.ENIID); err != nil {
+			slog.Warn("Failed to detach ENI on termination", "eni", extra.ENIID, "instanceId", instance.ID, "err", err)
+			continue
+		}
+		if !extra.DeleteOnTermination {
+			continue
+		}
+		if _, err := d.vpcService.DeleteNetworkInterface(&ec2.DeleteNetworkInterfaceInput{
+			NetworkInterfaceId: aws.String(extra.ENIID),
+		}, instance.AccountID); err != nil {
+			slog.Warn("Failed to delete ENI on termination", "eni", extra.ENIID, "instanceId", instance.ID, "err", err)
+		} else {
+			slog.Info("Deleted ENI on termination", "eni", extra.ENIID, "instanceId", instance.ID)
+		}
+	}
+}
+
+// extraENIByID returns the extra ENI with the given ID. Callers hold
+// d.Instances.Mu.
+func extraENIByID(instance *vm.VM, eniID string) *vm.ExtraENI {
+	for i := range instance.ExtraENIs {
+		if instance.ExtraENIs[i].ENIID == eniID {
+			return &instance.ExtraENIs[i]
+		}
+	}
+	return nil
+}
+
+// extraENIAtIndex returns the extra ENI at the given device index. Callers
+// hold d.Instances.Mu.
+func extraENIAtIndex(instance *vm.VM, deviceIndex int64) *vm.ExtraENI {
+	for i := range instance.ExtraENIs {
+		if instance.ExtraENIs[i].DeviceIndex == deviceIndex {
+			return &instance.ExtraENIs[i]
+		}
+	}
+	return nil
+}
+
+func (d *Daemon) rollbackENIDevice(instance *vm.VM, eniID string) {
+	if _, err := d.SendQMPCommand(instance.QMPClient, qmp.DeviceDel(ENIDeviceID(eniID)), instance.ID); err != nil {
+		slog.Warn("QMP device_del NIC failed (non-fatal)", "eniId", eniID, "err", err)
+	}
+}
+
+func (d *Daemon) rollbackENINetdev(instance *vm.VM, eniID string) {
+	if _, err := d.SendQMPCommand(instance.QMPClient, qmp.NetdevDel(ENINetdevID(eniID)), instance.ID); err != nil {
+		slog.Warn("QMP netdev_del failed (non-fatal)", "eniId", eniID, "err", err)
+	}
+}
+
+// rollbackENITap removes the ENI's tap device and any metadata firewall
+// table on it.
+func (d *Daemon) rollbackENITap(eniID string) {
+	if err := d.networkPlumber.CleanupTapDevice(eniID); err != nil {
+		slog.Warn("Failed to clean up ENI tap device", "eni", eniID, "err", err)
+	}
+	if d.metadataFirewall != nil {
+		if err := d.metadataFirewall.AllowMetadata(TapDeviceName(eniID)); err != nil {
+			slog.Warn("Failed to remove ENI metadata firewall", "eni", eniID, "err", err)
+		}
+	}
+}
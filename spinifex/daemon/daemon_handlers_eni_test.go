@@ -0,0 +1,258 @@
+package daemon
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/qmp"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const eniTestAccountID = "123456789012"
+
+// eniTestFixture is a running VPC instance with a recording QMP mock and
+// network plumber, plus a spare ENI in its subnet.
+type eniTestFixture struct {
+	d        *Daemon
+	instance *vm.VM
+	plumber  *MockNetworkPlumber
+	subnetID string
+
+	mu       sync.Mutex
+	commands []qmp.QMPCommand
+	failOn   string
+}
+
+func newENITestFixture(t *testing.T) *eniTestFixture {
+	t.Helper()
+	f := &eniTestFixture{d: createVPCTestDaemon(t), plumber: &MockNetworkPlumber{}}
+	f.d.networkPlumber = f.plumber
+
+	vpc, err := f.d.vpcService.CreateVpc(&ec2.CreateVpcInput{CidrBlock: aws.String("10.0.0.0/16")}, eniTestAccountID)
+	require.NoError(t, err)
+	subnet, err := f.d.vpcService.CreateSubnet(&ec2.CreateSubnetInput{
+		VpcId: vpc.Vpc.VpcId, CidrBlock: aws.String("10.0.1.0/24"),
+	}, eniTestAccountID)
+	require.NoError(t, err)
+	f.subnetID = *subnet.Subnet.SubnetId
+	f.d.config.AZ = aws.StringValue(subnet.Subnet.AvailabilityZone)
+
+	qmpClient, cancel := newMockQMPClient(t, func(cmd qmp.QMPCommand) map[string]any {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.commands = append(f.commands, cmd)
+		if cmd.Execute == f.failOn {
+			return map[string]any{"error": map[string]any{"class": "GenericError", "desc": "simulated failure"}}
+		}
+		return map[string]any{"return": map[string]any{}}
+	})
+	t.Cleanup(cancel)
+
+	f.instance = &vm.VM{
+		ID: "i-eni", AccountID: eniTestAccountID, Status: vm.StateRunning, QMPClient: qmpClient,
+		ENIId: f.createENI(t), Instance: &ec2.Instance{},
+	}
+	f.d.Instances = vm.Instances{VMS: map[string]*vm.VM{f.instance.ID: f.instance}}
+	return f
+}
+
+func (f *eniTestFixture) createENI(t *testing.T) string {
+	t.Helper()
+	out, err := f.d.vpcService.CreateNetworkInterface(&ec2.CreateNetworkInterfaceInput{SubnetId: aws.String(f.subnetID)}, eniTestAccountID)
+	require.NoError(t, err)
+	return *out.NetworkInterface.NetworkInterfaceId
+}
+
+// send runs a command through handler and returns the reply.
+func (f *eniTestFixture) send(t *testing.T, cmd types.EC2InstanceCommand, handler func(*nats.Msg, types.EC2InstanceCommand, *vm.VM)) []byte {
+	t.Helper()
+	subject := "test.eni." + f.instance.ID
+	sub, err := f.d.natsConn.Subscribe(subject, func(msg *nats.Msg) { handler(msg, cmd, f.instance) })
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	req := nats.NewMsg(subject)
+	req.Data, _ = json.Marshal(cmd)
+	req.Header.Set(utils.AccountIDHeader, eniTestAccountID)
+	reply, err := f.d.natsConn.RequestMsg(req, 5*time.Second)
+	require.NoError(t, err)
+	return reply.Data
+}
+
+func (f *eniTestFixture) attach(t *testing.T, eniID string, deviceIndex int64) []byte {
+	t.Helper()
+	return f.send(t, types.EC2InstanceCommand{
+		ID: f.instance.ID, Attributes: types.EC2CommandAttributes{AttachENI: true},
+		AttachENIData: &types.AttachENIData{NetworkInterfaceID: eniID, DeviceIndex: deviceIndex},
+	}, f.d.handleAttachENI)
+}
+
+func (f *eniTestFixture) detach(t *testing.T, eniID, attachmentID string) []byte {
+	t.Helper()
+	return f.send(t, types.EC2InstanceCommand{
+		ID: f.instance.ID, Attributes: types.EC2CommandAttributes{DetachENI: true},
+		DetachENIData: &types.DetachENIData{NetworkInterfaceID: eniID, AttachmentID: attachmentID},
+	}, f.d.handleDetachENI)
+}
+
+func (f *eniTestFixture) modify(t *testing.T, eniID, attachmentID string, deleteOnTermination bool) []byte {
+	t.Helper()
+	return f.send(t, types.EC2InstanceCommand{
+		ID: f.instance.ID, Attributes: types.EC2CommandAttributes{ModifyENI: true},
+		ModifyENIData: &types.ModifyENIData{NetworkInterfaceID: eniID, AttachmentID: attachmentID, DeleteOnTermination: deleteOnTermination},
+	}, f.d.handleModifyENI)
+}
+
+func (f *eniTestFixture) executed() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var names []string
+	for _, cmd := range f.commands {
+		names = append(names, cmd.Execute)
+	}
+	f.commands = nil
+	return names
+}
+
+func (f *eniTestFixture) eniStatus(t *testing.T, eniID string) string {
+	t.Helper()
+	out, err := f.d.vpcService.DescribeNetworkInterfaces(&ec2.DescribeNetworkInterfacesInput{
+		NetworkInterfaceIds: []*string{aws.String(eniID)},
+	}, eniTestAccountID)
+	require.NoError(t, err)
+	return aws.StringValue(out.NetworkInterfaces[0].Status)
+}
+
+func TestHandleAttachDetachENI(t *testing.T) {
+	f := newENITestFixture(t)
+	eniID := f.createENI(t)
+
+	reply := f.attach(t, eniID, 1)
+	var out ec2.AttachNetworkInterfaceOutput
+	require.NoError(t, json.Unmarshal(reply, &out), string(reply))
+	attachmentID := aws.StringValue(out.AttachmentId)
+	assert.Regexp(t, `^eni-attach-`, attachmentID)
+
+	assert.Equal(t, []string{"netdev_add", "device_add"}, f.executed())
+	require.Len(t, f.plumber.SetupCalls, 1)
+	assert.Equal(t, eniID, f.plumber.SetupCalls[0].ENIId)
+	assert.Equal(t, "in-use", f.eniStatus(t, eniID))
+	require.Len(t, f.instance.ExtraENIs, 1)
+	assert.Equal(t, vm.ExtraENI{
+		ENIID: eniID, ENIMac: f.instance.ExtraENIs[0].ENIMac, ENIIP: f.instance.ExtraENIs[0].ENIIP,
+		SubnetID: f.subnetID, DeviceIndex: 1, AttachmentID: attachmentID,
+	}, f.instance.ExtraENIs[0])
+	require.Len(t, f.instance.Instance.NetworkInterfaces, 1)
+	assert.Equal(t, attachmentID, aws.StringValue(f.instance.Instance.NetworkInterfaces[0].Attachment.AttachmentId))
+
+	// The same interface twice, or another one at a taken index
+	assert.Contains(t, string(f.attach(t, eniID, 2)), awserrors.ErrorInvalidNetworkInterfaceInUse)
+	other := f.createENI(t)
+	assert.Contains(t, string(f.attach(t, other, 1)), awserrors.ErrorInvalidParameterValue)
+	assert.Empty(t, f.executed())
+
+	// The primary interface stays, and attachments must match
+	assert.Contains(t, string(f.detach(t, f.instance.ENIId, "")), awserrors.ErrorOperationNotPermitted)
+	assert.Contains(t, string(f.detach(t, eniID, "eni-attach-other")), awserrors.ErrorInvalidAttachmentIDNotFound)
+
+	assert.Equal(t, `{}`, string(f.detach(t, eniID, attachmentID)))
+	assert.Equal(t, []string{"device_del", "netdev_del"}, f.executed())
+	assert.Equal(t, []string{eniID}, f.plumber.CleanupCalls)
+	assert.Equal(t, "available", f.eniStatus(t, eniID))
+	assert.Empty(t, f.instance.ExtraENIs)
+	assert.Empty(t, f.instance.Instance.NetworkInterfaces)
+}
+
+func TestHandleAttachENI_DeviceAddFailureRollsBack(t *testing.T) {
+	f := newENITestFixture(t)
+	eniID := f.createENI(t)
+	f.failOn = "device_add"
+
+	assert.Contains(t, string(f.attach(t, eniID, 1)), awserrors.ErrorServerInternal)
+	assert.Equal(t, []string{"netdev_add", "device_add", "netdev_del"}, f.executed())
+	assert.Equal(t, []string{eniID}, f.plumber.CleanupCalls)
+	assert.Equal(t, "available", f.eniStatus(t, eniID))
+	assert.Empty(t, f.instance.ExtraENIs)
+}
+
+func TestHandleAttachDetachENI_MetadataFirewall(t *testing.T) {
+	f := newENITestFixture(t)
+	fw := &MockMetadataFirewall{}
+	f.d.metadataFirewall = fw
+	setMetadataOptions(f.instance.Instance, &types.MetadataOptionsData{HttpEndpoint: ec2.InstanceMetadataEndpointStateDisabled})
+	eniID := f.createENI(t)
+	tap := TapDeviceName(eniID)
+
+	reply := f.attach(t, eniID, 1)
+	var out ec2.AttachNetworkInterfaceOutput
+	require.NoError(t, json.Unmarshal(reply, &out), string(reply))
+	assert.Equal(t, []string{tap}, fw.Blocked)
+	assert.Equal(t, []string{"netdev_add", "device_add"}, f.executed())
+
+	// Detaching removes the tap's firewall table with the tap.
+	assert.Equal(t, `{}`, string(f.detach(t, eniID, aws.StringValue(out.AttachmentId))))
+	assert.Equal(t, []string{tap}, fw.Allowed)
+}
+
+func TestHandleAttachENI_MetadataFirewallFailure(t *testing.T) {
+	f := newENITestFixture(t)
+	f.d.metadataFirewall = &MockMetadataFirewall{BlockErr: assert.AnError}
+	setMetadataOptions(f.instance.Instance, &types.MetadataOptionsData{HttpEndpoint: ec2.InstanceMetadataEndpointStateDisabled})
+	eniID := f.createENI(t)
+
+	// The guest never gets the interface.
+	assert.Contains(t, string(f.attach(t, eniID, 1)), awserrors.ErrorServerInternal)
+	assert.Empty(t, f.executed())
+	assert.Equal(t, []string{eniID}, f.plumber.CleanupCalls)
+	assert.Equal(t, "available", f.eniStatus(t, eniID))
+	assert.Empty(t, f.instance.ExtraENIs)
+}
+
+func TestHandleAttachENI_NonVPCInstance(t *testing.T) {
+	f := newENITestFixture(t)
+	eniID := f.createENI(t)
+	f.instance.ENIId = ""
+
+	assert.Contains(t, string(f.attach(t, eniID, 1)), awserrors.ErrorInvalidParameterCombination)
+	assert.Empty(t, f.plumber.SetupCalls)
+}
+
+func TestHandleModifyENI(t *testing.T) {
+	f := newENITestFixture(t)
+	eniID := f.createENI(t)
+	kept := f.createENI(t)
+
+	var out ec2.AttachNetworkInterfaceOutput
+	require.NoError(t, json.Unmarshal(f.attach(t, eniID, 1), &out))
+	attachmentID := aws.StringValue(out.AttachmentId)
+	require.NoError(t, json.Unmarshal(f.attach(t, kept, 2), &out))
+	f.executed()
+
+	assert.Contains(t, string(f.modify(t, f.instance.ENIId, "", true)), awserrors.ErrorInvalidParameterValue)
+	assert.Contains(t, string(f.modify(t, f.instance.ENIId, "eni-attach-primary", true)), awserrors.ErrorOperationNotPermitted)
+	assert.Contains(t, string(f.modify(t, eniID, "eni-attach-other", true)), awserrors.ErrorInvalidAttachmentIDNotFound)
+
+	assert.Equal(t, `{}`, string(f.modify(t, eniID, attachmentID, true)))
+	assert.Empty(t, f.executed(), "no device changes")
+	assert.True(t, extraENIByID(f.instance, eniID).DeleteOnTermination)
+	assert.True(t, aws.BoolValue(f.instance.Instance.NetworkInterfaces[0].Attachment.DeleteOnTermination))
+
+	// On termination the interface set to be deleted goes, the other is
+	// left available.
+	f.d.detachAttachedENIs(f.instance)
+	_, err := f.d.vpcService.DescribeNetworkInterfaces(&ec2.DescribeNetworkInterfacesInput{
+		NetworkInterfaceIds: []*string{aws.String(eniID)},
+	}, eniTestAccountID)
+	assert.ErrorContains(t, err, awserrors.ErrorInvalidNetworkInterfaceIDNotFound)
+	assert.Equal(t, "available", f.eniStatus(t, kept))
+}
@@ -2,10 +2,13 @@ package daemon
 
 import (
 	"log/slog"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
 	handlers_ec2_image "github.com/mulgadc/spinifex/spinifex/handlers/ec2/image"
+	"github.com/mulgadc/spinifex/spinifex/qmp"
 	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/mulgadc/spinifex/spinifex/vm"
 	"github.com/nats-io/nats.go"
@@ -46,9 +49,7 @@ func (d *Daemon) handleEC2CreateImage(msg *nats.Msg) {
 
 	input := &ec2.CreateImageInput{}
 	if errResp := utils.UnmarshalJsonPayload(input, msg.Data); errResp != nil {
-		if err := msg.Respond(errResp); err != nil {
-			slog.Error("Failed to respond to NATS request", "err", err)
-		}
+		respondWithError(msg, awserrors.ErrorValidationError)
 		return
 	}
 
@@ -62,25 +63,20 @@ func (d *Daemon) handleEC2CreateImage(msg *nats.Msg) {
 	instanceID := *input.InstanceId
 
 	// Extract all instance context in a single critical section
-	d.Instances.Mu.Lock()
-	instance, ok := d.Instances.VMS[instanceID]
+	var instance *vm.VM
 	var status vm.InstanceState
-	var rootVolumeID, sourceImageID string
-	if ok {
+	var rootVolumeID, rootDeviceName, sourceImageID, agentSocket string
+	ok := d.Instances.WithVM(instanceID, func(v *vm.VM) {
+		instance = v
 		status = instance.Status
+		agentSocket = instance.Config.GuestAgentSocket
 		if instance.Instance != nil {
-			for _, bdm := range instance.Instance.BlockDeviceMappings {
-				if bdm.Ebs != nil && bdm.Ebs.VolumeId != nil {
-					rootVolumeID = *bdm.Ebs.VolumeId
-					break
-				}
-			}
+			rootVolumeID, rootDeviceName = rootBlockDevice(instance.Instance)
 			if instance.Instance.ImageId != nil {
 				sourceImageID = *instance.Instance.ImageId
 			}
 		}
-	}
-	d.Instances.Mu.Unlock()
+	})
 
 	if !ok {
 		slog.Warn("CreateImage: instance not found", "instanceId", instanceID)
@@ -105,11 +101,26 @@ func (d *Daemon) handleEC2CreateImage(msg *nats.Msg) {
 		return
 	}
 
+	// Two builds at once would race on the guest freeze
+	if _, busy := d.imageBuilds.LoadOrStore(instanceID, struct{}{}); busy {
+		slog.Warn("CreateImage: another image of the instance is in progress", "instanceId", instanceID)
+		respondWithError(msg, awserrors.ErrorConcurrentCreateImageNoRebootLimitExceeded)
+		return
+	}
+	defer d.imageBuilds.Delete(instanceID)
+
 	params := handlers_ec2_image.CreateImageParams{
-		Input:         input,
-		RootVolumeID:  rootVolumeID,
-		SourceImageID: sourceImageID,
-		IsRunning:     status == vm.StateRunning,
+		Input:          input,
+		RootVolumeID:   rootVolumeID,
+		RootDeviceName: rootDeviceName,
+		SourceImageID:  sourceImageID,
+		IsRunning:      status == vm.StateRunning,
+	}
+	// NoReboot leaves the guest untouched, so the image is crash-consistent
+	if params.IsRunning && !aws.BoolValue(input.NoReboot) && agentSocket != "" {
+		params.Quiesce = func() func() {
+			return d.freezeGuestFilesystems(instanceID, agentSocket)
+		}
 	}
 
 	output, err := d.imageService.CreateImageFromInstance(params, accountID)
@@ -122,3 +133,53 @@ func (d *Daemon) handleEC2CreateImage(msg *nats.Msg) {
 	respondWithJSON(msg, output)
 	slog.Info("CreateImage completed", "instanceId", instanceID, "imageId", *output.ImageId)
 }
+
+// rootBlockDevice returns the volume and device name of the instance's root
+// volume: the mapping for RootDeviceName, or else the first EBS mapping.
+func rootBlockDevice(instance *ec2.Instance) (volumeID, deviceName string) {
+	for _, bdm := range instance.BlockDeviceMappings {
+		if bdm.Ebs == nil || bdm.Ebs.VolumeId == nil {
+			continue
+		}
+		if volumeID == "" {
+			volumeID, deviceName = *bdm.Ebs.VolumeId, aws.StringValue(bdm.DeviceName)
+		}
+		if instance.RootDeviceName != nil && aws.StringValue(bdm.DeviceName) == *instance.RootDeviceName {
+			return *bdm.Ebs.VolumeId, *instance.RootDeviceName
+		}
+	}
+	return volumeID, deviceName
+}
+
+// guestFreezeTimeout bounds a guest filesystem freeze or thaw, which flushes
+// dirty pages first and so can take longer than a guest-sync.
+var guestFreezeTimeout = 30 * time.Second
+
+// guestThawAttempts is how many times a thaw is tried before the guest is
+// left frozen and the failure logged for an operator.
+const guestThawAttempts = 3
+
+// freezeGuestFilesystems asks the instance's guest agent to flush and freeze
+// its filesystems so a live snapshot of them is consistent. It returns the
+// thaw to run once the snapshot is taken, or nil when the agent didn't
+// freeze anything, in which case the snapshot is only crash-consistent.
+func (d *Daemon) freezeGuestFilesystems(instanceID, socket string) func() {
+	frozen, err := qmp.GuestFsFreeze(socket, utils.Now().UnixNano(), guestFreezeTimeout)
+	if err != nil {
+		// A failed freeze thaws whatever it froze before it gave up
+		slog.Warn("CreateImage: guest agent did not freeze filesystems, image will be crash-consistent", "instanceId", instanceID, "err", err)
+		return nil
+	}
+	slog.Info("CreateImage: froze guest filesystems", "instanceId", instanceID, "filesystems", frozen)
+	return func() {
+		var err error
+		for range guestThawAttempts {
+			var thawed int
+			if thawed, err = qmp.GuestFsThaw(socket, utils.Now().UnixNano(), guestFreezeTimeout); err == nil {
+				slog.Info("CreateImage: thawed guest filesystems", "instanceId", instanceID, "filesystems", thawed)
+				return
+			}
+		}
+		slog.Error("CreateImage: failed to thaw guest filesystems, guest writes are blocked", "instanceId", instanceID, "err", err)
+	}
+}
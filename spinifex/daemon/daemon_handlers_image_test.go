@@ -0,0 +1,126 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/qmp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveFreezingGuestAgent answers guest-sync and the fsfreeze commands on a
+// unix socket like the QEMU guest agent, failing freezes when freezeFails is
+// set, and records the fsfreeze commands it ran.
+func serveFreezingGuestAgent(t *testing.T, freezeFails bool) (string, func() []string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "qga.sock")
+	ln, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	var mu sync.Mutex
+	var ran []string
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				decoder := json.NewDecoder(conn)
+				encoder := json.NewEncoder(conn)
+				for {
+					var cmd qmp.QMPCommand
+					if err := decoder.Decode(&cmd); err != nil {
+						return
+					}
+					reply := map[string]any{"return": 1}
+					switch cmd.Execute {
+					case "guest-sync":
+						reply["return"] = cmd.Arguments["id"]
+					case "guest-fsfreeze-freeze":
+						if freezeFails {
+							reply = map[string]any{"error": map[string]any{"class": "GenericError", "desc": "freeze failed"}}
+						}
+						fallthrough
+					default:
+						mu.Lock()
+						ran = append(ran, cmd.Execute)
+						mu.Unlock()
+					}
+					_ = encoder.Encode(reply)
+				}
+			}()
+		}
+	}()
+	return path, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), ran...)
+	}
+}
+
+func TestFreezeGuestFilesystems(t *testing.T) {
+	d := &Daemon{}
+
+	t.Run("freezes and thaws", func(t *testing.T) {
+		socket, ran := serveFreezingGuestAgent(t, false)
+		thaw := d.freezeGuestFilesystems("i-freeze", socket)
+		require.NotNil(t, thaw)
+		assert.Equal(t, []string{"guest-fsfreeze-freeze"}, ran())
+		thaw()
+		assert.Equal(t, []string{"guest-fsfreeze-freeze", "guest-fsfreeze-thaw"}, ran())
+	})
+
+	t.Run("freeze refused", func(t *testing.T) {
+		socket, ran := serveFreezingGuestAgent(t, true)
+		assert.Nil(t, d.freezeGuestFilesystems("i-freeze", socket))
+		assert.Equal(t, []string{"guest-fsfreeze-freeze"}, ran())
+	})
+
+	t.Run("no agent", func(t *testing.T) {
+		orig := guestFreezeTimeout
+		guestFreezeTimeout = 100 * time.Millisecond
+		t.Cleanup(func() { guestFreezeTimeout = orig })
+		assert.Nil(t, d.freezeGuestFilesystems("i-freeze", filepath.Join(t.TempDir(), "missing.sock")))
+	})
+}
+
+func TestRootBlockDevice(t *testing.T) {
+	mapping := func(device, volumeID string) *ec2.InstanceBlockDeviceMapping {
+		return &ec2.InstanceBlockDeviceMapping{
+			DeviceName: aws.String(device),
+			Ebs:        &ec2.EbsInstanceBlockDevice{VolumeId: aws.String(volumeID)},
+		}
+	}
+
+	instance := &ec2.Instance{
+		RootDeviceName: aws.String("/dev/vda"),
+		BlockDeviceMappings: []*ec2.InstanceBlockDeviceMapping{
+			{DeviceName: aws.String("/dev/sdb")},
+			mapping("/dev/sdc", "vol-data"),
+			mapping("/dev/vda", "vol-root"),
+		},
+	}
+	volumeID, device := rootBlockDevice(instance)
+	assert.Equal(t, "vol-root", volumeID)
+	assert.Equal(t, "/dev/vda", device)
+
+	// Without a RootDeviceName the first EBS mapping is the root
+	instance.RootDeviceName = nil
+	volumeID, device = rootBlockDevice(instance)
+	assert.Equal(t, "vol-data", volumeID)
+	assert.Equal(t, "/dev/sdc", device)
+
+	volumeID, device = rootBlockDevice(&ec2.Instance{})
+	assert.Empty(t, volumeID)
+	assert.Empty(t, device)
+}
@@ -1,9 +1,10 @@
 package daemon
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"log/slog"
 	"strings"
 	"time"
@@ -13,22 +14,31 @@ import (
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
 	"github.com/mulgadc/spinifex/spinifex/filterutil"
 	handlers_ec2_placementgroup "github.com/mulgadc/spinifex/spinifex/handlers/ec2/placementgroup"
-	"github.com/mulgadc/spinifex/spinifex/qmp"
+	"github.com/mulgadc/spinifex/spinifex/pagination"
+	"github.com/mulgadc/spinifex/spinifex/quota"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/tracing"
 	"github.com/mulgadc/spinifex/spinifex/types"
 	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/mulgadc/spinifex/spinifex/vm"
 	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // handleEC2RunInstances processes incoming EC2 RunInstances requests
 func (d *Daemon) handleEC2RunInstances(msg *nats.Msg) {
-	slog.Debug("Received message on subject", "subject", msg.Subject)
-	slog.Debug("Message data", "data", string(msg.Data))
+	logger := requestLogger(msg)
+	logger.Debug("Received message on subject", "subject", msg.Subject)
+	logger.Debug("Message data", "data", string(msg.Data))
+
+	ctx, span := tracing.Start(tracing.Extract(context.Background(), msg), "daemon.RunInstances",
+		attribute.String("spinifex.node", d.node))
+	defer span.End()
 
 	// Extract account ID from NATS header
 	accountID := utils.AccountIDFromMsg(msg)
 	if accountID == "" {
-		slog.Error("handleEC2RunInstances: missing account ID in NATS header")
+		logger.Error("handleEC2RunInstances: missing account ID in NATS header")
 		respondWithError(msg, awserrors.ErrorServerInternal)
 		return
 	}
@@ -38,37 +48,44 @@ func (d *Daemon) handleEC2RunInstances(msg *nats.Msg) {
 	errResp := utils.UnmarshalJsonPayload(runInstancesInput, msg.Data)
 
 	if errResp != nil {
-		if err := msg.Respond(errResp); err != nil {
-			slog.Error("Failed to respond to NATS request", "err", err)
-		}
-		slog.Error("Request does not match RunInstancesInput")
+		respondWithError(msg, awserrors.ErrorValidationError)
+		logger.Error("Request does not match RunInstancesInput")
 		return
 	}
 
-	slog.Info("Processing RunInstances request for instance type", "instanceType", *runInstancesInput.InstanceType)
+	logger.Info("Processing RunInstances request for instance type", "instanceType", *runInstancesInput.InstanceType)
 
 	// Check if instance type is supported
 	instanceType, exists := d.resourceMgr.instanceTypes[*runInstancesInput.InstanceType]
 	if !exists {
-		slog.Error("handleEC2RunInstances instance lookup", "err", awserrors.ErrorInvalidInstanceType, "InstanceType", *runInstancesInput.InstanceType)
+		logger.Error("handleEC2RunInstances instance lookup", "err", awserrors.ErrorInvalidInstanceType, "InstanceType", *runInstancesInput.InstanceType)
 		respondWithError(msg, awserrors.ErrorInvalidInstanceType)
 		return
 	}
 
+	// Apply configured default tags to the instance and its root volume
+	tagSpecs, err := utils.WithDefaultTags(runInstancesInput.TagSpecifications, d.config.Daemon.DefaultTagsFor(accountID), "instance", "volume")
+	if err != nil {
+		logger.Error("handleEC2RunInstances default tags", "err", err)
+		respondWithError(msg, err.Error())
+		return
+	}
+	runInstancesInput.TagSpecifications = tagSpecs
+
 	// Validate AMI exists before allocating resources
 	if runInstancesInput.ImageId == nil || *runInstancesInput.ImageId == "" {
-		slog.Error("handleEC2RunInstances missing ImageId")
+		logger.Error("handleEC2RunInstances missing ImageId")
 		respondWithError(msg, awserrors.ErrorMissingParameter)
 		return
 	}
 	if d.imageService == nil {
-		slog.Error("handleEC2RunInstances image service not initialized")
+		logger.Error("handleEC2RunInstances image service not initialized")
 		respondWithError(msg, awserrors.ErrorServerInternal)
 		return
 	}
 	amiMeta, err := d.imageService.GetAMIConfig(*runInstancesInput.ImageId)
 	if err != nil {
-		slog.Error("handleEC2RunInstances AMI not found", "imageId", *runInstancesInput.ImageId, "err", err)
+		logger.Error("handleEC2RunInstances AMI not found", "imageId", *runInstancesInput.ImageId, "err", err)
 		respondWithError(msg, awserrors.ErrorInvalidAMIIDNotFound)
 		return
 	}
@@ -77,7 +94,7 @@ func (d *Daemon) handleEC2RunInstances(msg *nats.Msg) {
 	amiOwner := amiMeta.ImageOwnerAlias
 	if amiOwner != "" && amiOwner != accountID {
 		if utils.IsAccountID(amiOwner) {
-			slog.Warn("handleEC2RunInstances AMI not owned by caller", "imageId", *runInstancesInput.ImageId, "amiOwner", amiOwner, "accountID", accountID)
+			logger.Warn("handleEC2RunInstances AMI not owned by caller", "imageId", *runInstancesInput.ImageId, "amiOwner", amiOwner, "accountID", accountID)
 			respondWithError(msg, awserrors.ErrorInvalidAMIIDNotFound)
 			return
 		}
@@ -86,23 +103,39 @@ func (d *Daemon) handleEC2RunInstances(msg *nats.Msg) {
 	// Validate key pair exists (if specified)
 	if runInstancesInput.KeyName != nil && *runInstancesInput.KeyName != "" {
 		if err := d.keyService.ValidateKeyPairExists(accountID, *runInstancesInput.KeyName); err != nil {
-			slog.Error("handleEC2RunInstances key pair not found", "keyName", *runInstancesInput.KeyName, "err", err)
+			logger.Error("handleEC2RunInstances key pair not found", "keyName", *runInstancesInput.KeyName, "err", err)
 			respondWithError(msg, awserrors.ErrorInvalidKeyPairNotFound)
 			return
 		}
 	}
 
+	// Validate this node can back the requested root volume type
+	if errCode := rootVolumeTypeError(d.config, runInstancesInput); errCode != "" {
+		respondWithError(msg, errCode)
+		return
+	}
+
 	// Determine how many instances to launch based on MinCount/MaxCount
 	minCount := int(*runInstancesInput.MinCount)
 	maxCount := int(*runInstancesInput.MaxCount)
 
+	// Launch no more than the account's instance and vCPU quotas allow
+	quotaCount, quotaErr := d.launchableByQuota(accountID, instanceType, maxCount)
+	if quotaErr != nil && quotaCount < minCount {
+		logger.Warn("handleEC2RunInstances account quota reached", "accountID", accountID, "requested", minCount, "allowed", quotaCount, "err", quotaErr)
+		respondWithServiceError(msg, quotaErr)
+		return
+	}
+	maxCount = quotaCount
+
 	// Check how many we can actually launch
 	allocatableCount := d.resourceMgr.canAllocate(instanceType, maxCount)
 
 	if allocatableCount < minCount {
 		// Cannot satisfy MinCount requirement - fail entirely
-		slog.Error("handleEC2RunInstances insufficient capacity", "requested", minCount, "available", allocatableCount, "InstanceType", *runInstancesInput.InstanceType)
-		respondWithError(msg, awserrors.ErrorInsufficientInstanceCapacity)
+		err := d.resourceMgr.shortfall(instanceType, minCount)
+		logger.Error("handleEC2RunInstances insufficient capacity", "requested", minCount, "available", allocatableCount, "InstanceType", *runInstancesInput.InstanceType, "err", err)
+		respondWithCapacityError(msg, err)
 		return
 	}
 
@@ -110,13 +143,14 @@ func (d *Daemon) handleEC2RunInstances(msg *nats.Msg) {
 	// Note: canAllocate() already caps at maxCount, so allocatableCount <= maxCount
 	launchCount := allocatableCount
 
-	slog.Info("Instance count determined", "min", minCount, "max", maxCount, "launching", launchCount)
+	logger.Info("Instance count determined", "min", minCount, "max", maxCount, "launching", launchCount)
 
 	// Allocate resources for all instances upfront
 	var allocatedCount int
+	var allocErr error
 	for i := 0; i < launchCount; i++ {
-		if err := d.resourceMgr.allocate(instanceType); err != nil {
-			slog.Error("handleEC2RunInstances allocate failed mid-allocation", "allocated", allocatedCount, "err", err)
+		if allocErr = d.resourceMgr.allocate(instanceType); allocErr != nil {
+			logger.Error("handleEC2RunInstances allocate failed mid-allocation", "allocated", allocatedCount, "err", allocErr)
 			break
 		}
 		allocatedCount++
@@ -128,8 +162,8 @@ func (d *Daemon) handleEC2RunInstances(msg *nats.Msg) {
 		for i := 0; i < allocatedCount; i++ {
 			d.resourceMgr.deallocate(instanceType)
 		}
-		slog.Error("handleEC2RunInstances insufficient capacity after allocation", "allocated", allocatedCount, "minCount", minCount)
-		respondWithError(msg, awserrors.ErrorInsufficientInstanceCapacity)
+		logger.Error("handleEC2RunInstances insufficient capacity after allocation", "allocated", allocatedCount, "minCount", minCount)
+		respondWithCapacityError(msg, allocErr)
 		return
 	}
 
@@ -141,7 +175,7 @@ func (d *Daemon) handleEC2RunInstances(msg *nats.Msg) {
 	if instanceType.InstanceType != nil {
 		instanceTypeName = *instanceType.InstanceType
 	}
-	slog.Info("Launching EC2 instances", "instanceType", instanceTypeName, "count", launchCount)
+	logger.Info("Launching EC2 instances", "instanceType", instanceTypeName, "count", launchCount)
 
 	// Create all instances
 	var instances []*vm.VM
@@ -151,7 +185,7 @@ func (d *Daemon) handleEC2RunInstances(msg *nats.Msg) {
 	for i := 0; i < launchCount; i++ {
 		instance, ec2Instance, err := d.instanceService.RunInstance(runInstancesInput)
 		if err != nil {
-			slog.Error("handleEC2RunInstances service.RunInstance failed", "index", i, "err", err)
+			logger.Error("handleEC2RunInstances service.RunInstance failed", "index", i, "err", err)
 			lastRunErr = err
 			// Deallocate this instance's resources
 			d.resourceMgr.deallocate(instanceType)
@@ -177,7 +211,7 @@ func (d *Daemon) handleEC2RunInstances(msg *nats.Msg) {
 			defaultSubnet, dsErr := d.vpcService.GetDefaultSubnet(accountID)
 			if dsErr == nil {
 				runInstancesInput.SubnetId = aws.String(defaultSubnet.SubnetId)
-				slog.Info("Resolved default subnet for instance", "instanceId", instance.ID, "subnetId", defaultSubnet.SubnetId)
+				logger.Info("Resolved default subnet for instance", "instanceId", instance.ID, "subnetId", defaultSubnet.SubnetId)
 			}
 		}
 
@@ -188,7 +222,7 @@ func (d *Daemon) handleEC2RunInstances(msg *nats.Msg) {
 				Description: aws.String("Primary network interface for " + instance.ID),
 			}, accountID)
 			if eniErr != nil {
-				slog.Error("handleEC2RunInstances auto-create ENI failed", "instanceId", instance.ID, "subnetId", *runInstancesInput.SubnetId, "err", eniErr)
+				logger.Error("handleEC2RunInstances auto-create ENI failed", "instanceId", instance.ID, "subnetId", *runInstancesInput.SubnetId, "err", eniErr)
 				lastRunErr = eniErr
 				d.resourceMgr.deallocate(instanceType)
 				continue
@@ -201,15 +235,17 @@ func (d *Daemon) handleEC2RunInstances(msg *nats.Msg) {
 			// Mark ENI as attached to this instance so attachment.instance-id
 			// filter works (used by ELBv2 RegisterTargets to resolve target IPs).
 			if _, attachErr := d.vpcService.AttachENI(accountID, instance.ENIId, instance.ID, 0); attachErr != nil {
-				slog.Error("Failed to attach ENI to instance record — ELBv2 target IP resolution will fail", "eniId", instance.ENIId, "instanceId", instance.ID, "err", attachErr)
+				logger.Error("Failed to attach ENI to instance record — ELBv2 target IP resolution will fail", "eniId", instance.ENIId, "instanceId", instance.ID, "err", attachErr)
 			}
 			ec2Instance.SetPrivateIpAddress(*eni.PrivateIpAddress)
+			ec2Instance.PrivateDnsName = eni.PrivateDnsName
 			ec2Instance.SetSubnetId(*runInstancesInput.SubnetId)
 			ec2Instance.SetVpcId(*eni.VpcId)
 			ec2Instance.NetworkInterfaces = []*ec2.InstanceNetworkInterface{
 				{
 					NetworkInterfaceId: eni.NetworkInterfaceId,
 					PrivateIpAddress:   eni.PrivateIpAddress,
+					PrivateDnsName:     eni.PrivateDnsName,
 					MacAddress:         eni.MacAddress,
 					SubnetId:           runInstancesInput.SubnetId,
 					VpcId:              eni.VpcId,
@@ -221,7 +257,7 @@ func (d *Daemon) handleEC2RunInstances(msg *nats.Msg) {
 				},
 			}
 
-			slog.Info("Auto-created ENI for VPC instance",
+			logger.Info("Auto-created ENI for VPC instance",
 				"instanceId", instance.ID,
 				"eniId", instance.ENIId,
 				"privateIp", *eni.PrivateIpAddress,
@@ -240,11 +276,11 @@ func (d *Daemon) handleEC2RunInstances(msg *nats.Msg) {
 					}
 					publicIP, poolName, allocErr := d.externalIPAM.AllocateIP(region, az, "auto_assign", "", *eni.NetworkInterfaceId, instance.ID)
 					if allocErr != nil {
-						slog.Warn("Failed to allocate public IP for instance", "instanceId", instance.ID, "err", allocErr)
+						logger.Warn("Failed to allocate public IP for instance", "instanceId", instance.ID, "err", allocErr)
 					} else {
 						// Update ENI record with public IP
 						if updateErr := d.vpcService.UpdateENIPublicIP(accountID, *eni.NetworkInterfaceId, publicIP, poolName); updateErr != nil {
-							slog.Warn("Failed to update ENI with public IP", "eniId", *eni.NetworkInterfaceId, "err", updateErr)
+							logger.Warn("Failed to update ENI with public IP", "eniId", *eni.NetworkInterfaceId, "err", updateErr)
 						}
 						// Publish vpc.add-nat for dnat_and_snat rule
 						portName := "port-" + *eni.NetworkInterfaceId
@@ -253,7 +289,7 @@ func (d *Daemon) handleEC2RunInstances(msg *nats.Msg) {
 						ec2Instance.PublicIpAddress = aws.String(publicIP)
 						instance.PublicIP = publicIP
 						instance.PublicIPPool = poolName
-						slog.Info("Auto-assigned public IP",
+						logger.Info("Auto-assigned public IP",
 							"instanceId", instance.ID,
 							"publicIp", publicIP,
 							"privateIp", *eni.PrivateIpAddress,
@@ -282,7 +318,7 @@ func (d *Daemon) handleEC2RunInstances(msg *nats.Msg) {
 				errCode = lastRunErr.Error()
 			}
 		}
-		slog.Error("handleEC2RunInstances failed to create minimum instances", "created", len(instances), "minCount", minCount, "err", errCode)
+		logger.Error("handleEC2RunInstances failed to create minimum instances", "created", len(instances), "minCount", minCount, "err", errCode)
 		respondWithError(msg, errCode)
 		return
 	}
@@ -306,7 +342,7 @@ func (d *Daemon) handleEC2RunInstances(msg *nats.Msg) {
 	// Respond to NATS immediately with reservation (instances are provisioning)
 	jsonResponse, err := json.Marshal(reservation)
 	if err != nil {
-		slog.Error("handleEC2RunInstances failed to marshal reservation", "err", err)
+		logger.Error("handleEC2RunInstances failed to marshal reservation", "err", err)
 		respondWithError(msg, awserrors.ErrorServerInternal)
 		// Deallocate all resources
 		for range instances {
@@ -314,32 +350,30 @@ func (d *Daemon) handleEC2RunInstances(msg *nats.Msg) {
 		}
 		return
 	}
-	if err := msg.Respond(jsonResponse); err != nil {
-		slog.Error("Failed to respond to NATS request", "err", err)
+	if err := utils.Respond(msg, awserrors.Reply{Result: jsonResponse}); err != nil {
+		logger.Error("Failed to respond to NATS request", "err", err)
 	}
 
 	// Add all instances to state immediately so DescribeInstances can find them
 	// while volumes are being prepared and VMs are launching
-	d.Instances.Mu.Lock()
 	for _, instance := range instances {
-		d.Instances.VMS[instance.ID] = instance
+		d.Instances.UpsertVM(instance)
 	}
-	d.Instances.Mu.Unlock()
 
 	if err := d.WriteState(); err != nil {
-		slog.Error("handleEC2RunInstances failed to write initial state", "err", err)
+		logger.Error("handleEC2RunInstances failed to write initial state", "err", err)
 	}
 
-	slog.Info("Instances added to state with pending status", "count", len(instances))
+	logger.Info("Instances added to state with pending status", "count", len(instances))
 
 	// Subscribe to per-instance NATS topics early so terminate/stop commands
 	// can reach this daemon while volumes are being prepared. LaunchInstance
 	// will replace these subscriptions when it completes.
 	d.mu.Lock()
 	for _, instance := range instances {
-		sub, subErr := d.natsConn.Subscribe(fmt.Sprintf("ec2.cmd.%s", instance.ID), d.handleEC2Events)
+		sub, subErr := d.natsConn.Subscribe(utils.Subject(subjects.InstanceCmd(instance.ID)), d.handleEC2Events)
 		if subErr != nil {
-			slog.Error("Failed to early-subscribe to per-instance topic", "instanceId", instance.ID, "err", subErr)
+			logger.Error("Failed to early-subscribe to per-instance topic", "instanceId", instance.ID, "err", subErr)
 		} else {
 			d.natsSubscriptions[instance.ID] = sub
 		}
@@ -349,12 +383,15 @@ func (d *Daemon) handleEC2RunInstances(msg *nats.Msg) {
 	// Launch all instances (volumes and VMs)
 	var successCount int
 	for _, instance := range instances {
+		tracing.SetInstance(ctx, instance.ID)
+		defer tracing.ClearInstance(instance.ID)
+
 		// Skip if instance was terminated by a concurrent request
 		d.Instances.Mu.Lock()
 		status := instance.Status
 		d.Instances.Mu.Unlock()
 		if status != vm.StatePending && status != vm.StateProvisioning {
-			slog.Info("Instance state changed during provisioning, skipping launch",
+			logger.Info("Instance state changed during provisioning, skipping launch",
 				"instanceId", instance.ID, "status", string(status))
 			continue
 		}
@@ -364,11 +401,16 @@ func (d *Daemon) handleEC2RunInstances(msg *nats.Msg) {
 		if d.config.Daemon.DevNetworking && instance.ENIId != "" {
 			instance.DevMAC = generateDevMAC(instance.ID)
 		}
+		if instance.ENIId != "" {
+			instance.DNSServers = d.guestDNSServers(accountID, aws.StringValue(instance.Instance.VpcId))
+		}
 
 		// Prepare the root volume, cloud-init, EFI drives via NBD (AMI clone to new volume)
+		_, volSpan := tracing.StartInstance(instance.ID, "GenerateVolumes", true)
 		volumeInfos, err := d.instanceService.GenerateVolumes(runInstancesInput, instance)
+		tracing.End(volSpan, err)
 		if err != nil {
-			slog.Error("handleEC2RunInstances GenerateVolumes failed", "instanceId", instance.ID, "err", err)
+			logger.Error("handleEC2RunInstances GenerateVolumes failed", "instanceId", instance.ID, "err", err)
 			d.markInstanceFailed(instance, "volume_preparation_failed")
 			continue
 		}
@@ -389,8 +431,12 @@ func (d *Daemon) handleEC2RunInstances(msg *nats.Msg) {
 		// Launch the instance infrastructure (QEMU, QMP, NATS subscriptions)
 		err = d.LaunchInstance(instance)
 		if err != nil {
-			slog.Error("handleEC2RunInstances LaunchInstance failed", "instanceId", instance.ID, "err", err)
-			d.markInstanceFailed(instance, "launch_failed")
+			logger.Error("handleEC2RunInstances LaunchInstance failed", "instanceId", instance.ID, "err", err)
+			reason := "launch_failed"
+			if errors.Is(err, errPreLaunchHook) {
+				reason = err.Error()
+			}
+			d.markInstanceFailed(instance, reason)
 			continue
 		}
 
@@ -398,37 +444,10 @@ func (d *Daemon) handleEC2RunInstances(msg *nats.Msg) {
 		d.updateGuestDeviceNames(instance)
 
 		successCount++
-		slog.Info("handleEC2RunInstances launched instance", "instanceId", instance.ID)
-	}
-
-	slog.Info("handleEC2RunInstances completed", "requested", launchCount, "created", len(instances), "launched", successCount)
-}
-
-func (d *Daemon) handleRebootInstance(msg *nats.Msg, command types.EC2InstanceCommand, instance *vm.VM) {
-	slog.Info("Rebooting instance", "id", command.ID)
-
-	d.Instances.Mu.Lock()
-	status := instance.Status
-	d.Instances.Mu.Unlock()
-
-	if status != vm.StateRunning {
-		slog.Error("RebootInstance: instance not in running state", "instanceId", command.ID, "status", status)
-		respondWithError(msg, awserrors.ErrorIncorrectInstanceState)
-		return
+		logger.Info("handleEC2RunInstances launched instance", "instanceId", instance.ID)
 	}
 
-	_, err := d.SendQMPCommand(instance.QMPClient, qmp.QMPCommand{Execute: "system_reset"}, command.ID)
-	if err != nil {
-		slog.Error("RebootInstance: QMP system_reset failed", "instanceId", command.ID, "err", err)
-		respondWithError(msg, awserrors.ErrorServerInternal)
-		return
-	}
-
-	slog.Info("Instance rebooted", "instanceId", command.ID)
-
-	if err := msg.Respond([]byte(`{}`)); err != nil {
-		slog.Error("Failed to respond to NATS request", "err", err)
-	}
+	logger.Info("handleEC2RunInstances completed", "requested", launchCount, "created", len(instances), "launched", successCount)
 }
 
 func (d *Daemon) handleStartInstance(msg *nats.Msg, command types.EC2InstanceCommand, instance *vm.VM) {
@@ -448,9 +467,14 @@ func (d *Daemon) handleStartInstance(msg *nats.Msg, command types.EC2InstanceCom
 	// Allocate resources
 	instanceType, ok := d.resourceMgr.instanceTypes[instance.InstanceType]
 	if ok {
+		if err := d.checkQuota(instance.AccountID, quota.Usage{Instances: 1, VCPUs: int(instanceTypeVCPUs(instanceType))}); err != nil {
+			slog.Warn("StartInstance: account quota reached", "id", command.ID, "accountID", instance.AccountID, "err", err)
+			respondWithServiceError(msg, err)
+			return
+		}
 		if err := d.resourceMgr.allocate(instanceType); err != nil {
 			slog.Error("Failed to allocate resources for start command", "id", command.ID, "err", err)
-			respondWithError(msg, awserrors.ErrorInsufficientInstanceCapacity)
+			respondWithCapacityError(msg, err)
 			return
 		}
 	}
@@ -480,9 +504,7 @@ func (d *Daemon) handleStartInstance(msg *nats.Msg, command types.EC2InstanceCom
 
 	slog.Info("Instance started", "instanceId", instance.ID)
 
-	if err := msg.Respond(fmt.Appendf(nil, `{"status":"running","instanceId":"%s"}`, instance.ID)); err != nil {
-		slog.Error("Failed to respond to NATS request", "err", err)
-	}
+	respondWithJSON(msg, instanceStatusResponse{Status: "running", InstanceID: instance.ID})
 }
 
 func (d *Daemon) handleStopOrTerminateInstance(msg *nats.Msg, command types.EC2InstanceCommand, instance *vm.VM) {
@@ -502,15 +524,30 @@ func (d *Daemon) handleStopOrTerminateInstance(msg *nats.Msg, command types.EC2I
 	// AWS error code when the instance is already stopped/terminated/etc.
 	d.Instances.Mu.Lock()
 	currentState := instance.Status
+	blocked := protectionDetail(instance, isTerminate)
+	interruptible := instance.Interruptible
 	d.Instances.Mu.Unlock()
 
 	// If instance is already shutting-down and we're asked to terminate, treat
 	// as idempotent — the finalizeTermination goroutine is already cleaning up.
 	if isTerminate && currentState == vm.StateShuttingDown {
 		slog.Info("Instance already shutting down, terminate is idempotent", "instanceId", instance.ID)
-		if err := msg.Respond([]byte(`{}`)); err != nil {
-			slog.Error("Failed to respond to NATS request", "err", err)
-		}
+		respondWithJSON(msg, struct{}{})
+		return
+	}
+
+	// Protections guard against API callers; a stop or terminate the
+	// platform initiates goes ahead.
+	if blocked != "" && command.Attributes.StateReason == "" {
+		slog.Warn("Instance is protected from "+strings.ToLower(action), "instanceId", instance.ID)
+		respondWithProtectionError(msg, blocked)
+		return
+	}
+
+	// Interruptible instances are one-time: they run until terminated.
+	if interruptible && !isTerminate && command.Attributes.StateReason == "" {
+		slog.Warn("Interruptible instance can't be stopped", "instanceId", instance.ID)
+		respondWithError(msg, awserrors.ErrorUnsupportedOperation)
 		return
 	}
 
@@ -521,6 +558,17 @@ func (d *Daemon) handleStopOrTerminateInstance(msg *nats.Msg, command types.EC2I
 		return
 	}
 
+	d.Instances.Mu.Lock()
+	switch command.Attributes.StateReason {
+	case stateReasonScheduledStop:
+		d.setStateReason(instance, stateReasonScheduledStop, "Instance stopped by a scheduled instance event")
+	case stateReasonSpotTermination:
+		d.setStateReason(instance, stateReasonSpotTermination, "Interruptible instance reclaimed for capacity")
+	default:
+		d.setStateReason(instance, stateReasonUserInitiatedShutdown, "User initiated shutdown")
+	}
+	d.Instances.Mu.Unlock()
+
 	// Transition to the initial transitional state
 	if err := d.TransitionState(instance, initialState); err != nil {
 		slog.Error("Failed to transition to "+string(initialState), "instanceId", instance.ID, "err", err)
@@ -530,104 +578,90 @@ func (d *Daemon) handleStopOrTerminateInstance(msg *nats.Msg, command types.EC2I
 
 	// Respond immediately - operation will complete in background
 	// stopInstance() handles the QMP shutdown command, so we don't send it here
-	if err := msg.Respond([]byte(`{}`)); err != nil {
-		slog.Error("Failed to respond to NATS request", "err", err)
-	}
+	respondWithJSON(msg, struct{}{})
 
 	// Run cleanup in goroutine to not block NATS
 	go func(inst *vm.VM, attrs types.EC2CommandAttributes) {
-		stopErr := d.stopInstance(map[string]*vm.VM{inst.ID: inst}, isTerminate)
-
-		if stopErr != nil {
-			slog.Error("Failed to "+strings.ToLower(action)+" instance", "err", stopErr, "id", inst.ID)
-			if err := d.TransitionState(inst, vm.StateError); err != nil {
-				slog.Error("Failed to transition to error state", "instanceId", inst.ID, "err", err)
-			}
-		} else {
-			d.Instances.Mu.Lock()
-			inst.Attributes = attrs
-			inst.LastNode = d.node
-			d.Instances.Mu.Unlock()
+		if teardownErr := d.stopInstance([]*vm.VM{inst}, isTerminate); teardownErr != nil {
+			slog.Error("Volume teardown incomplete after "+strings.ToLower(action)+", instance is down", "err", teardownErr, "id", inst.ID)
+		}
+		d.Instances.Mu.Lock()
+		inst.Attributes = attrs
+		inst.LastNode = d.node
+		d.Instances.Mu.Unlock()
 
-			if err := d.TransitionState(inst, finalState); err != nil {
-				slog.Error("Failed to transition to final state", "instanceId", inst.ID, "err", err)
-			}
-			slog.Info("Instance "+string(finalState), "id", inst.ID)
-
-			// Remove instance from placement group on terminate
-			if isTerminate && inst.PlacementGroupName != "" && d.placementGroupService != nil {
-				if _, pgErr := d.placementGroupService.RemoveInstance(&handlers_ec2_placementgroup.RemoveInstanceInput{
-					GroupName:  inst.PlacementGroupName,
-					NodeName:   inst.PlacementGroupNode,
-					InstanceID: inst.ID,
-				}, inst.AccountID); pgErr != nil {
-					slog.Error("Failed to remove instance from placement group",
-						"instanceId", inst.ID, "groupName", inst.PlacementGroupName, "err", pgErr)
-				}
+		if err := d.TransitionState(inst, finalState); err != nil {
+			slog.Error("Failed to transition to final state", "instanceId", inst.ID, "err", err)
+		}
+		slog.Info("Instance "+string(finalState), "id", inst.ID)
+
+		// Remove instance from placement group on terminate
+		if isTerminate && inst.PlacementGroupName != "" && d.placementGroupService != nil {
+			if _, pgErr := d.placementGroupService.RemoveInstance(&handlers_ec2_placementgroup.RemoveInstanceInput{
+				GroupName:  inst.PlacementGroupName,
+				NodeName:   inst.PlacementGroupNode,
+				InstanceID: inst.ID,
+			}, inst.AccountID); pgErr != nil {
+				slog.Error("Failed to remove instance from placement group",
+					"instanceId", inst.ID, "groupName", inst.PlacementGroupName, "err", pgErr)
 			}
+		}
+		if isTerminate {
+			d.deleteInstanceSchedules(inst.AccountID, inst.ID)
+		}
 
-			if d.jsManager != nil {
-				if isTerminate {
-					// Write to terminated KV bucket (auto-expires after 1 hour via TTL).
-					// If this fails, keep the instance in local state so DescribeInstances
-					// still sees it and restoreInstances can retry the KV migration.
-					if err := d.jsManager.WriteTerminatedInstance(inst.ID, inst); err != nil {
-						slog.Error("Failed to write terminated instance to KV, keeping in local state for retry",
-							"instanceId", inst.ID, "err", err)
-						return
-					}
-				} else {
-					// Write to shared KV first — if daemon crashes after this but
-					// before local cleanup, restoreInstances handles the overlap.
-					if err := d.jsManager.WriteStoppedInstance(inst.ID, inst); err != nil {
-						slog.Error("Failed to write stopped instance to shared KV, keeping local ownership",
-							"instanceId", inst.ID, "err", err)
-						return
-					}
-				}
-
-				// Guard + delete must be atomic under the same lock hold.
-				// A concurrent ec2.start handler may have loaded the instance
-				// from stopped KV, re-added it to VMS with a new pointer, and
-				// launched it. Deleting here would destroy the running instance's
-				// state — creating a "ghost instance" visible nowhere.
-				d.Instances.Mu.Lock()
-				current, exists := d.Instances.VMS[inst.ID]
-				if !exists || current != inst {
-					d.Instances.Mu.Unlock()
-					slog.Info("Instance was reclaimed by another handler, skipping local cleanup",
-						"instanceId", inst.ID, "state", string(finalState))
+		if d.jsManager != nil {
+			if isTerminate {
+				// Write to terminated KV bucket (auto-expires after 1 hour via TTL).
+				// If this fails, keep the instance in local state so DescribeInstances
+				// still sees it and restoreInstances can retry the KV migration.
+				if err := d.jsManager.WriteTerminatedInstance(inst.ID, inst); err != nil {
+					slog.Error("Failed to write terminated instance to KV, keeping in local state for retry",
+						"instanceId", inst.ID, "err", err)
 					return
 				}
-				delete(d.Instances.VMS, inst.ID)
-				d.Instances.Mu.Unlock()
-
-				// Unsubscribe from per-instance NATS topic. Safe to do after
-				// the delete — LaunchInstance already unsubscribes stale entries
-				// before creating new ones (daemon.go:1658-1664).
-				d.mu.Lock()
-				if sub, ok := d.natsSubscriptions[inst.ID]; ok {
-					if err := sub.Unsubscribe(); err != nil {
-						slog.Error("Failed to unsubscribe instance", "instanceId", inst.ID, "err", err)
-					}
-					delete(d.natsSubscriptions, inst.ID)
+			} else {
+				// Write to shared KV first — if daemon crashes after this but
+				// before local cleanup, restoreInstances handles the overlap.
+				if err := d.jsManager.WriteStoppedInstance(inst.ID, inst); err != nil {
+					slog.Error("Failed to write stopped instance to shared KV, keeping local ownership",
+						"instanceId", inst.ID, "err", err)
+					return
 				}
-				d.mu.Unlock()
+			}
 
-				// Persist local state without the instance
-				if err := d.WriteState(); err != nil {
-					slog.Error("Failed to persist state after releasing instance, re-adding to local map for consistency",
-						"instanceId", inst.ID, "err", err)
-					// Only re-add if another handler hasn't claimed the slot
-					d.Instances.Mu.Lock()
-					if _, occupied := d.Instances.VMS[inst.ID]; !occupied {
-						d.Instances.VMS[inst.ID] = inst
-					}
-					d.Instances.Mu.Unlock()
-				} else {
-					slog.Info("Released instance ownership to KV",
-						"instanceId", inst.ID, "state", string(finalState), "lastNode", d.node)
+			// Guard + delete must be atomic under the same lock hold.
+			// A concurrent ec2.start handler may have loaded the instance
+			// from stopped KV, re-added it to VMS with a new pointer, and
+			// launched it. Deleting here would destroy the running instance's
+			// state — creating a "ghost instance" visible nowhere.
+			if !d.Instances.DeleteVMIfCurrent(inst) {
+				slog.Info("Instance was reclaimed by another handler, skipping local cleanup",
+					"instanceId", inst.ID, "state", string(finalState))
+				return
+			}
+
+			// Unsubscribe from per-instance NATS topic. Safe to do after
+			// the delete — LaunchInstance already unsubscribes stale entries
+			// before creating new ones (daemon.go:1658-1664).
+			d.mu.Lock()
+			if sub, ok := d.natsSubscriptions[inst.ID]; ok {
+				if err := sub.Unsubscribe(); err != nil {
+					slog.Error("Failed to unsubscribe instance", "instanceId", inst.ID, "err", err)
 				}
+				delete(d.natsSubscriptions, inst.ID)
+			}
+			d.mu.Unlock()
+
+			// Persist local state without the instance
+			if err := d.WriteState(); err != nil {
+				slog.Error("Failed to persist state after releasing instance, re-adding to local map for consistency",
+					"instanceId", inst.ID, "err", err)
+				// Only re-add if another handler hasn't claimed the slot
+				d.Instances.InsertVM(inst)
+			} else {
+				slog.Info("Released instance ownership to KV",
+					"instanceId", inst.ID, "state", string(finalState), "lastNode", d.node)
 			}
 		}
 	}(instance, command.Attributes)
@@ -729,9 +763,7 @@ func (d *Daemon) handleEC2DescribeInstances(msg *nats.Msg) {
 	errResp := utils.UnmarshalJsonPayload(describeInstancesInput, msg.Data)
 
 	if errResp != nil {
-		if err := msg.Respond(errResp); err != nil {
-			slog.Error("Failed to respond to NATS request", "err", err)
-		}
+		respondWithError(msg, awserrors.ErrorValidationError)
 		slog.Error("Request does not match DescribeInstancesInput")
 		return
 	}
@@ -763,6 +795,12 @@ func (d *Daemon) handleEC2DescribeInstances(msg *nats.Msg) {
 		return
 	}
 
+	page, err := pagination.Parse(describeInstancesInput.MaxResults, describeInstancesInput.NextToken, pagination.DescribeInstancesLimits)
+	if err != nil {
+		respondWithError(msg, err.Error())
+		return
+	}
+
 	// Group instances by reservation ID (AWS returns instances grouped by reservation)
 	reservationMap := make(map[string]*ec2.Reservation)
 
@@ -841,6 +879,10 @@ func (d *Daemon) handleEC2DescribeInstances(msg *nats.Msg) {
 		reservations = append(reservations, reservation)
 	}
 
+	// Return at most this node's share of the requested page; the gateway
+	// merges the nodes' shares and cuts the page.
+	reservations = pagination.PrefetchReservations(page, reservations)
+
 	// Create the response
 	output := &ec2.DescribeInstancesOutput{
 		Reservations: reservations,
@@ -860,9 +902,7 @@ func (d *Daemon) handleEC2DescribeInstanceTypes(msg *nats.Msg) {
 	describeInput := &ec2.DescribeInstanceTypesInput{}
 	errResp := utils.UnmarshalJsonPayload(describeInput, msg.Data)
 	if errResp != nil {
-		if err := msg.Respond(errResp); err != nil {
-			slog.Error("Failed to respond to NATS request", "err", err)
-		}
+		respondWithError(msg, awserrors.ErrorValidationError)
 		slog.Error("Request does not match DescribeInstanceTypesInput")
 		return
 	}
@@ -882,8 +922,25 @@ func (d *Daemon) handleEC2DescribeInstanceTypes(msg *nats.Msg) {
 		}
 	}
 
-	// Get instance types based on capacity and the showCapacity flag
-	filteredTypes := d.resourceMgr.GetAvailableInstanceTypeInfos(showCapacity)
+	// Get instance types based on capacity and the showCapacity flag. Types
+	// asked for by name are returned whether or not they currently fit, so
+	// the gateway can tell an unknown type from a full node.
+	var filteredTypes []*ec2.InstanceTypeInfo
+	if len(describeInput.InstanceTypes) > 0 && !showCapacity {
+		requested := make(map[string]bool, len(describeInput.InstanceTypes))
+		for _, name := range describeInput.InstanceTypes {
+			if name != nil {
+				requested[*name] = true
+			}
+		}
+		for _, it := range d.resourceMgr.GetInstanceTypeInfos() {
+			if it.InstanceType != nil && requested[*it.InstanceType] {
+				filteredTypes = append(filteredTypes, it)
+			}
+		}
+	} else {
+		filteredTypes = d.resourceMgr.GetAvailableInstanceTypeInfos(showCapacity)
+	}
 
 	// Create the response
 	output := &ec2.DescribeInstanceTypesOutput{
@@ -894,29 +951,104 @@ func (d *Daemon) handleEC2DescribeInstanceTypes(msg *nats.Msg) {
 	slog.Info("handleEC2DescribeInstanceTypes completed", "count", len(filteredTypes))
 }
 
+// handleEC2GetInstanceTypesFromInstanceRequirements responds with the
+// instance types in this node's catalog that meet the requested vCPU, memory
+// and architecture requirements, whether or not they currently fit.
+func (d *Daemon) handleEC2GetInstanceTypesFromInstanceRequirements(msg *nats.Msg) {
+	input := &ec2.GetInstanceTypesFromInstanceRequirementsInput{}
+	if errResp := utils.UnmarshalJsonPayload(input, msg.Data); errResp != nil {
+		respondWithError(msg, awserrors.ErrorValidationError)
+		return
+	}
+
+	output := &ec2.GetInstanceTypesFromInstanceRequirementsOutput{
+		InstanceTypes: []*ec2.InstanceTypeInfoFromInstanceRequirements{},
+	}
+	for _, it := range d.resourceMgr.GetInstanceTypeInfos() {
+		if meetsInstanceRequirements(it, input) {
+			output.InstanceTypes = append(output.InstanceTypes, &ec2.InstanceTypeInfoFromInstanceRequirements{InstanceType: it.InstanceType})
+		}
+	}
+
+	respondWithJSON(msg, output)
+	slog.Info("handleEC2GetInstanceTypesFromInstanceRequirements completed", "count", len(output.InstanceTypes))
+}
+
+// meetsInstanceRequirements reports whether an instance type falls within the
+// requested vCPU and memory ranges and supports one of the requested
+// architectures and virtualization types. Omitted bounds and empty lists
+// don't constrain.
+func meetsInstanceRequirements(it *ec2.InstanceTypeInfo, input *ec2.GetInstanceTypesFromInstanceRequirementsInput) bool {
+	if req := input.InstanceRequirements; req != nil {
+		if req.VCpuCount != nil && !inRange(instanceTypeVCPUs(it), req.VCpuCount.Min, req.VCpuCount.Max) {
+			return false
+		}
+		if req.MemoryMiB != nil && !inRange(instanceTypeMemoryMiB(it), req.MemoryMiB.Min, req.MemoryMiB.Max) {
+			return false
+		}
+	}
+
+	var architectures []*string
+	if it.ProcessorInfo != nil {
+		architectures = it.ProcessorInfo.SupportedArchitectures
+	}
+	return supportsAny(architectures, input.ArchitectureTypes) && supportsAny(it.SupportedVirtualizationTypes, input.VirtualizationTypes)
+}
+
+func inRange(v int64, lo, hi *int64) bool {
+	return v >= aws.Int64Value(lo) && (hi == nil || v <= *hi)
+}
+
+// supportsAny reports whether supported holds any of wanted, or wanted is empty.
+func supportsAny(supported, wanted []*string) bool {
+	if len(wanted) == 0 {
+		return true
+	}
+	for _, w := range wanted {
+		for _, s := range supported {
+			if aws.StringValue(s) == aws.StringValue(w) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // startStoppedInstanceRequest is the payload for ec2.start topic
 type startStoppedInstanceRequest struct {
 	InstanceID string `json:"instance_id"`
 }
 
+// instanceStatusResponse acknowledges a start or terminate with the state
+// the instance is now in.
+type instanceStatusResponse struct {
+	Status     string `json:"status"`
+	InstanceID string `json:"instanceId"`
+}
+
 // handleEC2StartStoppedInstance picks up a stopped instance from shared KV,
 // re-launches it on this daemon node, and removes it from shared KV.
 func (d *Daemon) handleEC2StartStoppedInstance(msg *nats.Msg) {
+	logger := requestLogger(msg)
+	ctx, span := tracing.Start(tracing.Extract(context.Background(), msg), "daemon.StartInstances",
+		attribute.String("spinifex.node", d.node))
+	defer span.End()
+
 	var req startStoppedInstanceRequest
 	if err := json.Unmarshal(msg.Data, &req); err != nil {
-		slog.Error("handleEC2StartStoppedInstance: failed to unmarshal request", "err", err)
+		logger.Error("handleEC2StartStoppedInstance: failed to unmarshal request", "err", err)
 		respondWithError(msg, awserrors.ErrorServerInternal)
 		return
 	}
 
 	if req.InstanceID == "" {
-		slog.Error("handleEC2StartStoppedInstance: missing instance_id")
+		logger.Error("handleEC2StartStoppedInstance: missing instance_id")
 		respondWithError(msg, awserrors.ErrorMissingParameter)
 		return
 	}
 
 	if d.jsManager == nil {
-		slog.Error("handleEC2StartStoppedInstance: JetStream not available")
+		logger.Error("handleEC2StartStoppedInstance: JetStream not available")
 		respondWithError(msg, awserrors.ErrorServerInternal)
 		return
 	}
@@ -924,18 +1056,18 @@ func (d *Daemon) handleEC2StartStoppedInstance(msg *nats.Msg) {
 	// Load instance from shared KV
 	instance, err := d.jsManager.LoadStoppedInstance(req.InstanceID)
 	if err != nil {
-		slog.Error("handleEC2StartStoppedInstance: failed to load stopped instance", "instanceId", req.InstanceID, "err", err)
+		logger.Error("handleEC2StartStoppedInstance: failed to load stopped instance", "instanceId", req.InstanceID, "err", err)
 		respondWithError(msg, awserrors.ErrorServerInternal)
 		return
 	}
 	if instance == nil {
-		slog.Warn("handleEC2StartStoppedInstance: instance not found in shared KV", "instanceId", req.InstanceID)
+		logger.Warn("handleEC2StartStoppedInstance: instance not found in shared KV", "instanceId", req.InstanceID)
 		respondWithError(msg, awserrors.ErrorInvalidInstanceIDNotFound)
 		return
 	}
 
 	if instance.Status != vm.StateStopped {
-		slog.Error("handleEC2StartStoppedInstance: instance not in stopped state", "instanceId", req.InstanceID, "status", instance.Status)
+		logger.Error("handleEC2StartStoppedInstance: instance not in stopped state", "instanceId", req.InstanceID, "status", instance.Status)
 		respondWithError(msg, awserrors.ErrorIncorrectInstanceState)
 		return
 	}
@@ -951,34 +1083,36 @@ func (d *Daemon) handleEC2StartStoppedInstance(msg *nats.Msg) {
 	// Allocate resources
 	instanceType, ok := d.resourceMgr.instanceTypes[instance.InstanceType]
 	if !ok {
-		slog.Error("handleEC2StartStoppedInstance: instance type not available on this node",
+		logger.Error("handleEC2StartStoppedInstance: instance type not available on this node",
 			"instanceId", req.InstanceID, "instanceType", instance.InstanceType)
 		respondWithError(msg, awserrors.ErrorInsufficientInstanceCapacity)
 		return
 	}
+	if err := d.checkQuota(instance.AccountID, quota.Usage{Instances: 1, VCPUs: int(instanceTypeVCPUs(instanceType))}); err != nil {
+		logger.Warn("handleEC2StartStoppedInstance: account quota reached", "instanceId", req.InstanceID, "accountID", instance.AccountID, "err", err)
+		respondWithServiceError(msg, err)
+		return
+	}
 	if err := d.resourceMgr.allocate(instanceType); err != nil {
-		slog.Error("handleEC2StartStoppedInstance: failed to allocate resources", "instanceId", req.InstanceID, "err", err)
-		respondWithError(msg, awserrors.ErrorInsufficientInstanceCapacity)
+		logger.Error("handleEC2StartStoppedInstance: failed to allocate resources", "instanceId", req.InstanceID, "err", err)
+		respondWithCapacityError(msg, err)
 		return
 	}
 
-	// Add instance to local map and clear stop attribute before launch
-	d.Instances.Mu.Lock()
-	d.Instances.VMS[instance.ID] = instance
+	// Clear stop attribute and add instance to local map before launch
 	instance.Attributes = types.EC2CommandAttributes{StartInstance: true}
-	d.Instances.Mu.Unlock()
+	d.Instances.UpsertVM(instance)
+	tracing.SetInstance(ctx, instance.ID)
 
 	// Launch the instance infrastructure (QEMU, QMP, NATS subscriptions)
 	err = d.LaunchInstance(instance)
 	if err != nil {
-		slog.Error("handleEC2StartStoppedInstance: LaunchInstance failed", "instanceId", req.InstanceID, "err", err)
+		logger.Error("handleEC2StartStoppedInstance: LaunchInstance failed", "instanceId", req.InstanceID, "err", err)
 		// Rollback: deallocate resources and remove from local map
 		if ok {
 			d.resourceMgr.deallocate(instanceType)
 		}
-		d.Instances.Mu.Lock()
-		delete(d.Instances.VMS, instance.ID)
-		d.Instances.Mu.Unlock()
+		d.Instances.DeleteVM(instance.ID)
 		respondWithError(msg, awserrors.ErrorServerInternal)
 		return
 	}
@@ -989,19 +1123,17 @@ func (d *Daemon) handleEC2StartStoppedInstance(msg *nats.Msg) {
 	// Remove from shared KV now that it's running locally.
 	// Retry once on failure — a stale KV entry risks duplicate starts.
 	if err := d.jsManager.DeleteStoppedInstance(req.InstanceID); err != nil {
-		slog.Warn("handleEC2StartStoppedInstance: first KV delete failed, retrying",
+		logger.Warn("handleEC2StartStoppedInstance: first KV delete failed, retrying",
 			"instanceId", req.InstanceID, "err", err)
 		if retryErr := d.jsManager.DeleteStoppedInstance(req.InstanceID); retryErr != nil {
-			slog.Error("handleEC2StartStoppedInstance: KV delete failed after retry, instance is running locally but stale entry remains in shared KV",
+			logger.Error("handleEC2StartStoppedInstance: KV delete failed after retry, instance is running locally but stale entry remains in shared KV",
 				"instanceId", req.InstanceID, "err", retryErr)
 		}
 	}
 
-	slog.Info("Started stopped instance from shared KV", "instanceId", instance.ID, "node", d.node)
+	logger.Info("Started stopped instance from shared KV", "instanceId", instance.ID, "node", d.node)
 
-	if err := msg.Respond(fmt.Appendf(nil, `{"status":"running","instanceId":"%s"}`, instance.ID)); err != nil {
-		slog.Error("Failed to respond to NATS request", "err", err)
-	}
+	respondWithJSON(msg, instanceStatusResponse{Status: "running", InstanceID: instance.ID})
 }
 
 // terminateStoppedInstanceRequest is the payload for ec2.terminate topic
@@ -1055,40 +1187,58 @@ func (d *Daemon) handleEC2TerminateStoppedInstance(msg *nats.Msg) {
 		return
 	}
 
-	// Delete volumes — no QEMU shutdown or unmount needed (already done during stop)
-	instance.EBSRequests.Mu.Lock()
-	for _, ebsRequest := range instance.EBSRequests.Requests {
+	if detail := protectionDetail(instance, true); detail != "" {
+		slog.Warn("handleEC2TerminateStoppedInstance: instance has termination protection", "instanceId", req.InstanceID)
+		respondWithProtectionError(msg, detail)
+		return
+	}
+
+	if err := d.terminateStoppedInstance(instance); err != nil {
+		respondWithError(msg, awserrors.ErrorServerInternal)
+		return
+	}
+
+	slog.Info("Terminated stopped instance from shared KV", "instanceId", req.InstanceID)
+
+	respondWithJSON(msg, instanceStatusResponse{Status: "terminated", InstanceID: req.InstanceID})
+}
+
+// terminateStoppedInstance deletes the volumes, public IP and ENI of an
+// instance in the shared stopped KV and moves it to the terminated KV. No
+// QEMU shutdown or unmount is needed; that was done when it stopped.
+func (d *Daemon) terminateStoppedInstance(instance *vm.VM) error {
+	// Delete volumes
+	for _, ebsRequest := range instance.SnapshotEBSRequests() {
 		// Internal volumes (EFI, cloud-init) are always cleaned up via ebs.delete
 		if ebsRequest.EFI || ebsRequest.CloudInit {
 			ebsDeleteData, err := json.Marshal(types.EBSDeleteRequest{Volume: ebsRequest.Name})
 			if err != nil {
-				slog.Error("handleEC2TerminateStoppedInstance: failed to marshal ebs.delete request", "name", ebsRequest.Name, "err", err)
+				slog.Error("terminateStoppedInstance: failed to marshal ebs.delete request", "name", ebsRequest.Name, "err", err)
 				continue
 			}
-			deleteMsg, err := d.natsConn.Request("ebs.delete", ebsDeleteData, 30*time.Second)
+			deleteMsg, err := d.natsConn.Request(utils.Subject("ebs.delete"), ebsDeleteData, 30*time.Second)
 			if err != nil {
-				slog.Warn("handleEC2TerminateStoppedInstance: ebs.delete failed for internal volume", "name", ebsRequest.Name, "err", err)
+				slog.Warn("terminateStoppedInstance: ebs.delete failed for internal volume", "name", ebsRequest.Name, "err", err)
 			} else {
-				slog.Info("handleEC2TerminateStoppedInstance: ebs.delete sent for internal volume", "name", ebsRequest.Name, "data", string(deleteMsg.Data))
+				slog.Info("terminateStoppedInstance: ebs.delete sent for internal volume", "name", ebsRequest.Name, "data", string(deleteMsg.Data))
 			}
 			continue
 		}
 
 		// User-visible volumes: respect DeleteOnTermination flag
 		if !ebsRequest.DeleteOnTermination {
-			slog.Info("handleEC2TerminateStoppedInstance: volume has DeleteOnTermination=false, skipping", "name", ebsRequest.Name)
+			slog.Info("terminateStoppedInstance: volume has DeleteOnTermination=false, skipping", "name", ebsRequest.Name)
 			continue
 		}
 
-		slog.Info("handleEC2TerminateStoppedInstance: deleting volume with DeleteOnTermination=true", "name", ebsRequest.Name)
+		slog.Info("terminateStoppedInstance: deleting volume with DeleteOnTermination=true", "name", ebsRequest.Name)
 		_, err := d.volumeService.DeleteVolume(&ec2.DeleteVolumeInput{
 			VolumeId: &ebsRequest.Name,
 		}, instance.AccountID)
 		if err != nil {
-			slog.Error("handleEC2TerminateStoppedInstance: failed to delete volume", "name", ebsRequest.Name, "err", err)
+			slog.Error("terminateStoppedInstance: failed to delete volume", "name", ebsRequest.Name, "err", err)
 		}
 	}
-	instance.EBSRequests.Mu.Unlock()
 
 	// Release public IP before termination
 	if instance.PublicIP != "" && instance.PublicIPPool != "" && d.externalIPAM != nil {
@@ -1106,9 +1256,9 @@ func (d *Daemon) handleEC2TerminateStoppedInstance(msg *nats.Msg) {
 		d.publishNATEvent("vpc.delete-nat", vpcId, instance.PublicIP, logicalIP, portName, "")
 
 		if err := d.externalIPAM.ReleaseIP(instance.PublicIPPool, instance.PublicIP); err != nil {
-			slog.Warn("handleEC2TerminateStoppedInstance: failed to release public IP", "ip", instance.PublicIP, "pool", instance.PublicIPPool, "err", err)
+			slog.Warn("terminateStoppedInstance: failed to release public IP", "ip", instance.PublicIP, "pool", instance.PublicIPPool, "err", err)
 		} else {
-			slog.Info("handleEC2TerminateStoppedInstance: released public IP", "ip", instance.PublicIP, "instanceId", req.InstanceID)
+			slog.Info("terminateStoppedInstance: released public IP", "ip", instance.PublicIP, "instanceId", instance.ID)
 		}
 	}
 
@@ -1118,37 +1268,36 @@ func (d *Daemon) handleEC2TerminateStoppedInstance(msg *nats.Msg) {
 			NetworkInterfaceId: &instance.ENIId,
 		}, instance.AccountID)
 		if eniErr != nil {
-			slog.Error("handleEC2TerminateStoppedInstance: failed to delete ENI", "eni", instance.ENIId, "err", eniErr)
+			slog.Error("terminateStoppedInstance: failed to delete ENI", "eni", instance.ENIId, "err", eniErr)
 		} else {
-			slog.Info("handleEC2TerminateStoppedInstance: deleted ENI", "eni", instance.ENIId, "instanceId", req.InstanceID)
+			slog.Info("terminateStoppedInstance: deleted ENI", "eni", instance.ENIId, "instanceId", instance.ID)
 		}
 	}
 
+	d.deleteInstanceSchedules(instance.AccountID, instance.ID)
+	d.runPostTerminateHooks(instance)
+
 	// Write to terminated KV bucket FIRST so the instance is visible in DescribeInstances.
 	// If this fails, the instance remains in the stopped bucket (safe to retry).
 	instance.Status = vm.StateTerminated
-	if err := d.jsManager.WriteTerminatedInstance(req.InstanceID, instance); err != nil {
-		slog.Error("handleEC2TerminateStoppedInstance: failed to write to terminated KV, aborting", "instanceId", req.InstanceID, "err", err)
-		respondWithError(msg, awserrors.ErrorServerInternal)
-		return
+	instance.TerminatedAt = utils.Now()
+	if err := d.jsManager.WriteTerminatedInstance(instance.ID, instance); err != nil {
+		slog.Error("terminateStoppedInstance: failed to write to terminated KV, aborting", "instanceId", instance.ID, "err", err)
+		return err
 	}
 
 	// Now safe to remove from shared stopped KV — instance already exists in terminated bucket.
 	// Retry once on failure to avoid duplicate entries in DescribeInstances.
-	if err := d.jsManager.DeleteStoppedInstance(req.InstanceID); err != nil {
-		slog.Warn("handleEC2TerminateStoppedInstance: first stopped KV delete failed, retrying",
-			"instanceId", req.InstanceID, "err", err)
-		if retryErr := d.jsManager.DeleteStoppedInstance(req.InstanceID); retryErr != nil {
-			slog.Error("handleEC2TerminateStoppedInstance: stopped KV delete failed after retry, instance may appear in both buckets",
-				"instanceId", req.InstanceID, "err", retryErr)
+	if err := d.jsManager.DeleteStoppedInstance(instance.ID); err != nil {
+		slog.Warn("terminateStoppedInstance: first stopped KV delete failed, retrying",
+			"instanceId", instance.ID, "err", err)
+		if retryErr := d.jsManager.DeleteStoppedInstance(instance.ID); retryErr != nil {
+			slog.Error("terminateStoppedInstance: stopped KV delete failed after retry, instance may appear in both buckets",
+				"instanceId", instance.ID, "err", retryErr)
 		}
 	}
 
-	slog.Info("Terminated stopped instance from shared KV", "instanceId", req.InstanceID)
-
-	if err := msg.Respond(fmt.Appendf(nil, `{"status":"terminated","instanceId":"%s"}`, req.InstanceID)); err != nil {
-		slog.Error("Failed to respond to NATS request", "err", err)
-	}
+	return nil
 }
 
 // handleEC2DescribeStoppedInstances returns stopped instances from shared KV.
@@ -1158,7 +1307,27 @@ func (d *Daemon) handleEC2DescribeStoppedInstances(msg *nats.Msg) {
 
 // handleEC2DescribeTerminatedInstances returns terminated instances from the terminated KV bucket.
 func (d *Daemon) handleEC2DescribeTerminatedInstances(msg *nats.Msg) {
-	d.describeInstancesFromKV(msg, d.jsManager.ListTerminatedInstances, 48, "terminated", "handleEC2DescribeTerminatedInstances")
+	d.describeInstancesFromKV(msg, d.listVisibleTerminatedInstances, 48, "terminated", "handleEC2DescribeTerminatedInstances")
+}
+
+// listVisibleTerminatedInstances lists the terminated instances still inside
+// the visibility window. The bucket TTL only purges entries lazily and counts
+// from their last write, so the window itself is enforced against the daemon
+// clock. Entries without a termination time are left to the TTL.
+func (d *Daemon) listVisibleTerminatedInstances() ([]*vm.VM, error) {
+	instances, err := d.jsManager.ListTerminatedInstances()
+	if err != nil {
+		return nil, err
+	}
+	now := utils.Now()
+	visible := instances[:0]
+	for _, instance := range instances {
+		if !instance.TerminatedAt.IsZero() && now.Sub(instance.TerminatedAt) >= terminatedInstanceVisibility {
+			continue
+		}
+		visible = append(visible, instance)
+	}
+	return visible, nil
 }
 
 // describeInstancesFromKV is a shared helper for DescribeStopped/TerminatedInstances handlers.
@@ -1174,9 +1343,7 @@ func (d *Daemon) describeInstancesFromKV(msg *nats.Msg, listFn func() ([]*vm.VM,
 	describeInput := &ec2.DescribeInstancesInput{}
 	if len(msg.Data) > 0 {
 		if errResp := utils.UnmarshalJsonPayload(describeInput, msg.Data); errResp != nil {
-			if err := msg.Respond(errResp); err != nil {
-				slog.Error("Failed to respond to NATS request", "err", err)
-			}
+			respondWithError(msg, awserrors.ErrorValidationError)
 			return
 		}
 	}
@@ -1195,6 +1362,12 @@ func (d *Daemon) describeInstancesFromKV(msg *nats.Msg, listFn func() ([]*vm.VM,
 		return
 	}
 
+	page, pageErr := pagination.Parse(describeInput.MaxResults, describeInput.NextToken, pagination.DescribeInstancesLimits)
+	if pageErr != nil {
+		respondWithError(msg, pageErr.Error())
+		return
+	}
+
 	instances, err := listFn()
 	if err != nil {
 		slog.Error(handlerName+": failed to list instances", "err", err)
@@ -1253,13 +1426,15 @@ func (d *Daemon) describeInstancesFromKV(msg *nats.Msg, listFn func() ([]*vm.VM,
 	for _, reservation := range reservationMap {
 		reservations = append(reservations, reservation)
 	}
+	reservations = pagination.PrefetchReservations(page, reservations)
 
 	respondWithJSON(msg, &ec2.DescribeInstancesOutput{Reservations: reservations})
 	slog.Info(handlerName+" completed", "count", len(reservations))
 }
 
 // handleEC2ModifyInstanceAttribute modifies attributes of a stopped instance in shared KV.
-// All supported attributes (InstanceType, UserData) require the instance to be stopped.
+// InstanceType and UserData require the instance to be stopped; the gateway sends
+// protection changes for a running instance to the node hosting it instead.
 func (d *Daemon) handleEC2ModifyInstanceAttribute(msg *nats.Msg) {
 	var input ec2.ModifyInstanceAttributeInput
 	if err := json.Unmarshal(msg.Data, &input); err != nil {
@@ -1282,9 +1457,7 @@ func (d *Daemon) handleEC2ModifyInstanceAttribute(msg *nats.Msg) {
 	// it before the stopped-state gate.
 	if input.SourceDestCheck != nil {
 		slog.Info("handleEC2ModifyInstanceAttribute: accepting SourceDestCheck (no-op on bare metal)", "instanceId", instanceID)
-		if err := msg.Respond([]byte(`{}`)); err != nil {
-			slog.Error("Failed to respond to NATS request", "err", err)
-		}
+		respondWithJSON(msg, struct{}{})
 		return
 	}
 
@@ -1338,6 +1511,19 @@ func (d *Daemon) handleEC2ModifyInstanceAttribute(msg *nats.Msg) {
 		instance.Instance.InstanceType = aws.String(newType)
 		// Clear StateReason — resolves capacity-unavailable state from instance-type-missing bug
 		instance.Instance.StateReason = nil
+		instance.CPUCredits = retypeCPUCredits(instance.CPUCredits, newType)
+	}
+
+	if input.DisableApiTermination != nil || input.DisableApiStop != nil {
+		protection := &types.ProtectionData{}
+		if input.DisableApiTermination != nil {
+			protection.DisableApiTermination = input.DisableApiTermination.Value
+		}
+		if input.DisableApiStop != nil {
+			protection.DisableApiStop = input.DisableApiStop.Value
+		}
+		slog.Info("handleEC2ModifyInstanceAttribute: changing protection", "instanceId", instanceID)
+		setProtection(instance, protection)
 	}
 
 	if input.UserData != nil && input.UserData.Value != nil {
@@ -1359,9 +1545,7 @@ func (d *Daemon) handleEC2ModifyInstanceAttribute(msg *nats.Msg) {
 
 	slog.Info("handleEC2ModifyInstanceAttribute: completed successfully", "instanceId", instanceID)
 
-	if err := msg.Respond([]byte(`{}`)); err != nil {
-		slog.Error("Failed to respond to NATS request", "err", err)
-	}
+	respondWithJSON(msg, struct{}{})
 }
 
 // handleEC2DescribeInstanceAttribute returns a single requested attribute for an instance.
@@ -1390,13 +1574,7 @@ func (d *Daemon) handleEC2DescribeInstanceAttribute(msg *nats.Msg) {
 	accountID := utils.AccountIDFromMsg(msg)
 
 	// Look up instance: running first, then stopped KV.
-	var instance *vm.VM
-
-	d.Instances.Mu.Lock()
-	if running, ok := d.Instances.VMS[instanceID]; ok {
-		instance = running
-	}
-	d.Instances.Mu.Unlock()
+	instance, _ := d.Instances.GetVM(instanceID)
 
 	if instance == nil {
 		if d.jsManager == nil {
@@ -1439,11 +1617,11 @@ func (d *Daemon) handleEC2DescribeInstanceAttribute(msg *nats.Msg) {
 		output.UserData = &ec2.AttributeValue{Value: &val}
 
 	case ec2.InstanceAttributeNameDisableApiTermination:
-		val := false
+		val := instance.DisableApiTermination
 		output.DisableApiTermination = &ec2.AttributeBooleanValue{Value: &val}
 
 	case ec2.InstanceAttributeNameDisableApiStop:
-		val := false
+		val := instance.DisableApiStop
 		output.DisableApiStop = &ec2.AttributeBooleanValue{Value: &val}
 
 	case ec2.InstanceAttributeNameInstanceInitiatedShutdownBehavior:
@@ -1481,6 +1659,21 @@ func (d *Daemon) handleEC2DescribeInstanceAttribute(msg *nats.Msg) {
 	respondWithJSON(msg, output)
 }
 
+// guestDNSServers returns the resolvers cloud-init configures in a guest of
+// vpcID: the VPC's own domain-name-servers, or the cluster's guest resolvers
+// when it uses AmazonProvidedDNS, matching what vpcd serves over DHCP.
+func (d *Daemon) guestDNSServers(accountID, vpcID string) []string {
+	if d.vpcService != nil && vpcID != "" {
+		opts, err := d.vpcService.GetVPCDhcpOptions(accountID, vpcID)
+		if err != nil {
+			slog.Warn("Failed to load VPC DHCP options, using cluster resolvers", "vpcId", vpcID, "err", err)
+		} else if len(opts.DomainNameServers) > 0 {
+			return opts.DomainNameServers
+		}
+	}
+	return d.clusterConfig.GuestDNSServers()
+}
+
 // publishNATEvent sends a NAT lifecycle event (vpc.add-nat or vpc.delete-nat) to NATS.
 // For vpc.add-nat, it uses request-reply to ensure the OVN NAT rule is committed
 // before returning, preventing ARP propagation races. For vpc.delete-nat, it
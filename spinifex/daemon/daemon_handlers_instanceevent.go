@@ -0,0 +1,43 @@
+package daemon
+
+import (
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	handlers_ec2_instanceevent "github.com/mulgadc/spinifex/spinifex/handlers/ec2/instanceevent"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/nats-io/nats.go"
+)
+
+// handleEC2ScheduleInstanceEvent is subscribed on every node without a queue
+// group. Only the node running the instance responds, recording the event
+// against the instance's owner; the rest stay silent.
+func (d *Daemon) handleEC2ScheduleInstanceEvent(msg *nats.Msg) {
+	input := &handlers_ec2_instanceevent.ScheduleInstanceEventInput{}
+	if errResp := utils.UnmarshalJsonPayload(input, msg.Data); errResp != nil {
+		return
+	}
+
+	ownerAccountID := ""
+	ok := d.Instances.WithVM(input.InstanceID, func(v *vm.VM) {
+		ownerAccountID = v.AccountID
+	})
+	if !ok {
+		return
+	}
+
+	slog.Info("Scheduling instance event", "instanceId", input.InstanceID, "code", input.Code,
+		"scheduler", utils.AccountIDFromMsg(msg))
+	handleNATSRequest(msg, func(in *handlers_ec2_instanceevent.ScheduleInstanceEventInput, _ string) (*ec2.InstanceStatusEvent, error) {
+		return d.instanceEventService.ScheduleInstanceEvent(in, ownerAccountID)
+	})
+}
+
+func (d *Daemon) handleEC2DescribeInstanceEvents(msg *nats.Msg) {
+	handleNATSRequest(msg, d.instanceEventService.DescribeInstanceEvents)
+}
+
+func (d *Daemon) handleEC2ModifyInstanceEventStartTime(msg *nats.Msg) {
+	handleNATSRequest(msg, d.instanceEventService.ModifyInstanceEventStartTime)
+}
@@ -0,0 +1,17 @@
+package daemon
+
+import (
+	"github.com/nats-io/nats.go"
+)
+
+func (d *Daemon) handleEC2CreateInstanceSchedule(msg *nats.Msg) {
+	handleNATSRequest(msg, d.instanceScheduleService.CreateInstanceSchedule)
+}
+
+func (d *Daemon) handleEC2DescribeInstanceSchedules(msg *nats.Msg) {
+	handleNATSRequest(msg, d.instanceScheduleService.DescribeInstanceSchedules)
+}
+
+func (d *Daemon) handleEC2DeleteInstanceSchedule(msg *nats.Msg) {
+	handleNATSRequest(msg, d.instanceScheduleService.DeleteInstanceSchedule)
+}
@@ -0,0 +1,113 @@
+package daemon
+
+import (
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/nats-io/nats.go"
+)
+
+// handleModifyMaintenanceOptions changes the maintenance options of an
+// instance on this node. Auto-recovery is read when the instance crashes,
+// so the change needs nothing beyond persisting it.
+func (d *Daemon) handleModifyMaintenanceOptions(msg *nats.Msg, command types.EC2InstanceCommand) {
+	if errCode := validMaintenanceOptions(command.MaintenanceOptions); errCode != "" {
+		respondWithError(msg, errCode)
+		return
+	}
+
+	var options *ec2.InstanceMaintenanceOptions
+	found, _ := d.modifyLocalInstance(command.ID, utils.AccountIDFromMsg(msg), func(v *vm.VM) string {
+		setMaintenanceOptions(v.Instance, command.MaintenanceOptions)
+		options = v.Instance.MaintenanceOptions
+		return ""
+	})
+	if !found {
+		respondWithError(msg, awserrors.ErrorInvalidInstanceIDNotFound)
+		return
+	}
+
+	slog.Info("Modified instance maintenance options", "instanceId", command.ID, "autoRecovery", aws.StringValue(options.AutoRecovery))
+	respondWithJSON(msg, &ec2.ModifyInstanceMaintenanceOptionsOutput{
+		InstanceId:   aws.String(command.ID),
+		AutoRecovery: options.AutoRecovery,
+	})
+}
+
+// handleEC2ModifyStoppedInstanceMaintenanceOptions changes the maintenance
+// options of a stopped instance in shared KV.
+func (d *Daemon) handleEC2ModifyStoppedInstanceMaintenanceOptions(msg *nats.Msg) {
+	var command types.EC2InstanceCommand
+	if errResp := utils.UnmarshalJsonPayload(&command, msg.Data); errResp != nil {
+		respondWithError(msg, awserrors.ErrorValidationError)
+		return
+	}
+	if errCode := validMaintenanceOptions(command.MaintenanceOptions); errCode != "" {
+		respondWithError(msg, errCode)
+		return
+	}
+
+	instance, errCode := d.modifyStoppedInstance(command.ID, utils.AccountIDFromMsg(msg), func(v *vm.VM) string {
+		setMaintenanceOptions(v.Instance, command.MaintenanceOptions)
+		return ""
+	})
+	if errCode != "" {
+		respondWithError(msg, errCode)
+		return
+	}
+
+	slog.Info("Modified stopped instance maintenance options", "instanceId", command.ID, "autoRecovery", aws.StringValue(instance.Instance.MaintenanceOptions.AutoRecovery))
+	respondWithJSON(msg, &ec2.ModifyInstanceMaintenanceOptionsOutput{
+		InstanceId:   aws.String(command.ID),
+		AutoRecovery: instance.Instance.MaintenanceOptions.AutoRecovery,
+	})
+}
+
+// validMaintenanceOptions returns the error code for a request to change
+// the maintenance options to opts, or "".
+func validMaintenanceOptions(opts *types.MaintenanceOptionsData) string {
+	if opts == nil {
+		return awserrors.ErrorMissingParameter
+	}
+	if !validAutoRecovery(opts.AutoRecovery) {
+		return awserrors.ErrorInvalidParameterValue
+	}
+	return ""
+}
+
+// validAutoRecovery reports whether autoRecovery is empty (unchanged) or an
+// auto-recovery state.
+func validAutoRecovery(autoRecovery string) bool {
+	switch autoRecovery {
+	case "", ec2.InstanceAutoRecoveryStateDefault, ec2.InstanceAutoRecoveryStateDisabled:
+		return true
+	}
+	return false
+}
+
+// setMaintenanceOptions applies opts to the instance's maintenance options,
+// filling in the defaults for an instance that has none yet.
+func setMaintenanceOptions(instance *ec2.Instance, opts *types.MaintenanceOptionsData) {
+	options := &ec2.InstanceMaintenanceOptions{AutoRecovery: aws.String(ec2.InstanceAutoRecoveryStateDefault)}
+	if instance.MaintenanceOptions != nil {
+		copied := *instance.MaintenanceOptions
+		options = &copied
+	}
+	if opts.AutoRecovery != "" {
+		options.AutoRecovery = aws.String(opts.AutoRecovery)
+	}
+	instance.MaintenanceOptions = options
+}
+
+// autoRecoveryDisabled reports whether instance opted out of being restarted
+// after a crash. Instances launched before maintenance options existed
+// recover.
+func autoRecoveryDisabled(instance *vm.VM) bool {
+	return instance.Instance != nil && instance.Instance.MaintenanceOptions != nil &&
+		aws.StringValue(instance.Instance.MaintenanceOptions.AutoRecovery) == ec2.InstanceAutoRecoveryStateDisabled
+}
@@ -0,0 +1,109 @@
+package daemon
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleModifyMaintenanceOptions_RunningInstance(t *testing.T) {
+	d, cleanup := newTestDaemon(t)
+	defer cleanup()
+
+	instanceID := "i-maint-001"
+	d.Instances.VMS[instanceID] = &vm.VM{
+		ID:        instanceID,
+		Status:    vm.StateRunning,
+		AccountID: testAccountID,
+		Instance:  &ec2.Instance{InstanceId: aws.String(instanceID)},
+	}
+
+	topic := "test.ec2.cmd." + t.Name()
+	sub, err := d.natsConn.Subscribe(topic, d.handleEC2Events)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	modify := func(autoRecovery string) []byte {
+		t.Helper()
+		reqData, _ := json.Marshal(types.EC2InstanceCommand{
+			ID:                 instanceID,
+			Attributes:         types.EC2CommandAttributes{ModifyMaintenanceOptions: true},
+			MaintenanceOptions: &types.MaintenanceOptionsData{AutoRecovery: autoRecovery},
+		})
+		reply, err := natsRequest(d.natsConn, topic, reqData, 5*time.Second)
+		require.NoError(t, err)
+		return reply.Data
+	}
+
+	var output ec2.ModifyInstanceMaintenanceOptionsOutput
+	require.NoError(t, json.Unmarshal(modify(ec2.InstanceAutoRecoveryStateDisabled), &output))
+	assert.Equal(t, instanceID, aws.StringValue(output.InstanceId))
+	assert.Equal(t, ec2.InstanceAutoRecoveryStateDisabled, aws.StringValue(output.AutoRecovery))
+	assert.True(t, autoRecoveryDisabled(d.Instances.VMS[instanceID]))
+
+	assert.Contains(t, string(modify("always")), awserrors.ErrorInvalidParameterValue)
+	assert.True(t, autoRecoveryDisabled(d.Instances.VMS[instanceID]))
+
+	require.NoError(t, json.Unmarshal(modify(ec2.InstanceAutoRecoveryStateDefault), &output))
+	assert.Equal(t, ec2.InstanceAutoRecoveryStateDefault, aws.StringValue(output.AutoRecovery))
+	assert.False(t, autoRecoveryDisabled(d.Instances.VMS[instanceID]))
+}
+
+func TestHandleEC2ModifyStoppedInstanceMaintenanceOptions(t *testing.T) {
+	daemon := createFullTestDaemonWithJetStream(t, sharedJSNATSURL)
+
+	instanceID := "i-maint-stopped-001"
+	require.NoError(t, daemon.jsManager.WriteStoppedInstance(instanceID, &vm.VM{
+		ID:        instanceID,
+		Status:    vm.StateStopped,
+		AccountID: testAccountID,
+		Instance:  &ec2.Instance{InstanceId: aws.String(instanceID)},
+	}))
+	t.Cleanup(func() { _ = daemon.jsManager.DeleteStoppedInstance(instanceID) })
+
+	subject := "ec2.ModifyStoppedInstanceMaintenanceOptions"
+	sub, err := daemon.natsConn.QueueSubscribe(subject, "spinifex-workers", daemon.handleEC2ModifyStoppedInstanceMaintenanceOptions)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	modify := func(id string) []byte {
+		t.Helper()
+		reqData, _ := json.Marshal(types.EC2InstanceCommand{
+			ID:                 id,
+			MaintenanceOptions: &types.MaintenanceOptionsData{AutoRecovery: ec2.InstanceAutoRecoveryStateDisabled},
+		})
+		reply, err := natsRequest(daemon.natsConn, subject, reqData, 5*time.Second)
+		require.NoError(t, err)
+		return reply.Data
+	}
+
+	var output ec2.ModifyInstanceMaintenanceOptionsOutput
+	require.NoError(t, json.Unmarshal(modify(instanceID), &output))
+	assert.Equal(t, ec2.InstanceAutoRecoveryStateDisabled, aws.StringValue(output.AutoRecovery))
+
+	loaded, err := daemon.jsManager.LoadStoppedInstance(instanceID)
+	require.NoError(t, err)
+	require.NotNil(t, loaded)
+	assert.True(t, autoRecoveryDisabled(loaded))
+
+	assert.Contains(t, string(modify("i-maint-missing")), awserrors.ErrorInvalidInstanceIDNotFound)
+}
+
+func TestAutoRecoveryDisabled(t *testing.T) {
+	assert.False(t, autoRecoveryDisabled(&vm.VM{}), "instances without options recover")
+	assert.False(t, autoRecoveryDisabled(&vm.VM{Instance: &ec2.Instance{}}))
+
+	instance := &ec2.Instance{}
+	setMaintenanceOptions(instance, &types.MaintenanceOptionsData{})
+	assert.Equal(t, ec2.InstanceAutoRecoveryStateDefault, aws.StringValue(instance.MaintenanceOptions.AutoRecovery))
+	setMaintenanceOptions(instance, &types.MaintenanceOptionsData{AutoRecovery: ec2.InstanceAutoRecoveryStateDisabled})
+	assert.True(t, autoRecoveryDisabled(&vm.VM{Instance: instance}))
+}
@@ -0,0 +1,177 @@
+package daemon
+
+import (
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/nats-io/nats.go"
+)
+
+// handleModifyMetadataOptions changes the metadata options of an instance
+// on this node. A running instance's firewall is updated before the change
+// is reported, so once the call returns a disabled endpoint is unreachable.
+func (d *Daemon) handleModifyMetadataOptions(msg *nats.Msg, command types.EC2InstanceCommand, instance *vm.VM) {
+	if errCode := validMetadataOptions(command.MetadataOptions); errCode != "" {
+		respondWithError(msg, errCode)
+		return
+	}
+	accountID := utils.AccountIDFromMsg(msg)
+
+	var prev, options *ec2.InstanceMetadataOptionsResponse
+	var status vm.InstanceState
+	var disabled, prevDisabled, awaitingPhoneHome bool
+	var taps []string
+	found, errCode := d.modifyLocalInstance(command.ID, accountID, func(v *vm.VM) string {
+		prev = v.Instance.MetadataOptions
+		prevDisabled = metadataEndpointDisabled(v)
+		setMetadataOptions(v.Instance, command.MetadataOptions)
+		// A VF primary bypasses the host firewall, so its endpoint can't
+		// be disabled.
+		if v.SRIOVVF != "" && metadataEndpointDisabled(v) {
+			v.Instance.MetadataOptions = prev
+			return awserrors.ErrorUnsupportedOperation
+		}
+		options = v.Instance.MetadataOptions
+		status = v.Status
+		disabled = metadataEndpointDisabled(v)
+		taps = metadataTaps(v)
+		awaitingPhoneHome = v.PhoneHomeToken != "" && v.BootedAt.IsZero()
+		return ""
+	})
+	if !found {
+		respondWithError(msg, awserrors.ErrorInvalidInstanceIDNotFound)
+		return
+	}
+	if errCode != "" {
+		slog.Error("ModifyMetadataOptions: primary interface is an SR-IOV VF, cannot disable metadata endpoint", "instanceId", command.ID)
+		respondWithError(msg, errCode)
+		return
+	}
+
+	// Pending instances pick the options up when their taps are created.
+	if status == vm.StateRunning && d.metadataFirewall != nil {
+		if err := d.setMetadataFirewall(taps, disabled); err != nil {
+			slog.Error("ModifyMetadataOptions: failed to update metadata firewall", "instanceId", command.ID, "err", err)
+			d.modifyLocalInstance(command.ID, accountID, func(v *vm.VM) string {
+				v.Instance.MetadataOptions = prev
+				return ""
+			})
+			// Put back any taps already changed.
+			if revertErr := d.setMetadataFirewall(taps, prevDisabled); revertErr != nil {
+				slog.Warn("ModifyMetadataOptions: failed to restore metadata firewall", "instanceId", command.ID, "err", revertErr)
+			}
+			respondWithError(msg, awserrors.ErrorServerInternal)
+			return
+		}
+	}
+
+	// Behind a mgmt-only gateway guests phone home through the metadata
+	// service, so a guest still booting can no longer report completion.
+	if disabled && !prevDisabled && awaitingPhoneHome && d.instanceService != nil && d.instanceService.PhoneHomeViaIMDS {
+		slog.Warn("ModifyMetadataOptions: metadata endpoint disabled before the instance phoned home; its status will stay initializing", "instanceId", command.ID)
+	}
+
+	slog.Info("Modified instance metadata options", "instanceId", command.ID, "httpEndpoint", aws.StringValue(options.HttpEndpoint), "httpTokens", aws.StringValue(options.HttpTokens))
+	respondWithJSON(msg, &ec2.ModifyInstanceMetadataOptionsOutput{
+		InstanceId:              aws.String(command.ID),
+		InstanceMetadataOptions: options,
+	})
+}
+
+// handleEC2ModifyStoppedInstanceMetadataOptions changes the metadata
+// options of a stopped instance in shared KV. The firewall follows them
+// when the instance next starts.
+func (d *Daemon) handleEC2ModifyStoppedInstanceMetadataOptions(msg *nats.Msg) {
+	var command types.EC2InstanceCommand
+	if errResp := utils.UnmarshalJsonPayload(&command, msg.Data); errResp != nil {
+		respondWithError(msg, awserrors.ErrorValidationError)
+		return
+	}
+	if errCode := validMetadataOptions(command.MetadataOptions); errCode != "" {
+		respondWithError(msg, errCode)
+		return
+	}
+
+	instance, errCode := d.modifyStoppedInstance(command.ID, utils.AccountIDFromMsg(msg), func(v *vm.VM) string {
+		setMetadataOptions(v.Instance, command.MetadataOptions)
+		return ""
+	})
+	if errCode != "" {
+		respondWithError(msg, errCode)
+		return
+	}
+
+	slog.Info("Modified stopped instance metadata options", "instanceId", command.ID, "httpEndpoint", aws.StringValue(instance.Instance.MetadataOptions.HttpEndpoint), "httpTokens", aws.StringValue(instance.Instance.MetadataOptions.HttpTokens))
+	respondWithJSON(msg, &ec2.ModifyInstanceMetadataOptionsOutput{
+		InstanceId:              aws.String(command.ID),
+		InstanceMetadataOptions: instance.Instance.MetadataOptions,
+	})
+}
+
+// validMetadataOptions returns the error code for a request to change the
+// metadata options to opts, or "".
+func validMetadataOptions(opts *types.MetadataOptionsData) string {
+	if opts == nil {
+		return awserrors.ErrorMissingParameter
+	}
+	if !validMetadataEndpoint(opts.HttpEndpoint) || !validMetadataTokens(opts.HttpTokens) {
+		return awserrors.ErrorInvalidParameterValue
+	}
+	if opts.HttpPutResponseHopLimit < 0 || opts.HttpPutResponseHopLimit > maxMetadataHopLimit {
+		return awserrors.ErrorInvalidParameterValue
+	}
+	return ""
+}
+
+// maxMetadataHopLimit is the largest PUT response hop limit EC2 accepts.
+const maxMetadataHopLimit = 64
+
+// validMetadataEndpoint reports whether endpoint is empty (unchanged) or a
+// metadata endpoint state.
+func validMetadataEndpoint(endpoint string) bool {
+	switch endpoint {
+	case "", ec2.InstanceMetadataEndpointStateEnabled, ec2.InstanceMetadataEndpointStateDisabled:
+		return true
+	}
+	return false
+}
+
+// validMetadataTokens reports whether tokens is empty (unchanged) or an
+// IMDSv2 token requirement.
+func validMetadataTokens(tokens string) bool {
+	switch tokens {
+	case "", ec2.HttpTokensStateOptional, ec2.HttpTokensStateRequired:
+		return true
+	}
+	return false
+}
+
+// setMetadataOptions applies opts to the instance's metadata options,
+// filling in the defaults for an instance that has none yet.
+func setMetadataOptions(instance *ec2.Instance, opts *types.MetadataOptionsData) {
+	options := &ec2.InstanceMetadataOptionsResponse{
+		HttpEndpoint:            aws.String(ec2.InstanceMetadataEndpointStateEnabled),
+		HttpTokens:              aws.String(ec2.HttpTokensStateOptional),
+		HttpPutResponseHopLimit: aws.Int64(1),
+		State:                   aws.String(ec2.InstanceMetadataOptionsStateApplied),
+	}
+	if instance.MetadataOptions != nil {
+		copied := *instance.MetadataOptions
+		options = &copied
+	}
+	if opts.HttpEndpoint != "" {
+		options.HttpEndpoint = aws.String(opts.HttpEndpoint)
+	}
+	if opts.HttpTokens != "" {
+		options.HttpTokens = aws.String(opts.HttpTokens)
+	}
+	if opts.HttpPutResponseHopLimit != 0 {
+		options.HttpPutResponseHopLimit = aws.Int64(opts.HttpPutResponseHopLimit)
+	}
+	instance.MetadataOptions = options
+}
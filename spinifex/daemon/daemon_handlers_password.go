@@ -0,0 +1,66 @@
+package daemon
+
+import (
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/nats-io/nats.go"
+)
+
+// handleGetPasswordData returns the password data the guest agent of an
+// instance on this node posted. PasswordData is empty until it has.
+func (d *Daemon) handleGetPasswordData(msg *nats.Msg, command types.EC2InstanceCommand, instance *vm.VM) {
+	d.Instances.Mu.Lock()
+	output := passwordDataOutput(command.ID, instance)
+	d.Instances.Mu.Unlock()
+	respondWithJSON(msg, output)
+}
+
+// handleEC2GetStoppedInstancePasswordData returns the password data of a
+// stopped instance from shared KV.
+func (d *Daemon) handleEC2GetStoppedInstancePasswordData(msg *nats.Msg) {
+	var command types.EC2InstanceCommand
+	if errResp := utils.UnmarshalJsonPayload(&command, msg.Data); errResp != nil {
+		respondWithError(msg, awserrors.ErrorValidationError)
+		return
+	}
+	if d.jsManager == nil {
+		respondWithError(msg, awserrors.ErrorServerInternal)
+		return
+	}
+
+	instance, err := d.jsManager.LoadStoppedInstance(command.ID)
+	if err != nil {
+		slog.Error("handleEC2GetStoppedInstancePasswordData: failed to load instance", "instanceId", command.ID, "err", err)
+		respondWithError(msg, awserrors.ErrorServerInternal)
+		return
+	}
+	if instance == nil {
+		respondWithError(msg, awserrors.ErrorInvalidInstanceIDNotFound)
+		return
+	}
+	if !checkInstanceOwnership(msg, command.ID, instance.AccountID) {
+		return
+	}
+
+	respondWithJSON(msg, passwordDataOutput(command.ID, instance))
+}
+
+// passwordDataOutput builds the GetPasswordData response for instance. The
+// timestamp is when the guest posted the data, or now when it hasn't.
+func passwordDataOutput(instanceID string, instance *vm.VM) *ec2.GetPasswordDataOutput {
+	timestamp := instance.PasswordDataTime
+	if timestamp.IsZero() {
+		timestamp = utils.Now()
+	}
+	return &ec2.GetPasswordDataOutput{
+		InstanceId:   aws.String(instanceID),
+		PasswordData: aws.String(instance.PasswordData),
+		Timestamp:    aws.Time(timestamp),
+	}
+}
@@ -0,0 +1,105 @@
+package daemon
+
+import (
+	"crypto/subtle"
+	"log/slog"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/nats-io/nats.go"
+)
+
+// handleEC2PhoneHome records the boot milestone for an instance whose guest
+// has reported cloud-init completion. Every node receives the request; nodes
+// that don't host the instance stay silent so the owner's reply wins.
+func (d *Daemon) handleEC2PhoneHome(msg *nats.Msg) {
+	var input types.PhoneHomeInput
+	if errResp := utils.UnmarshalJsonPayload(&input, msg.Data); errResp != nil {
+		respondWithError(msg, awserrors.ErrorValidationError)
+		return
+	}
+
+	found, valid := d.recordPhoneHome(input.InstanceID, input.Token)
+	if !found {
+		return
+	}
+	if !valid {
+		respondWithError(msg, awserrors.ErrorAuthFailure)
+		return
+	}
+	respondWithJSON(msg, struct{}{})
+}
+
+// recordPhoneHome marks the instance booted if token is its phone-home
+// token. It reports whether this node hosts the instance and whether the
+// token matched; the gateway and the metadata service both report through it.
+func (d *Daemon) recordPhoneHome(instanceID, token string) (found, valid bool) {
+	var recorded bool
+	found = d.Instances.WithVM(instanceID, func(v *vm.VM) {
+		valid = v.PhoneHomeToken != "" &&
+			subtle.ConstantTimeCompare([]byte(v.PhoneHomeToken), []byte(token)) == 1
+		if valid && v.BootedAt.IsZero() {
+			v.BootedAt = utils.Now()
+			recorded = true
+		}
+	})
+	if !found {
+		return false, false
+	}
+	if !valid {
+		slog.Warn("Rejected phone-home with invalid token", "instanceId", instanceID)
+		return true, false
+	}
+
+	// cloud-init retries on failure, so a repeat after success is harmless.
+	if recorded {
+		if err := d.WriteState(); err != nil {
+			slog.Error("Failed to persist boot milestone", "instanceId", instanceID, "err", err)
+		}
+		slog.Info("Instance phoned home", "instanceId", instanceID)
+	}
+	return true, true
+}
+
+// handleEC2DescribeInstanceBootStatus reports the boot milestone and
+// reachability checks of the caller's instances on this node. It fans out to
+// all nodes and the gateway merges the replies.
+func (d *Daemon) handleEC2DescribeInstanceBootStatus(msg *nats.Msg) {
+	accountID := utils.AccountIDFromMsg(msg)
+
+	var input types.DescribeInstanceBootStatusInput
+	if errResp := utils.UnmarshalJsonPayload(&input, msg.Data); errResp != nil {
+		respondWithError(msg, awserrors.ErrorValidationError)
+		return
+	}
+
+	wanted := make(map[string]bool, len(input.InstanceIDs))
+	for _, id := range input.InstanceIDs {
+		wanted[id] = true
+	}
+
+	output := types.DescribeInstanceBootStatusOutput{
+		Instances:    map[string]types.InstanceBootStatus{},
+		Reachability: map[string]types.InstanceReachability{},
+	}
+	for _, instance := range d.Instances.ListVMs() {
+		if len(wanted) > 0 && !wanted[instance.ID] {
+			continue
+		}
+		d.Instances.WithVM(instance.ID, func(v *vm.VM) {
+			if !isInstanceVisible(accountID, v.AccountID) {
+				return
+			}
+			if v.PhoneHomeToken != "" {
+				output.Instances[v.ID] = types.InstanceBootStatus{BootedAt: v.BootedAt}
+			}
+			if v.Status == vm.StateRunning {
+				output.Reachability[v.ID] = instanceReachability(v.Reachability)
+			}
+		})
+	}
+
+	respondWithJSON(msg, output)
+}
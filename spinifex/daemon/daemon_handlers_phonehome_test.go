@@ -0,0 +1,93 @@
+package daemon
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/testutil"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleEC2PhoneHome(t *testing.T) {
+	daemon := createTestDaemon(t, sharedNATSURL)
+	clock := testutil.NewFakeClock(time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC))
+	t.Cleanup(utils.SetClock(clock))
+
+	booting := &vm.VM{ID: "i-phonehome-1", Status: vm.StateRunning, AccountID: testAccountID, PhoneHomeToken: "tok-1"}
+	legacy := &vm.VM{ID: "i-phonehome-2", Status: vm.StateRunning, AccountID: testAccountID}
+	daemon.Instances.UpsertVM(booting)
+	daemon.Instances.UpsertVM(legacy)
+
+	// Unique subjects keep other daemons on the shared server from replying.
+	phoneHome := "test.phonehome.PhoneHome"
+	bootStatus := "test.phonehome.DescribeInstanceBootStatus"
+	sub, err := daemon.natsConn.Subscribe(phoneHome, daemon.handleEC2PhoneHome)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+	statusSub, err := daemon.natsConn.Subscribe(bootStatus, daemon.handleEC2DescribeInstanceBootStatus)
+	require.NoError(t, err)
+	defer statusSub.Unsubscribe()
+
+	describe := func() map[string]types.InstanceBootStatus {
+		t.Helper()
+		out, err := utils.NATSRequest[types.DescribeInstanceBootStatusOutput](daemon.natsConn, bootStatus,
+			types.DescribeInstanceBootStatusInput{}, 5*time.Second, testAccountID)
+		require.NoError(t, err)
+		return out.Instances
+	}
+
+	// Before phone-home only the instance expecting one is listed, not yet booted.
+	statuses := describe()
+	require.Contains(t, statuses, booting.ID)
+	assert.True(t, statuses[booting.ID].BootedAt.IsZero())
+	assert.NotContains(t, statuses, legacy.ID)
+
+	// Wrong token is rejected and records nothing.
+	_, err = utils.NATSRequest[struct{}](daemon.natsConn, phoneHome, types.PhoneHomeInput{InstanceID: booting.ID, Token: "wrong"}, 5*time.Second, "")
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorAuthFailure, err.Error())
+	assert.True(t, describe()[booting.ID].BootedAt.IsZero())
+
+	// Instances without a token can't be marked booted.
+	_, err = utils.NATSRequest[struct{}](daemon.natsConn, phoneHome, types.PhoneHomeInput{InstanceID: legacy.ID}, 5*time.Second, "")
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorAuthFailure, err.Error())
+
+	// Simulate the guest's cloud-init phone_home POST.
+	_, err = utils.NATSRequest[struct{}](daemon.natsConn, phoneHome, types.PhoneHomeInput{InstanceID: booting.ID, Token: "tok-1"}, 5*time.Second, "")
+	require.NoError(t, err)
+	bootedAt := describe()[booting.ID].BootedAt
+	assert.True(t, bootedAt.Equal(clock.Now()), "BootedAt should be set by the phone-home, got %v", bootedAt)
+
+	// cloud-init retries keep the first milestone.
+	clock.Advance(time.Minute)
+	_, err = utils.NATSRequest[struct{}](daemon.natsConn, phoneHome, types.PhoneHomeInput{InstanceID: booting.ID, Token: "tok-1"}, 5*time.Second, "")
+	require.NoError(t, err)
+	assert.Equal(t, bootedAt, describe()[booting.ID].BootedAt)
+
+	// Other accounts don't see the milestone.
+	out, err := utils.NATSRequest[types.DescribeInstanceBootStatusOutput](daemon.natsConn, bootStatus,
+		types.DescribeInstanceBootStatusInput{InstanceIDs: []string{booting.ID}}, 5*time.Second, "999999999999")
+	require.NoError(t, err)
+	assert.Empty(t, out.Instances)
+}
+
+func TestHandleEC2PhoneHome_UnknownInstanceSilent(t *testing.T) {
+	daemon := createTestDaemon(t, sharedNATSURL)
+
+	subject := "test.phonehome-unknown.PhoneHome"
+	sub, err := daemon.natsConn.Subscribe(subject, daemon.handleEC2PhoneHome)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	data, err := json.Marshal(types.PhoneHomeInput{InstanceID: "i-not-here", Token: "tok"})
+	require.NoError(t, err)
+	_, err = daemon.natsConn.Request(subject, data, 200*time.Millisecond)
+	assert.Error(t, err, "a node not hosting the instance must not reply")
+}
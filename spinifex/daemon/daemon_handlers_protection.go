@@ -0,0 +1,70 @@
+package daemon
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/nats-io/nats.go"
+)
+
+// handleModifyProtection changes the stop and termination protection of an
+// instance running on this node. The flags live on the VM, so they are
+// persisted with the node state and carried into shared KV when the
+// instance stops.
+func (d *Daemon) handleModifyProtection(msg *nats.Msg, command types.EC2InstanceCommand) {
+	if command.Protection == nil {
+		respondWithError(msg, awserrors.ErrorMissingParameter)
+		return
+	}
+
+	var disableTermination, disableStop bool
+	found := d.Instances.WithVM(command.ID, func(v *vm.VM) {
+		setProtection(v, command.Protection)
+		disableTermination = v.DisableApiTermination
+		disableStop = v.DisableApiStop
+	})
+	if !found {
+		respondWithError(msg, awserrors.ErrorInvalidInstanceIDNotFound)
+		return
+	}
+
+	if err := d.WriteState(); err != nil {
+		slog.Error("ModifyProtection: failed to persist state", "instanceId", command.ID, "err", err)
+	}
+
+	slog.Info("Modified instance protection", "instanceId", command.ID,
+		"disableApiTermination", disableTermination, "disableApiStop", disableStop)
+	respondWithJSON(msg, struct{}{})
+}
+
+// setProtection applies the protection flags set in p to instance.
+func setProtection(instance *vm.VM, p *types.ProtectionData) {
+	if p.DisableApiTermination != nil {
+		instance.DisableApiTermination = aws.BoolValue(p.DisableApiTermination)
+	}
+	if p.DisableApiStop != nil {
+		instance.DisableApiStop = aws.BoolValue(p.DisableApiStop)
+	}
+}
+
+// protectionDetail names the protection that blocks stopping (or, with
+// terminate, terminating) instance, or returns "" when nothing does.
+func protectionDetail(instance *vm.VM, terminate bool) string {
+	if terminate && instance.DisableApiTermination {
+		return fmt.Sprintf("The instance '%s' may not be terminated. Modify its 'disableApiTermination' instance attribute and try again.", instance.ID)
+	}
+	if !terminate && instance.DisableApiStop {
+		return fmt.Sprintf("The instance '%s' may not be stopped. Modify its 'disableApiStop' instance attribute and try again.", instance.ID)
+	}
+	return ""
+}
+
+// respondWithProtectionError rejects a stop or terminate blocked by the
+// protection described by detail.
+func respondWithProtectionError(msg *nats.Msg, detail string) {
+	respondWithServiceError(msg, awserrors.WithDetail(awserrors.ErrorOperationNotPermitted, detail))
+}
@@ -0,0 +1,227 @@
+package daemon
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/qmp"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleEC2Events_Protection(t *testing.T) {
+	daemon := createFullTestDaemonWithJetStream(t, sharedJSNATSURL)
+
+	tests := []struct {
+		name      string
+		attrs     types.EC2CommandAttributes
+		protect   types.ProtectionData
+		clear     types.ProtectionData
+		attribute string
+		state     vm.InstanceState
+	}{
+		{
+			name:      "stop",
+			attrs:     types.EC2CommandAttributes{StopInstance: true},
+			protect:   types.ProtectionData{DisableApiStop: aws.Bool(true)},
+			clear:     types.ProtectionData{DisableApiStop: aws.Bool(false)},
+			attribute: "disableApiStop",
+			state:     vm.StateStopping,
+		},
+		{
+			name:      "terminate",
+			attrs:     types.EC2CommandAttributes{StopInstance: true, TerminateInstance: true},
+			protect:   types.ProtectionData{DisableApiTermination: aws.Bool(true)},
+			clear:     types.ProtectionData{DisableApiTermination: aws.Bool(false)},
+			attribute: "disableApiTermination",
+			state:     vm.StateShuttingDown,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instanceID := "i-protect-" + tt.name
+			instance := &vm.VM{
+				ID:           instanceID,
+				InstanceType: getTestInstanceType(t),
+				Status:       vm.StateRunning,
+				Instance:     &ec2.Instance{},
+				QMPClient:    &qmp.QMPClient{},
+				AccountID:    testAccountID,
+			}
+			daemon.Instances.UpsertVM(instance)
+
+			sub, err := daemon.natsConn.Subscribe(subjects.InstanceCmd(instanceID), daemon.handleEC2Events)
+			require.NoError(t, err)
+			defer sub.Unsubscribe()
+
+			send := func(command types.EC2InstanceCommand) []byte {
+				t.Helper()
+				command.ID = instanceID
+				cmdData, _ := json.Marshal(command)
+				reply, err := natsRequest(daemon.natsConn, subjects.InstanceCmd(instanceID), cmdData, 5*time.Second)
+				require.NoError(t, err)
+				return reply.Data
+			}
+			status := func() vm.InstanceState {
+				daemon.Instances.Mu.Lock()
+				defer daemon.Instances.Mu.Unlock()
+				return instance.Status
+			}
+
+			protect := tt.protect
+			assert.Equal(t, `{}`, string(send(types.EC2InstanceCommand{
+				Attributes: types.EC2CommandAttributes{ModifyProtection: true},
+				Protection: &protect,
+			})))
+
+			responseError, err := utils.ValidateErrorPayload(send(types.EC2InstanceCommand{Attributes: tt.attrs}))
+			require.Error(t, err)
+			assert.Equal(t, awserrors.ErrorOperationNotPermitted, aws.StringValue(responseError.Code))
+			assert.Contains(t, aws.StringValue(responseError.Message), tt.attribute)
+			assert.Contains(t, aws.StringValue(responseError.Message), instanceID)
+			assert.Equal(t, vm.StateRunning, status())
+
+			unprotect := tt.clear
+			assert.Equal(t, `{}`, string(send(types.EC2InstanceCommand{
+				Attributes: types.EC2CommandAttributes{ModifyProtection: true},
+				Protection: &unprotect,
+			})))
+
+			assert.Equal(t, `{}`, string(send(types.EC2InstanceCommand{Attributes: tt.attrs})))
+			assert.Equal(t, tt.state, status())
+		})
+	}
+}
+
+func TestHandleEC2Events_ProtectionOnlyBlocksItsAction(t *testing.T) {
+	daemon := createFullTestDaemonWithJetStream(t, sharedJSNATSURL)
+
+	instanceID := "i-protect-terminate-only"
+	instance := &vm.VM{
+		ID:                    instanceID,
+		InstanceType:          getTestInstanceType(t),
+		Status:                vm.StateRunning,
+		Instance:              &ec2.Instance{},
+		QMPClient:             &qmp.QMPClient{},
+		AccountID:             testAccountID,
+		DisableApiTermination: true,
+	}
+	daemon.Instances.UpsertVM(instance)
+
+	sub, err := daemon.natsConn.Subscribe(subjects.InstanceCmd(instanceID), daemon.handleEC2Events)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	// Termination protection does not stop the instance being stopped.
+	cmdData, _ := json.Marshal(types.EC2InstanceCommand{ID: instanceID, Attributes: types.EC2CommandAttributes{StopInstance: true}})
+	reply, err := natsRequest(daemon.natsConn, subjects.InstanceCmd(instanceID), cmdData, 5*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, `{}`, string(reply.Data))
+}
+
+func TestHandleEC2Events_ScheduledStopIgnoresProtection(t *testing.T) {
+	daemon := createFullTestDaemonWithJetStream(t, sharedJSNATSURL)
+
+	instanceID := "i-protect-scheduled"
+	instance := &vm.VM{
+		ID:             instanceID,
+		InstanceType:   getTestInstanceType(t),
+		Status:         vm.StateRunning,
+		Instance:       &ec2.Instance{},
+		QMPClient:      &qmp.QMPClient{},
+		AccountID:      testAccountID,
+		DisableApiStop: true,
+	}
+	daemon.Instances.UpsertVM(instance)
+
+	sub, err := daemon.natsConn.Subscribe(subjects.InstanceCmd(instanceID), daemon.handleEC2Events)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	cmdData, _ := json.Marshal(types.EC2InstanceCommand{
+		ID:         instanceID,
+		Attributes: types.EC2CommandAttributes{StopInstance: true, StateReason: stateReasonScheduledStop},
+	})
+	reply, err := natsRequest(daemon.natsConn, subjects.InstanceCmd(instanceID), cmdData, 5*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, `{}`, string(reply.Data))
+}
+
+func TestHandleEC2TerminateStoppedInstance_Protection(t *testing.T) {
+	daemon := createFullTestDaemonWithJetStream(t, sharedJSNATSURL)
+
+	instanceID := "i-protect-stopped-001"
+	stoppedVM := &vm.VM{
+		ID:           instanceID,
+		Status:       vm.StateStopped,
+		InstanceType: getTestInstanceType(t),
+		AccountID:    testAccountID,
+		Instance:     &ec2.Instance{InstanceId: aws.String(instanceID)},
+	}
+	require.NoError(t, daemon.jsManager.WriteStoppedInstance(instanceID, stoppedVM))
+	t.Cleanup(func() { _ = daemon.jsManager.DeleteStoppedInstance(instanceID) })
+
+	for subject, handler := range map[string]func(*nats.Msg){
+		"ec2.terminate":                 daemon.handleEC2TerminateStoppedInstance,
+		"ec2.ModifyInstanceAttribute":   daemon.handleEC2ModifyInstanceAttribute,
+		"ec2.DescribeInstanceAttribute": daemon.handleEC2DescribeInstanceAttribute,
+	} {
+		sub, err := daemon.natsConn.QueueSubscribe(subject, "spinifex-workers", handler)
+		require.NoError(t, err)
+		defer sub.Unsubscribe()
+	}
+
+	setProtection := func(on bool) {
+		t.Helper()
+		reqData, _ := json.Marshal(&ec2.ModifyInstanceAttributeInput{
+			InstanceId:            aws.String(instanceID),
+			DisableApiTermination: &ec2.AttributeBooleanValue{Value: aws.Bool(on)},
+		})
+		reply, err := natsRequest(daemon.natsConn, "ec2.ModifyInstanceAttribute", reqData, 5*time.Second)
+		require.NoError(t, err)
+		assert.Equal(t, `{}`, string(reply.Data))
+
+		reqData, _ = json.Marshal(&ec2.DescribeInstanceAttributeInput{
+			InstanceId: aws.String(instanceID),
+			Attribute:  aws.String(ec2.InstanceAttributeNameDisableApiTermination),
+		})
+		reply, err = natsRequest(daemon.natsConn, "ec2.DescribeInstanceAttribute", reqData, 5*time.Second)
+		require.NoError(t, err)
+		var output ec2.DescribeInstanceAttributeOutput
+		require.NoError(t, json.Unmarshal(reply.Data, &output))
+		require.NotNil(t, output.DisableApiTermination)
+		assert.Equal(t, on, aws.BoolValue(output.DisableApiTermination.Value))
+	}
+	terminate := func() []byte {
+		t.Helper()
+		reqData, _ := json.Marshal(map[string]string{"instance_id": instanceID})
+		reply, err := natsRequest(daemon.natsConn, "ec2.terminate", reqData, 5*time.Second)
+		require.NoError(t, err)
+		return reply.Data
+	}
+
+	setProtection(true)
+	responseError, err := utils.ValidateErrorPayload(terminate())
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorOperationNotPermitted, aws.StringValue(responseError.Code))
+	assert.Contains(t, aws.StringValue(responseError.Message), "disableApiTermination")
+
+	loaded, err := daemon.jsManager.LoadStoppedInstance(instanceID)
+	require.NoError(t, err)
+	require.NotNil(t, loaded, "a protected instance stays in shared KV")
+	assert.True(t, loaded.DisableApiTermination)
+
+	setProtection(false)
+	var resp map[string]string
+	require.NoError(t, json.Unmarshal(terminate(), &resp))
+	assert.Equal(t, "terminated", resp["status"])
+}
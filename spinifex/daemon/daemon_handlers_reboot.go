@@ -0,0 +1,175 @@
+package daemon
+
+import (
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/config"
+	"github.com/mulgadc/spinifex/spinifex/qmp"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/nats-io/nats.go"
+)
+
+// rebootPollInterval is how often a reboot checks whether the guest has shut
+// down.
+const rebootPollInterval = time.Second
+
+// handleRebootInstance reboots a running instance the way EC2 does: the guest
+// is sent an ACPI power button press and reset once it has shut down, or
+// hard reset if it ignores the press for the reboot grace period. QEMU is
+// told to halt rather than exit when the guest powers off, so the instance
+// stays running throughout. The request is answered once the press is sent.
+func (d *Daemon) handleRebootInstance(msg *nats.Msg, command types.EC2InstanceCommand, instance *vm.VM) {
+	slog.Info("Rebooting instance", "id", command.ID)
+
+	d.Instances.Mu.Lock()
+	status := instance.Status
+	d.Instances.Mu.Unlock()
+
+	if status != vm.StateRunning {
+		slog.Error("RebootInstance: instance not in running state", "instanceId", command.ID, "status", status)
+		respondWithError(msg, awserrors.ErrorIncorrectInstanceState)
+		return
+	}
+
+	if _, busy := d.rebooting.LoadOrStore(command.ID, struct{}{}); busy {
+		slog.Info("Instance reboot already in progress", "instanceId", command.ID)
+		respondRebootAccepted(msg)
+		return
+	}
+
+	if err := d.setShutdownAction(instance, "pause"); err != nil {
+		// Without set-action (QEMU before 6.0) a guest that shut down would
+		// take QEMU with it, so fall back to a hard reset.
+		d.rebooting.Delete(command.ID)
+		slog.Warn("RebootInstance: QMP set-action failed, resetting instead", "instanceId", command.ID, "err", err)
+		if _, err := d.SendQMPCommand(instance.QMPClient, qmp.QMPCommand{Execute: "system_reset"}, command.ID); err != nil {
+			slog.Error("RebootInstance: QMP system_reset failed", "instanceId", command.ID, "err", err)
+			respondWithQMPError(msg, err)
+			return
+		}
+		slog.Info("Instance rebooted", "instanceId", command.ID, "graceful", false)
+		respondRebootAccepted(msg)
+		return
+	}
+
+	if _, err := d.SendQMPCommand(instance.QMPClient, qmp.QMPCommand{Execute: "system_powerdown"}, command.ID); err != nil {
+		slog.Error("RebootInstance: QMP system_powerdown failed", "instanceId", command.ID, "err", err)
+		d.restoreShutdownAction(instance)
+		d.rebooting.Delete(command.ID)
+		respondWithQMPError(msg, err)
+		return
+	}
+
+	respondRebootAccepted(msg)
+	go d.finishReboot(instance, d.rebootGrace())
+}
+
+// finishReboot waits up to grace for the guest to shut down after the power
+// button press, then resets it and, if it had halted, resumes it.
+func (d *Daemon) finishReboot(instance *vm.VM, grace time.Duration) {
+	defer d.rebooting.Delete(instance.ID)
+
+	deadline := time.After(grace)
+	ticker := time.NewTicker(rebootPollInterval)
+	defer ticker.Stop()
+
+	halted := false
+	for !halted {
+		expired := false
+		select {
+		case <-deadline:
+			expired = true
+		case <-ticker.C:
+		}
+		if d.abandonReboot(instance) {
+			return
+		}
+		if expired {
+			slog.Warn("Guest did not shut down for reboot, resetting", "instanceId", instance.ID, "grace", grace)
+			break
+		}
+		halted = d.guestHalted(instance)
+	}
+
+	if _, err := d.SendQMPCommand(instance.QMPClient, qmp.QMPCommand{Execute: "system_reset"}, instance.ID); err != nil {
+		slog.Error("RebootInstance: QMP system_reset failed", "instanceId", instance.ID, "err", err)
+	}
+	if halted {
+		if _, err := d.SendQMPCommand(instance.QMPClient, qmp.QMPCommand{Execute: "cont"}, instance.ID); err != nil {
+			slog.Error("RebootInstance: QMP cont failed", "instanceId", instance.ID, "err", err)
+		}
+	}
+	d.restoreShutdownAction(instance)
+	slog.Info("Instance rebooted", "instanceId", instance.ID, "graceful", halted)
+}
+
+// abandonReboot gives way to a stop or terminate that arrived while a reboot
+// was waiting on the guest. QEMU is told to exit on power off again, and one
+// the guest already halted is quit so the stop sees the process exit.
+func (d *Daemon) abandonReboot(instance *vm.VM) bool {
+	d.Instances.Mu.Lock()
+	status := instance.Status
+	d.Instances.Mu.Unlock()
+	if status == vm.StateRunning {
+		return false
+	}
+
+	slog.Info("Reboot abandoned, instance is no longer running", "instanceId", instance.ID, "status", status)
+	halted := d.guestHalted(instance)
+	d.restoreShutdownAction(instance)
+	if halted {
+		if _, err := d.SendQMPCommand(instance.QMPClient, qmp.QMPCommand{Execute: "quit"}, instance.ID); err != nil {
+			slog.Warn("Failed to quit halted QEMU", "instanceId", instance.ID, "err", err)
+		}
+	}
+	return true
+}
+
+// guestHalted reports whether the guest has shut down and QEMU is holding it
+// halted.
+func (d *Daemon) guestHalted(instance *vm.VM) bool {
+	resp, err := d.SendQMPCommand(instance.QMPClient, qmp.QMPCommand{Execute: "query-status"}, instance.ID)
+	if err != nil {
+		slog.Warn("RebootInstance: QMP query-status failed", "instanceId", instance.ID, "err", err)
+		return false
+	}
+	var status qmp.Status
+	if err := json.Unmarshal(resp.Return, &status); err != nil {
+		return false
+	}
+	return status.Status == "shutdown"
+}
+
+// setShutdownAction sets what QEMU does when the guest powers off: "pause"
+// holds it halted, "poweroff" (the default) exits QEMU.
+func (d *Daemon) setShutdownAction(instance *vm.VM, action string) error {
+	_, err := d.SendQMPCommand(instance.QMPClient, qmp.QMPCommand{
+		Execute:   "set-action",
+		Arguments: map[string]any{"shutdown": action},
+	}, instance.ID)
+	return err
+}
+
+// restoreShutdownAction returns QEMU to exiting when the guest powers off.
+func (d *Daemon) restoreShutdownAction(instance *vm.VM) {
+	if err := d.setShutdownAction(instance, "poweroff"); err != nil {
+		slog.Error("Failed to restore QEMU shutdown action", "instanceId", instance.ID, "err", err)
+	}
+}
+
+// rebootGrace returns how long a reboot waits for the guest to shut down.
+func (d *Daemon) rebootGrace() time.Duration {
+	if d.config == nil {
+		return config.DefaultRebootGrace
+	}
+	return d.config.Daemon.RebootGrace()
+}
+
+// respondRebootAccepted acknowledges a reboot request.
+func respondRebootAccepted(msg *nats.Msg) {
+	respondWithJSON(msg, struct{}{})
+}
@@ -0,0 +1,171 @@
+package daemon
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mulgadc/spinifex/spinifex/config"
+	"github.com/mulgadc/spinifex/spinifex/qmp"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rebootGuest is a mock QEMU for reboot tests. It records the QMP commands it
+// receives and reports the guest halted once halts is set.
+type rebootGuest struct {
+	mu       sync.Mutex
+	commands []string
+	halts    bool
+	noAction bool
+}
+
+func (g *rebootGuest) respond(cmd qmp.QMPCommand) map[string]any {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	name := cmd.Execute
+	if action, ok := cmd.Arguments["shutdown"].(string); ok {
+		name += ":" + action
+	}
+	g.commands = append(g.commands, name)
+
+	switch cmd.Execute {
+	case "set-action":
+		if g.noAction {
+			return map[string]any{"error": map[string]any{"class": "CommandNotFound", "desc": "The command set-action has not been found"}}
+		}
+	case "query-status":
+		status := "running"
+		if g.halts {
+			status = "shutdown"
+		}
+		return map[string]any{"return": map[string]any{"status": status, "running": !g.halts}}
+	}
+	return map[string]any{"return": map[string]any{}}
+}
+
+func (g *rebootGuest) sent() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var sent []string
+	for _, c := range g.commands {
+		if c != "query-status" {
+			sent = append(sent, c)
+		}
+	}
+	return sent
+}
+
+func rebootTestDaemon(t *testing.T, guest *rebootGuest, graceSeconds int) (*Daemon, *vm.VM, func() []byte) {
+	t.Helper()
+	nc, err := nats.Connect(sharedNATSURL)
+	require.NoError(t, err)
+	t.Cleanup(nc.Close)
+
+	qmpClient, cancel := newMockQMPClient(t, guest.respond)
+	t.Cleanup(cancel)
+
+	instance := &vm.VM{ID: "i-reboot-" + t.Name(), Status: vm.StateRunning, QMPClient: qmpClient}
+	d := &Daemon{
+		natsConn:  nc,
+		config:    &config.Config{Daemon: config.DaemonConfig{RebootGraceSeconds: graceSeconds}},
+		Instances: vm.Instances{VMS: map[string]*vm.VM{instance.ID: instance}},
+	}
+
+	reboot := func() []byte {
+		t.Helper()
+		cmd := types.EC2InstanceCommand{ID: instance.ID, Attributes: types.EC2CommandAttributes{RebootInstance: true}}
+		subject := "ec2.cmd." + instance.ID
+		sub, err := nc.Subscribe(subject, func(msg *nats.Msg) { d.handleRebootInstance(msg, cmd, instance) })
+		require.NoError(t, err)
+		defer sub.Unsubscribe()
+
+		data, _ := json.Marshal(cmd)
+		reply, err := nc.Request(subject, data, 5*time.Second)
+		require.NoError(t, err)
+		return reply.Data
+	}
+	return d, instance, reboot
+}
+
+// rebootDone waits for the reboot of instance to finish in the background.
+func rebootDone(t *testing.T, d *Daemon, instance *vm.VM) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		_, busy := d.rebooting.Load(instance.ID)
+		return !busy
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestHandleRebootInstance_GuestShutsDown(t *testing.T) {
+	guest := &rebootGuest{halts: true}
+	d, instance, reboot := rebootTestDaemon(t, guest, 30)
+
+	assert.Equal(t, `{}`, string(reboot()))
+	rebootDone(t, d, instance)
+
+	assert.Equal(t, []string{
+		"set-action:pause", "system_powerdown", "system_reset", "cont", "set-action:poweroff",
+	}, guest.sent())
+	assert.Equal(t, vm.StateRunning, instance.Status)
+}
+
+func TestHandleRebootInstance_GraceExpires(t *testing.T) {
+	guest := &rebootGuest{}
+	d, instance, reboot := rebootTestDaemon(t, guest, 1)
+
+	assert.Equal(t, `{}`, string(reboot()))
+	rebootDone(t, d, instance)
+
+	// The guest ignored the power button, so it is reset where it runs.
+	assert.Equal(t, []string{
+		"set-action:pause", "system_powerdown", "system_reset", "set-action:poweroff",
+	}, guest.sent())
+}
+
+func TestHandleRebootInstance_NoSetAction(t *testing.T) {
+	guest := &rebootGuest{noAction: true}
+	d, instance, reboot := rebootTestDaemon(t, guest, 30)
+
+	assert.Equal(t, `{}`, string(reboot()))
+	assert.Equal(t, []string{"set-action:pause", "system_reset"}, guest.sent())
+	_, busy := d.rebooting.Load(instance.ID)
+	assert.False(t, busy)
+}
+
+func TestHandleRebootInstance_StopTakesOver(t *testing.T) {
+	guest := &rebootGuest{}
+	d, instance, reboot := rebootTestDaemon(t, guest, 30)
+
+	assert.Equal(t, `{}`, string(reboot()))
+
+	// A stop powers the guest down while the reboot waits on it.
+	d.Instances.Mu.Lock()
+	instance.Status = vm.StateStopping
+	d.Instances.Mu.Unlock()
+	guest.mu.Lock()
+	guest.halts = true
+	guest.mu.Unlock()
+	rebootDone(t, d, instance)
+
+	assert.Equal(t, []string{
+		"set-action:pause", "system_powerdown", "set-action:poweroff", "quit",
+	}, guest.sent())
+}
+
+func TestHandleRebootInstance_InProgress(t *testing.T) {
+	guest := &rebootGuest{}
+	d, instance, reboot := rebootTestDaemon(t, guest, 1)
+
+	assert.Equal(t, `{}`, string(reboot()))
+	assert.Equal(t, `{}`, string(reboot()))
+	rebootDone(t, d, instance)
+
+	assert.Equal(t, []string{
+		"set-action:pause", "system_powerdown", "system_reset", "set-action:poweroff",
+	}, guest.sent(), "the second request joins the reboot in progress")
+}
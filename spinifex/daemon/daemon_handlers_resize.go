@@ -0,0 +1,288 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/instancetypes"
+	"github.com/mulgadc/spinifex/spinifex/qmp"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/nats-io/nats.go"
+)
+
+// hotplugMemoryPath is the QOM path of the virtio-mem device that holds a
+// guest's hot-plugged memory.
+const hotplugMemoryPath = "/machine/peripheral/" + vm.HotplugMemoryDevice
+
+// errGuestRejectedResize is returned when the guest doesn't take vCPUs or
+// memory offline, or online, within its time budget.
+var errGuestRejectedResize = errors.New("guest did not complete the resize")
+
+// handleResizeInstance changes the instance type of a running instance to
+// another size of its family by hot-plugging vCPUs and memory. The instance
+// can only move between its boot size and the limits it was started with
+// (see ResourceManager.hotplugLimits); anything else needs a stop. A larger
+// size is reserved with the ResourceManager first, and every change is
+// rolled back if the guest doesn't accept it.
+func (d *Daemon) handleResizeInstance(msg *nats.Msg, command types.EC2InstanceCommand, instance *vm.VM) {
+	if command.ResizeInstanceData == nil || command.ResizeInstanceData.InstanceType == "" {
+		respondWithError(msg, awserrors.ErrorMissingParameter)
+		return
+	}
+	newType := command.ResizeInstanceData.InstanceType
+
+	d.Instances.Mu.Lock()
+	status := instance.Status
+	oldType := instance.InstanceType
+	cfg := instance.Config
+	d.Instances.Mu.Unlock()
+
+	if status != vm.StateRunning {
+		slog.Error("ResizeInstance: instance not running", "instanceId", instance.ID, "status", status)
+		respondWithError(msg, awserrors.ErrorIncorrectInstanceState)
+		return
+	}
+	if newType == oldType {
+		respondWithJSON(msg, struct{}{})
+		return
+	}
+
+	from := d.resourceMgr.instanceTypes[oldType]
+	to := d.resourceMgr.instanceTypes[newType]
+	if from == nil || to == nil {
+		slog.Error("ResizeInstance: unknown instance type", "instanceId", instance.ID, "oldType", oldType, "newType", newType)
+		respondWithError(msg, awserrors.ErrorInvalidInstanceAttributeValue)
+		return
+	}
+	if detail := resizeDetail(instance.ID, cfg, oldType, newType, to); detail != "" {
+		slog.Warn("ResizeInstance: type can't be changed while running", "instanceId", instance.ID, "newType", newType, "detail", detail)
+		respondWithServiceError(msg, awserrors.WithDetail(awserrors.ErrorIncorrectInstanceState, detail))
+		return
+	}
+
+	vCPUs, newVCPUs := int(instanceTypeVCPUs(from)), int(instanceTypeVCPUs(to))
+	memMiB, newMemMiB := int(instanceTypeMemoryMiB(from)), int(instanceTypeMemoryMiB(to))
+	growing := newVCPUs > vCPUs || newMemMiB > memMiB
+
+	// A larger size is reserved before the guest sees it; a smaller one is
+	// only released once the guest has let go.
+	if growing {
+		if err := d.resourceMgr.resize(from, to); err != nil {
+			slog.Warn("ResizeInstance: insufficient capacity", "instanceId", instance.ID, "newType", newType, "err", err)
+			respondWithCapacityError(msg, err)
+			return
+		}
+	}
+
+	if err := d.resizeGuest(instance, cfg, vCPUs, newVCPUs, memMiB, newMemMiB); err != nil {
+		if growing {
+			_ = d.resourceMgr.resize(to, from)
+		}
+		slog.Error("ResizeInstance: failed", "instanceId", instance.ID, "oldType", oldType, "newType", newType, "err", err)
+		if errors.Is(err, errGuestRejectedResize) {
+			respondWithServiceError(msg, awserrors.WithDetail(awserrors.ErrorIncorrectInstanceState,
+				fmt.Sprintf("The guest on instance '%s' did not accept the change to %s.", instance.ID, newType)))
+			return
+		}
+		respondWithQMPError(msg, err)
+		return
+	}
+
+	if !growing {
+		_ = d.resourceMgr.resize(from, to)
+	}
+
+	d.Instances.Mu.Lock()
+	instance.InstanceType = newType
+	instance.Config.InstanceType = newType
+	if instance.Instance != nil {
+		instance.Instance.InstanceType = aws.String(newType)
+	}
+	instance.CPUCredits = retypeCPUCredits(instance.CPUCredits, newType)
+	d.Instances.Mu.Unlock()
+
+	d.updateEBSThrottle(instance)
+	if pid, err := utils.ReadPidFile(instance.ID); err == nil && pid > 0 {
+		d.applyInstanceCgroup(instance, pid)
+	}
+
+	if err := d.WriteState(); err != nil {
+		slog.Error("ResizeInstance: failed to write state", "instanceId", instance.ID, "err", err)
+	}
+
+	respondWithJSON(msg, struct{}{})
+	slog.Info("Instance resized", "instanceId", instance.ID, "oldType", oldType, "newType", newType,
+		"vCPUs", newVCPUs, "memoryMiB", newMemMiB)
+}
+
+// resizeDetail returns why the running instance id, started with cfg,
+// can't be changed from oldType to newType (whose info is to), or "" when
+// it can.
+func resizeDetail(id string, cfg vm.Config, oldType, newType string, to *ec2.InstanceTypeInfo) string {
+	if _, _, ok := instancetypes.HotplugCeiling(newType); !ok || !instancetypes.SameFamily(oldType, newType) {
+		return fmt.Sprintf("The instance '%s' must be stopped to change its type from %s to %s.", id, oldType, newType)
+	}
+	vCPUs, memMiB := int(instanceTypeVCPUs(to)), int(instanceTypeMemoryMiB(to))
+	if vCPUs < cfg.CPUCount || memMiB < cfg.Memory {
+		return fmt.Sprintf("The instance '%s' cannot shrink below the size it was started with while running.", id)
+	}
+	if vCPUs > max(cfg.CPUCount, cfg.MaxCPUCount) || memMiB > max(cfg.Memory, cfg.MaxMemory) {
+		return fmt.Sprintf("The instance '%s' was started with room for at most %d vCPUs and %d MiB; stop it to change its type to %s.",
+			id, max(cfg.CPUCount, cfg.MaxCPUCount), max(cfg.Memory, cfg.MaxMemory), newType)
+	}
+	return ""
+}
+
+// resizeGuest moves the guest from vCPUs and memMiB to newVCPUs and
+// newMemMiB, restoring whatever it changed if a later step fails.
+func (d *Daemon) resizeGuest(instance *vm.VM, cfg vm.Config, vCPUs, newVCPUs, memMiB, newMemMiB int) error {
+	if newVCPUs != vCPUs {
+		if err := d.setVCPUs(instance, newVCPUs); err != nil {
+			d.rollbackVCPUs(instance, vCPUs)
+			return err
+		}
+	}
+	if newMemMiB != memMiB && cfg.MaxMemory > cfg.Memory {
+		if err := d.setHotplugMemory(instance, newMemMiB-cfg.Memory); err != nil {
+			d.rollbackHotplugMemory(instance, memMiB-cfg.Memory)
+			if newVCPUs != vCPUs {
+				d.rollbackVCPUs(instance, vCPUs)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// setVCPUs plugs vCPUs into empty slots, or unplugs the ones plugged in
+// earlier, until the guest has count. Unplugging needs the guest to take the
+// vCPUs offline, so it is polled at d.detachDelay.
+func (d *Daemon) setVCPUs(instance *vm.VM, count int) error {
+	const maxAttempts = 20 // 20 × detachDelay (default 1s) = 20s budget
+	slots, err := d.queryCPUSlots(instance)
+	if err != nil {
+		return err
+	}
+
+	plugged := pluggedVCPUs(slots)
+	if plugged == count {
+		return nil
+	}
+	if plugged < count {
+		for i, slot := range slots {
+			if plugged >= count {
+				break
+			}
+			if slot.QOMPath != "" {
+				continue
+			}
+			if _, err := d.SendQMPCommand(instance.QMPClient, qmp.DeviceAddCPU(fmt.Sprintf("vcpu%d", i), slot), instance.ID); err != nil {
+				return err
+			}
+			plugged += slot.VCPUsCount
+		}
+		if plugged < count {
+			return fmt.Errorf("only %d of %d vCPU slots available", plugged, count)
+		}
+		return nil
+	}
+
+	for _, slot := range slots {
+		if plugged <= count {
+			break
+		}
+		id, ok := strings.CutPrefix(slot.QOMPath, "/machine/peripheral/")
+		if !ok {
+			continue
+		}
+		if _, err := d.SendQMPCommand(instance.QMPClient, qmp.DeviceDel(id), instance.ID); err != nil && !isQMPDeviceNotFound(err) {
+			return err
+		}
+		plugged -= slot.VCPUsCount
+	}
+
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		slots, err := d.queryCPUSlots(instance)
+		if err != nil {
+			return err
+		}
+		if pluggedVCPUs(slots) <= count {
+			return nil
+		}
+		time.Sleep(d.detachDelay)
+	}
+	return errGuestRejectedResize
+}
+
+// rollbackVCPUs returns the guest to count vCPUs after a failed resize.
+func (d *Daemon) rollbackVCPUs(instance *vm.VM, count int) {
+	if err := d.setVCPUs(instance, count); err != nil {
+		slog.Error("ResizeInstance: failed to restore vCPUs", "instanceId", instance.ID, "vCPUs", count, "err", err)
+	}
+}
+
+// queryCPUSlots returns the guest's vCPU slots.
+func (d *Daemon) queryCPUSlots(instance *vm.VM) ([]qmp.HotpluggableCPU, error) {
+	resp, err := d.SendQMPCommand(instance.QMPClient, qmp.QueryHotpluggableCPUs(), instance.ID)
+	if err != nil {
+		return nil, err
+	}
+	var slots []qmp.HotpluggableCPU
+	if err := json.Unmarshal(resp.Return, &slots); err != nil {
+		return nil, fmt.Errorf("decode query-hotpluggable-cpus: %w", err)
+	}
+	return slots, nil
+}
+
+// pluggedVCPUs returns the number of vCPUs in the occupied slots.
+func pluggedVCPUs(slots []qmp.HotpluggableCPU) int {
+	n := 0
+	for _, slot := range slots {
+		if slot.QOMPath != "" {
+			n += slot.VCPUsCount
+		}
+	}
+	return n
+}
+
+// setHotplugMemory asks the guest's virtio-mem device for sizeMiB and polls
+// at d.detachDelay until the guest has plugged or unplugged that much.
+func (d *Daemon) setHotplugMemory(instance *vm.VM, sizeMiB int) error {
+	const maxAttempts = 20 // 20 × detachDelay (default 1s) = 20s budget
+	want := int64(sizeMiB) << 20
+	if _, err := d.SendQMPCommand(instance.QMPClient, qmp.QOMSet(hotplugMemoryPath, "requested-size", want), instance.ID); err != nil {
+		return err
+	}
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		resp, err := d.SendQMPCommand(instance.QMPClient, qmp.QOMGet(hotplugMemoryPath, "size"), instance.ID)
+		if err != nil {
+			return err
+		}
+		var size int64
+		if err := json.Unmarshal(resp.Return, &size); err != nil {
+			return fmt.Errorf("decode virtio-mem size: %w", err)
+		}
+		if size == want {
+			return nil
+		}
+		time.Sleep(d.detachDelay)
+	}
+	return errGuestRejectedResize
+}
+
+// rollbackHotplugMemory asks the guest's virtio-mem device for sizeMiB
+// again after a failed resize, without waiting for the guest.
+func (d *Daemon) rollbackHotplugMemory(instance *vm.VM, sizeMiB int) {
+	if _, err := d.SendQMPCommand(instance.QMPClient, qmp.QOMSet(hotplugMemoryPath, "requested-size", int64(sizeMiB)<<20), instance.ID); err != nil {
+		slog.Error("ResizeInstance: failed to restore memory", "instanceId", instance.ID, "memoryMiB", sizeMiB, "err", err)
+	}
+}
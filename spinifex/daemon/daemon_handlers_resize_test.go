@@ -0,0 +1,231 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/config"
+	"github.com/mulgadc/spinifex/spinifex/qmp"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func resizeTestType(name string, vCPUs, memMiB int64) *ec2.InstanceTypeInfo {
+	return &ec2.InstanceTypeInfo{
+		InstanceType: aws.String(name),
+		VCpuInfo:     &ec2.VCpuInfo{DefaultVCpus: aws.Int64(vCPUs)},
+		MemoryInfo:   &ec2.MemoryInfo{SizeInMiB: aws.Int64(memMiB)},
+	}
+}
+
+// hotplugGuest is a mock QMP guest with four vCPU slots, two of them
+// plugged at boot, and a virtio-mem device.
+type hotplugGuest struct {
+	mu            sync.Mutex
+	slots         []qmp.HotpluggableCPU
+	requestedSize float64
+	rejectUnplug  bool
+	rejectMemory  bool
+}
+
+func newHotplugGuest() *hotplugGuest {
+	g := &hotplugGuest{}
+	for i := range 4 {
+		slot := qmp.HotpluggableCPU{Type: "host-x86_64-cpu", VCPUsCount: 1, Props: map[string]any{"socket-id": i, "core-id": 0, "thread-id": 0}}
+		if i < 2 {
+			slot.QOMPath = fmt.Sprintf("/machine/unattached/device[%d]", i)
+		}
+		g.slots = append(g.slots, slot)
+	}
+	return g
+}
+
+func (g *hotplugGuest) handle(cmd qmp.QMPCommand) map[string]any {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	switch cmd.Execute {
+	case "query-hotpluggable-cpus":
+		return map[string]any{"return": g.slots}
+	case "device_add":
+		for i := range g.slots {
+			if g.slots[i].Props["socket-id"] == int(cmd.Arguments["socket-id"].(float64)) {
+				g.slots[i].QOMPath = "/machine/peripheral/" + cmd.Arguments["id"].(string)
+			}
+		}
+	case "device_del":
+		if !g.rejectUnplug {
+			for i := range g.slots {
+				if g.slots[i].QOMPath == "/machine/peripheral/"+cmd.Arguments["id"].(string) {
+					g.slots[i].QOMPath = ""
+				}
+			}
+		}
+	case "qom-set":
+		if cmd.Arguments["property"] == "requested-size" {
+			g.requestedSize = cmd.Arguments["value"].(float64)
+		}
+	case "qom-get":
+		if g.rejectMemory {
+			return map[string]any{"return": 0}
+		}
+		return map[string]any{"return": g.requestedSize}
+	}
+	return map[string]any{"return": map[string]any{}}
+}
+
+func (g *hotplugGuest) vCPUs() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return pluggedVCPUs(g.slots)
+}
+
+func TestHandleResizeInstance(t *testing.T) {
+	nc, err := nats.Connect(sharedNATSURL)
+	require.NoError(t, err)
+	t.Cleanup(nc.Close)
+
+	guest := newHotplugGuest()
+	qmpClient, cancel := newMockQMPClient(t, guest.handle)
+	t.Cleanup(cancel)
+
+	instance := &vm.VM{ID: "i-hotplug", InstanceType: "m5.large", Status: vm.StateRunning, QMPClient: qmpClient,
+		Instance: &ec2.Instance{InstanceType: aws.String("m5.large")},
+		Config:   vm.Config{CPUCount: 2, Memory: 8192, MaxCPUCount: 4, MaxMemory: 16384}}
+	d := &Daemon{
+		natsConn:  nc,
+		config:    &config.Config{},
+		Instances: vm.Instances{VMS: map[string]*vm.VM{instance.ID: instance}},
+		resourceMgr: &ResourceManager{
+			instanceTypes: map[string]*ec2.InstanceTypeInfo{
+				"m5.large":   resizeTestType("m5.large", 2, 8192),
+				"m5.xlarge":  resizeTestType("m5.xlarge", 4, 16384),
+				"m5.2xlarge": resizeTestType("m5.2xlarge", 8, 32768),
+				"t3.large":   resizeTestType("t3.large", 2, 8192),
+			},
+			hostVCPU:      8,
+			hostMemGB:     32,
+			allocatedVCPU: 2,
+			allocatedMem:  8,
+		},
+	}
+
+	resize := func(instanceType string) string {
+		t.Helper()
+		cmd := types.EC2InstanceCommand{ID: instance.ID, Attributes: types.EC2CommandAttributes{ResizeInstance: true},
+			ResizeInstanceData: &types.ResizeInstanceData{InstanceType: instanceType}}
+		subject := "test.resize-instance." + instance.ID
+		sub, err := nc.Subscribe(subject, func(msg *nats.Msg) { d.handleResizeInstance(msg, cmd, instance) })
+		require.NoError(t, err)
+		defer sub.Unsubscribe()
+
+		payload, _ := json.Marshal(cmd)
+		reply, err := nc.Request(subject, payload, 5*time.Second)
+		require.NoError(t, err)
+		return string(reply.Data)
+	}
+	allocated := func() (int, float64) {
+		d.resourceMgr.mu.RLock()
+		defer d.resourceMgr.mu.RUnlock()
+		return d.resourceMgr.allocatedVCPU, d.resourceMgr.allocatedMem
+	}
+
+	t.Run("grow", func(t *testing.T) {
+		assert.Equal(t, `{}`, resize("m5.xlarge"))
+		assert.Equal(t, 4, guest.vCPUs())
+		assert.InDelta(t, float64(8192<<20), guest.requestedSize, 0)
+		assert.Equal(t, "m5.xlarge", instance.InstanceType)
+		assert.Equal(t, "m5.xlarge", aws.StringValue(instance.Instance.InstanceType))
+		vCPUs, mem := allocated()
+		assert.Equal(t, 4, vCPUs)
+		assert.InDelta(t, 16.0, mem, 0)
+	})
+
+	t.Run("shrink", func(t *testing.T) {
+		assert.Equal(t, `{}`, resize("m5.large"))
+		assert.Equal(t, 2, guest.vCPUs())
+		assert.InDelta(t, 0, guest.requestedSize, 0)
+		vCPUs, mem := allocated()
+		assert.Equal(t, 2, vCPUs)
+		assert.InDelta(t, 8.0, mem, 0)
+	})
+
+	t.Run("beyond start limits", func(t *testing.T) {
+		out := resize("m5.2xlarge")
+		assert.Contains(t, out, awserrors.ErrorIncorrectInstanceState)
+		assert.Contains(t, out, "at most 4 vCPUs and 16384 MiB")
+	})
+
+	t.Run("other family", func(t *testing.T) {
+		out := resize("t3.large")
+		assert.Contains(t, out, awserrors.ErrorIncorrectInstanceState)
+		assert.Contains(t, out, "must be stopped")
+	})
+
+	t.Run("unknown type", func(t *testing.T) {
+		assert.Contains(t, resize("m5.huge"), awserrors.ErrorInvalidInstanceAttributeValue)
+	})
+
+	t.Run("guest rejects memory", func(t *testing.T) {
+		guest.mu.Lock()
+		guest.rejectMemory = true
+		guest.mu.Unlock()
+		t.Cleanup(func() {
+			guest.mu.Lock()
+			guest.rejectMemory = false
+			guest.mu.Unlock()
+		})
+
+		assert.Contains(t, resize("m5.xlarge"), "did not accept the change")
+		assert.Equal(t, 2, guest.vCPUs(), "vCPUs are rolled back")
+		assert.InDelta(t, 0, guest.requestedSize, 0)
+		assert.Equal(t, "m5.large", instance.InstanceType)
+		vCPUs, mem := allocated()
+		assert.Equal(t, 2, vCPUs)
+		assert.InDelta(t, 8.0, mem, 0)
+	})
+
+	t.Run("insufficient capacity", func(t *testing.T) {
+		d.resourceMgr.mu.Lock()
+		d.resourceMgr.allocatedVCPU = 7
+		d.resourceMgr.mu.Unlock()
+		t.Cleanup(func() {
+			d.resourceMgr.mu.Lock()
+			d.resourceMgr.allocatedVCPU = 2
+			d.resourceMgr.mu.Unlock()
+		})
+
+		assert.Contains(t, resize("m5.xlarge"), awserrors.ErrorInsufficientInstanceCapacity)
+		assert.Equal(t, 2, guest.vCPUs())
+	})
+
+	t.Run("not running", func(t *testing.T) {
+		instance.Status = vm.StateStopping
+		t.Cleanup(func() { instance.Status = vm.StateRunning })
+		assert.Contains(t, resize("m5.xlarge"), awserrors.ErrorIncorrectInstanceState)
+	})
+}
+
+func TestHotplugLimits(t *testing.T) {
+	rm := &ResourceManager{hostVCPU: 8, hostMemGB: 20.5, reservedVCPU: 2, reservedMem: 2}
+
+	vCPUs, memMiB := rm.hotplugLimits(resizeTestType("m5.large", 2, 8192))
+	assert.Equal(t, 6, vCPUs, "capped at the schedulable vCPUs")
+	assert.Equal(t, 18*1024, memMiB, "capped at whole GiB of schedulable memory")
+
+	vCPUs, memMiB = rm.hotplugLimits(resizeTestType("t3.large", 2, 8192))
+	assert.Zero(t, vCPUs, "burstable types aren't resized while running")
+	assert.Zero(t, memMiB)
+
+	vCPUs, memMiB = rm.hotplugLimits(resizeTestType("m5.8xlarge", 32, 131072))
+	assert.Zero(t, vCPUs, "no room above the boot size")
+	assert.Zero(t, memMiB)
+}
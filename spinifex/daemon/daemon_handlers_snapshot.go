@@ -19,3 +19,11 @@ func (d *Daemon) handleEC2DeleteSnapshot(msg *nats.Msg) {
 func (d *Daemon) handleEC2CopySnapshot(msg *nats.Msg) {
 	handleNATSRequest(msg, d.snapshotService.CopySnapshot)
 }
+
+func (d *Daemon) handleEC2DescribeSnapshotTree(msg *nats.Msg) {
+	handleNATSRequest(msg, d.snapshotService.DescribeSnapshotTree)
+}
+
+func (d *Daemon) handleEC2CreateSnapshotsByTag(msg *nats.Msg) {
+	handleNATSRequest(msg, d.snapshotService.CreateSnapshotsByTag)
+}
@@ -1,6 +1,15 @@
 package daemon
 
-import "github.com/nats-io/nats.go"
+import (
+	"errors"
+	"log/slog"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/nats-io/nats.go"
+)
 
 func (d *Daemon) handleEC2CreateTags(msg *nats.Msg) {
 	handleNATSRequest(msg, d.tagsService.CreateTags)
@@ -13,3 +22,98 @@ func (d *Daemon) handleEC2DeleteTags(msg *nats.Msg) {
 func (d *Daemon) handleEC2DescribeTags(msg *nats.Msg) {
 	handleNATSRequest(msg, d.tagsService.DescribeTags)
 }
+
+func (d *Daemon) handleEC2BatchCreateTags(msg *nats.Msg) {
+	handleNATSRequest(msg, d.tagsService.BatchCreateTags)
+}
+
+func (d *Daemon) handleEC2BatchDeleteTags(msg *nats.Msg) {
+	handleNATSRequest(msg, d.tagsService.BatchDeleteTags)
+}
+
+// lookupTaggedResource checks that a resource the tags service can't find in
+// the shared bucket exists for accountID, returning its NotFound error when
+// it doesn't. Resources of a service this node hasn't started are assumed to
+// exist.
+func (d *Daemon) lookupTaggedResource(accountID, resourceID string) error {
+	ids := []*string{aws.String(resourceID)}
+	var count int
+	var notFound string
+	var err error
+	switch {
+	case strings.HasPrefix(resourceID, "i-"):
+		return d.lookupTaggedInstance(accountID, resourceID)
+	case strings.HasPrefix(resourceID, "vpc-") && d.vpcService != nil:
+		notFound = awserrors.ErrorInvalidVpcIDNotFound
+		var out *ec2.DescribeVpcsOutput
+		if out, err = d.vpcService.DescribeVpcs(&ec2.DescribeVpcsInput{VpcIds: ids}, accountID); err == nil {
+			count = len(out.Vpcs)
+		}
+	case strings.HasPrefix(resourceID, "subnet-") && d.vpcService != nil:
+		notFound = awserrors.ErrorInvalidSubnetIDNotFound
+		var out *ec2.DescribeSubnetsOutput
+		if out, err = d.vpcService.DescribeSubnets(&ec2.DescribeSubnetsInput{SubnetIds: ids}, accountID); err == nil {
+			count = len(out.Subnets)
+		}
+	case strings.HasPrefix(resourceID, "sg-") && d.vpcService != nil:
+		notFound = awserrors.ErrorInvalidGroupNotFound
+		var out *ec2.DescribeSecurityGroupsOutput
+		if out, err = d.vpcService.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{GroupIds: ids}, accountID); err == nil {
+			count = len(out.SecurityGroups)
+		}
+	case strings.HasPrefix(resourceID, "rtb-") && d.routeTableService != nil:
+		notFound = awserrors.ErrorInvalidRouteTableIDNotFound
+		var out *ec2.DescribeRouteTablesOutput
+		if out, err = d.routeTableService.DescribeRouteTables(&ec2.DescribeRouteTablesInput{RouteTableIds: ids}, accountID); err == nil {
+			count = len(out.RouteTables)
+		}
+	case strings.HasPrefix(resourceID, "igw-") && d.igwService != nil:
+		notFound = awserrors.ErrorInvalidInternetGatewayIDNotFound
+		var out *ec2.DescribeInternetGatewaysOutput
+		if out, err = d.igwService.DescribeInternetGateways(&ec2.DescribeInternetGatewaysInput{InternetGatewayIds: ids}, accountID); err == nil {
+			count = len(out.InternetGateways)
+		}
+	case strings.HasPrefix(resourceID, "eigw-") && d.eigwService != nil:
+		notFound = awserrors.ErrorInvalidEgressOnlyInternetGatewayIdNotFound
+		var out *ec2.DescribeEgressOnlyInternetGatewaysOutput
+		if out, err = d.eigwService.DescribeEgressOnlyInternetGateways(&ec2.DescribeEgressOnlyInternetGatewaysInput{EgressOnlyInternetGatewayIds: ids}, accountID); err == nil {
+			count = len(out.EgressOnlyInternetGateways)
+		}
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New(notFound)
+	}
+	return nil
+}
+
+// lookupTaggedInstance checks that instanceID runs on any node, or is
+// stopped, and belongs to accountID.
+func (d *Daemon) lookupTaggedInstance(accountID, instanceID string) error {
+	if d.jsManager == nil {
+		return nil
+	}
+	nodes, err := d.jsManager.ListNodeStates()
+	if err != nil {
+		slog.Error("lookupTaggedInstance: failed to list node states", "instanceId", instanceID, "err", err)
+		return errors.New(awserrors.ErrorServerInternal)
+	}
+	for _, instances := range nodes {
+		if instance, ok := instances.VMS[instanceID]; ok && isInstanceVisible(accountID, instance.AccountID) {
+			return nil
+		}
+	}
+	stopped, err := d.jsManager.LoadStoppedInstance(instanceID)
+	if err != nil {
+		slog.Error("lookupTaggedInstance: failed to load stopped instance", "instanceId", instanceID, "err", err)
+		return errors.New(awserrors.ErrorServerInternal)
+	}
+	if stopped != nil && isInstanceVisible(accountID, stopped.AccountID) {
+		return nil
+	}
+	return errors.New(awserrors.ErrorInvalidInstanceIDNotFound)
+}
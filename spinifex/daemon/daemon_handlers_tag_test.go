@@ -0,0 +1,37 @@
+package daemon
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLookupTaggedResource_Instances(t *testing.T) {
+	d := createFullTestDaemonWithJetStream(t, sharedJSNATSURL)
+
+	runningID := "i-tag-lookup-running"
+	d.Instances.VMS[runningID] = &vm.VM{ID: runningID, Status: vm.StateRunning, AccountID: testAccountID}
+	require.NoError(t, d.WriteState())
+
+	stoppedID := "i-tag-lookup-stopped"
+	require.NoError(t, d.jsManager.WriteStoppedInstance(stoppedID, &vm.VM{
+		ID:        stoppedID,
+		Status:    vm.StateStopped,
+		AccountID: testAccountID,
+		Instance:  &ec2.Instance{InstanceId: aws.String(stoppedID)},
+	}))
+	t.Cleanup(func() { _ = d.jsManager.DeleteStoppedInstance(stoppedID) })
+
+	assert.NoError(t, d.lookupTaggedResource(testAccountID, runningID))
+	assert.NoError(t, d.lookupTaggedResource(testAccountID, stoppedID))
+	assert.EqualError(t, d.lookupTaggedResource(testAccountID, "i-tag-lookup-missing"), awserrors.ErrorInvalidInstanceIDNotFound)
+	assert.EqualError(t, d.lookupTaggedResource("999999999999", runningID), awserrors.ErrorInvalidInstanceIDNotFound)
+
+	// Resource types without a lookup are assumed to exist
+	assert.NoError(t, d.lookupTaggedResource(testAccountID, "ami-0123456789abcdef0"))
+}
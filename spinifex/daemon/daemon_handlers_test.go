@@ -1,10 +1,14 @@
 package daemon
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io/fs"
+	"net"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -13,6 +17,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/ec2"
 	awss3 "github.com/aws/aws-sdk-go/service/s3"
 
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
 	"github.com/mulgadc/spinifex/spinifex/config"
 	handlers_ec2_account "github.com/mulgadc/spinifex/spinifex/handlers/ec2/account"
 	handlers_ec2_eigw "github.com/mulgadc/spinifex/spinifex/handlers/ec2/eigw"
@@ -29,7 +34,10 @@ import (
 	handlers_ec2_vpc "github.com/mulgadc/spinifex/spinifex/handlers/ec2/vpc"
 	"github.com/mulgadc/spinifex/spinifex/objectstore"
 	"github.com/mulgadc/spinifex/spinifex/qmp"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/testutil"
 	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/mulgadc/spinifex/spinifex/vm"
 	"github.com/mulgadc/viperblock/viperblock"
 	"github.com/nats-io/nats-server/v2/server"
@@ -325,7 +333,7 @@ func TestHandleHealthCheck(t *testing.T) {
 
 	daemon := createTestDaemon(t, natsURL)
 
-	topic := fmt.Sprintf("spinifex.admin.%s.health", daemon.node)
+	topic := subjects.NodeHealth(daemon.node)
 	sub, err := daemon.natsConn.Subscribe(topic, daemon.handleHealthCheck)
 	require.NoError(t, err)
 	defer sub.Unsubscribe()
@@ -497,6 +505,47 @@ func TestHandleEC2RunInstances_EmptyKeyNameSkipsValidation(t *testing.T) {
 	assert.NotContains(t, string(reply.Data), "InvalidKeyPair.NotFound")
 }
 
+func TestHandleEC2RunInstances_DefaultTags(t *testing.T) {
+	natsURL := sharedNATSURL
+
+	daemon, memStore := createFullTestDaemonWithStore(t, natsURL)
+	seedTestAMI(t, memStore, daemon.config.Predastore.Bucket, "ami-defaulttags")
+	daemon.config.Daemon.DefaultTags = []config.DefaultTag{
+		{Key: "managed-by", Value: "spinifex"},
+		{Key: "owner", Value: "platform"},
+		{AccountID: "000000000999", Key: "owner", Value: "someone-else"},
+	}
+
+	sub, err := daemon.natsConn.QueueSubscribe("ec2.RunInstances", "spinifex-workers", daemon.handleEC2RunInstances)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	input := &ec2.RunInstancesInput{
+		ImageId:      aws.String("ami-defaulttags"),
+		InstanceType: aws.String(getTestInstanceType(t)),
+		MinCount:     aws.Int64(1),
+		MaxCount:     aws.Int64(1),
+		TagSpecifications: []*ec2.TagSpecification{{
+			ResourceType: aws.String("instance"),
+			Tags:         []*ec2.Tag{{Key: aws.String("owner"), Value: aws.String("web-team")}},
+		}},
+	}
+	reqData, _ := json.Marshal(input)
+	reply, err := natsRequest(daemon.natsConn, "ec2.RunInstances", reqData, 5*time.Second)
+	require.NoError(t, err)
+
+	var reservation ec2.Reservation
+	require.NoError(t, json.Unmarshal(reply.Data, &reservation), string(reply.Data))
+	require.Len(t, reservation.Instances, 1, string(reply.Data))
+
+	// Defaults are applied, and the explicit owner tag wins over the default.
+	tags := map[string]string{}
+	for _, tag := range reservation.Instances[0].Tags {
+		tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+	}
+	assert.Equal(t, map[string]string{"managed-by": "spinifex", "owner": "web-team"}, tags)
+}
+
 // --- handleEC2RunInstances service-layer error propagation ---
 
 func TestHandleEC2RunInstances_ServiceErrorPropagated(t *testing.T) {
@@ -552,7 +601,7 @@ func TestHandleEC2Events_StopInstance(t *testing.T) {
 	}
 
 	sub, err := daemon.natsConn.Subscribe(
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		daemon.handleEC2Events,
 	)
 	require.NoError(t, err)
@@ -565,7 +614,7 @@ func TestHandleEC2Events_StopInstance(t *testing.T) {
 	cmdData, _ := json.Marshal(cmd)
 
 	reply, err := natsRequest(daemon.natsConn,
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		cmdData,
 		5*time.Second,
 	)
@@ -582,6 +631,49 @@ func TestHandleEC2Events_StopInstance(t *testing.T) {
 	assert.Equal(t, vm.StateStopping, status)
 }
 
+func TestHandleEC2Events_StopStateReason(t *testing.T) {
+	daemon := createFullTestDaemonWithJetStream(t, sharedJSNATSURL)
+
+	tests := []struct {
+		name       string
+		attrs      types.EC2CommandAttributes
+		code       string
+		transition string
+	}{
+		{"user stop", types.EC2CommandAttributes{StopInstance: true}, "Client.UserInitiatedShutdown", "User initiated ("},
+		{"scheduled stop", types.EC2CommandAttributes{StopInstance: true, StateReason: stateReasonScheduledStop}, "Server.ScheduledStop", "Server.ScheduledStop ("},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instanceID := fmt.Sprintf("i-test-stop-reason-%d", i)
+			instance := &vm.VM{
+				ID:           instanceID,
+				InstanceType: getTestInstanceType(t),
+				Status:       vm.StateRunning,
+				Instance:     &ec2.Instance{},
+				QMPClient:    &qmp.QMPClient{},
+				AccountID:    testAccountID,
+			}
+			daemon.Instances.UpsertVM(instance)
+
+			sub, err := daemon.natsConn.Subscribe(subjects.InstanceCmd(instanceID), daemon.handleEC2Events)
+			require.NoError(t, err)
+			defer sub.Unsubscribe()
+
+			cmdData, _ := json.Marshal(types.EC2InstanceCommand{ID: instanceID, Attributes: tt.attrs})
+			_, err = natsRequest(daemon.natsConn, subjects.InstanceCmd(instanceID), cmdData, 5*time.Second)
+			require.NoError(t, err)
+
+			daemon.Instances.Mu.Lock()
+			defer daemon.Instances.Mu.Unlock()
+			require.NotNil(t, instance.Instance.StateReason)
+			assert.Equal(t, tt.code, aws.StringValue(instance.Instance.StateReason.Code))
+			assert.True(t, strings.HasPrefix(aws.StringValue(instance.Instance.StateTransitionReason), tt.transition),
+				"StateTransitionReason %q", aws.StringValue(instance.Instance.StateTransitionReason))
+		})
+	}
+}
+
 func TestHandleEC2Events_TerminateInstance(t *testing.T) {
 	natsURL := sharedJSNATSURL
 
@@ -598,7 +690,7 @@ func TestHandleEC2Events_TerminateInstance(t *testing.T) {
 	}
 
 	sub, err := daemon.natsConn.Subscribe(
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		daemon.handleEC2Events,
 	)
 	require.NoError(t, err)
@@ -611,7 +703,7 @@ func TestHandleEC2Events_TerminateInstance(t *testing.T) {
 	cmdData, _ := json.Marshal(cmd)
 
 	reply, err := natsRequest(daemon.natsConn,
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		cmdData,
 		5*time.Second,
 	)
@@ -642,7 +734,7 @@ func TestHandleEC2Events_RebootRunningInstance(t *testing.T) {
 	}
 
 	sub, err := daemon.natsConn.Subscribe(
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		daemon.handleEC2Events,
 	)
 	require.NoError(t, err)
@@ -655,7 +747,7 @@ func TestHandleEC2Events_RebootRunningInstance(t *testing.T) {
 	cmdData, _ := json.Marshal(cmd)
 
 	reply, err := natsRequest(daemon.natsConn,
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		cmdData,
 		5*time.Second,
 	)
@@ -692,7 +784,7 @@ func TestHandleEC2Events_RebootStoppedInstance(t *testing.T) {
 	}
 
 	sub, err := daemon.natsConn.Subscribe(
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		daemon.handleEC2Events,
 	)
 	require.NoError(t, err)
@@ -705,7 +797,7 @@ func TestHandleEC2Events_RebootStoppedInstance(t *testing.T) {
 	cmdData, _ := json.Marshal(cmd)
 
 	reply, err := natsRequest(daemon.natsConn,
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		cmdData,
 		5*time.Second,
 	)
@@ -735,7 +827,7 @@ func TestHandleEC2Events_RebootTerminatedInstance(t *testing.T) {
 	}
 
 	sub, err := daemon.natsConn.Subscribe(
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		daemon.handleEC2Events,
 	)
 	require.NoError(t, err)
@@ -748,7 +840,7 @@ func TestHandleEC2Events_RebootTerminatedInstance(t *testing.T) {
 	cmdData, _ := json.Marshal(cmd)
 
 	reply, err := natsRequest(daemon.natsConn,
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		cmdData,
 		5*time.Second,
 	)
@@ -767,7 +859,7 @@ func TestHandleEC2Events_InstanceNotFound(t *testing.T) {
 
 	daemon := createTestDaemon(t, natsURL)
 
-	sub, err := daemon.natsConn.Subscribe("ec2.cmd.i-nonexistent", daemon.handleEC2Events)
+	sub, err := daemon.natsConn.Subscribe(subjects.InstanceCmd("i-nonexistent"), daemon.handleEC2Events)
 	require.NoError(t, err)
 	defer sub.Unsubscribe()
 
@@ -777,7 +869,7 @@ func TestHandleEC2Events_InstanceNotFound(t *testing.T) {
 	}
 	cmdData, _ := json.Marshal(cmd)
 
-	reply, err := daemon.natsConn.Request("ec2.cmd.i-nonexistent", cmdData, 5*time.Second)
+	reply, err := daemon.natsConn.Request(subjects.InstanceCmd("i-nonexistent"), cmdData, 5*time.Second)
 	require.NoError(t, err)
 
 	var errResp map[string]any
@@ -791,11 +883,11 @@ func TestHandleEC2Events_MalformedJSON(t *testing.T) {
 
 	daemon := createTestDaemon(t, natsURL)
 
-	sub, err := daemon.natsConn.Subscribe("ec2.cmd.test", daemon.handleEC2Events)
+	sub, err := daemon.natsConn.Subscribe(subjects.InstanceCmd("test"), daemon.handleEC2Events)
 	require.NoError(t, err)
 	defer sub.Unsubscribe()
 
-	reply, err := daemon.natsConn.Request("ec2.cmd.test", []byte(`{bad json}`), 5*time.Second)
+	reply, err := daemon.natsConn.Request(subjects.InstanceCmd("test"), []byte(`{bad json}`), 5*time.Second)
 	require.NoError(t, err)
 
 	var errResp map[string]any
@@ -1490,7 +1582,7 @@ func TestHandleEC2GetConsoleOutput(t *testing.T) {
 	}
 	daemon.Instances.Mu.Unlock()
 
-	topic := fmt.Sprintf("ec2.%s.GetConsoleOutput", instanceID)
+	topic := subjects.ConsoleOutput(instanceID)
 	sub, err := daemon.natsConn.Subscribe(topic, daemon.handleEC2GetConsoleOutput)
 	require.NoError(t, err)
 	defer sub.Unsubscribe()
@@ -1516,6 +1608,25 @@ func TestHandleEC2GetConsoleOutput(t *testing.T) {
 	assert.Contains(t, string(decoded), "Boot complete.")
 }
 
+func TestReadConsoleTail(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "console.log")
+	log := append(bytes.Repeat([]byte("a"), maxConsoleOutput), []byte("login: ")...)
+	require.NoError(t, os.WriteFile(logPath, log, 0644))
+
+	data, modTime, err := readConsoleTail(logPath, maxConsoleOutput)
+	require.NoError(t, err)
+	assert.Len(t, data, maxConsoleOutput)
+	assert.True(t, bytes.HasSuffix(data, []byte("login: ")))
+	assert.False(t, modTime.IsZero())
+
+	data, _, err = readConsoleTail(logPath, 1<<20)
+	require.NoError(t, err)
+	assert.Equal(t, log, data)
+
+	_, _, err = readConsoleTail(filepath.Join(t.TempDir(), "missing.log"), maxConsoleOutput)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
 func TestHandleEC2GetConsoleOutput_EmptyLog(t *testing.T) {
 	natsURL := sharedNATSURL
 	daemon := createFullTestDaemon(t, natsURL)
@@ -1534,7 +1645,7 @@ func TestHandleEC2GetConsoleOutput_EmptyLog(t *testing.T) {
 	}
 	daemon.Instances.Mu.Unlock()
 
-	topic := fmt.Sprintf("ec2.%s.GetConsoleOutput", instanceID)
+	topic := subjects.ConsoleOutput(instanceID)
 	sub, err := daemon.natsConn.Subscribe(topic, daemon.handleEC2GetConsoleOutput)
 	require.NoError(t, err)
 	defer sub.Unsubscribe()
@@ -1559,7 +1670,7 @@ func TestHandleEC2GetConsoleOutput_NotFound(t *testing.T) {
 	daemon := createFullTestDaemon(t, natsURL)
 
 	instanceID := "i-nonexistent-console"
-	topic := fmt.Sprintf("ec2.%s.GetConsoleOutput", instanceID)
+	topic := subjects.ConsoleOutput(instanceID)
 	sub, err := daemon.natsConn.Subscribe(topic, daemon.handleEC2GetConsoleOutput)
 	require.NoError(t, err)
 	defer sub.Unsubscribe()
@@ -1575,6 +1686,141 @@ func TestHandleEC2GetConsoleOutput_NotFound(t *testing.T) {
 	assert.Contains(t, string(reply.Data), "InvalidInstanceID.NotFound")
 }
 
+func TestHandleEC2Events_ConsoleScreenshot(t *testing.T) {
+	daemon := createFullTestDaemon(t, sharedNATSURL)
+
+	png := []byte("\x89PNG\r\n\x1a\nscreen")
+	var dumpPath string
+	qmpClient, cancel := newMockQMPClient(t, func(cmd qmp.QMPCommand) map[string]any {
+		if cmd.Execute == "screendump" && cmd.Arguments["format"] == "png" {
+			dumpPath, _ = cmd.Arguments["filename"].(string)
+			_ = os.WriteFile(dumpPath, png, 0644)
+		}
+		return map[string]any{"return": map[string]any{}}
+	})
+	defer cancel()
+
+	logDir := t.TempDir()
+	screenshot := func(instanceID string, status vm.InstanceState) []byte {
+		t.Helper()
+		daemon.Instances.UpsertVM(&vm.VM{
+			ID:        instanceID,
+			Status:    status,
+			AccountID: testAccountID,
+			QMPClient: qmpClient,
+			Config:    vm.Config{ConsoleLogPath: filepath.Join(logDir, "console-"+instanceID+".log")},
+		})
+		sub, err := daemon.natsConn.Subscribe(subjects.InstanceCmd(instanceID), daemon.handleEC2Events)
+		require.NoError(t, err)
+		defer sub.Unsubscribe()
+
+		cmdData, _ := json.Marshal(types.EC2InstanceCommand{
+			ID:         instanceID,
+			Attributes: types.EC2CommandAttributes{ConsoleScreenshot: true},
+		})
+		reply, err := natsRequest(daemon.natsConn, subjects.InstanceCmd(instanceID), cmdData, 5*time.Second)
+		require.NoError(t, err)
+		return reply.Data
+	}
+
+	var output ec2.GetConsoleScreenshotOutput
+	require.NoError(t, json.Unmarshal(screenshot("i-screenshot-001", vm.StateRunning), &output))
+	assert.Equal(t, "i-screenshot-001", aws.StringValue(output.InstanceId))
+	decoded, err := base64.StdEncoding.DecodeString(aws.StringValue(output.ImageData))
+	require.NoError(t, err)
+	assert.Equal(t, png, decoded)
+	assert.Equal(t, logDir, filepath.Dir(dumpPath), "QEMU dumps beside the console log")
+	assert.NoFileExists(t, dumpPath)
+
+	var errResp map[string]any
+	require.NoError(t, json.Unmarshal(screenshot("i-screenshot-002", vm.StateStopping), &errResp))
+	assert.Equal(t, "IncorrectInstanceState", errResp["Code"])
+}
+
+func TestHandleEC2Events_OpenConsole(t *testing.T) {
+	daemon := createFullTestDaemon(t, sharedNATSURL)
+
+	// A short path keeps the socket under the unix socket length limit
+	dir, err := os.MkdirTemp("", "console")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "serial.sock")
+	ln, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	defer ln.Close()
+
+	// The fake QEMU echoes what it is sent, upper-cased
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		accepted <- conn
+		buf := make([]byte, 64)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write(bytes.ToUpper(buf[:n]))
+		}
+	}()
+
+	instanceID := "i-console-001"
+	daemon.Instances.UpsertVM(&vm.VM{
+		ID:        instanceID,
+		Status:    vm.StateRunning,
+		AccountID: testAccountID,
+		Config:    vm.Config{SerialSocket: socket},
+	})
+	cmdSub, err := daemon.natsConn.Subscribe(subjects.InstanceCmd(instanceID), daemon.handleEC2Events)
+	require.NoError(t, err)
+	defer cmdSub.Unsubscribe()
+
+	sessionID := "console-test-session"
+	output := make(chan *nats.Msg, 8)
+	outSub, err := daemon.natsConn.ChanSubscribe(subjects.ConsoleOut(sessionID), output)
+	require.NoError(t, err)
+	defer outSub.Unsubscribe()
+
+	open := func(consoleType string) []byte {
+		t.Helper()
+		cmdData, _ := json.Marshal(types.EC2InstanceCommand{
+			ID:             instanceID,
+			Attributes:     types.EC2CommandAttributes{OpenConsole: true},
+			ConsoleSession: &types.ConsoleSessionData{SessionID: sessionID, Type: consoleType},
+		})
+		reply, err := natsRequest(daemon.natsConn, subjects.InstanceCmd(instanceID), cmdData, 5*time.Second)
+		require.NoError(t, err)
+		return reply.Data
+	}
+
+	// The instance has no VNC socket
+	var errResp map[string]any
+	require.NoError(t, json.Unmarshal(open(types.ConsoleVNC), &errResp))
+	assert.Equal(t, awserrors.ErrorUnsupportedOperation, errResp["Code"])
+
+	open(types.ConsoleSerial)
+	require.NoError(t, daemon.natsConn.Publish(subjects.ConsoleIn(sessionID), []byte("login")))
+	select {
+	case msg := <-output:
+		assert.Equal(t, "LOGIN", string(msg.Data))
+	case <-time.After(5 * time.Second):
+		t.Fatal("no console output relayed")
+	}
+
+	// QEMU closing the socket ends the session and tells the gateway
+	conn := <-accepted
+	require.NoError(t, conn.Close())
+	select {
+	case msg := <-output:
+		assert.NotEmpty(t, msg.Header.Get(types.ConsoleCloseHeader))
+	case <-time.After(5 * time.Second):
+		t.Fatal("session close not relayed")
+	}
+}
+
 // TestAttachVolume_ZoneMismatch verifies that attaching a volume in a different AZ
 // returns InvalidVolume.ZoneMismatch instead of proceeding.
 func TestAttachVolume_ZoneMismatch(t *testing.T) {
@@ -1621,7 +1867,7 @@ func TestAttachVolume_ZoneMismatch(t *testing.T) {
 
 	// Subscribe handler
 	sub, err := daemon.natsConn.Subscribe(
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		daemon.handleEC2Events,
 	)
 	require.NoError(t, err)
@@ -1639,7 +1885,7 @@ func TestAttachVolume_ZoneMismatch(t *testing.T) {
 	cmdData, _ := json.Marshal(command)
 
 	resp, err := natsRequest(daemon.natsConn,
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		cmdData,
 		5*time.Second,
 	)
@@ -2526,9 +2772,14 @@ func TestHandleNodeVMs(t *testing.T) {
 		ID:           "i-vm-1",
 		Status:       vm.StateRunning,
 		InstanceType: instanceType,
+		AccountID:    testAccountID,
 		Instance: &ec2.Instance{
 			LaunchTime: &launchTime,
 		},
+		EBSRequests: types.EBSRequests{Requests: []types.EBSRequest{
+			{Name: "vol-root", Boot: true, DeleteOnTermination: true},
+			{Name: "vol-efi", EFI: true},
+		}},
 	}
 	daemon.Instances.VMS["i-vm-2"] = &vm.VM{
 		ID:           "i-vm-2",
@@ -2565,6 +2816,8 @@ func TestHandleNodeVMs(t *testing.T) {
 	assert.Greater(t, vm1.VCPU, 0)
 	assert.Greater(t, vm1.MemoryGB, 0.0)
 	assert.Equal(t, launchTime.Unix(), vm1.LaunchTime)
+	assert.Equal(t, testAccountID, vm1.AccountID)
+	assert.Equal(t, []types.VMVolume{{VolumeID: "vol-root", Boot: true, DeleteOnTermination: true}}, vm1.Volumes)
 
 	vm2 := vmsByID["i-vm-2"]
 	assert.Equal(t, "stopped", vm2.Status)
@@ -2655,6 +2908,31 @@ func createVPCTestDaemon(t *testing.T) *Daemon {
 	return daemon
 }
 
+func TestGuestDNSServers_FollowVPCDhcpOptions(t *testing.T) {
+	daemon := createVPCTestDaemon(t)
+	daemon.clusterConfig = &config.ClusterConfig{Network: config.NetworkConfig{ExternalPools: []config.ExternalPool{
+		{Name: "wan", DNSServers: []string{"192.168.1.1"}},
+	}}}
+
+	vpc, err := daemon.vpcService.CreateVpc(&ec2.CreateVpcInput{CidrBlock: aws.String("10.0.0.0/16")}, testAccountID)
+	require.NoError(t, err)
+	vpcID := *vpc.Vpc.VpcId
+
+	// AmazonProvidedDNS hands out the cluster resolvers.
+	assert.Equal(t, []string{"192.168.1.1"}, daemon.guestDNSServers(testAccountID, vpcID))
+
+	dopt, err := daemon.vpcService.CreateDhcpOptions(&ec2.CreateDhcpOptionsInput{DhcpConfigurations: []*ec2.NewDhcpConfiguration{
+		{Key: aws.String("domain-name-servers"), Values: aws.StringSlice([]string{"10.0.0.2"})},
+	}}, testAccountID)
+	require.NoError(t, err)
+	_, err = daemon.vpcService.AssociateDhcpOptions(&ec2.AssociateDhcpOptionsInput{VpcId: aws.String(vpcID), DhcpOptionsId: dopt.DhcpOptions.DhcpOptionsId}, testAccountID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.2"}, daemon.guestDNSServers(testAccountID, vpcID))
+
+	daemon.clusterConfig = nil
+	assert.Nil(t, daemon.guestDNSServers(testAccountID, "vpc-missing"))
+}
+
 func TestDelegateHandlers_VPC(t *testing.T) {
 	daemon := createVPCTestDaemon(t)
 
@@ -3162,6 +3440,121 @@ func TestHandleEC2DescribeInstanceTypes_NoFilter(t *testing.T) {
 	assert.Greater(t, len(output.InstanceTypes), 0)
 }
 
+func TestHandleEC2DescribeInstanceTypes_ExplicitListIgnoresCapacity(t *testing.T) {
+	daemon := createFullTestDaemon(t, sharedNATSURL)
+	// getTestInstanceType may pick a system type, which is never described.
+	infos := daemon.resourceMgr.GetInstanceTypeInfos()
+	require.NotEmpty(t, infos)
+	typeName := aws.StringValue(infos[0].InstanceType)
+
+	// A full node still describes the types it supports when asked by name.
+	daemon.resourceMgr.mu.Lock()
+	daemon.resourceMgr.allocatedVCPU = daemon.resourceMgr.hostVCPU
+	daemon.resourceMgr.mu.Unlock()
+
+	sub, err := daemon.natsConn.QueueSubscribe("ec2.DescribeInstanceTypes.explicit", "spinifex-workers", daemon.handleEC2DescribeInstanceTypes)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	reqData, _ := json.Marshal(&ec2.DescribeInstanceTypesInput{
+		InstanceTypes: aws.StringSlice([]string{typeName, "x9.mega"}),
+	})
+	reply, err := daemon.natsConn.Request("ec2.DescribeInstanceTypes.explicit", reqData, 5*time.Second)
+	require.NoError(t, err)
+
+	var output ec2.DescribeInstanceTypesOutput
+	require.NoError(t, json.Unmarshal(reply.Data, &output))
+	require.Len(t, output.InstanceTypes, 1)
+	assert.Equal(t, typeName, aws.StringValue(output.InstanceTypes[0].InstanceType))
+}
+
+func TestMeetsInstanceRequirements(t *testing.T) {
+	catalog := []*ec2.InstanceTypeInfo{
+		testInstanceTypeInfo("t3.small", "x86_64", 2, 2048),
+		testInstanceTypeInfo("t3.large", "x86_64", 2, 8192),
+		testInstanceTypeInfo("c6g.xlarge", "arm64", 4, 8192),
+		testInstanceTypeInfo("t4g.large", "arm64", 2, 8192),
+		testInstanceTypeInfo("m6g.2xlarge", "arm64", 8, 32768),
+		testInstanceTypeInfo("t4g.medium", "arm64", 2, 4096),
+	}
+
+	match := func(input *ec2.GetInstanceTypesFromInstanceRequirementsInput) []string {
+		var names []string
+		for _, it := range catalog {
+			if meetsInstanceRequirements(it, input) {
+				names = append(names, aws.StringValue(it.InstanceType))
+			}
+		}
+		return names
+	}
+
+	// 2-4 vCPUs, 4-8 GiB, arm64
+	assert.Equal(t, []string{"c6g.xlarge", "t4g.large", "t4g.medium"}, match(&ec2.GetInstanceTypesFromInstanceRequirementsInput{
+		ArchitectureTypes:   aws.StringSlice([]string{"arm64"}),
+		VirtualizationTypes: aws.StringSlice([]string{"hvm"}),
+		InstanceRequirements: &ec2.InstanceRequirementsRequest{
+			VCpuCount: &ec2.VCpuCountRangeRequest{Min: aws.Int64(2), Max: aws.Int64(4)},
+			MemoryMiB: &ec2.MemoryMiBRequest{Min: aws.Int64(4096), Max: aws.Int64(8192)},
+		},
+	}))
+
+	// An omitted Max is unbounded and no architecture list matches any.
+	assert.Equal(t, []string{"c6g.xlarge", "m6g.2xlarge"}, match(&ec2.GetInstanceTypesFromInstanceRequirementsInput{
+		InstanceRequirements: &ec2.InstanceRequirementsRequest{
+			VCpuCount: &ec2.VCpuCountRangeRequest{Min: aws.Int64(4)},
+			MemoryMiB: &ec2.MemoryMiBRequest{Min: aws.Int64(0)},
+		},
+	}))
+
+	assert.Empty(t, match(&ec2.GetInstanceTypesFromInstanceRequirementsInput{
+		VirtualizationTypes: aws.StringSlice([]string{"paravirtual"}),
+		InstanceRequirements: &ec2.InstanceRequirementsRequest{
+			VCpuCount: &ec2.VCpuCountRangeRequest{Min: aws.Int64(0)},
+			MemoryMiB: &ec2.MemoryMiBRequest{Min: aws.Int64(0)},
+		},
+	}))
+}
+
+func testInstanceTypeInfo(name, arch string, vCPUs, memMiB int64) *ec2.InstanceTypeInfo {
+	return &ec2.InstanceTypeInfo{
+		InstanceType:                 aws.String(name),
+		VCpuInfo:                     &ec2.VCpuInfo{DefaultVCpus: aws.Int64(vCPUs)},
+		MemoryInfo:                   &ec2.MemoryInfo{SizeInMiB: aws.Int64(memMiB)},
+		ProcessorInfo:                &ec2.ProcessorInfo{SupportedArchitectures: aws.StringSlice([]string{arch})},
+		SupportedVirtualizationTypes: aws.StringSlice([]string{"hvm"}),
+	}
+}
+
+func TestHandleEC2GetInstanceTypesFromInstanceRequirements(t *testing.T) {
+	daemon := createFullTestDaemon(t, sharedNATSURL)
+	// A full node still reports the types it offers.
+	daemon.resourceMgr.mu.Lock()
+	daemon.resourceMgr.allocatedVCPU = daemon.resourceMgr.hostVCPU
+	daemon.resourceMgr.mu.Unlock()
+
+	sub, err := daemon.natsConn.Subscribe("ec2.GetInstanceTypesFromInstanceRequirements.test", daemon.handleEC2GetInstanceTypesFromInstanceRequirements)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	reqData, _ := json.Marshal(&ec2.GetInstanceTypesFromInstanceRequirementsInput{
+		InstanceRequirements: &ec2.InstanceRequirementsRequest{
+			VCpuCount: &ec2.VCpuCountRangeRequest{Min: aws.Int64(2), Max: aws.Int64(2)},
+			MemoryMiB: &ec2.MemoryMiBRequest{Min: aws.Int64(0)},
+		},
+	})
+	reply, err := daemon.natsConn.Request("ec2.GetInstanceTypesFromInstanceRequirements.test", reqData, 5*time.Second)
+	require.NoError(t, err)
+
+	var output ec2.GetInstanceTypesFromInstanceRequirementsOutput
+	require.NoError(t, json.Unmarshal(reply.Data, &output))
+	require.NotEmpty(t, output.InstanceTypes)
+	for _, it := range output.InstanceTypes {
+		info, ok := daemon.resourceMgr.instanceTypes[aws.StringValue(it.InstanceType)]
+		require.True(t, ok)
+		assert.Equal(t, int64(2), instanceTypeVCPUs(info))
+	}
+}
+
 // --- handleEC2StartStoppedInstance: instance type not available ---
 
 func TestHandleEC2StartStoppedInstance_InstanceTypeNotAvailable(t *testing.T) {
@@ -3285,7 +3678,7 @@ func TestAttachVolume_MissingVolumeData(t *testing.T) {
 	daemon.Instances.VMS[instanceID] = instance
 
 	sub, err := daemon.natsConn.Subscribe(
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		daemon.handleEC2Events,
 	)
 	require.NoError(t, err)
@@ -3302,7 +3695,7 @@ func TestAttachVolume_MissingVolumeData(t *testing.T) {
 	cmdData, _ := json.Marshal(command)
 
 	resp, err := natsRequest(daemon.natsConn,
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		cmdData,
 		5*time.Second,
 	)
@@ -3325,7 +3718,7 @@ func TestAttachVolume_InstanceNotRunning(t *testing.T) {
 	daemon.Instances.VMS[instanceID] = instance
 
 	sub, err := daemon.natsConn.Subscribe(
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		daemon.handleEC2Events,
 	)
 	require.NoError(t, err)
@@ -3343,7 +3736,7 @@ func TestAttachVolume_InstanceNotRunning(t *testing.T) {
 	cmdData, _ := json.Marshal(command)
 
 	resp, err := natsRequest(daemon.natsConn,
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		cmdData,
 		5*time.Second,
 	)
@@ -3366,7 +3759,7 @@ func TestAttachVolume_VolumeNotFound(t *testing.T) {
 	daemon.Instances.VMS[instanceID] = instance
 
 	sub, err := daemon.natsConn.Subscribe(
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		daemon.handleEC2Events,
 	)
 	require.NoError(t, err)
@@ -3384,7 +3777,7 @@ func TestAttachVolume_VolumeNotFound(t *testing.T) {
 	cmdData, _ := json.Marshal(command)
 
 	resp, err := natsRequest(daemon.natsConn,
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		cmdData,
 		5*time.Second,
 	)
@@ -3429,7 +3822,7 @@ func TestAttachVolume_VolumeInUse(t *testing.T) {
 	})
 
 	sub, err := daemon.natsConn.Subscribe(
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		daemon.handleEC2Events,
 	)
 	require.NoError(t, err)
@@ -3447,7 +3840,7 @@ func TestAttachVolume_VolumeInUse(t *testing.T) {
 	cmdData, _ := json.Marshal(command)
 
 	resp, err := natsRequest(daemon.natsConn,
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		cmdData,
 		5*time.Second,
 	)
@@ -3472,7 +3865,7 @@ func TestDetachVolume_MissingVolumeData(t *testing.T) {
 	daemon.Instances.VMS[instanceID] = instance
 
 	sub, err := daemon.natsConn.Subscribe(
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		daemon.handleEC2Events,
 	)
 	require.NoError(t, err)
@@ -3488,7 +3881,7 @@ func TestDetachVolume_MissingVolumeData(t *testing.T) {
 	cmdData, _ := json.Marshal(command)
 
 	resp, err := natsRequest(daemon.natsConn,
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		cmdData,
 		5*time.Second,
 	)
@@ -3511,7 +3904,7 @@ func TestDetachVolume_InstanceNotRunning(t *testing.T) {
 	daemon.Instances.VMS[instanceID] = instance
 
 	sub, err := daemon.natsConn.Subscribe(
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		daemon.handleEC2Events,
 	)
 	require.NoError(t, err)
@@ -3529,7 +3922,7 @@ func TestDetachVolume_InstanceNotRunning(t *testing.T) {
 	cmdData, _ := json.Marshal(command)
 
 	resp, err := natsRequest(daemon.natsConn,
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		cmdData,
 		5*time.Second,
 	)
@@ -3552,7 +3945,7 @@ func TestDetachVolume_VolumeNotAttached(t *testing.T) {
 	daemon.Instances.VMS[instanceID] = instance
 
 	sub, err := daemon.natsConn.Subscribe(
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		daemon.handleEC2Events,
 	)
 	require.NoError(t, err)
@@ -3570,7 +3963,7 @@ func TestDetachVolume_VolumeNotAttached(t *testing.T) {
 	cmdData, _ := json.Marshal(command)
 
 	resp, err := natsRequest(daemon.natsConn,
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		cmdData,
 		5*time.Second,
 	)
@@ -3596,7 +3989,7 @@ func TestDetachVolume_BootVolumeRejected(t *testing.T) {
 	daemon.Instances.VMS[instanceID] = instance
 
 	sub, err := daemon.natsConn.Subscribe(
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		daemon.handleEC2Events,
 	)
 	require.NoError(t, err)
@@ -3614,7 +4007,7 @@ func TestDetachVolume_BootVolumeRejected(t *testing.T) {
 	cmdData, _ := json.Marshal(command)
 
 	resp, err := natsRequest(daemon.natsConn,
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		cmdData,
 		5*time.Second,
 	)
@@ -3640,7 +4033,7 @@ func TestDetachVolume_DeviceMismatch(t *testing.T) {
 	daemon.Instances.VMS[instanceID] = instance
 
 	sub, err := daemon.natsConn.Subscribe(
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		daemon.handleEC2Events,
 	)
 	require.NoError(t, err)
@@ -3659,7 +4052,7 @@ func TestDetachVolume_DeviceMismatch(t *testing.T) {
 	cmdData, _ := json.Marshal(command)
 
 	resp, err := natsRequest(daemon.natsConn,
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		cmdData,
 		5*time.Second,
 	)
@@ -3848,6 +4241,37 @@ func TestHandleEC2DescribeTerminatedInstances_WithFilter(t *testing.T) {
 	_ = daemon.jsManager.DeleteTerminatedInstance("i-tfilter-002")
 }
 
+func TestDescribeTerminatedInstances_VisibilityWindow(t *testing.T) {
+	daemon := createFullTestDaemonWithJetStream(t, sharedJSNATSURL)
+	clock := testutil.NewFakeClock(time.Date(2026, 3, 4, 5, 0, 0, 0, time.UTC))
+	t.Cleanup(utils.SetClock(clock))
+
+	instance := &vm.VM{ID: "i-tvisible-001", Status: vm.StateShuttingDown, AccountID: testAccountID}
+	daemon.Instances.UpsertVM(instance)
+	require.NoError(t, daemon.TransitionState(instance, vm.StateTerminated))
+	assert.Equal(t, clock.Now(), instance.TerminatedAt)
+	require.NoError(t, daemon.jsManager.WriteTerminatedInstance(instance.ID, instance))
+	t.Cleanup(func() { _ = daemon.jsManager.DeleteTerminatedInstance(instance.ID) })
+
+	visible := func() bool {
+		t.Helper()
+		instances, err := daemon.listVisibleTerminatedInstances()
+		require.NoError(t, err)
+		for _, v := range instances {
+			if v.ID == instance.ID {
+				return true
+			}
+		}
+		return false
+	}
+
+	assert.True(t, visible())
+	clock.Advance(terminatedInstanceVisibility - time.Second)
+	assert.True(t, visible(), "terminated instance should stay visible inside the window")
+	clock.Advance(time.Second)
+	assert.False(t, visible(), "terminated instance should be hidden once the window has passed")
+}
+
 func TestHandleEC2TerminateStoppedInstance_WritesToTerminatedKV(t *testing.T) {
 	daemon := createFullTestDaemonWithJetStream(t, sharedJSNATSURL)
 
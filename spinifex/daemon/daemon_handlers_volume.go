@@ -4,22 +4,29 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"os"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/config"
+	handlers_ec2_volume "github.com/mulgadc/spinifex/spinifex/handlers/ec2/volume"
 	"github.com/mulgadc/spinifex/spinifex/qmp"
+	"github.com/mulgadc/spinifex/spinifex/quota"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
 	"github.com/mulgadc/spinifex/spinifex/types"
 	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/mulgadc/viperblock/viperblock"
 	"github.com/nats-io/nats.go"
 )
 
 // handleAttachVolume performs a three-phase hot-plug:
 //
-//	Phase 1: ebs.mount via NATS   (rolls back with ebs.unmount)
+//	Phase 1: ebs.mount via NATS   (rolls back with ebs.unmount; skipped for local volumes)
 //	Phase 2: QMP blockdev-add     (rolls back Phase 1)
 //	Phase 3: QMP device_add       (rolls back Phase 2 + Phase 1)
 func (d *Daemon) handleAttachVolume(msg *nats.Msg, command types.EC2InstanceCommand, instance *vm.VM) {
@@ -80,11 +87,24 @@ func (d *Daemon) handleAttachVolume(msg *nats.Msg, command types.EC2InstanceComm
 		return
 	}
 
+	cacheMode, err := vm.ParseCacheMode(volCfg.VolumeMetadata.Tags[vm.CacheModeTag])
+	if err != nil {
+		slog.Error("AttachVolume: invalid cache mode", "volumeId", volumeID, "err", err)
+		respondWithError(msg, awserrors.ErrorInvalidParameterValue)
+		return
+	}
+	trim, err := vm.ParseTrim(volCfg.VolumeMetadata.Tags[vm.TrimTag], d.config.VolumeTrimEnabled(volCfg.VolumeMetadata.VolumeType))
+	if err != nil {
+		slog.Error("AttachVolume: invalid trim setting", "volumeId", volumeID, "err", err)
+		respondWithError(msg, awserrors.ErrorInvalidParameterValue)
+		return
+	}
+
 	// Determine device name
 	if device == "" {
-		d.Instances.Mu.Lock()
-		device = nextAvailableDevice(instance)
-		d.Instances.Mu.Unlock()
+		d.Instances.WithVolumes(instance, func(*types.EBSRequests) {
+			device = nextAvailableDevice(instance)
+		})
 		if device == "" {
 			slog.Error("AttachVolume: no available device names")
 			respondWithError(msg, awserrors.ErrorAttachmentLimitExceeded)
@@ -92,70 +112,78 @@ func (d *Daemon) handleAttachVolume(msg *nats.Msg, command types.EC2InstanceComm
 		}
 	}
 
-	// Create EBS mount request
+	nodeName := fmt.Sprintf("nbd-%s", volumeID)
+	deviceID := fmt.Sprintf("vdisk-%s", volumeID)
+	iothreadID := fmt.Sprintf("ioth-%s", volumeID)
+
+	// Phase 1: make the volume reachable and build its blockdev node
 	ebsRequest := types.EBSRequest{
 		Name:       volumeID,
+		VolType:    volCfg.VolumeMetadata.VolumeType,
 		DeviceName: device,
+		CacheMode:  cacheMode,
+		Trim:       trim,
+		Encrypted:  volCfg.VolumeMetadata.IsEncrypted,
+	}
+	ebsRequest.IOPS, ebsRequest.Throughput = d.volumeService.VolumePerformance(volCfg)
+	var blockdevArgs map[string]any
+	if d.config.VolumeBackend(volCfg.VolumeMetadata.VolumeType) == config.VolumeBackendLocal {
+		ebsRequest.Backend = config.VolumeBackendLocal
+		// A local volume's file is on one node only, so it can't follow an
+		// instance anywhere else.
+		owner, err := d.volumeService.LocalVolumeNode(volumeID)
+		if err != nil {
+			slog.Error("AttachVolume: failed to read local volume record", "volumeId", volumeID, "err", err)
+			respondWithError(msg, awserrors.ErrorServerInternal)
+			return
+		}
+		if owner != "" && owner != d.node {
+			slog.Error("AttachVolume: local volume is on another node",
+				"volumeId", volumeID, "volumeNode", owner, "instanceNode", d.node)
+			respondWithError(msg, awserrors.ErrorInvalidVolumeZoneMismatch)
+			return
+		}
+		blockdevArgs, err = d.localBlockdevArgs(volumeID, nodeName)
+		if err != nil {
+			slog.Error("AttachVolume: local volume file unavailable", "volumeId", volumeID, "err", err)
+			respondWithError(msg, awserrors.ErrorIncorrectState)
+			return
+		}
+	} else {
+		var errCode string
+		blockdevArgs, errCode = d.mountNBDBlockdev(&ebsRequest, nodeName)
+		if errCode != "" {
+			respondWithError(msg, errCode)
+			return
+		}
 	}
 
-	ebsMountData, err := json.Marshal(ebsRequest)
-	if err != nil {
-		slog.Error("AttachVolume: failed to marshal ebs.mount request", "err", err)
-		respondWithError(msg, awserrors.ErrorServerInternal)
-		return
-	}
-
-	mountReply, err := d.natsConn.Request(d.ebsTopic("mount"), ebsMountData, 30*time.Second)
-	if err != nil {
-		slog.Error("AttachVolume: ebs.mount failed", "volumeId", volumeID, "err", err)
-		respondWithError(msg, awserrors.ErrorServerInternal)
-		return
-	}
-
-	var mountResp types.EBSMountResponse
-	if err := json.Unmarshal(mountReply.Data, &mountResp); err != nil {
-		slog.Error("AttachVolume: failed to unmarshal mount response", "err", err)
-		respondWithError(msg, awserrors.ErrorServerInternal)
-		return
-	}
-
-	if mountResp.Error != "" {
-		slog.Error("AttachVolume: mount returned error", "volumeId", volumeID, "err", mountResp.Error)
-		respondWithError(msg, awserrors.ErrorServerInternal)
-		return
+	var secret *vm.Secret
+	if ebsRequest.Encrypted {
+		unlocked, err := d.volumeSecret(volumeID, d.volumeTarget(ebsRequest))
+		if err != nil {
+			slog.Error("AttachVolume: failed to unlock encrypted volume", "volumeId", volumeID, "err", err)
+			d.rollbackEBSMount(ebsRequest)
+			respondWithError(msg, awserrors.ErrorServerInternal)
+			return
+		}
+		secret = &unlocked
+		blockdevArgs = luksBlockdevArgs(blockdevArgs, secret.ID)
 	}
 
-	nbdURI := mountResp.URI
-	if nbdURI == "" {
-		slog.Error("AttachVolume: mount response has empty URI", "volumeId", volumeID)
-		d.rollbackEBSMount(ebsRequest)
-		respondWithError(msg, awserrors.ErrorServerInternal)
-		return
-	}
-	ebsRequest.NBDURI = nbdURI
+	cacheArgs, writeCache := vm.CacheModeBlockdevArgs(cacheMode)
+	blockdevArgs["cache"] = cacheArgs
 
-	// Parse NBDURI for QMP blockdev-add
-	serverType, socketPath, nbdHost, nbdPort, err := utils.ParseNBDURI(nbdURI)
-	if err != nil {
-		slog.Error("AttachVolume: failed to parse NBDURI", "uri", nbdURI, "err", err)
-		// Rollback: unmount
-		d.rollbackEBSMount(ebsRequest)
-		respondWithError(msg, awserrors.ErrorServerInternal)
-		return
+	// Join the instance's EBS throttle group if it has one.
+	d.Instances.Mu.Lock()
+	if len(instance.Config.ThrottleGroups) > 0 {
+		blockdevArgs = throttledBlockdevArgs(blockdevArgs, instance.Config.ThrottleGroups[0].ID)
 	}
-
-	// Build QMP server argument
-	var serverArg map[string]any
-	if serverType == "unix" {
-		serverArg = map[string]any{"type": "unix", "path": socketPath}
-	} else {
-		serverArg = map[string]any{"type": "inet", "host": nbdHost, "port": strconv.Itoa(nbdPort)}
+	d.Instances.Mu.Unlock()
+	if trim {
+		vm.TrimBlockdevArgs(blockdevArgs)
 	}
 
-	nodeName := fmt.Sprintf("nbd-%s", volumeID)
-	deviceID := fmt.Sprintf("vdisk-%s", volumeID)
-	iothreadID := fmt.Sprintf("ioth-%s", volumeID)
-
 	// QMP object-add: create iothread for this volume
 	iothreadCmd := qmp.QMPCommand{
 		Execute: "object-add",
@@ -168,27 +196,34 @@ func (d *Daemon) handleAttachVolume(msg *nats.Msg, command types.EC2InstanceComm
 	if err != nil {
 		slog.Error("AttachVolume: QMP object-add iothread failed", "volumeId", volumeID, "err", err)
 		d.rollbackEBSMount(ebsRequest)
-		respondWithError(msg, awserrors.ErrorServerInternal)
+		respondWithQMPError(msg, err)
 		return
 	}
 
+	// QMP object-add: the data key the LUKS node opens the volume with
+	if secret != nil {
+		if err := d.addVolumeSecret(instance, *secret); err != nil {
+			slog.Error("AttachVolume: QMP object-add secret failed", "volumeId", volumeID, "err", err)
+			d.rollbackEBSMount(ebsRequest)
+			respondWithQMPError(msg, err)
+			return
+		}
+	}
+
 	// QMP blockdev-add
 	blockdevCmd := qmp.QMPCommand{
-		Execute: "blockdev-add",
-		Arguments: map[string]any{
-			"node-name": nodeName,
-			"driver":    "nbd",
-			"server":    serverArg,
-			"export":    "",
-			"read-only": false,
-		},
+		Execute:   "blockdev-add",
+		Arguments: blockdevArgs,
 	}
 
 	_, err = d.SendQMPCommand(instance.QMPClient, blockdevCmd, instance.ID)
 	if err != nil {
 		slog.Error("AttachVolume: QMP blockdev-add failed", "volumeId", volumeID, "err", err)
+		if secret != nil {
+			d.removeVolumeSecret(instance, volumeID)
+		}
 		d.rollbackEBSMount(ebsRequest)
-		respondWithError(msg, awserrors.ErrorServerInternal)
+		respondWithQMPError(msg, err)
 		return
 	}
 
@@ -204,10 +239,11 @@ func (d *Daemon) handleAttachVolume(msg *nats.Msg, command types.EC2InstanceComm
 
 	// QMP device_add
 	deviceAddArgs := map[string]any{
-		"driver":   "virtio-blk-pci",
-		"id":       deviceID,
-		"drive":    nodeName,
-		"iothread": iothreadID,
+		"driver":      "virtio-blk-pci",
+		"id":          deviceID,
+		"drive":       nodeName,
+		"iothread":    iothreadID,
+		"write-cache": writeCache,
 	}
 	if hotplugBus != "" {
 		deviceAddArgs["bus"] = hotplugBus
@@ -227,9 +263,12 @@ func (d *Daemon) handleAttachVolume(msg *nats.Msg, command types.EC2InstanceComm
 		}, instance.ID); delErr != nil {
 			slog.Error("AttachVolume: rollback blockdev-del failed, skipping EBS unmount", "volumeId", volumeID, "err", delErr)
 		} else {
+			if secret != nil {
+				d.removeVolumeSecret(instance, volumeID)
+			}
 			d.rollbackEBSMount(ebsRequest)
 		}
-		respondWithError(msg, awserrors.ErrorServerInternal)
+		respondWithQMPError(msg, err)
 		return
 	}
 
@@ -249,35 +288,35 @@ func (d *Daemon) handleAttachVolume(msg *nats.Msg, command types.EC2InstanceComm
 	}
 
 	// Update instance state: replace existing entry for this volume (handles
-	// stop/start cycles that keep stale entries) or append a new one.
-	instance.EBSRequests.Mu.Lock()
-	replaced := false
-	for i, req := range instance.EBSRequests.Requests {
-		if req.Name == volumeID {
-			instance.EBSRequests.Requests[i] = ebsRequest
-			replaced = true
-			break
+	// stop/start cycles that keep stale entries) or append a new one, and add
+	// the BlockDeviceMapping using the actual guest device name.
+	d.Instances.WithVolumes(instance, func(reqs *types.EBSRequests) {
+		replaced := false
+		for i, req := range reqs.Requests {
+			if req.Name == volumeID {
+				reqs.Requests[i] = ebsRequest
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			reqs.Requests = append(reqs.Requests, ebsRequest)
 		}
-	}
-	if !replaced {
-		instance.EBSRequests.Requests = append(instance.EBSRequests.Requests, ebsRequest)
-	}
-	instance.EBSRequests.Mu.Unlock()
 
-	// Update BlockDeviceMappings on the ec2.Instance using actual guest device name
-	d.Instances.Mu.Lock()
-	if instance.Instance != nil {
-		now := time.Now()
-		mapping := &ec2.InstanceBlockDeviceMapping{}
-		mapping.SetDeviceName(guestDevice)
-		mapping.Ebs = &ec2.EbsInstanceBlockDevice{}
-		mapping.Ebs.SetVolumeId(volumeID)
-		mapping.Ebs.SetAttachTime(now)
-		mapping.Ebs.SetDeleteOnTermination(false)
-		mapping.Ebs.SetStatus("attached")
-		instance.Instance.BlockDeviceMappings = append(instance.Instance.BlockDeviceMappings, mapping)
-	}
-	d.Instances.Mu.Unlock()
+		if instance.Instance != nil {
+			now := utils.Now()
+			mapping := &ec2.InstanceBlockDeviceMapping{}
+			mapping.SetDeviceName(guestDevice)
+			mapping.Ebs = &ec2.EbsInstanceBlockDevice{}
+			mapping.Ebs.SetVolumeId(volumeID)
+			mapping.Ebs.SetAttachTime(now)
+			mapping.Ebs.SetDeleteOnTermination(false)
+			mapping.Ebs.SetStatus("attached")
+			instance.Instance.BlockDeviceMappings = append(instance.Instance.BlockDeviceMappings, mapping)
+		}
+	})
+
+	d.updateEBSThrottle(instance)
 
 	// Update volume metadata in S3
 	if err := d.volumeService.UpdateVolumeState(volumeID, "in-use", command.ID, guestDevice); err != nil {
@@ -290,9 +329,122 @@ func (d *Daemon) handleAttachVolume(msg *nats.Msg, command types.EC2InstanceComm
 	}
 
 	d.respondWithVolumeAttachment(msg, volumeID, command.ID, guestDevice, "attached")
+	d.publishVolumeNotification(instance, types.VolumeNotificationDetail{
+		Event: "attachVolume", Result: "attached", VolumeID: volumeID, InstanceID: command.ID, Device: guestDevice,
+	})
 	slog.Info("Volume attached successfully", "volumeId", volumeID, "instanceId", command.ID, "apiDevice", device, "guestDevice", guestDevice)
 }
 
+// mountNBDBlockdev asks viperblockd to export the volume over NBD and returns
+// blockdev-add arguments for the export. On failure it returns an AWS error
+// code, having already undone any mount.
+func (d *Daemon) mountNBDBlockdev(ebsRequest *types.EBSRequest, nodeName string) (map[string]any, string) {
+	volumeID := ebsRequest.Name
+
+	if err := d.checkFence(); err != nil {
+		slog.Error("AttachVolume: refusing to mount volume", "volumeId", volumeID, "err", err)
+		return nil, awserrors.ErrorServerInternal
+	}
+
+	ebsMountData, err := json.Marshal(ebsRequest)
+	if err != nil {
+		slog.Error("AttachVolume: failed to marshal ebs.mount request", "err", err)
+		return nil, awserrors.ErrorServerInternal
+	}
+
+	mountReply, err := d.natsConn.Request(utils.Subject(subjects.EBSMount(d.node)), ebsMountData, 30*time.Second)
+	if err != nil {
+		countNBDMount(false)
+		slog.Error("AttachVolume: ebs.mount failed", "volumeId", volumeID, "err", err)
+		return nil, awserrors.ErrorServerInternal
+	}
+
+	var mountResp types.EBSMountResponse
+	if err := json.Unmarshal(mountReply.Data, &mountResp); err != nil {
+		countNBDMount(false)
+		slog.Error("AttachVolume: failed to unmarshal mount response", "err", err)
+		return nil, awserrors.ErrorServerInternal
+	}
+	countNBDMount(mountResp.Error == "")
+
+	if mountResp.Error != "" {
+		slog.Error("AttachVolume: mount returned error", "volumeId", volumeID, "err", mountResp.Error)
+		return nil, awserrors.ErrorServerInternal
+	}
+
+	nbdURI := mountResp.URI
+	if nbdURI == "" {
+		slog.Error("AttachVolume: mount response has empty URI", "volumeId", volumeID)
+		d.rollbackEBSMount(*ebsRequest)
+		return nil, awserrors.ErrorServerInternal
+	}
+	ebsRequest.NBDURI = nbdURI
+
+	// Parse NBDURI for QMP blockdev-add
+	serverType, socketPath, nbdHost, nbdPort, err := utils.ParseNBDURI(nbdURI)
+	if err != nil {
+		slog.Error("AttachVolume: failed to parse NBDURI", "uri", nbdURI, "err", err)
+		// Rollback: unmount
+		d.rollbackEBSMount(*ebsRequest)
+		return nil, awserrors.ErrorServerInternal
+	}
+
+	// Build QMP server argument
+	var serverArg map[string]any
+	if serverType == "unix" {
+		serverArg = map[string]any{"type": "unix", "path": socketPath}
+	} else {
+		serverArg = map[string]any{"type": "inet", "host": nbdHost, "port": strconv.Itoa(nbdPort)}
+	}
+
+	return map[string]any{
+		"node-name": nodeName,
+		"driver":    "nbd",
+		"server":    serverArg,
+		"export":    "",
+		"read-only": false,
+	}, ""
+}
+
+// localBlockdevArgs returns blockdev-add arguments that open a local-backend
+// volume file directly, bypassing viperblock. The file lives on this node
+// only, so a missing file means the volume belongs to another node.
+func (d *Daemon) localBlockdevArgs(volumeID, nodeName string) (map[string]any, error) {
+	path := d.config.LocalVolumePath(volumeID)
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"node-name": nodeName,
+		"driver":    "raw",
+		"read-only": false,
+		"file": map[string]any{
+			"driver":   "file",
+			"filename": path,
+			"aio":      "threads",
+		},
+	}, nil
+}
+
+// rootVolumeTypeError checks that this node can back the root volume type a
+// RunInstances request asks for, returning an AWS error code or "". Root
+// volumes are clones of the AMI's viperblock snapshot, so the type must map
+// to viperblock here.
+func rootVolumeTypeError(cfg *config.Config, input *ec2.RunInstancesInput) string {
+	volumeType := ""
+	if len(input.BlockDeviceMappings) > 0 && input.BlockDeviceMappings[0].Ebs != nil {
+		volumeType = aws.StringValue(input.BlockDeviceMappings[0].Ebs.VolumeType)
+	}
+	if volumeType != "" && !handlers_ec2_volume.IsValidVolumeType(volumeType) {
+		return awserrors.ErrorInvalidParameterValue
+	}
+	if cfg.VolumeBackend(volumeType) != config.VolumeBackendViperblock {
+		slog.Warn("RunInstances: root volume type not available on this node", "volumeType", volumeType)
+		return awserrors.ErrorVolumeTypeNotAvailableInZone
+	}
+	return ""
+}
+
 // handleDetachVolume performs a three-phase hot-unplug (reverse of attach):
 //
 //	Phase 1: QMP device_del    (remove guest device)
@@ -365,10 +517,7 @@ func (d *Daemon) handleDetachVolume(msg *nats.Msg, command types.EC2InstanceComm
 	// failed at blockdev-del, leaving the volume's external state intact.
 	// Treat DeviceNotFound as success so the retry can drive blockdev-del
 	// to completion without bailing on the now-absent guest device.
-	_, err := d.SendQMPCommand(instance.QMPClient, qmp.QMPCommand{
-		Execute:   "device_del",
-		Arguments: map[string]any{"id": deviceID},
-	}, instance.ID)
+	_, err := d.SendQMPCommand(instance.QMPClient, qmp.DeviceDel(deviceID), instance.ID)
 	switch {
 	case err == nil:
 	case isQMPDeviceNotFound(err):
@@ -377,7 +526,7 @@ func (d *Daemon) handleDetachVolume(msg *nats.Msg, command types.EC2InstanceComm
 		slog.Warn("DetachVolume: QMP device_del failed (force=true, continuing)", "volumeId", volumeID, "err", err)
 	default:
 		slog.Error("DetachVolume: QMP device_del failed", "volumeId", volumeID, "err", err)
-		respondWithError(msg, awserrors.ErrorServerInternal)
+		respondWithQMPError(msg, err)
 		return
 	}
 
@@ -397,10 +546,14 @@ func (d *Daemon) handleDetachVolume(msg *nats.Msg, command types.EC2InstanceComm
 		// crash the VM, and removing metadata would allow the volume to be
 		// double-attached.
 		slog.Error("DetachVolume: QMP blockdev-del failed, leaving volume state intact", "volumeId", volumeID, "err", blockdevErr)
-		respondWithError(msg, awserrors.ErrorServerInternal)
+		respondWithQMPError(msg, blockdevErr)
 		return
 	}
 
+	if ebsReq.Encrypted {
+		d.removeVolumeSecret(instance, volumeID)
+	}
+
 	// Phase 2b: QMP object-del (remove iothread, best-effort)
 	_, iothreadErr := d.SendQMPCommand(instance.QMPClient, qmp.QMPCommand{
 		Execute:   "object-del",
@@ -413,29 +566,29 @@ func (d *Daemon) handleDetachVolume(msg *nats.Msg, command types.EC2InstanceComm
 	// Phase 3: ebs.unmount via NATS (best-effort)
 	d.rollbackEBSMount(ebsReq)
 
-	// State cleanup: remove volume from EBSRequests (search by name to avoid stale index)
-	instance.EBSRequests.Mu.Lock()
-	for i, req := range instance.EBSRequests.Requests {
-		if req.Name == volumeID {
-			instance.EBSRequests.Requests = append(instance.EBSRequests.Requests[:i], instance.EBSRequests.Requests[i+1:]...)
-			break
+	// State cleanup: remove volume from EBSRequests (search by name to avoid
+	// stale index) and from BlockDeviceMappings
+	d.Instances.WithVolumes(instance, func(reqs *types.EBSRequests) {
+		for i, req := range reqs.Requests {
+			if req.Name == volumeID {
+				reqs.Requests = append(reqs.Requests[:i], reqs.Requests[i+1:]...)
+				break
+			}
 		}
-	}
-	instance.EBSRequests.Mu.Unlock()
 
-	// Remove from BlockDeviceMappings
-	d.Instances.Mu.Lock()
-	if instance.Instance != nil {
-		filtered := make([]*ec2.InstanceBlockDeviceMapping, 0, len(instance.Instance.BlockDeviceMappings))
-		for _, bdm := range instance.Instance.BlockDeviceMappings {
-			if bdm.Ebs != nil && bdm.Ebs.VolumeId != nil && *bdm.Ebs.VolumeId == volumeID {
-				continue
+		if instance.Instance != nil {
+			filtered := make([]*ec2.InstanceBlockDeviceMapping, 0, len(instance.Instance.BlockDeviceMappings))
+			for _, bdm := range instance.Instance.BlockDeviceMappings {
+				if bdm.Ebs != nil && bdm.Ebs.VolumeId != nil && *bdm.Ebs.VolumeId == volumeID {
+					continue
+				}
+				filtered = append(filtered, bdm)
 			}
-			filtered = append(filtered, bdm)
+			instance.Instance.BlockDeviceMappings = filtered
 		}
-		instance.Instance.BlockDeviceMappings = filtered
-	}
-	d.Instances.Mu.Unlock()
+	})
+
+	d.updateEBSThrottle(instance)
 
 	// Update volume metadata to "available"
 	if err := d.volumeService.UpdateVolumeState(volumeID, "available", "", ""); err != nil {
@@ -448,11 +601,68 @@ func (d *Daemon) handleDetachVolume(msg *nats.Msg, command types.EC2InstanceComm
 	}
 
 	d.respondWithVolumeAttachment(msg, volumeID, command.ID, ebsReq.DeviceName, "detaching")
+	d.publishVolumeNotification(instance, types.VolumeNotificationDetail{
+		Event: "detachVolume", Result: "available", VolumeID: volumeID, InstanceID: command.ID, Device: ebsReq.DeviceName,
+	})
 	slog.Info("Volume detached successfully", "volumeId", volumeID, "instanceId", command.ID)
 }
 
 func (d *Daemon) handleEC2CreateVolume(msg *nats.Msg) {
-	handleNATSRequest(msg, d.volumeService.CreateVolume)
+	handleNATSRequest(msg, func(input *ec2.CreateVolumeInput, accountID string) (*ec2.Volume, error) {
+		size := d.createVolumeSize(input, accountID)
+		volumeType := aws.StringValue(input.VolumeType)
+		if volumeType == "" {
+			volumeType = config.DefaultVolumeType
+		}
+		if err := d.checkQuota(accountID, quota.Usage{Volumes: 1, VolumeGiB: size,
+			ProvisionedIOPS: int(handlers_ec2_volume.QuotaIOPS(volumeType, int64(size), aws.Int64Value(input.Iops)))}); err != nil {
+			return nil, err
+		}
+		return d.volumeService.CreateVolume(input, accountID)
+	})
+}
+
+// createVolumeSize returns the size in GiB of the volume input creates: its
+// Size, or else the size of the snapshot it restores. It is 0 when neither
+// is known, leaving CreateVolume to reject the request.
+func (d *Daemon) createVolumeSize(input *ec2.CreateVolumeInput, accountID string) int {
+	if input.Size != nil {
+		return int(*input.Size)
+	}
+	if input.SnapshotId == nil || d.snapshotService == nil {
+		return 0
+	}
+	out, err := d.snapshotService.DescribeSnapshots(&ec2.DescribeSnapshotsInput{SnapshotIds: []*string{input.SnapshotId}}, accountID)
+	if err != nil || len(out.Snapshots) == 0 {
+		return 0
+	}
+	return int(aws.Int64Value(out.Snapshots[0].VolumeSize))
+}
+
+// modifyVolumeUsage returns the volume storage and provisioned IOPS input
+// adds to the volume meta describes. Shrinking either adds nothing.
+func modifyVolumeUsage(input *ec2.ModifyVolumeInput, meta *viperblock.VolumeMetadata) quota.Usage {
+	size := utils.SafeUint64ToInt64(meta.SizeGiB)
+	volumeType := meta.VolumeType
+	if volumeType == "" {
+		volumeType = config.DefaultVolumeType
+	}
+	before := handlers_ec2_volume.QuotaIOPS(volumeType, size, int64(meta.IOPS))
+
+	targetSize := max(aws.Int64Value(input.Size), size)
+	targetType := volumeType
+	iops := aws.Int64Value(input.Iops)
+	if input.VolumeType != nil && *input.VolumeType != volumeType {
+		targetType = *input.VolumeType
+	} else if iops == 0 {
+		iops = int64(meta.IOPS)
+	}
+	after := handlers_ec2_volume.QuotaIOPS(targetType, targetSize, iops)
+
+	return quota.Usage{
+		VolumeGiB:       int(targetSize - size),
+		ProvisionedIOPS: int(max(after-before, 0)),
+	}
 }
 
 func (d *Daemon) handleEC2DescribeVolumes(msg *nats.Msg) {
@@ -467,6 +677,31 @@ func (d *Daemon) handleEC2DescribeVolumesModifications(msg *nats.Msg) {
 	handleNATSRequest(msg, d.volumeService.DescribeVolumesModifications)
 }
 
+func (d *Daemon) handleEC2ImportVolume(msg *nats.Msg) {
+	handleNATSRequest(msg, func(input *ec2.ImportVolumeInput, accountID string) (*ec2.ImportVolumeOutput, error) {
+		var size int
+		if input.Volume != nil {
+			size = int(aws.Int64Value(input.Volume.Size))
+		}
+		if err := d.checkQuota(accountID, quota.Usage{Volumes: 1, VolumeGiB: size}); err != nil {
+			return nil, err
+		}
+		return d.volumeService.ImportVolume(input, accountID)
+	})
+}
+
+func (d *Daemon) handleEC2ImportSnapshot(msg *nats.Msg) {
+	handleNATSRequest(msg, d.volumeService.ImportSnapshot)
+}
+
+func (d *Daemon) handleEC2DescribeConversionTasks(msg *nats.Msg) {
+	handleNATSRequest(msg, d.volumeService.DescribeConversionTasks)
+}
+
+func (d *Daemon) handleEC2DescribeImportSnapshotTasks(msg *nats.Msg) {
+	handleNATSRequest(msg, d.volumeService.DescribeImportSnapshotTasks)
+}
+
 // handleEC2ModifyVolume processes incoming EC2 ModifyVolume requests
 func (d *Daemon) handleEC2ModifyVolume(msg *nats.Msg) {
 	slog.Debug("Received message", "subject", msg.Subject)
@@ -478,15 +713,27 @@ func (d *Daemon) handleEC2ModifyVolume(msg *nats.Msg) {
 	errResp := utils.UnmarshalJsonPayload(modifyVolumeInput, msg.Data)
 
 	if errResp != nil {
-		if err := msg.Respond(errResp); err != nil {
-			slog.Error("Failed to respond to NATS request", "err", err)
-		}
+		respondWithError(msg, awserrors.ErrorValidationError)
 		slog.Error("Request does not match ModifyVolumeInput")
 		return
 	}
 
 	slog.Info("Processing ModifyVolume request", "volumeId", modifyVolumeInput.VolumeId, "accountID", accountID)
 
+	// A larger volume counts against the account's volume storage quota, and
+	// more provisioned IOPS against its IOPS quota
+	if modifyVolumeInput.VolumeId != nil {
+		if volCfg, err := d.volumeService.GetVolumeConfig(*modifyVolumeInput.VolumeId); err == nil {
+			if add := modifyVolumeUsage(modifyVolumeInput, &volCfg.VolumeMetadata); add != (quota.Usage{}) {
+				if err := d.checkQuota(accountID, add); err != nil {
+					slog.Warn("handleEC2ModifyVolume account quota reached", "volumeId", *modifyVolumeInput.VolumeId, "accountID", accountID, "err", err)
+					respondWithServiceError(msg, err)
+					return
+				}
+			}
+		}
+	}
+
 	output, err := d.volumeService.ModifyVolume(modifyVolumeInput, accountID)
 
 	if err != nil {
@@ -503,7 +750,7 @@ func (d *Daemon) handleEC2ModifyVolume(msg *nats.Msg) {
 		if err != nil {
 			slog.Error("failed to marshal ebs.sync request", "volumeId", *modifyVolumeInput.VolumeId, "err", err)
 		} else {
-			_, syncErr := d.natsConn.Request("ebs.sync", syncData, 5*time.Second)
+			_, syncErr := d.natsConn.Request(utils.Subject("ebs.sync"), syncData, 5*time.Second)
 			if syncErr != nil {
 				slog.Warn("ebs.sync notification failed (volume may not be mounted)",
 					"volumeId", *modifyVolumeInput.VolumeId, "err", syncErr)
@@ -511,9 +758,123 @@ func (d *Daemon) handleEC2ModifyVolume(msg *nats.Msg) {
 		}
 	}
 
+	if mod := output.VolumeModification; mod != nil && aws.StringValue(mod.ModificationState) == handlers_ec2_volume.ModificationStateModifying {
+		d.resizeAttachedVolume(accountID, aws.StringValue(mod.VolumeId), aws.Int64Value(mod.TargetSize))
+	}
+
 	slog.Info("handleEC2ModifyVolume completed", "volumeId", modifyVolumeInput.VolumeId)
 }
 
+// resizeAttachedVolume asks the node running the instance a grown volume is
+// attached to for an online resize, then completes the modification. If the
+// block device can't be resized the modification still completes, as the
+// volume itself has grown, and the instance sees it once restarted.
+func (d *Daemon) resizeAttachedVolume(accountID, volumeID string, sizeGiB int64) {
+	var statusMessage string
+	cfg, err := d.volumeService.GetVolumeConfig(volumeID)
+	if err == nil {
+		err = d.sendInstanceCommand(accountID, types.EC2InstanceCommand{
+			ID:               cfg.VolumeMetadata.AttachedInstance,
+			Attributes:       types.EC2CommandAttributes{ResizeVolume: true},
+			ResizeVolumeData: &types.ResizeVolumeData{VolumeID: volumeID, SizeGiB: sizeGiB},
+		})
+	}
+	if err != nil {
+		slog.Warn("ModifyVolume: online resize failed, instance sees the new size after a restart",
+			"volumeId", volumeID, "err", err)
+		statusMessage = "The instance sees the new size after it is stopped and started"
+	}
+
+	if err := d.volumeService.CompleteVolumeModification(volumeID, statusMessage); err != nil {
+		slog.Error("ModifyVolume: failed to complete modification", "volumeId", volumeID, "err", err)
+	}
+}
+
+// handleResizeVolume grows the block device of a local volume attached to
+// instance, after ModifyVolume has grown the volume's file, so the guest sees
+// the new capacity without a restart. NBD nodes cannot be grown, which
+// ModifyVolume already refuses for viperblock volumes in use.
+func (d *Daemon) handleResizeVolume(msg *nats.Msg, command types.EC2InstanceCommand, instance *vm.VM) {
+	data := command.ResizeVolumeData
+	if data == nil || data.VolumeID == "" || data.SizeGiB <= 0 {
+		respondWithError(msg, awserrors.ErrorMissingParameter)
+		return
+	}
+
+	var ebsRequest *types.EBSRequest
+	for _, req := range instance.SnapshotEBSRequests() {
+		if req.Name == data.VolumeID {
+			ebsRequest = &req
+			break
+		}
+	}
+	if ebsRequest == nil {
+		respondWithError(msg, awserrors.ErrorInvalidVolumeNotFound)
+		return
+	}
+	if ebsRequest.Backend != config.VolumeBackendLocal {
+		respondWithError(msg, awserrors.ErrorIncorrectState)
+		return
+	}
+
+	resp, err := d.SendQMPCommand(instance.QMPClient, qmp.QMPCommand{Execute: "query-block"}, instance.ID)
+	if err != nil {
+		slog.Error("ResizeVolume: QMP query-block failed", "volumeId", data.VolumeID, "err", err)
+		respondWithError(msg, awserrors.ErrorServerInternal)
+		return
+	}
+	var devices []qmp.BlockDevice
+	if err := json.Unmarshal(resp.Return, &devices); err != nil {
+		slog.Error("ResizeVolume: failed to parse query-block response", "volumeId", data.VolumeID, "err", err)
+		respondWithError(msg, awserrors.ErrorServerInternal)
+		return
+	}
+	nodeName := volumeBlockNode(devices, *ebsRequest)
+	if nodeName == "" {
+		slog.Error("ResizeVolume: no block node for volume", "volumeId", data.VolumeID, "instanceId", instance.ID)
+		respondWithError(msg, awserrors.ErrorServerInternal)
+		return
+	}
+
+	// The LUKS node of an encrypted volume sizes its payload, which sits
+	// after the header
+	size := data.SizeGiB * 1024 * 1024 * 1024
+	if ebsRequest.Encrypted {
+		size -= luksHeaderReserve
+	}
+	_, err = d.SendQMPCommand(instance.QMPClient, qmp.QMPCommand{
+		Execute:   "block_resize",
+		Arguments: map[string]any{"node-name": nodeName, "size": size},
+	}, instance.ID)
+	if err != nil {
+		slog.Error("ResizeVolume: QMP block_resize failed", "volumeId", data.VolumeID, "nodeName", nodeName, "err", err)
+		respondWithError(msg, awserrors.ErrorServerInternal)
+		return
+	}
+
+	slog.Info("Volume resized online", "volumeId", data.VolumeID, "instanceId", instance.ID, "sizeGiB", data.SizeGiB)
+	respondWithJSON(msg, struct{}{})
+}
+
+// volumeBlockNode finds the block node backing a volume in a query-block
+// result: the node hot-plugged volumes are added as, the boot drive, or the
+// drive opened from the volume's NBD export or file.
+func volumeBlockNode(devices []qmp.BlockDevice, req types.EBSRequest) string {
+	for _, dev := range devices {
+		if dev.Inserted == nil {
+			continue
+		}
+		switch {
+		case dev.Inserted.NodeName == "nbd-"+req.Name,
+			req.Boot && dev.Device == "os",
+			req.NBDURI != "" && dev.Inserted.File == req.NBDURI,
+			strings.Contains(dev.Inserted.File, req.Name):
+			return dev.Inserted.NodeName
+		}
+	}
+	return ""
+}
+
 func (d *Daemon) handleEC2DeleteVolume(msg *nats.Msg) {
 	handleNATSRequest(msg, d.volumeService.DeleteVolume)
 }
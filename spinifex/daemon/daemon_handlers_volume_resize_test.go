@@ -0,0 +1,108 @@
+package daemon
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/config"
+	"github.com/mulgadc/spinifex/spinifex/qmp"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVolumeBlockNode(t *testing.T) {
+	devices := []qmp.BlockDevice{
+		{Device: "cdrom"},
+		{Device: "os", Inserted: &qmp.BlockInserted{NodeName: "#block123", File: "nbd:unix:/run/vol-boot.sock"}},
+		{Device: "", Inserted: &qmp.BlockInserted{NodeName: "nbd-vol-data", File: "nbd:unix:/run/vol-data.sock"}},
+		{Device: "", Inserted: &qmp.BlockInserted{NodeName: "#block456", File: "nbd://10.0.0.5:10809/export"}},
+	}
+
+	tests := []struct {
+		name string
+		req  types.EBSRequest
+		want string
+	}{
+		{"hot-plugged node", types.EBSRequest{Name: "vol-data"}, "nbd-vol-data"},
+		{"boot drive", types.EBSRequest{Name: "vol-other", Boot: true}, "#block123"},
+		{"NBD URI", types.EBSRequest{Name: "vol-remote", NBDURI: "nbd://10.0.0.5:10809/export"}, "#block456"},
+		{"file name", types.EBSRequest{Name: "vol-boot"}, "#block123"},
+		{"not attached", types.EBSRequest{Name: "vol-missing"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, volumeBlockNode(devices, tt.req))
+		})
+	}
+}
+
+func TestHandleResizeVolume(t *testing.T) {
+	nc, err := nats.Connect(sharedNATSURL)
+	require.NoError(t, err)
+	t.Cleanup(nc.Close)
+
+	var mu sync.Mutex
+	var resized []map[string]any
+	qmpClient, cancel := newMockQMPClient(t, func(cmd qmp.QMPCommand) map[string]any {
+		switch cmd.Execute {
+		case "query-block":
+			return map[string]any{"return": []map[string]any{
+				{"device": "", "inserted": map[string]any{"node-name": "local-vol-resize", "file": "/var/lib/spinifex/volumes/vol-resize.raw"}},
+				{"device": "", "inserted": map[string]any{"node-name": "nbd-vol-nbd", "file": "nbd:unix:/run/vol-nbd.sock"}},
+			}}
+		case "block_resize":
+			mu.Lock()
+			resized = append(resized, cmd.Arguments)
+			mu.Unlock()
+		}
+		return map[string]any{"return": map[string]any{}}
+	})
+	t.Cleanup(cancel)
+
+	instance := &vm.VM{ID: "i-resize", Status: vm.StateRunning, QMPClient: qmpClient,
+		EBSRequests: types.EBSRequests{Requests: []types.EBSRequest{
+			{Name: "vol-resize", Backend: config.VolumeBackendLocal},
+			{Name: "vol-nbd"},
+		}}}
+	d := &Daemon{
+		natsConn:  nc,
+		config:    &config.Config{},
+		Instances: vm.Instances{VMS: map[string]*vm.VM{instance.ID: instance}},
+	}
+
+	resize := func(data *types.ResizeVolumeData) []byte {
+		t.Helper()
+		cmd := types.EC2InstanceCommand{ID: instance.ID, Attributes: types.EC2CommandAttributes{ResizeVolume: true}, ResizeVolumeData: data}
+		subject := "test.resize." + instance.ID
+		sub, err := nc.Subscribe(subject, func(msg *nats.Msg) { d.handleResizeVolume(msg, cmd, instance) })
+		require.NoError(t, err)
+		defer sub.Unsubscribe()
+
+		payload, _ := json.Marshal(cmd)
+		reply, err := nc.Request(subject, payload, 5*time.Second)
+		require.NoError(t, err)
+		return reply.Data
+	}
+
+	assert.Equal(t, `{}`, string(resize(&types.ResizeVolumeData{VolumeID: "vol-resize", SizeGiB: 20})))
+	mu.Lock()
+	require.Len(t, resized, 1)
+	assert.Equal(t, "local-vol-resize", resized[0]["node-name"])
+	assert.InDelta(t, float64(20<<30), resized[0]["size"], 0)
+	mu.Unlock()
+
+	// QEMU cannot grow NBD nodes.
+	assert.Contains(t, string(resize(&types.ResizeVolumeData{VolumeID: "vol-nbd", SizeGiB: 20})), awserrors.ErrorIncorrectState)
+	mu.Lock()
+	assert.Len(t, resized, 1)
+	mu.Unlock()
+
+	assert.Contains(t, string(resize(&types.ResizeVolumeData{VolumeID: "vol-missing", SizeGiB: 20})), awserrors.ErrorInvalidVolumeNotFound)
+	assert.Contains(t, string(resize(nil)), awserrors.ErrorMissingParameter)
+}
@@ -46,6 +46,22 @@ func (d *Daemon) handleEC2DescribeVpcAttribute(msg *nats.Msg) {
 	handleNATSRequest(msg, d.vpcService.DescribeVpcAttribute)
 }
 
+func (d *Daemon) handleEC2CreateDhcpOptions(msg *nats.Msg) {
+	handleNATSRequest(msg, d.vpcService.CreateDhcpOptions)
+}
+
+func (d *Daemon) handleEC2DeleteDhcpOptions(msg *nats.Msg) {
+	handleNATSRequest(msg, d.vpcService.DeleteDhcpOptions)
+}
+
+func (d *Daemon) handleEC2DescribeDhcpOptions(msg *nats.Msg) {
+	handleNATSRequest(msg, d.vpcService.DescribeDhcpOptions)
+}
+
+func (d *Daemon) handleEC2AssociateDhcpOptions(msg *nats.Msg) {
+	handleNATSRequest(msg, d.vpcService.AssociateDhcpOptions)
+}
+
 func (d *Daemon) handleEC2CreateNetworkInterface(msg *nats.Msg) {
 	handleNATSRequest(msg, d.vpcService.CreateNetworkInterface)
 }
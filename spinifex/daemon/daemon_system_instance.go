@@ -9,6 +9,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	handlers_elbv2 "github.com/mulgadc/spinifex/spinifex/handlers/elbv2"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
 	"github.com/mulgadc/spinifex/spinifex/tags"
 	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/mulgadc/spinifex/spinifex/vm"
@@ -124,10 +125,11 @@ func (d *Daemon) LaunchSystemInstance(input *handlers_elbv2.SystemInstanceInput)
 				}
 			}
 			instance.ExtraENIs = append(instance.ExtraENIs, vm.ExtraENI{
-				ENIID:    extra.ENIID,
-				ENIMac:   extra.ENIMac,
-				ENIIP:    extra.ENIIP,
-				SubnetID: extra.SubnetID,
+				ENIID:       extra.ENIID,
+				ENIMac:      extra.ENIMac,
+				ENIIP:       extra.ENIIP,
+				SubnetID:    extra.SubnetID,
+				DeviceIndex: int64(idx + 1),
 			})
 		}
 	} else if input.SubnetID != "" && d.vpcService != nil {
@@ -237,9 +239,7 @@ func (d *Daemon) LaunchSystemInstance(input *handlers_elbv2.SystemInstanceInput)
 	}
 
 	// Add to daemon state so LaunchInstance can find it
-	d.Instances.Mu.Lock()
-	d.Instances.VMS[instance.ID] = instance
-	d.Instances.Mu.Unlock()
+	d.Instances.UpsertVM(instance)
 
 	if err := d.WriteState(); err != nil {
 		slog.Warn("LaunchSystemInstance: failed to write state", "instanceId", instance.ID, "err", err)
@@ -247,7 +247,7 @@ func (d *Daemon) LaunchSystemInstance(input *handlers_elbv2.SystemInstanceInput)
 
 	// Subscribe to per-instance NATS topic for terminate commands
 	d.mu.Lock()
-	sub, subErr := d.natsConn.Subscribe(fmt.Sprintf("ec2.cmd.%s", instance.ID), d.handleEC2Events)
+	sub, subErr := d.natsConn.Subscribe(utils.Subject(subjects.InstanceCmd(instance.ID)), d.handleEC2Events)
 	if subErr != nil {
 		slog.Warn("LaunchSystemInstance: failed to subscribe to instance topic", "instanceId", instance.ID, "err", subErr)
 	} else {
@@ -347,9 +347,7 @@ func (d *Daemon) LaunchSystemInstance(input *handlers_elbv2.SystemInstanceInput)
 
 // TerminateSystemInstance stops and cleans up a system-managed VM.
 func (d *Daemon) TerminateSystemInstance(instanceID string) error {
-	d.Instances.Mu.Lock()
-	instance, exists := d.Instances.VMS[instanceID]
-	d.Instances.Mu.Unlock()
+	instance, exists := d.Instances.GetVM(instanceID)
 
 	if !exists {
 		return fmt.Errorf("instance %s not found", instanceID)
@@ -387,9 +385,8 @@ func (d *Daemon) TerminateSystemInstance(instanceID string) error {
 	}
 
 	// Stop the VM (QEMU shutdown, volume unmount, tap cleanup)
-	if err := d.stopInstance(map[string]*vm.VM{instanceID: instance}, true); err != nil {
-		slog.Error("TerminateSystemInstance: stopInstance failed", "instanceId", instanceID, "err", err)
-		return fmt.Errorf("stop instance: %w", err)
+	if err := d.stopInstance([]*vm.VM{instance}, true); err != nil {
+		slog.Error("TerminateSystemInstance: volume teardown incomplete, instance is down", "instanceId", instanceID, "err", err)
 	}
 
 	if err := d.TransitionState(instance, vm.StateTerminated); err != nil {
@@ -404,9 +401,7 @@ func (d *Daemon) TerminateSystemInstance(instanceID string) error {
 	}
 
 	// Clean up local state
-	d.Instances.Mu.Lock()
-	delete(d.Instances.VMS, instanceID)
-	d.Instances.Mu.Unlock()
+	d.Instances.DeleteVM(instanceID)
 
 	// Unsubscribe from per-instance NATS topic
 	d.mu.Lock()
@@ -467,13 +462,10 @@ func (d *Daemon) cleanupFailedSystemInstance(instance *vm.VM, instanceType *ec2.
 func (d *Daemon) WaitForSystemInstance(instanceID string, timeout time.Duration) error {
 	deadline := time.Now().Add(timeout)
 	for time.Now().Before(deadline) {
-		d.Instances.Mu.Lock()
-		inst, exists := d.Instances.VMS[instanceID]
 		var status vm.InstanceState
-		if exists {
+		exists := d.Instances.WithVM(instanceID, func(inst *vm.VM) {
 			status = inst.Status
-		}
-		d.Instances.Mu.Unlock()
+		})
 
 		if !exists {
 			return fmt.Errorf("instance %s disappeared", instanceID)
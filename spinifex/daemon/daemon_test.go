@@ -19,18 +19,23 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	awss3 "github.com/aws/aws-sdk-go/service/s3"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
 	"github.com/mulgadc/spinifex/spinifex/config"
 	handlers_ec2_instance "github.com/mulgadc/spinifex/spinifex/handlers/ec2/instance"
 	handlers_ec2_volume "github.com/mulgadc/spinifex/spinifex/handlers/ec2/volume"
 	"github.com/mulgadc/spinifex/spinifex/instancetypes"
 	"github.com/mulgadc/spinifex/spinifex/objectstore"
+	"github.com/mulgadc/spinifex/spinifex/pagination"
 	"github.com/mulgadc/spinifex/spinifex/qmp"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/testutil"
 	"github.com/mulgadc/spinifex/spinifex/types"
 	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/mulgadc/spinifex/spinifex/vm"
@@ -1335,6 +1340,37 @@ func TestDescribeInstances_ReservationGrouping(t *testing.T) {
 		}
 	})
 
+	t.Run("Paginated_ReturnsPagePlusOne", func(t *testing.T) {
+		// The node sends one instance beyond the page so the gateway can
+		// tell another page follows; it cuts the page itself.
+		input := &ec2.DescribeInstancesInput{
+			MaxResults: aws.Int64(5),
+			NextToken:  aws.String(pagination.EncodeToken("i-group1-001")),
+		}
+		inputJSON, _ := json.Marshal(input)
+
+		resp, err := natsRequest(daemon.natsConn, "ec2.DescribeInstances", inputJSON, 5*time.Second)
+		require.NoError(t, err)
+
+		var output ec2.DescribeInstancesOutput
+		require.NoError(t, json.Unmarshal(resp.Data, &output))
+		var ids []string
+		for _, res := range output.Reservations {
+			for _, inst := range res.Instances {
+				ids = append(ids, *inst.InstanceId)
+			}
+		}
+		assert.ElementsMatch(t, []string{"i-group1-002", "i-group1-003", "i-group2-001", "i-group2-002", "i-single-001"}, ids)
+	})
+
+	t.Run("Paginated_InvalidMaxResults", func(t *testing.T) {
+		inputJSON, _ := json.Marshal(&ec2.DescribeInstancesInput{MaxResults: aws.Int64(1001)})
+
+		resp, err := natsRequest(daemon.natsConn, "ec2.DescribeInstances", inputJSON, 5*time.Second)
+		require.NoError(t, err)
+		assert.Contains(t, string(resp.Data), awserrors.ErrorInvalidMaxResults)
+	})
+
 	t.Run("InstanceStates_AreCorrect", func(t *testing.T) {
 		input := &ec2.DescribeInstancesInput{}
 		inputJSON, _ := json.Marshal(input)
@@ -1365,7 +1401,7 @@ func TestDescribeInstances_ReservationGrouping(t *testing.T) {
 func TestRunInstances_CountValidation(t *testing.T) {
 	natsURL := sharedNATSURL
 	instanceType := getTestInstanceType(t)
-	topic := fmt.Sprintf("ec2.RunInstances.%s", instanceType)
+	topic := subjects.RunInstances(instanceType)
 
 	daemon, memStore := createFullTestDaemonWithStore(t, natsURL)
 
@@ -1437,6 +1473,58 @@ func TestRunInstances_CountValidation(t *testing.T) {
 	})
 }
 
+// TestRunInstances_CapacityDetail verifies that an InsufficientInstanceCapacity
+// from RunInstances names the binding resource and the shortfall.
+func TestRunInstances_CapacityDetail(t *testing.T) {
+	instanceType := getTestInstanceType(t)
+	topic := subjects.RunInstances(instanceType)
+
+	daemon, memStore := createFullTestDaemonWithStore(t, sharedNATSURL)
+	seedTestAMI(t, memStore, daemon.config.Predastore.Bucket, "ami-test")
+
+	sub, err := daemon.natsConn.QueueSubscribe(topic, "spinifex-workers", daemon.handleEC2RunInstances)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	it := daemon.resourceMgr.instanceTypes[instanceType]
+	vCPUs := int(instanceTypeVCPUs(it))
+	memGB := float64(instanceTypeMemoryMiB(it)) / 1024.0
+
+	runInstances := func(t *testing.T) map[string]any {
+		t.Helper()
+		inputJSON, _ := json.Marshal(&ec2.RunInstancesInput{
+			ImageId:      aws.String("ami-test"),
+			InstanceType: aws.String(instanceType),
+			MinCount:     aws.Int64(1),
+			MaxCount:     aws.Int64(1),
+		})
+		resp, err := natsRequest(daemon.natsConn, topic, inputJSON, 5*time.Second)
+		require.NoError(t, err)
+		var errResp map[string]any
+		require.NoError(t, json.Unmarshal(resp.Data, &errResp))
+		require.Equal(t, "InsufficientInstanceCapacity", errResp["Code"])
+		return errResp
+	}
+
+	rm := daemon.resourceMgr
+	rm.reservedVCPU, rm.reservedMem = 0, 0
+	rm.allocatedVCPU, rm.allocatedMem = 0, 0
+
+	t.Run("memory bound", func(t *testing.T) {
+		rm.hostVCPU, rm.hostMemGB = 64, memGB/2
+		errResp := runInstances(t)
+		assert.Contains(t, errResp["Message"], "not enough memory for 1 x "+instanceType)
+		assert.Contains(t, errResp["Message"], fmt.Sprintf("%.1f GiB needed, %.1f GiB available", memGB, memGB/2))
+	})
+
+	t.Run("vCPU bound", func(t *testing.T) {
+		rm.hostVCPU, rm.hostMemGB = vCPUs-1, 64
+		errResp := runInstances(t)
+		assert.Contains(t, errResp["Message"], "not enough vCPU for 1 x "+instanceType)
+		assert.Contains(t, errResp["Message"], fmt.Sprintf("%d needed, %d available (1 short)", vCPUs, vCPUs-1))
+	})
+}
+
 // TestInstanceTypeSubscriptions tests dynamic NATS subscription management
 // based on node capacity.
 func TestInstanceTypeSubscriptions(t *testing.T) {
@@ -1626,7 +1714,7 @@ func TestInstanceTypeSubscriptions(t *testing.T) {
 
 		// Publishing to an instance type topic should get no responders
 		instanceType := getTestInstanceType(t)
-		topic := fmt.Sprintf("ec2.RunInstances.%s", instanceType)
+		topic := subjects.RunInstances(instanceType)
 
 		_, err = nc.Request(topic, []byte("{}"), 500*time.Millisecond)
 		assert.ErrorIs(t, err, nats.ErrNoResponders,
@@ -1797,7 +1885,7 @@ func TestStopInstance_DeleteOnTermination_VolumeDeletion(t *testing.T) {
 	ebsDeletedVolumes := make(map[string]bool)
 
 	// Mock ebs.unmount subscriber
-	unmountSub, err := daemon.natsConn.Subscribe("ebs.node-1.unmount", func(msg *nats.Msg) {
+	unmountSub, err := daemon.natsConn.Subscribe(subjects.EBSUnmount("node-1"), func(msg *nats.Msg) {
 		var req types.EBSRequest
 		json.Unmarshal(msg.Data, &req)
 		mu.Lock()
@@ -1825,10 +1913,10 @@ func TestStopInstance_DeleteOnTermination_VolumeDeletion(t *testing.T) {
 	defer deleteSub.Unsubscribe()
 
 	// Subscribe to the instance NATS topic to avoid unsubscribe errors
-	instanceSub, err := daemon.natsConn.Subscribe("ec2.cmd.i-test-dot", func(msg *nats.Msg) {})
+	instanceSub, err := daemon.natsConn.Subscribe(subjects.InstanceCmd("i-test-dot"), func(msg *nats.Msg) {})
 	require.NoError(t, err)
 	defer instanceSub.Unsubscribe()
-	daemon.natsSubscriptions["ec2.cmd.i-test-dot"] = instanceSub
+	daemon.natsSubscriptions[subjects.InstanceCmd("i-test-dot")] = instanceSub
 
 	instance := &vm.VM{
 		ID:           "i-test-dot",
@@ -1864,12 +1952,9 @@ func TestStopInstance_DeleteOnTermination_VolumeDeletion(t *testing.T) {
 	daemon.Instances.VMS[instance.ID] = instance
 
 	// Call stopInstance with deleteVolume=true (termination)
-	err = daemon.stopInstance(map[string]*vm.VM{instance.ID: instance}, true)
+	err = daemon.stopInstance([]*vm.VM{instance}, true)
 	assert.NoError(t, err)
 
-	// Allow NATS messages to propagate
-	time.Sleep(200 * time.Millisecond)
-
 	mu.Lock()
 	defer mu.Unlock()
 
@@ -1895,7 +1980,7 @@ func TestStopInstance_DeleteOnTermination_False_SkipsVolumeDeletion(t *testing.T
 	ebsDeletedVolumes := make(map[string]bool)
 
 	// Mock ebs.unmount subscriber
-	unmountSub, err := daemon.natsConn.Subscribe("ebs.node-1.unmount", func(msg *nats.Msg) {
+	unmountSub, err := daemon.natsConn.Subscribe(subjects.EBSUnmount("node-1"), func(msg *nats.Msg) {
 		var req types.EBSRequest
 		json.Unmarshal(msg.Data, &req)
 		mu.Lock()
@@ -1923,10 +2008,10 @@ func TestStopInstance_DeleteOnTermination_False_SkipsVolumeDeletion(t *testing.T
 	defer deleteSub.Unsubscribe()
 
 	// Subscribe to the instance NATS topic
-	instanceSub, err := daemon.natsConn.Subscribe("ec2.cmd.i-test-no-delete", func(msg *nats.Msg) {})
+	instanceSub, err := daemon.natsConn.Subscribe(subjects.InstanceCmd("i-test-no-delete"), func(msg *nats.Msg) {})
 	require.NoError(t, err)
 	defer instanceSub.Unsubscribe()
-	daemon.natsSubscriptions["ec2.cmd.i-test-no-delete"] = instanceSub
+	daemon.natsSubscriptions[subjects.InstanceCmd("i-test-no-delete")] = instanceSub
 
 	instance := &vm.VM{
 		ID:           "i-test-no-delete",
@@ -1961,11 +2046,9 @@ func TestStopInstance_DeleteOnTermination_False_SkipsVolumeDeletion(t *testing.T
 	daemon.Instances.VMS[instance.ID] = instance
 
 	// Call stopInstance with deleteVolume=true (termination)
-	err = daemon.stopInstance(map[string]*vm.VM{instance.ID: instance}, true)
+	err = daemon.stopInstance([]*vm.VM{instance}, true)
 	assert.NoError(t, err)
 
-	time.Sleep(200 * time.Millisecond)
-
 	mu.Lock()
 	defer mu.Unlock()
 
@@ -1993,7 +2076,7 @@ func TestStopInstance_NoDelete_OnStop(t *testing.T) {
 	ebsDeletedVolumes := make(map[string]bool)
 
 	// Mock ebs.unmount subscriber
-	unmountSub, err := daemon.natsConn.Subscribe("ebs.node-1.unmount", func(msg *nats.Msg) {
+	unmountSub, err := daemon.natsConn.Subscribe(subjects.EBSUnmount("node-1"), func(msg *nats.Msg) {
 		resp := types.EBSUnMountResponse{Mounted: false}
 		data, _ := json.Marshal(resp)
 		msg.Respond(data)
@@ -2044,11 +2127,9 @@ func TestStopInstance_NoDelete_OnStop(t *testing.T) {
 	daemon.Instances.VMS[instance.ID] = instance
 
 	// Call stopInstance with deleteVolume=false (stop, not terminate)
-	err = daemon.stopInstance(map[string]*vm.VM{instance.ID: instance}, false)
+	err = daemon.stopInstance([]*vm.VM{instance}, false)
 	assert.NoError(t, err)
 
-	time.Sleep(200 * time.Millisecond)
-
 	mu.Lock()
 	defer mu.Unlock()
 
@@ -2056,6 +2137,194 @@ func TestStopInstance_NoDelete_OnStop(t *testing.T) {
 	assert.Empty(t, ebsDeletedVolumes, "No volumes should be deleted during stop (not terminate)")
 }
 
+// TestStopInstance_WaitsForVolumeTeardown verifies that stopInstance returns
+// only after every ebs.unmount and ebs.delete has been answered, and that
+// internal volumes are deleted only once all unmounts have completed.
+func TestStopInstance_WaitsForVolumeTeardown(t *testing.T) {
+	daemon := createTestDaemon(t, sharedNATSURL)
+
+	var mu sync.Mutex
+	var unmounted, deleted []string
+	var deletedBeforeUnmounts bool
+
+	unmountSub, err := daemon.natsConn.Subscribe(subjects.EBSUnmount("node-1"), func(msg *nats.Msg) {
+		var req types.EBSRequest
+		json.Unmarshal(msg.Data, &req)
+		// Slow viperblockd: the reply arrives well after the request.
+		time.Sleep(100 * time.Millisecond)
+		mu.Lock()
+		unmounted = append(unmounted, req.Name)
+		mu.Unlock()
+		data, _ := json.Marshal(types.EBSUnMountResponse{Volume: req.Name, Mounted: false})
+		msg.Respond(data)
+	})
+	require.NoError(t, err)
+	defer unmountSub.Unsubscribe()
+
+	deleteSub, err := daemon.natsConn.Subscribe("ebs.delete", func(msg *nats.Msg) {
+		var req types.EBSDeleteRequest
+		json.Unmarshal(msg.Data, &req)
+		time.Sleep(100 * time.Millisecond)
+		mu.Lock()
+		if len(unmounted) < 3 {
+			deletedBeforeUnmounts = true
+		}
+		deleted = append(deleted, req.Volume)
+		mu.Unlock()
+		data, _ := json.Marshal(types.EBSDeleteResponse{Volume: req.Volume, Success: true})
+		msg.Respond(data)
+	})
+	require.NoError(t, err)
+	defer deleteSub.Unsubscribe()
+
+	instance := &vm.VM{
+		ID:           "i-test-teardown-wait",
+		InstanceType: getTestInstanceType(t),
+		Status:       vm.StateRunning,
+		AccountID:    testAccountID,
+		QMPClient:    &qmp.QMPClient{},
+		EBSRequests: types.EBSRequests{
+			Requests: []types.EBSRequest{
+				{Name: "vol-wait", Boot: true},
+				{Name: "vol-wait-efi", EFI: true},
+				{Name: "vol-wait-cloudinit", CloudInit: true},
+			},
+		},
+	}
+
+	instanceType := daemon.resourceMgr.instanceTypes[instance.InstanceType]
+	require.NotNil(t, instanceType)
+	require.NoError(t, daemon.resourceMgr.allocate(instanceType))
+	daemon.Instances.VMS[instance.ID] = instance
+
+	require.NoError(t, daemon.stopInstance([]*vm.VM{instance}, true))
+
+	// No waiting: every reply has been received by the time stopInstance returns.
+	mu.Lock()
+	defer mu.Unlock()
+	assert.ElementsMatch(t, []string{"vol-wait", "vol-wait-efi", "vol-wait-cloudinit"}, unmounted)
+	assert.ElementsMatch(t, []string{"vol-wait-efi", "vol-wait-cloudinit"}, deleted)
+	assert.False(t, deletedBeforeUnmounts, "volumes must be unmounted before they are deleted")
+}
+
+// TestStopInstance_ConcurrentTeardownJoinsErrors verifies that an instance's
+// volumes are torn down concurrently, up to maxConcurrentVolumeTeardown at a
+// time, and that failing volumes don't stop the rest being cleaned up but are
+// all reported.
+func TestStopInstance_ConcurrentTeardownJoinsErrors(t *testing.T) {
+	daemon := createTestDaemon(t, sharedNATSURL)
+
+	var mu sync.Mutex
+	var inFlight, maxInFlight int
+	unmounted := make(map[string]bool)
+	deleted := make(map[string]bool)
+
+	// Replies are sent from goroutines so requests can overlap.
+	unmountSub, err := daemon.natsConn.Subscribe(subjects.EBSUnmount("node-1"), func(msg *nats.Msg) {
+		var req types.EBSRequest
+		json.Unmarshal(msg.Data, &req)
+		go func() {
+			mu.Lock()
+			inFlight++
+			maxInFlight = max(maxInFlight, inFlight)
+			mu.Unlock()
+			time.Sleep(100 * time.Millisecond)
+			mu.Lock()
+			inFlight--
+			unmounted[req.Name] = true
+			mu.Unlock()
+			resp := types.EBSUnMountResponse{Volume: req.Name}
+			if req.Name == "vol-par-2" || req.Name == "vol-par-4" {
+				resp.Mounted, resp.Error = true, "nbd export busy"
+			}
+			data, _ := json.Marshal(resp)
+			msg.Respond(data)
+		}()
+	})
+	require.NoError(t, err)
+	defer unmountSub.Unsubscribe()
+
+	deleteSub, err := daemon.natsConn.Subscribe("ebs.delete", func(msg *nats.Msg) {
+		var req types.EBSDeleteRequest
+		json.Unmarshal(msg.Data, &req)
+		mu.Lock()
+		deleted[req.Volume] = true
+		mu.Unlock()
+		resp := types.EBSDeleteResponse{Volume: req.Volume, Success: true}
+		if req.Volume == "vol-par-cloudinit" {
+			resp.Success, resp.Error = false, "viperblockd stop failed"
+		}
+		data, _ := json.Marshal(resp)
+		msg.Respond(data)
+	})
+	require.NoError(t, err)
+	defer deleteSub.Unsubscribe()
+
+	requests := []types.EBSRequest{
+		{Name: "vol-par-efi", EFI: true},
+		{Name: "vol-par-cloudinit", CloudInit: true},
+	}
+	for i := range 10 {
+		requests = append(requests, types.EBSRequest{Name: fmt.Sprintf("vol-par-%d", i), DeleteOnTermination: true})
+	}
+	instance := &vm.VM{
+		ID:           "i-test-teardown-par",
+		InstanceType: getTestInstanceType(t),
+		Status:       vm.StateRunning,
+		AccountID:    testAccountID,
+		QMPClient:    &qmp.QMPClient{},
+		EBSRequests:  types.EBSRequests{Requests: requests},
+	}
+
+	instanceType := daemon.resourceMgr.instanceTypes[instance.InstanceType]
+	require.NotNil(t, instanceType)
+	require.NoError(t, daemon.resourceMgr.allocate(instanceType))
+	daemon.Instances.VMS[instance.ID] = instance
+
+	err = daemon.stopInstance([]*vm.VM{instance}, true)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unmount vol-par-2: nbd export busy")
+	assert.Contains(t, err.Error(), "unmount vol-par-4: nbd export busy")
+	assert.Contains(t, err.Error(), "delete vol-par-cloudinit: viperblockd stop failed")
+	assert.NotContains(t, err.Error(), "vol-par-efi")
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Len(t, unmounted, len(requests), "every volume should be unmounted despite failures")
+	assert.True(t, deleted["vol-par-efi"], "internal volumes are always deleted")
+	assert.True(t, deleted["vol-par-cloudinit"], "internal volumes are always deleted")
+	assert.Greater(t, maxInFlight, 1, "unmounts should run concurrently")
+	assert.LessOrEqual(t, maxInFlight, maxConcurrentVolumeTeardown)
+}
+
+// TestFinalizeTermination_TeardownFailureStillTerminates verifies that a
+// volume that fails to unmount doesn't leave a dead instance in error: QEMU
+// is down, so the instance still reaches terminated.
+func TestFinalizeTermination_TeardownFailureStillTerminates(t *testing.T) {
+	daemon := createTestDaemon(t, sharedNATSURL)
+
+	unmountSub, err := daemon.natsConn.Subscribe(subjects.EBSUnmount("node-1"), func(msg *nats.Msg) {
+		var req types.EBSRequest
+		json.Unmarshal(msg.Data, &req)
+		data, _ := json.Marshal(types.EBSUnMountResponse{Volume: req.Name, Mounted: true, Error: "nbd export busy"})
+		msg.Respond(data)
+	})
+	require.NoError(t, err)
+	defer unmountSub.Unsubscribe()
+
+	instance := &vm.VM{
+		ID:          "i-test-teardown-fail",
+		Status:      vm.StateShuttingDown,
+		AccountID:   testAccountID,
+		QMPClient:   &qmp.QMPClient{},
+		EBSRequests: types.EBSRequests{Requests: []types.EBSRequest{{Name: "vol-stuck"}}},
+	}
+	daemon.Instances.VMS[instance.ID] = instance
+
+	daemon.finalizeTermination(instance)
+	assert.Equal(t, vm.StateTerminated, instance.Status)
+}
+
 // TestHandleEC2Events_AttachVolume tests the attach-volume handler in handleEC2Events
 func TestHandleEC2Events_AttachVolume(t *testing.T) {
 	natsURL := sharedNATSURL
@@ -2079,7 +2348,7 @@ func TestHandleEC2Events_AttachVolume(t *testing.T) {
 
 	// Subscribe the handler to the instance's per-instance topic
 	sub, err := daemon.natsConn.Subscribe(
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		daemon.handleEC2Events,
 	)
 	require.NoError(t, err)
@@ -2096,7 +2365,7 @@ func TestHandleEC2Events_AttachVolume(t *testing.T) {
 		data, _ := json.Marshal(command)
 
 		resp, err := natsRequest(daemon.natsConn,
-			fmt.Sprintf("ec2.cmd.%s", instanceID),
+			subjects.InstanceCmd(instanceID),
 			data,
 			5*time.Second,
 		)
@@ -2124,7 +2393,7 @@ func TestHandleEC2Events_AttachVolume(t *testing.T) {
 		data, _ := json.Marshal(command)
 
 		resp, err := natsRequest(daemon.natsConn,
-			fmt.Sprintf("ec2.cmd.%s", instanceID),
+			subjects.InstanceCmd(instanceID),
 			data,
 			5*time.Second,
 		)
@@ -2152,7 +2421,7 @@ func TestHandleEC2Events_AttachVolume(t *testing.T) {
 		data, _ := json.Marshal(command)
 
 		resp, err := natsRequest(daemon.natsConn,
-			fmt.Sprintf("ec2.cmd.%s", instanceID),
+			subjects.InstanceCmd(instanceID),
 			data,
 			5*time.Second,
 		)
@@ -2225,7 +2494,7 @@ func TestHandleEC2Events_DetachVolume(t *testing.T) {
 
 	// Subscribe the handler to the instance's per-instance topic
 	sub, err := daemon.natsConn.Subscribe(
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		daemon.handleEC2Events,
 	)
 	require.NoError(t, err)
@@ -2242,7 +2511,7 @@ func TestHandleEC2Events_DetachVolume(t *testing.T) {
 		data, _ := json.Marshal(command)
 
 		resp, err := natsRequest(daemon.natsConn,
-			fmt.Sprintf("ec2.cmd.%s", instanceID),
+			subjects.InstanceCmd(instanceID),
 			data,
 			5*time.Second,
 		)
@@ -2268,7 +2537,7 @@ func TestHandleEC2Events_DetachVolume(t *testing.T) {
 		data, _ := json.Marshal(command)
 
 		resp, err := natsRequest(daemon.natsConn,
-			fmt.Sprintf("ec2.cmd.%s", instanceID),
+			subjects.InstanceCmd(instanceID),
 			data,
 			5*time.Second,
 		)
@@ -2294,7 +2563,7 @@ func TestHandleEC2Events_DetachVolume(t *testing.T) {
 		data, _ := json.Marshal(command)
 
 		resp, err := natsRequest(daemon.natsConn,
-			fmt.Sprintf("ec2.cmd.%s", instanceID),
+			subjects.InstanceCmd(instanceID),
 			data,
 			5*time.Second,
 		)
@@ -2325,7 +2594,7 @@ func TestHandleEC2Events_DetachVolume(t *testing.T) {
 		data, _ := json.Marshal(command)
 
 		resp, err := natsRequest(daemon.natsConn,
-			fmt.Sprintf("ec2.cmd.%s", instanceID),
+			subjects.InstanceCmd(instanceID),
 			data,
 			5*time.Second,
 		)
@@ -2360,7 +2629,7 @@ func TestHandleEC2Events_DetachVolume(t *testing.T) {
 		data, _ := json.Marshal(command)
 
 		resp, err := natsRequest(daemon.natsConn,
-			fmt.Sprintf("ec2.cmd.%s", instanceID),
+			subjects.InstanceCmd(instanceID),
 			data,
 			5*time.Second,
 		)
@@ -2394,7 +2663,7 @@ func TestHandleEC2Events_DetachVolume(t *testing.T) {
 		data, _ := json.Marshal(command)
 
 		resp, err := natsRequest(daemon.natsConn,
-			fmt.Sprintf("ec2.cmd.%s", instanceID),
+			subjects.InstanceCmd(instanceID),
 			data,
 			5*time.Second,
 		)
@@ -2420,7 +2689,7 @@ func TestHandleEC2Events_DetachVolume(t *testing.T) {
 		data, _ := json.Marshal(command)
 
 		resp, err := natsRequest(daemon.natsConn,
-			fmt.Sprintf("ec2.cmd.%s", instanceID),
+			subjects.InstanceCmd(instanceID),
 			data,
 			5*time.Second,
 		)
@@ -2444,7 +2713,7 @@ func TestHandleEC2Events_DetachVolume(t *testing.T) {
 		data, _ := json.Marshal(command)
 
 		resp, err := natsRequest(daemon.natsConn,
-			fmt.Sprintf("ec2.cmd.%s", instanceID),
+			subjects.InstanceCmd(instanceID),
 			data,
 			5*time.Second,
 		)
@@ -2480,11 +2749,26 @@ func newMockQMPClient(t *testing.T, responseFunc func(cmd qmp.QMPCommand) map[st
 		Encoder: json.NewEncoder(clientConn),
 	}
 
+	// Responses are written from their own goroutine: net.Pipe writes block
+	// until fully read, and the client's trailing newline may still be unread
+	// when the response is ready.
+	responses := make(chan map[string]any, 16)
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		enc := json.NewEncoder(serverConn)
+		for resp := range responses {
+			if err := enc.Encode(resp); err != nil {
+				return
+			}
+		}
+	}()
+
 	done := make(chan struct{})
 	go func() {
 		defer close(done)
+		defer close(responses)
 		dec := json.NewDecoder(serverConn)
-		enc := json.NewEncoder(serverConn)
 		for {
 			var cmd qmp.QMPCommand
 			if err := dec.Decode(&cmd); err != nil {
@@ -2496,9 +2780,7 @@ func newMockQMPClient(t *testing.T, responseFunc func(cmd qmp.QMPCommand) map[st
 			} else {
 				resp = map[string]any{"return": map[string]any{}}
 			}
-			if err := enc.Encode(resp); err != nil {
-				return
-			}
+			responses <- resp
 		}
 	}()
 
@@ -2506,6 +2788,7 @@ func newMockQMPClient(t *testing.T, responseFunc func(cmd qmp.QMPCommand) map[st
 		clientConn.Close()
 		serverConn.Close()
 		<-done
+		<-writerDone
 	}
 	return client, cancel
 }
@@ -2574,7 +2857,7 @@ func TestDetachVolume_SuccessPath(t *testing.T) {
 
 	// Subscribe a mock ebs.unmount handler
 	ebsUnmountCalled := make(chan string, 1)
-	ebsSub, err := daemon.natsConn.Subscribe("ebs.node-1.unmount", func(msg *nats.Msg) {
+	ebsSub, err := daemon.natsConn.Subscribe(subjects.EBSUnmount("node-1"), func(msg *nats.Msg) {
 		var req types.EBSRequest
 		json.Unmarshal(msg.Data, &req)
 		ebsUnmountCalled <- req.Name
@@ -2586,7 +2869,7 @@ func TestDetachVolume_SuccessPath(t *testing.T) {
 	defer ebsSub.Unsubscribe()
 
 	sub, err := daemon.natsConn.Subscribe(
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		daemon.handleEC2Events,
 	)
 	require.NoError(t, err)
@@ -2604,7 +2887,7 @@ func TestDetachVolume_SuccessPath(t *testing.T) {
 	data, _ := json.Marshal(command)
 
 	resp, err := natsRequest(daemon.natsConn,
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		data,
 		10*time.Second,
 	)
@@ -2716,7 +2999,7 @@ func TestDetachVolume_ForceFlag(t *testing.T) {
 	daemon.Instances.VMS[instanceID] = instance
 
 	// Mock ebs.unmount
-	ebsSub, err := daemon.natsConn.Subscribe("ebs.node-1.unmount", func(msg *nats.Msg) {
+	ebsSub, err := daemon.natsConn.Subscribe(subjects.EBSUnmount("node-1"), func(msg *nats.Msg) {
 		resp := types.EBSUnMountResponse{Mounted: false}
 		data, _ := json.Marshal(resp)
 		msg.Respond(data)
@@ -2725,7 +3008,7 @@ func TestDetachVolume_ForceFlag(t *testing.T) {
 	defer ebsSub.Unsubscribe()
 
 	sub, err := daemon.natsConn.Subscribe(
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		daemon.handleEC2Events,
 	)
 	require.NoError(t, err)
@@ -2744,7 +3027,7 @@ func TestDetachVolume_ForceFlag(t *testing.T) {
 	data, _ := json.Marshal(command)
 
 	resp, err := natsRequest(daemon.natsConn,
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		data,
 		10*time.Second,
 	)
@@ -2830,7 +3113,7 @@ func TestDetachVolume_BlockdevDelFailure(t *testing.T) {
 	daemon.Instances.VMS[instanceID] = instance
 
 	sub, err := daemon.natsConn.Subscribe(
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		daemon.handleEC2Events,
 	)
 	require.NoError(t, err)
@@ -2848,12 +3131,14 @@ func TestDetachVolume_BlockdevDelFailure(t *testing.T) {
 	data, _ := json.Marshal(command)
 
 	resp, err := natsRequest(daemon.natsConn,
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		data,
 		10*time.Second,
 	)
 	require.NoError(t, err)
-	assert.Contains(t, string(resp.Data), "ServerInternal")
+	// A block node that stays busy is retryable, so it surfaces as IncorrectState
+	assert.Contains(t, string(resp.Data), "IncorrectState")
+	assert.Contains(t, string(resp.Data), "in use")
 
 	// Critical: EBSRequests must NOT be cleaned up (prevents double-attach)
 	instance.EBSRequests.Mu.Lock()
@@ -2921,7 +3206,7 @@ func TestDetachVolume_SuccessWithDeviceMatch(t *testing.T) {
 	}
 	daemon.Instances.VMS[instanceID] = instance
 
-	ebsSub, err := daemon.natsConn.Subscribe("ebs.node-1.unmount", func(msg *nats.Msg) {
+	ebsSub, err := daemon.natsConn.Subscribe(subjects.EBSUnmount("node-1"), func(msg *nats.Msg) {
 		resp := types.EBSUnMountResponse{Mounted: false}
 		data, _ := json.Marshal(resp)
 		msg.Respond(data)
@@ -2930,7 +3215,7 @@ func TestDetachVolume_SuccessWithDeviceMatch(t *testing.T) {
 	defer ebsSub.Unsubscribe()
 
 	sub, err := daemon.natsConn.Subscribe(
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		daemon.handleEC2Events,
 	)
 	require.NoError(t, err)
@@ -2949,7 +3234,7 @@ func TestDetachVolume_SuccessWithDeviceMatch(t *testing.T) {
 	data, _ := json.Marshal(command)
 
 	resp, err := natsRequest(daemon.natsConn,
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		data,
 		10*time.Second,
 	)
@@ -2998,7 +3283,7 @@ func TestAttachVolume_ReplacesStaleEBSRequest(t *testing.T) {
 	daemon.Instances.VMS[instanceID] = instance
 
 	// Mock ebs.mount to return success with a new NBDURI
-	ebsSub, err := daemon.natsConn.Subscribe("ebs.node-1.mount", func(msg *nats.Msg) {
+	ebsSub, err := daemon.natsConn.Subscribe(subjects.EBSMount("node-1"), func(msg *nats.Msg) {
 		resp := types.EBSMountResponse{URI: "nbd://new:2222"}
 		data, _ := json.Marshal(resp)
 		msg.Respond(data)
@@ -3007,7 +3292,7 @@ func TestAttachVolume_ReplacesStaleEBSRequest(t *testing.T) {
 	defer ebsSub.Unsubscribe()
 
 	sub, err := daemon.natsConn.Subscribe(
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		daemon.handleEC2Events,
 	)
 	require.NoError(t, err)
@@ -3026,7 +3311,7 @@ func TestAttachVolume_ReplacesStaleEBSRequest(t *testing.T) {
 	data, _ := json.Marshal(command)
 
 	resp, err := natsRequest(daemon.natsConn,
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		data,
 		10*time.Second,
 	)
@@ -3074,6 +3359,389 @@ func TestAttachVolume_ReplacesStaleEBSRequest(t *testing.T) {
 	assert.Equal(t, 1, count, "Should have exactly one EBSRequest for the volume, not a duplicate")
 }
 
+// TestAttachVolume_LocalBackend verifies that a volume whose type maps to the
+// local backend is opened by QEMU as a file, without an ebs.mount round-trip.
+func TestAttachVolume_LocalBackend(t *testing.T) {
+	daemon := createTestDaemon(t, sharedNATSURL)
+
+	instanceID := "i-test-local-attach"
+	volumeID := "vol-local-attach"
+
+	daemon.config.VolumeBackends = map[string]string{"gp3": config.VolumeBackendViperblock, "io2": config.VolumeBackendLocal}
+	daemon.config.LocalVolumes.Dir = t.TempDir()
+	require.NoError(t, os.WriteFile(daemon.config.LocalVolumePath(volumeID), nil, 0600))
+
+	store := objectstore.NewMemoryObjectStore()
+	daemon.volumeService = handlers_ec2_volume.NewVolumeServiceImplWithStore(daemon.config, store, daemon.natsConn)
+	volCfg := `{"VolumeConfig":{"VolumeMetadata":{"VolumeID":"` + volumeID + `","SizeGiB":1,"State":"available","VolumeType":"io2","TenantID":"` + testAccountID + `"}}}`
+	_, err := store.PutObject(&awss3.PutObjectInput{
+		Bucket: aws.String(daemon.config.Predastore.Bucket),
+		Key:    aws.String(volumeID + "/config.json"),
+		Body:   strings.NewReader(volCfg),
+	})
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var blockdevArgs map[string]any
+	qmpClient, cancelQMP := newMockQMPClient(t, func(cmd qmp.QMPCommand) map[string]any {
+		if cmd.Execute == "blockdev-add" {
+			mu.Lock()
+			blockdevArgs = cmd.Arguments
+			mu.Unlock()
+		}
+		return map[string]any{"return": map[string]any{}}
+	})
+	defer cancelQMP()
+
+	instance := &vm.VM{
+		ID:           instanceID,
+		InstanceType: getTestInstanceType(t),
+		Status:       vm.StateRunning,
+		AccountID:    testAccountID,
+		Instance:     &ec2.Instance{},
+		QMPClient:    qmpClient,
+	}
+	daemon.Instances.VMS[instanceID] = instance
+
+	var mounted atomic.Bool
+	ebsSub, err := daemon.natsConn.Subscribe(subjects.EBSMount("node-1"), func(msg *nats.Msg) {
+		mounted.Store(true)
+		data, _ := json.Marshal(types.EBSMountResponse{Error: "unexpected mount"})
+		msg.Respond(data)
+	})
+	require.NoError(t, err)
+	defer ebsSub.Unsubscribe()
+
+	sub, err := daemon.natsConn.Subscribe(subjects.InstanceCmd(instanceID), daemon.handleEC2Events)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	data, _ := json.Marshal(types.EC2InstanceCommand{
+		ID:               instanceID,
+		Attributes:       types.EC2CommandAttributes{AttachVolume: true},
+		AttachVolumeData: &types.AttachVolumeData{VolumeID: volumeID, Device: "/dev/sdf"},
+	})
+	resp, err := natsRequest(daemon.natsConn, subjects.InstanceCmd(instanceID), data, 30*time.Second)
+	require.NoError(t, err)
+
+	var attachment ec2.VolumeAttachment
+	require.NoError(t, json.Unmarshal(resp.Data, &attachment), string(resp.Data))
+	assert.Equal(t, "attached", aws.StringValue(attachment.State))
+	assert.False(t, mounted.Load(), "local volumes must not be sent to viperblockd")
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, "raw", blockdevArgs["driver"])
+	file, ok := blockdevArgs["file"].(map[string]any)
+	require.True(t, ok)
+	assert.Equal(t, daemon.config.LocalVolumePath(volumeID), file["filename"])
+
+	instance.EBSRequests.Mu.Lock()
+	defer instance.EBSRequests.Mu.Unlock()
+	require.Len(t, instance.EBSRequests.Requests, 1)
+	assert.Equal(t, config.VolumeBackendLocal, instance.EBSRequests.Requests[0].Backend)
+	assert.Equal(t, "io2", instance.EBSRequests.Requests[0].VolType)
+}
+
+// TestAttachVolume_CacheMode verifies that the volume's cache mode tag
+// reaches QEMU: the host cache in blockdev-add and the guest write cache in
+// device_add.
+func TestAttachVolume_CacheMode(t *testing.T) {
+	daemon := createTestDaemon(t, sharedNATSURL)
+
+	instanceID := "i-test-cache-mode"
+	volumeID := "vol-cache-mode"
+
+	store := objectstore.NewMemoryObjectStore()
+	daemon.volumeService = handlers_ec2_volume.NewVolumeServiceImplWithStore(daemon.config, store, daemon.natsConn)
+	volCfg := `{"VolumeConfig":{"VolumeMetadata":{"VolumeID":"` + volumeID + `","SizeGiB":1,"State":"available","VolumeType":"gp3","TenantID":"` + testAccountID + `","Tags":{"spinifex:cache-mode":"writethrough"}}}}`
+	_, err := store.PutObject(&awss3.PutObjectInput{
+		Bucket: aws.String(daemon.config.Predastore.Bucket),
+		Key:    aws.String(volumeID + "/config.json"),
+		Body:   strings.NewReader(volCfg),
+	})
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var blockdevArgs, deviceArgs map[string]any
+	qmpClient, cancelQMP := newMockQMPClient(t, func(cmd qmp.QMPCommand) map[string]any {
+		mu.Lock()
+		defer mu.Unlock()
+		switch cmd.Execute {
+		case "blockdev-add":
+			blockdevArgs = cmd.Arguments
+		case "device_add":
+			deviceArgs = cmd.Arguments
+		}
+		return map[string]any{"return": map[string]any{}}
+	})
+	defer cancelQMP()
+
+	instance := &vm.VM{
+		ID:           instanceID,
+		InstanceType: getTestInstanceType(t),
+		Status:       vm.StateRunning,
+		AccountID:    testAccountID,
+		Instance:     &ec2.Instance{},
+		QMPClient:    qmpClient,
+	}
+	daemon.Instances.VMS[instanceID] = instance
+
+	ebsSub, err := daemon.natsConn.Subscribe(subjects.EBSMount("node-1"), func(msg *nats.Msg) {
+		data, _ := json.Marshal(types.EBSMountResponse{URI: "nbd:unix:/run/vol-cache-mode.sock", Mounted: true})
+		msg.Respond(data)
+	})
+	require.NoError(t, err)
+	defer ebsSub.Unsubscribe()
+
+	sub, err := daemon.natsConn.Subscribe(subjects.InstanceCmd(instanceID), daemon.handleEC2Events)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	data, _ := json.Marshal(types.EC2InstanceCommand{
+		ID:               instanceID,
+		Attributes:       types.EC2CommandAttributes{AttachVolume: true},
+		AttachVolumeData: &types.AttachVolumeData{VolumeID: volumeID, Device: "/dev/sdf"},
+	})
+	resp, err := natsRequest(daemon.natsConn, subjects.InstanceCmd(instanceID), data, 30*time.Second)
+	require.NoError(t, err)
+
+	var attachment ec2.VolumeAttachment
+	require.NoError(t, json.Unmarshal(resp.Data, &attachment), string(resp.Data))
+	assert.Equal(t, "attached", aws.StringValue(attachment.State))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, "nbd", blockdevArgs["driver"])
+	assert.Equal(t, map[string]any{"direct": false, "no-flush": false}, blockdevArgs["cache"])
+	assert.Equal(t, "off", deviceArgs["write-cache"])
+
+	instance.EBSRequests.Mu.Lock()
+	defer instance.EBSRequests.Mu.Unlock()
+	require.Len(t, instance.EBSRequests.Requests, 1)
+	assert.Equal(t, "writethrough", instance.EBSRequests.Requests[0].CacheMode)
+}
+
+// TestAttachVolume_Trim verifies that a trim-enabled volume is attached
+// with discard passed through and zero writes unmapped, and that a volume
+// tagged off is not.
+func TestAttachVolume_Trim(t *testing.T) {
+	daemon := createTestDaemon(t, sharedNATSURL)
+
+	store := objectstore.NewMemoryObjectStore()
+	daemon.volumeService = handlers_ec2_volume.NewVolumeServiceImplWithStore(daemon.config, store, daemon.natsConn)
+
+	var mu sync.Mutex
+	blockdevArgs := make(map[string]map[string]any)
+	qmpClient, cancelQMP := newMockQMPClient(t, func(cmd qmp.QMPCommand) map[string]any {
+		mu.Lock()
+		defer mu.Unlock()
+		if cmd.Execute == "blockdev-add" {
+			blockdevArgs[cmd.Arguments["node-name"].(string)] = cmd.Arguments
+		}
+		return map[string]any{"return": map[string]any{}}
+	})
+	defer cancelQMP()
+
+	instanceID := "i-test-trim"
+	instance := &vm.VM{
+		ID:           instanceID,
+		InstanceType: getTestInstanceType(t),
+		Status:       vm.StateRunning,
+		AccountID:    testAccountID,
+		Instance:     &ec2.Instance{},
+		QMPClient:    qmpClient,
+	}
+	daemon.Instances.VMS[instanceID] = instance
+
+	ebsSub, err := daemon.natsConn.Subscribe(subjects.EBSMount("node-1"), func(msg *nats.Msg) {
+		data, _ := json.Marshal(types.EBSMountResponse{URI: "nbd:unix:/run/vol-trim.sock", Mounted: true})
+		msg.Respond(data)
+	})
+	require.NoError(t, err)
+	defer ebsSub.Unsubscribe()
+
+	sub, err := daemon.natsConn.Subscribe(subjects.InstanceCmd(instanceID), daemon.handleEC2Events)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	attach := func(volumeID, tags, device string) {
+		t.Helper()
+		volCfg := `{"VolumeConfig":{"VolumeMetadata":{"VolumeID":"` + volumeID + `","SizeGiB":1,"State":"available","VolumeType":"gp3","TenantID":"` + testAccountID + `","Tags":{` + tags + `}}}}`
+		_, err := store.PutObject(&awss3.PutObjectInput{
+			Bucket: aws.String(daemon.config.Predastore.Bucket),
+			Key:    aws.String(volumeID + "/config.json"),
+			Body:   strings.NewReader(volCfg),
+		})
+		require.NoError(t, err)
+
+		data, _ := json.Marshal(types.EC2InstanceCommand{
+			ID:               instanceID,
+			Attributes:       types.EC2CommandAttributes{AttachVolume: true},
+			AttachVolumeData: &types.AttachVolumeData{VolumeID: volumeID, Device: device},
+		})
+		resp, err := natsRequest(daemon.natsConn, subjects.InstanceCmd(instanceID), data, 30*time.Second)
+		require.NoError(t, err)
+		var attachment ec2.VolumeAttachment
+		require.NoError(t, json.Unmarshal(resp.Data, &attachment), string(resp.Data))
+		assert.Equal(t, "attached", aws.StringValue(attachment.State))
+	}
+
+	// gp3 has trim by default; the tag turns it off.
+	attach("vol-trim-default", ``, "/dev/sdf")
+	attach("vol-trim-off", `"spinifex:trim":"off"`, "/dev/sdg")
+
+	mu.Lock()
+	defer mu.Unlock()
+	on := blockdevArgs["nbd-vol-trim-default"]
+	require.NotNil(t, on)
+	assert.Equal(t, "unmap", on["discard"])
+	assert.Equal(t, "unmap", on["detect-zeroes"])
+	off := blockdevArgs["nbd-vol-trim-off"]
+	require.NotNil(t, off)
+	assert.NotContains(t, off, "discard")
+	assert.NotContains(t, off, "detect-zeroes")
+
+	instance.EBSRequests.Mu.Lock()
+	defer instance.EBSRequests.Mu.Unlock()
+	require.Len(t, instance.EBSRequests.Requests, 2)
+	assert.True(t, instance.EBSRequests.Requests[0].Trim)
+	assert.False(t, instance.EBSRequests.Requests[1].Trim)
+}
+
+// TestVolumeLockOrdering_ConcurrentAttachDetachStop runs attach/detach cycles,
+// a stop, and state writes at the same time so that -race and the deadlock
+// timeout catch any path taking Instances.Mu and EBSRequests.Mu out of order.
+func TestVolumeLockOrdering_ConcurrentAttachDetachStop(t *testing.T) {
+	ns, _, _ := testutil.StartTestJetStream(t)
+	daemon := createTestDaemon(t, ns.ClientURL())
+
+	var err error
+	daemon.jsManager, err = NewJetStreamManager(daemon.natsConn, 1)
+	require.NoError(t, err)
+	require.NoError(t, daemon.jsManager.InitKVBucket())
+
+	daemon.config.VolumeBackends = map[string]string{"gp3": config.VolumeBackendViperblock, "io2": config.VolumeBackendLocal}
+	daemon.config.LocalVolumes.Dir = t.TempDir()
+	store := objectstore.NewMemoryObjectStore()
+	daemon.volumeService = handlers_ec2_volume.NewVolumeServiceImplWithStore(daemon.config, store, daemon.natsConn)
+
+	const volumes = 4
+	for i := range volumes {
+		volumeID := fmt.Sprintf("vol-lock-order-%d", i)
+		require.NoError(t, os.WriteFile(daemon.config.LocalVolumePath(volumeID), nil, 0600))
+		volCfg := `{"VolumeConfig":{"VolumeMetadata":{"VolumeID":"` + volumeID + `","SizeGiB":1,"State":"available","VolumeType":"io2","TenantID":"` + testAccountID + `"}}}`
+		_, err := store.PutObject(&awss3.PutObjectInput{
+			Bucket: aws.String(daemon.config.Predastore.Bucket),
+			Key:    aws.String(volumeID + "/config.json"),
+			Body:   strings.NewReader(volCfg),
+		})
+		require.NoError(t, err)
+	}
+
+	mountSub, err := daemon.natsConn.Subscribe(subjects.EBSMount("node-1"), func(msg *nats.Msg) {
+		data, _ := json.Marshal(types.EBSMountResponse{URI: "nbd:unix:/tmp/lock-order.sock"})
+		msg.Respond(data)
+	})
+	require.NoError(t, err)
+	defer mountSub.Unsubscribe()
+	unmountSub, err := daemon.natsConn.Subscribe(subjects.EBSUnmount("node-1"), func(msg *nats.Msg) {
+		data, _ := json.Marshal(types.EBSUnMountResponse{Mounted: false})
+		msg.Respond(data)
+	})
+	require.NoError(t, err)
+	defer unmountSub.Unsubscribe()
+
+	qmpClient, cancelQMP := newMockQMPClient(t, nil)
+	defer cancelQMP()
+
+	attached := &vm.VM{
+		ID:        "i-test-lock-order",
+		Status:    vm.StateRunning,
+		AccountID: testAccountID,
+		Instance:  &ec2.Instance{},
+		QMPClient: qmpClient,
+	}
+	stopping := &vm.VM{
+		ID:        "i-test-lock-order-stop",
+		Status:    vm.StateRunning,
+		AccountID: testAccountID,
+		QMPClient: &qmp.QMPClient{},
+		EBSRequests: types.EBSRequests{
+			Requests: []types.EBSRequest{{Name: "vol-lock-order-root", Boot: true}},
+		},
+	}
+	daemon.Instances.UpsertVM(attached)
+	daemon.Instances.UpsertVM(stopping)
+
+	newMsg := func() *nats.Msg {
+		msg := nats.NewMsg("")
+		msg.Header.Set(utils.AccountIDHeader, testAccountID)
+		return msg
+	}
+
+	var wg sync.WaitGroup
+	for i := range volumes {
+		volumeID := fmt.Sprintf("vol-lock-order-%d", i)
+		wg.Go(func() {
+			for range 3 {
+				daemon.handleAttachVolume(newMsg(), types.EC2InstanceCommand{
+					ID:               attached.ID,
+					AttachVolumeData: &types.AttachVolumeData{VolumeID: volumeID},
+				}, attached)
+				daemon.handleDetachVolume(newMsg(), types.EC2InstanceCommand{
+					ID:               attached.ID,
+					DetachVolumeData: &types.DetachVolumeData{VolumeID: volumeID},
+				}, attached)
+			}
+		})
+	}
+	wg.Go(func() {
+		assert.NoError(t, daemon.MountVolumes(stopping))
+		_ = daemon.stopInstance([]*vm.VM{stopping}, false)
+	})
+	wg.Go(func() {
+		for range 20 {
+			_ = daemon.WriteState()
+			daemon.Instances.ListVMs()
+		}
+	})
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(60 * time.Second):
+		t.Fatal("attach/detach/stop did not finish; likely lock-order deadlock")
+	}
+
+	daemon.Instances.WithVolumes(attached, func(reqs *types.EBSRequests) {
+		assert.Empty(t, reqs.Requests, "every attach was followed by a detach")
+		assert.Empty(t, attached.Instance.BlockDeviceMappings)
+	})
+}
+
+func TestRootVolumeTypeError(t *testing.T) {
+	cfg := &config.Config{
+		VolumeBackends: map[string]string{"gp3": config.VolumeBackendViperblock, "io2": config.VolumeBackendLocal},
+		LocalVolumes:   config.LocalVolumeConfig{Dir: "/mnt/nvme"},
+	}
+	withRootType := func(volumeType string) *ec2.RunInstancesInput {
+		return &ec2.RunInstancesInput{BlockDeviceMappings: []*ec2.BlockDeviceMapping{
+			{DeviceName: aws.String("/dev/xvda"), Ebs: &ec2.EbsBlockDevice{VolumeType: aws.String(volumeType)}},
+		}}
+	}
+
+	assert.Empty(t, rootVolumeTypeError(cfg, &ec2.RunInstancesInput{}))
+	assert.Empty(t, rootVolumeTypeError(cfg, withRootType("gp3")))
+	assert.Equal(t, awserrors.ErrorVolumeTypeNotAvailableInZone, rootVolumeTypeError(cfg, withRootType("io2")))
+	assert.Equal(t, awserrors.ErrorVolumeTypeNotAvailableInZone, rootVolumeTypeError(cfg, withRootType("st1")))
+	assert.Equal(t, awserrors.ErrorInvalidParameterValue, rootVolumeTypeError(cfg, withRootType("gp9")))
+}
+
 // --- computeConfigHash ---
 
 func TestComputeConfigHash_Deterministic(t *testing.T) {
@@ -3226,6 +3894,42 @@ func TestGetAvailableInstanceTypeInfos_ShowCapacity(t *testing.T) {
 	assert.Len(t, infos, 1)
 }
 
+func TestGetAvailableInstanceTypeInfos_Cache(t *testing.T) {
+	micro := &ec2.InstanceTypeInfo{
+		InstanceType: aws.String("t3.micro"),
+		VCpuInfo:     &ec2.VCpuInfo{DefaultVCpus: aws.Int64(2)},
+		MemoryInfo:   &ec2.MemoryInfo{SizeInMiB: aws.Int64(1024)},
+	}
+	clock := testutil.NewFakeClock(time.Date(2026, 3, 4, 5, 0, 0, 0, time.UTC))
+	t.Cleanup(utils.SetClock(clock))
+	rm := &ResourceManager{
+		hostVCPU:      2,
+		hostMemGB:     4.0,
+		instanceTypes: map[string]*ec2.InstanceTypeInfo{"t3.micro": micro},
+	}
+
+	require.Len(t, rm.GetAvailableInstanceTypeInfos(false), 1)
+
+	// Within the TTL the cached list is served even though capacity
+	// changed behind the resource manager's back.
+	rm.allocatedVCPU = 2
+	assert.Len(t, rm.GetAvailableInstanceTypeInfos(false), 1, "cache hit within TTL")
+	assert.Empty(t, rm.GetAvailableInstanceTypeInfos(true), "capacity view is always live")
+
+	clock.Advance(availableTypesTTL)
+	assert.Empty(t, rm.GetAvailableInstanceTypeInfos(false), "cache expires after TTL")
+
+	rm.deallocate(micro)
+	assert.Len(t, rm.GetAvailableInstanceTypeInfos(false), 1, "invalidated after an allocation")
+
+	// A change to the instance types or reserve needs an explicit
+	// invalidation.
+	rm.reservedVCPU = 2
+	assert.Len(t, rm.GetAvailableInstanceTypeInfos(false), 1)
+	rm.invalidateAvailableTypes()
+	assert.Empty(t, rm.GetAvailableInstanceTypeInfos(false))
+}
+
 // --- NewDaemon ---
 
 func TestNewDaemon_WalDirDefaultsToBaseDir(t *testing.T) {
@@ -3331,7 +4035,7 @@ func TestRollbackEBSMount_Success(t *testing.T) {
 	unmountCalled := make(chan string, 1)
 
 	// Mock ebs.unmount subscriber that returns success
-	sub, err := daemon.natsConn.Subscribe("ebs.node-1.unmount", func(msg *nats.Msg) {
+	sub, err := daemon.natsConn.Subscribe(subjects.EBSUnmount("node-1"), func(msg *nats.Msg) {
 		var req types.EBSRequest
 		json.Unmarshal(msg.Data, &req)
 		unmountCalled <- req.Name
@@ -3365,7 +4069,7 @@ func TestRollbackEBSMount_UnmountError(t *testing.T) {
 	daemon := createTestDaemon(t, natsURL)
 
 	// Mock ebs.unmount subscriber that returns an error
-	sub, err := daemon.natsConn.Subscribe("ebs.node-1.unmount", func(msg *nats.Msg) {
+	sub, err := daemon.natsConn.Subscribe(subjects.EBSUnmount("node-1"), func(msg *nats.Msg) {
 		resp := types.EBSUnMountResponse{Error: "unmount failed: device busy"}
 		data, _ := json.Marshal(resp)
 		msg.Respond(data)
@@ -3386,7 +4090,7 @@ func TestRollbackEBSMount_StillMounted(t *testing.T) {
 
 	daemon := createTestDaemon(t, natsURL)
 
-	sub, err := daemon.natsConn.Subscribe("ebs.node-1.unmount", func(msg *nats.Msg) {
+	sub, err := daemon.natsConn.Subscribe(subjects.EBSUnmount("node-1"), func(msg *nats.Msg) {
 		resp := types.EBSUnMountResponse{Mounted: true} // still mounted
 		data, _ := json.Marshal(resp)
 		msg.Respond(data)
@@ -3466,7 +4170,7 @@ func TestStopTerminate_IncorrectInstanceState(t *testing.T) {
 	daemon.Instances.VMS[instanceID] = instance
 
 	sub, err := daemon.natsConn.Subscribe(
-		fmt.Sprintf("ec2.cmd.%s", instanceID),
+		subjects.InstanceCmd(instanceID),
 		daemon.handleEC2Events,
 	)
 	require.NoError(t, err)
@@ -3486,7 +4190,7 @@ func TestStopTerminate_IncorrectInstanceState(t *testing.T) {
 		data, _ := json.Marshal(command)
 
 		resp, err := natsRequest(daemon.natsConn,
-			fmt.Sprintf("ec2.cmd.%s", instanceID),
+			subjects.InstanceCmd(instanceID),
 			data,
 			5*time.Second,
 		)
@@ -3509,7 +4213,7 @@ func TestStopTerminate_IncorrectInstanceState(t *testing.T) {
 		data, _ := json.Marshal(command)
 
 		resp, err := natsRequest(daemon.natsConn,
-			fmt.Sprintf("ec2.cmd.%s", instanceID),
+			subjects.InstanceCmd(instanceID),
 			data,
 			5*time.Second,
 		)
@@ -3985,7 +4689,7 @@ func TestBuildDrives(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			drives, iothreads, devices, err := buildDrives(tt.requests, tt.cpuCount)
+			drives, iothreads, devices, err := buildDrives(tt.requests, tt.cpuCount, nil)
 
 			if tt.wantErr != "" {
 				require.Error(t, err)
@@ -4006,7 +4710,7 @@ func TestBuildDrives_BootVolume(t *testing.T) {
 		{Name: "vol-boot", NBDURI: "nbd:unix:/tmp/boot.sock", Boot: true},
 	}
 
-	drives, iothreads, devices, err := buildDrives(requests, 4)
+	drives, iothreads, devices, err := buildDrives(requests, 4, nil)
 	require.NoError(t, err)
 
 	require.Len(t, drives, 1)
@@ -4030,7 +4734,7 @@ func TestBuildDrives_CloudInitVolume(t *testing.T) {
 		{Name: "vol-ci", NBDURI: "nbd:unix:/tmp/ci.sock", CloudInit: true},
 	}
 
-	drives, _, _, err := buildDrives(requests, 2)
+	drives, _, _, err := buildDrives(requests, 2, nil)
 	require.NoError(t, err)
 
 	require.Len(t, drives, 1)
@@ -4042,6 +4746,54 @@ func TestBuildDrives_CloudInitVolume(t *testing.T) {
 	assert.Equal(t, "cloudinit", d.ID)
 }
 
+func TestBuildDrives_CacheMode(t *testing.T) {
+	requests := []types.EBSRequest{
+		{Name: "vol-boot", NBDURI: "nbd:unix:/tmp/boot.sock", Boot: true},
+		{Name: "vol-data", NBDURI: "nbd:unix:/tmp/data.sock", CacheMode: "writeback"},
+		{Name: "vol-old", NBDURI: "nbd:unix:/tmp/old.sock"},
+	}
+
+	drives, _, _, err := buildDrives(requests, 2, nil)
+	require.NoError(t, err)
+
+	require.Len(t, drives, 3)
+	assert.Equal(t, "none", drives[0].Cache)
+	assert.Equal(t, "writeback", drives[1].Cache, "attached volumes keep their cache mode across restarts")
+	assert.Empty(t, drives[2].Cache)
+}
+
+func TestBuildDrives_Trim(t *testing.T) {
+	requests := []types.EBSRequest{
+		{Name: "vol-boot", NBDURI: "nbd:unix:/tmp/boot.sock", Boot: true, Trim: true},
+		{Name: "vol-data", NBDURI: "nbd:unix:/tmp/data.sock"},
+		{Name: "cloudinit", NBDURI: "nbd:unix:/tmp/ci.sock", CloudInit: true, Trim: true},
+	}
+
+	drives, _, _, err := buildDrives(requests, 2, nil)
+	require.NoError(t, err)
+
+	require.Len(t, drives, 3)
+	assert.True(t, drives[0].Discard)
+	assert.False(t, drives[1].Discard)
+	assert.False(t, drives[2].Discard, "the cloud-init cdrom is read-only")
+}
+
+func TestBuildDrives_LocalVolume(t *testing.T) {
+	cfg := &config.Config{LocalVolumes: config.LocalVolumeConfig{Dir: "/var/lib/spinifex/local"}}
+	requests := []types.EBSRequest{
+		{Name: "vol-boot", NBDURI: "nbd:unix:/tmp/boot.sock", Boot: true},
+		// Local volumes are never mounted, so have no NBDURI to restart with.
+		{Name: "vol-local", Backend: config.VolumeBackendLocal, DeviceName: "/dev/sdf"},
+	}
+
+	drives, _, _, err := buildDrives(requests, 2, cfg.LocalVolumePath)
+	require.NoError(t, err)
+
+	require.Len(t, drives, 2)
+	assert.Equal(t, "/var/lib/spinifex/local/vol-local.raw", drives[1].File)
+	assert.Equal(t, "raw", drives[1].Format)
+}
+
 // --- ClusterManager TLS ---
 
 func TestClusterManager_TLSServesHTTPS(t *testing.T) {
@@ -4175,3 +4927,23 @@ func generateTestCert(t *testing.T) (certPEM, keyPEM []byte) {
 
 	return certBuf.Bytes(), keyBuf.Bytes()
 }
+
+func TestSubscribeAll_SubjectPrefix(t *testing.T) {
+	daemon := createTestDaemon(t, sharedNATSURL)
+	t.Cleanup(func() { utils.SetSubjectPrefix("") })
+
+	daemon.natsConn.Close()
+	daemon.config.NATS.SubjectPrefix = "tenant-a"
+	require.NoError(t, daemon.connectNATS())
+	require.NoError(t, daemon.subscribeAll())
+
+	assert.Equal(t, "tenant-a.ec2.DescribeKeyPairs", daemon.natsSubscriptions["ec2.DescribeKeyPairs"].Subject)
+	assert.Equal(t, "tenant-a.ec2.CreateImage", daemon.natsSubscriptions["ec2.CreateImage"].Subject)
+	assert.Equal(t, "tenant-a.ebs.node-1.unmount", utils.Subject(subjects.EBSUnmount(daemon.node)))
+
+	// The unprefixed subject belongs to another deployment.
+	_, err := daemon.natsConn.Request("ec2.DescribeVolumes", []byte(`{}`), 200*time.Millisecond)
+	assert.ErrorIs(t, err, nats.ErrNoResponders)
+	_, err = daemon.natsConn.Request("tenant-a.ec2.DescribeVolumes", []byte(`{}`), 5*time.Second)
+	assert.NoError(t, err)
+}
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/mulgadc/spinifex/spinifex/config"
+	handlers_ec2_instance "github.com/mulgadc/spinifex/spinifex/handlers/ec2/instance"
 	handlers_elbv2 "github.com/mulgadc/spinifex/spinifex/handlers/elbv2"
 	"github.com/mulgadc/spinifex/spinifex/testutil"
 	"github.com/stretchr/testify/assert"
@@ -21,8 +22,9 @@ func newWireLBTestDaemon(t *testing.T, cfg *config.Config) *Daemon {
 	t.Cleanup(func() { svc.Close() })
 
 	return &Daemon{
-		config:       cfg,
-		elbv2Service: svc,
+		config:          cfg,
+		elbv2Service:    svc,
+		instanceService: &handlers_ec2_instance.InstanceServiceImpl{},
 	}
 }
 
@@ -63,6 +65,23 @@ func TestWireLBAgentConfig_GatewayURL_MultiNode(t *testing.T) {
 	d.wireLBAgentConfig()
 
 	assert.Equal(t, "192.168.1.10", d.mgmtRouteVia)
+	assert.Empty(t, d.instanceService.PhoneHomeURL, "customer instances cannot reach a mgmt-only gateway")
+}
+
+func TestWireLBAgentConfig_PhoneHomeViaMetadata(t *testing.T) {
+	// Multi-node with a mgmt-only gateway: guests phone home to the
+	// node's metadata service instead.
+	cfg := &config.Config{
+		AWSGW:  config.AWSGWConfig{Host: "192.168.1.10:9999"},
+		Daemon: config.DaemonConfig{IMDSListen: "169.254.169.254:80"},
+	}
+	d := newWireLBTestDaemon(t, cfg)
+	d.mgmtBridgeIP = "10.15.8.1"
+
+	d.wireLBAgentConfig()
+
+	assert.Equal(t, "192.168.1.10", d.mgmtRouteVia)
+	assert.Equal(t, "http://169.254.169.254/phone-home", d.instanceService.PhoneHomeURL)
 }
 
 func TestWireLBAgentConfig_GatewayURL_SingleNode(t *testing.T) {
@@ -76,6 +95,7 @@ func TestWireLBAgentConfig_GatewayURL_SingleNode(t *testing.T) {
 	d.wireLBAgentConfig()
 
 	assert.Empty(t, d.mgmtRouteVia)
+	assert.Equal(t, "https://10.15.8.1:9999/phone-home", d.instanceService.PhoneHomeURL)
 }
 
 func TestWireLBAgentConfig_GatewayURL_MgmtNoAWSGW(t *testing.T) {
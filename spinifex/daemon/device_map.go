@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/mulgadc/spinifex/spinifex/qmp"
+	"github.com/mulgadc/spinifex/spinifex/types"
 	"github.com/mulgadc/spinifex/spinifex/vm"
 )
 
@@ -156,29 +157,27 @@ func (d *Daemon) updateGuestDeviceNames(instance *vm.VM) {
 		return
 	}
 
-	// Build volume ID → guest device path mapping from EBSRequests.
-	// Collect under EBSRequests lock, then release before acquiring Instances lock
-	// to maintain consistent lock ordering.
-	instance.EBSRequests.Mu.Lock()
-	volToGuest := make(map[string]string, len(instance.EBSRequests.Requests))
-	for _, req := range instance.EBSRequests.Requests {
-		var qemuID string
-		if req.Boot {
-			qemuID = "os"
-		} else if req.CloudInit {
-			qemuID = "cloudinit"
-		} else {
-			qemuID = fmt.Sprintf("vdisk-%s", req.Name)
-		}
-		if gd, ok := deviceMap[qemuID]; ok {
-			volToGuest[req.Name] = gd
+	// Map volume ID → guest device path from EBSRequests, then rewrite
+	// BlockDeviceMappings with it under the same lock hold.
+	d.Instances.WithVolumes(instance, func(reqs *types.EBSRequests) {
+		volToGuest := make(map[string]string, len(reqs.Requests))
+		for _, req := range reqs.Requests {
+			var qemuID string
+			if req.Boot {
+				qemuID = "os"
+			} else if req.CloudInit {
+				qemuID = "cloudinit"
+			} else {
+				qemuID = fmt.Sprintf("vdisk-%s", req.Name)
+			}
+			if gd, ok := deviceMap[qemuID]; ok {
+				volToGuest[req.Name] = gd
+			}
 		}
-	}
-	instance.EBSRequests.Mu.Unlock()
 
-	// Update BlockDeviceMappings using the mapping
-	d.Instances.Mu.Lock()
-	if instance.Instance != nil {
+		if instance.Instance == nil {
+			return
+		}
 		for _, bdm := range instance.Instance.BlockDeviceMappings {
 			if bdm.Ebs == nil || bdm.Ebs.VolumeId == nil || bdm.DeviceName == nil {
 				continue
@@ -187,8 +186,7 @@ func (d *Daemon) updateGuestDeviceNames(instance *vm.VM) {
 				bdm.DeviceName = &gd
 			}
 		}
-	}
-	d.Instances.Mu.Unlock()
+	})
 
 	if err := d.WriteState(); err != nil {
 		slog.Error("Failed to persist state after guest device name update", "instanceId", instance.ID, "err", err)
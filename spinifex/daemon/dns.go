@@ -0,0 +1,41 @@
+package daemon
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+)
+
+// vpcDNSRecordEvent snapshots the VPC-internal DNS records for instance, or
+// returns false when it isn't a VPC instance with an address.
+func (d *Daemon) vpcDNSRecordEvent(instance *vm.VM) (types.DNSRecordEvent, bool) {
+	d.Instances.Mu.Lock()
+	defer d.Instances.Mu.Unlock()
+	if instance.Hostname == "" || instance.Instance == nil {
+		return types.DNSRecordEvent{}, false
+	}
+	evt := types.DNSRecordEvent{
+		InstanceID: instance.ID,
+		AccountID:  instance.AccountID,
+		VpcId:      aws.StringValue(instance.Instance.VpcId),
+		Hostname:   instance.Hostname,
+		FQDN:       instance.FQDN,
+		PrivateIP:  aws.StringValue(instance.Instance.PrivateIpAddress),
+	}
+	if evt.VpcId == "" || evt.PrivateIP == "" {
+		return types.DNSRecordEvent{}, false
+	}
+	return evt, true
+}
+
+// registerDNS publishes the instance's hostname and FQDN to its VPC's
+// internal DNS. Registration is an upsert, so it is repeated on every start;
+// the records are kept while the instance is stopped, as EC2 keeps private
+// DNS names across stop/start. vpcd drops them with the instance's network
+// interface.
+func (d *Daemon) registerDNS(instance *vm.VM) {
+	if evt, ok := d.vpcDNSRecordEvent(instance); ok {
+		utils.PublishEvent(d.natsConn, "vpc.dns-register", evt)
+	}
+}
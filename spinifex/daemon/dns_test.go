@@ -0,0 +1,122 @@
+package daemon
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDNSRegistration_Lifecycle(t *testing.T) {
+	daemon := createDaemonWithJetStream(t)
+	daemon.config.Daemon.DNSZone = "compute.internal."
+
+	events := make(chan types.DNSRecordEvent, 10)
+	sub, err := daemon.natsConn.Subscribe("vpc.dns-register", func(msg *nats.Msg) {
+		var evt types.DNSRecordEvent
+		_ = json.Unmarshal(msg.Data, &evt)
+		events <- evt
+	})
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	// The FQDN is formed at launch from the guest hostname and the zone.
+	fqdn := daemon.config.Daemon.FQDN("ip-10-0-0-5")
+	require.Equal(t, "ip-10-0-0-5.compute.internal", fqdn)
+
+	instance := &vm.VM{
+		ID:        "i-dns-lifecycle",
+		Status:    vm.StatePending,
+		AccountID: testAccountID,
+		Hostname:  "ip-10-0-0-5",
+		FQDN:      fqdn,
+		Instance:  &ec2.Instance{VpcId: aws.String("vpc-dns"), PrivateIpAddress: aws.String("10.0.0.5")},
+	}
+	daemon.Instances.UpsertVM(instance)
+
+	want := types.DNSRecordEvent{
+		InstanceID: instance.ID, AccountID: testAccountID, VpcId: "vpc-dns", Hostname: "ip-10-0-0-5", FQDN: fqdn, PrivateIP: "10.0.0.5",
+	}
+	expect := func() {
+		t.Helper()
+		select {
+		case evt := <-events:
+			assert.Equal(t, want, evt)
+		case <-time.After(2 * time.Second):
+			t.Fatal("no vpc.dns-register event")
+		}
+	}
+	expectNone := func() {
+		t.Helper()
+		require.NoError(t, daemon.natsConn.Flush())
+		select {
+		case evt := <-events:
+			t.Fatalf("unexpected vpc.dns-register event for %s", evt.InstanceID)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	require.NoError(t, daemon.TransitionState(instance, vm.StateRunning))
+	expect()
+
+	// The records survive stop and are re-registered on start.
+	require.NoError(t, daemon.TransitionState(instance, vm.StateStopping))
+	require.NoError(t, daemon.TransitionState(instance, vm.StateStopped))
+	expectNone()
+	require.NoError(t, daemon.TransitionState(instance, vm.StateRunning))
+	expect()
+
+	// vpcd drops them with the network interface, not on an event.
+	require.NoError(t, daemon.TransitionState(instance, vm.StateShuttingDown))
+	require.NoError(t, daemon.TransitionState(instance, vm.StateTerminated))
+	expectNone()
+}
+
+func TestVPCDNSRegistration(t *testing.T) {
+	daemon := createDaemonWithJetStream(t)
+
+	events := make(chan types.DNSRecordEvent, 10)
+	sub, err := daemon.natsConn.Subscribe("vpc.dns-register", func(msg *nats.Msg) {
+		var evt types.DNSRecordEvent
+		_ = json.Unmarshal(msg.Data, &evt)
+		events <- evt
+	})
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	instance := &vm.VM{
+		ID:        "i-dns-vpc",
+		Status:    vm.StatePending,
+		AccountID: testAccountID,
+		Hostname:  "web-1",
+		Instance:  &ec2.Instance{VpcId: aws.String("vpc-dns"), PrivateIpAddress: aws.String("10.0.1.7")},
+	}
+	// Without a VPC there is no internal DNS to register with.
+	classic := &vm.VM{ID: "i-dns-classic", Status: vm.StatePending, Hostname: "classic", Instance: &ec2.Instance{}}
+	daemon.Instances.UpsertVM(instance)
+	daemon.Instances.UpsertVM(classic)
+
+	require.NoError(t, daemon.TransitionState(classic, vm.StateRunning))
+	require.NoError(t, daemon.TransitionState(instance, vm.StateRunning))
+	select {
+	case evt := <-events:
+		assert.Equal(t, types.DNSRecordEvent{
+			InstanceID: instance.ID, AccountID: testAccountID, VpcId: "vpc-dns", Hostname: "web-1", PrivateIP: "10.0.1.7",
+		}, evt)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no vpc.dns-register event")
+	}
+	require.NoError(t, daemon.natsConn.Flush())
+	select {
+	case evt := <-events:
+		t.Fatalf("unexpected vpc.dns-register event for %s", evt.InstanceID)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,199 @@
+package daemon
+
+import (
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	handlers_ec2_volume "github.com/mulgadc/spinifex/spinifex/handlers/ec2/volume"
+	"github.com/mulgadc/spinifex/spinifex/qmp"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+)
+
+// ebsThrottleGroupID is the QEMU throttle group shared by an instance's EBS
+// volumes.
+const ebsThrottleGroupID = "ebs-throttle"
+
+// ebsBurstSeconds is how long volumes may run at the instance's maximum EBS
+// throughput before falling back to the sustained rate, matching the 30
+// minute burst window AWS gives smaller EBS-optimized instances.
+const ebsBurstSeconds = 1800
+
+// volumeBaselineMBps is the baseline throughput each volume type adds to the
+// instance's sustained EBS rate. Untyped volumes predate VolType and are
+// treated as gp3, the default.
+var volumeBaselineMBps = map[string]float64{
+	"":         125,
+	"gp3":      125,
+	"gp2":      128,
+	"io1":      500,
+	"io2":      500,
+	"st1":      40,
+	"sc1":      12,
+	"standard": 40,
+}
+
+// volumeBaselineIOPS is the baseline operations/s each volume type adds to
+// the instance's sustained EBS IOPS, as volumeBaselineMBps does for
+// throughput.
+var volumeBaselineIOPS = map[string]int64{
+	"":         3000,
+	"gp3":      3000,
+	"gp2":      100,
+	"io1":      3000,
+	"io2":      3000,
+	"st1":      500,
+	"sc1":      250,
+	"standard": 100,
+}
+
+// provisionsIOPS reports whether volumes of volType have provisioned IOPS.
+// Untyped volumes are gp3, as in volumeBaselineIOPS.
+func provisionsIOPS(volType string) bool {
+	if volType == "" {
+		volType = "gp3"
+	}
+	return handlers_ec2_volume.ProvisionsIOPS(volType)
+}
+
+// ebsThrottleGroup computes the throttle group for an instance's volumes.
+// Volumes with provisioned IOPS or throughput count those instead of their
+// type's baseline, throughput in MiB/s being taken as MB/s like the gp3
+// baseline. The volumes' combined baselines set the sustained rate, raised to the
+// type's EBS-optimized baseline (or floorMBps when set) so the volumes
+// collectively always get at least that, and capped at the type's maximum.
+// Bursts are capped at the type's maximum throughput. IOPS are limited the
+// same way when the type reports them, without a configurable floor. It
+// returns nil when the type isn't EBS-optimized or there are no volumes to
+// throttle.
+func ebsThrottleGroup(info *ec2.InstanceTypeInfo, floorMBps float64, requests []types.EBSRequest) *vm.ThrottleGroup {
+	if info == nil || info.EbsInfo == nil || info.EbsInfo.EbsOptimizedInfo == nil {
+		return nil
+	}
+	ebs := info.EbsInfo.EbsOptimizedInfo
+
+	var sumMBps float64
+	var sumIOPS int64
+	volumes := 0
+	for _, req := range requests {
+		if req.EFI || req.CloudInit {
+			continue
+		}
+		baseline, ok := volumeBaselineMBps[req.VolType]
+		if !ok {
+			baseline = volumeBaselineMBps[""]
+		}
+		if req.Throughput > 0 {
+			baseline = float64(req.Throughput)
+		}
+		sumMBps += baseline
+		iops, ok := volumeBaselineIOPS[req.VolType]
+		if !ok {
+			iops = volumeBaselineIOPS[""]
+		}
+		if req.IOPS > 0 && provisionsIOPS(req.VolType) {
+			iops = req.IOPS
+		}
+		sumIOPS += iops
+		volumes++
+	}
+	if volumes == 0 {
+		return nil
+	}
+
+	floor := aws.Float64Value(ebs.BaselineThroughputInMBps)
+	if floorMBps > 0 {
+		floor = floorMBps
+	}
+	maximum := max(aws.Float64Value(ebs.MaximumThroughputInMBps), floor)
+
+	sustained := min(max(sumMBps, floor), maximum)
+	group := &vm.ThrottleGroup{
+		ID:       ebsThrottleGroupID,
+		BPSTotal: mbpsToBytes(sustained),
+	}
+	if maximum > sustained {
+		group.BPSTotalMax = mbpsToBytes(maximum)
+		group.BPSTotalMaxLength = ebsBurstSeconds
+	}
+
+	if maxIOPS := aws.Int64Value(ebs.MaximumIops); maxIOPS > 0 {
+		baselineIOPS := min(aws.Int64Value(ebs.BaselineIops), maxIOPS)
+		group.IOPSTotal = min(max(sumIOPS, baselineIOPS), maxIOPS)
+		if maxIOPS > group.IOPSTotal {
+			group.IOPSTotalMax = maxIOPS
+			group.IOPSTotalMaxLength = ebsBurstSeconds
+		}
+	}
+	return group
+}
+
+// mbpsToBytes converts megabytes/s, as EC2 reports EBS throughput, to
+// bytes/s.
+func mbpsToBytes(mbps float64) int64 {
+	return int64(mbps * 1000 * 1000)
+}
+
+// instanceThrottleGroup computes the EBS throttle group for instance from
+// its type and current volumes.
+func (d *Daemon) instanceThrottleGroup(instance *vm.VM) *vm.ThrottleGroup {
+	info := d.resourceMgr.instanceTypes[instance.InstanceType]
+	return ebsThrottleGroup(info, d.config.Daemon.EBSThroughputFloor(instance.InstanceType), instance.SnapshotEBSRequests())
+}
+
+// throttledBlockdevArgs wraps blockdev-add arguments in a throttle filter
+// joined to group, keeping the node name on the filter so device_add and
+// blockdev-del address it as before.
+func throttledBlockdevArgs(args map[string]any, group string) map[string]any {
+	inner := make(map[string]any, len(args))
+	for k, v := range args {
+		if k != "node-name" {
+			inner[k] = v
+		}
+	}
+	return map[string]any{
+		"driver":         "throttle",
+		"node-name":      args["node-name"],
+		"throttle-group": group,
+		"file":           inner,
+	}
+}
+
+// updateEBSThrottle recomputes a running instance's throttle group after its
+// volumes change and applies the new limits over QMP. Failures only leave
+// the previous limits in place, so they are logged rather than returned.
+func (d *Daemon) updateEBSThrottle(instance *vm.VM) {
+	d.Instances.Mu.Lock()
+	throttled := len(instance.Config.ThrottleGroups) > 0
+	d.Instances.Mu.Unlock()
+	if !throttled {
+		return
+	}
+
+	group := d.instanceThrottleGroup(instance)
+	if group == nil {
+		// The last data volume is gone but the root volume always
+		// remains, so this only happens if the type lost its EbsInfo.
+		return
+	}
+
+	_, err := d.SendQMPCommand(instance.QMPClient, qmp.QMPCommand{
+		Execute: "qom-set",
+		Arguments: map[string]any{
+			"path":     "/objects/" + group.ID,
+			"property": "limits",
+			"value":    group.QMPLimits(),
+		},
+	}, instance.ID)
+	if err != nil {
+		slog.Warn("Failed to update EBS throttle limits", "instanceId", instance.ID, "err", err)
+		return
+	}
+
+	d.Instances.Mu.Lock()
+	instance.Config.ThrottleGroups = []vm.ThrottleGroup{*group}
+	d.Instances.Mu.Unlock()
+	slog.Info("Updated EBS throttle limits", "instanceId", instance.ID,
+		"bpsTotal", group.BPSTotal, "bpsTotalMax", group.BPSTotalMax, "iopsTotal", group.IOPSTotal, "iopsTotalMax", group.IOPSTotalMax)
+}
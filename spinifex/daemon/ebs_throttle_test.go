@@ -0,0 +1,153 @@
+package daemon
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/stretchr/testify/assert"
+)
+
+func ebsOptimizedType(baselineMBps, maximumMBps float64) *ec2.InstanceTypeInfo {
+	return &ec2.InstanceTypeInfo{EbsInfo: &ec2.EbsInfo{
+		EbsOptimizedSupport: aws.String(ec2.EbsOptimizedSupportDefault),
+		EbsOptimizedInfo: &ec2.EbsOptimizedInfo{
+			BaselineThroughputInMBps: aws.Float64(baselineMBps),
+			MaximumThroughputInMBps:  aws.Float64(maximumMBps),
+		},
+	}}
+}
+
+// withIOPS returns a copy of info reporting the given EBS IOPS.
+func withIOPS(info *ec2.InstanceTypeInfo, baseline, maximum int64) *ec2.InstanceTypeInfo {
+	ebs := *info.EbsInfo.EbsOptimizedInfo
+	ebs.BaselineIops = aws.Int64(baseline)
+	ebs.MaximumIops = aws.Int64(maximum)
+	return &ec2.InstanceTypeInfo{EbsInfo: &ec2.EbsInfo{EbsOptimizedSupport: info.EbsInfo.EbsOptimizedSupport, EbsOptimizedInfo: &ebs}}
+}
+
+func TestEBSThrottleGroup(t *testing.T) {
+	// t3.micro and m5.4xlarge EBS-optimized throughput.
+	burstable := ebsOptimizedType(10.875, 260.625)
+	fixed := ebsOptimizedType(593.75, 593.75)
+
+	root := types.EBSRequest{Name: "vol-root", Boot: true, VolType: "gp3"}
+	cloudInit := types.EBSRequest{Name: "vol-ci", CloudInit: true}
+	efi := types.EBSRequest{Name: "vol-efi", EFI: true}
+
+	tests := []struct {
+		name     string
+		info     *ec2.InstanceTypeInfo
+		floor    float64
+		requests []types.EBSRequest
+		want     *vm.ThrottleGroup
+	}{
+		{
+			name:     "volume baselines above type baseline, burst to type maximum",
+			info:     burstable,
+			requests: []types.EBSRequest{root, cloudInit, efi},
+			want:     &vm.ThrottleGroup{ID: "ebs-throttle", BPSTotal: 125_000_000, BPSTotalMax: 260_625_000, BPSTotalMaxLength: 1800},
+		},
+		{
+			name:     "slow volumes raised to type baseline",
+			info:     fixed,
+			requests: []types.EBSRequest{root, {Name: "vol-cold", VolType: "sc1"}},
+			want:     &vm.ThrottleGroup{ID: "ebs-throttle", BPSTotal: 593_750_000},
+		},
+		{
+			name:     "sustained rate capped at type maximum",
+			info:     burstable,
+			requests: []types.EBSRequest{{VolType: "io1"}, {VolType: "io2"}},
+			want:     &vm.ThrottleGroup{ID: "ebs-throttle", BPSTotal: 260_625_000},
+		},
+		{
+			name:     "untyped volumes count as gp3",
+			info:     burstable,
+			requests: []types.EBSRequest{{Name: "vol-old"}, {Name: "vol-odd", VolType: "unknown"}},
+			want:     &vm.ThrottleGroup{ID: "ebs-throttle", BPSTotal: 250_000_000, BPSTotalMax: 260_625_000, BPSTotalMaxLength: 1800},
+		},
+		{
+			name:     "configured floor overrides type baseline",
+			info:     burstable,
+			floor:    200,
+			requests: []types.EBSRequest{{VolType: "st1"}},
+			want:     &vm.ThrottleGroup{ID: "ebs-throttle", BPSTotal: 200_000_000, BPSTotalMax: 260_625_000, BPSTotalMaxLength: 1800},
+		},
+		{
+			name:     "floor above type maximum raises the cap",
+			info:     burstable,
+			floor:    400,
+			requests: []types.EBSRequest{root},
+			want:     &vm.ThrottleGroup{ID: "ebs-throttle", BPSTotal: 400_000_000},
+		},
+		{
+			name:     "not EBS-optimized",
+			info:     &ec2.InstanceTypeInfo{EbsInfo: &ec2.EbsInfo{EbsOptimizedSupport: aws.String(ec2.EbsOptimizedSupportUnsupported)}},
+			requests: []types.EBSRequest{root},
+		},
+		{
+			name:     "IOPS from volume baselines, burst to type maximum",
+			info:     withIOPS(burstable, 2000, 11800),
+			requests: []types.EBSRequest{root, {Name: "vol-cold", VolType: "sc1"}},
+			want: &vm.ThrottleGroup{ID: "ebs-throttle", BPSTotal: 137_000_000, BPSTotalMax: 260_625_000, BPSTotalMaxLength: 1800,
+				IOPSTotal: 3250, IOPSTotalMax: 11800, IOPSTotalMaxLength: 1800},
+		},
+		{
+			name:     "IOPS raised to type baseline",
+			info:     withIOPS(fixed, 20000, 20000),
+			requests: []types.EBSRequest{root},
+			want:     &vm.ThrottleGroup{ID: "ebs-throttle", BPSTotal: 593_750_000, IOPSTotal: 20000},
+		},
+		{
+			name: "provisioned IOPS and throughput replace baselines",
+			info: withIOPS(ebsOptimizedType(100, 2000), 2000, 40000),
+			requests: []types.EBSRequest{
+				{VolType: "gp3", IOPS: 6000, Throughput: 250},
+				{VolType: "io2", IOPS: 16000},
+				{VolType: "gp2", IOPS: 9000},
+			},
+			want: &vm.ThrottleGroup{ID: "ebs-throttle", BPSTotal: 878_000_000, BPSTotalMax: 2_000_000_000, BPSTotalMaxLength: 1800,
+				IOPSTotal: 22100, IOPSTotalMax: 40000, IOPSTotalMaxLength: 1800},
+		},
+		{
+			name:     "no EBS volumes",
+			info:     burstable,
+			requests: []types.EBSRequest{cloudInit, efi},
+		},
+		{
+			name:     "unknown type",
+			requests: []types.EBSRequest{root},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ebsThrottleGroup(tt.info, tt.floor, tt.requests))
+		})
+	}
+}
+
+func TestThrottledBlockdevArgs(t *testing.T) {
+	args := map[string]any{
+		"node-name": "nbd-vol-1",
+		"driver":    "nbd",
+		"server":    map[string]any{"type": "unix", "path": "/run/vol-1.sock"},
+		"export":    "",
+		"read-only": false,
+	}
+
+	assert.Equal(t, map[string]any{
+		"driver":         "throttle",
+		"node-name":      "nbd-vol-1",
+		"throttle-group": "ebs-throttle",
+		"file": map[string]any{
+			"driver":    "nbd",
+			"server":    map[string]any{"type": "unix", "path": "/run/vol-1.sock"},
+			"export":    "",
+			"read-only": false,
+		},
+	}, throttledBlockdevArgs(args, "ebs-throttle"))
+	assert.Equal(t, "nbd-vol-1", args["node-name"], "input must not be modified")
+}
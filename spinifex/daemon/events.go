@@ -0,0 +1,73 @@
+package daemon
+
+import (
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+)
+
+// Event detail types, as EventBridge names the EC2 and EBS notifications.
+const (
+	eventInstanceStateChange = "EC2 Instance State-change Notification"
+	eventVolumeNotification  = "EBS Volume Notification"
+)
+
+// publishStateChange emits an instance state-change event for a transition
+// from previous to the instance's current state. reason is the state reason
+// code, if any.
+func (d *Daemon) publishStateChange(instance *vm.VM, accountID string, previous, state vm.InstanceState, reason string) {
+	d.publishEvent(subjects.EventInstanceStateChange, "aws.ec2", eventInstanceStateChange, accountID,
+		"instance/"+instance.ID, types.InstanceStateChangeDetail{
+			InstanceID:    instance.ID,
+			State:         string(state),
+			PreviousState: string(previous),
+			StateReason:   reason,
+		})
+}
+
+// publishVolumeNotification emits a volume attach or detach event.
+func (d *Daemon) publishVolumeNotification(instance *vm.VM, detail types.VolumeNotificationDetail) {
+	d.Instances.Mu.Lock()
+	accountID := instance.AccountID
+	d.Instances.Mu.Unlock()
+	d.publishEvent(subjects.EventVolumeNotification, "aws.ebs", eventVolumeNotification, accountID,
+		"volume/"+detail.VolumeID, detail)
+}
+
+// publishEvent publishes detail in an event envelope on subject. resource is
+// the EC2 resource the event concerns, e.g. "instance/i-0123". Events are
+// best effort: a failure is logged and the caller carries on.
+func (d *Daemon) publishEvent(subject, source, detailType, accountID, resource string, detail any) {
+	if d.natsConn == nil {
+		return
+	}
+	var region string
+	if d.config != nil {
+		region = d.config.Region
+	}
+	event := types.Event{
+		Version:    "0",
+		ID:         uuid.NewString(),
+		DetailType: detailType,
+		Source:     source,
+		Account:    accountID,
+		Time:       utils.Now().UTC().Format(time.RFC3339),
+		Region:     region,
+		Resources:  []string{"arn:aws:ec2:" + region + ":" + accountID + ":" + resource},
+		Detail:     detail,
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("Failed to marshal event", "detailType", detailType, "err", err)
+		return
+	}
+	if err := d.natsConn.Publish(utils.Subject(subject), data); err != nil {
+		slog.Warn("Failed to publish event", "subject", subject, "err", err)
+	}
+}
@@ -0,0 +1,61 @@
+package daemon
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransitionState_PublishesStateChangeEvent(t *testing.T) {
+	daemon := createDaemonWithJetStream(t)
+	daemon.config.Region = "ap-southeast-2"
+	require.NoError(t, daemon.jsManager.InitEventStream())
+	// A second init finds the existing stream.
+	require.NoError(t, daemon.jsManager.InitEventStream())
+
+	sub, err := daemon.natsConn.SubscribeSync(subjects.EventInstanceStateChange)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	instance := &vm.VM{
+		ID:        "i-events-001",
+		Status:    vm.StateRunning,
+		AccountID: testAccountID,
+		Instance:  &ec2.Instance{},
+	}
+	daemon.Instances.UpsertVM(instance)
+
+	daemon.Instances.Mu.Lock()
+	daemon.setStateReason(instance, stateReasonInternalError, "crashed")
+	daemon.Instances.Mu.Unlock()
+	require.NoError(t, daemon.TransitionState(instance, vm.StateError))
+
+	msg, err := sub.NextMsg(5 * time.Second)
+	require.NoError(t, err)
+
+	var event types.Event
+	require.NoError(t, json.Unmarshal(msg.Data, &event))
+	assert.Equal(t, "EC2 Instance State-change Notification", event.DetailType)
+	assert.Equal(t, "aws.ec2", event.Source)
+	assert.Equal(t, testAccountID, event.Account)
+	assert.Equal(t, []string{"arn:aws:ec2:ap-southeast-2:" + testAccountID + ":instance/i-events-001"}, event.Resources)
+	assert.NotEmpty(t, event.ID)
+
+	detail, err := json.Marshal(event.Detail)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"instance-id":"i-events-001","state":"error","previous-state":"running","state-reason":"Server.InternalError"}`, string(detail))
+
+	// The stream keeps the event for replay.
+	js, err := daemon.natsConn.JetStream()
+	require.NoError(t, err)
+	stored, err := js.GetLastMsg(EventStream, subjects.EventInstanceStateChange)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(msg.Data), string(stored.Data))
+}
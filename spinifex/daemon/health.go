@@ -10,6 +10,8 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/mulgadc/spinifex/spinifex/vm"
 )
 
@@ -105,7 +107,7 @@ func (d *Daemon) handleInstanceCrash(instance *vm.VM, waitErr error) {
 	}
 
 	// Update health tracking
-	now := time.Now()
+	now := utils.Now()
 	d.Instances.Mu.Lock()
 	instance.Health.CrashCount++
 	instance.Health.LastCrashTime = now
@@ -113,6 +115,7 @@ func (d *Daemon) handleInstanceCrash(instance *vm.VM, waitErr error) {
 	if instance.Health.FirstCrashTime.IsZero() {
 		instance.Health.FirstCrashTime = now
 	}
+	d.setStateReason(instance, stateReasonInternalError, "Instance process exited unexpectedly: "+reason)
 	instance.Running = false
 	instance.PID = 0
 	d.Instances.Mu.Unlock()
@@ -124,11 +127,18 @@ func (d *Daemon) handleInstanceCrash(instance *vm.VM, waitErr error) {
 			"instance", instance.ID, "type", instance.InstanceType)
 		d.resourceMgr.deallocate(instanceType)
 	}
+	d.resourceMgr.releaseNUMA(instance.ID)
 
-	// Clean up stale QMP socket so QEMU can rebind on restart
+	// Clean up stale QMP and agent sockets so QEMU can rebind on restart
 	if instance.Config.QMPSocket != "" {
 		_ = os.Remove(instance.Config.QMPSocket)
 	}
+	if instance.Config.GuestAgentSocket != "" {
+		_ = os.Remove(instance.Config.GuestAgentSocket)
+	}
+	if instance.Config.AgentSocket != "" {
+		_ = os.Remove(instance.Config.AgentSocket)
+	}
 
 	// Unmount EBS volumes (same pattern as stopInstance)
 	d.unmountInstanceVolumes(instance)
@@ -145,10 +155,7 @@ func (d *Daemon) handleInstanceCrash(instance *vm.VM, waitErr error) {
 // unmountInstanceVolumes sends NATS unmount requests for all volumes attached
 // to the instance and updates their state to "available".
 func (d *Daemon) unmountInstanceVolumes(instance *vm.VM) {
-	instance.EBSRequests.Mu.Lock()
-	defer instance.EBSRequests.Mu.Unlock()
-
-	for _, ebsRequest := range instance.EBSRequests.Requests {
+	for _, ebsRequest := range instance.SnapshotEBSRequests() {
 		ebsUnMountRequest, err := json.Marshal(ebsRequest)
 		if err != nil {
 			slog.Error("Failed to marshal volume payload for crash cleanup",
@@ -156,7 +163,7 @@ func (d *Daemon) unmountInstanceVolumes(instance *vm.VM) {
 			continue
 		}
 
-		msg, err := d.natsConn.Request(d.ebsTopic("unmount"), ebsUnMountRequest, 30*time.Second)
+		msg, err := d.natsConn.Request(utils.Subject(subjects.EBSUnmount(d.node)), ebsUnMountRequest, 30*time.Second)
 		if err != nil {
 			slog.Error("Failed to unmount volume after crash",
 				"name", ebsRequest.Name, "instance", instance.ID, "err", err)
@@ -175,16 +182,23 @@ func (d *Daemon) unmountInstanceVolumes(instance *vm.VM) {
 	}
 }
 
-// maybeRestartInstance checks restart policy and schedules a restart if allowed.
+// maybeRestartInstance checks restart policy and schedules a restart if
+// allowed. Instances whose maintenance options disable auto-recovery are
+// never restarted.
 func (d *Daemon) maybeRestartInstance(instance *vm.VM) {
 	if d.shuttingDown.Load() {
 		slog.Info("Skipping restart during shutdown", "instance", instance.ID)
 		return
 	}
 
-	now := time.Now()
+	now := utils.Now()
 
 	d.Instances.Mu.Lock()
+	if autoRecoveryDisabled(instance) {
+		d.Instances.Mu.Unlock()
+		slog.Info("Auto-recovery disabled, leaving crashed instance in error state", "instance", instance.ID)
+		return
+	}
 	health := &instance.Health
 
 	// If crashes are outside the restart window, reset counters
@@ -197,6 +211,8 @@ func (d *Daemon) maybeRestartInstance(instance *vm.VM) {
 
 	// Check if we've exceeded the max restarts in the window
 	if health.CrashCount > maxRestartsInWindow {
+		d.setStateReason(instance, stateReasonInternalError,
+			fmt.Sprintf("Instance crashed %d times within %s; not restarting", health.CrashCount, restartWindow))
 		d.Instances.Mu.Unlock()
 		slog.Error("Instance exceeded max restarts in window, leaving in error state",
 			"instance", instance.ID,
@@ -220,6 +236,9 @@ func (d *Daemon) maybeRestartInstance(instance *vm.VM) {
 	if d.resourceMgr.canAllocate(instanceType, 1) < 1 {
 		slog.Error("Insufficient resources to restart instance",
 			"instance", instance.ID, "type", instance.InstanceType)
+		d.Instances.Mu.Lock()
+		d.setStateReason(instance, stateReasonInsufficientCapacity, "Insufficient capacity on the host to restart the instance")
+		d.Instances.Mu.Unlock()
 		return
 	}
 
@@ -293,3 +312,95 @@ func (d *Daemon) restartCrashedInstance(instance *vm.VM) {
 		}
 	}
 }
+
+// handleQMPEvent dispatches asynchronous QMP events that need daemon action.
+// Called with the QMP client lock held, so handlers run in their own goroutine.
+func (d *Daemon) handleQMPEvent(instanceID string, msg map[string]any) {
+	data, _ := msg["data"].(map[string]any)
+	switch msg["event"] {
+	case "WATCHDOG":
+		action, _ := data["action"].(string)
+		go d.handleWatchdogEvent(instanceID, action)
+	case "BLOCK_IO_ERROR":
+		go d.handleBlockIOErrorEvent(instanceID, data)
+	}
+}
+
+// drainQMPEvents reads any events QEMU wrote to the QMP socket before it
+// exited and dispatches them via handleQMPEvent.
+func (d *Daemon) drainQMPEvents(instance *vm.VM) {
+	q := instance.QMPClient
+	if q == nil || q.Conn == nil || q.Decoder == nil {
+		return
+	}
+
+	q.Mu.Lock()
+	defer q.Mu.Unlock()
+
+	if err := q.Conn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+		return
+	}
+	for {
+		var msg map[string]any
+		if err := q.Decoder.Decode(&msg); err != nil {
+			return
+		}
+		if _, ok := msg["event"]; ok {
+			slog.Info("QMP event after exit", "event", msg["event"], "instanceId", instance.ID)
+			d.handleQMPEvent(instance.ID, msg)
+		}
+	}
+}
+
+// handleWatchdogEvent records a guest watchdog expiry and reconciles instance
+// state with the action QEMU already took: a reset guest keeps running, while
+// a powered-off guest is stopped and its volumes and resources released.
+func (d *Daemon) handleWatchdogEvent(instanceID, action string) {
+	var instance *vm.VM
+	var status vm.InstanceState
+	ok := d.Instances.WithVM(instanceID, func(v *vm.VM) {
+		v.Health.WatchdogCount++
+		v.Health.LastWatchdogTime = utils.Now()
+		v.Health.LastWatchdogAction = action
+		instance, status = v, v.Status
+	})
+	if !ok {
+		slog.Warn("Watchdog event for unknown instance", "instance", instanceID, "action", action)
+		return
+	}
+
+	slog.Warn("Guest watchdog expired", "instance", instanceID, "action", action, "status", status)
+
+	if action != vm.WatchdogPoweroff || status != vm.StateRunning {
+		if err := d.WriteState(); err != nil {
+			slog.Error("Failed to persist state after watchdog event", "instance", instanceID, "err", err)
+		}
+		return
+	}
+
+	d.Instances.Mu.Lock()
+	d.setStateReason(instance, stateReasonInstanceInitiatedShutdown, "Guest watchdog expired; instance powered off")
+	d.Instances.Mu.Unlock()
+
+	if err := d.TransitionState(instance, vm.StateStopping); err != nil {
+		slog.Error("Failed to transition watchdog instance to stopping", "instance", instanceID, "err", err)
+		if instance.Status != vm.StateStopping {
+			return
+		}
+	}
+
+	if err := d.stopInstance([]*vm.VM{instance}, false); err != nil {
+		slog.Error("Volume teardown incomplete after watchdog poweroff, instance is down", "instance", instanceID, "err", err)
+	}
+
+	d.Instances.Mu.Lock()
+	instance.Running = false
+	instance.PID = 0
+	instance.LastNode = d.node
+	d.Instances.Mu.Unlock()
+
+	if err := d.TransitionState(instance, vm.StateStopped); err != nil {
+		slog.Error("Failed to transition watchdog instance to stopped", "instance", instanceID, "err", err)
+	}
+	slog.Info("Instance stopped by guest watchdog", "instance", instanceID)
+}
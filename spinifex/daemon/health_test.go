@@ -1,14 +1,19 @@
 package daemon
 
 import (
+	"encoding/json"
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/mulgadc/spinifex/spinifex/config"
+	"github.com/mulgadc/spinifex/spinifex/qmp"
 	"github.com/mulgadc/spinifex/spinifex/vm"
 	"github.com/nats-io/nats.go"
 	"github.com/stretchr/testify/assert"
@@ -283,6 +288,7 @@ func TestHandleInstanceCrash_CoreFlow(t *testing.T) {
 		PID:          12345,
 		InstanceType: allocType,
 		Config:       vm.Config{QMPSocket: qmpPath},
+		Instance:     &ec2.Instance{},
 	}
 	d.Instances.VMS[instance.ID] = instance
 
@@ -297,6 +303,10 @@ func TestHandleInstanceCrash_CoreFlow(t *testing.T) {
 	assert.Equal(t, "unknown", instance.Health.LastCrashReason) // fmt.Errorf is not *exec.ExitError
 	assert.False(t, instance.Health.FirstCrashTime.IsZero())
 
+	// The crash is a server-side state change
+	require.NotNil(t, instance.Instance.StateReason)
+	assert.Equal(t, "Server.InternalError", *instance.Instance.StateReason.Code)
+
 	// Running and PID cleared
 	assert.False(t, instance.Running)
 	assert.Equal(t, 0, instance.PID)
@@ -446,6 +456,39 @@ func TestMaybeRestart_InsufficientResources(t *testing.T) {
 	assert.Equal(t, 0, instance.Health.RestartCount)
 }
 
+func TestMaybeRestart_AutoRecoveryDisabled(t *testing.T) {
+	d, cleanup := newTestDaemon(t)
+	defer cleanup()
+
+	allocType := smallestAllocType(t, d.resourceMgr)
+
+	// With no capacity left, a restart attempt would record an
+	// insufficient-capacity state reason.
+	d.resourceMgr.mu.Lock()
+	d.resourceMgr.allocatedVCPU = d.resourceMgr.hostVCPU - d.resourceMgr.reservedVCPU
+	d.resourceMgr.allocatedMem = d.resourceMgr.hostMemGB - d.resourceMgr.reservedMem
+	d.resourceMgr.mu.Unlock()
+
+	instance := &vm.VM{
+		ID:           "i-test-restart-norecovery",
+		Status:       vm.StateError,
+		InstanceType: allocType,
+		Instance: &ec2.Instance{MaintenanceOptions: &ec2.InstanceMaintenanceOptions{
+			AutoRecovery: aws.String(ec2.InstanceAutoRecoveryStateDisabled),
+		}},
+		Health: vm.InstanceHealthState{
+			CrashCount:     1,
+			FirstCrashTime: time.Now(),
+		},
+	}
+	d.Instances.VMS[instance.ID] = instance
+
+	d.maybeRestartInstance(instance)
+
+	assert.Nil(t, instance.Instance.StateReason, "restart not attempted")
+	assert.Equal(t, 0, instance.Health.RestartCount)
+}
+
 func TestMaybeRestart_SchedulesRestart(t *testing.T) {
 	d, cleanup := newTestDaemon(t)
 	defer cleanup()
@@ -479,3 +522,138 @@ func TestMaybeRestart_SchedulesRestart(t *testing.T) {
 	assert.Equal(t, 1, instance.Health.CrashCount)
 	assert.Equal(t, 0, instance.Health.RestartCount) // incremented by restartCrashedInstance, not maybeRestart
 }
+
+// newWatchdogQMPClient returns a mock QMP client that emits a WATCHDOG event
+// with the given action ahead of the reply to the first command, the way QEMU
+// interleaves asynchronous events with command responses.
+func newWatchdogQMPClient(t *testing.T, action string) (*qmp.QMPClient, func()) {
+	t.Helper()
+	clientConn, serverConn := net.Pipe()
+
+	client := &qmp.QMPClient{
+		Conn:    clientConn,
+		Decoder: json.NewDecoder(clientConn),
+		Encoder: json.NewEncoder(clientConn),
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		dec := json.NewDecoder(serverConn)
+		enc := json.NewEncoder(serverConn)
+		sent := false
+		for {
+			var cmd qmp.QMPCommand
+			if err := dec.Decode(&cmd); err != nil {
+				return
+			}
+			if !sent {
+				sent = true
+				if err := enc.Encode(map[string]any{
+					"event": "WATCHDOG",
+					"data":  map[string]any{"action": action},
+				}); err != nil {
+					return
+				}
+			}
+			if err := enc.Encode(map[string]any{"return": map[string]any{}}); err != nil {
+				return
+			}
+		}
+	}()
+
+	return client, func() {
+		clientConn.Close()
+		serverConn.Close()
+		<-done
+	}
+}
+
+func TestWatchdogEvent_Reset(t *testing.T) {
+	d, cleanup := newTestDaemon(t)
+	defer cleanup()
+
+	qmpClient, cancelQMP := newWatchdogQMPClient(t, vm.WatchdogReset)
+	defer cancelQMP()
+
+	instance := &vm.VM{
+		ID:             "i-test-watchdog-reset",
+		Status:         vm.StateRunning,
+		WatchdogAction: vm.WatchdogReset,
+		QMPClient:      qmpClient,
+	}
+	d.Instances.VMS[instance.ID] = instance
+
+	_, err := d.SendQMPCommand(qmpClient, qmp.QMPCommand{Execute: "query-status"}, instance.ID)
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		d.Instances.Mu.Lock()
+		defer d.Instances.Mu.Unlock()
+		return instance.Health.WatchdogCount == 1
+	}, 5*time.Second, 20*time.Millisecond)
+
+	d.Instances.Mu.Lock()
+	defer d.Instances.Mu.Unlock()
+	assert.Equal(t, vm.StateRunning, instance.Status, "reset guest keeps running")
+	assert.Equal(t, vm.WatchdogReset, instance.Health.LastWatchdogAction)
+	assert.False(t, instance.Health.LastWatchdogTime.IsZero())
+}
+
+func TestWatchdogEvent_Poweroff(t *testing.T) {
+	d, cleanup := newTestDaemon(t)
+	defer cleanup()
+
+	allocType := smallestAllocType(t, d.resourceMgr)
+	instanceType := d.resourceMgr.instanceTypes[allocType]
+	require.NoError(t, d.resourceMgr.allocate(instanceType))
+
+	d.resourceMgr.mu.RLock()
+	allocVCPUBefore := d.resourceMgr.allocatedVCPU
+	d.resourceMgr.mu.RUnlock()
+
+	qmpClient, cancelQMP := newWatchdogQMPClient(t, vm.WatchdogPoweroff)
+	defer cancelQMP()
+
+	instance := &vm.VM{
+		ID:             "i-test-watchdog-poweroff",
+		Status:         vm.StateRunning,
+		Running:        true,
+		InstanceType:   allocType,
+		WatchdogAction: vm.WatchdogPoweroff,
+		QMPClient:      qmpClient,
+		Instance:       &ec2.Instance{},
+	}
+	d.Instances.VMS[instance.ID] = instance
+
+	_, err := d.SendQMPCommand(qmpClient, qmp.QMPCommand{Execute: "query-status"}, instance.ID)
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		d.Instances.Mu.Lock()
+		defer d.Instances.Mu.Unlock()
+		return instance.Status == vm.StateStopped
+	}, 10*time.Second, 50*time.Millisecond)
+
+	d.Instances.Mu.Lock()
+	assert.Equal(t, 1, instance.Health.WatchdogCount)
+	assert.Equal(t, vm.WatchdogPoweroff, instance.Health.LastWatchdogAction)
+	assert.False(t, instance.Running)
+	require.NotNil(t, instance.Instance.StateReason)
+	assert.Equal(t, "Client.InstanceInitiatedShutdown", *instance.Instance.StateReason.Code)
+	d.Instances.Mu.Unlock()
+
+	// Resources released as for a normal stop
+	d.resourceMgr.mu.RLock()
+	assert.Less(t, d.resourceMgr.allocatedVCPU, allocVCPUBefore)
+	d.resourceMgr.mu.RUnlock()
+}
+
+func TestWatchdogEvent_UnknownInstance(t *testing.T) {
+	d, cleanup := newTestDaemon(t)
+	defer cleanup()
+
+	// Must not panic or create state for an instance this node doesn't own
+	d.handleWatchdogEvent("i-does-not-exist", vm.WatchdogPoweroff)
+	assert.Empty(t, d.Instances.VMS)
+}
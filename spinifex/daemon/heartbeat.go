@@ -1,15 +1,23 @@
 package daemon
 
 import (
+	"encoding/json"
 	"log/slog"
 	"time"
+
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
 )
 
 const heartbeatInterval = 10 * time.Second
 
 // startHeartbeat launches a goroutine that publishes this daemon's heartbeat
-// to the cluster-state KV store every heartbeatInterval. It fires immediately
-// on start, then repeats on a ticker. The goroutine exits when d.ctx is cancelled.
+// to the cluster-state KV store and the node registries every
+// heartbeatInterval, then sweeps the node registry for nodes that went
+// quiet. It fires immediately on start, then repeats on a ticker. The
+// goroutine exits when d.ctx is cancelled.
 func (d *Daemon) startHeartbeat() {
 	if d.jsManager == nil {
 		slog.Warn("JetStream not initialized, skipping heartbeat")
@@ -30,6 +38,7 @@ func (d *Daemon) startHeartbeat() {
 				return
 			case <-ticker.C:
 				d.publishHeartbeat()
+				d.sweepNodeRegistry()
 			}
 		}
 	}()
@@ -37,7 +46,8 @@ func (d *Daemon) startHeartbeat() {
 	slog.Info("Heartbeat started", "interval", heartbeatInterval)
 }
 
-// publishHeartbeat builds and writes a heartbeat entry to KV.
+// publishHeartbeat builds a heartbeat, writes it to KV and publishes it on
+// subjects.NodeHeartbeat.
 func (d *Daemon) publishHeartbeat() {
 	h := d.buildHeartbeat()
 	if err := d.jsManager.WriteHeartbeat(h); err != nil {
@@ -45,6 +55,18 @@ func (d *Daemon) publishHeartbeat() {
 	} else {
 		slog.Debug("Heartbeat published", "node", h.Node, "vms", h.VMCount)
 	}
+
+	if d.natsConn == nil {
+		return
+	}
+	data, err := json.Marshal(h)
+	if err != nil {
+		slog.Error("Failed to marshal heartbeat", "error", err)
+		return
+	}
+	if err := d.natsConn.Publish(utils.Subject(subjects.NodeHeartbeat), data); err != nil {
+		slog.Warn("Failed to broadcast heartbeat", "error", err)
+	}
 }
 
 // buildHeartbeat constructs a Heartbeat from the daemon's current state.
@@ -54,16 +76,33 @@ func (d *Daemon) publishHeartbeat() {
 func (d *Daemon) buildHeartbeat() *Heartbeat {
 	totalVCPU, totalMem, reservedVCPU, reservedMem, allocVCPU, allocMem, _ := d.resourceMgr.GetResourceStats()
 
+	vmCount := 0
+	runningCount := 0
 	d.Instances.Mu.Lock()
-	vmCount := len(d.Instances.VMS)
+	for _, v := range d.Instances.VMS {
+		vmCount++
+		if v.Status == vm.StateRunning {
+			runningCount++
+		}
+	}
 	d.Instances.Mu.Unlock()
 
+	status := types.HostStateAvailable
+	if d.resourceMgr.isCordoned() {
+		status = types.HostStateDraining
+	}
+
 	return &Heartbeat{
 		Node:          d.node,
 		Epoch:         d.clusterConfig.Epoch,
-		Timestamp:     time.Now().UTC().Format(time.RFC3339),
+		Timestamp:     utils.Now().Format(time.RFC3339),
+		Version:       d.clusterConfig.Version,
+		Status:        status,
 		Services:      d.config.GetServices(),
 		VMCount:       vmCount,
+		RunningCount:  runningCount,
+		TotalVCPU:     totalVCPU,
+		TotalMem:      totalMem,
 		AllocatedVCPU: allocVCPU,
 		AvailableVCPU: totalVCPU - allocVCPU,
 		AllocatedMem:  allocMem,
@@ -3,8 +3,11 @@ package daemon
 import (
 	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/mulgadc/spinifex/spinifex/config"
+	"github.com/mulgadc/spinifex/spinifex/testutil"
+	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/mulgadc/spinifex/spinifex/vm"
 	"github.com/nats-io/nats.go"
 	"github.com/stretchr/testify/assert"
@@ -19,7 +22,8 @@ func TestBuildHeartbeat(t *testing.T) {
 	d := &Daemon{
 		node: "test-node",
 		clusterConfig: &config.ClusterConfig{
-			Epoch: 5,
+			Epoch:   5,
+			Version: "v1.2.0",
 		},
 		config: &config.Config{
 			Services: []string{"daemon", "nats", "viperblock"},
@@ -27,14 +31,19 @@ func TestBuildHeartbeat(t *testing.T) {
 		resourceMgr: rm,
 		Instances:   vm.Instances{VMS: make(map[string]*vm.VM)},
 	}
+	t.Cleanup(utils.SetClock(testutil.NewFakeClock(time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC))))
 
 	h := d.buildHeartbeat()
 
 	assert.Equal(t, "test-node", h.Node)
 	assert.Equal(t, uint64(5), h.Epoch)
-	assert.NotEmpty(t, h.Timestamp)
+	assert.Equal(t, "2026-03-04T05:06:07Z", h.Timestamp)
 	assert.Equal(t, []string{"daemon", "nats", "viperblock"}, h.Services)
+	assert.Equal(t, "v1.2.0", h.Version)
+	assert.Equal(t, "available", h.Status)
 	assert.Equal(t, 0, h.VMCount)
+	assert.Equal(t, 0, h.RunningCount)
+	assert.Greater(t, h.TotalVCPU, 0)
 	assert.Equal(t, 0, h.AllocatedVCPU)
 	assert.Greater(t, h.AvailableVCPU, 0)
 	assert.Greater(t, h.AvailableMem, 0.0)
@@ -91,6 +100,7 @@ func TestHeartbeatReflectsAllocation(t *testing.T) {
 	after := d.buildHeartbeat()
 
 	assert.Equal(t, 1, after.VMCount, "Should reflect 1 VM")
+	assert.Equal(t, 1, after.RunningCount, "Should reflect 1 running VM")
 	assert.Greater(t, after.AllocatedVCPU, before.AllocatedVCPU, "AllocatedVCPU should increase")
 	assert.Less(t, after.AvailableVCPU, before.AvailableVCPU, "AvailableVCPU should decrease")
 }
@@ -112,8 +122,13 @@ func TestHeartbeatKVContract(t *testing.T) {
 		Node:          "kv-contract-node",
 		Epoch:         3,
 		Timestamp:     "2025-01-01T00:00:00Z",
+		Version:       "v1.2.0",
+		Status:        "available",
 		Services:      []string{"daemon", "nats"},
 		VMCount:       2,
+		RunningCount:  1,
+		TotalVCPU:     16,
+		TotalMem:      32.0,
 		AllocatedVCPU: 4,
 		AvailableVCPU: 12,
 		AllocatedMem:  8.0,
@@ -135,7 +150,12 @@ func TestHeartbeatKVContract(t *testing.T) {
 	assert.Equal(t, float64(3), raw["epoch"])
 	assert.Equal(t, "2025-01-01T00:00:00Z", raw["timestamp"])
 	assert.Equal(t, []any{"daemon", "nats"}, raw["services"])
+	assert.Equal(t, "v1.2.0", raw["version"])
+	assert.Equal(t, "available", raw["status"])
 	assert.Equal(t, float64(2), raw["vm_count"])
+	assert.Equal(t, float64(1), raw["running_count"])
+	assert.Equal(t, float64(16), raw["total_vcpu"])
+	assert.Equal(t, 32.0, raw["total_mem_gb"])
 	assert.Equal(t, float64(4), raw["allocated_vcpu"])
 	assert.Equal(t, float64(12), raw["available_vcpu"])
 	assert.Equal(t, 8.0, raw["allocated_mem_gb"])
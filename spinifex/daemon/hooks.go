@@ -0,0 +1,160 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/mulgadc/spinifex/spinifex/config"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+)
+
+// Lifecycle hook events, passed to hooks as SPINIFEX_HOOK_EVENT.
+const (
+	hookEventPreLaunch     = "pre-launch"
+	hookEventPostTerminate = "post-terminate"
+)
+
+// maxHookOutput caps how much hook output is logged, and maxHookErrorOutput
+// how much of it goes into a launch failure's state reason.
+const (
+	maxHookOutput      = 4096
+	maxHookErrorOutput = 256
+)
+
+// errPreLaunchHook marks a launch aborted by a failing pre-launch hook.
+var errPreLaunchHook = errors.New("pre-launch hook failed")
+
+// hookInput is the instance metadata a hook receives as JSON on stdin.
+type hookInput struct {
+	Event        string `json:"event"`
+	Node         string `json:"node"`
+	InstanceID   string `json:"instance_id"`
+	AccountID    string `json:"account_id"`
+	InstanceType string `json:"instance_type"`
+	ImageID      string `json:"image_id,omitempty"`
+	PrivateIP    string `json:"private_ip,omitempty"`
+	FQDN         string `json:"fqdn,omitempty"`
+}
+
+// env returns the metadata as SPINIFEX_* environment variables.
+func (in hookInput) env() []string {
+	return []string{
+		"SPINIFEX_HOOK_EVENT=" + in.Event,
+		"SPINIFEX_NODE=" + in.Node,
+		"SPINIFEX_INSTANCE_ID=" + in.InstanceID,
+		"SPINIFEX_ACCOUNT_ID=" + in.AccountID,
+		"SPINIFEX_INSTANCE_TYPE=" + in.InstanceType,
+		"SPINIFEX_IMAGE_ID=" + in.ImageID,
+		"SPINIFEX_PRIVATE_IP=" + in.PrivateIP,
+		"SPINIFEX_FQDN=" + in.FQDN,
+	}
+}
+
+// newHookInput snapshots the instance metadata passed to hooks.
+func (d *Daemon) newHookInput(event string, instance *vm.VM) hookInput {
+	d.Instances.Mu.Lock()
+	defer d.Instances.Mu.Unlock()
+	in := hookInput{
+		Event:        event,
+		Node:         d.node,
+		InstanceID:   instance.ID,
+		AccountID:    instance.AccountID,
+		InstanceType: instance.InstanceType,
+		FQDN:         instance.FQDN,
+	}
+	if instance.Instance != nil {
+		in.ImageID = aws.StringValue(instance.Instance.ImageId)
+		in.PrivateIP = aws.StringValue(instance.Instance.PrivateIpAddress)
+	}
+	return in
+}
+
+// runHook runs one hook to completion or its timeout, returning its combined
+// output with any error.
+func runHook(hook config.LifecycleHook, in hookInput) (string, error) {
+	stdin, err := json.Marshal(in)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hook.Timeout())
+	defer cancel()
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, hook.Command[0], hook.Command[1:]...)
+	cmd.Env = append(os.Environ(), in.env()...)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	// Don't wait on a killed hook's children holding the output pipe open.
+	cmd.WaitDelay = hook.Timeout()
+
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("timed out after %s", hook.Timeout())
+	}
+
+	out := strings.TrimSpace(output.String())
+	if len(out) > maxHookOutput {
+		out = out[:maxHookOutput]
+	}
+	return out, err
+}
+
+// runPreLaunchHooks runs the configured pre-launch hooks in order. The first
+// failing hook with the abort policy stops the launch; the returned error
+// wraps errPreLaunchHook and carries the hook's output.
+func (d *Daemon) runPreLaunchHooks(instance *vm.VM) error {
+	hooks := d.config.Daemon.Hooks.PreLaunch
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	in := d.newHookInput(hookEventPreLaunch, instance)
+	for _, hook := range hooks {
+		output, err := runHook(hook, in)
+		if err == nil {
+			slog.Info("Pre-launch hook succeeded", "instanceId", instance.ID, "hook", hook.Command[0])
+			continue
+		}
+		if hook.OnFailure == config.HookOnFailureContinue {
+			slog.Warn("Pre-launch hook failed, continuing launch", "instanceId", instance.ID, "hook", hook.Command[0], "err", err, "output", output)
+			continue
+		}
+		slog.Error("Pre-launch hook failed, aborting launch", "instanceId", instance.ID, "hook", hook.Command[0], "err", err, "output", output)
+		if output != "" {
+			return fmt.Errorf("%w: %s: %v: %s", errPreLaunchHook, hook.Command[0], err, output[:min(len(output), maxHookErrorOutput)])
+		}
+		return fmt.Errorf("%w: %s: %v", errPreLaunchHook, hook.Command[0], err)
+	}
+	return nil
+}
+
+// runPostTerminateHooks runs the configured post-terminate hooks in the
+// background, in order. Failures are only logged: the instance is already
+// gone and teardown must not wait on operator scripts.
+func (d *Daemon) runPostTerminateHooks(instance *vm.VM) {
+	hooks := d.config.Daemon.Hooks.PostTerminate
+	if len(hooks) == 0 {
+		return
+	}
+
+	in := d.newHookInput(hookEventPostTerminate, instance)
+	go func() {
+		for _, hook := range hooks {
+			if output, err := runHook(hook, in); err != nil {
+				slog.Error("Post-terminate hook failed", "instanceId", in.InstanceID, "hook", hook.Command[0], "err", err, "output", output)
+			} else {
+				slog.Info("Post-terminate hook succeeded", "instanceId", in.InstanceID, "hook", hook.Command[0])
+			}
+		}
+	}()
+}
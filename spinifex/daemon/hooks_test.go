@@ -0,0 +1,141 @@
+package daemon
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/config"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeHookScript writes an executable shell script into dir and returns its path.
+func writeHookScript(t *testing.T, dir, name, body string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0700))
+	return path
+}
+
+func hookTestInstance(id string) *vm.VM {
+	return &vm.VM{
+		ID:           id,
+		Status:       vm.StatePending,
+		AccountID:    testAccountID,
+		InstanceType: "t3.micro",
+		Instance: &ec2.Instance{
+			ImageId:          aws.String("ami-hooks"),
+			PrivateIpAddress: aws.String("10.0.0.9"),
+		},
+	}
+}
+
+func TestRunPreLaunchHooks(t *testing.T) {
+	daemon := createTestDaemon(t, sharedNATSURL)
+	dir := t.TempDir()
+
+	record := writeHookScript(t, dir, "record.sh",
+		`env | grep ^SPINIFEX_ | sort > "$0.env"; cat > "$0.stdin"`)
+	daemon.config.Daemon.Hooks.PreLaunch = []config.LifecycleHook{{Command: []string{record}}}
+
+	require.NoError(t, daemon.runPreLaunchHooks(hookTestInstance("i-hook-ok")))
+
+	env, err := os.ReadFile(record + ".env")
+	require.NoError(t, err)
+	assert.Contains(t, string(env), "SPINIFEX_HOOK_EVENT=pre-launch\n")
+	assert.Contains(t, string(env), "SPINIFEX_INSTANCE_ID=i-hook-ok\n")
+	assert.Contains(t, string(env), "SPINIFEX_ACCOUNT_ID="+testAccountID+"\n")
+	assert.Contains(t, string(env), "SPINIFEX_IMAGE_ID=ami-hooks\n")
+	assert.Contains(t, string(env), "SPINIFEX_PRIVATE_IP=10.0.0.9\n")
+
+	stdin, err := os.ReadFile(record + ".stdin")
+	require.NoError(t, err)
+	var in hookInput
+	require.NoError(t, json.Unmarshal(stdin, &in))
+	assert.Equal(t, hookInput{
+		Event:        hookEventPreLaunch,
+		Node:         daemon.node,
+		InstanceID:   "i-hook-ok",
+		AccountID:    testAccountID,
+		InstanceType: "t3.micro",
+		ImageID:      "ami-hooks",
+		PrivateIP:    "10.0.0.9",
+	}, in)
+}
+
+func TestRunPreLaunchHooks_FailurePolicy(t *testing.T) {
+	daemon := createTestDaemon(t, sharedNATSURL)
+	dir := t.TempDir()
+
+	fail := writeHookScript(t, dir, "fail.sh", `echo "no free VLAN" >&2; exit 3`)
+	slow := writeHookScript(t, dir, "slow.sh", `sleep 10`)
+	touch := writeHookScript(t, dir, "touch.sh", `touch "$0.ran"`)
+
+	t.Run("abort", func(t *testing.T) {
+		daemon.config.Daemon.Hooks.PreLaunch = []config.LifecycleHook{{Command: []string{fail}}, {Command: []string{touch}}}
+		err := daemon.runPreLaunchHooks(hookTestInstance("i-hook-abort"))
+		require.ErrorIs(t, err, errPreLaunchHook)
+		assert.Contains(t, err.Error(), "exit status 3")
+		assert.Contains(t, err.Error(), "no free VLAN")
+		assert.NoFileExists(t, touch+".ran", "hooks after an aborting hook must not run")
+	})
+
+	t.Run("continue", func(t *testing.T) {
+		daemon.config.Daemon.Hooks.PreLaunch = []config.LifecycleHook{
+			{Command: []string{fail}, OnFailure: config.HookOnFailureContinue},
+			{Command: []string{touch}},
+		}
+		require.NoError(t, daemon.runPreLaunchHooks(hookTestInstance("i-hook-continue")))
+		assert.FileExists(t, touch+".ran")
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		daemon.config.Daemon.Hooks.PreLaunch = []config.LifecycleHook{{Command: []string{slow}, TimeoutSeconds: 1}}
+		start := time.Now()
+		err := daemon.runPreLaunchHooks(hookTestInstance("i-hook-timeout"))
+		require.ErrorIs(t, err, errPreLaunchHook)
+		assert.Contains(t, err.Error(), "timed out after 1s")
+		assert.Less(t, time.Since(start), 5*time.Second)
+	})
+}
+
+func TestLaunchInstance_PreLaunchHookAborts(t *testing.T) {
+	daemon := createTestDaemon(t, sharedNATSURL)
+	fail := writeHookScript(t, t.TempDir(), "fail.sh", `exit 1`)
+	daemon.config.Daemon.Hooks.PreLaunch = []config.LifecycleHook{{Command: []string{fail}}}
+
+	err := daemon.LaunchInstance(hookTestInstance("i-hook-launch"))
+	require.ErrorIs(t, err, errPreLaunchHook)
+}
+
+func TestPostTerminateHooks(t *testing.T) {
+	daemon := createDaemonWithJetStream(t)
+	dir := t.TempDir()
+
+	fail := writeHookScript(t, dir, "fail.sh", `exit 1`)
+	record := writeHookScript(t, dir, "record.sh", `echo "$SPINIFEX_HOOK_EVENT $SPINIFEX_INSTANCE_ID" > "$0.out.tmp" && mv "$0.out.tmp" "$0.out"`)
+	daemon.config.Daemon.Hooks.PostTerminate = []config.LifecycleHook{{Command: []string{fail}}, {Command: []string{record}}}
+
+	instance := hookTestInstance("i-hook-terminate")
+	instance.Status = vm.StateShuttingDown
+	daemon.Instances.UpsertVM(instance)
+
+	// A failing hook doesn't hold up or fail the transition, and later hooks still run.
+	require.NoError(t, daemon.TransitionState(instance, vm.StateTerminated))
+	assert.Equal(t, vm.StateTerminated, instance.Status)
+
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(record + ".out")
+		return err == nil
+	}, 5*time.Second, 20*time.Millisecond)
+	out, err := os.ReadFile(record + ".out")
+	require.NoError(t, err)
+	assert.Equal(t, "post-terminate i-hook-terminate", strings.TrimSpace(string(out)))
+}
@@ -0,0 +1,447 @@
+package daemon
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	handlers_iam "github.com/mulgadc/spinifex/spinifex/handlers/iam"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+)
+
+const (
+	imdsTokenHeader    = "X-aws-ec2-metadata-token"
+	imdsTokenTTLHeader = "X-aws-ec2-metadata-token-ttl-seconds"
+
+	// imdsMaxTokenTTL is the longest an IMDSv2 session token lives, as on AWS.
+	imdsMaxTokenTTL = 21600
+
+	// imdsCredentialRefresh is how long before they expire cached instance
+	// profile credentials are replaced, so a guest never receives
+	// credentials about to lapse.
+	imdsCredentialRefresh = 15 * time.Minute
+
+	imdsCredentialsTimeout = 5 * time.Second
+
+	// imdsPhoneHomePath is where guests that can't reach the gateway report
+	// cloud-init completion.
+	imdsPhoneHomePath = "/phone-home"
+)
+
+// imdsInstance is what the metadata service serves about one instance,
+// copied from its VM record under the instances lock.
+type imdsInstance struct {
+	id                 string
+	accountID          string
+	imageID            string
+	instanceType       string
+	localIPv4          string
+	instanceProfileArn string
+	tokensRequired     bool
+	disabled           bool
+}
+
+// cachedCredentials are instance profile credentials and when they were
+// fetched.
+type cachedCredentials struct {
+	creds       *handlers_iam.InstanceCredentials
+	expiration  time.Time
+	lastUpdated time.Time
+}
+
+// IMDS serves the instance metadata service to the guests on this node. A
+// guest is identified by the source address of its request together with
+// the MAC address the host's neighbour table holds for it: private
+// addresses repeat across VPCs and accounts, but an ENI's MAC does not, so
+// the pair picks out one running instance here. Instances launched
+// with an instance profile get its role's temporary credentials under
+// iam/security-credentials/, fetched from the gateways over NATS.
+type IMDS struct {
+	instances *vm.Instances
+	now       func() time.Time
+
+	// fetch obtains fresh credentials for an instance's instance profile.
+	fetch func(inst imdsInstance) (*handlers_iam.InstanceCredentials, error)
+
+	// neighborMACs returns the MAC addresses the host has resolved ip to.
+	neighborMACs func(ip string) ([]string, error)
+
+	// phoneHome records a guest's cloud-init completion, reporting whether
+	// the token matched. Nil refuses phone-home.
+	phoneHome func(instanceID, token string) (found, valid bool)
+
+	// tokenKey signs IMDSv2 session tokens. Tokens do not survive a daemon
+	// restart, as on AWS they do not survive an instance stop.
+	tokenKey []byte
+
+	mu    sync.Mutex
+	creds map[string]*cachedCredentials // by instance ID
+}
+
+// newIMDS returns the metadata service for the daemon's instances.
+func (d *Daemon) newIMDS() (*IMDS, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("generate IMDS token key: %w", err)
+	}
+	return &IMDS{
+		instances:    &d.Instances,
+		now:          utils.Now,
+		tokenKey:     key,
+		creds:        make(map[string]*cachedCredentials),
+		neighborMACs: procNeighborMACs,
+		phoneHome:    d.recordPhoneHome,
+		fetch: func(inst imdsInstance) (*handlers_iam.InstanceCredentials, error) {
+			return utils.NATSRequest[handlers_iam.InstanceCredentials](d.natsConn,
+				handlers_iam.InstanceCredentialsSubject,
+				handlers_iam.InstanceCredentialsRequest{InstanceID: inst.id, InstanceProfileArn: inst.instanceProfileArn},
+				imdsCredentialsTimeout, inst.accountID)
+		},
+	}, nil
+}
+
+// startIMDS starts the metadata service on daemon.imds_listen, if set.
+func (d *Daemon) startIMDS() error {
+	addr := d.config.Daemon.IMDSListen
+	if addr == "" {
+		return nil
+	}
+	imds, err := d.newIMDS()
+	if err != nil {
+		return err
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("metadata service listen on %s: %w", addr, err)
+	}
+	d.imdsServer = &http.Server{
+		Addr:              addr,
+		Handler:           imds,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		slog.Info("Starting instance metadata service", "addr", addr)
+		if err := d.imdsServer.Serve(ln); err != nil && err != http.ErrServerClosed {
+			slog.Error("Instance metadata service failed", "error", err)
+		}
+	}()
+	return nil
+}
+
+func (m *IMDS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	inst, ok := m.instanceFor(r.RemoteAddr)
+	if !ok {
+		slog.Debug("IMDS: request from unknown address", "remote", r.RemoteAddr)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if inst.disabled {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if r.URL.Path == "/latest/api/token" {
+		m.serveToken(w, r, inst)
+		return
+	}
+	if rest, ok := strings.CutPrefix(r.URL.Path, imdsPhoneHomePath+"/"); ok {
+		m.servePhoneHome(w, r, inst, rest)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// IMDSv2: a token, if presented, must be valid. Without one the request
+	// is IMDSv1, which the instance may require be refused.
+	if token := r.Header.Get(imdsTokenHeader); token != "" {
+		if !m.validToken(token, inst.id) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	} else if inst.tokensRequired {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	path, ok := strings.CutPrefix(r.URL.Path, "/latest/meta-data/")
+	if !ok {
+		if r.URL.Path == "/latest/meta-data" || r.URL.Path == "/latest/" || r.URL.Path == "/latest" {
+			http.Redirect(w, r, "/latest/meta-data/", http.StatusMovedPermanently)
+			return
+		}
+		http.NotFound(w, r)
+		return
+	}
+	m.serveMetadata(w, r, inst, path)
+}
+
+// servePhoneHome accepts cloud-init's phone_home POST to
+// /phone-home/{instanceId}/{token}, for guests that can't reach the gateway.
+// A guest may only report for itself. cloud-init sends no IMDSv2 token, and
+// the phone-home token authenticates the report instead.
+func (m *IMDS) servePhoneHome(w http.ResponseWriter, r *http.Request, inst imdsInstance, rest string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	instanceID, token, ok := strings.Cut(rest, "/")
+	if !ok || instanceID != inst.id || m.phoneHome == nil {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	if _, valid := m.phoneHome(instanceID, token); !valid {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	writeIMDSText(w, "")
+}
+
+// serveToken issues an IMDSv2 session token bound to the instance.
+func (m *IMDS) serveToken(w http.ResponseWriter, r *http.Request, inst imdsInstance) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// A forwarded token request came through a proxy on the guest, which
+	// must not be able to obtain tokens on the guest's behalf.
+	if r.Header.Get("X-Forwarded-For") != "" {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	ttl, err := strconv.Atoi(r.Header.Get(imdsTokenTTLHeader))
+	if err != nil || ttl < 1 || ttl > imdsMaxTokenTTL {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	expires := m.now().Add(time.Duration(ttl) * time.Second).Unix()
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set(imdsTokenTTLHeader, strconv.Itoa(ttl))
+	_, _ = w.Write([]byte(m.signToken(inst.id, expires)))
+}
+
+func (m *IMDS) signToken(instanceID string, expires int64) string {
+	exp := strconv.FormatInt(expires, 10)
+	mac := hmac.New(sha256.New, m.tokenKey)
+	mac.Write([]byte(instanceID + ":" + exp))
+	return exp + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// validToken reports whether token was issued to instanceID and is unexpired.
+func (m *IMDS) validToken(token, instanceID string) bool {
+	exp, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	expires, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || m.now().Unix() >= expires {
+		return false
+	}
+	return hmac.Equal([]byte(token), []byte(m.signToken(instanceID, expires)))
+}
+
+func (m *IMDS) serveMetadata(w http.ResponseWriter, r *http.Request, inst imdsInstance, path string) {
+	switch path {
+	case "":
+		entries := []string{"ami-id", "instance-id", "instance-type", "local-ipv4"}
+		if inst.instanceProfileArn != "" {
+			entries = append(entries, "iam/")
+		}
+		writeIMDSText(w, strings.Join(entries, "\n"))
+		return
+	case "ami-id":
+		writeIMDSText(w, inst.imageID)
+		return
+	case "instance-id":
+		writeIMDSText(w, inst.id)
+		return
+	case "instance-type":
+		writeIMDSText(w, inst.instanceType)
+		return
+	case "local-ipv4":
+		writeIMDSText(w, inst.localIPv4)
+		return
+	}
+
+	// Everything else is under iam/, which exists only for instances
+	// launched with an instance profile.
+	if inst.instanceProfileArn == "" || (path != "iam" && !strings.HasPrefix(path, "iam/")) {
+		http.NotFound(w, r)
+		return
+	}
+	if path == "iam" || path == "iam/" {
+		writeIMDSText(w, "info\nsecurity-credentials/")
+		return
+	}
+
+	cached, err := m.credentials(inst)
+	if err != nil {
+		slog.Warn("IMDS: failed to get instance profile credentials", "instanceId", inst.id, "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	lastUpdated := cached.lastUpdated.UTC().Format(time.RFC3339)
+
+	switch path {
+	case "iam/info":
+		writeIMDSJSON(w, map[string]string{
+			"Code":               "Success",
+			"LastUpdated":        lastUpdated,
+			"InstanceProfileArn": inst.instanceProfileArn,
+		})
+	case "iam/security-credentials", "iam/security-credentials/":
+		writeIMDSText(w, cached.creds.RoleName)
+	case "iam/security-credentials/" + cached.creds.RoleName:
+		writeIMDSJSON(w, map[string]string{
+			"Code":            "Success",
+			"LastUpdated":     lastUpdated,
+			"Type":            "AWS-HMAC",
+			"AccessKeyId":     cached.creds.AccessKeyID,
+			"SecretAccessKey": cached.creds.SecretAccessKey,
+			"Token":           cached.creds.SessionToken,
+			"Expiration":      cached.creds.Expiration,
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// credentials returns the instance's cached profile credentials, fetching
+// new ones when there are none or they are close to expiring.
+func (m *IMDS) credentials(inst imdsInstance) (*cachedCredentials, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if cached, ok := m.creds[inst.id]; ok && cached.expiration.Sub(now) > imdsCredentialRefresh {
+		return cached, nil
+	}
+
+	creds, err := m.fetch(inst)
+	if err != nil {
+		return nil, err
+	}
+	expiration, err := time.Parse(time.RFC3339, creds.Expiration)
+	if err != nil {
+		return nil, fmt.Errorf("parse credentials expiration: %w", err)
+	}
+	cached := &cachedCredentials{creds: creds, expiration: expiration, lastUpdated: now}
+	m.creds[inst.id] = cached
+	return cached, nil
+}
+
+// instanceFor returns the running instance a request from remoteAddr came
+// from: the one whose private IPv4 address is the source address and whose
+// ENI has the MAC the host reached that address at. It refuses to choose
+// when the source matches no instance, or more than one.
+func (m *IMDS) instanceFor(remoteAddr string) (imdsInstance, bool) {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return imdsInstance{}, false
+	}
+
+	macs, err := m.neighborMACs(host)
+	if err != nil {
+		slog.Warn("IMDS: failed to look up neighbour address", "ip", host, "err", err)
+		return imdsInstance{}, false
+	}
+
+	m.instances.Mu.Lock()
+	defer m.instances.Mu.Unlock()
+	var matched []*vm.VM
+	for _, v := range m.instances.VMS {
+		if v.Status != vm.StateRunning || v.Instance == nil || aws.StringValue(v.Instance.PrivateIpAddress) != host {
+			continue
+		}
+		if v.ENIMac == "" || !slices.ContainsFunc(macs, func(mac string) bool { return strings.EqualFold(mac, v.ENIMac) }) {
+			continue
+		}
+		matched = append(matched, v)
+	}
+	if len(matched) != 1 {
+		if len(matched) > 1 {
+			slog.Warn("IMDS: request matches more than one instance, refusing", "ip", host, "instances", len(matched))
+		}
+		return imdsInstance{}, false
+	}
+
+	v := matched[0]
+	inst := imdsInstance{
+		id:           v.ID,
+		accountID:    v.AccountID,
+		imageID:      aws.StringValue(v.Instance.ImageId),
+		instanceType: aws.StringValue(v.Instance.InstanceType),
+		localIPv4:    host,
+		disabled:     metadataEndpointDisabled(v),
+	}
+	if opts := v.Instance.MetadataOptions; opts != nil {
+		inst.tokensRequired = aws.StringValue(opts.HttpTokens) == "required"
+	}
+	if profile := v.Instance.IamInstanceProfile; profile != nil {
+		inst.instanceProfileArn = aws.StringValue(profile.Arn)
+	}
+	return inst, true
+}
+
+// procNeighborPath is the kernel's IPv4 neighbour (ARP) table.
+const procNeighborPath = "/proc/net/arp"
+
+// procNeighborMACs returns the MACs of the complete entries for ip in the
+// host's ARP table. The host has one for any guest it has exchanged packets
+// with, so for the source of an accepted connection.
+func procNeighborMACs(ip string) ([]string, error) {
+	data, err := os.ReadFile(procNeighborPath)
+	if err != nil {
+		return nil, err
+	}
+	return parseNeighborMACs(string(data), ip), nil
+}
+
+// parseNeighborMACs returns the MACs of the complete entries for ip in
+// the contents of /proc/net/arp.
+func parseNeighborMACs(table, ip string) []string {
+	var macs []string
+	lines := strings.Split(table, "\n")
+	for _, line := range lines[min(1, len(lines)):] { // skip the header
+		// IP address, HW type, Flags, HW address, Mask, Device
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[0] != ip || fields[2] == "0x0" {
+			continue
+		}
+		macs = append(macs, fields[3])
+	}
+	return macs
+}
+
+func writeIMDSText(w http.ResponseWriter, body string) {
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write([]byte(body))
+}
+
+func writeIMDSJSON(w http.ResponseWriter, body any) {
+	data, err := json.MarshalIndent(body, "", "  ")
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	_, _ = w.Write(data)
+}
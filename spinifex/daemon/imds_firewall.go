@@ -0,0 +1,226 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+)
+
+// Addresses of the instance metadata service, as AWS publishes them.
+const (
+	imdsIPv4 = "169.254.169.254"
+	imdsIPv6 = "fd00:ec2::254"
+)
+
+// MetadataFirewall blocks a guest from reaching the instance metadata
+// service at the host, so an instance with its metadata endpoint disabled
+// can't reach it even through an SSRF bug in software it runs.
+// The live implementation uses nftables; tests use a mock.
+type MetadataFirewall interface {
+	// BlockMetadata drops traffic from the guest behind tap to the
+	// metadata addresses.
+	BlockMetadata(tap string) error
+
+	// AllowMetadata removes the block. It succeeds when there is none.
+	AllowMetadata(tap string) error
+}
+
+// NFTMetadataFirewall implements MetadataFirewall with one nftables netdev
+// table per tap. Its chain hooks the tap's ingress, which sees every frame
+// the guest sends before OVS switches it.
+//
+// It remembers which taps it has blocked, starting from the tables already
+// on the host, so allowing a tap that was never blocked - every VPC
+// instance start - doesn't run nft.
+type NFTMetadataFirewall struct {
+	mu sync.Mutex
+	// blocked is the set of taps with a block installed, or nil until the
+	// host's tables have been listed.
+	blocked map[string]bool
+}
+
+var _ MetadataFirewall = (*NFTMetadataFirewall)(nil)
+
+func (f *NFTMetadataFirewall) BlockMetadata(tap string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.loadBlocked()
+
+	if err := runNFT(imdsBlockRuleset(tap)); err != nil {
+		return fmt.Errorf("block metadata on %s: %w", tap, err)
+	}
+	if f.blocked != nil {
+		f.blocked[tap] = true
+	}
+	slog.Info("Metadata endpoint blocked", "tap", tap)
+	return nil
+}
+
+func (f *NFTMetadataFirewall) AllowMetadata(tap string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.loadBlocked()
+
+	// Without the host's tables to go by, remove the block regardless.
+	if f.blocked != nil && !f.blocked[tap] {
+		return nil
+	}
+	if err := runNFT(imdsAllowRuleset(tap)); err != nil {
+		return fmt.Errorf("allow metadata on %s: %w", tap, err)
+	}
+	delete(f.blocked, tap)
+	slog.Info("Metadata endpoint allowed", "tap", tap)
+	return nil
+}
+
+// loadBlocked lists the blocks already on the host, left by an earlier run
+// of the daemon, the first time it succeeds. f.mu must be held.
+func (f *NFTMetadataFirewall) loadBlocked() {
+	if f.blocked != nil {
+		return
+	}
+	out, err := sudoCommand("nft", "list", "tables", "netdev").Output()
+	if err != nil {
+		slog.Warn("Failed to list nftables tables, metadata blocks will be removed unconditionally", "err", err)
+		return
+	}
+	f.blocked = parseIMDSTables(string(out))
+}
+
+// parseIMDSTables returns the taps with a metadata block among the tables
+// "nft list tables" printed.
+func parseIMDSTables(out string) map[string]bool {
+	taps := make(map[string]bool)
+	prefix := imdsTableName("")
+	for line := range strings.Lines(out) {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[0] != "table" || fields[1] != "netdev" {
+			continue
+		}
+		if tap, ok := strings.CutPrefix(fields[2], prefix); ok && tap != "" {
+			taps[tap] = true
+		}
+	}
+	return taps
+}
+
+// imdsTableName returns the nftables table holding the block for tap.
+func imdsTableName(tap string) string {
+	return "spinifex_imds_" + tap
+}
+
+// imdsBlockRuleset returns the nft script blocking the metadata addresses
+// on tap. Declaring and deleting the table first makes it replace any
+// earlier block atomically. ARP for the IPv4 address is dropped too, so the
+// guest can't learn a next hop for it.
+func imdsBlockRuleset(tap string) string {
+	table := imdsTableName(tap)
+	return fmt.Sprintf(`table netdev %[1]s
+delete table netdev %[1]s
+table netdev %[1]s {
+	chain ingress {
+		type filter hook ingress device "%[2]s" priority -500; policy accept;
+		ip daddr %[3]s drop
+		ip6 daddr %[4]s drop
+		arp operation request arp daddr ip %[3]s drop
+	}
+}
+`, table, tap, imdsIPv4, imdsIPv6)
+}
+
+// imdsAllowRuleset returns the nft script removing the block on tap,
+// declaring the table first so deleting a missing one isn't an error.
+func imdsAllowRuleset(tap string) string {
+	table := imdsTableName(tap)
+	return fmt.Sprintf("table netdev %[1]s\ndelete table netdev %[1]s\n", table)
+}
+
+// runNFT applies an nft script in one transaction.
+func runNFT(script string) error {
+	cmd := sudoCommand("nft", "-f", "-")
+	cmd.Stdin = strings.NewReader(script)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("nft: %s: %w", strings.TrimSpace(string(out)), err)
+	}
+	return nil
+}
+
+// metadataEndpointDisabled reports whether the instance's metadata
+// endpoint has been disabled.
+func metadataEndpointDisabled(instance *vm.VM) bool {
+	return instance.Instance != nil && instance.Instance.MetadataOptions != nil &&
+		instance.Instance.MetadataOptions.HttpEndpoint != nil &&
+		*instance.Instance.MetadataOptions.HttpEndpoint == ec2.InstanceMetadataEndpointStateDisabled
+}
+
+// errMetadataFirewallVF is returned when an instance whose primary ENI is
+// an SR-IOV VF is to have its metadata endpoint disabled: the VF bypasses
+// the host, so there is no tap to block it at.
+var errMetadataFirewallVF = errors.New("primary interface is an SR-IOV VF with no tap to firewall")
+
+// metadataTaps returns the tap devices of the instance's VPC interfaces: its
+// primary ENI's, unless an SR-IOV VF carries it, and those of its extra
+// ENIs. Callers hold d.Instances.Mu or own the instance.
+func metadataTaps(instance *vm.VM) []string {
+	if instance.ENIId == "" {
+		return nil
+	}
+	var taps []string
+	if instance.SRIOVVF == "" {
+		taps = append(taps, TapDeviceName(instance.ENIId))
+	}
+	for _, extra := range instance.ExtraENIs {
+		taps = append(taps, TapDeviceName(extra.ENIID))
+	}
+	return taps
+}
+
+// applyMetadataFirewall blocks or allows the metadata service on every tap
+// the instance owns to match its metadata options. Instances without a VPC
+// tap use QEMU user networking, which has no host firewall to enforce this
+// at. An instance whose primary ENI is a VF can't have its endpoint
+// blocked, so disabling it there fails closed.
+func (d *Daemon) applyMetadataFirewall(instance *vm.VM) error {
+	if instance.ENIId == "" || d.metadataFirewall == nil {
+		if metadataEndpointDisabled(instance) {
+			slog.Warn("Metadata endpoint disabled but instance has no VPC tap to firewall", "instanceId", instance.ID)
+		}
+		return nil
+	}
+	disabled := metadataEndpointDisabled(instance)
+	if disabled && instance.SRIOVVF != "" {
+		return errMetadataFirewallVF
+	}
+	return d.setMetadataFirewall(metadataTaps(instance), disabled)
+}
+
+// applyMetadataFirewallToTap blocks or allows the metadata service on one of
+// the instance's taps, for a tap created after the instance's others.
+func (d *Daemon) applyMetadataFirewallToTap(instance *vm.VM, tap string) error {
+	if d.metadataFirewall == nil {
+		return nil
+	}
+	return d.setMetadataFirewall([]string{tap}, metadataEndpointDisabled(instance))
+}
+
+// setMetadataFirewall blocks the metadata service on taps, or allows it,
+// stopping at the first tap that fails.
+func (d *Daemon) setMetadataFirewall(taps []string, disabled bool) error {
+	for _, tap := range taps {
+		var err error
+		if disabled {
+			err = d.metadataFirewall.BlockMetadata(tap)
+		} else {
+			err = d.metadataFirewall.AllowMetadata(tap)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,306 @@
+package daemon
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// MockMetadataFirewall records the taps blocked and allowed.
+type MockMetadataFirewall struct {
+	Blocked  []string
+	Allowed  []string
+	BlockErr error
+}
+
+var _ MetadataFirewall = (*MockMetadataFirewall)(nil)
+
+func (m *MockMetadataFirewall) BlockMetadata(tap string) error {
+	m.Blocked = append(m.Blocked, tap)
+	return m.BlockErr
+}
+
+func (m *MockMetadataFirewall) AllowMetadata(tap string) error {
+	m.Allowed = append(m.Allowed, tap)
+	return nil
+}
+
+// captureNFT stubs sudoCommand so nft scripts are written to a file instead
+// of the host firewall, and returns a function reading the last one back.
+func captureNFT(t *testing.T) func() (args []string, script string) {
+	t.Helper()
+	out := filepath.Join(t.TempDir(), "nft")
+	var gotArgs []string
+
+	orig := sudoCommand
+	t.Cleanup(func() { sudoCommand = orig })
+	sudoCommand = func(name string, args ...string) *exec.Cmd {
+		gotArgs = append([]string{name}, args...)
+		return exec.Command("sh", "-c", `cat > "$0"`, out)
+	}
+
+	return func() ([]string, string) {
+		data, err := os.ReadFile(out)
+		require.NoError(t, err)
+		return gotArgs, string(data)
+	}
+}
+
+func TestNFTMetadataFirewall_BlocksLinkLocalOnTap(t *testing.T) {
+	last := captureNFT(t)
+	tap := TapDeviceName("eni-abc123def456789")
+
+	fw := &NFTMetadataFirewall{}
+	require.NoError(t, fw.BlockMetadata(tap))
+
+	args, script := last()
+	assert.Equal(t, []string{"nft", "-f", "-"}, args)
+	assert.Contains(t, script, "table netdev spinifex_imds_"+tap+" {")
+	assert.Contains(t, script, `type filter hook ingress device "`+tap+`"`)
+	assert.Contains(t, script, "ip daddr 169.254.169.254 drop")
+	assert.Contains(t, script, "ip6 daddr fd00:ec2::254 drop")
+	assert.Contains(t, script, "arp daddr ip 169.254.169.254 drop")
+	// The block replaces any earlier one rather than stacking on it.
+	assert.Less(t, strings.Index(script, "delete table netdev spinifex_imds_"+tap), strings.Index(script, "chain ingress"))
+
+	require.NoError(t, fw.AllowMetadata(tap))
+	_, script = last()
+	assert.Equal(t, "table netdev spinifex_imds_"+tap+"\ndelete table netdev spinifex_imds_"+tap+"\n", script)
+}
+
+func TestNFTMetadataFirewall_AllowOnlyRemovesBlocks(t *testing.T) {
+	var calls [][]string
+	orig := sudoCommand
+	t.Cleanup(func() { sudoCommand = orig })
+	sudoCommand = func(name string, args ...string) *exec.Cmd {
+		calls = append(calls, append([]string{name}, args...))
+		// A block left on the host by an earlier run of the daemon.
+		return exec.Command("echo", "table netdev spinifex_imds_tapold\ntable inet filter")
+	}
+
+	fw := &NFTMetadataFirewall{}
+	require.NoError(t, fw.AllowMetadata("tapnew"))
+	require.NoError(t, fw.AllowMetadata("tapnew"))
+	assert.Equal(t, [][]string{{"nft", "list", "tables", "netdev"}}, calls, "no nft run for a tap never blocked")
+
+	require.NoError(t, fw.AllowMetadata("tapold"))
+	assert.Len(t, calls, 2)
+	require.NoError(t, fw.AllowMetadata("tapold"))
+	assert.Len(t, calls, 2, "the block is gone")
+}
+
+func TestParseIMDSTables(t *testing.T) {
+	out := "table netdev spinifex_imds_tapabc\ntable netdev other\ntable inet filter\ntable netdev spinifex_imds_\n"
+	assert.Equal(t, map[string]bool{"tapabc": true}, parseIMDSTables(out))
+}
+
+func TestNFTMetadataFirewall_Error(t *testing.T) {
+	orig := sudoCommand
+	t.Cleanup(func() { sudoCommand = orig })
+	sudoCommand = func(string, ...string) *exec.Cmd {
+		return exec.Command("/bin/false")
+	}
+
+	assert.Error(t, (&NFTMetadataFirewall{}).BlockMetadata("tapabc"))
+}
+
+func TestApplyMetadataFirewall(t *testing.T) {
+	fw := &MockMetadataFirewall{}
+	d := &Daemon{metadataFirewall: fw}
+	tap := TapDeviceName("eni-abc123")
+
+	instance := &vm.VM{
+		ID:       "i-imds",
+		ENIId:    "eni-abc123",
+		Instance: &ec2.Instance{},
+	}
+	setMetadataOptions(instance.Instance, &types.MetadataOptionsData{HttpEndpoint: ec2.InstanceMetadataEndpointStateDisabled})
+	require.NoError(t, d.applyMetadataFirewall(instance))
+	assert.Equal(t, []string{tap}, fw.Blocked)
+
+	setMetadataOptions(instance.Instance, &types.MetadataOptionsData{HttpEndpoint: ec2.InstanceMetadataEndpointStateEnabled})
+	require.NoError(t, d.applyMetadataFirewall(instance))
+	assert.Equal(t, []string{tap}, fw.Allowed)
+
+	// Without a VPC tap there is nothing to firewall.
+	instance.ENIId = ""
+	require.NoError(t, d.applyMetadataFirewall(instance))
+	assert.Len(t, fw.Blocked, 1)
+	assert.Len(t, fw.Allowed, 1)
+}
+
+func TestHandleModifyMetadataOptions_RunningInstance(t *testing.T) {
+	d, cleanup := newTestDaemon(t)
+	defer cleanup()
+	fw := &MockMetadataFirewall{}
+	d.metadataFirewall = fw
+
+	instanceID := "i-imds-001"
+	d.Instances.VMS[instanceID] = &vm.VM{
+		ID:        instanceID,
+		Status:    vm.StateRunning,
+		AccountID: testAccountID,
+		ENIId:     "eni-imds001",
+		Instance:  &ec2.Instance{InstanceId: aws.String(instanceID)},
+	}
+
+	topic := "test.ec2.cmd." + t.Name()
+	sub, err := d.natsConn.Subscribe(topic, d.handleEC2Events)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	modify := func(endpoint string) *ec2.ModifyInstanceMetadataOptionsOutput {
+		t.Helper()
+		reqData, _ := json.Marshal(types.EC2InstanceCommand{
+			ID:              instanceID,
+			Attributes:      types.EC2CommandAttributes{ModifyMetadataOptions: true},
+			MetadataOptions: &types.MetadataOptionsData{HttpEndpoint: endpoint},
+		})
+		reply, err := natsRequest(d.natsConn, topic, reqData, 5*time.Second)
+		require.NoError(t, err)
+		var output ec2.ModifyInstanceMetadataOptionsOutput
+		require.NoError(t, json.Unmarshal(reply.Data, &output))
+		return &output
+	}
+
+	output := modify(ec2.InstanceMetadataEndpointStateDisabled)
+	require.NotNil(t, output.InstanceMetadataOptions)
+	assert.Equal(t, ec2.InstanceMetadataEndpointStateDisabled, *output.InstanceMetadataOptions.HttpEndpoint)
+	assert.Equal(t, []string{TapDeviceName("eni-imds001")}, fw.Blocked)
+	assert.True(t, metadataEndpointDisabled(d.Instances.VMS[instanceID]))
+
+	output = modify(ec2.InstanceMetadataEndpointStateEnabled)
+	assert.Equal(t, ec2.InstanceMetadataEndpointStateEnabled, *output.InstanceMetadataOptions.HttpEndpoint)
+	assert.Equal(t, []string{TapDeviceName("eni-imds001")}, fw.Allowed)
+
+	// A firewall failure leaves the options as they were.
+	fw.BlockErr = assert.AnError
+	reqData, _ := json.Marshal(types.EC2InstanceCommand{
+		ID:              instanceID,
+		Attributes:      types.EC2CommandAttributes{ModifyMetadataOptions: true},
+		MetadataOptions: &types.MetadataOptionsData{HttpEndpoint: ec2.InstanceMetadataEndpointStateDisabled},
+	})
+	reply, err := natsRequest(d.natsConn, topic, reqData, 5*time.Second)
+	require.NoError(t, err)
+	assert.Contains(t, string(reply.Data), awserrors.ErrorServerInternal)
+	assert.False(t, metadataEndpointDisabled(d.Instances.VMS[instanceID]))
+}
+
+func TestApplyMetadataFirewall_ExtraENIs(t *testing.T) {
+	fw := &MockMetadataFirewall{}
+	d := &Daemon{metadataFirewall: fw}
+	instance := &vm.VM{
+		ID:    "i-imds-multi",
+		ENIId: "eni-primary",
+		ExtraENIs: []vm.ExtraENI{
+			{ENIID: "eni-extra1"},
+			{ENIID: "eni-extra2"},
+		},
+		Instance: &ec2.Instance{},
+	}
+	taps := []string{TapDeviceName("eni-primary"), TapDeviceName("eni-extra1"), TapDeviceName("eni-extra2")}
+
+	setMetadataOptions(instance.Instance, &types.MetadataOptionsData{HttpEndpoint: ec2.InstanceMetadataEndpointStateDisabled})
+	require.NoError(t, d.applyMetadataFirewall(instance))
+	assert.Equal(t, taps, fw.Blocked)
+
+	setMetadataOptions(instance.Instance, &types.MetadataOptionsData{HttpEndpoint: ec2.InstanceMetadataEndpointStateEnabled})
+	require.NoError(t, d.applyMetadataFirewall(instance))
+	assert.Equal(t, taps, fw.Allowed)
+
+	// A VF primary has no tap; its extra ENIs' taps are still allowed, but
+	// disabling the endpoint fails closed.
+	fw.Blocked, fw.Allowed = nil, nil
+	instance.SRIOVVF = "0000:3b:02.0"
+	require.NoError(t, d.applyMetadataFirewall(instance))
+	assert.Equal(t, taps[1:], fw.Allowed)
+
+	setMetadataOptions(instance.Instance, &types.MetadataOptionsData{HttpEndpoint: ec2.InstanceMetadataEndpointStateDisabled})
+	assert.ErrorIs(t, d.applyMetadataFirewall(instance), errMetadataFirewallVF)
+	assert.Empty(t, fw.Blocked)
+}
+
+func TestSetupExtraENINICs_MetadataFirewall(t *testing.T) {
+	fw := &MockMetadataFirewall{}
+	plumber := &MockNetworkPlumber{}
+	d := &Daemon{networkPlumber: plumber, metadataFirewall: fw}
+	instance := &vm.VM{
+		ID:    "i-imds-extra",
+		ENIId: "eni-primary",
+		ExtraENIs: []vm.ExtraENI{
+			{ENIID: "eni-extra1", ENIMac: "02:00:00:aa:aa:aa"},
+			{ENIID: "eni-extra2", ENIMac: "02:00:00:bb:bb:bb"},
+		},
+		Instance: &ec2.Instance{},
+	}
+	setMetadataOptions(instance.Instance, &types.MetadataOptionsData{HttpEndpoint: ec2.InstanceMetadataEndpointStateDisabled})
+
+	require.NoError(t, d.setupExtraENINICs(instance))
+	assert.Equal(t, []string{TapDeviceName("eni-extra1"), TapDeviceName("eni-extra2")}, fw.Blocked)
+
+	// A tap that can't be firewalled is removed and the launch fails.
+	fw.Blocked, fw.BlockErr = nil, assert.AnError
+	instance.Config = vm.Config{}
+	require.Error(t, d.setupExtraENINICs(instance))
+	assert.Equal(t, []string{"eni-extra1"}, plumber.CleanupCalls)
+	assert.Empty(t, instance.Config.NetDevs)
+}
+
+func TestHandleModifyMetadataOptions_MultiENI(t *testing.T) {
+	d, cleanup := newTestDaemon(t)
+	defer cleanup()
+	fw := &MockMetadataFirewall{}
+	d.metadataFirewall = fw
+
+	const instanceID = "i-imds-002"
+	d.Instances.VMS[instanceID] = &vm.VM{
+		ID:        instanceID,
+		Status:    vm.StateRunning,
+		AccountID: testAccountID,
+		ENIId:     "eni-imds002",
+		ExtraENIs: []vm.ExtraENI{{ENIID: "eni-imds002b", AttachmentID: "eni-attach-1"}},
+		Instance:  &ec2.Instance{InstanceId: aws.String(instanceID)},
+	}
+
+	topic := "test.ec2.cmd." + t.Name()
+	sub, err := d.natsConn.Subscribe(topic, d.handleEC2Events)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	modify := func(endpoint string) string {
+		t.Helper()
+		reqData, _ := json.Marshal(types.EC2InstanceCommand{
+			ID:              instanceID,
+			Attributes:      types.EC2CommandAttributes{ModifyMetadataOptions: true},
+			MetadataOptions: &types.MetadataOptionsData{HttpEndpoint: endpoint},
+		})
+		reply, err := natsRequest(d.natsConn, topic, reqData, 5*time.Second)
+		require.NoError(t, err)
+		return string(reply.Data)
+	}
+
+	modify(ec2.InstanceMetadataEndpointStateDisabled)
+	assert.Equal(t, []string{TapDeviceName("eni-imds002"), TapDeviceName("eni-imds002b")}, fw.Blocked)
+
+	modify(ec2.InstanceMetadataEndpointStateEnabled)
+	assert.Equal(t, []string{TapDeviceName("eni-imds002"), TapDeviceName("eni-imds002b")}, fw.Allowed)
+
+	// With a VF primary the endpoint can't be disabled.
+	fw.Blocked = nil
+	d.Instances.VMS[instanceID].SRIOVVF = "0000:3b:02.0"
+	assert.Contains(t, modify(ec2.InstanceMetadataEndpointStateDisabled), awserrors.ErrorUnsupportedOperation)
+	assert.Empty(t, fw.Blocked)
+	assert.False(t, metadataEndpointDisabled(d.Instances.VMS[instanceID]))
+}
@@ -0,0 +1,346 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/config"
+	handlers_ec2_instance "github.com/mulgadc/spinifex/spinifex/handlers/ec2/instance"
+	handlers_iam "github.com/mulgadc/spinifex/spinifex/handlers/iam"
+	"github.com/mulgadc/spinifex/spinifex/objectstore"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testIMDSInstanceIP  = "10.0.1.5"
+	testIMDSInstanceMAC = "02:00:00:0a:00:05"
+	testIMDSProfileArn  = "arn:aws:iam::000000000001:instance-profile/web"
+)
+
+// newTestIMDS returns a metadata service for one running instance at
+// testIMDSInstanceIP, with a clock the test controls and a credential fetch
+// that counts its calls.
+func newTestIMDS(t *testing.T, profileArn string) (*IMDS, *vm.VM, *time.Time, *int) {
+	t.Helper()
+	instance := &vm.VM{
+		ID:        "i-0imds0000000001",
+		AccountID: "000000000001",
+		Status:    vm.StateRunning,
+		ENIMac:    testIMDSInstanceMAC,
+		Instance: &ec2.Instance{
+			InstanceId:       aws.String("i-0imds0000000001"),
+			ImageId:          aws.String("ami-0123456789abcdef0"),
+			InstanceType:     aws.String("t3.micro"),
+			PrivateIpAddress: aws.String(testIMDSInstanceIP),
+		},
+	}
+	if profileArn != "" {
+		instance.Instance.IamInstanceProfile = &ec2.IamInstanceProfile{Arn: aws.String(profileArn)}
+	}
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	fetches := 0
+	m := &IMDS{
+		instances: &vm.Instances{VMS: map[string]*vm.VM{instance.ID: instance}},
+		now:       func() time.Time { return now },
+		tokenKey:  []byte("test-token-key"),
+		creds:     make(map[string]*cachedCredentials),
+		neighborMACs: func(ip string) ([]string, error) {
+			if ip == testIMDSInstanceIP {
+				return []string{testIMDSInstanceMAC}, nil
+			}
+			return nil, nil
+		},
+		fetch: func(inst imdsInstance) (*handlers_iam.InstanceCredentials, error) {
+			fetches++
+			if inst.instanceProfileArn != testIMDSProfileArn {
+				return nil, errors.New("unexpected instance profile")
+			}
+			return &handlers_iam.InstanceCredentials{
+				RoleName:        "web-role",
+				AccessKeyID:     "ASIAEXAMPLE0000000" + string(rune('0'+fetches)),
+				SecretAccessKey: "secret",
+				SessionToken:    "token",
+				Expiration:      now.Add(6 * time.Hour).Format(time.RFC3339),
+			}, nil
+		},
+	}
+	return m, instance, &now, &fetches
+}
+
+func imdsGet(m *IMDS, path, token string) *http.Response {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = testIMDSInstanceIP + ":40000"
+	if token != "" {
+		req.Header.Set(imdsTokenHeader, token)
+	}
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, req)
+	return w.Result()
+}
+
+func imdsToken(t *testing.T, m *IMDS, ttl string) string {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPut, "/latest/api/token", nil)
+	req.RemoteAddr = testIMDSInstanceIP + ":40000"
+	req.Header.Set(imdsTokenTTLHeader, ttl)
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	return w.Body.String()
+}
+
+func TestIMDS_InstanceMetadata(t *testing.T) {
+	m, _, _, _ := newTestIMDS(t, "")
+
+	tests := map[string]string{
+		"/latest/meta-data/instance-id":   "i-0imds0000000001",
+		"/latest/meta-data/ami-id":        "ami-0123456789abcdef0",
+		"/latest/meta-data/instance-type": "t3.micro",
+		"/latest/meta-data/local-ipv4":    testIMDSInstanceIP,
+		"/latest/meta-data/":              "ami-id\ninstance-id\ninstance-type\nlocal-ipv4",
+	}
+	for path, want := range tests {
+		resp := imdsGet(m, path, "")
+		body, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, http.StatusOK, resp.StatusCode, path)
+		assert.Equal(t, want, string(body), path)
+	}
+
+	// Without an instance profile there is no iam/ tree.
+	assert.Equal(t, http.StatusNotFound, imdsGet(m, "/latest/meta-data/iam/security-credentials/", "").StatusCode)
+}
+
+func TestIMDS_UnknownSource(t *testing.T) {
+	m, instance, _, _ := newTestIMDS(t, "")
+
+	req := httptest.NewRequest(http.MethodGet, "/latest/meta-data/instance-id", nil)
+	req.RemoteAddr = "10.0.9.9:40000"
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Stopped instances are not served even from their old address.
+	instance.Status = vm.StateStopped
+	assert.Equal(t, http.StatusForbidden, imdsGet(m, "/latest/meta-data/instance-id", "").StatusCode)
+}
+
+func TestIMDS_SameAddressInAnotherVPC(t *testing.T) {
+	m, _, _, _ := newTestIMDS(t, testIMDSProfileArn)
+
+	// Another account's instance with the same private address, as default
+	// VPCs all use 172.31.0.0/16.
+	other := &vm.VM{
+		ID:        "i-0imds0000000002",
+		AccountID: "000000000002",
+		Status:    vm.StateRunning,
+		ENIMac:    "02:00:00:0b:00:05",
+		Instance: &ec2.Instance{
+			InstanceId:         aws.String("i-0imds0000000002"),
+			PrivateIpAddress:   aws.String(testIMDSInstanceIP),
+			IamInstanceProfile: &ec2.IamInstanceProfile{Arn: aws.String("arn:aws:iam::000000000002:instance-profile/admin")},
+		},
+	}
+	m.instances.VMS[other.ID] = other
+
+	// The host reached the source at the first instance's MAC, so only it
+	// is served, however the map iterates.
+	for range 20 {
+		resp := imdsGet(m, "/latest/meta-data/instance-id", "")
+		body, _ := io.ReadAll(resp.Body)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "i-0imds0000000001", string(body))
+	}
+
+	// Both MACs resolved for the address: refuse rather than guess.
+	m.neighborMACs = func(string) ([]string, error) {
+		return []string{testIMDSInstanceMAC, "02:00:00:0b:00:05"}, nil
+	}
+	assert.Equal(t, http.StatusForbidden, imdsGet(m, "/latest/meta-data/instance-id", "").StatusCode)
+
+	// No neighbour entry: nothing identifies the guest.
+	m.neighborMACs = func(string) ([]string, error) { return nil, nil }
+	assert.Equal(t, http.StatusForbidden, imdsGet(m, "/latest/meta-data/instance-id", "").StatusCode)
+}
+
+func TestParseNeighborMACs(t *testing.T) {
+	table := `IP address       HW type     Flags       HW address            Mask     Device
+10.0.1.5         0x1         0x2         02:00:00:0a:00:05     *        br-int
+10.0.1.6         0x1         0x2         02:00:00:0a:00:06     *        br-int
+10.0.1.5         0x1         0x2         02:00:00:0b:00:05     *        br-vpc2
+10.0.1.7         0x1         0x0         00:00:00:00:00:00     *        br-int
+`
+	assert.Equal(t, []string{"02:00:00:0a:00:05", "02:00:00:0b:00:05"}, parseNeighborMACs(table, "10.0.1.5"))
+	assert.Empty(t, parseNeighborMACs(table, "10.0.1.7"), "incomplete entries are skipped")
+	assert.Empty(t, parseNeighborMACs(table, "10.0.1.8"))
+	assert.Empty(t, parseNeighborMACs("", "10.0.1.5"))
+}
+
+func TestIMDS_EndpointDisabled(t *testing.T) {
+	m, instance, _, _ := newTestIMDS(t, "")
+	instance.Instance.MetadataOptions = &ec2.InstanceMetadataOptionsResponse{
+		HttpEndpoint: aws.String(ec2.InstanceMetadataEndpointStateDisabled),
+	}
+	assert.Equal(t, http.StatusForbidden, imdsGet(m, "/latest/meta-data/instance-id", "").StatusCode)
+}
+
+func TestIMDS_SessionTokens(t *testing.T) {
+	m, instance, now, _ := newTestIMDS(t, "")
+	instance.Instance.MetadataOptions = &ec2.InstanceMetadataOptionsResponse{
+		HttpTokens: aws.String(ec2.HttpTokensStateRequired),
+	}
+
+	// IMDSv1 is refused when tokens are required.
+	assert.Equal(t, http.StatusUnauthorized, imdsGet(m, "/latest/meta-data/instance-id", "").StatusCode)
+
+	token := imdsToken(t, m, "60")
+	assert.Equal(t, http.StatusOK, imdsGet(m, "/latest/meta-data/instance-id", token).StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, imdsGet(m, "/latest/meta-data/instance-id", token+"x").StatusCode)
+
+	*now = now.Add(time.Minute)
+	assert.Equal(t, http.StatusUnauthorized, imdsGet(m, "/latest/meta-data/instance-id", token).StatusCode)
+}
+
+// An instance launched with HttpTokens=required refuses IMDSv1 requests, and
+// ModifyInstanceMetadataOptions can relax it.
+func TestIMDS_LaunchRequiresTokens(t *testing.T) {
+	svc := handlers_ec2_instance.NewInstanceServiceImpl(&config.Config{}, map[string]*ec2.InstanceTypeInfo{
+		"t3.micro": {InstanceType: aws.String("t3.micro")},
+	}, nil, &vm.Instances{VMS: map[string]*vm.VM{}}, objectstore.NewMemoryObjectStore())
+	launched, _, err := svc.RunInstance(&ec2.RunInstancesInput{
+		ImageId:      aws.String("ami-0123456789abcdef0"),
+		InstanceType: aws.String("t3.micro"),
+		MetadataOptions: &ec2.InstanceMetadataOptionsRequest{
+			HttpTokens:              aws.String(ec2.HttpTokensStateRequired),
+			HttpPutResponseHopLimit: aws.Int64(2),
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), aws.Int64Value(launched.Instance.MetadataOptions.HttpPutResponseHopLimit))
+
+	m, instance, _, _ := newTestIMDS(t, "")
+	instance.Instance.MetadataOptions = launched.Instance.MetadataOptions
+
+	assert.Equal(t, http.StatusUnauthorized, imdsGet(m, "/latest/meta-data/instance-id", "").StatusCode)
+	token := imdsToken(t, m, "60")
+	assert.Equal(t, http.StatusOK, imdsGet(m, "/latest/meta-data/instance-id", token).StatusCode)
+
+	setMetadataOptions(instance.Instance, &types.MetadataOptionsData{HttpTokens: ec2.HttpTokensStateOptional})
+	assert.Equal(t, http.StatusOK, imdsGet(m, "/latest/meta-data/instance-id", "").StatusCode)
+	assert.Equal(t, int64(2), aws.Int64Value(instance.Instance.MetadataOptions.HttpPutResponseHopLimit))
+}
+
+func TestIMDS_TokenRequest(t *testing.T) {
+	m, _, _, _ := newTestIMDS(t, "")
+
+	for _, ttl := range []string{"", "0", "21601", "abc"} {
+		req := httptest.NewRequest(http.MethodPut, "/latest/api/token", nil)
+		req.RemoteAddr = testIMDSInstanceIP + ":40000"
+		req.Header.Set(imdsTokenTTLHeader, ttl)
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code, "ttl %q", ttl)
+	}
+
+	req := httptest.NewRequest(http.MethodPut, "/latest/api/token", nil)
+	req.RemoteAddr = testIMDSInstanceIP + ":40000"
+	req.Header.Set(imdsTokenTTLHeader, "60")
+	req.Header.Set("X-Forwarded-For", "192.0.2.1")
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/latest/api/token", nil)
+	req.RemoteAddr = testIMDSInstanceIP + ":40000"
+	w = httptest.NewRecorder()
+	m.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
+
+func TestIMDS_TokenBoundToInstance(t *testing.T) {
+	m, _, now, _ := newTestIMDS(t, "")
+	other := m.signToken("i-0other000000001", now.Add(time.Hour).Unix())
+	assert.Equal(t, http.StatusUnauthorized, imdsGet(m, "/latest/meta-data/instance-id", other).StatusCode)
+}
+
+func TestIMDS_SecurityCredentials(t *testing.T) {
+	m, _, now, fetches := newTestIMDS(t, testIMDSProfileArn)
+
+	resp := imdsGet(m, "/latest/meta-data/iam/security-credentials/", "")
+	body, _ := io.ReadAll(resp.Body)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "web-role", string(body))
+
+	resp = imdsGet(m, "/latest/meta-data/iam/security-credentials/web-role", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var creds map[string]string
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&creds))
+	assert.Equal(t, "Success", creds["Code"])
+	assert.Equal(t, "AWS-HMAC", creds["Type"])
+	assert.Equal(t, "token", creds["Token"])
+	assert.Equal(t, now.Add(6*time.Hour).Format(time.RFC3339), creds["Expiration"])
+
+	resp = imdsGet(m, "/latest/meta-data/iam/info", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var info map[string]string
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+	assert.Equal(t, testIMDSProfileArn, info["InstanceProfileArn"])
+
+	assert.Equal(t, http.StatusNotFound, imdsGet(m, "/latest/meta-data/iam/security-credentials/other-role", "").StatusCode)
+	assert.Equal(t, 1, *fetches, "credentials are cached between requests")
+}
+
+func TestIMDS_CredentialsRefreshedBeforeExpiry(t *testing.T) {
+	m, _, now, fetches := newTestIMDS(t, testIMDSProfileArn)
+
+	require.Equal(t, http.StatusOK, imdsGet(m, "/latest/meta-data/iam/security-credentials/web-role", "").StatusCode)
+	require.Equal(t, 1, *fetches)
+
+	*now = now.Add(5 * time.Hour)
+	require.Equal(t, http.StatusOK, imdsGet(m, "/latest/meta-data/iam/security-credentials/web-role", "").StatusCode)
+	assert.Equal(t, 1, *fetches, "an hour of validity left is not yet due for refresh")
+
+	*now = now.Add(50 * time.Minute)
+	require.Equal(t, http.StatusOK, imdsGet(m, "/latest/meta-data/iam/security-credentials/web-role", "").StatusCode)
+	assert.Equal(t, 2, *fetches)
+}
+
+func TestIMDS_CredentialsFetchFailure(t *testing.T) {
+	m, _, _, _ := newTestIMDS(t, "arn:aws:iam::000000000001:instance-profile/deleted")
+	assert.Equal(t, http.StatusInternalServerError, imdsGet(m, "/latest/meta-data/iam/security-credentials/", "").StatusCode)
+}
+
+func TestIMDS_PhoneHome(t *testing.T) {
+	m, instance, _, _ := newTestIMDS(t, "")
+	var reported []string
+	m.phoneHome = func(instanceID, token string) (bool, bool) {
+		reported = append(reported, instanceID)
+		return true, token == "tok-1"
+	}
+
+	post := func(path string) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader("instance_id=x"))
+		req.RemoteAddr = testIMDSInstanceIP + ":40000"
+		w := httptest.NewRecorder()
+		m.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, post("/phone-home/"+instance.ID+"/tok-1"))
+	assert.Equal(t, http.StatusForbidden, post("/phone-home/"+instance.ID+"/wrong"))
+	// A guest can't report for another instance
+	assert.Equal(t, http.StatusForbidden, post("/phone-home/i-0other000000001/tok-1"))
+	assert.Equal(t, http.StatusMethodNotAllowed, imdsGet(m, "/phone-home/"+instance.ID+"/tok-1", "").StatusCode)
+	assert.Equal(t, []string{instance.ID, instance.ID}, reported)
+}
@@ -0,0 +1,81 @@
+package daemon
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+)
+
+// Modify*Attribute style calls change an instance wherever it lives: on the
+// node running it, or in shared KV while it is stopped. modifyLocalInstance
+// and modifyStoppedInstance hold what both paths of each call have in
+// common, so a handler only supplies the change itself.
+//
+// modify returns the error code to report when the change doesn't apply, or
+// "" once it has made it. It may assume instance.Instance is set.
+
+// modifyLocalInstance applies modify to accountID's instance on this node
+// under the instances lock and persists the node's state. found is false
+// when this node doesn't run the instance or accountID can't see it.
+func (d *Daemon) modifyLocalInstance(instanceID, accountID string, modify func(instance *vm.VM) string) (found bool, errCode string) {
+	d.Instances.WithVM(instanceID, func(v *vm.VM) {
+		if !isInstanceVisible(accountID, v.AccountID) {
+			return
+		}
+		found = true
+		if v.Instance == nil {
+			v.Instance = &ec2.Instance{}
+		}
+		errCode = modify(v)
+	})
+	if !found || errCode != "" {
+		return found, errCode
+	}
+	if err := d.WriteState(); err != nil {
+		slog.Error("Failed to persist modified instance", "instanceId", instanceID, "err", err)
+	}
+	return true, ""
+}
+
+// errModifyRefused carries modify's error code out of UpdateStoppedInstance.
+type errModifyRefused struct{ code string }
+
+func (e errModifyRefused) Error() string { return e.code }
+
+// modifyStoppedInstance applies modify to accountID's stopped instance in
+// shared KV under a revision check, so a concurrent change or start is never
+// overwritten. It returns the updated instance, or the error code to report:
+// InvalidInstanceID.NotFound when the instance isn't stopped or accountID
+// can't see it, or modify's own.
+func (d *Daemon) modifyStoppedInstance(instanceID, accountID string, modify func(instance *vm.VM) string) (*vm.VM, string) {
+	if d.jsManager == nil {
+		return nil, awserrors.ErrorServerInternal
+	}
+
+	instance, err := d.jsManager.UpdateStoppedInstance(instanceID, func(v *vm.VM) error {
+		if !isInstanceVisible(accountID, v.AccountID) {
+			return errModifyRefused{awserrors.ErrorInvalidInstanceIDNotFound}
+		}
+		if v.Instance == nil {
+			v.Instance = &ec2.Instance{}
+		}
+		if code := modify(v); code != "" {
+			return errModifyRefused{code}
+		}
+		return nil
+	})
+	var refused errModifyRefused
+	switch {
+	case errors.As(err, &refused):
+		return nil, refused.code
+	case err != nil:
+		slog.Error("Failed to modify stopped instance", "instanceId", instanceID, "err", err)
+		return nil, awserrors.ErrorServerInternal
+	case instance == nil:
+		return nil, awserrors.ErrorInvalidInstanceIDNotFound
+	}
+	return instance, ""
+}
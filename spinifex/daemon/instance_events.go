@@ -0,0 +1,114 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_ec2_instanceevent "github.com/mulgadc/spinifex/spinifex/handlers/ec2/instanceevent"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	instanceEventInterval       = 30 * time.Second
+	instanceEventCommandTimeout = 10 * time.Second
+)
+
+// startInstanceEventScheduler runs scheduled instance events once they are
+// due. Every daemon runs the ticker, but only the JetStream meta-leader acts
+// on a tick so each event is executed once cluster-wide.
+func (d *Daemon) startInstanceEventScheduler() {
+	ticker := time.NewTicker(instanceEventInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-d.ctx.Done():
+				return
+			case <-ticker.C:
+				if d.queryNATSRole() != roleLeader {
+					continue
+				}
+				d.runDueInstanceEvents(utils.Now())
+			}
+		}
+	}()
+}
+
+// runDueInstanceEvents executes every event due at now by sending the reboot
+// or stop command to the instance's owning node, exactly as the public API
+// would. Events whose instance is no longer running are canceled; transient
+// failures are left scheduled and retried on the next tick.
+func (d *Daemon) runDueInstanceEvents(now time.Time) {
+	due, err := d.instanceEventService.DueInstanceEvents(now)
+	if err != nil {
+		slog.Error("Failed to list due instance events", "err", err)
+		return
+	}
+
+	for _, event := range due {
+		attrs := types.EC2CommandAttributes{StopInstance: true, StateReason: stateReasonScheduledStop}
+		if handlers_ec2_instanceevent.IsRebootEvent(event.Code) {
+			attrs = types.EC2CommandAttributes{RebootInstance: true}
+		}
+
+		state := handlers_ec2_instanceevent.EventStateCompleted
+		if err := d.sendInstanceCommand(event.AccountID, types.EC2InstanceCommand{ID: event.InstanceID, Attributes: attrs}); err != nil {
+			if !isInstanceGoneError(err) {
+				slog.Warn("Scheduled instance event failed, will retry",
+					"eventId", event.EventID, "instanceId", event.InstanceID, "code", event.Code, "err", err)
+				continue
+			}
+			slog.Info("Scheduled instance event canceled, instance not running",
+				"eventId", event.EventID, "instanceId", event.InstanceID, "err", err)
+			state = handlers_ec2_instanceevent.EventStateCanceled
+		}
+
+		if err := d.instanceEventService.FinishInstanceEvent(event.AccountID, event.EventID, state); err != nil {
+			slog.Error("Failed to record instance event outcome", "eventId", event.EventID, "state", state, "err", err)
+			continue
+		}
+		slog.Info("Scheduled instance event executed", "eventId", event.EventID, "instanceId", event.InstanceID,
+			"code", event.Code, "state", state)
+	}
+}
+
+// sendInstanceCommand sends an EC2 instance command on behalf of accountID
+// and returns the daemon's error code, if any.
+func (d *Daemon) sendInstanceCommand(accountID string, command types.EC2InstanceCommand) error {
+	data, err := json.Marshal(command)
+	if err != nil {
+		return fmt.Errorf("marshal command: %w", err)
+	}
+
+	reqMsg := nats.NewMsg(utils.Subject(subjects.InstanceCmd(command.ID)))
+	reqMsg.Data = data
+	reqMsg.Header.Set(utils.AccountIDHeader, accountID)
+	resp, err := d.natsConn.RequestMsg(reqMsg, instanceEventCommandTimeout)
+	if err != nil {
+		return err
+	}
+	if replyErr := utils.DecodeReply(resp).Err; replyErr != nil {
+		return replyErr
+	}
+	return nil
+}
+
+// isInstanceGoneError reports whether err means the instance is not running
+// anywhere, so a scheduled event against it can never run.
+func isInstanceGoneError(err error) bool {
+	if errors.Is(err, nats.ErrNoResponders) {
+		return true
+	}
+	switch err.Error() {
+	case awserrors.ErrorInvalidInstanceIDNotFound, awserrors.ErrorIncorrectInstanceState:
+		return true
+	}
+	return false
+}
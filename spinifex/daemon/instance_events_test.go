@@ -0,0 +1,164 @@
+package daemon
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_ec2_instanceevent "github.com/mulgadc/spinifex/spinifex/handlers/ec2/instanceevent"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/testutil"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const eventTestAccountID = "123456789012"
+
+func newInstanceEventTestDaemon(t *testing.T) (*Daemon, *nats.Conn) {
+	t.Helper()
+	_, nc, _ := testutil.StartTestJetStream(t)
+
+	svc, err := handlers_ec2_instanceevent.NewInstanceEventServiceImplWithNATS(nil, nc)
+	require.NoError(t, err)
+
+	return &Daemon{
+		node:                 "test-node",
+		natsConn:             nc,
+		instanceEventService: svc,
+		Instances:            vm.Instances{VMS: make(map[string]*vm.VM)},
+	}, nc
+}
+
+func describeAllInstanceEvents(t *testing.T, d *Daemon) map[string][]*ec2.InstanceStatusEvent {
+	t.Helper()
+	out, err := d.instanceEventService.DescribeInstanceEvents(&handlers_ec2_instanceevent.DescribeInstanceEventsInput{IncludeCompleted: true}, eventTestAccountID)
+	require.NoError(t, err)
+	return out.Events
+}
+
+func TestRunDueInstanceEvents(t *testing.T) {
+	d, nc := newInstanceEventTestDaemon(t)
+	now := time.Now()
+
+	// Mock owning node for i-running: records commands and the caller account.
+	var mu sync.Mutex
+	var commands []types.EC2InstanceCommand
+	var callers []string
+	sub, err := nc.Subscribe(subjects.InstanceCmd("i-running"), func(msg *nats.Msg) {
+		var cmd types.EC2InstanceCommand
+		require.NoError(t, json.Unmarshal(msg.Data, &cmd))
+		mu.Lock()
+		commands = append(commands, cmd)
+		callers = append(callers, utils.AccountIDFromMsg(msg))
+		mu.Unlock()
+		_ = msg.Respond([]byte(`{}`))
+	})
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	schedule := func(instanceID, code string, notBefore time.Time) string {
+		event, err := d.instanceEventService.ScheduleInstanceEvent(&handlers_ec2_instanceevent.ScheduleInstanceEventInput{
+			InstanceID: instanceID,
+			Code:       code,
+			NotBefore:  notBefore,
+		}, eventTestAccountID)
+		require.NoError(t, err)
+		return *event.InstanceEventId
+	}
+	rebootID := schedule("i-running", ec2.EventCodeInstanceReboot, now.Add(-time.Minute))
+	goneID := schedule("i-gone", ec2.EventCodeInstanceStop, now.Add(-time.Minute))
+	futureID := schedule("i-running", ec2.EventCodeInstanceStop, now.Add(time.Hour))
+
+	d.runDueInstanceEvents(now)
+
+	mu.Lock()
+	require.Len(t, commands, 1, "only the due event for a running instance is sent")
+	assert.True(t, commands[0].Attributes.RebootInstance)
+	assert.False(t, commands[0].Attributes.StopInstance)
+	assert.Equal(t, eventTestAccountID, callers[0], "command is sent as the instance owner")
+	mu.Unlock()
+
+	states := make(map[string]string)
+	for _, events := range describeAllInstanceEvents(t, d) {
+		for _, event := range events {
+			states[*event.InstanceEventId] = *event.Description
+		}
+	}
+	assert.Contains(t, states[rebootID], "[Completed]")
+	assert.Contains(t, states[goneID], "[Canceled]")
+	assert.NotContains(t, states[futureID], "[")
+
+	// A second pass does not re-run finished events.
+	d.runDueInstanceEvents(now)
+	mu.Lock()
+	assert.Len(t, commands, 1)
+	mu.Unlock()
+
+	// Once the future event is due it stops the instance.
+	d.runDueInstanceEvents(now.Add(2 * time.Hour))
+	mu.Lock()
+	require.Len(t, commands, 2)
+	assert.True(t, commands[1].Attributes.StopInstance)
+	assert.Equal(t, stateReasonScheduledStop, commands[1].Attributes.StateReason, "a scheduled stop is a server stop")
+	mu.Unlock()
+}
+
+func TestRunDueInstanceEvents_RetriesTransientFailure(t *testing.T) {
+	d, nc := newInstanceEventTestDaemon(t)
+	now := time.Now()
+
+	sub, err := nc.Subscribe(subjects.InstanceCmd("i-flaky"), func(msg *nats.Msg) {
+		_ = msg.Respond(utils.GenerateErrorPayload(awserrors.ErrorServerInternal))
+	})
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	_, err = d.instanceEventService.ScheduleInstanceEvent(&handlers_ec2_instanceevent.ScheduleInstanceEventInput{
+		InstanceID: "i-flaky",
+		Code:       ec2.EventCodeSystemReboot,
+		NotBefore:  now.Add(-time.Minute),
+	}, eventTestAccountID)
+	require.NoError(t, err)
+
+	d.runDueInstanceEvents(now)
+
+	due, err := d.instanceEventService.DueInstanceEvents(now)
+	require.NoError(t, err)
+	assert.Len(t, due, 1, "event stays scheduled after a transient failure")
+}
+
+func TestHandleEC2ScheduleInstanceEvent_OwnerNodeResponds(t *testing.T) {
+	d, nc := newInstanceEventTestDaemon(t)
+	d.Instances.VMS["i-local"] = &vm.VM{ID: "i-local", AccountID: eventTestAccountID}
+
+	sub, err := nc.Subscribe("ec2.ScheduleInstanceEvent", d.handleEC2ScheduleInstanceEvent)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	svc := handlers_ec2_instanceevent.NewNATSInstanceEventService(nc)
+	event, err := svc.ScheduleInstanceEvent(&handlers_ec2_instanceevent.ScheduleInstanceEventInput{
+		InstanceID: "i-local",
+		Code:       ec2.EventCodeInstanceReboot,
+		NotBefore:  time.Now().Add(time.Hour),
+	}, "000000000000")
+	require.NoError(t, err)
+	assert.Equal(t, ec2.EventCodeInstanceReboot, *event.Code)
+
+	// Recorded against the instance owner, not the scheduler's account
+	assert.Len(t, describeAllInstanceEvents(t, d)["i-local"], 1)
+
+	// Instances not on this node get no reply
+	_, err = svc.ScheduleInstanceEvent(&handlers_ec2_instanceevent.ScheduleInstanceEventInput{
+		InstanceID: "i-elsewhere",
+		Code:       ec2.EventCodeInstanceReboot,
+		NotBefore:  time.Now().Add(time.Hour),
+	}, "000000000000")
+	assert.ErrorIs(t, err, nats.ErrTimeout)
+}
@@ -0,0 +1,168 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_ec2_instanceschedule "github.com/mulgadc/spinifex/spinifex/handlers/ec2/instanceschedule"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	instanceScheduleInterval = 30 * time.Second
+	// instanceScheduleGrace is how late a run may still be taken. Runs found
+	// later than this, say after the cluster was down, are recorded as
+	// missed rather than starting or stopping instances at the wrong time.
+	instanceScheduleGrace        = 15 * time.Minute
+	instanceScheduleStartTimeout = 30 * time.Second
+)
+
+// startInstanceScheduler runs recurring instance schedules as they come due.
+// As with scheduled events, only the JetStream meta-leader acts on a tick.
+func (d *Daemon) startInstanceScheduler() {
+	ticker := time.NewTicker(instanceScheduleInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-d.ctx.Done():
+				return
+			case <-ticker.C:
+				if d.queryNATSRole() != roleLeader {
+					continue
+				}
+				d.runDueInstanceSchedules(utils.Now())
+			}
+		}
+	}()
+}
+
+// runDueInstanceSchedules takes every schedule due at now. Each run is
+// claimed before its action is sent, so a run is attempted at most once even
+// if leadership changes mid-tick; a failed run is recorded, not retried.
+func (d *Daemon) runDueInstanceSchedules(now time.Time) {
+	due, err := d.instanceScheduleService.DueInstanceSchedules(now)
+	if err != nil {
+		slog.Error("Failed to list due instance schedules", "err", err)
+		return
+	}
+
+	for _, schedule := range due {
+		claimed, err := d.instanceScheduleService.ClaimInstanceScheduleRun(schedule.AccountID, schedule.InstanceScheduleID, now)
+		if err != nil {
+			slog.Warn("Failed to claim instance schedule run", "scheduleId", schedule.InstanceScheduleID, "err", err)
+			continue
+		}
+		if claimed == nil {
+			continue
+		}
+
+		result, errCode := d.runInstanceSchedule(claimed, now)
+		if result == "" {
+			continue
+		}
+		if err := d.instanceScheduleService.RecordInstanceScheduleResult(claimed.AccountID, claimed.InstanceScheduleID, result, errCode); err != nil {
+			slog.Error("Failed to record instance schedule outcome", "scheduleId", claimed.InstanceScheduleID, "result", result, "err", err)
+			continue
+		}
+		slog.Info("Instance schedule run", "scheduleId", claimed.InstanceScheduleID, "instanceId", claimed.InstanceID,
+			"action", claimed.Action, "result", result, "error", errCode, "nextRun", claimed.NextRun)
+	}
+}
+
+// runInstanceSchedule starts or stops the schedule's instance through the
+// same paths as StartInstances and StopInstances, so stop protection and the
+// other checks those make apply here too. It returns the run's result and,
+// for a failed run, the error code. The result is empty when the instance
+// has been terminated, in which case its schedules are deleted.
+func (d *Daemon) runInstanceSchedule(schedule *handlers_ec2_instanceschedule.InstanceSchedule, now time.Time) (string, string) {
+	if now.Sub(schedule.LastRun) > instanceScheduleGrace {
+		slog.Warn("Instance schedule run missed", "scheduleId", schedule.InstanceScheduleID,
+			"instanceId", schedule.InstanceID, "due", schedule.LastRun)
+		return handlers_ec2_instanceschedule.ScheduleResultMissed, ""
+	}
+
+	var err error
+	var alreadyDone bool
+	switch schedule.Action {
+	case handlers_ec2_instanceschedule.ScheduleActionStart:
+		err = d.startStoppedInstance(schedule.AccountID, schedule.InstanceID)
+		// The instance isn't in the stopped bucket: running, or gone
+		alreadyDone = err != nil && (err.Error() == awserrors.ErrorInvalidInstanceIDNotFound ||
+			err.Error() == awserrors.ErrorIncorrectInstanceState)
+	case handlers_ec2_instanceschedule.ScheduleActionStop:
+		err = d.sendInstanceCommand(schedule.AccountID, types.EC2InstanceCommand{
+			ID:         schedule.InstanceID,
+			Attributes: types.EC2CommandAttributes{StopInstance: true},
+		})
+		// No node is running the instance: stopped, or gone
+		alreadyDone = err != nil && isInstanceGoneError(err)
+	default:
+		return handlers_ec2_instanceschedule.ScheduleResultFailed, awserrors.ErrorInvalidParameterValue
+	}
+
+	switch {
+	case err == nil:
+		return handlers_ec2_instanceschedule.ScheduleResultSucceeded, ""
+	case alreadyDone:
+		if d.instanceTerminated(schedule.InstanceID) {
+			d.deleteInstanceSchedules(schedule.AccountID, schedule.InstanceID)
+			return "", ""
+		}
+		return handlers_ec2_instanceschedule.ScheduleResultSkipped, ""
+	default:
+		slog.Warn("Instance schedule run failed", "scheduleId", schedule.InstanceScheduleID,
+			"instanceId", schedule.InstanceID, "action", schedule.Action, "err", err)
+		return handlers_ec2_instanceschedule.ScheduleResultFailed, awserrors.ValidErrorCode(err.Error())
+	}
+}
+
+// deleteInstanceSchedules removes a terminated instance's schedules.
+func (d *Daemon) deleteInstanceSchedules(accountID, instanceID string) {
+	if d.instanceScheduleService == nil {
+		return
+	}
+	if err := d.instanceScheduleService.DeleteInstanceSchedulesForInstance(accountID, instanceID); err != nil {
+		slog.Error("Failed to delete schedules of terminated instance", "instanceId", instanceID, "err", err)
+	}
+}
+
+// instanceTerminated reports whether the instance is in the terminated bucket.
+func (d *Daemon) instanceTerminated(instanceID string) bool {
+	if d.jsManager == nil {
+		return false
+	}
+	instance, err := d.jsManager.LoadTerminatedInstance(instanceID)
+	if err != nil {
+		slog.Warn("Failed to check for terminated instance", "instanceId", instanceID, "err", err)
+		return false
+	}
+	return instance != nil
+}
+
+// startStoppedInstance asks the cluster to start a stopped instance on behalf
+// of accountID, as StartInstances does, and returns the daemon's error code,
+// if any.
+func (d *Daemon) startStoppedInstance(accountID, instanceID string) error {
+	data, err := json.Marshal(startStoppedInstanceRequest{InstanceID: instanceID})
+	if err != nil {
+		return fmt.Errorf("marshal start request: %w", err)
+	}
+
+	reqMsg := nats.NewMsg(utils.Subject("ec2.start"))
+	reqMsg.Data = data
+	reqMsg.Header.Set(utils.AccountIDHeader, accountID)
+	resp, err := d.natsConn.RequestMsg(reqMsg, instanceScheduleStartTimeout)
+	if err != nil {
+		return err
+	}
+	if replyErr := utils.DecodeReply(resp).Err; replyErr != nil {
+		return replyErr
+	}
+	return nil
+}
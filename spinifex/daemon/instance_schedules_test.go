@@ -0,0 +1,145 @@
+package daemon
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_ec2_instanceschedule "github.com/mulgadc/spinifex/spinifex/handlers/ec2/instanceschedule"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/testutil"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newInstanceScheduleTestDaemon(t *testing.T) (*Daemon, *nats.Conn) {
+	t.Helper()
+	_, nc, _ := testutil.StartTestJetStream(t)
+
+	svc, err := handlers_ec2_instanceschedule.NewInstanceScheduleServiceImplWithNATS(nil, nc)
+	require.NoError(t, err)
+	jsManager, err := NewJetStreamManager(nc, 1)
+	require.NoError(t, err)
+	require.NoError(t, jsManager.InitTerminatedInstanceBucket())
+
+	return &Daemon{
+		node:                    "test-node",
+		natsConn:                nc,
+		jsManager:               jsManager,
+		instanceScheduleService: svc,
+		Instances:               vm.Instances{VMS: make(map[string]*vm.VM)},
+	}, nc
+}
+
+// dueInstanceSchedule creates a schedule and moves its next run to due.
+func dueInstanceSchedule(t *testing.T, nc *nats.Conn, d *Daemon, instanceID, action string, due time.Time) string {
+	t.Helper()
+	schedule, err := d.instanceScheduleService.CreateInstanceSchedule(&handlers_ec2_instanceschedule.CreateInstanceScheduleInput{
+		InstanceID:         instanceID,
+		Action:             action,
+		ScheduleExpression: "*/5 * * * *",
+	}, eventTestAccountID)
+	require.NoError(t, err)
+
+	js, err := nc.JetStream()
+	require.NoError(t, err)
+	kv, err := js.KeyValue(handlers_ec2_instanceschedule.KVBucketInstanceSchedules)
+	require.NoError(t, err)
+	schedule.NextRun = due
+	data, err := json.Marshal(schedule)
+	require.NoError(t, err)
+	_, err = kv.Put(eventTestAccountID+"."+schedule.InstanceScheduleID, data)
+	require.NoError(t, err)
+	return schedule.InstanceScheduleID
+}
+
+func TestRunDueInstanceSchedules(t *testing.T) {
+	d, nc := newInstanceScheduleTestDaemon(t)
+	now := time.Now().UTC()
+	due := now.Add(-time.Minute)
+
+	// Mock owning node for i-running, which refuses to stop i-protected.
+	var mu sync.Mutex
+	var commands []types.EC2InstanceCommand
+	var starts []string
+	for _, id := range []string{"i-running", "i-protected"} {
+		sub, err := nc.Subscribe(subjects.InstanceCmd(id), func(msg *nats.Msg) {
+			var cmd types.EC2InstanceCommand
+			require.NoError(t, json.Unmarshal(msg.Data, &cmd))
+			mu.Lock()
+			commands = append(commands, cmd)
+			mu.Unlock()
+			if cmd.ID == "i-protected" {
+				_ = msg.Respond(utils.GenerateErrorPayload(awserrors.ErrorOperationNotPermitted))
+				return
+			}
+			_ = msg.Respond([]byte(`{}`))
+		})
+		require.NoError(t, err)
+		defer sub.Unsubscribe()
+	}
+	// Mock start worker: only i-stopped is in the stopped bucket.
+	sub, err := nc.Subscribe("ec2.start", func(msg *nats.Msg) {
+		var req startStoppedInstanceRequest
+		require.NoError(t, json.Unmarshal(msg.Data, &req))
+		mu.Lock()
+		starts = append(starts, req.InstanceID)
+		mu.Unlock()
+		if req.InstanceID != "i-stopped" {
+			_ = msg.Respond(utils.GenerateErrorPayload(awserrors.ErrorInvalidInstanceIDNotFound))
+			return
+		}
+		_ = msg.Respond([]byte(`{}`))
+	})
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	require.NoError(t, d.jsManager.WriteTerminatedInstance("i-terminated", &vm.VM{ID: "i-terminated", Status: vm.StateTerminated}))
+
+	stopID := dueInstanceSchedule(t, nc, d, "i-running", handlers_ec2_instanceschedule.ScheduleActionStop, due)
+	startID := dueInstanceSchedule(t, nc, d, "i-stopped", handlers_ec2_instanceschedule.ScheduleActionStart, due)
+	alreadyID := dueInstanceSchedule(t, nc, d, "i-running", handlers_ec2_instanceschedule.ScheduleActionStart, due)
+	protectedID := dueInstanceSchedule(t, nc, d, "i-protected", handlers_ec2_instanceschedule.ScheduleActionStop, due)
+	missedID := dueInstanceSchedule(t, nc, d, "i-stopped", handlers_ec2_instanceschedule.ScheduleActionStart, now.Add(-time.Hour))
+	dueInstanceSchedule(t, nc, d, "i-terminated", handlers_ec2_instanceschedule.ScheduleActionStop, due)
+
+	d.runDueInstanceSchedules(now)
+
+	mu.Lock()
+	require.Len(t, commands, 2)
+	for _, cmd := range commands {
+		assert.True(t, cmd.Attributes.StopInstance)
+		assert.Empty(t, cmd.Attributes.StateReason, "a scheduled stop is a user stop")
+	}
+	assert.ElementsMatch(t, []string{"i-stopped", "i-running"}, starts, "the missed run is not started")
+	mu.Unlock()
+
+	out, err := d.instanceScheduleService.DescribeInstanceSchedules(&handlers_ec2_instanceschedule.DescribeInstanceSchedulesInput{}, eventTestAccountID)
+	require.NoError(t, err)
+	results := make(map[string]*handlers_ec2_instanceschedule.InstanceSchedule)
+	for _, s := range out.InstanceSchedules {
+		results[s.InstanceScheduleID] = s
+		assert.True(t, s.NextRun.After(now), "next run advanced past now")
+	}
+	require.Len(t, results, 5, "the terminated instance's schedule is deleted")
+	assert.Equal(t, handlers_ec2_instanceschedule.ScheduleResultSucceeded, results[stopID].LastResult)
+	assert.Equal(t, handlers_ec2_instanceschedule.ScheduleResultSucceeded, results[startID].LastResult)
+	assert.Equal(t, handlers_ec2_instanceschedule.ScheduleResultSkipped, results[alreadyID].LastResult)
+	assert.Equal(t, handlers_ec2_instanceschedule.ScheduleResultFailed, results[protectedID].LastResult)
+	assert.Equal(t, awserrors.ErrorOperationNotPermitted, results[protectedID].LastError)
+	assert.Equal(t, handlers_ec2_instanceschedule.ScheduleResultMissed, results[missedID].LastResult)
+	assert.True(t, due.Equal(results[stopID].LastRun))
+
+	// A second pass finds nothing due
+	d.runDueInstanceSchedules(now)
+	mu.Lock()
+	assert.Len(t, commands, 2)
+	assert.Len(t, starts, 2)
+	mu.Unlock()
+}
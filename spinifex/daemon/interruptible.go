@@ -0,0 +1,231 @@
+package daemon
+
+import (
+	"encoding/json"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// interruptionNotice is how long an interruptible instance runs after
+	// being given notice, as with EC2 Spot.
+	interruptionNotice = 2 * time.Minute
+	// interruptionCheckInterval is how often the node terminates
+	// interruptible instances whose notice has run out.
+	interruptionCheckInterval = 10 * time.Second
+
+	eventSpotInterruption = "EC2 Spot Instance Interruption Warning"
+)
+
+// interruptibleUsage returns the vCPUs and memory held by this node's
+// interruptible instances, which reclaiming them would free.
+func (d *Daemon) interruptibleUsage() (vcpu int, memGB float64) {
+	d.Instances.Mu.Lock()
+	defer d.Instances.Mu.Unlock()
+	for _, instance := range d.Instances.VMS {
+		if !holdsInterruptibleCapacity(instance) {
+			continue
+		}
+		if it, ok := d.resourceMgr.instanceTypes[instance.InstanceType]; ok {
+			vcpu += int(instanceTypeVCPUs(it))
+			memGB += float64(instanceTypeMemoryMiB(it)) / 1024.0
+		}
+	}
+	return vcpu, memGB
+}
+
+// holdsInterruptibleCapacity reports whether instance is interruptible and
+// holds capacity that reclaiming it would free.
+func holdsInterruptibleCapacity(instance *vm.VM) bool {
+	if !instance.Interruptible {
+		return false
+	}
+	switch instance.Status {
+	case vm.StateStopped, vm.StateTerminated:
+		return false
+	}
+	return true
+}
+
+// addReclaimable fills in each type's Reclaimable count from the capacity
+// left on the node and the capacity its interruptible instances hold.
+func addReclaimable(caps []types.InstanceTypeCap, remainVCPU int, remainMem float64, freeVCPU int, freeMem float64) {
+	if freeVCPU <= 0 && freeMem <= 0 {
+		return
+	}
+	for i := range caps {
+		c := &caps[i]
+		if c.VCPU <= 0 || c.MemoryGB <= 0 {
+			continue
+		}
+		fit := min((remainVCPU+freeVCPU)/c.VCPU, int((remainMem+freeMem)/c.MemoryGB))
+		c.Reclaimable = max(fit-c.Available, 0)
+	}
+}
+
+// handleReclaimCapacity gives interruptible instances on this node notice
+// until the requested number of instances of a type will fit once they are
+// gone. Instances already under notice count as freed. The node interrupts
+// nothing unless it can free enough: a partial reclaim would cost running
+// instances without letting the on-demand launch through.
+func (d *Daemon) handleReclaimCapacity(msg *nats.Msg) {
+	var req types.ReclaimCapacityRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil || req.Count <= 0 {
+		respondWithError(msg, awserrors.ErrorInvalidParameterValue)
+		return
+	}
+	it, ok := d.resourceMgr.instanceTypes[req.InstanceType]
+	if !ok {
+		respondWithError(msg, awserrors.ErrorInvalidInstanceType)
+		return
+	}
+	typeVCPU := int(instanceTypeVCPUs(it))
+	typeMem := float64(instanceTypeMemoryMiB(it)) / 1024.0
+	if typeVCPU <= 0 || typeMem <= 0 {
+		respondWithError(msg, awserrors.ErrorInvalidInstanceType)
+		return
+	}
+
+	remainVCPU, remainMem := d.resourceMgr.remaining()
+	fits := func() int {
+		return max(min(remainVCPU/typeVCPU, int(remainMem/typeMem)), 0)
+	}
+
+	now := utils.Now()
+	var victims []*vm.VM
+	resp := types.ReclaimCapacityResponse{Interrupted: []string{}}
+
+	d.Instances.Mu.Lock()
+	var candidates []*vm.VM
+	for _, instance := range d.Instances.VMS {
+		if !holdsInterruptibleCapacity(instance) {
+			continue
+		}
+		instanceType, ok := d.resourceMgr.instanceTypes[instance.InstanceType]
+		if !ok {
+			continue
+		}
+		if !instance.InterruptionTime.IsZero() {
+			remainVCPU += int(instanceTypeVCPUs(instanceType))
+			remainMem += float64(instanceTypeMemoryMiB(instanceType)) / 1024.0
+			continue
+		}
+		candidates = append(candidates, instance)
+	}
+
+	noticedVCPU, noticedMem := remainVCPU, remainMem
+
+	// Reclaim the newest instances first: they have done the least work.
+	slices.SortFunc(candidates, func(a, b *vm.VM) int {
+		return launchTime(b).Compare(launchTime(a))
+	})
+	for _, instance := range candidates {
+		if fits() >= req.Count {
+			break
+		}
+		instanceType := d.resourceMgr.instanceTypes[instance.InstanceType]
+		remainVCPU += int(instanceTypeVCPUs(instanceType))
+		remainMem += float64(instanceTypeMemoryMiB(instanceType)) / 1024.0
+		victims = append(victims, instance)
+	}
+
+	if fits() < req.Count {
+		victims = nil
+		remainVCPU, remainMem = noticedVCPU, noticedMem
+	}
+	for _, instance := range victims {
+		instance.InterruptionTime = now.Add(interruptionNotice)
+		resp.Interrupted = append(resp.Interrupted, instance.ID)
+	}
+	d.Instances.Mu.Unlock()
+
+	if len(victims) > 0 {
+		if err := d.WriteState(); err != nil {
+			slog.Error("ReclaimCapacity: failed to persist state", "err", err)
+		}
+		for _, instance := range victims {
+			d.Instances.Mu.Lock()
+			accountID := instance.AccountID
+			d.Instances.Mu.Unlock()
+			d.publishEvent(subjects.EventSpotInterruption, "aws.ec2", eventSpotInterruption, accountID,
+				"instance/"+instance.ID, types.SpotInterruptionDetail{
+					InstanceID:     instance.ID,
+					InstanceAction: "terminate",
+				})
+			slog.Info("Interruptible instance given notice", "instanceId", instance.ID,
+				"terminateAt", now.Add(interruptionNotice), "for", req.InstanceType)
+		}
+	}
+
+	resp.Available = fits()
+	respondWithJSON(msg, resp)
+}
+
+// launchTime returns the instance's launch time, or the zero time.
+func launchTime(instance *vm.VM) time.Time {
+	if instance.Instance == nil {
+		return time.Time{}
+	}
+	return aws.TimeValue(instance.Instance.LaunchTime)
+}
+
+// startInterruptionScheduler terminates interruptible instances on this
+// node once their notice has run out. The notice is kept with the instance
+// state, so it survives a daemon restart.
+func (d *Daemon) startInterruptionScheduler() {
+	ticker := time.NewTicker(interruptionCheckInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-d.ctx.Done():
+				return
+			case <-ticker.C:
+				d.terminateInterruptedInstances(utils.Now())
+			}
+		}
+	}()
+}
+
+// terminateInterruptedInstances terminates the interruptible instances whose
+// notice ran out by now.
+func (d *Daemon) terminateInterruptedInstances(now time.Time) {
+	type due struct{ id, accountID string }
+	var instances []due
+	d.Instances.Mu.Lock()
+	for _, instance := range d.Instances.VMS {
+		if !holdsInterruptibleCapacity(instance) || instance.InterruptionTime.IsZero() || now.Before(instance.InterruptionTime) {
+			continue
+		}
+		if instance.Status == vm.StateShuttingDown {
+			continue
+		}
+		instances = append(instances, due{instance.ID, instance.AccountID})
+	}
+	d.Instances.Mu.Unlock()
+
+	for _, instance := range instances {
+		err := d.sendInstanceCommand(instance.accountID, types.EC2InstanceCommand{
+			ID: instance.id,
+			Attributes: types.EC2CommandAttributes{
+				StopInstance:      true,
+				TerminateInstance: true,
+				StateReason:       stateReasonSpotTermination,
+			},
+		})
+		if err != nil {
+			slog.Warn("Failed to terminate interrupted instance, will retry", "instanceId", instance.id, "err", err)
+			continue
+		}
+		slog.Info("Interrupted instance terminated", "instanceId", instance.id)
+	}
+}
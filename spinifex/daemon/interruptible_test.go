@@ -0,0 +1,182 @@
+package daemon
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/qmp"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddReclaimable(t *testing.T) {
+	caps := []types.InstanceTypeCap{
+		{Name: "t3.small", VCPU: 2, MemoryGB: 2, Available: 1},
+		{Name: "t3.large", VCPU: 2, MemoryGB: 8, Available: 0},
+		{Name: "t3.xlarge", VCPU: 4, MemoryGB: 16, Available: 0},
+	}
+	// 2 vCPUs and 2 GB left, plus 4 vCPUs and 4 GB held by interruptible instances.
+	addReclaimable(caps, 2, 2, 4, 4)
+
+	assert.Equal(t, 2, caps[0].Reclaimable, "three fit once reclaimed, one already fits")
+	assert.Equal(t, 0, caps[1].Reclaimable, "memory still too short")
+	assert.Equal(t, 0, caps[2].Reclaimable)
+
+	none := []types.InstanceTypeCap{{Name: "t3.small", VCPU: 2, MemoryGB: 2}}
+	addReclaimable(none, 0, 0, 0, 0)
+	assert.Equal(t, 0, none[0].Reclaimable)
+}
+
+// newReclaimTestDaemon returns a daemon with 4 vCPUs and 4 GB, all held by
+// the given interruptible t3.small instances.
+func newReclaimTestDaemon(t *testing.T, instances ...*vm.VM) (*Daemon, *nats.Conn) {
+	t.Helper()
+	d, nc := newInstanceEventTestDaemon(t)
+	d.resourceMgr = &ResourceManager{
+		instanceTypes: map[string]*ec2.InstanceTypeInfo{
+			"t3.small": {
+				InstanceType: aws.String("t3.small"),
+				VCpuInfo:     &ec2.VCpuInfo{DefaultVCpus: aws.Int64(2)},
+				MemoryInfo:   &ec2.MemoryInfo{SizeInMiB: aws.Int64(2048)},
+			},
+		},
+		hostVCPU:      4,
+		hostMemGB:     4,
+		allocatedVCPU: 4,
+		allocatedMem:  4,
+	}
+	for _, instance := range instances {
+		d.Instances.VMS[instance.ID] = instance
+	}
+	return d, nc
+}
+
+func interruptibleVM(id string, launched time.Time) *vm.VM {
+	return &vm.VM{
+		ID:            id,
+		InstanceType:  "t3.small",
+		Status:        vm.StateRunning,
+		AccountID:     eventTestAccountID,
+		Interruptible: true,
+		Instance:      &ec2.Instance{LaunchTime: aws.Time(launched)},
+	}
+}
+
+func TestHandleReclaimCapacity(t *testing.T) {
+	now := time.Now()
+	older := interruptibleVM("i-older", now.Add(-time.Hour))
+	newer := interruptibleVM("i-newer", now.Add(-time.Minute))
+	d, nc := newReclaimTestDaemon(t, older, newer)
+
+	sub, err := nc.Subscribe(subjects.ReclaimCapacity(d.node), d.handleReclaimCapacity)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	reclaim := func(count int) *types.ReclaimCapacityResponse {
+		t.Helper()
+		resp, err := utils.NATSRequest[types.ReclaimCapacityResponse](nc, subjects.ReclaimCapacity(d.node),
+			types.ReclaimCapacityRequest{InstanceType: "t3.small", Count: count}, 5*time.Second, utils.GlobalAccountID)
+		require.NoError(t, err)
+		return resp
+	}
+
+	// More than the node can ever free: nothing is interrupted.
+	resp := reclaim(3)
+	assert.Empty(t, resp.Interrupted)
+	assert.Equal(t, 0, resp.Available)
+	assert.True(t, older.InterruptionTime.IsZero())
+	assert.True(t, newer.InterruptionTime.IsZero())
+
+	// The newest instance is reclaimed first.
+	resp = reclaim(1)
+	assert.Equal(t, []string{"i-newer"}, resp.Interrupted)
+	assert.Equal(t, 1, resp.Available)
+	assert.False(t, newer.InterruptionTime.IsZero())
+	assert.True(t, older.InterruptionTime.IsZero())
+	require.NotNil(t, newer.InstanceAction())
+
+	// An instance already under notice counts as freed.
+	resp = reclaim(1)
+	assert.Empty(t, resp.Interrupted)
+	assert.Equal(t, 1, resp.Available)
+
+	_, err = utils.NATSRequest[types.ReclaimCapacityResponse](nc, subjects.ReclaimCapacity(d.node),
+		types.ReclaimCapacityRequest{InstanceType: "t9.huge", Count: 1}, 5*time.Second, utils.GlobalAccountID)
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorInvalidInstanceType, err.Error())
+}
+
+func TestTerminateInterruptedInstances(t *testing.T) {
+	now := time.Now()
+	due := interruptibleVM("i-due", now.Add(-time.Hour))
+	due.InterruptionTime = now.Add(-time.Second)
+	pending := interruptibleVM("i-pending", now.Add(-time.Hour))
+	pending.InterruptionTime = now.Add(time.Minute)
+	untouched := interruptibleVM("i-untouched", now.Add(-time.Hour))
+	d, nc := newReclaimTestDaemon(t, due, pending, untouched)
+
+	var mu sync.Mutex
+	var commands []types.EC2InstanceCommand
+	for _, id := range []string{"i-due", "i-pending", "i-untouched"} {
+		sub, err := nc.Subscribe(subjects.InstanceCmd(id), func(msg *nats.Msg) {
+			var cmd types.EC2InstanceCommand
+			require.NoError(t, json.Unmarshal(msg.Data, &cmd))
+			mu.Lock()
+			commands = append(commands, cmd)
+			mu.Unlock()
+			_ = msg.Respond([]byte(`{}`))
+		})
+		require.NoError(t, err)
+		defer sub.Unsubscribe()
+	}
+
+	d.terminateInterruptedInstances(now)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, commands, 1)
+	assert.Equal(t, "i-due", commands[0].ID)
+	assert.True(t, commands[0].Attributes.TerminateInstance)
+	assert.Equal(t, stateReasonSpotTermination, commands[0].Attributes.StateReason)
+}
+
+func TestHandleEC2Events_InterruptibleStop(t *testing.T) {
+	daemon := createFullTestDaemonWithJetStream(t, sharedJSNATSURL)
+
+	instanceID := "i-interruptible-stop"
+	instance := &vm.VM{
+		ID:            instanceID,
+		InstanceType:  getTestInstanceType(t),
+		Status:        vm.StateRunning,
+		Instance:      &ec2.Instance{},
+		QMPClient:     &qmp.QMPClient{},
+		AccountID:     testAccountID,
+		Interruptible: true,
+	}
+	daemon.Instances.UpsertVM(instance)
+
+	sub, err := daemon.natsConn.Subscribe(subjects.InstanceCmd(instanceID), daemon.handleEC2Events)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	cmdData, _ := json.Marshal(types.EC2InstanceCommand{ID: instanceID, Attributes: types.EC2CommandAttributes{StopInstance: true}})
+	reply, err := natsRequest(daemon.natsConn, subjects.InstanceCmd(instanceID), cmdData, 5*time.Second)
+	require.NoError(t, err)
+	responseError, err := utils.ValidateErrorPayload(reply.Data)
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorUnsupportedOperation, aws.StringValue(responseError.Code))
+
+	daemon.Instances.Mu.Lock()
+	defer daemon.Instances.Mu.Unlock()
+	assert.Equal(t, vm.StateRunning, instance.Status)
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/mulgadc/spinifex/spinifex/migrate"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
 	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/mulgadc/spinifex/spinifex/vm"
 	"github.com/nats-io/nats.go"
@@ -26,8 +27,19 @@ const (
 	StoppedInstancePrefix = "instance."
 	// TerminatedInstanceBucket is the name of the KV bucket for terminated instances (auto-expiry via TTL)
 	TerminatedInstanceBucket = "spinifex-terminated-instances"
+	// terminatedInstanceVisibility is how long a terminated instance stays
+	// visible to DescribeInstances, as in AWS; it is also the bucket's TTL.
+	terminatedInstanceVisibility = 1 * time.Hour
 	// TerminatedInstancePrefix is the key prefix for terminated instances
 	TerminatedInstancePrefix = "terminated."
+	// EventStream is the JetStream stream that keeps the events published on
+	// subjects.Events so consumers can replay recent history.
+	EventStream = "spinifex-events"
+	// eventRetention is how long EventStream keeps an event.
+	eventRetention = 24 * time.Hour
+	// MetricsStream is the JetStream stream that keeps the instance metric
+	// samples the daemons publish on subjects.Metrics, for metricsRetention.
+	MetricsStream = "spinifex-metrics"
 
 	// Schema versions for daemon KV buckets
 	InstanceStateBucketVersion      = 1
@@ -59,6 +71,17 @@ func NewJetStreamManager(nc *nats.Conn, replicas int) (*JetStreamManager, error)
 	}, nil
 }
 
+// BindKVBucket binds to the existing KV bucket without creating or
+// migrating it, for tools that only read the cluster's state.
+func (m *JetStreamManager) BindKVBucket() error {
+	kv, err := m.js.KeyValue(InstanceStateBucket)
+	if err != nil {
+		return err
+	}
+	m.kv = kv
+	return nil
+}
+
 // InitKVBucket initializes the KV bucket, creating it if it doesn't exist
 func (m *JetStreamManager) InitKVBucket() error {
 	// Try to get the existing bucket first
@@ -132,7 +155,7 @@ func (m *JetStreamManager) InitTerminatedInstanceBucket() error {
 				Description: "Terminated instances (auto-expire after 1 hour)",
 				History:     1,
 				Replicas:    m.replicas,
-				TTL:         1 * time.Hour,
+				TTL:         terminatedInstanceVisibility,
 			})
 			if err != nil {
 				return err
@@ -151,6 +174,108 @@ func (m *JetStreamManager) InitTerminatedInstanceBucket() error {
 	return nil
 }
 
+// InitEventStream creates the event stream if it doesn't exist. Events are
+// published with core NATS, so the stream only records them: a daemon keeps
+// publishing if the stream is unavailable.
+func (m *JetStreamManager) InitEventStream() error {
+	_, err := m.js.StreamInfo(EventStream)
+	if err == nil {
+		slog.Debug("Connected to existing JetStream stream", "stream", EventStream)
+		return nil
+	}
+	if !errors.Is(err, nats.ErrStreamNotFound) {
+		return err
+	}
+
+	slog.Debug("Creating JetStream stream", "stream", EventStream, "replicas", m.replicas)
+	_, err = m.js.AddStream(&nats.StreamConfig{
+		Name:        EventStream,
+		Description: "Spinifex instance and volume events",
+		Subjects:    []string{utils.Subject(subjects.Events)},
+		MaxAge:      eventRetention,
+		Replicas:    m.replicas,
+	})
+	return err
+}
+
+// InitMetricsStream creates the metrics stream if it doesn't exist. Daemons
+// publish their instances' samples to it and reload them on start, so a
+// restart doesn't empty the metrics window.
+func (m *JetStreamManager) InitMetricsStream() error {
+	_, err := m.js.StreamInfo(MetricsStream)
+	if err == nil {
+		slog.Debug("Connected to existing JetStream stream", "stream", MetricsStream)
+		return nil
+	}
+	if !errors.Is(err, nats.ErrStreamNotFound) {
+		return err
+	}
+
+	slog.Debug("Creating JetStream stream", "stream", MetricsStream, "replicas", m.replicas)
+	_, err = m.js.AddStream(&nats.StreamConfig{
+		Name:        MetricsStream,
+		Description: "Spinifex instance metric samples",
+		Subjects:    []string{utils.Subject(subjects.Metrics)},
+		MaxAge:      metricsRetention,
+		Replicas:    m.replicas,
+	})
+	return err
+}
+
+// PublishMetricRecords appends one sampling round of node's instances to
+// the metrics stream.
+func (m *JetStreamManager) PublishMetricRecords(node string, records []metricRecord) error {
+	if m.js == nil {
+		return errors.New("JetStream context not initialized")
+	}
+	data, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	_, err = m.js.Publish(utils.Subject(subjects.MetricSamples(node)), data)
+	return err
+}
+
+// LoadMetricRecords reads back the sampling rounds of node the metrics
+// stream still holds, oldest first.
+func (m *JetStreamManager) LoadMetricRecords(node string) ([]metricRecord, error) {
+	if m.js == nil {
+		return nil, errors.New("JetStream context not initialized")
+	}
+	subject := utils.Subject(subjects.MetricSamples(node))
+	info, err := m.js.StreamInfo(MetricsStream, &nats.StreamInfoRequest{SubjectsFilter: subject})
+	if err != nil {
+		return nil, err
+	}
+	if info.State.Subjects[subject] == 0 {
+		return nil, nil
+	}
+
+	sub, err := m.js.SubscribeSync(subject, nats.OrderedConsumer(), nats.DeliverAll())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = sub.Unsubscribe() }()
+
+	var records []metricRecord
+	for {
+		msg, err := sub.NextMsg(5 * time.Second)
+		if err != nil {
+			return records, fmt.Errorf("read %s: %w", subject, err)
+		}
+		var round []metricRecord
+		if err := json.Unmarshal(msg.Data, &round); err != nil {
+			slog.Warn("Skipping malformed metric samples", "subject", subject, "err", err)
+		} else {
+			records = append(records, round...)
+		}
+		meta, err := msg.Metadata()
+		if err != nil || meta.NumPending == 0 {
+			return records, nil
+		}
+	}
+}
+
 // isStreamUnavailable checks if an error indicates the underlying JetStream stream
 // was lost or is unreachable. This can happen during NATS cluster formation when
 // streams created with low replication are disrupted by node join/catchup operations.
@@ -221,7 +346,7 @@ func (m *JetStreamManager) recoverTerminatedKVBucket() (nats.KeyValue, error) {
 	return m.recoverBucket(&nats.KeyValueConfig{
 		Bucket:      TerminatedInstanceBucket,
 		Description: "Terminated instances (auto-expire after 1 hour)",
-		TTL:         1 * time.Hour,
+		TTL:         terminatedInstanceVisibility,
 	}, &m.terminatedKV, TerminatedInstanceBucketVersion)
 }
 
@@ -231,13 +356,19 @@ func (m *JetStreamManager) recoverTerminatedKVBucket() (nats.KeyValue, error) {
 // raw). Scheduling routing happens at the local daemon via admission
 // control, which already accounts for the reserve; ReservedVCPU /
 // ReservedMem are exposed purely for operator dashboards and capacity
-// reporting.
+// reporting. The same heartbeat is published on subjects.NodeHeartbeat for
+// the daemons' node registries.
 type Heartbeat struct {
 	Node          string   `json:"node"`
 	Epoch         uint64   `json:"epoch"`
 	Timestamp     string   `json:"timestamp"`
+	Version       string   `json:"version,omitempty"`
+	Status        string   `json:"status,omitempty"`
 	Services      []string `json:"services"`
 	VMCount       int      `json:"vm_count"`
+	RunningCount  int      `json:"running_count"`
+	TotalVCPU     int      `json:"total_vcpu"`
+	TotalMem      float64  `json:"total_mem_gb"`
 	AllocatedVCPU int      `json:"allocated_vcpu"`
 	AvailableVCPU int      `json:"available_vcpu"`
 	AllocatedMem  float64  `json:"allocated_mem_gb"`
@@ -248,6 +379,8 @@ type Heartbeat struct {
 
 // WriteHeartbeat writes a heartbeat entry for the given node to the cluster-state KV.
 func (m *JetStreamManager) WriteHeartbeat(h *Heartbeat) error {
+	defer observeJetStreamWrite("heartbeat", time.Now())
+
 	if m.clusterKV == nil {
 		return errors.New("cluster state KV not initialized")
 	}
@@ -370,6 +503,52 @@ func (m *JetStreamManager) DeleteShutdownMarker(nodeID string) error {
 	return nil
 }
 
+// WriteFenceMarker fences a lost node before its instances are rescheduled.
+// While the marker stands the node refuses to write its state or mount
+// volumes, so it can't clobber the instances if it comes back.
+func (m *JetStreamManager) WriteFenceMarker(nodeID, fencedBy string) error {
+	if m.clusterKV == nil {
+		return errors.New("cluster state KV not initialized")
+	}
+	data, err := json.Marshal(map[string]any{
+		"node":      nodeID,
+		"fenced_by": fencedBy,
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return fmt.Errorf("marshal fence marker: %w", err)
+	}
+	_, err = m.clusterKV.Put("fence."+nodeID, data)
+	return err
+}
+
+// ReadFenceMarker checks if the given node is fenced.
+func (m *JetStreamManager) ReadFenceMarker(nodeID string) (bool, error) {
+	if m.clusterKV == nil {
+		return false, errors.New("cluster state KV not initialized")
+	}
+	_, err := m.clusterKV.Get("fence." + nodeID)
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DeleteFenceMarker lifts the fence on the given node.
+func (m *JetStreamManager) DeleteFenceMarker(nodeID string) error {
+	if m.clusterKV == nil {
+		return errors.New("cluster state KV not initialized")
+	}
+	err := m.clusterKV.Delete("fence." + nodeID)
+	if err != nil && !errors.Is(err, nats.ErrKeyNotFound) {
+		return err
+	}
+	return nil
+}
+
 // WriteServiceManifest writes the service manifest for the given node to the cluster-state KV.
 func (m *JetStreamManager) WriteServiceManifest(nodeID string, services []string, natsHost, predastoreHost string) error {
 	if m.clusterKV == nil {
@@ -390,23 +569,19 @@ func (m *JetStreamManager) WriteServiceManifest(nodeID string, services []string
 }
 
 // WriteState writes the instance state to the KV store for the given node.
-// It acquires instances.Mu internally.
+// It acquires instances.Mu and every VM's EBSRequests.Mu internally, since
+// marshalling reads the volume lists.
 func (m *JetStreamManager) WriteState(nodeID string, instances *vm.Instances) error {
-	instances.Mu.Lock()
-	defer instances.Mu.Unlock()
+	defer observeJetStreamWrite("state", time.Now())
+
+	unlock := instances.LockAll()
+	defer unlock()
 
 	if m.kv == nil {
 		return errors.New("KV bucket not initialized")
 	}
 
-	// Create a struct without the mutex to avoid copying the lock
-	state := struct {
-		VMS map[string]*vm.VM `json:"vms"`
-	}{
-		VMS: instances.VMS,
-	}
-
-	jsonData, err := json.Marshal(state)
+	jsonData, err := vm.EncodeInstances(instances)
 	if err != nil {
 		return err
 	}
@@ -467,18 +642,13 @@ func (m *JetStreamManager) LoadState(nodeID string) (*vm.Instances, error) {
 		}
 	}
 
-	var instances vm.Instances
-	if err := json.Unmarshal(entry.Value(), &instances); err != nil {
-		return nil, err
-	}
-
-	// Ensure the VMS map is initialized
-	if instances.VMS == nil {
-		instances.VMS = make(map[string]*vm.VM)
+	instances, err := vm.DecodeInstances(entry.Value())
+	if err != nil {
+		return nil, fmt.Errorf("load state %s: %w", key, err)
 	}
 
 	slog.Debug("Loaded state from JetStream KV", "key", key, "instances", len(instances.VMS))
-	return &instances, nil
+	return instances, nil
 }
 
 // DeleteState removes the instance state from the KV store for the given node
@@ -509,8 +679,9 @@ func (m *JetStreamManager) DeleteState(nodeID string) error {
 	return nil
 }
 
-// UpdateReplicas updates the replica count for ALL JetStream KV buckets.
-// It iterates over every KV_* stream and bumps replicas to match the cluster size.
+// UpdateReplicas updates the replica count for ALL JetStream KV buckets and
+// the event stream. It iterates over every KV_* stream and bumps replicas to
+// match the cluster size.
 // This ensures service buckets (IAM, VPC, IGW, etc.) are replicated alongside daemon buckets.
 // This should be called when new nodes join the cluster.
 func (m *JetStreamManager) UpdateReplicas(newReplicas int) error {
@@ -523,7 +694,7 @@ func (m *JetStreamManager) UpdateReplicas(newReplicas int) error {
 	// Iterate all streams and update any KV-backed stream (prefixed "KV_")
 	updated := 0
 	for name := range m.js.StreamNames() {
-		if !strings.HasPrefix(name, "KV_") {
+		if !strings.HasPrefix(name, "KV_") && name != EventStream && name != MetricsStream {
 			continue
 		}
 
@@ -558,11 +729,13 @@ func (m *JetStreamManager) UpdateReplicas(newReplicas int) error {
 
 // WriteStoppedInstance writes a stopped instance to the shared KV store.
 func (m *JetStreamManager) WriteStoppedInstance(instanceID string, instance *vm.VM) error {
+	defer observeJetStreamWrite("stopped_instance", time.Now())
+
 	if m.kv == nil {
 		return errors.New("KV bucket not initialized")
 	}
 
-	jsonData, err := json.Marshal(instance)
+	jsonData, err := vm.EncodeVM(instance)
 	if err != nil {
 		return err
 	}
@@ -622,12 +795,58 @@ func (m *JetStreamManager) LoadStoppedInstance(instanceID string) (*vm.VM, error
 		}
 	}
 
-	var instance vm.VM
-	if err := json.Unmarshal(entry.Value(), &instance); err != nil {
-		return nil, err
+	instance, err := vm.DecodeVM(entry.Value())
+	if err != nil {
+		return nil, fmt.Errorf("load %s: %w", key, err)
+	}
+
+	return instance, nil
+}
+
+// maxStoppedInstanceUpdates bounds how often UpdateStoppedInstance retries
+// when another writer changes the instance between its read and write.
+const maxStoppedInstanceUpdates = 5
+
+// UpdateStoppedInstance applies update to a stopped instance in the shared
+// KV store, writing it back only if nothing else has changed it since it was
+// read and retrying from a fresh read if something has. It returns nil, nil
+// if the instance isn't stopped, which includes one started meanwhile, and
+// update's error unchanged.
+func (m *JetStreamManager) UpdateStoppedInstance(instanceID string, update func(*vm.VM) error) (*vm.VM, error) {
+	defer observeJetStreamWrite("stopped_instance", time.Now())
+
+	if m.kv == nil {
+		return nil, errors.New("KV bucket not initialized")
 	}
 
-	return &instance, nil
+	key := StoppedInstancePrefix + instanceID
+	for range maxStoppedInstanceUpdates {
+		entry, err := m.kv.Get(key)
+		if errors.Is(err, nats.ErrKeyNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		instance, err := vm.DecodeVM(entry.Value())
+		if err != nil {
+			return nil, fmt.Errorf("load %s: %w", key, err)
+		}
+		if err := update(instance); err != nil {
+			return nil, err
+		}
+		jsonData, err := vm.EncodeVM(instance)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := m.kv.Update(key, jsonData, entry.Revision()); err != nil {
+			slog.Debug("Stopped instance changed during update, retrying", "key", key, "err", err)
+			continue
+		}
+		slog.Debug("Updated stopped instance in JetStream KV", "key", key, "instanceId", instanceID)
+		return instance, nil
+	}
+	return nil, fmt.Errorf("update %s: changed concurrently %d times", key, maxStoppedInstanceUpdates)
 }
 
 // DeleteStoppedInstance removes a stopped instance from the shared KV store.
@@ -707,26 +926,89 @@ func (m *JetStreamManager) ListStoppedInstances() ([]*vm.VM, error) {
 			return nil, err
 		}
 
-		var instance vm.VM
-		if err := json.Unmarshal(entry.Value(), &instance); err != nil {
-			slog.Error("Failed to unmarshal stopped instance", "key", key, "err", err)
+		instance, err := vm.DecodeVM(entry.Value())
+		if err != nil {
+			slog.Error("Failed to decode stopped instance", "key", key, "err", err)
 			continue
 		}
 
-		instances = append(instances, &instance)
+		instances = append(instances, instance)
 	}
 
 	return instances, nil
 }
 
+// ListNodeStates returns the instance state every node has written to the
+// shared KV store, keyed by node ID.
+func (m *JetStreamManager) ListNodeStates() (map[string]*vm.Instances, error) {
+	if m.kv == nil {
+		return nil, errors.New("KV bucket not initialized")
+	}
+
+	keys, err := m.kv.Keys()
+	if err != nil {
+		if errors.Is(err, nats.ErrNoKeysFound) {
+			return map[string]*vm.Instances{}, nil
+		}
+		return nil, err
+	}
+
+	nodes := make(map[string]*vm.Instances)
+	for _, key := range keys {
+		nodeID, ok := strings.CutPrefix(key, InstanceStatePrefix)
+		if !ok {
+			continue
+		}
+		instances, err := m.LoadState(nodeID)
+		if err != nil {
+			return nil, err
+		}
+		nodes[nodeID] = instances
+	}
+	return nodes, nil
+}
+
+// ListInstanceStates returns the state of every instance in the shared KV
+// store, running on any node or stopped, keyed by instance ID.
+func (m *JetStreamManager) ListInstanceStates() (map[string]vm.InstanceState, error) {
+	if m.kv == nil {
+		return nil, errors.New("KV bucket not initialized")
+	}
+
+	nodes, err := m.ListNodeStates()
+	if err != nil {
+		return nil, err
+	}
+
+	states := make(map[string]vm.InstanceState)
+	for _, instances := range nodes {
+		for id, instance := range instances.VMS {
+			states[id] = instance.Status
+		}
+	}
+
+	stopped, err := m.ListStoppedInstances()
+	if err != nil {
+		return nil, err
+	}
+	for _, instance := range stopped {
+		if _, ok := states[instance.ID]; !ok {
+			states[instance.ID] = instance.Status
+		}
+	}
+	return states, nil
+}
+
 // WriteTerminatedInstance writes a terminated instance to the terminated KV bucket.
 // The entry will auto-expire after the bucket's TTL (1 hour).
 func (m *JetStreamManager) WriteTerminatedInstance(instanceID string, instance *vm.VM) error {
+	defer observeJetStreamWrite("terminated_instance", time.Now())
+
 	if m.terminatedKV == nil {
 		return errors.New("terminated instance KV bucket not initialized")
 	}
 
-	jsonData, err := json.Marshal(instance)
+	jsonData, err := vm.EncodeVM(instance)
 	if err != nil {
 		return err
 	}
@@ -799,13 +1081,13 @@ func (m *JetStreamManager) ListTerminatedInstances() ([]*vm.VM, error) {
 			return nil, err
 		}
 
-		var instance vm.VM
-		if err := json.Unmarshal(entry.Value(), &instance); err != nil {
-			slog.Error("Failed to unmarshal terminated instance", "key", key, "err", err)
+		instance, err := vm.DecodeVM(entry.Value())
+		if err != nil {
+			slog.Error("Failed to decode terminated instance", "key", key, "err", err)
 			continue
 		}
 
-		instances = append(instances, &instance)
+		instances = append(instances, instance)
 	}
 
 	return instances, nil
@@ -869,10 +1151,10 @@ func (m *JetStreamManager) LoadTerminatedInstance(instanceID string) (*vm.VM, er
 		}
 	}
 
-	var instance vm.VM
-	if err := json.Unmarshal(entry.Value(), &instance); err != nil {
-		return nil, err
+	instance, err := vm.DecodeVM(entry.Value())
+	if err != nil {
+		return nil, fmt.Errorf("load %s: %w", key, err)
 	}
 
-	return &instance, nil
+	return instance, nil
 }
@@ -86,6 +86,57 @@ func TestJetStreamManager_LoadState_KeyNotFound(t *testing.T) {
 	assert.Empty(t, instances.VMS, "Should return empty VMS map")
 }
 
+// TestJetStreamManager_LoadState_Unversioned tests that state written before
+// schema versioning loads, and is versioned when written back
+func TestJetStreamManager_LoadState_Unversioned(t *testing.T) {
+	nc, err := nats.Connect(sharedJSNATSURL)
+	require.NoError(t, err)
+	defer nc.Close()
+
+	jsm, err := NewJetStreamManager(nc, 1)
+	require.NoError(t, err)
+	require.NoError(t, jsm.InitKVBucket())
+
+	const nodeID = "unversioned-node"
+	v0VM := `{"id":"i-v0-001","pid":4121,"running":true,"status":"running","instance_type":"t3.micro","config":{},` +
+		`"ebs_requests":{"Requests":[{"Name":"vol-v0-001","VolType":"gp3","Boot":true,"EFI":false,"CloudInit":false,` +
+		`"DeleteOnTermination":true,"NBDURI":"nbd:unix:/run/spinifex/nbd/vol-v0-001.sock","DeviceName":"/dev/sda1","KmsKeyId":"","DataKey":""}]},` +
+		`"attributes":{"stop_instance":false,"delete_instance":false,"start_instance":false,"attach_volume":false,"detach_volume":false,"reboot_instance":false},` +
+		`"health":{"crash_count":0,"last_crash_time":"0001-01-01T00:00:00Z","restart_count":0,"first_crash_time":"0001-01-01T00:00:00Z","last_watchdog_time":"0001-01-01T00:00:00Z"}}`
+	_, err = jsm.kv.Put(InstanceStatePrefix+nodeID, []byte(`{"vms":{"i-v0-001":`+v0VM+`}}`))
+	require.NoError(t, err)
+	_, err = jsm.kv.Put(StoppedInstancePrefix+"i-v0-001", []byte(v0VM))
+	require.NoError(t, err)
+	defer func() {
+		_ = jsm.DeleteState(nodeID)
+		_ = jsm.DeleteStoppedInstance("i-v0-001")
+	}()
+
+	instances, err := jsm.LoadState(nodeID)
+	require.NoError(t, err)
+	require.Contains(t, instances.VMS, "i-v0-001")
+	loaded := instances.VMS["i-v0-001"]
+	assert.Equal(t, vm.StateRunning, loaded.Status)
+	require.Len(t, loaded.EBSRequests.Requests, 1)
+	assert.Equal(t, "vol-v0-001", loaded.EBSRequests.Requests[0].Name)
+
+	stopped, err := jsm.LoadStoppedInstance("i-v0-001")
+	require.NoError(t, err)
+	require.NotNil(t, stopped)
+	assert.Equal(t, "/dev/sda1", stopped.EBSRequests.Requests[0].DeviceName)
+
+	require.NoError(t, jsm.WriteState(nodeID, instances))
+	entry, err := jsm.kv.Get(InstanceStatePrefix + nodeID)
+	require.NoError(t, err)
+	var stored struct {
+		VMS map[string]struct {
+			SchemaVersion int `json:"schema_version"`
+		} `json:"vms"`
+	}
+	require.NoError(t, json.Unmarshal(entry.Value(), &stored))
+	assert.Equal(t, vm.SchemaVersion, stored.VMS["i-v0-001"].SchemaVersion)
+}
+
 // TestJetStreamManager_BucketCreation tests that InitKVBucket creates the bucket when it doesn't exist
 func TestJetStreamManager_BucketCreation(t *testing.T) {
 	natsURL := sharedJSNATSURL
@@ -435,6 +486,65 @@ func TestJetStreamManager_LoadStoppedInstance_NotFound(t *testing.T) {
 	assert.Nil(t, loaded)
 }
 
+// TestJetStreamManager_UpdateStoppedInstance tests that an update retries on
+// a concurrent write instead of overwriting it, and gives up once the
+// instance has left stopped KV
+func TestJetStreamManager_UpdateStoppedInstance(t *testing.T) {
+	nc, err := nats.Connect(sharedJSNATSURL)
+	require.NoError(t, err)
+	defer nc.Close()
+
+	jsm, err := NewJetStreamManager(nc, 1)
+	require.NoError(t, err)
+	err = jsm.InitKVBucket()
+	require.NoError(t, err)
+
+	instanceID := "i-stopped-update-001"
+	require.NoError(t, jsm.WriteStoppedInstance(instanceID, &vm.VM{ID: instanceID, Status: vm.StateStopped, InstanceType: "t3.micro"}))
+	t.Cleanup(func() { _ = jsm.DeleteStoppedInstance(instanceID) })
+
+	// The first attempt races a concurrent write, which must survive.
+	calls := 0
+	updated, err := jsm.UpdateStoppedInstance(instanceID, func(v *vm.VM) error {
+		calls++
+		if calls == 1 {
+			require.NoError(t, jsm.WriteStoppedInstance(instanceID, &vm.VM{ID: instanceID, Status: vm.StateStopped, InstanceType: "t3.large"}))
+		}
+		v.LastNode = "node-2"
+		return nil
+	})
+	require.NoError(t, err)
+	require.NotNil(t, updated)
+	assert.Equal(t, 2, calls)
+
+	loaded, err := jsm.LoadStoppedInstance(instanceID)
+	require.NoError(t, err)
+	require.NotNil(t, loaded)
+	assert.Equal(t, "t3.large", loaded.InstanceType)
+	assert.Equal(t, "node-2", loaded.LastNode)
+
+	// An instance started mid-update is not written back.
+	updated, err = jsm.UpdateStoppedInstance(instanceID, func(v *vm.VM) error {
+		if v.LastNode == "node-2" {
+			require.NoError(t, jsm.DeleteStoppedInstance(instanceID))
+		}
+		v.LastNode = "node-3"
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Nil(t, updated)
+
+	loaded, err = jsm.LoadStoppedInstance(instanceID)
+	require.NoError(t, err)
+	assert.Nil(t, loaded)
+
+	// An update error is returned without writing.
+	require.NoError(t, jsm.WriteStoppedInstance(instanceID, &vm.VM{ID: instanceID, Status: vm.StateStopped}))
+	refused := errors.New("refused")
+	_, err = jsm.UpdateStoppedInstance(instanceID, func(v *vm.VM) error { return refused })
+	assert.ErrorIs(t, err, refused)
+}
+
 // TestJetStreamManager_DeleteStoppedInstance tests deleting a stopped instance (including non-existent)
 func TestJetStreamManager_DeleteStoppedInstance(t *testing.T) {
 	nc, err := nats.Connect(sharedJSNATSURL)
@@ -510,6 +620,41 @@ func TestJetStreamManager_ListStoppedInstances(t *testing.T) {
 	}
 }
 
+// TestJetStreamManager_ListInstanceStates tests that running and stopped instances are both listed
+func TestJetStreamManager_ListInstanceStates(t *testing.T) {
+	nc, err := nats.Connect(sharedJSNATSURL)
+	require.NoError(t, err)
+	defer nc.Close()
+
+	jsm, err := NewJetStreamManager(nc, 1)
+	require.NoError(t, err)
+	err = jsm.InitKVBucket()
+	require.NoError(t, err)
+
+	nodeInstances := &vm.Instances{
+		VMS: map[string]*vm.VM{
+			"i-states-001": {ID: "i-states-001", Status: vm.StateRunning},
+			"i-states-002": {ID: "i-states-002", Status: vm.StatePending},
+		},
+	}
+	err = jsm.WriteState("states-test-node", nodeInstances)
+	require.NoError(t, err)
+
+	stoppedVM := &vm.VM{ID: "i-states-003", Status: vm.StateStopped}
+	err = jsm.WriteStoppedInstance(stoppedVM.ID, stoppedVM)
+	require.NoError(t, err)
+
+	states, err := jsm.ListInstanceStates()
+	require.NoError(t, err)
+	assert.Equal(t, vm.StateRunning, states["i-states-001"])
+	assert.Equal(t, vm.StatePending, states["i-states-002"])
+	assert.Equal(t, vm.StateStopped, states["i-states-003"])
+
+	// Cleanup
+	_ = jsm.DeleteStoppedInstance(stoppedVM.ID)
+	_ = jsm.DeleteState("states-test-node")
+}
+
 // TestJetStreamManager_StoppedInstances_NoInterference tests that stopped instances don't interfere with per-node state
 func TestJetStreamManager_StoppedInstances_NoInterference(t *testing.T) {
 	nc, err := nats.Connect(sharedJSNATSURL)
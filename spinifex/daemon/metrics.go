@@ -0,0 +1,494 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/qmp"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	metricsInterval = time.Minute
+
+	// metricsRetention is how long samples are kept, so at one sample a
+	// minute each metric of an instance holds up to 1440 samples.
+	metricsRetention = 24 * time.Hour
+)
+
+// maxMetricSamplesPerReply caps the samples in one node's reply to
+// GetInstanceMetrics, keeping it well inside the NATS payload limit.
+// Variable for tests.
+var maxMetricSamplesPerReply = 10000
+
+// sysClassNet is where tap device counters are read from. Variable for tests.
+var sysClassNet = "/sys/class/net"
+
+// instanceMetrics holds the metric samples of this node's instances. The
+// samples of an instance that stops or moves stay until they age out.
+type instanceMetrics struct {
+	mu     sync.Mutex
+	series map[string]*metricSeries
+}
+
+// metricSeries is the samples of one instance, and the counters of the
+// QEMU process they were last sampled from.
+type metricSeries struct {
+	accountID string
+	pid       int
+	last      metricCounters
+	lastAt    time.Time
+	samples   map[string][]types.MetricSample
+}
+
+// metricCounters is a reading of an instance's cumulative counters. A group
+// that couldn't be read is left unset, so it isn't sampled.
+type metricCounters struct {
+	cpu  bool
+	net  bool
+	disk bool
+
+	cpuSeconds float64
+
+	netInBytes, netOutBytes uint64
+	netInPkts, netOutPkts   uint64
+
+	diskReadBytes, diskWriteBytes uint64
+	diskReadOps, diskWriteOps     uint64
+}
+
+// metricRecord is the samples one instance got in a sampling round, as kept
+// in MetricsStream.
+type metricRecord struct {
+	InstanceID string             `json:"instance_id"`
+	AccountID  string             `json:"account_id,omitempty"`
+	Timestamp  time.Time          `json:"timestamp"`
+	Values     map[string]float64 `json:"values"`
+}
+
+// instanceSample is what sampleInstanceMetrics reads from one instance.
+type instanceSample struct {
+	accountID string
+	pid       int
+	vcpus     int64
+	counters  metricCounters
+	// memory is the MemoryUtilization gauge, or negative if unknown.
+	memory float64
+}
+
+// startMetricsCollection reloads the samples a previous run of this node
+// kept, then samples its running instances every metricsInterval.
+func (d *Daemon) startMetricsCollection() {
+	ticker := time.NewTicker(metricsInterval)
+	go func() {
+		defer ticker.Stop()
+		d.restoreMetrics()
+		for {
+			select {
+			case <-d.ctx.Done():
+				return
+			case <-ticker.C:
+				d.sampleInstanceMetrics(utils.Now())
+			}
+		}
+	}()
+}
+
+// sampleInstanceMetrics records a sample of every running instance's
+// metrics, persists it to the metrics stream and drops samples older than
+// metricsRetention.
+func (d *Daemon) sampleInstanceMetrics(now time.Time) {
+	var records []metricRecord
+	for _, instance := range d.Instances.ListVMs() {
+		sample, ok := d.readInstanceSample(instance)
+		if !ok {
+			continue
+		}
+		if values := d.metrics.record(instance.ID, sample, now); len(values) > 0 {
+			records = append(records, metricRecord{InstanceID: instance.ID, AccountID: sample.accountID, Timestamp: now, Values: values})
+		}
+	}
+	if len(records) > 0 && d.jsManager != nil {
+		if err := d.jsManager.PublishMetricRecords(d.node, records); err != nil {
+			slog.Warn("Metrics: failed to persist samples", "err", err)
+		}
+	}
+	d.metrics.prune(now.Add(-metricsRetention))
+}
+
+// restoreMetrics reloads the samples this node persisted within
+// metricsRetention.
+func (d *Daemon) restoreMetrics() {
+	if d.jsManager == nil {
+		return
+	}
+	records, err := d.jsManager.LoadMetricRecords(d.node)
+	if err != nil {
+		slog.Warn("Metrics: failed to reload persisted samples", "err", err)
+	}
+	d.metrics.restore(records, utils.Now().Add(-metricsRetention))
+	slog.Debug("Metrics: reloaded persisted samples", "records", len(records))
+}
+
+// readInstanceSample reads the counters and gauges of a running instance
+// from its QEMU process, QMP and tap devices.
+func (d *Daemon) readInstanceSample(instance *vm.VM) (instanceSample, bool) {
+	var running bool
+	var instanceType string
+	var q *qmp.QMPClient
+	var taps []string
+	sample := instanceSample{memory: -1}
+	d.Instances.WithVM(instance.ID, func(v *vm.VM) {
+		running = v.Status == vm.StateRunning
+		sample.accountID = v.AccountID
+		instanceType = v.InstanceType
+		q = v.QMPClient
+		if v.ENIId != "" {
+			taps = append(taps, TapDeviceName(v.ENIId))
+		}
+		for _, extra := range v.ExtraENIs {
+			taps = append(taps, TapDeviceName(extra.ENIID))
+		}
+	})
+	if !running {
+		return sample, false
+	}
+
+	pid, err := utils.ReadPidFile(instance.ID)
+	if err != nil || pid <= 0 {
+		return sample, false
+	}
+	sample.pid = pid
+
+	var memMiB int64
+	if d.resourceMgr != nil {
+		if info, ok := d.resourceMgr.instanceTypes[instanceType]; ok {
+			sample.vcpus = instanceTypeVCPUs(info)
+			memMiB = instanceTypeMemoryMiB(info)
+		}
+	}
+
+	c := &sample.counters
+	if cpuSeconds, err := processCPUSeconds(pid); err == nil {
+		c.cpu, c.cpuSeconds = true, cpuSeconds
+	} else {
+		slog.Debug("Metrics: failed to read instance CPU time", "instanceId", instance.ID, "err", err)
+	}
+	if rss, err := processRSSBytes(pid); err == nil && memMiB > 0 {
+		sample.memory = min(100, float64(rss)/float64(memMiB<<20)*100)
+	}
+	if len(taps) > 0 {
+		c.net = true
+		for _, tap := range taps {
+			// The host receives what the guest sends, so the tap's rx is the
+			// instance's out.
+			rxBytes, err1 := readNetCounter(tap, "rx_bytes")
+			txBytes, err2 := readNetCounter(tap, "tx_bytes")
+			rxPkts, err3 := readNetCounter(tap, "rx_packets")
+			txPkts, err4 := readNetCounter(tap, "tx_packets")
+			if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+				slog.Debug("Metrics: failed to read tap counters", "instanceId", instance.ID, "tap", tap)
+				c.net = false
+				break
+			}
+			c.netOutBytes += rxBytes
+			c.netInBytes += txBytes
+			c.netOutPkts += rxPkts
+			c.netInPkts += txPkts
+		}
+	}
+	if err := d.readBlockStats(q, instance.ID, c); err != nil {
+		slog.Debug("Metrics: failed to query block stats", "instanceId", instance.ID, "err", err)
+	}
+	return sample, true
+}
+
+// qmpBlockStats is the part of a query-blockstats entry metrics use.
+type qmpBlockStats struct {
+	Stats struct {
+		RdBytes      uint64 `json:"rd_bytes"`
+		WrBytes      uint64 `json:"wr_bytes"`
+		RdOperations uint64 `json:"rd_operations"`
+		WrOperations uint64 `json:"wr_operations"`
+	} `json:"stats"`
+}
+
+// readBlockStats totals the I/O of all the instance's block devices into c.
+func (d *Daemon) readBlockStats(q *qmp.QMPClient, instanceID string, c *metricCounters) error {
+	resp, err := d.SendQMPCommand(q, qmp.QMPCommand{Execute: "query-blockstats"}, instanceID)
+	if err != nil {
+		return err
+	}
+	var devices []qmpBlockStats
+	if err := json.Unmarshal(resp.Return, &devices); err != nil {
+		return fmt.Errorf("parse query-blockstats: %w", err)
+	}
+	for _, dev := range devices {
+		c.diskReadBytes += dev.Stats.RdBytes
+		c.diskWriteBytes += dev.Stats.WrBytes
+		c.diskReadOps += dev.Stats.RdOperations
+		c.diskWriteOps += dev.Stats.WrOperations
+	}
+	c.disk = true
+	return nil
+}
+
+// processRSSBytes returns the resident memory of a process.
+func processRSSBytes(pid int) (uint64, error) {
+	data, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "statm"))
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("malformed statm for pid %d", pid)
+	}
+	pages, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse resident pages: %w", err)
+	}
+	return pages * uint64(os.Getpagesize()), nil
+}
+
+// readNetCounter reads one of a network device's statistics counters.
+func readNetCounter(dev, name string) (uint64, error) {
+	data, err := os.ReadFile(filepath.Join(sysClassNet, dev, "statistics", name))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// record adds a sample of instanceID taken at now and returns the values it
+// added. Counters are sampled as the change since the last reading, so the
+// first reading of a QEMU process only sets the baseline.
+func (m *instanceMetrics) record(instanceID string, sample instanceSample, now time.Time) map[string]float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.seriesLocked(instanceID)
+	s.accountID = sample.accountID
+
+	values := map[string]float64{}
+	add := func(name string, value float64) {
+		s.samples[name] = append(s.samples[name], types.MetricSample{Timestamp: now, Value: value})
+		values[name] = value
+	}
+	if sample.memory >= 0 {
+		add(types.MetricMemoryUtilization, sample.memory)
+	}
+
+	// A new QEMU process restarts its counters.
+	if s.pid == sample.pid && !s.lastAt.IsZero() {
+		last, cur := s.last, sample.counters
+		if elapsed := now.Sub(s.lastAt).Seconds(); cur.cpu && last.cpu && elapsed > 0 && sample.vcpus > 0 {
+			used := (cur.cpuSeconds - last.cpuSeconds) / (elapsed * float64(sample.vcpus)) * 100
+			add(types.MetricCPUUtilization, max(0, min(100, used)))
+		}
+		if cur.net && last.net {
+			add(types.MetricNetworkIn, counterDelta(last.netInBytes, cur.netInBytes))
+			add(types.MetricNetworkOut, counterDelta(last.netOutBytes, cur.netOutBytes))
+			add(types.MetricNetworkPacketsIn, counterDelta(last.netInPkts, cur.netInPkts))
+			add(types.MetricNetworkPacketsOut, counterDelta(last.netOutPkts, cur.netOutPkts))
+		}
+		if cur.disk && last.disk {
+			add(types.MetricDiskReadBytes, counterDelta(last.diskReadBytes, cur.diskReadBytes))
+			add(types.MetricDiskWriteBytes, counterDelta(last.diskWriteBytes, cur.diskWriteBytes))
+			add(types.MetricDiskReadOps, counterDelta(last.diskReadOps, cur.diskReadOps))
+			add(types.MetricDiskWriteOps, counterDelta(last.diskWriteOps, cur.diskWriteOps))
+		}
+	}
+	s.pid = sample.pid
+	s.last = sample.counters
+	s.lastAt = now
+	return values
+}
+
+// restore adds persisted samples taken at or after cutoff, oldest first.
+// Counter baselines aren't persisted, so each instance's next reading sets
+// a new one.
+func (m *instanceMetrics) restore(records []metricRecord, cutoff time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, r := range records {
+		if r.Timestamp.Before(cutoff) {
+			continue
+		}
+		s := m.seriesLocked(r.InstanceID)
+		s.accountID = r.AccountID
+		for name, value := range r.Values {
+			s.samples[name] = append(s.samples[name], types.MetricSample{Timestamp: r.Timestamp, Value: value})
+		}
+	}
+}
+
+// seriesLocked returns the series of instanceID, creating it. The caller
+// must hold m.mu.
+func (m *instanceMetrics) seriesLocked(instanceID string) *metricSeries {
+	if m.series == nil {
+		m.series = map[string]*metricSeries{}
+	}
+	s, ok := m.series[instanceID]
+	if !ok {
+		s = &metricSeries{samples: map[string][]types.MetricSample{}}
+		m.series[instanceID] = s
+	}
+	return s
+}
+
+// counterDelta is the increase of a counter, or 0 if it was reset (e.g. a
+// tap device recreated on a volume hotplug or ENI change).
+func counterDelta(last, cur uint64) float64 {
+	if cur < last {
+		return 0
+	}
+	return float64(cur - last)
+}
+
+// prune drops samples taken before cutoff, and the instances left without
+// any.
+func (m *instanceMetrics) prune(cutoff time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, s := range m.series {
+		for name, samples := range s.samples {
+			i := 0
+			for i < len(samples) && samples[i].Timestamp.Before(cutoff) {
+				i++
+			}
+			if i == len(samples) {
+				delete(s.samples, name)
+				continue
+			}
+			s.samples[name] = samples[i:]
+		}
+		if len(s.samples) == 0 && s.lastAt.Before(cutoff) {
+			delete(m.series, id)
+		}
+	}
+}
+
+// query returns the samples of the instances accountID may see that match
+// input, capped at maxMetricSamplesPerReply.
+func (m *instanceMetrics) query(accountID string, input *types.GetInstanceMetricsInput) types.GetInstanceMetricsOutput {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wanted := make(map[string]bool, len(input.InstanceIDs))
+	for _, id := range input.InstanceIDs {
+		wanted[id] = true
+	}
+
+	output := types.GetInstanceMetricsOutput{Instances: map[string]map[string][]types.MetricSample{}}
+	for id, s := range m.series {
+		if len(wanted) > 0 && !wanted[id] || !isInstanceVisible(accountID, s.accountID) {
+			continue
+		}
+		metrics := map[string][]types.MetricSample{}
+		for name, samples := range s.samples {
+			if input.MetricName != "" && name != input.MetricName {
+				continue
+			}
+			var matched []types.MetricSample
+			for _, sample := range samples {
+				if !input.StartTime.IsZero() && sample.Timestamp.Before(input.StartTime) ||
+					!input.EndTime.IsZero() && !sample.Timestamp.Before(input.EndTime) {
+					continue
+				}
+				matched = append(matched, sample)
+			}
+			switch {
+			case len(matched) == 0:
+			case input.NamesOnly:
+				metrics[name] = nil
+			default:
+				metrics[name] = matched
+			}
+		}
+		if len(metrics) > 0 {
+			output.Instances[id] = metrics
+		}
+	}
+	capMetricSamples(&output, maxMetricSamplesPerReply)
+	return output
+}
+
+// capMetricSamples trims output to the samples taken before the first
+// timestamp at which their count passes limit, and sets NextStartTime
+// there. The samples of the earliest timestamp are always kept, so paging
+// through a window makes progress.
+func capMetricSamples(output *types.GetInstanceMetricsOutput, limit int) {
+	perTime := map[time.Time]int{}
+	total := 0
+	for _, metrics := range output.Instances {
+		for _, samples := range metrics {
+			for _, sample := range samples {
+				perTime[sample.Timestamp]++
+				total++
+			}
+		}
+	}
+	if total <= limit {
+		return
+	}
+
+	times := slices.SortedFunc(maps.Keys(perTime), time.Time.Compare)
+	var cutoff time.Time
+	kept := 0
+	for i, ts := range times {
+		kept += perTime[ts]
+		if kept > limit && i > 0 {
+			cutoff = ts
+			break
+		}
+	}
+	if cutoff.IsZero() {
+		return
+	}
+
+	for id, metrics := range output.Instances {
+		for name, samples := range metrics {
+			i := slices.IndexFunc(samples, func(sample types.MetricSample) bool { return !sample.Timestamp.Before(cutoff) })
+			switch {
+			case i == 0:
+				delete(metrics, name)
+			case i > 0:
+				metrics[name] = samples[:i]
+			}
+		}
+		if len(metrics) == 0 {
+			delete(output.Instances, id)
+		}
+	}
+	output.NextStartTime = cutoff
+}
+
+// handleCloudWatchGetInstanceMetrics returns the metric samples this node
+// holds for the caller's instances. It fans out to all nodes and the gateway
+// merges the replies.
+func (d *Daemon) handleCloudWatchGetInstanceMetrics(msg *nats.Msg) {
+	accountID := utils.AccountIDFromMsg(msg)
+
+	var input types.GetInstanceMetricsInput
+	if errResp := utils.UnmarshalJsonPayload(&input, msg.Data); errResp != nil {
+		respondWithError(msg, awserrors.ErrorValidationError)
+		return
+	}
+
+	respondWithJSON(msg, d.metrics.query(accountID, &input))
+}
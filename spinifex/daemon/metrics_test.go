@@ -0,0 +1,251 @@
+package daemon
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mulgadc/spinifex/spinifex/qmp"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstanceMetrics_Record(t *testing.T) {
+	var m instanceMetrics
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return start.Add(time.Duration(minutes) * time.Minute) }
+	sample := func(pid int, cpuSeconds float64, netIn, diskRead uint64) instanceSample {
+		return instanceSample{
+			accountID: testAccountID,
+			pid:       pid,
+			vcpus:     2,
+			memory:    25,
+			counters: metricCounters{
+				cpu: true, net: true, disk: true,
+				cpuSeconds: cpuSeconds, netInBytes: netIn, diskReadBytes: diskRead,
+			},
+		}
+	}
+
+	// The first reading only sets the counter baseline.
+	m.record("i-metrics-001", sample(10, 100, 1000, 500), at(0))
+	// One of two vCPUs busy for the minute.
+	m.record("i-metrics-001", sample(10, 160, 4000, 500), at(1))
+	// A restarted QEMU process starts a new baseline.
+	m.record("i-metrics-001", sample(11, 5, 10, 0), at(2))
+	// A counter reset (e.g. a recreated tap) counts as no traffic.
+	m.record("i-metrics-001", sample(11, 5, 0, 0), at(3))
+
+	all := m.query(testAccountID, &types.GetInstanceMetricsInput{})
+	metrics := all.Instances["i-metrics-001"]
+	require.NotNil(t, metrics)
+	assert.Equal(t, []types.MetricSample{{Timestamp: at(1), Value: 50}, {Timestamp: at(3), Value: 0}}, metrics[types.MetricCPUUtilization])
+	assert.Equal(t, []types.MetricSample{{Timestamp: at(1), Value: 3000}, {Timestamp: at(3), Value: 0}}, metrics[types.MetricNetworkIn])
+	assert.Len(t, metrics[types.MetricMemoryUtilization], 4)
+
+	window := m.query(testAccountID, &types.GetInstanceMetricsInput{
+		MetricName: types.MetricCPUUtilization,
+		StartTime:  at(2),
+		EndTime:    at(4),
+	})
+	assert.Equal(t, map[string][]types.MetricSample{
+		types.MetricCPUUtilization: {{Timestamp: at(3), Value: 0}},
+	}, window.Instances["i-metrics-001"])
+
+	names := m.query(testAccountID, &types.GetInstanceMetricsInput{NamesOnly: true})
+	assert.Len(t, names.Instances["i-metrics-001"], len(types.InstanceMetricUnits))
+	assert.Contains(t, names.Instances["i-metrics-001"], types.MetricDiskWriteOps)
+	assert.Nil(t, names.Instances["i-metrics-001"][types.MetricDiskWriteOps])
+
+	assert.Empty(t, m.query("000000000002", &types.GetInstanceMetricsInput{}).Instances, "other accounts don't see the instance")
+
+	m.prune(at(2))
+	assert.Len(t, m.query(testAccountID, &types.GetInstanceMetricsInput{MetricName: types.MetricCPUUtilization}).Instances["i-metrics-001"][types.MetricCPUUtilization], 1)
+	m.prune(at(5))
+	assert.Empty(t, m.series, "an instance with no samples left is dropped")
+}
+
+func TestSampleInstanceMetrics(t *testing.T) {
+	d, cleanup := newTestDaemon(t)
+	defer cleanup()
+
+	var instanceType string
+	var memMiB int64
+	for name, info := range d.resourceMgr.instanceTypes {
+		if instanceTypeVCPUs(info) > 0 && instanceTypeMemoryMiB(info) > 0 {
+			instanceType, memMiB = name, instanceTypeMemoryMiB(info)
+			break
+		}
+	}
+	if instanceType == "" {
+		t.Skip("no instance types on this host")
+	}
+
+	const pid = 4343
+	root := t.TempDir()
+	oldProc, oldNet := procRoot, sysClassNet
+	procRoot, sysClassNet = filepath.Join(root, "proc"), filepath.Join(root, "net")
+	t.Cleanup(func() { procRoot, sysClassNet = oldProc, oldNet })
+
+	runDir := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", runDir)
+	instanceID := "i-metrics-002"
+	require.NoError(t, os.WriteFile(filepath.Join(runDir, instanceID+".pid"), []byte(strconv.Itoa(pid)), 0o644))
+
+	procDir := filepath.Join(procRoot, strconv.Itoa(pid))
+	require.NoError(t, os.MkdirAll(procDir, 0o755))
+	// Resident pages covering a quarter of the instance's memory.
+	residentPages := (memMiB << 20) / 4 / int64(os.Getpagesize())
+	require.NoError(t, os.WriteFile(filepath.Join(procDir, "statm"), []byte("1000000 "+strconv.FormatInt(residentPages, 10)+" 0 0 0 0 0\n"), 0o644))
+
+	tap := TapDeviceName("eni-metrics002")
+	statsDir := filepath.Join(sysClassNet, tap, "statistics")
+	require.NoError(t, os.MkdirAll(statsDir, 0o755))
+	setCounters := func(utime, rx, tx int) {
+		t.Helper()
+		stat := "4343 (qemu) S 1 4343 4343 0 -1 0 0 0 0 0 " + strconv.Itoa(utime) + " 0 0 0 20 0 3 0 100 0 0\n"
+		require.NoError(t, os.WriteFile(filepath.Join(procDir, "stat"), []byte(stat), 0o644))
+		for name, v := range map[string]int{"rx_bytes": rx, "tx_bytes": tx, "rx_packets": rx / 100, "tx_packets": tx / 100} {
+			require.NoError(t, os.WriteFile(filepath.Join(statsDir, name), []byte(strconv.Itoa(v)+"\n"), 0o644))
+		}
+	}
+
+	reads := 0
+	q, qmpCleanup := newMockQMPClient(t, func(cmd qmp.QMPCommand) map[string]any {
+		require.Equal(t, "query-blockstats", cmd.Execute)
+		reads++
+		return map[string]any{"return": []map[string]any{
+			{"device": "", "stats": map[string]any{"rd_bytes": 4096 * reads, "wr_bytes": 0, "rd_operations": reads, "wr_operations": 0}},
+			{"device": "", "stats": map[string]any{"rd_bytes": 0, "wr_bytes": 512 * reads, "rd_operations": 0, "wr_operations": 2 * reads}},
+		}}
+	})
+	defer qmpCleanup()
+
+	d.Instances.UpsertVM(&vm.VM{
+		ID:           instanceID,
+		Status:       vm.StateRunning,
+		InstanceType: instanceType,
+		AccountID:    testAccountID,
+		ENIId:        "eni-metrics002",
+		QMPClient:    q,
+	})
+
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	setCounters(0, 0, 0)
+	d.sampleInstanceMetrics(start)
+	setCounters(600, 20000, 5000)
+	d.sampleInstanceMetrics(start.Add(time.Minute))
+
+	reqData, _ := json.Marshal(&types.GetInstanceMetricsInput{InstanceIDs: []string{instanceID}})
+	topic := "test.cloudwatch.GetInstanceMetrics." + t.Name()
+	sub, err := d.natsConn.Subscribe(topic, d.handleCloudWatchGetInstanceMetrics)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+	reply, err := natsRequest(d.natsConn, topic, reqData, 5*time.Second)
+	require.NoError(t, err)
+
+	var output types.GetInstanceMetricsOutput
+	require.NoError(t, json.Unmarshal(reply.Data, &output))
+	latest := func(name string) float64 {
+		t.Helper()
+		samples := output.Instances[instanceID][name]
+		require.NotEmpty(t, samples, name)
+		return samples[len(samples)-1].Value
+	}
+
+	vcpus := float64(instanceTypeVCPUs(d.resourceMgr.instanceTypes[instanceType]))
+	assert.InDelta(t, min(100, 6/(60*vcpus)*100), latest(types.MetricCPUUtilization), 1e-9)
+	assert.InDelta(t, 25, latest(types.MetricMemoryUtilization), 0.1)
+	assert.Equal(t, 5000.0, latest(types.MetricNetworkIn), "tap tx is guest in")
+	assert.Equal(t, 20000.0, latest(types.MetricNetworkOut))
+	assert.Equal(t, 50.0, latest(types.MetricNetworkPacketsIn))
+	assert.Equal(t, 4096.0, latest(types.MetricDiskReadBytes))
+	assert.Equal(t, 512.0, latest(types.MetricDiskWriteBytes))
+	assert.Equal(t, 1.0, latest(types.MetricDiskReadOps))
+	assert.Equal(t, 2.0, latest(types.MetricDiskWriteOps))
+}
+
+func TestCapMetricSamples(t *testing.T) {
+	start := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	samples := func(minutes ...int) []types.MetricSample {
+		var out []types.MetricSample
+		for _, m := range minutes {
+			out = append(out, types.MetricSample{Timestamp: start.Add(time.Duration(m) * time.Minute), Value: float64(m)})
+		}
+		return out
+	}
+	output := func() types.GetInstanceMetricsOutput {
+		return types.GetInstanceMetricsOutput{Instances: map[string]map[string][]types.MetricSample{
+			"i-a": {types.MetricCPUUtilization: samples(0, 1, 2, 3), types.MetricNetworkIn: samples(2, 3)},
+			"i-b": {types.MetricCPUUtilization: samples(3)},
+		}}
+	}
+
+	small := output()
+	capMetricSamples(&small, 7)
+	assert.Equal(t, output(), small, "a reply within the limit is left alone")
+
+	// Samples at minutes 0 and 1 fit; minute 2's would pass the limit.
+	paged := output()
+	capMetricSamples(&paged, 3)
+	assert.Equal(t, types.GetInstanceMetricsOutput{
+		Instances:     map[string]map[string][]types.MetricSample{"i-a": {types.MetricCPUUtilization: samples(0, 1)}},
+		NextStartTime: start.Add(2 * time.Minute),
+	}, paged)
+
+	// The earliest timestamp is kept whole even past the limit.
+	crowded := types.GetInstanceMetricsOutput{Instances: map[string]map[string][]types.MetricSample{
+		"i-a": {types.MetricCPUUtilization: samples(0, 1)},
+		"i-b": {types.MetricCPUUtilization: samples(0, 1)},
+	}}
+	capMetricSamples(&crowded, 1)
+	assert.Equal(t, start.Add(time.Minute), crowded.NextStartTime)
+	assert.Len(t, crowded.Instances, 2)
+}
+
+func TestMetrics_PersistAndRestore(t *testing.T) {
+	nc, err := nats.Connect(sharedJSNATSURL)
+	require.NoError(t, err)
+	defer nc.Close()
+	jsm, err := NewJetStreamManager(nc, 1)
+	require.NoError(t, err)
+	require.NoError(t, jsm.InitMetricsStream())
+
+	node := "node-metrics-restore"
+	t.Cleanup(func() {
+		js, _ := nc.JetStream()
+		_ = js.PurgeStream(MetricsStream, &nats.StreamPurgeRequest{Subject: subjects.MetricSamples(node)})
+	})
+
+	now := utils.Now().Truncate(time.Minute)
+	old := now.Add(-metricsRetention - time.Minute)
+	require.NoError(t, jsm.PublishMetricRecords(node, []metricRecord{
+		{InstanceID: "i-restore-1", AccountID: testAccountID, Timestamp: old, Values: map[string]float64{types.MetricCPUUtilization: 5}},
+	}))
+	require.NoError(t, jsm.PublishMetricRecords(node, []metricRecord{
+		{InstanceID: "i-restore-1", AccountID: testAccountID, Timestamp: now, Values: map[string]float64{types.MetricCPUUtilization: 40, types.MetricNetworkIn: 1000}},
+	}))
+
+	d := &Daemon{node: node, jsManager: jsm}
+	d.restoreMetrics()
+
+	got := d.metrics.query(testAccountID, &types.GetInstanceMetricsInput{InstanceIDs: []string{"i-restore-1"}})
+	assert.Equal(t, map[string][]types.MetricSample{
+		types.MetricCPUUtilization: {{Timestamp: now, Value: 40}},
+		types.MetricNetworkIn:      {{Timestamp: now, Value: 1000}},
+	}, got.Instances["i-restore-1"], "samples past the retention window aren't reloaded")
+	assert.Empty(t, d.metrics.query("000000000002", &types.GetInstanceMetricsInput{}).Instances)
+
+	// A node that never published has nothing to reload.
+	empty := &Daemon{node: "node-metrics-none", jsManager: jsm}
+	empty.restoreMetrics()
+	assert.Empty(t, empty.metrics.series)
+}
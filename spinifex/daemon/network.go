@@ -110,24 +110,62 @@ func (p *OVSNetworkPlumber) CleanupTapDevice(eniId string) error {
 	return nil
 }
 
+// setupPrimaryTap creates the tap device of the instance's primary ENI on
+// br-int and appends its QEMU virtio-net NIC to instance.Config.
+func (d *Daemon) setupPrimaryTap(instance *vm.VM) error {
+	if err := d.networkPlumber.SetupTapDevice(instance.ENIId, instance.ENIMac); err != nil {
+		slog.Error("Failed to set up tap device", "eni", instance.ENIId, "err", err)
+		return fmt.Errorf("setup tap device: %w", err)
+	}
+
+	// Fail closed: a guest must not boot able to reach a metadata
+	// endpoint it was launched with disabled.
+	if err := d.applyMetadataFirewallToTap(instance, TapDeviceName(instance.ENIId)); err != nil {
+		slog.Error("Failed to apply metadata firewall", "instanceId", instance.ID, "err", err)
+		if cleanErr := d.networkPlumber.CleanupTapDevice(instance.ENIId); cleanErr != nil {
+			slog.Warn("Failed to clean up tap device after metadata firewall failure", "eni", instance.ENIId, "err", cleanErr)
+		}
+		return fmt.Errorf("apply metadata firewall: %w", err)
+	}
+
+	tapName := TapDeviceName(instance.ENIId)
+	instance.Config.NetDevs = append(instance.Config.NetDevs, vm.NetDev{
+		Value: fmt.Sprintf("tap,id=net0,ifname=%s,script=no,downscript=no", tapName),
+	})
+	instance.Config.Devices = append(instance.Config.Devices, vm.Device{
+		Value: fmt.Sprintf("virtio-net-pci,netdev=net0,mac=%s", instance.ENIMac),
+	})
+
+	slog.Info("VPC networking configured", "tap", tapName, "eni", instance.ENIId, "mac", instance.ENIMac)
+	return nil
+}
+
 // setupExtraENINICs creates tap devices on br-int and appends matching QEMU
 // virtio-net device entries to instance.Config for each additional ENI a
 // system VM spans. The primary ENI (instance.ENIId) is handled separately by
-// the LaunchInstance caller. Cloud-init brings the guest interfaces up via
+// the LaunchInstance caller. Each tap gets the instance's metadata firewall
+// before QEMU is given it. Cloud-init brings the guest interfaces up via
 // per-MAC DHCP blocks written by generateNetworkConfig.
 func (d *Daemon) setupExtraENINICs(instance *vm.VM) error {
-	for idx, extra := range instance.ExtraENIs {
+	for _, extra := range instance.ExtraENIs {
 		if err := d.networkPlumber.SetupTapDevice(extra.ENIID, extra.ENIMac); err != nil {
 			slog.Error("Failed to set up tap device for extra ENI", "eni", extra.ENIID, "err", err)
 			return fmt.Errorf("setup tap device for extra ENI %s: %w", extra.ENIID, err)
 		}
 		extraTapName := TapDeviceName(extra.ENIID)
-		netID := fmt.Sprintf("net%d", idx+1)
+		if err := d.applyMetadataFirewallToTap(instance, extraTapName); err != nil {
+			slog.Error("Failed to apply metadata firewall to extra ENI", "instanceId", instance.ID, "eni", extra.ENIID, "err", err)
+			if cleanErr := d.networkPlumber.CleanupTapDevice(extra.ENIID); cleanErr != nil {
+				slog.Warn("Failed to clean up extra ENI tap device after metadata firewall failure", "eni", extra.ENIID, "err", cleanErr)
+			}
+			return fmt.Errorf("apply metadata firewall to extra ENI %s: %w", extra.ENIID, err)
+		}
+		netID := ENINetdevID(extra.ENIID)
 		instance.Config.NetDevs = append(instance.Config.NetDevs, vm.NetDev{
 			Value: fmt.Sprintf("tap,id=%s,ifname=%s,script=no,downscript=no", netID, extraTapName),
 		})
 		instance.Config.Devices = append(instance.Config.Devices, vm.Device{
-			Value: fmt.Sprintf("virtio-net-pci,netdev=%s,mac=%s", netID, extra.ENIMac),
+			Value: fmt.Sprintf("virtio-net-pci,id=%s,netdev=%s,mac=%s", ENIDeviceID(extra.ENIID), netID, extra.ENIMac),
 		})
 		slog.Info("Extra VPC NIC configured",
 			"tap", extraTapName, "eni", extra.ENIID, "mac", extra.ENIMac, "subnet", extra.SubnetID)
@@ -158,6 +196,18 @@ func TapDeviceName(eniId string) string {
 	return name
 }
 
+// ENINetdevID returns the QEMU netdev ID of an extra ENI's tap backend.
+// IDs follow the ENI rather than its position so an interface can be
+// hot-unplugged by name after others have come and gone.
+func ENINetdevID(eniId string) string {
+	return "net-" + eniId
+}
+
+// ENIDeviceID returns the QEMU device ID of an extra ENI's virtio-net NIC.
+func ENIDeviceID(eniId string) string {
+	return "nic-" + eniId
+}
+
 // OVSIfaceID returns the OVS external_ids:iface-id value for an ENI.
 // This must match the OVN LogicalSwitchPort name for ovn-controller binding.
 func OVSIfaceID(eniId string) string {
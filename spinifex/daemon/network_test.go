@@ -255,16 +255,19 @@ func TestSetupExtraENINICs_AppendsOnePerExtra(t *testing.T) {
 		t.Errorf("second setup call = %+v, want eni-bbb/02:00:00:bb:bb:bb", mock.SetupCalls[1])
 	}
 
-	// NetDevs and Devices each get one entry per extra ENI, named net1/net2.
+	// NetDevs and Devices each get one entry per extra ENI, named after it.
 	if len(instance.Config.NetDevs) != 2 || len(instance.Config.Devices) != 2 {
 		t.Fatalf("expected 2 netdevs + 2 devices, got %d + %d",
 			len(instance.Config.NetDevs), len(instance.Config.Devices))
 	}
-	if !strings.Contains(instance.Config.NetDevs[0].Value, "id=net1") {
-		t.Errorf("netdev[0] = %q, want id=net1", instance.Config.NetDevs[0].Value)
+	if !strings.Contains(instance.Config.NetDevs[0].Value, "id=net-eni-aaa") {
+		t.Errorf("netdev[0] = %q, want id=net-eni-aaa", instance.Config.NetDevs[0].Value)
 	}
-	if !strings.Contains(instance.Config.NetDevs[1].Value, "id=net2") {
-		t.Errorf("netdev[1] = %q, want id=net2", instance.Config.NetDevs[1].Value)
+	if !strings.Contains(instance.Config.NetDevs[1].Value, "id=net-eni-bbb") {
+		t.Errorf("netdev[1] = %q, want id=net-eni-bbb", instance.Config.NetDevs[1].Value)
+	}
+	if !strings.Contains(instance.Config.Devices[0].Value, "id=nic-eni-aaa,netdev=net-eni-aaa") {
+		t.Errorf("device[0] = %q, want id=nic-eni-aaa on netdev net-eni-aaa", instance.Config.Devices[0].Value)
 	}
 	if !strings.Contains(instance.Config.Devices[0].Value, "mac=02:00:00:aa:aa:aa") {
 		t.Errorf("device[0] = %q, missing primary MAC", instance.Config.Devices[0].Value)
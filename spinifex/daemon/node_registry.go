@@ -0,0 +1,384 @@
+package daemon
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/nats-io/nats.go"
+)
+
+// heartbeatMissLimit is how many heartbeat intervals a node may go without
+// a heartbeat before the node registry marks it lost.
+const heartbeatMissLimit = 3
+
+// lostNodeStartTimeout bounds the wait for another node to start an
+// instance rescheduled off a lost node.
+const lostNodeStartTimeout = 2 * time.Minute
+
+// nodeRegistry tracks the cluster's nodes from the heartbeats they publish.
+// Every daemon keeps its own; they agree because they hear the same
+// heartbeats.
+type nodeRegistry struct {
+	mu    sync.Mutex
+	nodes map[string]*registeredNode
+}
+
+// registeredNode is the registry's record of one node.
+type registeredNode struct {
+	heartbeat Heartbeat
+	lastSeen  time.Time
+	lostSince time.Time
+	impaired  []string
+}
+
+func newNodeRegistry() *nodeRegistry {
+	return &nodeRegistry{nodes: make(map[string]*registeredNode)}
+}
+
+// record stores a heartbeat received at now, reporting whether the node was
+// lost until then.
+func (r *nodeRegistry) record(h Heartbeat, now time.Time) (rejoined bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n, ok := r.nodes[h.Node]
+	if !ok {
+		n = &registeredNode{}
+		r.nodes[h.Node] = n
+	}
+	rejoined = !n.lostSince.IsZero()
+	n.heartbeat = h
+	n.lastSeen = now
+	n.lostSince = time.Time{}
+	n.impaired = nil
+	return rejoined
+}
+
+// markLost marks lost every node last heard from more than silence before
+// now, returning the names of those newly lost, sorted.
+func (r *nodeRegistry) markLost(now time.Time, silence time.Duration) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var lost []string
+	for name, n := range r.nodes {
+		if n.lostSince.IsZero() && now.Sub(n.lastSeen) > silence {
+			n.lostSince = now
+			lost = append(lost, name)
+		}
+	}
+	slices.Sort(lost)
+	return lost
+}
+
+// setImpaired records the instances that were running on a lost node.
+func (r *nodeRegistry) setImpaired(node string, instanceIDs []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if n, ok := r.nodes[node]; ok && !n.lostSince.IsZero() {
+		n.impaired = instanceIDs
+	}
+}
+
+// up reports whether the registry has heard from node and not marked it
+// lost.
+func (r *nodeRegistry) up(node string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n, ok := r.nodes[node]
+	return ok && n.lostSince.IsZero()
+}
+
+// hosts lists every node the registry has heard from, sorted by name.
+func (r *nodeRegistry) hosts() []types.HostInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hosts := make([]types.HostInfo, 0, len(r.nodes))
+	for name, n := range r.nodes {
+		h := n.heartbeat
+		state := h.Status
+		if state == "" {
+			state = types.HostStateAvailable
+		}
+		if !n.lostSince.IsZero() {
+			state = types.HostStateLost
+		}
+		hosts = append(hosts, types.HostInfo{
+			Node:              name,
+			State:             state,
+			Version:           h.Version,
+			LastHeartbeat:     n.lastSeen,
+			LostSince:         n.lostSince,
+			TotalVCPU:         h.TotalVCPU,
+			TotalMemGB:        h.TotalMem,
+			AllocVCPU:         h.AllocatedVCPU,
+			AllocMemGB:        h.AllocatedMem,
+			RunningInstances:  h.RunningCount,
+			ImpairedInstances: slices.Clone(n.impaired),
+		})
+	}
+	slices.SortFunc(hosts, func(a, b types.HostInfo) int { return cmp.Compare(a.Node, b.Node) })
+	return hosts
+}
+
+// handleNodeHeartbeat records a heartbeat published by any node, this one
+// included.
+func (d *Daemon) handleNodeHeartbeat(msg *nats.Msg) {
+	if d.registry == nil {
+		return
+	}
+	var h Heartbeat
+	if err := json.Unmarshal(msg.Data, &h); err != nil || h.Node == "" {
+		slog.Debug("Ignoring malformed node heartbeat", "err", err)
+		return
+	}
+	if d.registry.record(h, utils.Now()) {
+		slog.Info("Lost node is sending heartbeats again", "node", h.Node)
+	}
+}
+
+// handleDescribeHosts answers with the node registry's view of every node.
+func (d *Daemon) handleDescribeHosts(msg *nats.Msg) {
+	output := types.DescribeHostsOutput{Hosts: []types.HostInfo{}}
+	if d.registry != nil {
+		output.Hosts = d.registry.hosts()
+	}
+	respondWithJSON(msg, output)
+}
+
+// sweepNodeRegistry marks lost the nodes that missed heartbeatMissLimit
+// heartbeats and flags their running instances impaired. With
+// reschedule_lost_instances set, the JetStream meta-leader then hands those
+// instances to the remaining nodes, so they are rescheduled once.
+func (d *Daemon) sweepNodeRegistry() {
+	if d.registry == nil {
+		return
+	}
+	for _, node := range d.registry.markLost(utils.Now(), heartbeatMissLimit*heartbeatInterval) {
+		if node == d.node {
+			continue
+		}
+		slog.Warn("Node stopped sending heartbeats, marking it lost", "node", node, "missed", heartbeatMissLimit)
+		d.handleLostNode(node)
+	}
+}
+
+// handleLostNode flags the running instances recorded for a lost node
+// impaired and, when configured, reschedules them.
+func (d *Daemon) handleLostNode(node string) {
+	if d.jsManager == nil {
+		return
+	}
+	state, err := d.jsManager.LoadState(node)
+	if err != nil {
+		slog.Error("Failed to load lost node's state", "node", node, "err", err)
+		return
+	}
+
+	var impaired []string
+	for id, instance := range state.VMS {
+		if instance.Status == vm.StateRunning {
+			impaired = append(impaired, id)
+		}
+	}
+	slices.Sort(impaired)
+	d.registry.setImpaired(node, impaired)
+	if len(impaired) == 0 {
+		return
+	}
+	slog.Warn("Instances on lost node are impaired", "node", node, "instances", impaired)
+
+	if !d.config.Daemon.RescheduleLostInstances || d.queryNATSRole() != roleLeader {
+		return
+	}
+	d.rescheduleLostInstances(node, state, impaired)
+}
+
+// rescheduleLostInstances fences the lost node, moves the impaired instances
+// out of its state into the shared KV as stopped, then asks the cluster to
+// start each one. The lost node forgets them, so it does not relaunch them
+// if its daemon starts again, and the fence keeps it from writing them back
+// or mounting their volumes if it was only cut off.
+func (d *Daemon) rescheduleLostInstances(node string, state *vm.Instances, impaired []string) {
+	if err := d.jsManager.WriteFenceMarker(node, d.node); err != nil {
+		slog.Error("Failed to fence lost node, not rescheduling its instances", "node", node, "err", err)
+		return
+	}
+	slog.Warn("Fenced lost node", "node", node)
+
+	var moved []*vm.VM
+	for _, id := range impaired {
+		instance := state.VMS[id]
+		instance.Status = vm.StateStopped
+		instance.LastNode = node
+		d.setStateReason(instance, stateReasonInternalError, "Instance stopped because its host stopped responding")
+		if err := d.jsManager.WriteStoppedInstance(id, instance); err != nil {
+			slog.Error("Failed to hand lost node's instance to shared KV", "node", node, "instanceId", id, "err", err)
+			continue
+		}
+		delete(state.VMS, id)
+		moved = append(moved, instance)
+	}
+	if len(moved) == 0 {
+		return
+	}
+	if err := d.jsManager.WriteState(node, state); err != nil {
+		slog.Error("Failed to remove rescheduled instances from lost node's state", "node", node, "err", err)
+	}
+
+	for _, instance := range moved {
+		go d.startRescheduledInstance(instance)
+	}
+}
+
+// errNodeFenced is returned for the state writes and volume mounts a fenced
+// node refuses.
+var errNodeFenced = errors.New("node is fenced: its instances were rescheduled while it was lost, restart the daemon to rejoin")
+
+// checkFence returns errNodeFenced while the cluster has fenced this node.
+// A marker that can't be read doesn't block: without the cluster KV the
+// write or mount it guards fails anyway.
+func (d *Daemon) checkFence() error {
+	if d.jsManager == nil {
+		return nil
+	}
+	fenced, err := d.jsManager.ReadFenceMarker(d.node)
+	if err != nil {
+		slog.Debug("Failed to read fence marker", "node", d.node, "err", err)
+		return nil
+	}
+	if fenced {
+		return errNodeFenced
+	}
+	return nil
+}
+
+// startRescheduledInstance starts an instance moved off a lost node on
+// whichever node takes the request, as StartInstances would.
+func (d *Daemon) startRescheduledInstance(instance *vm.VM) {
+	data, err := json.Marshal(startStoppedInstanceRequest{InstanceID: instance.ID})
+	if err != nil {
+		slog.Error("Failed to marshal start request", "instanceId", instance.ID, "err", err)
+		return
+	}
+	accountID := instance.AccountID
+	if accountID == "" {
+		accountID = utils.GlobalAccountID
+	}
+
+	reqMsg := nats.NewMsg(utils.Subject("ec2.start"))
+	reqMsg.Data = data
+	reqMsg.Header.Set(utils.AccountIDHeader, accountID)
+	resp, err := d.natsConn.RequestMsg(reqMsg, lostNodeStartTimeout)
+	if err != nil {
+		slog.Error("Failed to reschedule instance from lost node, it stays stopped", "instanceId", instance.ID, "lastNode", instance.LastNode, "err", err)
+		return
+	}
+	if replyErr := utils.DecodeReply(resp).Err; replyErr != nil {
+		slog.Error("Failed to reschedule instance from lost node, it stays stopped", "instanceId", instance.ID, "lastNode", instance.LastNode, "code", replyErr.Code)
+		return
+	}
+	slog.Info("Rescheduled instance from lost node", "instanceId", instance.ID, "lastNode", instance.LastNode)
+}
+
+// ForceTerminateRequest asks the cluster to terminate an orphaned instance:
+// one left in the state of a node that is lost or gone, which
+// TerminateInstances cannot reach, or one stranded in the shared stopped KV.
+type ForceTerminateRequest struct {
+	InstanceID string `json:"instance_id"`
+}
+
+// ForceTerminateResponse reports a force-terminated instance and the node
+// whose state it was taken from, if any.
+type ForceTerminateResponse struct {
+	InstanceID string `json:"instance_id"`
+	Node       string `json:"node,omitempty"`
+	Status     string `json:"status"`
+}
+
+// handleForceTerminate terminates an orphaned instance for an operator.
+// Termination protection does not apply. An instance on a node the registry
+// sees as up is refused: TerminateInstances reaches it there.
+func (d *Daemon) handleForceTerminate(msg *nats.Msg) {
+	var req ForceTerminateRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		slog.Error("handleForceTerminate: failed to unmarshal request", "err", err)
+		respondWithError(msg, awserrors.ErrorServerInternal)
+		return
+	}
+	if req.InstanceID == "" {
+		respondWithError(msg, awserrors.ErrorMissingParameter)
+		return
+	}
+	if d.jsManager == nil {
+		slog.Error("handleForceTerminate: JetStream not available")
+		respondWithError(msg, awserrors.ErrorServerInternal)
+		return
+	}
+
+	instance, node, err := d.takeOrphanedInstance(req.InstanceID)
+	if err != nil {
+		slog.Warn("handleForceTerminate: cannot take instance", "instanceId", req.InstanceID, "err", err)
+		respondWithServiceError(msg, err)
+		return
+	}
+	if err := d.terminateStoppedInstance(instance); err != nil {
+		respondWithError(msg, awserrors.ErrorServerInternal)
+		return
+	}
+
+	slog.Warn("Force-terminated orphaned instance", "instanceId", req.InstanceID, "node", node)
+	respondWithJSON(msg, ForceTerminateResponse{InstanceID: req.InstanceID, Node: node, Status: string(vm.StateTerminated)})
+}
+
+// takeOrphanedInstance finds instanceID in the node states or the shared
+// stopped KV. An instance in the state of a node that is not up is moved to
+// the stopped KV, as rescheduleLostInstances does, so it can be terminated
+// as a stopped instance. It returns the node the instance was taken from.
+func (d *Daemon) takeOrphanedInstance(instanceID string) (*vm.VM, string, error) {
+	states, err := d.jsManager.ListNodeStates()
+	if err != nil {
+		return nil, "", fmt.Errorf("list node states: %w", err)
+	}
+	for node, state := range states {
+		instance, ok := state.VMS[instanceID]
+		if !ok {
+			continue
+		}
+		if node == d.node || (d.registry != nil && d.registry.up(node)) {
+			return nil, "", awserrors.WithDetail(awserrors.ErrorIncorrectInstanceState,
+				fmt.Sprintf("instance %s is on node %s, which is up; use TerminateInstances", instanceID, node))
+		}
+		instance.Status = vm.StateStopped
+		instance.LastNode = node
+		if err := d.jsManager.WriteStoppedInstance(instanceID, instance); err != nil {
+			return nil, "", fmt.Errorf("write stopped instance: %w", err)
+		}
+		delete(state.VMS, instanceID)
+		if err := d.jsManager.WriteState(node, state); err != nil {
+			return nil, "", fmt.Errorf("remove instance from node %s state: %w", node, err)
+		}
+		return instance, node, nil
+	}
+
+	instance, err := d.jsManager.LoadStoppedInstance(instanceID)
+	if err != nil {
+		return nil, "", fmt.Errorf("load stopped instance: %w", err)
+	}
+	if instance == nil {
+		return nil, "", awserrors.WithDetail(awserrors.ErrorInvalidInstanceIDNotFound,
+			fmt.Sprintf("instance %s is not in any node state or the stopped KV", instanceID))
+	}
+	return instance, instance.LastNode, nil
+}
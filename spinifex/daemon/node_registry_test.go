@@ -0,0 +1,187 @@
+package daemon
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/config"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNodeRegistry_MarkLost(t *testing.T) {
+	r := newNodeRegistry()
+	start := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+	silence := heartbeatMissLimit * heartbeatInterval
+
+	r.record(Heartbeat{Node: "node1", Version: "v1.2.0", TotalVCPU: 8, RunningCount: 2}, start)
+	r.record(Heartbeat{Node: "node2", Status: types.HostStateDraining}, start.Add(silence))
+
+	assert.Empty(t, r.markLost(start.Add(silence), silence), "a node exactly at the limit is not lost")
+	assert.Equal(t, []string{"node1"}, r.markLost(start.Add(silence+time.Second), silence))
+	assert.Empty(t, r.markLost(start.Add(2*silence), silence), "a lost node is reported once")
+
+	r.setImpaired("node1", []string{"i-a", "i-b"})
+	r.setImpaired("node2", []string{"i-c"})
+
+	hosts := r.hosts()
+	require.Len(t, hosts, 2)
+	assert.Equal(t, "node1", hosts[0].Node)
+	assert.Equal(t, types.HostStateLost, hosts[0].State)
+	assert.Equal(t, "v1.2.0", hosts[0].Version)
+	assert.Equal(t, 8, hosts[0].TotalVCPU)
+	assert.Equal(t, 2, hosts[0].RunningInstances)
+	assert.Equal(t, []string{"i-a", "i-b"}, hosts[0].ImpairedInstances)
+	assert.Equal(t, start.Add(silence+time.Second), hosts[0].LostSince)
+	assert.Equal(t, types.HostStateDraining, hosts[1].State)
+	assert.Empty(t, hosts[1].ImpairedInstances, "only lost nodes have impaired instances")
+
+	assert.True(t, r.record(Heartbeat{Node: "node1"}, start.Add(3*silence)), "a lost node rejoins")
+	hosts = r.hosts()
+	assert.Equal(t, types.HostStateAvailable, hosts[0].State)
+	assert.Empty(t, hosts[0].ImpairedInstances)
+}
+
+func TestNodeRegistry_Up(t *testing.T) {
+	r := newNodeRegistry()
+	now := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+	r.record(Heartbeat{Node: "node1"}, now)
+	assert.True(t, r.up("node1"))
+	assert.False(t, r.up("node2"), "a node never heard from is not up")
+
+	r.markLost(now.Add(time.Hour), time.Minute)
+	assert.False(t, r.up("node1"))
+}
+
+func TestHandleNodeHeartbeatAndDescribeHosts(t *testing.T) {
+	d := &Daemon{registry: newNodeRegistry()}
+
+	data, err := json.Marshal(Heartbeat{Node: "node1", Version: "v1.2.0", RunningCount: 3})
+	require.NoError(t, err)
+	d.handleNodeHeartbeat(&nats.Msg{Data: data})
+	d.handleNodeHeartbeat(&nats.Msg{Data: []byte("not json")})
+	d.handleNodeHeartbeat(&nats.Msg{Data: []byte("{}")})
+
+	hosts := d.registry.hosts()
+	require.Len(t, hosts, 1)
+	assert.Equal(t, "node1", hosts[0].Node)
+	assert.Equal(t, types.HostStateAvailable, hosts[0].State)
+	assert.Equal(t, 3, hosts[0].RunningInstances)
+}
+
+func TestRescheduleLostInstances_FencesNode(t *testing.T) {
+	nc, err := nats.Connect(sharedJSNATSURL)
+	require.NoError(t, err)
+	defer nc.Close()
+	jsm, err := NewJetStreamManager(nc, 1)
+	require.NoError(t, err)
+	require.NoError(t, jsm.InitKVBucket())
+	require.NoError(t, jsm.InitClusterStateBucket())
+
+	d := &Daemon{node: "node-fence-leader", natsConn: nc, jsManager: jsm, registry: newNodeRegistry(), config: &config.Config{}}
+	lost := "node-fence-lost"
+	state := &vm.Instances{VMS: map[string]*vm.VM{
+		"i-fence-1": {ID: "i-fence-1", Status: vm.StateRunning, AccountID: testAccountID},
+	}}
+	require.NoError(t, jsm.WriteState(lost, state))
+	t.Cleanup(func() {
+		_ = jsm.DeleteFenceMarker(lost)
+		_ = jsm.DeleteStoppedInstance("i-fence-1")
+		_ = jsm.WriteState(lost, &vm.Instances{VMS: map[string]*vm.VM{}})
+	})
+
+	d.rescheduleLostInstances(lost, state, []string{"i-fence-1"})
+
+	fenced, err := jsm.ReadFenceMarker(lost)
+	require.NoError(t, err)
+	assert.True(t, fenced)
+	stopped, err := jsm.LoadStoppedInstance("i-fence-1")
+	require.NoError(t, err)
+	require.NotNil(t, stopped)
+	assert.Equal(t, lost, stopped.LastNode)
+
+	// The lost node, if it was only cut off, can't write its stale view
+	// back or mount the volumes of the instances it lost.
+	lostDaemon := &Daemon{node: lost, natsConn: nc, jsManager: jsm}
+	lostDaemon.Instances.VMS = map[string]*vm.VM{"i-fence-1": {ID: "i-fence-1", Status: vm.StateRunning}}
+	assert.ErrorIs(t, lostDaemon.WriteState(), errNodeFenced)
+	assert.ErrorIs(t, lostDaemon.MountVolumes(lostDaemon.Instances.VMS["i-fence-1"]), errNodeFenced)
+	loaded, err := jsm.LoadState(lost)
+	require.NoError(t, err)
+	assert.NotContains(t, loaded.VMS, "i-fence-1")
+
+	// Other nodes are unaffected.
+	assert.NoError(t, d.checkFence())
+}
+
+func TestHandleForceTerminate(t *testing.T) {
+	nc, err := nats.Connect(sharedJSNATSURL)
+	require.NoError(t, err)
+	defer nc.Close()
+	jsm, err := NewJetStreamManager(nc, 1)
+	require.NoError(t, err)
+	require.NoError(t, jsm.InitKVBucket())
+	require.NoError(t, jsm.InitTerminatedInstanceBucket())
+
+	d := &Daemon{node: "node-ft-self", natsConn: nc, jsManager: jsm, registry: newNodeRegistry(), config: &config.Config{}}
+	d.registry.record(Heartbeat{Node: "node-ft-up"}, utils.Now())
+
+	require.NoError(t, d.jsManager.WriteState("node-ft-gone", &vm.Instances{VMS: map[string]*vm.VM{
+		"i-ft-orphan": {ID: "i-ft-orphan", Status: vm.StateRunning, AccountID: testAccountID},
+		"i-ft-other":  {ID: "i-ft-other", Status: vm.StateRunning, AccountID: testAccountID},
+	}}))
+	require.NoError(t, d.jsManager.WriteState("node-ft-up", &vm.Instances{VMS: map[string]*vm.VM{
+		"i-ft-live": {ID: "i-ft-live", Status: vm.StateRunning, AccountID: testAccountID},
+	}}))
+	t.Cleanup(func() {
+		_ = d.jsManager.WriteState("node-ft-gone", &vm.Instances{VMS: map[string]*vm.VM{}})
+		_ = d.jsManager.WriteState("node-ft-up", &vm.Instances{VMS: map[string]*vm.VM{}})
+	})
+
+	sub, err := d.natsConn.QueueSubscribe("spinifex.admin.terminate", "spinifex-workers", d.handleForceTerminate)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	forceTerminate := func(instanceID string) awserrors.Reply {
+		data, err := json.Marshal(ForceTerminateRequest{InstanceID: instanceID})
+		require.NoError(t, err)
+		reply, err := d.natsConn.Request("spinifex.admin.terminate", data, 5*time.Second)
+		require.NoError(t, err)
+		return utils.DecodeReply(reply)
+	}
+
+	var resp ForceTerminateResponse
+	require.NoError(t, forceTerminate("i-ft-orphan").Decode(&resp))
+	assert.Equal(t, ForceTerminateResponse{InstanceID: "i-ft-orphan", Node: "node-ft-gone", Status: "terminated"}, resp)
+
+	state, err := d.jsManager.LoadState("node-ft-gone")
+	require.NoError(t, err)
+	assert.NotContains(t, state.VMS, "i-ft-orphan")
+	assert.Contains(t, state.VMS, "i-ft-other", "other instances stay in the node's state")
+	stopped, err := d.jsManager.LoadStoppedInstance("i-ft-orphan")
+	require.NoError(t, err)
+	assert.Nil(t, stopped)
+	terminated, err := d.jsManager.LoadTerminatedInstance("i-ft-orphan")
+	require.NoError(t, err)
+	require.NotNil(t, terminated)
+	assert.Equal(t, vm.StateTerminated, terminated.Status)
+
+	replyErr := forceTerminate("i-ft-live").Err
+	require.NotNil(t, replyErr)
+	assert.Equal(t, awserrors.ErrorIncorrectInstanceState, replyErr.Code)
+	assert.Contains(t, replyErr.Message, "node-ft-up")
+
+	replyErr = forceTerminate("i-ft-missing").Err
+	require.NotNil(t, replyErr)
+	assert.Equal(t, awserrors.ErrorInvalidInstanceIDNotFound, replyErr.Code)
+
+	replyErr = forceTerminate("").Err
+	require.NotNil(t, replyErr)
+	assert.Equal(t, awserrors.ErrorMissingParameter, replyErr.Code)
+}
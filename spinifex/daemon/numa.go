@@ -0,0 +1,301 @@
+package daemon
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/qmp"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"golang.org/x/sys/unix"
+)
+
+// numaNodeRoot is where the host's NUMA topology is read from. Variable so
+// tests can point it at a temp dir.
+var numaNodeRoot = "/sys/devices/system/node"
+
+// numaPinMinVCPUs is the smallest instance pinned to a NUMA node when
+// pinning is enabled. Smaller instances fit in a node's caches anyway, and
+// leaving them to the kernel scheduler keeps nodes from fragmenting.
+const numaPinMinVCPUs = 8
+
+// numaNode is one host NUMA node: the CPUs instances may be pinned to and
+// the memory they may bind, and how much of each pinned instances hold.
+type numaNode struct {
+	id     int
+	cpus   []int
+	memMiB int64
+
+	usedCPUs   map[int]bool
+	usedMemMiB int64
+}
+
+// freeCPUs returns the node's CPUs no pinned instance holds, lowest first.
+func (n *numaNode) freeCPUs() []int {
+	var free []int
+	for _, cpu := range n.cpus {
+		if !n.usedCPUs[cpu] {
+			free = append(free, cpu)
+		}
+	}
+	return free
+}
+
+// numaTopology is the host's NUMA nodes and the placement of every pinned
+// instance on this node. Callers hold ResourceManager.mu.
+type numaTopology struct {
+	nodes      []*numaNode
+	placements map[string]numaHold
+}
+
+// numaHold is a pinned instance's placement and the node memory it holds.
+type numaHold struct {
+	placement vm.NUMAPlacement
+	memMiB    int64
+}
+
+// newNUMATopology builds the topology of nodes, holding back the host's
+// lowest reservedVCPU CPUs and an even share of reservedMemGB on each node
+// for the daemon and co-located services.
+func newNUMATopology(nodes []*numaNode, reservedVCPU int, reservedMemGB float64) *numaTopology {
+	var all []int
+	for _, n := range nodes {
+		all = append(all, n.cpus...)
+	}
+	slices.Sort(all)
+	reserved := all[:min(reservedVCPU, len(all))]
+
+	memShareMiB := int64(reservedMemGB*1024) / int64(max(len(nodes), 1))
+	for _, n := range nodes {
+		n.cpus = slices.DeleteFunc(n.cpus, func(cpu int) bool { return slices.Contains(reserved, cpu) })
+		n.memMiB = max(n.memMiB-memShareMiB, 0)
+		n.usedCPUs = make(map[int]bool)
+	}
+	return &numaTopology{nodes: nodes, placements: make(map[string]numaHold)}
+}
+
+// place pins instanceID to the node that fits vCPUs and memMiB most
+// tightly, so the nodes with the most room are kept for the largest
+// instances. It returns false when no single node fits.
+func (t *numaTopology) place(instanceID string, vCPUs int, memMiB int64) (vm.NUMAPlacement, bool) {
+	t.release(instanceID)
+
+	var best *numaNode
+	for _, n := range t.nodes {
+		if len(n.freeCPUs()) < vCPUs || n.memMiB-n.usedMemMiB < memMiB {
+			continue
+		}
+		if best == nil || len(n.freeCPUs()) < len(best.freeCPUs()) ||
+			(len(n.freeCPUs()) == len(best.freeCPUs()) && n.memMiB-n.usedMemMiB < best.memMiB-best.usedMemMiB) {
+			best = n
+		}
+	}
+	if best == nil {
+		return vm.NUMAPlacement{}, false
+	}
+
+	p := vm.NUMAPlacement{HostNode: best.id, CPUs: best.freeCPUs()[:vCPUs]}
+	t.hold(instanceID, p, memMiB)
+	return p, true
+}
+
+// hold records p, with memMiB of its node's memory, as instanceID's.
+func (t *numaTopology) hold(instanceID string, p vm.NUMAPlacement, memMiB int64) {
+	for _, n := range t.nodes {
+		if n.id != p.HostNode {
+			continue
+		}
+		for _, cpu := range p.CPUs {
+			n.usedCPUs[cpu] = true
+		}
+		n.usedMemMiB += memMiB
+	}
+	t.placements[instanceID] = numaHold{placement: p, memMiB: memMiB}
+}
+
+// release frees the CPUs and memory instanceID holds, if any.
+func (t *numaTopology) release(instanceID string) {
+	held, ok := t.placements[instanceID]
+	if !ok {
+		return
+	}
+	delete(t.placements, instanceID)
+	for _, n := range t.nodes {
+		if n.id != held.placement.HostNode {
+			continue
+		}
+		for _, cpu := range held.placement.CPUs {
+			delete(n.usedCPUs, cpu)
+		}
+		n.usedMemMiB -= held.memMiB
+	}
+}
+
+// detectNUMATopology reads the host's NUMA nodes from numaNodeRoot. Nodes
+// without CPUs (memory-only nodes) are skipped.
+func detectNUMATopology() ([]*numaNode, error) {
+	dirs, err := filepath.Glob(filepath.Join(numaNodeRoot, "node[0-9]*"))
+	if err != nil {
+		return nil, err
+	}
+	var nodes []*numaNode
+	for _, dir := range dirs {
+		id, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(dir), "node"))
+		if err != nil {
+			continue
+		}
+		cpuList, err := os.ReadFile(filepath.Join(dir, "cpulist"))
+		if err != nil {
+			return nil, fmt.Errorf("read node %d cpulist: %w", id, err)
+		}
+		cpus, err := parseCPUList(strings.TrimSpace(string(cpuList)))
+		if err != nil {
+			return nil, fmt.Errorf("node %d: %w", id, err)
+		}
+		if len(cpus) == 0 {
+			continue
+		}
+		memMiB, err := nodeMemTotalMiB(filepath.Join(dir, "meminfo"))
+		if err != nil {
+			return nil, fmt.Errorf("node %d: %w", id, err)
+		}
+		nodes = append(nodes, &numaNode{id: id, cpus: cpus, memMiB: memMiB})
+	}
+	slices.SortFunc(nodes, func(a, b *numaNode) int { return a.id - b.id })
+	return nodes, nil
+}
+
+// parseCPUList parses a kernel CPU list such as "0-3,8,10-11".
+func parseCPUList(s string) ([]int, error) {
+	var cpus []int
+	if s == "" {
+		return cpus, nil
+	}
+	for part := range strings.SplitSeq(s, ",") {
+		lo, hi, isRange := strings.Cut(part, "-")
+		first, err := strconv.Atoi(lo)
+		if err != nil {
+			return nil, fmt.Errorf("parse cpu list %q: %w", s, err)
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.Atoi(hi); err != nil {
+				return nil, fmt.Errorf("parse cpu list %q: %w", s, err)
+			}
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+// nodeMemTotalMiB reads MemTotal from a node's meminfo, which reports it as
+// "Node 0 MemTotal:       32768000 kB".
+func nodeMemTotalMiB(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 4 && fields[2] == "MemTotal:" {
+			kb, err := strconv.ParseInt(fields[3], 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("parse MemTotal: %w", err)
+			}
+			return kb / 1024, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("MemTotal not found in %s", path)
+}
+
+// placeNUMA pins an instance of instanceType to a NUMA node, returning nil
+// when the host has a single node, the type is below numaPinMinVCPUs or no
+// node has room for it. Unplaced instances run wherever the kernel
+// schedules them.
+func (rm *ResourceManager) placeNUMA(instanceID string, instanceType *ec2.InstanceTypeInfo) *vm.NUMAPlacement {
+	vCPUs := int(instanceTypeVCPUs(instanceType))
+	memMiB := instanceTypeMemoryMiB(instanceType)
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	if rm.numa == nil {
+		return nil
+	}
+	if vCPUs < numaPinMinVCPUs {
+		rm.numa.release(instanceID)
+		return nil
+	}
+	p, ok := rm.numa.place(instanceID, vCPUs, memMiB)
+	if !ok {
+		slog.Warn("No NUMA node has room for instance, leaving it unpinned",
+			"instanceId", instanceID, "vCPUs", vCPUs, "memoryMiB", memMiB)
+		return nil
+	}
+	return &p
+}
+
+// restoreNUMA records the placement of an instance that kept running while
+// the daemon restarted.
+func (rm *ResourceManager) restoreNUMA(instanceID string, p *vm.NUMAPlacement, memMiB int64) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	if rm.numa == nil || p == nil {
+		return
+	}
+	rm.numa.hold(instanceID, *p, memMiB)
+}
+
+// releaseNUMA frees the NUMA node resources an instance held.
+func (rm *ResourceManager) releaseNUMA(instanceID string) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	if rm.numa != nil {
+		rm.numa.release(instanceID)
+	}
+}
+
+// pinVCPUs gives each vCPU thread of a pinned instance its own host CPU.
+// The instance's cgroup already confines QEMU to the node; failures leave
+// the vCPUs floating within it, so they are logged rather than returned.
+func (d *Daemon) pinVCPUs(instance *vm.VM) {
+	p := instance.Config.NUMA
+	if p == nil {
+		return
+	}
+	resp, err := d.SendQMPCommand(instance.QMPClient, qmp.QueryCPUsFast(), instance.ID)
+	if err != nil {
+		slog.Warn("Failed to query vCPU threads for pinning", "instanceId", instance.ID, "err", err)
+		return
+	}
+	var cpus []qmp.CPUInfoFast
+	if err := json.Unmarshal(resp.Return, &cpus); err != nil {
+		slog.Warn("Failed to decode vCPU threads for pinning", "instanceId", instance.ID, "err", err)
+		return
+	}
+	for _, cpu := range cpus {
+		if cpu.CPUIndex < 0 || cpu.CPUIndex >= len(p.CPUs) {
+			continue
+		}
+		var set unix.CPUSet
+		set.Set(p.CPUs[cpu.CPUIndex])
+		if err := unix.SchedSetaffinity(cpu.ThreadID, &set); err != nil {
+			slog.Warn("Failed to pin vCPU", "instanceId", instance.ID, "vcpu", cpu.CPUIndex, "hostCPU", p.CPUs[cpu.CPUIndex], "err", err)
+		}
+	}
+	slog.Info("Pinned instance vCPUs", "instanceId", instance.ID, "hostNode", p.HostNode, "cpus", p.CPUList())
+}
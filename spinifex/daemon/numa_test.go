@@ -0,0 +1,122 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCPUList(t *testing.T) {
+	cpus, err := parseCPUList("0-3,8,10-11")
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 1, 2, 3, 8, 10, 11}, cpus)
+
+	cpus, err = parseCPUList("")
+	require.NoError(t, err)
+	assert.Empty(t, cpus)
+
+	_, err = parseCPUList("0-x")
+	assert.Error(t, err)
+}
+
+func TestDetectNUMATopology(t *testing.T) {
+	root := t.TempDir()
+	orig := numaNodeRoot
+	numaNodeRoot = root
+	t.Cleanup(func() { numaNodeRoot = orig })
+
+	writeNode := func(name, cpulist, memKB string) {
+		dir := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "cpulist"), []byte(cpulist+"\n"), 0o644))
+		meminfo := "Node " + name[4:] + " MemTotal:       " + memKB + " kB\nNode " + name[4:] + " MemFree:        1024 kB\n"
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "meminfo"), []byte(meminfo), 0o644))
+	}
+	writeNode("node1", "8-15", "33554432")
+	writeNode("node0", "0-7", "33554432")
+	writeNode("node2", "", "16777216") // memory-only
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "possible"), 0o755))
+
+	nodes, err := detectNUMATopology()
+	require.NoError(t, err)
+	require.Len(t, nodes, 2)
+	assert.Equal(t, 0, nodes[0].id)
+	assert.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7}, nodes[0].cpus)
+	assert.Equal(t, int64(32768), nodes[0].memMiB)
+	assert.Equal(t, 1, nodes[1].id)
+}
+
+func testNUMATopology() *numaTopology {
+	return newNUMATopology([]*numaNode{
+		{id: 0, cpus: []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}, memMiB: 65536},
+		{id: 1, cpus: []int{12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23}, memMiB: 65536},
+	}, 2, 4)
+}
+
+func TestNUMATopology_Reserve(t *testing.T) {
+	topo := testNUMATopology()
+	assert.Equal(t, []int{2, 3, 4, 5, 6, 7, 8, 9, 10, 11}, topo.nodes[0].cpus, "lowest CPUs are held back")
+	assert.Len(t, topo.nodes[1].cpus, 12)
+	assert.Equal(t, int64(63488), topo.nodes[0].memMiB, "reserved memory is shared across nodes")
+}
+
+func TestNUMATopology_PlaceBestFit(t *testing.T) {
+	topo := testNUMATopology()
+
+	// Node 0 has fewer free CPUs, so it takes the first instance.
+	p, ok := topo.place("i-a", 8, 16384)
+	require.True(t, ok)
+	assert.Equal(t, 0, p.HostNode)
+	assert.Equal(t, []int{2, 3, 4, 5, 6, 7, 8, 9}, p.CPUs)
+
+	// Node 0 has 2 CPUs left; a 12-vCPU instance still fits on node 1.
+	p, ok = topo.place("i-b", 12, 16384)
+	require.True(t, ok)
+	assert.Equal(t, 1, p.HostNode)
+
+	_, ok = topo.place("i-c", 8, 16384)
+	assert.False(t, ok, "no single node has 8 free CPUs")
+
+	topo.release("i-a")
+	p, ok = topo.place("i-c", 8, 16384)
+	require.True(t, ok)
+	assert.Equal(t, 0, p.HostNode)
+
+	_, ok = topo.place("i-d", 1, 65536)
+	assert.False(t, ok, "memory must fit on the node too")
+}
+
+func TestNUMATopology_PlaceAgainReleasesFirst(t *testing.T) {
+	topo := testNUMATopology()
+	_, ok := topo.place("i-a", 10, 1024)
+	require.True(t, ok)
+	p, ok := topo.place("i-a", 10, 1024)
+	require.True(t, ok)
+	assert.Equal(t, 0, p.HostNode)
+	assert.Len(t, topo.nodes[0].usedCPUs, 10)
+	assert.Equal(t, int64(1024), topo.nodes[0].usedMemMiB)
+}
+
+func TestPlaceNUMA(t *testing.T) {
+	rm := &ResourceManager{}
+	assert.Nil(t, rm.placeNUMA("i-a", resizeTestType("m5.4xlarge", 16, 65536)), "single-node hosts aren't pinned")
+
+	rm.numa = testNUMATopology()
+	assert.Nil(t, rm.placeNUMA("i-a", resizeTestType("m5.xlarge", 4, 16384)), "small instances float")
+
+	p := rm.placeNUMA("i-a", resizeTestType("m5.2xlarge", 8, 32768))
+	require.NotNil(t, p)
+	assert.Equal(t, 0, p.HostNode)
+
+	assert.Nil(t, rm.placeNUMA("i-b", resizeTestType("m5.4xlarge", 16, 65536)), "too large for any node")
+
+	rm.releaseNUMA("i-a")
+	assert.Empty(t, rm.numa.placements)
+
+	rm.restoreNUMA("i-a", p, 32768)
+	assert.Len(t, rm.numa.nodes[0].usedCPUs, 8)
+	assert.Equal(t, int64(32768), rm.numa.nodes[0].usedMemMiB)
+}
@@ -0,0 +1,177 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/mulgadc/spinifex/spinifex/qmp"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Metrics the daemon updates as it works. They are exported on
+// daemon.metrics_listen alongside the gauges daemonCollector reads from the
+// daemon's state at scrape time.
+var (
+	natsHandlerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "spinifex_nats_handler_duration_seconds",
+		Help:    "Time the daemon's NATS handlers take to handle a message, by subject.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 4, 9),
+	}, []string{"subject"})
+
+	jetStreamWriteDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "spinifex_jetstream_write_duration_seconds",
+		Help:    "Time JetStream KV writes take, by the kind of record written.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"record"})
+
+	qmpErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "spinifex_qmp_errors_total",
+		Help: "QMP commands that failed, by QMP error class; transport for failures before QEMU answered.",
+	}, []string{"class"})
+
+	nbdMountRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "spinifex_nbd_mount_requests_total",
+		Help: "Volume mount requests sent to viperblockd, by result.",
+	}, []string{"result"})
+)
+
+var (
+	resourceVCPUsDesc = prometheus.NewDesc("spinifex_resource_vcpus",
+		"Host vCPUs, by total, reserved for the host and allocated to instances.", []string{"kind"}, nil)
+	resourceMemoryDesc = prometheus.NewDesc("spinifex_resource_memory_gib",
+		"Host memory in GiB, by total, reserved for the host and allocated to instances.", []string{"kind"}, nil)
+	instancesDesc = prometheus.NewDesc("spinifex_instances",
+		"Instances on this node, by state.", []string{"state"}, nil)
+	nbdMountsDesc = prometheus.NewDesc("spinifex_nbd_mounts",
+		"Viperblock volumes mounted over NBD for this node's instances.", nil, nil)
+)
+
+// daemonCollector reports the daemon's resource allocation, instances and
+// NBD mounts as they are when scraped.
+type daemonCollector struct {
+	d *Daemon
+}
+
+func (c daemonCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- resourceVCPUsDesc
+	ch <- resourceMemoryDesc
+	ch <- instancesDesc
+	ch <- nbdMountsDesc
+}
+
+func (c daemonCollector) Collect(ch chan<- prometheus.Metric) {
+	if rm := c.d.resourceMgr; rm != nil {
+		totalVCPU, totalMem, reservedVCPU, reservedMem, allocVCPU, allocMem, _ := rm.GetResourceStats()
+		ch <- prometheus.MustNewConstMetric(resourceVCPUsDesc, prometheus.GaugeValue, float64(totalVCPU), "total")
+		ch <- prometheus.MustNewConstMetric(resourceVCPUsDesc, prometheus.GaugeValue, float64(reservedVCPU), "reserved")
+		ch <- prometheus.MustNewConstMetric(resourceVCPUsDesc, prometheus.GaugeValue, float64(allocVCPU), "allocated")
+		ch <- prometheus.MustNewConstMetric(resourceMemoryDesc, prometheus.GaugeValue, totalMem, "total")
+		ch <- prometheus.MustNewConstMetric(resourceMemoryDesc, prometheus.GaugeValue, reservedMem, "reserved")
+		ch <- prometheus.MustNewConstMetric(resourceMemoryDesc, prometheus.GaugeValue, allocMem, "allocated")
+	}
+
+	states := make(map[string]int)
+	mounts := 0
+	unlock := c.d.Instances.LockAll()
+	for _, v := range c.d.Instances.VMS {
+		states[string(v.Status)]++
+		for _, req := range v.EBSRequests.Requests {
+			if req.Backend == "" && req.NBDURI != "" {
+				mounts++
+			}
+		}
+	}
+	unlock()
+
+	for state, n := range states {
+		ch <- prometheus.MustNewConstMetric(instancesDesc, prometheus.GaugeValue, float64(n), state)
+	}
+	ch <- prometheus.MustNewConstMetric(nbdMountsDesc, prometheus.GaugeValue, float64(mounts))
+}
+
+// newMetricsRegistry returns a registry with the daemon's metrics and the Go
+// runtime and process collectors.
+func (d *Daemon) newMetricsRegistry() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		natsHandlerDuration,
+		jetStreamWriteDuration,
+		qmpErrors,
+		nbdMountRequests,
+		daemonCollector{d: d},
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return reg
+}
+
+// startMetricsServer serves Prometheus metrics on daemon.metrics_listen at
+// /metrics. It is off when the setting is empty.
+func (d *Daemon) startMetricsServer() error {
+	addr := d.config.Daemon.MetricsListen
+	if addr == "" {
+		return nil
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("metrics listen on %s: %w", addr, err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(d.newMetricsRegistry(), promhttp.HandlerOpts{}))
+	d.metricsServer = &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		slog.Info("Starting metrics endpoint", "addr", addr)
+		if err := d.metricsServer.Serve(ln); err != nil && err != http.ErrServerClosed {
+			slog.Error("Metrics endpoint failed", "error", err)
+		}
+	}()
+	return nil
+}
+
+// timeNATSHandler wraps handler to record how long it takes under subject.
+func timeNATSHandler(subject string, handler nats.MsgHandler) nats.MsgHandler {
+	observer := natsHandlerDuration.WithLabelValues(subject)
+	return func(msg *nats.Msg) {
+		start := time.Now()
+		defer func() { observer.Observe(time.Since(start).Seconds()) }()
+		handler(msg)
+	}
+}
+
+// observeJetStreamWrite records a KV write of the given kind of record that
+// started at start.
+func observeJetStreamWrite(record string, start time.Time) {
+	jetStreamWriteDuration.WithLabelValues(record).Observe(time.Since(start).Seconds())
+}
+
+// countQMPError counts a failed QMP command by its error class.
+func countQMPError(err error) {
+	class := "transport"
+	var qmpErr *qmp.QMPError
+	if errors.As(err, &qmpErr) {
+		class = qmpErr.Class
+	}
+	qmpErrors.WithLabelValues(class).Inc()
+}
+
+// countNBDMount counts a volume mount request by whether it succeeded.
+func countNBDMount(ok bool) {
+	result := "error"
+	if ok {
+		result = "ok"
+	}
+	nbdMountRequests.WithLabelValues(result).Inc()
+}
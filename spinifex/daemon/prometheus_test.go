@@ -0,0 +1,96 @@
+package daemon
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mulgadc/spinifex/spinifex/config"
+	"github.com/mulgadc/spinifex/spinifex/qmp"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDaemonCollector(t *testing.T) {
+	d := &Daemon{Instances: vm.Instances{VMS: map[string]*vm.VM{
+		"i-running": {ID: "i-running", Status: vm.StateRunning, EBSRequests: types.EBSRequests{Requests: []types.EBSRequest{
+			{Name: "vol-nbd", NBDURI: "nbd:unix:/run/vol-nbd.sock"},
+			{Name: "vol-local", NBDURI: "/mnt/nvme/vol-local.raw", Backend: config.VolumeBackendLocal},
+		}}},
+		"i-stopped": {ID: "i-stopped", Status: vm.StateStopped},
+		"i-other":   {ID: "i-other", Status: vm.StateRunning},
+	}}}
+
+	expected := `
+# HELP spinifex_instances Instances on this node, by state.
+# TYPE spinifex_instances gauge
+spinifex_instances{state="running"} 2
+spinifex_instances{state="stopped"} 1
+# HELP spinifex_nbd_mounts Viperblock volumes mounted over NBD for this node's instances.
+# TYPE spinifex_nbd_mounts gauge
+spinifex_nbd_mounts 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(daemonCollector{d: d}, strings.NewReader(expected)))
+}
+
+func TestTimeNATSHandler(t *testing.T) {
+	samples := func() uint64 {
+		var m dto.Metric
+		require.NoError(t, natsHandlerDuration.WithLabelValues("test.timed").(prometheus.Metric).Write(&m))
+		return m.GetHistogram().GetSampleCount()
+	}
+	called := false
+	handler := timeNATSHandler("test.timed", func(*nats.Msg) { called = true })
+	before := samples()
+
+	handler(&nats.Msg{})
+	assert.True(t, called)
+	assert.Equal(t, before+1, samples())
+}
+
+func TestCountQMPError(t *testing.T) {
+	before := testutil.ToFloat64(qmpErrors.WithLabelValues(qmp.ErrorClassDeviceNotFound))
+	countQMPError(&qmp.QMPError{Class: qmp.ErrorClassDeviceNotFound, Desc: "no such device"})
+	assert.Equal(t, before+1, testutil.ToFloat64(qmpErrors.WithLabelValues(qmp.ErrorClassDeviceNotFound)))
+
+	before = testutil.ToFloat64(qmpErrors.WithLabelValues("transport"))
+	countQMPError(io.EOF)
+	assert.Equal(t, before+1, testutil.ToFloat64(qmpErrors.WithLabelValues("transport")))
+}
+
+func TestStartMetricsServer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	require.NoError(t, ln.Close())
+
+	d := &Daemon{config: &config.Config{Daemon: config.DaemonConfig{MetricsListen: addr}}}
+	require.NoError(t, d.startMetricsServer())
+	t.Cleanup(func() { _ = d.metricsServer.Shutdown(context.Background()) })
+
+	countNBDMount(true)
+	resp, err := http.Get("http://" + addr + "/metrics")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), `spinifex_nbd_mount_requests_total{result="ok"}`)
+	assert.Contains(t, string(body), "spinifex_nbd_mounts 0")
+	assert.Contains(t, string(body), "go_goroutines")
+}
+
+func TestStartMetricsServer_Disabled(t *testing.T) {
+	d := &Daemon{config: &config.Config{}}
+	require.NoError(t, d.startMetricsServer())
+	assert.Nil(t, d.metricsServer)
+}
@@ -0,0 +1,68 @@
+package daemon
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/qmp"
+	"github.com/nats-io/nats.go"
+)
+
+// maxQMPDetailLen caps the QEMU description returned to clients.
+const maxQMPDetailLen = 256
+
+var (
+	qmpURIPattern  = regexp.MustCompile(`\b[a-z][a-z0-9+.-]*://[^\s'"]+`)
+	qmpPathPattern = regexp.MustCompile(`(^|[\s'"(=])/[^\s'",)]+`)
+	qmpAddrPattern = regexp.MustCompile(`\b\d{1,3}(\.\d{1,3}){3}(:\d+)?\b`)
+)
+
+// qmpErrorResponse maps a failed QMP command to an AWS error code and a
+// client-safe detail. QMP classes with a clear meaning to the caller get a
+// specific code; unexpected classes stay ServerInternal but still carry the
+// redacted description. Non-QMP failures (socket, decode, timeout) return
+// ServerInternal with no detail.
+func qmpErrorResponse(err error) (code, detail string) {
+	var qmpErr *qmp.QMPError
+	if !errors.As(err, &qmpErr) {
+		return awserrors.ErrorServerInternal, ""
+	}
+
+	detail = "QEMU " + qmpErr.Class + ": " + redactQMPDesc(qmpErr.Desc)
+	switch qmpErr.Class {
+	case qmp.ErrorClassDeviceNotActive:
+		return awserrors.ErrorIncorrectInstanceState, detail
+	case qmp.ErrorClassDeviceNotFound:
+		return awserrors.ErrorIncorrectState, detail
+	case qmp.ErrorClassCommandNotFound, qmp.ErrorClassKVMMissingCap:
+		return awserrors.ErrorUnsupportedOperation, detail
+	case qmp.ErrorClassGenericError:
+		// Busy block nodes and duplicate device IDs mean the volume is
+		// mid-transition or already attached; a retry can succeed.
+		if isQMPNodeInUse(err) || strings.Contains(qmpErr.Desc, "Duplicate") || strings.Contains(qmpErr.Desc, "already") {
+			return awserrors.ErrorIncorrectState, detail
+		}
+	}
+	return awserrors.ErrorServerInternal, detail
+}
+
+// redactQMPDesc strips host paths, URIs and addresses from a QEMU error
+// description before it leaves the node.
+func redactQMPDesc(desc string) string {
+	desc = qmpURIPattern.ReplaceAllString(desc, "<uri>")
+	desc = qmpPathPattern.ReplaceAllString(desc, "$1<path>")
+	desc = qmpAddrPattern.ReplaceAllString(desc, "<addr>")
+	if len(desc) > maxQMPDetailLen {
+		desc = desc[:maxQMPDetailLen] + "..."
+	}
+	return desc
+}
+
+// respondWithQMPError responds to msg with the AWS error for a failed QMP
+// command (see qmpErrorResponse).
+func respondWithQMPError(msg *nats.Msg, err error) {
+	code, detail := qmpErrorResponse(err)
+	respondWithServiceError(msg, awserrors.WithDetail(code, detail))
+}
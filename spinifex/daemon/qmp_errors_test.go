@@ -0,0 +1,137 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/qmp"
+	"github.com/mulgadc/spinifex/spinifex/testutil"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQMPErrorResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantCode   string
+		wantDetail string
+	}{
+		{"DeviceNotActive", &qmp.QMPError{Class: qmp.ErrorClassDeviceNotActive, Desc: "No bootable device"},
+			awserrors.ErrorIncorrectInstanceState, "QEMU DeviceNotActive: No bootable device"},
+		{"DeviceNotFound", &qmp.QMPError{Class: qmp.ErrorClassDeviceNotFound, Desc: "Device 'vdisk-vol-1' not found"},
+			awserrors.ErrorIncorrectState, "QEMU DeviceNotFound: Device 'vdisk-vol-1' not found"},
+		{"CommandNotFound", &qmp.QMPError{Class: qmp.ErrorClassCommandNotFound, Desc: "The command foo has not been found"},
+			awserrors.ErrorUnsupportedOperation, "QEMU CommandNotFound: The command foo has not been found"},
+		{"NodeInUse", &qmp.QMPError{Class: qmp.ErrorClassGenericError, Desc: "Node nbd-vol-1 is in use"},
+			awserrors.ErrorIncorrectState, "QEMU GenericError: Node nbd-vol-1 is in use"},
+		{"DuplicateID", fmt.Errorf("attach: %w", &qmp.QMPError{Class: qmp.ErrorClassGenericError, Desc: "Duplicate ID 'vdisk-vol-1' for device"}),
+			awserrors.ErrorIncorrectState, "QEMU GenericError: Duplicate ID 'vdisk-vol-1' for device"},
+		{"UnexpectedGeneric", &qmp.QMPError{Class: qmp.ErrorClassGenericError, Desc: "Failed to connect to 'nbd://10.0.0.4:40123': Connection refused"},
+			awserrors.ErrorServerInternal, "QEMU GenericError: Failed to connect to '<uri>': Connection refused"},
+		{"Transport", fmt.Errorf("decode error: EOF"), awserrors.ErrorServerInternal, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, detail := qmpErrorResponse(tt.err)
+			assert.Equal(t, tt.wantCode, code)
+			assert.Equal(t, tt.wantDetail, detail)
+		})
+	}
+}
+
+func TestRedactQMPDesc(t *testing.T) {
+	assert.Equal(t, "Could not open '<path>': No such file", redactQMPDesc("Could not open '/run/spinifex/nbd-vol-1.sock': No such file"))
+	assert.Equal(t, "server <addr> refused", redactQMPDesc("server 192.168.1.20:10809 refused"))
+	assert.Len(t, redactQMPDesc(string(make([]byte, 1000))), maxQMPDetailLen+3)
+}
+
+// TestQMPErrorSurfacedInResponse drives handlers against a mock QMP server
+// returning known error classes and checks the NATS error payload.
+func TestQMPErrorSurfacedInResponse(t *testing.T) {
+	_, nc, _ := testutil.StartTestJetStream(t)
+
+	request := func(t *testing.T, handler func(*nats.Msg), cmd types.EC2InstanceCommand) ec2.ResponseError {
+		t.Helper()
+		subject := "ec2.cmd." + cmd.ID
+		sub, err := nc.Subscribe(subject, handler)
+		require.NoError(t, err)
+		defer sub.Unsubscribe()
+
+		data, err := json.Marshal(cmd)
+		require.NoError(t, err)
+		reply, err := nc.Request(subject, data, 5*time.Second)
+		require.NoError(t, err)
+
+		responseError, err := utils.ValidateErrorPayload(reply.Data)
+		require.Error(t, err, "expected an error payload, got %s", reply.Data)
+		return responseError
+	}
+
+	t.Run("RebootDeviceNotActive", func(t *testing.T) {
+		qmpClient, cancel := newMockQMPClient(t, func(cmd qmp.QMPCommand) map[string]any {
+			return map[string]any{"error": map[string]any{"class": qmp.ErrorClassDeviceNotActive, "desc": "guest is not running"}}
+		})
+		defer cancel()
+
+		instance := &vm.VM{ID: "i-qmperr-reboot", Status: vm.StateRunning, QMPClient: qmpClient}
+		d := &Daemon{natsConn: nc, Instances: vm.Instances{VMS: map[string]*vm.VM{instance.ID: instance}}}
+
+		cmd := types.EC2InstanceCommand{ID: instance.ID, Attributes: types.EC2CommandAttributes{RebootInstance: true}}
+		resp := request(t, func(msg *nats.Msg) { d.handleRebootInstance(msg, cmd, instance) }, cmd)
+
+		assert.Equal(t, awserrors.ErrorIncorrectInstanceState, *resp.Code)
+		require.NotNil(t, resp.Message)
+		assert.Equal(t, "QEMU DeviceNotActive: guest is not running", *resp.Message)
+
+		// Gateway side keeps the detail alongside the code
+		err := utils.ResponseErrorToError(resp)
+		assert.EqualError(t, err, awserrors.ErrorIncorrectInstanceState)
+		assert.Equal(t, "QEMU DeviceNotActive: guest is not running", awserrors.Detail(err))
+	})
+
+	t.Run("DetachNodeInUse", func(t *testing.T) {
+		qmpClient, cancel := newMockQMPClient(t, func(cmd qmp.QMPCommand) map[string]any {
+			if cmd.Execute == "blockdev-del" {
+				return map[string]any{"error": map[string]any{"class": qmp.ErrorClassGenericError, "desc": "Node nbd-vol-qmperr is in use"}}
+			}
+			return map[string]any{"return": map[string]any{}}
+		})
+		defer cancel()
+
+		instance := &vm.VM{ID: "i-qmperr-detach", Status: vm.StateRunning, QMPClient: qmpClient}
+		instance.EBSRequests.Requests = []types.EBSRequest{{Name: "vol-qmperr", DeviceName: "/dev/sdf"}}
+		d := &Daemon{natsConn: nc, Instances: vm.Instances{VMS: map[string]*vm.VM{instance.ID: instance}}, detachDelay: time.Millisecond}
+
+		cmd := types.EC2InstanceCommand{
+			ID:               instance.ID,
+			Attributes:       types.EC2CommandAttributes{DetachVolume: true},
+			DetachVolumeData: &types.DetachVolumeData{VolumeID: "vol-qmperr"},
+		}
+		resp := request(t, func(msg *nats.Msg) { d.handleDetachVolume(msg, cmd, instance) }, cmd)
+
+		assert.Equal(t, awserrors.ErrorIncorrectState, *resp.Code)
+		require.NotNil(t, resp.Message)
+		assert.Contains(t, *resp.Message, "is in use")
+		assert.Len(t, instance.EBSRequests.Requests, 1, "volume state left intact")
+	})
+
+	t.Run("TransportFailureStaysInternal", func(t *testing.T) {
+		instance := &vm.VM{ID: "i-qmperr-noclient", Status: vm.StateRunning, QMPClient: &qmp.QMPClient{}}
+		d := &Daemon{natsConn: nc, Instances: vm.Instances{VMS: map[string]*vm.VM{instance.ID: instance}}}
+
+		cmd := types.EC2InstanceCommand{ID: instance.ID, Attributes: types.EC2CommandAttributes{RebootInstance: true}}
+		resp := request(t, func(msg *nats.Msg) { d.handleRebootInstance(msg, cmd, instance) }, cmd)
+
+		assert.Equal(t, awserrors.ErrorServerInternal, *resp.Code)
+		assert.Nil(t, resp.Message)
+	})
+}
@@ -0,0 +1,138 @@
+package daemon
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/config"
+	handlers_ec2_volume "github.com/mulgadc/spinifex/spinifex/handlers/ec2/volume"
+	"github.com/mulgadc/spinifex/spinifex/quota"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/nats-io/nats.go"
+)
+
+// countsTowardQuota reports whether an instance in status holds instance and
+// vCPU quota. As in EC2, stopped and terminated instances don't.
+func countsTowardQuota(status vm.InstanceState) bool {
+	switch status {
+	case vm.StateStopped, vm.StateShuttingDown, vm.StateTerminated:
+		return false
+	}
+	return true
+}
+
+// accountUsage returns what accountID holds across the cluster. Instances on
+// this node are read from memory, those on other nodes from the state each
+// node writes to the shared KV store.
+func (d *Daemon) accountUsage(accountID string) (quota.Usage, error) {
+	var usage quota.Usage
+	count := func(instance *vm.VM) {
+		if instance.AccountID != accountID || !countsTowardQuota(instance.Status) {
+			return
+		}
+		usage.Instances++
+		if it, ok := d.resourceMgr.instanceTypes[instance.InstanceType]; ok {
+			usage.VCPUs += int(instanceTypeVCPUs(it))
+		}
+	}
+
+	d.Instances.Mu.Lock()
+	for _, instance := range d.Instances.VMS {
+		count(instance)
+	}
+	d.Instances.Mu.Unlock()
+
+	if d.jsManager != nil {
+		nodes, err := d.jsManager.ListNodeStates()
+		if err != nil {
+			return usage, fmt.Errorf("list instance state: %w", err)
+		}
+		for nodeID, instances := range nodes {
+			if nodeID == d.node {
+				continue
+			}
+			for _, instance := range instances.VMS {
+				count(instance)
+			}
+		}
+	}
+
+	if d.volumeService != nil {
+		volumes, err := d.volumeService.DescribeVolumes(&ec2.DescribeVolumesInput{}, accountID)
+		if err != nil {
+			return usage, fmt.Errorf("describe volumes: %w", err)
+		}
+		for _, volume := range volumes.Volumes {
+			usage.Volumes++
+			usage.VolumeGiB += int(aws.Int64Value(volume.Size))
+			usage.ProvisionedIOPS += int(handlers_ec2_volume.QuotaIOPS(aws.StringValue(volume.VolumeType),
+				aws.Int64Value(volume.Size), aws.Int64Value(volume.Iops)))
+		}
+	}
+
+	if d.eipService != nil {
+		addresses, err := d.eipService.DescribeAddresses(&ec2.DescribeAddressesInput{}, accountID)
+		if err != nil {
+			return usage, fmt.Errorf("describe addresses: %w", err)
+		}
+		usage.Addresses = len(addresses.Addresses)
+	}
+
+	return usage, nil
+}
+
+// accountQuota returns accountID's quota, and whether it sets any limit.
+func (d *Daemon) accountQuota(accountID string) (config.AccountQuota, bool) {
+	q := d.config.Daemon.QuotaFor(accountID)
+	return q, q != config.AccountQuota{AccountID: accountID}
+}
+
+// checkQuota fails with the account's limit error when adding add to what
+// accountID holds would exceed one of its quotas. The usage of accounts
+// without quotas isn't counted.
+func (d *Daemon) checkQuota(accountID string, add quota.Usage) error {
+	q, limited := d.accountQuota(accountID)
+	if !limited {
+		return nil
+	}
+	usage, err := d.accountUsage(accountID)
+	if err != nil {
+		slog.Error("checkQuota: failed to count account usage", "accountID", accountID, "err", err)
+		return errors.New(awserrors.ErrorServerInternal)
+	}
+	return quota.Check(q, usage, add)
+}
+
+// launchableByQuota returns how many instances of instanceType, up to count,
+// accountID's instance and vCPU quotas allow it to launch, and the limit
+// error when that is fewer than count.
+func (d *Daemon) launchableByQuota(accountID string, instanceType *ec2.InstanceTypeInfo, count int) (int, error) {
+	q, limited := d.accountQuota(accountID)
+	if !limited {
+		return count, nil
+	}
+	usage, err := d.accountUsage(accountID)
+	if err != nil {
+		slog.Error("launchableByQuota: failed to count account usage", "accountID", accountID, "err", err)
+		return 0, errors.New(awserrors.ErrorServerInternal)
+	}
+	return quota.Launchable(q, usage, int(instanceTypeVCPUs(instanceType)), count)
+}
+
+// describeAccountQuotas reports the caller's quotas against its usage.
+func (d *Daemon) describeAccountQuotas(_ *quota.DescribeAccountQuotasInput, accountID string) (*quota.DescribeAccountQuotasOutput, error) {
+	usage, err := d.accountUsage(accountID)
+	if err != nil {
+		slog.Error("DescribeAccountQuotas: failed to count account usage", "accountID", accountID, "err", err)
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+	return quota.Describe(d.config.Daemon.QuotaFor(accountID), usage), nil
+}
+
+func (d *Daemon) handleEC2DescribeAccountQuotas(msg *nats.Msg) {
+	handleNATSRequest(msg, d.describeAccountQuotas)
+}
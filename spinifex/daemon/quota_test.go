@@ -0,0 +1,163 @@
+package daemon
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/config"
+	"github.com/mulgadc/spinifex/spinifex/quota"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/mulgadc/viperblock/viperblock"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const quotaTestAccountID = "000000000710"
+
+// setupQuotaTestDaemon returns a daemon holding, for quotaTestAccountID, a
+// running and a stopped instance on this node, a pending instance on another
+// node and one 10 GiB volume.
+func setupQuotaTestDaemon(t *testing.T) (*Daemon, int) {
+	t.Helper()
+	daemon, store := createFullTestDaemonWithStore(t, sharedJSNATSURL)
+	var err error
+	daemon.jsManager, err = NewJetStreamManager(daemon.natsConn, 1)
+	require.NoError(t, err)
+	require.NoError(t, daemon.jsManager.InitKVBucket())
+	instanceType := getTestInstanceType(t)
+	vcpus := int(instanceTypeVCPUs(daemon.resourceMgr.instanceTypes[instanceType]))
+
+	daemon.Instances.UpsertVM(&vm.VM{ID: "i-quota-running", InstanceType: instanceType, Status: vm.StateRunning, AccountID: quotaTestAccountID})
+	daemon.Instances.UpsertVM(&vm.VM{ID: "i-quota-stopped", InstanceType: instanceType, Status: vm.StateStopped, AccountID: quotaTestAccountID})
+
+	remote := &vm.Instances{VMS: map[string]*vm.VM{
+		"i-quota-remote": {ID: "i-quota-remote", InstanceType: instanceType, Status: vm.StatePending, AccountID: quotaTestAccountID},
+		"i-quota-other":  {ID: "i-quota-other", InstanceType: instanceType, Status: vm.StateRunning, AccountID: "000000000711"},
+	}}
+	require.NoError(t, daemon.jsManager.WriteState("quota-remote-node", remote))
+	t.Cleanup(func() { _ = daemon.jsManager.DeleteState("quota-remote-node") })
+
+	data, err := json.Marshal(map[string]viperblock.VolumeConfig{"VolumeConfig": {
+		VolumeMetadata: viperblock.VolumeMetadata{VolumeID: "vol-quota", SizeGiB: 10, State: "available", VolumeType: "gp3", TenantID: quotaTestAccountID},
+	}})
+	require.NoError(t, err)
+	_, err = store.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String("test-bucket"),
+		Key:    aws.String("vol-quota/config.json"),
+		Body:   bytes.NewReader(data),
+	})
+	require.NoError(t, err)
+
+	return daemon, vcpus
+}
+
+func TestAccountUsage(t *testing.T) {
+	daemon, vcpus := setupQuotaTestDaemon(t)
+
+	usage, err := daemon.accountUsage(quotaTestAccountID)
+	require.NoError(t, err)
+	assert.Equal(t, quota.Usage{Instances: 2, VCPUs: 2 * vcpus, Volumes: 1, VolumeGiB: 10}, usage)
+}
+
+func TestCheckQuota(t *testing.T) {
+	daemon, _ := setupQuotaTestDaemon(t)
+
+	assert.NoError(t, daemon.checkQuota(quotaTestAccountID, quota.Usage{Instances: 100, Volumes: 100}), "no quotas")
+
+	daemon.config.Daemon.Quotas = []config.AccountQuota{
+		{MaxInstances: 10},
+		{AccountID: quotaTestAccountID, MaxInstances: 2, MaxVolumeGiB: 15},
+	}
+	err := daemon.checkQuota(quotaTestAccountID, quota.Usage{Instances: 1})
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorInstanceLimitExceeded, err.Error())
+	assert.NoError(t, daemon.checkQuota(quotaTestAccountID, quota.Usage{Volumes: 1, VolumeGiB: 5}))
+
+	n, err := daemon.launchableByQuota(quotaTestAccountID, daemon.resourceMgr.instanceTypes[getTestInstanceType(t)], 3)
+	assert.Equal(t, 0, n)
+	assert.Error(t, err)
+}
+
+func TestHandleEC2CreateVolume_Quota(t *testing.T) {
+	daemon, _ := setupQuotaTestDaemon(t)
+	daemon.config.Daemon.Quotas = []config.AccountQuota{{AccountID: quotaTestAccountID, MaxVolumeGiB: 15}}
+
+	sub, err := daemon.natsConn.Subscribe("ec2.test.QuotaCreateVolume", daemon.handleEC2CreateVolume)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	req := nats.NewMsg("ec2.test.QuotaCreateVolume")
+	req.Data, _ = json.Marshal(&ec2.CreateVolumeInput{AvailabilityZone: aws.String("us-east-1a"), Size: aws.Int64(8)})
+	req.Header.Set(utils.AccountIDHeader, quotaTestAccountID)
+	reply, err := daemon.natsConn.RequestMsg(req, 5*time.Second)
+	require.NoError(t, err)
+
+	var resp ec2.ResponseError
+	require.NoError(t, json.Unmarshal(reply.Data, &resp))
+	assert.Equal(t, awserrors.ErrorVolumeLimitExceeded, aws.StringValue(resp.Code))
+	assert.Equal(t, "account 000000000710 is limited to 15 GiB of volume storage and holds 10", aws.StringValue(resp.Message))
+}
+
+func TestDescribeAccountQuotas(t *testing.T) {
+	daemon, vcpus := setupQuotaTestDaemon(t)
+	daemon.config.Daemon.Quotas = []config.AccountQuota{{MaxVCPUs: 64}}
+
+	out, err := daemon.describeAccountQuotas(&quota.DescribeAccountQuotasInput{}, quotaTestAccountID)
+	require.NoError(t, err)
+	assert.Equal(t, quotaTestAccountID, out.AccountID)
+	assert.Contains(t, out.Quotas, quota.Quota{Name: "max-vcpus", Limit: 64, Usage: 2 * vcpus})
+	assert.Contains(t, out.Quotas, quota.Quota{Name: "max-volume-gib", Usage: 10})
+}
+
+func TestHandleEC2CreateVolume_IOPSQuota(t *testing.T) {
+	daemon, _ := setupQuotaTestDaemon(t)
+	daemon.config.Daemon.Quotas = []config.AccountQuota{{AccountID: quotaTestAccountID, MaxProvisionedIOPS: 10000}}
+
+	sub, err := daemon.natsConn.Subscribe("ec2.test.QuotaCreateIOPSVolume", daemon.handleEC2CreateVolume)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	req := nats.NewMsg("ec2.test.QuotaCreateIOPSVolume")
+	req.Data, _ = json.Marshal(&ec2.CreateVolumeInput{AvailabilityZone: aws.String("us-east-1a"), Size: aws.Int64(300),
+		VolumeType: aws.String("io1"), Iops: aws.Int64(15000)})
+	req.Header.Set(utils.AccountIDHeader, quotaTestAccountID)
+	reply, err := daemon.natsConn.RequestMsg(req, 5*time.Second)
+	require.NoError(t, err)
+
+	var resp ec2.ResponseError
+	require.NoError(t, json.Unmarshal(reply.Data, &resp))
+	assert.Equal(t, awserrors.ErrorMaxIOPSLimitExceeded, aws.StringValue(resp.Code))
+	assert.Equal(t, "account 000000000710 is limited to 10000 provisioned IOPS and holds 0", aws.StringValue(resp.Message))
+}
+
+func TestModifyVolumeUsage(t *testing.T) {
+	io1 := &viperblock.VolumeMetadata{SizeGiB: 100, VolumeType: "io1", IOPS: 2000}
+	gp3 := &viperblock.VolumeMetadata{SizeGiB: 100, VolumeType: "gp3", IOPS: 3000}
+
+	tests := []struct {
+		name  string
+		input *ec2.ModifyVolumeInput
+		meta  *viperblock.VolumeMetadata
+		want  quota.Usage
+	}{
+		{name: "grow", input: &ec2.ModifyVolumeInput{Size: aws.Int64(150)}, meta: io1, want: quota.Usage{VolumeGiB: 50}},
+		{name: "more IOPS", input: &ec2.ModifyVolumeInput{Iops: aws.Int64(5000)}, meta: io1, want: quota.Usage{ProvisionedIOPS: 3000}},
+		{name: "fewer IOPS", input: &ec2.ModifyVolumeInput{Iops: aws.Int64(1000)}, meta: io1},
+		{name: "gp3 IOPS don't count", input: &ec2.ModifyVolumeInput{Iops: aws.Int64(16000)}, meta: gp3},
+		{name: "gp3 to io1", input: &ec2.ModifyVolumeInput{VolumeType: aws.String("io1"), Iops: aws.Int64(4000)}, meta: gp3, want: quota.Usage{ProvisionedIOPS: 4000}},
+		{name: "gp3 to io1 default", input: &ec2.ModifyVolumeInput{VolumeType: aws.String("io1")}, meta: gp3, want: quota.Usage{ProvisionedIOPS: 3000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, modifyVolumeUsage(tt.input, tt.meta))
+		})
+	}
+}
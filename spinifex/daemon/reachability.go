@@ -0,0 +1,108 @@
+package daemon
+
+import (
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"github.com/mulgadc/spinifex/spinifex/qmp"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+)
+
+// reachabilityFailureThreshold is how many heartbeats in a row must fail
+// before a check reports the instance impaired, so a single slow reply
+// doesn't flap DescribeInstanceStatus.
+const reachabilityFailureThreshold = 2
+
+// guestAgentTimeout bounds the wait for the guest agent's reply.
+var guestAgentTimeout = 5 * time.Second
+
+// failedRunStates are the QMP run states of a VM that has stopped working on
+// its own, as opposed to one paused or shut down on request.
+var failedRunStates = map[string]bool{
+	"internal-error": true,
+	"io-error":       true,
+	"guest-panicked": true,
+}
+
+// checkReachability runs an instance's health checks on each QMP heartbeat.
+// The system check asks QEMU for its run state; the instance check round-trips
+// a guest-sync through the guest agent, when the guest runs one. The agent is
+// probed off the heartbeat, so a silent guest can't hold it up.
+func (d *Daemon) checkReachability(instance *vm.VM) {
+	systemOK := true
+	resp, err := d.SendQMPCommand(instance.QMPClient, qmp.QMPCommand{Execute: "query-status"}, instance.ID)
+	if err != nil {
+		slog.Warn("QMP heartbeat failed", "instance", instance.ID, "err", err)
+		systemOK = false
+	} else {
+		var status qmp.Status
+		if err := json.Unmarshal(resp.Return, &status); err != nil || failedRunStates[status.Status] {
+			slog.Warn("QMP heartbeat reports a failed run state", "instance", instance.ID, "status", string(resp.Return))
+			systemOK = false
+		} else {
+			slog.Debug("QMP status", "instance", instance.ID, "status", status.Status)
+		}
+	}
+
+	now := utils.Now()
+	d.Instances.Mu.Lock()
+	r := &instance.Reachability
+	r.CheckedAt = now
+	r.SystemFailures, r.SystemImpairedSince = recordCheck(systemOK, r.SystemFailures, r.SystemImpairedSince, now)
+	d.Instances.Mu.Unlock()
+
+	if socket := instance.Config.GuestAgentSocket; socket != "" {
+		if _, busy := d.agentProbes.LoadOrStore(instance.ID, struct{}{}); !busy {
+			go d.probeGuestAgent(instance, socket, now)
+		}
+	}
+}
+
+// probeGuestAgent folds one guest-sync round trip into the instance check.
+// Only one probe per instance runs at a time.
+func (d *Daemon) probeGuestAgent(instance *vm.VM, socket string, now time.Time) {
+	defer d.agentProbes.Delete(instance.ID)
+
+	err := qmp.GuestSync(socket, now.UnixNano(), guestAgentTimeout)
+	agentOK := err == nil
+	if err != nil {
+		slog.Debug("Guest agent did not answer", "instance", instance.ID, "err", err)
+	}
+
+	d.Instances.Mu.Lock()
+	defer d.Instances.Mu.Unlock()
+	r := &instance.Reachability
+	if agentOK {
+		r.GuestAgent = true
+	}
+	if r.GuestAgent {
+		r.GuestAgentFailures, r.GuestAgentImpairedSince = recordCheck(agentOK, r.GuestAgentFailures, r.GuestAgentImpairedSince, now)
+	}
+}
+
+// recordCheck folds one check result into its run of consecutive failures.
+func recordCheck(ok bool, failures int, impairedSince, now time.Time) (int, time.Time) {
+	if ok {
+		return 0, time.Time{}
+	}
+	if failures == 0 {
+		impairedSince = now
+	}
+	return failures + 1, impairedSince
+}
+
+// instanceReachability reports the checks of a running instance, with
+// ImpairedSince set only once a check has failed often enough to count.
+func instanceReachability(r vm.Reachability) types.InstanceReachability {
+	out := types.InstanceReachability{GuestAgent: r.GuestAgent}
+	if r.SystemFailures >= reachabilityFailureThreshold {
+		out.SystemImpairedSince = r.SystemImpairedSince
+	}
+	if r.GuestAgentFailures >= reachabilityFailureThreshold {
+		out.InstanceImpairedSince = r.GuestAgentImpairedSince
+	}
+	return out
+}
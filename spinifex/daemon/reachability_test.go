@@ -0,0 +1,175 @@
+package daemon
+
+import (
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mulgadc/spinifex/spinifex/qmp"
+	"github.com/mulgadc/spinifex/spinifex/testutil"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveGuestAgent answers guest-sync on a unix socket like the QEMU guest
+// agent, while answering is set. Otherwise it reads and stays silent.
+func serveGuestAgent(t *testing.T, answering *atomic.Bool) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "qga.sock")
+	ln, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var cmd qmp.QMPCommand
+				if err := json.NewDecoder(conn).Decode(&cmd); err != nil || !answering.Load() {
+					return
+				}
+				_ = json.NewEncoder(conn).Encode(map[string]any{"return": cmd.Arguments["id"]})
+			}()
+		}
+	}()
+	return path
+}
+
+// checkReachabilityAndWait runs the heartbeat's checks and waits for the
+// guest agent probe they start.
+func checkReachabilityAndWait(t *testing.T, d *Daemon, instance *vm.VM) {
+	t.Helper()
+	d.checkReachability(instance)
+	require.Eventually(t, func() bool {
+		_, busy := d.agentProbes.Load(instance.ID)
+		return !busy
+	}, 5*time.Second, 5*time.Millisecond)
+}
+
+func TestCheckReachability(t *testing.T) {
+	orig := guestAgentTimeout
+	guestAgentTimeout = 200 * time.Millisecond
+	t.Cleanup(func() { guestAgentTimeout = orig })
+
+	daemon := createTestDaemon(t, sharedNATSURL)
+	clock := testutil.NewFakeClock(time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC))
+	t.Cleanup(utils.SetClock(clock))
+
+	var runState atomic.Value
+	runState.Store("running")
+	client, cleanup := newMockQMPClient(t, func(cmd qmp.QMPCommand) map[string]any {
+		return map[string]any{"return": map[string]any{"status": runState.Load(), "running": runState.Load() == "running"}}
+	})
+	defer cleanup()
+
+	var answering atomic.Bool
+	instance := &vm.VM{ID: "i-reach", Status: vm.StateRunning, QMPClient: client}
+	daemon.Instances.UpsertVM(instance)
+
+	// A guest without an agent passes but can't be checked.
+	instance.Config.GuestAgentSocket = serveGuestAgent(t, &answering)
+	checkReachabilityAndWait(t, daemon, instance)
+	assert.Equal(t, types.InstanceReachability{}, instanceReachability(instance.Reachability))
+
+	answering.Store(true)
+	checkReachabilityAndWait(t, daemon, instance)
+	assert.Equal(t, types.InstanceReachability{GuestAgent: true}, instanceReachability(instance.Reachability))
+	assert.Equal(t, clock.Now(), instance.Reachability.CheckedAt)
+
+	// A single failed heartbeat isn't reported yet.
+	runState.Store("guest-panicked")
+	answering.Store(false)
+	failedAt := clock.Now().Add(30 * time.Second)
+	clock.Advance(30 * time.Second)
+	checkReachabilityAndWait(t, daemon, instance)
+	assert.Equal(t, types.InstanceReachability{GuestAgent: true}, instanceReachability(instance.Reachability))
+
+	clock.Advance(30 * time.Second)
+	checkReachabilityAndWait(t, daemon, instance)
+	assert.Equal(t, types.InstanceReachability{
+		SystemImpairedSince:   failedAt,
+		GuestAgent:            true,
+		InstanceImpairedSince: failedAt,
+	}, instanceReachability(instance.Reachability))
+
+	// Recovery clears both checks.
+	runState.Store("running")
+	answering.Store(true)
+	checkReachabilityAndWait(t, daemon, instance)
+	assert.Equal(t, types.InstanceReachability{GuestAgent: true}, instanceReachability(instance.Reachability))
+}
+
+func TestCheckReachability_SilentAgentDoesNotBlock(t *testing.T) {
+	orig := guestAgentTimeout
+	guestAgentTimeout = 2 * time.Second
+	t.Cleanup(func() { guestAgentTimeout = orig })
+
+	daemon := createTestDaemon(t, sharedNATSURL)
+	client, cleanup := newMockQMPClient(t, func(cmd qmp.QMPCommand) map[string]any {
+		return map[string]any{"return": map[string]any{"status": "running", "running": true}}
+	})
+	defer cleanup()
+
+	// An agent that accepts the connection and never replies.
+	path := filepath.Join(t.TempDir(), "qga.sock")
+	ln, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	var accepted atomic.Int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			t.Cleanup(func() { conn.Close() })
+		}
+	}()
+
+	instance := &vm.VM{ID: "i-reach-silent", Status: vm.StateRunning, QMPClient: client}
+	instance.Config.GuestAgentSocket = path
+	daemon.Instances.UpsertVM(instance)
+
+	start := time.Now()
+	daemon.checkReachability(instance)
+	daemon.checkReachability(instance)
+	assert.Less(t, time.Since(start), guestAgentTimeout, "the heartbeat waited on the guest agent")
+
+	// The second heartbeat doesn't stack a probe on the one in flight.
+	require.Eventually(t, func() bool { return accepted.Load() == 1 }, time.Second, 5*time.Millisecond)
+	_, busy := daemon.agentProbes.Load(instance.ID)
+	assert.True(t, busy)
+}
+
+func TestDescribeInstanceBootStatus_Reachability(t *testing.T) {
+	daemon := createTestDaemon(t, sharedNATSURL)
+	since := time.Date(2026, 10, 17, 9, 0, 0, 0, time.UTC)
+
+	running := &vm.VM{ID: "i-reach-running", Status: vm.StateRunning, AccountID: testAccountID,
+		Reachability: vm.Reachability{SystemFailures: 3, SystemImpairedSince: since}}
+	stopped := &vm.VM{ID: "i-reach-stopped", Status: vm.StateStopped, AccountID: testAccountID}
+	daemon.Instances.UpsertVM(running)
+	daemon.Instances.UpsertVM(stopped)
+
+	subject := "test.reachability.DescribeInstanceBootStatus"
+	sub, err := daemon.natsConn.Subscribe(subject, daemon.handleEC2DescribeInstanceBootStatus)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	out, err := utils.NATSRequest[types.DescribeInstanceBootStatusOutput](daemon.natsConn, subject,
+		types.DescribeInstanceBootStatusInput{}, 5*time.Second, testAccountID)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]types.InstanceReachability{running.ID: {SystemImpairedSince: since}}, out.Reachability)
+	assert.Empty(t, out.Instances)
+}
@@ -0,0 +1,227 @@
+package daemon
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/mulgadc/spinifex/spinifex/config"
+	"github.com/mulgadc/spinifex/spinifex/objectstore"
+	"github.com/nats-io/nats.go"
+)
+
+// reloadableConfig lists the settings, by their key under the node's section
+// of spinifex.toml, that a config reload applies to a running daemon. A key
+// covers everything under it. Changes to any other setting are rejected and
+// need a restart.
+var reloadableConfig = map[string]bool{
+	"max_volume_size_gib":              true,
+	"max_volume_iops":                  true,
+	"nats.acl.token":                   true,
+	"predastore.accesskey":             true,
+	"predastore.secretkey":             true,
+	"daemon.log_level":                 true,
+	"daemon.quotas":                    true,
+	"daemon.default_tags":              true,
+	"daemon.hooks":                     true,
+	"daemon.hostname_pattern":          true,
+	"daemon.auto_enable_io":            true,
+	"daemon.boot_oversubscription":     true,
+	"daemon.reboot_grace_seconds":      true,
+	"daemon.drain_timeout_seconds":     true,
+	"daemon.reschedule_lost_instances": true,
+}
+
+// ConfigReloadResponse is a daemon's answer to a config reload: the settings
+// it applied and those it left alone because they need a restart.
+type ConfigReloadResponse struct {
+	Node     string   `json:"node"`
+	Applied  []string `json:"applied,omitempty"`
+	Rejected []string `json:"rejected,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// configChange is a setting that differs between two configs: its key and
+// the index of its field within the config struct.
+type configChange struct {
+	key   string
+	index []int
+}
+
+// reloadable reports whether key, or a key above it, is in reloadableConfig.
+func reloadable(key string) bool {
+	for {
+		if reloadableConfig[key] {
+			return true
+		}
+		i := strings.LastIndexByte(key, '.')
+		if i < 0 {
+			return false
+		}
+		key = key[:i]
+	}
+}
+
+// diffConfig returns the settings that differ between the structs prev and
+// next, keyed by their mapstructure names under prefix.
+func diffConfig(prefix string, index []int, prev, next reflect.Value) []configChange {
+	var changes []configChange
+	t := prev.Type()
+	for i := range t.NumField() {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("mapstructure"), ",")
+		if !field.IsExported() || name == "" || name == "-" {
+			continue
+		}
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+		fieldIndex := append(slices.Clone(index), i)
+		if field.Type.Kind() == reflect.Struct {
+			changes = append(changes, diffConfig(key, fieldIndex, prev.Field(i), next.Field(i))...)
+			continue
+		}
+		if !reflect.DeepEqual(prev.Field(i).Interface(), next.Field(i).Interface()) {
+			changes = append(changes, configChange{key: key, index: fieldIndex})
+		}
+	}
+	return changes
+}
+
+// setupReload reloads the config on SIGHUP until the daemon stops.
+func (d *Daemon) setupReload() {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(sigChan)
+		for {
+			select {
+			case <-d.ctx.Done():
+				return
+			case <-sigChan:
+				slog.Info("Received SIGHUP, reloading config")
+				d.reloadConfig()
+			}
+		}
+	}()
+}
+
+// handleConfigReload reloads the config on request and answers with what
+// changed.
+func (d *Daemon) handleConfigReload(msg *nats.Msg) {
+	respondWithJSON(msg, d.reloadConfig())
+}
+
+// reloadConfig re-reads the config file and applies the changed settings
+// that are reloadable. A file that fails to load or validate changes
+// nothing; other changed settings are reported rejected and keep their
+// running values until the daemon restarts.
+func (d *Daemon) reloadConfig() ConfigReloadResponse {
+	d.reloadMu.Lock()
+	defer d.reloadMu.Unlock()
+
+	resp := ConfigReloadResponse{Node: d.node}
+	if d.configPath == "" {
+		resp.Error = "daemon was started without a config file"
+		slog.Error("Config reload failed", "err", resp.Error)
+		return resp
+	}
+	cluster, err := config.LoadConfig(d.configPath)
+	if err != nil {
+		resp.Error = err.Error()
+		slog.Error("Config reload failed", "path", d.configPath, "err", err)
+		return resp
+	}
+	next, ok := cluster.Nodes[d.node]
+	if !ok {
+		resp.Error = fmt.Sprintf("node %s is not in %s", d.node, d.configPath)
+		slog.Error("Config reload failed", "err", resp.Error)
+		return resp
+	}
+	// Match the defaults NewDaemon filled in, so they do not show as changes.
+	if next.WalDir == "" {
+		next.WalDir = next.BaseDir
+	}
+
+	prev := *d.config
+	changes := diffConfig("", nil, reflect.ValueOf(prev), reflect.ValueOf(next))
+	for _, c := range diffConfig("network", nil, reflect.ValueOf(d.clusterConfig.Network), reflect.ValueOf(cluster.Network)) {
+		resp.Rejected = append(resp.Rejected, c.key)
+	}
+	for _, c := range diffConfig("bootstrap", nil, reflect.ValueOf(d.clusterConfig.Bootstrap), reflect.ValueOf(cluster.Bootstrap)) {
+		resp.Rejected = append(resp.Rejected, c.key)
+	}
+
+	d.mu.Lock()
+	live := reflect.ValueOf(d.config).Elem()
+	for _, c := range changes {
+		if !reloadable(c.key) {
+			resp.Rejected = append(resp.Rejected, c.key)
+			continue
+		}
+		live.FieldByIndex(c.index).Set(reflect.ValueOf(next).FieldByIndex(c.index))
+		resp.Applied = append(resp.Applied, c.key)
+	}
+	if len(resp.Applied) > 0 {
+		d.clusterConfig.Nodes[d.node] = *d.config
+	}
+	d.mu.Unlock()
+
+	d.applyReloadedConfig(prev)
+
+	if len(resp.Rejected) > 0 {
+		slog.Warn("Config reload left settings that need a restart unchanged", "rejected", resp.Rejected)
+	}
+	slog.Info("Config reloaded", "path", d.configPath, "applied", resp.Applied)
+	return resp
+}
+
+// applyReloadedConfig pushes reloaded settings the daemon caches outside
+// d.config to where they are used.
+func (d *Daemon) applyReloadedConfig(prev config.Config) {
+	slog.SetLogLoggerLevel(d.config.Daemon.SlogLevel())
+
+	// The instance types offered follow the config; recompute them rather
+	// than serve a list cached under the old one.
+	if d.resourceMgr != nil {
+		d.resourceMgr.invalidateAvailableTypes()
+	}
+
+	if d.config.Predastore.AccessKey != prev.Predastore.AccessKey || d.config.Predastore.SecretKey != prev.Predastore.SecretKey {
+		objectstore.RotateCredentials(prev.Predastore.AccessKey, d.config.Predastore.AccessKey, d.config.Predastore.SecretKey)
+		if d.systemAccessKey != "" {
+			d.systemAccessKey = d.config.Predastore.AccessKey
+			d.systemSecretKey = d.config.Predastore.SecretKey
+		}
+		if d.elbv2Service != nil && d.elbv2Service.SystemAccessKey != "" {
+			d.elbv2Service.SystemAccessKey = d.config.Predastore.AccessKey
+			d.elbv2Service.SystemSecretKey = d.config.Predastore.SecretKey
+		}
+		slog.Info("Predastore credentials rotated")
+	}
+
+	if d.config.NATS.ACL.Token != prev.NATS.ACL.Token {
+		token := d.config.NATS.ACL.Token
+		d.natsToken.Store(&token)
+		if d.natsConn != nil {
+			if err := d.natsConn.ForceReconnect(); err != nil {
+				slog.Error("Failed to reconnect to NATS with the new token", "err", err)
+			}
+		}
+		slog.Info("NATS token rotated")
+	}
+}
+
+// natsTokenSource returns the NATS token to present on the next connect.
+func (d *Daemon) natsTokenSource() string {
+	if token := d.natsToken.Load(); token != nil {
+		return *token
+	}
+	return ""
+}
@@ -0,0 +1,137 @@
+package daemon
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const reloadTestConfig = `
+node = "n1"
+
+[nodes.n1]
+node = "n1"
+base_dir = "/var/lib/spinifex"
+
+[nodes.n1.nats]
+host = "127.0.0.1:4222"
+
+[nodes.n1.nats.acl]
+token = "nats-token-1"
+
+[nodes.n1.predastore]
+accesskey = "reload-key-1"
+secretkey = "reload-secret-1"
+
+[nodes.n1.daemon]
+log_level = "info"
+drain_timeout_seconds = 60
+`
+
+// newReloadTestDaemon returns a daemon running the config in a temp file,
+// and the file's path.
+func newReloadTestDaemon(t *testing.T) (*Daemon, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "spinifex.toml")
+	require.NoError(t, os.WriteFile(path, []byte(reloadTestConfig), 0600))
+
+	cluster, err := config.LoadConfig(path)
+	require.NoError(t, err)
+	cfg := cluster.Nodes["n1"]
+	cfg.WalDir = cfg.BaseDir
+	return &Daemon{node: "n1", config: &cfg, clusterConfig: cluster, configPath: path}, path
+}
+
+func TestReloadConfig(t *testing.T) {
+	d, path := newReloadTestDaemon(t)
+	d.systemAccessKey = "reload-key-1"
+
+	edited := `
+node = "n1"
+
+[nodes.n1]
+node = "n1"
+base_dir = "/var/lib/spinifex"
+
+[nodes.n1.nats]
+host = "10.0.0.9:4222"
+
+[nodes.n1.nats.acl]
+token = "nats-token-2"
+
+[nodes.n1.predastore]
+accesskey = "reload-key-2"
+secretkey = "reload-secret-2"
+
+[nodes.n1.daemon]
+log_level = "debug"
+drain_timeout_seconds = 90
+quotas = [{ max_instances = 5 }]
+`
+	require.NoError(t, os.WriteFile(path, []byte(edited), 0600))
+	t.Cleanup(func() { slog.SetLogLoggerLevel(slog.LevelInfo) })
+
+	resp := d.reloadConfig()
+	assert.Empty(t, resp.Error)
+	assert.Equal(t, "n1", resp.Node)
+	assert.ElementsMatch(t, []string{
+		"nats.acl.token", "predastore.accesskey", "predastore.secretkey",
+		"daemon.log_level", "daemon.drain_timeout_seconds", "daemon.quotas",
+	}, resp.Applied)
+	assert.Equal(t, []string{"nats.host"}, resp.Rejected)
+
+	assert.Equal(t, "nats-token-2", d.config.NATS.ACL.Token)
+	assert.Equal(t, "nats-token-2", d.natsTokenSource())
+	assert.Equal(t, "reload-key-2", d.config.Predastore.AccessKey)
+	assert.Equal(t, "reload-key-2", d.systemAccessKey)
+	assert.Equal(t, "reload-secret-2", d.systemSecretKey)
+	assert.Equal(t, 90, d.config.Daemon.DrainTimeoutSeconds)
+	assert.Equal(t, 5, d.config.Daemon.Quotas[0].MaxInstances)
+	assert.Equal(t, "127.0.0.1:4222", d.config.NATS.Host, "rejected settings keep their running value")
+	assert.Equal(t, "reload-key-2", d.clusterConfig.Nodes["n1"].Predastore.AccessKey)
+
+	// Reloading the same file again changes nothing.
+	resp = d.reloadConfig()
+	assert.Empty(t, resp.Applied)
+	assert.Equal(t, []string{"nats.host"}, resp.Rejected)
+}
+
+func TestReloadConfig_InvalidatesAvailableTypes(t *testing.T) {
+	d, _ := newReloadTestDaemon(t)
+	d.resourceMgr = &ResourceManager{hostVCPU: 2, hostMemGB: 4.0, instanceTypes: map[string]*ec2.InstanceTypeInfo{}}
+	d.resourceMgr.GetAvailableInstanceTypeInfos(false)
+	require.False(t, d.resourceMgr.availableTypesExpiry.IsZero())
+
+	resp := d.reloadConfig()
+	assert.Empty(t, resp.Error)
+	assert.True(t, d.resourceMgr.availableTypesExpiry.IsZero(), "a reload recomputes the type list")
+}
+
+func TestReloadConfig_InvalidFileChangesNothing(t *testing.T) {
+	d, path := newReloadTestDaemon(t)
+	require.NoError(t, os.WriteFile(path, []byte(reloadTestConfig+"boot_oversubscription = \"overcommit\"\n"), 0600))
+
+	resp := d.reloadConfig()
+	assert.Contains(t, resp.Error, "boot_oversubscription")
+	assert.Empty(t, resp.Applied)
+	assert.Equal(t, 60, d.config.Daemon.DrainTimeoutSeconds)
+}
+
+func TestReloadConfig_NoConfigFile(t *testing.T) {
+	d := &Daemon{node: "n1", config: &config.Config{}}
+	assert.NotEmpty(t, d.reloadConfig().Error)
+}
+
+func TestReloadable(t *testing.T) {
+	assert.True(t, reloadable("daemon.log_level"))
+	assert.True(t, reloadable("daemon.hooks.pre_launch"))
+	assert.False(t, reloadable("daemon.launch_workers"))
+	assert.False(t, reloadable("nats.host"))
+	assert.False(t, reloadable("daemon"))
+}
@@ -87,6 +87,64 @@ func canAllocateCount(availVCPU, allocVCPU int, availMem, allocMem float64,
 	return max(result, 0)
 }
 
+// Resources an allocation can run short of.
+const (
+	capacityResourceVCPU   = "vCPU"
+	capacityResourceMemory = "memory"
+)
+
+// capacityShortfallError reports why instances don't fit: the binding
+// resource and how much of it the request needs and has left. Amounts are in
+// vCPUs or GiB.
+type capacityShortfallError struct {
+	instanceType string
+	count        int
+	resource     string
+	needed       float64
+	available    float64
+}
+
+func (e *capacityShortfallError) Error() string {
+	return fmt.Sprintf("insufficient resources for instance type %s: %s", e.instanceType, e.detail())
+}
+
+// detail is the client-facing description of the shortfall, sent as the
+// InsufficientInstanceCapacity detail.
+func (e *capacityShortfallError) detail() string {
+	if e.resource == capacityResourceMemory {
+		return fmt.Sprintf("not enough memory for %d x %s: %.1f GiB needed, %.1f GiB available (%.1f GiB short)",
+			e.count, e.instanceType, e.needed, e.available, e.needed-e.available)
+	}
+	return fmt.Sprintf("not enough vCPU for %d x %s: %d needed, %d available (%d short)",
+		e.count, e.instanceType, int(e.needed), int(e.available), int(e.needed-e.available))
+}
+
+// capacityShortfall returns nil if count instances fit in the remaining
+// capacity, or the shortfall of the binding resource. When both resources
+// are short, the binding one is the one covering the smaller share of the
+// request. Pure function, the counterpart of canAllocateCount.
+func capacityShortfall(availVCPU, allocVCPU int, availMem, allocMem float64,
+	instanceType string, vCPUs int64, memMiB int64, count int) *capacityShortfallError {
+	remainingVCPU := float64(max(availVCPU-allocVCPU, 0))
+	remainingMem := max(availMem-allocMem, 0)
+	neededVCPU := float64(vCPUs) * float64(count)
+	neededMem := float64(memMiB) / 1024.0 * float64(count)
+
+	shortVCPU := neededVCPU > remainingVCPU
+	shortMem := neededMem > remainingMem
+	if shortVCPU && shortMem && remainingMem/neededMem < remainingVCPU/neededVCPU {
+		shortVCPU = false
+	}
+
+	switch {
+	case shortVCPU:
+		return &capacityShortfallError{instanceType, count, capacityResourceVCPU, neededVCPU, remainingVCPU}
+	case shortMem:
+		return &capacityShortfallError{instanceType, count, capacityResourceMemory, neededMem, remainingMem}
+	}
+	return nil
+}
+
 // resourceStatsForType computes the InstanceTypeCap for a single instance type
 // given the remaining host resources. Pure function — no locks or side effects.
 // Callers are responsible for alarming on negative remainVCPU/remainMem
@@ -341,3 +341,74 @@ func TestAllocateForLaunch(t *testing.T) {
 		})
 	}
 }
+
+func TestCapacityShortfall(t *testing.T) {
+	tests := []struct {
+		name      string
+		availVCPU int
+		allocVCPU int
+		availMem  float64
+		allocMem  float64
+		count     int
+		resource  string // "" when the request fits
+		needed    float64
+		available float64
+		detail    string
+	}{
+		{
+			name:      "fits",
+			availVCPU: 8, availMem: 16.0,
+			count: 2,
+		},
+		{
+			name:      "memory bound",
+			availVCPU: 64, availMem: 16.0, allocMem: 13.0,
+			count:    1,
+			resource: capacityResourceMemory, needed: 4.0, available: 3.0,
+			detail: "not enough memory for 1 x t3.medium: 4.0 GiB needed, 3.0 GiB available (1.0 GiB short)",
+		},
+		{
+			name:      "vCPU bound",
+			availVCPU: 4, allocVCPU: 1, availMem: 64.0,
+			count:    2,
+			resource: capacityResourceVCPU, needed: 4, available: 3,
+			detail: "not enough vCPU for 2 x t3.medium: 4 needed, 3 available (1 short)",
+		},
+		{
+			name:      "both short, memory covers less",
+			availVCPU: 1, availMem: 1.0,
+			count:    1,
+			resource: capacityResourceMemory, needed: 4.0, available: 1.0,
+		},
+		{
+			name:      "both short, vCPU covers less",
+			availVCPU: 1, availMem: 3.0,
+			count:    1,
+			resource: capacityResourceVCPU, needed: 2, available: 1,
+		},
+		{
+			name:      "overallocated reports nothing available",
+			availVCPU: 4, allocVCPU: 6, availMem: 64.0,
+			count:    1,
+			resource: capacityResourceVCPU, needed: 2, available: 0,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := capacityShortfall(tc.availVCPU, tc.allocVCPU, tc.availMem, tc.allocMem, "t3.medium", 2, 4096, tc.count)
+			if tc.resource == "" {
+				assert.Nil(t, got)
+				return
+			}
+			if assert.NotNil(t, got) {
+				assert.Equal(t, tc.resource, got.resource)
+				assert.InDelta(t, tc.needed, got.needed, 0.001)
+				assert.InDelta(t, tc.available, got.available, 0.001)
+				if tc.detail != "" {
+					assert.Equal(t, tc.detail, got.detail())
+				}
+			}
+		})
+	}
+}
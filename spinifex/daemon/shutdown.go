@@ -3,13 +3,19 @@ package daemon
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"sync"
 	"time"
 
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
 	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
 	"github.com/nats-io/nats.go"
 )
 
@@ -47,6 +53,26 @@ type ShutdownProgress struct {
 	Remaining int    `json:"remaining"`
 }
 
+// NodeDrainRequest asks one node's daemon to drain for maintenance and exit.
+type NodeDrainRequest struct {
+	// Evacuate stops the node's running instances as StopInstances does, so
+	// they can be started on other nodes. Otherwise they are relaunched when
+	// the node's daemon starts again.
+	Evacuate bool `json:"evacuate"`
+	// Timeout bounds the drain, in seconds. Zero uses the node's
+	// drain_timeout_seconds.
+	Timeout int `json:"timeout_seconds"`
+}
+
+// NodeDrainResponse reports what draining a node did to its instances.
+type NodeDrainResponse struct {
+	Node      string   `json:"node"`
+	Stopped   []string `json:"stopped,omitempty"`
+	Evacuated []string `json:"evacuated,omitempty"`
+	TimedOut  bool     `json:"timed_out,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
 // handleShutdownGate stops the API gateway and UI, then sets shuttingDown flag
 // so the daemon rejects new work. Phase: GATE.
 func (d *Daemon) handleShutdownGate(msg *nats.Msg) {
@@ -112,29 +138,20 @@ func (d *Daemon) handleShutdownDrain(msg *nats.Msg) {
 
 	slog.Info("Shutdown DRAIN phase starting", "node", d.node)
 
+	// Let in-flight launches finish so their instances are stopped too
+	d.drainLaunches()
+
 	// Count total VMs
-	d.Instances.Mu.Lock()
-	total := len(d.Instances.VMS)
-	d.Instances.Mu.Unlock()
+	vms := d.Instances.ListVMs()
+	total := len(vms)
 
 	// Publish initial progress
 	d.publishShutdownProgress("drain", total, total)
 
 	// Stop all instances (graceful shutdown, no volume deletion)
 	if total > 0 {
-		d.Instances.Mu.Lock()
-		vms := d.Instances.VMS
-		d.Instances.Mu.Unlock()
-
 		if err := d.stopInstance(vms, false); err != nil {
-			slog.Error("Failed to stop instances during DRAIN", "error", err)
-			ack := ShutdownACK{
-				Node:  d.node,
-				Phase: "drain",
-				Error: err.Error(),
-			}
-			d.respondShutdownACK(msg, ack)
-			return
+			slog.Error("Volume teardown incomplete during DRAIN, instances are down", "error", err)
 		}
 	}
 
@@ -247,6 +264,24 @@ func (d *Daemon) handleShutdownInfra(msg *nats.Msg) {
 		}
 	}
 
+	if d.imdsServer != nil {
+		if err := d.imdsServer.Shutdown(context.Background()); err != nil {
+			slog.Warn("Failed to shutdown instance metadata service", "error", err)
+		}
+	}
+
+	if d.metricsServer != nil {
+		if err := d.metricsServer.Shutdown(context.Background()); err != nil {
+			slog.Warn("Failed to shutdown metrics endpoint", "error", err)
+		}
+	}
+
+	if d.tracingShutdown != nil {
+		if err := d.tracingShutdown(context.Background()); err != nil {
+			slog.Warn("Failed to flush traces", "error", err)
+		}
+	}
+
 	// Shutdown cluster manager
 	if d.clusterServer != nil {
 		if err := d.clusterServer.Shutdown(context.Background()); err != nil {
@@ -280,7 +315,7 @@ func (d *Daemon) respondShutdownACK(msg *nats.Msg, ack ShutdownACK) {
 		slog.Error("Failed to marshal shutdown ACK", "error", err)
 		return
 	}
-	if err := msg.Respond(data); err != nil {
+	if err := utils.Respond(msg, awserrors.Reply{Result: data}); err != nil {
 		slog.Error("Failed to respond with shutdown ACK", "error", err)
 	}
 }
@@ -298,7 +333,168 @@ func (d *Daemon) publishShutdownProgress(phase string, total, remaining int) {
 		slog.Error("Failed to marshal shutdown progress", "error", err)
 		return
 	}
-	if err := d.natsConn.Publish("spinifex.cluster.shutdown.progress", data); err != nil {
+	if err := d.natsConn.Publish(utils.Subject("spinifex.cluster.shutdown.progress"), data); err != nil {
 		slog.Warn("Failed to publish shutdown progress", "error", err)
 	}
 }
+
+// handleNodeDrain drains the node and, once it has answered, has the daemon
+// exit.
+func (d *Daemon) handleNodeDrain(msg *nats.Msg) {
+	var req NodeDrainRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		slog.Error("handleNodeDrain: failed to unmarshal request", "error", err)
+		respondWithJSON(msg, NodeDrainResponse{Node: d.node, Error: err.Error()})
+		return
+	}
+
+	timeout := d.config.Daemon.DrainTimeout()
+	if req.Timeout > 0 {
+		timeout = time.Duration(req.Timeout) * time.Second
+	}
+
+	slog.Info("Draining node", "node", d.node, "evacuate", req.Evacuate, "timeout", timeout)
+	respondWithJSON(msg, d.drain(req.Evacuate, timeout))
+	d.requestExit()
+}
+
+// requestExit has the shutdown handler clean up and the daemon exit.
+func (d *Daemon) requestExit() {
+	if d.exitCh == nil {
+		return
+	}
+	d.exitOnce.Do(func() { close(d.exitCh) })
+}
+
+// drain cordons the node so launches go to other nodes, lets the launches
+// in flight finish and stops the node's instances, unmounting their volumes.
+// It returns once they are stopped or timeout passes. Only the first call
+// drains; later and concurrent calls wait for it and get its result.
+func (d *Daemon) drain(evacuate bool, timeout time.Duration) *NodeDrainResponse {
+	d.draining.Store(true)
+	d.drainOnce.Do(func() {
+		d.drainResult = d.runDrain(evacuate, timeout)
+	})
+	return d.drainResult
+}
+
+func (d *Daemon) runDrain(evacuate bool, timeout time.Duration) *NodeDrainResponse {
+	// Crash handlers and restart schedulers bail out from here on
+	d.shuttingDown.Store(true)
+	d.cordon()
+
+	var mu sync.Mutex
+	var stoppedIDs, evacuatedIDs []string
+	stopped := func(instanceID string, evacuated bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if evacuated {
+			evacuatedIDs = append(evacuatedIDs, instanceID)
+		} else {
+			stoppedIDs = append(stoppedIDs, instanceID)
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- d.stopForDrain(evacuate, stopped) }()
+
+	result := &NodeDrainResponse{Node: d.node}
+	select {
+	case err := <-done:
+		if err != nil {
+			result.Error = err.Error()
+		}
+	case <-time.After(timeout):
+		slog.Warn("Timed out draining node", "node", d.node, "timeout", timeout)
+		result.TimedOut = true
+		result.Error = fmt.Sprintf("drain timed out after %s", timeout)
+	}
+
+	mu.Lock()
+	result.Stopped = slices.Sorted(slices.Values(stoppedIDs))
+	result.Evacuated = slices.Sorted(slices.Values(evacuatedIDs))
+	mu.Unlock()
+
+	slog.Info("Node drained", "node", d.node, "stopped", len(result.Stopped), "evacuated", len(result.Evacuated), "timedOut", result.TimedOut)
+	return result
+}
+
+// cordon stops the node taking launches: it leaves the RunInstances and
+// start subjects so the other nodes serve them.
+func (d *Daemon) cordon() {
+	d.resourceMgr.cordon()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if sub, ok := d.natsSubscriptions["ec2.start"]; ok {
+		if err := sub.Unsubscribe(); err != nil {
+			slog.Warn("Failed to unsubscribe from start requests", "err", err)
+		}
+		delete(d.natsSubscriptions, "ec2.start")
+	}
+}
+
+// stopForDrain waits for in-flight launches, then stops every instance on
+// the node, calling stopped for each one stopped. With evacuate, running
+// instances are handed to the shared KV as stopped, except interruptible
+// instances, which can't be stopped and are relaunched with the node.
+func (d *Daemon) stopForDrain(evacuate bool, stopped func(instanceID string, evacuated bool)) error {
+	d.drainLaunches()
+
+	var wg sync.WaitGroup
+	var errMu sync.Mutex
+	var errs []error
+	for _, instance := range d.Instances.ListVMs() {
+		wg.Go(func() {
+			move := evacuate && d.startEvacuation(instance)
+			// The instance is down even if its volumes failed to tear down;
+			// those failures are reported once every instance is handled.
+			if err := d.stopInstance([]*vm.VM{instance}, false); err != nil {
+				errMu.Lock()
+				errs = append(errs, err)
+				errMu.Unlock()
+			}
+			if move {
+				move = d.finishEvacuation(instance)
+			}
+			stopped(instance.ID, move)
+		})
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// startEvacuation moves a running instance to stopping ahead of its stop,
+// reporting whether it did.
+func (d *Daemon) startEvacuation(instance *vm.VM) bool {
+	d.Instances.Mu.Lock()
+	if instance.Status != vm.StateRunning || instance.Interruptible {
+		d.Instances.Mu.Unlock()
+		return false
+	}
+	d.setStateReason(instance, stateReasonScheduledStop, "Instance stopped to drain its host for maintenance")
+	d.Instances.Mu.Unlock()
+
+	if err := d.TransitionState(instance, vm.StateStopping); err != nil {
+		slog.Error("Failed to move instance to stopping for evacuation", "instanceId", instance.ID, "err", err)
+		return false
+	}
+	return true
+}
+
+// finishEvacuation marks an evacuated instance stopped and hands it to the
+// shared KV, where any node can start it. An instance the KV write fails
+// for stays on this node, stopped, and is handed over when it restarts.
+func (d *Daemon) finishEvacuation(instance *vm.VM) bool {
+	if err := d.TransitionState(instance, vm.StateStopped); err != nil {
+		slog.Error("Failed to stop evacuated instance", "instanceId", instance.ID, "err", err)
+		return false
+	}
+	if !d.migrateStoppedToSharedKV(instance) {
+		return false
+	}
+	if err := d.WriteState(); err != nil {
+		slog.Error("Failed to persist state after evacuating instance", "instanceId", instance.ID, "err", err)
+	}
+	return true
+}
@@ -189,3 +189,57 @@ func TestPublishShutdownProgress(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleNodeDrain(t *testing.T) {
+	d := createTestDaemon(t, sharedNATSURL)
+	startSub, err := d.natsConn.Subscribe("test.drain.ec2.start", func(*nats.Msg) {})
+	require.NoError(t, err)
+	d.natsSubscriptions["ec2.start"] = startSub
+
+	sub, err := d.natsConn.Subscribe("test.drain.node", d.handleNodeDrain)
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	reply, err := d.natsConn.Request("test.drain.node", []byte(`{"evacuate":true,"timeout_seconds":5}`), 10*time.Second)
+	require.NoError(t, err)
+
+	var resp NodeDrainResponse
+	require.NoError(t, json.Unmarshal(reply.Data, &resp))
+	assert.Equal(t, NodeDrainResponse{Node: "node-1"}, resp)
+
+	// The node takes no more launches and reports no capacity
+	assert.True(t, d.shuttingDown.Load())
+	assert.True(t, d.resourceMgr.isCordoned())
+	assert.NotContains(t, d.natsSubscriptions, "ec2.start")
+	assert.False(t, startSub.IsValid())
+	_, _, _, _, _, _, caps := d.resourceMgr.GetResourceStats()
+	assert.Empty(t, caps)
+
+	select {
+	case <-d.exitCh:
+	default:
+		t.Fatal("drain request did not ask the daemon to exit")
+	}
+}
+
+func TestDrain_TimesOutOnStuckLaunch(t *testing.T) {
+	d := createTestDaemon(t, sharedNATSURL)
+
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	sub, err := d.natsConn.Subscribe("test.drain.launch", d.launchPool.handler(func(*nats.Msg) {
+		close(started)
+		<-release
+	}))
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+	require.NoError(t, d.natsConn.Publish("test.drain.launch", nil))
+	<-started
+
+	result := d.drain(false, 100*time.Millisecond)
+	assert.True(t, result.TimedOut)
+	assert.Equal(t, "drain timed out after 100ms", result.Error)
+
+	// SIGTERM during or after a drain gets the first drain's result
+	assert.Same(t, result, d.drain(true, time.Hour))
+}
@@ -0,0 +1,236 @@
+package daemon
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/instancetypes"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+)
+
+// sriovNetRoot and pciDeviceRoot are where virtual functions are found and
+// rebound. Variables so tests can point them at temp dirs.
+var (
+	sriovNetRoot  = "/sys/class/net"
+	pciDeviceRoot = "/sys/bus/pci/devices"
+)
+
+// sriovVF is one SR-IOV virtual function of a host NIC.
+type sriovVF struct {
+	pf      string // physical function's interface name
+	index   int    // VF number on the physical function
+	pciAddr string // e.g. "0000:3b:02.1"
+}
+
+// sriovPool hands out the host's virtual functions, one per ENI.
+type sriovPool struct {
+	mu     sync.Mutex
+	vfs    []*sriovVF
+	owners map[string]*sriovVF // ENI ID -> VF
+}
+
+func newSRIOVPool(vfs []*sriovVF) *sriovPool {
+	return &sriovPool{vfs: vfs, owners: make(map[string]*sriovVF)}
+}
+
+// allocate returns the VF eniID holds, or else the first free one. It
+// returns nil when every VF is taken.
+func (p *sriovPool) allocate(eniID string) *sriovVF {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if vf, ok := p.owners[eniID]; ok {
+		return vf
+	}
+	for _, vf := range p.vfs {
+		if !p.heldLocked(vf) {
+			p.owners[eniID] = vf
+			return vf
+		}
+	}
+	return nil
+}
+
+// claim records the VF at pciAddr as eniID's, for an instance that kept
+// running while the daemon restarted. It returns nil when the VF is no
+// longer on the host.
+func (p *sriovPool) claim(eniID, pciAddr string) *sriovVF {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, vf := range p.vfs {
+		if vf.pciAddr == pciAddr {
+			p.owners[eniID] = vf
+			return vf
+		}
+	}
+	return nil
+}
+
+// release frees the VF eniID holds and returns it, or nil if it held none.
+func (p *sriovPool) release(eniID string) *sriovVF {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	vf := p.owners[eniID]
+	delete(p.owners, eniID)
+	return vf
+}
+
+func (p *sriovPool) heldLocked(vf *sriovVF) bool {
+	for _, held := range p.owners {
+		if held == vf {
+			return true
+		}
+	}
+	return false
+}
+
+// detectSRIOVVFs lists the virtual functions of the given physical
+// functions, in the order the interfaces are given and then by VF number.
+// VFs are created by writing sriov_numvfs before the daemon starts.
+func detectSRIOVVFs(interfaces []string) ([]*sriovVF, error) {
+	var vfs []*sriovVF
+	for _, pf := range interfaces {
+		links, err := filepath.Glob(filepath.Join(sriovNetRoot, pf, "device", "virtfn*"))
+		if err != nil {
+			return nil, err
+		}
+		if len(links) == 0 {
+			return nil, fmt.Errorf("%s has no virtual functions", pf)
+		}
+		var pfVFs []*sriovVF
+		for _, link := range links {
+			index, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(link), "virtfn"))
+			if err != nil {
+				continue
+			}
+			target, err := os.Readlink(link)
+			if err != nil {
+				return nil, fmt.Errorf("read %s: %w", link, err)
+			}
+			pfVFs = append(pfVFs, &sriovVF{pf: pf, index: index, pciAddr: filepath.Base(target)})
+		}
+		slices.SortFunc(pfVFs, func(a, b *sriovVF) int { return a.index - b.index })
+		vfs = append(vfs, pfVFs...)
+	}
+	return vfs, nil
+}
+
+// VFPlumber configures virtual functions for instances. The live
+// implementation uses ip(8) and sysfs; tests use a mock.
+type VFPlumber interface {
+	// SetupVF gives vf the ENI's MAC and VLAN and binds it to vfio-pci so
+	// QEMU can pass it through.
+	SetupVF(vf *sriovVF, mac string, vlan int) error
+
+	// CleanupVF returns vf to its host driver and clears its MAC and VLAN.
+	CleanupVF(vf *sriovVF) error
+}
+
+// IPLinkVFPlumber implements VFPlumber with ip(8), which programs the VF
+// through the physical function's driver over netlink.
+type IPLinkVFPlumber struct{}
+
+var _ VFPlumber = (*IPLinkVFPlumber)(nil)
+
+func (p *IPLinkVFPlumber) SetupVF(vf *sriovVF, mac string, vlan int) error {
+	// spoofchk keeps the guest from sending as any other MAC; without trust
+	// it cannot turn on promiscuous mode or change its MAC either.
+	if out, err := sudoCommand("ip", "link", "set", vf.pf, "vf", strconv.Itoa(vf.index),
+		"mac", mac, "vlan", strconv.Itoa(vlan), "spoofchk", "on", "trust", "off").CombinedOutput(); err != nil {
+		return fmt.Errorf("configure %s vf %d: %s: %w", vf.pf, vf.index, strings.TrimSpace(string(out)), err)
+	}
+	if err := bindPCIDriver(vf.pciAddr, "vfio-pci"); err != nil {
+		return fmt.Errorf("bind %s to vfio-pci: %w", vf.pciAddr, err)
+	}
+	slog.Info("SR-IOV VF configured", "pf", vf.pf, "vf", vf.index, "pci", vf.pciAddr, "mac", mac, "vlan", vlan)
+	return nil
+}
+
+func (p *IPLinkVFPlumber) CleanupVF(vf *sriovVF) error {
+	if err := bindPCIDriver(vf.pciAddr, ""); err != nil {
+		slog.Warn("Failed to return VF to its host driver", "pci", vf.pciAddr, "err", err)
+	}
+	if out, err := sudoCommand("ip", "link", "set", vf.pf, "vf", strconv.Itoa(vf.index),
+		"mac", "00:00:00:00:00:00", "vlan", "0").CombinedOutput(); err != nil {
+		return fmt.Errorf("reset %s vf %d: %s: %w", vf.pf, vf.index, strings.TrimSpace(string(out)), err)
+	}
+	slog.Info("SR-IOV VF released", "pf", vf.pf, "vf", vf.index, "pci", vf.pciAddr)
+	return nil
+}
+
+// bindPCIDriver unbinds the device at pciAddr from its driver and reprobes
+// it with driver, or with its default driver when driver is "".
+func bindPCIDriver(pciAddr, driver string) error {
+	dev := filepath.Join(pciDeviceRoot, pciAddr)
+	if _, err := os.Stat(filepath.Join(dev, "driver")); err == nil {
+		if err := os.WriteFile(filepath.Join(dev, "driver", "unbind"), []byte(pciAddr), 0o200); err != nil {
+			return fmt.Errorf("unbind: %w", err)
+		}
+	}
+	// An empty write is rejected; a newline clears the override.
+	override := driver
+	if override == "" {
+		override = "\n"
+	}
+	if err := os.WriteFile(filepath.Join(dev, "driver_override"), []byte(override), 0o200); err != nil {
+		return fmt.Errorf("set driver_override: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(filepath.Dir(pciDeviceRoot), "drivers_probe"), []byte(pciAddr), 0o200); err != nil {
+		return fmt.Errorf("probe: %w", err)
+	}
+	return nil
+}
+
+// setupPrimaryVF passes an SR-IOV virtual function through to the guest as
+// its primary NIC. It returns false, and the instance uses a tap on br-int,
+// unless the host has SR-IOV configured, the instance type has dedicated
+// network bandwidth, the ENI's subnet is mapped to a VLAN and a VF is free.
+// Instances with their metadata endpoint disabled also keep a tap, which
+// the metadata firewall needs.
+func (d *Daemon) setupPrimaryVF(instance *vm.VM, instanceType *ec2.InstanceTypeInfo) (bool, error) {
+	if d.sriov == nil || d.vfPlumber == nil || !instancetypes.DedicatedNetworking(instanceType) ||
+		metadataEndpointDisabled(instance) || instance.Instance == nil {
+		return false, nil
+	}
+	vlan, ok := d.config.Daemon.SRIOV.SubnetVLANs[aws.StringValue(instance.Instance.SubnetId)]
+	if !ok {
+		return false, nil
+	}
+	vf := d.sriov.allocate(instance.ENIId)
+	if vf == nil {
+		slog.Info("No free SR-IOV VF, using a tap", "instanceId", instance.ID, "eni", instance.ENIId)
+		return false, nil
+	}
+	if err := d.vfPlumber.SetupVF(vf, instance.ENIMac, vlan); err != nil {
+		d.sriov.release(instance.ENIId)
+		return false, fmt.Errorf("setup SR-IOV VF: %w", err)
+	}
+
+	instance.SRIOVVF = vf.pciAddr
+	instance.Config.Devices = append(instance.Config.Devices, vm.Device{
+		Value: fmt.Sprintf("vfio-pci,host=%s,id=%s", vf.pciAddr, ENIDeviceID(instance.ENIId)),
+	})
+	slog.Info("VPC networking configured", "vf", vf.pciAddr, "pf", vf.pf, "eni", instance.ENIId, "mac", instance.ENIMac, "vlan", vlan)
+	return true, nil
+}
+
+// releasePrimaryVF returns the instance's VF to the pool once its QEMU
+// process has exited.
+func (d *Daemon) releasePrimaryVF(instance *vm.VM) {
+	if instance.SRIOVVF == "" || d.sriov == nil {
+		return
+	}
+	if vf := d.sriov.release(instance.ENIId); vf != nil && d.vfPlumber != nil {
+		if err := d.vfPlumber.CleanupVF(vf); err != nil {
+			slog.Warn("Failed to clean up SR-IOV VF", "eni", instance.ENIId, "pci", vf.pciAddr, "err", err)
+		}
+	}
+	instance.SRIOVVF = ""
+}
@@ -0,0 +1,172 @@
+package daemon
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/config"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// MockVFPlumber records VF setup and cleanup without touching the host.
+type MockVFPlumber struct {
+	SetupCalls   []mockVFSetupCall
+	CleanupCalls []string
+	SetupErr     error
+}
+
+var _ VFPlumber = (*MockVFPlumber)(nil)
+
+type mockVFSetupCall struct {
+	PCIAddr string
+	MAC     string
+	VLAN    int
+}
+
+func (m *MockVFPlumber) SetupVF(vf *sriovVF, mac string, vlan int) error {
+	m.SetupCalls = append(m.SetupCalls, mockVFSetupCall{PCIAddr: vf.pciAddr, MAC: mac, VLAN: vlan})
+	return m.SetupErr
+}
+
+func (m *MockVFPlumber) CleanupVF(vf *sriovVF) error {
+	m.CleanupCalls = append(m.CleanupCalls, vf.pciAddr)
+	return nil
+}
+
+func TestDetectSRIOVVFs(t *testing.T) {
+	root := t.TempDir()
+	orig := sriovNetRoot
+	sriovNetRoot = root
+	t.Cleanup(func() { sriovNetRoot = orig })
+
+	dev := filepath.Join(root, "enp59s0f0", "device")
+	require.NoError(t, os.MkdirAll(dev, 0o755))
+	for name, target := range map[string]string{
+		"virtfn0":  "../0000:3b:02.0",
+		"virtfn1":  "../0000:3b:02.1",
+		"virtfn10": "../0000:3b:03.2",
+	} {
+		require.NoError(t, os.Symlink(target, filepath.Join(dev, name)))
+	}
+
+	vfs, err := detectSRIOVVFs([]string{"enp59s0f0"})
+	require.NoError(t, err)
+	require.Len(t, vfs, 3)
+	assert.Equal(t, sriovVF{pf: "enp59s0f0", index: 0, pciAddr: "0000:3b:02.0"}, *vfs[0])
+	assert.Equal(t, 1, vfs[1].index)
+	assert.Equal(t, 10, vfs[2].index, "sorted numerically")
+
+	_, err = detectSRIOVVFs([]string{"eth9"})
+	assert.ErrorContains(t, err, "no virtual functions")
+}
+
+func TestSRIOVPool(t *testing.T) {
+	pool := newSRIOVPool([]*sriovVF{
+		{pf: "pf0", index: 0, pciAddr: "0000:3b:02.0"},
+		{pf: "pf0", index: 1, pciAddr: "0000:3b:02.1"},
+	})
+
+	a := pool.allocate("eni-a")
+	require.NotNil(t, a)
+	assert.Same(t, a, pool.allocate("eni-a"), "an ENI keeps its VF")
+	b := pool.allocate("eni-b")
+	require.NotNil(t, b)
+	assert.NotSame(t, a, b)
+	assert.Nil(t, pool.allocate("eni-c"), "pool exhausted")
+
+	assert.Same(t, a, pool.release("eni-a"))
+	assert.Nil(t, pool.release("eni-a"))
+	assert.Same(t, a, pool.allocate("eni-c"))
+
+	pool.release("eni-b")
+	assert.Same(t, b, pool.claim("eni-b", "0000:3b:02.1"))
+	assert.Nil(t, pool.claim("eni-d", "0000:00:00.0"), "VF no longer on the host")
+}
+
+func TestSetupPrimaryVF(t *testing.T) {
+	large := &ec2.InstanceTypeInfo{InstanceType: aws.String("m6i.8xlarge"),
+		NetworkInfo: &ec2.NetworkInfo{NetworkPerformance: aws.String("12.5 Gigabit")}}
+	small := &ec2.InstanceTypeInfo{InstanceType: aws.String("m6i.large"),
+		NetworkInfo: &ec2.NetworkInfo{NetworkPerformance: aws.String("Up to 12.5 Gigabit")}}
+
+	newDaemon := func() (*Daemon, *MockVFPlumber) {
+		plumber := &MockVFPlumber{}
+		cfg := &config.Config{}
+		cfg.Daemon.SRIOV.SubnetVLANs = map[string]int{"subnet-vlan": 120}
+		return &Daemon{
+			config:    cfg,
+			sriov:     newSRIOVPool([]*sriovVF{{pf: "pf0", index: 0, pciAddr: "0000:3b:02.0"}}),
+			vfPlumber: plumber,
+		}, plumber
+	}
+	newInstance := func(id, subnetID string) *vm.VM {
+		return &vm.VM{ID: id, ENIId: "eni-" + id, ENIMac: "02:00:00:11:22:33",
+			Instance: &ec2.Instance{SubnetId: aws.String(subnetID)}}
+	}
+
+	t.Run("dedicated bandwidth in a mapped subnet", func(t *testing.T) {
+		d, plumber := newDaemon()
+		instance := newInstance("i-a", "subnet-vlan")
+		usesVF, err := d.setupPrimaryVF(instance, large)
+		require.NoError(t, err)
+		assert.True(t, usesVF)
+		assert.Equal(t, "0000:3b:02.0", instance.SRIOVVF)
+		assert.Equal(t, []mockVFSetupCall{{PCIAddr: "0000:3b:02.0", MAC: "02:00:00:11:22:33", VLAN: 120}}, plumber.SetupCalls)
+		require.Len(t, instance.Config.Devices, 1)
+		assert.Equal(t, "vfio-pci,host=0000:3b:02.0,id=nic-eni-i-a", instance.Config.Devices[0].Value)
+
+		// The only VF is taken, so the next instance gets a tap.
+		usesVF, err = d.setupPrimaryVF(newInstance("i-b", "subnet-vlan"), large)
+		require.NoError(t, err)
+		assert.False(t, usesVF)
+
+		d.releasePrimaryVF(instance)
+		assert.Empty(t, instance.SRIOVVF)
+		assert.Equal(t, []string{"0000:3b:02.0"}, plumber.CleanupCalls)
+		assert.NotNil(t, d.sriov.allocate("eni-i-b"))
+	})
+
+	t.Run("falls back to a tap", func(t *testing.T) {
+		d, plumber := newDaemon()
+
+		usesVF, err := d.setupPrimaryVF(newInstance("i-a", "subnet-vlan"), small)
+		require.NoError(t, err)
+		assert.False(t, usesVF, "shared bandwidth types use taps")
+
+		usesVF, err = d.setupPrimaryVF(newInstance("i-a", "subnet-overlay"), large)
+		require.NoError(t, err)
+		assert.False(t, usesVF, "subnets without a VLAN stay on the overlay")
+
+		instance := newInstance("i-a", "subnet-vlan")
+		instance.Instance.MetadataOptions = &ec2.InstanceMetadataOptionsResponse{
+			HttpEndpoint: aws.String(ec2.InstanceMetadataEndpointStateDisabled)}
+		usesVF, err = d.setupPrimaryVF(instance, large)
+		require.NoError(t, err)
+		assert.False(t, usesVF, "the metadata firewall needs a tap")
+
+		assert.Empty(t, plumber.SetupCalls)
+	})
+
+	t.Run("setup failure releases the VF", func(t *testing.T) {
+		d, plumber := newDaemon()
+		plumber.SetupErr = errors.New("RTNETLINK answers: Operation not supported")
+		instance := newInstance("i-a", "subnet-vlan")
+		_, err := d.setupPrimaryVF(instance, large)
+		assert.ErrorContains(t, err, "setup SR-IOV VF")
+		assert.Empty(t, instance.SRIOVVF)
+		assert.NotNil(t, d.sriov.allocate("eni-i-b"))
+	})
+
+	t.Run("no SR-IOV configured", func(t *testing.T) {
+		d := &Daemon{config: &config.Config{}}
+		usesVF, err := d.setupPrimaryVF(newInstance("i-a", "subnet-vlan"), large)
+		require.NoError(t, err)
+		assert.False(t, usesVF)
+	})
+}
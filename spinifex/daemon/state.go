@@ -4,11 +4,14 @@ import (
 	"fmt"
 	"log/slog"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/mulgadc/spinifex/spinifex/vm"
 )
 
 // TransitionState validates and applies a state transition on the given instance.
-// It sets instance.Status, persists via WriteState, and logs.
+// It sets instance.Status, persists via WriteState, logs, and publishes an
+// instance state-change event.
 // On validation failure, the instance status is unchanged and an error is returned.
 // If WriteState fails, the in-memory status retains the new value (the VM has
 // physically changed state regardless) and an error is returned.
@@ -21,10 +24,31 @@ func (d *Daemon) TransitionState(instance *vm.VM, target vm.InstanceState) error
 		return fmt.Errorf("invalid state transition: %s -> %s for instance %s", current, target, instance.ID)
 	}
 	instance.Status = target
+	switch target {
+	case vm.StateRunning:
+		// Running again supersedes the reason for the last stop.
+		clearStateReason(instance)
+	case vm.StateTerminated:
+		instance.TerminatedAt = utils.Now()
+	}
+	accountID := instance.AccountID
+	var reason string
+	if instance.Instance != nil && instance.Instance.StateReason != nil {
+		reason = aws.StringValue(instance.Instance.StateReason.Code)
+	}
 	d.Instances.Mu.Unlock()
 
 	slog.Info("Instance state transition", "instanceId", instance.ID, "from", string(current), "to", string(target))
 
+	switch target {
+	case vm.StateRunning:
+		d.registerDNS(instance)
+	case vm.StateTerminated:
+		d.runPostTerminateHooks(instance)
+	}
+
+	d.publishStateChange(instance, accountID, current, target, reason)
+
 	if err := d.WriteState(); err != nil {
 		slog.Error("Failed to persist state after transition", "instanceId", instance.ID,
 			"from", string(current), "to", string(target), "err", err)
@@ -0,0 +1,150 @@
+package daemon
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/backup"
+	"github.com/mulgadc/spinifex/spinifex/objectstore"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+)
+
+// stateBackupPrefix is where exports go in the Predastore bucket when the
+// request names no key.
+const stateBackupPrefix = "backups/state/"
+
+// StateExportRequest asks for the cluster state to be exported to Key in the
+// Predastore bucket, or to a timestamped key under backups/state/.
+type StateExportRequest struct {
+	Key string `json:"key,omitempty"`
+}
+
+// StateImportRequest asks for the archive at Key in the Predastore bucket to
+// be restored. Replace restores over state the cluster already holds.
+type StateImportRequest struct {
+	Key     string `json:"key"`
+	Replace bool   `json:"replace,omitempty"`
+}
+
+// StateBackupResponse reports where an archive is and what it holds.
+type StateBackupResponse struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+	backup.Summary
+}
+
+// handleStateExport exports the cluster state to an archive in the
+// Predastore bucket.
+func (d *Daemon) handleStateExport(msg *nats.Msg) {
+	var req StateExportRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		respondWithError(msg, awserrors.ErrorValidationError)
+		return
+	}
+	if d.jsManager == nil || d.objectStore == nil {
+		slog.Error("handleStateExport: JetStream or object store not available")
+		respondWithError(msg, awserrors.ErrorServerInternal)
+		return
+	}
+	if req.Key == "" {
+		req.Key = stateBackupPrefix + utils.Now().UTC().Format("20060102T150405Z") + ".json"
+	}
+
+	archive, err := backup.Export(d.jsManager.js, d.objectStore, d.config.Predastore.Bucket)
+	if err != nil {
+		slog.Error("handleStateExport: export failed", "err", err)
+		respondWithError(msg, awserrors.ErrorServerInternal)
+		return
+	}
+	var buf bytes.Buffer
+	if err := archive.Write(&buf); err != nil {
+		respondWithError(msg, awserrors.ErrorServerInternal)
+		return
+	}
+	if _, err := d.objectStore.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(d.config.Predastore.Bucket),
+		Key:         aws.String(req.Key),
+		Body:        bytes.NewReader(buf.Bytes()),
+		ContentType: aws.String("application/json"),
+	}); err != nil {
+		slog.Error("handleStateExport: failed to store archive", "key", req.Key, "err", err)
+		respondWithError(msg, awserrors.ErrorServerInternal)
+		return
+	}
+
+	summary := archive.Summary()
+	slog.Info("Exported cluster state", "key", req.Key, "buckets", summary.Buckets, "entries", summary.Entries, "objects", summary.Objects)
+	respondWithJSON(msg, StateBackupResponse{Bucket: d.config.Predastore.Bucket, Key: req.Key, Summary: summary})
+}
+
+// handleStateImport restores the cluster state from an archive in the
+// Predastore bucket. The services hold state in memory, so they must be
+// restarted to pick up what was restored.
+func (d *Daemon) handleStateImport(msg *nats.Msg) {
+	var req StateImportRequest
+	if err := json.Unmarshal(msg.Data, &req); err != nil {
+		respondWithError(msg, awserrors.ErrorValidationError)
+		return
+	}
+	if req.Key == "" {
+		respondWithError(msg, awserrors.ErrorMissingParameter)
+		return
+	}
+	if d.jsManager == nil || d.objectStore == nil {
+		slog.Error("handleStateImport: JetStream or object store not available")
+		respondWithError(msg, awserrors.ErrorServerInternal)
+		return
+	}
+
+	out, err := d.objectStore.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(d.config.Predastore.Bucket),
+		Key:    aws.String(req.Key),
+	})
+	if err != nil {
+		if objectstore.IsNoSuchKeyError(err) {
+			respondWithServiceError(msg, awserrors.WithDetail(awserrors.ErrorInvalidParameterValue, "no archive at "+req.Key))
+			return
+		}
+		slog.Error("handleStateImport: failed to read archive", "key", req.Key, "err", err)
+		respondWithError(msg, awserrors.ErrorServerInternal)
+		return
+	}
+	data, err := io.ReadAll(out.Body)
+	_ = out.Body.Close()
+	if err != nil {
+		respondWithError(msg, awserrors.ErrorServerInternal)
+		return
+	}
+
+	archive, err := backup.Read(bytes.NewReader(data))
+	if err != nil {
+		respondWithServiceError(msg, awserrors.WithDetail(awserrors.ErrorInvalidParameterValue, err.Error()))
+		return
+	}
+	summary, err := backup.Import(d.jsManager.js, d.objectStore, d.config.Predastore.Bucket, archive, backup.ImportOptions{
+		Replicas: len(d.clusterConfig.Nodes),
+		Replace:  req.Replace,
+	})
+	if errors.Is(err, backup.ErrRefused) {
+		slog.Warn("handleStateImport: import refused", "key", req.Key, "err", err)
+		respondWithServiceError(msg, awserrors.WithDetail(awserrors.ErrorInvalidParameterValue, err.Error()))
+		return
+	}
+	if err != nil {
+		slog.Error("handleStateImport: import failed part way", "key", req.Key, "err", err)
+		respondWithServiceError(msg, awserrors.WithDetail(awserrors.ErrorServerInternal, err.Error()))
+		return
+	}
+
+	slog.Warn("Imported cluster state, restart the services to load it", "key", req.Key, "created", archive.Created.Format(time.RFC3339),
+		"buckets", summary.Buckets, "entries", summary.Entries, "objects", summary.Objects)
+	respondWithJSON(msg, StateBackupResponse{Bucket: d.config.Predastore.Bucket, Key: req.Key, Summary: summary})
+}
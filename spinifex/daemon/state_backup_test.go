@@ -0,0 +1,99 @@
+package daemon
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/config"
+	"github.com/mulgadc/spinifex/spinifex/objectstore"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/testutil"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newStateBackupTestDaemon starts a daemon on its own JetStream server,
+// serving the state endpoints, with store as its Predastore.
+func newStateBackupTestDaemon(t *testing.T, store objectstore.ObjectStore) *Daemon {
+	t.Helper()
+	_, nc, _ := testutil.StartTestJetStream(t)
+	jsm, err := NewJetStreamManager(nc, 1)
+	require.NoError(t, err)
+	require.NoError(t, jsm.InitKVBucket())
+	require.NoError(t, jsm.InitClusterStateBucket())
+
+	d := &Daemon{
+		node:          "node1",
+		natsConn:      nc,
+		jsManager:     jsm,
+		objectStore:   store,
+		config:        &config.Config{Predastore: config.PredastoreConfig{Bucket: "spinifex"}},
+		clusterConfig: &config.ClusterConfig{Nodes: map[string]config.Config{"node1": {}}},
+	}
+	for subject, handler := range map[string]nats.MsgHandler{
+		subjects.StateExport: d.handleStateExport,
+		subjects.StateImport: d.handleStateImport,
+	} {
+		sub, err := nc.QueueSubscribe(subject, "spinifex-workers", handler)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = sub.Unsubscribe() })
+	}
+	return d
+}
+
+func stateRequest(t *testing.T, d *Daemon, subject string, req any) awserrors.Reply {
+	t.Helper()
+	data, err := json.Marshal(req)
+	require.NoError(t, err)
+	reply, err := d.natsConn.Request(subject, data, 5*time.Second)
+	require.NoError(t, err)
+	return utils.DecodeReply(reply)
+}
+
+func TestStateExportImport(t *testing.T) {
+	// Predastore outlives the cluster, as when it is restored first
+	store := objectstore.NewMemoryObjectStore()
+
+	src := newStateBackupTestDaemon(t, store)
+	require.NoError(t, src.jsManager.WriteState("node1", &vm.Instances{VMS: map[string]*vm.VM{
+		"i-0123": {ID: "i-0123", Status: vm.StateRunning, AccountID: testAccountID},
+	}}))
+	require.NoError(t, src.jsManager.WriteShutdownMarker("node1"))
+
+	var exported StateBackupResponse
+	require.NoError(t, stateRequest(t, src, subjects.StateExport, StateExportRequest{}).Decode(&exported))
+	assert.Equal(t, "spinifex", exported.Bucket)
+	assert.Regexp(t, `^backups/state/\d{8}T\d{6}Z\.json$`, exported.Key)
+	assert.Equal(t, 1, exported.Buckets, "cluster state is not exported")
+	assert.Equal(t, 1, exported.Entries)
+
+	dst := newStateBackupTestDaemon(t, store)
+	var imported StateBackupResponse
+	require.NoError(t, stateRequest(t, dst, subjects.StateImport, StateImportRequest{Key: exported.Key}).Decode(&imported))
+	assert.Equal(t, exported.Summary, imported.Summary)
+
+	state, err := dst.jsManager.LoadState("node1")
+	require.NoError(t, err)
+	require.Contains(t, state.VMS, "i-0123")
+	assert.Equal(t, vm.StateRunning, state.VMS["i-0123"].Status)
+
+	// Restoring again would overwrite state, so needs Replace
+	replyErr := stateRequest(t, dst, subjects.StateImport, StateImportRequest{Key: exported.Key}).Err
+	require.NotNil(t, replyErr)
+	assert.Equal(t, awserrors.ErrorInvalidParameterValue, replyErr.Code)
+	assert.Contains(t, replyErr.Message, "already holds state")
+	assert.Nil(t, stateRequest(t, dst, subjects.StateImport, StateImportRequest{Key: exported.Key, Replace: true}).Err)
+
+	replyErr = stateRequest(t, dst, subjects.StateImport, StateImportRequest{Key: "backups/state/missing.json"}).Err
+	require.NotNil(t, replyErr)
+	assert.Equal(t, awserrors.ErrorInvalidParameterValue, replyErr.Code)
+
+	replyErr = stateRequest(t, dst, subjects.StateImport, StateImportRequest{}).Err
+	require.NotNil(t, replyErr)
+	assert.Equal(t, awserrors.ErrorMissingParameter, replyErr.Code)
+}
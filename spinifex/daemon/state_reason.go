@@ -0,0 +1,48 @@
+package daemon
+
+import (
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+)
+
+// State reason codes, as AWS reports them in an instance's StateReason.
+// Client.* codes mean the user or the guest asked for the state change;
+// Server.* codes mean the platform made it.
+const (
+	stateReasonUserInitiatedShutdown     = "Client.UserInitiatedShutdown"
+	stateReasonInstanceInitiatedShutdown = "Client.InstanceInitiatedShutdown"
+	stateReasonScheduledStop             = "Server.ScheduledStop"
+	stateReasonSpotTermination           = "Server.SpotInstanceTermination"
+	stateReasonInsufficientCapacity      = "Server.InsufficientInstanceCapacity"
+	stateReasonInternalError             = "Server.InternalError"
+)
+
+// setStateReason records why the instance is changing state, as its
+// StateReason and the timestamped StateTransitionReason DescribeInstances
+// returns, e.g. "Server.ScheduledStop (2026-10-16 12:00:00 GMT)". The caller
+// must hold d.Instances.Mu.
+func (d *Daemon) setStateReason(instance *vm.VM, code, message string) {
+	if instance.Instance == nil {
+		return
+	}
+	instance.Instance.StateReason = &ec2.StateReason{}
+	instance.Instance.StateReason.SetCode(code)
+	instance.Instance.StateReason.SetMessage(message)
+
+	transition := code
+	if code == stateReasonUserInitiatedShutdown {
+		transition = "User initiated"
+	}
+	instance.Instance.SetStateTransitionReason(transition + " (" + utils.Now().UTC().Format("2006-01-02 15:04:05") + " GMT)")
+}
+
+// clearStateReason drops the reason for the instance's last state change.
+// The caller must hold d.Instances.Mu.
+func clearStateReason(instance *vm.VM) {
+	if instance.Instance == nil {
+		return
+	}
+	instance.Instance.StateReason = nil
+	instance.Instance.StateTransitionReason = nil
+}
@@ -8,10 +8,12 @@ import (
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/mulgadc/spinifex/spinifex/config"
 	"github.com/mulgadc/spinifex/spinifex/testutil"
 	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/mulgadc/spinifex/spinifex/vm"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -600,7 +602,7 @@ func TestTransitionState_MultipleInstancesIndependent(t *testing.T) {
 func simulateCleanRestore(t *testing.T, daemon *Daemon) {
 	t.Helper()
 	require.NoError(t, daemon.jsManager.WriteShutdownMarker(daemon.node))
-	daemon.restoreInstances()
+	require.NoError(t, daemon.restoreInstances())
 }
 
 // TestRestoreInstances_StoppingFinalizedToStopped verifies that an instance
@@ -746,7 +748,7 @@ func TestRestoreInstances_RunningResetsLaunchTime(t *testing.T) {
 	require.NoError(t, daemon.WriteState())
 
 	daemon.Instances.VMS = make(map[string]*vm.VM)
-	before := time.Now()
+	before := time.Now().Truncate(time.Millisecond) // API timestamps carry millisecond precision
 	simulateCleanRestore(t, daemon)
 
 	instance, ok := daemon.Instances.VMS["i-stale-launch"]
@@ -1001,9 +1003,11 @@ func TestRestoreInstances_UnknownTypeMigratedToStoppedWithReason(t *testing.T) {
 // detects instances stuck in pending beyond the timeout and marks them failed.
 func TestPendingWatchdog_MarksStuckInstanceFailed(t *testing.T) {
 	daemon := createDaemonWithJetStream(t)
+	clock := testutil.NewFakeClock(time.Date(2026, 3, 4, 5, 0, 0, 0, time.UTC))
+	t.Cleanup(utils.SetClock(clock))
 
-	staleTime := time.Now().Add(-6 * time.Minute)
-	recentTime := time.Now()
+	staleTime := clock.Now()
+	recentTime := clock.Now().Add(2 * time.Minute)
 
 	daemon.Instances.VMS["i-stuck"] = &vm.VM{
 		ID:     "i-stuck",
@@ -1020,18 +1024,14 @@ func TestPendingWatchdog_MarksStuckInstanceFailed(t *testing.T) {
 		},
 	}
 
-	// Run one watchdog tick manually instead of waiting for the ticker
-	daemon.Instances.Mu.Lock()
-	var stuck []*vm.VM
-	for _, instance := range daemon.Instances.VMS {
-		if (instance.Status == vm.StatePending || instance.Status == vm.StateProvisioning) &&
-			instance.Instance != nil && instance.Instance.LaunchTime != nil &&
-			time.Since(*instance.Instance.LaunchTime) > 5*time.Minute {
-			stuck = append(stuck, instance)
-		}
-	}
-	daemon.Instances.Mu.Unlock()
+	// Nothing is stuck until the timeout has passed.
+	clock.Advance(pendingWatchdogTimeout)
+	assert.Empty(t, daemon.stuckPendingInstances(utils.Now()))
 
+	// Run one watchdog tick manually instead of waiting for the ticker
+	clock.Advance(time.Minute)
+	stuck := daemon.stuckPendingInstances(utils.Now())
+	require.Len(t, stuck, 1)
 	for _, instance := range stuck {
 		daemon.markInstanceFailed(instance, "launch_timeout")
 	}
@@ -1177,7 +1177,7 @@ func TestRestoreInstances_ProvisioningInstanceLaunchTimeReset(t *testing.T) {
 	require.NoError(t, daemon.WriteState())
 
 	daemon.Instances.VMS = make(map[string]*vm.VM)
-	before := time.Now()
+	before := time.Now().Truncate(time.Millisecond) // API timestamps carry millisecond precision
 	simulateCleanRestore(t, daemon)
 
 	// LoadState inside restoreInstances creates fresh objects, so look up
@@ -1196,3 +1196,83 @@ func TestRestoreInstances_ProvisioningInstanceLaunchTimeReset(t *testing.T) {
 	assert.True(t, instance.Instance.LaunchTime.After(before) || instance.Instance.LaunchTime.Equal(before),
 		"LaunchTime should be reset for provisioning instances, got %v", *instance.Instance.LaunchTime)
 }
+
+// persistOversubscribedState sizes the host for two instances of one type and
+// persists three running ones: i-boot-high (boot priority 10, newest),
+// i-boot-old (untagged, launched first) and i-boot-low (untagged, launched
+// after i-boot-old).
+func persistOversubscribedState(t *testing.T, daemon *Daemon) {
+	t.Helper()
+	instanceType := getTestInstanceType(t)
+	it := daemon.resourceMgr.instanceTypes[instanceType]
+	require.NotNil(t, it)
+
+	rm := daemon.resourceMgr
+	rm.hostVCPU = 2 * int(instanceTypeVCPUs(it))
+	rm.hostMemGB = 2 * float64(instanceTypeMemoryMiB(it)) / 1024.0
+	rm.reservedVCPU, rm.reservedMem = 0, 0
+	rm.allocatedVCPU, rm.allocatedMem = 0, 0
+
+	now := time.Now()
+	running := func(id string, launched time.Time, tags ...*ec2.Tag) *vm.VM {
+		return &vm.VM{
+			ID:           id,
+			Status:       vm.StateRunning,
+			InstanceType: instanceType,
+			Instance:     &ec2.Instance{LaunchTime: &launched, Tags: tags},
+		}
+	}
+	daemon.Instances.VMS["i-boot-high"] = running("i-boot-high", now,
+		&ec2.Tag{Key: aws.String(vm.BootPriorityTag), Value: aws.String("10")})
+	daemon.Instances.VMS["i-boot-old"] = running("i-boot-old", now.Add(-2*time.Hour))
+	daemon.Instances.VMS["i-boot-low"] = running("i-boot-low", now.Add(-time.Hour))
+	require.NoError(t, daemon.WriteState())
+	daemon.Instances.VMS = make(map[string]*vm.VM)
+}
+
+// TestRestoreInstances_OversubscribedStopsLowestPriority verifies that when
+// persisted running instances exceed the host's capacity, the default policy
+// stops the lowest-priority ones and restores the rest.
+func TestRestoreInstances_OversubscribedStopsLowestPriority(t *testing.T) {
+	daemon := createDaemonWithJetStream(t)
+	persistOversubscribedState(t, daemon)
+
+	simulateCleanRestore(t, daemon)
+
+	assert.NotContains(t, daemon.Instances.VMS, "i-boot-low")
+	stopped, err := daemon.jsManager.LoadStoppedInstance("i-boot-low")
+	require.NoError(t, err)
+	require.NotNil(t, stopped, "evicted instance should be handed to shared KV")
+	assert.Equal(t, vm.StateStopped, stopped.Status)
+	require.NotNil(t, stopped.Instance.StateReason)
+	assert.Equal(t, "Server.InsufficientInstanceCapacity", *stopped.Instance.StateReason.Code)
+
+	for _, id := range []string{"i-boot-high", "i-boot-old"} {
+		kept, err := daemon.jsManager.LoadStoppedInstance(id)
+		require.NoError(t, err)
+		assert.Nil(t, kept, "%s fits and should be restored, not stopped", id)
+	}
+}
+
+// TestRestoreInstances_OversubscribedRefuse verifies that the refuse policy
+// fails the restore with a report and leaves the persisted state alone.
+func TestRestoreInstances_OversubscribedRefuse(t *testing.T) {
+	daemon := createDaemonWithJetStream(t)
+	daemon.config.Daemon.BootOversubscription = config.BootOversubscriptionRefuse
+	persistOversubscribedState(t, daemon)
+
+	require.NoError(t, daemon.jsManager.WriteShutdownMarker(daemon.node))
+	err := daemon.restoreInstances()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "host is oversubscribed")
+	assert.Contains(t, err.Error(), "1 instance(s) don't fit: i-boot-low")
+
+	for _, id := range []string{"i-boot-high", "i-boot-old", "i-boot-low"} {
+		require.Contains(t, daemon.Instances.VMS, id)
+		assert.Equal(t, vm.StateRunning, daemon.Instances.VMS[id].Status)
+	}
+	stopped, err := daemon.jsManager.LoadStoppedInstance("i-boot-low")
+	require.NoError(t, err)
+	assert.Nil(t, stopped)
+	assert.Zero(t, daemon.resourceMgr.allocatedVCPU)
+}
@@ -0,0 +1,154 @@
+package daemon
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"strconv"
+
+	"github.com/mulgadc/spinifex/spinifex/config"
+	handlers_iam "github.com/mulgadc/spinifex/spinifex/handlers/iam"
+	"github.com/mulgadc/spinifex/spinifex/kms"
+	"github.com/mulgadc/spinifex/spinifex/qmp"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+)
+
+// openKMSStore opens the cluster's KMS key store, importing any keys this
+// node kept in its key directory under earlier releases. Without the
+// cluster master key the node runs without one, and refuses encrypted
+// volumes.
+func (d *Daemon) openKMSStore() *kms.Store {
+	masterKey, err := handlers_iam.LoadMasterKey(d.config.MasterKeyPath())
+	if err != nil {
+		slog.Warn("No cluster master key, encrypted volumes are unavailable on this node", "err", err)
+		return nil
+	}
+	js, err := d.natsConn.JetStream()
+	if err != nil {
+		slog.Warn("Failed to get JetStream context for the KMS key store", "err", err)
+		return nil
+	}
+	keys, err := kms.OpenStore(js, masterKey)
+	if err != nil {
+		slog.Warn("Failed to open the KMS key store, encrypted volumes are unavailable on this node", "err", err)
+		return nil
+	}
+	if err := keys.ImportDir(d.config.KMSDir()); err != nil {
+		slog.Warn("Failed to import this node's KMS keys into the cluster key store", "dir", d.config.KMSDir(), "err", err)
+	}
+	return keys
+}
+
+// luksHeaderReserve is the space at the start of an encrypted volume set
+// aside for the LUKS header and key slots. The guest sees the rest.
+const luksHeaderReserve = 16 << 20
+
+// formatLUKS writes a LUKS header for an AES-XTS payload of payloadBytes to
+// target, unlocked by secret. A variable so tests can stand in for qemu-img.
+var formatLUKS = func(target string, secret vm.Secret, payloadBytes int64) error {
+	files, objects, err := vm.SecretPipes([]vm.Secret{secret})
+	if err != nil {
+		return err
+	}
+	defer vm.CloseFiles(files)
+
+	cmd := exec.Command("qemu-img", "create", "-f", "luks",
+		"--object", objects[0],
+		"-o", "key-secret="+secret.ID+",cipher-alg=aes-256,cipher-mode=xts",
+		target, strconv.FormatInt(payloadBytes, 10))
+	cmd.ExtraFiles = files
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("qemu-img create: %w: %s", err, out)
+	}
+	return nil
+}
+
+// volumeSecretID names the QEMU secret object unlocking a volume.
+func volumeSecretID(volumeID string) string {
+	return "sec-" + volumeID
+}
+
+// volumeTarget is a volume as QEMU tools address it: its local file, or the
+// NBD export it is mounted on.
+func (d *Daemon) volumeTarget(req types.EBSRequest) string {
+	if req.Backend == config.VolumeBackendLocal {
+		return d.config.LocalVolumePath(req.Name)
+	}
+	return req.NBDURI
+}
+
+// volumeSecret unwraps an encrypted volume's data key into the QEMU secret
+// that opens it. A volume attached for the first time has no LUKS header
+// yet, so it is formatted through target first. Nothing has been written to
+// it before then, which makes formatting again after a failed attempt safe.
+func (d *Daemon) volumeSecret(volumeID, target string) (vm.Secret, error) {
+	key, formatted, err := d.volumeService.VolumeDataKey(volumeID)
+	if err != nil {
+		return vm.Secret{}, fmt.Errorf("unwrap data key: %w", err)
+	}
+	secret := vm.Secret{ID: volumeSecretID(volumeID), Data: base64.StdEncoding.EncodeToString(key)}
+	if formatted {
+		return secret, nil
+	}
+
+	volCfg, err := d.volumeService.GetVolumeConfig(volumeID)
+	if err != nil {
+		return vm.Secret{}, fmt.Errorf("get volume config: %w", err)
+	}
+	payload := utils.SafeUint64ToInt64(volCfg.VolumeMetadata.SizeGiB)<<30 - luksHeaderReserve
+	slog.Info("Formatting encrypted volume", "volumeId", volumeID, "payloadBytes", payload)
+	if err := formatLUKS(target, secret, payload); err != nil {
+		return vm.Secret{}, err
+	}
+	if err := d.volumeService.MarkVolumeFormatted(volumeID); err != nil {
+		return vm.Secret{}, fmt.Errorf("mark volume formatted: %w", err)
+	}
+	return secret, nil
+}
+
+// luksBlockdevArgs layers a LUKS node over a volume's blockdev-add
+// arguments. The LUKS node takes over the node name, so the guest device
+// and throttle group attach to the decrypted view.
+func luksBlockdevArgs(args map[string]any, secretID string) map[string]any {
+	inner := make(map[string]any, len(args))
+	for k, v := range args {
+		if k != "node-name" {
+			inner[k] = v
+		}
+	}
+	return map[string]any{
+		"driver":     "luks",
+		"node-name":  args["node-name"],
+		"key-secret": secretID,
+		"file":       inner,
+	}
+}
+
+// addVolumeSecret defines a volume's secret in a running QEMU.
+func (d *Daemon) addVolumeSecret(instance *vm.VM, secret vm.Secret) error {
+	_, err := d.SendQMPCommand(instance.QMPClient, qmp.QMPCommand{
+		Execute: "object-add",
+		Arguments: map[string]any{
+			"qom-type": "secret",
+			"id":       secret.ID,
+			"data":     secret.Data,
+			"format":   "base64",
+		},
+	}, instance.ID)
+	return err
+}
+
+// removeVolumeSecret drops a volume's secret from a running QEMU once its
+// block node is gone. Failures only leave an unused object behind.
+func (d *Daemon) removeVolumeSecret(instance *vm.VM, volumeID string) {
+	_, err := d.SendQMPCommand(instance.QMPClient, qmp.QMPCommand{
+		Execute:   "object-del",
+		Arguments: map[string]any{"id": volumeSecretID(volumeID)},
+	}, instance.ID)
+	if err != nil {
+		slog.Warn("QMP object-del secret failed (non-fatal)", "volumeId", volumeID, "err", err)
+	}
+}
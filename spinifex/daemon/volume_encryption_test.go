@@ -0,0 +1,114 @@
+package daemon
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	handlers_ec2_volume "github.com/mulgadc/spinifex/spinifex/handlers/ec2/volume"
+	"github.com/mulgadc/spinifex/spinifex/kms"
+	"github.com/mulgadc/spinifex/spinifex/testutil"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/mulgadc/viperblock/viperblock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLuksBlockdevArgs(t *testing.T) {
+	args := map[string]any{
+		"node-name": "nbd-vol-enc",
+		"driver":    "nbd",
+		"server":    map[string]any{"type": "unix", "path": "/run/vol-enc.sock"},
+	}
+
+	got := luksBlockdevArgs(args, "sec-vol-enc")
+	assert.Equal(t, map[string]any{
+		"driver":     "luks",
+		"node-name":  "nbd-vol-enc",
+		"key-secret": "sec-vol-enc",
+		"file": map[string]any{
+			"driver": "nbd",
+			"server": map[string]any{"type": "unix", "path": "/run/vol-enc.sock"},
+		},
+	}, got)
+	assert.Equal(t, "nbd-vol-enc", args["node-name"], "the backend arguments are left as they were")
+}
+
+func TestBuildDrives_Encrypted(t *testing.T) {
+	requests := []types.EBSRequest{
+		{Name: "vol-boot", NBDURI: "nbd:unix:/tmp/boot.sock", Boot: true},
+		{Name: "vol-enc", NBDURI: "nbd:unix:/tmp/enc.sock", Encrypted: true},
+	}
+
+	drives, _, _, err := buildDrives(requests, 2, nil)
+	require.NoError(t, err)
+
+	require.Len(t, drives, 2)
+	assert.Equal(t, "raw", drives[0].Format)
+	assert.Empty(t, drives[0].KeySecret)
+	assert.Equal(t, "luks", drives[1].Format)
+	assert.Equal(t, "sec-vol-enc", drives[1].KeySecret)
+}
+
+func TestVolumeSecret(t *testing.T) {
+	d, store := createFullTestDaemonWithStore(t, sharedNATSURL)
+	d.volumeService = handlers_ec2_volume.NewVolumeServiceImplWithStore(d.config, store, d.natsConn)
+	_, _, js := testutil.StartTestJetStream(t)
+	keys, err := kms.OpenStore(js, bytes.Repeat([]byte{0x42}, 32))
+	require.NoError(t, err)
+	d.volumeService.SetKeyStore(keys)
+
+	keyID, err := keys.ResolveKeyID("")
+	require.NoError(t, err)
+	_, wrapped, err := keys.GenerateDataKey(keyID)
+	require.NoError(t, err)
+	putJSON := func(key string, v any) {
+		t.Helper()
+		data, err := json.Marshal(v)
+		require.NoError(t, err)
+		_, err = store.PutObject(&s3.PutObjectInput{
+			Bucket: aws.String(d.config.Predastore.Bucket),
+			Key:    aws.String(key),
+			Body:   bytes.NewReader(data),
+		})
+		require.NoError(t, err)
+	}
+	putJSON("vol-enc/config.json", viperblock.VBState{VolumeConfig: viperblock.VolumeConfig{
+		VolumeMetadata: viperblock.VolumeMetadata{VolumeID: "vol-enc", SizeGiB: 2, IsEncrypted: true},
+	}})
+	putJSON(types.VolumeEncryptionKey("vol-enc"), types.VolumeEncryption{KmsKeyID: keyID, DataKey: wrapped})
+
+	type formatCall struct {
+		target  string
+		secret  vm.Secret
+		payload int64
+	}
+	var calls []formatCall
+	orig := formatLUKS
+	formatLUKS = func(target string, secret vm.Secret, payloadBytes int64) error {
+		calls = append(calls, formatCall{target, secret, payloadBytes})
+		return nil
+	}
+	t.Cleanup(func() { formatLUKS = orig })
+
+	secret, err := d.volumeSecret("vol-enc", "nbd:unix:/run/enc.sock")
+	require.NoError(t, err)
+	assert.Equal(t, "sec-vol-enc", secret.ID)
+	key, err := base64.StdEncoding.DecodeString(secret.Data)
+	require.NoError(t, err)
+	assert.Len(t, key, 32)
+
+	// The first attach formats the volume, leaving the header's share of it
+	// out of what the guest sees.
+	require.Len(t, calls, 1)
+	assert.Equal(t, formatCall{"nbd:unix:/run/enc.sock", secret, 2<<30 - luksHeaderReserve}, calls[0])
+
+	again, err := d.volumeSecret("vol-enc", "nbd:unix:/run/enc.sock")
+	require.NoError(t, err)
+	assert.Equal(t, secret, again)
+	assert.Len(t, calls, 1, "a formatted volume is not formatted again")
+}
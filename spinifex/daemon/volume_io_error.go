@@ -0,0 +1,91 @@
+package daemon
+
+import (
+	"log/slog"
+	"strings"
+
+	handlers_ec2_volume "github.com/mulgadc/spinifex/spinifex/handlers/ec2/volume"
+	"github.com/mulgadc/spinifex/spinifex/qmp"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+)
+
+// handleBlockIOErrorEvent handles a QEMU BLOCK_IO_ERROR event. It marks the
+// affected volume as errored, which DescribeVolumeStatus reports as impaired.
+// It then applies the node's AutoEnableIO policy:
+//   - enabled: resume a guest that QEMU paused, so the failed request is retried;
+//   - disabled: pause the guest so it cannot keep writing to a failing disk.
+func (d *Daemon) handleBlockIOErrorEvent(instanceID string, data map[string]any) {
+	device, _ := data["device"].(string)
+	nodeName, _ := data["node-name"].(string)
+	qemuAction, _ := data["action"].(string)
+	reason, _ := data["reason"].(string)
+
+	instance, ok := d.Instances.GetVM(instanceID)
+	if !ok {
+		slog.Warn("Block I/O error for unknown instance", "instance", instanceID, "device", device, "nodeName", nodeName)
+		return
+	}
+
+	ebsReq, found := blockIOErrorVolume(instance, device, nodeName)
+	if !found {
+		slog.Warn("Block I/O error on untracked device", "instance", instanceID, "device", device, "nodeName", nodeName, "reason", reason)
+		return
+	}
+	volumeID := ebsReq.Name
+	slog.Error("Volume I/O error", "instance", instanceID, "volumeId", volumeID, "qemuAction", qemuAction, "reason", reason)
+
+	// QEMU rate-limits this event but still repeats it; only the first
+	// error writes the volume state.
+	if cfg, err := d.volumeService.GetVolumeConfig(volumeID); err != nil {
+		slog.Error("Failed to read volume config after I/O error", "volumeId", volumeID, "err", err)
+	} else if cfg.VolumeMetadata.State != handlers_ec2_volume.VolumeStateError {
+		if err := d.volumeService.UpdateVolumeState(volumeID, handlers_ec2_volume.VolumeStateError, instanceID, cfg.VolumeMetadata.DeviceName); err != nil {
+			slog.Error("Failed to mark volume errored", "volumeId", volumeID, "err", err)
+		}
+	}
+
+	// QEMU's own action already paused the guest ("stop") or let it continue
+	// ("report"/"ignore"); only send a command when the policy differs.
+	var cmd string
+	if d.config != nil && d.config.Daemon.AutoEnableIO {
+		if qemuAction == "stop" {
+			cmd = "cont"
+		}
+	} else if qemuAction != "stop" {
+		cmd = "stop"
+	}
+	if cmd == "" {
+		return
+	}
+	if _, err := d.SendQMPCommand(instance.QMPClient, qmp.QMPCommand{Execute: cmd}, instanceID); err != nil {
+		slog.Error("Failed to apply volume I/O error policy", "instance", instanceID, "volumeId", volumeID, "command", cmd, "err", err)
+		return
+	}
+	slog.Warn("Applied volume I/O error policy", "instance", instanceID, "volumeId", volumeID, "command", cmd)
+}
+
+// blockIOErrorVolume finds the EBS volume behind a BLOCK_IO_ERROR event. Boot
+// volumes are the "os" drive; hot-attached volumes use the nbd-<volumeID>
+// node and vdisk-<volumeID> device names set by AttachVolume. Cloud-init and
+// EFI drives are not customer volumes and are ignored.
+func blockIOErrorVolume(instance *vm.VM, device, nodeName string) (types.EBSRequest, bool) {
+	volumeID := ""
+	if id, ok := strings.CutPrefix(nodeName, "nbd-"); ok {
+		volumeID = id
+	} else if id, ok := strings.CutPrefix(device, "vdisk-"); ok {
+		volumeID = id
+	}
+
+	instance.EBSRequests.Mu.Lock()
+	defer instance.EBSRequests.Mu.Unlock()
+	for _, req := range instance.EBSRequests.Requests {
+		if req.CloudInit || req.EFI {
+			continue
+		}
+		if (volumeID != "" && req.Name == volumeID) || (device == "os" && req.Boot) {
+			return req, true
+		}
+	}
+	return types.EBSRequest{}, false
+}
@@ -0,0 +1,160 @@
+package daemon
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	awss3 "github.com/aws/aws-sdk-go/service/s3"
+	"github.com/mulgadc/spinifex/spinifex/config"
+	handlers_ec2_volume "github.com/mulgadc/spinifex/spinifex/handlers/ec2/volume"
+	"github.com/mulgadc/spinifex/spinifex/objectstore"
+	"github.com/mulgadc/spinifex/spinifex/qmp"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newBlockIOErrorTestDaemon builds a daemon with one running instance that
+// has a boot volume and a hot-attached data volume, both in-use.
+func newBlockIOErrorTestDaemon(t *testing.T, autoEnableIO bool) (*Daemon, *[]string, *sync.Mutex) {
+	t.Helper()
+
+	cfg := &config.Config{
+		Predastore: config.PredastoreConfig{Bucket: "test-bucket"},
+		Daemon:     config.DaemonConfig{AutoEnableIO: autoEnableIO},
+	}
+	store := objectstore.NewMemoryObjectStore()
+	for _, vol := range []struct{ id, dev string }{{"vol-root", "/dev/sda1"}, {"vol-data", "/dev/sdf"}} {
+		body := `{"VolumeConfig":{"VolumeMetadata":{"VolumeID":"` + vol.id + `","SizeGiB":10,"State":"in-use","AttachedInstance":"i-ioerr","DeviceName":"` + vol.dev + `"}}}`
+		_, err := store.PutObject(&awss3.PutObjectInput{
+			Bucket: aws.String(cfg.Predastore.Bucket),
+			Key:    aws.String(vol.id + "/config.json"),
+			Body:   strings.NewReader(body),
+		})
+		require.NoError(t, err)
+	}
+
+	var mu sync.Mutex
+	var commands []string
+	qmpClient, cancel := newMockQMPClient(t, func(cmd qmp.QMPCommand) map[string]any {
+		mu.Lock()
+		commands = append(commands, cmd.Execute)
+		mu.Unlock()
+		return map[string]any{"return": map[string]any{}}
+	})
+	t.Cleanup(cancel)
+
+	d := &Daemon{
+		config:        cfg,
+		volumeService: handlers_ec2_volume.NewVolumeServiceImplWithStore(cfg, store, nil),
+	}
+	d.Instances.VMS = map[string]*vm.VM{
+		"i-ioerr": {
+			ID:        "i-ioerr",
+			Status:    vm.StateRunning,
+			QMPClient: qmpClient,
+			EBSRequests: types.EBSRequests{Requests: []types.EBSRequest{
+				{Name: "vol-root", Boot: true, DeviceName: "/dev/sda1"},
+				{Name: "cloud-init", CloudInit: true},
+				{Name: "vol-data", DeviceName: "/dev/sdf"},
+			}},
+		},
+	}
+	return d, &commands, &mu
+}
+
+func volumeState(t *testing.T, d *Daemon, volumeID string) string {
+	t.Helper()
+	cfg, err := d.volumeService.GetVolumeConfig(volumeID)
+	require.NoError(t, err)
+	return cfg.VolumeMetadata.State
+}
+
+func TestHandleBlockIOErrorEvent(t *testing.T) {
+	tests := []struct {
+		name         string
+		autoEnableIO bool
+		data         map[string]any
+		volumeID     string
+		wantCommands []string
+	}{
+		{
+			name:         "report action pauses guest",
+			data:         map[string]any{"device": "vdisk-vol-data", "node-name": "nbd-vol-data", "action": "report"},
+			volumeID:     "vol-data",
+			wantCommands: []string{"stop"},
+		},
+		{
+			name:     "stop action leaves guest paused",
+			data:     map[string]any{"device": "", "node-name": "nbd-vol-data", "action": "stop"},
+			volumeID: "vol-data",
+		},
+		{
+			name:         "auto-enable resumes stopped guest",
+			autoEnableIO: true,
+			data:         map[string]any{"device": "os", "action": "stop"},
+			volumeID:     "vol-root",
+			wantCommands: []string{"cont"},
+		},
+		{
+			name:         "auto-enable leaves running guest alone",
+			autoEnableIO: true,
+			data:         map[string]any{"device": "vdisk-vol-data", "action": "report"},
+			volumeID:     "vol-data",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, commands, mu := newBlockIOErrorTestDaemon(t, tt.autoEnableIO)
+
+			d.handleBlockIOErrorEvent("i-ioerr", tt.data)
+
+			assert.Equal(t, handlers_ec2_volume.VolumeStateError, volumeState(t, d, tt.volumeID))
+			mu.Lock()
+			assert.Equal(t, tt.wantCommands, *commands)
+			mu.Unlock()
+
+			out, err := d.volumeService.DescribeVolumeStatus(&ec2.DescribeVolumeStatusInput{
+				VolumeIds: []*string{aws.String(tt.volumeID)},
+			}, "")
+			require.NoError(t, err)
+			require.Len(t, out.VolumeStatuses, 1)
+			assert.Equal(t, "impaired", *out.VolumeStatuses[0].VolumeStatus.Status)
+		})
+	}
+}
+
+func TestHandleBlockIOErrorEvent_IgnoresUntrackedDevices(t *testing.T) {
+	d, commands, mu := newBlockIOErrorTestDaemon(t, false)
+
+	d.handleBlockIOErrorEvent("i-ioerr", map[string]any{"device": "cloudinit", "action": "report"})
+	d.handleBlockIOErrorEvent("i-missing", map[string]any{"device": "os", "action": "report"})
+
+	assert.Equal(t, "in-use", volumeState(t, d, "vol-root"))
+	assert.Equal(t, "in-use", volumeState(t, d, "vol-data"))
+	mu.Lock()
+	assert.Empty(t, *commands)
+	mu.Unlock()
+}
+
+func TestHandleQMPEvent_BlockIOError(t *testing.T) {
+	d, commands, mu := newBlockIOErrorTestDaemon(t, false)
+
+	d.handleQMPEvent("i-ioerr", map[string]any{
+		"event": "BLOCK_IO_ERROR",
+		"data":  map[string]any{"node-name": "nbd-vol-data", "action": "report", "reason": "Input/output error"},
+	})
+
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(*commands) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, handlers_ec2_volume.VolumeStateError, volumeState(t, d, "vol-data"))
+}
@@ -0,0 +1,87 @@
+package daemon
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// workerPool bounds how many messages a set of NATS subscriptions handle at
+// once. NATS delivers each subscription's messages on its own goroutine, so
+// a node subscribed to many launch subjects would otherwise run one launch
+// per subject concurrently. A message arriving while every worker is busy
+// holds up its subscription's delivery, queuing the messages behind it in
+// the client until a worker frees up.
+type workerPool struct {
+	slots    chan struct{}
+	inflight sync.WaitGroup
+	// reject answers messages delivered after drain.
+	reject nats.MsgHandler
+
+	mu      sync.RWMutex
+	closed  bool
+	closeCh chan struct{}
+}
+
+func newWorkerPool(size int, reject nats.MsgHandler) *workerPool {
+	return &workerPool{
+		slots:   make(chan struct{}, size),
+		reject:  reject,
+		closeCh: make(chan struct{}),
+	}
+}
+
+// handler wraps h so each message runs on a pool worker.
+func (p *workerPool) handler(h nats.MsgHandler) nats.MsgHandler {
+	return func(msg *nats.Msg) {
+		select {
+		case p.slots <- struct{}{}:
+		case <-p.closeCh:
+			p.reject(msg)
+			return
+		}
+
+		p.mu.RLock()
+		if p.closed {
+			p.mu.RUnlock()
+			<-p.slots
+			p.reject(msg)
+			return
+		}
+		p.inflight.Add(1)
+		p.mu.RUnlock()
+
+		go func() {
+			defer func() {
+				<-p.slots
+				p.inflight.Done()
+			}()
+			h(msg)
+		}()
+	}
+}
+
+// drain stops the pool taking new messages, rejecting any still queued, and
+// waits up to timeout for running ones to finish. It reports whether they
+// all did.
+func (p *workerPool) drain(timeout time.Duration) bool {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.closeCh)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
@@ -0,0 +1,102 @@
+package daemon
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerPool_BoundsConcurrency(t *testing.T) {
+	nc, err := nats.Connect(sharedNATSURL)
+	require.NoError(t, err)
+	defer nc.Close()
+
+	const workers, subjects, perSubject = 3, 4, 6
+	pool := newWorkerPool(workers, func(msg *nats.Msg) { t.Error("message rejected before drain") })
+
+	var running, peak, handled atomic.Int32
+	handler := pool.handler(func(msg *nats.Msg) {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		running.Add(-1)
+		handled.Add(1)
+		_ = msg.Respond([]byte(`{}`))
+	})
+
+	// Like the per-instance-type launch subjects, each subscription gets its
+	// own delivery goroutine.
+	for i := range subjects {
+		sub, err := nc.QueueSubscribe(fmt.Sprintf("test.workerpool.%d", i), "spinifex-workers", handler)
+		require.NoError(t, err)
+		defer sub.Unsubscribe()
+	}
+
+	inbox := nats.NewInbox()
+	replies, err := nc.SubscribeSync(inbox)
+	require.NoError(t, err)
+	defer replies.Unsubscribe()
+	for i := range subjects * perSubject {
+		require.NoError(t, nc.PublishRequest(fmt.Sprintf("test.workerpool.%d", i%subjects), inbox, []byte(`{}`)))
+	}
+
+	for range subjects * perSubject {
+		_, err := replies.NextMsg(5 * time.Second)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(subjects*perSubject), handled.Load())
+	assert.Equal(t, int32(workers), peak.Load(), "a burst should keep every worker busy and no more")
+}
+
+func TestWorkerPool_DrainRejectsQueued(t *testing.T) {
+	nc, err := nats.Connect(sharedNATSURL)
+	require.NoError(t, err)
+	defer nc.Close()
+
+	started, release := make(chan struct{}), make(chan struct{})
+	pool := newWorkerPool(1, rejectLaunch)
+	sub, err := nc.Subscribe("test.workerpool.drain", pool.handler(func(msg *nats.Msg) {
+		close(started)
+		<-release
+		_ = msg.Respond([]byte(`{}`))
+	}))
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	inbox := nats.NewInbox()
+	replies, err := nc.SubscribeSync(inbox)
+	require.NoError(t, err)
+	defer replies.Unsubscribe()
+	require.NoError(t, nc.PublishRequest("test.workerpool.drain", inbox, []byte(`first`)))
+	require.NoError(t, nc.PublishRequest("test.workerpool.drain", inbox, []byte(`second`)))
+	require.NoError(t, nc.Flush())
+	<-started
+
+	// The second request waits for the only worker; draining rejects it.
+	drained := make(chan bool)
+	go func() { drained <- pool.drain(5 * time.Second) }()
+
+	msg, err := replies.NextMsg(5 * time.Second)
+	require.NoError(t, err)
+	assert.Contains(t, string(msg.Data), "InsufficientInstanceCapacity")
+	_, err = utils.ValidateErrorPayload(msg.Data)
+	assert.Error(t, err)
+
+	// Drain waits for the running request.
+	close(release)
+	assert.True(t, <-drained)
+	msg, err = replies.NextMsg(5 * time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, `{}`, string(msg.Data))
+}
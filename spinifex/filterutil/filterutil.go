@@ -75,6 +75,17 @@ func MatchesTags(filters map[string][]string, tags map[string]string) bool {
 	return true
 }
 
+// MatchesTagKey returns true if any of the resource's tag keys matches any
+// of the tag-key filter values (with wildcard support).
+func MatchesTagKey(values []string, tags map[string]string) bool {
+	for key := range tags {
+		if MatchesAny(values, key) {
+			return true
+		}
+	}
+	return false
+}
+
 // EC2TagsToMap converts []*ec2.Tag to map[string]string for MatchesTags.
 func EC2TagsToMap(tags []*ec2.Tag) map[string]string {
 	if len(tags) == 0 {
@@ -262,6 +262,22 @@ func TestMatchesTags_EmptyFilters(t *testing.T) {
 	}
 }
 
+func TestMatchesTagKey(t *testing.T) {
+	tags := map[string]string{"Name": "web", "Environment": "prod"}
+	if !MatchesTagKey([]string{"Environment"}, tags) {
+		t.Fatal("expected tag key match")
+	}
+	if !MatchesTagKey([]string{"Env*"}, tags) {
+		t.Fatal("expected wildcard tag key match")
+	}
+	if MatchesTagKey([]string{"Owner"}, tags) {
+		t.Fatal("expected no match for absent key")
+	}
+	if MatchesTagKey([]string{"Name"}, nil) {
+		t.Fatal("expected no match for untagged resource")
+	}
+}
+
 func TestEC2TagsToMap(t *testing.T) {
 	tags := []*ec2.Tag{
 		{Key: aws.String("Env"), Value: aws.String("prod")},
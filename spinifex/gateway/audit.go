@@ -0,0 +1,259 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mulgadc/spinifex/spinifex/audit"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+)
+
+const (
+	// auditBodyLimit bounds how much of a response auditMiddleware keeps to
+	// find the resources a call created and the error it failed with.
+	auditBodyLimit = 64 << 10
+	// maxAuditResources bounds the resources recorded for one call.
+	maxAuditResources = 100
+)
+
+// auditExcludedFields are ID fields of a request or response that name the
+// caller or the request rather than a resource, compared lower-cased without
+// underscores.
+var auditExcludedFields = map[string]bool{
+	"requestid":   true,
+	"ownerid":     true,
+	"requesterid": true,
+	"accountid":   true,
+}
+
+// auditWriter wraps http.ResponseWriter to capture the status code and the
+// start of the body.
+type auditWriter struct {
+	http.ResponseWriter
+
+	status int
+	body   bytes.Buffer
+}
+
+func (w *auditWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *auditWriter) Write(b []byte) (int, error) {
+	if room := auditBodyLimit - w.body.Len(); room > 0 {
+		w.body.Write(b[:min(len(b), room)])
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// auditMiddleware records each mutating call, once it has been served, to
+// gw.Audit. It runs after SigV4 auth, which puts the caller and the parsed
+// request in the context.
+func (gw *GatewayConfig) auditMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		action, _ := r.Context().Value(ctxAction).(string)
+		if action == "" {
+			action = r.URL.Query().Get("Action")
+		}
+		if !audit.IsMutating(action) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		aw := &auditWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(aw, r)
+		gw.Audit.Record(gw.auditEvent(r, action, start, aw))
+	})
+}
+
+// auditEvent builds the audit record of the call r made to action.
+func (gw *GatewayConfig) auditEvent(r *http.Request, action string, start time.Time, aw *auditWriter) *audit.Event {
+	ctx := r.Context()
+	svc, _ := ctx.Value(ctxService).(string)
+	accountID, _ := ctx.Value(ctxAccountID).(string)
+	identity, _ := ctx.Value(ctxIdentity).(string)
+	accessKey, _ := ctx.Value(ctxAccessKey).(string)
+	args, _ := ctx.Value(ctxQueryArgs).(map[string]string)
+
+	identityType := "IAMUser"
+	if roleName, _ := ctx.Value(ctxRoleName).(string); roleName != "" {
+		identityType = "AssumedRole"
+	}
+
+	event := &audit.Event{
+		EventID:         uuid.NewString(),
+		RequestID:       utils.RequestIDFromContext(ctx),
+		EventTime:       start.UTC(),
+		EventSource:     svc,
+		EventName:       action,
+		Region:          gw.Region,
+		SourceIPAddress: extractClientIP(r),
+		UserAgent:       r.UserAgent(),
+		UserIdentity: audit.UserIdentity{
+			Type:        identityType,
+			AccountID:   accountID,
+			UserName:    identity,
+			AccessKeyID: accessKey,
+		},
+		RequestParameters: audit.RequestParameters(args),
+	}
+
+	resources := requestResources(args)
+	if aw.status >= http.StatusBadRequest {
+		event.ErrorCode = responseErrorCode(aw.body.Bytes())
+	} else {
+		resources = append(resources, responseResources(aw.body.Bytes())...)
+	}
+	event.Resources = dedupeResources(resources)
+	return event
+}
+
+// isResourceField reports whether a request parameter or response field
+// named name holds a resource ID or ARN, e.g. "InstanceId", "volumeId",
+// "PolicyArn" or "snapshot_id".
+func isResourceField(name string) bool {
+	if auditExcludedFields[strings.ToLower(strings.ReplaceAll(name, "_", ""))] {
+		return false
+	}
+	for _, suffix := range []string{"Id", "ID", "_id", "Arn", "ARN", "_arn"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestResources returns the resources a call's parameters name. List
+// parameters are numbered, e.g. "InstanceId.1", so the field is the last
+// segment that isn't an index.
+func requestResources(args map[string]string) []string {
+	var resources []string
+	for key, value := range args {
+		if value == "" {
+			continue
+		}
+		segments := strings.Split(key, ".")
+		field := segments[len(segments)-1]
+		for i := len(segments) - 1; i > 0 && isIndex(field); i-- {
+			field = segments[i-1]
+		}
+		if isResourceField(field) {
+			resources = append(resources, value)
+		}
+	}
+	slices.Sort(resources)
+	return resources
+}
+
+func isIndex(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// responseResources returns the resource IDs and ARNs in a successful
+// response: the query services answer in XML, the spinifex service in JSON.
+func responseResources(body []byte) []string {
+	body = bytes.TrimSpace(body)
+	if len(body) == 0 {
+		return nil
+	}
+	if body[0] == '{' || body[0] == '[' {
+		var doc any
+		if json.Unmarshal(body, &doc) != nil {
+			return nil
+		}
+		var resources []string
+		jsonResources(doc, "", &resources)
+		return resources
+	}
+
+	var resources []string
+	var field string
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			// io.EOF, or a response cut short at auditBodyLimit.
+			return resources
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			field = t.Name.Local
+		case xml.EndElement:
+			field = ""
+		case xml.CharData:
+			if value := strings.TrimSpace(string(t)); value != "" && isResourceField(field) {
+				resources = append(resources, value)
+			}
+		}
+	}
+}
+
+func jsonResources(v any, field string, resources *[]string) {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, child := range t {
+			jsonResources(child, k, resources)
+		}
+	case []any:
+		for _, child := range t {
+			jsonResources(child, field, resources)
+		}
+	case string:
+		if t != "" && isResourceField(field) {
+			*resources = append(*resources, t)
+		}
+	}
+}
+
+// responseErrorCode returns the error code of an error response, in either
+// the EC2 or the IAM format; both carry it in a Code element.
+func responseErrorCode(body []byte) string {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return ""
+		}
+		if start, ok := tok.(xml.StartElement); ok && start.Name.Local == "Code" {
+			var code string
+			if dec.DecodeElement(&code, &start) != nil {
+				return ""
+			}
+			return strings.TrimSpace(code)
+		}
+	}
+}
+
+// dedupeResources removes repeats from resources, keeping the first of each,
+// and caps how many are kept.
+func dedupeResources(resources []string) []string {
+	seen := make(map[string]bool, len(resources))
+	var out []string
+	for _, resource := range resources {
+		if seen[resource] {
+			continue
+		}
+		seen[resource] = true
+		out = append(out, resource)
+		if len(out) == maxAuditResources {
+			break
+		}
+	}
+	return out
+}
@@ -0,0 +1,158 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mulgadc/spinifex/spinifex/admin"
+	"github.com/mulgadc/spinifex/spinifex/audit"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/testutil"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// auditRequest serves body through the audit middleware as an authenticated
+// ec2 call by alice, with handler writing the response.
+func auditRequest(gw *GatewayConfig, body string, handler http.HandlerFunc) {
+	args, _ := ParseAWSQueryArgs(body)
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.RemoteAddr = "192.0.2.10:51000"
+	req.Header.Set("User-Agent", "aws-cli/2.15.0")
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, ctxService, "ec2")
+	ctx = context.WithValue(ctx, ctxAccountID, "000000000001")
+	ctx = context.WithValue(ctx, ctxIdentity, "alice")
+	ctx = context.WithValue(ctx, ctxAccessKey, "AKIAALICE")
+	ctx = context.WithValue(ctx, ctxQueryArgs, args)
+	ctx = context.WithValue(ctx, ctxAction, args["Action"])
+
+	gw.auditMiddleware(handler).ServeHTTP(httptest.NewRecorder(), req.WithContext(ctx))
+}
+
+func setupAuditGateway(t *testing.T) (*GatewayConfig, *nats.Subscription) {
+	t.Helper()
+	_, nc := testutil.StartTestNATS(t)
+	sub, err := nc.SubscribeSync(utils.Subject(subjects.Audit))
+	require.NoError(t, err)
+	return &GatewayConfig{DisableLogging: true, Region: "ap-southeast-2", Audit: audit.NewRecorder(nc, nil, "")}, sub
+}
+
+func nextAuditEvent(t *testing.T, sub *nats.Subscription) audit.Event {
+	t.Helper()
+	msg, err := sub.NextMsg(5 * time.Second)
+	require.NoError(t, err)
+	var event audit.Event
+	require.NoError(t, json.Unmarshal(msg.Data, &event))
+	return event
+}
+
+func TestAuditMiddleware_RecordsMutation(t *testing.T) {
+	gw, sub := setupAuditGateway(t)
+
+	auditRequest(gw, "Action=RunInstances&ImageId=ami-0123456789abcdef0&UserData=c2VjcmV0&SubnetId=subnet-0abc",
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(`<RunInstancesResponse><requestId>req-1</requestId><ownerId>000000000001</ownerId>` +
+				`<instancesSet><item><instanceId>i-0123456789abcdef0</instanceId><imageId>ami-0123456789abcdef0</imageId></item></instancesSet>` +
+				`</RunInstancesResponse>`))
+		})
+
+	event := nextAuditEvent(t, sub)
+	assert.Equal(t, "RunInstances", event.EventName)
+	assert.Equal(t, "ec2", event.EventSource)
+	assert.Equal(t, "ap-southeast-2", event.Region)
+	assert.Equal(t, "192.0.2.10", event.SourceIPAddress)
+	assert.Equal(t, "aws-cli/2.15.0", event.UserAgent)
+	assert.Equal(t, audit.UserIdentity{Type: "IAMUser", AccountID: "000000000001", UserName: "alice", AccessKeyID: "AKIAALICE"}, event.UserIdentity)
+	assert.Equal(t, "HIDDEN_DUE_TO_SECURITY_REASONS", event.RequestParameters["UserData"])
+	assert.ElementsMatch(t, []string{"ami-0123456789abcdef0", "subnet-0abc", "i-0123456789abcdef0"}, event.Resources)
+	assert.Empty(t, event.ErrorCode)
+}
+
+func TestAuditMiddleware_RecordsError(t *testing.T) {
+	gw, sub := setupAuditGateway(t)
+
+	auditRequest(gw, "Action=TerminateInstances&InstanceId.1=i-0aaa&InstanceId.2=i-0bbb",
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write(GenerateEC2ErrorResponse(awserrors.ErrorInvalidInstanceIDNotFound, "not found", "req-1"))
+		})
+
+	event := nextAuditEvent(t, sub)
+	assert.Equal(t, awserrors.ErrorInvalidInstanceIDNotFound, event.ErrorCode)
+	assert.Equal(t, []string{"i-0aaa", "i-0bbb"}, event.Resources)
+}
+
+func TestAuditMiddleware_SkipsReads(t *testing.T) {
+	gw, sub := setupAuditGateway(t)
+
+	auditRequest(gw, "Action=DescribeInstances", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	_, err := sub.NextMsg(100 * time.Millisecond)
+	assert.ErrorIs(t, err, nats.ErrTimeout)
+}
+
+func TestResponseResources_JSON(t *testing.T) {
+	resources := responseResources([]byte(`{"source_instance_id":"i-0src","instance_id":"i-0new","owner_id":"000000000001",` +
+		`"volumes":[{"snapshot_id":"snap-0001","volume_id":""}]}`))
+	assert.ElementsMatch(t, []string{"i-0src", "i-0new", "snap-0001"}, resources)
+}
+
+func TestSpinifex_LookupEvents(t *testing.T) {
+	_, nc, js := testutil.StartTestJetStream(t)
+	require.NoError(t, audit.InitStream(js, 1, 0))
+	gw := &GatewayConfig{DisableLogging: true, NATSConn: nc, Audit: audit.NewRecorder(nc, nil, "")}
+
+	gw.Audit.Record(&audit.Event{EventID: "e1", EventTime: time.Now().UTC(), EventName: "CreateVpc",
+		UserIdentity: audit.UserIdentity{AccountID: "000000000002", UserName: "bob"}})
+	require.Eventually(t, func() bool {
+		info, err := js.StreamInfo(audit.Stream)
+		return err == nil && info.State.Msgs == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	w := spinifexRequest(t, gw, "LookupEvents", admin.DefaultAccountID(), "admin")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var out audit.LookupOutput
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &out))
+	require.Len(t, out.Events, 1)
+	assert.Equal(t, "CreateVpc", out.Events[0].EventName)
+
+	w = spinifexRequest(t, gw, "LookupEvents", "000000000002", "bob")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), awserrors.ErrorAccessDenied)
+}
+
+func TestLookupEventsInput(t *testing.T) {
+	input, err := lookupEventsInput(map[string]string{
+		"AccountId":  "000000000002",
+		"EventName":  "RunInstances",
+		"StartTime":  "2026-01-01T00:00:00Z",
+		"MaxResults": "10",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "000000000002", input.AccountID)
+	assert.Equal(t, "RunInstances", input.EventName)
+	assert.Equal(t, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), input.StartTime)
+	assert.Equal(t, 10, input.MaxResults)
+
+	for name, args := range map[string]map[string]string{
+		"bad time":        {"EndTime": "yesterday"},
+		"max results 0":   {"MaxResults": "0"},
+		"max results 51":  {"MaxResults": "51"},
+		"max results NaN": {"MaxResults": "ten"},
+	} {
+		_, err := lookupEventsInput(args)
+		require.Error(t, err, name)
+		assert.Equal(t, awserrors.ErrorInvalidParameterValue, err.Error(), name)
+	}
+}
@@ -9,11 +9,13 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/mulgadc/predastore/auth"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
 	handlers_iam "github.com/mulgadc/spinifex/spinifex/handlers/iam"
@@ -25,8 +27,29 @@ const (
 
 	// Maximum request body size for signature validation (10 MB)
 	maxBodySize = 10 * 1024 * 1024
+
+	// Maximum X-Amz-Expires of a presigned URL (7 days)
+	maxPresignExpiry = 7 * 24 * 60 * 60
+
+	sigV4Algorithm = "AWS4-HMAC-SHA256"
+
+	// X-Amz-Content-Sha256 values that stand in for a payload hash.
+	unsignedPayload  = "UNSIGNED-PAYLOAD"
+	streamingPayload = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
 )
 
+// presignQueryParams are the query parameters that carry a presigned URL's
+// signature rather than request arguments.
+var presignQueryParams = []string{
+	"X-Amz-Algorithm",
+	"X-Amz-Credential",
+	"X-Amz-Date",
+	"X-Amz-Expires",
+	"X-Amz-SignedHeaders",
+	"X-Amz-Signature",
+	"X-Amz-Security-Token",
+}
+
 // SigV4AuthMiddleware returns stdlib middleware that validates AWS Signature V4 authentication.
 func (gw *GatewayConfig) SigV4AuthMiddleware() func(http.Handler) http.Handler {
 	if gw.RateLimiter == nil {
@@ -41,60 +64,24 @@ func (gw *GatewayConfig) SigV4AuthMiddleware() func(http.Handler) http.Handler {
 				return
 			}
 
+			// Requests carry their signature either in the Authorization
+			// header or, for presigned URLs, in the query string.
+			var cred sigV4Credential
+			var errCode string
 			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
-				gw.writeSigV4Error(w, r, awserrors.ErrorMissingAuthenticationToken)
-				return
+			switch {
+			case authHeader != "":
+				cred, errCode = parseAuthorizationHeader(authHeader, r.Header.Get("X-Amz-Date"))
+			case r.URL.Query().Has("X-Amz-Algorithm"):
+				cred, errCode = parsePresignedQuery(r.URL.Query())
+			default:
+				errCode = awserrors.ErrorMissingAuthenticationToken
 			}
-
-			// Parse the Authorization header
-			// Format: AWS4-HMAC-SHA256 Credential=ACCESS_KEY/DATE/REGION/SERVICE/aws4_request, SignedHeaders=..., Signature=...
-			if !strings.HasPrefix(authHeader, "AWS4-HMAC-SHA256 ") {
-				gw.writeSigV4Error(w, r, awserrors.ErrorIncompleteSignature)
-				return
-			}
-
-			// Extract components from the Authorization header
-			parts := strings.Split(authHeader[len("AWS4-HMAC-SHA256 "):], ", ")
-			if len(parts) != 3 {
-				gw.writeSigV4Error(w, r, awserrors.ErrorIncompleteSignature)
-				return
-			}
-
-			// Parse Credential
-			var accessKey, date, region, service string
-			if after, ok := strings.CutPrefix(parts[0], "Credential="); ok {
-				credParts := strings.Split(after, "/")
-				if len(credParts) != 5 || credParts[4] != "aws4_request" {
-					gw.writeSigV4Error(w, r, awserrors.ErrorIncompleteSignature)
-					return
-				}
-				accessKey = credParts[0]
-				date = credParts[1]
-				region = credParts[2]
-				service = credParts[3]
-			} else {
-				gw.writeSigV4Error(w, r, awserrors.ErrorIncompleteSignature)
-				return
-			}
-
-			// Parse SignedHeaders
-			var signedHeaders string
-			if after, ok := strings.CutPrefix(parts[1], "SignedHeaders="); ok {
-				signedHeaders = after
-			} else {
-				gw.writeSigV4Error(w, r, awserrors.ErrorIncompleteSignature)
-				return
-			}
-
-			// Parse Signature
-			var providedSignature string
-			if after, ok := strings.CutPrefix(parts[2], "Signature="); ok {
-				providedSignature = after
-			} else {
-				gw.writeSigV4Error(w, r, awserrors.ErrorIncompleteSignature)
+			if errCode != "" {
+				gw.writeSigV4Error(w, r, errCode)
 				return
 			}
+			accessKey, date, region, service := cred.accessKey, cred.date, cred.region, cred.service
 
 			// Lookup access key in IAM KV store
 			if gw.IAMService == nil {
@@ -122,6 +109,19 @@ func (gw *GatewayConfig) SigV4AuthMiddleware() func(http.Handler) http.Handler {
 				return
 			}
 
+			// Temporary credentials are only valid with the session token
+			// they were issued with, until they expire.
+			if ak.Temporary() {
+				if errCode := checkSessionToken(ak, sessionToken(r)); errCode != "" {
+					slog.Warn("Auth failure: invalid session credentials", "accessKeyID", accessKey, "sourceIP", clientIP, "code", errCode)
+					if errCode != awserrors.ErrorSTSExpiredToken {
+						gw.RateLimiter.RecordFailure(clientIP)
+					}
+					gw.writeSigV4Error(w, r, errCode)
+					return
+				}
+			}
+
 			secret, err := gw.IAMService.DecryptSecret(ak.SecretAccessKey)
 			if err != nil {
 				slog.Error("Failed to decrypt IAM secret", "accessKeyID", accessKey, "err", err)
@@ -129,8 +129,7 @@ func (gw *GatewayConfig) SigV4AuthMiddleware() func(http.Handler) http.Handler {
 				return
 			}
 
-			// Get timestamp from X-Amz-Date header
-			timestamp := r.Header.Get("X-Amz-Date")
+			timestamp := cred.timestamp
 			if timestamp == "" {
 				gw.writeSigV4Error(w, r, awserrors.ErrorIncompleteSignature)
 				return
@@ -143,7 +142,20 @@ func (gw *GatewayConfig) SigV4AuthMiddleware() func(http.Handler) http.Handler {
 				gw.writeSigV4Error(w, r, awserrors.ErrorIncompleteSignature)
 				return
 			}
-			if time.Since(parsedTime).Abs() > maxClockSkew {
+			if cred.presigned {
+				// A presigned URL is valid from its signing time until it
+				// expires, rather than within the clock skew of it.
+				if time.Until(parsedTime) > maxClockSkew {
+					slog.Debug("Presigned URL not yet valid", "timestamp", timestamp)
+					gw.writeSigV4Error(w, r, awserrors.ErrorSignatureDoesNotMatch)
+					return
+				}
+				if time.Since(parsedTime) > cred.expires {
+					slog.Debug("Presigned URL expired", "timestamp", timestamp, "expires", cred.expires)
+					gw.writeSigV4Error(w, r, awserrors.ErrorRequestExpired)
+					return
+				}
+			} else if time.Since(parsedTime).Abs() > maxClockSkew {
 				slog.Debug("Signature expired", "timestamp", timestamp, "skew", time.Since(parsedTime))
 				gw.writeSigV4Error(w, r, awserrors.ErrorSignatureDoesNotMatch)
 				return
@@ -165,13 +177,12 @@ func (gw *GatewayConfig) SigV4AuthMiddleware() func(http.Handler) http.Handler {
 				gw.writeSigV4Error(w, r, awserrors.ErrorInternalError)
 				return
 			}
-			r.Body = io.NopCloser(bytes.NewReader(body))
 
 			// Compute expected signature using decrypted secret
-			expectedSignature := computeSignatureWithSecret(r, body, secret, date, timestamp, region, service, signedHeaders)
+			expectedSignature := computeSignatureWithSecret(r, body, secret, date, timestamp, region, service, cred.signedHeaders)
 
 			// Compare signatures using constant-time comparison to prevent timing attacks
-			if subtle.ConstantTimeCompare([]byte(expectedSignature), []byte(providedSignature)) != 1 {
+			if subtle.ConstantTimeCompare([]byte(expectedSignature), []byte(cred.signature)) != 1 {
 				slog.Warn("Auth failure: signature mismatch",
 					"accessKeyID", accessKey,
 					"sourceIP", clientIP,
@@ -181,9 +192,40 @@ func (gw *GatewayConfig) SigV4AuthMiddleware() func(http.Handler) http.Handler {
 				return
 			}
 
+			// A streaming payload is signed chunk by chunk, each signature
+			// chained to the one before it starting from the request's.
+			if r.Header.Get("X-Amz-Content-Sha256") == streamingPayload {
+				signingKey := auth.GetSigningKey(secret, date, region, service)
+				scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, region, service)
+				decoded, err := decodeStreamingPayload(body, cred.signature, signingKey, timestamp, scope)
+				if err != nil {
+					slog.Warn("Auth failure: invalid streaming payload",
+						"accessKeyID", accessKey,
+						"sourceIP", clientIP,
+						"err", err,
+					)
+					gw.RateLimiter.RecordFailure(clientIP)
+					if errors.Is(err, errChunkSignature) {
+						gw.writeSigV4Error(w, r, awserrors.ErrorSignatureDoesNotMatch)
+					} else {
+						gw.writeSigV4Error(w, r, awserrors.ErrorIncompleteSignature)
+					}
+					return
+				}
+				body = decoded
+				r.ContentLength = int64(len(body))
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
 			// Store parsed auth data in context for downstream handlers
 			ctx := r.Context()
-			ctx = context.WithValue(ctx, ctxIdentity, ak.UserName)
+			identity := ak.UserName
+			if ak.RoleName != "" {
+				identity = "assumed-role/" + ak.RoleName + "/" + ak.SessionName
+				ctx = context.WithValue(ctx, ctxRoleName, ak.RoleName)
+				ctx = context.WithValue(ctx, ctxSessionName, ak.SessionName)
+			}
+			ctx = context.WithValue(ctx, ctxIdentity, identity)
 			ctx = context.WithValue(ctx, ctxAccountID, ak.AccountID)
 			ctx = context.WithValue(ctx, ctxService, service)
 			ctx = context.WithValue(ctx, ctxRegion, region)
@@ -191,20 +233,242 @@ func (gw *GatewayConfig) SigV4AuthMiddleware() func(http.Handler) http.Handler {
 
 			// Parse once; dispatchers reuse via ctxQueryArgs. On error, the
 			// dispatcher re-parses and returns MalformedQueryString.
-			if args, err := ParseAWSQueryArgs(string(body)); err == nil {
+			if args, err := ParseAWSQueryArgs(queryArgsSource(r, body)); err == nil {
 				ctx = context.WithValue(ctx, ctxQueryArgs, args)
 				if action := args["Action"]; action != "" {
 					ctx = context.WithValue(ctx, ctxAction, action)
 				}
 			}
 
-			slog.Debug("SigV4 authentication successful", "accessKey", accessKey, "identity", ak.UserName)
+			slog.Debug("SigV4 authentication successful", "accessKey", accessKey, "identity", identity)
 			gw.RateLimiter.RecordSuccess(clientIP)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// sessionToken returns the STS session token a request presents, from the
+// X-Amz-Security-Token header or, for presigned URLs, the query string.
+func sessionToken(r *http.Request) string {
+	if token := r.Header.Get("X-Amz-Security-Token"); token != "" {
+		return token
+	}
+	return r.URL.Query().Get("X-Amz-Security-Token")
+}
+
+// checkSessionToken validates the session token presented with temporary
+// credentials and their expiry, returning the error code to fail with.
+func checkSessionToken(ak *handlers_iam.AccessKey, token string) string {
+	if token == "" || subtle.ConstantTimeCompare([]byte(handlers_iam.HashSessionToken(token)), []byte(ak.SessionTokenHash)) != 1 {
+		return awserrors.ErrorInvalidClientTokenId
+	}
+	expiration, err := time.Parse(time.RFC3339, ak.Expiration)
+	if err != nil || !time.Now().Before(expiration) {
+		return awserrors.ErrorSTSExpiredToken
+	}
+	return ""
+}
+
+// sigV4Credential is the signing information a request carries, from either
+// its Authorization header or a presigned URL's query string.
+type sigV4Credential struct {
+	accessKey     string
+	date          string
+	region        string
+	service       string
+	signedHeaders string
+	signature     string
+	timestamp     string
+
+	// presigned requests are valid until expires after timestamp.
+	presigned bool
+	expires   time.Duration
+}
+
+// parseAuthorizationHeader parses an Authorization header of the form
+// AWS4-HMAC-SHA256 Credential=ACCESS_KEY/DATE/REGION/SERVICE/aws4_request, SignedHeaders=..., Signature=...
+// and takes the timestamp from the X-Amz-Date header. It returns an error
+// code when the header is malformed.
+func parseAuthorizationHeader(authHeader, amzDate string) (sigV4Credential, string) {
+	if !strings.HasPrefix(authHeader, sigV4Algorithm+" ") {
+		return sigV4Credential{}, awserrors.ErrorIncompleteSignature
+	}
+
+	// Extract components from the Authorization header
+	parts := strings.Split(authHeader[len(sigV4Algorithm+" "):], ", ")
+	if len(parts) != 3 {
+		return sigV4Credential{}, awserrors.ErrorIncompleteSignature
+	}
+
+	credential, ok := strings.CutPrefix(parts[0], "Credential=")
+	if !ok {
+		return sigV4Credential{}, awserrors.ErrorIncompleteSignature
+	}
+	cred, ok := parseCredentialScope(credential)
+	if !ok {
+		return sigV4Credential{}, awserrors.ErrorIncompleteSignature
+	}
+	if cred.signedHeaders, ok = strings.CutPrefix(parts[1], "SignedHeaders="); !ok {
+		return sigV4Credential{}, awserrors.ErrorIncompleteSignature
+	}
+	if cred.signature, ok = strings.CutPrefix(parts[2], "Signature="); !ok {
+		return sigV4Credential{}, awserrors.ErrorIncompleteSignature
+	}
+	cred.timestamp = amzDate
+	return cred, ""
+}
+
+// parsePresignedQuery parses the X-Amz-* parameters of a presigned URL. It
+// returns an error code when one is missing or malformed.
+func parsePresignedQuery(query url.Values) (sigV4Credential, string) {
+	if query.Get("X-Amz-Algorithm") != sigV4Algorithm {
+		return sigV4Credential{}, awserrors.ErrorIncompleteSignature
+	}
+	cred, ok := parseCredentialScope(query.Get("X-Amz-Credential"))
+	if !ok {
+		return sigV4Credential{}, awserrors.ErrorIncompleteSignature
+	}
+	cred.signedHeaders = query.Get("X-Amz-SignedHeaders")
+	cred.signature = query.Get("X-Amz-Signature")
+	cred.timestamp = query.Get("X-Amz-Date")
+	if cred.signedHeaders == "" || cred.signature == "" {
+		return sigV4Credential{}, awserrors.ErrorIncompleteSignature
+	}
+
+	expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil || expires < 1 || expires > maxPresignExpiry {
+		return sigV4Credential{}, awserrors.ErrorIncompleteSignature
+	}
+	cred.presigned = true
+	cred.expires = time.Duration(expires) * time.Second
+	return cred, ""
+}
+
+// parseCredentialScope parses ACCESS_KEY/DATE/REGION/SERVICE/aws4_request.
+func parseCredentialScope(credential string) (sigV4Credential, bool) {
+	credParts := strings.Split(credential, "/")
+	if len(credParts) != 5 || credParts[4] != "aws4_request" {
+		return sigV4Credential{}, false
+	}
+	return sigV4Credential{
+		accessKey: credParts[0],
+		date:      credParts[1],
+		region:    credParts[2],
+		service:   credParts[3],
+	}, true
+}
+
+// requestPayloadHash returns the payload hash of the canonical request. The
+// client declares in X-Amz-Content-Sha256 whether the payload is signed
+// whole, left unsigned or streamed in signed chunks; a declared hash that
+// does not match the body fails the signature check.
+//
+// The body of a query-protocol request carries its arguments, so a payload
+// is only left unsigned when there is none and every argument is in the
+// signed query string. Streamed chunks are each signed, so their arguments
+// are covered too.
+func requestPayloadHash(r *http.Request, body []byte) string {
+	switch contentHash := r.Header.Get("X-Amz-Content-Sha256"); contentHash {
+	case streamingPayload:
+		return contentHash
+	case unsignedPayload:
+		if len(body) == 0 {
+			return contentHash
+		}
+		return auth.HashSHA256(string(body))
+	default:
+		return auth.HashSHA256(string(body))
+	}
+}
+
+// errChunkSignature reports a streaming payload chunk whose signature does
+// not match its data.
+var errChunkSignature = errors.New("chunk signature mismatch")
+
+// decodeStreamingPayload verifies and decodes an aws-chunked body, as sent
+// with X-Amz-Content-Sha256: STREAMING-AWS4-HMAC-SHA256-PAYLOAD. Each chunk is
+// framed as
+//
+//	hex(size);chunk-signature=signature\r\n
+//	data\r\n
+//
+// and ends with a zero-size chunk. A chunk's signature covers its data and
+// the signature before it, seeded with the request signature.
+func decodeStreamingPayload(body []byte, seedSignature string, signingKey []byte, timestamp, scope string) ([]byte, error) {
+	emptyHash := auth.HashSHA256("")
+	previous := seedSignature
+	var decoded []byte
+	for {
+		header, rest, ok := bytes.Cut(body, []byte("\r\n"))
+		if !ok {
+			return nil, errors.New("missing chunk header")
+		}
+		sizeHex, signature, ok := strings.Cut(string(header), ";chunk-signature=")
+		if !ok {
+			return nil, errors.New("missing chunk signature")
+		}
+		size, err := strconv.ParseUint(sizeHex, 16, 32)
+		if err != nil || size > uint64(len(rest)) {
+			return nil, errors.New("invalid chunk size")
+		}
+		data := rest[:size]
+		rest = rest[size:]
+
+		stringToSign := strings.Join([]string{
+			sigV4Algorithm + "-PAYLOAD",
+			timestamp,
+			scope,
+			previous,
+			emptyHash,
+			auth.HashSHA256(string(data)),
+		}, "\n")
+		expected := auth.HmacSHA256Hex(signingKey, stringToSign)
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(signature)) != 1 {
+			return nil, errChunkSignature
+		}
+		previous = signature
+
+		if size == 0 {
+			if len(rest) > 0 && !bytes.Equal(rest, []byte("\r\n")) {
+				return nil, errors.New("data after final chunk")
+			}
+			return decoded, nil
+		}
+		decoded = append(decoded, data...)
+		if body, ok = bytes.CutPrefix(rest, []byte("\r\n")); !ok {
+			return nil, errors.New("missing chunk terminator")
+		}
+	}
+}
+
+// withoutQueryParams returns rawQuery with the named parameters removed.
+func withoutQueryParams(rawQuery string, names ...string) string {
+	var kept []string
+	for pair := range strings.SplitSeq(rawQuery, "&") {
+		key, _, _ := strings.Cut(pair, "=")
+		if !slices.Contains(names, queryUnescape(key)) {
+			kept = append(kept, pair)
+		}
+	}
+	return strings.Join(kept, "&")
+}
+
+// queryArgsSource returns the query-protocol arguments of a request: the
+// query string less any signing parameters, followed by the form body. Older
+// tools send arguments in either, or put Action in the query string and the
+// rest in the body; where both name an argument the body's value wins.
+func queryArgsSource(r *http.Request, body []byte) string {
+	query := withoutQueryParams(r.URL.RawQuery, presignQueryParams...)
+	switch {
+	case query == "":
+		return string(body)
+	case len(body) == 0:
+		return query
+	default:
+		return query + "&" + string(body)
+	}
+}
+
 // computeSignatureWithSecret builds the canonical request and computes the AWS Signature V4 signature
 // using the provided secret key. The body is passed explicitly since it has already been read from r.Body.
 func computeSignatureWithSecret(r *http.Request, body []byte, secretKey, date, timestamp, region, service, signedHeaders string) string {
@@ -218,8 +482,13 @@ func computeSignatureWithSecret(r *http.Request, body []byte, secretKey, date, t
 		canonicalURI = "/"
 	}
 
-	// Build canonical query string (sorted, encoded)
-	canonicalQueryString := buildCanonicalQueryString(r.URL.RawQuery)
+	// Build canonical query string (sorted, encoded). A presigned URL's own
+	// signature is not part of what it signs.
+	rawQuery := r.URL.RawQuery
+	if r.Header.Get("Authorization") == "" {
+		rawQuery = withoutQueryParams(rawQuery, "X-Amz-Signature")
+	}
+	canonicalQueryString := buildCanonicalQueryString(rawQuery)
 
 	// Build canonical headers from SignedHeaders list
 	headersList := strings.Split(signedHeaders, ";")
@@ -242,8 +511,7 @@ func computeSignatureWithSecret(r *http.Request, body []byte, secretKey, date, t
 		canonicalHeaders.WriteString("\n")
 	}
 
-	// Hash payload body with SHA256
-	payloadHash := auth.HashSHA256(string(body))
+	payloadHash := requestPayloadHash(r, body)
 
 	// Build canonical request
 	canonicalRequest := fmt.Sprintf(
@@ -288,10 +556,12 @@ func buildCanonicalQueryString(queryString string) string {
 			continue
 		}
 		kv := strings.SplitN(pair, "=", 2)
-		key := kv[0]
+		// Decode before re-encoding so percent-encoded input is not
+		// encoded a second time.
+		key := queryUnescape(kv[0])
 		value := ""
 		if len(kv) == 2 {
-			value = kv[1]
+			value = queryUnescape(kv[1])
 		}
 		params[key] = append(params[key], value)
 	}
@@ -318,6 +588,14 @@ func buildCanonicalQueryString(queryString string) string {
 	return strings.Join(result, "&")
 }
 
+// queryUnescape decodes a query component, leaving malformed input as is.
+func queryUnescape(s string) string {
+	if decoded, err := url.QueryUnescape(s); err == nil {
+		return decoded
+	}
+	return s
+}
+
 // canonicalHeaderName converts a lowercase header name to the canonical form for lookup.
 func canonicalHeaderName(header string) string {
 	// Convert header names like "x-amz-date" to "X-Amz-Date" for http.Header.Get
@@ -332,7 +610,7 @@ func canonicalHeaderName(header string) string {
 
 // writeSigV4Error writes an EC2-compatible XML error response for authentication failures.
 func (gw *GatewayConfig) writeSigV4Error(w http.ResponseWriter, r *http.Request, errorCode string) {
-	requestID := uuid.NewString()
+	requestID := requestIDOf(r)
 
 	errorMsg, exists := awserrors.ErrorLookup[errorCode]
 	if !exists {
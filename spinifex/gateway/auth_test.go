@@ -10,12 +10,17 @@ import (
 	"testing"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
 	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/go-chi/chi/v5"
 	"github.com/mulgadc/predastore/auth"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
 	handlers_iam "github.com/mulgadc/spinifex/spinifex/handlers/iam"
 	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const (
@@ -90,6 +95,60 @@ func (m *mockIAMService) ListAttachedUserPolicies(_ string, _ *iam.ListAttachedU
 func (m *mockIAMService) GetUserPolicies(_, _ string) ([]handlers_iam.PolicyDocument, error) {
 	return nil, nil
 }
+func (m *mockIAMService) CreateRole(_ string, _ *iam.CreateRoleInput) (*iam.CreateRoleOutput, error) {
+	return nil, nil
+}
+func (m *mockIAMService) GetRole(_ string, _ *iam.GetRoleInput) (*iam.GetRoleOutput, error) {
+	return nil, nil
+}
+func (m *mockIAMService) ListRoles(_ string, _ *iam.ListRolesInput) (*iam.ListRolesOutput, error) {
+	return nil, nil
+}
+func (m *mockIAMService) DeleteRole(_ string, _ *iam.DeleteRoleInput) (*iam.DeleteRoleOutput, error) {
+	return nil, nil
+}
+func (m *mockIAMService) AttachRolePolicy(_ string, _ *iam.AttachRolePolicyInput) (*iam.AttachRolePolicyOutput, error) {
+	return nil, nil
+}
+func (m *mockIAMService) DetachRolePolicy(_ string, _ *iam.DetachRolePolicyInput) (*iam.DetachRolePolicyOutput, error) {
+	return nil, nil
+}
+func (m *mockIAMService) ListAttachedRolePolicies(_ string, _ *iam.ListAttachedRolePoliciesInput) (*iam.ListAttachedRolePoliciesOutput, error) {
+	return nil, nil
+}
+func (m *mockIAMService) CreateInstanceProfile(_ string, _ *iam.CreateInstanceProfileInput) (*iam.CreateInstanceProfileOutput, error) {
+	return nil, nil
+}
+func (m *mockIAMService) GetInstanceProfile(_ string, _ *iam.GetInstanceProfileInput) (*iam.GetInstanceProfileOutput, error) {
+	return nil, nil
+}
+func (m *mockIAMService) ListInstanceProfiles(_ string, _ *iam.ListInstanceProfilesInput) (*iam.ListInstanceProfilesOutput, error) {
+	return nil, nil
+}
+func (m *mockIAMService) DeleteInstanceProfile(_ string, _ *iam.DeleteInstanceProfileInput) (*iam.DeleteInstanceProfileOutput, error) {
+	return nil, nil
+}
+func (m *mockIAMService) AddRoleToInstanceProfile(_ string, _ *iam.AddRoleToInstanceProfileInput) (*iam.AddRoleToInstanceProfileOutput, error) {
+	return nil, nil
+}
+func (m *mockIAMService) RemoveRoleFromInstanceProfile(_ string, _ *iam.RemoveRoleFromInstanceProfileInput) (*iam.RemoveRoleFromInstanceProfileOutput, error) {
+	return nil, nil
+}
+func (m *mockIAMService) ResolveInstanceProfile(_, _, _ string) (*handlers_iam.InstanceProfile, error) {
+	return nil, nil
+}
+func (m *mockIAMService) GetSessionToken(_, _ string, _ *sts.GetSessionTokenInput) (*sts.GetSessionTokenOutput, error) {
+	return nil, nil
+}
+func (m *mockIAMService) AssumeRole(_, _ string, _ *sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error) {
+	return nil, nil
+}
+func (m *mockIAMService) InstanceProfileCredentials(_ *handlers_iam.InstanceCredentialsRequest) (*handlers_iam.InstanceCredentials, error) {
+	return nil, nil
+}
+func (m *mockIAMService) GetRolePolicies(_, _ string) ([]handlers_iam.PolicyDocument, error) {
+	return nil, nil
+}
 func (m *mockIAMService) DecryptSecret(ciphertext string) (string, error) {
 	return handlers_iam.DecryptSecret(ciphertext, m.masterKey)
 }
@@ -587,6 +646,7 @@ func TestBuildCanonicalQueryString_EdgeCases(t *testing.T) {
 		{"long query string", "a=" + strings.Repeat("x", 500), "a=" + strings.Repeat("x", 500)},
 		{"no value (key only)", "key", "key="},
 		{"empty pair skipped", "a=1&&b=2", "a=1&b=2"},
+		{"percent-encoded not re-encoded", "X-Amz-Credential=AKID%2F20260101%2Fus-east-1%2Fec2%2Faws4_request", "X-Amz-Credential=AKID%2F20260101%2Fus-east-1%2Fec2%2Faws4_request"},
 	}
 
 	for _, tc := range testCases {
@@ -1601,8 +1661,8 @@ func TestCheckPolicy_NonRootNoPolicies_Denied(t *testing.T) {
 	}
 
 	body, _ := io.ReadAll(resp.Body)
-	if !strings.Contains(string(body), "AccessDenied") {
-		t.Errorf("Expected AccessDenied error, got: %s", string(body))
+	if !strings.Contains(string(body), "UnauthorizedOperation") {
+		t.Errorf("Expected UnauthorizedOperation error, got: %s", string(body))
 	}
 }
 
@@ -1733,8 +1793,8 @@ func TestCheckPolicy_NonRootWithExplicitDeny_Denied(t *testing.T) {
 	}
 
 	body, _ := io.ReadAll(resp.Body)
-	if !strings.Contains(string(body), "AccessDenied") {
-		t.Errorf("Expected AccessDenied error, got: %s", string(body))
+	if !strings.Contains(string(body), "UnauthorizedOperation") {
+		t.Errorf("Expected UnauthorizedOperation error, got: %s", string(body))
 	}
 }
 
@@ -1951,3 +2011,307 @@ func TestCheckPolicy_RootNonGlobalAccount_StillEvaluated(t *testing.T) {
 		t.Errorf("Expected status 403, got %d, body: %s", resp.StatusCode, string(body))
 	}
 }
+
+// --- Presigned URL and payload signing tests ---
+
+// setupActionEchoApp authenticates with SigV4 and echoes the parsed Action and
+// the request body, to show what reaches downstream handlers.
+func setupActionEchoApp() http.Handler {
+	encryptedSecret, err := handlers_iam.EncryptSecret(testSecretKey, testMasterKey)
+	if err != nil {
+		panic("failed to encrypt test secret: " + err.Error())
+	}
+	gw := &GatewayConfig{
+		DisableLogging: true,
+		Region:         testRegion,
+		IAMService: &mockIAMService{
+			masterKey: testMasterKey,
+			accessKeys: map[string]*handlers_iam.AccessKey{
+				testAccessKey: {
+					AccessKeyID:     testAccessKey,
+					SecretAccessKey: encryptedSecret,
+					UserName:        "alice",
+					AccountID:       "123456789012",
+					Status:          "Active",
+				},
+			},
+		},
+	}
+
+	r := chi.NewRouter()
+	r.Use(gw.SigV4AuthMiddleware())
+	r.HandleFunc("/*", func(w http.ResponseWriter, r *http.Request) {
+		action, _ := r.Context().Value(ctxAction).(string)
+		body, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s|%s", action, body)
+	})
+	return r
+}
+
+func testSigner() *v4.Signer {
+	return v4.NewSigner(credentials.NewStaticCredentials(testAccessKey, testSecretKey, ""))
+}
+
+func presignedRequest(t *testing.T, query string, expires time.Duration, signTime time.Time) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, "http://localhost:9999/?"+query, nil)
+	require.NoError(t, err)
+	_, err = testSigner().Presign(req, nil, testService, testRegion, expires, signTime)
+	require.NoError(t, err)
+	req.Body = http.NoBody // as on a server-side request
+	return req
+}
+
+func TestSigV4Auth_PresignedURL(t *testing.T) {
+	handler := setupActionEchoApp()
+	req := presignedRequest(t, "Action=DescribeInstances&Version=2016-11-15", 5*time.Minute, time.Now())
+	require.NotEmpty(t, req.URL.Query().Get("X-Amz-Signature"))
+
+	resp := doRequest(handler, req)
+	body, _ := io.ReadAll(resp.Body)
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+	assert.Equal(t, "DescribeInstances|", string(body))
+}
+
+func TestSigV4Auth_PresignedURLErrors(t *testing.T) {
+	handler := setupActionEchoApp()
+
+	tests := []struct {
+		name   string
+		req    func(t *testing.T) *http.Request
+		status int
+		code   string
+	}{
+		{
+			name: "Expired",
+			req: func(t *testing.T) *http.Request {
+				return presignedRequest(t, "Action=DescribeInstances", time.Minute, time.Now().Add(-2*time.Minute))
+			},
+			status: http.StatusForbidden,
+			code:   awserrors.ErrorRequestExpired,
+		},
+		{
+			name: "LongLivedStillValid",
+			req: func(t *testing.T) *http.Request {
+				return presignedRequest(t, "Action=DescribeInstances", time.Hour, time.Now().Add(-30*time.Minute))
+			},
+			status: http.StatusOK,
+		},
+		{
+			name: "NotYetValid",
+			req: func(t *testing.T) *http.Request {
+				return presignedRequest(t, "Action=DescribeInstances", time.Hour, time.Now().Add(time.Hour))
+			},
+			status: http.StatusForbidden,
+			code:   awserrors.ErrorSignatureDoesNotMatch,
+		},
+		{
+			name: "TamperedArgument",
+			req: func(t *testing.T) *http.Request {
+				req := presignedRequest(t, "Action=DescribeInstances", time.Minute, time.Now())
+				req.URL.RawQuery = strings.Replace(req.URL.RawQuery, "DescribeInstances", "TerminateInstances", 1)
+				return req
+			},
+			status: http.StatusForbidden,
+			code:   awserrors.ErrorSignatureDoesNotMatch,
+		},
+		{
+			name: "ExpiresTooLong",
+			req: func(t *testing.T) *http.Request {
+				req := presignedRequest(t, "Action=DescribeInstances", time.Minute, time.Now())
+				q := req.URL.Query()
+				q.Set("X-Amz-Expires", "604801")
+				req.URL.RawQuery = q.Encode()
+				return req
+			},
+			status: http.StatusBadRequest,
+			code:   awserrors.ErrorIncompleteSignature,
+		},
+		{
+			name: "MissingSignature",
+			req: func(t *testing.T) *http.Request {
+				req := presignedRequest(t, "Action=DescribeInstances", time.Minute, time.Now())
+				q := req.URL.Query()
+				q.Del("X-Amz-Signature")
+				req.URL.RawQuery = q.Encode()
+				return req
+			},
+			status: http.StatusBadRequest,
+			code:   awserrors.ErrorIncompleteSignature,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := doRequest(handler, tt.req(t))
+			body, _ := io.ReadAll(resp.Body)
+			assert.Equal(t, tt.status, resp.StatusCode, string(body))
+			if tt.code != "" {
+				assert.Contains(t, string(body), "<Code>"+tt.code+"</Code>")
+			}
+		})
+	}
+}
+
+func TestSigV4Auth_SDKSignedRequest(t *testing.T) {
+	handler := setupActionEchoApp()
+
+	body := "Action=DescribeVolumes&Version=2016-11-15&Filter.1.Name=tag%3AName&Filter.1.Value.1=a%2Fb"
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:9999/", nil)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	_, err = testSigner().Sign(req, strings.NewReader(body), testService, testRegion, time.Now())
+	require.NoError(t, err)
+
+	resp := doRequest(handler, req)
+	respBody, _ := io.ReadAll(resp.Body)
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(respBody))
+	assert.Equal(t, "DescribeVolumes|"+body, string(respBody))
+}
+
+func TestSigV4Auth_UnsignedPayload(t *testing.T) {
+	handler := setupActionEchoApp()
+	args := "Action=DescribeVolumes&Version=2016-11-15"
+
+	// unsignedRequest signs a request without its payload, sending args in
+	// the query string or the body.
+	unsignedRequest := func(t *testing.T, query, body string) *http.Request {
+		req, err := http.NewRequest(http.MethodPost, "http://localhost:9999/?"+query, nil)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+		signer := testSigner()
+		signer.UnsignedPayload = true
+		_, err = signer.Sign(req, strings.NewReader(body), testService, testRegion, time.Now())
+		require.NoError(t, err)
+		require.Equal(t, unsignedPayload, req.Header.Get("X-Amz-Content-Sha256"))
+		return req
+	}
+
+	t.Run("ArgumentsInSignedQuery", func(t *testing.T) {
+		resp := doRequest(handler, unsignedRequest(t, args, ""))
+		respBody, _ := io.ReadAll(resp.Body)
+		require.Equal(t, http.StatusOK, resp.StatusCode, string(respBody))
+		assert.Equal(t, "DescribeVolumes|", string(respBody))
+	})
+
+	t.Run("ArgumentsInUnsignedBody", func(t *testing.T) {
+		// Anyone on the path could rewrite arguments nothing signed.
+		resp := doRequest(handler, unsignedRequest(t, "", args))
+		respBody, _ := io.ReadAll(resp.Body)
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, string(respBody))
+		assert.Contains(t, string(respBody), "<Code>"+awserrors.ErrorSignatureDoesNotMatch+"</Code>")
+	})
+}
+
+// streamingRequest signs a request whose payload is sent aws-chunked in the
+// given chunks and returns it with the encoded body attached.
+func streamingRequest(t *testing.T, chunks ...string) *http.Request {
+	t.Helper()
+	signTime := time.Now().UTC()
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:9999/", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Amz-Content-Sha256", streamingPayload)
+	req.Header.Set("Content-Encoding", "aws-chunked")
+	_, err = testSigner().Sign(req, nil, testService, testRegion, signTime)
+	require.NoError(t, err)
+
+	_, seed, ok := strings.Cut(req.Header.Get("Authorization"), "Signature=")
+	require.True(t, ok)
+
+	date := signTime.Format(auth.ShortTimeFormat)
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, testRegion, testService)
+	signingKey := auth.GetSigningKey(testSecretKey, date, testRegion, testService)
+
+	var encoded strings.Builder
+	previous := seed
+	for _, chunk := range append(chunks, "") {
+		stringToSign := strings.Join([]string{
+			"AWS4-HMAC-SHA256-PAYLOAD",
+			signTime.Format(auth.TimeFormat),
+			scope,
+			previous,
+			auth.HashSHA256(""),
+			auth.HashSHA256(chunk),
+		}, "\n")
+		previous = auth.HmacSHA256Hex(signingKey, stringToSign)
+		fmt.Fprintf(&encoded, "%x;chunk-signature=%s\r\n%s\r\n", len(chunk), previous, chunk)
+	}
+	req.Body = io.NopCloser(strings.NewReader(encoded.String()))
+	return req
+}
+
+func TestSigV4Auth_StreamingPayload(t *testing.T) {
+	handler := setupActionEchoApp()
+
+	req := streamingRequest(t, "Action=CreateVolume&Size=8", "&AvailabilityZone=us-east-1a")
+	resp := doRequest(handler, req)
+	body, _ := io.ReadAll(resp.Body)
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+	assert.Equal(t, "CreateVolume|Action=CreateVolume&Size=8&AvailabilityZone=us-east-1a", string(body))
+}
+
+func TestSigV4Auth_StreamingPayloadErrors(t *testing.T) {
+	handler := setupActionEchoApp()
+
+	tests := []struct {
+		name   string
+		mutate func(body string) string
+		code   string
+	}{
+		{
+			name:   "TamperedChunk",
+			mutate: func(body string) string { return strings.Replace(body, "Size=8", "Size=9", 1) },
+			code:   awserrors.ErrorSignatureDoesNotMatch,
+		},
+		{
+			name: "DroppedChunk",
+			mutate: func(body string) string {
+				// Remove the second data chunk; the final chunk's signature
+				// no longer chains from its predecessor.
+				parts := strings.SplitAfterN(body, "\r\n", 5)
+				return parts[0] + parts[1] + parts[4]
+			},
+			code: awserrors.ErrorSignatureDoesNotMatch,
+		},
+		{
+			name:   "Truncated",
+			mutate: func(body string) string { return body[:len(body)/2] },
+			code:   awserrors.ErrorIncompleteSignature,
+		},
+		{
+			name:   "NotChunked",
+			mutate: func(string) string { return "Action=CreateVolume" },
+			code:   awserrors.ErrorIncompleteSignature,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := streamingRequest(t, "Action=CreateVolume&Size=8", "&AvailabilityZone=us-east-1a")
+			encoded, _ := io.ReadAll(req.Body)
+			req.Body = io.NopCloser(strings.NewReader(tt.mutate(string(encoded))))
+
+			resp := doRequest(handler, req)
+			body, _ := io.ReadAll(resp.Body)
+			assert.NotEqual(t, http.StatusOK, resp.StatusCode)
+			assert.Contains(t, string(body), "<Code>"+tt.code+"</Code>")
+		})
+	}
+}
+
+func TestWithoutQueryParams(t *testing.T) {
+	assert.Equal(t, "Action=A&b=2", withoutQueryParams("Action=A&X-Amz-Signature=abc&b=2", "X-Amz-Signature"))
+	assert.Equal(t, "Action=A", withoutQueryParams("Action=A&X-Amz-Date=1&X-Amz-Expires=60", presignQueryParams...))
+	assert.Equal(t, "", withoutQueryParams("", "X-Amz-Signature"))
+}
+
+func TestQueryArgsSource(t *testing.T) {
+	post := httptest.NewRequest(http.MethodPost, "/", nil)
+	assert.Equal(t, "Action=A&b=2", queryArgsSource(post, []byte("Action=A&b=2")))
+
+	presigned := httptest.NewRequest(http.MethodGet, "/?Action=A&X-Amz-Signature=abc", nil)
+	assert.Equal(t, "Action=A", queryArgsSource(presigned, nil))
+
+	split := httptest.NewRequest(http.MethodPost, "/?Action=A&b=1", nil)
+	args, err := ParseAWSQueryArgs(queryArgsSource(split, []byte("b=2&InstanceId.1=i-1")))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"Action": "A", "b": "2", "InstanceId.1": "i-1"}, args)
+}
@@ -0,0 +1,109 @@
+package gateway
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/mulgadc/spinifex/spinifex/awsec2query"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	gateway_autoscaling "github.com/mulgadc/spinifex/spinifex/gateway/autoscaling"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+)
+
+// AutoScalingHandler processes parsed query args and returns XML response bytes.
+type AutoScalingHandler func(action string, q map[string]string, gw *GatewayConfig, accountID string) ([]byte, error)
+
+// autoScalingHandler creates a type-safe AutoScalingHandler that allocates
+// the typed input struct, parses query params into it, validates it against
+// the model constraints, calls the handler, and marshals the output to XML. Auto Scaling uses the same
+// <ActionResponse><ActionResult> envelope as IAM and ELBv2.
+func autoScalingHandler[In any](handler func(*In, *GatewayConfig, string) (any, error)) AutoScalingHandler {
+	return func(action string, q map[string]string, gw *GatewayConfig, accountID string) ([]byte, error) {
+		input := new(In)
+		if err := awsec2query.QueryParamsToStruct(q, input); err != nil {
+			if errors.Is(err, awsec2query.ErrSliceTooLarge) {
+				return nil, errors.New(awserrors.ErrorMalformedQueryString)
+			}
+			return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+		}
+		if err := validateInput(input); err != nil {
+			return nil, err
+		}
+		output, err := handler(input, gw, accountID)
+		if err != nil {
+			return nil, err
+		}
+		payload := utils.GenerateIAMXMLPayload(action, output)
+		xmlOutput, err := utils.MarshalToXML(payload)
+		if err != nil {
+			return nil, errors.New("failed to marshal response to XML")
+		}
+		return xmlOutput, nil
+	}
+}
+
+var autoScalingActions = map[string]AutoScalingHandler{
+	"CreateAutoScalingGroup": autoScalingHandler(func(input *autoscaling.CreateAutoScalingGroupInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_autoscaling.CreateAutoScalingGroup(input, gw.NATSConn, accountID)
+	}),
+	"UpdateAutoScalingGroup": autoScalingHandler(func(input *autoscaling.UpdateAutoScalingGroupInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_autoscaling.UpdateAutoScalingGroup(input, gw.NATSConn, accountID)
+	}),
+	"SetDesiredCapacity": autoScalingHandler(func(input *autoscaling.SetDesiredCapacityInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_autoscaling.SetDesiredCapacity(input, gw.NATSConn, accountID)
+	}),
+	"DeleteAutoScalingGroup": autoScalingHandler(func(input *autoscaling.DeleteAutoScalingGroupInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_autoscaling.DeleteAutoScalingGroup(input, gw.NATSConn, accountID)
+	}),
+	"DescribeAutoScalingGroups": autoScalingHandler(func(input *autoscaling.DescribeAutoScalingGroupsInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_autoscaling.DescribeAutoScalingGroups(input, gw.NATSConn, accountID)
+	}),
+}
+
+// AutoScaling_Request serves the Auto Scaling query API (SigV4 service
+// "autoscaling"). Groups launch from EC2 launch templates only.
+func (gw *GatewayConfig) AutoScaling_Request(w http.ResponseWriter, r *http.Request) error {
+	queryArgs, err := readQueryArgs(r)
+	if err != nil {
+		slog.Debug("AutoScaling: malformed query string", "err", err)
+		return errors.New(awserrors.ErrorMalformedQueryString)
+	}
+
+	action := queryArgs["Action"]
+	if action == "" {
+		return errors.New(awserrors.ErrorMissingAction)
+	}
+	handler, ok := autoScalingActions[action]
+	if !ok {
+		return errors.New(awserrors.ErrorInvalidAction)
+	}
+
+	if err := gw.checkPolicy(r, "autoscaling", action); err != nil {
+		return err
+	}
+
+	if gw.NATSConn == nil {
+		return errors.New(awserrors.ErrorServerInternal)
+	}
+
+	accountID, _ := r.Context().Value(ctxAccountID).(string)
+	if accountID == "" {
+		slog.Error("AutoScaling_Request: no account ID in auth context")
+		return errors.New(awserrors.ErrorServerInternal)
+	}
+
+	xmlOutput, err := handler(action, queryArgs, gw, accountID)
+	if err != nil {
+		return err
+	}
+
+	xmlOutput = addRequestID(xmlOutput, requestIDOf(r), true)
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(xmlOutput); err != nil {
+		slog.Error("Failed to write Auto Scaling response", "err", err)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package gateway_autoscaling
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_autoscaling "github.com/mulgadc/spinifex/spinifex/handlers/autoscaling"
+	"github.com/nats-io/nats.go"
+)
+
+// ValidateCreateAutoScalingGroupInput validates the input parameters
+func ValidateCreateAutoScalingGroupInput(input *autoscaling.CreateAutoScalingGroupInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if input.AutoScalingGroupName == nil || *input.AutoScalingGroupName == "" {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	if input.MinSize == nil || input.MaxSize == nil {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	return nil
+}
+
+// CreateAutoScalingGroup handles the Auto Scaling CreateAutoScalingGroup API call.
+func CreateAutoScalingGroup(input *autoscaling.CreateAutoScalingGroupInput, natsConn *nats.Conn, accountID string) (autoscaling.CreateAutoScalingGroupOutput, error) {
+	var output autoscaling.CreateAutoScalingGroupOutput
+
+	if err := ValidateCreateAutoScalingGroupInput(input); err != nil {
+		return output, err
+	}
+
+	svc := handlers_autoscaling.NewNATSAutoScalingService(natsConn)
+	result, err := svc.CreateAutoScalingGroup(input, accountID)
+	if err != nil {
+		return output, err
+	}
+
+	return *result, nil
+}
@@ -0,0 +1,38 @@
+package gateway_autoscaling
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_autoscaling "github.com/mulgadc/spinifex/spinifex/handlers/autoscaling"
+	"github.com/nats-io/nats.go"
+)
+
+// ValidateDeleteAutoScalingGroupInput validates the input parameters
+func ValidateDeleteAutoScalingGroupInput(input *autoscaling.DeleteAutoScalingGroupInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if input.AutoScalingGroupName == nil || *input.AutoScalingGroupName == "" {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	return nil
+}
+
+// DeleteAutoScalingGroup handles the Auto Scaling DeleteAutoScalingGroup API call.
+func DeleteAutoScalingGroup(input *autoscaling.DeleteAutoScalingGroupInput, natsConn *nats.Conn, accountID string) (autoscaling.DeleteAutoScalingGroupOutput, error) {
+	var output autoscaling.DeleteAutoScalingGroupOutput
+
+	if err := ValidateDeleteAutoScalingGroupInput(input); err != nil {
+		return output, err
+	}
+
+	svc := handlers_autoscaling.NewNATSAutoScalingService(natsConn)
+	result, err := svc.DeleteAutoScalingGroup(input, accountID)
+	if err != nil {
+		return output, err
+	}
+
+	return *result, nil
+}
@@ -0,0 +1,35 @@
+package gateway_autoscaling
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_autoscaling "github.com/mulgadc/spinifex/spinifex/handlers/autoscaling"
+	"github.com/nats-io/nats.go"
+)
+
+// ValidateDescribeAutoScalingGroupsInput validates the input parameters
+func ValidateDescribeAutoScalingGroupsInput(input *autoscaling.DescribeAutoScalingGroupsInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	return nil
+}
+
+// DescribeAutoScalingGroups handles the Auto Scaling DescribeAutoScalingGroups API call.
+func DescribeAutoScalingGroups(input *autoscaling.DescribeAutoScalingGroupsInput, natsConn *nats.Conn, accountID string) (autoscaling.DescribeAutoScalingGroupsOutput, error) {
+	var output autoscaling.DescribeAutoScalingGroupsOutput
+
+	if err := ValidateDescribeAutoScalingGroupsInput(input); err != nil {
+		return output, err
+	}
+
+	svc := handlers_autoscaling.NewNATSAutoScalingService(natsConn)
+	result, err := svc.DescribeAutoScalingGroups(input, accountID)
+	if err != nil {
+		return output, err
+	}
+
+	return *result, nil
+}
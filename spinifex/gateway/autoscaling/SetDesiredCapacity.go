@@ -0,0 +1,41 @@
+package gateway_autoscaling
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_autoscaling "github.com/mulgadc/spinifex/spinifex/handlers/autoscaling"
+	"github.com/nats-io/nats.go"
+)
+
+// ValidateSetDesiredCapacityInput validates the input parameters
+func ValidateSetDesiredCapacityInput(input *autoscaling.SetDesiredCapacityInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if input.AutoScalingGroupName == nil || *input.AutoScalingGroupName == "" {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	if input.DesiredCapacity == nil {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	return nil
+}
+
+// SetDesiredCapacity handles the Auto Scaling SetDesiredCapacity API call.
+func SetDesiredCapacity(input *autoscaling.SetDesiredCapacityInput, natsConn *nats.Conn, accountID string) (autoscaling.SetDesiredCapacityOutput, error) {
+	var output autoscaling.SetDesiredCapacityOutput
+
+	if err := ValidateSetDesiredCapacityInput(input); err != nil {
+		return output, err
+	}
+
+	svc := handlers_autoscaling.NewNATSAutoScalingService(natsConn)
+	result, err := svc.SetDesiredCapacity(input, accountID)
+	if err != nil {
+		return output, err
+	}
+
+	return *result, nil
+}
@@ -0,0 +1,38 @@
+package gateway_autoscaling
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_autoscaling "github.com/mulgadc/spinifex/spinifex/handlers/autoscaling"
+	"github.com/nats-io/nats.go"
+)
+
+// ValidateUpdateAutoScalingGroupInput validates the input parameters
+func ValidateUpdateAutoScalingGroupInput(input *autoscaling.UpdateAutoScalingGroupInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if input.AutoScalingGroupName == nil || *input.AutoScalingGroupName == "" {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	return nil
+}
+
+// UpdateAutoScalingGroup handles the Auto Scaling UpdateAutoScalingGroup API call.
+func UpdateAutoScalingGroup(input *autoscaling.UpdateAutoScalingGroupInput, natsConn *nats.Conn, accountID string) (autoscaling.UpdateAutoScalingGroupOutput, error) {
+	var output autoscaling.UpdateAutoScalingGroupOutput
+
+	if err := ValidateUpdateAutoScalingGroupInput(input); err != nil {
+		return output, err
+	}
+
+	svc := handlers_autoscaling.NewNATSAutoScalingService(natsConn)
+	result, err := svc.UpdateAutoScalingGroup(input, accountID)
+	if err != nil {
+		return output, err
+	}
+
+	return *result, nil
+}
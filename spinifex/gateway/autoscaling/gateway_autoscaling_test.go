@@ -0,0 +1,56 @@
+package gateway_autoscaling
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/stretchr/testify/assert"
+)
+
+// These tests validate input validation in the gateway layer.
+// They do not require a NATS connection since validation happens before the NATS call.
+
+func TestCreateAutoScalingGroup_NilInput(t *testing.T) {
+	_, err := CreateAutoScalingGroup(nil, nil, "123456789012")
+	assert.EqualError(t, err, awserrors.ErrorInvalidParameterValue)
+}
+
+func TestCreateAutoScalingGroup_MissingName(t *testing.T) {
+	_, err := CreateAutoScalingGroup(&autoscaling.CreateAutoScalingGroupInput{
+		MinSize: aws.Int64(1),
+		MaxSize: aws.Int64(2),
+	}, nil, "123456789012")
+	assert.EqualError(t, err, awserrors.ErrorMissingParameter)
+}
+
+func TestCreateAutoScalingGroup_MissingSize(t *testing.T) {
+	_, err := CreateAutoScalingGroup(&autoscaling.CreateAutoScalingGroupInput{
+		AutoScalingGroupName: aws.String("web"),
+		MinSize:              aws.Int64(1),
+	}, nil, "123456789012")
+	assert.EqualError(t, err, awserrors.ErrorMissingParameter)
+}
+
+func TestUpdateAutoScalingGroup_MissingName(t *testing.T) {
+	_, err := UpdateAutoScalingGroup(&autoscaling.UpdateAutoScalingGroupInput{}, nil, "123456789012")
+	assert.EqualError(t, err, awserrors.ErrorMissingParameter)
+}
+
+func TestSetDesiredCapacity_MissingCapacity(t *testing.T) {
+	_, err := SetDesiredCapacity(&autoscaling.SetDesiredCapacityInput{
+		AutoScalingGroupName: aws.String("web"),
+	}, nil, "123456789012")
+	assert.EqualError(t, err, awserrors.ErrorMissingParameter)
+}
+
+func TestDeleteAutoScalingGroup_NilInput(t *testing.T) {
+	_, err := DeleteAutoScalingGroup(nil, nil, "123456789012")
+	assert.EqualError(t, err, awserrors.ErrorInvalidParameterValue)
+}
+
+func TestDescribeAutoScalingGroups_NilInput(t *testing.T) {
+	_, err := DescribeAutoScalingGroups(nil, nil, "123456789012")
+	assert.EqualError(t, err, awserrors.ErrorInvalidParameterValue)
+}
@@ -0,0 +1,65 @@
+package gateway
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupAutoScalingRequest(body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	ctx := context.WithValue(req.Context(), ctxService, "autoscaling")
+	ctx = context.WithValue(ctx, ctxAccountID, "123456789012")
+	return req.WithContext(ctx)
+}
+
+func TestAutoScalingRequest_MissingAction(t *testing.T) {
+	gw := &GatewayConfig{DisableLogging: true}
+	err := gw.AutoScaling_Request(httptest.NewRecorder(), setupAutoScalingRequest(""))
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorMissingAction, err.Error())
+}
+
+func TestAutoScalingRequest_UnknownAction(t *testing.T) {
+	gw := &GatewayConfig{DisableLogging: true}
+	err := gw.AutoScaling_Request(httptest.NewRecorder(), setupAutoScalingRequest("Action=PutScalingPolicy"))
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorInvalidAction, err.Error())
+}
+
+func TestAutoScalingActionsMap_AllActionsRegistered(t *testing.T) {
+	expectedActions := []string{
+		"CreateAutoScalingGroup",
+		"UpdateAutoScalingGroup",
+		"SetDesiredCapacity",
+		"DeleteAutoScalingGroup",
+		"DescribeAutoScalingGroups",
+	}
+
+	for _, action := range expectedActions {
+		_, ok := autoScalingActions[action]
+		assert.True(t, ok, "action %q should be registered in autoScalingActions", action)
+	}
+
+	assert.Len(t, autoScalingActions, len(expectedActions), "autoScalingActions should have exactly %d actions", len(expectedActions))
+}
+
+func TestAutoScalingRequest_ErrorFormat(t *testing.T) {
+	// Auto Scaling errors use the IAM-style <ErrorResponse> envelope.
+	gw := &GatewayConfig{DisableLogging: true}
+	w := httptest.NewRecorder()
+	gw.Request(w, setupAutoScalingRequest("Action=DescribeScalingActivities"))
+
+	resp := w.Result()
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, 400, resp.StatusCode)
+	assert.Contains(t, string(body), "<ErrorResponse")
+	assert.Contains(t, string(body), "InvalidAction")
+}
@@ -0,0 +1,100 @@
+package gateway
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/mulgadc/spinifex/spinifex/awsec2query"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	gateway_cloudwatch "github.com/mulgadc/spinifex/spinifex/gateway/cloudwatch"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+)
+
+// CloudWatchHandler processes parsed query args and returns XML response bytes.
+type CloudWatchHandler func(action string, q map[string]string, gw *GatewayConfig, accountID string) ([]byte, error)
+
+// cloudWatchHandler creates a type-safe CloudWatchHandler that allocates the
+// typed input struct, parses query params into it, validates it against the
+// model constraints, calls the handler, and marshals the output to XML. CloudWatch uses the same
+// <ActionResponse><ActionResult> envelope as IAM and ELBv2.
+func cloudWatchHandler[In any](handler func(*In, *GatewayConfig, string) (any, error)) CloudWatchHandler {
+	return func(action string, q map[string]string, gw *GatewayConfig, accountID string) ([]byte, error) {
+		input := new(In)
+		if err := awsec2query.QueryParamsToStruct(q, input); err != nil {
+			if errors.Is(err, awsec2query.ErrSliceTooLarge) {
+				return nil, errors.New(awserrors.ErrorMalformedQueryString)
+			}
+			return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+		}
+		if err := validateInput(input); err != nil {
+			return nil, err
+		}
+		output, err := handler(input, gw, accountID)
+		if err != nil {
+			return nil, err
+		}
+		payload := utils.GenerateIAMXMLPayload(action, output)
+		xmlOutput, err := utils.MarshalToXML(payload)
+		if err != nil {
+			return nil, errors.New("failed to marshal response to XML")
+		}
+		return xmlOutput, nil
+	}
+}
+
+var cloudWatchActions = map[string]CloudWatchHandler{
+	"GetMetricStatistics": cloudWatchHandler(func(input *cloudwatch.GetMetricStatisticsInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_cloudwatch.GetMetricStatistics(input, gw.NATSConn, gw.DiscoverActiveNodes(), accountID)
+	}),
+	"ListMetrics": cloudWatchHandler(func(input *cloudwatch.ListMetricsInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_cloudwatch.ListMetrics(input, gw.NATSConn, gw.DiscoverActiveNodes(), accountID)
+	}),
+}
+
+// CloudWatch_Request serves the CloudWatch query API (SigV4 service
+// "monitoring"). Only instance metrics are available.
+func (gw *GatewayConfig) CloudWatch_Request(w http.ResponseWriter, r *http.Request) error {
+	queryArgs, err := readQueryArgs(r)
+	if err != nil {
+		slog.Debug("CloudWatch: malformed query string", "err", err)
+		return errors.New(awserrors.ErrorMalformedQueryString)
+	}
+
+	action := queryArgs["Action"]
+	if action == "" {
+		return errors.New(awserrors.ErrorMissingAction)
+	}
+	handler, ok := cloudWatchActions[action]
+	if !ok {
+		return errors.New(awserrors.ErrorInvalidAction)
+	}
+
+	if err := gw.checkPolicy(r, "cloudwatch", action); err != nil {
+		return err
+	}
+
+	if gw.NATSConn == nil {
+		return errors.New(awserrors.ErrorServerInternal)
+	}
+
+	accountID, _ := r.Context().Value(ctxAccountID).(string)
+	if accountID == "" {
+		slog.Error("CloudWatch_Request: no account ID in auth context")
+		return errors.New(awserrors.ErrorServerInternal)
+	}
+
+	xmlOutput, err := handler(action, queryArgs, gw, accountID)
+	if err != nil {
+		return err
+	}
+
+	xmlOutput = addRequestID(xmlOutput, requestIDOf(r), true)
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(xmlOutput); err != nil {
+		slog.Error("Failed to write CloudWatch response", "err", err)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package gateway_cloudwatch
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/nats-io/nats.go"
+)
+
+// maxDatapoints is the most datapoints GetMetricStatistics returns, as in
+// AWS.
+const maxDatapoints = 1440
+
+// metricResolution is how often nodes sample instance metrics, and so the
+// finest period GetMetricStatistics can aggregate over.
+const metricResolution = 60
+
+// percentilePattern matches an extended statistic, p0.0 to p100.
+var percentilePattern = regexp.MustCompile(`^p(\d{1,2}(\.\d{1,2})?|100)$`)
+
+// ValidateGetMetricStatisticsInput validates the input parameters.
+func ValidateGetMetricStatisticsInput(input *cloudwatch.GetMetricStatisticsInput) error {
+	if input == nil || aws.StringValue(input.Namespace) == "" || aws.StringValue(input.MetricName) == "" ||
+		input.StartTime == nil || input.EndTime == nil || input.Period == nil {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	if len(input.Statistics) == 0 && len(input.ExtendedStatistics) == 0 {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	if len(input.Statistics) > 0 && len(input.ExtendedStatistics) > 0 {
+		return errors.New(awserrors.ErrorInvalidParameterCombination)
+	}
+	for _, stat := range input.Statistics {
+		if !slices.Contains(cloudwatch.Statistic_Values(), aws.StringValue(stat)) {
+			return awserrors.WithDetail(awserrors.ErrorInvalidParameterValue, "unsupported statistic "+aws.StringValue(stat))
+		}
+	}
+	for _, stat := range input.ExtendedStatistics {
+		if !percentilePattern.MatchString(aws.StringValue(stat)) {
+			return awserrors.WithDetail(awserrors.ErrorInvalidParameterValue, "unsupported extended statistic "+aws.StringValue(stat))
+		}
+	}
+	for _, dim := range input.Dimensions {
+		if dim == nil || aws.StringValue(dim.Name) == "" || aws.StringValue(dim.Value) == "" {
+			return errors.New(awserrors.ErrorInvalidParameterValue)
+		}
+	}
+
+	period := aws.Int64Value(input.Period)
+	if period < metricResolution || period%metricResolution != 0 {
+		return awserrors.WithDetail(awserrors.ErrorInvalidParameterValue, "the period must be a multiple of 60 seconds")
+	}
+	if !input.StartTime.Before(*input.EndTime) {
+		return awserrors.WithDetail(awserrors.ErrorInvalidParameterValue, "the start time must be before the end time")
+	}
+	if buckets := input.EndTime.Sub(*input.StartTime) / (time.Duration(period) * time.Second); buckets > maxDatapoints {
+		return awserrors.WithDetail(awserrors.ErrorInvalidParameterCombination, "the request would return more than 1440 datapoints")
+	}
+	return nil
+}
+
+// GetMetricStatistics aggregates an instance metric over each period between
+// StartTime and EndTime. With an InstanceId dimension it covers that
+// instance, and with no dimensions all the caller's instances; metrics
+// aren't kept by any other dimension, so those return no datapoints.
+func GetMetricStatistics(input *cloudwatch.GetMetricStatisticsInput, natsConn *nats.Conn, expectedNodes int, accountID string) (*cloudwatch.GetMetricStatisticsOutput, error) {
+	if err := ValidateGetMetricStatisticsInput(input); err != nil {
+		return nil, err
+	}
+
+	metricName := aws.StringValue(input.MetricName)
+	output := &cloudwatch.GetMetricStatisticsOutput{
+		Label:      input.MetricName,
+		Datapoints: []*cloudwatch.Datapoint{},
+	}
+
+	unit, known := types.InstanceMetricUnits[metricName]
+	if !known || aws.StringValue(input.Namespace) != types.InstanceMetricNamespace ||
+		input.Unit != nil && aws.StringValue(input.Unit) != unit {
+		return output, nil
+	}
+
+	query := &types.GetInstanceMetricsInput{
+		MetricName: metricName,
+		StartTime:  *input.StartTime,
+		EndTime:    *input.EndTime,
+	}
+	switch {
+	case len(input.Dimensions) == 0:
+	case len(input.Dimensions) == 1 && aws.StringValue(input.Dimensions[0].Name) == instanceIDDimension:
+		query.InstanceIDs = []string{aws.StringValue(input.Dimensions[0].Value)}
+	default:
+		return output, nil
+	}
+
+	instances, err := getInstanceMetrics(query, natsConn, expectedNodes, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	period := time.Duration(aws.Int64Value(input.Period)) * time.Second
+	buckets := map[time.Time][]float64{}
+	for _, metrics := range instances {
+		for _, sample := range metrics[metricName] {
+			start := input.StartTime.Add(sample.Timestamp.Sub(*input.StartTime) / period * period)
+			buckets[start] = append(buckets[start], sample.Value)
+		}
+	}
+
+	for start, values := range buckets {
+		output.Datapoints = append(output.Datapoints, datapoint(start, unit, values, input))
+	}
+	slices.SortFunc(output.Datapoints, func(a, b *cloudwatch.Datapoint) int {
+		return a.Timestamp.Compare(*b.Timestamp)
+	})
+	return output, nil
+}
+
+// datapoint computes the requested statistics of the samples in a period.
+func datapoint(start time.Time, unit string, values []float64, input *cloudwatch.GetMetricStatisticsInput) *cloudwatch.Datapoint {
+	dp := &cloudwatch.Datapoint{
+		Timestamp: aws.Time(start),
+		Unit:      aws.String(unit),
+	}
+
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	for _, stat := range input.Statistics {
+		switch aws.StringValue(stat) {
+		case cloudwatch.StatisticSampleCount:
+			dp.SampleCount = aws.Float64(float64(len(values)))
+		case cloudwatch.StatisticSum:
+			dp.Sum = aws.Float64(sum)
+		case cloudwatch.StatisticAverage:
+			dp.Average = aws.Float64(sum / float64(len(values)))
+		case cloudwatch.StatisticMinimum:
+			dp.Minimum = aws.Float64(slices.Min(values))
+		case cloudwatch.StatisticMaximum:
+			dp.Maximum = aws.Float64(slices.Max(values))
+		}
+	}
+
+	if len(input.ExtendedStatistics) > 0 {
+		sorted := slices.Sorted(slices.Values(values))
+		dp.ExtendedStatistics = map[string]*float64{}
+		for _, stat := range input.ExtendedStatistics {
+			name := aws.StringValue(stat)
+			p, _ := strconv.ParseFloat(name[1:], 64)
+			dp.ExtendedStatistics[name] = aws.Float64(percentile(sorted, p))
+		}
+	}
+	return dp
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(0, rank-1)]
+}
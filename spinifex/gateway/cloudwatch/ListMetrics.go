@@ -0,0 +1,82 @@
+package gateway_cloudwatch
+
+import (
+	"cmp"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+)
+
+// recentlyActive is the only RecentlyActive window CloudWatch accepts.
+const recentlyActive = "PT3H"
+
+// ValidateListMetricsInput validates the input parameters.
+func ValidateListMetricsInput(input *cloudwatch.ListMetricsInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	if r := aws.StringValue(input.RecentlyActive); r != "" && r != recentlyActive {
+		return awserrors.WithDetail(awserrors.ErrorInvalidParameterValue, "RecentlyActive must be PT3H")
+	}
+	for _, dim := range input.Dimensions {
+		if dim == nil || aws.StringValue(dim.Name) == "" {
+			return errors.New(awserrors.ErrorInvalidParameterValue)
+		}
+	}
+	return nil
+}
+
+// ListMetrics lists the instance metrics that have samples, one per metric
+// and instance, narrowed by namespace, metric name and dimension filters.
+// All metrics are returned at once, without a NextToken.
+func ListMetrics(input *cloudwatch.ListMetricsInput, natsConn *nats.Conn, expectedNodes int, accountID string) (*cloudwatch.ListMetricsOutput, error) {
+	if err := ValidateListMetricsInput(input); err != nil {
+		return nil, err
+	}
+
+	output := &cloudwatch.ListMetricsOutput{Metrics: []*cloudwatch.Metric{}}
+	if ns := aws.StringValue(input.Namespace); ns != "" && ns != types.InstanceMetricNamespace {
+		return output, nil
+	}
+
+	query := &types.GetInstanceMetricsInput{MetricName: aws.StringValue(input.MetricName), NamesOnly: true}
+	if aws.StringValue(input.RecentlyActive) == recentlyActive {
+		query.StartTime = utils.Now().Add(-3 * time.Hour)
+	}
+	for _, dim := range input.Dimensions {
+		if aws.StringValue(dim.Name) != instanceIDDimension {
+			return output, nil
+		}
+		if dim.Value != nil {
+			query.InstanceIDs = append(query.InstanceIDs, aws.StringValue(dim.Value))
+		}
+	}
+
+	instances, err := getInstanceMetrics(query, natsConn, expectedNodes, accountID)
+	if err != nil {
+		return nil, err
+	}
+	for id, metrics := range instances {
+		for name := range metrics {
+			output.Metrics = append(output.Metrics, &cloudwatch.Metric{
+				Namespace:  aws.String(types.InstanceMetricNamespace),
+				MetricName: aws.String(name),
+				Dimensions: []*cloudwatch.Dimension{{Name: aws.String(instanceIDDimension), Value: aws.String(id)}},
+			})
+		}
+	}
+	slices.SortFunc(output.Metrics, func(a, b *cloudwatch.Metric) int {
+		return cmp.Or(
+			cmp.Compare(aws.StringValue(a.MetricName), aws.StringValue(b.MetricName)),
+			cmp.Compare(aws.StringValue(a.Dimensions[0].Value), aws.StringValue(b.Dimensions[0].Value)),
+		)
+	})
+	return output, nil
+}
@@ -0,0 +1,257 @@
+package gateway_cloudwatch
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/testutil"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAccountID = "123456789012"
+
+var testStart = time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+// serveNode answers instance metric queries like a node holding instances.
+func serveNode(t *testing.T, nc *nats.Conn, instances map[string]map[string][]types.MetricSample) *[]types.GetInstanceMetricsInput {
+	t.Helper()
+	var queries []types.GetInstanceMetricsInput
+	_, err := nc.Subscribe("cloudwatch.GetInstanceMetrics", func(msg *nats.Msg) {
+		var input types.GetInstanceMetricsInput
+		require.NoError(t, json.Unmarshal(msg.Data, &input))
+		assert.Equal(t, testAccountID, msg.Header.Get(utils.AccountIDHeader))
+		queries = append(queries, input)
+		data, _ := json.Marshal(&types.GetInstanceMetricsOutput{Instances: instances})
+		msg.Respond(data)
+	})
+	require.NoError(t, err)
+	return &queries
+}
+
+func samplesAt(values ...float64) []types.MetricSample {
+	samples := make([]types.MetricSample, len(values))
+	for i, v := range values {
+		samples[i] = types.MetricSample{Timestamp: testStart.Add(time.Duration(i) * time.Minute), Value: v}
+	}
+	return samples
+}
+
+func TestValidateGetMetricStatisticsInput(t *testing.T) {
+	valid := func(mut func(*cloudwatch.GetMetricStatisticsInput)) *cloudwatch.GetMetricStatisticsInput {
+		input := &cloudwatch.GetMetricStatisticsInput{
+			Namespace:  aws.String("AWS/EC2"),
+			MetricName: aws.String("CPUUtilization"),
+			StartTime:  aws.Time(testStart),
+			EndTime:    aws.Time(testStart.Add(time.Hour)),
+			Period:     aws.Int64(300),
+			Statistics: aws.StringSlice([]string{"Average"}),
+		}
+		if mut != nil {
+			mut(input)
+		}
+		return input
+	}
+
+	tests := []struct {
+		name  string
+		input *cloudwatch.GetMetricStatisticsInput
+		want  string
+	}{
+		{"nil input", nil, awserrors.ErrorMissingParameter},
+		{"missing metric", valid(func(i *cloudwatch.GetMetricStatisticsInput) { i.MetricName = nil }), awserrors.ErrorMissingParameter},
+		{"missing period", valid(func(i *cloudwatch.GetMetricStatisticsInput) { i.Period = nil }), awserrors.ErrorMissingParameter},
+		{"no statistics", valid(func(i *cloudwatch.GetMetricStatisticsInput) { i.Statistics = nil }), awserrors.ErrorMissingParameter},
+		{"both statistics", valid(func(i *cloudwatch.GetMetricStatisticsInput) { i.ExtendedStatistics = aws.StringSlice([]string{"p99"}) }), awserrors.ErrorInvalidParameterCombination},
+		{"bad statistic", valid(func(i *cloudwatch.GetMetricStatisticsInput) { i.Statistics = aws.StringSlice([]string{"Median"}) }), awserrors.ErrorInvalidParameterValue},
+		{"bad percentile", valid(func(i *cloudwatch.GetMetricStatisticsInput) {
+			i.Statistics = nil
+			i.ExtendedStatistics = aws.StringSlice([]string{"p101"})
+		}), awserrors.ErrorInvalidParameterValue},
+		{"sub-minute period", valid(func(i *cloudwatch.GetMetricStatisticsInput) { i.Period = aws.Int64(30) }), awserrors.ErrorInvalidParameterValue},
+		{"odd period", valid(func(i *cloudwatch.GetMetricStatisticsInput) { i.Period = aws.Int64(90) }), awserrors.ErrorInvalidParameterValue},
+		{"end before start", valid(func(i *cloudwatch.GetMetricStatisticsInput) { i.EndTime = aws.Time(testStart) }), awserrors.ErrorInvalidParameterValue},
+		{"too many datapoints", valid(func(i *cloudwatch.GetMetricStatisticsInput) {
+			i.Period = aws.Int64(60)
+			i.EndTime = aws.Time(testStart.Add(25 * time.Hour))
+		}), awserrors.ErrorInvalidParameterCombination},
+		{"empty dimension", valid(func(i *cloudwatch.GetMetricStatisticsInput) {
+			i.Dimensions = []*cloudwatch.Dimension{{Name: aws.String("InstanceId")}}
+		}), awserrors.ErrorInvalidParameterValue},
+		{"valid", valid(nil), ""},
+		{"valid percentile", valid(func(i *cloudwatch.GetMetricStatisticsInput) {
+			i.Statistics = nil
+			i.ExtendedStatistics = aws.StringSlice([]string{"p99.9", "p50"})
+		}), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateGetMetricStatisticsInput(tt.input)
+			if tt.want == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Equal(t, tt.want, err.Error())
+		})
+	}
+}
+
+func TestGetMetricStatistics(t *testing.T) {
+	_, nc := testutil.StartTestNATS(t)
+	queries := serveNode(t, nc, map[string]map[string][]types.MetricSample{
+		"i-0aaa": {"CPUUtilization": samplesAt(10, 20, 30, 40, 50, 60)},
+		"i-0bbb": {"CPUUtilization": samplesAt(90)},
+	})
+
+	input := &cloudwatch.GetMetricStatisticsInput{
+		Namespace:  aws.String("AWS/EC2"),
+		MetricName: aws.String("CPUUtilization"),
+		StartTime:  aws.Time(testStart),
+		EndTime:    aws.Time(testStart.Add(10 * time.Minute)),
+		Period:     aws.Int64(300),
+		Statistics: aws.StringSlice([]string{"Average", "Maximum", "SampleCount"}),
+	}
+
+	// With no dimensions, all the caller's instances are aggregated.
+	out, err := GetMetricStatistics(input, nc, 1, testAccountID)
+	require.NoError(t, err)
+	assert.Equal(t, "CPUUtilization", aws.StringValue(out.Label))
+	require.Len(t, out.Datapoints, 2)
+	first, second := out.Datapoints[0], out.Datapoints[1]
+	assert.Equal(t, testStart, aws.TimeValue(first.Timestamp))
+	assert.Equal(t, 6.0, aws.Float64Value(first.SampleCount))
+	assert.InDelta(t, 40.0, aws.Float64Value(first.Average), 1e-9)
+	assert.Equal(t, 90.0, aws.Float64Value(first.Maximum))
+	assert.Nil(t, first.Sum)
+	assert.Equal(t, "Percent", aws.StringValue(first.Unit))
+	assert.Equal(t, testStart.Add(5*time.Minute), aws.TimeValue(second.Timestamp))
+	assert.Equal(t, 60.0, aws.Float64Value(second.Average))
+
+	require.Len(t, *queries, 1)
+	assert.Equal(t, "CPUUtilization", (*queries)[0].MetricName)
+	assert.Empty(t, (*queries)[0].InstanceIDs)
+
+	// An InstanceId dimension narrows the query to that instance.
+	input.Dimensions = []*cloudwatch.Dimension{{Name: aws.String("InstanceId"), Value: aws.String("i-0aaa")}}
+	input.Statistics = nil
+	input.ExtendedStatistics = aws.StringSlice([]string{"p50"})
+	_, err = GetMetricStatistics(input, nc, 1, testAccountID)
+	require.NoError(t, err)
+	require.Len(t, *queries, 2)
+	assert.Equal(t, []string{"i-0aaa"}, (*queries)[1].InstanceIDs)
+
+	// Metrics outside AWS/EC2, kept by other dimensions or in another unit
+	// have no datapoints, and don't reach the nodes.
+	for _, mut := range []func(*cloudwatch.GetMetricStatisticsInput){
+		func(i *cloudwatch.GetMetricStatisticsInput) { i.Namespace = aws.String("AWS/EBS") },
+		func(i *cloudwatch.GetMetricStatisticsInput) { i.MetricName = aws.String("StatusCheckFailed") },
+		func(i *cloudwatch.GetMetricStatisticsInput) {
+			i.Dimensions = []*cloudwatch.Dimension{{Name: aws.String("AutoScalingGroupName"), Value: aws.String("asg")}}
+		},
+		func(i *cloudwatch.GetMetricStatisticsInput) { i.Unit = aws.String("Bytes") },
+	} {
+		other := *input
+		mut(&other)
+		out, err := GetMetricStatistics(&other, nc, 1, testAccountID)
+		require.NoError(t, err)
+		assert.Empty(t, out.Datapoints)
+	}
+	assert.Len(t, *queries, 2)
+}
+
+func TestDatapointPercentile(t *testing.T) {
+	input := &cloudwatch.GetMetricStatisticsInput{ExtendedStatistics: aws.StringSlice([]string{"p50", "p90", "p100", "p0"})}
+	dp := datapoint(testStart, "Percent", []float64{5, 1, 4, 2, 3, 10, 9, 8, 7, 6}, input)
+	assert.Equal(t, 5.0, aws.Float64Value(dp.ExtendedStatistics["p50"]))
+	assert.Equal(t, 9.0, aws.Float64Value(dp.ExtendedStatistics["p90"]))
+	assert.Equal(t, 10.0, aws.Float64Value(dp.ExtendedStatistics["p100"]))
+	assert.Equal(t, 1.0, aws.Float64Value(dp.ExtendedStatistics["p0"]))
+}
+
+func TestListMetrics(t *testing.T) {
+	_, nc := testutil.StartTestNATS(t)
+	queries := serveNode(t, nc, map[string]map[string][]types.MetricSample{
+		"i-0bbb": {"NetworkIn": nil, "CPUUtilization": nil},
+		"i-0aaa": {"CPUUtilization": nil},
+	})
+
+	out, err := ListMetrics(&cloudwatch.ListMetricsInput{}, nc, 1, testAccountID)
+	require.NoError(t, err)
+	var got []string
+	for _, m := range out.Metrics {
+		assert.Equal(t, "AWS/EC2", aws.StringValue(m.Namespace))
+		require.Len(t, m.Dimensions, 1)
+		assert.Equal(t, "InstanceId", aws.StringValue(m.Dimensions[0].Name))
+		got = append(got, aws.StringValue(m.MetricName)+"/"+aws.StringValue(m.Dimensions[0].Value))
+	}
+	assert.Equal(t, []string{"CPUUtilization/i-0aaa", "CPUUtilization/i-0bbb", "NetworkIn/i-0bbb"}, got)
+	require.Len(t, *queries, 1)
+	assert.True(t, (*queries)[0].NamesOnly)
+	assert.True(t, (*queries)[0].StartTime.IsZero())
+
+	_, err = ListMetrics(&cloudwatch.ListMetricsInput{
+		MetricName:     aws.String("CPUUtilization"),
+		RecentlyActive: aws.String("PT3H"),
+		Dimensions:     []*cloudwatch.DimensionFilter{{Name: aws.String("InstanceId"), Value: aws.String("i-0aaa")}},
+	}, nc, 1, testAccountID)
+	require.NoError(t, err)
+	require.Len(t, *queries, 2)
+	assert.Equal(t, "CPUUtilization", (*queries)[1].MetricName)
+	assert.Equal(t, []string{"i-0aaa"}, (*queries)[1].InstanceIDs)
+	assert.False(t, (*queries)[1].StartTime.IsZero())
+
+	out, err = ListMetrics(&cloudwatch.ListMetricsInput{Namespace: aws.String("AWS/Lambda")}, nc, 1, testAccountID)
+	require.NoError(t, err)
+	assert.Empty(t, out.Metrics)
+
+	_, err = ListMetrics(&cloudwatch.ListMetricsInput{RecentlyActive: aws.String("PT1H")}, nc, 1, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorInvalidParameterValue)
+}
+
+func TestGetInstanceMetrics_Pages(t *testing.T) {
+	_, nc := testutil.StartTestNATS(t)
+	// Nodes holding the samples of one instance each: i-0aaa's pages them
+	// two at a time, i-0bbb's sends everything from StartTime on.
+	var pages []time.Time
+	serve := func(instanceID string, pageSize int) {
+		_, err := nc.Subscribe("cloudwatch.GetInstanceMetrics", func(msg *nats.Msg) {
+			var input types.GetInstanceMetricsInput
+			require.NoError(t, json.Unmarshal(msg.Data, &input))
+			if pageSize > 0 {
+				pages = append(pages, input.StartTime)
+			}
+			var kept []types.MetricSample
+			output := types.GetInstanceMetricsOutput{}
+			for _, sample := range samplesAt(1, 2, 3, 4, 5) {
+				if sample.Timestamp.Before(input.StartTime) {
+					continue
+				}
+				if pageSize > 0 && len(kept) == pageSize {
+					output.NextStartTime = sample.Timestamp
+					break
+				}
+				kept = append(kept, sample)
+			}
+			output.Instances = map[string]map[string][]types.MetricSample{instanceID: {"CPUUtilization": kept}}
+			data, _ := json.Marshal(&output)
+			msg.Respond(data)
+		})
+		require.NoError(t, err)
+	}
+	serve("i-0aaa", 2)
+	serve("i-0bbb", 0)
+
+	instances, err := getInstanceMetrics(&types.GetInstanceMetricsInput{StartTime: testStart}, nc, 2, testAccountID)
+	require.NoError(t, err)
+	assert.Equal(t, samplesAt(1, 2, 3, 4, 5), instances["i-0aaa"]["CPUUtilization"])
+	assert.Equal(t, samplesAt(1, 2, 3, 4, 5), instances["i-0bbb"]["CPUUtilization"], "samples sent again on a later page aren't duplicated")
+	assert.Equal(t, []time.Time{testStart, testStart.Add(2 * time.Minute), testStart.Add(4 * time.Minute)}, pages)
+}
@@ -0,0 +1,118 @@
+package gateway_cloudwatch
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+)
+
+// instanceIDDimension is the only dimension instance metrics are kept by.
+const instanceIDDimension = "InstanceId"
+
+// metricsTimeout bounds how long to wait for the nodes to report samples.
+const metricsTimeout = 3 * time.Second
+
+// getInstanceMetrics collects instance metric samples from every node. An
+// instance that moved between nodes has samples on each, so they are merged
+// in time order. A node with more samples than fit one reply pages them, so
+// the window is asked for again from the earliest point a node stopped at.
+func getInstanceMetrics(input *types.GetInstanceMetricsInput, natsConn *nats.Conn, expectedNodes int, accountID string) (map[string]map[string][]types.MetricSample, error) {
+	merged := map[string]map[string][]types.MetricSample{}
+	query := *input
+	for {
+		replies, err := queryInstanceMetrics(&query, natsConn, expectedNodes, accountID)
+		if err != nil {
+			return nil, err
+		}
+
+		// Every node sent all its samples before its own NextStartTime, so
+		// the window is complete up to the earliest of them.
+		var next time.Time
+		for _, reply := range replies {
+			if !reply.NextStartTime.IsZero() && (next.IsZero() || reply.NextStartTime.Before(next)) {
+				next = reply.NextStartTime
+			}
+		}
+		for _, reply := range replies {
+			for id, metrics := range reply.Instances {
+				if merged[id] == nil {
+					merged[id] = map[string][]types.MetricSample{}
+				}
+				for name, samples := range metrics {
+					kept := merged[id][name]
+					for _, sample := range samples {
+						if next.IsZero() || sample.Timestamp.Before(next) {
+							kept = append(kept, sample)
+						}
+					}
+					merged[id][name] = kept
+				}
+			}
+		}
+		if next.IsZero() || !next.After(query.StartTime) {
+			break
+		}
+		query.StartTime = next
+	}
+
+	for _, metrics := range merged {
+		for _, samples := range metrics {
+			slices.SortFunc(samples, func(a, b types.MetricSample) int {
+				return a.Timestamp.Compare(b.Timestamp)
+			})
+		}
+	}
+	return merged, nil
+}
+
+// queryInstanceMetrics fans input out to the nodes and returns their
+// replies.
+func queryInstanceMetrics(input *types.GetInstanceMetricsInput, natsConn *nats.Conn, expectedNodes int, accountID string) ([]types.GetInstanceMetricsOutput, error) {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return nil, err
+	}
+
+	inbox := nats.NewInbox()
+	sub, err := natsConn.SubscribeSync(inbox)
+	if err != nil {
+		return nil, err
+	}
+	defer sub.Unsubscribe()
+
+	pubMsg := nats.NewMsg(utils.Subject("cloudwatch.GetInstanceMetrics"))
+	pubMsg.Reply = inbox
+	pubMsg.Data = data
+	pubMsg.Header.Set(utils.AccountIDHeader, accountID)
+	if err := natsConn.PublishMsg(pubMsg); err != nil {
+		slog.Error("CloudWatch: failed to query instance metrics", "err", err)
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+
+	var replies []types.GetInstanceMetricsOutput
+	deadline := time.Now().Add(metricsTimeout)
+	for responses := 0; expectedNodes <= 0 || responses < expectedNodes; responses++ {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			break
+		}
+		msg, err := sub.NextMsg(remaining)
+		if err != nil {
+			break
+		}
+		var nodeOutput types.GetInstanceMetricsOutput
+		if err := json.Unmarshal(msg.Data, &nodeOutput); err != nil {
+			slog.Debug("CloudWatch: skipping malformed metrics reply", "err", err)
+			continue
+		}
+		replies = append(replies, nodeOutput)
+	}
+	return replies, nil
+}
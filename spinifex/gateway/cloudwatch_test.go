@@ -0,0 +1,62 @@
+package gateway
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupCloudWatchRequest(body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	ctx := context.WithValue(req.Context(), ctxService, "monitoring")
+	ctx = context.WithValue(ctx, ctxAccountID, "123456789012")
+	return req.WithContext(ctx)
+}
+
+func TestCloudWatchRequest_MissingAction(t *testing.T) {
+	gw := &GatewayConfig{DisableLogging: true}
+	err := gw.CloudWatch_Request(httptest.NewRecorder(), setupCloudWatchRequest(""))
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorMissingAction, err.Error())
+}
+
+func TestCloudWatchRequest_UnknownAction(t *testing.T) {
+	gw := &GatewayConfig{DisableLogging: true}
+	err := gw.CloudWatch_Request(httptest.NewRecorder(), setupCloudWatchRequest("Action=PutMetricAlarm"))
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorInvalidAction, err.Error())
+}
+
+func TestCloudWatchActionsMap_AllActionsRegistered(t *testing.T) {
+	expectedActions := []string{
+		"GetMetricStatistics",
+		"ListMetrics",
+	}
+
+	for _, action := range expectedActions {
+		_, ok := cloudWatchActions[action]
+		assert.True(t, ok, "action %q should be registered in cloudWatchActions", action)
+	}
+
+	assert.Len(t, cloudWatchActions, len(expectedActions), "cloudWatchActions should have exactly %d actions", len(expectedActions))
+}
+
+func TestCloudWatchRequest_ErrorFormat(t *testing.T) {
+	// CloudWatch errors use the IAM-style <ErrorResponse> envelope.
+	gw := &GatewayConfig{DisableLogging: true}
+	w := httptest.NewRecorder()
+	gw.Request(w, setupCloudWatchRequest("Action=DescribeAlarms"))
+
+	resp := w.Result()
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, 400, resp.StatusCode)
+	assert.Contains(t, string(body), "<ErrorResponse")
+	assert.Contains(t, string(body), "InvalidAction")
+}
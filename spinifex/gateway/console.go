@@ -0,0 +1,180 @@
+package gateway
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+	"golang.org/x/net/websocket"
+)
+
+// consoleAction is the IAM action console sessions are authorized as,
+// against the instance's ARN.
+const consoleAction = "ConnectInstanceConsole"
+
+// consoleKeepalive is how often the proxy tells the node an idle session is
+// still wanted. It must stay well under the node's idle timeout.
+var consoleKeepalive = 30 * time.Second
+
+// consoleOpenTimeout bounds the wait for the node hosting the instance to
+// connect to its console.
+const consoleOpenTimeout = 10 * time.Second
+
+// consoleBacklog is how many output messages are buffered while the
+// websocket handshake completes or the client falls behind.
+const consoleBacklog = 256
+
+// InstanceConsole proxies an instance's serial console (?type=serial, the
+// default) or VNC display (?type=vnc) over a websocket, for the UI. Browsers
+// can't set an Authorization header on a websocket, so callers sign the URL
+// as a presigned GET; the output is relayed as binary frames.
+func (gw *GatewayConfig) InstanceConsole(w http.ResponseWriter, r *http.Request) {
+	instanceID := chi.URLParam(r, "instanceId")
+	if !strings.HasPrefix(instanceID, "i-") {
+		gw.ErrorHandler(w, r, errors.New(awserrors.ErrorInvalidInstanceIDMalformed))
+		return
+	}
+	consoleType := r.URL.Query().Get("type")
+	if consoleType == "" {
+		consoleType = types.ConsoleSerial
+	}
+	if consoleType != types.ConsoleSerial && consoleType != types.ConsoleVNC {
+		gw.ErrorHandler(w, r, errors.New(awserrors.ErrorInvalidParameterValue))
+		return
+	}
+	if gw.NATSConn == nil {
+		gw.ErrorHandler(w, r, errors.New(awserrors.ErrorServerInternal))
+		return
+	}
+
+	accountID, _ := r.Context().Value(ctxAccountID).(string)
+	region, _ := r.Context().Value(ctxRegion).(string)
+	if region == "" {
+		region = gw.Region
+	}
+	resource := "arn:aws:ec2:" + region + ":" + accountID + ":instance/" + instanceID
+	if err := gw.checkPolicyFor(r, "ec2", consoleAction, []string{resource}); err != nil {
+		gw.ErrorHandler(w, r, err)
+		return
+	}
+
+	// Subscribe before asking the node to connect, so no output is lost
+	// while the websocket handshake completes.
+	sessionID := uuid.NewString()
+	output := make(chan *nats.Msg, consoleBacklog)
+	sub, err := gw.NATSConn.ChanSubscribe(utils.Subject(subjects.ConsoleOut(sessionID)), output)
+	if err != nil {
+		slog.Error("InstanceConsole: failed to subscribe to console output", "instanceId", instanceID, "err", err)
+		gw.ErrorHandler(w, r, errors.New(awserrors.ErrorServerInternal))
+		return
+	}
+	defer sub.Unsubscribe()
+
+	command := types.EC2InstanceCommand{
+		ID:             instanceID,
+		Attributes:     types.EC2CommandAttributes{OpenConsole: true},
+		ConsoleSession: &types.ConsoleSessionData{SessionID: sessionID, Type: consoleType},
+	}
+	if _, err := utils.NATSRequestContext[struct{}](r.Context(), gw.NATSConn, subjects.InstanceCmd(instanceID), command, consoleOpenTimeout, accountID); err != nil {
+		if errors.Is(err, nats.ErrNoResponders) {
+			// No node runs the instance
+			err = errors.New(awserrors.ErrorIncorrectInstanceState)
+		}
+		slog.Warn("InstanceConsole: node did not open the console", "instanceId", instanceID, "type", consoleType, "err", err)
+		gw.ErrorHandler(w, r, err)
+		return
+	}
+
+	input := utils.Subject(subjects.ConsoleIn(sessionID))
+	server := websocket.Server{
+		// The presigned URL is the credential, so any origin holding one
+		// may connect. noVNC asks for the "binary" subprotocol.
+		Handshake: func(config *websocket.Config, _ *http.Request) error {
+			for _, protocol := range config.Protocol {
+				if protocol == "binary" {
+					config.Protocol = []string{protocol}
+					return nil
+				}
+			}
+			config.Protocol = nil
+			return nil
+		},
+		Handler: func(ws *websocket.Conn) {
+			ws.PayloadType = websocket.BinaryFrame
+			relayConsole(ws, gw.NATSConn, input, output)
+		},
+	}
+	slog.Info("InstanceConsole: session opened", "instanceId", instanceID, "type", consoleType, "session", sessionID)
+	server.ServeHTTP(w, r)
+	slog.Info("InstanceConsole: session closed", "instanceId", instanceID, "session", sessionID)
+}
+
+// relayConsole copies the client's frames to the node and the node's output
+// to the client until either side closes, then tells the node to end the
+// session.
+func relayConsole(ws *websocket.Conn, nc *nats.Conn, input string, output <-chan *nats.Msg) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := ws.Read(buf)
+			if n > 0 {
+				if err := nc.Publish(input, append([]byte(nil), buf[:n]...)); err != nil {
+					slog.Warn("InstanceConsole: failed to relay input", "err", err)
+					return
+				}
+			}
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					slog.Debug("InstanceConsole: websocket read ended", "err", err)
+				}
+				return
+			}
+		}
+	}()
+
+	keepalive := time.NewTicker(consoleKeepalive)
+	defer keepalive.Stop()
+	for {
+		select {
+		case msg := <-output:
+			if msg.Header.Get(types.ConsoleCloseHeader) != "" {
+				_ = ws.Close()
+				<-done
+				return
+			}
+			if _, err := ws.Write(msg.Data); err != nil {
+				_ = ws.Close()
+				<-done
+				closeConsole(nc, input)
+				return
+			}
+		case <-keepalive.C:
+			_ = nc.Publish(input, nil)
+		case <-done:
+			_ = ws.Close()
+			closeConsole(nc, input)
+			return
+		}
+	}
+}
+
+// closeConsole tells the node to end the session whose input is on subject.
+func closeConsole(nc *nats.Conn, subject string) {
+	msg := nats.NewMsg(subject)
+	msg.Header.Set(types.ConsoleCloseHeader, "1")
+	if err := nc.PublishMsg(msg); err != nil {
+		slog.Warn("InstanceConsole: failed to close session", "err", err)
+	}
+}
@@ -0,0 +1,107 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/testutil"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+// consoleServer serves InstanceConsole behind the request logger, as
+// SetupRoutes does, with the SigV4 context of an authenticated caller.
+func consoleServer(t *testing.T, nc *nats.Conn) *httptest.Server {
+	t.Helper()
+	gw := &GatewayConfig{NATSConn: nc, Region: "us-east-1"}
+	r := chi.NewRouter()
+	r.Use(slogRequestLogger)
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), ctxAccountID, "123456789012")
+			ctx = context.WithValue(ctx, ctxService, "ec2")
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	})
+	r.Get("/console/{instanceId}", gw.InstanceConsole)
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestInstanceConsole_Relay(t *testing.T) {
+	_, nc := testutil.StartTestNATS(t)
+
+	// A fake node opens the session and echoes the client's input upper-cased
+	closed := make(chan struct{})
+	_, err := nc.Subscribe(subjects.InstanceCmd("i-console"), func(msg *nats.Msg) {
+		var command types.EC2InstanceCommand
+		require.NoError(t, json.Unmarshal(msg.Data, &command))
+		require.True(t, command.Attributes.OpenConsole)
+		require.Equal(t, types.ConsoleVNC, command.ConsoleSession.Type)
+		session := command.ConsoleSession.SessionID
+		_, err := nc.Subscribe(subjects.ConsoleIn(session), func(in *nats.Msg) {
+			if in.Header.Get(types.ConsoleCloseHeader) != "" {
+				close(closed)
+				return
+			}
+			if len(in.Data) > 0 {
+				_ = nc.Publish(subjects.ConsoleOut(session), bytes.ToUpper(in.Data))
+			}
+		})
+		require.NoError(t, err)
+		msg.Respond([]byte("{}"))
+	})
+	require.NoError(t, err)
+
+	srv := consoleServer(t, nc)
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/console/i-console?type=vnc"
+	ws, err := websocket.Dial(url, "binary", srv.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "binary", ws.Config().Protocol[0])
+
+	_, err = ws.Write([]byte("rfb"))
+	require.NoError(t, err)
+	require.NoError(t, ws.SetReadDeadline(time.Now().Add(5*time.Second)))
+	buf := make([]byte, 16)
+	n, err := ws.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "RFB", string(buf[:n]))
+
+	// Closing the websocket ends the node's session
+	require.NoError(t, ws.Close())
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("node session not closed")
+	}
+}
+
+func TestInstanceConsole_Errors(t *testing.T) {
+	_, nc := testutil.StartTestNATS(t)
+	srv := consoleServer(t, nc)
+
+	get := func(path string) int {
+		t.Helper()
+		resp, err := http.Get(srv.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusBadRequest, get("/console/vol-123"))
+	assert.Equal(t, http.StatusBadRequest, get("/console/i-console?type=rdp"))
+	// No node runs the instance
+	assert.Equal(t, http.StatusConflict, get("/console/i-console"))
+}
@@ -3,12 +3,17 @@
 package gateway
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"regexp"
 	"strings"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/iam"
 	"github.com/mulgadc/spinifex/spinifex/awsec2query"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
 	gateway_ec2_account "github.com/mulgadc/spinifex/spinifex/gateway/ec2/account"
@@ -18,8 +23,10 @@ import (
 	gateway_ec2_image "github.com/mulgadc/spinifex/spinifex/gateway/ec2/image"
 	gateway_ec2_instance "github.com/mulgadc/spinifex/spinifex/gateway/ec2/instance"
 	gateway_ec2_key "github.com/mulgadc/spinifex/spinifex/gateway/ec2/key"
+	gateway_ec2_launchtemplate "github.com/mulgadc/spinifex/spinifex/gateway/ec2/launchtemplate"
 	gateway_ec2_natgw "github.com/mulgadc/spinifex/spinifex/gateway/ec2/natgw"
 	gateway_ec2_placementgroup "github.com/mulgadc/spinifex/spinifex/gateway/ec2/placementgroup"
+	gateway_ec2_reservedinstances "github.com/mulgadc/spinifex/spinifex/gateway/ec2/reservedinstances"
 	gateway_ec2_routetable "github.com/mulgadc/spinifex/spinifex/gateway/ec2/routetable"
 	gateway_ec2_snapshot "github.com/mulgadc/spinifex/spinifex/gateway/ec2/snapshot"
 	gateway_ec2_tags "github.com/mulgadc/spinifex/spinifex/gateway/ec2/tags"
@@ -32,12 +39,21 @@ import (
 // EC2Handler processes parsed query args and returns XML response bytes.
 // The action parameter is the EC2 API action name, passed from the map key.
 // accountID is the caller's AWS account ID extracted from SigV4 auth context.
-type EC2Handler func(action string, q map[string]string, gw *GatewayConfig, accountID string) ([]byte, error)
+type EC2Handler func(ctx context.Context, action string, q map[string]string, gw *GatewayConfig, accountID string) ([]byte, error)
 
 // ec2Handler creates a type-safe EC2Handler that allocates the typed input struct,
-// parses query params into it, calls the handler, and marshals the output to XML.
+// parses query params into it, validates it against the model constraints,
+// calls the handler, and marshals the output to XML.
 func ec2Handler[In any](handler func(*In, *GatewayConfig, string) (any, error)) EC2Handler {
-	return func(action string, q map[string]string, gw *GatewayConfig, accountID string) ([]byte, error) {
+	return ec2HandlerContext(func(_ context.Context, input *In, gw *GatewayConfig, accountID string) (any, error) {
+		return handler(input, gw, accountID)
+	})
+}
+
+// ec2HandlerContext is ec2Handler for handlers that take the request
+// context, to carry its trace to the daemons.
+func ec2HandlerContext[In any](handler func(context.Context, *In, *GatewayConfig, string) (any, error)) EC2Handler {
+	return func(ctx context.Context, action string, q map[string]string, gw *GatewayConfig, accountID string) ([]byte, error) {
 		input := new(In)
 		if err := awsec2query.QueryParamsToStruct(q, input); err != nil {
 			if errors.Is(err, awsec2query.ErrSliceTooLarge) {
@@ -45,11 +61,17 @@ func ec2Handler[In any](handler func(*In, *GatewayConfig, string) (any, error))
 			}
 			return nil, err
 		}
-		output, err := handler(input, gw, accountID)
+		if err := validateInput(input); err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(q["DryRun"], "true") {
+			return nil, ec2DryRun(action, input, gw, accountID)
+		}
+		output, err := handler(ctx, input, gw, accountID)
 		if err != nil {
 			return nil, err
 		}
-		payload := utils.GenerateXMLPayload(action+"Response", output)
+		payload := utils.GenerateNamespacedXMLPayload(action+"Response", ec2Namespace(q["Version"]), output)
 		xmlOutput, err := utils.MarshalToXML(payload)
 		if err != nil {
 			return nil, errors.New("failed to marshal response to XML")
@@ -58,15 +80,86 @@ func ec2Handler[In any](handler func(*In, *GatewayConfig, string) (any, error))
 	}
 }
 
+// ec2APIVersion matches the API version an EC2 query request names, e.g.
+// 2016-11-15.
+var ec2APIVersion = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}$`)
+
+// ec2Namespace returns the XML namespace of the response to a request for
+// API version, which EC2 names after the version the request asked for.
+// Clients that read responses namespace-aware, such as libcloud, look
+// elements up in it.
+func ec2Namespace(version string) string {
+	if !ec2APIVersion.MatchString(version) {
+		return xmlnsEC2
+	}
+	return "http://ec2.amazonaws.com/doc/" + version + "/"
+}
+
+// ec2DryRunCheck is the part of an action's validation a DryRun request
+// runs: the checks the action makes before it changes anything.
+type ec2DryRunCheck func(input any, gw *GatewayConfig, accountID string) error
+
+// dryRunCheck adapts a typed check to an ec2DryRunCheck.
+func dryRunCheck[In any](check func(*In, *GatewayConfig, string) error) ec2DryRunCheck {
+	return func(input any, gw *GatewayConfig, accountID string) error {
+		return check(input.(*In), gw, accountID)
+	}
+}
+
+// dryRunValidate adapts an input validator to an ec2DryRunCheck.
+func dryRunValidate[In any](validate func(*In) error) ec2DryRunCheck {
+	return func(input any, _ *GatewayConfig, _ string) error {
+		return validate(input.(*In))
+	}
+}
+
+// ec2DryRunChecks are the actions that validate a DryRun request beyond the
+// model constraints.
+var ec2DryRunChecks = map[string]ec2DryRunCheck{
+	"RunInstances": dryRunCheck(func(input *ec2.RunInstancesInput, gw *GatewayConfig, accountID string) error {
+		return gateway_ec2_instance.ValidateRunInstancesRequest(input, gw.NATSConn, accountID)
+	}),
+	"StartInstances":                dryRunValidate(gateway_ec2_instance.ValidateStartInstancesInput),
+	"StopInstances":                 dryRunValidate(gateway_ec2_instance.ValidateStopInstancesInput),
+	"RebootInstances":               dryRunValidate(gateway_ec2_instance.ValidateRebootInstancesInput),
+	"TerminateInstances":            dryRunValidate(gateway_ec2_instance.ValidateTerminateInstancesInput),
+	"CreateVolume":                  dryRunValidate(gateway_ec2_volume.ValidateCreateVolumeInput),
+	"AttachVolume":                  dryRunValidate(gateway_ec2_volume.ValidateAttachVolumeInput),
+	"DetachVolume":                  dryRunValidate(gateway_ec2_volume.ValidateDetachVolumeInput),
+	"ModifyVolume":                  dryRunValidate(gateway_ec2_volume.ValidateModifyVolumeInput),
+	"DeleteVolume":                  dryRunValidate(gateway_ec2_volume.ValidateDeleteVolumeInput),
+	"ImportVolume":                  dryRunValidate(gateway_ec2_volume.ValidateImportVolumeInput),
+	"ImportSnapshot":                dryRunValidate(gateway_ec2_volume.ValidateImportSnapshotInput),
+	"CreateSecurityGroup":           dryRunValidate(gateway_ec2_vpc.ValidateCreateSecurityGroupInput),
+	"DeleteSecurityGroup":           dryRunValidate(gateway_ec2_vpc.ValidateDeleteSecurityGroupInput),
+	"AuthorizeSecurityGroupIngress": dryRunValidate(gateway_ec2_vpc.ValidateAuthorizeSecurityGroupIngressInput),
+	"AuthorizeSecurityGroupEgress":  dryRunValidate(gateway_ec2_vpc.ValidateAuthorizeSecurityGroupEgressInput),
+	"RevokeSecurityGroupIngress":    dryRunValidate(gateway_ec2_vpc.ValidateRevokeSecurityGroupIngressInput),
+	"RevokeSecurityGroupEgress":     dryRunValidate(gateway_ec2_vpc.ValidateRevokeSecurityGroupEgressInput),
+}
+
+// ec2DryRun answers a DryRun request, which has been authorized and has met
+// the model constraints by the time it gets here. It runs the action's dry
+// run checks, if any, and fails with DryRunOperation (HTTP 412) in place of
+// performing the action, as EC2 does when the request would have succeeded.
+func ec2DryRun(action string, input any, gw *GatewayConfig, accountID string) error {
+	if check, ok := ec2DryRunChecks[action]; ok {
+		if err := check(input, gw, accountID); err != nil {
+			return err
+		}
+	}
+	return errors.New(awserrors.ErrorDryRunOperation)
+}
+
 var ec2Actions = map[string]EC2Handler{
 	"DescribeInstances": ec2Handler(func(input *ec2.DescribeInstancesInput, gw *GatewayConfig, accountID string) (any, error) {
 		return gateway_ec2_instance.DescribeInstances(input, gw.NATSConn, gw.DiscoverActiveNodes(), accountID)
 	}),
-	"RunInstances": ec2Handler(func(input *ec2.RunInstancesInput, gw *GatewayConfig, accountID string) (any, error) {
-		return gateway_ec2_instance.RunInstances(input, gw.NATSConn, accountID)
+	"RunInstances": ec2HandlerContext(func(ctx context.Context, input *ec2.RunInstancesInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_ec2_instance.RunInstancesContext(ctx, input, gw.NATSConn, accountID)
 	}),
-	"StartInstances": ec2Handler(func(input *ec2.StartInstancesInput, gw *GatewayConfig, accountID string) (any, error) {
-		return gateway_ec2_instance.StartInstances(input, gw.NATSConn, accountID)
+	"StartInstances": ec2HandlerContext(func(ctx context.Context, input *ec2.StartInstancesInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_ec2_instance.StartInstancesContext(ctx, input, gw.NATSConn, accountID)
 	}),
 	"StopInstances": ec2Handler(func(input *ec2.StopInstancesInput, gw *GatewayConfig, accountID string) (any, error) {
 		return gateway_ec2_instance.StopInstances(input, gw.NATSConn, accountID)
@@ -77,12 +170,27 @@ var ec2Actions = map[string]EC2Handler{
 	"TerminateInstances": ec2Handler(func(input *ec2.TerminateInstancesInput, gw *GatewayConfig, accountID string) (any, error) {
 		return gateway_ec2_instance.TerminateInstances(input, gw.NATSConn, accountID)
 	}),
+	"DescribeInstanceStatus": ec2Handler(func(input *ec2.DescribeInstanceStatusInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_ec2_instance.DescribeInstanceStatus(input, gw.NATSConn, gw.DiscoverActiveNodes(), accountID)
+	}),
+	"ModifyInstanceEventStartTime": ec2Handler(func(input *ec2.ModifyInstanceEventStartTimeInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_ec2_instance.ModifyInstanceEventStartTime(input, gw.NATSConn, accountID)
+	}),
 	"DescribeInstanceTypes": ec2Handler(func(input *ec2.DescribeInstanceTypesInput, gw *GatewayConfig, accountID string) (any, error) {
 		return gateway_ec2_instance.DescribeInstanceTypes(input, gw.NATSConn, gw.ExpectedNodes)
 	}),
+	"GetInstanceTypesFromInstanceRequirements": ec2Handler(func(input *ec2.GetInstanceTypesFromInstanceRequirementsInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_ec2_instance.GetInstanceTypesFromInstanceRequirements(input, gw.NATSConn, gw.ExpectedNodes)
+	}),
 	"GetConsoleOutput": ec2Handler(func(input *ec2.GetConsoleOutputInput, gw *GatewayConfig, accountID string) (any, error) {
 		return gateway_ec2_instance.GetConsoleOutput(input, gw.NATSConn, accountID)
 	}),
+	"GetConsoleScreenshot": ec2Handler(func(input *ec2.GetConsoleScreenshotInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_ec2_instance.GetConsoleScreenshot(input, gw.NATSConn, accountID)
+	}),
+	"GetPasswordData": ec2Handler(func(input *ec2.GetPasswordDataInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_ec2_instance.GetPasswordData(input, gw.NATSConn, accountID)
+	}),
 	"ModifyInstanceAttribute": ec2Handler(func(input *ec2.ModifyInstanceAttributeInput, gw *GatewayConfig, accountID string) (any, error) {
 		return gateway_ec2_instance.ModifyInstanceAttribute(input, gw.NATSConn, accountID)
 	}),
@@ -90,7 +198,16 @@ var ec2Actions = map[string]EC2Handler{
 		return gateway_ec2_instance.DescribeInstanceAttribute(input, gw.NATSConn, accountID)
 	}),
 	"DescribeInstanceCreditSpecifications": ec2Handler(func(input *ec2.DescribeInstanceCreditSpecificationsInput, gw *GatewayConfig, accountID string) (any, error) {
-		return gateway_ec2_instance.DescribeInstanceCreditSpecifications(input)
+		return gateway_ec2_instance.DescribeInstanceCreditSpecifications(input, gw.NATSConn, gw.DiscoverActiveNodes(), accountID)
+	}),
+	"ModifyInstanceCreditSpecification": ec2Handler(func(input *ec2.ModifyInstanceCreditSpecificationInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_ec2_instance.ModifyInstanceCreditSpecification(input, gw.NATSConn, gw.DiscoverActiveNodes(), accountID)
+	}),
+	"ModifyInstanceMetadataOptions": ec2Handler(func(input *ec2.ModifyInstanceMetadataOptionsInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_ec2_instance.ModifyInstanceMetadataOptions(input, gw.NATSConn, accountID)
+	}),
+	"ModifyInstanceMaintenanceOptions": ec2Handler(func(input *ec2.ModifyInstanceMaintenanceOptionsInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_ec2_instance.ModifyInstanceMaintenanceOptions(input, gw.NATSConn, accountID)
 	}),
 	"CreateKeyPair": ec2Handler(func(input *ec2.CreateKeyPairInput, gw *GatewayConfig, accountID string) (any, error) {
 		return gateway_ec2_key.CreateKeyPair(input, gw.NATSConn, accountID)
@@ -101,14 +218,32 @@ var ec2Actions = map[string]EC2Handler{
 	"DescribeKeyPairs": ec2Handler(func(input *ec2.DescribeKeyPairsInput, gw *GatewayConfig, accountID string) (any, error) {
 		return gateway_ec2_key.DescribeKeyPairs(input, gw.NATSConn, accountID)
 	}),
-	"ImportKeyPair": func(action string, q map[string]string, gw *GatewayConfig, accountID string) ([]byte, error) {
+	"CreateLaunchTemplate": ec2Handler(func(input *ec2.CreateLaunchTemplateInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_ec2_launchtemplate.CreateLaunchTemplate(input, gw.NATSConn, accountID)
+	}),
+	"CreateLaunchTemplateVersion": ec2Handler(func(input *ec2.CreateLaunchTemplateVersionInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_ec2_launchtemplate.CreateLaunchTemplateVersion(input, gw.NATSConn, accountID)
+	}),
+	"ModifyLaunchTemplate": ec2Handler(func(input *ec2.ModifyLaunchTemplateInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_ec2_launchtemplate.ModifyLaunchTemplate(input, gw.NATSConn, accountID)
+	}),
+	"DeleteLaunchTemplate": ec2Handler(func(input *ec2.DeleteLaunchTemplateInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_ec2_launchtemplate.DeleteLaunchTemplate(input, gw.NATSConn, accountID)
+	}),
+	"DescribeLaunchTemplates": ec2Handler(func(input *ec2.DescribeLaunchTemplatesInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_ec2_launchtemplate.DescribeLaunchTemplates(input, gw.NATSConn, accountID)
+	}),
+	"DescribeLaunchTemplateVersions": ec2Handler(func(input *ec2.DescribeLaunchTemplateVersionsInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_ec2_launchtemplate.DescribeLaunchTemplateVersions(input, gw.NATSConn, accountID)
+	}),
+	"ImportKeyPair": func(ctx context.Context, action string, q map[string]string, gw *GatewayConfig, accountID string) ([]byte, error) {
 		// Workaround: parser leaves Base64 padding URL-encoded
 		if strings.HasSuffix(q["PublicKeyMaterial"], "%3D%3D") {
 			q["PublicKeyMaterial"] = strings.Replace(q["PublicKeyMaterial"], "%3D%3D", "==", 1)
 		}
 		return ec2Handler(func(input *ec2.ImportKeyPairInput, gw *GatewayConfig, accountID string) (any, error) {
 			return gateway_ec2_key.ImportKeyPair(input, gw.NATSConn, accountID)
-		})(action, q, gw, accountID)
+		})(ctx, action, q, gw, accountID)
 	},
 	"DescribeImages": ec2Handler(func(input *ec2.DescribeImagesInput, gw *GatewayConfig, accountID string) (any, error) {
 		return gateway_ec2_image.DescribeImages(input, gw.NATSConn, accountID)
@@ -164,6 +299,18 @@ var ec2Actions = map[string]EC2Handler{
 	"DetachVolume": ec2Handler(func(input *ec2.DetachVolumeInput, gw *GatewayConfig, accountID string) (any, error) {
 		return gateway_ec2_volume.DetachVolume(input, gw.NATSConn, accountID)
 	}),
+	"ImportVolume": ec2Handler(func(input *ec2.ImportVolumeInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_ec2_volume.ImportVolume(input, gw.NATSConn, accountID)
+	}),
+	"ImportSnapshot": ec2Handler(func(input *ec2.ImportSnapshotInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_ec2_volume.ImportSnapshot(input, gw.NATSConn, accountID)
+	}),
+	"DescribeConversionTasks": ec2Handler(func(input *ec2.DescribeConversionTasksInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_ec2_volume.DescribeConversionTasks(input, gw.NATSConn, accountID)
+	}),
+	"DescribeImportSnapshotTasks": ec2Handler(func(input *ec2.DescribeImportSnapshotTasksInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_ec2_volume.DescribeImportSnapshotTasks(input, gw.NATSConn, accountID)
+	}),
 	"DescribeAccountAttributes": ec2Handler(func(input *ec2.DescribeAccountAttributesInput, gw *GatewayConfig, accountID string) (any, error) {
 		return gateway_ec2_account.DescribeAccountAttributes(input)
 	}),
@@ -254,6 +401,18 @@ var ec2Actions = map[string]EC2Handler{
 	"DescribeVpcAttribute": ec2Handler(func(input *ec2.DescribeVpcAttributeInput, gw *GatewayConfig, accountID string) (any, error) {
 		return gateway_ec2_vpc.DescribeVpcAttribute(input, gw.NATSConn, accountID)
 	}),
+	"CreateDhcpOptions": ec2Handler(func(input *ec2.CreateDhcpOptionsInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_ec2_vpc.CreateDhcpOptions(input, gw.NATSConn, accountID)
+	}),
+	"DeleteDhcpOptions": ec2Handler(func(input *ec2.DeleteDhcpOptionsInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_ec2_vpc.DeleteDhcpOptions(input, gw.NATSConn, accountID)
+	}),
+	"DescribeDhcpOptions": ec2Handler(func(input *ec2.DescribeDhcpOptionsInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_ec2_vpc.DescribeDhcpOptions(input, gw.NATSConn, accountID)
+	}),
+	"AssociateDhcpOptions": ec2Handler(func(input *ec2.AssociateDhcpOptionsInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_ec2_vpc.AssociateDhcpOptions(input, gw.NATSConn, accountID)
+	}),
 	"CreateSubnet": ec2Handler(func(input *ec2.CreateSubnetInput, gw *GatewayConfig, accountID string) (any, error) {
 		return gateway_ec2_vpc.CreateSubnet(input, gw.NATSConn, accountID)
 	}),
@@ -305,6 +464,12 @@ var ec2Actions = map[string]EC2Handler{
 	"ModifyNetworkInterfaceAttribute": ec2Handler(func(input *ec2.ModifyNetworkInterfaceAttributeInput, gw *GatewayConfig, accountID string) (any, error) {
 		return gateway_ec2_vpc.ModifyNetworkInterfaceAttribute(input, gw.NATSConn, accountID)
 	}),
+	"AttachNetworkInterface": ec2Handler(func(input *ec2.AttachNetworkInterfaceInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_ec2_vpc.AttachNetworkInterface(input, gw.NATSConn, accountID)
+	}),
+	"DetachNetworkInterface": ec2Handler(func(input *ec2.DetachNetworkInterfaceInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_ec2_vpc.DetachNetworkInterface(input, gw.NATSConn, accountID)
+	}),
 	"CreateSecurityGroup": ec2Handler(func(input *ec2.CreateSecurityGroupInput, gw *GatewayConfig, accountID string) (any, error) {
 		return gateway_ec2_vpc.CreateSecurityGroup(input, gw.NATSConn, accountID)
 	}),
@@ -353,13 +518,25 @@ var ec2Actions = map[string]EC2Handler{
 	"DescribeNatGateways": ec2Handler(func(input *ec2.DescribeNatGatewaysInput, gw *GatewayConfig, accountID string) (any, error) {
 		return gateway_ec2_natgw.DescribeNatGateways(input, gw.NATSConn, accountID)
 	}),
+	"ModifyReservedInstances": ec2Handler(func(input *ec2.ModifyReservedInstancesInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_ec2_reservedinstances.ModifyReservedInstances(input)
+	}),
+	"GetReservedInstancesExchangeQuote": ec2Handler(func(input *ec2.GetReservedInstancesExchangeQuoteInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_ec2_reservedinstances.GetReservedInstancesExchangeQuote(input)
+	}),
+	"AcceptReservedInstancesExchangeQuote": ec2Handler(func(input *ec2.AcceptReservedInstancesExchangeQuoteInput, gw *GatewayConfig, accountID string) (any, error) {
+		return gateway_ec2_reservedinstances.AcceptReservedInstancesExchangeQuote(input)
+	}),
 }
 
 // ec2LocalActions are actions that don't require a NATS connection.
 var ec2LocalActions = map[string]bool{
-	"DescribeRegions":           true,
-	"DescribeAvailabilityZones": true,
-	"DescribeAccountAttributes": true,
+	"DescribeRegions":                      true,
+	"DescribeAvailabilityZones":            true,
+	"DescribeAccountAttributes":            true,
+	"ModifyReservedInstances":              true,
+	"GetReservedInstancesExchangeQuote":    true,
+	"AcceptReservedInstancesExchangeQuote": true,
 }
 
 func (gw *GatewayConfig) EC2_Request(w http.ResponseWriter, r *http.Request) error {
@@ -382,6 +559,12 @@ func (gw *GatewayConfig) EC2_Request(w http.ResponseWriter, r *http.Request) err
 		return err
 	}
 
+	if action == "RunInstances" {
+		if err := gw.resolveInstanceProfile(r, queryArgs); err != nil {
+			return err
+		}
+	}
+
 	if gw.NATSConn == nil && !ec2LocalActions[action] {
 		return errors.New(awserrors.ErrorServerInternal)
 	}
@@ -393,10 +576,11 @@ func (gw *GatewayConfig) EC2_Request(w http.ResponseWriter, r *http.Request) err
 		return errors.New(awserrors.ErrorServerInternal)
 	}
 
-	xmlOutput, err := handler(action, queryArgs, gw, accountID)
+	xmlOutput, err := handler(r.Context(), action, queryArgs, gw, accountID)
 	if err != nil {
 		return err
 	}
+	xmlOutput = addRequestID(xmlOutput, requestIDOf(r), false)
 
 	w.Header().Set("Content-Type", "text/xml")
 	w.WriteHeader(http.StatusOK)
@@ -405,3 +589,60 @@ func (gw *GatewayConfig) EC2_Request(w http.ResponseWriter, r *http.Request) err
 	}
 	return nil
 }
+
+// resolveInstanceProfile checks the instance profile a RunInstances request
+// names, by ARN or by name, and rewrites args to name it by ARN for the
+// daemon. The profile must hold a role the caller may pass (iam:PassRole).
+func (gw *GatewayConfig) resolveInstanceProfile(r *http.Request, args map[string]string) error {
+	arn, name := args["IamInstanceProfile.Arn"], args["IamInstanceProfile.Name"]
+	if arn == "" && name == "" {
+		return nil
+	}
+	if gw.IAMService == nil {
+		return awserrors.WithDetail(awserrors.ErrorInvalidParameterValue, "IAM instance profiles are not available")
+	}
+	accountID, _ := r.Context().Value(ctxAccountID).(string)
+
+	invalid := func() error {
+		if arn != "" {
+			return awserrors.WithDetail(awserrors.ErrorInvalidParameterValue,
+				fmt.Sprintf("Value (%s) for parameter iamInstanceProfile.arn is invalid. Invalid IAM Instance Profile ARN", arn))
+		}
+		return awserrors.WithDetail(awserrors.ErrorInvalidParameterValue,
+			fmt.Sprintf("Value (%s) for parameter iamInstanceProfile.name is invalid. Invalid IAM Instance Profile name", name))
+	}
+
+	profile, err := gw.IAMService.ResolveInstanceProfile(accountID, arn, name)
+	if err != nil {
+		switch err.Error() {
+		case awserrors.ErrorIAMNoSuchEntity:
+			return invalid()
+		case awserrors.ErrorInvalidIamInstanceProfileArnMalformed:
+			return err
+		}
+		slog.Error("resolveInstanceProfile: lookup failed", "arn", arn, "name", name, "err", err)
+		return errors.New(awserrors.ErrorServerInternal)
+	}
+	if profile.AccountID != accountID || len(profile.Roles) == 0 {
+		return invalid()
+	}
+
+	role, err := gw.IAMService.GetRole(accountID, &iam.GetRoleInput{RoleName: aws.String(profile.Roles[0])})
+	if err != nil {
+		if err.Error() == awserrors.ErrorIAMNoSuchEntity {
+			return invalid()
+		}
+		slog.Error("resolveInstanceProfile: role lookup failed", "role", profile.Roles[0], "err", err)
+		return errors.New(awserrors.ErrorServerInternal)
+	}
+	if err := gw.checkPolicyFor(r, "iam", "PassRole", []string{aws.StringValue(role.Role.Arn)}); err != nil {
+		if err.Error() == awserrors.ErrorAccessDenied {
+			return errors.New(awserrors.ErrorUnauthorizedOperation)
+		}
+		return err
+	}
+
+	delete(args, "IamInstanceProfile.Name")
+	args["IamInstanceProfile.Arn"] = profile.ARN
+	return nil
+}
@@ -0,0 +1,15 @@
+package gateway_ec2_account
+
+import (
+	"time"
+
+	"github.com/mulgadc/spinifex/spinifex/quota"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+)
+
+// DescribeAccountQuotas handles the DescribeAccountQuotas spinifex extension,
+// returning the caller's resource quotas and how much of each it uses.
+func DescribeAccountQuotas(natsConn *nats.Conn, accountID string) (*quota.DescribeAccountQuotasOutput, error) {
+	return utils.NATSRequest[quota.DescribeAccountQuotasOutput](natsConn, "ec2.DescribeAccountQuotas", &quota.DescribeAccountQuotasInput{}, 30*time.Second, accountID)
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
 	handlers_ec2_image "github.com/mulgadc/spinifex/spinifex/handlers/ec2/image"
+	"github.com/mulgadc/spinifex/spinifex/pagination"
 	"github.com/nats-io/nats.go"
 )
 
@@ -24,6 +25,11 @@ func ValidateDescribeImagesInput(input *ec2.DescribeImagesInput) (err error) {
 		}
 	}
 
+	// As on AWS, MaxResults can't be combined with ImageIds.
+	if input.MaxResults != nil && len(input.ImageIds) > 0 {
+		return errors.New(awserrors.ErrorInvalidParameterCombination)
+	}
+	_, err = pagination.Parse(input.MaxResults, input.NextToken, pagination.DescribeImagesLimits)
 	return err
 }
 
@@ -78,6 +78,32 @@ func TestValidateDescribeImagesInput(t *testing.T) {
 			wantErr: true,
 			errMsg:  awserrors.ErrorInvalidAMIIDMalformed,
 		},
+		{
+			name:    "MaxResults",
+			input:   &ec2.DescribeImagesInput{MaxResults: aws.Int64(6)},
+			wantErr: false,
+		},
+		{
+			name:    "MaxResultsOutOfRange",
+			input:   &ec2.DescribeImagesInput{MaxResults: aws.Int64(5)},
+			wantErr: true,
+			errMsg:  awserrors.ErrorInvalidMaxResults,
+		},
+		{
+			name:    "InvalidNextToken",
+			input:   &ec2.DescribeImagesInput{NextToken: aws.String("bogus")},
+			wantErr: true,
+			errMsg:  awserrors.ErrorInvalidNextToken,
+		},
+		{
+			name: "MaxResultsWithImageIds",
+			input: &ec2.DescribeImagesInput{
+				ImageIds:   []*string{aws.String("ami-111")},
+				MaxResults: aws.Int64(10),
+			},
+			wantErr: true,
+			errMsg:  awserrors.ErrorInvalidParameterCombination,
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,546 @@
+package gateway_ec2_instance
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	gateway_ec2_image "github.com/mulgadc/spinifex/spinifex/gateway/ec2/image"
+	gateway_ec2_snapshot "github.com/mulgadc/spinifex/spinifex/gateway/ec2/snapshot"
+	gateway_ec2_volume "github.com/mulgadc/spinifex/spinifex/gateway/ec2/volume"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/nats-io/nats.go"
+)
+
+// Clone copy modes. Viperblock volumes restored from a snapshot share the
+// snapshot's frozen blocks and write to their own chunks, so a copy-on-write
+// clone is already independent of its source but keeps the snapshots. A full
+// copy writes every block into the clone's volumes, after which the
+// snapshots are deleted.
+const (
+	CloneCopyOnWrite = vm.CopyModeCopyOnWrite
+	CloneFullCopy    = vm.CopyModeFull
+)
+
+// cloneAttachTimeout bounds how long the clone is waited on, to reach
+// running and for each full-copy volume to finish copying.
+var (
+	cloneAttachTimeout = 10 * time.Minute
+	clonePollInterval  = 2 * time.Second
+)
+
+// cloneAsync runs the work CloneInstance leaves to the background. A
+// variable so tests can run it inline.
+var cloneAsync = func(f func()) { go f() }
+
+// errCloneGone is returned while waiting on a clone that was terminated.
+var errCloneGone = errors.New("clone terminated")
+
+// CloneInstanceInput is the request for the CloneInstance spinifex extension.
+type CloneInstanceInput struct {
+	InstanceID   string `json:"instance_id"`
+	InstanceType string `json:"instance_type,omitempty"` // defaults to the source's type
+	CopyTags     bool   `json:"copy_tags"`
+	CopyMode     string `json:"copy_mode,omitempty"` // defaults to CloneCopyOnWrite
+}
+
+// ClonedVolume maps a source volume to the clone's independent copy.
+// Attached is only set for the root volume: data volumes are attached once
+// the clone is running, after CloneInstance has replied.
+type ClonedVolume struct {
+	DeviceName     string `json:"device_name"`
+	SourceVolumeID string `json:"source_volume_id"`
+	SnapshotID     string `json:"snapshot_id"`
+	VolumeID       string `json:"volume_id,omitempty"` // empty for the root volume until the clone boots
+	Attached       bool   `json:"attached"`
+}
+
+// CloneInstanceOutput is the response for CloneInstance.
+type CloneInstanceOutput struct {
+	SourceInstanceID string         `json:"source_instance_id"`
+	InstanceID       string         `json:"instance_id"`
+	ImageID          string         `json:"image_id"`
+	CrashConsistent  bool           `json:"crash_consistent"` // source was running when snapshotted
+	Volumes          []ClonedVolume `json:"volumes"`
+}
+
+// cloneBackend is the set of EC2 operations CloneInstance composes.
+type cloneBackend interface {
+	describeInstance(instanceID string) (*ec2.Instance, error)
+	createImage(input *ec2.CreateImageInput) (string, error)
+	createSnapshot(volumeID, description string) (string, error)
+	createVolume(snapshotID, az, copyMode string) (string, error)
+	volumeState(volumeID string) (string, error)
+	runInstance(input *ec2.RunInstancesInput) (*ec2.Instance, error)
+	attachVolume(volumeID, instanceID, device string) error
+	imageSnapshotID(imageID string) (string, error)
+	deleteVolume(volumeID string) error
+	deleteSnapshot(snapshotID string) error
+	deregisterImage(imageID string) error
+}
+
+// natsCloneBackend implements cloneBackend with the gateway's NATS-backed handlers.
+type natsCloneBackend struct {
+	natsConn      *nats.Conn
+	expectedNodes int
+	accountID     string
+}
+
+func (b *natsCloneBackend) describeInstance(instanceID string) (*ec2.Instance, error) {
+	return describeInstance(instanceID, b.natsConn, b.expectedNodes, b.accountID)
+}
+
+// describeInstance looks up one of accountID's instances in any state.
+func describeInstance(instanceID string, natsConn *nats.Conn, expectedNodes int, accountID string) (*ec2.Instance, error) {
+	out, err := DescribeInstances(&ec2.DescribeInstancesInput{
+		InstanceIds: []*string{aws.String(instanceID)},
+	}, natsConn, expectedNodes, accountID)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range out.Reservations {
+		for _, inst := range r.Instances {
+			if aws.StringValue(inst.InstanceId) == instanceID {
+				return inst, nil
+			}
+		}
+	}
+	return nil, errors.New(awserrors.ErrorInvalidInstanceIDNotFound)
+}
+
+func (b *natsCloneBackend) createImage(input *ec2.CreateImageInput) (string, error) {
+	out, err := gateway_ec2_image.CreateImage(input, b.natsConn, b.expectedNodes, b.accountID)
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(out.ImageId), nil
+}
+
+func (b *natsCloneBackend) createSnapshot(volumeID, description string) (string, error) {
+	out, err := gateway_ec2_snapshot.CreateSnapshot(&ec2.CreateSnapshotInput{
+		VolumeId:    aws.String(volumeID),
+		Description: aws.String(description),
+	}, b.natsConn, b.accountID)
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(out.SnapshotId), nil
+}
+
+func (b *natsCloneBackend) createVolume(snapshotID, az, copyMode string) (string, error) {
+	out, err := gateway_ec2_volume.CreateVolume(&ec2.CreateVolumeInput{
+		SnapshotId:        aws.String(snapshotID),
+		AvailabilityZone:  aws.String(az),
+		TagSpecifications: cloneVolumeTags(copyMode),
+	}, b.natsConn, b.accountID)
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(out.VolumeId), nil
+}
+
+func (b *natsCloneBackend) volumeState(volumeID string) (string, error) {
+	out, err := gateway_ec2_volume.DescribeVolumes(&ec2.DescribeVolumesInput{
+		VolumeIds: []*string{aws.String(volumeID)},
+	}, b.natsConn, b.accountID)
+	if err != nil {
+		return "", err
+	}
+	if len(out.Volumes) == 0 {
+		return "", errors.New(awserrors.ErrorInvalidVolumeNotFound)
+	}
+	return aws.StringValue(out.Volumes[0].State), nil
+}
+
+func (b *natsCloneBackend) runInstance(input *ec2.RunInstancesInput) (*ec2.Instance, error) {
+	reservation, err := RunInstances(input, b.natsConn, b.accountID)
+	if err != nil {
+		return nil, err
+	}
+	if len(reservation.Instances) == 0 {
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+	return reservation.Instances[0], nil
+}
+
+func (b *natsCloneBackend) attachVolume(volumeID, instanceID, device string) error {
+	_, err := gateway_ec2_volume.AttachVolume(&ec2.AttachVolumeInput{
+		VolumeId:   aws.String(volumeID),
+		InstanceId: aws.String(instanceID),
+		Device:     aws.String(device),
+	}, b.natsConn, b.accountID)
+	return err
+}
+
+func (b *natsCloneBackend) imageSnapshotID(imageID string) (string, error) {
+	out, err := gateway_ec2_image.DescribeImages(&ec2.DescribeImagesInput{
+		ImageIds: []*string{aws.String(imageID)},
+	}, b.natsConn, b.accountID)
+	if err != nil {
+		return "", err
+	}
+	for _, image := range out.Images {
+		for _, bdm := range image.BlockDeviceMappings {
+			if bdm.Ebs != nil && bdm.Ebs.SnapshotId != nil {
+				return *bdm.Ebs.SnapshotId, nil
+			}
+		}
+	}
+	return "", errors.New(awserrors.ErrorInvalidAMIIDNotFound)
+}
+
+func (b *natsCloneBackend) deleteVolume(volumeID string) error {
+	_, err := gateway_ec2_volume.DeleteVolume(&ec2.DeleteVolumeInput{VolumeId: aws.String(volumeID)}, b.natsConn, b.accountID)
+	return err
+}
+
+func (b *natsCloneBackend) deleteSnapshot(snapshotID string) error {
+	_, err := gateway_ec2_snapshot.DeleteSnapshot(&ec2.DeleteSnapshotInput{SnapshotId: aws.String(snapshotID)}, b.natsConn, b.accountID)
+	return err
+}
+
+func (b *natsCloneBackend) deregisterImage(imageID string) error {
+	_, err := gateway_ec2_image.DeregisterImage(&ec2.DeregisterImageInput{ImageId: aws.String(imageID)}, b.natsConn, b.accountID)
+	return err
+}
+
+// cloneVolumeTags returns the tag specifications that make the clone's
+// volumes full copies, or nil for copy-on-write.
+func cloneVolumeTags(copyMode string) []*ec2.TagSpecification {
+	if copyMode != CloneFullCopy {
+		return nil
+	}
+	return []*ec2.TagSpecification{{
+		ResourceType: aws.String("volume"),
+		Tags:         []*ec2.Tag{{Key: aws.String(vm.CopyModeTag), Value: aws.String(CloneFullCopy)}},
+	}}
+}
+
+// ValidateCloneInstanceInput validates the input parameters for CloneInstance
+func ValidateCloneInstanceInput(input *CloneInstanceInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if input.InstanceID == "" {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	if !strings.HasPrefix(input.InstanceID, "i-") {
+		return errors.New(awserrors.ErrorInvalidInstanceIDMalformed)
+	}
+	if _, err := vm.ParseCopyMode(input.CopyMode); err != nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	return nil
+}
+
+// CloneInstance snapshots every EBS volume of a source instance and launches
+// a new instance from those snapshots with a fresh ID and network identity.
+// A running source is snapshotted live, so the clone is crash-consistent;
+// a stopped source yields a fully consistent clone. It replies once the
+// clone is launched: data volumes are attached and the AMI used to boot the
+// clone is deregistered in the background once the clone is running. If a
+// step fails, or the clone is terminated before it runs, everything created
+// for the clone is removed.
+func CloneInstance(input *CloneInstanceInput, natsConn *nats.Conn, expectedNodes int, accountID string) (*CloneInstanceOutput, error) {
+	if err := ValidateCloneInstanceInput(input); err != nil {
+		return nil, err
+	}
+	backend := &natsCloneBackend{natsConn: natsConn, expectedNodes: expectedNodes, accountID: accountID}
+	return cloneInstance(input, backend)
+}
+
+func cloneInstance(input *CloneInstanceInput, backend cloneBackend) (*CloneInstanceOutput, error) {
+	copyMode, err := vm.ParseCopyMode(input.CopyMode)
+	if err != nil {
+		return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+
+	source, err := backend.describeInstance(input.InstanceID)
+	if err != nil {
+		return nil, err
+	}
+
+	state := ""
+	if source.State != nil {
+		state = aws.StringValue(source.State.Name)
+	}
+	if state != ec2.InstanceStateNameRunning && state != ec2.InstanceStateNameStopped {
+		slog.Info("CloneInstance: source in incorrect state", "instanceId", input.InstanceID, "state", state)
+		return nil, errors.New(awserrors.ErrorIncorrectInstanceState)
+	}
+
+	rootVolumeID := cloneRootVolumeID(source)
+	output := &CloneInstanceOutput{
+		SourceInstanceID: input.InstanceID,
+		CrashConsistent:  state == ec2.InstanceStateNameRunning,
+	}
+
+	// Root volume: capture as an AMI so RunInstances can boot from it.
+	// NoReboot keeps a running source up; the live snapshot is crash-consistent.
+	imageID, err := backend.createImage(&ec2.CreateImageInput{
+		InstanceId:  aws.String(input.InstanceID),
+		Name:        aws.String(fmt.Sprintf("clone-%s-%d", input.InstanceID, time.Now().UnixNano())),
+		Description: aws.String("CloneInstance source image for " + input.InstanceID),
+		NoReboot:    aws.Bool(true),
+	})
+	if err != nil {
+		slog.Error("CloneInstance: failed to image root volume", "instanceId", input.InstanceID, "err", err)
+		return nil, err
+	}
+	output.ImageID = imageID
+	clone := &cloneJob{backend: backend, output: output, copyMode: copyMode}
+	if clone.imageSnapshotID, err = backend.imageSnapshotID(imageID); err != nil {
+		slog.Warn("CloneInstance: failed to find the image's snapshot", "imageId", imageID, "err", err)
+	}
+
+	// Data volumes: snapshot each and restore into a new volume in the same AZ.
+	az := ""
+	if source.Placement != nil {
+		az = aws.StringValue(source.Placement.AvailabilityZone)
+	}
+	for _, bdm := range source.BlockDeviceMappings {
+		if bdm.Ebs == nil || bdm.Ebs.VolumeId == nil {
+			continue
+		}
+		device := aws.StringValue(bdm.DeviceName)
+		sourceVolumeID := aws.StringValue(bdm.Ebs.VolumeId)
+		if sourceVolumeID == rootVolumeID {
+			output.Volumes = append(output.Volumes, ClonedVolume{DeviceName: device, SourceVolumeID: sourceVolumeID, Attached: true})
+			continue
+		}
+
+		snapshotID, err := backend.createSnapshot(sourceVolumeID, "CloneInstance snapshot of "+sourceVolumeID)
+		if err != nil {
+			slog.Error("CloneInstance: failed to snapshot data volume", "volumeId", sourceVolumeID, "err", err)
+			cloneAsync(clone.cleanup)
+			return nil, err
+		}
+		output.Volumes = append(output.Volumes, ClonedVolume{
+			DeviceName:     device,
+			SourceVolumeID: sourceVolumeID,
+			SnapshotID:     snapshotID,
+		})
+		volumeID, err := backend.createVolume(snapshotID, az, copyMode)
+		if err != nil {
+			slog.Error("CloneInstance: failed to restore data volume", "snapshotId", snapshotID, "err", err)
+			cloneAsync(clone.cleanup)
+			return nil, err
+		}
+		output.Volumes[len(output.Volumes)-1].VolumeID = volumeID
+	}
+
+	runInput := cloneRunInstancesInput(source, imageID, input)
+	runInput.TagSpecifications = append(runInput.TagSpecifications, cloneVolumeTags(copyMode)...)
+	instance, err := backend.runInstance(runInput)
+	if err != nil {
+		slog.Error("CloneInstance: failed to launch clone", "instanceId", input.InstanceID, "imageId", imageID, "err", err)
+		cloneAsync(clone.cleanup)
+		return nil, err
+	}
+	output.InstanceID = aws.StringValue(instance.InstanceId)
+
+	// Snapshot the output: the background work updates the job's own copy.
+	reply := *output
+	reply.Volumes = slices.Clone(output.Volumes)
+	cloneAsync(clone.finish)
+
+	slog.Info("CloneInstance launched", "sourceInstanceId", input.InstanceID, "instanceId", output.InstanceID, "imageId", imageID)
+	return &reply, nil
+}
+
+// cloneJob is the state of one clone, carried into the work CloneInstance
+// leaves to the background.
+type cloneJob struct {
+	backend         cloneBackend
+	output          *CloneInstanceOutput
+	copyMode        string
+	imageSnapshotID string // the snapshot behind output.ImageID
+}
+
+// finish attaches the clone's data volumes once it is running and removes
+// what was only needed to launch it: the AMI, and in full-copy mode the
+// snapshots. A clone terminated before it runs is cleaned up; one that
+// times out is left as is.
+func (j *cloneJob) finish() {
+	instanceID := j.output.InstanceID
+	// Volumes can only be hot-plugged once the clone is running.
+	if err := waitForCloneRunning(j.backend, instanceID, cloneAttachTimeout); err != nil {
+		if errors.Is(err, errCloneGone) {
+			slog.Warn("CloneInstance: clone terminated before running, removing its volumes", "instanceId", instanceID, "err", err)
+			j.cleanup()
+			return
+		}
+		slog.Warn("CloneInstance: clone did not reach running, data volumes left detached",
+			"instanceId", instanceID, "err", err)
+		return
+	}
+
+	for i := range j.output.Volumes {
+		vol := &j.output.Volumes[i]
+		if vol.VolumeID == "" {
+			continue // root volume, attached at boot
+		}
+		if j.copyMode == CloneFullCopy {
+			if err := waitForCloneVolume(j.backend, vol.VolumeID, cloneAttachTimeout); err != nil {
+				slog.Warn("CloneInstance: data volume copy did not complete", "volumeId", vol.VolumeID, "err", err)
+				continue
+			}
+			j.deleteSnapshot(vol.SnapshotID)
+		}
+		if err := j.backend.attachVolume(vol.VolumeID, instanceID, vol.DeviceName); err != nil {
+			slog.Warn("CloneInstance: failed to attach data volume", "volumeId", vol.VolumeID, "instanceId", instanceID, "err", err)
+			continue
+		}
+		vol.Attached = true
+	}
+
+	// The root volume exists once the clone runs, so the AMI is no longer
+	// needed. A copy-on-write root still reads the AMI's snapshot.
+	j.deregisterImage()
+	if j.copyMode == CloneFullCopy {
+		j.deleteSnapshot(j.imageSnapshotID)
+	}
+
+	slog.Info("CloneInstance completed", "sourceInstanceId", j.output.SourceInstanceID, "instanceId", instanceID, "imageId", j.output.ImageID)
+}
+
+// cleanup removes everything created for a clone that failed: its data
+// volumes, their snapshots, and the AMI with its snapshot. Errors are
+// logged, so as much as possible is removed.
+func (j *cloneJob) cleanup() {
+	for _, vol := range j.output.Volumes {
+		if vol.VolumeID == "" {
+			continue
+		}
+		// A volume still copying would be rewritten by its copy.
+		if err := waitForCloneVolume(j.backend, vol.VolumeID, cloneAttachTimeout); err != nil {
+			slog.Warn("CloneInstance: data volume did not settle before cleanup", "volumeId", vol.VolumeID, "err", err)
+		}
+		if err := j.backend.deleteVolume(vol.VolumeID); err != nil {
+			slog.Warn("CloneInstance: failed to delete data volume", "volumeId", vol.VolumeID, "err", err)
+		}
+	}
+	for _, vol := range j.output.Volumes {
+		j.deleteSnapshot(vol.SnapshotID)
+	}
+	j.deregisterImage()
+	j.deleteSnapshot(j.imageSnapshotID)
+}
+
+func (j *cloneJob) deleteSnapshot(snapshotID string) {
+	if snapshotID == "" {
+		return
+	}
+	if err := j.backend.deleteSnapshot(snapshotID); err != nil {
+		slog.Warn("CloneInstance: failed to delete snapshot", "snapshotId", snapshotID, "err", err)
+	}
+}
+
+func (j *cloneJob) deregisterImage() {
+	if err := j.backend.deregisterImage(j.output.ImageID); err != nil {
+		slog.Warn("CloneInstance: failed to deregister image", "imageId", j.output.ImageID, "err", err)
+	}
+}
+
+// cloneRootVolumeID returns the source's root volume: the mapping for
+// RootDeviceName, or the first EBS mapping as CreateImage assumes.
+func cloneRootVolumeID(source *ec2.Instance) string {
+	first := ""
+	for _, bdm := range source.BlockDeviceMappings {
+		if bdm.Ebs == nil || bdm.Ebs.VolumeId == nil {
+			continue
+		}
+		if first == "" {
+			first = *bdm.Ebs.VolumeId
+		}
+		if source.RootDeviceName != nil && aws.StringValue(bdm.DeviceName) == *source.RootDeviceName {
+			return *bdm.Ebs.VolumeId
+		}
+	}
+	return first
+}
+
+// cloneRunInstancesInput builds the launch request for a clone: same key,
+// subnet and security groups as the source, but a fresh ID and private IP.
+func cloneRunInstancesInput(source *ec2.Instance, imageID string, input *CloneInstanceInput) *ec2.RunInstancesInput {
+	instanceType := input.InstanceType
+	if instanceType == "" {
+		instanceType = aws.StringValue(source.InstanceType)
+	}
+
+	runInput := &ec2.RunInstancesInput{
+		ImageId:      aws.String(imageID),
+		InstanceType: aws.String(instanceType),
+		KeyName:      source.KeyName,
+		MinCount:     aws.Int64(1),
+		MaxCount:     aws.Int64(1),
+		SubnetId:     source.SubnetId,
+	}
+	for _, sg := range source.SecurityGroups {
+		if sg.GroupId != nil {
+			runInput.SecurityGroupIds = append(runInput.SecurityGroupIds, sg.GroupId)
+		}
+	}
+	if source.Placement != nil && source.Placement.AvailabilityZone != nil {
+		runInput.Placement = &ec2.Placement{AvailabilityZone: source.Placement.AvailabilityZone}
+	}
+	if input.CopyTags && len(source.Tags) > 0 {
+		tags := make([]*ec2.Tag, 0, len(source.Tags))
+		for _, tag := range source.Tags {
+			tags = append(tags, &ec2.Tag{Key: tag.Key, Value: tag.Value})
+		}
+		runInput.TagSpecifications = []*ec2.TagSpecification{{
+			ResourceType: aws.String("instance"),
+			Tags:         tags,
+		}}
+	}
+	return runInput
+}
+
+// waitForCloneRunning polls the clone until it is running or timeout elapses.
+func waitForCloneRunning(backend cloneBackend, instanceID string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		inst, err := backend.describeInstance(instanceID)
+		if err == nil && inst.State != nil {
+			switch aws.StringValue(inst.State.Name) {
+			case ec2.InstanceStateNameRunning:
+				return nil
+			case ec2.InstanceStateNameShuttingDown, ec2.InstanceStateNameTerminated:
+				return fmt.Errorf("%w: %s is %s", errCloneGone, instanceID, aws.StringValue(inst.State.Name))
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for clone %s to run", instanceID)
+		}
+		time.Sleep(clonePollInterval)
+	}
+}
+
+// waitForCloneVolume polls a volume until it is no longer creating or
+// timeout elapses, failing unless it ends up available.
+func waitForCloneVolume(backend cloneBackend, volumeID string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		state, err := backend.volumeState(volumeID)
+		if err != nil && err.Error() == awserrors.ErrorInvalidVolumeNotFound {
+			return err
+		}
+		if err == nil && state != "creating" {
+			if state != ec2.VolumeStateAvailable {
+				return fmt.Errorf("volume %s is %s", volumeID, state)
+			}
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for volume %s", volumeID)
+		}
+		time.Sleep(clonePollInterval)
+	}
+}
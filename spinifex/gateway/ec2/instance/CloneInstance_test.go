@@ -0,0 +1,421 @@
+package gateway_ec2_instance
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/vm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCloneBackend records the operations CloneInstance performs against an
+// in-memory set of instances, volumes and snapshots.
+type fakeCloneBackend struct {
+	instances    map[string]*ec2.Instance
+	snapshots    map[string]string // snapshot ID → source volume ID
+	volumes      map[string]string // volume ID → snapshot ID it was restored from
+	copyModes    map[string]string // volume ID → copy mode it was created with
+	attached     map[string]string // volume ID → instance ID
+	imageIDs     map[string]string // image ID → its snapshot ID
+	images       []*ec2.CreateImageInput
+	runInputs    []*ec2.RunInstancesInput
+	nextID       int
+	failCreate   bool // createVolume fails after the first volume
+	failRun      bool
+	cloneState   string // state launched clones report, default running
+	deletedVols  []string
+	deletedSnaps []string
+	deregistered []string
+}
+
+func newFakeCloneBackend(source *ec2.Instance) *fakeCloneBackend {
+	return &fakeCloneBackend{
+		instances: map[string]*ec2.Instance{aws.StringValue(source.InstanceId): source},
+		snapshots: make(map[string]string),
+		volumes:   make(map[string]string),
+		copyModes: make(map[string]string),
+		attached:  make(map[string]string),
+		imageIDs:  make(map[string]string),
+	}
+}
+
+// runCloneInline makes CloneInstance's background work run before it
+// returns.
+func runCloneInline(t *testing.T) {
+	orig := cloneAsync
+	cloneAsync = func(f func()) { f() }
+	t.Cleanup(func() { cloneAsync = orig })
+}
+
+func (f *fakeCloneBackend) id(prefix string) string {
+	f.nextID++
+	return fmt.Sprintf("%s-%08d", prefix, f.nextID)
+}
+
+func (f *fakeCloneBackend) describeInstance(instanceID string) (*ec2.Instance, error) {
+	inst, ok := f.instances[instanceID]
+	if !ok {
+		return nil, fmt.Errorf("%s", awserrors.ErrorInvalidInstanceIDNotFound)
+	}
+	return inst, nil
+}
+
+func (f *fakeCloneBackend) createImage(input *ec2.CreateImageInput) (string, error) {
+	f.images = append(f.images, input)
+	imageID := f.id("ami")
+	f.imageIDs[imageID] = f.id("snap")
+	return imageID, nil
+}
+
+func (f *fakeCloneBackend) imageSnapshotID(imageID string) (string, error) {
+	return f.imageIDs[imageID], nil
+}
+
+func (f *fakeCloneBackend) createSnapshot(volumeID, _ string) (string, error) {
+	snapID := f.id("snap")
+	f.snapshots[snapID] = volumeID
+	return snapID, nil
+}
+
+func (f *fakeCloneBackend) createVolume(snapshotID, _, copyMode string) (string, error) {
+	if f.failCreate && len(f.volumes) > 0 {
+		return "", fmt.Errorf("%s", awserrors.ErrorServerInternal)
+	}
+	volID := f.id("vol")
+	f.volumes[volID] = snapshotID
+	f.copyModes[volID] = copyMode
+	return volID, nil
+}
+
+func (f *fakeCloneBackend) volumeState(volumeID string) (string, error) {
+	if _, ok := f.volumes[volumeID]; !ok {
+		return "", fmt.Errorf("%s", awserrors.ErrorInvalidVolumeNotFound)
+	}
+	return ec2.VolumeStateAvailable, nil
+}
+
+func (f *fakeCloneBackend) deleteVolume(volumeID string) error {
+	f.deletedVols = append(f.deletedVols, volumeID)
+	return nil
+}
+
+func (f *fakeCloneBackend) deleteSnapshot(snapshotID string) error {
+	f.deletedSnaps = append(f.deletedSnaps, snapshotID)
+	return nil
+}
+
+func (f *fakeCloneBackend) deregisterImage(imageID string) error {
+	f.deregistered = append(f.deregistered, imageID)
+	return nil
+}
+
+func (f *fakeCloneBackend) runInstance(input *ec2.RunInstancesInput) (*ec2.Instance, error) {
+	f.runInputs = append(f.runInputs, input)
+	if f.failRun {
+		return nil, fmt.Errorf("%s", awserrors.ErrorInsufficientInstanceCapacity)
+	}
+	state := ec2.InstanceStateNameRunning
+	if f.cloneState != "" {
+		state = f.cloneState
+	}
+	inst := &ec2.Instance{
+		InstanceId:   aws.String(f.id("i")),
+		InstanceType: input.InstanceType,
+		State:        &ec2.InstanceState{Name: aws.String(state)},
+	}
+	f.instances[*inst.InstanceId] = inst
+	return inst, nil
+}
+
+func (f *fakeCloneBackend) attachVolume(volumeID, instanceID, _ string) error {
+	f.attached[volumeID] = instanceID
+	return nil
+}
+
+func cloneSourceInstance(state string) *ec2.Instance {
+	return &ec2.Instance{
+		InstanceId:     aws.String("i-source"),
+		InstanceType:   aws.String("t3.small"),
+		KeyName:        aws.String("my-key"),
+		SubnetId:       aws.String("subnet-1"),
+		RootDeviceName: aws.String("/dev/sda1"),
+		State:          &ec2.InstanceState{Name: aws.String(state)},
+		Placement:      &ec2.Placement{AvailabilityZone: aws.String("ap-southeast-2a")},
+		SecurityGroups: []*ec2.GroupIdentifier{{GroupId: aws.String("sg-1")}},
+		Tags:           []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String("web")}},
+		BlockDeviceMappings: []*ec2.InstanceBlockDeviceMapping{
+			{DeviceName: aws.String("/dev/sda1"), Ebs: &ec2.EbsInstanceBlockDevice{VolumeId: aws.String("vol-root")}},
+			{DeviceName: aws.String("/dev/sdf"), Ebs: &ec2.EbsInstanceBlockDevice{VolumeId: aws.String("vol-data1")}},
+			{DeviceName: aws.String("/dev/sdg"), Ebs: &ec2.EbsInstanceBlockDevice{VolumeId: aws.String("vol-data2")}},
+		},
+	}
+}
+
+func TestValidateCloneInstanceInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   *CloneInstanceInput
+		wantErr string
+	}{
+		{name: "NilInput", input: nil, wantErr: awserrors.ErrorInvalidParameterValue},
+		{name: "MissingInstanceID", input: &CloneInstanceInput{}, wantErr: awserrors.ErrorMissingParameter},
+		{name: "MalformedInstanceID", input: &CloneInstanceInput{InstanceID: "vol-123"}, wantErr: awserrors.ErrorInvalidInstanceIDMalformed},
+		{name: "UnknownCopyMode", input: &CloneInstanceInput{InstanceID: "i-123", CopyMode: "bogus"}, wantErr: awserrors.ErrorInvalidParameterValue},
+		{name: "DefaultCopyMode", input: &CloneInstanceInput{InstanceID: "i-123"}},
+		{name: "CopyOnWrite", input: &CloneInstanceInput{InstanceID: "i-123", CopyMode: CloneCopyOnWrite}},
+		{name: "FullCopy", input: &CloneInstanceInput{InstanceID: "i-123", CopyMode: CloneFullCopy}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateCloneInstanceInput(tt.input)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Equal(t, tt.wantErr, err.Error())
+		})
+	}
+}
+
+func TestCloneInstance_IndependentVolumes(t *testing.T) {
+	runCloneInline(t)
+	source := cloneSourceInstance(ec2.InstanceStateNameStopped)
+	backend := newFakeCloneBackend(source)
+
+	out, err := cloneInstance(&CloneInstanceInput{InstanceID: "i-source"}, backend)
+	require.NoError(t, err)
+
+	assert.Equal(t, "i-source", out.SourceInstanceID)
+	assert.NotEmpty(t, out.InstanceID)
+	assert.NotEqual(t, out.SourceInstanceID, out.InstanceID)
+	assert.False(t, out.CrashConsistent, "stopped source should yield a consistent clone")
+
+	require.Len(t, backend.images, 1)
+	assert.Equal(t, "i-source", aws.StringValue(backend.images[0].InstanceId))
+	assert.True(t, aws.BoolValue(backend.images[0].NoReboot))
+	require.Len(t, backend.runInputs, 1)
+	assert.Equal(t, out.ImageID, aws.StringValue(backend.runInputs[0].ImageId))
+
+	require.Len(t, out.Volumes, 3)
+	sourceVolumes := map[string]bool{"vol-root": true, "vol-data1": true, "vol-data2": true}
+	for _, vol := range out.Volumes {
+		if vol.SourceVolumeID == "vol-root" {
+			assert.True(t, vol.Attached, "root volume is attached at boot")
+			assert.Empty(t, vol.VolumeID, "root volume is created by RunInstances from the image")
+			continue
+		}
+		assert.False(t, vol.Attached, "data volumes are attached after the reply")
+		// Each data volume is a new volume restored from a fresh snapshot of its source.
+		assert.NotEmpty(t, vol.VolumeID)
+		assert.False(t, sourceVolumes[vol.VolumeID], "clone must not reuse source volume %s", vol.VolumeID)
+		assert.Equal(t, vol.SourceVolumeID, backend.snapshots[vol.SnapshotID])
+		assert.Equal(t, vol.SnapshotID, backend.volumes[vol.VolumeID])
+		assert.Equal(t, out.InstanceID, backend.attached[vol.VolumeID])
+	}
+	assert.Len(t, backend.snapshots, 2)
+	assert.Len(t, backend.volumes, 2)
+	assert.NotContains(t, backend.attached, "vol-data1")
+	assert.NotContains(t, backend.attached, "vol-data2")
+
+	// The AMI is only needed to launch; copy-on-write keeps the snapshots.
+	assert.Equal(t, []string{out.ImageID}, backend.deregistered)
+	assert.Empty(t, backend.deletedSnaps)
+	assert.Empty(t, backend.deletedVols)
+}
+
+func TestCloneInstance_FullCopy(t *testing.T) {
+	runCloneInline(t)
+	backend := newFakeCloneBackend(cloneSourceInstance(ec2.InstanceStateNameStopped))
+
+	out, err := cloneInstance(&CloneInstanceInput{InstanceID: "i-source", CopyMode: CloneFullCopy}, backend)
+	require.NoError(t, err)
+
+	// The root volume is copied through the launch's volume tags.
+	run := backend.runInputs[0]
+	require.Len(t, run.TagSpecifications, 1)
+	assert.Equal(t, "volume", aws.StringValue(run.TagSpecifications[0].ResourceType))
+	assert.Equal(t, vm.CopyModeTag, aws.StringValue(run.TagSpecifications[0].Tags[0].Key))
+	assert.Equal(t, CloneFullCopy, aws.StringValue(run.TagSpecifications[0].Tags[0].Value))
+
+	var snapshots []string
+	for _, vol := range out.Volumes {
+		if vol.VolumeID == "" {
+			continue
+		}
+		assert.Equal(t, CloneFullCopy, backend.copyModes[vol.VolumeID])
+		assert.Equal(t, out.InstanceID, backend.attached[vol.VolumeID])
+		snapshots = append(snapshots, vol.SnapshotID)
+	}
+	// Every snapshot, the image's included, goes once the copies are done.
+	snapshots = append(snapshots, backend.imageIDs[out.ImageID])
+	assert.ElementsMatch(t, snapshots, backend.deletedSnaps)
+	assert.Equal(t, []string{out.ImageID}, backend.deregistered)
+	assert.Empty(t, backend.deletedVols)
+}
+
+func TestCloneInstance_CleansUpOnFailure(t *testing.T) {
+	runCloneInline(t)
+
+	t.Run("CreateVolume", func(t *testing.T) {
+		backend := newFakeCloneBackend(cloneSourceInstance(ec2.InstanceStateNameStopped))
+		backend.failCreate = true
+
+		_, err := cloneInstance(&CloneInstanceInput{InstanceID: "i-source"}, backend)
+		require.Error(t, err)
+		assert.Empty(t, backend.runInputs)
+
+		require.Len(t, backend.volumes, 1)
+		assert.ElementsMatch(t, slices.Collect(maps.Keys(backend.volumes)), backend.deletedVols)
+		// Both data snapshots and the image's snapshot.
+		assert.Len(t, backend.deletedSnaps, 3)
+		require.Len(t, backend.imageIDs, 1)
+		for imageID, snapshotID := range backend.imageIDs {
+			assert.Equal(t, []string{imageID}, backend.deregistered)
+			assert.Contains(t, backend.deletedSnaps, snapshotID)
+		}
+	})
+
+	t.Run("RunInstances", func(t *testing.T) {
+		backend := newFakeCloneBackend(cloneSourceInstance(ec2.InstanceStateNameStopped))
+		backend.failRun = true
+
+		_, err := cloneInstance(&CloneInstanceInput{InstanceID: "i-source"}, backend)
+		require.Error(t, err)
+		assert.Len(t, backend.deletedVols, 2)
+		assert.Len(t, backend.deletedSnaps, 3)
+		assert.Len(t, backend.deregistered, 1)
+	})
+
+	t.Run("CloneTerminated", func(t *testing.T) {
+		backend := newFakeCloneBackend(cloneSourceInstance(ec2.InstanceStateNameStopped))
+		backend.cloneState = ec2.InstanceStateNameTerminated
+
+		out, err := cloneInstance(&CloneInstanceInput{InstanceID: "i-source"}, backend)
+		require.NoError(t, err)
+		assert.Empty(t, backend.attached)
+		assert.Len(t, backend.deletedVols, 2)
+		assert.Len(t, backend.deletedSnaps, 3)
+		assert.Equal(t, []string{out.ImageID}, backend.deregistered)
+	})
+}
+
+func TestCloneInstance_RepliesBeforeCloneRuns(t *testing.T) {
+	release := make(chan struct{})
+	done := make(chan struct{})
+	orig := cloneAsync
+	cloneAsync = func(f func()) {
+		go func() {
+			defer close(done)
+			<-release
+			f()
+		}()
+	}
+	t.Cleanup(func() { cloneAsync = orig })
+
+	backend := newFakeCloneBackend(cloneSourceInstance(ec2.InstanceStateNameStopped))
+	out, err := cloneInstance(&CloneInstanceInput{InstanceID: "i-source"}, backend)
+	require.NoError(t, err)
+	assert.NotEmpty(t, out.InstanceID)
+	assert.Empty(t, backend.attached)
+	assert.Empty(t, backend.deregistered)
+
+	close(release)
+	<-done
+	assert.Len(t, backend.attached, 2)
+	assert.Equal(t, []string{out.ImageID}, backend.deregistered)
+}
+
+func TestCloneInstance_RunningSourceIsCrashConsistent(t *testing.T) {
+	runCloneInline(t)
+	backend := newFakeCloneBackend(cloneSourceInstance(ec2.InstanceStateNameRunning))
+
+	out, err := cloneInstance(&CloneInstanceInput{InstanceID: "i-source"}, backend)
+	require.NoError(t, err)
+	assert.True(t, out.CrashConsistent)
+}
+
+func TestCloneInstance_IncorrectState(t *testing.T) {
+	for _, state := range []string{ec2.InstanceStateNamePending, ec2.InstanceStateNameStopping, ec2.InstanceStateNameTerminated} {
+		t.Run(state, func(t *testing.T) {
+			backend := newFakeCloneBackend(cloneSourceInstance(state))
+
+			_, err := cloneInstance(&CloneInstanceInput{InstanceID: "i-source"}, backend)
+			require.Error(t, err)
+			assert.Equal(t, awserrors.ErrorIncorrectInstanceState, err.Error())
+			assert.Empty(t, backend.images)
+			assert.Empty(t, backend.runInputs)
+		})
+	}
+}
+
+func TestCloneInstance_LaunchParameters(t *testing.T) {
+	runCloneInline(t)
+	t.Run("InheritsSourceTypeWithoutTags", func(t *testing.T) {
+		backend := newFakeCloneBackend(cloneSourceInstance(ec2.InstanceStateNameStopped))
+
+		_, err := cloneInstance(&CloneInstanceInput{InstanceID: "i-source"}, backend)
+		require.NoError(t, err)
+
+		run := backend.runInputs[0]
+		assert.Equal(t, "t3.small", aws.StringValue(run.InstanceType))
+		assert.Equal(t, "my-key", aws.StringValue(run.KeyName))
+		assert.Equal(t, "subnet-1", aws.StringValue(run.SubnetId))
+		assert.Equal(t, []*string{aws.String("sg-1")}, run.SecurityGroupIds)
+		assert.Equal(t, "ap-southeast-2a", aws.StringValue(run.Placement.AvailabilityZone))
+		assert.Empty(t, run.TagSpecifications)
+	})
+
+	t.Run("OverrideTypeAndCopyTags", func(t *testing.T) {
+		backend := newFakeCloneBackend(cloneSourceInstance(ec2.InstanceStateNameStopped))
+
+		_, err := cloneInstance(&CloneInstanceInput{InstanceID: "i-source", InstanceType: "t3.large", CopyTags: true}, backend)
+		require.NoError(t, err)
+
+		run := backend.runInputs[0]
+		assert.Equal(t, "t3.large", aws.StringValue(run.InstanceType))
+		require.Len(t, run.TagSpecifications, 1)
+		assert.Equal(t, "instance", aws.StringValue(run.TagSpecifications[0].ResourceType))
+		require.Len(t, run.TagSpecifications[0].Tags, 1)
+		assert.Equal(t, "Name", aws.StringValue(run.TagSpecifications[0].Tags[0].Key))
+		assert.Equal(t, "web", aws.StringValue(run.TagSpecifications[0].Tags[0].Value))
+	})
+}
+
+func TestCloneInstance_CloneNeverRuns(t *testing.T) {
+	runCloneInline(t)
+	origTimeout, origPoll := cloneAttachTimeout, clonePollInterval
+	cloneAttachTimeout, clonePollInterval = 50*time.Millisecond, 10*time.Millisecond
+	t.Cleanup(func() { cloneAttachTimeout, clonePollInterval = origTimeout, origPoll })
+
+	backend := &pendingCloneBackend{newFakeCloneBackend(cloneSourceInstance(ec2.InstanceStateNameStopped))}
+
+	out, err := cloneInstance(&CloneInstanceInput{InstanceID: "i-source"}, backend)
+	require.NoError(t, err)
+	assert.NotEmpty(t, out.InstanceID)
+	assert.Empty(t, backend.attached, "data volumes should be left detached")
+	// A clone that may still boot keeps what it was launched from.
+	assert.Empty(t, backend.deletedVols)
+	assert.Empty(t, backend.deregistered)
+}
+
+// pendingCloneBackend launches clones that never leave pending.
+type pendingCloneBackend struct {
+	*fakeCloneBackend
+}
+
+func (p *pendingCloneBackend) runInstance(input *ec2.RunInstancesInput) (*ec2.Instance, error) {
+	inst, err := p.fakeCloneBackend.runInstance(input)
+	if err != nil {
+		return nil, err
+	}
+	inst.State.Name = aws.String(ec2.InstanceStateNamePending)
+	return inst, nil
+}
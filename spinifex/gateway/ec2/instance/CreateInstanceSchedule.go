@@ -0,0 +1,52 @@
+package gateway_ec2_instance
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_ec2_instanceschedule "github.com/mulgadc/spinifex/spinifex/handlers/ec2/instanceschedule"
+	"github.com/nats-io/nats.go"
+)
+
+// ValidateCreateInstanceScheduleInput validates the input parameters
+func ValidateCreateInstanceScheduleInput(input *handlers_ec2_instanceschedule.CreateInstanceScheduleInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if input.InstanceID == "" || input.Action == "" || input.ScheduleExpression == "" {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	if !strings.HasPrefix(input.InstanceID, "i-") {
+		return errors.New(awserrors.ErrorInvalidInstanceIDMalformed)
+	}
+	if input.Action != handlers_ec2_instanceschedule.ScheduleActionStart && input.Action != handlers_ec2_instanceschedule.ScheduleActionStop {
+		return awserrors.WithDetail(awserrors.ErrorInvalidParameterValue, "Action must be start or stop")
+	}
+	if _, err := handlers_ec2_instanceschedule.ParseSchedule(input.ScheduleExpression, input.Timezone); err != nil {
+		return awserrors.WithDetail(awserrors.ErrorInvalidParameterValue, err.Error())
+	}
+	return nil
+}
+
+// CreateInstanceSchedule adds a recurring start or stop to one of the
+// caller's instances. The instance may be running or stopped, but not
+// terminated.
+func CreateInstanceSchedule(input *handlers_ec2_instanceschedule.CreateInstanceScheduleInput, natsConn *nats.Conn, expectedNodes int, accountID string) (*handlers_ec2_instanceschedule.InstanceSchedule, error) {
+	if err := ValidateCreateInstanceScheduleInput(input); err != nil {
+		return nil, err
+	}
+
+	instance, err := describeInstance(input.InstanceID, natsConn, expectedNodes, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if instance.State != nil && aws.StringValue(instance.State.Name) == ec2.InstanceStateNameTerminated {
+		return nil, errors.New(awserrors.ErrorInvalidInstanceIDNotFound)
+	}
+
+	svc := handlers_ec2_instanceschedule.NewNATSInstanceScheduleService(natsConn)
+	return svc.CreateInstanceSchedule(input, accountID)
+}
@@ -0,0 +1,99 @@
+package gateway_ec2_instance
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_ec2_instanceschedule "github.com/mulgadc/spinifex/spinifex/handlers/ec2/instanceschedule"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateCreateInstanceScheduleInput(t *testing.T) {
+	type scheduleInput = handlers_ec2_instanceschedule.CreateInstanceScheduleInput
+	valid := func() *scheduleInput {
+		return &scheduleInput{
+			InstanceID:         "i-123",
+			Action:             handlers_ec2_instanceschedule.ScheduleActionStop,
+			ScheduleExpression: "0 20 * * *",
+			Timezone:           "Europe/London",
+		}
+	}
+
+	assert.NoError(t, ValidateCreateInstanceScheduleInput(valid()))
+	assert.EqualError(t, ValidateCreateInstanceScheduleInput(nil), awserrors.ErrorInvalidParameterValue)
+
+	tests := []struct {
+		name    string
+		modify  func(*scheduleInput)
+		wantErr string
+	}{
+		{"MissingExpression", func(in *scheduleInput) { in.ScheduleExpression = "" }, awserrors.ErrorMissingParameter},
+		{"MalformedInstance", func(in *scheduleInput) { in.InstanceID = "vol-123" }, awserrors.ErrorInvalidInstanceIDMalformed},
+		{"UnsupportedAction", func(in *scheduleInput) { in.Action = "terminate" }, awserrors.ErrorInvalidParameterValue},
+		{"BadExpression", func(in *scheduleInput) { in.ScheduleExpression = "every day" }, awserrors.ErrorInvalidParameterValue},
+		{"BadTimezone", func(in *scheduleInput) { in.Timezone = "Nowhere" }, awserrors.ErrorInvalidParameterValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := valid()
+			tt.modify(input)
+			assert.EqualError(t, ValidateCreateInstanceScheduleInput(input), tt.wantErr)
+		})
+	}
+}
+
+func TestCreateInstanceSchedule_ChecksInstance(t *testing.T) {
+	_, nc := startTestNATSServer(t)
+
+	states := map[string]string{"i-running": ec2.InstanceStateNameRunning, "i-terminated": ec2.InstanceStateNameTerminated}
+	_, err := nc.Subscribe("ec2.DescribeInstances", func(msg *nats.Msg) {
+		var input ec2.DescribeInstancesInput
+		_ = json.Unmarshal(msg.Data, &input)
+		out := &ec2.DescribeInstancesOutput{}
+		for _, id := range input.InstanceIds {
+			if state, ok := states[aws.StringValue(id)]; ok {
+				out.Reservations = append(out.Reservations, &ec2.Reservation{Instances: []*ec2.Instance{{
+					InstanceId: id,
+					State:      &ec2.InstanceState{Name: aws.String(state)},
+				}}})
+			}
+		}
+		data, _ := json.Marshal(out)
+		msg.Respond(data)
+	})
+	require.NoError(t, err)
+
+	var created []string
+	_, err = nc.Subscribe("ec2.CreateInstanceSchedule", func(msg *nats.Msg) {
+		var input handlers_ec2_instanceschedule.CreateInstanceScheduleInput
+		_ = json.Unmarshal(msg.Data, &input)
+		created = append(created, input.InstanceID)
+		data, _ := json.Marshal(&handlers_ec2_instanceschedule.InstanceSchedule{InstanceScheduleID: "isch-1", InstanceID: input.InstanceID})
+		msg.Respond(data)
+	})
+	require.NoError(t, err)
+
+	input := func(instanceID string) *handlers_ec2_instanceschedule.CreateInstanceScheduleInput {
+		return &handlers_ec2_instanceschedule.CreateInstanceScheduleInput{
+			InstanceID:         instanceID,
+			Action:             handlers_ec2_instanceschedule.ScheduleActionStart,
+			ScheduleExpression: "0 8 * * MON-FRI",
+		}
+	}
+
+	out, err := CreateInstanceSchedule(input("i-running"), nc, 1, "123456789012")
+	require.NoError(t, err)
+	assert.Equal(t, "isch-1", out.InstanceScheduleID)
+
+	_, err = CreateInstanceSchedule(input("i-terminated"), nc, 1, "123456789012")
+	assert.EqualError(t, err, awserrors.ErrorInvalidInstanceIDNotFound)
+	_, err = CreateInstanceSchedule(input("i-unknown"), nc, 1, "123456789012")
+	assert.EqualError(t, err, awserrors.ErrorInvalidInstanceIDNotFound)
+
+	assert.Equal(t, []string{"i-running"}, created, "only the caller's live instance gets a schedule")
+}
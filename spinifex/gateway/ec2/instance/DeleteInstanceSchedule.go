@@ -0,0 +1,33 @@
+package gateway_ec2_instance
+
+import (
+	"errors"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_ec2_instanceschedule "github.com/mulgadc/spinifex/spinifex/handlers/ec2/instanceschedule"
+	"github.com/nats-io/nats.go"
+)
+
+// ValidateDeleteInstanceScheduleInput validates the input parameters
+func ValidateDeleteInstanceScheduleInput(input *handlers_ec2_instanceschedule.DeleteInstanceScheduleInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if input.InstanceScheduleID == "" {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	if !handlers_ec2_instanceschedule.IsValidScheduleID(input.InstanceScheduleID) {
+		return errors.New(awserrors.ErrorInvalidInstanceScheduleIDMalformed)
+	}
+	return nil
+}
+
+// DeleteInstanceSchedule removes one of the caller's instance schedules.
+func DeleteInstanceSchedule(input *handlers_ec2_instanceschedule.DeleteInstanceScheduleInput, natsConn *nats.Conn, accountID string) (*handlers_ec2_instanceschedule.DeleteInstanceScheduleOutput, error) {
+	if err := ValidateDeleteInstanceScheduleInput(input); err != nil {
+		return nil, err
+	}
+
+	svc := handlers_ec2_instanceschedule.NewNATSInstanceScheduleService(natsConn)
+	return svc.DeleteInstanceSchedule(input, accountID)
+}
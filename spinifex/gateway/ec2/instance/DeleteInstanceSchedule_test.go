@@ -0,0 +1,20 @@
+package gateway_ec2_instance
+
+import (
+	"testing"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_ec2_instanceschedule "github.com/mulgadc/spinifex/spinifex/handlers/ec2/instanceschedule"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateDeleteInstanceScheduleInput(t *testing.T) {
+	assert.EqualError(t, ValidateDeleteInstanceScheduleInput(nil), awserrors.ErrorInvalidParameterValue)
+	assert.EqualError(t, ValidateDeleteInstanceScheduleInput(&handlers_ec2_instanceschedule.DeleteInstanceScheduleInput{}), awserrors.ErrorMissingParameter)
+	assert.EqualError(t, ValidateDeleteInstanceScheduleInput(&handlers_ec2_instanceschedule.DeleteInstanceScheduleInput{
+		InstanceScheduleID: "i-123",
+	}), awserrors.ErrorInvalidInstanceScheduleIDMalformed)
+	assert.NoError(t, ValidateDeleteInstanceScheduleInput(&handlers_ec2_instanceschedule.DeleteInstanceScheduleInput{
+		InstanceScheduleID: "isch-0123456789abcdef0",
+	}))
+}
@@ -1,31 +1,111 @@
 package gateway_ec2_instance
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
 )
 
-// DescribeInstanceCreditSpecifications returns CPU credit specifications for T-series instances.
-// Stub: always returns "standard" mode for each requested instance.
-func DescribeInstanceCreditSpecifications(input *ec2.DescribeInstanceCreditSpecificationsInput) (*ec2.DescribeInstanceCreditSpecificationsOutput, error) {
+// DescribeInstanceCreditSpecifications returns the CPU credit mode of the
+// caller's burstable instances, or of the listed ones. Running instances are
+// gathered from every node and stopped ones from shared KV; instances that
+// don't use CPU credits are left out.
+func DescribeInstanceCreditSpecifications(input *ec2.DescribeInstanceCreditSpecificationsInput, natsConn *nats.Conn, expectedNodes int, accountID string) (*ec2.DescribeInstanceCreditSpecificationsOutput, error) {
 	if input == nil {
 		return nil, errors.New(awserrors.ErrorInvalidParameterValue)
 	}
-
-	var specs []*ec2.InstanceCreditSpecification
 	for _, id := range input.InstanceIds {
-		if id != nil && *id != "" {
-			specs = append(specs, &ec2.InstanceCreditSpecification{
-				InstanceId: id,
-				CpuCredits: aws.String("standard"),
-			})
+		if !strings.HasPrefix(aws.StringValue(id), "i-") {
+			return nil, errors.New(awserrors.ErrorInvalidInstanceIDMalformed)
+		}
+	}
+
+	jsonData, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal input: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	specs := []*ec2.InstanceCreditSpecification{}
+	add := func(nodeOutput *ec2.DescribeInstanceCreditSpecificationsOutput) {
+		for _, spec := range nodeOutput.InstanceCreditSpecifications {
+			if id := aws.StringValue(spec.InstanceId); id != "" && !seen[id] {
+				seen[id] = true
+				specs = append(specs, spec)
+			}
 		}
 	}
 
-	return &ec2.DescribeInstanceCreditSpecificationsOutput{
-		InstanceCreditSpecifications: specs,
-	}, nil
+	err = gatherFromNodes(natsConn, "ec2.DescribeInstanceCreditSpecifications", jsonData, expectedNodes, accountID, func(data []byte) {
+		var nodeOutput ec2.DescribeInstanceCreditSpecificationsOutput
+		if err := json.Unmarshal(data, &nodeOutput); err != nil {
+			slog.Error("DescribeInstanceCreditSpecifications: Failed to unmarshal node response", "err", err)
+			return
+		}
+		add(&nodeOutput)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stopped, err := utils.NATSRequest[ec2.DescribeInstanceCreditSpecificationsOutput](natsConn, "ec2.DescribeStoppedInstanceCreditSpecifications", input, 3*time.Second, accountID)
+	if err != nil {
+		slog.Warn("DescribeInstanceCreditSpecifications: Failed to query stopped instances", "err", err)
+	} else {
+		add(stopped)
+	}
+
+	slices.SortFunc(specs, func(a, b *ec2.InstanceCreditSpecification) int {
+		return strings.Compare(aws.StringValue(a.InstanceId), aws.StringValue(b.InstanceId))
+	})
+	return &ec2.DescribeInstanceCreditSpecificationsOutput{InstanceCreditSpecifications: specs}, nil
+}
+
+// gatherFromNodes publishes data to every node on topic and passes each
+// successful reply to handle, until expectedNodes have answered or the
+// 3 second deadline passes. Error replies are logged and skipped.
+func gatherFromNodes(natsConn *nats.Conn, topic string, data []byte, expectedNodes int, accountID string, handle func([]byte)) error {
+	inbox := nats.NewInbox()
+	sub, err := natsConn.SubscribeSync(inbox)
+	if err != nil {
+		return fmt.Errorf("failed to create inbox: %w", err)
+	}
+	defer sub.Unsubscribe()
+
+	pubMsg := nats.NewMsg(utils.Subject(topic))
+	pubMsg.Reply = inbox
+	pubMsg.Data = data
+	pubMsg.Header.Set(utils.AccountIDHeader, accountID)
+	if err := natsConn.PublishMsg(pubMsg); err != nil {
+		return fmt.Errorf("failed to publish request: %w", err)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for responses := 0; expectedNodes <= 0 || responses < expectedNodes; responses++ {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			break
+		}
+		msg, err := sub.NextMsg(remaining)
+		if err != nil {
+			break
+		}
+		reply := utils.DecodeReply(msg)
+		if reply.Err != nil {
+			slog.Warn("Received error from node", "topic", topic, "code", reply.Err.Code)
+			continue
+		}
+		handle(reply.Result)
+	}
+	return nil
 }
@@ -1,55 +1,75 @@
 package gateway_ec2_instance
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/nats-io/nats.go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+func respondCreditSpecs(t *testing.T, nc *nats.Conn, topic string, ids ...string) {
+	t.Helper()
+	_, err := nc.Subscribe(topic, func(msg *nats.Msg) {
+		output := &ec2.DescribeInstanceCreditSpecificationsOutput{}
+		for _, id := range ids {
+			output.InstanceCreditSpecifications = append(output.InstanceCreditSpecifications,
+				&ec2.InstanceCreditSpecification{InstanceId: aws.String(id), CpuCredits: aws.String("standard")})
+		}
+		data, _ := json.Marshal(output)
+		msg.Respond(data)
+	})
+	require.NoError(t, err)
+}
+
 func TestDescribeInstanceCreditSpecifications_NilInput(t *testing.T) {
-	out, err := DescribeInstanceCreditSpecifications(nil)
+	out, err := DescribeInstanceCreditSpecifications(nil, nil, 0, "123456789012")
 	require.Error(t, err)
 	assert.Nil(t, out)
 	assert.Equal(t, awserrors.ErrorInvalidParameterValue, err.Error())
 }
 
-func TestDescribeInstanceCreditSpecifications_EmptyInstanceIds(t *testing.T) {
-	out, err := DescribeInstanceCreditSpecifications(&ec2.DescribeInstanceCreditSpecificationsInput{})
-	require.NoError(t, err)
-	assert.Empty(t, out.InstanceCreditSpecifications)
+func TestDescribeInstanceCreditSpecifications_MalformedInstanceId(t *testing.T) {
+	out, err := DescribeInstanceCreditSpecifications(&ec2.DescribeInstanceCreditSpecificationsInput{
+		InstanceIds: []*string{aws.String("abc123")},
+	}, nil, 0, "123456789012")
+	require.Error(t, err)
+	assert.Nil(t, out)
+	assert.Equal(t, awserrors.ErrorInvalidInstanceIDMalformed, err.Error())
 }
 
-func TestDescribeInstanceCreditSpecifications_SingleInstance(t *testing.T) {
-	out, err := DescribeInstanceCreditSpecifications(&ec2.DescribeInstanceCreditSpecificationsInput{
-		InstanceIds: []*string{aws.String("i-abc123")},
-	})
+func TestDescribeInstanceCreditSpecifications_MergesNodesAndStopped(t *testing.T) {
+	_, nc := startTestNATSServer(t)
+
+	respondCreditSpecs(t, nc, "ec2.DescribeInstanceCreditSpecifications", "i-ccc", "i-aaa")
+	nc2, err := nats.Connect(nc.ConnectedUrl())
 	require.NoError(t, err)
-	require.Len(t, out.InstanceCreditSpecifications, 1)
-	assert.Equal(t, "i-abc123", *out.InstanceCreditSpecifications[0].InstanceId)
-	assert.Equal(t, "standard", *out.InstanceCreditSpecifications[0].CpuCredits)
-}
+	defer nc2.Close()
+	respondCreditSpecs(t, nc2, "ec2.DescribeInstanceCreditSpecifications", "i-bbb")
+	// A stopped instance also reported by a node mid-migration is listed once.
+	respondCreditSpecs(t, nc, "ec2.DescribeStoppedInstanceCreditSpecifications", "i-ddd", "i-aaa")
+	require.NoError(t, nc2.Flush())
 
-func TestDescribeInstanceCreditSpecifications_MultipleInstances(t *testing.T) {
-	out, err := DescribeInstanceCreditSpecifications(&ec2.DescribeInstanceCreditSpecificationsInput{
-		InstanceIds: []*string{aws.String("i-aaa"), aws.String("i-bbb"), aws.String("i-ccc")},
-	})
+	out, err := DescribeInstanceCreditSpecifications(&ec2.DescribeInstanceCreditSpecificationsInput{}, nc, 2, "123456789012")
 	require.NoError(t, err)
-	require.Len(t, out.InstanceCreditSpecifications, 3)
+
+	var ids []string
 	for _, spec := range out.InstanceCreditSpecifications {
-		assert.Equal(t, "standard", *spec.CpuCredits)
+		ids = append(ids, *spec.InstanceId)
 	}
+	assert.Equal(t, []string{"i-aaa", "i-bbb", "i-ccc", "i-ddd"}, ids)
 }
 
-func TestDescribeInstanceCreditSpecifications_SkipsNilAndEmpty(t *testing.T) {
-	out, err := DescribeInstanceCreditSpecifications(&ec2.DescribeInstanceCreditSpecificationsInput{
-		InstanceIds: []*string{nil, aws.String(""), aws.String("i-valid"), nil, aws.String("i-also")},
-	})
+func TestDescribeInstanceCreditSpecifications_NoStoppedResponder(t *testing.T) {
+	_, nc := startTestNATSServer(t)
+	respondCreditSpecs(t, nc, "ec2.DescribeInstanceCreditSpecifications", "i-aaa")
+
+	out, err := DescribeInstanceCreditSpecifications(&ec2.DescribeInstanceCreditSpecificationsInput{}, nc, 1, "123456789012")
 	require.NoError(t, err)
-	require.Len(t, out.InstanceCreditSpecifications, 2)
-	assert.Equal(t, "i-valid", *out.InstanceCreditSpecifications[0].InstanceId)
-	assert.Equal(t, "i-also", *out.InstanceCreditSpecifications[1].InstanceId)
+	require.Len(t, out.InstanceCreditSpecifications, 1)
+	assert.Equal(t, "i-aaa", *out.InstanceCreditSpecifications[0].InstanceId)
 }
@@ -0,0 +1,32 @@
+package gateway_ec2_instance
+
+import (
+	"errors"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_ec2_instanceschedule "github.com/mulgadc/spinifex/spinifex/handlers/ec2/instanceschedule"
+	"github.com/nats-io/nats.go"
+)
+
+// ValidateDescribeInstanceSchedulesInput validates the input parameters
+func ValidateDescribeInstanceSchedulesInput(input *handlers_ec2_instanceschedule.DescribeInstanceSchedulesInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	for _, id := range input.InstanceScheduleIDs {
+		if !handlers_ec2_instanceschedule.IsValidScheduleID(id) {
+			return errors.New(awserrors.ErrorInvalidInstanceScheduleIDMalformed)
+		}
+	}
+	return nil
+}
+
+// DescribeInstanceSchedules lists the caller's instance schedules.
+func DescribeInstanceSchedules(input *handlers_ec2_instanceschedule.DescribeInstanceSchedulesInput, natsConn *nats.Conn, accountID string) (*handlers_ec2_instanceschedule.DescribeInstanceSchedulesOutput, error) {
+	if err := ValidateDescribeInstanceSchedulesInput(input); err != nil {
+		return nil, err
+	}
+
+	svc := handlers_ec2_instanceschedule.NewNATSInstanceScheduleService(natsConn)
+	return svc.DescribeInstanceSchedules(input, accountID)
+}
@@ -0,0 +1,17 @@
+package gateway_ec2_instance
+
+import (
+	"testing"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_ec2_instanceschedule "github.com/mulgadc/spinifex/spinifex/handlers/ec2/instanceschedule"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateDescribeInstanceSchedulesInput(t *testing.T) {
+	assert.EqualError(t, ValidateDescribeInstanceSchedulesInput(nil), awserrors.ErrorInvalidParameterValue)
+	assert.NoError(t, ValidateDescribeInstanceSchedulesInput(&handlers_ec2_instanceschedule.DescribeInstanceSchedulesInput{}))
+	assert.EqualError(t, ValidateDescribeInstanceSchedulesInput(&handlers_ec2_instanceschedule.DescribeInstanceSchedulesInput{
+		InstanceScheduleIDs: []string{"isch-1", "sched-2"},
+	}), awserrors.ErrorInvalidInstanceScheduleIDMalformed)
+}
@@ -0,0 +1,243 @@
+package gateway_ec2_instance
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/filterutil"
+	handlers_ec2_instanceevent "github.com/mulgadc/spinifex/spinifex/handlers/ec2/instanceevent"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+)
+
+// describeInstanceStatusValidFilters defines the set of filter names accepted by DescribeInstanceStatus.
+var describeInstanceStatusValidFilters = map[string]bool{
+	"instance-state-name": true,
+	"event.code":          true,
+}
+
+// ValidateDescribeInstanceStatusInput validates the input parameters
+func ValidateDescribeInstanceStatusInput(input *ec2.DescribeInstanceStatusInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	for _, id := range input.InstanceIds {
+		if id != nil && !strings.HasPrefix(*id, "i-") {
+			return errors.New(awserrors.ErrorInvalidInstanceIDMalformed)
+		}
+	}
+	return nil
+}
+
+// DescribeInstanceStatus reports instance state together with any scheduled
+// events and the nodes' reachability checks. Only running instances are
+// returned unless IncludeAllInstances is set.
+func DescribeInstanceStatus(input *ec2.DescribeInstanceStatusInput, natsConn *nats.Conn, expectedNodes int, accountID string) (*ec2.DescribeInstanceStatusOutput, error) {
+	if err := ValidateDescribeInstanceStatusInput(input); err != nil {
+		return nil, err
+	}
+	filters, err := filterutil.ParseFilters(input.Filters, describeInstanceStatusValidFilters)
+	if err != nil {
+		slog.Warn("DescribeInstanceStatus: invalid filter", "err", err)
+		return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+
+	instances, err := DescribeInstances(&ec2.DescribeInstancesInput{InstanceIds: input.InstanceIds}, natsConn, expectedNodes, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	eventsInput := &handlers_ec2_instanceevent.DescribeInstanceEventsInput{}
+	for _, id := range input.InstanceIds {
+		if id != nil {
+			eventsInput.InstanceIDs = append(eventsInput.InstanceIDs, *id)
+		}
+	}
+	svc := handlers_ec2_instanceevent.NewNATSInstanceEventService(natsConn)
+	events, err := svc.DescribeInstanceEvents(eventsInput, accountID)
+	if err != nil {
+		// Status is still useful without events; don't fail the whole call.
+		slog.Warn("DescribeInstanceStatus: failed to query scheduled events", "err", err)
+		events = &handlers_ec2_instanceevent.DescribeInstanceEventsOutput{}
+	}
+
+	boot := describeInstanceBootStatus(eventsInput.InstanceIDs, natsConn, expectedNodes, accountID)
+
+	return &ec2.DescribeInstanceStatusOutput{
+		InstanceStatuses: buildInstanceStatuses(instances.Reservations, events.Events, boot, aws.BoolValue(input.IncludeAllInstances), filters),
+	}, nil
+}
+
+// describeInstanceBootStatus collects boot milestones and reachability checks
+// from every node. Like events, status is still useful without them, so
+// failures only log.
+func describeInstanceBootStatus(instanceIDs []string, natsConn *nats.Conn, expectedNodes int, accountID string) *types.DescribeInstanceBootStatusOutput {
+	boot := &types.DescribeInstanceBootStatusOutput{
+		Instances:    map[string]types.InstanceBootStatus{},
+		Reachability: map[string]types.InstanceReachability{},
+	}
+
+	data, err := json.Marshal(&types.DescribeInstanceBootStatusInput{InstanceIDs: instanceIDs})
+	if err != nil {
+		slog.Warn("DescribeInstanceStatus: failed to marshal boot status input", "err", err)
+		return boot
+	}
+
+	inbox := nats.NewInbox()
+	sub, err := natsConn.SubscribeSync(inbox)
+	if err != nil {
+		slog.Warn("DescribeInstanceStatus: failed to create inbox", "err", err)
+		return boot
+	}
+	defer sub.Unsubscribe()
+
+	pubMsg := nats.NewMsg(utils.Subject("ec2.DescribeInstanceBootStatus"))
+	pubMsg.Reply = inbox
+	pubMsg.Data = data
+	pubMsg.Header.Set(utils.AccountIDHeader, accountID)
+	if err := natsConn.PublishMsg(pubMsg); err != nil {
+		slog.Warn("DescribeInstanceStatus: failed to query boot status", "err", err)
+		return boot
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for responses := 0; expectedNodes <= 0 || responses < expectedNodes; responses++ {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			break
+		}
+		msg, err := sub.NextMsg(remaining)
+		if err != nil {
+			break
+		}
+		var nodeOutput types.DescribeInstanceBootStatusOutput
+		if err := json.Unmarshal(msg.Data, &nodeOutput); err != nil {
+			slog.Debug("DescribeInstanceStatus: skipping malformed boot status", "err", err)
+			continue
+		}
+		maps.Copy(boot.Instances, nodeOutput.Instances)
+		maps.Copy(boot.Reachability, nodeOutput.Reachability)
+	}
+	return boot
+}
+
+// buildInstanceStatuses joins instances with their scheduled events, boot
+// milestones and reachability checks. boot may be nil.
+func buildInstanceStatuses(reservations []*ec2.Reservation, events map[string][]*ec2.InstanceStatusEvent, boot *types.DescribeInstanceBootStatusOutput, includeAll bool, filters map[string][]string) []*ec2.InstanceStatus {
+	if boot == nil {
+		boot = &types.DescribeInstanceBootStatusOutput{}
+	}
+	statuses := []*ec2.InstanceStatus{}
+	for _, reservation := range reservations {
+		for _, inst := range reservation.Instances {
+			if inst.InstanceId == nil || inst.State == nil {
+				continue
+			}
+			stateName := aws.StringValue(inst.State.Name)
+			if !includeAll && stateName != ec2.InstanceStateNameRunning {
+				continue
+			}
+			if values, ok := filters["instance-state-name"]; ok && !filterutil.MatchesAny(values, stateName) {
+				continue
+			}
+
+			instanceEvents := events[*inst.InstanceId]
+			if event := serverStopEvent(inst, stateName); event != nil {
+				instanceEvents = append(slices.Clip(instanceEvents), event)
+			}
+			if values, ok := filters["event.code"]; ok && !eventCodeMatches(instanceEvents, values) {
+				continue
+			}
+
+			reachability := boot.Reachability[*inst.InstanceId]
+			status := &ec2.InstanceStatus{
+				InstanceId:     inst.InstanceId,
+				InstanceState:  inst.State,
+				InstanceStatus: guestStatusSummary(stateName, boot.Instances, *inst.InstanceId, reachability.InstanceImpairedSince),
+				SystemStatus:   instanceStatusSummary(stateName, reachability.SystemImpairedSince),
+				Events:         instanceEvents,
+			}
+			if inst.Placement != nil {
+				status.AvailabilityZone = inst.Placement.AvailabilityZone
+			}
+			statuses = append(statuses, status)
+		}
+	}
+	return statuses
+}
+
+// serverStopEvent reports a stop the platform made, e.g. for lack of capacity
+// or a scheduled event, as a completed instance-stop event carrying the
+// instance's state reason. User and guest initiated stops have none.
+func serverStopEvent(inst *ec2.Instance, stateName string) *ec2.InstanceStatusEvent {
+	reason := inst.StateReason
+	if stateName == ec2.InstanceStateNameRunning || reason == nil || !strings.HasPrefix(aws.StringValue(reason.Code), "Server.") {
+		return nil
+	}
+	return &ec2.InstanceStatusEvent{
+		Code:        aws.String(ec2.EventCodeInstanceStop),
+		Description: aws.String("[Completed] " + aws.StringValue(reason.Code) + ": " + aws.StringValue(reason.Message)),
+	}
+}
+
+func eventCodeMatches(events []*ec2.InstanceStatusEvent, values []string) bool {
+	for _, event := range events {
+		if filterutil.MatchesAny(values, aws.StringValue(event.Code)) {
+			return true
+		}
+	}
+	return false
+}
+
+// guestStatusSummary is instanceStatusSummary for the guest itself, whose
+// check fails once its guest agent stops answering. Otherwise an instance
+// that was given a phone-home URL stays initializing until cloud-init reports
+// back, and instances without one pass as soon as they run.
+func guestStatusSummary(stateName string, boot map[string]types.InstanceBootStatus, instanceID string, impairedSince time.Time) *ec2.InstanceStatusSummary {
+	status, tracked := boot[instanceID]
+	if stateName != ec2.InstanceStateNameRunning || !impairedSince.IsZero() || !tracked || !status.BootedAt.IsZero() {
+		return instanceStatusSummary(stateName, impairedSince)
+	}
+	return &ec2.InstanceStatusSummary{
+		Status: aws.String(ec2.SummaryStatusInitializing),
+		Details: []*ec2.InstanceStatusDetails{{
+			Name:   aws.String(ec2.StatusNameReachability),
+			Status: aws.String(ec2.StatusTypeInitializing),
+		}},
+	}
+}
+
+// instanceStatusSummary reports reachability checks: passed while running,
+// failed once the node has seen the check failing since impairedSince, and
+// not-applicable otherwise (as AWS does for stopped instances).
+func instanceStatusSummary(stateName string, impairedSince time.Time) *ec2.InstanceStatusSummary {
+	if stateName != ec2.InstanceStateNameRunning {
+		return &ec2.InstanceStatusSummary{Status: aws.String(ec2.SummaryStatusNotApplicable)}
+	}
+	if !impairedSince.IsZero() {
+		return &ec2.InstanceStatusSummary{
+			Status: aws.String(ec2.SummaryStatusImpaired),
+			Details: []*ec2.InstanceStatusDetails{{
+				Name:          aws.String(ec2.StatusNameReachability),
+				Status:        aws.String(ec2.StatusTypeFailed),
+				ImpairedSince: aws.Time(impairedSince),
+			}},
+		}
+	}
+	return &ec2.InstanceStatusSummary{
+		Status: aws.String(ec2.SummaryStatusOk),
+		Details: []*ec2.InstanceStatusDetails{{
+			Name:   aws.String(ec2.StatusNameReachability),
+			Status: aws.String(ec2.StatusTypePassed),
+		}},
+	}
+}
@@ -0,0 +1,128 @@
+package gateway_ec2_instance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func statusTestReservations() []*ec2.Reservation {
+	return []*ec2.Reservation{{
+		Instances: []*ec2.Instance{
+			{InstanceId: aws.String("i-running"), State: &ec2.InstanceState{Code: aws.Int64(16), Name: aws.String(ec2.InstanceStateNameRunning)}},
+			{InstanceId: aws.String("i-stopped"), State: &ec2.InstanceState{Code: aws.Int64(80), Name: aws.String(ec2.InstanceStateNameStopped)}},
+		},
+	}}
+}
+
+func TestValidateDescribeInstanceStatusInput(t *testing.T) {
+	assert.EqualError(t, ValidateDescribeInstanceStatusInput(nil), awserrors.ErrorInvalidParameterValue)
+	assert.EqualError(t, ValidateDescribeInstanceStatusInput(&ec2.DescribeInstanceStatusInput{
+		InstanceIds: []*string{aws.String("vol-123")},
+	}), awserrors.ErrorInvalidInstanceIDMalformed)
+	assert.NoError(t, ValidateDescribeInstanceStatusInput(&ec2.DescribeInstanceStatusInput{}))
+}
+
+func TestBuildInstanceStatuses(t *testing.T) {
+	events := map[string][]*ec2.InstanceStatusEvent{
+		"i-running": {{
+			InstanceEventId: aws.String("instance-event-1"),
+			Code:            aws.String(ec2.EventCodeInstanceReboot),
+			NotBefore:       aws.Time(time.Now().Add(time.Hour)),
+		}},
+	}
+
+	t.Run("RunningOnly", func(t *testing.T) {
+		statuses := buildInstanceStatuses(statusTestReservations(), events, nil, false, nil)
+		require.Len(t, statuses, 1)
+		assert.Equal(t, "i-running", *statuses[0].InstanceId)
+		assert.Equal(t, ec2.SummaryStatusOk, *statuses[0].InstanceStatus.Status)
+		assert.Equal(t, ec2.SummaryStatusOk, *statuses[0].SystemStatus.Status)
+		require.Len(t, statuses[0].Events, 1)
+		assert.Equal(t, "instance-event-1", *statuses[0].Events[0].InstanceEventId)
+	})
+
+	t.Run("IncludeAllInstances", func(t *testing.T) {
+		statuses := buildInstanceStatuses(statusTestReservations(), events, nil, true, nil)
+		require.Len(t, statuses, 2)
+		assert.Equal(t, ec2.SummaryStatusNotApplicable, *statuses[1].InstanceStatus.Status)
+		assert.Empty(t, statuses[1].Events)
+	})
+
+	t.Run("EventCodeFilter", func(t *testing.T) {
+		statuses := buildInstanceStatuses(statusTestReservations(), events, nil, true, map[string][]string{"event.code": {ec2.EventCodeInstanceReboot}})
+		require.Len(t, statuses, 1)
+		assert.Equal(t, "i-running", *statuses[0].InstanceId)
+
+		statuses = buildInstanceStatuses(statusTestReservations(), events, nil, true, map[string][]string{"event.code": {ec2.EventCodeInstanceStop}})
+		assert.Empty(t, statuses)
+	})
+
+	t.Run("AwaitingPhoneHome", func(t *testing.T) {
+		boot := &types.DescribeInstanceBootStatusOutput{Instances: map[string]types.InstanceBootStatus{"i-running": {}}}
+		statuses := buildInstanceStatuses(statusTestReservations(), events, boot, false, nil)
+		require.Len(t, statuses, 1)
+		assert.Equal(t, ec2.SummaryStatusInitializing, *statuses[0].InstanceStatus.Status)
+		assert.Equal(t, ec2.StatusTypeInitializing, *statuses[0].InstanceStatus.Details[0].Status)
+		assert.Equal(t, ec2.SummaryStatusOk, *statuses[0].SystemStatus.Status)
+
+		boot.Instances["i-running"] = types.InstanceBootStatus{BootedAt: time.Now()}
+		statuses = buildInstanceStatuses(statusTestReservations(), events, boot, false, nil)
+		assert.Equal(t, ec2.SummaryStatusOk, *statuses[0].InstanceStatus.Status)
+	})
+
+	t.Run("Reachability", func(t *testing.T) {
+		since := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+		boot := &types.DescribeInstanceBootStatusOutput{
+			Instances: map[string]types.InstanceBootStatus{"i-running": {}},
+			Reachability: map[string]types.InstanceReachability{
+				"i-running": {SystemImpairedSince: since, GuestAgent: true, InstanceImpairedSince: since},
+			},
+		}
+		statuses := buildInstanceStatuses(statusTestReservations(), events, boot, false, nil)
+		require.Len(t, statuses, 1)
+		for _, summary := range []*ec2.InstanceStatusSummary{statuses[0].SystemStatus, statuses[0].InstanceStatus} {
+			assert.Equal(t, ec2.SummaryStatusImpaired, *summary.Status)
+			require.Len(t, summary.Details, 1)
+			assert.Equal(t, ec2.StatusTypeFailed, *summary.Details[0].Status)
+			assert.Equal(t, since, *summary.Details[0].ImpairedSince)
+		}
+
+		// A failing guest agent doesn't touch the system check.
+		boot.Reachability["i-running"] = types.InstanceReachability{GuestAgent: true, InstanceImpairedSince: since}
+		statuses = buildInstanceStatuses(statusTestReservations(), events, boot, false, nil)
+		assert.Equal(t, ec2.SummaryStatusOk, *statuses[0].SystemStatus.Status)
+		assert.Equal(t, ec2.SummaryStatusImpaired, *statuses[0].InstanceStatus.Status)
+	})
+
+	t.Run("ServerStopReason", func(t *testing.T) {
+		reservations := statusTestReservations()
+		stopped := reservations[0].Instances[1]
+		stopped.StateReason = &ec2.StateReason{
+			Code:    aws.String("Server.InsufficientInstanceCapacity"),
+			Message: aws.String("not enough memory"),
+		}
+		statuses := buildInstanceStatuses(reservations, events, nil, true, map[string][]string{"event.code": {ec2.EventCodeInstanceStop}})
+		require.Len(t, statuses, 1)
+		require.Len(t, statuses[0].Events, 1)
+		assert.Equal(t, "[Completed] Server.InsufficientInstanceCapacity: not enough memory", *statuses[0].Events[0].Description)
+
+		// A user stop is not reported as an event.
+		stopped.StateReason.Code = aws.String("Client.UserInitiatedShutdown")
+		statuses = buildInstanceStatuses(reservations, events, nil, true, nil)
+		require.Len(t, statuses, 2)
+		assert.Empty(t, statuses[1].Events)
+	})
+
+	t.Run("StateFilter", func(t *testing.T) {
+		statuses := buildInstanceStatuses(statusTestReservations(), events, nil, true, map[string][]string{"instance-state-name": {"stopped"}})
+		require.Len(t, statuses, 1)
+		assert.Equal(t, "i-stopped", *statuses[0].InstanceId)
+	})
+}
@@ -2,17 +2,46 @@ package gateway_ec2_instance
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/pagination"
 	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/nats-io/nats.go"
 )
 
+// ValidateDescribeInstanceTypesInput validates the pagination parameters.
+// The capacity view lists a type once per free slot, so it has no stable
+// cursor and can't be paginated.
+func ValidateDescribeInstanceTypesInput(input *ec2.DescribeInstanceTypesInput) error {
+	if input == nil {
+		return nil
+	}
+	if (input.MaxResults != nil || input.NextToken != nil) && showInstanceTypeCapacity(input) {
+		return errors.New(awserrors.ErrorInvalidParameterCombination)
+	}
+	_, err := pagination.Parse(input.MaxResults, input.NextToken, pagination.DescribeInstanceTypesLimits)
+	return err
+}
+
 // DescribeInstanceTypes queries all spinifex nodes for their instance types via NATS
 func DescribeInstanceTypes(input *ec2.DescribeInstanceTypesInput, natsConn *nats.Conn, expectedNodes int) (*ec2.DescribeInstanceTypesOutput, error) {
+	if err := ValidateDescribeInstanceTypesInput(input); err != nil {
+		return nil, err
+	}
+	if input == nil {
+		input = &ec2.DescribeInstanceTypesInput{}
+	}
+	page, err := pagination.Parse(input.MaxResults, input.NextToken, pagination.DescribeInstanceTypesLimits)
+	if err != nil {
+		return nil, err
+	}
+
 	// Marshal input to JSON
 	jsonData, err := json.Marshal(input)
 	if err != nil {
@@ -30,7 +59,7 @@ func DescribeInstanceTypes(input *ec2.DescribeInstanceTypesInput, natsConn *nats
 	defer sub.Unsubscribe()
 
 	// Publish request to all nodes (no queue group, so all daemons receive it)
-	err = natsConn.PublishRequest("ec2.DescribeInstanceTypes", inbox, jsonData)
+	err = natsConn.PublishRequest(utils.Subject("ec2.DescribeInstanceTypes"), inbox, jsonData)
 	if err != nil {
 		slog.Error("DescribeInstanceTypes: Failed to publish request", "err", err)
 		return nil, fmt.Errorf("failed to publish request: %w", err)
@@ -77,17 +106,16 @@ func DescribeInstanceTypes(input *ec2.DescribeInstanceTypesInput, natsConn *nats
 		responsesReceived++
 
 		// Check if response is an error
-		responseError, err := utils.ValidateErrorPayload(msg.Data)
-		if err != nil {
+		reply := utils.DecodeReply(msg)
+		if reply.Err != nil {
 			// Response is an error payload - log but continue collecting from other nodes
-			slog.Warn("DescribeInstanceTypes: Received error from node", "code", responseError.Code, "responses_received", responsesReceived)
+			slog.Warn("DescribeInstanceTypes: Received error from node", "code", reply.Err.Code, "responses_received", responsesReceived)
 			continue
 		}
 
 		// Parse the DescribeInstanceTypesOutput from this node
 		var nodeOutput ec2.DescribeInstanceTypesOutput
-		err = json.Unmarshal(msg.Data, &nodeOutput)
-		if err != nil {
+		if err := reply.Decode(&nodeOutput); err != nil {
 			slog.Error("DescribeInstanceTypes: Failed to unmarshal node response", "err", err)
 			continue
 		}
@@ -101,17 +129,7 @@ func DescribeInstanceTypes(input *ec2.DescribeInstanceTypesInput, natsConn *nats
 
 	// By default, deduplicate instance types.
 	// If the "capacity" filter is set to "true", show all available slots (duplicates).
-	showCapacity := false
-	for _, f := range input.Filters {
-		if f.Name != nil && *f.Name == "capacity" {
-			for _, v := range f.Values {
-				if v != nil && *v == "true" {
-					showCapacity = true
-					break
-				}
-			}
-		}
-	}
+	showCapacity := showInstanceTypeCapacity(input)
 
 	// Build set of requested instance type names (if any) for filtering.
 	requestedTypes := make(map[string]bool)
@@ -121,6 +139,17 @@ func DescribeInstanceTypes(input *ec2.DescribeInstanceTypesInput, natsConn *nats
 		}
 	}
 
+	// An explicit list returns exactly those types, in request order
+	// unless paginated.
+	if len(requestedTypes) > 0 && !showCapacity {
+		output, err := requestedInstanceTypes(input.InstanceTypes, allInstanceTypes)
+		if err != nil {
+			return nil, err
+		}
+		output.InstanceTypes, output.NextToken = pagination.Apply(page, output.InstanceTypes, instanceTypeName)
+		return output, nil
+	}
+
 	var finalInstanceTypes []*ec2.InstanceTypeInfo
 	if showCapacity {
 		finalInstanceTypes = allInstanceTypes
@@ -148,10 +177,58 @@ func DescribeInstanceTypes(input *ec2.DescribeInstanceTypesInput, natsConn *nats
 	}
 
 	// Build final aggregated response
-	output := &ec2.DescribeInstanceTypesOutput{
-		InstanceTypes: finalInstanceTypes,
+	output := &ec2.DescribeInstanceTypesOutput{}
+	output.InstanceTypes, output.NextToken = pagination.Apply(page, finalInstanceTypes, instanceTypeName)
+
+	slog.Info("DescribeInstanceTypes: Aggregated response", "total_instance_types", len(output.InstanceTypes), "show_capacity", showCapacity)
+	return output, nil
+}
+
+// showInstanceTypeCapacity reports whether the "capacity" filter asks for
+// one entry per available slot rather than one per type.
+func showInstanceTypeCapacity(input *ec2.DescribeInstanceTypesInput) bool {
+	for _, f := range input.Filters {
+		if f.Name != nil && *f.Name == "capacity" {
+			for _, v := range f.Values {
+				if v != nil && *v == "true" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func instanceTypeName(it *ec2.InstanceTypeInfo) string {
+	return aws.StringValue(it.InstanceType)
+}
+
+// requestedInstanceTypes picks the requested types out of the nodes'
+// responses in request order, failing with InvalidInstanceType if any type
+// isn't offered by a node. Duplicate requests are returned once.
+func requestedInstanceTypes(requested []*string, nodeTypes []*ec2.InstanceTypeInfo) (*ec2.DescribeInstanceTypesOutput, error) {
+	byName := make(map[string]*ec2.InstanceTypeInfo, len(nodeTypes))
+	for _, it := range nodeTypes {
+		if it != nil && it.InstanceType != nil {
+			byName[*it.InstanceType] = it
+		}
+	}
+
+	output := &ec2.DescribeInstanceTypesOutput{}
+	seen := make(map[string]bool, len(requested))
+	for _, name := range requested {
+		if name == nil || seen[*name] {
+			continue
+		}
+		seen[*name] = true
+		it, ok := byName[*name]
+		if !ok {
+			slog.Info("DescribeInstanceTypes: Unknown instance type requested", "instanceType", *name)
+			return nil, errors.New(awserrors.ErrorInvalidInstanceType)
+		}
+		output.InstanceTypes = append(output.InstanceTypes, it)
 	}
 
-	slog.Info("DescribeInstanceTypes: Aggregated response", "total_instance_types", len(finalInstanceTypes), "show_capacity", showCapacity)
+	slog.Info("DescribeInstanceTypes: Returning requested instance types", "count", len(output.InstanceTypes))
 	return output, nil
 }
@@ -6,6 +6,7 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
 	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/nats-io/nats.go"
 	"github.com/stretchr/testify/assert"
@@ -84,6 +85,39 @@ func TestDescribeInstanceTypes_DeduplicatesAcrossNodes(t *testing.T) {
 	assert.Equal(t, 1, seen["m5.large"])
 }
 
+func TestDescribeInstanceTypes_ExplicitList(t *testing.T) {
+	_, nc := startTestNATSServer(t)
+
+	// Each node returns the catalog entries for the requested names it knows.
+	catalog := map[string]bool{"t3.micro": true, "t3.small": true, "m5.large": true}
+	nc.Subscribe("ec2.DescribeInstanceTypes", func(msg *nats.Msg) {
+		var input ec2.DescribeInstanceTypesInput
+		_ = json.Unmarshal(msg.Data, &input)
+		output := &ec2.DescribeInstanceTypesOutput{}
+		for _, name := range input.InstanceTypes {
+			if catalog[*name] {
+				output.InstanceTypes = append(output.InstanceTypes, &ec2.InstanceTypeInfo{InstanceType: name})
+			}
+		}
+		data, _ := json.Marshal(output)
+		msg.Respond(data)
+	})
+
+	output, err := DescribeInstanceTypes(&ec2.DescribeInstanceTypesInput{
+		InstanceTypes: aws.StringSlice([]string{"m5.large", "t3.micro", "m5.large"}),
+	}, nc, 1)
+	require.NoError(t, err)
+	require.Len(t, output.InstanceTypes, 2)
+	assert.Equal(t, "m5.large", *output.InstanceTypes[0].InstanceType, "request order is kept")
+	assert.Equal(t, "t3.micro", *output.InstanceTypes[1].InstanceType)
+
+	_, err = DescribeInstanceTypes(&ec2.DescribeInstanceTypesInput{
+		InstanceTypes: aws.StringSlice([]string{"t3.small", "x9.mega"}),
+	}, nc, 1)
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorInvalidInstanceType, err.Error())
+}
+
 func TestDescribeInstanceTypes_CapacityFilterShowsDuplicates(t *testing.T) {
 	_, nc := startTestNATSServer(t)
 
@@ -237,3 +271,61 @@ func TestDescribeInstanceTypes_ClosedConnection(t *testing.T) {
 
 	require.Error(t, err)
 }
+
+func TestDescribeInstanceTypes_Paginated(t *testing.T) {
+	_, nc := startTestNATSServer(t)
+
+	nc.Subscribe("ec2.DescribeInstanceTypes", func(msg *nats.Msg) {
+		var types []*ec2.InstanceTypeInfo
+		for _, name := range []string{"t3.xlarge", "t3.micro", "t3.large", "t3.small", "t3.medium", "t3.nano", "t3.2xlarge"} {
+			types = append(types, &ec2.InstanceTypeInfo{InstanceType: aws.String(name)})
+		}
+		data, _ := json.Marshal(&ec2.DescribeInstanceTypesOutput{InstanceTypes: types})
+		msg.Respond(data)
+	})
+
+	first, err := DescribeInstanceTypes(&ec2.DescribeInstanceTypesInput{MaxResults: aws.Int64(5)}, nc, 1)
+	require.NoError(t, err)
+	require.NotNil(t, first.NextToken)
+	assert.Equal(t, []string{"t3.2xlarge", "t3.large", "t3.medium", "t3.micro", "t3.nano"}, instanceTypeNames(first.InstanceTypes))
+
+	second, err := DescribeInstanceTypes(&ec2.DescribeInstanceTypesInput{MaxResults: aws.Int64(5), NextToken: first.NextToken}, nc, 1)
+	require.NoError(t, err)
+	assert.Nil(t, second.NextToken)
+	assert.Equal(t, []string{"t3.small", "t3.xlarge"}, instanceTypeNames(second.InstanceTypes))
+}
+
+func TestValidateDescribeInstanceTypesInput(t *testing.T) {
+	capacity := []*ec2.Filter{{Name: aws.String("capacity"), Values: aws.StringSlice([]string{"true"})}}
+
+	tests := []struct {
+		name  string
+		input *ec2.DescribeInstanceTypesInput
+		err   string
+	}{
+		{name: "Nil"},
+		{name: "MaxResults", input: &ec2.DescribeInstanceTypesInput{MaxResults: aws.Int64(100)}},
+		{name: "Capacity", input: &ec2.DescribeInstanceTypesInput{Filters: capacity}},
+		{name: "MaxResultsOutOfRange", input: &ec2.DescribeInstanceTypesInput{MaxResults: aws.Int64(101)}, err: awserrors.ErrorInvalidMaxResults},
+		{name: "InvalidNextToken", input: &ec2.DescribeInstanceTypesInput{NextToken: aws.String("bogus")}, err: awserrors.ErrorInvalidNextToken},
+		{name: "CapacityWithMaxResults", input: &ec2.DescribeInstanceTypesInput{Filters: capacity, MaxResults: aws.Int64(5)}, err: awserrors.ErrorInvalidParameterCombination},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateDescribeInstanceTypesInput(tt.input)
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func instanceTypeNames(types []*ec2.InstanceTypeInfo) []string {
+	names := make([]string, 0, len(types))
+	for _, it := range types {
+		names = append(names, aws.StringValue(it.InstanceType))
+	}
+	return names
+}
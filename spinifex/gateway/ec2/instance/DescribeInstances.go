@@ -10,13 +10,40 @@ import (
 
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/pagination"
 	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/nats-io/nats.go"
 )
 
+// ValidateDescribeInstancesInput validates the pagination parameters. As on
+// AWS, MaxResults can't be combined with InstanceIds.
+func ValidateDescribeInstancesInput(input *ec2.DescribeInstancesInput) error {
+	if input == nil {
+		return nil
+	}
+	if input.MaxResults != nil && len(input.InstanceIds) > 0 {
+		return errors.New(awserrors.ErrorInvalidParameterCombination)
+	}
+	_, err := pagination.Parse(input.MaxResults, input.NextToken, pagination.DescribeInstancesLimits)
+	return err
+}
+
 // DescribeInstances queries all spinifex nodes for their instances via NATS
-// and aggregates the results into a single response
+// and aggregates the results into a single response. Each node returns at
+// most one page plus one instance, so a paginated call stays bounded however
+// many instances the cluster runs.
 func DescribeInstances(input *ec2.DescribeInstancesInput, natsConn *nats.Conn, expectedNodes int, accountID string) (*ec2.DescribeInstancesOutput, error) {
+	if err := ValidateDescribeInstancesInput(input); err != nil {
+		return nil, err
+	}
+	if input == nil {
+		input = &ec2.DescribeInstancesInput{}
+	}
+	page, err := pagination.Parse(input.MaxResults, input.NextToken, pagination.DescribeInstancesLimits)
+	if err != nil {
+		return nil, err
+	}
+
 	// Marshal input to JSON
 	jsonData, err := json.Marshal(input)
 	if err != nil {
@@ -34,7 +61,7 @@ func DescribeInstances(input *ec2.DescribeInstancesInput, natsConn *nats.Conn, e
 	defer sub.Unsubscribe()
 
 	// Publish request to all nodes with account ID header
-	pubMsg := nats.NewMsg("ec2.DescribeInstances")
+	pubMsg := nats.NewMsg(utils.Subject("ec2.DescribeInstances"))
 	pubMsg.Reply = inbox
 	pubMsg.Data = jsonData
 	pubMsg.Header.Set(utils.AccountIDHeader, accountID)
@@ -50,7 +77,7 @@ func DescribeInstances(input *ec2.DescribeInstancesInput, natsConn *nats.Conn, e
 	deadline := time.Now().Add(timeout)
 
 	var allReservations []*ec2.Reservation
-	var clientError string // first client error code from any node (e.g. InvalidParameterValue)
+	var clientError *awserrors.Error // first client error from any node (e.g. InvalidParameterValue)
 	responsesReceived := 0
 
 	// If expectedNodes is not configured (0), fall back to timeout-based collection
@@ -87,28 +114,23 @@ func DescribeInstances(input *ec2.DescribeInstancesInput, natsConn *nats.Conn, e
 		responsesReceived++
 
 		// Check if response is an error
-		responseError, err := utils.ValidateErrorPayload(msg.Data)
-		if err != nil {
-			code := ""
-			if responseError.Code != nil {
-				code = *responseError.Code
-			}
+		reply := utils.DecodeReply(msg)
+		if reply.Err != nil {
 			// Capture the first client error (e.g. InvalidParameterValue). Client errors
 			// are deterministic — all nodes return the same error for the same invalid
 			// request — so we propagate them to the caller after collection completes.
-			if clientError == "" && code != "" {
-				if info, known := awserrors.ErrorLookup[code]; known && info.HTTPCode >= 400 && info.HTTPCode < 500 {
-					clientError = code
+			if clientError == nil {
+				if info, known := awserrors.ErrorLookup[reply.Err.Code]; known && info.HTTPCode >= 400 && info.HTTPCode < 500 {
+					clientError = reply.Err
 				}
 			}
-			slog.Warn("DescribeInstances: Received error from node", "code", code, "responses_received", responsesReceived)
+			slog.Warn("DescribeInstances: Received error from node", "code", reply.Err.Code, "responses_received", responsesReceived)
 			continue
 		}
 
 		// Parse the DescribeInstancesOutput from this node
 		var nodeOutput ec2.DescribeInstancesOutput
-		err = json.Unmarshal(msg.Data, &nodeOutput)
-		if err != nil {
+		if err := reply.Decode(&nodeOutput); err != nil {
 			slog.Error("DescribeInstances: Failed to unmarshal node response", "err", err)
 			continue
 		}
@@ -139,22 +161,21 @@ func DescribeInstances(input *ec2.DescribeInstancesInput, natsConn *nats.Conn, e
 
 	// If every node returned a client error and we collected no data, propagate
 	// the error to the caller so the HTTP response carries the correct status.
-	if clientError != "" && len(allReservations) == 0 {
-		return nil, errors.New(clientError)
+	if clientError != nil && len(allReservations) == 0 {
+		return nil, clientError
 	}
 
 	// Build final aggregated response
-	output := &ec2.DescribeInstancesOutput{
-		Reservations: allReservations,
-	}
+	output := &ec2.DescribeInstancesOutput{}
+	output.Reservations, output.NextToken = pagination.ApplyReservations(page, allReservations)
 
-	slog.Info("DescribeInstances: Aggregated response", "total_reservations", len(allReservations))
+	slog.Info("DescribeInstances: Aggregated response", "total_reservations", len(output.Reservations), "has_next_page", output.NextToken != nil)
 	return output, nil
 }
 
 // queryInstanceBucket sends a NATS request to a describe topic and returns the reservations.
 func queryInstanceBucket(natsConn *nats.Conn, topic string, jsonData []byte, accountID string) []*ec2.Reservation {
-	reqMsg := nats.NewMsg(topic)
+	reqMsg := nats.NewMsg(utils.Subject(topic))
 	reqMsg.Data = jsonData
 	reqMsg.Header.Set(utils.AccountIDHeader, accountID)
 	msg, err := natsConn.RequestMsg(reqMsg, 3*time.Second)
@@ -162,12 +183,13 @@ func queryInstanceBucket(natsConn *nats.Conn, topic string, jsonData []byte, acc
 		slog.Warn("DescribeInstances: Failed to query instance bucket", "topic", topic, "err", err)
 		return nil
 	}
-	if responseError, parseErr := utils.ValidateErrorPayload(msg.Data); parseErr != nil {
-		slog.Warn("DescribeInstances: Instance bucket query returned error", "topic", topic, "code", responseError.Code)
+	reply := utils.DecodeReply(msg)
+	if reply.Err != nil {
+		slog.Warn("DescribeInstances: Instance bucket query returned error", "topic", topic, "code", reply.Err.Code)
 		return nil
 	}
 	var output ec2.DescribeInstancesOutput
-	if err := json.Unmarshal(msg.Data, &output); err != nil {
+	if err := reply.Decode(&output); err != nil {
 		slog.Error("DescribeInstances: Failed to unmarshal instance bucket response", "topic", topic, "err", err)
 		return nil
 	}
@@ -2,11 +2,14 @@ package gateway_ec2_instance
 
 import (
 	"encoding/json"
+	"slices"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/pagination"
 	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/nats-io/nats.go"
 	"github.com/stretchr/testify/assert"
@@ -254,3 +257,84 @@ func TestDescribeInstances_ClosedConnection(t *testing.T) {
 
 	require.Error(t, err)
 }
+
+func TestDescribeInstances_Paginated(t *testing.T) {
+	_, nc := startTestNATSServer(t)
+
+	// Each fake node sends its share of the requested page, as the daemon
+	// does. r-shared has an instance on both nodes.
+	respondPaged := func(conn *nats.Conn, reservations ...*ec2.Reservation) {
+		_, err := conn.Subscribe("ec2.DescribeInstances", func(msg *nats.Msg) {
+			var input ec2.DescribeInstancesInput
+			require.NoError(t, json.Unmarshal(msg.Data, &input))
+			page, err := pagination.Parse(input.MaxResults, input.NextToken, pagination.DescribeInstancesLimits)
+			require.NoError(t, err)
+			data, _ := json.Marshal(&ec2.DescribeInstancesOutput{Reservations: pagination.PrefetchReservations(page, reservations)})
+			msg.Respond(data)
+		})
+		require.NoError(t, err)
+	}
+	reservation := func(id string, instanceIDs ...string) *ec2.Reservation {
+		r := &ec2.Reservation{ReservationId: aws.String(id)}
+		for _, instanceID := range instanceIDs {
+			r.Instances = append(r.Instances, &ec2.Instance{InstanceId: aws.String(instanceID)})
+		}
+		return r
+	}
+
+	nc2, err := nats.Connect(nc.ConnectedUrl())
+	require.NoError(t, err)
+	defer nc2.Close()
+	respondPaged(nc, reservation("r-1", "i-01", "i-03", "i-05"), reservation("r-shared", "i-07"))
+	respondPaged(nc2, reservation("r-2", "i-02", "i-04", "i-06"), reservation("r-shared", "i-08"))
+	nc.Flush()
+	nc2.Flush()
+
+	var ids []string
+	input := &ec2.DescribeInstancesInput{MaxResults: aws.Int64(5)}
+	for pages := 1; ; pages++ {
+		require.LessOrEqual(t, pages, 2, "pagination did not terminate")
+		output, err := DescribeInstances(input, nc, 2, "123456789012")
+		require.NoError(t, err)
+		// Instances come grouped by reservation, so order within a page varies.
+		var pageIDs []string
+		for _, r := range output.Reservations {
+			for _, instance := range r.Instances {
+				pageIDs = append(pageIDs, *instance.InstanceId)
+			}
+		}
+		assert.LessOrEqual(t, len(pageIDs), 5)
+		slices.Sort(pageIDs)
+		ids = append(ids, pageIDs...)
+		if output.NextToken == nil {
+			break
+		}
+		input.NextToken = output.NextToken
+	}
+	assert.Equal(t, []string{"i-01", "i-02", "i-03", "i-04", "i-05", "i-06", "i-07", "i-08"}, ids)
+}
+
+func TestValidateDescribeInstancesInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		input *ec2.DescribeInstancesInput
+		err   string
+	}{
+		{name: "Nil"},
+		{name: "MaxResults", input: &ec2.DescribeInstancesInput{MaxResults: aws.Int64(1000)}},
+		{name: "InstanceIds", input: &ec2.DescribeInstancesInput{InstanceIds: aws.StringSlice([]string{"i-001"})}},
+		{name: "MaxResultsOutOfRange", input: &ec2.DescribeInstancesInput{MaxResults: aws.Int64(4)}, err: awserrors.ErrorInvalidMaxResults},
+		{name: "InvalidNextToken", input: &ec2.DescribeInstancesInput{NextToken: aws.String("bogus")}, err: awserrors.ErrorInvalidNextToken},
+		{name: "MaxResultsWithInstanceIds", input: &ec2.DescribeInstancesInput{InstanceIds: aws.StringSlice([]string{"i-001"}), MaxResults: aws.Int64(5)}, err: awserrors.ErrorInvalidParameterCombination},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateDescribeInstancesInput(tt.input)
+			if tt.err == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
 	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/nats-io/nats.go"
 )
@@ -36,8 +37,8 @@ func GetConsoleOutput(input *ec2.GetConsoleOutputInput, natsConn *nats.Conn, acc
 		return nil, fmt.Errorf("failed to marshal input: %w", err)
 	}
 
-	topic := fmt.Sprintf("ec2.%s.GetConsoleOutput", *input.InstanceId)
-	reqMsg := nats.NewMsg(topic)
+	topic := subjects.ConsoleOutput(*input.InstanceId)
+	reqMsg := nats.NewMsg(utils.Subject(topic))
 	reqMsg.Data = jsonData
 	reqMsg.Header.Set(utils.AccountIDHeader, accountID)
 	msg, err := natsConn.RequestMsg(reqMsg, 5*time.Second)
@@ -48,16 +49,10 @@ func GetConsoleOutput(input *ec2.GetConsoleOutputInput, natsConn *nats.Conn, acc
 		return nil, fmt.Errorf("failed to get console output: %w", err)
 	}
 
-	responseError, parseErr := utils.ValidateErrorPayload(msg.Data)
-	if parseErr != nil {
-		slog.Error("GetConsoleOutput: Daemon returned error", "instance_id", *input.InstanceId, "code", *responseError.Code)
-		return nil, errors.New(*responseError.Code)
-	}
-
 	var output ec2.GetConsoleOutputOutput
-	if err := json.Unmarshal(msg.Data, &output); err != nil {
-		slog.Error("GetConsoleOutput: Failed to unmarshal response", "err", err)
-		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	if err := utils.DecodeReply(msg).Decode(&output); err != nil {
+		slog.Error("GetConsoleOutput: Daemon returned error", "instance_id", *input.InstanceId, "err", err)
+		return nil, err
 	}
 
 	return &output, nil
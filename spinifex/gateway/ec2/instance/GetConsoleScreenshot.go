@@ -0,0 +1,64 @@
+package gateway_ec2_instance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+)
+
+// ValidateGetConsoleScreenshotInput validates the input parameters
+func ValidateGetConsoleScreenshotInput(input *ec2.GetConsoleScreenshotInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if input.InstanceId == nil || *input.InstanceId == "" {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	if !strings.HasPrefix(*input.InstanceId, "i-") {
+		return errors.New(awserrors.ErrorInvalidInstanceIDMalformed)
+	}
+	return nil
+}
+
+// GetConsoleScreenshot returns a PNG of a running instance's display,
+// captured by the node hosting it. WakeUp is accepted but has no effect.
+func GetConsoleScreenshot(input *ec2.GetConsoleScreenshotInput, natsConn *nats.Conn, accountID string) (*ec2.GetConsoleScreenshotOutput, error) {
+	if err := ValidateGetConsoleScreenshotInput(input); err != nil {
+		return nil, err
+	}
+
+	instanceID := *input.InstanceId
+	command := types.EC2InstanceCommand{
+		ID:         instanceID,
+		Attributes: types.EC2CommandAttributes{ConsoleScreenshot: true},
+	}
+
+	output, err := utils.NATSRequest[ec2.GetConsoleScreenshotOutput](natsConn, subjects.InstanceCmd(instanceID), command, 30*time.Second, accountID)
+	if err != nil && errors.Is(err, nats.ErrNoResponders) {
+		// No node runs the instance: a stopped instance has no display.
+		describeData, err := json.Marshal(&ec2.DescribeInstancesInput{InstanceIds: []*string{&instanceID}})
+		if err != nil {
+			return nil, fmt.Errorf("marshal describe input: %w", err)
+		}
+		if reservations := queryInstanceBucket(natsConn, "ec2.DescribeStoppedInstances", describeData, accountID); len(reservations) > 0 {
+			return nil, errors.New(awserrors.ErrorIncorrectInstanceState)
+		}
+		return nil, errors.New(awserrors.ErrorInvalidInstanceIDNotFound)
+	}
+	if err != nil {
+		slog.Error("GetConsoleScreenshot: Failed", "instance_id", instanceID, "err", err)
+		return nil, err
+	}
+
+	return output, nil
+}
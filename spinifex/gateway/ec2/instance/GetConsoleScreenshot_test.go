@@ -0,0 +1,88 @@
+package gateway_ec2_instance
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateGetConsoleScreenshotInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		input *ec2.GetConsoleScreenshotInput
+		want  string
+	}{
+		{"nil input", nil, awserrors.ErrorInvalidParameterValue},
+		{"missing instance", &ec2.GetConsoleScreenshotInput{}, awserrors.ErrorMissingParameter},
+		{"malformed instance", &ec2.GetConsoleScreenshotInput{InstanceId: aws.String("vol-1")}, awserrors.ErrorInvalidInstanceIDMalformed},
+		{"valid", &ec2.GetConsoleScreenshotInput{InstanceId: aws.String("i-1"), WakeUp: aws.Bool(true)}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateGetConsoleScreenshotInput(tt.input)
+			if tt.want == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Equal(t, tt.want, err.Error())
+		})
+	}
+}
+
+func TestGetConsoleScreenshot_RunningInstance(t *testing.T) {
+	_, nc := startTestNATSServer(t)
+	instanceID := "i-0123456789abcdef0"
+
+	_, err := nc.Subscribe(subjects.InstanceCmd(instanceID), func(msg *nats.Msg) {
+		var cmd types.EC2InstanceCommand
+		require.NoError(t, json.Unmarshal(msg.Data, &cmd))
+		assert.True(t, cmd.Attributes.ConsoleScreenshot)
+		data, _ := json.Marshal(&ec2.GetConsoleScreenshotOutput{
+			InstanceId: aws.String(cmd.ID),
+			ImageData:  aws.String("iVBORw0KGgo="),
+		})
+		msg.Respond(data)
+	})
+	require.NoError(t, err)
+
+	out, err := GetConsoleScreenshot(&ec2.GetConsoleScreenshotInput{InstanceId: aws.String(instanceID)}, nc, "123456789012")
+	require.NoError(t, err)
+	assert.Equal(t, instanceID, aws.StringValue(out.InstanceId))
+	assert.Equal(t, "iVBORw0KGgo=", aws.StringValue(out.ImageData))
+}
+
+func TestGetConsoleScreenshot_StoppedInstance(t *testing.T) {
+	_, nc := startTestNATSServer(t)
+	instanceID := "i-stopped"
+
+	_, err := nc.Subscribe("ec2.DescribeStoppedInstances", func(msg *nats.Msg) {
+		data, _ := json.Marshal(ec2.DescribeInstancesOutput{
+			Reservations: []*ec2.Reservation{
+				{Instances: []*ec2.Instance{{InstanceId: aws.String(instanceID)}}},
+			},
+		})
+		msg.Respond(data)
+	})
+	require.NoError(t, err)
+
+	_, err = GetConsoleScreenshot(&ec2.GetConsoleScreenshotInput{InstanceId: aws.String(instanceID)}, nc, "123456789012")
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorIncorrectInstanceState, err.Error())
+}
+
+func TestGetConsoleScreenshot_NotFound(t *testing.T) {
+	_, nc := startTestNATSServer(t)
+
+	_, err := GetConsoleScreenshot(&ec2.GetConsoleScreenshotInput{InstanceId: aws.String("i-missing")}, nc, "123456789012")
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorInvalidInstanceIDNotFound, err.Error())
+}
@@ -0,0 +1,100 @@
+package gateway_ec2_instance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+)
+
+// GetInstanceTypesFromInstanceRequirements returns the instance types whose
+// vCPU count, memory and architecture fall within the requested ranges. Each
+// node matches its own catalog, so types offered by any node are returned,
+// once each and sorted by name.
+func GetInstanceTypesFromInstanceRequirements(input *ec2.GetInstanceTypesFromInstanceRequirementsInput, natsConn *nats.Conn, expectedNodes int) (*ec2.GetInstanceTypesFromInstanceRequirementsOutput, error) {
+	if err := validateInstanceRequirements(input); err != nil {
+		return nil, err
+	}
+
+	jsonData, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal input: %w", err)
+	}
+
+	inbox := nats.NewInbox()
+	sub, err := natsConn.SubscribeSync(inbox)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create inbox: %w", err)
+	}
+	defer sub.Unsubscribe()
+
+	// Publish to all nodes (no queue group), each matches its own catalog
+	if err := natsConn.PublishRequest(utils.Subject("ec2.GetInstanceTypesFromInstanceRequirements"), inbox, jsonData); err != nil {
+		return nil, fmt.Errorf("failed to publish request: %w", err)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	seen := make(map[string]bool)
+	var names []string
+	for responses := 0; expectedNodes <= 0 || responses < expectedNodes; responses++ {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			break
+		}
+		msg, err := sub.NextMsg(remaining)
+		if err != nil {
+			break
+		}
+
+		var nodeOutput ec2.GetInstanceTypesFromInstanceRequirementsOutput
+		if err := utils.DecodeReply(msg).Decode(&nodeOutput); err != nil {
+			slog.Warn("GetInstanceTypesFromInstanceRequirements: Received error from node", "err", err)
+			continue
+		}
+		for _, it := range nodeOutput.InstanceTypes {
+			if name := aws.StringValue(it.InstanceType); name != "" && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+
+	slices.Sort(names)
+	output := &ec2.GetInstanceTypesFromInstanceRequirementsOutput{
+		InstanceTypes: []*ec2.InstanceTypeInfoFromInstanceRequirements{},
+	}
+	for _, name := range names {
+		output.InstanceTypes = append(output.InstanceTypes, &ec2.InstanceTypeInfoFromInstanceRequirements{InstanceType: aws.String(name)})
+	}
+
+	slog.Info("GetInstanceTypesFromInstanceRequirements: Matched instance types", "count", len(names))
+	return output, nil
+}
+
+// validateInstanceRequirements checks that the vCPU and memory ranges are
+// present, non-negative and not inverted. An omitted Max is unbounded.
+func validateInstanceRequirements(input *ec2.GetInstanceTypesFromInstanceRequirementsInput) error {
+	req := input.InstanceRequirements
+	if req == nil || req.VCpuCount == nil || req.MemoryMiB == nil {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	if !validRange(req.VCpuCount.Min, req.VCpuCount.Max) || !validRange(req.MemoryMiB.Min, req.MemoryMiB.Max) {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	return nil
+}
+
+func validRange(lo, hi *int64) bool {
+	if aws.Int64Value(lo) < 0 || aws.Int64Value(hi) < 0 {
+		return false
+	}
+	return hi == nil || aws.Int64Value(lo) <= *hi
+}
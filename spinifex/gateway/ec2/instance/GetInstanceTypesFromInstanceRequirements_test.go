@@ -0,0 +1,81 @@
+package gateway_ec2_instance
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func instanceRequirementsInput(minVCPU, maxVCPU, minMiB, maxMiB int64) *ec2.GetInstanceTypesFromInstanceRequirementsInput {
+	return &ec2.GetInstanceTypesFromInstanceRequirementsInput{
+		ArchitectureTypes:   aws.StringSlice([]string{"arm64"}),
+		VirtualizationTypes: aws.StringSlice([]string{"hvm"}),
+		InstanceRequirements: &ec2.InstanceRequirementsRequest{
+			VCpuCount: &ec2.VCpuCountRangeRequest{Min: aws.Int64(minVCPU), Max: aws.Int64(maxVCPU)},
+			MemoryMiB: &ec2.MemoryMiBRequest{Min: aws.Int64(minMiB), Max: aws.Int64(maxMiB)},
+		},
+	}
+}
+
+func TestGetInstanceTypesFromInstanceRequirements_MergesNodes(t *testing.T) {
+	_, nc := startTestNATSServer(t)
+
+	respond := func(conn *nats.Conn, names ...string) {
+		conn.Subscribe("ec2.GetInstanceTypesFromInstanceRequirements", func(msg *nats.Msg) {
+			var input ec2.GetInstanceTypesFromInstanceRequirementsInput
+			require.NoError(t, json.Unmarshal(msg.Data, &input))
+			output := &ec2.GetInstanceTypesFromInstanceRequirementsOutput{}
+			for _, name := range names {
+				output.InstanceTypes = append(output.InstanceTypes, &ec2.InstanceTypeInfoFromInstanceRequirements{InstanceType: aws.String(name)})
+			}
+			data, _ := json.Marshal(output)
+			msg.Respond(data)
+		})
+	}
+	respond(nc, "t4g.large", "c6g.xlarge")
+	nc2, err := nats.Connect(nc.ConnectedUrl())
+	require.NoError(t, err)
+	defer nc2.Close()
+	respond(nc2, "t4g.medium", "t4g.large")
+	require.NoError(t, nc2.Flush())
+
+	output, err := GetInstanceTypesFromInstanceRequirements(instanceRequirementsInput(2, 4, 4096, 8192), nc, 2)
+	require.NoError(t, err)
+
+	var names []string
+	for _, it := range output.InstanceTypes {
+		names = append(names, aws.StringValue(it.InstanceType))
+	}
+	assert.Equal(t, []string{"c6g.xlarge", "t4g.large", "t4g.medium"}, names)
+}
+
+func TestGetInstanceTypesFromInstanceRequirements_Validation(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   *ec2.GetInstanceTypesFromInstanceRequirementsInput
+		wantErr string
+	}{
+		{"inverted vCPU range", instanceRequirementsInput(4, 2, 0, 8192), awserrors.ErrorInvalidParameterValue},
+		{"inverted memory range", instanceRequirementsInput(2, 4, 8192, 4096), awserrors.ErrorInvalidParameterValue},
+		{"negative vCPU", instanceRequirementsInput(-1, 4, 0, 8192), awserrors.ErrorInvalidParameterValue},
+		{"missing requirements", &ec2.GetInstanceTypesFromInstanceRequirementsInput{}, awserrors.ErrorMissingParameter},
+		{"missing memory", &ec2.GetInstanceTypesFromInstanceRequirementsInput{
+			InstanceRequirements: &ec2.InstanceRequirementsRequest{VCpuCount: &ec2.VCpuCountRangeRequest{Min: aws.Int64(2)}},
+		}, awserrors.ErrorMissingParameter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := GetInstanceTypesFromInstanceRequirements(tt.input, nil, 1)
+			require.Error(t, err)
+			assert.Equal(t, tt.wantErr, err.Error())
+		})
+	}
+
+	assert.NoError(t, validateInstanceRequirements(instanceRequirementsInput(2, 2, 4096, 4096)))
+}
@@ -0,0 +1,57 @@
+package gateway_ec2_instance
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+)
+
+// ValidateGetPasswordDataInput validates the input parameters
+func ValidateGetPasswordDataInput(input *ec2.GetPasswordDataInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if input.InstanceId == nil || *input.InstanceId == "" {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	if !strings.HasPrefix(*input.InstanceId, "i-") {
+		return errors.New(awserrors.ErrorInvalidInstanceIDMalformed)
+	}
+	return nil
+}
+
+// GetPasswordData returns the password the instance's guest agent posted,
+// encrypted with the instance key pair. PasswordData is empty until the
+// guest has posted it. A running instance is answered by the node hosting
+// it; otherwise the data comes from the stopped instance in shared KV.
+func GetPasswordData(input *ec2.GetPasswordDataInput, natsConn *nats.Conn, accountID string) (*ec2.GetPasswordDataOutput, error) {
+	if err := ValidateGetPasswordDataInput(input); err != nil {
+		return nil, err
+	}
+
+	instanceID := *input.InstanceId
+	command := types.EC2InstanceCommand{
+		ID:         instanceID,
+		Attributes: types.EC2CommandAttributes{GetPasswordData: true},
+	}
+
+	output, err := utils.NATSRequest[ec2.GetPasswordDataOutput](natsConn, subjects.InstanceCmd(instanceID), command, 10*time.Second, accountID)
+	if err != nil && errors.Is(err, nats.ErrNoResponders) {
+		// No node runs the instance, so it is stopped if it exists.
+		output, err = utils.NATSRequest[ec2.GetPasswordDataOutput](natsConn, "ec2.GetStoppedInstancePasswordData", command, 10*time.Second, accountID)
+	}
+	if err != nil {
+		slog.Error("GetPasswordData: Failed", "instance_id", instanceID, "err", err)
+		return nil, err
+	}
+
+	return output, nil
+}
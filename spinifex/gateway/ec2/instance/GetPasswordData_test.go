@@ -0,0 +1,86 @@
+package gateway_ec2_instance
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateGetPasswordDataInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		input *ec2.GetPasswordDataInput
+		want  string
+	}{
+		{"nil input", nil, awserrors.ErrorInvalidParameterValue},
+		{"missing instance", &ec2.GetPasswordDataInput{}, awserrors.ErrorMissingParameter},
+		{"malformed instance", &ec2.GetPasswordDataInput{InstanceId: aws.String("vol-1")}, awserrors.ErrorInvalidInstanceIDMalformed},
+		{"valid", &ec2.GetPasswordDataInput{InstanceId: aws.String("i-1")}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateGetPasswordDataInput(tt.input)
+			if tt.want == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Equal(t, tt.want, err.Error())
+		})
+	}
+}
+
+func TestGetPasswordData_RunningInstance(t *testing.T) {
+	_, nc := startTestNATSServer(t)
+	instanceID := "i-0123456789abcdef0"
+
+	_, err := nc.Subscribe(subjects.InstanceCmd(instanceID), func(msg *nats.Msg) {
+		var cmd types.EC2InstanceCommand
+		require.NoError(t, json.Unmarshal(msg.Data, &cmd))
+		assert.True(t, cmd.Attributes.GetPasswordData)
+		data, _ := json.Marshal(&ec2.GetPasswordDataOutput{
+			InstanceId:   aws.String(cmd.ID),
+			PasswordData: aws.String("ZW5jcnlwdGVk"),
+		})
+		msg.Respond(data)
+	})
+	require.NoError(t, err)
+
+	out, err := GetPasswordData(&ec2.GetPasswordDataInput{InstanceId: aws.String(instanceID)}, nc, "123456789012")
+	require.NoError(t, err)
+	assert.Equal(t, instanceID, aws.StringValue(out.InstanceId))
+	assert.Equal(t, "ZW5jcnlwdGVk", aws.StringValue(out.PasswordData))
+}
+
+func TestGetPasswordData_StoppedInstance(t *testing.T) {
+	_, nc := startTestNATSServer(t)
+
+	_, err := nc.Subscribe("ec2.GetStoppedInstancePasswordData", func(msg *nats.Msg) {
+		var cmd types.EC2InstanceCommand
+		require.NoError(t, json.Unmarshal(msg.Data, &cmd))
+		if cmd.ID != "i-stopped" {
+			msg.Respond(utils.GenerateErrorPayload(awserrors.ErrorInvalidInstanceIDNotFound))
+			return
+		}
+		data, _ := json.Marshal(&ec2.GetPasswordDataOutput{InstanceId: aws.String(cmd.ID), PasswordData: aws.String("")})
+		msg.Respond(data)
+	})
+	require.NoError(t, err)
+
+	out, err := GetPasswordData(&ec2.GetPasswordDataInput{InstanceId: aws.String("i-stopped")}, nc, "123456789012")
+	require.NoError(t, err)
+	assert.Empty(t, aws.StringValue(out.PasswordData))
+
+	_, err = GetPasswordData(&ec2.GetPasswordDataInput{InstanceId: aws.String("i-gone")}, nc, "123456789012")
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorInvalidInstanceIDNotFound, err.Error())
+}
@@ -10,6 +10,9 @@ import (
 
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_ec2_instance "github.com/mulgadc/spinifex/spinifex/handlers/ec2/instance"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/types"
 	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/nats-io/nats.go"
 )
@@ -38,6 +41,12 @@ func ValidateModifyInstanceAttributeInput(input *ec2.ModifyInstanceAttributeInpu
 	if input.SourceDestCheck != nil {
 		count++
 	}
+	if input.DisableApiTermination != nil {
+		count++
+	}
+	if input.DisableApiStop != nil {
+		count++
+	}
 	if count != 1 {
 		return errors.New(awserrors.ErrorInvalidParameterValue)
 	}
@@ -46,12 +55,26 @@ func ValidateModifyInstanceAttributeInput(input *ec2.ModifyInstanceAttributeInpu
 	if input.InstanceType != nil && (input.InstanceType.Value == nil || *input.InstanceType.Value == "") {
 		return errors.New(awserrors.ErrorInvalidInstanceAttributeValue)
 	}
+	if input.UserData != nil {
+		if err := handlers_ec2_instance.ValidateUserDataSize(len(input.UserData.Value)); err != nil {
+			return err
+		}
+	}
+	if input.DisableApiTermination != nil && input.DisableApiTermination.Value == nil {
+		return errors.New(awserrors.ErrorInvalidInstanceAttributeValue)
+	}
+	if input.DisableApiStop != nil && input.DisableApiStop.Value == nil {
+		return errors.New(awserrors.ErrorInvalidInstanceAttributeValue)
+	}
 
 	return nil
 }
 
 // ModifyInstanceAttribute sends a modify request to the daemon via NATS.
 // The daemon updates the stopped instance in KV and returns an empty response on success.
+// Stop and termination protection can also change while the instance runs, and
+// so can the instance type within a hot-pluggable family, so those go to the
+// node hosting it first.
 func ModifyInstanceAttribute(input *ec2.ModifyInstanceAttributeInput, natsConn *nats.Conn, accountID string) (ec2.ModifyInstanceAttributeOutput, error) {
 	if err := ValidateModifyInstanceAttributeInput(input); err != nil {
 		return ec2.ModifyInstanceAttributeOutput{}, err
@@ -59,13 +82,26 @@ func ModifyInstanceAttribute(input *ec2.ModifyInstanceAttributeInput, natsConn *
 
 	slog.Info("ModifyInstanceAttribute: Processing request", "instance_id", *input.InstanceId)
 
+	if command, ok := runningInstanceAttributeCommand(input); ok {
+		_, err := utils.NATSRequest[struct{}](natsConn, subjects.InstanceCmd(*input.InstanceId), command, 60*time.Second, accountID)
+		if err == nil {
+			slog.Info("ModifyInstanceAttribute: Completed successfully", "instance_id", *input.InstanceId)
+			return ec2.ModifyInstanceAttributeOutput{}, nil
+		}
+		if !errors.Is(err, nats.ErrNoResponders) {
+			slog.Error("ModifyInstanceAttribute: Failed", "instance_id", *input.InstanceId, "err", err)
+			return ec2.ModifyInstanceAttributeOutput{}, err
+		}
+		// No node runs the instance, so it is stopped if it exists.
+	}
+
 	jsonData, err := json.Marshal(input)
 	if err != nil {
 		slog.Error("ModifyInstanceAttribute: Failed to marshal request", "instance_id", *input.InstanceId, "err", err)
 		return ec2.ModifyInstanceAttributeOutput{}, fmt.Errorf("failed to marshal request: %w", err)
 	}
 
-	reqMsg := nats.NewMsg("ec2.ModifyInstanceAttribute")
+	reqMsg := nats.NewMsg(utils.Subject("ec2.ModifyInstanceAttribute"))
 	reqMsg.Data = jsonData
 	reqMsg.Header.Set(utils.AccountIDHeader, accountID)
 	msg, err := natsConn.RequestMsg(reqMsg, 30*time.Second)
@@ -74,11 +110,36 @@ func ModifyInstanceAttribute(input *ec2.ModifyInstanceAttributeInput, natsConn *
 		return ec2.ModifyInstanceAttributeOutput{}, fmt.Errorf("failed to send modify request: %w", err)
 	}
 
-	if responseError, parseErr := utils.ValidateErrorPayload(msg.Data); parseErr != nil {
-		slog.Error("ModifyInstanceAttribute: Daemon returned error", "instance_id", *input.InstanceId, "code", *responseError.Code)
-		return ec2.ModifyInstanceAttributeOutput{}, errors.New(*responseError.Code)
+	if replyErr := utils.DecodeReply(msg).Err; replyErr != nil {
+		slog.Error("ModifyInstanceAttribute: Daemon returned error", "instance_id", *input.InstanceId, "code", replyErr.Code)
+		return ec2.ModifyInstanceAttributeOutput{}, replyErr
 	}
 
 	slog.Info("ModifyInstanceAttribute: Completed successfully", "instance_id", *input.InstanceId)
 	return ec2.ModifyInstanceAttributeOutput{}, nil
 }
+
+// runningInstanceAttributeCommand returns the command that applies input to
+// a running instance, or false when the attribute only changes while the
+// instance is stopped.
+func runningInstanceAttributeCommand(input *ec2.ModifyInstanceAttributeInput) (types.EC2InstanceCommand, bool) {
+	command := types.EC2InstanceCommand{ID: *input.InstanceId}
+	switch {
+	case input.DisableApiTermination != nil || input.DisableApiStop != nil:
+		protection := &types.ProtectionData{}
+		if input.DisableApiTermination != nil {
+			protection.DisableApiTermination = input.DisableApiTermination.Value
+		}
+		if input.DisableApiStop != nil {
+			protection.DisableApiStop = input.DisableApiStop.Value
+		}
+		command.Attributes.ModifyProtection = true
+		command.Protection = protection
+	case input.InstanceType != nil:
+		command.Attributes.ResizeInstance = true
+		command.ResizeInstanceData = &types.ResizeInstanceData{InstanceType: *input.InstanceType.Value}
+	default:
+		return command, false
+	}
+	return command, true
+}
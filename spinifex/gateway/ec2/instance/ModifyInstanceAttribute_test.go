@@ -7,6 +7,8 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/types"
 	"github.com/nats-io/nats.go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -95,6 +97,16 @@ func TestValidateModifyInstanceAttributeInput_ValidUserData(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestValidateModifyInstanceAttributeInput_UserDataTooLarge(t *testing.T) {
+	err := ValidateModifyInstanceAttributeInput(&ec2.ModifyInstanceAttributeInput{
+		InstanceId: aws.String("i-abc123"),
+		UserData:   &ec2.BlobAttributeValue{Value: make([]byte, 16*1024+1)},
+	})
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorInvalidParameterValue, err.Error())
+	assert.Contains(t, awserrors.Detail(err), "16384 bytes")
+}
+
 func TestValidateModifyInstanceAttributeInput_ValidSourceDestCheck(t *testing.T) {
 	err := ValidateModifyInstanceAttributeInput(&ec2.ModifyInstanceAttributeInput{
 		InstanceId:      aws.String("i-abc123"),
@@ -113,6 +125,35 @@ func TestValidateModifyInstanceAttributeInput_SourceDestCheckWithOtherAttribute(
 	assert.Equal(t, awserrors.ErrorInvalidParameterValue, err.Error())
 }
 
+func TestValidateModifyInstanceAttributeInput_Protection(t *testing.T) {
+	err := ValidateModifyInstanceAttributeInput(&ec2.ModifyInstanceAttributeInput{
+		InstanceId:            aws.String("i-abc123"),
+		DisableApiTermination: &ec2.AttributeBooleanValue{Value: aws.Bool(true)},
+	})
+	assert.NoError(t, err)
+
+	err = ValidateModifyInstanceAttributeInput(&ec2.ModifyInstanceAttributeInput{
+		InstanceId:     aws.String("i-abc123"),
+		DisableApiStop: &ec2.AttributeBooleanValue{Value: aws.Bool(false)},
+	})
+	assert.NoError(t, err)
+
+	err = ValidateModifyInstanceAttributeInput(&ec2.ModifyInstanceAttributeInput{
+		InstanceId:     aws.String("i-abc123"),
+		DisableApiStop: &ec2.AttributeBooleanValue{},
+	})
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorInvalidInstanceAttributeValue, err.Error())
+
+	err = ValidateModifyInstanceAttributeInput(&ec2.ModifyInstanceAttributeInput{
+		InstanceId:            aws.String("i-abc123"),
+		DisableApiTermination: &ec2.AttributeBooleanValue{Value: aws.Bool(true)},
+		DisableApiStop:        &ec2.AttributeBooleanValue{Value: aws.Bool(true)},
+	})
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorInvalidParameterValue, err.Error())
+}
+
 // --- Gateway function tests ---
 
 func TestModifyInstanceAttribute_Success(t *testing.T) {
@@ -175,3 +216,73 @@ func TestModifyInstanceAttribute_ValidationFailure(t *testing.T) {
 	require.Error(t, err)
 	assert.Equal(t, awserrors.ErrorInvalidParameterValue, err.Error())
 }
+
+func TestModifyInstanceAttribute_ProtectionRunningInstance(t *testing.T) {
+	_, nc := startTestNATSServer(t)
+
+	instanceID := "i-protect-running"
+	var received types.EC2InstanceCommand
+	nc.Subscribe(subjects.InstanceCmd(instanceID), func(msg *nats.Msg) {
+		require.NoError(t, json.Unmarshal(msg.Data, &received))
+		msg.Respond([]byte(`{}`))
+	})
+	nc.QueueSubscribe("ec2.ModifyInstanceAttribute", "spinifex-workers", func(msg *nats.Msg) {
+		t.Error("a running instance's protection should be changed by its node")
+		msg.Respond([]byte(`{}`))
+	})
+
+	_, err := ModifyInstanceAttribute(&ec2.ModifyInstanceAttributeInput{
+		InstanceId:     aws.String(instanceID),
+		DisableApiStop: &ec2.AttributeBooleanValue{Value: aws.Bool(true)},
+	}, nc, "123456789012")
+	require.NoError(t, err)
+
+	assert.True(t, received.Attributes.ModifyProtection)
+	require.NotNil(t, received.Protection)
+	assert.Nil(t, received.Protection.DisableApiTermination)
+	assert.True(t, aws.BoolValue(received.Protection.DisableApiStop))
+}
+
+func TestModifyInstanceAttribute_ProtectionStoppedInstance(t *testing.T) {
+	_, nc := startTestNATSServer(t)
+
+	// No node runs the instance, so the stopped-instance handler applies it.
+	var received ec2.ModifyInstanceAttributeInput
+	nc.QueueSubscribe("ec2.ModifyInstanceAttribute", "spinifex-workers", func(msg *nats.Msg) {
+		require.NoError(t, json.Unmarshal(msg.Data, &received))
+		msg.Respond([]byte(`{}`))
+	})
+
+	_, err := ModifyInstanceAttribute(&ec2.ModifyInstanceAttributeInput{
+		InstanceId:            aws.String("i-protect-stopped"),
+		DisableApiTermination: &ec2.AttributeBooleanValue{Value: aws.Bool(true)},
+	}, nc, "123456789012")
+	require.NoError(t, err)
+	require.NotNil(t, received.DisableApiTermination)
+	assert.True(t, aws.BoolValue(received.DisableApiTermination.Value))
+}
+
+func TestModifyInstanceAttribute_InstanceTypeRunningInstance(t *testing.T) {
+	_, nc := startTestNATSServer(t)
+
+	instanceID := "i-resize-running"
+	var received types.EC2InstanceCommand
+	nc.Subscribe(subjects.InstanceCmd(instanceID), func(msg *nats.Msg) {
+		require.NoError(t, json.Unmarshal(msg.Data, &received))
+		msg.Respond([]byte(`{}`))
+	})
+	nc.QueueSubscribe("ec2.ModifyInstanceAttribute", "spinifex-workers", func(msg *nats.Msg) {
+		t.Error("a running instance should be resized by its node")
+		msg.Respond([]byte(`{}`))
+	})
+
+	_, err := ModifyInstanceAttribute(&ec2.ModifyInstanceAttributeInput{
+		InstanceId:   aws.String(instanceID),
+		InstanceType: &ec2.AttributeValue{Value: aws.String("m5.xlarge")},
+	}, nc, "123456789012")
+	require.NoError(t, err)
+
+	assert.True(t, received.Attributes.ResizeInstance)
+	require.NotNil(t, received.ResizeInstanceData)
+	assert.Equal(t, "m5.xlarge", received.ResizeInstanceData.InstanceType)
+}
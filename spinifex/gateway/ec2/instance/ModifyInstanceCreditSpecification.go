@@ -0,0 +1,108 @@
+package gateway_ec2_instance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/instancetypes"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+)
+
+// ValidateModifyInstanceCreditSpecificationInput validates the input for
+// ModifyInstanceCreditSpecification.
+func ValidateModifyInstanceCreditSpecificationInput(input *ec2.ModifyInstanceCreditSpecificationInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if len(input.InstanceCreditSpecifications) == 0 {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+
+	seen := make(map[string]bool, len(input.InstanceCreditSpecifications))
+	for _, spec := range input.InstanceCreditSpecifications {
+		if spec == nil || spec.InstanceId == nil {
+			return errors.New(awserrors.ErrorMissingParameter)
+		}
+		if !strings.HasPrefix(*spec.InstanceId, "i-") {
+			return errors.New(awserrors.ErrorInvalidInstanceIDMalformed)
+		}
+		if seen[*spec.InstanceId] {
+			return errors.New(awserrors.ErrorInvalidInstanceCreditSpecificationDuplicateInstanceId)
+		}
+		seen[*spec.InstanceId] = true
+		if !instancetypes.ValidCPUCredits(aws.StringValue(spec.CpuCredits)) {
+			return errors.New(awserrors.ErrorInvalidCpuCredits)
+		}
+	}
+	return nil
+}
+
+// ModifyInstanceCreditSpecification switches the CPU credit mode of
+// burstable instances. Every node updates the listed instances it runs;
+// the rest are looked up among the stopped instances in shared KV. Each
+// instance succeeds or fails on its own.
+func ModifyInstanceCreditSpecification(input *ec2.ModifyInstanceCreditSpecificationInput, natsConn *nats.Conn, expectedNodes int, accountID string) (*ec2.ModifyInstanceCreditSpecificationOutput, error) {
+	if err := ValidateModifyInstanceCreditSpecificationInput(input); err != nil {
+		return nil, err
+	}
+
+	jsonData, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal input: %w", err)
+	}
+
+	output := &ec2.ModifyInstanceCreditSpecificationOutput{
+		SuccessfulInstanceCreditSpecifications:   []*ec2.SuccessfulInstanceCreditSpecificationItem{},
+		UnsuccessfulInstanceCreditSpecifications: []*ec2.UnsuccessfulInstanceCreditSpecificationItem{},
+	}
+	handled := make(map[string]bool)
+	merge := func(nodeOutput *ec2.ModifyInstanceCreditSpecificationOutput) {
+		for _, item := range nodeOutput.SuccessfulInstanceCreditSpecifications {
+			handled[aws.StringValue(item.InstanceId)] = true
+			output.SuccessfulInstanceCreditSpecifications = append(output.SuccessfulInstanceCreditSpecifications, item)
+		}
+		for _, item := range nodeOutput.UnsuccessfulInstanceCreditSpecifications {
+			handled[aws.StringValue(item.InstanceId)] = true
+			output.UnsuccessfulInstanceCreditSpecifications = append(output.UnsuccessfulInstanceCreditSpecifications, item)
+		}
+	}
+
+	err = gatherFromNodes(natsConn, "ec2.ModifyInstanceCreditSpecification", jsonData, expectedNodes, accountID, func(data []byte) {
+		var nodeOutput ec2.ModifyInstanceCreditSpecificationOutput
+		if err := json.Unmarshal(data, &nodeOutput); err != nil {
+			slog.Error("ModifyInstanceCreditSpecification: Failed to unmarshal node response", "err", err)
+			return
+		}
+		merge(&nodeOutput)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := &ec2.ModifyInstanceCreditSpecificationInput{}
+	for _, spec := range input.InstanceCreditSpecifications {
+		if !handled[*spec.InstanceId] {
+			remaining.InstanceCreditSpecifications = append(remaining.InstanceCreditSpecifications, spec)
+		}
+	}
+	if len(remaining.InstanceCreditSpecifications) > 0 {
+		stopped, err := utils.NATSRequest[ec2.ModifyInstanceCreditSpecificationOutput](natsConn, "ec2.ModifyStoppedInstanceCreditSpecification", remaining, 30*time.Second, accountID)
+		if err != nil {
+			return nil, err
+		}
+		merge(stopped)
+	}
+
+	slog.Info("ModifyInstanceCreditSpecification: Completed",
+		"successful", len(output.SuccessfulInstanceCreditSpecifications),
+		"unsuccessful", len(output.UnsuccessfulInstanceCreditSpecifications))
+	return output, nil
+}
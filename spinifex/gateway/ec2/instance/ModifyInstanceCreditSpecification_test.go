@@ -0,0 +1,118 @@
+package gateway_ec2_instance
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func creditSpecRequest(id, mode string) *ec2.InstanceCreditSpecificationRequest {
+	return &ec2.InstanceCreditSpecificationRequest{InstanceId: aws.String(id), CpuCredits: aws.String(mode)}
+}
+
+func TestValidateModifyInstanceCreditSpecificationInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   *ec2.ModifyInstanceCreditSpecificationInput
+		wantErr string
+	}{
+		{name: "nil input", input: nil, wantErr: awserrors.ErrorInvalidParameterValue},
+		{name: "no instances", input: &ec2.ModifyInstanceCreditSpecificationInput{}, wantErr: awserrors.ErrorMissingParameter},
+		{
+			name: "missing instance id",
+			input: &ec2.ModifyInstanceCreditSpecificationInput{InstanceCreditSpecifications: []*ec2.InstanceCreditSpecificationRequest{
+				{CpuCredits: aws.String("standard")},
+			}},
+			wantErr: awserrors.ErrorMissingParameter,
+		},
+		{
+			name: "malformed instance id",
+			input: &ec2.ModifyInstanceCreditSpecificationInput{InstanceCreditSpecifications: []*ec2.InstanceCreditSpecificationRequest{
+				creditSpecRequest("abc", "standard"),
+			}},
+			wantErr: awserrors.ErrorInvalidInstanceIDMalformed,
+		},
+		{
+			name: "duplicate instance id",
+			input: &ec2.ModifyInstanceCreditSpecificationInput{InstanceCreditSpecifications: []*ec2.InstanceCreditSpecificationRequest{
+				creditSpecRequest("i-aaa", "standard"), creditSpecRequest("i-aaa", "unlimited"),
+			}},
+			wantErr: awserrors.ErrorInvalidInstanceCreditSpecificationDuplicateInstanceId,
+		},
+		{
+			name: "invalid mode",
+			input: &ec2.ModifyInstanceCreditSpecificationInput{InstanceCreditSpecifications: []*ec2.InstanceCreditSpecificationRequest{
+				creditSpecRequest("i-aaa", "turbo"),
+			}},
+			wantErr: awserrors.ErrorInvalidCpuCredits,
+		},
+		{
+			name: "valid",
+			input: &ec2.ModifyInstanceCreditSpecificationInput{InstanceCreditSpecifications: []*ec2.InstanceCreditSpecificationRequest{
+				creditSpecRequest("i-aaa", "standard"), creditSpecRequest("i-bbb", "unlimited"),
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateModifyInstanceCreditSpecificationInput(tt.input)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Equal(t, tt.wantErr, err.Error())
+		})
+	}
+}
+
+func TestModifyInstanceCreditSpecification_RunningAndStopped(t *testing.T) {
+	_, nc := startTestNATSServer(t)
+
+	// The node runs i-aaa; i-bbb is stopped and must be sent on to KV alone.
+	_, err := nc.Subscribe("ec2.ModifyInstanceCreditSpecification", func(msg *nats.Msg) {
+		data, _ := json.Marshal(&ec2.ModifyInstanceCreditSpecificationOutput{
+			SuccessfulInstanceCreditSpecifications: []*ec2.SuccessfulInstanceCreditSpecificationItem{
+				{InstanceId: aws.String("i-aaa")},
+			},
+		})
+		msg.Respond(data)
+	})
+	require.NoError(t, err)
+
+	var stoppedInput ec2.ModifyInstanceCreditSpecificationInput
+	_, err = nc.Subscribe("ec2.ModifyStoppedInstanceCreditSpecification", func(msg *nats.Msg) {
+		_ = json.Unmarshal(msg.Data, &stoppedInput)
+		data, _ := json.Marshal(&ec2.ModifyInstanceCreditSpecificationOutput{
+			UnsuccessfulInstanceCreditSpecifications: []*ec2.UnsuccessfulInstanceCreditSpecificationItem{
+				{
+					InstanceId: aws.String("i-bbb"),
+					Error:      &ec2.UnsuccessfulInstanceCreditSpecificationItemError{Code: aws.String(awserrors.ErrorInstanceCreditSpecificationNotSupported)},
+				},
+			},
+		})
+		msg.Respond(data)
+	})
+	require.NoError(t, err)
+
+	out, err := ModifyInstanceCreditSpecification(&ec2.ModifyInstanceCreditSpecificationInput{
+		InstanceCreditSpecifications: []*ec2.InstanceCreditSpecificationRequest{
+			creditSpecRequest("i-aaa", "unlimited"), creditSpecRequest("i-bbb", "unlimited"),
+		},
+	}, nc, 1, "123456789012")
+	require.NoError(t, err)
+
+	require.Len(t, stoppedInput.InstanceCreditSpecifications, 1)
+	assert.Equal(t, "i-bbb", *stoppedInput.InstanceCreditSpecifications[0].InstanceId)
+
+	require.Len(t, out.SuccessfulInstanceCreditSpecifications, 1)
+	assert.Equal(t, "i-aaa", *out.SuccessfulInstanceCreditSpecifications[0].InstanceId)
+	require.Len(t, out.UnsuccessfulInstanceCreditSpecifications, 1)
+	assert.Equal(t, awserrors.ErrorInstanceCreditSpecificationNotSupported, *out.UnsuccessfulInstanceCreditSpecifications[0].Error.Code)
+}
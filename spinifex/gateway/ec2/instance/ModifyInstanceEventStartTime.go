@@ -0,0 +1,38 @@
+package gateway_ec2_instance
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_ec2_instanceevent "github.com/mulgadc/spinifex/spinifex/handlers/ec2/instanceevent"
+	"github.com/nats-io/nats.go"
+)
+
+// ValidateModifyInstanceEventStartTimeInput validates the input parameters
+func ValidateModifyInstanceEventStartTimeInput(input *ec2.ModifyInstanceEventStartTimeInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if input.InstanceId == nil || *input.InstanceId == "" ||
+		input.InstanceEventId == nil || *input.InstanceEventId == "" ||
+		input.NotBefore == nil {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	if !strings.HasPrefix(*input.InstanceId, "i-") {
+		return errors.New(awserrors.ErrorInvalidInstanceIDMalformed)
+	}
+	return nil
+}
+
+// ModifyInstanceEventStartTime reschedules a scheduled instance event within
+// the window allowed by the event's deadline.
+func ModifyInstanceEventStartTime(input *ec2.ModifyInstanceEventStartTimeInput, natsConn *nats.Conn, accountID string) (*ec2.ModifyInstanceEventStartTimeOutput, error) {
+	if err := ValidateModifyInstanceEventStartTimeInput(input); err != nil {
+		return nil, err
+	}
+
+	svc := handlers_ec2_instanceevent.NewNATSInstanceEventService(natsConn)
+	return svc.ModifyInstanceEventStartTime(input, accountID)
+}
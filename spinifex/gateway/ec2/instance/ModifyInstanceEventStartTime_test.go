@@ -0,0 +1,35 @@
+package gateway_ec2_instance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateModifyInstanceEventStartTimeInput(t *testing.T) {
+	valid := func() *ec2.ModifyInstanceEventStartTimeInput {
+		return &ec2.ModifyInstanceEventStartTimeInput{
+			InstanceId:      aws.String("i-123"),
+			InstanceEventId: aws.String("instance-event-1"),
+			NotBefore:       aws.Time(time.Now().Add(time.Hour)),
+		}
+	}
+	assert.NoError(t, ValidateModifyInstanceEventStartTimeInput(valid()))
+	assert.EqualError(t, ValidateModifyInstanceEventStartTimeInput(nil), awserrors.ErrorInvalidParameterValue)
+
+	missingEvent := valid()
+	missingEvent.InstanceEventId = nil
+	assert.EqualError(t, ValidateModifyInstanceEventStartTimeInput(missingEvent), awserrors.ErrorMissingParameter)
+
+	missingStart := valid()
+	missingStart.NotBefore = nil
+	assert.EqualError(t, ValidateModifyInstanceEventStartTimeInput(missingStart), awserrors.ErrorMissingParameter)
+
+	malformed := valid()
+	malformed.InstanceId = aws.String("vol-123")
+	assert.EqualError(t, ValidateModifyInstanceEventStartTimeInput(malformed), awserrors.ErrorInvalidInstanceIDMalformed)
+}
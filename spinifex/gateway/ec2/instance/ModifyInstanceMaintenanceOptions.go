@@ -0,0 +1,70 @@
+package gateway_ec2_instance
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+)
+
+// ValidateModifyInstanceMaintenanceOptionsInput validates the input for
+// ModifyInstanceMaintenanceOptions. Only AutoRecovery is supported.
+func ValidateModifyInstanceMaintenanceOptionsInput(input *ec2.ModifyInstanceMaintenanceOptionsInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if input.InstanceId == nil || *input.InstanceId == "" {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	if !strings.HasPrefix(*input.InstanceId, "i-") {
+		return errors.New(awserrors.ErrorInvalidInstanceIDMalformed)
+	}
+	if input.AutoRecovery == nil {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	switch *input.AutoRecovery {
+	case ec2.InstanceAutoRecoveryStateDefault, ec2.InstanceAutoRecoveryStateDisabled:
+	default:
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	return nil
+}
+
+// ModifyInstanceMaintenanceOptions turns an instance's auto-recovery on or
+// off. With auto-recovery disabled the node leaves a crashed instance in
+// the error state instead of restarting it. A running instance is updated
+// by the node hosting it; otherwise the change is made to the stopped
+// instance in shared KV.
+func ModifyInstanceMaintenanceOptions(input *ec2.ModifyInstanceMaintenanceOptionsInput, natsConn *nats.Conn, accountID string) (*ec2.ModifyInstanceMaintenanceOptionsOutput, error) {
+	if err := ValidateModifyInstanceMaintenanceOptionsInput(input); err != nil {
+		return nil, err
+	}
+
+	instanceID := *input.InstanceId
+	command := types.EC2InstanceCommand{
+		ID:                 instanceID,
+		Attributes:         types.EC2CommandAttributes{ModifyMaintenanceOptions: true},
+		MaintenanceOptions: &types.MaintenanceOptionsData{AutoRecovery: aws.StringValue(input.AutoRecovery)},
+	}
+
+	output, err := utils.NATSRequest[ec2.ModifyInstanceMaintenanceOptionsOutput](natsConn, subjects.InstanceCmd(instanceID), command, 10*time.Second, accountID)
+	if err != nil && errors.Is(err, nats.ErrNoResponders) {
+		// No node runs the instance, so it is stopped if it exists.
+		output, err = utils.NATSRequest[ec2.ModifyInstanceMaintenanceOptionsOutput](natsConn, "ec2.ModifyStoppedInstanceMaintenanceOptions", command, 10*time.Second, accountID)
+	}
+	if err != nil {
+		slog.Error("ModifyInstanceMaintenanceOptions: Failed", "instance_id", instanceID, "err", err)
+		return nil, err
+	}
+
+	slog.Info("ModifyInstanceMaintenanceOptions: Completed", "instance_id", instanceID, "auto_recovery", aws.StringValue(input.AutoRecovery))
+	return output, nil
+}
@@ -0,0 +1,97 @@
+package gateway_ec2_instance
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func respondMaintenanceOptions(t *testing.T, nc *nats.Conn, topic string) {
+	t.Helper()
+	_, err := nc.Subscribe(topic, func(msg *nats.Msg) {
+		var cmd types.EC2InstanceCommand
+		require.NoError(t, json.Unmarshal(msg.Data, &cmd))
+		data, _ := json.Marshal(&ec2.ModifyInstanceMaintenanceOptionsOutput{
+			InstanceId:   aws.String(cmd.ID),
+			AutoRecovery: aws.String(cmd.MaintenanceOptions.AutoRecovery),
+		})
+		msg.Respond(data)
+	})
+	require.NoError(t, err)
+}
+
+func TestValidateModifyInstanceMaintenanceOptionsInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		input *ec2.ModifyInstanceMaintenanceOptionsInput
+		want  string
+	}{
+		{"nil input", nil, awserrors.ErrorInvalidParameterValue},
+		{"missing instance", &ec2.ModifyInstanceMaintenanceOptionsInput{AutoRecovery: aws.String("disabled")}, awserrors.ErrorMissingParameter},
+		{"malformed instance", &ec2.ModifyInstanceMaintenanceOptionsInput{InstanceId: aws.String("vol-1"), AutoRecovery: aws.String("disabled")}, awserrors.ErrorInvalidInstanceIDMalformed},
+		{"missing auto-recovery", &ec2.ModifyInstanceMaintenanceOptionsInput{InstanceId: aws.String("i-1")}, awserrors.ErrorMissingParameter},
+		{"bad auto-recovery", &ec2.ModifyInstanceMaintenanceOptionsInput{InstanceId: aws.String("i-1"), AutoRecovery: aws.String("always")}, awserrors.ErrorInvalidParameterValue},
+		{"valid", &ec2.ModifyInstanceMaintenanceOptionsInput{InstanceId: aws.String("i-1"), AutoRecovery: aws.String("disabled")}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateModifyInstanceMaintenanceOptionsInput(tt.input)
+			if tt.want == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Equal(t, tt.want, err.Error())
+		})
+	}
+}
+
+func TestModifyInstanceMaintenanceOptions_RunningInstance(t *testing.T) {
+	_, nc := startTestNATSServer(t)
+	instanceID := "i-0123456789abcdef0"
+	respondMaintenanceOptions(t, nc, subjects.InstanceCmd(instanceID))
+
+	out, err := ModifyInstanceMaintenanceOptions(&ec2.ModifyInstanceMaintenanceOptionsInput{
+		InstanceId:   aws.String(instanceID),
+		AutoRecovery: aws.String(ec2.InstanceAutoRecoveryStateDisabled),
+	}, nc, "123456789012")
+	require.NoError(t, err)
+	assert.Equal(t, instanceID, *out.InstanceId)
+	assert.Equal(t, ec2.InstanceAutoRecoveryStateDisabled, *out.AutoRecovery)
+}
+
+func TestModifyInstanceMaintenanceOptions_StoppedInstance(t *testing.T) {
+	_, nc := startTestNATSServer(t)
+	respondMaintenanceOptions(t, nc, "ec2.ModifyStoppedInstanceMaintenanceOptions")
+
+	out, err := ModifyInstanceMaintenanceOptions(&ec2.ModifyInstanceMaintenanceOptionsInput{
+		InstanceId:   aws.String("i-stopped"),
+		AutoRecovery: aws.String(ec2.InstanceAutoRecoveryStateDefault),
+	}, nc, "123456789012")
+	require.NoError(t, err)
+	assert.Equal(t, "i-stopped", *out.InstanceId)
+}
+
+func TestModifyInstanceMaintenanceOptions_NotFound(t *testing.T) {
+	_, nc := startTestNATSServer(t)
+	_, err := nc.Subscribe("ec2.ModifyStoppedInstanceMaintenanceOptions", func(msg *nats.Msg) {
+		msg.Respond(utils.GenerateErrorPayload(awserrors.ErrorInvalidInstanceIDNotFound))
+	})
+	require.NoError(t, err)
+
+	_, err = ModifyInstanceMaintenanceOptions(&ec2.ModifyInstanceMaintenanceOptionsInput{
+		InstanceId:   aws.String("i-missing"),
+		AutoRecovery: aws.String(ec2.InstanceAutoRecoveryStateDisabled),
+	}, nc, "123456789012")
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorInvalidInstanceIDNotFound, err.Error())
+}
@@ -0,0 +1,95 @@
+package gateway_ec2_instance
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+)
+
+// ValidateModifyInstanceMetadataOptionsInput validates the input for
+// ModifyInstanceMetadataOptions. HttpEndpoint, HttpTokens and
+// HttpPutResponseHopLimit are supported, and at least one must be given.
+func ValidateModifyInstanceMetadataOptionsInput(input *ec2.ModifyInstanceMetadataOptionsInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if input.InstanceId == nil || *input.InstanceId == "" {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	if !strings.HasPrefix(*input.InstanceId, "i-") {
+		return errors.New(awserrors.ErrorInvalidInstanceIDMalformed)
+	}
+	if input.HttpEndpoint == nil && input.HttpTokens == nil && input.HttpPutResponseHopLimit == nil {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	return validateMetadataOptions(input.HttpEndpoint, input.HttpTokens, input.HttpPutResponseHopLimit)
+}
+
+// maxMetadataHopLimit is the largest PUT response hop limit EC2 accepts.
+const maxMetadataHopLimit = 64
+
+// validateMetadataOptions checks the metadata options given to RunInstances
+// or ModifyInstanceMetadataOptions. Nil options are not being set.
+func validateMetadataOptions(endpoint, tokens *string, hopLimit *int64) error {
+	if endpoint != nil {
+		switch *endpoint {
+		case ec2.InstanceMetadataEndpointStateEnabled, ec2.InstanceMetadataEndpointStateDisabled:
+		default:
+			return errors.New(awserrors.ErrorInvalidParameterValue)
+		}
+	}
+	if tokens != nil {
+		switch *tokens {
+		case ec2.HttpTokensStateOptional, ec2.HttpTokensStateRequired:
+		default:
+			return errors.New(awserrors.ErrorInvalidParameterValue)
+		}
+	}
+	if hopLimit != nil && (*hopLimit < 1 || *hopLimit > maxMetadataHopLimit) {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	return nil
+}
+
+// ModifyInstanceMetadataOptions enables or disables an instance's metadata
+// endpoint. A running instance is updated by the node hosting it, which
+// blocks or unblocks the endpoint at its host firewall; otherwise the
+// change is made to the stopped instance in shared KV.
+func ModifyInstanceMetadataOptions(input *ec2.ModifyInstanceMetadataOptionsInput, natsConn *nats.Conn, accountID string) (*ec2.ModifyInstanceMetadataOptionsOutput, error) {
+	if err := ValidateModifyInstanceMetadataOptionsInput(input); err != nil {
+		return nil, err
+	}
+
+	instanceID := *input.InstanceId
+	command := types.EC2InstanceCommand{
+		ID:         instanceID,
+		Attributes: types.EC2CommandAttributes{ModifyMetadataOptions: true},
+		MetadataOptions: &types.MetadataOptionsData{
+			HttpEndpoint:            aws.StringValue(input.HttpEndpoint),
+			HttpTokens:              aws.StringValue(input.HttpTokens),
+			HttpPutResponseHopLimit: aws.Int64Value(input.HttpPutResponseHopLimit),
+		},
+	}
+
+	output, err := utils.NATSRequest[ec2.ModifyInstanceMetadataOptionsOutput](natsConn, subjects.InstanceCmd(instanceID), command, 10*time.Second, accountID)
+	if err != nil && errors.Is(err, nats.ErrNoResponders) {
+		// No node runs the instance, so it is stopped if it exists.
+		output, err = utils.NATSRequest[ec2.ModifyInstanceMetadataOptionsOutput](natsConn, "ec2.ModifyStoppedInstanceMetadataOptions", command, 10*time.Second, accountID)
+	}
+	if err != nil {
+		slog.Error("ModifyInstanceMetadataOptions: Failed", "instance_id", instanceID, "err", err)
+		return nil, err
+	}
+
+	slog.Info("ModifyInstanceMetadataOptions: Completed", "instance_id", instanceID, "http_endpoint", aws.StringValue(input.HttpEndpoint), "http_tokens", aws.StringValue(input.HttpTokens))
+	return output, nil
+}
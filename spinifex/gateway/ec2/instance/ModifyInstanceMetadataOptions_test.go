@@ -0,0 +1,103 @@
+package gateway_ec2_instance
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func respondMetadataOptions(t *testing.T, nc *nats.Conn, topic string) {
+	t.Helper()
+	_, err := nc.Subscribe(topic, func(msg *nats.Msg) {
+		var cmd types.EC2InstanceCommand
+		require.NoError(t, json.Unmarshal(msg.Data, &cmd))
+		data, _ := json.Marshal(&ec2.ModifyInstanceMetadataOptionsOutput{
+			InstanceId: aws.String(cmd.ID),
+			InstanceMetadataOptions: &ec2.InstanceMetadataOptionsResponse{
+				HttpEndpoint: aws.String(cmd.MetadataOptions.HttpEndpoint),
+			},
+		})
+		msg.Respond(data)
+	})
+	require.NoError(t, err)
+}
+
+func TestValidateModifyInstanceMetadataOptionsInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		input *ec2.ModifyInstanceMetadataOptionsInput
+		want  string
+	}{
+		{"nil input", nil, awserrors.ErrorInvalidParameterValue},
+		{"missing instance", &ec2.ModifyInstanceMetadataOptionsInput{HttpEndpoint: aws.String("disabled")}, awserrors.ErrorMissingParameter},
+		{"malformed instance", &ec2.ModifyInstanceMetadataOptionsInput{InstanceId: aws.String("vol-1"), HttpEndpoint: aws.String("disabled")}, awserrors.ErrorInvalidInstanceIDMalformed},
+		{"no options", &ec2.ModifyInstanceMetadataOptionsInput{InstanceId: aws.String("i-1")}, awserrors.ErrorMissingParameter},
+		{"bad endpoint", &ec2.ModifyInstanceMetadataOptionsInput{InstanceId: aws.String("i-1"), HttpEndpoint: aws.String("off")}, awserrors.ErrorInvalidParameterValue},
+		{"bad tokens", &ec2.ModifyInstanceMetadataOptionsInput{InstanceId: aws.String("i-1"), HttpTokens: aws.String("always")}, awserrors.ErrorInvalidParameterValue},
+		{"hop limit zero", &ec2.ModifyInstanceMetadataOptionsInput{InstanceId: aws.String("i-1"), HttpPutResponseHopLimit: aws.Int64(0)}, awserrors.ErrorInvalidParameterValue},
+		{"hop limit too high", &ec2.ModifyInstanceMetadataOptionsInput{InstanceId: aws.String("i-1"), HttpPutResponseHopLimit: aws.Int64(65)}, awserrors.ErrorInvalidParameterValue},
+		{"valid", &ec2.ModifyInstanceMetadataOptionsInput{InstanceId: aws.String("i-1"), HttpEndpoint: aws.String("disabled")}, ""},
+		{"valid tokens only", &ec2.ModifyInstanceMetadataOptionsInput{InstanceId: aws.String("i-1"), HttpTokens: aws.String("required"), HttpPutResponseHopLimit: aws.Int64(2)}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateModifyInstanceMetadataOptionsInput(tt.input)
+			if tt.want == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Equal(t, tt.want, err.Error())
+		})
+	}
+}
+
+func TestModifyInstanceMetadataOptions_RunningInstance(t *testing.T) {
+	_, nc := startTestNATSServer(t)
+	instanceID := "i-0123456789abcdef0"
+	respondMetadataOptions(t, nc, subjects.InstanceCmd(instanceID))
+
+	out, err := ModifyInstanceMetadataOptions(&ec2.ModifyInstanceMetadataOptionsInput{
+		InstanceId:   aws.String(instanceID),
+		HttpEndpoint: aws.String(ec2.InstanceMetadataEndpointStateDisabled),
+	}, nc, "123456789012")
+	require.NoError(t, err)
+	assert.Equal(t, instanceID, *out.InstanceId)
+	assert.Equal(t, ec2.InstanceMetadataEndpointStateDisabled, *out.InstanceMetadataOptions.HttpEndpoint)
+}
+
+func TestModifyInstanceMetadataOptions_StoppedInstance(t *testing.T) {
+	_, nc := startTestNATSServer(t)
+	respondMetadataOptions(t, nc, "ec2.ModifyStoppedInstanceMetadataOptions")
+
+	out, err := ModifyInstanceMetadataOptions(&ec2.ModifyInstanceMetadataOptionsInput{
+		InstanceId:   aws.String("i-stopped"),
+		HttpEndpoint: aws.String(ec2.InstanceMetadataEndpointStateEnabled),
+	}, nc, "123456789012")
+	require.NoError(t, err)
+	assert.Equal(t, "i-stopped", *out.InstanceId)
+}
+
+func TestModifyInstanceMetadataOptions_NotFound(t *testing.T) {
+	_, nc := startTestNATSServer(t)
+	_, err := nc.Subscribe("ec2.ModifyStoppedInstanceMetadataOptions", func(msg *nats.Msg) {
+		msg.Respond(utils.GenerateErrorPayload(awserrors.ErrorInvalidInstanceIDNotFound))
+	})
+	require.NoError(t, err)
+
+	_, err = ModifyInstanceMetadataOptions(&ec2.ModifyInstanceMetadataOptionsInput{
+		InstanceId:   aws.String("i-missing"),
+		HttpEndpoint: aws.String(ec2.InstanceMetadataEndpointStateDisabled),
+	}, nc, "123456789012")
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorInvalidInstanceIDNotFound, err.Error())
+}
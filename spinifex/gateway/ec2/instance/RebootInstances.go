@@ -9,6 +9,7 @@ import (
 
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
 	"github.com/mulgadc/spinifex/spinifex/types"
 	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/nats-io/nats.go"
@@ -26,7 +27,8 @@ func ValidateRebootInstancesInput(input *ec2.RebootInstancesInput) error {
 }
 
 // RebootInstances sends reboot commands to specified instances via NATS.
-// Unlike stop+start, reboot keeps the instance running and sends a QMP system_reset.
+// Unlike stop+start, reboot keeps the instance running: the node asks the guest
+// to shut down and resets it once it has, or after a grace period.
 // Returns an empty response on success (AWS returns no state-change data).
 func RebootInstances(input *ec2.RebootInstancesInput, natsConn *nats.Conn, accountID string) (*ec2.RebootInstancesOutput, error) {
 	if err := ValidateRebootInstancesInput(input); err != nil {
@@ -54,8 +56,8 @@ func RebootInstances(input *ec2.RebootInstancesInput, natsConn *nats.Conn, accou
 			continue
 		}
 
-		subject := fmt.Sprintf("ec2.cmd.%s", instanceID)
-		reqMsg := nats.NewMsg(subject)
+		subject := subjects.InstanceCmd(instanceID)
+		reqMsg := nats.NewMsg(utils.Subject(subject))
 		reqMsg.Data = jsonData
 		reqMsg.Header.Set(utils.AccountIDHeader, accountID)
 		msg, err := natsConn.RequestMsg(reqMsg, 5*time.Second)
@@ -80,9 +82,9 @@ func RebootInstances(input *ec2.RebootInstancesInput, natsConn *nats.Conn, accou
 		}
 
 		// Check if the daemon returned an error response (e.g. ownership check failure)
-		if responseError, parseErr := utils.ValidateErrorPayload(msg.Data); parseErr != nil {
-			slog.Error("RebootInstances: Daemon returned error", "instance_id", instanceID, "code", *responseError.Code)
-			return nil, errors.New(*responseError.Code)
+		if replyErr := utils.DecodeReply(msg).Err; replyErr != nil {
+			slog.Error("RebootInstances: Daemon returned error", "instance_id", instanceID, "code", replyErr.Code)
+			return nil, replyErr
 		}
 
 		slog.Info("RebootInstances: Command sent successfully", "instance_id", instanceID)
@@ -7,6 +7,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
 	"github.com/mulgadc/spinifex/spinifex/types"
 	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/nats-io/nats.go"
@@ -19,7 +20,7 @@ func TestRebootInstances_Success(t *testing.T) {
 
 	instanceID := "i-0123456789abcdef0"
 
-	nc.Subscribe("ec2.cmd."+instanceID, func(msg *nats.Msg) {
+	nc.Subscribe(subjects.InstanceCmd(instanceID), func(msg *nats.Msg) {
 		var cmd types.EC2InstanceCommand
 		err := json.Unmarshal(msg.Data, &cmd)
 		require.NoError(t, err)
@@ -46,7 +47,7 @@ func TestRebootInstances_MultipleInstances(t *testing.T) {
 	ids := []string{"i-001", "i-002"}
 
 	for _, id := range ids {
-		nc.Subscribe("ec2.cmd."+id, func(msg *nats.Msg) {
+		nc.Subscribe(subjects.InstanceCmd(id), func(msg *nats.Msg) {
 			msg.Respond([]byte(`{}`))
 		})
 	}
@@ -116,7 +117,7 @@ func TestRebootInstances_DaemonError(t *testing.T) {
 
 	instanceID := "i-error"
 
-	nc.Subscribe("ec2.cmd."+instanceID, func(msg *nats.Msg) {
+	nc.Subscribe(subjects.InstanceCmd(instanceID), func(msg *nats.Msg) {
 		msg.Respond(utils.GenerateErrorPayload(awserrors.ErrorIncorrectInstanceState))
 	})
 
@@ -1,6 +1,7 @@
 package gateway_ec2_instance
 
 import (
+	"context"
 	"errors"
 	"strings"
 	"time"
@@ -8,7 +9,10 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_ec2_instance "github.com/mulgadc/spinifex/spinifex/handlers/ec2/instance"
+	handlers_ec2_launchtemplate "github.com/mulgadc/spinifex/spinifex/handlers/ec2/launchtemplate"
 	handlers_ec2_placementgroup "github.com/mulgadc/spinifex/spinifex/handlers/ec2/placementgroup"
+	"github.com/mulgadc/spinifex/spinifex/instancetypes"
 	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/nats-io/nats.go"
 )
@@ -17,56 +21,137 @@ type RunInstancesResponse struct {
 	Reservation *ec2.Reservation `locationName:"RunInstancesResponse"`
 }
 
-func ValidateRunInstancesInput(input *ec2.RunInstancesInput) (err error) {
+// ValidateRunInstancesInput validates the input parameters. Checks run in
+// a fixed order so an input with several problems always reports the same
+// one: missing required parameters first (MinCount, MaxCount, ImageId,
+// InstanceType, KeyName), then malformed IDs, then invalid values, and
+// finally MinCount against MaxCount.
+func ValidateRunInstancesInput(input *ec2.RunInstancesInput) error {
 	if input == nil {
 		return errors.New(awserrors.ErrorMissingParameter)
 	}
 
-	if input.MinCount == nil {
+	// Required parameters
+	if input.MinCount == nil || input.MaxCount == nil {
 		return errors.New(awserrors.ErrorMissingParameter)
 	}
-
-	if *input.MinCount == 0 {
-		return errors.New(awserrors.ErrorInvalidParameterValue)
+	if input.ImageId == nil || *input.ImageId == "" {
+		return errors.New(awserrors.ErrorMissingParameter)
 	}
-
-	if input.MaxCount == nil {
+	if input.InstanceType == nil || *input.InstanceType == "" {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	if input.KeyName == nil || *input.KeyName == "" {
 		return errors.New(awserrors.ErrorMissingParameter)
 	}
 
-	if *input.MaxCount == 0 {
-		return errors.New(awserrors.ErrorInvalidParameterValue)
+	// ID formats
+	if !strings.HasPrefix(*input.ImageId, "ami-") {
+		return errors.New(awserrors.ErrorInvalidAMIIDMalformed)
 	}
 
-	// Additional validation from EC2 spec
-	if *input.MinCount > *input.MaxCount {
+	// Values
+	if *input.MinCount == 0 || *input.MaxCount == 0 {
 		return errors.New(awserrors.ErrorInvalidParameterValue)
 	}
+	if input.CreditSpecification != nil && !instancetypes.ValidCPUCredits(aws.StringValue(input.CreditSpecification.CpuCredits)) {
+		return errors.New(awserrors.ErrorInvalidCpuCredits)
+	}
+	if opts := input.MetadataOptions; opts != nil {
+		if err := validateMetadataOptions(opts.HttpEndpoint, opts.HttpTokens, opts.HttpPutResponseHopLimit); err != nil {
+			return err
+		}
+	}
+	if input.MaintenanceOptions != nil && input.MaintenanceOptions.AutoRecovery != nil {
+		switch *input.MaintenanceOptions.AutoRecovery {
+		case ec2.InstanceAutoRecoveryStateDefault, ec2.InstanceAutoRecoveryStateDisabled:
+		default:
+			return errors.New(awserrors.ErrorInvalidParameterValue)
+		}
+	}
 
-	if input.ImageId == nil || *input.ImageId == "" {
-		return errors.New(awserrors.ErrorMissingParameter)
+	if input.UserData != nil && *input.UserData != "" {
+		if err := handlers_ec2_instance.ValidateUserData(*input.UserData); err != nil {
+			return err
+		}
+	}
+	if input.InstanceMarketOptions != nil {
+		if err := validateMarketOptions(input.InstanceMarketOptions); err != nil {
+			return err
+		}
 	}
 
-	if input.InstanceType == nil || *input.InstanceType == "" {
-		return errors.New(awserrors.ErrorMissingParameter)
+	// Root volumes are zero-copy clones of the AMI's unencrypted snapshot,
+	// so they can't be encrypted at launch. Encrypted data volumes are
+	// created with CreateVolume and attached.
+	for _, bdm := range input.BlockDeviceMappings {
+		if bdm == nil || bdm.Ebs == nil {
+			continue
+		}
+		if aws.StringValue(bdm.Ebs.KmsKeyId) != "" && !aws.BoolValue(bdm.Ebs.Encrypted) {
+			return errors.New(awserrors.ErrorInvalidParameterDependency)
+		}
+		if aws.BoolValue(bdm.Ebs.Encrypted) {
+			return errors.New(awserrors.ErrorInvalidParameterCombination)
+		}
 	}
 
-	if input.KeyName == nil || *input.KeyName == "" {
-		return errors.New(awserrors.ErrorMissingParameter)
+	// Cross-field
+	if *input.MinCount > *input.MaxCount {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	// Interruptible instances are terminated without asking, so termination
+	// protection can't be honoured.
+	if handlers_ec2_instance.Interruptible(input) && aws.BoolValue(input.DisableApiTermination) {
+		return errors.New(awserrors.ErrorInvalidParameterCombination)
 	}
 
-	if !strings.HasPrefix(*input.ImageId, "ami-") {
-		return errors.New(awserrors.ErrorInvalidAMIIDMalformed)
+	return nil
+}
+
+// validateMarketOptions accepts spot market options in the one form the
+// cluster supports: one-time requests that terminate on interruption.
+func validateMarketOptions(opts *ec2.InstanceMarketOptionsRequest) error {
+	if aws.StringValue(opts.MarketType) != ec2.MarketTypeSpot {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	spot := opts.SpotOptions
+	if spot == nil {
+		return nil
 	}
+	if t := aws.StringValue(spot.SpotInstanceType); t != "" && t != ec2.SpotInstanceTypeOneTime {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if b := aws.StringValue(spot.InstanceInterruptionBehavior); b != "" && b != ec2.InstanceInterruptionBehaviorTerminate {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if spot.BlockDurationMinutes != nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	return nil
+}
 
-	return err
+// ValidateRunInstancesRequest checks a request as RunInstances does before
+// launching anything, and is all a DryRun request runs. Parameters not given
+// on the request are filled from its launch template first, so validation
+// and capacity routing see the merged request.
+func ValidateRunInstancesRequest(input *ec2.RunInstancesInput, natsConn *nats.Conn, accountID string) error {
+	if input != nil && input.LaunchTemplate != nil {
+		if err := applyLaunchTemplate(input, natsConn, accountID); err != nil {
+			return err
+		}
+	}
+	return ValidateRunInstancesInput(input)
 }
 
 func RunInstances(input *ec2.RunInstancesInput, natsConn *nats.Conn, accountID string) (reservation ec2.Reservation, err error) {
-	// Validate input
-	err = ValidateRunInstancesInput(input)
+	return RunInstancesContext(context.Background(), input, natsConn, accountID)
+}
 
-	if err != nil {
+// RunInstancesContext is RunInstances with the caller's context, whose trace
+// the launch requests to the daemons carry.
+func RunInstancesContext(ctx context.Context, input *ec2.RunInstancesInput, natsConn *nats.Conn, accountID string) (reservation ec2.Reservation, err error) {
+	if err = ValidateRunInstancesRequest(input, natsConn, accountID); err != nil {
 		return reservation, err
 	}
 
@@ -81,13 +166,13 @@ func RunInstances(input *ec2.RunInstancesInput, natsConn *nats.Conn, accountID s
 
 		switch strategy {
 		case ec2.PlacementStrategySpread:
-			reservationPtr, err := distributeInstancesSpread(input, natsConn, accountID, groupName)
+			reservationPtr, err := distributeInstancesSpread(ctx, input, natsConn, accountID, groupName)
 			if err != nil {
 				return reservation, err
 			}
 			return *reservationPtr, nil
 		case ec2.PlacementStrategyCluster:
-			reservationPtr, err := distributeInstancesCluster(input, natsConn, accountID, groupName)
+			reservationPtr, err := distributeInstancesCluster(ctx, input, natsConn, accountID, groupName)
 			if err != nil {
 				return reservation, err
 			}
@@ -101,7 +186,7 @@ func RunInstances(input *ec2.RunInstancesInput, natsConn *nats.Conn, accountID s
 	// instances across nodes with best-effort spread. This applies to both
 	// single-instance (count=1) and batch (count>1) launches, ensuring fair
 	// distribution across the cluster.
-	reservationPtr, err := distributeInstances(input, natsConn, accountID)
+	reservationPtr, err := distributeInstances(ctx, input, natsConn, accountID)
 	if err != nil {
 		// When no nodes have capacity, distinguish between "unknown instance type"
 		// and "all nodes full" by checking DescribeInstanceTypes.
@@ -142,6 +227,12 @@ func lookupPlacementGroupStrategy(natsConn *nats.Conn, accountID, groupName stri
 	return aws.StringValue(pg.Strategy), nil
 }
 
+// applyLaunchTemplate merges the requested launch template version into input.
+func applyLaunchTemplate(input *ec2.RunInstancesInput, natsConn *nats.Conn, accountID string) error {
+	ltSvc := handlers_ec2_launchtemplate.NewNATSLaunchTemplateService(natsConn)
+	return handlers_ec2_launchtemplate.ResolveRunInstances(ltSvc, input, accountID)
+}
+
 // isKnownInstanceType checks whether any daemon recognizes the given instance type.
 func isKnownInstanceType(natsConn *nats.Conn, instanceType string) bool {
 	result, err := utils.NATSRequest[ec2.DescribeInstanceTypesOutput](
@@ -1,13 +1,17 @@
 package gateway_ec2_instance
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/nats-io/nats.go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var defaults = ec2.RunInstancesInput{
@@ -242,3 +246,314 @@ func TestParseRunInstances(t *testing.T) {
 
 	// Additional test
 }
+
+func TestValidateRunInstancesInput_Precedence(t *testing.T) {
+	tests := []struct {
+		name  string
+		input *ec2.RunInstancesInput
+		want  string
+	}{
+		{
+			name: "MissingBeforeInvalidCount",
+			input: &ec2.RunInstancesInput{
+				ImageId:      defaults.ImageId,
+				InstanceType: defaults.InstanceType,
+				MinCount:     aws.Int64(0),
+				MaxCount:     aws.Int64(1),
+			},
+			want: awserrors.ErrorMissingParameter,
+		},
+		{
+			name: "MissingBeforeMalformedImage",
+			input: &ec2.RunInstancesInput{
+				ImageId:  aws.String("img-123"),
+				MinCount: aws.Int64(1),
+				MaxCount: aws.Int64(1),
+				KeyName:  defaults.KeyName,
+			},
+			want: awserrors.ErrorMissingParameter,
+		},
+		{
+			name: "MalformedImageBeforeInvalidValues",
+			input: &ec2.RunInstancesInput{
+				ImageId:             aws.String("img-123"),
+				InstanceType:        defaults.InstanceType,
+				MinCount:            aws.Int64(0),
+				MaxCount:            aws.Int64(1),
+				KeyName:             defaults.KeyName,
+				CreditSpecification: &ec2.CreditSpecificationRequest{CpuCredits: aws.String("turbo")},
+			},
+			want: awserrors.ErrorInvalidAMIIDMalformed,
+		},
+		{
+			name: "InvalidCountBeforeCpuCredits",
+			input: &ec2.RunInstancesInput{
+				ImageId:             defaults.ImageId,
+				InstanceType:        defaults.InstanceType,
+				MinCount:            aws.Int64(0),
+				MaxCount:            aws.Int64(1),
+				KeyName:             defaults.KeyName,
+				CreditSpecification: &ec2.CreditSpecificationRequest{CpuCredits: aws.String("turbo")},
+			},
+			want: awserrors.ErrorInvalidParameterValue,
+		},
+		{
+			name: "CpuCreditsBeforeCountOrder",
+			input: &ec2.RunInstancesInput{
+				ImageId:             defaults.ImageId,
+				InstanceType:        defaults.InstanceType,
+				MinCount:            aws.Int64(5),
+				MaxCount:            aws.Int64(2),
+				KeyName:             defaults.KeyName,
+				CreditSpecification: &ec2.CreditSpecificationRequest{CpuCredits: aws.String("turbo")},
+			},
+			want: awserrors.ErrorInvalidCpuCredits,
+		},
+		{
+			name: "InvalidAutoRecovery",
+			input: &ec2.RunInstancesInput{
+				ImageId:            defaults.ImageId,
+				InstanceType:       defaults.InstanceType,
+				MinCount:           aws.Int64(1),
+				MaxCount:           aws.Int64(1),
+				KeyName:            defaults.KeyName,
+				MaintenanceOptions: &ec2.InstanceMaintenanceOptionsRequest{AutoRecovery: aws.String("always")},
+			},
+			want: awserrors.ErrorInvalidParameterValue,
+		},
+		{
+			name: "InvalidHttpTokens",
+			input: &ec2.RunInstancesInput{
+				ImageId:         defaults.ImageId,
+				InstanceType:    defaults.InstanceType,
+				MinCount:        aws.Int64(1),
+				MaxCount:        aws.Int64(1),
+				KeyName:         defaults.KeyName,
+				MetadataOptions: &ec2.InstanceMetadataOptionsRequest{HttpTokens: aws.String("always")},
+			},
+			want: awserrors.ErrorInvalidParameterValue,
+		},
+		{
+			name: "InvalidHopLimit",
+			input: &ec2.RunInstancesInput{
+				ImageId:         defaults.ImageId,
+				InstanceType:    defaults.InstanceType,
+				MinCount:        aws.Int64(1),
+				MaxCount:        aws.Int64(1),
+				KeyName:         defaults.KeyName,
+				MetadataOptions: &ec2.InstanceMetadataOptionsRequest{HttpPutResponseHopLimit: aws.Int64(65)},
+			},
+			want: awserrors.ErrorInvalidParameterValue,
+		},
+		{
+			name: "EncryptedRootVolume",
+			input: &ec2.RunInstancesInput{
+				ImageId:      defaults.ImageId,
+				InstanceType: defaults.InstanceType,
+				MinCount:     aws.Int64(1),
+				MaxCount:     aws.Int64(1),
+				KeyName:      defaults.KeyName,
+				BlockDeviceMappings: []*ec2.BlockDeviceMapping{
+					{DeviceName: aws.String("/dev/sda1"), Ebs: &ec2.EbsBlockDevice{Encrypted: aws.Bool(true)}},
+				},
+			},
+			want: awserrors.ErrorInvalidParameterCombination,
+		},
+		{
+			name: "KmsKeyWithoutEncrypted",
+			input: &ec2.RunInstancesInput{
+				ImageId:      defaults.ImageId,
+				InstanceType: defaults.InstanceType,
+				MinCount:     aws.Int64(1),
+				MaxCount:     aws.Int64(1),
+				KeyName:      defaults.KeyName,
+				BlockDeviceMappings: []*ec2.BlockDeviceMapping{
+					{DeviceName: aws.String("/dev/sda1"), Ebs: &ec2.EbsBlockDevice{KmsKeyId: aws.String("alias/aws/ebs")}},
+				},
+			},
+			want: awserrors.ErrorInvalidParameterDependency,
+		},
+		{
+			name: "UserDataNotBase64",
+			input: &ec2.RunInstancesInput{
+				ImageId:      defaults.ImageId,
+				InstanceType: defaults.InstanceType,
+				MinCount:     aws.Int64(1),
+				MaxCount:     aws.Int64(1),
+				KeyName:      defaults.KeyName,
+				UserData:     aws.String("#!/bin/sh"),
+			},
+			want: awserrors.ErrorInvalidParameterValue,
+		},
+		{
+			name: "UserDataTooLarge",
+			input: &ec2.RunInstancesInput{
+				ImageId:      defaults.ImageId,
+				InstanceType: defaults.InstanceType,
+				MinCount:     aws.Int64(1),
+				MaxCount:     aws.Int64(1),
+				KeyName:      defaults.KeyName,
+				UserData:     aws.String(base64.StdEncoding.EncodeToString(make([]byte, 16*1024+1))),
+			},
+			want: awserrors.ErrorInvalidParameterValue,
+		},
+		{
+			name: "UnsupportedMarketType",
+			input: &ec2.RunInstancesInput{
+				ImageId:               defaults.ImageId,
+				InstanceType:          defaults.InstanceType,
+				MinCount:              aws.Int64(1),
+				MaxCount:              aws.Int64(1),
+				KeyName:               defaults.KeyName,
+				InstanceMarketOptions: &ec2.InstanceMarketOptionsRequest{MarketType: aws.String("capacity-block")},
+			},
+			want: awserrors.ErrorInvalidParameterValue,
+		},
+		{
+			name: "PersistentSpotRequest",
+			input: &ec2.RunInstancesInput{
+				ImageId:      defaults.ImageId,
+				InstanceType: defaults.InstanceType,
+				MinCount:     aws.Int64(1),
+				MaxCount:     aws.Int64(1),
+				KeyName:      defaults.KeyName,
+				InstanceMarketOptions: &ec2.InstanceMarketOptionsRequest{
+					MarketType:  aws.String(ec2.MarketTypeSpot),
+					SpotOptions: &ec2.SpotMarketOptions{SpotInstanceType: aws.String(ec2.SpotInstanceTypePersistent)},
+				},
+			},
+			want: awserrors.ErrorInvalidParameterValue,
+		},
+		{
+			name: "SpotStopOnInterruption",
+			input: &ec2.RunInstancesInput{
+				ImageId:      defaults.ImageId,
+				InstanceType: defaults.InstanceType,
+				MinCount:     aws.Int64(1),
+				MaxCount:     aws.Int64(1),
+				KeyName:      defaults.KeyName,
+				InstanceMarketOptions: &ec2.InstanceMarketOptionsRequest{
+					MarketType:  aws.String(ec2.MarketTypeSpot),
+					SpotOptions: &ec2.SpotMarketOptions{InstanceInterruptionBehavior: aws.String(ec2.InstanceInterruptionBehaviorStop)},
+				},
+			},
+			want: awserrors.ErrorInvalidParameterValue,
+		},
+		{
+			name: "SpotBlockDuration",
+			input: &ec2.RunInstancesInput{
+				ImageId:      defaults.ImageId,
+				InstanceType: defaults.InstanceType,
+				MinCount:     aws.Int64(1),
+				MaxCount:     aws.Int64(1),
+				KeyName:      defaults.KeyName,
+				InstanceMarketOptions: &ec2.InstanceMarketOptionsRequest{
+					MarketType:  aws.String(ec2.MarketTypeSpot),
+					SpotOptions: &ec2.SpotMarketOptions{BlockDurationMinutes: aws.Int64(60)},
+				},
+			},
+			want: awserrors.ErrorInvalidParameterValue,
+		},
+		{
+			name: "SpotWithTerminationProtection",
+			input: &ec2.RunInstancesInput{
+				ImageId:               defaults.ImageId,
+				InstanceType:          defaults.InstanceType,
+				MinCount:              aws.Int64(1),
+				MaxCount:              aws.Int64(1),
+				KeyName:               defaults.KeyName,
+				InstanceMarketOptions: &ec2.InstanceMarketOptionsRequest{MarketType: aws.String(ec2.MarketTypeSpot)},
+				DisableApiTermination: aws.Bool(true),
+			},
+			want: awserrors.ErrorInvalidParameterCombination,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The same input must always report the same error.
+			for range 20 {
+				err := ValidateRunInstancesInput(tt.input)
+				require.Error(t, err)
+				assert.Equal(t, tt.want, err.Error())
+			}
+		})
+	}
+}
+
+func TestValidateRunInstancesInput_Spot(t *testing.T) {
+	input := &ec2.RunInstancesInput{
+		ImageId:      defaults.ImageId,
+		InstanceType: defaults.InstanceType,
+		MinCount:     aws.Int64(1),
+		MaxCount:     aws.Int64(1),
+		KeyName:      defaults.KeyName,
+		InstanceMarketOptions: &ec2.InstanceMarketOptionsRequest{
+			MarketType: aws.String(ec2.MarketTypeSpot),
+			SpotOptions: &ec2.SpotMarketOptions{
+				SpotInstanceType:             aws.String(ec2.SpotInstanceTypeOneTime),
+				InstanceInterruptionBehavior: aws.String(ec2.InstanceInterruptionBehaviorTerminate),
+			},
+		},
+	}
+	require.NoError(t, ValidateRunInstancesInput(input))
+
+	input.InstanceMarketOptions.SpotOptions = nil
+	require.NoError(t, ValidateRunInstancesInput(input))
+}
+
+func TestApplyLaunchTemplate(t *testing.T) {
+	_, nc := startTestNATSServer(t)
+
+	var requested ec2.DescribeLaunchTemplateVersionsInput
+	sub, err := nc.Subscribe("ec2.DescribeLaunchTemplateVersions", func(msg *nats.Msg) {
+		_ = json.Unmarshal(msg.Data, &requested)
+		out := ec2.DescribeLaunchTemplateVersionsOutput{
+			LaunchTemplateVersions: []*ec2.LaunchTemplateVersion{{
+				LaunchTemplateId: aws.String("lt-0123456789abcdef0"),
+				VersionNumber:    aws.Int64(2),
+				LaunchTemplateData: &ec2.ResponseLaunchTemplateData{
+					ImageId:          aws.String("ami-0abcdef1234567890"),
+					InstanceType:     aws.String("t3.micro"),
+					KeyName:          aws.String("template-key"),
+					SecurityGroupIds: []*string{aws.String("sg-0123456789abcdef0")},
+				},
+			}},
+		}
+		data, _ := json.Marshal(out)
+		_ = msg.Respond(data)
+	})
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	input := &ec2.RunInstancesInput{
+		MinCount: aws.Int64(1),
+		MaxCount: aws.Int64(1),
+		KeyName:  aws.String("request-key"),
+		LaunchTemplate: &ec2.LaunchTemplateSpecification{
+			LaunchTemplateId: aws.String("lt-0123456789abcdef0"),
+		},
+	}
+	require.NoError(t, applyLaunchTemplate(input, nc, "123456789012"))
+
+	// No version requested resolves the template's default.
+	require.Len(t, requested.Versions, 1)
+	assert.Equal(t, "$Default", aws.StringValue(requested.Versions[0]))
+
+	assert.Nil(t, input.LaunchTemplate)
+	assert.Equal(t, "ami-0abcdef1234567890", aws.StringValue(input.ImageId))
+	assert.Equal(t, "t3.micro", aws.StringValue(input.InstanceType))
+	assert.Equal(t, "request-key", aws.StringValue(input.KeyName), "request parameters override the template")
+	require.Len(t, input.SecurityGroupIds, 1)
+	assert.Equal(t, int64(1), aws.Int64Value(input.MaxCount))
+}
+
+func TestApplyLaunchTemplate_InvalidSpec(t *testing.T) {
+	err := applyLaunchTemplate(&ec2.RunInstancesInput{LaunchTemplate: &ec2.LaunchTemplateSpecification{}}, nil, "123456789012")
+	assert.EqualError(t, err, awserrors.ErrorMissingParameter)
+
+	err = applyLaunchTemplate(&ec2.RunInstancesInput{LaunchTemplate: &ec2.LaunchTemplateSpecification{
+		LaunchTemplateId: aws.String("web-servers"),
+	}}, nil, "123456789012")
+	assert.EqualError(t, err, awserrors.ErrorInvalidLaunchTemplateIdMalformed)
+}
@@ -0,0 +1,46 @@
+package gateway_ec2_instance
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_ec2_instanceevent "github.com/mulgadc/spinifex/spinifex/handlers/ec2/instanceevent"
+	"github.com/nats-io/nats.go"
+)
+
+// ValidateScheduleInstanceEventInput validates the input parameters
+func ValidateScheduleInstanceEventInput(input *handlers_ec2_instanceevent.ScheduleInstanceEventInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if input.InstanceID == "" || input.Code == "" || input.NotBefore.IsZero() {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	if !strings.HasPrefix(input.InstanceID, "i-") {
+		return errors.New(awserrors.ErrorInvalidInstanceIDMalformed)
+	}
+	return nil
+}
+
+// ScheduleInstanceEvent posts a maintenance event (reboot or stop) against a
+// running instance. The node running the instance records it for the owner;
+// if no node answers the instance is not running anywhere.
+func ScheduleInstanceEvent(input *handlers_ec2_instanceevent.ScheduleInstanceEventInput, natsConn *nats.Conn, accountID string) (*ec2.InstanceStatusEvent, error) {
+	if err := ValidateScheduleInstanceEventInput(input); err != nil {
+		return nil, err
+	}
+
+	svc := handlers_ec2_instanceevent.NewNATSInstanceEventService(natsConn)
+	event, err := svc.ScheduleInstanceEvent(input, accountID)
+	if err != nil {
+		if errors.Is(err, nats.ErrTimeout) || errors.Is(err, nats.ErrNoResponders) {
+			slog.Info("ScheduleInstanceEvent: no node is running the instance", "instanceId", input.InstanceID)
+			return nil, errors.New(awserrors.ErrorInvalidInstanceIDNotFound)
+		}
+		return nil, err
+	}
+	return event, nil
+}
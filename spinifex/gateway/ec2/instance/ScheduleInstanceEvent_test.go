@@ -0,0 +1,24 @@
+package gateway_ec2_instance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_ec2_instanceevent "github.com/mulgadc/spinifex/spinifex/handlers/ec2/instanceevent"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateScheduleInstanceEventInput(t *testing.T) {
+	assert.EqualError(t, ValidateScheduleInstanceEventInput(nil), awserrors.ErrorInvalidParameterValue)
+	assert.EqualError(t, ValidateScheduleInstanceEventInput(&handlers_ec2_instanceevent.ScheduleInstanceEventInput{
+		InstanceID: "i-123", Code: ec2.EventCodeInstanceStop,
+	}), awserrors.ErrorMissingParameter)
+	assert.EqualError(t, ValidateScheduleInstanceEventInput(&handlers_ec2_instanceevent.ScheduleInstanceEventInput{
+		InstanceID: "vol-123", Code: ec2.EventCodeInstanceStop, NotBefore: time.Now(),
+	}), awserrors.ErrorInvalidInstanceIDMalformed)
+	assert.NoError(t, ValidateScheduleInstanceEventInput(&handlers_ec2_instanceevent.ScheduleInstanceEventInput{
+		InstanceID: "i-123", Code: ec2.EventCodeInstanceStop, NotBefore: time.Now(),
+	}))
+}
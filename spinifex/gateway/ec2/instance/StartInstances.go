@@ -1,6 +1,7 @@
 package gateway_ec2_instance
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"log/slog"
@@ -8,6 +9,7 @@ import (
 
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/tracing"
 	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/nats-io/nats.go"
 )
@@ -31,6 +33,12 @@ func ValidateStartInstancesInput(input *ec2.StartInstancesInput) error {
 // StartInstances sends start requests to the ec2.start queue group topic.
 // Any available daemon can pick up the request and launch the stopped instance.
 func StartInstances(input *ec2.StartInstancesInput, natsConn *nats.Conn, accountID string) (*ec2.StartInstancesOutput, error) {
+	return StartInstancesContext(context.Background(), input, natsConn, accountID)
+}
+
+// StartInstancesContext is StartInstances with the caller's context, whose
+// trace the start requests to the daemons carry.
+func StartInstancesContext(ctx context.Context, input *ec2.StartInstancesInput, natsConn *nats.Conn, accountID string) (*ec2.StartInstancesOutput, error) {
 	if err := ValidateStartInstancesInput(input); err != nil {
 		return nil, err
 	}
@@ -54,9 +62,10 @@ func StartInstances(input *ec2.StartInstancesInput, natsConn *nats.Conn, account
 
 		slog.Info("StartInstances: Sending NATS request", "subject", "ec2.start", "instance_id", instanceID)
 
-		reqMsg := nats.NewMsg("ec2.start")
+		reqMsg := nats.NewMsg(utils.Subject("ec2.start"))
 		reqMsg.Data = jsonData
 		reqMsg.Header.Set(utils.AccountIDHeader, accountID)
+		tracing.Inject(ctx, reqMsg.Header)
 		msg, err := natsConn.RequestMsg(reqMsg, 30*time.Second)
 		if err != nil {
 			slog.Error("StartInstances: Failed to send start request", "instance_id", instanceID, "err", err)
@@ -65,9 +74,9 @@ func StartInstances(input *ec2.StartInstancesInput, natsConn *nats.Conn, account
 		}
 
 		// Check if the daemon returned an error response
-		if responseError, parseErr := utils.ValidateErrorPayload(msg.Data); parseErr != nil {
-			slog.Error("StartInstances: Daemon returned error", "instance_id", instanceID, "code", *responseError.Code)
-			return nil, errors.New(*responseError.Code)
+		if replyErr := utils.DecodeReply(msg).Err; replyErr != nil {
+			slog.Error("StartInstances: Daemon returned error", "instance_id", instanceID, "code", replyErr.Code)
+			return nil, replyErr
 		}
 
 		slog.Info("StartInstances: Command sent successfully", "instance_id", instanceID, "response", string(msg.Data))
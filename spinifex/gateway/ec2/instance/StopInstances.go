@@ -3,12 +3,12 @@ package gateway_ec2_instance
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
 	"log/slog"
 	"time"
 
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
 	"github.com/mulgadc/spinifex/spinifex/types"
 	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/nats-io/nats.go"
@@ -35,6 +35,7 @@ func StopInstances(input *ec2.StopInstancesInput, natsConn *nats.Conn, accountID
 	slog.Info("StopInstances: Processing request", "instance_count", len(input.InstanceIds))
 
 	var stateChanges []*ec2.InstanceStateChange
+	var protected protectedInstances
 
 	// Process each instance
 	for _, instanceIDPtr := range input.InstanceIds {
@@ -59,8 +60,8 @@ func StopInstances(input *ec2.StopInstancesInput, natsConn *nats.Conn, accountID
 		}
 
 		// Send NATS request to the specific instance topic with account ID header
-		subject := fmt.Sprintf("ec2.cmd.%s", instanceID)
-		reqMsg := nats.NewMsg(subject)
+		subject := subjects.InstanceCmd(instanceID)
+		reqMsg := nats.NewMsg(utils.Subject(subject))
 		reqMsg.Data = jsonData
 		reqMsg.Header.Set(utils.AccountIDHeader, accountID)
 		msg, err := natsConn.RequestMsg(reqMsg, 5*time.Second)
@@ -71,9 +72,13 @@ func StopInstances(input *ec2.StopInstancesInput, natsConn *nats.Conn, accountID
 		}
 
 		// Check if the daemon returned an error response (e.g. ownership check failure)
-		if responseError, parseErr := utils.ValidateErrorPayload(msg.Data); parseErr != nil {
-			slog.Error("StopInstances: Daemon returned error", "instance_id", instanceID, "code", *responseError.Code)
-			return nil, errors.New(*responseError.Code)
+		if replyErr := utils.DecodeReply(msg).Err; replyErr != nil {
+			if protected.add(replyErr) {
+				slog.Warn("StopInstances: Instance has stop protection", "instance_id", instanceID)
+				continue
+			}
+			slog.Error("StopInstances: Daemon returned error", "instance_id", instanceID, "code", replyErr.Code)
+			return nil, replyErr
 		}
 
 		slog.Info("StopInstances: Command sent successfully", "instance_id", instanceID, "response", string(msg.Data))
@@ -81,6 +86,12 @@ func StopInstances(input *ec2.StopInstancesInput, natsConn *nats.Conn, accountID
 		stateChanges = append(stateChanges, newStateChange(instanceID, 64, "stopping", 16, "running"))
 	}
 
+	// The unprotected instances are already stopping; report the ones that
+	// were not.
+	if err := protected.err(); err != nil {
+		return nil, err
+	}
+
 	output := &ec2.StopInstancesOutput{
 		StoppingInstances: stateChanges,
 	}
@@ -7,7 +7,9 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
 	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/nats-io/nats.go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -18,7 +20,7 @@ func TestStopInstances_Success(t *testing.T) {
 
 	instanceID := "i-0123456789abcdef0"
 
-	nc.Subscribe("ec2.cmd."+instanceID, func(msg *nats.Msg) {
+	nc.Subscribe(subjects.InstanceCmd(instanceID), func(msg *nats.Msg) {
 		var cmd types.EC2InstanceCommand
 		err := json.Unmarshal(msg.Data, &cmd)
 		require.NoError(t, err)
@@ -54,7 +56,7 @@ func TestStopInstances_MultipleInstances(t *testing.T) {
 	ids := []string{"i-001", "i-002"}
 
 	for _, id := range ids {
-		nc.Subscribe("ec2.cmd."+id, func(msg *nats.Msg) {
+		nc.Subscribe(subjects.InstanceCmd(id), func(msg *nats.Msg) {
 			msg.Respond([]byte(`{"return":{}}`))
 		})
 	}
@@ -91,7 +93,7 @@ func TestStopInstances_NilInstanceIdSkipped(t *testing.T) {
 	_, nc := startTestNATSServer(t)
 
 	instanceID := "i-valid"
-	nc.Subscribe("ec2.cmd."+instanceID, func(msg *nats.Msg) {
+	nc.Subscribe(subjects.InstanceCmd(instanceID), func(msg *nats.Msg) {
 		msg.Respond([]byte(`{"return":{}}`))
 	})
 
@@ -135,7 +137,7 @@ func TestStopInstances_MixedSuccessAndFailure(t *testing.T) {
 	goodID := "i-good"
 	badID := "i-bad"
 
-	nc.Subscribe("ec2.cmd."+goodID, func(msg *nats.Msg) {
+	nc.Subscribe(subjects.InstanceCmd(goodID), func(msg *nats.Msg) {
 		msg.Respond([]byte(`{"return":{}}`))
 	})
 
@@ -156,3 +158,35 @@ func TestStopInstances_MixedSuccessAndFailure(t *testing.T) {
 	assert.Equal(t, badID, *output.StoppingInstances[1].InstanceId)
 	assert.Equal(t, "running", *output.StoppingInstances[1].CurrentState.Name)
 }
+
+func TestStopInstances_ProtectedInstance(t *testing.T) {
+	_, nc := startTestNATSServer(t)
+
+	protectedID := "i-protected"
+	ids := []string{"i-first", protectedID, "i-last"}
+	var stopped []string
+	for _, id := range ids {
+		nc.Subscribe(subjects.InstanceCmd(id), func(msg *nats.Msg) {
+			if id == protectedID {
+				msg.Respond(utils.GenerateErrorPayloadWithDetail(awserrors.ErrorOperationNotPermitted,
+					"The instance '"+id+"' may not be stopped. Modify its 'disableApiStop' instance attribute and try again."))
+				return
+			}
+			stopped = append(stopped, id)
+			msg.Respond([]byte(`{}`))
+		})
+	}
+
+	input := &ec2.StopInstancesInput{
+		InstanceIds: []*string{aws.String(ids[0]), aws.String(ids[1]), aws.String(ids[2])},
+	}
+
+	_, err := StopInstances(input, nc, "123456789012")
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorOperationNotPermitted, err.Error())
+	assert.Contains(t, awserrors.Detail(err), protectedID)
+	assert.Contains(t, awserrors.Detail(err), "disableApiStop")
+
+	// The protected instance does not hold up the rest of the batch.
+	assert.Equal(t, []string{"i-first", "i-last"}, stopped)
+}
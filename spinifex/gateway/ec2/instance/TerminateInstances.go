@@ -9,6 +9,7 @@ import (
 
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
 	"github.com/mulgadc/spinifex/spinifex/types"
 	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/nats-io/nats.go"
@@ -40,6 +41,7 @@ func TerminateInstances(input *ec2.TerminateInstancesInput, natsConn *nats.Conn,
 	slog.Info("TerminateInstances: Processing request", "instance_count", len(input.InstanceIds))
 
 	var stateChanges []*ec2.InstanceStateChange
+	var protected protectedInstances
 
 	// Process each instance
 	for _, instanceIDPtr := range input.InstanceIds {
@@ -67,10 +69,10 @@ func TerminateInstances(input *ec2.TerminateInstancesInput, natsConn *nats.Conn,
 		// Retry briefly on ErrNoResponders — after a cluster restart the
 		// per-instance NATS subscription may not have propagated to all
 		// servers yet.
-		subject := fmt.Sprintf("ec2.cmd.%s", instanceID)
+		subject := subjects.InstanceCmd(instanceID)
 		var msg *nats.Msg
 		for attempt := range 3 {
-			reqMsg := nats.NewMsg(subject)
+			reqMsg := nats.NewMsg(utils.Subject(subject))
 			reqMsg.Data = jsonData
 			reqMsg.Header.Set(utils.AccountIDHeader, accountID)
 			msg, err = natsConn.RequestMsg(reqMsg, 5*time.Second)
@@ -93,16 +95,21 @@ func TerminateInstances(input *ec2.TerminateInstancesInput, natsConn *nats.Conn,
 					slog.Error("TerminateInstances: Failed to marshal terminate request", "instance_id", instanceID, "err", err)
 					continue
 				}
-				terminateReqMsg := nats.NewMsg("ec2.terminate")
+				terminateReqMsg := nats.NewMsg(utils.Subject("ec2.terminate"))
 				terminateReqMsg.Data = terminateReq
 				terminateReqMsg.Header.Set(utils.AccountIDHeader, accountID)
 				terminateMsg, terminateErr := natsConn.RequestMsg(terminateReqMsg, 30*time.Second)
 				if terminateErr == nil {
-					if _, parseErr := utils.ValidateErrorPayload(terminateMsg.Data); parseErr == nil {
+					replyErr := utils.DecodeReply(terminateMsg).Err
+					if replyErr == nil {
 						slog.Info("TerminateInstances: Stopped instance terminated via ec2.terminate", "instance_id", instanceID)
 						stateChanges = append(stateChanges, newStateChange(instanceID, 32, "shutting-down", 80, "stopped"))
 						continue
 					}
+					if protected.add(replyErr) {
+						slog.Warn("TerminateInstances: Stopped instance has termination protection", "instance_id", instanceID)
+						continue
+					}
 				}
 
 				// Check if instance is already terminated (idempotent, matches AWS behavior)
@@ -118,9 +125,13 @@ func TerminateInstances(input *ec2.TerminateInstancesInput, natsConn *nats.Conn,
 		}
 
 		// Check if the daemon returned an error response (e.g. ownership check failure)
-		if responseError, parseErr := utils.ValidateErrorPayload(msg.Data); parseErr != nil {
-			slog.Error("TerminateInstances: Daemon returned error", "instance_id", instanceID, "code", *responseError.Code)
-			return nil, errors.New(*responseError.Code)
+		if replyErr := utils.DecodeReply(msg).Err; replyErr != nil {
+			if protected.add(replyErr) {
+				slog.Warn("TerminateInstances: Instance has termination protection", "instance_id", instanceID)
+				continue
+			}
+			slog.Error("TerminateInstances: Daemon returned error", "instance_id", instanceID, "code", replyErr.Code)
+			return nil, replyErr
 		}
 
 		slog.Info("TerminateInstances: Command sent successfully", "instance_id", instanceID, "response", string(msg.Data))
@@ -128,6 +139,12 @@ func TerminateInstances(input *ec2.TerminateInstancesInput, natsConn *nats.Conn,
 		stateChanges = append(stateChanges, newStateChange(instanceID, 32, "shutting-down", 16, "running"))
 	}
 
+	// The unprotected instances are already terminating; report the ones
+	// that were not.
+	if err := protected.err(); err != nil {
+		return nil, err
+	}
+
 	output := &ec2.TerminateInstancesOutput{
 		TerminatingInstances: stateChanges,
 	}
@@ -146,7 +163,7 @@ func isAlreadyTerminated(natsConn *nats.Conn, instanceID, accountID string) bool
 		slog.Warn("isAlreadyTerminated: failed to marshal request", "instanceId", instanceID, "err", err)
 		return false
 	}
-	reqMsg := nats.NewMsg("ec2.DescribeTerminatedInstances")
+	reqMsg := nats.NewMsg(utils.Subject("ec2.DescribeTerminatedInstances"))
 	reqMsg.Data = reqData
 	reqMsg.Header.Set(utils.AccountIDHeader, accountID)
 	msg, err := natsConn.RequestMsg(reqMsg, 3*time.Second)
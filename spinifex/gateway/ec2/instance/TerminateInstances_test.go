@@ -7,7 +7,9 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
 	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/nats-io/nats.go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -18,7 +20,7 @@ func TestTerminateInstances_Success(t *testing.T) {
 
 	instanceID := "i-0123456789abcdef0"
 
-	nc.Subscribe("ec2.cmd."+instanceID, func(msg *nats.Msg) {
+	nc.Subscribe(subjects.InstanceCmd(instanceID), func(msg *nats.Msg) {
 		var cmd types.EC2InstanceCommand
 		err := json.Unmarshal(msg.Data, &cmd)
 		require.NoError(t, err)
@@ -54,7 +56,7 @@ func TestTerminateInstances_MultipleInstances(t *testing.T) {
 	ids := []string{"i-001", "i-002", "i-003"}
 
 	for _, id := range ids {
-		nc.Subscribe("ec2.cmd."+id, func(msg *nats.Msg) {
+		nc.Subscribe(subjects.InstanceCmd(id), func(msg *nats.Msg) {
 			msg.Respond([]byte(`{"return":{}}`))
 		})
 	}
@@ -91,7 +93,7 @@ func TestTerminateInstances_NilInstanceIdSkipped(t *testing.T) {
 	_, nc := startTestNATSServer(t)
 
 	instanceID := "i-valid"
-	nc.Subscribe("ec2.cmd."+instanceID, func(msg *nats.Msg) {
+	nc.Subscribe(subjects.InstanceCmd(instanceID), func(msg *nats.Msg) {
 		msg.Respond([]byte(`{"return":{}}`))
 	})
 
@@ -128,7 +130,7 @@ func TestTerminateInstances_MixedSuccessAndFailure(t *testing.T) {
 	goodID := "i-good"
 	badID := "i-bad"
 
-	nc.Subscribe("ec2.cmd."+goodID, func(msg *nats.Msg) {
+	nc.Subscribe(subjects.InstanceCmd(goodID), func(msg *nats.Msg) {
 		msg.Respond([]byte(`{"return":{}}`))
 	})
 
@@ -150,7 +152,7 @@ func TestTerminateInstances_VerifiesQMPAttributes(t *testing.T) {
 	instanceID := "i-verify"
 	var receivedCmd types.EC2InstanceCommand
 
-	nc.Subscribe("ec2.cmd."+instanceID, func(msg *nats.Msg) {
+	nc.Subscribe(subjects.InstanceCmd(instanceID), func(msg *nats.Msg) {
 		json.Unmarshal(msg.Data, &receivedCmd)
 		msg.Respond([]byte(`{"return":{}}`))
 	})
@@ -206,7 +208,7 @@ func TestTerminateInstances_MixedRunningAndStopped(t *testing.T) {
 	stoppedID := "i-stopped-mix"
 
 	// Running instance responds on ec2.cmd.<id>
-	nc.Subscribe("ec2.cmd."+runningID, func(msg *nats.Msg) {
+	nc.Subscribe(subjects.InstanceCmd(runningID), func(msg *nats.Msg) {
 		msg.Respond([]byte(`{"return":{}}`))
 	})
 
@@ -240,3 +242,44 @@ func TestTerminateInstances_MixedRunningAndStopped(t *testing.T) {
 	assert.Equal(t, int64(80), *output.TerminatingInstances[1].PreviousState.Code)
 	assert.Equal(t, "stopped", *output.TerminatingInstances[1].PreviousState.Name)
 }
+
+func TestTerminateInstances_ProtectedInstances(t *testing.T) {
+	_, nc := startTestNATSServer(t)
+
+	runningID := "i-running-unprotected"
+	protectedRunningID := "i-running-protected"
+	protectedStoppedID := "i-stopped-protected"
+	blocked := func(id string) []byte {
+		return utils.GenerateErrorPayloadWithDetail(awserrors.ErrorOperationNotPermitted,
+			"The instance '"+id+"' may not be terminated. Modify its 'disableApiTermination' instance attribute and try again.")
+	}
+
+	var terminated []string
+	nc.Subscribe(subjects.InstanceCmd(runningID), func(msg *nats.Msg) {
+		terminated = append(terminated, runningID)
+		msg.Respond([]byte(`{}`))
+	})
+	nc.Subscribe(subjects.InstanceCmd(protectedRunningID), func(msg *nats.Msg) {
+		msg.Respond(blocked(protectedRunningID))
+	})
+	// The stopped instance has no ec2.cmd.<id> subscriber.
+	nc.QueueSubscribe("ec2.terminate", "spinifex-workers", func(msg *nats.Msg) {
+		var req terminateStoppedInstanceRequest
+		json.Unmarshal(msg.Data, &req)
+		msg.Respond(blocked(req.InstanceID))
+	})
+
+	input := &ec2.TerminateInstancesInput{
+		InstanceIds: []*string{aws.String(protectedRunningID), aws.String(protectedStoppedID), aws.String(runningID)},
+	}
+
+	_, err := TerminateInstances(input, nc, "123456789012")
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorOperationNotPermitted, err.Error())
+	assert.Contains(t, awserrors.Detail(err), protectedRunningID)
+	assert.Contains(t, awserrors.Detail(err), protectedStoppedID)
+	assert.Contains(t, awserrors.Detail(err), "disableApiTermination")
+
+	// Protected instances do not hold up the rest of the batch.
+	assert.Equal(t, []string{runningID}, terminated)
+}
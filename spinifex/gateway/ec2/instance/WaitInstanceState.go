@@ -0,0 +1,49 @@
+package gateway_ec2_instance
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/nats-io/nats.go"
+)
+
+// waitPollInterval is how often WaitInstanceState re-reads instance status.
+var waitPollInterval = 2 * time.Second
+
+// WaitInstanceState polls DescribeInstanceStatus until the instance is in
+// state and its instance status check reads status — running plus ok is the
+// SDK's InstanceStatusOk waiter, and with phone-home it means the guest has
+// finished cloud-init. It fails fast once the instance is shutting down or
+// terminated, unless that is the state being waited for, and stops early
+// when ctx is done.
+func WaitInstanceState(ctx context.Context, instanceID, state, status string, timeout time.Duration, natsConn *nats.Conn, expectedNodes int, accountID string) error {
+	input := &ec2.DescribeInstanceStatusInput{
+		InstanceIds:         []*string{aws.String(instanceID)},
+		IncludeAllInstances: aws.Bool(true),
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		output, err := DescribeInstanceStatus(input, natsConn, expectedNodes, accountID)
+		if err == nil && len(output.InstanceStatuses) > 0 {
+			current := output.InstanceStatuses[0]
+			currentState := aws.StringValue(current.InstanceState.Name)
+			if currentState == state && aws.StringValue(current.InstanceStatus.Status) == status {
+				return nil
+			}
+			if currentState != state && (currentState == ec2.InstanceStateNameShuttingDown || currentState == ec2.InstanceStateNameTerminated) {
+				return fmt.Errorf("instance %s is %s", instanceID, currentState)
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for instance %s to be %s/%s", instanceID, state, status)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(waitPollInterval):
+		}
+	}
+}
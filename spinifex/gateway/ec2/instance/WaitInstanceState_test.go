@@ -0,0 +1,104 @@
+package gateway_ec2_instance
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockBootingNode answers DescribeInstances and DescribeInstanceBootStatus
+// for one running instance that stays unbooted until ec2.PhoneHome is sent.
+func mockBootingNode(t *testing.T, nc *nats.Conn, instanceID string, state string) {
+	t.Helper()
+	var bootedAt atomic.Pointer[time.Time]
+
+	_, err := nc.Subscribe("ec2.DescribeInstances", func(msg *nats.Msg) {
+		data, _ := json.Marshal(&ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{{
+			Instances: []*ec2.Instance{{
+				InstanceId: aws.String(instanceID),
+				State:      &ec2.InstanceState{Code: aws.Int64(16), Name: aws.String(state)},
+			}},
+		}}})
+		msg.Respond(data)
+	})
+	require.NoError(t, err)
+
+	_, err = nc.Subscribe("ec2.DescribeInstanceBootStatus", func(msg *nats.Msg) {
+		status := types.InstanceBootStatus{}
+		if at := bootedAt.Load(); at != nil {
+			status.BootedAt = *at
+		}
+		data, _ := json.Marshal(&types.DescribeInstanceBootStatusOutput{
+			Instances: map[string]types.InstanceBootStatus{instanceID: status},
+		})
+		msg.Respond(data)
+	})
+	require.NoError(t, err)
+
+	_, err = nc.Subscribe("ec2.PhoneHome", func(msg *nats.Msg) {
+		now := time.Now()
+		bootedAt.Store(&now)
+		msg.Respond([]byte("{}"))
+	})
+	require.NoError(t, err)
+}
+
+func TestWaitInstanceState_UnblocksOnPhoneHome(t *testing.T) {
+	_, nc := startTestNATSServer(t)
+	mockBootingNode(t, nc, "i-booting", ec2.InstanceStateNameRunning)
+
+	orig := waitPollInterval
+	waitPollInterval = 20 * time.Millisecond
+	t.Cleanup(func() { waitPollInterval = orig })
+
+	// Running but not yet phoned home: initializing.
+	out, err := DescribeInstanceStatus(&ec2.DescribeInstanceStatusInput{InstanceIds: []*string{aws.String("i-booting")}}, nc, 1, "123456789012")
+	require.NoError(t, err)
+	require.Len(t, out.InstanceStatuses, 1)
+	assert.Equal(t, ec2.SummaryStatusInitializing, *out.InstanceStatuses[0].InstanceStatus.Status)
+	assert.Equal(t, ec2.SummaryStatusOk, *out.InstanceStatuses[0].SystemStatus.Status)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- WaitInstanceState(t.Context(), "i-booting", ec2.InstanceStateNameRunning, ec2.SummaryStatusOk, 10*time.Second, nc, 1, "123456789012")
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("waiter returned before phone-home: %v", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	_, err = utils.NATSRequest[struct{}](nc, "ec2.PhoneHome", types.PhoneHomeInput{InstanceID: "i-booting", Token: "tok"}, time.Second, "")
+	require.NoError(t, err)
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("waiter did not unblock after phone-home")
+	}
+
+	out, err = DescribeInstanceStatus(&ec2.DescribeInstanceStatusInput{InstanceIds: []*string{aws.String("i-booting")}}, nc, 1, "123456789012")
+	require.NoError(t, err)
+	require.Len(t, out.InstanceStatuses, 1)
+	assert.Equal(t, ec2.SummaryStatusOk, *out.InstanceStatuses[0].InstanceStatus.Status)
+}
+
+func TestWaitInstanceState_FailsOnTerminated(t *testing.T) {
+	_, nc := startTestNATSServer(t)
+	mockBootingNode(t, nc, "i-gone", ec2.InstanceStateNameTerminated)
+
+	err := WaitInstanceState(t.Context(), "i-gone", ec2.InstanceStateNameRunning, ec2.SummaryStatusOk, 10*time.Second, nc, 1, "123456789012")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "terminated")
+}
@@ -0,0 +1,76 @@
+package gateway_ec2_instance
+
+import (
+	"errors"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+)
+
+const reclaimCapacityTimeout = 5 * time.Second
+
+// reclaimInterruptibleCapacity asks nodes running interruptible instances to
+// give them notice so that count more instances of instanceType fit. The
+// capacity frees up only when the notice runs out, so the launch still fails:
+// the error tells the caller to retry once the interruptible instances are
+// gone.
+func reclaimInterruptibleCapacity(natsConn *nats.Conn, instanceType string, count int) error {
+	statuses, err := collectNodeStatus(natsConn)
+	if err != nil {
+		return err
+	}
+
+	type reclaimNode struct {
+		id  string
+		cap types.InstanceTypeCap
+	}
+	var nodes []reclaimNode
+	for _, status := range statuses {
+		for _, cap := range status.InstanceTypes {
+			if cap.Name == instanceType && cap.Reclaimable > 0 {
+				nodes = append(nodes, reclaimNode{id: status.Node, cap: cap})
+				break
+			}
+		}
+	}
+	// Ask the nodes that can free the most first, to interrupt on as few
+	// nodes as possible.
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].cap.Reclaimable > nodes[j].cap.Reclaimable
+	})
+
+	freed := 0
+	for _, node := range nodes {
+		need := count - freed
+		if need <= 0 {
+			break
+		}
+		req := types.ReclaimCapacityRequest{
+			InstanceType: instanceType,
+			Count:        node.cap.Available + min(need, node.cap.Reclaimable),
+		}
+		resp, err := utils.NATSRequest[types.ReclaimCapacityResponse](natsConn, subjects.ReclaimCapacity(node.id),
+			req, reclaimCapacityTimeout, utils.GlobalAccountID)
+		if err != nil {
+			slog.Warn("reclaimInterruptibleCapacity: node did not reclaim capacity", "node", node.id, "err", err)
+			continue
+		}
+		if len(resp.Interrupted) > 0 {
+			slog.Info("Reclaiming interruptible capacity", "node", node.id, "instanceType", instanceType,
+				"interrupted", resp.Interrupted)
+		}
+		freed += max(resp.Available-node.cap.Available, 0)
+	}
+
+	if freed == 0 {
+		return errors.New(awserrors.ErrorInsufficientInstanceCapacity)
+	}
+	return awserrors.WithDetail(awserrors.ErrorInsufficientInstanceCapacity,
+		"Interruptible instances are being reclaimed to make room for this request; retry in about 2 minutes.")
+}
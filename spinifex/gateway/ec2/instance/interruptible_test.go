@@ -0,0 +1,81 @@
+package gateway_ec2_instance
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// respondNodeStatus answers spinifex.node.status with the given responses.
+func respondNodeStatus(t *testing.T, nc *nats.Conn, responses ...types.NodeStatusResponse) {
+	t.Helper()
+	sub, err := nc.Subscribe(subjects.NodeStatus, func(msg *nats.Msg) {
+		for _, resp := range responses {
+			data, _ := json.Marshal(resp)
+			_ = nc.Publish(msg.Reply, data)
+		}
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = sub.Unsubscribe() })
+}
+
+func TestReclaimInterruptibleCapacity(t *testing.T) {
+	_, nc := startTestNATSServer(t)
+
+	respondNodeStatus(t, nc,
+		types.NodeStatusResponse{
+			Node:          "node-1",
+			InstanceTypes: []types.InstanceTypeCap{{Name: "t3.micro", Available: 1, Reclaimable: 1}},
+		},
+		types.NodeStatusResponse{
+			Node:          "node-2",
+			InstanceTypes: []types.InstanceTypeCap{{Name: "t3.micro", Available: 0, Reclaimable: 3}},
+		},
+		types.NodeStatusResponse{
+			Node:          "node-3",
+			InstanceTypes: []types.InstanceTypeCap{{Name: "t3.micro", Available: 2}},
+		},
+	)
+
+	requests := make(chan types.ReclaimCapacityRequest, 3)
+	for _, node := range []string{"node-1", "node-2", "node-3"} {
+		sub, err := nc.Subscribe(subjects.ReclaimCapacity(node), func(msg *nats.Msg) {
+			var req types.ReclaimCapacityRequest
+			require.NoError(t, json.Unmarshal(msg.Data, &req))
+			requests <- req
+			data, _ := json.Marshal(types.ReclaimCapacityResponse{Interrupted: []string{"i-spot"}, Available: req.Count})
+			_ = msg.Respond(data)
+		})
+		require.NoError(t, err)
+		defer sub.Unsubscribe()
+	}
+
+	// node-2 can free the most, so it is asked first and covers the shortfall.
+	err := reclaimInterruptibleCapacity(nc, "t3.micro", 2)
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorInsufficientInstanceCapacity, err.Error())
+	assert.Contains(t, awserrors.Detail(err), "retry")
+
+	require.Len(t, requests, 1)
+	assert.Equal(t, types.ReclaimCapacityRequest{InstanceType: "t3.micro", Count: 2}, <-requests)
+}
+
+func TestReclaimInterruptibleCapacity_NothingReclaimable(t *testing.T) {
+	_, nc := startTestNATSServer(t)
+
+	respondNodeStatus(t, nc, types.NodeStatusResponse{
+		Node:          "node-1",
+		InstanceTypes: []types.InstanceTypeCap{{Name: "t3.micro", Available: 0}},
+	})
+
+	err := reclaimInterruptibleCapacity(nc, "t3.micro", 1)
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorInsufficientInstanceCapacity, err.Error())
+	assert.Empty(t, awserrors.Detail(err))
+}
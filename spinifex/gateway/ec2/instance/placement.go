@@ -1,6 +1,7 @@
 package gateway_ec2_instance
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,7 +14,9 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_ec2_instance "github.com/mulgadc/spinifex/spinifex/handlers/ec2/instance"
 	handlers_ec2_placementgroup "github.com/mulgadc/spinifex/spinifex/handlers/ec2/placementgroup"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
 	"github.com/mulgadc/spinifex/spinifex/types"
 	"github.com/mulgadc/spinifex/spinifex/utils"
 
@@ -34,7 +37,7 @@ type nodeAllocation struct {
 // partial failures with rollback.
 //
 // Returns the merged reservation on success or an error.
-func distributeInstances(input *ec2.RunInstancesInput, natsConn *nats.Conn, accountID string) (*ec2.Reservation, error) {
+func distributeInstances(ctx context.Context, input *ec2.RunInstancesInput, natsConn *nats.Conn, accountID string) (*ec2.Reservation, error) {
 	instanceType := aws.StringValue(input.InstanceType)
 	minCount := int(aws.Int64Value(input.MinCount))
 	maxCount := int(aws.Int64Value(input.MaxCount))
@@ -45,17 +48,17 @@ func distributeInstances(input *ec2.RunInstancesInput, natsConn *nats.Conn, acco
 		return nil, err
 	}
 
-	if len(nodes) == 0 {
-		return nil, errors.New(awserrors.ErrorInsufficientInstanceCapacity)
-	}
-
-	// Step 2: Calculate total capacity and check feasibility
+	// Step 2: Calculate total capacity and check feasibility. An on-demand
+	// launch that doesn't fit reclaims capacity from interruptible instances.
 	totalCapacity := 0
 	for _, n := range nodes {
 		totalCapacity += n.Available
 	}
 	if totalCapacity < minCount {
-		return nil, errors.New(awserrors.ErrorInsufficientInstanceCapacity)
+		if handlers_ec2_instance.Interruptible(input) {
+			return nil, errors.New(awserrors.ErrorInsufficientInstanceCapacity)
+		}
+		return nil, reclaimInterruptibleCapacity(natsConn, instanceType, minCount-totalCapacity)
 	}
 
 	// Step 3: Determine launch count (capped to MaxCount and available capacity)
@@ -65,7 +68,7 @@ func distributeInstances(input *ec2.RunInstancesInput, natsConn *nats.Conn, acco
 	allocations := spreadAllocate(nodes, launchCount)
 
 	// Step 5: Launch instances on each node in parallel
-	results := launchOnNodes(allocations, input, natsConn, accountID)
+	results := launchOnNodes(ctx, allocations, input, natsConn, accountID)
 
 	// Step 6: Aggregate results and handle partial failure
 	return aggregateResults(results, minCount, natsConn, accountID)
@@ -75,10 +78,44 @@ func distributeInstances(input *ec2.RunInstancesInput, natsConn *nats.Conn, acco
 // eligible nodes (those with Available >= 1 for the requested instance type),
 // sorted by available capacity descending with random tiebreaking for fair
 // distribution among equal-capacity nodes.
+func queryNodeCapacity(natsConn *nats.Conn, instanceType string) ([]nodeAllocation, error) {
+	statuses, err := collectNodeStatus(natsConn)
+	if err != nil {
+		return nil, err
+	}
+
+	var nodes []nodeAllocation
+	for _, status := range statuses {
+		// Find capacity for the requested instance type on this node
+		for _, cap := range status.InstanceTypes {
+			if cap.Name == instanceType && cap.Available >= 1 {
+				nodes = append(nodes, nodeAllocation{
+					NodeID:    status.Node,
+					Available: cap.Available,
+				})
+				break
+			}
+		}
+	}
+
+	// Shuffle first for random tiebreaking, then stable-sort by capacity
+	// descending. This ensures fair distribution among equal-capacity nodes.
+	rand.Shuffle(len(nodes), func(i, j int) {
+		nodes[i], nodes[j] = nodes[j], nodes[i]
+	})
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].Available > nodes[j].Available
+	})
+
+	return nodes, nil
+}
+
+// collectNodeStatus fans out spinifex.node.status to all daemons and returns
+// every response that names its node.
 //
 // Uses a collection window: after the first response arrives, only waits an
 // additional 200ms for remaining responses (instead of the full 3s timeout).
-func queryNodeCapacity(natsConn *nats.Conn, instanceType string) ([]nodeAllocation, error) {
+func collectNodeStatus(natsConn *nats.Conn) ([]types.NodeStatusResponse, error) {
 	inbox := nats.NewInbox()
 	sub, err := natsConn.SubscribeSync(inbox)
 	if err != nil {
@@ -86,7 +123,7 @@ func queryNodeCapacity(natsConn *nats.Conn, instanceType string) ([]nodeAllocati
 	}
 	defer sub.Unsubscribe()
 
-	pubMsg := nats.NewMsg("spinifex.node.status")
+	pubMsg := nats.NewMsg(utils.Subject(subjects.NodeStatus))
 	pubMsg.Reply = inbox
 	pubMsg.Data = []byte("{}")
 	if err := natsConn.PublishMsg(pubMsg); err != nil {
@@ -100,7 +137,7 @@ func queryNodeCapacity(natsConn *nats.Conn, instanceType string) ([]nodeAllocati
 
 	deadline := time.Now().Add(initialTimeout)
 	gotFirst := false
-	var nodes []nodeAllocation
+	var statuses []types.NodeStatusResponse
 
 	for time.Now().Before(deadline) {
 		remaining := time.Until(deadline)
@@ -112,30 +149,21 @@ func queryNodeCapacity(natsConn *nats.Conn, instanceType string) ([]nodeAllocati
 			if err == nats.ErrTimeout {
 				break
 			}
-			slog.Debug("queryNodeCapacity: error receiving message", "err", err)
+			slog.Debug("collectNodeStatus: error receiving message", "err", err)
 			break
 		}
 
 		var status types.NodeStatusResponse
 		if err := json.Unmarshal(msg.Data, &status); err != nil {
-			slog.Debug("queryNodeCapacity: failed to unmarshal response", "err", err)
+			slog.Debug("collectNodeStatus: failed to unmarshal response", "err", err)
 			continue
 		}
 		if status.Node == "" {
-			slog.Debug("queryNodeCapacity: skipping response with empty node ID")
+			slog.Debug("collectNodeStatus: skipping response with empty node ID")
 			continue
 		}
 
-		// Find capacity for the requested instance type on this node
-		for _, cap := range status.InstanceTypes {
-			if cap.Name == instanceType && cap.Available >= 1 {
-				nodes = append(nodes, nodeAllocation{
-					NodeID:    status.Node,
-					Available: cap.Available,
-				})
-				break
-			}
-		}
+		statuses = append(statuses, status)
 
 		// After the first valid response, tighten the deadline so we don't
 		// wait the full 3s for stragglers.
@@ -148,16 +176,7 @@ func queryNodeCapacity(natsConn *nats.Conn, instanceType string) ([]nodeAllocati
 		}
 	}
 
-	// Shuffle first for random tiebreaking, then stable-sort by capacity
-	// descending. This ensures fair distribution among equal-capacity nodes.
-	rand.Shuffle(len(nodes), func(i, j int) {
-		nodes[i], nodes[j] = nodes[j], nodes[i]
-	})
-	sort.SliceStable(nodes, func(i, j int) bool {
-		return nodes[i].Available > nodes[j].Available
-	})
-
-	return nodes, nil
+	return statuses, nil
 }
 
 // spreadAllocate distributes count instances across nodes using best-effort spread:
@@ -221,7 +240,7 @@ type nodeLaunchResult struct {
 
 // launchOnNodes sends targeted RunInstances requests to specific nodes in parallel.
 // Each node gets MinCount=MaxCount=assignedCount so the daemon treats it as all-or-nothing.
-func launchOnNodes(allocations []nodeAllocation, input *ec2.RunInstancesInput, natsConn *nats.Conn, accountID string) []nodeLaunchResult {
+func launchOnNodes(ctx context.Context, allocations []nodeAllocation, input *ec2.RunInstancesInput, natsConn *nats.Conn, accountID string) []nodeLaunchResult {
 	instanceType := aws.StringValue(input.InstanceType)
 
 	results := make([]nodeLaunchResult, len(allocations))
@@ -237,8 +256,8 @@ func launchOnNodes(allocations []nodeAllocation, input *ec2.RunInstancesInput, n
 			nodeInput.MinCount = aws.Int64(int64(a.Assigned))
 			nodeInput.MaxCount = aws.Int64(int64(a.Assigned))
 
-			topic := fmt.Sprintf("ec2.RunInstances.%s.%s", instanceType, a.NodeID)
-			reservation, err := utils.NATSRequest[ec2.Reservation](natsConn, topic, &nodeInput, 5*time.Minute, accountID)
+			topic := subjects.RunInstancesOnNode(instanceType, a.NodeID)
+			reservation, err := utils.NATSRequestContext[ec2.Reservation](ctx, natsConn, topic, &nodeInput, 5*time.Minute, accountID)
 			if err != nil {
 				results[idx] = nodeLaunchResult{NodeID: a.NodeID, Err: fmt.Errorf("launch on %s: %w", a.NodeID, err)}
 				return
@@ -295,7 +314,7 @@ func aggregateResults(results []nodeLaunchResult, minCount int, natsConn *nats.C
 // distributeInstancesSpread implements strict 1-per-node spread for placement groups.
 // It queries capacity, reserves unused nodes via CAS, launches 1 instance per node,
 // and finalizes or rolls back the placement group record.
-func distributeInstancesSpread(input *ec2.RunInstancesInput, natsConn *nats.Conn, accountID string, groupName string) (*ec2.Reservation, error) {
+func distributeInstancesSpread(ctx context.Context, input *ec2.RunInstancesInput, natsConn *nats.Conn, accountID string, groupName string) (*ec2.Reservation, error) {
 	instanceType := aws.StringValue(input.InstanceType)
 	minCount := int(aws.Int64Value(input.MinCount))
 	maxCount := int(aws.Int64Value(input.MaxCount))
@@ -337,7 +356,7 @@ func distributeInstancesSpread(input *ec2.RunInstancesInput, natsConn *nats.Conn
 	}
 
 	// Step 4: Launch instances on reserved nodes in parallel
-	results := launchOnNodes(allocations, input, natsConn, accountID)
+	results := launchOnNodes(ctx, allocations, input, natsConn, accountID)
 
 	// Step 5: Collect results
 	var allInstances []*ec2.Instance
@@ -423,7 +442,7 @@ func distributeInstancesSpread(input *ec2.RunInstancesInput, natsConn *nats.Conn
 // distributeInstancesCluster implements cluster placement group routing.
 // All instances are pinned to a single node. If the group already has instances,
 // subsequent launches go to the same node. If empty, picks the node with most capacity.
-func distributeInstancesCluster(input *ec2.RunInstancesInput, natsConn *nats.Conn, accountID string, groupName string) (*ec2.Reservation, error) {
+func distributeInstancesCluster(ctx context.Context, input *ec2.RunInstancesInput, natsConn *nats.Conn, accountID string, groupName string) (*ec2.Reservation, error) {
 	instanceType := aws.StringValue(input.InstanceType)
 	minCount := int(aws.Int64Value(input.MinCount))
 	maxCount := int(aws.Int64Value(input.MaxCount))
@@ -474,7 +493,7 @@ func distributeInstancesCluster(input *ec2.RunInstancesInput, natsConn *nats.Con
 		NodeID:   targetNode,
 		Assigned: launchCount,
 	}}
-	results := launchOnNodes(allocations, input, natsConn, accountID)
+	results := launchOnNodes(ctx, allocations, input, natsConn, accountID)
 
 	// Step 5: Handle result (single node, no partial failure logic needed)
 	if results[0].Err != nil {
@@ -511,7 +530,8 @@ func distributeInstancesCluster(input *ec2.RunInstancesInput, natsConn *nats.Con
 
 // extractClientError scans node launch results for specific client validation
 // errors (e.g. InvalidAMIID.NotFound) that should be propagated instead of the
-// generic InsufficientInstanceCapacity. Returns the first match, or nil.
+// generic InsufficientInstanceCapacity, then for an InsufficientInstanceCapacity
+// carrying a node's shortfall detail. Returns the first match, or nil.
 func extractClientError(results []nodeLaunchResult) error {
 	for _, r := range results {
 		if r.Err == nil {
@@ -530,6 +550,12 @@ func extractClientError(results []nodeLaunchResult) error {
 			return inner
 		}
 	}
+	for _, r := range results {
+		var detailed *awserrors.DetailedError
+		if errors.As(r.Err, &detailed) && detailed.Code == awserrors.ErrorInsufficientInstanceCapacity {
+			return detailed
+		}
+	}
 	return nil
 }
 
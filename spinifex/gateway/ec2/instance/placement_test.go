@@ -1,6 +1,7 @@
 package gateway_ec2_instance
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,6 +11,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
 	"github.com/mulgadc/spinifex/spinifex/types"
 	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/nats-io/nats.go"
@@ -144,7 +146,7 @@ func TestQueryNodeCapacity_FiltersEligibleNodes(t *testing.T) {
 	_, nc := startTestNATSServer(t)
 
 	// Simulate 3 daemons responding to spinifex.node.status
-	sub, err := nc.Subscribe("spinifex.node.status", func(msg *nats.Msg) {
+	sub, err := nc.Subscribe(subjects.NodeStatus, func(msg *nats.Msg) {
 		// Respond 3 times with different node statuses
 		responses := []types.NodeStatusResponse{
 			{
@@ -329,6 +331,25 @@ func TestExtractClientError_KeyPairNotFound(t *testing.T) {
 	assert.Equal(t, awserrors.ErrorInvalidKeyPairNotFound, err.Error())
 }
 
+func TestExtractClientError_CapacityDetail(t *testing.T) {
+	generic := fmt.Errorf("launch on node-1: %w", errors.New(awserrors.ErrorInsufficientInstanceCapacity))
+	detailed := fmt.Errorf("launch on node-2: %w", awserrors.WithDetail(awserrors.ErrorInsufficientInstanceCapacity, "not enough memory"))
+	results := []nodeLaunchResult{
+		{NodeID: "node-1", Err: generic},
+		{NodeID: "node-2", Err: detailed},
+	}
+	err := extractClientError(results)
+	require.NotNil(t, err)
+	assert.Equal(t, awserrors.ErrorInsufficientInstanceCapacity, err.Error())
+	assert.Equal(t, "not enough memory", awserrors.Detail(err))
+
+	// Client errors win over capacity detail.
+	amiErr := fmt.Errorf("launch on node-3: %w", errors.New(awserrors.ErrorInvalidAMIIDNotFound))
+	err = extractClientError(append(results, nodeLaunchResult{NodeID: "node-3", Err: amiErr}))
+	require.NotNil(t, err)
+	assert.Equal(t, awserrors.ErrorInvalidAMIIDNotFound, err.Error())
+}
+
 func TestAggregateResults_PropagatesClientError(t *testing.T) {
 	inner := errors.New(awserrors.ErrorInvalidAMIIDNotFound)
 	wrapped := fmt.Errorf("launch on node-1: %w", inner)
@@ -348,7 +369,7 @@ func TestDistributeInstances_SuccessfulSpread(t *testing.T) {
 	_, nc := startTestNATSServer(t)
 
 	// Mock node.status responder
-	statusSub, err := nc.Subscribe("spinifex.node.status", func(msg *nats.Msg) {
+	statusSub, err := nc.Subscribe(subjects.NodeStatus, func(msg *nats.Msg) {
 		for _, resp := range []types.NodeStatusResponse{
 			{Node: "node-1", InstanceTypes: []types.InstanceTypeCap{{Name: "t3.micro", Available: 2}}},
 			{Node: "node-2", InstanceTypes: []types.InstanceTypeCap{{Name: "t3.micro", Available: 2}}},
@@ -361,7 +382,7 @@ func TestDistributeInstances_SuccessfulSpread(t *testing.T) {
 	defer statusSub.Unsubscribe()
 
 	// Mock daemon on node-1
-	sub1, err := nc.Subscribe("ec2.RunInstances.t3.micro.node-1", func(msg *nats.Msg) {
+	sub1, err := nc.Subscribe(subjects.RunInstancesOnNode("t3.micro", "node-1"), func(msg *nats.Msg) {
 		reservation := ec2.Reservation{
 			ReservationId: aws.String("r-test1"),
 			Instances:     []*ec2.Instance{{InstanceId: aws.String("i-n1")}},
@@ -373,7 +394,7 @@ func TestDistributeInstances_SuccessfulSpread(t *testing.T) {
 	defer sub1.Unsubscribe()
 
 	// Mock daemon on node-2
-	sub2, err := nc.Subscribe("ec2.RunInstances.t3.micro.node-2", func(msg *nats.Msg) {
+	sub2, err := nc.Subscribe(subjects.RunInstancesOnNode("t3.micro", "node-2"), func(msg *nats.Msg) {
 		reservation := ec2.Reservation{
 			ReservationId: aws.String("r-test2"),
 			Instances:     []*ec2.Instance{{InstanceId: aws.String("i-n2")}},
@@ -393,7 +414,7 @@ func TestDistributeInstances_SuccessfulSpread(t *testing.T) {
 		MaxCount:     aws.Int64(2),
 	}
 
-	reservation, err := distributeInstances(input, nc, "test-account")
+	reservation, err := distributeInstances(context.Background(), input, nc, "test-account")
 	require.NoError(t, err)
 	assert.Len(t, reservation.Instances, 2)
 
@@ -410,7 +431,7 @@ func TestDistributeInstances_InsufficientCapacity(t *testing.T) {
 	_, nc := startTestNATSServer(t)
 
 	// Mock node.status with only 1 available slot total
-	statusSub, err := nc.Subscribe("spinifex.node.status", func(msg *nats.Msg) {
+	statusSub, err := nc.Subscribe(subjects.NodeStatus, func(msg *nats.Msg) {
 		resp := types.NodeStatusResponse{
 			Node:          "node-1",
 			InstanceTypes: []types.InstanceTypeCap{{Name: "t3.micro", Available: 1}},
@@ -430,7 +451,7 @@ func TestDistributeInstances_InsufficientCapacity(t *testing.T) {
 		MaxCount:     aws.Int64(3),
 	}
 
-	_, err = distributeInstances(input, nc, "test-account")
+	_, err = distributeInstances(context.Background(), input, nc, "test-account")
 	require.Error(t, err)
 	assert.Equal(t, awserrors.ErrorInsufficientInstanceCapacity, err.Error())
 }
@@ -439,7 +460,7 @@ func TestDistributeInstances_PropagatesAMINotFound(t *testing.T) {
 	_, nc := startTestNATSServer(t)
 
 	// Mock node.status with capacity available
-	statusSub, err := nc.Subscribe("spinifex.node.status", func(msg *nats.Msg) {
+	statusSub, err := nc.Subscribe(subjects.NodeStatus, func(msg *nats.Msg) {
 		resp := types.NodeStatusResponse{
 			Node:          "node-1",
 			InstanceTypes: []types.InstanceTypeCap{{Name: "t3.micro", Available: 2}},
@@ -451,7 +472,7 @@ func TestDistributeInstances_PropagatesAMINotFound(t *testing.T) {
 	defer statusSub.Unsubscribe()
 
 	// Mock daemon responds with InvalidAMIID.NotFound (AMI doesn't exist)
-	sub1, err := nc.Subscribe("ec2.RunInstances.t3.micro.node-1", func(msg *nats.Msg) {
+	sub1, err := nc.Subscribe(subjects.RunInstancesOnNode("t3.micro", "node-1"), func(msg *nats.Msg) {
 		_ = msg.Respond(utils.GenerateErrorPayload(awserrors.ErrorInvalidAMIIDNotFound))
 	})
 	require.NoError(t, err)
@@ -466,7 +487,7 @@ func TestDistributeInstances_PropagatesAMINotFound(t *testing.T) {
 		MaxCount:     aws.Int64(1),
 	}
 
-	_, err = distributeInstances(input, nc, "test-account")
+	_, err = distributeInstances(context.Background(), input, nc, "test-account")
 	require.Error(t, err)
 	assert.Equal(t, awserrors.ErrorInvalidAMIIDNotFound, err.Error(),
 		"should propagate InvalidAMIID.NotFound, not InsufficientInstanceCapacity")
@@ -476,7 +497,7 @@ func TestDistributeInstances_LaunchCountCappedToMaxCount(t *testing.T) {
 	_, nc := startTestNATSServer(t)
 
 	// 3 nodes with capacity, but MaxCount=2
-	statusSub, err := nc.Subscribe("spinifex.node.status", func(msg *nats.Msg) {
+	statusSub, err := nc.Subscribe(subjects.NodeStatus, func(msg *nats.Msg) {
 		for _, resp := range []types.NodeStatusResponse{
 			{Node: "node-1", InstanceTypes: []types.InstanceTypeCap{{Name: "t3.micro", Available: 4}}},
 			{Node: "node-2", InstanceTypes: []types.InstanceTypeCap{{Name: "t3.micro", Available: 3}}},
@@ -491,7 +512,7 @@ func TestDistributeInstances_LaunchCountCappedToMaxCount(t *testing.T) {
 
 	// Mock daemons — each returns 1 instance
 	for _, nodeID := range []string{"node-1", "node-2"} {
-		sub, err := nc.Subscribe("ec2.RunInstances.t3.micro."+nodeID, func(msg *nats.Msg) {
+		sub, err := nc.Subscribe(subjects.RunInstancesOnNode("t3.micro", nodeID), func(msg *nats.Msg) {
 			reservation := ec2.Reservation{
 				ReservationId: aws.String("r-" + nodeID),
 				Instances:     []*ec2.Instance{{InstanceId: aws.String("i-" + nodeID)}},
@@ -512,7 +533,7 @@ func TestDistributeInstances_LaunchCountCappedToMaxCount(t *testing.T) {
 		MaxCount:     aws.Int64(2),
 	}
 
-	reservation, err := distributeInstances(input, nc, "test-account")
+	reservation, err := distributeInstances(context.Background(), input, nc, "test-account")
 	require.NoError(t, err)
 	// Should launch exactly 2 (MaxCount), not 3 (total capacity)
 	assert.Len(t, reservation.Instances, 2)
@@ -531,7 +552,7 @@ func TestDistributeInstances_NoNodesAvailable(t *testing.T) {
 		MaxCount:     aws.Int64(2),
 	}
 
-	_, err := distributeInstances(input, nc, "test-account")
+	_, err := distributeInstances(context.Background(), input, nc, "test-account")
 	require.Error(t, err)
 	assert.Equal(t, awserrors.ErrorInsufficientInstanceCapacity, err.Error())
 }
@@ -544,7 +565,7 @@ func TestRunInstances_SingleInstanceDistributes(t *testing.T) {
 	_, nc := startTestNATSServer(t)
 
 	// Mock node status response (1 node with capacity)
-	statusSub, err := nc.Subscribe("spinifex.node.status", func(msg *nats.Msg) {
+	statusSub, err := nc.Subscribe(subjects.NodeStatus, func(msg *nats.Msg) {
 		resp := types.NodeStatusResponse{
 			Node:          "node-1",
 			InstanceTypes: []types.InstanceTypeCap{{Name: "t3.micro", Available: 4}},
@@ -556,7 +577,7 @@ func TestRunInstances_SingleInstanceDistributes(t *testing.T) {
 	defer statusSub.Unsubscribe()
 
 	// Mock the node-specific handler (targeted topic)
-	nodeSub, err := nc.Subscribe("ec2.RunInstances.t3.micro.node-1", func(msg *nats.Msg) {
+	nodeSub, err := nc.Subscribe(subjects.RunInstancesOnNode("t3.micro", "node-1"), func(msg *nats.Msg) {
 		reservation := ec2.Reservation{
 			ReservationId: aws.String("r-single"),
 			Instances:     []*ec2.Instance{{InstanceId: aws.String("i-single")}},
@@ -714,7 +735,7 @@ func TestDistributeInstancesCluster_FirstLaunchPicksBestNode(t *testing.T) {
 	_, nc := startTestNATSServer(t)
 
 	// Mock node.status: node-1 has 4, node-2 has 6 (node-2 should be picked)
-	statusSub, err := nc.Subscribe("spinifex.node.status", func(msg *nats.Msg) {
+	statusSub, err := nc.Subscribe(subjects.NodeStatus, func(msg *nats.Msg) {
 		for _, resp := range []types.NodeStatusResponse{
 			{Node: "node-1", InstanceTypes: []types.InstanceTypeCap{{Name: "t3.micro", Available: 4}}},
 			{Node: "node-2", InstanceTypes: []types.InstanceTypeCap{{Name: "t3.micro", Available: 6}}},
@@ -738,7 +759,7 @@ func TestDistributeInstancesCluster_FirstLaunchPicksBestNode(t *testing.T) {
 	defer reserveSub.Unsubscribe()
 
 	// Mock daemon on node-2
-	daemonSub, err := nc.Subscribe("ec2.RunInstances.t3.micro.node-2", func(msg *nats.Msg) {
+	daemonSub, err := nc.Subscribe(subjects.RunInstancesOnNode("t3.micro", "node-2"), func(msg *nats.Msg) {
 		reservation := ec2.Reservation{
 			ReservationId: aws.String("r-cluster"),
 			Instances: []*ec2.Instance{
@@ -770,7 +791,7 @@ func TestDistributeInstancesCluster_FirstLaunchPicksBestNode(t *testing.T) {
 		MaxCount:     aws.Int64(3),
 	}
 
-	reservation, err := distributeInstancesCluster(input, nc, "test-account", "my-cluster-group")
+	reservation, err := distributeInstancesCluster(context.Background(), input, nc, "test-account", "my-cluster-group")
 	require.NoError(t, err)
 	assert.Len(t, reservation.Instances, 3)
 
@@ -785,7 +806,7 @@ func TestDistributeInstancesCluster_SubsequentLaunchPinsToExistingNode(t *testin
 	_, nc := startTestNATSServer(t)
 
 	// Mock node.status: both nodes have capacity
-	statusSub, err := nc.Subscribe("spinifex.node.status", func(msg *nats.Msg) {
+	statusSub, err := nc.Subscribe(subjects.NodeStatus, func(msg *nats.Msg) {
 		for _, resp := range []types.NodeStatusResponse{
 			{Node: "node-1", InstanceTypes: []types.InstanceTypeCap{{Name: "t3.micro", Available: 5}}},
 			{Node: "node-2", InstanceTypes: []types.InstanceTypeCap{{Name: "t3.micro", Available: 3}}},
@@ -810,13 +831,13 @@ func TestDistributeInstancesCluster_SubsequentLaunchPinsToExistingNode(t *testin
 
 	// Mock daemon on node-2 only — node-1 should NOT be contacted
 	node1Contacted := false
-	node1Sub, err := nc.Subscribe("ec2.RunInstances.t3.micro.node-1", func(msg *nats.Msg) {
+	node1Sub, err := nc.Subscribe(subjects.RunInstancesOnNode("t3.micro", "node-1"), func(msg *nats.Msg) {
 		node1Contacted = true
 	})
 	require.NoError(t, err)
 	defer node1Sub.Unsubscribe()
 
-	daemonSub, err := nc.Subscribe("ec2.RunInstances.t3.micro.node-2", func(msg *nats.Msg) {
+	daemonSub, err := nc.Subscribe(subjects.RunInstancesOnNode("t3.micro", "node-2"), func(msg *nats.Msg) {
 		reservation := ec2.Reservation{
 			ReservationId: aws.String("r-cluster2"),
 			Instances: []*ec2.Instance{
@@ -847,7 +868,7 @@ func TestDistributeInstancesCluster_SubsequentLaunchPinsToExistingNode(t *testin
 		MaxCount:     aws.Int64(2),
 	}
 
-	reservation, err := distributeInstancesCluster(input, nc, "test-account", "my-cluster-group")
+	reservation, err := distributeInstancesCluster(context.Background(), input, nc, "test-account", "my-cluster-group")
 	require.NoError(t, err)
 	assert.Len(t, reservation.Instances, 2)
 	assert.False(t, node1Contacted, "cluster should only contact the pinned node")
@@ -858,7 +879,7 @@ func TestDistributeInstancesCluster_InsufficientCapacityOnPinnedNode(t *testing.
 	_, nc := startTestNATSServer(t)
 
 	// Mock node.status: pinned node-2 has only 1 slot, node-1 has plenty
-	statusSub, err := nc.Subscribe("spinifex.node.status", func(msg *nats.Msg) {
+	statusSub, err := nc.Subscribe(subjects.NodeStatus, func(msg *nats.Msg) {
 		for _, resp := range []types.NodeStatusResponse{
 			{Node: "node-1", InstanceTypes: []types.InstanceTypeCap{{Name: "t3.micro", Available: 10}}},
 			{Node: "node-2", InstanceTypes: []types.InstanceTypeCap{{Name: "t3.micro", Available: 1}}},
@@ -890,7 +911,7 @@ func TestDistributeInstancesCluster_InsufficientCapacityOnPinnedNode(t *testing.
 		MaxCount:     aws.Int64(3),
 	}
 
-	_, err = distributeInstancesCluster(input, nc, "test-account", "my-cluster-group")
+	_, err = distributeInstancesCluster(context.Background(), input, nc, "test-account", "my-cluster-group")
 	require.Error(t, err)
 	assert.Equal(t, awserrors.ErrorInsufficientInstanceCapacity, err.Error())
 }
@@ -900,7 +921,7 @@ func TestDistributeInstancesCluster_PinnedNodeNotInCapacityResults(t *testing.T)
 	_, nc := startTestNATSServer(t)
 
 	// Mock node.status: only node-1 has capacity (pinned node-2 is at 0)
-	statusSub, err := nc.Subscribe("spinifex.node.status", func(msg *nats.Msg) {
+	statusSub, err := nc.Subscribe(subjects.NodeStatus, func(msg *nats.Msg) {
 		resp := types.NodeStatusResponse{
 			Node:          "node-1",
 			InstanceTypes: []types.InstanceTypeCap{{Name: "t3.micro", Available: 5}},
@@ -931,7 +952,7 @@ func TestDistributeInstancesCluster_PinnedNodeNotInCapacityResults(t *testing.T)
 		MaxCount:     aws.Int64(1),
 	}
 
-	_, err = distributeInstancesCluster(input, nc, "test-account", "my-cluster-group")
+	_, err = distributeInstancesCluster(context.Background(), input, nc, "test-account", "my-cluster-group")
 	require.Error(t, err)
 	assert.Equal(t, awserrors.ErrorInsufficientInstanceCapacity, err.Error())
 }
@@ -940,7 +961,7 @@ func TestDistributeInstancesCluster_LaunchCountCappedByCapacityAndMaxCount(t *te
 	// Target node has 3 available but MaxCount=2 → should launch 2
 	_, nc := startTestNATSServer(t)
 
-	statusSub, err := nc.Subscribe("spinifex.node.status", func(msg *nats.Msg) {
+	statusSub, err := nc.Subscribe(subjects.NodeStatus, func(msg *nats.Msg) {
 		resp := types.NodeStatusResponse{
 			Node:          "node-1",
 			InstanceTypes: []types.InstanceTypeCap{{Name: "t3.micro", Available: 3}},
@@ -962,7 +983,7 @@ func TestDistributeInstancesCluster_LaunchCountCappedByCapacityAndMaxCount(t *te
 	defer reserveSub.Unsubscribe()
 
 	// Daemon returns 2 instances (matching assigned count)
-	daemonSub, err := nc.Subscribe("ec2.RunInstances.t3.micro.node-1", func(msg *nats.Msg) {
+	daemonSub, err := nc.Subscribe(subjects.RunInstancesOnNode("t3.micro", "node-1"), func(msg *nats.Msg) {
 		var reqInput ec2.RunInstancesInput
 		_ = json.Unmarshal(msg.Data, &reqInput)
 		count := int(aws.Int64Value(reqInput.MaxCount))
@@ -996,7 +1017,7 @@ func TestDistributeInstancesCluster_LaunchCountCappedByCapacityAndMaxCount(t *te
 		MaxCount:     aws.Int64(2),
 	}
 
-	reservation, err := distributeInstancesCluster(input, nc, "test-account", "my-cluster-group")
+	reservation, err := distributeInstancesCluster(context.Background(), input, nc, "test-account", "my-cluster-group")
 	require.NoError(t, err)
 	assert.Len(t, reservation.Instances, 2, "should launch min(MaxCount=2, capacity=3) = 2")
 }
@@ -1024,7 +1045,7 @@ func TestRunInstances_ClusterPlacementGroupRouting(t *testing.T) {
 	defer pgSub.Unsubscribe()
 
 	// Mock node.status
-	statusSub, err := nc.Subscribe("spinifex.node.status", func(msg *nats.Msg) {
+	statusSub, err := nc.Subscribe(subjects.NodeStatus, func(msg *nats.Msg) {
 		resp := types.NodeStatusResponse{
 			Node:          "node-1",
 			InstanceTypes: []types.InstanceTypeCap{{Name: "t3.micro", Available: 5}},
@@ -1047,7 +1068,7 @@ func TestRunInstances_ClusterPlacementGroupRouting(t *testing.T) {
 	defer reserveSub.Unsubscribe()
 
 	// Mock daemon
-	daemonSub, err := nc.Subscribe("ec2.RunInstances.t3.micro.node-1", func(msg *nats.Msg) {
+	daemonSub, err := nc.Subscribe(subjects.RunInstancesOnNode("t3.micro", "node-1"), func(msg *nats.Msg) {
 		reservation := ec2.Reservation{
 			ReservationId: aws.String("r-cluster"),
 			Instances: []*ec2.Instance{
@@ -1093,7 +1114,7 @@ func TestRunInstances_MultiInstanceUsesDistribution(t *testing.T) {
 	_, nc := startTestNATSServer(t)
 
 	statusQueried := false
-	statusSub, err := nc.Subscribe("spinifex.node.status", func(msg *nats.Msg) {
+	statusSub, err := nc.Subscribe(subjects.NodeStatus, func(msg *nats.Msg) {
 		statusQueried = true
 		resp := types.NodeStatusResponse{
 			Node:          "node-1",
@@ -1106,7 +1127,7 @@ func TestRunInstances_MultiInstanceUsesDistribution(t *testing.T) {
 	defer statusSub.Unsubscribe()
 
 	// Mock node-specific handler
-	nodeSub, err := nc.Subscribe("ec2.RunInstances.t3.micro.node-1", func(msg *nats.Msg) {
+	nodeSub, err := nc.Subscribe(subjects.RunInstancesOnNode("t3.micro", "node-1"), func(msg *nats.Msg) {
 		reservation := ec2.Reservation{
 			ReservationId: aws.String("r-multi"),
 			Instances: []*ec2.Instance{
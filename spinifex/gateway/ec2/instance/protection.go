@@ -0,0 +1,30 @@
+package gateway_ec2_instance
+
+import (
+	"strings"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+)
+
+// protectedInstances collects the daemon errors of instances a bulk stop or
+// terminate skipped because of their stop or termination protection, so
+// the rest of the batch still goes ahead.
+type protectedInstances []string
+
+// add records replyErr if it reports a protected instance.
+func (p *protectedInstances) add(replyErr *awserrors.Error) bool {
+	if replyErr.Code != awserrors.ErrorOperationNotPermitted {
+		return false
+	}
+	*p = append(*p, replyErr.Message)
+	return true
+}
+
+// err returns the OperationNotPermitted error naming each protection that
+// blocked the batch, or nil when none did.
+func (p protectedInstances) err() error {
+	if len(p) == 0 {
+		return nil
+	}
+	return awserrors.WithDetail(awserrors.ErrorOperationNotPermitted, strings.Join(p, " "))
+}
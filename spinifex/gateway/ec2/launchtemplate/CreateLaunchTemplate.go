@@ -0,0 +1,38 @@
+package gateway_ec2_launchtemplate
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_ec2_launchtemplate "github.com/mulgadc/spinifex/spinifex/handlers/ec2/launchtemplate"
+	"github.com/nats-io/nats.go"
+)
+
+// ValidateCreateLaunchTemplateInput validates the input parameters
+func ValidateCreateLaunchTemplateInput(input *ec2.CreateLaunchTemplateInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if input.LaunchTemplateName == nil || *input.LaunchTemplateName == "" || input.LaunchTemplateData == nil {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	return handlers_ec2_launchtemplate.ValidateTemplateName(*input.LaunchTemplateName)
+}
+
+// CreateLaunchTemplate handles the EC2 CreateLaunchTemplate API call
+func CreateLaunchTemplate(input *ec2.CreateLaunchTemplateInput, natsConn *nats.Conn, accountID string) (ec2.CreateLaunchTemplateOutput, error) {
+	var output ec2.CreateLaunchTemplateOutput
+
+	if err := ValidateCreateLaunchTemplateInput(input); err != nil {
+		return output, err
+	}
+
+	svc := handlers_ec2_launchtemplate.NewNATSLaunchTemplateService(natsConn)
+	result, err := svc.CreateLaunchTemplate(input, accountID)
+	if err != nil {
+		return output, err
+	}
+
+	return *result, nil
+}
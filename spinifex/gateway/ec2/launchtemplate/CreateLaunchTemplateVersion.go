@@ -0,0 +1,38 @@
+package gateway_ec2_launchtemplate
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_ec2_launchtemplate "github.com/mulgadc/spinifex/spinifex/handlers/ec2/launchtemplate"
+	"github.com/nats-io/nats.go"
+)
+
+// ValidateCreateLaunchTemplateVersionInput validates the input parameters
+func ValidateCreateLaunchTemplateVersionInput(input *ec2.CreateLaunchTemplateVersionInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if input.LaunchTemplateData == nil {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	return handlers_ec2_launchtemplate.ValidateTemplateRef(input.LaunchTemplateId, input.LaunchTemplateName)
+}
+
+// CreateLaunchTemplateVersion handles the EC2 CreateLaunchTemplateVersion API call
+func CreateLaunchTemplateVersion(input *ec2.CreateLaunchTemplateVersionInput, natsConn *nats.Conn, accountID string) (ec2.CreateLaunchTemplateVersionOutput, error) {
+	var output ec2.CreateLaunchTemplateVersionOutput
+
+	if err := ValidateCreateLaunchTemplateVersionInput(input); err != nil {
+		return output, err
+	}
+
+	svc := handlers_ec2_launchtemplate.NewNATSLaunchTemplateService(natsConn)
+	result, err := svc.CreateLaunchTemplateVersion(input, accountID)
+	if err != nil {
+		return output, err
+	}
+
+	return *result, nil
+}
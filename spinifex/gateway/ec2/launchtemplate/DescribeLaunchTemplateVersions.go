@@ -0,0 +1,35 @@
+package gateway_ec2_launchtemplate
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_ec2_launchtemplate "github.com/mulgadc/spinifex/spinifex/handlers/ec2/launchtemplate"
+	"github.com/nats-io/nats.go"
+)
+
+// ValidateDescribeLaunchTemplateVersionsInput validates the input parameters
+func ValidateDescribeLaunchTemplateVersionsInput(input *ec2.DescribeLaunchTemplateVersionsInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	return handlers_ec2_launchtemplate.ValidateTemplateRef(input.LaunchTemplateId, input.LaunchTemplateName)
+}
+
+// DescribeLaunchTemplateVersions handles the EC2 DescribeLaunchTemplateVersions API call
+func DescribeLaunchTemplateVersions(input *ec2.DescribeLaunchTemplateVersionsInput, natsConn *nats.Conn, accountID string) (ec2.DescribeLaunchTemplateVersionsOutput, error) {
+	var output ec2.DescribeLaunchTemplateVersionsOutput
+
+	if err := ValidateDescribeLaunchTemplateVersionsInput(input); err != nil {
+		return output, err
+	}
+
+	svc := handlers_ec2_launchtemplate.NewNATSLaunchTemplateService(natsConn)
+	result, err := svc.DescribeLaunchTemplateVersions(input, accountID)
+	if err != nil {
+		return output, err
+	}
+
+	return *result, nil
+}
@@ -0,0 +1,20 @@
+package gateway_ec2_launchtemplate
+
+import (
+	"github.com/aws/aws-sdk-go/service/ec2"
+	handlers_ec2_launchtemplate "github.com/mulgadc/spinifex/spinifex/handlers/ec2/launchtemplate"
+	"github.com/nats-io/nats.go"
+)
+
+// DescribeLaunchTemplates handles the EC2 DescribeLaunchTemplates API call
+func DescribeLaunchTemplates(input *ec2.DescribeLaunchTemplatesInput, natsConn *nats.Conn, accountID string) (ec2.DescribeLaunchTemplatesOutput, error) {
+	var output ec2.DescribeLaunchTemplatesOutput
+
+	svc := handlers_ec2_launchtemplate.NewNATSLaunchTemplateService(natsConn)
+	result, err := svc.DescribeLaunchTemplates(input, accountID)
+	if err != nil {
+		return output, err
+	}
+
+	return *result, nil
+}
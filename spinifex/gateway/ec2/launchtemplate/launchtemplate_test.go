@@ -0,0 +1,57 @@
+package gateway_ec2_launchtemplate
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/stretchr/testify/assert"
+)
+
+const testAccountID = "123456789012"
+
+func TestCreateLaunchTemplate_Validation(t *testing.T) {
+	_, err := CreateLaunchTemplate(nil, nil, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorInvalidParameterValue)
+
+	_, err = CreateLaunchTemplate(&ec2.CreateLaunchTemplateInput{LaunchTemplateName: aws.String("web-servers")}, nil, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorMissingParameter)
+
+	_, err = CreateLaunchTemplate(&ec2.CreateLaunchTemplateInput{
+		LaunchTemplateName: aws.String("web servers"),
+		LaunchTemplateData: &ec2.RequestLaunchTemplateData{},
+	}, nil, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorInvalidLaunchTemplateNameMalformedException)
+}
+
+func TestCreateLaunchTemplateVersion_Validation(t *testing.T) {
+	_, err := CreateLaunchTemplateVersion(&ec2.CreateLaunchTemplateVersionInput{LaunchTemplateId: aws.String("lt-123")}, nil, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorMissingParameter)
+
+	_, err = CreateLaunchTemplateVersion(&ec2.CreateLaunchTemplateVersionInput{
+		LaunchTemplateData: &ec2.RequestLaunchTemplateData{},
+	}, nil, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorMissingParameter)
+}
+
+func TestTemplateRef_Validation(t *testing.T) {
+	_, err := DeleteLaunchTemplate(&ec2.DeleteLaunchTemplateInput{LaunchTemplateId: aws.String("web-servers")}, nil, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorInvalidLaunchTemplateIdMalformed)
+
+	_, err = ModifyLaunchTemplate(&ec2.ModifyLaunchTemplateInput{
+		LaunchTemplateId: aws.String("lt-123"), LaunchTemplateName: aws.String("web-servers"),
+	}, nil, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorInvalidParameterCombination)
+
+	_, err = DescribeLaunchTemplateVersions(&ec2.DescribeLaunchTemplateVersionsInput{}, nil, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorMissingParameter)
+}
+
+func TestLaunchTemplates_NilNATS(t *testing.T) {
+	_, err := DeleteLaunchTemplate(&ec2.DeleteLaunchTemplateInput{LaunchTemplateId: aws.String("lt-123")}, nil, testAccountID)
+	assert.Error(t, err)
+
+	_, err = DescribeLaunchTemplates(&ec2.DescribeLaunchTemplatesInput{}, nil, testAccountID)
+	assert.Error(t, err)
+}
@@ -0,0 +1,132 @@
+package gateway_ec2_reservedinstances
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+)
+
+// Spinifex has no Reserved Instances: there is no offering to purchase, so
+// no reservation exists to modify or exchange. These actions validate their
+// input as AWS does and then report the reservation as not found, so cost
+// tooling that reconfigures RIs gets AWS errors instead of an unknown action.
+
+// Scopes a modification can target.
+const (
+	scopeAvailabilityZone = "Availability Zone"
+	scopeRegion           = "Region"
+)
+
+// ValidateModifyReservedInstancesInput validates the input for
+// ModifyReservedInstances.
+func ValidateModifyReservedInstancesInput(input *ec2.ModifyReservedInstancesInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	if err := validateReservedInstancesIDs(input.ReservedInstancesIds); err != nil {
+		return err
+	}
+	if len(input.TargetConfigurations) == 0 {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	for _, target := range input.TargetConfigurations {
+		if target == nil || aws.Int64Value(target.InstanceCount) <= 0 {
+			return errors.New(awserrors.ErrorInvalidInput)
+		}
+		if target.InstanceType != nil && *target.InstanceType == "" {
+			return errors.New(awserrors.ErrorInvalidInput)
+		}
+		switch aws.StringValue(target.Scope) {
+		case "", scopeAvailabilityZone:
+			if aws.StringValue(target.AvailabilityZone) == "" {
+				return errors.New(awserrors.ErrorInvalidInput)
+			}
+		case scopeRegion:
+			if target.AvailabilityZone != nil {
+				return errors.New(awserrors.ErrorInvalidInput)
+			}
+		default:
+			return errors.New(awserrors.ErrorInvalidInput)
+		}
+	}
+	return nil
+}
+
+// ModifyReservedInstances changes the instance type or scope of Reserved
+// Instances.
+func ModifyReservedInstances(input *ec2.ModifyReservedInstancesInput) (*ec2.ModifyReservedInstancesOutput, error) {
+	if err := ValidateModifyReservedInstancesInput(input); err != nil {
+		return nil, err
+	}
+	return nil, errors.New(awserrors.ErrorInvalidReservedInstancesId)
+}
+
+// ValidateGetReservedInstancesExchangeQuoteInput validates the input for
+// GetReservedInstancesExchangeQuote.
+func ValidateGetReservedInstancesExchangeQuoteInput(input *ec2.GetReservedInstancesExchangeQuoteInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	if err := validateReservedInstancesIDs(input.ReservedInstanceIds); err != nil {
+		return err
+	}
+	return validateExchangeTargets(input.TargetConfigurations)
+}
+
+// GetReservedInstancesExchangeQuote prices exchanging convertible Reserved
+// Instances for the target configurations.
+func GetReservedInstancesExchangeQuote(input *ec2.GetReservedInstancesExchangeQuoteInput) (*ec2.GetReservedInstancesExchangeQuoteOutput, error) {
+	if err := ValidateGetReservedInstancesExchangeQuoteInput(input); err != nil {
+		return nil, err
+	}
+	return nil, errors.New(awserrors.ErrorInvalidReservedInstancesId)
+}
+
+// ValidateAcceptReservedInstancesExchangeQuoteInput validates the input for
+// AcceptReservedInstancesExchangeQuote.
+func ValidateAcceptReservedInstancesExchangeQuoteInput(input *ec2.AcceptReservedInstancesExchangeQuoteInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	if err := validateReservedInstancesIDs(input.ReservedInstanceIds); err != nil {
+		return err
+	}
+	return validateExchangeTargets(input.TargetConfigurations)
+}
+
+// AcceptReservedInstancesExchangeQuote exchanges convertible Reserved
+// Instances for the target configurations.
+func AcceptReservedInstancesExchangeQuote(input *ec2.AcceptReservedInstancesExchangeQuoteInput) (*ec2.AcceptReservedInstancesExchangeQuoteOutput, error) {
+	if err := ValidateAcceptReservedInstancesExchangeQuoteInput(input); err != nil {
+		return nil, err
+	}
+	return nil, errors.New(awserrors.ErrorInvalidReservedInstancesId)
+}
+
+func validateReservedInstancesIDs(ids []*string) error {
+	if len(ids) == 0 {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	for _, id := range ids {
+		if aws.StringValue(id) == "" {
+			return errors.New(awserrors.ErrorInvalidReservedInstancesId)
+		}
+	}
+	return nil
+}
+
+// validateExchangeTargets checks the optional exchange targets, each of
+// which names a convertible offering.
+func validateExchangeTargets(targets []*ec2.TargetConfigurationRequest) error {
+	for _, target := range targets {
+		if target == nil || aws.StringValue(target.OfferingId) == "" {
+			return errors.New(awserrors.ErrorInvalidInput)
+		}
+		if target.InstanceCount != nil && *target.InstanceCount <= 0 {
+			return errors.New(awserrors.ErrorInvalidInput)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package gateway_ec2_reservedinstances
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateModifyReservedInstancesInput(t *testing.T) {
+	target := func(mut func(*ec2.ReservedInstancesConfiguration)) *ec2.ModifyReservedInstancesInput {
+		cfg := &ec2.ReservedInstancesConfiguration{
+			InstanceCount:    aws.Int64(2),
+			InstanceType:     aws.String("t3.small"),
+			Scope:            aws.String("Availability Zone"),
+			AvailabilityZone: aws.String("ap-southeast-2a"),
+		}
+		if mut != nil {
+			mut(cfg)
+		}
+		return &ec2.ModifyReservedInstancesInput{
+			ReservedInstancesIds: []*string{aws.String("b847fa93-e282-4f55-b59a-1342fexample")},
+			TargetConfigurations: []*ec2.ReservedInstancesConfiguration{cfg},
+		}
+	}
+
+	tests := []struct {
+		name  string
+		input *ec2.ModifyReservedInstancesInput
+		want  string
+	}{
+		{"nil input", nil, awserrors.ErrorMissingParameter},
+		{"missing ids", &ec2.ModifyReservedInstancesInput{}, awserrors.ErrorMissingParameter},
+		{"empty id", &ec2.ModifyReservedInstancesInput{ReservedInstancesIds: []*string{aws.String("")}}, awserrors.ErrorInvalidReservedInstancesId},
+		{"missing targets", &ec2.ModifyReservedInstancesInput{ReservedInstancesIds: []*string{aws.String("ri-1")}}, awserrors.ErrorMissingParameter},
+		{"zero count", target(func(c *ec2.ReservedInstancesConfiguration) { c.InstanceCount = aws.Int64(0) }), awserrors.ErrorInvalidInput},
+		{"empty type", target(func(c *ec2.ReservedInstancesConfiguration) { c.InstanceType = aws.String("") }), awserrors.ErrorInvalidInput},
+		{"zonal without zone", target(func(c *ec2.ReservedInstancesConfiguration) { c.AvailabilityZone = nil }), awserrors.ErrorInvalidInput},
+		{"regional with zone", target(func(c *ec2.ReservedInstancesConfiguration) { c.Scope = aws.String("Region") }), awserrors.ErrorInvalidInput},
+		{"bad scope", target(func(c *ec2.ReservedInstancesConfiguration) { c.Scope = aws.String("Global") }), awserrors.ErrorInvalidInput},
+		{"zonal", target(nil), ""},
+		{"regional", target(func(c *ec2.ReservedInstancesConfiguration) {
+			c.Scope = aws.String("Region")
+			c.AvailabilityZone = nil
+		}), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateModifyReservedInstancesInput(tt.input)
+			if tt.want == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Equal(t, tt.want, err.Error())
+		})
+	}
+}
+
+func TestModifyReservedInstances_NoReservation(t *testing.T) {
+	// A well-formed modification names a reservation that can't exist.
+	_, err := ModifyReservedInstances(&ec2.ModifyReservedInstancesInput{
+		ReservedInstancesIds: []*string{aws.String("b847fa93-e282-4f55-b59a-1342fexample")},
+		TargetConfigurations: []*ec2.ReservedInstancesConfiguration{{
+			InstanceCount: aws.Int64(1),
+			InstanceType:  aws.String("t3.large"),
+			Scope:         aws.String("Region"),
+		}},
+	})
+	assert.EqualError(t, err, awserrors.ErrorInvalidReservedInstancesId)
+}
+
+func TestReservedInstancesExchangeQuote(t *testing.T) {
+	ids := []*string{aws.String("b847fa93-e282-4f55-b59a-1342fexample")}
+
+	_, err := GetReservedInstancesExchangeQuote(&ec2.GetReservedInstancesExchangeQuoteInput{})
+	assert.EqualError(t, err, awserrors.ErrorMissingParameter)
+
+	_, err = GetReservedInstancesExchangeQuote(&ec2.GetReservedInstancesExchangeQuoteInput{
+		ReservedInstanceIds:  ids,
+		TargetConfigurations: []*ec2.TargetConfigurationRequest{{InstanceCount: aws.Int64(1)}},
+	})
+	assert.EqualError(t, err, awserrors.ErrorInvalidInput)
+
+	_, err = GetReservedInstancesExchangeQuote(&ec2.GetReservedInstancesExchangeQuoteInput{ReservedInstanceIds: ids})
+	assert.EqualError(t, err, awserrors.ErrorInvalidReservedInstancesId)
+
+	_, err = AcceptReservedInstancesExchangeQuote(&ec2.AcceptReservedInstancesExchangeQuoteInput{
+		ReservedInstanceIds:  ids,
+		TargetConfigurations: []*ec2.TargetConfigurationRequest{{OfferingId: aws.String("")}},
+	})
+	assert.EqualError(t, err, awserrors.ErrorInvalidInput)
+
+	_, err = AcceptReservedInstancesExchangeQuote(&ec2.AcceptReservedInstancesExchangeQuoteInput{
+		ReservedInstanceIds:  ids,
+		TargetConfigurations: []*ec2.TargetConfigurationRequest{{OfferingId: aws.String("ri-offering-1")}},
+	})
+	assert.EqualError(t, err, awserrors.ErrorInvalidReservedInstancesId)
+}
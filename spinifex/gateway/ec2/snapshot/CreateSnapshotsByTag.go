@@ -0,0 +1,40 @@
+package gateway_ec2_snapshot
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_ec2_snapshot "github.com/mulgadc/spinifex/spinifex/handlers/ec2/snapshot"
+	"github.com/nats-io/nats.go"
+)
+
+// ValidateCreateSnapshotsByTagInput validates the input parameters for CreateSnapshotsByTag
+func ValidateCreateSnapshotsByTagInput(input *handlers_ec2_snapshot.CreateSnapshotsByTagInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+
+	if len(input.Filters) == 0 {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+
+	for _, filter := range input.Filters {
+		if filter == nil || filter.Name == nil || !strings.HasPrefix(*filter.Name, "tag:") || len(filter.Values) == 0 {
+			return errors.New(awserrors.ErrorInvalidParameterValue)
+		}
+	}
+
+	return nil
+}
+
+// CreateSnapshotsByTag handles the CreateSnapshotsByTag spinifex extension,
+// snapshotting every volume whose tags match the filters.
+func CreateSnapshotsByTag(input *handlers_ec2_snapshot.CreateSnapshotsByTagInput, natsConn *nats.Conn, accountID string) (*handlers_ec2_snapshot.CreateSnapshotsByTagOutput, error) {
+	if err := ValidateCreateSnapshotsByTagInput(input); err != nil {
+		return nil, err
+	}
+
+	svc := handlers_ec2_snapshot.NewNATSSnapshotService(natsConn)
+	return svc.CreateSnapshotsByTag(input, accountID)
+}
@@ -0,0 +1,41 @@
+package gateway_ec2_snapshot
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_ec2_snapshot "github.com/mulgadc/spinifex/spinifex/handlers/ec2/snapshot"
+	"github.com/nats-io/nats.go"
+)
+
+// ValidateDescribeSnapshotTreeInput validates the input parameters for DescribeSnapshotTree
+func ValidateDescribeSnapshotTreeInput(input *handlers_ec2_snapshot.DescribeSnapshotTreeInput) error {
+	if input == nil {
+		return nil
+	}
+
+	if input.SnapshotID != "" && !strings.HasPrefix(input.SnapshotID, "snap-") {
+		return errors.New(awserrors.ErrorInvalidSnapshotIDMalformed)
+	}
+
+	return nil
+}
+
+// DescribeSnapshotTree handles the DescribeSnapshotTree spinifex extension, returning
+// the snapshot lineage visible to the caller.
+func DescribeSnapshotTree(input *handlers_ec2_snapshot.DescribeSnapshotTreeInput, natsConn *nats.Conn, accountID string) (handlers_ec2_snapshot.DescribeSnapshotTreeOutput, error) {
+	var output handlers_ec2_snapshot.DescribeSnapshotTreeOutput
+
+	if err := ValidateDescribeSnapshotTreeInput(input); err != nil {
+		return output, err
+	}
+
+	svc := handlers_ec2_snapshot.NewNATSSnapshotService(natsConn)
+	result, err := svc.DescribeSnapshotTree(input, accountID)
+	if err != nil {
+		return output, err
+	}
+
+	return *result, nil
+}
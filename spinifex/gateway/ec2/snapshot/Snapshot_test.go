@@ -6,6 +6,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_ec2_snapshot "github.com/mulgadc/spinifex/spinifex/handlers/ec2/snapshot"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -293,3 +294,29 @@ func TestCopySnapshot_NilNATS(t *testing.T) {
 	}, nil, "acct-123")
 	assert.Error(t, err)
 }
+
+func TestDescribeSnapshotTree_ValidationErrors(t *testing.T) {
+	assert.NoError(t, ValidateDescribeSnapshotTreeInput(nil))
+	assert.NoError(t, ValidateDescribeSnapshotTreeInput(&handlers_ec2_snapshot.DescribeSnapshotTreeInput{}))
+
+	_, err := DescribeSnapshotTree(&handlers_ec2_snapshot.DescribeSnapshotTreeInput{SnapshotID: "bad"}, nil, "")
+	assert.EqualError(t, err, awserrors.ErrorInvalidSnapshotIDMalformed)
+}
+
+func TestCreateSnapshotsByTag_ValidationErrors(t *testing.T) {
+	_, err := CreateSnapshotsByTag(nil, nil, "")
+	assert.EqualError(t, err, awserrors.ErrorInvalidParameterValue)
+
+	_, err = CreateSnapshotsByTag(&handlers_ec2_snapshot.CreateSnapshotsByTagInput{}, nil, "")
+	assert.EqualError(t, err, awserrors.ErrorMissingParameter)
+
+	_, err = CreateSnapshotsByTag(&handlers_ec2_snapshot.CreateSnapshotsByTagInput{
+		Filters: []*ec2.Filter{{Name: aws.String("volume-id"), Values: []*string{aws.String("vol-1")}}},
+	}, nil, "")
+	assert.EqualError(t, err, awserrors.ErrorInvalidParameterValue)
+
+	_, err = CreateSnapshotsByTag(&handlers_ec2_snapshot.CreateSnapshotsByTagInput{
+		Filters: []*ec2.Filter{{Name: aws.String("tag:Backup")}},
+	}, nil, "")
+	assert.EqualError(t, err, awserrors.ErrorInvalidParameterValue)
+}
@@ -0,0 +1,61 @@
+package gateway_ec2_tags
+
+import (
+	"errors"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_ec2_tags "github.com/mulgadc/spinifex/spinifex/handlers/ec2/tags"
+	"github.com/nats-io/nats.go"
+)
+
+// ValidateBatchCreateTagsInput validates the input parameters for BatchCreateTags
+func ValidateBatchCreateTagsInput(input *handlers_ec2_tags.BatchCreateTagsInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+
+	if len(input.Resources) == 0 || len(input.Tags) == 0 {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+
+	for _, tag := range input.Tags {
+		if tag == nil || tag.Key == nil || *tag.Key == "" {
+			return errors.New(awserrors.ErrorInvalidParameterValue)
+		}
+	}
+
+	return nil
+}
+
+// BatchCreateTags handles the spinifex BatchCreateTags extension
+func BatchCreateTags(input *handlers_ec2_tags.BatchCreateTagsInput, natsConn *nats.Conn, accountID string) (*handlers_ec2_tags.BatchTagsOutput, error) {
+	if err := ValidateBatchCreateTagsInput(input); err != nil {
+		return nil, err
+	}
+
+	svc := handlers_ec2_tags.NewNATSTagsService(natsConn)
+	return svc.BatchCreateTags(input, accountID)
+}
+
+// ValidateBatchDeleteTagsInput validates the input parameters for BatchDeleteTags
+func ValidateBatchDeleteTagsInput(input *handlers_ec2_tags.BatchDeleteTagsInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+
+	if len(input.Resources) == 0 {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+
+	return nil
+}
+
+// BatchDeleteTags handles the spinifex BatchDeleteTags extension
+func BatchDeleteTags(input *handlers_ec2_tags.BatchDeleteTagsInput, natsConn *nats.Conn, accountID string) (*handlers_ec2_tags.BatchTagsOutput, error) {
+	if err := ValidateBatchDeleteTagsInput(input); err != nil {
+		return nil, err
+	}
+
+	svc := handlers_ec2_tags.NewNATSTagsService(natsConn)
+	return svc.BatchDeleteTags(input, accountID)
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_ec2_tags "github.com/mulgadc/spinifex/spinifex/handlers/ec2/tags"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -60,3 +61,27 @@ func TestDescribeTags_NilNATS(t *testing.T) {
 	_, err = DescribeTags(&ec2.DescribeTagsInput{}, nil, "acct-123")
 	assert.Error(t, err)
 }
+
+func TestBatchCreateTags_ValidationErrors(t *testing.T) {
+	_, err := BatchCreateTags(nil, nil, "")
+	assert.EqualError(t, err, awserrors.ErrorInvalidParameterValue)
+
+	_, err = BatchCreateTags(&handlers_ec2_tags.BatchCreateTagsInput{
+		Resources: []*string{aws.String("i-123")},
+	}, nil, "")
+	assert.EqualError(t, err, awserrors.ErrorMissingParameter)
+
+	_, err = BatchCreateTags(&handlers_ec2_tags.BatchCreateTagsInput{
+		Resources: []*string{aws.String("i-123")},
+		Tags:      []*ec2.Tag{{Key: aws.String(""), Value: aws.String("v")}},
+	}, nil, "")
+	assert.EqualError(t, err, awserrors.ErrorInvalidParameterValue)
+}
+
+func TestBatchDeleteTags_ValidationErrors(t *testing.T) {
+	_, err := BatchDeleteTags(nil, nil, "")
+	assert.EqualError(t, err, awserrors.ErrorInvalidParameterValue)
+
+	_, err = BatchDeleteTags(&handlers_ec2_tags.BatchDeleteTagsInput{}, nil, "")
+	assert.EqualError(t, err, awserrors.ErrorMissingParameter)
+}
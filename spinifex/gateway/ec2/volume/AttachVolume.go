@@ -3,32 +3,44 @@ package gateway_ec2_volume
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
 	"github.com/mulgadc/spinifex/spinifex/types"
 	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/nats-io/nats.go"
 )
 
-// ValidateAttachVolumeInput validates the input parameters for AttachVolume
+// ValidateAttachVolumeInput validates the input parameters for AttachVolume.
+// Missing parameters (VolumeId, then InstanceId) are reported before
+// malformed IDs, so an input with several problems always reports the same
+// one.
 func ValidateAttachVolumeInput(input *ec2.AttachVolumeInput) error {
 	if input == nil {
 		return errors.New(awserrors.ErrorInvalidParameterValue)
 	}
 
+	// Required parameters
 	if input.VolumeId == nil || *input.VolumeId == "" {
 		return errors.New(awserrors.ErrorInvalidParameterValue)
 	}
-
 	if input.InstanceId == nil || *input.InstanceId == "" {
 		return errors.New(awserrors.ErrorInvalidParameterValue)
 	}
 
+	// ID formats
+	if !strings.HasPrefix(*input.VolumeId, "vol-") {
+		return errors.New(awserrors.ErrorInvalidVolumeIDMalformed)
+	}
+	if !strings.HasPrefix(*input.InstanceId, "i-") {
+		return errors.New(awserrors.ErrorInvalidInstanceIDMalformed)
+	}
+
 	return nil
 }
 
@@ -65,8 +77,8 @@ func AttachVolume(input *ec2.AttachVolumeInput, natsConn *nats.Conn, accountID s
 		return output, errors.New(awserrors.ErrorServerInternal)
 	}
 
-	subject := fmt.Sprintf("ec2.cmd.%s", instanceID)
-	reqMsg := nats.NewMsg(subject)
+	subject := subjects.InstanceCmd(instanceID)
+	reqMsg := nats.NewMsg(utils.Subject(subject))
 	reqMsg.Data = jsonData
 	reqMsg.Header.Set(utils.AccountIDHeader, accountID)
 	msg, err := natsConn.RequestMsg(reqMsg, 30*time.Second)
@@ -82,12 +94,11 @@ func AttachVolume(input *ec2.AttachVolumeInput, natsConn *nats.Conn, accountID s
 		return output, errors.New(awserrors.ErrorServerInternal)
 	}
 
-	responseError, err := utils.ValidateErrorPayload(msg.Data)
-	if err != nil {
-		return output, errors.New(*responseError.Code)
+	reply := utils.DecodeReply(msg)
+	if reply.Err != nil {
+		return output, reply.Err
 	}
-
-	if err := json.Unmarshal(msg.Data, &output); err != nil {
+	if err := reply.Decode(&output); err != nil {
 		slog.Error("AttachVolume: Failed to unmarshal response", "err", err)
 		return output, errors.New(awserrors.ErrorServerInternal)
 	}
@@ -107,7 +118,7 @@ func isStoppedInstance(instanceID string, natsConn *nats.Conn, accountID string)
 		return false
 	}
 
-	reqMsg := nats.NewMsg("ec2.DescribeStoppedInstances")
+	reqMsg := nats.NewMsg(utils.Subject("ec2.DescribeStoppedInstances"))
 	reqMsg.Data = reqData
 	reqMsg.Header.Set(utils.AccountIDHeader, accountID)
 	msg, err := natsConn.RequestMsg(reqMsg, 3*time.Second)
@@ -115,12 +126,8 @@ func isStoppedInstance(instanceID string, natsConn *nats.Conn, accountID string)
 		return false
 	}
 
-	if _, err := utils.ValidateErrorPayload(msg.Data); err != nil {
-		return false
-	}
-
 	var output ec2.DescribeInstancesOutput
-	if err := json.Unmarshal(msg.Data, &output); err != nil {
+	if err := utils.DecodeReply(msg).Decode(&output); err != nil {
 		return false
 	}
 
@@ -94,3 +94,33 @@ func TestValidateAttachVolumeInput(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateAttachVolumeInput_Precedence(t *testing.T) {
+	tests := []struct {
+		name  string
+		input *ec2.AttachVolumeInput
+		want  string
+	}{
+		{
+			name:  "MissingInstanceBeforeMalformedVolume",
+			input: &ec2.AttachVolumeInput{VolumeId: aws.String("v-123")},
+			want:  awserrors.ErrorInvalidParameterValue,
+		},
+		{
+			name:  "MalformedVolumeBeforeMalformedInstance",
+			input: &ec2.AttachVolumeInput{VolumeId: aws.String("v-123"), InstanceId: aws.String("inst-1")},
+			want:  awserrors.ErrorInvalidVolumeIDMalformed,
+		},
+		{
+			name:  "MalformedInstance",
+			input: &ec2.AttachVolumeInput{VolumeId: aws.String("vol-123"), InstanceId: aws.String("inst-1")},
+			want:  awserrors.ErrorInvalidInstanceIDMalformed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.EqualError(t, ValidateAttachVolumeInput(tt.input), tt.want)
+		})
+	}
+}
@@ -9,22 +9,29 @@ import (
 	"github.com/nats-io/nats.go"
 )
 
-// ValidateCreateVolumeInput validates the input parameters
+// ValidateCreateVolumeInput validates the input parameters. Missing
+// parameters (AvailabilityZone, then Size) are reported before invalid
+// values (Size out of range, then VolumeType), so an input with several
+// problems always reports the same one.
 func ValidateCreateVolumeInput(input *ec2.CreateVolumeInput) error {
 	if input == nil {
 		return errors.New(awserrors.ErrorInvalidParameterValue)
 	}
 
-	if input.Size == nil || *input.Size < 1 || *input.Size > 16384 {
+	// Required parameters
+	if input.AvailabilityZone == nil || *input.AvailabilityZone == "" {
 		return errors.New(awserrors.ErrorInvalidParameterValue)
 	}
-
-	if input.AvailabilityZone == nil || *input.AvailabilityZone == "" {
+	if input.Size == nil {
 		return errors.New(awserrors.ErrorInvalidParameterValue)
 	}
 
-	// Only gp3 or empty (defaults to gp3) allowed
-	if input.VolumeType != nil && *input.VolumeType != "" && *input.VolumeType != "gp3" {
+	// Values
+	if *input.Size < 1 || *input.Size > 16384 {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	// Empty defaults to gp3. The owning node decides whether it offers the type.
+	if input.VolumeType != nil && *input.VolumeType != "" && !handlers_ec2_volume.IsValidVolumeType(*input.VolumeType) {
 		return errors.New(awserrors.ErrorInvalidParameterValue)
 	}
 
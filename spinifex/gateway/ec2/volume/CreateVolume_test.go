@@ -98,21 +98,20 @@ func TestValidateCreateVolumeInput(t *testing.T) {
 			errMsg:  awserrors.ErrorInvalidParameterValue,
 		},
 		{
-			name: "InvalidVolumeType_IO1",
+			name: "ValidInput_WithIO2",
 			input: &ec2.CreateVolumeInput{
 				Size:             aws.Int64(80),
 				AvailabilityZone: aws.String("ap-southeast-2a"),
-				VolumeType:       aws.String("io1"),
+				VolumeType:       aws.String("io2"),
 			},
-			wantErr: true,
-			errMsg:  awserrors.ErrorInvalidParameterValue,
+			wantErr: false,
 		},
 		{
-			name: "InvalidVolumeType_GP2",
+			name: "InvalidVolumeType_Unknown",
 			input: &ec2.CreateVolumeInput{
 				Size:             aws.Int64(80),
 				AvailabilityZone: aws.String("ap-southeast-2a"),
-				VolumeType:       aws.String("gp2"),
+				VolumeType:       aws.String("gp9"),
 			},
 			wantErr: true,
 			errMsg:  awserrors.ErrorInvalidParameterValue,
@@ -0,0 +1,45 @@
+package gateway_ec2_volume
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_ec2_volume "github.com/mulgadc/spinifex/spinifex/handlers/ec2/volume"
+	"github.com/nats-io/nats.go"
+)
+
+// ValidateDescribeConversionTasksInput validates the input parameters
+func ValidateDescribeConversionTasksInput(input *ec2.DescribeConversionTasksInput) error {
+	if input == nil {
+		return nil
+	}
+
+	for _, taskID := range input.ConversionTaskIds {
+		if taskID != nil && !strings.HasPrefix(*taskID, "import-vol-") {
+			return errors.New(awserrors.ErrorInvalidConversionTaskIdMalformed)
+		}
+	}
+
+	return nil
+}
+
+// DescribeConversionTasks handles the DescribeConversionTasks API call
+func DescribeConversionTasks(input *ec2.DescribeConversionTasksInput, natsConn *nats.Conn, accountID string) (ec2.DescribeConversionTasksOutput, error) {
+	var output ec2.DescribeConversionTasksOutput
+
+	err := ValidateDescribeConversionTasksInput(input)
+	if err != nil {
+		return output, err
+	}
+
+	volumeService := handlers_ec2_volume.NewNATSVolumeService(natsConn)
+	result, err := volumeService.DescribeConversionTasks(input, accountID)
+	if err != nil {
+		return output, err
+	}
+
+	output = *result
+	return output, nil
+}
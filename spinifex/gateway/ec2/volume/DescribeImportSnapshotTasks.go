@@ -0,0 +1,45 @@
+package gateway_ec2_volume
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_ec2_volume "github.com/mulgadc/spinifex/spinifex/handlers/ec2/volume"
+	"github.com/nats-io/nats.go"
+)
+
+// ValidateDescribeImportSnapshotTasksInput validates the input parameters
+func ValidateDescribeImportSnapshotTasksInput(input *ec2.DescribeImportSnapshotTasksInput) error {
+	if input == nil {
+		return nil
+	}
+
+	for _, taskID := range input.ImportTaskIds {
+		if taskID != nil && !strings.HasPrefix(*taskID, "import-snap-") {
+			return errors.New(awserrors.ErrorInvalidConversionTaskIdMalformed)
+		}
+	}
+
+	return nil
+}
+
+// DescribeImportSnapshotTasks handles the DescribeImportSnapshotTasks API call
+func DescribeImportSnapshotTasks(input *ec2.DescribeImportSnapshotTasksInput, natsConn *nats.Conn, accountID string) (ec2.DescribeImportSnapshotTasksOutput, error) {
+	var output ec2.DescribeImportSnapshotTasksOutput
+
+	err := ValidateDescribeImportSnapshotTasksInput(input)
+	if err != nil {
+		return output, err
+	}
+
+	volumeService := handlers_ec2_volume.NewNATSVolumeService(natsConn)
+	result, err := volumeService.DescribeImportSnapshotTasks(input, accountID)
+	if err != nil {
+		return output, err
+	}
+
+	output = *result
+	return output, nil
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
 	handlers_ec2_volume "github.com/mulgadc/spinifex/spinifex/handlers/ec2/volume"
+	"github.com/mulgadc/spinifex/spinifex/pagination"
 	"github.com/nats-io/nats.go"
 )
 
@@ -25,7 +26,12 @@ func ValidateDescribeVolumesInput(input *ec2.DescribeVolumesInput) error {
 		}
 	}
 
-	return nil
+	// As on AWS, MaxResults can't be combined with VolumeIds.
+	if input.MaxResults != nil && len(input.VolumeIds) > 0 {
+		return errors.New(awserrors.ErrorInvalidParameterCombination)
+	}
+	_, err := pagination.Parse(input.MaxResults, input.NextToken, pagination.DescribeVolumesLimits)
+	return err
 }
 
 // DescribeVolumes handles the DescribeVolumes API call
@@ -5,6 +5,7 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -85,6 +86,32 @@ func TestValidateDescribeVolumesInput(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name:    "MaxResults",
+			input:   &ec2.DescribeVolumesInput{MaxResults: aws.Int64(500)},
+			wantErr: false,
+		},
+		{
+			name:    "MaxResultsOutOfRange",
+			input:   &ec2.DescribeVolumesInput{MaxResults: aws.Int64(501)},
+			wantErr: true,
+			errMsg:  awserrors.ErrorInvalidMaxResults,
+		},
+		{
+			name:    "InvalidNextToken",
+			input:   &ec2.DescribeVolumesInput{NextToken: aws.String("bogus")},
+			wantErr: true,
+			errMsg:  awserrors.ErrorInvalidNextToken,
+		},
+		{
+			name: "MaxResultsWithVolumeIds",
+			input: &ec2.DescribeVolumesInput{
+				VolumeIds:  []*string{aws.String("vol-abc123")},
+				MaxResults: aws.Int64(5),
+			},
+			wantErr: true,
+			errMsg:  awserrors.ErrorInvalidParameterCombination,
+		},
 	}
 
 	for _, tt := range tests {
@@ -3,28 +3,41 @@ package gateway_ec2_volume
 import (
 	"encoding/json"
 	"errors"
-	"fmt"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
 	handlers_ec2_volume "github.com/mulgadc/spinifex/spinifex/handlers/ec2/volume"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
 	"github.com/mulgadc/spinifex/spinifex/types"
 	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/nats-io/nats.go"
 )
 
-// ValidateDetachVolumeInput validates the input parameters for DetachVolume
+// ValidateDetachVolumeInput validates the input parameters for DetachVolume.
+// A missing VolumeId is reported before malformed IDs (VolumeId, then the
+// optional InstanceId), so an input with several problems always reports
+// the same one.
 func ValidateDetachVolumeInput(input *ec2.DetachVolumeInput) error {
 	if input == nil {
 		return errors.New(awserrors.ErrorInvalidParameterValue)
 	}
 
+	// Required parameters
 	if input.VolumeId == nil || *input.VolumeId == "" {
 		return errors.New(awserrors.ErrorInvalidParameterValue)
 	}
 
+	// ID formats
+	if !strings.HasPrefix(*input.VolumeId, "vol-") {
+		return errors.New(awserrors.ErrorInvalidVolumeIDMalformed)
+	}
+	if input.InstanceId != nil && *input.InstanceId != "" && !strings.HasPrefix(*input.InstanceId, "i-") {
+		return errors.New(awserrors.ErrorInvalidInstanceIDMalformed)
+	}
+
 	return nil
 }
 
@@ -84,8 +97,8 @@ func DetachVolume(input *ec2.DetachVolumeInput, natsConn *nats.Conn, accountID s
 		return output, errors.New(awserrors.ErrorServerInternal)
 	}
 
-	subject := fmt.Sprintf("ec2.cmd.%s", instanceID)
-	reqMsg := nats.NewMsg(subject)
+	subject := subjects.InstanceCmd(instanceID)
+	reqMsg := nats.NewMsg(utils.Subject(subject))
 	reqMsg.Data = jsonData
 	reqMsg.Header.Set(utils.AccountIDHeader, accountID)
 	msg, err := natsConn.RequestMsg(reqMsg, 30*time.Second)
@@ -97,15 +110,11 @@ func DetachVolume(input *ec2.DetachVolumeInput, natsConn *nats.Conn, accountID s
 		return output, errors.New(awserrors.ErrorServerInternal)
 	}
 
-	responseError, err := utils.ValidateErrorPayload(msg.Data)
-	if err != nil {
-		if responseError.Code != nil {
-			return output, errors.New(*responseError.Code)
-		}
-		return output, errors.New(awserrors.ErrorServerInternal)
+	reply := utils.DecodeReply(msg)
+	if reply.Err != nil {
+		return output, reply.Err
 	}
-
-	if err := json.Unmarshal(msg.Data, &output); err != nil {
+	if err := reply.Decode(&output); err != nil {
 		slog.Error("DetachVolume: Failed to unmarshal response", "err", err)
 		return output, errors.New(awserrors.ErrorServerInternal)
 	}
@@ -92,3 +92,33 @@ func TestValidateDetachVolumeInput(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateDetachVolumeInput_Precedence(t *testing.T) {
+	tests := []struct {
+		name  string
+		input *ec2.DetachVolumeInput
+		want  string
+	}{
+		{
+			name:  "MissingVolumeBeforeMalformedInstance",
+			input: &ec2.DetachVolumeInput{InstanceId: aws.String("inst-1")},
+			want:  awserrors.ErrorInvalidParameterValue,
+		},
+		{
+			name:  "MalformedVolumeBeforeMalformedInstance",
+			input: &ec2.DetachVolumeInput{VolumeId: aws.String("v-123"), InstanceId: aws.String("inst-1")},
+			want:  awserrors.ErrorInvalidVolumeIDMalformed,
+		},
+		{
+			name:  "MalformedInstance",
+			input: &ec2.DetachVolumeInput{VolumeId: aws.String("vol-123"), InstanceId: aws.String("inst-1")},
+			want:  awserrors.ErrorInvalidInstanceIDMalformed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.EqualError(t, ValidateDetachVolumeInput(tt.input), tt.want)
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package gateway_ec2_volume
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_ec2_volume "github.com/mulgadc/spinifex/spinifex/handlers/ec2/volume"
+	"github.com/nats-io/nats.go"
+)
+
+// ValidateImportSnapshotInput validates the input parameters
+func ValidateImportSnapshotInput(input *ec2.ImportSnapshotInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+
+	disk := input.DiskContainer
+	if disk == nil || disk.Format == nil || (disk.Url == nil && disk.UserBucket == nil) {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+
+	if disk.Url != nil && disk.UserBucket != nil {
+		return errors.New(awserrors.ErrorInvalidParameterCombination)
+	}
+
+	return nil
+}
+
+// ImportSnapshot handles the ImportSnapshot API call
+func ImportSnapshot(input *ec2.ImportSnapshotInput, natsConn *nats.Conn, accountID string) (ec2.ImportSnapshotOutput, error) {
+	var output ec2.ImportSnapshotOutput
+
+	err := ValidateImportSnapshotInput(input)
+	if err != nil {
+		return output, err
+	}
+
+	volumeService := handlers_ec2_volume.NewNATSVolumeService(natsConn)
+	result, err := volumeService.ImportSnapshot(input, accountID)
+	if err != nil {
+		return output, err
+	}
+
+	output = *result
+	return output, nil
+}
@@ -0,0 +1,54 @@
+package gateway_ec2_volume
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_ec2_volume "github.com/mulgadc/spinifex/spinifex/handlers/ec2/volume"
+	"github.com/nats-io/nats.go"
+)
+
+// ValidateImportVolumeInput validates the input parameters
+func ValidateImportVolumeInput(input *ec2.ImportVolumeInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+
+	if input.AvailabilityZone == nil || *input.AvailabilityZone == "" {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+
+	if input.Image == nil || input.Image.Format == nil || input.Image.ImportManifestUrl == nil || *input.Image.ImportManifestUrl == "" {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+
+	if input.Volume == nil || input.Volume.Size == nil {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+
+	if *input.Volume.Size <= 0 {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+
+	return nil
+}
+
+// ImportVolume handles the ImportVolume API call
+func ImportVolume(input *ec2.ImportVolumeInput, natsConn *nats.Conn, accountID string) (ec2.ImportVolumeOutput, error) {
+	var output ec2.ImportVolumeOutput
+
+	err := ValidateImportVolumeInput(input)
+	if err != nil {
+		return output, err
+	}
+
+	volumeService := handlers_ec2_volume.NewNATSVolumeService(natsConn)
+	result, err := volumeService.ImportVolume(input, accountID)
+	if err != nil {
+		return output, err
+	}
+
+	output = *result
+	return output, nil
+}
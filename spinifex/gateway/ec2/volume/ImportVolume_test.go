@@ -0,0 +1,82 @@
+package gateway_ec2_volume
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateImportVolumeInput(t *testing.T) {
+	image := &ec2.DiskImageDetail{Format: aws.String("RAW"), ImportManifestUrl: aws.String("s3://images/disk.raw")}
+	tests := []struct {
+		name    string
+		input   *ec2.ImportVolumeInput
+		wantErr string
+	}{
+		{name: "NilInput", input: nil, wantErr: awserrors.ErrorInvalidParameterValue},
+		{name: "NoAZ", input: &ec2.ImportVolumeInput{Image: image, Volume: &ec2.VolumeDetail{Size: aws.Int64(8)}}, wantErr: awserrors.ErrorMissingParameter},
+		{name: "NoImage", input: &ec2.ImportVolumeInput{AvailabilityZone: aws.String("ap-southeast-2a"), Volume: &ec2.VolumeDetail{Size: aws.Int64(8)}}, wantErr: awserrors.ErrorMissingParameter},
+		{name: "NoSize", input: &ec2.ImportVolumeInput{AvailabilityZone: aws.String("ap-southeast-2a"), Image: image, Volume: &ec2.VolumeDetail{}}, wantErr: awserrors.ErrorMissingParameter},
+		{name: "ZeroSize", input: &ec2.ImportVolumeInput{AvailabilityZone: aws.String("ap-southeast-2a"), Image: image, Volume: &ec2.VolumeDetail{Size: aws.Int64(0)}}, wantErr: awserrors.ErrorInvalidParameterValue},
+		{name: "Valid", input: &ec2.ImportVolumeInput{AvailabilityZone: aws.String("ap-southeast-2a"), Image: image, Volume: &ec2.VolumeDetail{Size: aws.Int64(8)}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateImportVolumeInput(tt.input)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestValidateImportSnapshotInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   *ec2.ImportSnapshotInput
+		wantErr string
+	}{
+		{name: "NilInput", input: nil, wantErr: awserrors.ErrorInvalidParameterValue},
+		{name: "NoDiskContainer", input: &ec2.ImportSnapshotInput{}, wantErr: awserrors.ErrorMissingParameter},
+		{name: "NoSource", input: &ec2.ImportSnapshotInput{DiskContainer: &ec2.SnapshotDiskContainer{Format: aws.String("VMDK")}}, wantErr: awserrors.ErrorMissingParameter},
+		{name: "UrlAndBucket", input: &ec2.ImportSnapshotInput{DiskContainer: &ec2.SnapshotDiskContainer{
+			Format:     aws.String("VMDK"),
+			Url:        aws.String("s3://images/disk.vmdk"),
+			UserBucket: &ec2.UserBucket{S3Bucket: aws.String("images"), S3Key: aws.String("disk.vmdk")},
+		}}, wantErr: awserrors.ErrorInvalidParameterCombination},
+		{name: "Valid", input: &ec2.ImportSnapshotInput{DiskContainer: &ec2.SnapshotDiskContainer{
+			Format:     aws.String("VMDK"),
+			UserBucket: &ec2.UserBucket{S3Bucket: aws.String("images"), S3Key: aws.String("disk.vmdk")},
+		}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateImportSnapshotInput(tt.input)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestDescribeImportTasks_MalformedIDs(t *testing.T) {
+	_, err := DescribeConversionTasks(&ec2.DescribeConversionTasksInput{
+		ConversionTaskIds: []*string{aws.String("import-snap-0123456789abcdef0")},
+	}, nil, "acct-123")
+	assert.EqualError(t, err, awserrors.ErrorInvalidConversionTaskIdMalformed)
+
+	_, err = DescribeImportSnapshotTasks(&ec2.DescribeImportSnapshotTasksInput{
+		ImportTaskIds: []*string{aws.String("import-vol-0123456789abcdef0")},
+	}, nil, "acct-123")
+	assert.EqualError(t, err, awserrors.ErrorInvalidConversionTaskIdMalformed)
+
+	_, err = DescribeConversionTasks(nil, nil, "acct-123")
+	assert.Error(t, err, "nil NATS connection")
+}
@@ -0,0 +1,41 @@
+package gateway_ec2_vpc
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_ec2_vpc "github.com/mulgadc/spinifex/spinifex/handlers/ec2/vpc"
+	"github.com/nats-io/nats.go"
+)
+
+// ValidateAssociateDhcpOptionsInput validates the input parameters
+func ValidateAssociateDhcpOptionsInput(input *ec2.AssociateDhcpOptionsInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if input.DhcpOptionsId == nil || *input.DhcpOptionsId == "" {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	if input.VpcId == nil || *input.VpcId == "" {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	return nil
+}
+
+// AssociateDhcpOptions handles the EC2 AssociateDhcpOptions API call
+func AssociateDhcpOptions(input *ec2.AssociateDhcpOptionsInput, natsConn *nats.Conn, accountID string) (ec2.AssociateDhcpOptionsOutput, error) {
+	var output ec2.AssociateDhcpOptionsOutput
+
+	if err := ValidateAssociateDhcpOptionsInput(input); err != nil {
+		return output, err
+	}
+
+	svc := handlers_ec2_vpc.NewNATSVPCService(natsConn)
+	result, err := svc.AssociateDhcpOptions(input, accountID)
+	if err != nil {
+		return output, err
+	}
+
+	return *result, nil
+}
@@ -0,0 +1,76 @@
+package gateway_ec2_vpc
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+)
+
+// ValidateAttachNetworkInterfaceInput validates the input parameters.
+// Missing parameters are reported before malformed IDs. Device index 0 is
+// the primary interface, which is only set at launch.
+func ValidateAttachNetworkInterfaceInput(input *ec2.AttachNetworkInterfaceInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if input.NetworkInterfaceId == nil || *input.NetworkInterfaceId == "" ||
+		input.InstanceId == nil || *input.InstanceId == "" ||
+		input.DeviceIndex == nil {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	if !strings.HasPrefix(*input.NetworkInterfaceId, "eni-") {
+		return errors.New(awserrors.ErrorInvalidNetworkInterfaceIdMalformed)
+	}
+	if !strings.HasPrefix(*input.InstanceId, "i-") {
+		return errors.New(awserrors.ErrorInvalidInstanceIDMalformed)
+	}
+	if *input.DeviceIndex < 1 {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if input.NetworkCardIndex != nil && *input.NetworkCardIndex != 0 {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	return nil
+}
+
+// AttachNetworkInterface sends an attach-network-interface command to the
+// daemon running the instance, which hot-plugs the interface into the VM.
+func AttachNetworkInterface(input *ec2.AttachNetworkInterfaceInput, natsConn *nats.Conn, accountID string) (ec2.AttachNetworkInterfaceOutput, error) {
+	var output ec2.AttachNetworkInterfaceOutput
+
+	if err := ValidateAttachNetworkInterfaceInput(input); err != nil {
+		return output, err
+	}
+
+	instanceID := *input.InstanceId
+	eniID := *input.NetworkInterfaceId
+	command := types.EC2InstanceCommand{
+		ID:         instanceID,
+		Attributes: types.EC2CommandAttributes{AttachENI: true},
+		AttachENIData: &types.AttachENIData{
+			NetworkInterfaceID: eniID,
+			DeviceIndex:        aws.Int64Value(input.DeviceIndex),
+		},
+	}
+
+	result, err := utils.NATSRequest[ec2.AttachNetworkInterfaceOutput](natsConn, subjects.InstanceCmd(instanceID), command, 30*time.Second, accountID)
+	if err != nil {
+		slog.Error("AttachNetworkInterface: failed", "instanceId", instanceID, "eniId", eniID, "err", err)
+		if errors.Is(err, nats.ErrNoResponders) {
+			return output, errors.New(awserrors.ErrorInvalidInstanceIDNotFound)
+		}
+		return output, err
+	}
+
+	slog.Info("AttachNetworkInterface completed", "instanceId", instanceID, "eniId", eniID, "attachmentId", aws.StringValue(result.AttachmentId))
+	return *result, nil
+}
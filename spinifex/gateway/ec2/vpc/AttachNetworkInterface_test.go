@@ -0,0 +1,76 @@
+package gateway_ec2_vpc
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateAttachNetworkInterfaceInput(t *testing.T) {
+	valid := func() *ec2.AttachNetworkInterfaceInput {
+		return &ec2.AttachNetworkInterfaceInput{
+			NetworkInterfaceId: aws.String("eni-abc123"),
+			InstanceId:         aws.String("i-abc123"),
+			DeviceIndex:        aws.Int64(1),
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*ec2.AttachNetworkInterfaceInput)
+		want   string
+	}{
+		{"valid", func(*ec2.AttachNetworkInterfaceInput) {}, ""},
+		{"missing interface", func(in *ec2.AttachNetworkInterfaceInput) { in.NetworkInterfaceId = nil }, awserrors.ErrorMissingParameter},
+		{"missing instance", func(in *ec2.AttachNetworkInterfaceInput) { in.InstanceId = aws.String("") }, awserrors.ErrorMissingParameter},
+		{"missing device index", func(in *ec2.AttachNetworkInterfaceInput) { in.DeviceIndex = nil }, awserrors.ErrorMissingParameter},
+		{"missing before malformed", func(in *ec2.AttachNetworkInterfaceInput) {
+			in.NetworkInterfaceId = aws.String("bad")
+			in.InstanceId = nil
+		}, awserrors.ErrorMissingParameter},
+		{"malformed interface", func(in *ec2.AttachNetworkInterfaceInput) { in.NetworkInterfaceId = aws.String("abc123") }, awserrors.ErrorInvalidNetworkInterfaceIdMalformed},
+		{"malformed instance", func(in *ec2.AttachNetworkInterfaceInput) { in.InstanceId = aws.String("abc123") }, awserrors.ErrorInvalidInstanceIDMalformed},
+		{"primary device index", func(in *ec2.AttachNetworkInterfaceInput) { in.DeviceIndex = aws.Int64(0) }, awserrors.ErrorInvalidParameterValue},
+		{"second network card", func(in *ec2.AttachNetworkInterfaceInput) { in.NetworkCardIndex = aws.Int64(1) }, awserrors.ErrorInvalidParameterValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := valid()
+			tt.modify(input)
+			err := ValidateAttachNetworkInterfaceInput(input)
+			if tt.want == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.want)
+		})
+	}
+
+	assert.EqualError(t, ValidateAttachNetworkInterfaceInput(nil), awserrors.ErrorInvalidParameterValue)
+}
+
+func TestValidateDetachNetworkInterfaceInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		input *ec2.DetachNetworkInterfaceInput
+		want  string
+	}{
+		{"nil input", nil, awserrors.ErrorInvalidParameterValue},
+		{"missing attachment", &ec2.DetachNetworkInterfaceInput{}, awserrors.ErrorMissingParameter},
+		{"interface ID instead of attachment", &ec2.DetachNetworkInterfaceInput{AttachmentId: aws.String("eni-abc123")}, awserrors.ErrorInvalidNetworkInterfaceAttachmentIdMalformed},
+		{"valid", &ec2.DetachNetworkInterfaceInput{AttachmentId: aws.String("eni-attach-abc123"), Force: aws.Bool(true)}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateDetachNetworkInterfaceInput(tt.input)
+			if tt.want == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tt.want)
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package gateway_ec2_vpc
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_ec2_vpc "github.com/mulgadc/spinifex/spinifex/handlers/ec2/vpc"
+	"github.com/nats-io/nats.go"
+)
+
+// ValidateCreateDhcpOptionsInput validates the input parameters
+func ValidateCreateDhcpOptionsInput(input *ec2.CreateDhcpOptionsInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if len(input.DhcpConfigurations) == 0 {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	return nil
+}
+
+// CreateDhcpOptions handles the EC2 CreateDhcpOptions API call
+func CreateDhcpOptions(input *ec2.CreateDhcpOptionsInput, natsConn *nats.Conn, accountID string) (ec2.CreateDhcpOptionsOutput, error) {
+	var output ec2.CreateDhcpOptionsOutput
+
+	if err := ValidateCreateDhcpOptionsInput(input); err != nil {
+		return output, err
+	}
+
+	svc := handlers_ec2_vpc.NewNATSVPCService(natsConn)
+	result, err := svc.CreateDhcpOptions(input, accountID)
+	if err != nil {
+		return output, err
+	}
+
+	return *result, nil
+}
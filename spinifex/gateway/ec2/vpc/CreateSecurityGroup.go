@@ -9,13 +9,70 @@ import (
 	"github.com/nats-io/nats.go"
 )
 
-func CreateSecurityGroup(input *ec2.CreateSecurityGroupInput, natsConn *nats.Conn, accountID string) (ec2.CreateSecurityGroupOutput, error) {
-	var output ec2.CreateSecurityGroupOutput
+// ValidateCreateSecurityGroupInput validates the input parameters
+func ValidateCreateSecurityGroupInput(input *ec2.CreateSecurityGroupInput) error {
 	if input == nil {
-		return output, errors.New(awserrors.ErrorInvalidParameterValue)
+		return errors.New(awserrors.ErrorInvalidParameterValue)
 	}
 	if input.GroupName == nil || *input.GroupName == "" {
-		return output, errors.New(awserrors.ErrorMissingParameter)
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	return nil
+}
+
+// validateGroupID validates the GroupId of an operation on an existing
+// security group.
+func validateGroupID(groupID *string) error {
+	if groupID == nil || *groupID == "" {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	return nil
+}
+
+// ValidateDeleteSecurityGroupInput validates the input parameters
+func ValidateDeleteSecurityGroupInput(input *ec2.DeleteSecurityGroupInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	return validateGroupID(input.GroupId)
+}
+
+// ValidateAuthorizeSecurityGroupIngressInput validates the input parameters
+func ValidateAuthorizeSecurityGroupIngressInput(input *ec2.AuthorizeSecurityGroupIngressInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	return validateGroupID(input.GroupId)
+}
+
+// ValidateAuthorizeSecurityGroupEgressInput validates the input parameters
+func ValidateAuthorizeSecurityGroupEgressInput(input *ec2.AuthorizeSecurityGroupEgressInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	return validateGroupID(input.GroupId)
+}
+
+// ValidateRevokeSecurityGroupIngressInput validates the input parameters
+func ValidateRevokeSecurityGroupIngressInput(input *ec2.RevokeSecurityGroupIngressInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	return validateGroupID(input.GroupId)
+}
+
+// ValidateRevokeSecurityGroupEgressInput validates the input parameters
+func ValidateRevokeSecurityGroupEgressInput(input *ec2.RevokeSecurityGroupEgressInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	return validateGroupID(input.GroupId)
+}
+
+func CreateSecurityGroup(input *ec2.CreateSecurityGroupInput, natsConn *nats.Conn, accountID string) (ec2.CreateSecurityGroupOutput, error) {
+	var output ec2.CreateSecurityGroupOutput
+	if err := ValidateCreateSecurityGroupInput(input); err != nil {
+		return output, err
 	}
 	svc := handlers_ec2_vpc.NewNATSVPCService(natsConn)
 	result, err := svc.CreateSecurityGroup(input, accountID)
@@ -27,11 +84,8 @@ func CreateSecurityGroup(input *ec2.CreateSecurityGroupInput, natsConn *nats.Con
 
 func DeleteSecurityGroup(input *ec2.DeleteSecurityGroupInput, natsConn *nats.Conn, accountID string) (ec2.DeleteSecurityGroupOutput, error) {
 	var output ec2.DeleteSecurityGroupOutput
-	if input == nil {
-		return output, errors.New(awserrors.ErrorInvalidParameterValue)
-	}
-	if input.GroupId == nil || *input.GroupId == "" {
-		return output, errors.New(awserrors.ErrorMissingParameter)
+	if err := ValidateDeleteSecurityGroupInput(input); err != nil {
+		return output, err
 	}
 	svc := handlers_ec2_vpc.NewNATSVPCService(natsConn)
 	result, err := svc.DeleteSecurityGroup(input, accountID)
@@ -56,11 +110,8 @@ func DescribeSecurityGroups(input *ec2.DescribeSecurityGroupsInput, natsConn *na
 
 func AuthorizeSecurityGroupIngress(input *ec2.AuthorizeSecurityGroupIngressInput, natsConn *nats.Conn, accountID string) (ec2.AuthorizeSecurityGroupIngressOutput, error) {
 	var output ec2.AuthorizeSecurityGroupIngressOutput
-	if input == nil {
-		return output, errors.New(awserrors.ErrorInvalidParameterValue)
-	}
-	if input.GroupId == nil || *input.GroupId == "" {
-		return output, errors.New(awserrors.ErrorMissingParameter)
+	if err := ValidateAuthorizeSecurityGroupIngressInput(input); err != nil {
+		return output, err
 	}
 	svc := handlers_ec2_vpc.NewNATSVPCService(natsConn)
 	result, err := svc.AuthorizeSecurityGroupIngress(input, accountID)
@@ -72,11 +123,8 @@ func AuthorizeSecurityGroupIngress(input *ec2.AuthorizeSecurityGroupIngressInput
 
 func AuthorizeSecurityGroupEgress(input *ec2.AuthorizeSecurityGroupEgressInput, natsConn *nats.Conn, accountID string) (ec2.AuthorizeSecurityGroupEgressOutput, error) {
 	var output ec2.AuthorizeSecurityGroupEgressOutput
-	if input == nil {
-		return output, errors.New(awserrors.ErrorInvalidParameterValue)
-	}
-	if input.GroupId == nil || *input.GroupId == "" {
-		return output, errors.New(awserrors.ErrorMissingParameter)
+	if err := ValidateAuthorizeSecurityGroupEgressInput(input); err != nil {
+		return output, err
 	}
 	svc := handlers_ec2_vpc.NewNATSVPCService(natsConn)
 	result, err := svc.AuthorizeSecurityGroupEgress(input, accountID)
@@ -88,11 +136,8 @@ func AuthorizeSecurityGroupEgress(input *ec2.AuthorizeSecurityGroupEgressInput,
 
 func RevokeSecurityGroupIngress(input *ec2.RevokeSecurityGroupIngressInput, natsConn *nats.Conn, accountID string) (ec2.RevokeSecurityGroupIngressOutput, error) {
 	var output ec2.RevokeSecurityGroupIngressOutput
-	if input == nil {
-		return output, errors.New(awserrors.ErrorInvalidParameterValue)
-	}
-	if input.GroupId == nil || *input.GroupId == "" {
-		return output, errors.New(awserrors.ErrorMissingParameter)
+	if err := ValidateRevokeSecurityGroupIngressInput(input); err != nil {
+		return output, err
 	}
 	svc := handlers_ec2_vpc.NewNATSVPCService(natsConn)
 	result, err := svc.RevokeSecurityGroupIngress(input, accountID)
@@ -104,11 +149,8 @@ func RevokeSecurityGroupIngress(input *ec2.RevokeSecurityGroupIngressInput, nats
 
 func RevokeSecurityGroupEgress(input *ec2.RevokeSecurityGroupEgressInput, natsConn *nats.Conn, accountID string) (ec2.RevokeSecurityGroupEgressOutput, error) {
 	var output ec2.RevokeSecurityGroupEgressOutput
-	if input == nil {
-		return output, errors.New(awserrors.ErrorInvalidParameterValue)
-	}
-	if input.GroupId == nil || *input.GroupId == "" {
-		return output, errors.New(awserrors.ErrorMissingParameter)
+	if err := ValidateRevokeSecurityGroupEgressInput(input); err != nil {
+		return output, err
 	}
 	svc := handlers_ec2_vpc.NewNATSVPCService(natsConn)
 	result, err := svc.RevokeSecurityGroupEgress(input, accountID)
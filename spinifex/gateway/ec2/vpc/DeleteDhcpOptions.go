@@ -0,0 +1,42 @@
+package gateway_ec2_vpc
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_ec2_vpc "github.com/mulgadc/spinifex/spinifex/handlers/ec2/vpc"
+	"github.com/nats-io/nats.go"
+)
+
+// ValidateDeleteDhcpOptionsInput validates the input parameters
+func ValidateDeleteDhcpOptionsInput(input *ec2.DeleteDhcpOptionsInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if input.DhcpOptionsId == nil || *input.DhcpOptionsId == "" {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	if !strings.HasPrefix(*input.DhcpOptionsId, "dopt-") {
+		return errors.New(awserrors.ErrorInvalidDhcpOptionsIdMalformed)
+	}
+	return nil
+}
+
+// DeleteDhcpOptions handles the EC2 DeleteDhcpOptions API call
+func DeleteDhcpOptions(input *ec2.DeleteDhcpOptionsInput, natsConn *nats.Conn, accountID string) (ec2.DeleteDhcpOptionsOutput, error) {
+	var output ec2.DeleteDhcpOptionsOutput
+
+	if err := ValidateDeleteDhcpOptionsInput(input); err != nil {
+		return output, err
+	}
+
+	svc := handlers_ec2_vpc.NewNATSVPCService(natsConn)
+	result, err := svc.DeleteDhcpOptions(input, accountID)
+	if err != nil {
+		return output, err
+	}
+
+	return *result, nil
+}
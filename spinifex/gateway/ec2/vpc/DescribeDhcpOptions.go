@@ -0,0 +1,20 @@
+package gateway_ec2_vpc
+
+import (
+	"github.com/aws/aws-sdk-go/service/ec2"
+	handlers_ec2_vpc "github.com/mulgadc/spinifex/spinifex/handlers/ec2/vpc"
+	"github.com/nats-io/nats.go"
+)
+
+// DescribeDhcpOptions handles the EC2 DescribeDhcpOptions API call
+func DescribeDhcpOptions(input *ec2.DescribeDhcpOptionsInput, natsConn *nats.Conn, accountID string) (ec2.DescribeDhcpOptionsOutput, error) {
+	var output ec2.DescribeDhcpOptionsOutput
+
+	svc := handlers_ec2_vpc.NewNATSVPCService(natsConn)
+	result, err := svc.DescribeDhcpOptions(input, accountID)
+	if err != nil {
+		return output, err
+	}
+
+	return *result, nil
+}
@@ -0,0 +1,82 @@
+package gateway_ec2_vpc
+
+import (
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_ec2_vpc "github.com/mulgadc/spinifex/spinifex/handlers/ec2/vpc"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+)
+
+// ValidateDetachNetworkInterfaceInput validates the input parameters
+func ValidateDetachNetworkInterfaceInput(input *ec2.DetachNetworkInterfaceInput) error {
+	if input == nil {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if input.AttachmentId == nil || *input.AttachmentId == "" {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	if !strings.HasPrefix(*input.AttachmentId, "eni-attach-") {
+		return errors.New(awserrors.ErrorInvalidNetworkInterfaceAttachmentIdMalformed)
+	}
+	return nil
+}
+
+// DetachNetworkInterface resolves an attachment to its interface and
+// instance, then sends a detach-network-interface command to the daemon
+// running the instance.
+func DetachNetworkInterface(input *ec2.DetachNetworkInterfaceInput, natsConn *nats.Conn, accountID string) (ec2.DetachNetworkInterfaceOutput, error) {
+	var output ec2.DetachNetworkInterfaceOutput
+
+	if err := ValidateDetachNetworkInterfaceInput(input); err != nil {
+		return output, err
+	}
+
+	attachmentID := *input.AttachmentId
+	svc := handlers_ec2_vpc.NewNATSVPCService(natsConn)
+	described, err := svc.DescribeNetworkInterfaces(&ec2.DescribeNetworkInterfacesInput{
+		Filters: []*ec2.Filter{{
+			Name:   aws.String("attachment.attachment-id"),
+			Values: []*string{aws.String(attachmentID)},
+		}},
+	}, accountID)
+	if err != nil {
+		slog.Error("DetachNetworkInterface: failed to resolve attachment", "attachmentId", attachmentID, "err", err)
+		return output, err
+	}
+	if len(described.NetworkInterfaces) == 0 || described.NetworkInterfaces[0].Attachment == nil {
+		return output, errors.New(awserrors.ErrorInvalidAttachmentIDNotFound)
+	}
+	eni := described.NetworkInterfaces[0]
+	instanceID := aws.StringValue(eni.Attachment.InstanceId)
+	eniID := aws.StringValue(eni.NetworkInterfaceId)
+
+	command := types.EC2InstanceCommand{
+		ID:         instanceID,
+		Attributes: types.EC2CommandAttributes{DetachENI: true},
+		DetachENIData: &types.DetachENIData{
+			NetworkInterfaceID: eniID,
+			AttachmentID:       attachmentID,
+			Force:              aws.BoolValue(input.Force),
+		},
+	}
+
+	if _, err := utils.NATSRequest[ec2.DetachNetworkInterfaceOutput](natsConn, subjects.InstanceCmd(instanceID), command, 30*time.Second, accountID); err != nil {
+		slog.Error("DetachNetworkInterface: failed", "instanceId", instanceID, "eniId", eniID, "err", err)
+		if errors.Is(err, nats.ErrNoResponders) {
+			return output, errors.New(awserrors.ErrorIncorrectInstanceState)
+		}
+		return output, err
+	}
+
+	slog.Info("DetachNetworkInterface completed", "instanceId", instanceID, "eniId", eniID, "attachmentId", attachmentID)
+	return output, nil
+}
@@ -0,0 +1,41 @@
+package gateway_ec2_vpc
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateCreateDhcpOptionsInput(t *testing.T) {
+	assert.EqualError(t, ValidateCreateDhcpOptionsInput(nil), awserrors.ErrorInvalidParameterValue)
+	assert.EqualError(t, ValidateCreateDhcpOptionsInput(&ec2.CreateDhcpOptionsInput{}), awserrors.ErrorMissingParameter)
+	assert.NoError(t, ValidateCreateDhcpOptionsInput(&ec2.CreateDhcpOptionsInput{
+		DhcpConfigurations: []*ec2.NewDhcpConfiguration{{Key: aws.String("domain-name"), Values: aws.StringSlice([]string{"corp.example"})}},
+	}))
+}
+
+func TestValidateDeleteDhcpOptionsInput(t *testing.T) {
+	assert.EqualError(t, ValidateDeleteDhcpOptionsInput(nil), awserrors.ErrorInvalidParameterValue)
+	assert.EqualError(t, ValidateDeleteDhcpOptionsInput(&ec2.DeleteDhcpOptionsInput{}), awserrors.ErrorMissingParameter)
+	assert.EqualError(t, ValidateDeleteDhcpOptionsInput(&ec2.DeleteDhcpOptionsInput{DhcpOptionsId: aws.String("vpc-123")}), awserrors.ErrorInvalidDhcpOptionsIdMalformed)
+	assert.NoError(t, ValidateDeleteDhcpOptionsInput(&ec2.DeleteDhcpOptionsInput{DhcpOptionsId: aws.String("dopt-123")}))
+}
+
+func TestValidateAssociateDhcpOptionsInput(t *testing.T) {
+	assert.EqualError(t, ValidateAssociateDhcpOptionsInput(nil), awserrors.ErrorInvalidParameterValue)
+	assert.EqualError(t, ValidateAssociateDhcpOptionsInput(&ec2.AssociateDhcpOptionsInput{VpcId: aws.String("vpc-123")}), awserrors.ErrorMissingParameter)
+	assert.EqualError(t, ValidateAssociateDhcpOptionsInput(&ec2.AssociateDhcpOptionsInput{DhcpOptionsId: aws.String("default")}), awserrors.ErrorMissingParameter)
+	assert.NoError(t, ValidateAssociateDhcpOptionsInput(&ec2.AssociateDhcpOptionsInput{DhcpOptionsId: aws.String("default"), VpcId: aws.String("vpc-123")}))
+}
+
+func TestDhcpOptions_NilNATS(t *testing.T) {
+	_, err := CreateDhcpOptions(&ec2.CreateDhcpOptionsInput{
+		DhcpConfigurations: []*ec2.NewDhcpConfiguration{{Key: aws.String("domain-name"), Values: aws.StringSlice([]string{"corp.example"})}},
+	}, nil, testAccountID)
+	assert.Error(t, err)
+	_, err = DescribeDhcpOptions(&ec2.DescribeDhcpOptionsInput{}, nil, testAccountID)
+	assert.Error(t, err)
+}
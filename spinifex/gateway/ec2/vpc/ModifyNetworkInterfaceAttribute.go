@@ -2,10 +2,16 @@ package gateway_ec2_vpc
 
 import (
 	"errors"
+	"log/slog"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
 	handlers_ec2_vpc "github.com/mulgadc/spinifex/spinifex/handlers/ec2/vpc"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/nats-io/nats.go"
 )
 
@@ -17,22 +23,84 @@ func ValidateModifyNetworkInterfaceAttributeInput(input *ec2.ModifyNetworkInterf
 	if input.NetworkInterfaceId == nil || *input.NetworkInterfaceId == "" {
 		return errors.New(awserrors.ErrorMissingParameter)
 	}
+	if input.Attachment != nil &&
+		(aws.StringValue(input.Attachment.AttachmentId) == "" || input.Attachment.DeleteOnTermination == nil) {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
 	return nil
 }
 
-// ModifyNetworkInterfaceAttribute handles the EC2 ModifyNetworkInterfaceAttribute API call
+// ModifyNetworkInterfaceAttribute handles the EC2 ModifyNetworkInterfaceAttribute API call.
+// An Attachment change goes to the daemon running the instance, which keeps
+// its NetworkInterfaces in step; the other attributes are changed in the ENI
+// record.
 func ModifyNetworkInterfaceAttribute(input *ec2.ModifyNetworkInterfaceAttributeInput, natsConn *nats.Conn, accountID string) (ec2.ModifyNetworkInterfaceAttributeOutput, error) {
 	var output ec2.ModifyNetworkInterfaceAttributeOutput
-
 	if err := ValidateModifyNetworkInterfaceAttributeInput(input); err != nil {
 		return output, err
 	}
 
+	if input.Attachment != nil {
+		if err := modifyNetworkInterfaceAttachment(input, natsConn, accountID); err != nil {
+			return output, err
+		}
+		if len(input.Groups) == 0 && input.Description == nil {
+			return output, nil
+		}
+		rest := *input
+		rest.Attachment = nil
+		input = &rest
+	}
+
 	svc := handlers_ec2_vpc.NewNATSVPCService(natsConn)
 	result, err := svc.ModifyNetworkInterfaceAttribute(input, accountID)
 	if err != nil {
 		return output, err
 	}
-
 	return *result, nil
 }
+
+// modifyNetworkInterfaceAttachment sends the Attachment change of input to
+// the daemon running the instance the interface is attached to.
+func modifyNetworkInterfaceAttachment(input *ec2.ModifyNetworkInterfaceAttributeInput, natsConn *nats.Conn, accountID string) error {
+	eniID := *input.NetworkInterfaceId
+	attachmentID := *input.Attachment.AttachmentId
+
+	svc := handlers_ec2_vpc.NewNATSVPCService(natsConn)
+	described, err := svc.DescribeNetworkInterfaces(&ec2.DescribeNetworkInterfacesInput{
+		NetworkInterfaceIds: []*string{aws.String(eniID)},
+	}, accountID)
+	if err != nil {
+		slog.Error("ModifyNetworkInterfaceAttribute: failed to describe ENI", "eniId", eniID, "err", err)
+		return err
+	}
+	if len(described.NetworkInterfaces) == 0 {
+		return errors.New(awserrors.ErrorInvalidNetworkInterfaceIDNotFound)
+	}
+	attachment := described.NetworkInterfaces[0].Attachment
+	if attachment == nil || aws.StringValue(attachment.AttachmentId) != attachmentID {
+		return errors.New(awserrors.ErrorInvalidAttachmentIDNotFound)
+	}
+	instanceID := aws.StringValue(attachment.InstanceId)
+
+	command := types.EC2InstanceCommand{
+		ID:         instanceID,
+		Attributes: types.EC2CommandAttributes{ModifyENI: true},
+		ModifyENIData: &types.ModifyENIData{
+			NetworkInterfaceID:  eniID,
+			AttachmentID:        attachmentID,
+			DeleteOnTermination: *input.Attachment.DeleteOnTermination,
+		},
+	}
+
+	if _, err := utils.NATSRequest[ec2.ModifyNetworkInterfaceAttributeOutput](natsConn, subjects.InstanceCmd(instanceID), command, 30*time.Second, accountID); err != nil {
+		slog.Error("ModifyNetworkInterfaceAttribute: failed", "instanceId", instanceID, "eniId", eniID, "err", err)
+		if errors.Is(err, nats.ErrNoResponders) {
+			return errors.New(awserrors.ErrorIncorrectInstanceState)
+		}
+		return err
+	}
+
+	slog.Info("ModifyNetworkInterfaceAttribute: attachment modified", "instanceId", instanceID, "eniId", eniID, "attachmentId", attachmentID)
+	return nil
+}
@@ -32,3 +32,16 @@ func TestModifyNetworkInterfaceAttribute_NilNATS(t *testing.T) {
 	}, nil, "123456789012")
 	assert.Error(t, err)
 }
+
+func TestModifyNetworkInterfaceAttribute_IncompleteAttachment(t *testing.T) {
+	for _, attachment := range []*ec2.NetworkInterfaceAttachmentChanges{
+		{DeleteOnTermination: aws.Bool(true)},
+		{AttachmentId: aws.String("eni-attach-abc123")},
+	} {
+		_, err := ModifyNetworkInterfaceAttribute(&ec2.ModifyNetworkInterfaceAttributeInput{
+			NetworkInterfaceId: aws.String("eni-abc123"),
+			Attachment:         attachment,
+		}, nil, "123456789012")
+		assert.EqualError(t, err, awserrors.ErrorMissingParameter)
+	}
+}
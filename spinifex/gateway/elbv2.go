@@ -136,6 +136,7 @@ func (gw *GatewayConfig) ELBv2_Request(w http.ResponseWriter, r *http.Request) e
 		return err
 	}
 
+	xmlOutput = addRequestID(xmlOutput, requestIDOf(r), true)
 	w.Header().Set("Content-Type", "text/xml")
 	w.WriteHeader(http.StatusOK)
 	if _, err := w.Write(xmlOutput); err != nil {
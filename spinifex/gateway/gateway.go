@@ -1,12 +1,16 @@
 package gateway
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -16,13 +20,17 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 	"github.com/mulgadc/predastore/ratelimit"
+	"github.com/mulgadc/spinifex/spinifex/audit"
 	"github.com/mulgadc/spinifex/spinifex/awsec2query"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
 	"github.com/mulgadc/spinifex/spinifex/gateway/policy"
 	handlers_iam "github.com/mulgadc/spinifex/spinifex/handlers/iam"
+	"github.com/mulgadc/spinifex/spinifex/tracing"
 	"github.com/mulgadc/spinifex/spinifex/types"
 	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
 // contextKey is a typed key for storing values in request context.
@@ -36,6 +44,11 @@ const (
 	ctxAccessKey contextKey = "sigv4.accessKey"
 	ctxAction    contextKey = "sigv4.action"
 	ctxQueryArgs contextKey = "sigv4.queryArgs"
+
+	// Set for requests signed with role session credentials, whose policies
+	// are the role's rather than a user's.
+	ctxRoleName    contextKey = "sigv4.roleName"
+	ctxSessionName contextKey = "sigv4.sessionName"
 )
 
 type GatewayConfig struct {
@@ -49,6 +62,7 @@ type GatewayConfig struct {
 	IAMService     handlers_iam.IAMService
 	RateLimiter    *AuthRateLimiter     // Per-IP auth failure rate limiter
 	Throttler      *ratelimit.Throttler // Per-account+action API request throttler
+	Audit          *audit.Recorder      // Audit log of mutating API calls (nil disables auditing)
 	Version        string               // Build-time version string (set from cmd.Version)
 	Commit         string               // Build-time commit hash (set from cmd.Commit)
 }
@@ -58,7 +72,10 @@ var supportedServices = map[string]bool{
 	"iam":                  true,
 	"account":              true,
 	"elasticloadbalancing": true,
+	"monitoring":           true,
+	"autoscaling":          true,
 	"spinifex":             true,
+	"sts":                  true,
 }
 
 const xmlnsEC2 = "http://ec2.amazonaws.com/doc/2016-11-15/"
@@ -75,7 +92,7 @@ type Errors struct {
 
 type ErrorDetail struct {
 	Code    string `xml:"Code"`
-	Message error  `xml:"Message"`
+	Message string `xml:"Message"`
 }
 
 func (gw *GatewayConfig) SetupRoutes() http.Handler {
@@ -94,7 +111,7 @@ func (gw *GatewayConfig) SetupRoutes() http.Handler {
 	})
 
 	// Create a new logger with the custom handler
-	slogger := slog.New(handler)
+	slogger := slog.New(requestIDLogHandler{handler})
 
 	// Set it as the default logger
 	slog.SetDefault(slogger)
@@ -106,23 +123,46 @@ func (gw *GatewayConfig) SetupRoutes() http.Handler {
 
 	r := chi.NewRouter()
 
+	// Give every request an ID for its responses, logs and NATS messages
+	r.Use(requestIDMiddleware)
+
 	if !gw.DisableLogging {
 		r.Use(slogRequestLogger)
 	}
 
-	// AWS SigV4 authentication middleware
-	r.Use(gw.SigV4AuthMiddleware())
+	// Guest boot reports from cloud-init (token-authenticated, no SigV4)
+	r.Post("/phone-home/{instanceId}/{token}", gw.PhoneHome)
 
-	// API request throttling (post-auth, per-account+action token bucket)
-	if gw.Throttler != nil {
-		r.Use(gw.Throttler.Middleware(
-			gw.throttleKeyFuncs(),
-			gw.writeThrottleError,
-		))
-	}
+	// Instance console websocket, signed as a presigned URL
+	r.With(gw.SigV4AuthMiddleware()).Get("/console/{instanceId}", gw.InstanceConsole)
 
-	// Catch-all routes
-	r.HandleFunc("/*", gw.Request)
+	// Long-poll until an instance is ready, such as booted and phoned home
+	r.With(gw.SigV4AuthMiddleware()).Get("/wait/{instanceId}", gw.WaitInstance)
+
+	r.Group(func(r chi.Router) {
+		// AWS SigV4 authentication middleware
+		r.Use(gw.SigV4AuthMiddleware())
+
+		// Trace each API call (post-auth, so the span is named by action)
+		r.Use(traceMiddleware)
+
+		// Audit log of mutating calls (post-auth, so throttled calls are
+		// recorded with their error too)
+		if gw.Audit != nil {
+			r.Use(gw.auditMiddleware)
+		}
+
+		// API request throttling (post-auth, per-account+action token bucket)
+		if gw.Throttler != nil {
+			r.Use(gw.Throttler.Middleware(
+				gw.throttleKeyFuncs(),
+				gw.writeThrottleError,
+			))
+		}
+
+		// Catch-all routes
+		r.HandleFunc("/*", gw.Request)
+	})
 
 	return r
 }
@@ -151,17 +191,17 @@ func (gw *GatewayConfig) throttleKeyFuncs() []ratelimit.KeyFunc {
 
 // writeThrottleError writes the service-appropriate throttle rejection response.
 func (gw *GatewayConfig) writeThrottleError(w http.ResponseWriter, r *http.Request) {
-	requestID := uuid.NewString()
+	requestID := requestIDOf(r)
 	svc, _ := r.Context().Value(ctxService).(string)
 
 	errorCode := awserrors.ErrorRequestLimitExceeded
-	if svc == "iam" {
+	if usesIAMErrorFormat(svc) {
 		errorCode = awserrors.ErrorThrottling
 	}
 	errorMsg := awserrors.ErrorLookup[errorCode]
 
 	var xmlErr []byte
-	if svc == "iam" {
+	if usesIAMErrorFormat(svc) {
 		xmlErr = GenerateIAMErrorResponse(errorCode, errorMsg.Message, requestID)
 	} else { // ec2, elasticloadbalancing, account, spinifex
 		xmlErr = GenerateEC2ErrorResponse(errorCode, errorMsg.Message, requestID)
@@ -174,6 +214,12 @@ func (gw *GatewayConfig) writeThrottleError(w http.ResponseWriter, r *http.Reque
 	}
 }
 
+// usesIAMErrorFormat reports whether svc reports errors in the IAM query
+// format rather than EC2's: IAM, STS, CloudWatch and Auto Scaling do.
+func usesIAMErrorFormat(svc string) bool {
+	return svc == "iam" || svc == "sts" || svc == "monitoring" || svc == "autoscaling"
+}
+
 // Note, custom endpoints can be configured via ENV vars to the AWS SDK/CLI tool, with individual endpoints depending the service
 // AWS_ENDPOINT_URL_EC2=https://localhost:9999/ aws  --no-verify-ssl ec2 describe-instances
 // aws --endpoint-url https://localhost:9999/  --no-verify-ssl eks list-clusters
@@ -182,10 +228,11 @@ func (gw *GatewayConfig) writeThrottleError(w http.ResponseWriter, r *http.Reque
 func (gw *GatewayConfig) Request(w http.ResponseWriter, r *http.Request) {
 	// Route the request to the appropriate endpoint (e.g EC2, IAM, etc)
 	svc, err := gw.GetService(r)
-	slog.Info("Request", "service", svc, "method", r.Method, "path", r.URL.Path)
+	ctx := r.Context()
+	slog.InfoContext(ctx, "Request", "service", svc, "method", r.Method, "path", r.URL.Path)
 
 	if err != nil {
-		slog.Error("GetService error", "error", err)
+		slog.ErrorContext(ctx, "GetService error", "error", err)
 		gw.ErrorHandler(w, r, err)
 		return
 	}
@@ -199,17 +246,23 @@ func (gw *GatewayConfig) Request(w http.ResponseWriter, r *http.Request) {
 		err = gw.IAM_Request(w, r)
 	case "elasticloadbalancing":
 		err = gw.ELBv2_Request(w, r)
+	case "monitoring":
+		err = gw.CloudWatch_Request(w, r)
+	case "autoscaling":
+		err = gw.AutoScaling_Request(w, r)
 	case "spinifex":
 		err = gw.Spinifex_Request(w, r)
+	case "sts":
+		err = gw.STS_Request(w, r)
 	default:
 		err = errors.New(awserrors.ErrorUnsupportedOperation)
 	}
 
 	if err != nil {
-		slog.Error("Service request error", "service", svc, "error", err)
+		slog.ErrorContext(ctx, "Service request error", "service", svc, "error", err)
 		gw.ErrorHandler(w, r, err)
 	} else {
-		slog.Info("Service request completed", "service", svc)
+		slog.InfoContext(ctx, "Service request completed", "service", svc)
 	}
 }
 
@@ -234,10 +287,18 @@ func isNATSTransient(err error) bool {
 }
 
 // checkPolicy evaluates IAM policies for the current request. Returns nil
-// if access is allowed, or an ErrorAccessDenied error if denied.
+// if access is allowed, or an error if denied: UnauthorizedOperation for EC2,
+// as on AWS, and AccessDenied for other services.
 // Root users bypass evaluation entirely. If the IAM service is unavailable,
 // access is allowed (pre-IAM compatibility).
 func (gw *GatewayConfig) checkPolicy(r *http.Request, service, action string) error {
+	return gw.checkPolicyFor(r, service, action, nil)
+}
+
+// checkPolicyFor is checkPolicy against explicit resources, for actions whose
+// resource is not named by EC2-style query arguments. Nil resources are
+// derived from the request as in checkPolicy.
+func (gw *GatewayConfig) checkPolicyFor(r *http.Request, service, action string, resources []string) error {
 	if gw.IAMService == nil {
 		slog.Warn("checkPolicy: IAM service not available, skipping policy check",
 			"service", service, "action", action)
@@ -268,11 +329,19 @@ func (gw *GatewayConfig) checkPolicy(r *http.Request, service, action string) er
 	// Resolve the IAM action string (e.g. "ec2:RunInstances")
 	iamAction := policy.IAMAction(service, action)
 
+	// Role sessions carry the role's policies.
+	getPolicies := gw.IAMService.GetUserPolicies
+	principal := identity
+	if roleName, ok := r.Context().Value(ctxRoleName).(string); ok {
+		getPolicies = gw.IAMService.GetRolePolicies
+		principal = roleName
+	}
+
 	// Retry on transient NATS errors (e.g. during node failure / leader election).
 	var policies []handlers_iam.PolicyDocument
 	var err error
 	for attempt := range 3 {
-		policies, err = gw.IAMService.GetUserPolicies(accountID, identity)
+		policies, err = getPolicies(accountID, principal)
 		if err == nil || !isNATSTransient(err) {
 			break
 		}
@@ -287,40 +356,81 @@ func (gw *GatewayConfig) checkPolicy(r *http.Request, service, action string) er
 		return errors.New(awserrors.ErrorInternalError)
 	}
 
-	if policy.EvaluateAccess(identity, iamAction, "*", policies) == policy.Deny {
-		slog.Info("checkPolicy: access denied", "user", identity, "action", iamAction)
-		return errors.New(awserrors.ErrorAccessDenied)
+	if resources == nil {
+		resources, err = gw.policyResources(r, service, action, accountID)
+		if err != nil {
+			slog.Info("checkPolicy: access denied", "user", identity, "action", iamAction, "err", err)
+			return errors.New(awserrors.ErrorUnauthorizedOperation)
+		}
+	}
+	for _, resource := range resources {
+		if policy.EvaluateAccess(identity, iamAction, resource, policies) == policy.Deny {
+			slog.Info("checkPolicy: access denied", "user", identity, "action", iamAction, "resource", resource)
+			if service == "ec2" {
+				return errors.New(awserrors.ErrorUnauthorizedOperation)
+			}
+			return errors.New(awserrors.ErrorAccessDenied)
+		}
 	}
 
 	return nil
 }
 
+// policyResources returns the resources a request is evaluated against; every
+// one must be allowed. EC2 requests name resources through their query
+// arguments, other services are evaluated against "*". An EC2 request naming
+// a resource that can't be mapped to an ARN returns an error.
+func (gw *GatewayConfig) policyResources(r *http.Request, service, action, accountID string) ([]string, error) {
+	args, _ := r.Context().Value(ctxQueryArgs).(map[string]string)
+	if service != "ec2" || args == nil {
+		return []string{"*"}, nil
+	}
+	region, _ := r.Context().Value(ctxRegion).(string)
+	if region == "" {
+		region = gw.Region
+	}
+	return policy.EC2Resources(region, accountID, action, args)
+}
+
 func (gw *GatewayConfig) ErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
 	svc, _ := gw.GetService(r)
-	slog.Debug("ErrorHandler", "service", svc, "error", err.Error())
-
-	// Generate a server-side request ID — never trust client-provided values
-	var requestId = uuid.NewString()
+	ctx := r.Context()
+	slog.DebugContext(ctx, "ErrorHandler", "service", svc, "error", err.Error())
+
+	// Use the server-side request ID — never trust client-provided values.
+	// Outside requestIDMiddleware, an error a daemon replied with keeps the
+	// ID it was served under.
+	requestId := utils.RequestIDFromContext(ctx)
+	if requestId == "" {
+		var replyErr *awserrors.Error
+		if errors.As(err, &replyErr) && replyErr.RequestID != "" {
+			requestId = replyErr.RequestID
+		} else {
+			requestId = uuid.NewString()
+		}
+	}
 
 	var errorMsg = awserrors.ErrorMessage{}
 
 	// Check if the error lookup exists
 	if _, exists := awserrors.ErrorLookup[err.Error()]; !exists {
-		slog.Warn("Unknown error code", "error", err.Error())
+		slog.WarnContext(ctx, "Unknown error code", "error", err.Error())
 		err = errors.New(awserrors.ErrorInternalError)
 	}
 
 	errorMsg = awserrors.ErrorLookup[err.Error()]
+	if detail := awserrors.Detail(err); detail != "" {
+		errorMsg.Message += " Detail: " + detail
+	}
 
-	// IAM uses a different error XML format than EC2
 	var xmlError []byte
-	if svc == "iam" {
+	if usesIAMErrorFormat(svc) {
 		xmlError = GenerateIAMErrorResponse(err.Error(), errorMsg.Message, requestId)
 	} else {
 		xmlError = GenerateEC2ErrorResponse(err.Error(), errorMsg.Message, requestId)
 	}
 
-	slog.Debug("Generated error response", "error", err.Error(), "xml", string(xmlError), "requestId", requestId)
+	slog.DebugContext(ctx, "Generated error response", "error", err.Error(), "xml", string(xmlError))
 
 	if errorMsg.HTTPCode == 0 {
 		errorMsg.HTTPCode = 500
@@ -343,7 +453,7 @@ func readQueryArgs(r *http.Request) (map[string]string, error) {
 	if err != nil {
 		return nil, fmt.Errorf("read body: %w", err)
 	}
-	return ParseAWSQueryArgs(string(body))
+	return ParseAWSQueryArgs(queryArgsSource(r, body))
 }
 
 // ParseAWSQueryArgs parses an AWS query-protocol body. Returns an error on
@@ -375,7 +485,7 @@ func GenerateEC2ErrorResponse(code, message, requestID string) (output []byte) {
 		Errors: Errors{
 			Error: ErrorDetail{
 				Code:    code,
-				Message: errors.New(message),
+				Message: message,
 			},
 		},
 		RequestID: requestID,
@@ -458,7 +568,7 @@ func (gw *GatewayConfig) DiscoverActiveNodes() int {
 	defer sub.Unsubscribe()
 
 	// Publish discovery request to all nodes
-	err = gw.NATSConn.PublishRequest("spinifex.nodes.discover", inbox, []byte("{}"))
+	err = gw.NATSConn.PublishRequest(utils.Subject("spinifex.nodes.discover"), inbox, []byte("{}"))
 	if err != nil {
 		slog.Error("DiscoverActiveNodes: Failed to publish request", "err", err)
 		return gw.ExpectedNodes
@@ -518,12 +628,106 @@ func (w *statusWriter) WriteHeader(code int) {
 	w.ResponseWriter.WriteHeader(code)
 }
 
+// Hijack passes a websocket upgrade, as InstanceConsole makes, through to
+// the wrapped writer.
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// traceMiddleware starts a span for each API call, named service.Action,
+// continuing the client's trace when the request carries one. Handlers pass
+// the request context on so the daemons' spans join the trace.
+func traceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		svc, _ := r.Context().Value(ctxService).(string)
+		action, _ := r.Context().Value(ctxAction).(string)
+		ctx := tracing.ExtractHTTP(r.Context(), r.Header)
+		ctx, span := tracing.Start(ctx, svc+"."+action,
+			attribute.String("rpc.service", svc),
+			attribute.String("rpc.method", action),
+			attribute.String("spinifex.request_id", utils.RequestIDFromContext(ctx)),
+		)
+		defer span.End()
+
+		ww := &statusWriter{ResponseWriter: w, status: 200}
+		next.ServeHTTP(ww, r.WithContext(ctx))
+		span.SetAttributes(attribute.Int("http.response.status_code", ww.status))
+		if ww.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(ww.status))
+		}
+	})
+}
+
 // SlogRequestLogger is a middleware that logs each request using slog.
 func slogRequestLogger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		ww := &statusWriter{ResponseWriter: w, status: 200}
 		next.ServeHTTP(ww, r)
-		slog.Info("request", "method", r.Method, "path", r.URL.Path, "status", ww.status, "duration", time.Since(start))
+		slog.InfoContext(r.Context(), "request", "method", r.Method, "path", r.URL.Path, "status", ww.status, "duration", time.Since(start))
+	})
+}
+
+// requestIDResponseHeader is the HTTP response header AWS returns each
+// request's ID in.
+const requestIDResponseHeader = "X-Amzn-Requestid"
+
+// requestIDMiddleware gives each request a server-generated ID, returned in
+// requestIDResponseHeader and in the RequestId of the response body, logged
+// with every line logged with the request context and passed to the daemons
+// in the NATS request header.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := uuid.NewString()
+		w.Header().Set(requestIDResponseHeader, requestID)
+		next.ServeHTTP(w, r.WithContext(utils.WithRequestID(r.Context(), requestID)))
 	})
 }
+
+// requestIDOf returns the ID of request r, or a new one for a request that
+// did not pass through requestIDMiddleware.
+func requestIDOf(r *http.Request) string {
+	if requestID := utils.RequestIDFromContext(r.Context()); requestID != "" {
+		return requestID
+	}
+	return uuid.NewString()
+}
+
+// addRequestID adds requestID to a successful XML response: as the
+// requestId element EC2 responses carry or, in the query format IAM and
+// the other services use, as ResponseMetadata/RequestId.
+func addRequestID(xmlOutput []byte, requestID string, queryFormat bool) []byte {
+	end := bytes.LastIndex(xmlOutput, []byte("</"))
+	if end < 0 {
+		return xmlOutput
+	}
+	elem := "<requestId>" + requestID + "</requestId>"
+	if queryFormat {
+		elem = "<ResponseMetadata><RequestId>" + requestID + "</RequestId></ResponseMetadata>"
+	}
+	out := make([]byte, 0, len(xmlOutput)+len(elem))
+	out = append(out, xmlOutput[:end]...)
+	out = append(out, elem...)
+	return append(out, xmlOutput[end:]...)
+}
+
+// requestIDLogHandler adds the request ID of the context a line is logged
+// with, if any, to each log line.
+type requestIDLogHandler struct {
+	slog.Handler
+}
+
+func (h requestIDLogHandler) Handle(ctx context.Context, rec slog.Record) error {
+	if requestID := utils.RequestIDFromContext(ctx); requestID != "" {
+		rec.AddAttrs(slog.String("requestId", requestID))
+	}
+	return h.Handler.Handle(ctx, rec)
+}
+
+func (h requestIDLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestIDLogHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestIDLogHandler) WithGroup(name string) slog.Handler {
+	return requestIDLogHandler{h.Handler.WithGroup(name)}
+}
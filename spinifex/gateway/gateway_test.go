@@ -7,19 +7,27 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/mulgadc/predastore/ratelimit"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
 	handlers_iam "github.com/mulgadc/spinifex/spinifex/handlers/iam"
 	"github.com/mulgadc/spinifex/spinifex/testutil"
 	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/nats-io/nats.go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // doRequest sends a request through an http.Handler and returns the response.
@@ -207,6 +215,45 @@ func TestErrorHandler_UnknownError(t *testing.T) {
 	assert.Contains(t, xmlStr, "<Errors>")
 }
 
+func TestErrorHandler_Detail(t *testing.T) {
+	gw := &GatewayConfig{DisableLogging: true}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), ctxService, "ec2")
+		r = r.WithContext(ctx)
+		gw.ErrorHandler(w, r, awserrors.WithDetail(awserrors.ErrorIncorrectState, "QEMU GenericError: Node nbd-vol-1 is in use"))
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	resp := doRequest(handler, req)
+
+	body, _ := io.ReadAll(resp.Body)
+	xmlStr := string(body)
+	assert.Contains(t, xmlStr, "<Code>IncorrectState</Code>")
+	assert.Contains(t, xmlStr, "<Message>The resource is in an incorrect state")
+	assert.Contains(t, xmlStr, "Detail: QEMU GenericError: Node nbd-vol-1 is in use</Message>")
+}
+
+func TestErrorHandler_ReplyError(t *testing.T) {
+	gw := &GatewayConfig{DisableLogging: true}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), ctxService, "ec2")
+		r = r.WithContext(ctx)
+		gw.ErrorHandler(w, r, &awserrors.Error{Code: awserrors.ErrorIncorrectState, Message: "volume in use", RequestID: "req-daemon-1"})
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	resp := doRequest(handler, req)
+	assert.Equal(t, 400, resp.StatusCode)
+
+	body, _ := io.ReadAll(resp.Body)
+	xmlStr := string(body)
+	assert.Contains(t, xmlStr, "<Code>IncorrectState</Code>")
+	assert.Contains(t, xmlStr, "Detail: volume in use</Message>")
+	assert.Contains(t, xmlStr, "<RequestID>req-daemon-1</RequestID>")
+}
+
 func TestErrorHandler_EC2Service(t *testing.T) {
 	gw := &GatewayConfig{DisableLogging: true}
 
@@ -355,6 +402,7 @@ func TestSupportedServices(t *testing.T) {
 	assert.True(t, supportedServices["iam"])
 	assert.True(t, supportedServices["account"])
 	assert.True(t, supportedServices["elasticloadbalancing"])
+	assert.True(t, supportedServices["monitoring"])
 	assert.False(t, supportedServices["s3"])
 	assert.False(t, supportedServices["dynamodb"])
 	assert.False(t, supportedServices[""])
@@ -548,6 +596,7 @@ func TestRequest_MalformedQueryString_EndToEnd(t *testing.T) {
 	}{
 		{"ec2", "ec2", "Action=DescribeInstances&Bad=%ZZ"},
 		{"elbv2", "elasticloadbalancing", "Action=DescribeLoadBalancers&Bad=%ZZ"},
+		{"cloudwatch", "monitoring", "Action=ListMetrics&Bad=%ZZ"},
 		{"iam", "iam", "Action=ListUsers&Bad=%ZZ"},
 		{"spinifex", "spinifex", "Action=GetVersion&Bad=%ZZ"},
 	}
@@ -677,6 +726,34 @@ func TestEC2Request_NilNATSLocalAction(t *testing.T) {
 	assert.Contains(t, string(body), "DescribeRegionsResponse")
 }
 
+func TestEC2Request_QueryProtocol(t *testing.T) {
+	gw := &GatewayConfig{DisableLogging: true, Region: "us-east-1", AZ: "us-east-1a"}
+
+	// Action in the query string, flattened list arguments in the form body
+	req := httptest.NewRequest(http.MethodPost, "/?Action=DescribeRegions", strings.NewReader("Version=2014-10-01&RegionName.1=us-east-1"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	req = req.WithContext(context.WithValue(req.Context(), ctxAccountID, "123456789012"))
+	w := httptest.NewRecorder()
+	require.NoError(t, gw.EC2_Request(w, req))
+	body := w.Body.String()
+	assert.Contains(t, body, `<DescribeRegionsResponse xmlns="http://ec2.amazonaws.com/doc/2014-10-01/">`)
+	assert.Contains(t, body, "<regionName>us-east-1</regionName>")
+	assert.Contains(t, body, "<requestId>")
+
+	// All arguments in the query string of a GET
+	req = httptest.NewRequest(http.MethodGet, "/?Action=DescribeRegions&Version=2016-11-15", nil)
+	req = req.WithContext(context.WithValue(req.Context(), ctxAccountID, "123456789012"))
+	w = httptest.NewRecorder()
+	require.NoError(t, gw.EC2_Request(w, req))
+	assert.Contains(t, w.Body.String(), `<DescribeRegionsResponse xmlns="`+xmlnsEC2+`">`)
+}
+
+func TestEC2Namespace(t *testing.T) {
+	assert.Equal(t, "http://ec2.amazonaws.com/doc/2014-10-01/", ec2Namespace("2014-10-01"))
+	assert.Equal(t, xmlnsEC2, ec2Namespace(""))
+	assert.Equal(t, xmlnsEC2, ec2Namespace(`2016-11-15"><x`))
+}
+
 func TestEC2Request_MissingAccountID(t *testing.T) {
 	gw := &GatewayConfig{DisableLogging: true, NATSConn: nil}
 	// Use a local action so we don't fail on nil NATS first
@@ -725,6 +802,90 @@ func TestEC2Request_DescribeAvailabilityZones(t *testing.T) {
 	assert.Contains(t, string(body), "DescribeAvailabilityZonesResponse")
 }
 
+func TestEC2Request_DryRun(t *testing.T) {
+	_, nc := testutil.StartTestNATS(t)
+	// A dry run must not reach the daemons.
+	sub, err := nc.SubscribeSync(">")
+	require.NoError(t, err)
+	gw := &GatewayConfig{DisableLogging: true, NATSConn: nc}
+
+	tests := map[string]string{
+		"RunInstances":                  "ImageId=ami-0123456789abcdef0&InstanceType=t3.micro&MinCount=1&MaxCount=1&KeyName=key",
+		"StartInstances":                "InstanceId.1=i-0123456789abcdef0",
+		"StopInstances":                 "InstanceId.1=i-0123456789abcdef0",
+		"TerminateInstances":            "InstanceId.1=i-0123456789abcdef0",
+		"CreateVolume":                  "AvailabilityZone=us-east-1a&Size=10",
+		"AttachVolume":                  "VolumeId=vol-0123456789abcdef0&InstanceId=i-0123456789abcdef0&Device=/dev/sdf",
+		"CreateSecurityGroup":           "GroupName=web&Description=web",
+		"AuthorizeSecurityGroupIngress": "GroupId=sg-0123456789abcdef0&IpPermissions.1.IpProtocol=tcp",
+		"DescribeInstances":             "",
+	}
+	for action, args := range tests {
+		t.Run(action, func(t *testing.T) {
+			req := setupEC2Request("Action="+action+"&DryRun=true&"+args, "123456789012")
+			err := gw.EC2_Request(httptest.NewRecorder(), req)
+			require.Error(t, err)
+			assert.Equal(t, awserrors.ErrorDryRunOperation, err.Error())
+		})
+	}
+
+	_, err = sub.NextMsg(100 * time.Millisecond)
+	assert.ErrorIs(t, err, nats.ErrTimeout)
+}
+
+func TestEC2Request_DryRunValidates(t *testing.T) {
+	_, nc := testutil.StartTestNATS(t)
+	gw := &GatewayConfig{DisableLogging: true, NATSConn: nc}
+
+	tests := map[string]struct {
+		body string
+		want string
+	}{
+		"RunInstances without KeyName": {
+			"Action=RunInstances&DryRun=true&ImageId=ami-0123456789abcdef0&InstanceType=t3.micro&MinCount=1&MaxCount=1",
+			awserrors.ErrorMissingParameter,
+		},
+		"AttachVolume malformed volume ID": {
+			"Action=AttachVolume&DryRun=true&VolumeId=bad&InstanceId=i-0123456789abcdef0&Device=/dev/sdf",
+			awserrors.ErrorInvalidVolumeIDMalformed,
+		},
+		"CreateVolume size out of range": {
+			"Action=CreateVolume&DryRun=true&AvailabilityZone=us-east-1a&Size=0",
+			awserrors.ErrorInvalidParameterValue,
+		},
+		"DeleteSecurityGroup without GroupId": {
+			"Action=DeleteSecurityGroup&DryRun=true",
+			awserrors.ErrorMissingParameter,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := gw.EC2_Request(httptest.NewRecorder(), setupEC2Request(tt.body, "123456789012"))
+			require.Error(t, err)
+			assert.Equal(t, tt.want, err.Error())
+		})
+	}
+}
+
+func TestEC2Request_DryRunUnauthorized(t *testing.T) {
+	_, nc := testutil.StartTestNATS(t)
+	gw := &GatewayConfig{DisableLogging: true, NATSConn: nc, IAMService: &policyMockIAMService{}}
+	req := setupEC2Request("Action=TerminateInstances&DryRun=true&InstanceId.1=i-0123456789abcdef0", "123456789012")
+	req = req.WithContext(context.WithValue(req.Context(), ctxIdentity, "alice"))
+
+	err := gw.EC2_Request(httptest.NewRecorder(), req)
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorUnauthorizedOperation, err.Error())
+}
+
+func TestErrorHandler_DryRunOperation(t *testing.T) {
+	gw := &GatewayConfig{DisableLogging: true}
+	w := httptest.NewRecorder()
+	gw.ErrorHandler(w, setupEC2Request("", "123456789012"), errors.New(awserrors.ErrorDryRunOperation))
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.Contains(t, w.Body.String(), "<Code>DryRunOperation</Code>")
+}
+
 func TestCheckPolicy_NilIAMService(t *testing.T) {
 	gw := &GatewayConfig{DisableLogging: true, IAMService: nil}
 	req := httptest.NewRequest(http.MethodPost, "/", nil)
@@ -796,6 +957,64 @@ func TestCheckPolicy_NonRootDenyPolicy(t *testing.T) {
 
 	err := gw.checkPolicy(req, "ec2", "DescribeInstances")
 	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorUnauthorizedOperation, err.Error())
+}
+
+func TestCheckPolicy_ResourceScoped(t *testing.T) {
+	mock := &policyMockIAMService{
+		getUserPoliciesFn: func(_, _ string) ([]handlers_iam.PolicyDocument, error) {
+			return []handlers_iam.PolicyDocument{
+				{
+					Version: "2012-10-17",
+					Statement: []handlers_iam.Statement{
+						{Effect: "Allow", Action: handlers_iam.StringOrArr{"ec2:TerminateInstances"}, Resource: handlers_iam.StringOrArr{"arn:aws:ec2:*:123456789012:instance/i-dev*"}},
+						{Effect: "Allow", Action: handlers_iam.StringOrArr{"ec2:Describe*"}, Resource: handlers_iam.StringOrArr{"*"}},
+					},
+				},
+			}, nil
+		},
+	}
+	gw := &GatewayConfig{DisableLogging: true, IAMService: mock, Region: "us-east-1"}
+	request := func(action string, args map[string]string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		ctx := context.WithValue(req.Context(), ctxIdentity, "alice")
+		ctx = context.WithValue(ctx, ctxAccountID, "123456789012")
+		ctx = context.WithValue(ctx, ctxQueryArgs, args)
+		return req.WithContext(ctx)
+	}
+
+	err := gw.checkPolicy(request("TerminateInstances", map[string]string{"InstanceId.1": "i-dev1", "InstanceId.2": "i-dev2"}), "ec2", "TerminateInstances")
+	assert.NoError(t, err)
+
+	// Every named resource must be allowed.
+	err = gw.checkPolicy(request("TerminateInstances", map[string]string{"InstanceId.1": "i-dev1", "InstanceId.2": "i-prod1"}), "ec2", "TerminateInstances")
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorUnauthorizedOperation, err.Error())
+
+	// Describe actions are evaluated against "*".
+	err = gw.checkPolicy(request("DescribeInstances", map[string]string{"InstanceId.1": "i-prod1"}), "ec2", "DescribeInstances")
+	assert.NoError(t, err)
+
+	// A resource with no known ARN is denied rather than evaluated as "*".
+	err = gw.checkPolicy(request("TerminateInstances", map[string]string{"InstanceId.1": "i-dev1", "PeerVpcId": "vpc-0123456789abcdef0"}), "ec2", "TerminateInstances")
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorUnauthorizedOperation, err.Error())
+}
+
+func TestCheckPolicy_DeniedOutsideEC2(t *testing.T) {
+	mock := &policyMockIAMService{
+		getUserPoliciesFn: func(_, _ string) ([]handlers_iam.PolicyDocument, error) {
+			return nil, nil
+		},
+	}
+	gw := &GatewayConfig{DisableLogging: true, IAMService: mock}
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	ctx := context.WithValue(req.Context(), ctxIdentity, "alice")
+	ctx = context.WithValue(ctx, ctxAccountID, "123456789012")
+	req = req.WithContext(ctx)
+
+	err := gw.checkPolicy(req, "iam", "ListUsers")
+	require.Error(t, err)
 	assert.Equal(t, awserrors.ErrorAccessDenied, err.Error())
 }
 
@@ -813,7 +1032,7 @@ func TestCheckPolicy_NonRootNoPolicies(t *testing.T) {
 
 	err := gw.checkPolicy(req, "ec2", "DescribeInstances")
 	require.Error(t, err)
-	assert.Equal(t, awserrors.ErrorAccessDenied, err.Error())
+	assert.Equal(t, awserrors.ErrorUnauthorizedOperation, err.Error())
 }
 
 func TestCheckPolicy_GetUserPoliciesError(t *testing.T) {
@@ -961,14 +1180,19 @@ func TestSlogRequestLogger_CapturesStatusCode(t *testing.T) {
 func TestEC2ActionMapCompleteness(t *testing.T) {
 	expectedActions := []string{
 		"DescribeInstances", "RunInstances", "StartInstances", "StopInstances",
-		"TerminateInstances", "RebootInstances", "DescribeInstanceTypes", "GetConsoleOutput",
+		"TerminateInstances", "RebootInstances", "DescribeInstanceTypes", "GetInstanceTypesFromInstanceRequirements", "GetConsoleOutput",
+		"GetConsoleScreenshot", "GetPasswordData",
 		"ModifyInstanceAttribute", "DescribeInstanceAttribute",
+		"DescribeInstanceStatus", "ModifyInstanceEventStartTime",
 		"CreateKeyPair", "DeleteKeyPair", "DescribeKeyPairs", "ImportKeyPair",
+		"CreateLaunchTemplate", "CreateLaunchTemplateVersion", "ModifyLaunchTemplate", "DeleteLaunchTemplate",
+		"DescribeLaunchTemplates", "DescribeLaunchTemplateVersions",
 		"DescribeImages", "CreateImage", "DeregisterImage", "RegisterImage", "CopyImage",
 		"DescribeImageAttribute", "ModifyImageAttribute", "ResetImageAttribute",
 		"DescribeRegions", "DescribeAvailabilityZones",
 		"DescribeVolumes", "ModifyVolume", "CreateVolume", "DeleteVolume",
 		"AttachVolume", "DescribeVolumeStatus", "DescribeVolumesModifications", "DetachVolume",
+		"ImportVolume", "ImportSnapshot", "DescribeConversionTasks", "DescribeImportSnapshotTasks",
 		"DescribeAccountAttributes", "EnableEbsEncryptionByDefault",
 		"DisableEbsEncryptionByDefault", "GetEbsEncryptionByDefault",
 		"GetSerialConsoleAccessStatus", "EnableSerialConsoleAccess",
@@ -981,17 +1205,21 @@ func TestEC2ActionMapCompleteness(t *testing.T) {
 		"DescribeEgressOnlyInternetGateways",
 		"CreatePlacementGroup", "DeletePlacementGroup", "DescribePlacementGroups",
 		"CreateVpc", "DeleteVpc", "DescribeVpcs", "ModifyVpcAttribute", "DescribeVpcAttribute",
+		"CreateDhcpOptions", "DeleteDhcpOptions", "DescribeDhcpOptions", "AssociateDhcpOptions",
 		"CreateSubnet", "DeleteSubnet", "DescribeSubnets", "ModifySubnetAttribute",
 		"CreateNetworkInterface", "DeleteNetworkInterface", "DescribeNetworkInterfaces", "ModifyNetworkInterfaceAttribute",
+		"AttachNetworkInterface", "DetachNetworkInterface",
 		"CreateSecurityGroup", "DeleteSecurityGroup", "DescribeSecurityGroups",
 		"AuthorizeSecurityGroupIngress", "AuthorizeSecurityGroupEgress",
 		"RevokeSecurityGroupIngress", "RevokeSecurityGroupEgress",
-		"DescribeInstanceCreditSpecifications",
+		"DescribeInstanceCreditSpecifications", "ModifyInstanceCreditSpecification",
+		"ModifyInstanceMetadataOptions", "ModifyInstanceMaintenanceOptions",
 		"AllocateAddress", "ReleaseAddress", "AssociateAddress", "DisassociateAddress", "DescribeAddresses", "DescribeAddressesAttribute",
 		"CreateRouteTable", "DeleteRouteTable", "DescribeRouteTables",
 		"CreateRoute", "DeleteRoute", "ReplaceRoute",
 		"AssociateRouteTable", "DisassociateRouteTable", "ReplaceRouteTableAssociation",
 		"CreateNatGateway", "DeleteNatGateway", "DescribeNatGateways",
+		"ModifyReservedInstances", "GetReservedInstancesExchangeQuote", "AcceptReservedInstancesExchangeQuote",
 	}
 
 	for _, action := range expectedActions {
@@ -1001,7 +1229,10 @@ func TestEC2ActionMapCompleteness(t *testing.T) {
 }
 
 func TestEC2LocalActionsCompleteness(t *testing.T) {
-	expected := []string{"DescribeRegions", "DescribeAvailabilityZones", "DescribeAccountAttributes"}
+	expected := []string{
+		"DescribeRegions", "DescribeAvailabilityZones", "DescribeAccountAttributes",
+		"ModifyReservedInstances", "GetReservedInstancesExchangeQuote", "AcceptReservedInstancesExchangeQuote",
+	}
 	for _, action := range expected {
 		assert.True(t, ec2LocalActions[action], "ec2LocalActions missing %s", action)
 	}
@@ -1014,6 +1245,10 @@ func TestIAMActionMapCompleteness(t *testing.T) {
 		"CreateAccessKey", "ListAccessKeys", "DeleteAccessKey", "UpdateAccessKey",
 		"CreatePolicy", "GetPolicy", "GetPolicyVersion", "ListPolicies", "DeletePolicy",
 		"AttachUserPolicy", "DetachUserPolicy", "ListAttachedUserPolicies",
+		"CreateRole", "GetRole", "ListRoles", "DeleteRole",
+		"AttachRolePolicy", "DetachRolePolicy", "ListAttachedRolePolicies",
+		"CreateInstanceProfile", "GetInstanceProfile", "ListInstanceProfiles", "DeleteInstanceProfile",
+		"AddRoleToInstanceProfile", "RemoveRoleFromInstanceProfile",
 	}
 
 	for _, action := range expectedActions {
@@ -1022,6 +1257,15 @@ func TestIAMActionMapCompleteness(t *testing.T) {
 	assert.Len(t, iamActions, len(expectedActions), "iamActions has unexpected entries")
 }
 
+func TestSTSActionMapCompleteness(t *testing.T) {
+	expectedActions := []string{"GetCallerIdentity", "GetSessionToken", "AssumeRole"}
+
+	for _, action := range expectedActions {
+		assert.Contains(t, stsActions, action, "stsActions missing %s", action)
+	}
+	assert.Len(t, stsActions, len(expectedActions), "stsActions has unexpected entries")
+}
+
 func TestImportKeyPair_Base64PaddingWorkaround(t *testing.T) {
 	// The ImportKeyPair handler has a workaround that decodes URL-encoded
 	// Base64 padding (%3D%3D → ==) before passing to the generic handler.
@@ -1037,7 +1281,7 @@ func TestImportKeyPair_Base64PaddingWorkaround(t *testing.T) {
 	gw := &GatewayConfig{DisableLogging: true, NATSConn: nil}
 	// The handler will fail because NATS is nil, but we can verify the
 	// workaround ran by checking that q["PublicKeyMaterial"] was modified.
-	_, _ = handler("ImportKeyPair", q, gw, "123456789012")
+	_, _ = handler(context.Background(), "ImportKeyPair", q, gw, "123456789012")
 
 	// After the workaround, the URL-encoded padding should be decoded
 	assert.True(t, strings.HasSuffix(q["PublicKeyMaterial"], "=="),
@@ -1268,3 +1512,75 @@ func TestThrottleMiddleware_PerActionIsolation(t *testing.T) {
 	resp = makeReq("RunInstances")
 	assert.Equal(t, 200, resp.StatusCode)
 }
+
+func TestTraceMiddleware(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	ctx := context.WithValue(req.Context(), ctxService, "ec2")
+	ctx = context.WithValue(ctx, ctxAction, "RunInstances")
+
+	var handlerSpan trace.SpanContext
+	handler := traceMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlerSpan = trace.SpanContextFromContext(r.Context())
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	resp := doRequest(handler, req.WithContext(ctx))
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	ended := recorder.Ended()
+	require.Len(t, ended, 1)
+	assert.Equal(t, "ec2.RunInstances", ended[0].Name())
+	assert.Equal(t, traceID, ended[0].SpanContext().TraceID().String())
+	assert.Equal(t, ended[0].SpanContext().SpanID(), handlerSpan.SpanID(), "handlers run in the request's span")
+	assert.Equal(t, codes.Error, ended[0].Status().Code)
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	gw := &GatewayConfig{DisableLogging: true}
+
+	var requestID string
+	handler := requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID = utils.RequestIDFromContext(r.Context())
+		r = r.WithContext(context.WithValue(r.Context(), ctxService, "ec2"))
+		gw.ErrorHandler(w, r, &awserrors.Error{Code: awserrors.ErrorIncorrectState, RequestID: "req-daemon-1"})
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("X-Amz-Request-Id", "custom-req-id-123")
+	resp := doRequest(handler, req)
+
+	require.NotEmpty(t, requestID)
+	assert.NotEqual(t, "custom-req-id-123", requestID)
+	assert.Equal(t, requestID, resp.Header.Get("x-amzn-RequestId"))
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(body), "<RequestID>"+requestID+"</RequestID>")
+}
+
+func TestAddRequestID(t *testing.T) {
+	ec2XML := addRequestID([]byte(`<StopInstancesResponse><instancesSet></instancesSet></StopInstancesResponse>`), "req-1", false)
+	assert.Equal(t, `<StopInstancesResponse><instancesSet></instancesSet><requestId>req-1</requestId></StopInstancesResponse>`, string(ec2XML))
+
+	iamXML := addRequestID([]byte(`<GetUserResponse><GetUserResult></GetUserResult></GetUserResponse>`), "req-1", true)
+	assert.Equal(t, `<GetUserResponse><GetUserResult></GetUserResult><ResponseMetadata><RequestId>req-1</RequestId></ResponseMetadata></GetUserResponse>`, string(iamXML))
+
+	assert.Empty(t, addRequestID(nil, "req-1", false))
+}
+
+func TestRequestIDLogHandler(t *testing.T) {
+	var buf strings.Builder
+	logger := slog.New(requestIDLogHandler{slog.NewJSONHandler(&buf, nil)})
+
+	logger.InfoContext(utils.WithRequestID(context.Background(), "req-1"), "served")
+	logger.Info("background")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], `"requestId":"req-1"`)
+	assert.NotContains(t, lines[1], "requestId")
+}
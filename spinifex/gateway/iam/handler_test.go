@@ -3,6 +3,7 @@ package gateway_iam
 import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
 	handlers_iam "github.com/mulgadc/spinifex/spinifex/handlers/iam"
 	"github.com/stretchr/testify/assert"
@@ -83,6 +84,60 @@ func (s *stubIAMService) GetUserPolicies(_, _ string) ([]handlers_iam.PolicyDocu
 	return nil, nil
 }
 
+func (s *stubIAMService) CreateRole(_ string, _ *iam.CreateRoleInput) (*iam.CreateRoleOutput, error) {
+	return nil, nil
+}
+func (s *stubIAMService) GetRole(_ string, _ *iam.GetRoleInput) (*iam.GetRoleOutput, error) {
+	return nil, nil
+}
+func (s *stubIAMService) ListRoles(_ string, _ *iam.ListRolesInput) (*iam.ListRolesOutput, error) {
+	return nil, nil
+}
+func (s *stubIAMService) DeleteRole(_ string, _ *iam.DeleteRoleInput) (*iam.DeleteRoleOutput, error) {
+	return nil, nil
+}
+func (s *stubIAMService) AttachRolePolicy(_ string, _ *iam.AttachRolePolicyInput) (*iam.AttachRolePolicyOutput, error) {
+	return nil, nil
+}
+func (s *stubIAMService) DetachRolePolicy(_ string, _ *iam.DetachRolePolicyInput) (*iam.DetachRolePolicyOutput, error) {
+	return nil, nil
+}
+func (s *stubIAMService) ListAttachedRolePolicies(_ string, _ *iam.ListAttachedRolePoliciesInput) (*iam.ListAttachedRolePoliciesOutput, error) {
+	return nil, nil
+}
+func (s *stubIAMService) CreateInstanceProfile(_ string, _ *iam.CreateInstanceProfileInput) (*iam.CreateInstanceProfileOutput, error) {
+	return nil, nil
+}
+func (s *stubIAMService) GetInstanceProfile(_ string, _ *iam.GetInstanceProfileInput) (*iam.GetInstanceProfileOutput, error) {
+	return nil, nil
+}
+func (s *stubIAMService) ListInstanceProfiles(_ string, _ *iam.ListInstanceProfilesInput) (*iam.ListInstanceProfilesOutput, error) {
+	return nil, nil
+}
+func (s *stubIAMService) DeleteInstanceProfile(_ string, _ *iam.DeleteInstanceProfileInput) (*iam.DeleteInstanceProfileOutput, error) {
+	return nil, nil
+}
+func (s *stubIAMService) AddRoleToInstanceProfile(_ string, _ *iam.AddRoleToInstanceProfileInput) (*iam.AddRoleToInstanceProfileOutput, error) {
+	return nil, nil
+}
+func (s *stubIAMService) RemoveRoleFromInstanceProfile(_ string, _ *iam.RemoveRoleFromInstanceProfileInput) (*iam.RemoveRoleFromInstanceProfileOutput, error) {
+	return nil, nil
+}
+func (s *stubIAMService) ResolveInstanceProfile(_, _, _ string) (*handlers_iam.InstanceProfile, error) {
+	return nil, nil
+}
+func (s *stubIAMService) GetSessionToken(_, _ string, _ *sts.GetSessionTokenInput) (*sts.GetSessionTokenOutput, error) {
+	return nil, nil
+}
+func (s *stubIAMService) AssumeRole(_, _ string, _ *sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error) {
+	return nil, nil
+}
+func (s *stubIAMService) InstanceProfileCredentials(_ *handlers_iam.InstanceCredentialsRequest) (*handlers_iam.InstanceCredentials, error) {
+	return nil, nil
+}
+func (s *stubIAMService) GetRolePolicies(_, _ string) ([]handlers_iam.PolicyDocument, error) {
+	return nil, nil
+}
 func (s *stubIAMService) LookupAccessKey(_ string) (*handlers_iam.AccessKey, error) {
 	return nil, nil
 }
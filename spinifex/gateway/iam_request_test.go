@@ -11,6 +11,7 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
 	handlers_iam "github.com/mulgadc/spinifex/spinifex/handlers/iam"
 	"github.com/stretchr/testify/assert"
@@ -120,6 +121,60 @@ func (m *flexMockIAMService) GetUserPolicies(_, _ string) ([]handlers_iam.Policy
 	return nil, nil
 }
 
+func (m *flexMockIAMService) CreateRole(_ string, _ *iam.CreateRoleInput) (*iam.CreateRoleOutput, error) {
+	return nil, nil
+}
+func (m *flexMockIAMService) GetRole(_ string, _ *iam.GetRoleInput) (*iam.GetRoleOutput, error) {
+	return nil, nil
+}
+func (m *flexMockIAMService) ListRoles(_ string, _ *iam.ListRolesInput) (*iam.ListRolesOutput, error) {
+	return nil, nil
+}
+func (m *flexMockIAMService) DeleteRole(_ string, _ *iam.DeleteRoleInput) (*iam.DeleteRoleOutput, error) {
+	return nil, nil
+}
+func (m *flexMockIAMService) AttachRolePolicy(_ string, _ *iam.AttachRolePolicyInput) (*iam.AttachRolePolicyOutput, error) {
+	return nil, nil
+}
+func (m *flexMockIAMService) DetachRolePolicy(_ string, _ *iam.DetachRolePolicyInput) (*iam.DetachRolePolicyOutput, error) {
+	return nil, nil
+}
+func (m *flexMockIAMService) ListAttachedRolePolicies(_ string, _ *iam.ListAttachedRolePoliciesInput) (*iam.ListAttachedRolePoliciesOutput, error) {
+	return nil, nil
+}
+func (m *flexMockIAMService) CreateInstanceProfile(_ string, _ *iam.CreateInstanceProfileInput) (*iam.CreateInstanceProfileOutput, error) {
+	return nil, nil
+}
+func (m *flexMockIAMService) GetInstanceProfile(_ string, _ *iam.GetInstanceProfileInput) (*iam.GetInstanceProfileOutput, error) {
+	return nil, nil
+}
+func (m *flexMockIAMService) ListInstanceProfiles(_ string, _ *iam.ListInstanceProfilesInput) (*iam.ListInstanceProfilesOutput, error) {
+	return nil, nil
+}
+func (m *flexMockIAMService) DeleteInstanceProfile(_ string, _ *iam.DeleteInstanceProfileInput) (*iam.DeleteInstanceProfileOutput, error) {
+	return nil, nil
+}
+func (m *flexMockIAMService) AddRoleToInstanceProfile(_ string, _ *iam.AddRoleToInstanceProfileInput) (*iam.AddRoleToInstanceProfileOutput, error) {
+	return nil, nil
+}
+func (m *flexMockIAMService) RemoveRoleFromInstanceProfile(_ string, _ *iam.RemoveRoleFromInstanceProfileInput) (*iam.RemoveRoleFromInstanceProfileOutput, error) {
+	return nil, nil
+}
+func (m *flexMockIAMService) ResolveInstanceProfile(_, _, _ string) (*handlers_iam.InstanceProfile, error) {
+	return nil, nil
+}
+func (m *flexMockIAMService) GetSessionToken(_, _ string, _ *sts.GetSessionTokenInput) (*sts.GetSessionTokenOutput, error) {
+	return nil, nil
+}
+func (m *flexMockIAMService) AssumeRole(_, _ string, _ *sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error) {
+	return nil, nil
+}
+func (m *flexMockIAMService) InstanceProfileCredentials(_ *handlers_iam.InstanceCredentialsRequest) (*handlers_iam.InstanceCredentials, error) {
+	return nil, nil
+}
+func (m *flexMockIAMService) GetRolePolicies(_, _ string) ([]handlers_iam.PolicyDocument, error) {
+	return nil, nil
+}
 func (m *flexMockIAMService) LookupAccessKey(_ string) (*handlers_iam.AccessKey, error) {
 	return nil, errors.New("not implemented")
 }
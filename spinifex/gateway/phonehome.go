@@ -0,0 +1,54 @@
+package gateway
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+)
+
+// phoneHomeTimeout bounds the wait for the node hosting the instance. Nodes
+// that don't host it never reply, so an unknown instance costs the full wait.
+const phoneHomeTimeout = 5 * time.Second
+
+// PhoneHome accepts cloud-init's phone_home POST from a guest and forwards
+// it to the daemon hosting the instance. Guests hold no AWS credentials, so
+// this route sits outside SigV4; the per-instance token in the URL stands in
+// for auth and bad tokens count towards the IP lockout.
+func (gw *GatewayConfig) PhoneHome(w http.ResponseWriter, r *http.Request) {
+	clientIP := extractClientIP(r)
+	if errCode := gw.RateLimiter.CheckIP(clientIP); errCode != "" {
+		gw.writeSigV4Error(w, r, errCode)
+		return
+	}
+
+	instanceID := chi.URLParam(r, "instanceId")
+	if !strings.HasPrefix(instanceID, "i-") {
+		gw.writeSigV4Error(w, r, awserrors.ErrorInvalidInstanceIDMalformed)
+		return
+	}
+	if gw.NATSConn == nil {
+		gw.writeSigV4Error(w, r, awserrors.ErrorServerInternal)
+		return
+	}
+
+	input := types.PhoneHomeInput{InstanceID: instanceID, Token: chi.URLParam(r, "token")}
+	if _, err := utils.NATSRequest[struct{}](gw.NATSConn, "ec2.PhoneHome", input, phoneHomeTimeout, ""); err != nil {
+		switch err.Error() {
+		case awserrors.ErrorAuthFailure:
+			gw.RateLimiter.RecordFailure(clientIP)
+			gw.writeSigV4Error(w, r, awserrors.ErrorAuthFailure)
+		default:
+			slog.Warn("PhoneHome: no node accepted the report", "instanceId", instanceID, "err", err)
+			gw.writeSigV4Error(w, r, awserrors.ErrorInvalidInstanceIDNotFound)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,62 @@
+package gateway
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/testutil"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPhoneHome_Route(t *testing.T) {
+	_, nc := testutil.StartTestNATS(t)
+
+	received := make(chan types.PhoneHomeInput, 4)
+	_, err := nc.Subscribe("ec2.PhoneHome", func(msg *nats.Msg) {
+		var input types.PhoneHomeInput
+		_ = json.Unmarshal(msg.Data, &input)
+		received <- input
+		if input.Token != "good" {
+			msg.Respond(utils.GenerateErrorPayload(awserrors.ErrorAuthFailure))
+			return
+		}
+		msg.Respond([]byte("{}"))
+	})
+	require.NoError(t, err)
+
+	gw := &GatewayConfig{DisableLogging: true, NATSConn: nc}
+	handler := gw.SetupRoutes()
+	defer gw.RateLimiter.Stop()
+
+	post := func(path string) *http.Response {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader("instance_id=i-abc"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return doRequest(handler, req)
+	}
+
+	// No SigV4 needed: the token authenticates the guest.
+	resp := post("/phone-home/i-abc/good")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, types.PhoneHomeInput{InstanceID: "i-abc", Token: "good"}, <-received)
+
+	resp = post("/phone-home/i-abc/bad")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	<-received
+
+	resp = post("/phone-home/vol-abc/good")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Every other route still requires SigV4.
+	resp = post("/")
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(body), awserrors.ErrorMissingAuthenticationToken)
+}
@@ -64,6 +64,7 @@ func EvaluateAccess(identity, action, resource string, policies []handlers_iam.P
 //   - "ec2:*"            — matches all actions in the ec2 service
 //   - "s3:Get*"          — matches s3:GetObject, s3:GetBucketPolicy, etc.
 //   - "ec2:RunInstances" — exact match
+//   - "arn:aws:ec2:*:*:instance/i-*" — wildcards anywhere in a resource ARN
 func matchesAny(patterns []string, value string) bool {
 	for _, p := range patterns {
 		if matchWildcard(p, value) {
@@ -73,21 +74,40 @@ func matchesAny(patterns []string, value string) bool {
 	return false
 }
 
-// matchWildcard performs simple wildcard matching where "*" can appear at the
-// end of a pattern as a suffix wildcard, or alone to match everything.
+// matchWildcard performs case-insensitive IAM wildcard matching, where "*"
+// matches any run of characters and "?" matches exactly one.
 // Examples:
 //
 //	"*"              matches anything
 //	"ec2:*"          matches "ec2:RunInstances"
 //	"s3:Get*"        matches "s3:GetObject"
 //	"ec2:RunInstances" matches only "ec2:RunInstances"
+//	"arn:aws:ec2:*:*:volume/vol-?" matches "arn:aws:ec2:us-east-1:123456789012:volume/vol-1"
 func matchWildcard(pattern, value string) bool {
-	if pattern == "*" {
-		return true
+	pattern = strings.ToLower(pattern)
+	value = strings.ToLower(value)
+
+	// Iterative glob match: on a mismatch, backtrack to the last "*" and let
+	// it absorb one more character of value.
+	p, v := 0, 0
+	star, mark := -1, 0
+	for v < len(value) {
+		switch {
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == value[v]):
+			p++
+			v++
+		case p < len(pattern) && pattern[p] == '*':
+			star, mark = p, v
+			p++
+		case star >= 0:
+			mark++
+			p, v = star+1, mark
+		default:
+			return false
+		}
 	}
-	if strings.HasSuffix(pattern, "*") {
-		prefix := strings.ToLower(pattern[:len(pattern)-1])
-		return strings.HasPrefix(strings.ToLower(value), prefix)
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
 	}
-	return strings.EqualFold(pattern, value)
+	return p == len(pattern)
 }
@@ -206,6 +206,20 @@ func TestEvaluateAccess_ResourceMismatch(t *testing.T) {
 	}
 }
 
+func TestEvaluateAccess_ResourceARN(t *testing.T) {
+	policies := []handlers_iam.PolicyDocument{
+		doc("Allow", "ec2:TerminateInstances", "arn:aws:ec2:*:123456789012:instance/i-dev*"),
+	}
+	got := EvaluateAccess("alice", "ec2:TerminateInstances", "arn:aws:ec2:us-east-1:123456789012:instance/i-dev01", policies)
+	if got != Allow {
+		t.Fatalf("expected Allow for matching instance ARN, got %v", got)
+	}
+	got = EvaluateAccess("alice", "ec2:TerminateInstances", "arn:aws:ec2:us-east-1:123456789012:instance/i-prod01", policies)
+	if got != Deny {
+		t.Fatalf("expected Deny for instance outside the pattern, got %v", got)
+	}
+}
+
 func TestEvaluateAccess_CaseInsensitiveAction(t *testing.T) {
 	// Action matching should be case-insensitive for exact matches.
 	policies := []handlers_iam.PolicyDocument{
@@ -249,9 +263,20 @@ func TestMatchWildcard(t *testing.T) {
 		{"EC2:RunInstances", "ec2:RunInstances", true},
 		{"ec2:runinstances", "ec2:RunInstances", true},
 
+		// Wildcards inside resource ARNs
+		{"arn:aws:ec2:*:*:instance/*", "arn:aws:ec2:us-east-1:123456789012:instance/i-0abc", true},
+		{"arn:aws:ec2:*:*:instance/*", "arn:aws:ec2:us-east-1:123456789012:volume/vol-1", false},
+		{"arn:aws:ec2:us-east-1:*:volume/vol-?", "arn:aws:ec2:us-east-1:123456789012:volume/vol-1", true},
+		{"arn:aws:ec2:us-east-1:*:volume/vol-?", "arn:aws:ec2:us-east-1:123456789012:volume/vol-12", false},
+		{"*:RunInstances", "ec2:RunInstances", true},
+		{"ec2:*Instances", "ec2:TerminateInstances", true},
+		{"ec2:*Instances", "ec2:CreateVolume", false},
+		{"**", "anything", true},
+
 		// Edge cases
 		{"", "", true},
 		{"", "something", false},
+		{"?", "", false},
 	}
 
 	for _, tt := range tests {
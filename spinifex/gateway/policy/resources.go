@@ -0,0 +1,147 @@
+package policy
+
+import (
+	"errors"
+	"slices"
+	"strings"
+)
+
+// ec2ResourceParams maps the EC2 query parameters that name a resource to
+// the resource type used in its ARN. List and nested parameters
+// (InstanceId.1, BlockDeviceMapping.1.Ebs.SnapshotId, ...) map through
+// their last named segment. An empty type is taken from the ID's prefix,
+// for parameters such as CreateTags' ResourceId that name any resource.
+var ec2ResourceParams = map[string]string{
+	"InstanceId":                  "instance",
+	"VolumeId":                    "volume",
+	"ImageId":                     "image",
+	"SourceImageId":               "image",
+	"SnapshotId":                  "snapshot",
+	"SourceSnapshotId":            "snapshot",
+	"VpcId":                       "vpc",
+	"SubnetId":                    "subnet",
+	"GroupId":                     "security-group",
+	"SecurityGroupId":             "security-group",
+	"KeyName":                     "key-pair",
+	"NetworkInterfaceId":          "network-interface",
+	"InternetGatewayId":           "internet-gateway",
+	"EgressOnlyInternetGatewayId": "egress-only-internet-gateway",
+	"RouteTableId":                "route-table",
+	"AllocationId":                "elastic-ip",
+	"LaunchTemplateId":            "launch-template",
+	"NatGatewayId":                "natgateway",
+	"DhcpOptionsId":               "dhcp-options",
+	"NetworkAclId":                "network-acl",
+	"ResourceId":                  "",
+	"GatewayId":                   "",
+}
+
+// ec2ResourceIDTypes maps resource ID prefixes to the resource type used in
+// their ARNs.
+var ec2ResourceIDTypes = map[string]string{
+	"i":        "instance",
+	"vol":      "volume",
+	"ami":      "image",
+	"snap":     "snapshot",
+	"vpc":      "vpc",
+	"subnet":   "subnet",
+	"sg":       "security-group",
+	"eni":      "network-interface",
+	"igw":      "internet-gateway",
+	"eigw":     "egress-only-internet-gateway",
+	"rtb":      "route-table",
+	"eipalloc": "elastic-ip",
+	"lt":       "launch-template",
+	"nat":      "natgateway",
+	"dopt":     "dhcp-options",
+	"acl":      "network-acl",
+}
+
+// ErrUnmappedResource is returned for a request naming a resource whose ARN
+// can't be worked out, which is denied rather than evaluated against "*"
+// so a Deny scoped to that resource can't be sidestepped.
+var ErrUnmappedResource = errors.New("request names a resource with no known ARN")
+
+// EC2Resources returns the ARNs of the resources an EC2 request names, for
+// matching against statement Resource patterns. Describe actions and
+// requests naming no resource evaluate against "*", as Describe actions do
+// not support resource-level permissions on AWS. Other requests with an
+// ID parameter (one named ...Id) holding a resource ID that isn't mapped
+// return ErrUnmappedResource.
+func EC2Resources(region, accountID, action string, args map[string]string) ([]string, error) {
+	if strings.HasPrefix(action, "Describe") {
+		return []string{"*"}, nil
+	}
+
+	var resources []string
+	for key, value := range args {
+		if value == "" {
+			continue
+		}
+		name := paramName(key)
+		resourceType, ok := ec2ResourceParams[name]
+		if !ok {
+			if _, isID := resourceIDType(value); isID && strings.HasSuffix(name, "Id") {
+				return nil, ErrUnmappedResource
+			}
+			continue
+		}
+		if resourceType == "" {
+			if resourceType, ok = resourceIDType(value); !ok {
+				return nil, ErrUnmappedResource
+			}
+		}
+		owner := accountID
+		if resourceType == "image" {
+			// Image ARNs carry no account, as AMIs may be shared.
+			owner = ""
+		}
+		resources = append(resources, "arn:aws:ec2:"+region+":"+owner+":"+resourceType+"/"+value)
+	}
+	if len(resources) == 0 {
+		return []string{"*"}, nil
+	}
+	slices.Sort(resources)
+	return slices.Compact(resources), nil
+}
+
+// paramName returns the last named segment of a query parameter, skipping
+// list indices: BlockDeviceMapping.1.Ebs.SnapshotId names a SnapshotId.
+func paramName(key string) string {
+	segments := strings.Split(key, ".")
+	for i := len(segments) - 1; i >= 0; i-- {
+		if !isListIndex(segments[i]) {
+			return segments[i]
+		}
+	}
+	return ""
+}
+
+// resourceIDType returns the ARN resource type of a resource ID, such as
+// "volume" for vol-0123456789abcdef0.
+func resourceIDType(id string) (string, bool) {
+	i := strings.LastIndexByte(id, '-')
+	if i < 0 || len(id)-i-1 < 8 {
+		return "", false
+	}
+	for _, c := range id[i+1:] {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return "", false
+		}
+	}
+	resourceType, ok := ec2ResourceIDTypes[id[:i]]
+	return resourceType, ok
+}
+
+// isListIndex reports whether s is the numeric index of a query list member.
+func isListIndex(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
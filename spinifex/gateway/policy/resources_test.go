@@ -0,0 +1,183 @@
+package policy
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	handlers_iam "github.com/mulgadc/spinifex/spinifex/handlers/iam"
+)
+
+func TestEC2Resources(t *testing.T) {
+	tests := []struct {
+		name   string
+		action string
+		args   map[string]string
+		want   []string
+	}{
+		{
+			name:   "NoResource",
+			action: "CreateKeyPair",
+			args:   map[string]string{"Action": "CreateKeyPair"},
+			want:   []string{"*"},
+		},
+		{
+			name:   "DescribeIsUnscoped",
+			action: "DescribeInstances",
+			args:   map[string]string{"InstanceId.1": "i-1"},
+			want:   []string{"*"},
+		},
+		{
+			name:   "InstanceList",
+			action: "TerminateInstances",
+			args:   map[string]string{"InstanceId.2": "i-2", "InstanceId.1": "i-1"},
+			want: []string{
+				"arn:aws:ec2:us-east-1:123456789012:instance/i-1",
+				"arn:aws:ec2:us-east-1:123456789012:instance/i-2",
+			},
+		},
+		{
+			name:   "ImageHasNoAccount",
+			action: "RunInstances",
+			args:   map[string]string{"ImageId": "ami-1", "SubnetId": "subnet-1", "SecurityGroupId.1": "sg-1"},
+			want: []string{
+				"arn:aws:ec2:us-east-1:123456789012:security-group/sg-1",
+				"arn:aws:ec2:us-east-1:123456789012:subnet/subnet-1",
+				"arn:aws:ec2:us-east-1::image/ami-1",
+			},
+		},
+		{
+			name:   "IgnoresNestedAndEmpty",
+			action: "AttachVolume",
+			args:   map[string]string{"VolumeId": "vol-1", "InstanceId": "", "VolumeId.Foo": "x"},
+			want:   []string{"arn:aws:ec2:us-east-1:123456789012:volume/vol-1"},
+		},
+		{
+			name:   "TagResourcesByPrefix",
+			action: "CreateTags",
+			args: map[string]string{
+				"ResourceId.1": "vol-0123456789abcdef0",
+				"ResourceId.2": "snap-0123456789abcdef0",
+				"ResourceId.3": "ami-0123456789abcdef0",
+				"Tag.1.Value":  "i-0123456789abcdef0",
+			},
+			want: []string{
+				"arn:aws:ec2:us-east-1:123456789012:snapshot/snap-0123456789abcdef0",
+				"arn:aws:ec2:us-east-1:123456789012:volume/vol-0123456789abcdef0",
+				"arn:aws:ec2:us-east-1::image/ami-0123456789abcdef0",
+			},
+		},
+		{
+			name:   "NestedParameters",
+			action: "RunInstances",
+			args: map[string]string{
+				"LaunchTemplate.LaunchTemplateId":       "lt-0123456789abcdef0",
+				"BlockDeviceMapping.1.Ebs.SnapshotId":   "snap-1",
+				"NetworkInterface.1.NetworkInterfaceId": "eni-1",
+			},
+			want: []string{
+				"arn:aws:ec2:us-east-1:123456789012:launch-template/lt-0123456789abcdef0",
+				"arn:aws:ec2:us-east-1:123456789012:network-interface/eni-1",
+				"arn:aws:ec2:us-east-1:123456789012:snapshot/snap-1",
+			},
+		},
+		{
+			name:   "IgnoresOtherIDs",
+			action: "DetachNetworkInterface",
+			args:   map[string]string{"AttachmentId": "eni-attach-0123456789abcdef0", "ClientToken": "vol-0123456789abcdef0"},
+			want:   []string{"*"},
+		},
+		{
+			name:   "Duplicates",
+			action: "StopInstances",
+			args:   map[string]string{"InstanceId.1": "i-1", "InstanceId.2": "i-1"},
+			want:   []string{"arn:aws:ec2:us-east-1:123456789012:instance/i-1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EC2Resources("us-east-1", "123456789012", tt.action, tt.args)
+			if err != nil {
+				t.Fatalf("EC2Resources() error = %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("EC2Resources() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEC2Resources_UnmappedFailsClosed(t *testing.T) {
+	tests := []struct {
+		name   string
+		action string
+		args   map[string]string
+	}{
+		{"UnmappedIDParameter", "AssociateVpcCidrBlock", map[string]string{"PeerVpcId": "vpc-0123456789abcdef0"}},
+		{"UnknownTagResource", "CreateTags", map[string]string{"ResourceId.1": "vgw-0123456789abcdef0"}},
+		{"MalformedTagResource", "DeleteTags", map[string]string{"ResourceId.1": "not-a-resource"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := EC2Resources("us-east-1", "123456789012", tt.action, tt.args); !errors.Is(err, ErrUnmappedResource) {
+				t.Fatalf("EC2Resources() error = %v, want ErrUnmappedResource", err)
+			}
+		})
+	}
+
+	// Describe actions are unscoped whatever they name.
+	got, err := EC2Resources("us-east-1", "123456789012", "DescribeVpcs", map[string]string{"PeerVpcId": "vpc-0123456789abcdef0"})
+	if err != nil || !slices.Equal(got, []string{"*"}) {
+		t.Fatalf("EC2Resources() = %v, %v, want [*]", got, err)
+	}
+}
+
+// A Deny scoped to one resource applies however the request names it.
+func TestEC2Resources_ScopedDeny(t *testing.T) {
+	const account = "123456789012"
+	policies := []handlers_iam.PolicyDocument{
+		doc("Allow", "ec2:*", "*"),
+		{
+			Version: "2012-10-17",
+			Statement: []handlers_iam.Statement{{
+				Effect: "Deny",
+				Action: handlers_iam.StringOrArr{"ec2:*"},
+				Resource: handlers_iam.StringOrArr{
+					"arn:aws:ec2:*:" + account + ":volume/vol-0deadbeef0000001",
+					"arn:aws:ec2:*:" + account + ":snapshot/snap-0deadbeef0000001",
+					"arn:aws:ec2:*:" + account + ":launch-template/lt-0deadbeef0000001",
+					"arn:aws:ec2:*:" + account + ":network-interface/eni-0deadbeef0000001",
+				},
+			}},
+		},
+	}
+	tests := []struct {
+		name   string
+		action string
+		args   map[string]string
+	}{
+		{"CreateTags", "CreateTags", map[string]string{"ResourceId.1": "i-0123456789abcdef0", "ResourceId.2": "vol-0deadbeef0000001"}},
+		{"DeleteTags", "DeleteTags", map[string]string{"ResourceId.1": "vol-0deadbeef0000001"}},
+		{"BatchCreateTags", "BatchCreateTags", map[string]string{"ResourceId.1": "vol-0deadbeef0000001"}},
+		{"LaunchTemplate", "RunInstances", map[string]string{"ImageId": "ami-1", "LaunchTemplate.LaunchTemplateId": "lt-0deadbeef0000001"}},
+		{"BlockDeviceSnapshot", "RunInstances", map[string]string{"ImageId": "ami-1", "BlockDeviceMapping.1.Ebs.SnapshotId": "snap-0deadbeef0000001"}},
+		{"NetworkInterface", "RunInstances", map[string]string{"ImageId": "ami-1", "NetworkInterface.1.NetworkInterfaceId": "eni-0deadbeef0000001"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resources, err := EC2Resources("us-east-1", account, tt.action, tt.args)
+			if err != nil {
+				t.Fatalf("EC2Resources() error = %v", err)
+			}
+			denied := false
+			for _, resource := range resources {
+				if EvaluateAccess("alice", "ec2:"+tt.action, resource, policies) == Deny {
+					denied = true
+				}
+			}
+			if !denied {
+				t.Fatalf("resources %v were not denied", resources)
+			}
+		})
+	}
+}
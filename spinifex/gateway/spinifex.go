@@ -3,20 +3,36 @@ package gateway
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/mulgadc/spinifex/spinifex/admin"
+	"github.com/mulgadc/spinifex/spinifex/audit"
+	"github.com/mulgadc/spinifex/spinifex/awsec2query"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	gateway_ec2_account "github.com/mulgadc/spinifex/spinifex/gateway/ec2/account"
+	gateway_ec2_instance "github.com/mulgadc/spinifex/spinifex/gateway/ec2/instance"
+	gateway_ec2_snapshot "github.com/mulgadc/spinifex/spinifex/gateway/ec2/snapshot"
+	gateway_ec2_tags "github.com/mulgadc/spinifex/spinifex/gateway/ec2/tags"
 	gateway_spx "github.com/mulgadc/spinifex/spinifex/gateway/spx"
+	handlers_ec2_instanceevent "github.com/mulgadc/spinifex/spinifex/handlers/ec2/instanceevent"
+	handlers_ec2_instanceschedule "github.com/mulgadc/spinifex/spinifex/handlers/ec2/instanceschedule"
+	handlers_ec2_snapshot "github.com/mulgadc/spinifex/spinifex/handlers/ec2/snapshot"
+	handlers_ec2_tags "github.com/mulgadc/spinifex/spinifex/handlers/ec2/tags"
 )
 
 // spinifexAdminActions lists actions that require admin account access.
 var spinifexAdminActions = map[string]bool{
-	"GetVersion":       true,
-	"GetNodes":         true,
-	"GetVMs":           true,
-	"GetStorageStatus": true,
+	"GetVersion":            true,
+	"GetNodes":              true,
+	"DescribeHosts":         true,
+	"GetVMs":                true,
+	"GetStorageStatus":      true,
+	"ScheduleInstanceEvent": true,
+	"LookupEvents":          true,
 }
 
 func (gw *GatewayConfig) Spinifex_Request(w http.ResponseWriter, r *http.Request) error {
@@ -64,6 +80,11 @@ func (gw *GatewayConfig) Spinifex_Request(w http.ResponseWriter, r *http.Request
 			return errors.New(awserrors.ErrorServerInternal)
 		}
 		output, err = gateway_spx.GetNodes(gw.NATSConn, gw.DiscoverActiveNodes())
+	case "DescribeHosts":
+		if gw.NATSConn == nil {
+			return errors.New(awserrors.ErrorServerInternal)
+		}
+		output, err = gateway_spx.DescribeHosts(gw.NATSConn, accountID)
 	case "GetVMs":
 		if gw.NATSConn == nil {
 			return errors.New(awserrors.ErrorServerInternal)
@@ -74,6 +95,137 @@ func (gw *GatewayConfig) Spinifex_Request(w http.ResponseWriter, r *http.Request
 			return errors.New(awserrors.ErrorServerInternal)
 		}
 		output, err = gateway_spx.GetStorageStatus(gw.NATSConn)
+	case "GetPlacementScore":
+		if gw.NATSConn == nil {
+			return errors.New(awserrors.ErrorServerInternal)
+		}
+		input := &gateway_spx.GetPlacementScoreInput{InstanceType: queryArgs["InstanceType"]}
+		if v := queryArgs["TargetCapacity"]; v != "" {
+			if input.TargetCapacity, err = strconv.Atoi(v); err != nil {
+				return errors.New(awserrors.ErrorInvalidParameterValue)
+			}
+		}
+		output, err = gateway_spx.GetPlacementScore(gw.NATSConn, gw.DiscoverActiveNodes(), input, accountID)
+	case "GetInstanceGroups":
+		if gw.NATSConn == nil {
+			return errors.New(awserrors.ErrorServerInternal)
+		}
+		input := &gateway_spx.GetInstanceGroupsInput{TagKey: queryArgs["TagKey"]}
+		if v := queryArgs["IncludeStates"]; v != "" {
+			if input.IncludeStates, err = strconv.ParseBool(v); err != nil {
+				return errors.New(awserrors.ErrorInvalidParameterValue)
+			}
+		}
+		output, err = gateway_spx.GetInstanceGroups(gw.NATSConn, gw.DiscoverActiveNodes(), input, accountID)
+	case "DescribeSnapshotTree":
+		if gw.NATSConn == nil {
+			return errors.New(awserrors.ErrorServerInternal)
+		}
+		output, err = gateway_ec2_snapshot.DescribeSnapshotTree(&handlers_ec2_snapshot.DescribeSnapshotTreeInput{
+			SnapshotID: queryArgs["SnapshotId"],
+		}, gw.NATSConn, accountID)
+	case "CreateSnapshotsByTag":
+		if gw.NATSConn == nil {
+			return errors.New(awserrors.ErrorServerInternal)
+		}
+		input := &handlers_ec2_snapshot.CreateSnapshotsByTagInput{}
+		if err := awsec2query.QueryParamsToStruct(queryArgs, input); err != nil {
+			return errors.New(awserrors.ErrorInvalidParameter)
+		}
+		output, err = gateway_ec2_snapshot.CreateSnapshotsByTag(input, gw.NATSConn, accountID)
+	case "BatchCreateTags":
+		if gw.NATSConn == nil {
+			return errors.New(awserrors.ErrorServerInternal)
+		}
+		input := &handlers_ec2_tags.BatchCreateTagsInput{}
+		if err := awsec2query.QueryParamsToStruct(queryArgs, input); err != nil {
+			return errors.New(awserrors.ErrorInvalidParameter)
+		}
+		output, err = gateway_ec2_tags.BatchCreateTags(input, gw.NATSConn, accountID)
+	case "BatchDeleteTags":
+		if gw.NATSConn == nil {
+			return errors.New(awserrors.ErrorServerInternal)
+		}
+		input := &handlers_ec2_tags.BatchDeleteTagsInput{}
+		if err := awsec2query.QueryParamsToStruct(queryArgs, input); err != nil {
+			return errors.New(awserrors.ErrorInvalidParameter)
+		}
+		output, err = gateway_ec2_tags.BatchDeleteTags(input, gw.NATSConn, accountID)
+	case "CloneInstance":
+		if gw.NATSConn == nil {
+			return errors.New(awserrors.ErrorServerInternal)
+		}
+		input := &gateway_ec2_instance.CloneInstanceInput{
+			InstanceID:   queryArgs["InstanceId"],
+			InstanceType: queryArgs["InstanceType"],
+			CopyMode:     queryArgs["CopyMode"],
+		}
+		if v := queryArgs["CopyTags"]; v != "" {
+			if input.CopyTags, err = strconv.ParseBool(v); err != nil {
+				return errors.New(awserrors.ErrorInvalidParameterValue)
+			}
+		}
+		output, err = gateway_ec2_instance.CloneInstance(input, gw.NATSConn, gw.DiscoverActiveNodes(), accountID)
+	case "ScheduleInstanceEvent":
+		if gw.NATSConn == nil {
+			return errors.New(awserrors.ErrorServerInternal)
+		}
+		input := &handlers_ec2_instanceevent.ScheduleInstanceEventInput{
+			InstanceID:  queryArgs["InstanceId"],
+			Code:        queryArgs["Code"],
+			Description: queryArgs["Description"],
+		}
+		for param, dst := range map[string]*time.Time{"NotBefore": &input.NotBefore, "NotBeforeDeadline": &input.NotBeforeDeadline} {
+			if v := queryArgs[param]; v != "" {
+				if *dst, err = time.Parse(time.RFC3339, v); err != nil {
+					return errors.New(awserrors.ErrorInvalidParameterValue)
+				}
+			}
+		}
+		output, err = gateway_ec2_instance.ScheduleInstanceEvent(input, gw.NATSConn, accountID)
+	case "CreateInstanceSchedule":
+		if gw.NATSConn == nil {
+			return errors.New(awserrors.ErrorServerInternal)
+		}
+		// ScheduleAction, since Action names the API action
+		input := &handlers_ec2_instanceschedule.CreateInstanceScheduleInput{
+			InstanceID:         queryArgs["InstanceId"],
+			Action:             queryArgs["ScheduleAction"],
+			ScheduleExpression: queryArgs["ScheduleExpression"],
+			Timezone:           queryArgs["Timezone"],
+			Description:        queryArgs["Description"],
+		}
+		output, err = gateway_ec2_instance.CreateInstanceSchedule(input, gw.NATSConn, gw.DiscoverActiveNodes(), accountID)
+	case "DescribeInstanceSchedules":
+		if gw.NATSConn == nil {
+			return errors.New(awserrors.ErrorServerInternal)
+		}
+		input := &handlers_ec2_instanceschedule.DescribeInstanceSchedulesInput{}
+		if err := awsec2query.QueryParamsToStruct(queryArgs, input); err != nil {
+			return errors.New(awserrors.ErrorInvalidParameter)
+		}
+		output, err = gateway_ec2_instance.DescribeInstanceSchedules(input, gw.NATSConn, accountID)
+	case "DeleteInstanceSchedule":
+		if gw.NATSConn == nil {
+			return errors.New(awserrors.ErrorServerInternal)
+		}
+		output, err = gateway_ec2_instance.DeleteInstanceSchedule(&handlers_ec2_instanceschedule.DeleteInstanceScheduleInput{
+			InstanceScheduleID: queryArgs["InstanceScheduleId"],
+		}, gw.NATSConn, accountID)
+	case "DescribeAccountQuotas":
+		if gw.NATSConn == nil {
+			return errors.New(awserrors.ErrorServerInternal)
+		}
+		output, err = gateway_ec2_account.DescribeAccountQuotas(gw.NATSConn, accountID)
+	case "LookupEvents":
+		if gw.NATSConn == nil {
+			return errors.New(awserrors.ErrorServerInternal)
+		}
+		input, err := lookupEventsInput(queryArgs)
+		if err != nil {
+			return err
+		}
+		output, err = gw.lookupEvents(input)
 	default:
 		return errors.New(awserrors.ErrorInvalidAction)
 	}
@@ -95,3 +247,52 @@ func (gw *GatewayConfig) Spinifex_Request(w http.ResponseWriter, r *http.Request
 	}
 	return nil
 }
+
+// lookupEventsInput parses the LookupEvents filters: AccountId, EventName,
+// UserName, ResourceName, StartTime and EndTime (RFC 3339), MaxResults and
+// NextToken.
+func lookupEventsInput(queryArgs map[string]string) (*audit.LookupInput, error) {
+	input := &audit.LookupInput{
+		AccountID:    queryArgs["AccountId"],
+		EventName:    queryArgs["EventName"],
+		UserName:     queryArgs["UserName"],
+		ResourceName: queryArgs["ResourceName"],
+		NextToken:    queryArgs["NextToken"],
+	}
+	for param, dst := range map[string]*time.Time{"StartTime": &input.StartTime, "EndTime": &input.EndTime} {
+		if v := queryArgs[param]; v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, awserrors.WithDetail(awserrors.ErrorInvalidParameterValue, param+" must be an RFC 3339 timestamp")
+			}
+			*dst = t
+		}
+	}
+	if v := queryArgs["MaxResults"]; v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > audit.MaxLookupResults {
+			return nil, awserrors.WithDetail(awserrors.ErrorInvalidParameterValue,
+				fmt.Sprintf("MaxResults must be between 1 and %d", audit.MaxLookupResults))
+		}
+		input.MaxResults = n
+	}
+	return input, nil
+}
+
+// lookupEvents queries the audit stream.
+func (gw *GatewayConfig) lookupEvents(input *audit.LookupInput) (*audit.LookupOutput, error) {
+	js, err := gw.NATSConn.JetStream()
+	if err != nil {
+		slog.Error("LookupEvents: JetStream unavailable", "err", err)
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+	output, err := audit.Lookup(js, input)
+	if errors.Is(err, audit.ErrInvalidNextToken) {
+		return nil, errors.New(awserrors.ErrorInvalidNextToken)
+	}
+	if err != nil {
+		slog.Error("LookupEvents: audit stream query failed", "err", err)
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+	return output, nil
+}
@@ -2,6 +2,7 @@ package gateway
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -9,6 +10,12 @@ import (
 
 	"github.com/mulgadc/spinifex/spinifex/admin"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/config"
+	handlers_ec2_instanceschedule "github.com/mulgadc/spinifex/spinifex/handlers/ec2/instanceschedule"
+	"github.com/mulgadc/spinifex/spinifex/quota"
+	"github.com/mulgadc/spinifex/spinifex/testutil"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -137,3 +144,63 @@ func TestSpinifex_GetNodes_NoNATS(t *testing.T) {
 	require.Equal(t, http.StatusForbidden, w.Code)
 	assert.Contains(t, w.Body.String(), awserrors.ErrorServerInternal)
 }
+
+func TestSpinifex_DescribeAccountQuotas(t *testing.T) {
+	_, nc := testutil.StartTestNATS(t)
+	sub, err := nc.Subscribe(utils.Subject("ec2.DescribeAccountQuotas"), func(msg *nats.Msg) {
+		out := quota.Describe(config.AccountQuota{AccountID: utils.AccountIDFromMsg(msg), MaxInstances: 20}, quota.Usage{Instances: 3})
+		data, _ := json.Marshal(out)
+		_ = msg.Respond(data)
+	})
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	gw := &GatewayConfig{DisableLogging: true, NATSConn: nc}
+	w := spinifexRequest(t, gw, "DescribeAccountQuotas", "000000000002", "bob")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var out quota.DescribeAccountQuotasOutput
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &out))
+	assert.Equal(t, "000000000002", out.AccountID)
+	assert.Contains(t, out.Quotas, quota.Quota{Name: "max-instances", Limit: 20, Usage: 3})
+}
+
+func TestSpinifex_InstanceSchedules(t *testing.T) {
+	_, nc := testutil.StartTestNATS(t)
+	var describeInput handlers_ec2_instanceschedule.DescribeInstanceSchedulesInput
+	sub, err := nc.Subscribe(utils.Subject("ec2.DescribeInstanceSchedules"), func(msg *nats.Msg) {
+		_ = json.Unmarshal(msg.Data, &describeInput)
+		data, _ := json.Marshal(&handlers_ec2_instanceschedule.DescribeInstanceSchedulesOutput{
+			InstanceSchedules: []*handlers_ec2_instanceschedule.InstanceSchedule{{InstanceScheduleID: "isch-1", AccountID: utils.AccountIDFromMsg(msg)}},
+		})
+		_ = msg.Respond(data)
+	})
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+	var deleted string
+	sub, err = nc.Subscribe(utils.Subject("ec2.DeleteInstanceSchedule"), func(msg *nats.Msg) {
+		var input handlers_ec2_instanceschedule.DeleteInstanceScheduleInput
+		_ = json.Unmarshal(msg.Data, &input)
+		deleted = input.InstanceScheduleID
+		_ = msg.Respond([]byte(`{"return":true}`))
+	})
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	// Schedules are not admin-only
+	gw := &GatewayConfig{DisableLogging: true, NATSConn: nc}
+	w := spinifexRequest(t, gw, "DescribeInstanceSchedules&InstanceScheduleId.1=isch-1&InstanceScheduleId.2=isch-2", "000000000002", "bob")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []string{"isch-1", "isch-2"}, describeInput.InstanceScheduleIDs)
+	var out handlers_ec2_instanceschedule.DescribeInstanceSchedulesOutput
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &out))
+	require.Len(t, out.InstanceSchedules, 1)
+	assert.Equal(t, "000000000002", out.InstanceSchedules[0].AccountID)
+
+	w = spinifexRequest(t, gw, "DeleteInstanceSchedule&InstanceScheduleId=isch-1", "000000000002", "bob")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "isch-1", deleted)
+
+	w = spinifexRequest(t, gw, "DeleteInstanceSchedule&InstanceScheduleId=i-1", "000000000002", "bob")
+	assert.Contains(t, w.Body.String(), awserrors.ErrorInvalidInstanceScheduleIDMalformed)
+}
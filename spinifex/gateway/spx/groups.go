@@ -0,0 +1,136 @@
+package spx
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	gateway_ec2_instance "github.com/mulgadc/spinifex/spinifex/gateway/ec2/instance"
+	handlers_ec2_tags "github.com/mulgadc/spinifex/spinifex/handlers/ec2/tags"
+	"github.com/nats-io/nats.go"
+)
+
+// GetInstanceGroupsInput is the request for GetInstanceGroups.
+type GetInstanceGroupsInput struct {
+	TagKey string `json:"tag_key"`
+	// IncludeStates adds a per-state count to each group.
+	IncludeStates bool `json:"include_states"`
+}
+
+// InstanceGroup is the set of instances sharing one value of the tag key.
+// Instances without the tag form a single group with Untagged set.
+type InstanceGroup struct {
+	Value    string         `json:"value"`
+	Untagged bool           `json:"untagged,omitempty"`
+	Count    int            `json:"count"`
+	States   map[string]int `json:"states,omitempty"`
+}
+
+// GetInstanceGroupsOutput is the response for GetInstanceGroups. Groups are
+// sorted by value, with the untagged group last.
+type GetInstanceGroupsOutput struct {
+	TagKey string          `json:"tag_key"`
+	Total  int             `json:"total"`
+	Groups []InstanceGroup `json:"groups"`
+}
+
+// GetInstanceGroups groups the caller's instances by the value of a tag key,
+// so the UI can render views such as instances by Environment without
+// fetching and grouping every instance itself. Tag values come from the
+// instances' own tags in DescribeInstances, falling back to the tag store for
+// instances whose tags it doesn't carry.
+func GetInstanceGroups(nc *nats.Conn, expectedNodes int, input *GetInstanceGroupsInput, accountID string) (*GetInstanceGroupsOutput, error) {
+	if input == nil || input.TagKey == "" {
+		return nil, errors.New(awserrors.ErrorMissingParameter)
+	}
+
+	tags, err := handlers_ec2_tags.NewNATSTagsService(nc).DescribeTags(&ec2.DescribeTagsInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("resource-type"), Values: []*string{aws.String("instance")}},
+			{Name: aws.String("key"), Values: []*string{aws.String(input.TagKey)}},
+		},
+	}, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	instances, err := gateway_ec2_instance.DescribeInstances(&ec2.DescribeInstancesInput{}, nc, expectedNodes, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	return groupInstances(input, tags.Tags, instances.Reservations), nil
+}
+
+// groupInstances counts instances per tag value. An instance's own tag
+// wins over the tag store's. Tags on resources that DescribeInstances didn't
+// return, such as long-terminated instances, are ignored.
+func groupInstances(input *GetInstanceGroupsInput, tags []*ec2.TagDescription, reservations []*ec2.Reservation) *GetInstanceGroupsOutput {
+	values := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		values[aws.StringValue(tag.ResourceId)] = aws.StringValue(tag.Value)
+	}
+	for _, reservation := range reservations {
+		for _, instance := range reservation.Instances {
+			if instance == nil {
+				continue
+			}
+			for _, tag := range instance.Tags {
+				if aws.StringValue(tag.Key) == input.TagKey {
+					values[aws.StringValue(instance.InstanceId)] = aws.StringValue(tag.Value)
+				}
+			}
+		}
+	}
+
+	out := &GetInstanceGroupsOutput{TagKey: input.TagKey, Groups: []InstanceGroup{}}
+	groups := make(map[string]*InstanceGroup)
+	var untagged *InstanceGroup
+
+	for _, reservation := range reservations {
+		for _, instance := range reservation.Instances {
+			if instance == nil {
+				continue
+			}
+
+			var group *InstanceGroup
+			if value, ok := values[aws.StringValue(instance.InstanceId)]; ok {
+				group = groups[value]
+				if group == nil {
+					group = &InstanceGroup{Value: value}
+					groups[value] = group
+				}
+			} else {
+				if untagged == nil {
+					untagged = &InstanceGroup{Untagged: true}
+				}
+				group = untagged
+			}
+
+			group.Count++
+			out.Total++
+			if input.IncludeStates {
+				if group.States == nil {
+					group.States = make(map[string]int)
+				}
+				state := "unknown"
+				if instance.State != nil && instance.State.Name != nil {
+					state = *instance.State.Name
+				}
+				group.States[state]++
+			}
+		}
+	}
+
+	for _, group := range groups {
+		out.Groups = append(out.Groups, *group)
+	}
+	sort.Slice(out.Groups, func(i, j int) bool { return out.Groups[i].Value < out.Groups[j].Value })
+	if untagged != nil {
+		out.Groups = append(out.Groups, *untagged)
+	}
+
+	return out
+}
@@ -0,0 +1,109 @@
+package spx
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetInstanceGroups(t *testing.T) {
+	_, nc := startEmbeddedNATS(t)
+
+	fleet := map[string]string{
+		"i-prod-1":    ec2.InstanceStateNameRunning,
+		"i-prod-2":    ec2.InstanceStateNameRunning,
+		"i-prod-3":    ec2.InstanceStateNameStopped,
+		"i-staging-1": ec2.InstanceStateNameRunning,
+		"i-dev-1":     ec2.InstanceStateNamePending,
+		"i-untagged":  ec2.InstanceStateNameRunning,
+		"i-own-tag":   ec2.InstanceStateNameRunning,
+	}
+	// Tags the instances carry themselves, which the tag store may lack or
+	// hold stale.
+	instanceTags := map[string]string{
+		"i-own-tag": "staging",
+		"i-dev-1":   "dev",
+	}
+	environments := map[string]string{
+		"i-prod-1":    "prod",
+		"i-prod-2":    "prod",
+		"i-prod-3":    "prod",
+		"i-staging-1": "staging",
+		"i-dev-1":     "prod",
+		// Tag left behind by an instance DescribeInstances no longer returns.
+		"i-gone": "prod",
+	}
+
+	var tagsInput ec2.DescribeTagsInput
+	tagSub, err := nc.Subscribe("ec2.DescribeTags", func(msg *nats.Msg) {
+		_ = json.Unmarshal(msg.Data, &tagsInput)
+		out := ec2.DescribeTagsOutput{}
+		for id, env := range environments {
+			out.Tags = append(out.Tags, &ec2.TagDescription{
+				ResourceId:   aws.String(id),
+				ResourceType: aws.String("instance"),
+				Key:          aws.String("Environment"),
+				Value:        aws.String(env),
+			})
+		}
+		data, _ := json.Marshal(out)
+		msg.Respond(data)
+	})
+	require.NoError(t, err)
+	defer tagSub.Unsubscribe()
+
+	instanceSub, err := nc.Subscribe("ec2.DescribeInstances", func(msg *nats.Msg) {
+		reservation := &ec2.Reservation{}
+		for id, state := range fleet {
+			instance := &ec2.Instance{
+				InstanceId: aws.String(id),
+				State:      &ec2.InstanceState{Name: aws.String(state)},
+			}
+			if env, ok := instanceTags[id]; ok {
+				instance.Tags = []*ec2.Tag{{Key: aws.String("Environment"), Value: aws.String(env)}}
+			}
+			reservation.Instances = append(reservation.Instances, instance)
+		}
+		data, _ := json.Marshal(ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{reservation}})
+		msg.Respond(data)
+	})
+	require.NoError(t, err)
+	defer instanceSub.Unsubscribe()
+	nc.Flush()
+
+	out, err := GetInstanceGroups(nc, 1, &GetInstanceGroupsInput{TagKey: "Environment", IncludeStates: true}, "000000000001")
+	require.NoError(t, err)
+
+	// Only the requested key's instance tags are fetched from the tag store.
+	require.Len(t, tagsInput.Filters, 2)
+	assert.Equal(t, "resource-type", aws.StringValue(tagsInput.Filters[0].Name))
+	assert.Equal(t, "key", aws.StringValue(tagsInput.Filters[1].Name))
+	assert.Equal(t, "Environment", aws.StringValue(tagsInput.Filters[1].Values[0]))
+
+	assert.Equal(t, "Environment", out.TagKey)
+	assert.Equal(t, 7, out.Total)
+	assert.Equal(t, []InstanceGroup{
+		{Value: "dev", Count: 1, States: map[string]int{"pending": 1}},
+		{Value: "prod", Count: 3, States: map[string]int{"running": 2, "stopped": 1}},
+		{Value: "staging", Count: 2, States: map[string]int{"running": 2}},
+		{Untagged: true, Count: 1, States: map[string]int{"running": 1}},
+	}, out.Groups)
+
+	// Without the state breakdown only counts are returned.
+	out, err = GetInstanceGroups(nc, 1, &GetInstanceGroupsInput{TagKey: "Environment"}, "000000000001")
+	require.NoError(t, err)
+	require.Len(t, out.Groups, 4)
+	assert.Equal(t, 3, out.Groups[1].Count)
+	assert.Nil(t, out.Groups[1].States)
+}
+
+func TestGetInstanceGroups_MissingTagKey(t *testing.T) {
+	_, err := GetInstanceGroups(nil, 1, &GetInstanceGroupsInput{}, "000000000001")
+	assert.EqualError(t, err, awserrors.ErrorMissingParameter)
+}
@@ -0,0 +1,185 @@
+package spx
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// maxPlacementTargetCapacity caps the instance count a single score query may ask about.
+	maxPlacementTargetCapacity = 1000
+
+	// maxPlacementConfigs is how many distinct (instance type, capacity) configurations
+	// an account may score within placementConfigWindow, mirroring the AWS Spot
+	// placement score limit. Repeating a configuration already seen is always allowed.
+	maxPlacementConfigs = 10
+
+	placementConfigWindow = 24 * time.Hour
+)
+
+// GetPlacementScoreInput is the request for GetPlacementScore.
+type GetPlacementScoreInput struct {
+	InstanceType   string `json:"instance_type"`
+	TargetCapacity int    `json:"target_capacity"`
+}
+
+// PlacementScore rates one node or availability zone for a placement request.
+type PlacementScore struct {
+	AvailabilityZone string `json:"availability_zone"`
+	Node             string `json:"node,omitempty"`
+	Available        int    `json:"available"`
+	Score            int    `json:"score"`
+}
+
+// GetPlacementScoreOutput is the response for GetPlacementScore. Entries are
+// sorted by score, highest first.
+type GetPlacementScoreOutput struct {
+	InstanceType      string           `json:"instance_type"`
+	TargetCapacity    int              `json:"target_capacity"`
+	AvailabilityZones []PlacementScore `json:"availability_zones"`
+	Nodes             []PlacementScore `json:"nodes"`
+}
+
+// placementConfigTracker remembers the configurations each account scored
+// recently so GetPlacementScore can't be used to continuously probe capacity.
+type placementConfigTracker struct {
+	mu   sync.Mutex
+	seen map[string]map[string]time.Time // accountID → config key → first seen
+}
+
+var placementConfigs = &placementConfigTracker{seen: make(map[string]map[string]time.Time)}
+
+// allow records key for accountID and reports whether it fits within the limit.
+func (t *placementConfigTracker) allow(accountID, key string, now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	configs := t.seen[accountID]
+	if configs == nil {
+		configs = make(map[string]time.Time)
+		t.seen[accountID] = configs
+	}
+	for k, seenAt := range configs {
+		if now.Sub(seenAt) >= placementConfigWindow {
+			delete(configs, k)
+		}
+	}
+
+	if _, ok := configs[key]; ok {
+		return true
+	}
+	if len(configs) >= maxPlacementConfigs {
+		return false
+	}
+	configs[key] = now
+	return true
+}
+
+// ValidateGetPlacementScoreInput validates the input parameters for GetPlacementScore.
+func ValidateGetPlacementScoreInput(input *GetPlacementScoreInput) error {
+	if input == nil || input.InstanceType == "" {
+		return errors.New(awserrors.ErrorMissingParameter)
+	}
+	if input.TargetCapacity < 1 {
+		return errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if input.TargetCapacity > maxPlacementTargetCapacity {
+		return errors.New(awserrors.ErrorTargetCapacityLimitExceededException)
+	}
+	return nil
+}
+
+// GetPlacementScore queries every node's free capacity and scores how well
+// each node and availability zone could satisfy the requested launch.
+func GetPlacementScore(nc *nats.Conn, expectedNodes int, input *GetPlacementScoreInput, accountID string) (*GetPlacementScoreOutput, error) {
+	if err := ValidateGetPlacementScoreInput(input); err != nil {
+		return nil, err
+	}
+
+	key := fmt.Sprintf("%s/%d", input.InstanceType, input.TargetCapacity)
+	if !placementConfigs.allow(accountID, key, time.Now()) {
+		slog.Info("GetPlacementScore: configuration limit exceeded", "accountID", accountID, "config", key)
+		return nil, errors.New(awserrors.ErrorMaxConfigLimitExceededException)
+	}
+
+	nodes, err := GetNodes(nc, expectedNodes)
+	if err != nil {
+		return nil, err
+	}
+
+	return scorePlacement(nodes.Nodes, input.InstanceType, input.TargetCapacity), nil
+}
+
+// scorePlacement builds per-node and per-AZ scores from node status responses.
+func scorePlacement(nodes []types.NodeStatusResponse, instanceType string, target int) *GetPlacementScoreOutput {
+	out := &GetPlacementScoreOutput{
+		InstanceType:      instanceType,
+		TargetCapacity:    target,
+		AvailabilityZones: []PlacementScore{},
+		Nodes:             []PlacementScore{},
+	}
+
+	azAvailable := make(map[string]int)
+	for _, node := range nodes {
+		available := 0
+		for _, c := range node.InstanceTypes {
+			if c.Name == instanceType {
+				available = c.Available
+				break
+			}
+		}
+		azAvailable[node.AZ] += available
+		out.Nodes = append(out.Nodes, PlacementScore{
+			AvailabilityZone: node.AZ,
+			Node:             node.Node,
+			Available:        available,
+			Score:            placementScore(available, target),
+		})
+	}
+
+	for az, available := range azAvailable {
+		out.AvailabilityZones = append(out.AvailabilityZones, PlacementScore{
+			AvailabilityZone: az,
+			Available:        available,
+			Score:            placementScore(available, target),
+		})
+	}
+
+	sortPlacementScores(out.Nodes)
+	sortPlacementScores(out.AvailabilityZones)
+	return out
+}
+
+// placementScore rates how well available slots satisfy target instances on a
+// 0–100 scale. Meeting the target exactly scores 80; the remaining 20 points
+// reward headroom up to twice the target, so emptier nodes rank higher.
+func placementScore(available, target int) int {
+	if available <= 0 || target <= 0 {
+		return 0
+	}
+	if available < target {
+		return available * 80 / target
+	}
+	headroom := min(available-target, target)
+	return 80 + headroom*20/target
+}
+
+func sortPlacementScores(scores []PlacementScore) {
+	sort.SliceStable(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score > scores[j].Score
+		}
+		if scores[i].AvailabilityZone != scores[j].AvailabilityZone {
+			return scores[i].AvailabilityZone < scores[j].AvailabilityZone
+		}
+		return scores[i].Node < scores[j].Node
+	})
+}
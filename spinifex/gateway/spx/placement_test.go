@@ -0,0 +1,98 @@
+package spx
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlacementScore(t *testing.T) {
+	assert.Equal(t, 0, placementScore(0, 4))
+	assert.Equal(t, 40, placementScore(2, 4))
+	assert.Equal(t, 80, placementScore(4, 4))
+	assert.Equal(t, 90, placementScore(6, 4))
+	assert.Equal(t, 100, placementScore(8, 4))
+	assert.Equal(t, 100, placementScore(50, 4))
+}
+
+func TestScorePlacement_MoreFreeCapacityScoresHigher(t *testing.T) {
+	nodes := []types.NodeStatusResponse{
+		{Node: "node-busy", AZ: "ap-southeast-2a", InstanceTypes: []types.InstanceTypeCap{{Name: "t3.small", Available: 1}}},
+		{Node: "node-idle", AZ: "ap-southeast-2b", InstanceTypes: []types.InstanceTypeCap{{Name: "t3.small", Available: 6}}},
+		{Node: "node-other", AZ: "ap-southeast-2b", InstanceTypes: []types.InstanceTypeCap{{Name: "m5.large", Available: 9}}},
+	}
+
+	out := scorePlacement(nodes, "t3.small", 3)
+	require.Len(t, out.Nodes, 3)
+	assert.Equal(t, "node-idle", out.Nodes[0].Node)
+	assert.Equal(t, 100, out.Nodes[0].Score)
+	assert.Equal(t, "node-busy", out.Nodes[1].Node)
+	assert.Equal(t, 26, out.Nodes[1].Score)
+	assert.Equal(t, "node-other", out.Nodes[2].Node)
+	assert.Equal(t, 0, out.Nodes[2].Score)
+
+	require.Len(t, out.AvailabilityZones, 2)
+	assert.Equal(t, "ap-southeast-2b", out.AvailabilityZones[0].AvailabilityZone)
+	assert.Equal(t, 6, out.AvailabilityZones[0].Available)
+	assert.Greater(t, out.AvailabilityZones[0].Score, out.AvailabilityZones[1].Score)
+}
+
+func TestValidateGetPlacementScoreInput(t *testing.T) {
+	assert.EqualError(t, ValidateGetPlacementScoreInput(nil), awserrors.ErrorMissingParameter)
+	assert.EqualError(t, ValidateGetPlacementScoreInput(&GetPlacementScoreInput{TargetCapacity: 1}), awserrors.ErrorMissingParameter)
+	assert.EqualError(t, ValidateGetPlacementScoreInput(&GetPlacementScoreInput{InstanceType: "t3.small"}), awserrors.ErrorInvalidParameterValue)
+	assert.EqualError(t, ValidateGetPlacementScoreInput(&GetPlacementScoreInput{
+		InstanceType:   "t3.small",
+		TargetCapacity: maxPlacementTargetCapacity + 1,
+	}), awserrors.ErrorTargetCapacityLimitExceededException)
+	assert.NoError(t, ValidateGetPlacementScoreInput(&GetPlacementScoreInput{InstanceType: "t3.small", TargetCapacity: 2}))
+}
+
+func TestPlacementConfigTracker_Limit(t *testing.T) {
+	tracker := &placementConfigTracker{seen: make(map[string]map[string]time.Time)}
+	now := time.Now()
+
+	for i := range maxPlacementConfigs {
+		assert.True(t, tracker.allow("acct", fmt.Sprintf("t3.small/%d", i+1), now))
+	}
+	assert.False(t, tracker.allow("acct", "t3.small/99", now))
+
+	// Repeating a known configuration and other accounts are unaffected
+	assert.True(t, tracker.allow("acct", "t3.small/1", now))
+	assert.True(t, tracker.allow("other", "t3.small/99", now))
+
+	// Configurations expire after the window
+	assert.True(t, tracker.allow("acct", "t3.small/99", now.Add(placementConfigWindow)))
+}
+
+func TestGetPlacementScore(t *testing.T) {
+	_, nc := startEmbeddedNATS(t)
+
+	sub, err := nc.Subscribe(subjects.NodeStatus, func(msg *nats.Msg) {
+		resp := types.NodeStatusResponse{
+			Node:          "node1",
+			AZ:            "ap-southeast-2a",
+			InstanceTypes: []types.InstanceTypeCap{{Name: "t3.small", Available: 2}},
+		}
+		data, _ := json.Marshal(resp)
+		msg.Respond(data)
+	})
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+	nc.Flush()
+
+	out, err := GetPlacementScore(nc, 1, &GetPlacementScoreInput{InstanceType: "t3.small", TargetCapacity: 2}, "000000000001")
+	require.NoError(t, err)
+	require.Len(t, out.Nodes, 1)
+	assert.Equal(t, 80, out.Nodes[0].Score)
+	require.Len(t, out.AvailabilityZones, 1)
+	assert.Equal(t, "ap-southeast-2a", out.AvailabilityZones[0].AvailabilityZone)
+}
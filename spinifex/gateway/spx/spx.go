@@ -4,11 +4,11 @@
 package spx
 
 import (
-	"encoding/json"
 	"runtime"
 	"strings"
 	"time"
 
+	"github.com/mulgadc/spinifex/spinifex/subjects"
 	"github.com/mulgadc/spinifex/spinifex/types"
 	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/nats-io/nats.go"
@@ -67,7 +67,7 @@ func GetNodes(nc *nats.Conn, expectedNodes int) (*GetNodesOutput, error) {
 	}
 	defer sub.Unsubscribe()
 
-	err = nc.PublishRequest("spinifex.node.status", inbox, []byte("{}"))
+	err = nc.PublishRequest(utils.Subject(subjects.NodeStatus), inbox, []byte("{}"))
 	if err != nil {
 		return nil, err
 	}
@@ -91,12 +91,8 @@ func GetNodes(nc *nats.Conn, expectedNodes int) (*GetNodesOutput, error) {
 		}
 		responsesReceived++
 
-		if _, valErr := utils.ValidateErrorPayload(msg.Data); valErr != nil {
-			continue
-		}
-
 		var node types.NodeStatusResponse
-		if err := json.Unmarshal(msg.Data, &node); err != nil {
+		if err := utils.DecodeReply(msg).Decode(&node); err != nil {
 			continue
 		}
 		nodes = append(nodes, node)
@@ -138,7 +134,7 @@ func GetVMs(nc *nats.Conn, expectedNodes int) (*GetVMsOutput, error) {
 	}
 	defer sub.Unsubscribe()
 
-	err = nc.PublishRequest("spinifex.node.vms", inbox, []byte("{}"))
+	err = nc.PublishRequest(utils.Subject("spinifex.node.vms"), inbox, []byte("{}"))
 	if err != nil {
 		return nil, err
 	}
@@ -162,12 +158,8 @@ func GetVMs(nc *nats.Conn, expectedNodes int) (*GetVMsOutput, error) {
 		}
 		responsesReceived++
 
-		if _, valErr := utils.ValidateErrorPayload(msg.Data); valErr != nil {
-			continue
-		}
-
 		var nodeResp types.NodeVMsResponse
-		if err := json.Unmarshal(msg.Data, &nodeResp); err != nil {
+		if err := utils.DecodeReply(msg).Decode(&nodeResp); err != nil {
 			continue
 		}
 		for _, vm := range nodeResp.VMs {
@@ -186,3 +178,11 @@ func GetVMs(nc *nats.Conn, expectedNodes int) (*GetVMsOutput, error) {
 		VMs: allVMs,
 	}, nil
 }
+
+// DescribeHosts returns the node registry's view of every node, including
+// nodes that stopped sending heartbeats and the instances impaired on them.
+// Unlike GetNodes it is answered by one daemon, so it lists nodes that are
+// down.
+func DescribeHosts(nc *nats.Conn, accountID string) (*types.DescribeHostsOutput, error) {
+	return utils.NATSRequest[types.DescribeHostsOutput](nc, subjects.DescribeHosts, struct{}{}, 3*time.Second, accountID)
+}
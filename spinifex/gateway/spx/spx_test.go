@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"testing"
 
+	"github.com/mulgadc/spinifex/spinifex/subjects"
 	"github.com/mulgadc/spinifex/spinifex/testutil"
 	"github.com/mulgadc/spinifex/spinifex/types"
 	"github.com/nats-io/nats-server/v2/server"
@@ -67,7 +68,7 @@ func TestGetNodes_NoResponders(t *testing.T) {
 func TestGetNodes_SingleNode(t *testing.T) {
 	_, nc := startEmbeddedNATS(t)
 
-	sub, err := nc.Subscribe("spinifex.node.status", func(msg *nats.Msg) {
+	sub, err := nc.Subscribe(subjects.NodeStatus, func(msg *nats.Msg) {
 		resp := types.NodeStatusResponse{
 			Node:       "node1",
 			Status:     "Ready",
@@ -106,7 +107,7 @@ func TestGetNodes_MultiNode(t *testing.T) {
 
 	for _, name := range []string{"node1", "node2", "node3"} {
 		nodeName := name
-		sub, err := nc.Subscribe("spinifex.node.status", func(msg *nats.Msg) {
+		sub, err := nc.Subscribe(subjects.NodeStatus, func(msg *nats.Msg) {
 			resp := types.NodeStatusResponse{Node: nodeName, Status: "Ready"}
 			data, _ := json.Marshal(resp)
 			msg.Respond(data)
@@ -182,3 +183,30 @@ func TestGetVMs_MultiNode(t *testing.T) {
 	require.NoError(t, err)
 	require.Len(t, out.VMs, 2)
 }
+
+func TestDescribeHosts(t *testing.T) {
+	_, nc := startEmbeddedNATS(t)
+
+	sub, err := nc.Subscribe(subjects.DescribeHosts, func(msg *nats.Msg) {
+		data, _ := json.Marshal(types.DescribeHostsOutput{Hosts: []types.HostInfo{
+			{Node: "node1", State: types.HostStateAvailable, RunningInstances: 2},
+			{Node: "node2", State: types.HostStateLost, ImpairedInstances: []string{"i-lost"}},
+		}})
+		msg.Respond(data)
+	})
+	require.NoError(t, err)
+	defer sub.Unsubscribe()
+
+	out, err := DescribeHosts(nc, "000000000001")
+	require.NoError(t, err)
+	require.Len(t, out.Hosts, 2)
+	assert.Equal(t, types.HostStateLost, out.Hosts[1].State)
+	assert.Equal(t, []string{"i-lost"}, out.Hosts[1].ImpairedInstances)
+}
+
+func TestDescribeHosts_NoResponders(t *testing.T) {
+	_, nc := startEmbeddedNATS(t)
+
+	_, err := DescribeHosts(nc, "000000000001")
+	require.Error(t, err)
+}
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/nats-io/nats.go"
 )
 
@@ -53,7 +54,7 @@ var storageHTTPClient = &http.Client{
 // node's /status and /health endpoints in parallel.
 func GetStorageStatus(nc *nats.Conn) (*StorageStatusOutput, error) {
 	// Phase 1: get config from any daemon via NATS
-	msg, err := nc.Request("spinifex.storage.config", []byte("{}"), 3*time.Second)
+	msg, err := nc.Request(utils.Subject("spinifex.storage.config"), []byte("{}"), 3*time.Second)
 	if err != nil {
 		return nil, fmt.Errorf("storage config request: %w", err)
 	}
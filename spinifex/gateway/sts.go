@@ -0,0 +1,158 @@
+package gateway
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/mulgadc/spinifex/spinifex/awsec2query"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_iam "github.com/mulgadc/spinifex/spinifex/handlers/iam"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+)
+
+// STSHandler processes parsed query args for the authenticated caller of r
+// and returns the action's output.
+type STSHandler func(gw *GatewayConfig, r *http.Request, q map[string]string) (any, error)
+
+// stsHandler creates a type-safe STSHandler that parses and validates the
+// typed input struct before calling the handler.
+func stsHandler[In any](handler func(*GatewayConfig, *http.Request, *In) (any, error)) STSHandler {
+	return func(gw *GatewayConfig, r *http.Request, q map[string]string) (any, error) {
+		input := new(In)
+		if err := awsec2query.QueryParamsToStruct(q, input); err != nil {
+			if errors.Is(err, awsec2query.ErrSliceTooLarge) {
+				return nil, errors.New(awserrors.ErrorMalformedQueryString)
+			}
+			return nil, errors.New(awserrors.ErrorValidationError)
+		}
+		if err := validateInput(input); err != nil {
+			return nil, err
+		}
+		return handler(gw, r, input)
+	}
+}
+
+var stsActions = map[string]STSHandler{
+	"GetCallerIdentity": stsHandler(func(gw *GatewayConfig, r *http.Request, _ *sts.GetCallerIdentityInput) (any, error) {
+		caller, err := gw.callerIdentity(r)
+		if err != nil {
+			return nil, err
+		}
+		return caller, nil
+	}),
+	"GetSessionToken": stsHandler(func(gw *GatewayConfig, r *http.Request, input *sts.GetSessionTokenInput) (any, error) {
+		// Session credentials cannot mint further sessions, as on AWS.
+		if callerIsTemporary(r) {
+			return nil, errors.New(awserrors.ErrorAccessDenied)
+		}
+		accountID, _ := r.Context().Value(ctxAccountID).(string)
+		userName, _ := r.Context().Value(ctxIdentity).(string)
+		return gw.IAMService.GetSessionToken(accountID, userName, input)
+	}),
+	"AssumeRole": stsHandler(func(gw *GatewayConfig, r *http.Request, input *sts.AssumeRoleInput) (any, error) {
+		if err := gw.checkPolicyFor(r, "sts", "AssumeRole", []string{*input.RoleArn}); err != nil {
+			return nil, err
+		}
+		caller, err := gw.callerIdentity(r)
+		if err != nil {
+			return nil, err
+		}
+		return gw.IAMService.AssumeRole(*caller.Account, *caller.Arn, input)
+	}),
+}
+
+// STS_Request serves the Security Token Service actions that issue temporary
+// credentials. Responses and errors use the IAM query format.
+func (gw *GatewayConfig) STS_Request(w http.ResponseWriter, r *http.Request) error {
+	queryArgs, err := readQueryArgs(r)
+	if err != nil {
+		slog.Debug("STS: malformed query string", "err", err)
+		return errors.New(awserrors.ErrorMalformedQueryString)
+	}
+
+	action := queryArgs["Action"]
+	if action == "" {
+		return errors.New(awserrors.ErrorMissingAction)
+	}
+	handler, ok := stsActions[action]
+	if !ok {
+		slog.Debug("STS: unknown action", "action", action)
+		return errors.New(awserrors.ErrorInvalidAction)
+	}
+
+	if gw.IAMService == nil {
+		slog.Error("STS: service not initialized")
+		return errors.New(awserrors.ErrorInternalError)
+	}
+
+	output, err := handler(gw, r, queryArgs)
+	if err != nil {
+		return err
+	}
+
+	xmlOutput, err := utils.MarshalToXML(utils.GenerateIAMXMLPayload(action, output))
+	if err != nil {
+		return errors.New(awserrors.ErrorInternalError)
+	}
+
+	xmlOutput = addRequestID(xmlOutput, requestIDOf(r), true)
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(xmlOutput); err != nil {
+		slog.Error("Failed to write STS response", "err", err)
+	}
+	return nil
+}
+
+// callerIdentity returns the account, ARN and unique ID of the principal
+// that signed r: an IAM user, an account root user, or a role session.
+func (gw *GatewayConfig) callerIdentity(r *http.Request) (*sts.GetCallerIdentityOutput, error) {
+	accountID, _ := r.Context().Value(ctxAccountID).(string)
+	identity, _ := r.Context().Value(ctxIdentity).(string)
+	if accountID == "" || identity == "" {
+		slog.Error("callerIdentity: no identity in auth context")
+		return nil, errors.New(awserrors.ErrorInternalError)
+	}
+
+	if roleName, ok := r.Context().Value(ctxRoleName).(string); ok {
+		sessionName, _ := r.Context().Value(ctxSessionName).(string)
+		role, err := gw.IAMService.GetRole(accountID, &iam.GetRoleInput{RoleName: aws.String(roleName)})
+		if err != nil {
+			return nil, err
+		}
+		return &sts.GetCallerIdentityOutput{
+			Account: aws.String(accountID),
+			Arn:     aws.String(handlers_iam.AssumedRoleARN(accountID, roleName, sessionName)),
+			UserId:  aws.String(aws.StringValue(role.Role.RoleId) + ":" + sessionName),
+		}, nil
+	}
+
+	user, err := gw.IAMService.GetUser(accountID, &iam.GetUserInput{UserName: aws.String(identity)})
+	if err != nil {
+		if identity == "root" && err.Error() == awserrors.ErrorIAMNoSuchEntity {
+			// Account root users are not always stored as IAM users.
+			return &sts.GetCallerIdentityOutput{
+				Account: aws.String(accountID),
+				Arn:     aws.String("arn:aws:iam::" + accountID + ":root"),
+				UserId:  aws.String(accountID),
+			}, nil
+		}
+		return nil, err
+	}
+	return &sts.GetCallerIdentityOutput{
+		Account: aws.String(accountID),
+		Arn:     user.User.Arn,
+		UserId:  user.User.UserId,
+	}, nil
+}
+
+// callerIsTemporary reports whether r was signed with STS session credentials.
+func callerIsTemporary(r *http.Request) bool {
+	accessKey, _ := r.Context().Value(ctxAccessKey).(string)
+	return strings.HasPrefix(accessKey, handlers_iam.SessionAccessKeyPrefix)
+}
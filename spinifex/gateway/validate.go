@@ -0,0 +1,54 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+)
+
+// validateInput checks a parsed request against the constraints the AWS SDK
+// generates from the service model: required members and minimum values and
+// lengths, including those of nested structures. It runs before the action
+// handler so a malformed request fails the same way for every action:
+// MissingParameter for an absent required member, InvalidParameterValue for
+// any other violation. Only the first violation is reported, as on AWS.
+func validateInput(input any) error {
+	validator, ok := input.(request.Validator)
+	if !ok {
+		return nil
+	}
+	err := validator.Validate()
+	if err == nil {
+		return nil
+	}
+
+	var invalid request.ErrInvalidParams
+	if !errors.As(err, &invalid) || invalid.Len() == 0 {
+		return awserrors.WithDetail(awserrors.ErrorInvalidParameterValue, err.Error())
+	}
+	var param request.ErrInvalidParam
+	if !errors.As(invalid.OrigErrs()[0], &param) {
+		return awserrors.WithDetail(awserrors.ErrorInvalidParameterValue, invalid.Error())
+	}
+
+	// Field is qualified with the input shape, e.g. RunInstancesInput.MaxCount.
+	field := strings.TrimPrefix(param.Field(), invalid.Context+".")
+	var detail string
+	switch param := param.(type) {
+	case *request.ErrParamRequired:
+		return awserrors.WithDetail(awserrors.ErrorMissingParameter,
+			fmt.Sprintf("The request must contain the parameter %s", field))
+	case *request.ErrParamMinValue:
+		detail = fmt.Sprintf("Value for parameter %s must be at least %v", field, param.MinValue())
+	case *request.ErrParamMinLen:
+		detail = fmt.Sprintf("Value for parameter %s must have a length of at least %d", field, param.MinLen())
+	case *request.ErrParamMaxLen:
+		detail = fmt.Sprintf("Value for parameter %s must have a length of at most %d", field, param.MaxLen())
+	default:
+		detail = fmt.Sprintf("Invalid value for parameter %s", field)
+	}
+	return awserrors.WithDetail(awserrors.ErrorInvalidParameterValue, detail)
+}
@@ -0,0 +1,91 @@
+package gateway
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateInput(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  any
+		code   string
+		detail string
+	}{
+		{name: "NoConstraints", input: &ec2.DescribeInstancesInput{}},
+		{name: "NotAnSDKInput", input: &struct{}{}},
+		{name: "Valid", input: &ec2.RunInstancesInput{MinCount: aws.Int64(1), MaxCount: aws.Int64(1)}},
+		{
+			name:   "MissingRequired",
+			input:  &ec2.RunInstancesInput{MinCount: aws.Int64(1)},
+			code:   awserrors.ErrorMissingParameter,
+			detail: "The request must contain the parameter MaxCount",
+		},
+		{
+			name: "MissingNestedRequired",
+			input: &ec2.RunInstancesInput{
+				MinCount:            aws.Int64(1),
+				MaxCount:            aws.Int64(1),
+				CreditSpecification: &ec2.CreditSpecificationRequest{},
+			},
+			code:   awserrors.ErrorMissingParameter,
+			detail: "The request must contain the parameter CreditSpecification.CpuCredits",
+		},
+		{
+			name: "BelowMinValue",
+			input: &cloudwatch.GetMetricStatisticsInput{
+				MetricName: aws.String("CPUUtilization"),
+				Namespace:  aws.String("AWS/EC2"),
+				Period:     aws.Int64(0),
+				StartTime:  aws.Time(time.Unix(0, 0)),
+				EndTime:    aws.Time(time.Unix(60, 0)),
+			},
+			code:   awserrors.ErrorInvalidParameterValue,
+			detail: "Value for parameter Period must be at least 1",
+		},
+		{
+			name:   "BelowMinLength",
+			input:  &autoscaling.DeleteAutoScalingGroupInput{AutoScalingGroupName: aws.String("")},
+			code:   awserrors.ErrorInvalidParameterValue,
+			detail: "Value for parameter AutoScalingGroupName must have a length of at least 1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateInput(tt.input)
+			if tt.code == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Equal(t, tt.code, err.Error())
+			assert.Equal(t, tt.detail, awserrors.Detail(err))
+		})
+	}
+}
+
+func TestEC2Handler_ValidatesBeforeHandler(t *testing.T) {
+	called := false
+	handler := ec2Handler(func(*ec2.RunInstancesInput, *GatewayConfig, string) (any, error) {
+		called = true
+		return &ec2.Reservation{}, nil
+	})
+
+	_, err := handler(context.Background(), "RunInstances", map[string]string{"ImageId": "ami-123", "MinCount": "1"}, &GatewayConfig{}, "123456789012")
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorMissingParameter, err.Error())
+	assert.False(t, called, "handler must not run for an invalid request")
+
+	_, err = handler(context.Background(), "RunInstances", map[string]string{"ImageId": "ami-123", "MinCount": "1", "MaxCount": "1"}, &GatewayConfig{}, "123456789012")
+	require.NoError(t, err)
+	assert.True(t, called)
+}
@@ -0,0 +1,94 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/go-chi/chi/v5"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	gateway_ec2_instance "github.com/mulgadc/spinifex/spinifex/gateway/ec2/instance"
+)
+
+// waitAction is the IAM action instance waits are authorized as, since a
+// wait only reads what DescribeInstanceStatus would return.
+const waitAction = "DescribeInstanceStatus"
+
+// waitDefaultTimeout and waitMaxTimeout bound ?timeout=, in seconds.
+const (
+	waitDefaultTimeout = 10 * time.Minute
+	waitMaxTimeout     = 30 * time.Minute
+)
+
+// WaitInstanceResponse is the body returned once the instance is ready.
+type WaitInstanceResponse struct {
+	InstanceId string `json:"InstanceId"`
+	State      string `json:"State"`
+	Status     string `json:"Status"`
+}
+
+// WaitInstance blocks until an instance reaches ?state= (default running)
+// with its instance status check reading ?status= (default ok), or
+// ?timeout= seconds pass. With the defaults it returns once the guest has
+// phoned home, so scripts can wait on boot completion in one signed GET
+// rather than polling DescribeInstanceStatus.
+func (gw *GatewayConfig) WaitInstance(w http.ResponseWriter, r *http.Request) {
+	instanceID := chi.URLParam(r, "instanceId")
+	if !strings.HasPrefix(instanceID, "i-") {
+		gw.ErrorHandler(w, r, errors.New(awserrors.ErrorInvalidInstanceIDMalformed))
+		return
+	}
+	query := r.URL.Query()
+	state := query.Get("state")
+	if state == "" {
+		state = ec2.InstanceStateNameRunning
+	}
+	status := query.Get("status")
+	if status == "" {
+		status = ec2.SummaryStatusOk
+	}
+	if !slices.Contains(ec2.InstanceStateName_Values(), state) || !slices.Contains(ec2.SummaryStatus_Values(), status) {
+		gw.ErrorHandler(w, r, errors.New(awserrors.ErrorInvalidParameterValue))
+		return
+	}
+	timeout := waitDefaultTimeout
+	if raw := query.Get("timeout"); raw != "" {
+		seconds, err := strconv.Atoi(raw)
+		if err != nil || seconds <= 0 || time.Duration(seconds)*time.Second > waitMaxTimeout {
+			gw.ErrorHandler(w, r, errors.New(awserrors.ErrorInvalidParameterValue))
+			return
+		}
+		timeout = time.Duration(seconds) * time.Second
+	}
+	if gw.NATSConn == nil {
+		gw.ErrorHandler(w, r, errors.New(awserrors.ErrorServerInternal))
+		return
+	}
+
+	accountID, _ := r.Context().Value(ctxAccountID).(string)
+	region, _ := r.Context().Value(ctxRegion).(string)
+	if region == "" {
+		region = gw.Region
+	}
+	resource := "arn:aws:ec2:" + region + ":" + accountID + ":instance/" + instanceID
+	if err := gw.checkPolicyFor(r, "ec2", waitAction, []string{resource}); err != nil {
+		gw.ErrorHandler(w, r, err)
+		return
+	}
+
+	err := gateway_ec2_instance.WaitInstanceState(r.Context(), instanceID, state, status, timeout, gw.NATSConn, gw.DiscoverActiveNodes(), accountID)
+	if err != nil {
+		slog.Info("WaitInstance: instance not ready", "instanceId", instanceID, "state", state, "status", status, "err", err)
+		gw.ErrorHandler(w, r, errors.New(awserrors.ErrorIncorrectInstanceState))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(WaitInstanceResponse{InstanceId: instanceID, State: state, Status: status})
+}
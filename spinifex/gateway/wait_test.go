@@ -0,0 +1,133 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/go-chi/chi/v5"
+	"github.com/mulgadc/spinifex/spinifex/testutil"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// waitServer serves WaitInstance with the SigV4 context of an authenticated
+// caller, as SetupRoutes does.
+func waitServer(t *testing.T, nc *nats.Conn) *httptest.Server {
+	t.Helper()
+	gw := &GatewayConfig{NATSConn: nc, Region: "us-east-1", ExpectedNodes: 1}
+	r := chi.NewRouter()
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), ctxAccountID, "123456789012")
+			ctx = context.WithValue(ctx, ctxService, "ec2")
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	})
+	r.Get("/wait/{instanceId}", gw.WaitInstance)
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// mockBootingInstance answers for one running instance that stays unbooted
+// until ec2.PhoneHome is sent, as its node would.
+func mockBootingInstance(t *testing.T, nc *nats.Conn, instanceID string) {
+	t.Helper()
+	var booted atomic.Bool
+
+	_, err := nc.Subscribe("ec2.DescribeInstances", func(msg *nats.Msg) {
+		data, _ := json.Marshal(&ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{{
+			Instances: []*ec2.Instance{{
+				InstanceId: aws.String(instanceID),
+				State:      &ec2.InstanceState{Code: aws.Int64(16), Name: aws.String(ec2.InstanceStateNameRunning)},
+			}},
+		}}})
+		msg.Respond(data)
+	})
+	require.NoError(t, err)
+
+	_, err = nc.Subscribe("ec2.DescribeInstanceBootStatus", func(msg *nats.Msg) {
+		status := types.InstanceBootStatus{}
+		if booted.Load() {
+			status.BootedAt = time.Now()
+		}
+		data, _ := json.Marshal(&types.DescribeInstanceBootStatusOutput{
+			Instances: map[string]types.InstanceBootStatus{instanceID: status},
+		})
+		msg.Respond(data)
+	})
+	require.NoError(t, err)
+
+	_, err = nc.Subscribe("ec2.PhoneHome", func(msg *nats.Msg) {
+		booted.Store(true)
+		msg.Respond([]byte("{}"))
+	})
+	require.NoError(t, err)
+}
+
+func TestWaitInstance_UnblocksOnPhoneHome(t *testing.T) {
+	_, nc := testutil.StartTestNATS(t)
+	mockBootingInstance(t, nc, "i-booting")
+	srv := waitServer(t, nc)
+
+	done := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.Get(srv.URL + "/wait/i-booting?timeout=30")
+		if err != nil {
+			t.Error(err)
+			close(done)
+			return
+		}
+		done <- resp
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("wait returned before phone-home")
+	case <-time.After(time.Second):
+	}
+
+	_, err := utils.NATSRequest[struct{}](nc, "ec2.PhoneHome", types.PhoneHomeInput{InstanceID: "i-booting", Token: "tok"}, time.Second, "")
+	require.NoError(t, err)
+
+	var resp *http.Response
+	select {
+	case resp = <-done:
+	case <-time.After(15 * time.Second):
+		t.Fatal("wait did not unblock after phone-home")
+	}
+	require.NotNil(t, resp)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var body WaitInstanceResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, WaitInstanceResponse{InstanceId: "i-booting", State: ec2.InstanceStateNameRunning, Status: ec2.SummaryStatusOk}, body)
+}
+
+func TestWaitInstance_InvalidParameters(t *testing.T) {
+	_, nc := testutil.StartTestNATS(t)
+	srv := waitServer(t, nc)
+
+	for _, path := range []string{
+		"/wait/vol-abc",
+		"/wait/i-abc?state=booting",
+		"/wait/i-abc?status=fine",
+		"/wait/i-abc?timeout=0",
+		"/wait/i-abc?timeout=86400",
+	} {
+		resp, err := http.Get(srv.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, path)
+	}
+}
@@ -0,0 +1,324 @@
+package handlers_autoscaling
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	handlers_ec2_launchtemplate "github.com/mulgadc/spinifex/spinifex/handlers/ec2/launchtemplate"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+)
+
+// launchGracePeriod is how long a freshly launched instance may be missing
+// from the cluster's instance state before the group gives up on it.
+const launchGracePeriod = 2 * time.Minute
+
+// Health statuses reported for group instances.
+const (
+	healthHealthy   = "Healthy"
+	healthUnhealthy = "Unhealthy"
+)
+
+// InstanceController is the subset of daemon functionality the
+// reconciliation loop needs to manage a group's instances. Defined here to
+// avoid a circular import between handlers/autoscaling and daemon.
+type InstanceController interface {
+	// LaunchInstance launches a single instance on behalf of accountID.
+	LaunchInstance(input *ec2.RunInstancesInput, accountID string) (*ec2.Instance, error)
+
+	// TerminateInstance terminates an instance on behalf of accountID.
+	TerminateInstance(instanceID, accountID string) error
+
+	// InstanceStates returns the EC2 state name ("pending", "running",
+	// "stopped", ...) of every instance in the cluster, keyed by instance ID.
+	// Instances the cluster no longer knows about are absent.
+	InstanceStates() (map[string]string, error)
+}
+
+// Reconcile moves every group towards its desired capacity: it forgets
+// instances that are gone, terminates and replaces instances that are no
+// longer running, launches or terminates instances to match the desired
+// capacity, and removes force-deleted groups once they are empty. It must
+// run on one node at a time.
+func (s *AutoScalingServiceImpl) Reconcile(ctrl InstanceController, now time.Time) {
+	records, err := s.listGroups("")
+	if err != nil {
+		slog.Error("Auto Scaling: failed to list groups", "err", err)
+		return
+	}
+	if len(records) == 0 {
+		return
+	}
+
+	states, err := ctrl.InstanceStates()
+	if err != nil {
+		slog.Error("Auto Scaling: failed to load instance states", "err", err)
+		return
+	}
+
+	for _, record := range records {
+		s.reconcileGroup(ctrl, utils.AccountKey(record.AccountID, record.GroupName), states, now)
+	}
+}
+
+// reconcileGroup runs one reconciliation pass over the group stored at key.
+func (s *AutoScalingServiceImpl) reconcileGroup(ctrl InstanceController, key string, states map[string]string, now time.Time) {
+	var group GroupRecord
+	err := s.updateGroupKey(key, func(r *GroupRecord) error {
+		r.Instances = refreshInstances(r.Instances, states, now)
+		markScaleIn(r)
+		group = *r
+		return nil
+	})
+	if err != nil {
+		slog.Warn("Auto Scaling: failed to refresh group", "key", key, "err", err)
+		return
+	}
+
+	// Terminate instances marked for termination that haven't started
+	// shutting down, including ones whose earlier terminate request failed.
+	for _, inst := range group.Instances {
+		if inst.LifecycleState != autoscaling.LifecycleStateTerminating {
+			continue
+		}
+		if state, ok := states[inst.InstanceID]; ok && state == ec2.InstanceStateNameShuttingDown {
+			continue
+		}
+		if err := ctrl.TerminateInstance(inst.InstanceID, group.AccountID); err != nil {
+			slog.Warn("Auto Scaling: failed to terminate instance, will retry", "group", group.GroupName,
+				"instanceId", inst.InstanceID, "err", err)
+			continue
+		}
+		slog.Info("Auto Scaling: terminating instance", "group", group.GroupName, "instanceId", inst.InstanceID,
+			"health", inst.HealthStatus)
+	}
+
+	for range group.DesiredCapacity - activeCount(group.Instances) {
+		if err := s.launchInstance(ctrl, key, &group, now); err != nil {
+			slog.Warn("Auto Scaling: failed to launch instance, will retry", "group", group.GroupName, "err", err)
+			break
+		}
+	}
+
+	if group.Status == StatusDeleting && len(group.Instances) == 0 {
+		_, entry, err := s.getGroup(key)
+		if err != nil {
+			return
+		}
+		if err := s.kv.Delete(key, nats.LastRevision(entry.Revision())); err != nil {
+			slog.Debug("Auto Scaling: group changed during delete, will retry", "group", group.GroupName, "err", err)
+			return
+		}
+		slog.Info("Auto Scaling: deleted group", "group", group.GroupName, "accountID", group.AccountID)
+	}
+}
+
+// refreshInstances updates each instance's lifecycle state from the
+// cluster's instance states. Instances that are gone are dropped, and
+// instances that stopped or failed are marked unhealthy for replacement.
+func refreshInstances(instances []InstanceRecord, states map[string]string, now time.Time) []InstanceRecord {
+	kept := make([]InstanceRecord, 0, len(instances))
+	for _, inst := range instances {
+		state, ok := states[inst.InstanceID]
+		switch {
+		case !ok:
+			// Not yet written to the cluster state, or long gone.
+			if now.Sub(inst.LaunchedAt) >= launchGracePeriod {
+				continue
+			}
+		case state == ec2.InstanceStateNameTerminated:
+			continue
+		case state == ec2.InstanceStateNameShuttingDown:
+			inst.LifecycleState = autoscaling.LifecycleStateTerminating
+		case inst.LifecycleState == autoscaling.LifecycleStateTerminating:
+			// Already on its way out.
+		case state == ec2.InstanceStateNamePending:
+			inst.LifecycleState = autoscaling.LifecycleStatePending
+		case state == ec2.InstanceStateNameRunning:
+			inst.LifecycleState = autoscaling.LifecycleStateInService
+			inst.HealthStatus = healthHealthy
+		default:
+			// Stopped, stopping or failed: EC2 health checks fail, so the
+			// group replaces the instance.
+			inst.LifecycleState = autoscaling.LifecycleStateTerminating
+			inst.HealthStatus = healthUnhealthy
+		}
+		kept = append(kept, inst)
+	}
+	return kept
+}
+
+// markScaleIn marks instances for termination until the group is down to
+// its desired capacity. It keeps subnets balanced by taking the newest
+// instance from the subnet with the most active instances.
+func markScaleIn(r *GroupRecord) {
+	for activeCount(r.Instances) > r.DesiredCapacity {
+		counts := subnetCounts(r)
+		victim := -1
+		for i := range r.Instances {
+			inst := &r.Instances[i]
+			if !inst.active() {
+				continue
+			}
+			if victim < 0 {
+				victim = i
+				continue
+			}
+			best := &r.Instances[victim]
+			if counts[inst.SubnetID] > counts[best.SubnetID] ||
+				(counts[inst.SubnetID] == counts[best.SubnetID] && !inst.LaunchedAt.Before(best.LaunchedAt)) {
+				victim = i
+			}
+		}
+		r.Instances[victim].LifecycleState = autoscaling.LifecycleStateTerminating
+	}
+}
+
+// launchInstance launches one instance from the group's launch template into
+// its least populated subnet and records it in the group.
+func (s *AutoScalingServiceImpl) launchInstance(ctrl InstanceController, key string, group *GroupRecord, now time.Time) error {
+	if s.LaunchTemplates == nil {
+		return errors.New("launch template service not available")
+	}
+
+	input := &ec2.RunInstancesInput{
+		MinCount: aws.Int64(1),
+		MaxCount: aws.Int64(1),
+		LaunchTemplate: &ec2.LaunchTemplateSpecification{
+			Version: aws.String(group.LaunchTemplate.Version),
+		},
+	}
+	if group.LaunchTemplate.LaunchTemplateId != "" {
+		input.LaunchTemplate.LaunchTemplateId = aws.String(group.LaunchTemplate.LaunchTemplateId)
+	} else {
+		input.LaunchTemplate.LaunchTemplateName = aws.String(group.LaunchTemplate.LaunchTemplateName)
+	}
+	if err := handlers_ec2_launchtemplate.ResolveRunInstances(s.LaunchTemplates, input, group.AccountID); err != nil {
+		return fmt.Errorf("resolve launch template: %w", err)
+	}
+	if aws.StringValue(input.ImageId) == "" || aws.StringValue(input.InstanceType) == "" {
+		return errors.New("launch template has no image or instance type")
+	}
+
+	// The group's subnets override the template's.
+	subnet := pickSubnet(group)
+	if subnet != "" {
+		input.SubnetId = aws.String(subnet)
+	}
+	addInstanceTags(input, group)
+
+	instance, err := ctrl.LaunchInstance(input, group.AccountID)
+	if err != nil {
+		return err
+	}
+
+	record := InstanceRecord{
+		InstanceID:     aws.StringValue(instance.InstanceId),
+		InstanceType:   aws.StringValue(input.InstanceType),
+		SubnetID:       subnet,
+		LifecycleState: autoscaling.LifecycleStatePending,
+		HealthStatus:   healthHealthy,
+		LaunchedAt:     now,
+	}
+	if instance.Placement != nil {
+		record.AvailabilityZone = aws.StringValue(instance.Placement.AvailabilityZone)
+	}
+
+	err = s.updateGroupKey(key, func(r *GroupRecord) error {
+		r.Instances = append(r.Instances, record)
+		*group = *r
+		return nil
+	})
+	if err != nil {
+		// The group is gone; don't leave the instance behind untracked.
+		slog.Warn("Auto Scaling: group changed during launch, terminating instance", "key", key,
+			"instanceId", record.InstanceID, "err", err)
+		if termErr := ctrl.TerminateInstance(record.InstanceID, group.AccountID); termErr != nil {
+			slog.Error("Auto Scaling: failed to terminate untracked instance", "instanceId", record.InstanceID, "err", termErr)
+		}
+		return err
+	}
+
+	slog.Info("Auto Scaling: launched instance", "group", group.GroupName, "instanceId", record.InstanceID,
+		"subnet", subnet, "accountID", group.AccountID)
+	return nil
+}
+
+// addInstanceTags tags the instance with the group name and the group's
+// propagated tags, alongside any instance tags from the launch template.
+func addInstanceTags(input *ec2.RunInstancesInput, group *GroupRecord) {
+	tags := []*ec2.Tag{{Key: aws.String(GroupNameTag), Value: aws.String(group.GroupName)}}
+	for _, tag := range group.Tags {
+		if tag.PropagateAtLaunch {
+			tags = append(tags, &ec2.Tag{Key: aws.String(tag.Key), Value: aws.String(tag.Value)})
+		}
+	}
+
+	for _, spec := range input.TagSpecifications {
+		if spec != nil && aws.StringValue(spec.ResourceType) == ec2.ResourceTypeInstance {
+			spec.Tags = append(spec.Tags, tags...)
+			return
+		}
+	}
+	input.TagSpecifications = append(input.TagSpecifications, &ec2.TagSpecification{
+		ResourceType: aws.String(ec2.ResourceTypeInstance),
+		Tags:         tags,
+	})
+}
+
+// groupSubnets returns the subnets listed in the group's VPCZoneIdentifier.
+func groupSubnets(r *GroupRecord) []string {
+	var subnets []string
+	for subnet := range strings.SplitSeq(r.VPCZoneIdentifier, ",") {
+		if subnet = strings.TrimSpace(subnet); subnet != "" && !slices.Contains(subnets, subnet) {
+			subnets = append(subnets, subnet)
+		}
+	}
+	return subnets
+}
+
+// subnetCounts returns the number of active instances in each subnet.
+func subnetCounts(r *GroupRecord) map[string]int {
+	counts := make(map[string]int)
+	for _, inst := range r.Instances {
+		if inst.active() {
+			counts[inst.SubnetID]++
+		}
+	}
+	return counts
+}
+
+// pickSubnet returns the group subnet with the fewest active instances, or
+// "" when the group has no subnets and the launch template decides.
+func pickSubnet(r *GroupRecord) string {
+	subnets := groupSubnets(r)
+	if len(subnets) == 0 {
+		return ""
+	}
+	counts := subnetCounts(r)
+	best := subnets[0]
+	for _, subnet := range subnets[1:] {
+		if counts[subnet] < counts[best] {
+			best = subnet
+		}
+	}
+	return best
+}
+
+// activeCount returns the number of instances counting towards the desired capacity.
+func activeCount(instances []InstanceRecord) int64 {
+	var n int64
+	for i := range instances {
+		if instances[i].active() {
+			n++
+		}
+	}
+	return n
+}
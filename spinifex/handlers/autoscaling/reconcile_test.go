@@ -0,0 +1,244 @@
+package handlers_autoscaling
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	handlers_ec2_launchtemplate "github.com/mulgadc/spinifex/spinifex/handlers/ec2/launchtemplate"
+	"github.com/mulgadc/spinifex/spinifex/objectstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeController launches and terminates instances in memory.
+type fakeController struct {
+	states     map[string]string
+	launched   []*ec2.RunInstancesInput
+	terminated []string
+	launchErr  error
+	next       int
+}
+
+func newFakeController() *fakeController {
+	return &fakeController{states: make(map[string]string)}
+}
+
+func (c *fakeController) LaunchInstance(input *ec2.RunInstancesInput, accountID string) (*ec2.Instance, error) {
+	if c.launchErr != nil {
+		return nil, c.launchErr
+	}
+	c.next++
+	id := fmt.Sprintf("i-%017d", c.next)
+	c.states[id] = ec2.InstanceStateNamePending
+	c.launched = append(c.launched, input)
+	return &ec2.Instance{
+		InstanceId: aws.String(id),
+		Placement:  &ec2.Placement{AvailabilityZone: aws.String("ap-southeast-2a")},
+	}, nil
+}
+
+func (c *fakeController) TerminateInstance(instanceID, accountID string) error {
+	c.terminated = append(c.terminated, instanceID)
+	c.states[instanceID] = ec2.InstanceStateNameShuttingDown
+	return nil
+}
+
+func (c *fakeController) InstanceStates() (map[string]string, error) {
+	return c.states, nil
+}
+
+func setupReconcileTest(t *testing.T) (*AutoScalingServiceImpl, *fakeController) {
+	t.Helper()
+	svc := setupTestService(t)
+
+	templates := handlers_ec2_launchtemplate.NewLaunchTemplateServiceImpl(objectstore.NewMemoryObjectStore(), "test-bucket")
+	_, err := templates.CreateLaunchTemplate(&ec2.CreateLaunchTemplateInput{
+		LaunchTemplateName: aws.String("web"),
+		LaunchTemplateData: &ec2.RequestLaunchTemplateData{
+			ImageId:      aws.String("ami-0123456789abcdef0"),
+			InstanceType: aws.String("t3.micro"),
+			TagSpecifications: []*ec2.LaunchTemplateTagSpecificationRequest{{
+				ResourceType: aws.String("instance"),
+				Tags:         []*ec2.Tag{{Key: aws.String("role"), Value: aws.String("web")}},
+			}},
+		},
+	}, testAccountID)
+	require.NoError(t, err)
+	svc.LaunchTemplates = templates
+
+	return svc, newFakeController()
+}
+
+func groupInstances(t *testing.T, svc *AutoScalingServiceImpl, name string) []*autoscaling.Instance {
+	t.Helper()
+	return describeTestGroup(t, svc, name).Instances
+}
+
+func tagValue(tags []*ec2.Tag, key string) string {
+	for _, tag := range tags {
+		if aws.StringValue(tag.Key) == key {
+			return aws.StringValue(tag.Value)
+		}
+	}
+	return ""
+}
+
+func TestReconcile_LaunchesToDesiredCapacity(t *testing.T) {
+	svc, ctrl := setupReconcileTest(t)
+	createTestGroup(t, svc, "web-asg", 1, 4, 3)
+	now := time.Now()
+
+	svc.Reconcile(ctrl, now)
+
+	require.Len(t, ctrl.launched, 3)
+	input := ctrl.launched[0]
+	assert.Equal(t, "ami-0123456789abcdef0", aws.StringValue(input.ImageId))
+	assert.Equal(t, "t3.micro", aws.StringValue(input.InstanceType))
+	assert.Nil(t, input.LaunchTemplate)
+	require.Len(t, input.TagSpecifications, 1)
+	tags := input.TagSpecifications[0].Tags
+	assert.Equal(t, "web-asg", tagValue(tags, GroupNameTag))
+	assert.Equal(t, "prod", tagValue(tags, "env"))
+	assert.Equal(t, "web", tagValue(tags, "role"), "template tags are kept")
+
+	// Launches alternate between the group's subnets.
+	assert.Equal(t, "subnet-a", aws.StringValue(ctrl.launched[0].SubnetId))
+	assert.Equal(t, "subnet-b", aws.StringValue(ctrl.launched[1].SubnetId))
+	assert.Equal(t, "subnet-a", aws.StringValue(ctrl.launched[2].SubnetId))
+
+	instances := groupInstances(t, svc, "web-asg")
+	require.Len(t, instances, 3)
+	assert.Equal(t, autoscaling.LifecycleStatePending, *instances[0].LifecycleState)
+	assert.Equal(t, "ap-southeast-2a", *instances[0].AvailabilityZone)
+
+	// Running instances go in service; nothing more is launched.
+	for id := range ctrl.states {
+		ctrl.states[id] = ec2.InstanceStateNameRunning
+	}
+	svc.Reconcile(ctrl, now.Add(time.Minute))
+	assert.Len(t, ctrl.launched, 3)
+	for _, inst := range groupInstances(t, svc, "web-asg") {
+		assert.Equal(t, autoscaling.LifecycleStateInService, *inst.LifecycleState)
+		assert.Equal(t, "Healthy", *inst.HealthStatus)
+	}
+}
+
+func TestReconcile_ScalesIn(t *testing.T) {
+	svc, ctrl := setupReconcileTest(t)
+	createTestGroup(t, svc, "web-asg", 0, 4, 3)
+	now := time.Now()
+	svc.Reconcile(ctrl, now)
+	require.Len(t, ctrl.launched, 3)
+
+	_, err := svc.SetDesiredCapacity(&autoscaling.SetDesiredCapacityInput{
+		AutoScalingGroupName: aws.String("web-asg"),
+		DesiredCapacity:      aws.Int64(1),
+	}, testAccountID)
+	require.NoError(t, err)
+	svc.Reconcile(ctrl, now.Add(time.Minute))
+
+	// subnet-a held two instances; scale-in empties it down to one first.
+	require.Len(t, ctrl.terminated, 2)
+	assert.ElementsMatch(t, []string{"i-00000000000000003", "i-00000000000000002"}, ctrl.terminated)
+
+	for _, id := range ctrl.terminated {
+		ctrl.states[id] = ec2.InstanceStateNameTerminated
+	}
+	svc.Reconcile(ctrl, now.Add(2*time.Minute))
+	instances := groupInstances(t, svc, "web-asg")
+	require.Len(t, instances, 1)
+	assert.Equal(t, "i-00000000000000001", *instances[0].InstanceId)
+}
+
+func TestReconcile_ReplacesUnhealthyAndLostInstances(t *testing.T) {
+	svc, ctrl := setupReconcileTest(t)
+	createTestGroup(t, svc, "web-asg", 2, 2, 2)
+	now := time.Now()
+	svc.Reconcile(ctrl, now)
+	require.Len(t, ctrl.launched, 2)
+
+	// One instance was stopped, the other vanished from the cluster.
+	ctrl.states["i-00000000000000001"] = ec2.InstanceStateNameStopped
+	delete(ctrl.states, "i-00000000000000002")
+
+	svc.Reconcile(ctrl, now.Add(launchGracePeriod))
+	assert.Equal(t, []string{"i-00000000000000001"}, ctrl.terminated)
+	assert.Len(t, ctrl.launched, 4)
+
+	instances := groupInstances(t, svc, "web-asg")
+	require.Len(t, instances, 3)
+	assert.Equal(t, "i-00000000000000001", *instances[0].InstanceId)
+	assert.Equal(t, autoscaling.LifecycleStateTerminating, *instances[0].LifecycleState)
+	assert.Equal(t, "Unhealthy", *instances[0].HealthStatus)
+}
+
+func TestReconcile_KeepsFreshInstancesMissingFromState(t *testing.T) {
+	svc, ctrl := setupReconcileTest(t)
+	createTestGroup(t, svc, "web-asg", 1, 1, 1)
+	now := time.Now()
+	svc.Reconcile(ctrl, now)
+	delete(ctrl.states, "i-00000000000000001")
+
+	svc.Reconcile(ctrl, now.Add(time.Second))
+	assert.Len(t, ctrl.launched, 1, "a just-launched instance is not replaced")
+	assert.Len(t, groupInstances(t, svc, "web-asg"), 1)
+}
+
+func TestReconcile_LaunchFailureRetriedNextPass(t *testing.T) {
+	svc, ctrl := setupReconcileTest(t)
+	createTestGroup(t, svc, "web-asg", 2, 2, 2)
+	now := time.Now()
+
+	ctrl.launchErr = errors.New("InsufficientInstanceCapacity")
+	svc.Reconcile(ctrl, now)
+	assert.Empty(t, groupInstances(t, svc, "web-asg"))
+
+	ctrl.launchErr = nil
+	svc.Reconcile(ctrl, now.Add(time.Minute))
+	assert.Len(t, groupInstances(t, svc, "web-asg"), 2)
+}
+
+func TestReconcile_ForceDelete(t *testing.T) {
+	svc, ctrl := setupReconcileTest(t)
+	createTestGroup(t, svc, "web-asg", 2, 2, 2)
+	now := time.Now()
+	svc.Reconcile(ctrl, now)
+
+	_, err := svc.DeleteAutoScalingGroup(&autoscaling.DeleteAutoScalingGroupInput{
+		AutoScalingGroupName: aws.String("web-asg"),
+		ForceDelete:          aws.Bool(true),
+	}, testAccountID)
+	require.NoError(t, err)
+
+	svc.Reconcile(ctrl, now.Add(time.Minute))
+	assert.Len(t, ctrl.terminated, 2)
+	assert.Len(t, groupInstances(t, svc, "web-asg"), 2, "group stays until its instances are gone")
+
+	for _, id := range ctrl.terminated {
+		ctrl.states[id] = ec2.InstanceStateNameTerminated
+	}
+	svc.Reconcile(ctrl, now.Add(2*time.Minute))
+
+	out, err := svc.DescribeAutoScalingGroups(&autoscaling.DescribeAutoScalingGroupsInput{}, testAccountID)
+	require.NoError(t, err)
+	assert.Empty(t, out.AutoScalingGroups)
+}
+
+func TestReconcile_UnknownLaunchTemplate(t *testing.T) {
+	svc, ctrl := setupReconcileTest(t)
+	_, err := svc.CreateAutoScalingGroup(&autoscaling.CreateAutoScalingGroupInput{
+		AutoScalingGroupName: aws.String("orphan-asg"),
+		LaunchTemplate:       &autoscaling.LaunchTemplateSpecification{LaunchTemplateName: aws.String("missing")},
+		MinSize:              aws.Int64(1),
+		MaxSize:              aws.Int64(1),
+	}, testAccountID)
+	require.NoError(t, err)
+
+	svc.Reconcile(ctrl, time.Now())
+	assert.Empty(t, ctrl.launched)
+}
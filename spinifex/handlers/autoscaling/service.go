@@ -0,0 +1,12 @@
+package handlers_autoscaling
+
+import "github.com/aws/aws-sdk-go/service/autoscaling"
+
+// AutoScalingService defines the interface for Auto Scaling group operations.
+type AutoScalingService interface {
+	CreateAutoScalingGroup(input *autoscaling.CreateAutoScalingGroupInput, accountID string) (*autoscaling.CreateAutoScalingGroupOutput, error)
+	UpdateAutoScalingGroup(input *autoscaling.UpdateAutoScalingGroupInput, accountID string) (*autoscaling.UpdateAutoScalingGroupOutput, error)
+	SetDesiredCapacity(input *autoscaling.SetDesiredCapacityInput, accountID string) (*autoscaling.SetDesiredCapacityOutput, error)
+	DeleteAutoScalingGroup(input *autoscaling.DeleteAutoScalingGroupInput, accountID string) (*autoscaling.DeleteAutoScalingGroupOutput, error)
+	DescribeAutoScalingGroups(input *autoscaling.DescribeAutoScalingGroupsInput, accountID string) (*autoscaling.DescribeAutoScalingGroupsOutput, error)
+}
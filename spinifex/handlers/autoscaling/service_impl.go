@@ -0,0 +1,584 @@
+package handlers_autoscaling
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/google/uuid"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/config"
+	handlers_ec2_launchtemplate "github.com/mulgadc/spinifex/spinifex/handlers/ec2/launchtemplate"
+	"github.com/mulgadc/spinifex/spinifex/migrate"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+)
+
+// Ensure AutoScalingServiceImpl implements AutoScalingService
+var _ AutoScalingService = (*AutoScalingServiceImpl)(nil)
+
+const (
+	KVBucketAutoScalingGroups        = "spinifex-autoscaling-groups"
+	KVBucketAutoScalingGroupsVersion = 1
+)
+
+const (
+	// StatusDeleting marks a group force-deleted while it still has
+	// instances; the reconciliation loop removes it once they are gone.
+	StatusDeleting = "Delete in progress"
+
+	// GroupNameTag is set on every instance the group launches, as in AWS.
+	GroupNameTag = "aws:autoscaling:groupName"
+
+	defaultCooldown    = 300
+	healthCheckTypeEC2 = "EC2"
+	maxCASRetries      = 5
+)
+
+// groupNamePattern restricts group names to characters that are valid in a
+// KV key, since the name is part of the record's key.
+var groupNamePattern = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,255}$`)
+
+// GroupRecord is a stored Auto Scaling group.
+type GroupRecord struct {
+	GroupARN               string               `json:"group_arn"`
+	GroupName              string               `json:"group_name"`
+	AccountID              string               `json:"account_id"`
+	LaunchTemplate         LaunchTemplateRecord `json:"launch_template"`
+	MinSize                int64                `json:"min_size"`
+	MaxSize                int64                `json:"max_size"`
+	DesiredCapacity        int64                `json:"desired_capacity"`
+	DefaultCooldown        int64                `json:"default_cooldown"`
+	HealthCheckGracePeriod int64                `json:"health_check_grace_period"`
+	AvailabilityZones      []string             `json:"availability_zones,omitempty"`
+	// VPCZoneIdentifier is the comma-separated list of subnets instances
+	// are launched into, spread evenly.
+	VPCZoneIdentifier string           `json:"vpc_zone_identifier,omitempty"`
+	Tags              []TagRecord      `json:"tags,omitempty"`
+	Status            string           `json:"status,omitempty"`
+	CreatedTime       time.Time        `json:"created_time"`
+	Instances         []InstanceRecord `json:"instances,omitempty"`
+}
+
+// LaunchTemplateRecord is the launch template a group launches instances from.
+type LaunchTemplateRecord struct {
+	LaunchTemplateId   string `json:"launch_template_id,omitempty"`
+	LaunchTemplateName string `json:"launch_template_name,omitempty"`
+	Version            string `json:"version,omitempty"`
+}
+
+// TagRecord is a group tag, optionally copied to the instances it launches.
+type TagRecord struct {
+	Key               string `json:"key"`
+	Value             string `json:"value"`
+	PropagateAtLaunch bool   `json:"propagate_at_launch"`
+}
+
+// InstanceRecord is an instance the group launched and still tracks.
+type InstanceRecord struct {
+	InstanceID       string    `json:"instance_id"`
+	InstanceType     string    `json:"instance_type"`
+	AvailabilityZone string    `json:"availability_zone"`
+	SubnetID         string    `json:"subnet_id,omitempty"`
+	LifecycleState   string    `json:"lifecycle_state"`
+	HealthStatus     string    `json:"health_status"`
+	LaunchedAt       time.Time `json:"launched_at"`
+}
+
+// active reports whether the instance counts towards the desired capacity.
+func (i *InstanceRecord) active() bool {
+	return i.LifecycleState == autoscaling.LifecycleStatePending || i.LifecycleState == autoscaling.LifecycleStateInService
+}
+
+// AutoScalingServiceImpl implements Auto Scaling groups with NATS JetStream
+// persistence. Group state lives in KV, so a restarted daemon (or a new
+// leader) picks up reconciliation where the last one stopped.
+type AutoScalingServiceImpl struct {
+	config *config.Config
+	kv     nats.KeyValue
+	region string
+
+	// LaunchTemplates resolves group launch templates when launching instances.
+	LaunchTemplates handlers_ec2_launchtemplate.LaunchTemplateService
+}
+
+// NewAutoScalingServiceImplWithNATS creates an Auto Scaling service with NATS JetStream.
+func NewAutoScalingServiceImplWithNATS(cfg *config.Config, natsConn *nats.Conn) (*AutoScalingServiceImpl, error) {
+	js, err := natsConn.JetStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get JetStream context: %w", err)
+	}
+
+	kv, err := utils.GetOrCreateKVBucket(js, KVBucketAutoScalingGroups, 10)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create KV bucket %s: %w", KVBucketAutoScalingGroups, err)
+	}
+	if err := migrate.DefaultRegistry.RunKV(KVBucketAutoScalingGroups, kv, KVBucketAutoScalingGroupsVersion); err != nil {
+		return nil, fmt.Errorf("migrate %s: %w", KVBucketAutoScalingGroups, err)
+	}
+
+	region := "us-east-1"
+	if cfg != nil && cfg.Region != "" {
+		region = cfg.Region
+	}
+
+	slog.Info("Auto Scaling service initialized with JetStream KV", "bucket", KVBucketAutoScalingGroups)
+
+	return &AutoScalingServiceImpl{
+		config: cfg,
+		kv:     kv,
+		region: region,
+	}, nil
+}
+
+// CreateAutoScalingGroup stores a new group. Its instances are launched by
+// the reconciliation loop, not here.
+func (s *AutoScalingServiceImpl) CreateAutoScalingGroup(input *autoscaling.CreateAutoScalingGroupInput, accountID string) (*autoscaling.CreateAutoScalingGroupOutput, error) {
+	name := aws.StringValue(input.AutoScalingGroupName)
+	if name == "" || input.MinSize == nil || input.MaxSize == nil {
+		return nil, errors.New(awserrors.ErrorMissingParameter)
+	}
+	if !groupNamePattern.MatchString(name) {
+		return nil, errors.New(awserrors.ErrorValidationError)
+	}
+	// Only launch templates are supported: launch configurations,
+	// instance-based groups and mixed instance policies are not.
+	if input.LaunchConfigurationName != nil || input.InstanceId != nil || input.MixedInstancesPolicy != nil {
+		return nil, errors.New(awserrors.ErrorValidationError)
+	}
+	template, err := launchTemplateRecord(input.LaunchTemplate)
+	if err != nil {
+		return nil, err
+	}
+	if input.HealthCheckType != nil && aws.StringValue(input.HealthCheckType) != healthCheckTypeEC2 {
+		return nil, errors.New(awserrors.ErrorValidationError)
+	}
+
+	desired := aws.Int64Value(input.MinSize)
+	if input.DesiredCapacity != nil {
+		desired = *input.DesiredCapacity
+	}
+	if err := validateCapacity(*input.MinSize, *input.MaxSize, desired); err != nil {
+		return nil, err
+	}
+
+	cooldown := int64(defaultCooldown)
+	if input.DefaultCooldown != nil {
+		cooldown = *input.DefaultCooldown
+	}
+
+	tags, err := tagRecords(input.Tags)
+	if err != nil {
+		return nil, err
+	}
+
+	record := GroupRecord{
+		GroupARN:               fmt.Sprintf("arn:aws:autoscaling:%s:%s:autoScalingGroup:%s:autoScalingGroupName/%s", s.region, accountID, uuid.NewString(), name),
+		GroupName:              name,
+		AccountID:              accountID,
+		LaunchTemplate:         template,
+		MinSize:                *input.MinSize,
+		MaxSize:                *input.MaxSize,
+		DesiredCapacity:        desired,
+		DefaultCooldown:        cooldown,
+		HealthCheckGracePeriod: aws.Int64Value(input.HealthCheckGracePeriod),
+		AvailabilityZones:      aws.StringValueSlice(input.AvailabilityZones),
+		VPCZoneIdentifier:      aws.StringValue(input.VPCZoneIdentifier),
+		Tags:                   tags,
+		CreatedTime:            time.Now().UTC(),
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+	// Atomic create-if-not-exists to prevent TOCTOU race on duplicate names
+	if _, err := s.kv.Create(utils.AccountKey(accountID, name), data); err != nil {
+		return nil, errors.New(awserrors.ErrorAutoScalingAlreadyExists)
+	}
+
+	slog.Info("CreateAutoScalingGroup completed", "groupName", name, "min", record.MinSize, "max", record.MaxSize,
+		"desired", record.DesiredCapacity, "accountID", accountID)
+	return &autoscaling.CreateAutoScalingGroupOutput{}, nil
+}
+
+// UpdateAutoScalingGroup changes a group's size, launch template or subnets.
+// Instances already running are left alone; new launches use the new settings.
+func (s *AutoScalingServiceImpl) UpdateAutoScalingGroup(input *autoscaling.UpdateAutoScalingGroupInput, accountID string) (*autoscaling.UpdateAutoScalingGroupOutput, error) {
+	name := aws.StringValue(input.AutoScalingGroupName)
+	if name == "" {
+		return nil, errors.New(awserrors.ErrorMissingParameter)
+	}
+	if input.LaunchConfigurationName != nil || input.MixedInstancesPolicy != nil {
+		return nil, errors.New(awserrors.ErrorValidationError)
+	}
+	if input.HealthCheckType != nil && aws.StringValue(input.HealthCheckType) != healthCheckTypeEC2 {
+		return nil, errors.New(awserrors.ErrorValidationError)
+	}
+
+	var template *LaunchTemplateRecord
+	if input.LaunchTemplate != nil {
+		t, err := launchTemplateRecord(input.LaunchTemplate)
+		if err != nil {
+			return nil, err
+		}
+		template = &t
+	}
+
+	err := s.updateGroup(accountID, name, func(record *GroupRecord) error {
+		if record.Status == StatusDeleting {
+			return errors.New(awserrors.ErrorAutoScalingScalingActivityInProgress)
+		}
+		if input.MinSize != nil {
+			record.MinSize = *input.MinSize
+		}
+		if input.MaxSize != nil {
+			record.MaxSize = *input.MaxSize
+		}
+		if input.DesiredCapacity != nil {
+			record.DesiredCapacity = *input.DesiredCapacity
+		} else {
+			// As in AWS, a new size range drags the desired capacity along.
+			record.DesiredCapacity = max(record.MinSize, min(record.DesiredCapacity, record.MaxSize))
+		}
+		if err := validateCapacity(record.MinSize, record.MaxSize, record.DesiredCapacity); err != nil {
+			return err
+		}
+		if template != nil {
+			record.LaunchTemplate = *template
+		}
+		if input.DefaultCooldown != nil {
+			record.DefaultCooldown = *input.DefaultCooldown
+		}
+		if input.HealthCheckGracePeriod != nil {
+			record.HealthCheckGracePeriod = *input.HealthCheckGracePeriod
+		}
+		if input.AvailabilityZones != nil {
+			record.AvailabilityZones = aws.StringValueSlice(input.AvailabilityZones)
+		}
+		if input.VPCZoneIdentifier != nil {
+			record.VPCZoneIdentifier = *input.VPCZoneIdentifier
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("UpdateAutoScalingGroup completed", "groupName", name, "accountID", accountID)
+	return &autoscaling.UpdateAutoScalingGroupOutput{}, nil
+}
+
+// SetDesiredCapacity changes the number of instances the group maintains.
+func (s *AutoScalingServiceImpl) SetDesiredCapacity(input *autoscaling.SetDesiredCapacityInput, accountID string) (*autoscaling.SetDesiredCapacityOutput, error) {
+	name := aws.StringValue(input.AutoScalingGroupName)
+	if name == "" || input.DesiredCapacity == nil {
+		return nil, errors.New(awserrors.ErrorMissingParameter)
+	}
+
+	err := s.updateGroup(accountID, name, func(record *GroupRecord) error {
+		if record.Status == StatusDeleting {
+			return errors.New(awserrors.ErrorAutoScalingScalingActivityInProgress)
+		}
+		if err := validateCapacity(record.MinSize, record.MaxSize, *input.DesiredCapacity); err != nil {
+			return err
+		}
+		record.DesiredCapacity = *input.DesiredCapacity
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("SetDesiredCapacity completed", "groupName", name, "desired", *input.DesiredCapacity, "accountID", accountID)
+	return &autoscaling.SetDesiredCapacityOutput{}, nil
+}
+
+// DeleteAutoScalingGroup deletes a group. A group that still has instances
+// can only be deleted with ForceDelete, which scales it to zero first: the
+// reconciliation loop terminates the instances and then removes the group.
+func (s *AutoScalingServiceImpl) DeleteAutoScalingGroup(input *autoscaling.DeleteAutoScalingGroupInput, accountID string) (*autoscaling.DeleteAutoScalingGroupOutput, error) {
+	name := aws.StringValue(input.AutoScalingGroupName)
+	if name == "" {
+		return nil, errors.New(awserrors.ErrorMissingParameter)
+	}
+	key := utils.AccountKey(accountID, name)
+
+	for attempt := range maxCASRetries {
+		record, entry, err := s.getGroup(key)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(record.Instances) == 0 {
+			if err := s.kv.Delete(key, nats.LastRevision(entry.Revision())); err != nil {
+				slog.Debug("DeleteAutoScalingGroup: CAS conflict, retrying", "attempt", attempt, "err", err)
+				continue
+			}
+			slog.Info("DeleteAutoScalingGroup completed", "groupName", name, "accountID", accountID)
+			return &autoscaling.DeleteAutoScalingGroupOutput{}, nil
+		}
+
+		if !aws.BoolValue(input.ForceDelete) {
+			return nil, errors.New(awserrors.ErrorAutoScalingScalingActivityInProgress)
+		}
+
+		record.Status = StatusDeleting
+		record.MinSize, record.MaxSize, record.DesiredCapacity = 0, 0, 0
+		if err := s.putGroup(key, record, entry.Revision()); err != nil {
+			slog.Debug("DeleteAutoScalingGroup: CAS conflict, retrying", "attempt", attempt, "err", err)
+			continue
+		}
+		slog.Info("DeleteAutoScalingGroup: terminating instances before delete", "groupName", name,
+			"instances", len(record.Instances), "accountID", accountID)
+		return &autoscaling.DeleteAutoScalingGroupOutput{}, nil
+	}
+
+	slog.Error("DeleteAutoScalingGroup: CAS retries exhausted", "groupName", name, "accountID", accountID)
+	return nil, errors.New(awserrors.ErrorServerInternal)
+}
+
+// DescribeAutoScalingGroups lists the account's groups, optionally by name
+// or tag filter. Unknown names are skipped, as in AWS.
+func (s *AutoScalingServiceImpl) DescribeAutoScalingGroups(input *autoscaling.DescribeAutoScalingGroupsInput, accountID string) (*autoscaling.DescribeAutoScalingGroupsOutput, error) {
+	records, err := s.listGroups(accountID + ".")
+	if err != nil {
+		return nil, err
+	}
+
+	names := aws.StringValueSlice(input.AutoScalingGroupNames)
+	groups := make([]*autoscaling.Group, 0, len(records))
+	for _, record := range records {
+		if len(names) > 0 && !slices.Contains(names, record.GroupName) {
+			continue
+		}
+		if !matchesFilters(record, input.Filters) {
+			continue
+		}
+		groups = append(groups, record.toGroup())
+	}
+
+	return &autoscaling.DescribeAutoScalingGroupsOutput{AutoScalingGroups: groups}, nil
+}
+
+// matchesFilters applies the tag-key, tag-value and tag:<key> filters.
+func matchesFilters(record *GroupRecord, filters []*autoscaling.Filter) bool {
+	for _, f := range filters {
+		if f == nil {
+			continue
+		}
+		values := aws.StringValueSlice(f.Values)
+		name := aws.StringValue(f.Name)
+		matched := false
+		for _, tag := range record.Tags {
+			switch {
+			case name == "tag-key":
+				matched = slices.Contains(values, tag.Key)
+			case name == "tag-value":
+				matched = slices.Contains(values, tag.Value)
+			case strings.HasPrefix(name, "tag:"):
+				matched = tag.Key == strings.TrimPrefix(name, "tag:") && slices.Contains(values, tag.Value)
+			}
+			if matched {
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// toGroup converts a stored group to its API shape.
+func (r *GroupRecord) toGroup() *autoscaling.Group {
+	template := &autoscaling.LaunchTemplateSpecification{Version: aws.String(r.LaunchTemplate.Version)}
+	if r.LaunchTemplate.LaunchTemplateId != "" {
+		template.LaunchTemplateId = aws.String(r.LaunchTemplate.LaunchTemplateId)
+	}
+	if r.LaunchTemplate.LaunchTemplateName != "" {
+		template.LaunchTemplateName = aws.String(r.LaunchTemplate.LaunchTemplateName)
+	}
+
+	group := &autoscaling.Group{
+		AutoScalingGroupARN:    aws.String(r.GroupARN),
+		AutoScalingGroupName:   aws.String(r.GroupName),
+		AvailabilityZones:      aws.StringSlice(r.AvailabilityZones),
+		CreatedTime:            aws.Time(r.CreatedTime),
+		DefaultCooldown:        aws.Int64(r.DefaultCooldown),
+		DesiredCapacity:        aws.Int64(r.DesiredCapacity),
+		HealthCheckGracePeriod: aws.Int64(r.HealthCheckGracePeriod),
+		HealthCheckType:        aws.String(healthCheckTypeEC2),
+		LaunchTemplate:         template,
+		MaxSize:                aws.Int64(r.MaxSize),
+		MinSize:                aws.Int64(r.MinSize),
+		TerminationPolicies:    aws.StringSlice([]string{"Default"}),
+	}
+	if r.VPCZoneIdentifier != "" {
+		group.VPCZoneIdentifier = aws.String(r.VPCZoneIdentifier)
+	}
+	if r.Status != "" {
+		group.Status = aws.String(r.Status)
+	}
+	if group.AvailabilityZones == nil {
+		group.AvailabilityZones = []*string{}
+	}
+
+	group.Instances = make([]*autoscaling.Instance, 0, len(r.Instances))
+	for _, inst := range r.Instances {
+		group.Instances = append(group.Instances, &autoscaling.Instance{
+			InstanceId:           aws.String(inst.InstanceID),
+			InstanceType:         aws.String(inst.InstanceType),
+			AvailabilityZone:     aws.String(inst.AvailabilityZone),
+			LifecycleState:       aws.String(inst.LifecycleState),
+			HealthStatus:         aws.String(inst.HealthStatus),
+			LaunchTemplate:       template,
+			ProtectedFromScaleIn: aws.Bool(false),
+		})
+	}
+
+	group.Tags = make([]*autoscaling.TagDescription, 0, len(r.Tags))
+	for _, tag := range r.Tags {
+		group.Tags = append(group.Tags, &autoscaling.TagDescription{
+			Key:               aws.String(tag.Key),
+			Value:             aws.String(tag.Value),
+			PropagateAtLaunch: aws.Bool(tag.PropagateAtLaunch),
+			ResourceId:        aws.String(r.GroupName),
+			ResourceType:      aws.String("auto-scaling-group"),
+		})
+	}
+	return group
+}
+
+// launchTemplateRecord validates a group's launch template reference. The
+// version defaults to the template's default version.
+func launchTemplateRecord(spec *autoscaling.LaunchTemplateSpecification) (LaunchTemplateRecord, error) {
+	if spec == nil {
+		return LaunchTemplateRecord{}, errors.New(awserrors.ErrorValidationError)
+	}
+	if err := handlers_ec2_launchtemplate.ValidateTemplateRef(spec.LaunchTemplateId, spec.LaunchTemplateName); err != nil {
+		return LaunchTemplateRecord{}, errors.New(awserrors.ErrorValidationError)
+	}
+	version := aws.StringValue(spec.Version)
+	if version == "" {
+		version = handlers_ec2_launchtemplate.VersionDefault
+	}
+	return LaunchTemplateRecord{
+		LaunchTemplateId:   aws.StringValue(spec.LaunchTemplateId),
+		LaunchTemplateName: aws.StringValue(spec.LaunchTemplateName),
+		Version:            version,
+	}, nil
+}
+
+// validateCapacity checks min <= desired <= max.
+func validateCapacity(minSize, maxSize, desired int64) error {
+	if minSize < 0 || maxSize < minSize || desired < minSize || desired > maxSize {
+		return errors.New(awserrors.ErrorValidationError)
+	}
+	return nil
+}
+
+// tagRecords converts request tags, rejecting reserved aws: keys.
+func tagRecords(tags []*autoscaling.Tag) ([]TagRecord, error) {
+	records := make([]TagRecord, 0, len(tags))
+	for _, tag := range tags {
+		if tag == nil {
+			continue
+		}
+		key := aws.StringValue(tag.Key)
+		if key == "" || len(key) > 128 || strings.HasPrefix(strings.ToLower(key), "aws:") {
+			return nil, errors.New(awserrors.ErrorValidationError)
+		}
+		records = append(records, TagRecord{
+			Key:               key,
+			Value:             aws.StringValue(tag.Value),
+			PropagateAtLaunch: aws.BoolValue(tag.PropagateAtLaunch),
+		})
+	}
+	return records, nil
+}
+
+// getGroup loads the group stored at key.
+func (s *AutoScalingServiceImpl) getGroup(key string) (*GroupRecord, nats.KeyValueEntry, error) {
+	entry, err := s.kv.Get(key)
+	if err != nil {
+		if errors.Is(err, nats.ErrKeyNotFound) {
+			return nil, nil, errors.New(awserrors.ErrorValidationError)
+		}
+		return nil, nil, errors.New(awserrors.ErrorServerInternal)
+	}
+	var record GroupRecord
+	if err := json.Unmarshal(entry.Value(), &record); err != nil {
+		return nil, nil, errors.New(awserrors.ErrorServerInternal)
+	}
+	return &record, entry, nil
+}
+
+// putGroup writes record at key if it is still at revision.
+func (s *AutoScalingServiceImpl) putGroup(key string, record *GroupRecord, revision uint64) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = s.kv.Update(key, data, revision)
+	return err
+}
+
+// updateGroup applies fn to the account's named group and writes the result,
+// retrying on concurrent modification. An error from fn aborts the update.
+func (s *AutoScalingServiceImpl) updateGroup(accountID, name string, fn func(*GroupRecord) error) error {
+	return s.updateGroupKey(utils.AccountKey(accountID, name), fn)
+}
+
+func (s *AutoScalingServiceImpl) updateGroupKey(key string, fn func(*GroupRecord) error) error {
+	for attempt := range maxCASRetries {
+		record, entry, err := s.getGroup(key)
+		if err != nil {
+			return err
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+		if err := s.putGroup(key, record, entry.Revision()); err != nil {
+			slog.Debug("updateGroup: CAS conflict, retrying", "key", key, "attempt", attempt, "err", err)
+			continue
+		}
+		return nil
+	}
+	slog.Error("updateGroup: CAS retries exhausted", "key", key)
+	return errors.New(awserrors.ErrorServerInternal)
+}
+
+// listGroups returns the groups whose keys start with prefix, oldest first.
+func (s *AutoScalingServiceImpl) listGroups(prefix string) ([]*GroupRecord, error) {
+	keys, err := s.kv.Keys()
+	if err != nil {
+		if errors.Is(err, nats.ErrNoKeysFound) {
+			return nil, nil
+		}
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+
+	var records []*GroupRecord
+	for _, key := range keys {
+		if key == utils.VersionKey || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		record, _, err := s.getGroup(key)
+		if err != nil {
+			continue // deleted since Keys()
+		}
+		records = append(records, record)
+	}
+	slices.SortFunc(records, func(a, b *GroupRecord) int {
+		return a.CreatedTime.Compare(b.CreatedTime)
+	})
+	return records, nil
+}
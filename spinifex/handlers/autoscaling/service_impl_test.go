@@ -0,0 +1,253 @@
+package handlers_autoscaling
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAccountID = "123456789012"
+
+func setupTestService(t *testing.T) *AutoScalingServiceImpl {
+	t.Helper()
+	_, nc, _ := testutil.StartTestJetStream(t)
+
+	svc, err := NewAutoScalingServiceImplWithNATS(nil, nc)
+	require.NoError(t, err)
+	return svc
+}
+
+func createTestGroup(t *testing.T, svc *AutoScalingServiceImpl, name string, minSize, maxSize, desired int64) {
+	t.Helper()
+	_, err := svc.CreateAutoScalingGroup(&autoscaling.CreateAutoScalingGroupInput{
+		AutoScalingGroupName: aws.String(name),
+		LaunchTemplate:       &autoscaling.LaunchTemplateSpecification{LaunchTemplateName: aws.String("web")},
+		MinSize:              aws.Int64(minSize),
+		MaxSize:              aws.Int64(maxSize),
+		DesiredCapacity:      aws.Int64(desired),
+		VPCZoneIdentifier:    aws.String("subnet-a,subnet-b"),
+		Tags: []*autoscaling.Tag{
+			{Key: aws.String("env"), Value: aws.String("prod"), PropagateAtLaunch: aws.Bool(true)},
+		},
+	}, testAccountID)
+	require.NoError(t, err)
+}
+
+func describeTestGroup(t *testing.T, svc *AutoScalingServiceImpl, name string) *autoscaling.Group {
+	t.Helper()
+	out, err := svc.DescribeAutoScalingGroups(&autoscaling.DescribeAutoScalingGroupsInput{
+		AutoScalingGroupNames: aws.StringSlice([]string{name}),
+	}, testAccountID)
+	require.NoError(t, err)
+	require.Len(t, out.AutoScalingGroups, 1)
+	return out.AutoScalingGroups[0]
+}
+
+// --- CreateAutoScalingGroup Tests ---
+
+func TestCreateAutoScalingGroup(t *testing.T) {
+	svc := setupTestService(t)
+	createTestGroup(t, svc, "web-asg", 1, 4, 2)
+
+	group := describeTestGroup(t, svc, "web-asg")
+	assert.Equal(t, "web-asg", *group.AutoScalingGroupName)
+	assert.Contains(t, *group.AutoScalingGroupARN, "arn:aws:autoscaling:us-east-1:123456789012:autoScalingGroup:")
+	assert.Equal(t, int64(1), *group.MinSize)
+	assert.Equal(t, int64(4), *group.MaxSize)
+	assert.Equal(t, int64(2), *group.DesiredCapacity)
+	assert.Equal(t, int64(300), *group.DefaultCooldown)
+	assert.Equal(t, "EC2", *group.HealthCheckType)
+	assert.Equal(t, "web", *group.LaunchTemplate.LaunchTemplateName)
+	assert.Equal(t, "$Default", *group.LaunchTemplate.Version)
+	assert.Equal(t, "subnet-a,subnet-b", *group.VPCZoneIdentifier)
+	assert.Empty(t, group.Instances)
+	require.Len(t, group.Tags, 1)
+	assert.True(t, *group.Tags[0].PropagateAtLaunch)
+}
+
+func TestCreateAutoScalingGroup_DesiredDefaultsToMin(t *testing.T) {
+	svc := setupTestService(t)
+	_, err := svc.CreateAutoScalingGroup(&autoscaling.CreateAutoScalingGroupInput{
+		AutoScalingGroupName: aws.String("web-asg"),
+		LaunchTemplate:       &autoscaling.LaunchTemplateSpecification{LaunchTemplateId: aws.String("lt-0123456789abcdef0"), Version: aws.String("2")},
+		MinSize:              aws.Int64(2),
+		MaxSize:              aws.Int64(3),
+	}, testAccountID)
+	require.NoError(t, err)
+
+	group := describeTestGroup(t, svc, "web-asg")
+	assert.Equal(t, int64(2), *group.DesiredCapacity)
+	assert.Equal(t, "2", *group.LaunchTemplate.Version)
+}
+
+func TestCreateAutoScalingGroup_Duplicate(t *testing.T) {
+	svc := setupTestService(t)
+	createTestGroup(t, svc, "web-asg", 0, 2, 1)
+
+	_, err := svc.CreateAutoScalingGroup(&autoscaling.CreateAutoScalingGroupInput{
+		AutoScalingGroupName: aws.String("web-asg"),
+		LaunchTemplate:       &autoscaling.LaunchTemplateSpecification{LaunchTemplateName: aws.String("web")},
+		MinSize:              aws.Int64(0),
+		MaxSize:              aws.Int64(1),
+	}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorAutoScalingAlreadyExists)
+}
+
+func TestCreateAutoScalingGroup_Validation(t *testing.T) {
+	svc := setupTestService(t)
+	template := &autoscaling.LaunchTemplateSpecification{LaunchTemplateName: aws.String("web")}
+
+	tests := []struct {
+		name  string
+		input *autoscaling.CreateAutoScalingGroupInput
+		want  string
+	}{
+		{"MissingName", &autoscaling.CreateAutoScalingGroupInput{LaunchTemplate: template, MinSize: aws.Int64(0), MaxSize: aws.Int64(1)}, awserrors.ErrorMissingParameter},
+		{"MissingMaxSize", &autoscaling.CreateAutoScalingGroupInput{AutoScalingGroupName: aws.String("g"), LaunchTemplate: template, MinSize: aws.Int64(0)}, awserrors.ErrorMissingParameter},
+		{"MissingLaunchTemplate", &autoscaling.CreateAutoScalingGroupInput{AutoScalingGroupName: aws.String("g"), MinSize: aws.Int64(0), MaxSize: aws.Int64(1)}, awserrors.ErrorValidationError},
+		{"LaunchConfiguration", &autoscaling.CreateAutoScalingGroupInput{AutoScalingGroupName: aws.String("g"), LaunchConfigurationName: aws.String("lc"), MinSize: aws.Int64(0), MaxSize: aws.Int64(1)}, awserrors.ErrorValidationError},
+		{"InvalidName", &autoscaling.CreateAutoScalingGroupInput{AutoScalingGroupName: aws.String("web asg"), LaunchTemplate: template, MinSize: aws.Int64(0), MaxSize: aws.Int64(1)}, awserrors.ErrorValidationError},
+		{"MinAboveMax", &autoscaling.CreateAutoScalingGroupInput{AutoScalingGroupName: aws.String("g"), LaunchTemplate: template, MinSize: aws.Int64(3), MaxSize: aws.Int64(1)}, awserrors.ErrorValidationError},
+		{"DesiredAboveMax", &autoscaling.CreateAutoScalingGroupInput{AutoScalingGroupName: aws.String("g"), LaunchTemplate: template, MinSize: aws.Int64(0), MaxSize: aws.Int64(1), DesiredCapacity: aws.Int64(2)}, awserrors.ErrorValidationError},
+		{"ELBHealthCheck", &autoscaling.CreateAutoScalingGroupInput{AutoScalingGroupName: aws.String("g"), LaunchTemplate: template, MinSize: aws.Int64(0), MaxSize: aws.Int64(1), HealthCheckType: aws.String("ELB")}, awserrors.ErrorValidationError},
+		{"ReservedTag", &autoscaling.CreateAutoScalingGroupInput{AutoScalingGroupName: aws.String("g"), LaunchTemplate: template, MinSize: aws.Int64(0), MaxSize: aws.Int64(1), Tags: []*autoscaling.Tag{{Key: aws.String("aws:owner"), Value: aws.String("x")}}}, awserrors.ErrorValidationError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.CreateAutoScalingGroup(tt.input, testAccountID)
+			assert.EqualError(t, err, tt.want)
+		})
+	}
+}
+
+// --- UpdateAutoScalingGroup / SetDesiredCapacity Tests ---
+
+func TestUpdateAutoScalingGroup(t *testing.T) {
+	svc := setupTestService(t)
+	createTestGroup(t, svc, "web-asg", 1, 4, 3)
+
+	// Lowering the max drags the desired capacity down with it.
+	_, err := svc.UpdateAutoScalingGroup(&autoscaling.UpdateAutoScalingGroupInput{
+		AutoScalingGroupName: aws.String("web-asg"),
+		MaxSize:              aws.Int64(2),
+		LaunchTemplate:       &autoscaling.LaunchTemplateSpecification{LaunchTemplateName: aws.String("web"), Version: aws.String("$Latest")},
+	}, testAccountID)
+	require.NoError(t, err)
+
+	group := describeTestGroup(t, svc, "web-asg")
+	assert.Equal(t, int64(2), *group.MaxSize)
+	assert.Equal(t, int64(2), *group.DesiredCapacity)
+	assert.Equal(t, "$Latest", *group.LaunchTemplate.Version)
+
+	_, err = svc.UpdateAutoScalingGroup(&autoscaling.UpdateAutoScalingGroupInput{
+		AutoScalingGroupName: aws.String("web-asg"),
+		MinSize:              aws.Int64(5),
+	}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorValidationError)
+
+	_, err = svc.UpdateAutoScalingGroup(&autoscaling.UpdateAutoScalingGroupInput{
+		AutoScalingGroupName: aws.String("missing"),
+		MaxSize:              aws.Int64(5),
+	}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorValidationError)
+}
+
+func TestSetDesiredCapacity(t *testing.T) {
+	svc := setupTestService(t)
+	createTestGroup(t, svc, "web-asg", 1, 4, 1)
+
+	_, err := svc.SetDesiredCapacity(&autoscaling.SetDesiredCapacityInput{
+		AutoScalingGroupName: aws.String("web-asg"),
+		DesiredCapacity:      aws.Int64(4),
+	}, testAccountID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), *describeTestGroup(t, svc, "web-asg").DesiredCapacity)
+
+	_, err = svc.SetDesiredCapacity(&autoscaling.SetDesiredCapacityInput{
+		AutoScalingGroupName: aws.String("web-asg"),
+		DesiredCapacity:      aws.Int64(5),
+	}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorValidationError)
+}
+
+// --- DeleteAutoScalingGroup Tests ---
+
+func TestDeleteAutoScalingGroup_Empty(t *testing.T) {
+	svc := setupTestService(t)
+	createTestGroup(t, svc, "web-asg", 0, 2, 0)
+
+	_, err := svc.DeleteAutoScalingGroup(&autoscaling.DeleteAutoScalingGroupInput{AutoScalingGroupName: aws.String("web-asg")}, testAccountID)
+	require.NoError(t, err)
+
+	out, err := svc.DescribeAutoScalingGroups(&autoscaling.DescribeAutoScalingGroupsInput{}, testAccountID)
+	require.NoError(t, err)
+	assert.Empty(t, out.AutoScalingGroups)
+
+	_, err = svc.DeleteAutoScalingGroup(&autoscaling.DeleteAutoScalingGroupInput{AutoScalingGroupName: aws.String("web-asg")}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorValidationError)
+}
+
+func TestDeleteAutoScalingGroup_WithInstances(t *testing.T) {
+	svc := setupTestService(t)
+	createTestGroup(t, svc, "web-asg", 1, 2, 1)
+	require.NoError(t, svc.updateGroup(testAccountID, "web-asg", func(r *GroupRecord) error {
+		r.Instances = append(r.Instances, InstanceRecord{InstanceID: "i-1", LifecycleState: autoscaling.LifecycleStateInService})
+		return nil
+	}))
+
+	_, err := svc.DeleteAutoScalingGroup(&autoscaling.DeleteAutoScalingGroupInput{AutoScalingGroupName: aws.String("web-asg")}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorAutoScalingScalingActivityInProgress)
+
+	_, err = svc.DeleteAutoScalingGroup(&autoscaling.DeleteAutoScalingGroupInput{
+		AutoScalingGroupName: aws.String("web-asg"),
+		ForceDelete:          aws.Bool(true),
+	}, testAccountID)
+	require.NoError(t, err)
+
+	group := describeTestGroup(t, svc, "web-asg")
+	assert.Equal(t, StatusDeleting, *group.Status)
+	assert.Equal(t, int64(0), *group.DesiredCapacity)
+
+	_, err = svc.SetDesiredCapacity(&autoscaling.SetDesiredCapacityInput{
+		AutoScalingGroupName: aws.String("web-asg"),
+		DesiredCapacity:      aws.Int64(0),
+	}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorAutoScalingScalingActivityInProgress)
+}
+
+// --- DescribeAutoScalingGroups Tests ---
+
+func TestDescribeAutoScalingGroups_Filters(t *testing.T) {
+	svc := setupTestService(t)
+	createTestGroup(t, svc, "web-asg", 0, 2, 0)
+	_, err := svc.CreateAutoScalingGroup(&autoscaling.CreateAutoScalingGroupInput{
+		AutoScalingGroupName: aws.String("batch-asg"),
+		LaunchTemplate:       &autoscaling.LaunchTemplateSpecification{LaunchTemplateName: aws.String("batch")},
+		MinSize:              aws.Int64(0),
+		MaxSize:              aws.Int64(1),
+		Tags:                 []*autoscaling.Tag{{Key: aws.String("env"), Value: aws.String("dev")}},
+	}, testAccountID)
+	require.NoError(t, err)
+
+	out, err := svc.DescribeAutoScalingGroups(&autoscaling.DescribeAutoScalingGroupsInput{}, testAccountID)
+	require.NoError(t, err)
+	require.Len(t, out.AutoScalingGroups, 2)
+	assert.Equal(t, "web-asg", *out.AutoScalingGroups[0].AutoScalingGroupName)
+
+	out, err = svc.DescribeAutoScalingGroups(&autoscaling.DescribeAutoScalingGroupsInput{
+		Filters: []*autoscaling.Filter{{Name: aws.String("tag:env"), Values: aws.StringSlice([]string{"dev"})}},
+	}, testAccountID)
+	require.NoError(t, err)
+	require.Len(t, out.AutoScalingGroups, 1)
+	assert.Equal(t, "batch-asg", *out.AutoScalingGroups[0].AutoScalingGroupName)
+
+	// Other accounts see nothing.
+	out, err = svc.DescribeAutoScalingGroups(&autoscaling.DescribeAutoScalingGroupsInput{}, "000000000000")
+	require.NoError(t, err)
+	assert.Empty(t, out.AutoScalingGroups)
+}
@@ -0,0 +1,39 @@
+package handlers_autoscaling
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+)
+
+// NATSAutoScalingService handles Auto Scaling operations via NATS messaging.
+type NATSAutoScalingService struct {
+	natsConn *nats.Conn
+}
+
+// NewNATSAutoScalingService creates a new NATS-based Auto Scaling service.
+func NewNATSAutoScalingService(conn *nats.Conn) AutoScalingService {
+	return &NATSAutoScalingService{natsConn: conn}
+}
+
+func (s *NATSAutoScalingService) CreateAutoScalingGroup(input *autoscaling.CreateAutoScalingGroupInput, accountID string) (*autoscaling.CreateAutoScalingGroupOutput, error) {
+	return utils.NATSRequest[autoscaling.CreateAutoScalingGroupOutput](s.natsConn, "autoscaling.CreateAutoScalingGroup", input, 30*time.Second, accountID)
+}
+
+func (s *NATSAutoScalingService) UpdateAutoScalingGroup(input *autoscaling.UpdateAutoScalingGroupInput, accountID string) (*autoscaling.UpdateAutoScalingGroupOutput, error) {
+	return utils.NATSRequest[autoscaling.UpdateAutoScalingGroupOutput](s.natsConn, "autoscaling.UpdateAutoScalingGroup", input, 30*time.Second, accountID)
+}
+
+func (s *NATSAutoScalingService) SetDesiredCapacity(input *autoscaling.SetDesiredCapacityInput, accountID string) (*autoscaling.SetDesiredCapacityOutput, error) {
+	return utils.NATSRequest[autoscaling.SetDesiredCapacityOutput](s.natsConn, "autoscaling.SetDesiredCapacity", input, 30*time.Second, accountID)
+}
+
+func (s *NATSAutoScalingService) DeleteAutoScalingGroup(input *autoscaling.DeleteAutoScalingGroupInput, accountID string) (*autoscaling.DeleteAutoScalingGroupOutput, error) {
+	return utils.NATSRequest[autoscaling.DeleteAutoScalingGroupOutput](s.natsConn, "autoscaling.DeleteAutoScalingGroup", input, 30*time.Second, accountID)
+}
+
+func (s *NATSAutoScalingService) DescribeAutoScalingGroups(input *autoscaling.DescribeAutoScalingGroupsInput, accountID string) (*autoscaling.DescribeAutoScalingGroupsOutput, error) {
+	return utils.NATSRequest[autoscaling.DescribeAutoScalingGroupsOutput](s.natsConn, "autoscaling.DescribeAutoScalingGroups", input, 30*time.Second, accountID)
+}
@@ -310,7 +310,7 @@ func (s *IGWServiceImpl) AttachInternetGateway(input *ec2.AttachInternetGatewayI
 		eventData, err := json.Marshal(event)
 		if err != nil {
 			slog.Warn("Failed to marshal IGW attach event", "error", err)
-		} else if err := s.natsConn.Publish("vpc.igw-attach", eventData); err != nil {
+		} else if err := s.natsConn.Publish(utils.Subject("vpc.igw-attach"), eventData); err != nil {
 			slog.Warn("Failed to publish IGW attach event", "error", err)
 		}
 	}
@@ -368,7 +368,7 @@ func (s *IGWServiceImpl) DetachInternetGateway(input *ec2.DetachInternetGatewayI
 		eventData, err := json.Marshal(event)
 		if err != nil {
 			slog.Warn("Failed to marshal IGW detach event", "error", err)
-		} else if err := s.natsConn.Publish("vpc.igw-detach", eventData); err != nil {
+		} else if err := s.natsConn.Publish(utils.Subject("vpc.igw-detach"), eventData); err != nil {
 			slog.Warn("Failed to publish IGW detach event", "error", err)
 		}
 	}
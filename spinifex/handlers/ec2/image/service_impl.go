@@ -20,6 +20,7 @@ import (
 	"github.com/mulgadc/spinifex/spinifex/filterutil"
 	handlers_ec2_snapshot "github.com/mulgadc/spinifex/spinifex/handlers/ec2/snapshot"
 	"github.com/mulgadc/spinifex/spinifex/objectstore"
+	"github.com/mulgadc/spinifex/spinifex/pagination"
 	"github.com/mulgadc/spinifex/spinifex/types"
 	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/mulgadc/viperblock/viperblock"
@@ -33,10 +34,14 @@ var _ ImageService = (*ImageServiceImpl)(nil)
 // CreateImageParams holds parameters for creating an AMI from an instance.
 // Used by the daemon handler which extracts instance state before calling the service.
 type CreateImageParams struct {
-	Input         *ec2.CreateImageInput
-	RootVolumeID  string
-	SourceImageID string
-	IsRunning     bool // true = use ebs.snapshot NATS, false = snapshot from S3 state
+	Input          *ec2.CreateImageInput
+	RootVolumeID   string
+	RootDeviceName string
+	SourceImageID  string
+	IsRunning      bool // true = use ebs.snapshot NATS, false = snapshot from S3 state
+	// Quiesce, when set, readies a running guest for its live snapshot and
+	// returns the function that releases it again, or nil if it couldn't.
+	Quiesce func() func()
 }
 
 // ImageServiceImpl handles AMI image operations with S3 storage
@@ -47,15 +52,8 @@ type ImageServiceImpl struct {
 	bucketName string
 }
 
-// NewImageServiceImpl creates a new daemon-side image service
-func NewImageServiceImpl(cfg *config.Config, natsConn *nats.Conn) *ImageServiceImpl {
-	store := objectstore.NewS3ObjectStoreFromConfig(
-		cfg.Predastore.Host,
-		cfg.Predastore.Region,
-		cfg.Predastore.AccessKey,
-		cfg.Predastore.SecretKey,
-	)
-
+// NewImageServiceImpl creates a new daemon-side image service on store
+func NewImageServiceImpl(cfg *config.Config, natsConn *nats.Conn, store objectstore.ObjectStore) *ImageServiceImpl {
 	return &ImageServiceImpl{
 		config:     cfg,
 		store:      store,
@@ -84,6 +82,7 @@ var describeImagesValidFilters = map[string]bool{
 	"image-type":          true,
 	"virtualization-type": true,
 	"root-device-type":    true,
+	"tag-key":             true,
 }
 
 // DescribeImages lists available AMI images by reading config.json files from S3
@@ -100,6 +99,11 @@ func (s *ImageServiceImpl) DescribeImages(input *ec2.DescribeImagesInput, accoun
 		return nil, errors.New(awserrors.ErrorInvalidParameterValue)
 	}
 
+	page, err := pagination.Parse(input.MaxResults, input.NextToken, pagination.DescribeImagesLimits)
+	if err != nil {
+		return nil, err
+	}
+
 	// List all prefixes in the bucket (AMIs are stored as ami-<id>/ directories)
 	result, err := s.store.ListObjectsV2(&s3.ListObjectsV2Input{
 		Bucket:    aws.String(s.bucketName),
@@ -134,10 +138,13 @@ func (s *ImageServiceImpl) DescribeImages(input *ec2.DescribeImagesInput, accoun
 			continue
 		}
 
-		// Early skip: if image-id filter is set, check the prefix (ami-xxx/)
-		// against filter values before fetching config from S3.
+		// Early skip: AMIs on earlier pages, and those the image-id filter
+		// excludes, are skipped before fetching their config from S3.
+		amiID := strings.TrimSuffix(prefixStr, "/")
+		if page.After != "" && amiID <= page.After {
+			continue
+		}
 		if len(imageIDFilterValues) > 0 {
-			amiID := strings.TrimSuffix(prefixStr, "/")
 			if !filterutil.MatchesAny(imageIDFilterValues, amiID) {
 				continue
 			}
@@ -294,11 +301,11 @@ func (s *ImageServiceImpl) DescribeImages(input *ec2.DescribeImagesInput, accoun
 		}
 	}
 
-	slog.Info("DescribeImages completed", "count", len(images))
+	output := &ec2.DescribeImagesOutput{}
+	output.Images, output.NextToken = pagination.Apply(page, images, func(image *ec2.Image) string { return aws.StringValue(image.ImageId) })
 
-	return &ec2.DescribeImagesOutput{
-		Images: images,
-	}, nil
+	slog.Info("DescribeImages completed", "count", len(output.Images), "has_next_page", output.NextToken != nil)
+	return output, nil
 }
 
 // imageMatchesFilters checks whether an ec2.Image satisfies all parsed filters.
@@ -350,6 +357,11 @@ func imageMatchesFilters(image *ec2.Image, filters map[string][]string, tags map
 			if image.RootDeviceType != nil {
 				field = *image.RootDeviceType
 			}
+		case "tag-key":
+			if !filterutil.MatchesTagKey(values, tags) {
+				return false
+			}
+			continue
 		default:
 			return false
 		}
@@ -387,29 +399,53 @@ func (s *ImageServiceImpl) CreateImageFromInstance(params CreateImageParams, acc
 		}
 	}
 
+	var defaultTags map[string]string
+	if s.config != nil {
+		defaultTags = s.config.Daemon.DefaultTagsFor(accountID)
+	}
+	imageTags, err := utils.MergeDefaultTags(input.TagSpecifications, "image", defaultTags)
+	if err != nil {
+		return nil, err
+	}
+	snapshotTags, err := utils.MergeDefaultTags(input.TagSpecifications, "snapshot", defaultTags)
+	if err != nil {
+		return nil, err
+	}
+
+	// Step 1: Read source volume config for size
+	volumeConfig, err := s.getVolumeConfig(params.RootVolumeID)
+	if err != nil {
+		slog.Error("CreateImageFromInstance: failed to read volume config", "volumeId", params.RootVolumeID, "err", err)
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+	volumeSizeGiB, err := imageRootVolumeSize(input.BlockDeviceMappings, params.RootDeviceName, volumeConfig.VolumeMetadata.SizeGiB)
+	if err != nil {
+		return nil, err
+	}
+
 	amiID := utils.GenerateResourceID("ami")
 	snapshotID := utils.GenerateResourceID("snap")
 
 	slog.Info("CreateImageFromInstance", "instanceId", *input.InstanceId,
 		"rootVolumeId", params.RootVolumeID, "amiId", amiID, "snapshotId", snapshotID,
-		"isRunning", params.IsRunning)
+		"isRunning", params.IsRunning, "noReboot", aws.BoolValue(input.NoReboot))
 
-	// Step 1: Snapshot root volume (live via NATS or offline from S3)
-	snapshotFn := s.snapshotStoppedVolume
+	// Step 2: Snapshot root volume (live via NATS or offline from S3)
 	if params.IsRunning {
-		snapshotFn = s.snapshotRunningVolume
-	}
-	if err := snapshotFn(params.RootVolumeID, snapshotID); err != nil {
-		return nil, err
+		var release func()
+		if params.Quiesce != nil {
+			release = params.Quiesce()
+		}
+		err = s.snapshotRunningVolume(params.RootVolumeID, snapshotID)
+		if release != nil {
+			release()
+		}
+	} else {
+		err = s.snapshotStoppedVolume(params.RootVolumeID, snapshotID)
 	}
-
-	// Step 2: Read source volume config for size
-	volumeConfig, err := s.getVolumeConfig(params.RootVolumeID)
 	if err != nil {
-		slog.Error("CreateImageFromInstance: failed to read volume config", "volumeId", params.RootVolumeID, "err", err)
-		return nil, errors.New(awserrors.ErrorServerInternal)
+		return nil, err
 	}
-	volumeSizeGiB := volumeConfig.VolumeMetadata.SizeGiB
 
 	// Step 3: Read source AMI config for architecture, platform, etc.
 	sourceAMI := viperblock.AMIMetadata{
@@ -427,7 +463,7 @@ func (s *ImageServiceImpl) CreateImageFromInstance(params CreateImageParams, acc
 	}
 
 	// Step 4: Store snapshot metadata
-	if err := s.putSnapshotMetadata(snapshotID, params.RootVolumeID, volumeSizeGiB, accountID); err != nil {
+	if err := s.putSnapshotMetadata(snapshotID, params.RootVolumeID, volumeConfig.VolumeMetadata.SizeGiB, accountID, snapshotTags); err != nil {
 		slog.Error("CreateImageFromInstance: failed to write snapshot metadata", "snapshotId", snapshotID, "err", err)
 		return nil, errors.New(awserrors.ErrorServerInternal)
 	}
@@ -446,6 +482,9 @@ func (s *ImageServiceImpl) CreateImageFromInstance(params CreateImageParams, acc
 		RootDeviceType:  ec2.DeviceTypeEbs,
 		ImageOwnerAlias: accountID,
 	}
+	if len(imageTags) > 0 {
+		meta.Tags = imageTags
+	}
 
 	if err := s.putAMIConfig(amiID, meta); err != nil {
 		slog.Error("CreateImageFromInstance: failed to store AMI config", "amiId", amiID, "err", err)
@@ -459,6 +498,47 @@ func (s *ImageServiceImpl) CreateImageFromInstance(params CreateImageParams, acc
 	}, nil
 }
 
+// imageRootVolumeSize applies CreateImage's block device mappings to the
+// root volume of sizeGiB and returns the size the image launches it at. Only
+// the root volume is imaged: other devices may only be suppressed with
+// NoDevice, and the root may only be grown.
+func imageRootVolumeSize(mappings []*ec2.BlockDeviceMapping, rootDeviceName string, sizeGiB uint64) (uint64, error) {
+	for _, bdm := range mappings {
+		if bdm == nil {
+			continue
+		}
+		device := aws.StringValue(bdm.DeviceName)
+		if device == "" {
+			return 0, errors.New(awserrors.ErrorMissingParameter)
+		}
+		// DescribeImages reports every root as /dev/sda1
+		isRoot := device == rootDeviceName || device == "/dev/sda1"
+		if !isRoot {
+			if bdm.NoDevice == nil || bdm.Ebs != nil || bdm.VirtualName != nil {
+				return 0, errors.New(awserrors.ErrorInvalidBlockDeviceMapping)
+			}
+			continue
+		}
+		if bdm.NoDevice != nil || bdm.VirtualName != nil {
+			return 0, errors.New(awserrors.ErrorInvalidBlockDeviceMapping)
+		}
+		if bdm.Ebs == nil {
+			continue
+		}
+		if bdm.Ebs.SnapshotId != nil || aws.BoolValue(bdm.Ebs.Encrypted) || bdm.Ebs.KmsKeyId != nil {
+			return 0, errors.New(awserrors.ErrorInvalidBlockDeviceMapping)
+		}
+		if bdm.Ebs.VolumeSize != nil {
+			size := aws.Int64Value(bdm.Ebs.VolumeSize)
+			if size < utils.SafeUint64ToInt64(sizeGiB) {
+				return 0, errors.New(awserrors.ErrorInvalidBlockDeviceMapping)
+			}
+			sizeGiB = uint64(size)
+		}
+	}
+	return sizeGiB, nil
+}
+
 // snapshotRunningVolume triggers a snapshot via NATS on a running viperblockd instance
 func (s *ImageServiceImpl) snapshotRunningVolume(volumeID, snapshotID string) error {
 	if s.natsConn == nil {
@@ -472,7 +552,7 @@ func (s *ImageServiceImpl) snapshotRunningVolume(volumeID, snapshotID string) er
 		return errors.New(awserrors.ErrorServerInternal)
 	}
 
-	msg, err := s.natsConn.Request(fmt.Sprintf("ebs.snapshot.%s", volumeID), snapData, 30*time.Second)
+	msg, err := s.natsConn.Request(utils.Subject(fmt.Sprintf("ebs.snapshot.%s", volumeID)), snapData, 30*time.Second)
 	if err != nil {
 		slog.Error("snapshotRunningVolume: NATS request failed", "volumeId", volumeID, "snapshotId", snapshotID, "err", err)
 		return errors.New(awserrors.ErrorServerInternal)
@@ -718,16 +798,19 @@ func (s *ImageServiceImpl) loadAMIForMutation(imageID, accountID string) (viperb
 }
 
 // putSnapshotMetadata stores snapshot metadata in S3 using the canonical SnapshotConfig type
-func (s *ImageServiceImpl) putSnapshotMetadata(snapshotID, volumeID string, volumeSizeGiB uint64, accountID string) error {
+func (s *ImageServiceImpl) putSnapshotMetadata(snapshotID, volumeID string, volumeSizeGiB uint64, accountID string, tags map[string]string) error {
 	cfg := handlers_ec2_snapshot.SnapshotConfig{
 		SnapshotID: snapshotID,
 		VolumeID:   volumeID,
 		VolumeSize: utils.SafeUint64ToInt64(volumeSizeGiB),
 		State:      "completed",
 		Progress:   "100%",
-		StartTime:  time.Now(),
+		StartTime:  utils.Now(),
 		OwnerID:    accountID,
 	}
+	if len(tags) > 0 {
+		cfg.Tags = tags
+	}
 	return handlers_ec2_snapshot.WriteSnapshotConfig(s.store, s.bucketName, snapshotID, &cfg)
 }
 
@@ -802,7 +885,7 @@ func (s *ImageServiceImpl) CopyImage(input *ec2.CopyImageInput, accountID string
 	if srcSnap.VolumeSize > 0 {
 		snapSizeGiB = uint64(srcSnap.VolumeSize)
 	}
-	if err := s.putSnapshotMetadata(newSnapshotID, srcSnap.VolumeID, snapSizeGiB, accountID); err != nil {
+	if err := s.putSnapshotMetadata(newSnapshotID, srcSnap.VolumeID, snapSizeGiB, accountID, nil); err != nil {
 		slog.Error("CopyImage: failed to write snapshot metadata", "snapshotId", newSnapshotID, "err", err)
 		return nil, errors.New(awserrors.ErrorServerInternal)
 	}
@@ -2,6 +2,7 @@ package handlers_ec2_image
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"strings"
 	"testing"
@@ -13,7 +14,11 @@ import (
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
 	handlers_ec2_snapshot "github.com/mulgadc/spinifex/spinifex/handlers/ec2/snapshot"
 	"github.com/mulgadc/spinifex/spinifex/objectstore"
+	"github.com/mulgadc/spinifex/spinifex/testutil"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/mulgadc/viperblock/viperblock"
+	"github.com/nats-io/nats.go"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -242,7 +247,7 @@ func TestGetAMIConfig_NotFound(t *testing.T) {
 func TestPutSnapshotMetadata(t *testing.T) {
 	svc, store := setupTestImageService(t)
 
-	err := svc.putSnapshotMetadata("snap-abc123", "vol-xyz789", 10, testAccountID)
+	err := svc.putSnapshotMetadata("snap-abc123", "vol-xyz789", 10, testAccountID, nil)
 	require.NoError(t, err)
 
 	// Verify the metadata was written correctly
@@ -527,7 +532,7 @@ func TestDeregisterImage_DoesNotTouchSnapshot(t *testing.T) {
 	require.NoError(t, err)
 
 	// Backing snapshot metadata
-	require.NoError(t, svc.putSnapshotMetadata(snapID, "vol-keep", 8, testAccountID))
+	require.NoError(t, svc.putSnapshotMetadata(snapID, "vol-keep", 8, testAccountID, nil))
 
 	_, err = svc.DeregisterImage(&ec2.DeregisterImageInput{ImageId: aws.String(amiID)}, testAccountID)
 	require.NoError(t, err)
@@ -2307,3 +2312,139 @@ func TestResetImageAttribute_MissingParameters(t *testing.T) {
 	require.Error(t, err)
 	assert.Equal(t, awserrors.ErrorMissingParameter, err.Error())
 }
+
+func TestDescribeImages_Paginated(t *testing.T) {
+	svc, store := setupTestImageService(t)
+	for i := 7; i >= 1; i-- {
+		id := fmt.Sprintf("ami-page%d", i)
+		createTestAMIConfigWithOwner(t, store, id, id, testAccountID)
+	}
+
+	first, err := svc.DescribeImages(&ec2.DescribeImagesInput{MaxResults: aws.Int64(6)}, testAccountID)
+	require.NoError(t, err)
+	require.Len(t, first.Images, 6)
+	assert.Equal(t, "ami-page1", *first.Images[0].ImageId)
+	assert.Equal(t, "ami-page6", *first.Images[5].ImageId)
+	require.NotNil(t, first.NextToken)
+
+	second, err := svc.DescribeImages(&ec2.DescribeImagesInput{MaxResults: aws.Int64(6), NextToken: first.NextToken}, testAccountID)
+	require.NoError(t, err)
+	require.Len(t, second.Images, 1)
+	assert.Equal(t, "ami-page7", *second.Images[0].ImageId)
+	assert.Nil(t, second.NextToken)
+
+	_, err = svc.DescribeImages(&ec2.DescribeImagesInput{NextToken: aws.String("bogus")}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorInvalidNextToken)
+}
+
+func TestCreateImageFromInstance_QuiescesAroundLiveSnapshot(t *testing.T) {
+	svc, store := setupTestImageService(t)
+	_, nc := testutil.StartTestNATS(t)
+	svc.natsConn = nc
+	createTestVolumeConfig(t, store, "vol-root123", 10)
+
+	var steps []string
+	_, err := nc.Subscribe(utils.Subject("ebs.snapshot.vol-root123"), func(msg *nats.Msg) {
+		var req types.EBSSnapshotRequest
+		require.NoError(t, json.Unmarshal(msg.Data, &req))
+		steps = append(steps, "snapshot")
+		data, _ := json.Marshal(types.EBSSnapshotResponse{SnapshotID: req.SnapshotID, Success: true})
+		_ = msg.Respond(data)
+	})
+	require.NoError(t, err)
+
+	out, err := svc.CreateImageFromInstance(CreateImageParams{
+		Input: &ec2.CreateImageInput{
+			InstanceId: aws.String("i-test123"),
+			Name:       aws.String("packer-build"),
+			BlockDeviceMappings: []*ec2.BlockDeviceMapping{
+				{DeviceName: aws.String("/dev/vda"), Ebs: &ec2.EbsBlockDevice{VolumeSize: aws.Int64(20)}},
+				{DeviceName: aws.String("/dev/sdb"), NoDevice: aws.String("")},
+			},
+			TagSpecifications: []*ec2.TagSpecification{
+				{ResourceType: aws.String("image"), Tags: []*ec2.Tag{{Key: aws.String("Build"), Value: aws.String("42")}}},
+				{ResourceType: aws.String("snapshot"), Tags: []*ec2.Tag{{Key: aws.String("Source"), Value: aws.String("packer")}}},
+			},
+		},
+		RootVolumeID:   "vol-root123",
+		RootDeviceName: "/dev/vda",
+		IsRunning:      true,
+		Quiesce: func() func() {
+			steps = append(steps, "freeze")
+			return func() { steps = append(steps, "thaw") }
+		},
+	}, testAccountID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"freeze", "snapshot", "thaw"}, steps)
+
+	meta, err := svc.GetAMIConfig(*out.ImageId)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(20), meta.VolumeSizeGiB)
+	assert.Equal(t, map[string]string{"Build": "42"}, meta.Tags)
+
+	snap, err := handlers_ec2_snapshot.ReadSnapshotConfig(store, testBucket, meta.SnapshotID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), snap.VolumeSize)
+	assert.Equal(t, map[string]string{"Source": "packer"}, snap.Tags)
+}
+
+func TestCreateImageFromInstance_ReleasesQuiesceOnSnapshotFailure(t *testing.T) {
+	svc, store := setupTestImageService(t)
+	createTestVolumeConfig(t, store, "vol-root123", 10)
+
+	released := false
+	_, err := svc.CreateImageFromInstance(CreateImageParams{
+		Input:        &ec2.CreateImageInput{InstanceId: aws.String("i-test123"), Name: aws.String("img")},
+		RootVolumeID: "vol-root123",
+		IsRunning:    true,
+		Quiesce:      func() func() { return func() { released = true } },
+	}, testAccountID)
+	require.Error(t, err)
+	assert.True(t, released)
+}
+
+func TestImageRootVolumeSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		mappings []*ec2.BlockDeviceMapping
+		want     uint64
+		wantErr  string
+	}{
+		{name: "no mappings", want: 8},
+		{name: "grow root", mappings: []*ec2.BlockDeviceMapping{
+			{DeviceName: aws.String("/dev/vda"), Ebs: &ec2.EbsBlockDevice{VolumeSize: aws.Int64(30)}},
+		}, want: 30},
+		{name: "root by AMI name", mappings: []*ec2.BlockDeviceMapping{
+			{DeviceName: aws.String("/dev/sda1"), Ebs: &ec2.EbsBlockDevice{VolumeSize: aws.Int64(12)}},
+		}, want: 12},
+		{name: "suppress data volume", mappings: []*ec2.BlockDeviceMapping{
+			{DeviceName: aws.String("/dev/sdb"), NoDevice: aws.String("")},
+		}, want: 8},
+		{name: "shrink root", mappings: []*ec2.BlockDeviceMapping{
+			{DeviceName: aws.String("/dev/vda"), Ebs: &ec2.EbsBlockDevice{VolumeSize: aws.Int64(4)}},
+		}, wantErr: awserrors.ErrorInvalidBlockDeviceMapping},
+		{name: "suppress root", mappings: []*ec2.BlockDeviceMapping{
+			{DeviceName: aws.String("/dev/vda"), NoDevice: aws.String("")},
+		}, wantErr: awserrors.ErrorInvalidBlockDeviceMapping},
+		{name: "root from snapshot", mappings: []*ec2.BlockDeviceMapping{
+			{DeviceName: aws.String("/dev/vda"), Ebs: &ec2.EbsBlockDevice{SnapshotId: aws.String("snap-1")}},
+		}, wantErr: awserrors.ErrorInvalidBlockDeviceMapping},
+		{name: "extra volume", mappings: []*ec2.BlockDeviceMapping{
+			{DeviceName: aws.String("/dev/sdc"), Ebs: &ec2.EbsBlockDevice{VolumeSize: aws.Int64(100)}},
+		}, wantErr: awserrors.ErrorInvalidBlockDeviceMapping},
+		{name: "no device name", mappings: []*ec2.BlockDeviceMapping{
+			{Ebs: &ec2.EbsBlockDevice{VolumeSize: aws.Int64(100)}},
+		}, wantErr: awserrors.ErrorMissingParameter},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := imageRootVolumeSize(tt.mappings, "/dev/vda", 8)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -2,6 +2,7 @@ package handlers_ec2_instance
 
 import (
 	"bytes"
+	"crypto/rand"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -19,7 +20,10 @@ import (
 	"github.com/kdomanski/iso9660"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
 	"github.com/mulgadc/spinifex/spinifex/config"
+	handlers_ec2_snapshot "github.com/mulgadc/spinifex/spinifex/handlers/ec2/snapshot"
+	"github.com/mulgadc/spinifex/spinifex/instancetypes"
 	"github.com/mulgadc/spinifex/spinifex/objectstore"
+	"github.com/mulgadc/spinifex/spinifex/tracing"
 	spxtypes "github.com/mulgadc/spinifex/spinifex/types"
 	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/mulgadc/spinifex/spinifex/vm"
@@ -42,8 +46,20 @@ users:
 {{end}}
 ssh_pwauth: false
 
+preserve_hostname: false
 hostname: {{.Hostname}}
+{{- if .FQDN}}
+fqdn: {{.FQDN}}
+{{- end}}
 manage_etc_hosts: true
+{{if .DNSServers}}
+manage_resolv_conf: true
+resolv_conf:
+  nameservers:
+{{- range .DNSServers}}
+    - {{.}}
+{{- end}}
+{{end}}
 
 {{if .CACertPEM}}
 ca_certs:
@@ -52,6 +68,13 @@ ca_certs:
 {{.CACertPEM}}
 {{end}}
 
+{{if .PhoneHomeURL}}
+phone_home:
+  url: {{.PhoneHomeURL}}
+  post: [instance_id]
+  tries: 10
+{{end}}
+
 {{if .UserDataCloudConfig}}
 {{.UserDataCloudConfig}}
 {{end}}
@@ -71,6 +94,7 @@ runcmd:
 const cloudInitMetaTemplate = `# meta-data
 instance-id: {{.InstanceID}}
 local-hostname: {{.Hostname}}
+virtio-rng: {{.VirtioRNG}}
 `
 
 // cloudInitNetworkConfigWildcard enables DHCP on all NICs via wildcard match.
@@ -100,7 +124,10 @@ const cloudInitNetworkConfigWildcard = `network:
 //
 // The dev NIC still gets an IP via DHCP (needed for hostfwd port forwarding)
 // but dhcp4-overrides prevents it from installing routes or DNS.
-func generateNetworkConfig(eniMAC, devMAC, mgmtMAC, mgmtIP string, extraENIMACs []string) string {
+//
+// dnsServers pins the primary VPC NIC's resolvers to the subnet's DHCP
+// options so netplan/systemd-resolved guests get them even if DHCP DNS is lost.
+func generateNetworkConfig(eniMAC, devMAC, mgmtMAC, mgmtIP string, extraENIMACs, dnsServers []string) string {
 	if eniMAC == "" {
 		return cloudInitNetworkConfigWildcard
 	}
@@ -113,6 +140,11 @@ func generateNetworkConfig(eniMAC, devMAC, mgmtMAC, mgmtIP string, extraENIMACs
       dhcp4: true
       dhcp-identifier: mac
 `, eniMAC)
+	if len(dnsServers) > 0 {
+		cfg += fmt.Sprintf(`      nameservers:
+        addresses: [%s]
+`, strings.Join(dnsServers, ", "))
+	}
 
 	for i, mac := range extraENIMACs {
 		if mac == "" {
@@ -156,14 +188,18 @@ type CloudInitData struct {
 	Username            string
 	SSHKey              string
 	Hostname            string
+	FQDN                string
 	UserDataCloudConfig string
 	UserDataScript      string
 	CACertPEM           string
+	DNSServers          []string
+	PhoneHomeURL        string
 }
 
 type CloudInitMetaData struct {
 	InstanceID string
 	Hostname   string
+	VirtioRNG  bool
 }
 
 // VolumeInfo holds volume information returned from GenerateVolumes
@@ -233,6 +269,14 @@ type InstanceServiceImpl struct {
 	natsConn      *nats.Conn
 	instances     *vm.Instances
 	objectStore   objectstore.ObjectStore
+
+	// PhoneHomeURL is the gateway endpoint guests POST to once cloud-init
+	// has finished. Empty when guests cannot reach the gateway.
+	PhoneHomeURL string
+
+	// PhoneHomeViaIMDS is set when PhoneHomeURL is this node's metadata
+	// service, which guests launched with the endpoint disabled can't reach.
+	PhoneHomeViaIMDS bool
 }
 
 // NewInstanceServiceImpl creates a new instance service implementation for daemon use
@@ -250,18 +294,46 @@ func NewInstanceServiceImpl(cfg *config.Config, instanceTypes map[string]*ec2.In
 // Returns the VM struct and EC2 instance metadata
 func (s *InstanceServiceImpl) RunInstance(input *ec2.RunInstancesInput) (*vm.VM, *ec2.Instance, error) {
 	// Validate instance type exists
-	_, exists := s.instanceTypes[*input.InstanceType]
+	typeInfo, exists := s.instanceTypes[*input.InstanceType]
 	if !exists {
 		return nil, nil, errors.New(awserrors.ErrorInvalidInstanceType)
 	}
 
+	// Optional guest watchdog and QEMU passthrough options, requested via instance tags at launch
+	instanceTags := utils.ExtractTags(input.TagSpecifications, "instance")
+	watchdogAction := instanceTags[vm.WatchdogActionTag]
+	if watchdogAction != "" && !vm.IsValidWatchdogAction(watchdogAction) {
+		return nil, nil, errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	qemuOptions, err := vm.ParseQEMUOptions(instanceTags[vm.QEMUOptionsTag])
+	if err != nil {
+		slog.Info("RunInstance: rejected qemu options", "err", err)
+		return nil, nil, errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+
+	var vcpus int64
+	if typeInfo != nil && typeInfo.VCpuInfo != nil {
+		vcpus = aws.Int64Value(typeInfo.VCpuInfo.DefaultVCpus)
+	}
+	cpuCredits, err := launchCPUCredits(input, vcpus)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	instanceId := utils.GenerateResourceID("i")
 
 	// Create new instance structure
 	instance := &vm.VM{
-		ID:           instanceId,
-		Status:       vm.StateProvisioning,
-		InstanceType: *input.InstanceType,
+		ID:                    instanceId,
+		Status:                vm.StateProvisioning,
+		InstanceType:          *input.InstanceType,
+		WatchdogAction:        watchdogAction,
+		VirtioRNG:             s.config == nil || s.config.Daemon.VirtioRNGEnabled(),
+		QEMUOptions:           qemuOptions,
+		CPUCredits:            cpuCredits,
+		DisableApiTermination: aws.BoolValue(input.DisableApiTermination),
+		DisableApiStop:        aws.BoolValue(input.DisableApiStop),
+		Interruptible:         Interruptible(input),
 	}
 
 	// Create EC2 instance metadata
@@ -276,9 +348,21 @@ func (s *InstanceServiceImpl) RunInstance(input *ec2.RunInstancesInput) (*vm.VM,
 	if input.KeyName != nil {
 		ec2Instance.SetKeyName(*input.KeyName)
 	}
-	ec2Instance.SetLaunchTime(time.Now())
+	if len(instanceTags) > 0 {
+		ec2Instance.Tags = utils.MapToEC2Tags(instanceTags)
+	}
+	ec2Instance.SetLaunchTime(utils.Now())
 	ec2Instance.State.SetCode(0)
 	ec2Instance.State.SetName("pending")
+	ec2Instance.MetadataOptions = launchMetadataOptions(input)
+	ec2Instance.MaintenanceOptions = launchMaintenanceOptions(input)
+	// The gateway resolves the instance profile to its ARN before launch.
+	if input.IamInstanceProfile != nil && aws.StringValue(input.IamInstanceProfile.Arn) != "" {
+		ec2Instance.IamInstanceProfile = &ec2.IamInstanceProfile{Arn: input.IamInstanceProfile.Arn}
+	}
+	if instance.Interruptible {
+		ec2Instance.SetInstanceLifecycle(ec2.InstanceLifecycleTypeSpot)
+	}
 
 	// Store EC2 API metadata in VM for DescribeInstances compatibility
 	instance.RunInstancesInput = input
@@ -287,11 +371,98 @@ func (s *InstanceServiceImpl) RunInstance(input *ec2.RunInstancesInput) (*vm.VM,
 	return instance, ec2Instance, nil
 }
 
+// launchCPUCredits returns the credit state a burstable instance starts
+// with, in the requested mode or its type's default, holding the launch
+// credits for its vcpus so it can burst while it boots. It returns nil for
+// types that don't use CPU credits.
+func launchCPUCredits(input *ec2.RunInstancesInput, vcpus int64) (*vm.CPUCredits, error) {
+	mode, ok := instancetypes.DefaultCPUCredits(*input.InstanceType)
+	if !ok {
+		return nil, nil
+	}
+	if input.CreditSpecification != nil && input.CreditSpecification.CpuCredits != nil {
+		mode = *input.CreditSpecification.CpuCredits
+		if !instancetypes.ValidCPUCredits(mode) {
+			return nil, errors.New(awserrors.ErrorInvalidCpuCredits)
+		}
+	}
+	return &vm.CPUCredits{Mode: mode, Balance: float64(vcpus) * instancetypes.LaunchCreditsPerVCPU}, nil
+}
+
+// launchMetadataOptions returns the metadata options an instance starts
+// with: the endpoint is enabled, IMDSv1 is allowed and token responses
+// travel one hop, unless the request says otherwise.
+func launchMetadataOptions(input *ec2.RunInstancesInput) *ec2.InstanceMetadataOptionsResponse {
+	options := &ec2.InstanceMetadataOptionsResponse{
+		HttpEndpoint:            aws.String(ec2.InstanceMetadataEndpointStateEnabled),
+		HttpTokens:              aws.String(ec2.HttpTokensStateOptional),
+		HttpPutResponseHopLimit: aws.Int64(1),
+		State:                   aws.String(ec2.InstanceMetadataOptionsStateApplied),
+	}
+	if opts := input.MetadataOptions; opts != nil {
+		if opts.HttpEndpoint != nil {
+			options.HttpEndpoint = aws.String(*opts.HttpEndpoint)
+		}
+		if opts.HttpTokens != nil {
+			options.HttpTokens = aws.String(*opts.HttpTokens)
+		}
+		if opts.HttpPutResponseHopLimit != nil {
+			options.HttpPutResponseHopLimit = aws.Int64(*opts.HttpPutResponseHopLimit)
+		}
+	}
+	return options
+}
+
+// canPhoneHome reports whether an instance launched from input can reach
+// PhoneHomeURL. When it is the metadata service and the instance starts with
+// the endpoint disabled, no URL is injected and the instance status reads ok
+// as soon as it runs, rather than staying initializing.
+func (s *InstanceServiceImpl) canPhoneHome(input *ec2.RunInstancesInput, instanceID string) bool {
+	if s.PhoneHomeURL == "" {
+		return false
+	}
+	if s.PhoneHomeViaIMDS && aws.StringValue(launchMetadataOptions(input).HttpEndpoint) == ec2.InstanceMetadataEndpointStateDisabled {
+		slog.Info("Metadata endpoint disabled, boot completion won't be reported", "instanceId", instanceID)
+		return false
+	}
+	return true
+}
+
+// launchMaintenanceOptions returns the maintenance options an instance
+// starts with: the node restarts it after a crash unless the request
+// disables auto-recovery.
+func launchMaintenanceOptions(input *ec2.RunInstancesInput) *ec2.InstanceMaintenanceOptions {
+	autoRecovery := ec2.InstanceAutoRecoveryStateDefault
+	if input.MaintenanceOptions != nil && input.MaintenanceOptions.AutoRecovery != nil {
+		autoRecovery = *input.MaintenanceOptions.AutoRecovery
+	}
+	return &ec2.InstanceMaintenanceOptions{AutoRecovery: aws.String(autoRecovery)}
+}
+
+// Interruptible reports whether input launches interruptible instances:
+// those requested with the spot market type, which the cluster may reclaim
+// to make room for on-demand launches.
+func Interruptible(input *ec2.RunInstancesInput) bool {
+	return input.InstanceMarketOptions != nil && aws.StringValue(input.InstanceMarketOptions.MarketType) == ec2.MarketTypeSpot
+}
+
 func (s *InstanceServiceImpl) GenerateVolumes(input *ec2.RunInstancesInput, instance *vm.VM) ([]VolumeInfo, error) {
 	p := parseVolumeParams(input)
 
 	// Capture attach time for the root volume
-	attachTime := time.Now()
+	attachTime := utils.Now()
+
+	tags := utils.ExtractTags(input.TagSpecifications, "volume")
+	trim, err := vm.ParseTrim(tags[vm.TrimTag], s.config.VolumeTrimEnabled(p.volumeType))
+	if err != nil {
+		slog.Error("GenerateVolumes: invalid trim setting", "err", err)
+		return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	copyMode, err := vm.ParseCopyMode(tags[vm.CopyModeTag])
+	if err != nil {
+		slog.Error("GenerateVolumes: invalid copy mode", "err", err)
+		return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+	}
 
 	volumeConfig := viperblock.VolumeConfig{
 		VolumeMetadata: viperblock.VolumeMetadata{
@@ -304,6 +475,7 @@ func (s *InstanceServiceImpl) GenerateVolumes(input *ec2.RunInstancesInput, inst
 			SnapshotID:          p.snapshotId,
 			DeleteOnTermination: p.deleteOnTermination,
 			TenantID:            instance.AccountID,
+			Tags:                tags,
 		},
 	}
 
@@ -313,7 +485,7 @@ func (s *InstanceServiceImpl) GenerateVolumes(input *ec2.RunInstancesInput, inst
 	deleteOnTermination := p.deleteOnTermination
 
 	// Step 1: Create or validate root volume
-	err := s.prepareRootVolume(input, imageId, size, volumeConfig, instance, deleteOnTermination)
+	err = s.prepareRootVolume(input, imageId, size, volumeConfig, instance, deleteOnTermination, trim, copyMode == vm.CopyModeFull)
 	if err != nil {
 		return nil, err
 	}
@@ -347,6 +519,12 @@ func (s *InstanceServiceImpl) GenerateVolumes(input *ec2.RunInstancesInput, inst
 
 // newViperblock creates a viperblock instance with the service's S3/Predastore credentials.
 func (s *InstanceServiceImpl) newViperblock(volumeName string, size int, volumeConfig viperblock.VolumeConfig) (*viperblock.VB, error) {
+	vbconfig, cfg := s.viperblockConfig(volumeName, size, volumeConfig)
+	return viperblock.New(vbconfig, "s3", cfg)
+}
+
+// viperblockConfig returns the viperblock and S3 backend config for a volume.
+func (s *InstanceServiceImpl) viperblockConfig(volumeName string, size int, volumeConfig viperblock.VolumeConfig) (*viperblock.VB, s3.S3Config) {
 	cfg := s3.S3Config{
 		VolumeName: volumeName,
 		VolumeSize: utils.SafeIntToUint64(size),
@@ -365,11 +543,12 @@ func (s *InstanceServiceImpl) newViperblock(volumeName string, size int, volumeC
 		VolumeConfig: volumeConfig,
 	}
 
-	return viperblock.New(&vbconfig, "s3", cfg)
+	return &vbconfig, cfg
 }
 
-// prepareRootVolume handles creation/cloning of the root volume
-func (s *InstanceServiceImpl) prepareRootVolume(input *ec2.RunInstancesInput, imageId string, size int, volumeConfig viperblock.VolumeConfig, instance *vm.VM, deleteOnTermination bool) error {
+// prepareRootVolume handles creation/cloning of the root volume. A full copy
+// writes the AMI's blocks into the volume instead of reading them in place.
+func (s *InstanceServiceImpl) prepareRootVolume(input *ec2.RunInstancesInput, imageId string, size int, volumeConfig viperblock.VolumeConfig, instance *vm.VM, deleteOnTermination, trim, fullCopy bool) error {
 	vb, err := s.newViperblock(imageId, size, volumeConfig)
 	if err != nil {
 		slog.Error("Failed to connect to Viperblock store", "err", err)
@@ -392,7 +571,11 @@ func (s *InstanceServiceImpl) prepareRootVolume(input *ec2.RunInstancesInput, im
 	if err != nil {
 		slog.Info("Volume does not yet exist, creating from AMI ...")
 
-		err = s.cloneAMIToVolume(input, size, volumeConfig, vb)
+		if fullCopy {
+			err = s.copyAMIToVolume(input, imageId, size, volumeConfig)
+		} else {
+			err = s.cloneAMIToVolume(input, size, volumeConfig, vb)
+		}
 		if err != nil {
 			return err
 		}
@@ -402,42 +585,72 @@ func (s *InstanceServiceImpl) prepareRootVolume(input *ec2.RunInstancesInput, im
 	instance.EBSRequests.Mu.Lock()
 	instance.EBSRequests.Requests = append(instance.EBSRequests.Requests, spxtypes.EBSRequest{
 		Name:                imageId,
+		VolType:             volumeConfig.VolumeMetadata.VolumeType,
 		Boot:                true,
 		DeleteOnTermination: deleteOnTermination,
+		Trim:                trim,
+		IOPS:                int64(volumeConfig.VolumeMetadata.IOPS),
 	})
 	instance.EBSRequests.Mu.Unlock()
 
 	return nil
 }
 
-// cloneAMIToVolume creates a new volume from an AMI using snapshot-based
-// zero-copy cloning. The destination volume points at the AMI's frozen block
-// map and reads on-demand from the AMI's chunks (copy-on-write).
-func (s *InstanceServiceImpl) cloneAMIToVolume(input *ec2.RunInstancesInput, size int, volumeConfig viperblock.VolumeConfig, destVb *viperblock.VB) error {
-	// Load AMI state to get the snapshot ID
-	amiVb, err := s.newViperblock(*input.ImageId, size, volumeConfig)
+// amiSnapshotID returns the snapshot an AMI's blocks are frozen in.
+func (s *InstanceServiceImpl) amiSnapshotID(imageID string, size int, volumeConfig viperblock.VolumeConfig) (string, error) {
+	amiVb, err := s.newViperblock(imageID, size, volumeConfig)
 	if err != nil {
 		slog.Error("Failed to connect to Viperblock store for AMI", "err", err)
-		return errors.New(awserrors.ErrorServerInternal)
+		return "", errors.New(awserrors.ErrorServerInternal)
 	}
 
 	err = amiVb.Backend.Init()
 	if err != nil {
 		slog.Error("Could not connect to AMI Viperblock store", "err", err)
-		return errors.New(awserrors.ErrorServerInternal)
+		return "", errors.New(awserrors.ErrorServerInternal)
 	}
 
 	amiState, err := amiVb.LoadStateRequest("")
 	if err != nil {
-		slog.Error("Could not load state for AMI", "imageId", *input.ImageId, "err", err)
-		return errors.New(awserrors.ErrorInvalidAMIIDNotFound)
+		slog.Error("Could not load state for AMI", "imageId", imageID, "err", err)
+		return "", errors.New(awserrors.ErrorInvalidAMIIDNotFound)
 	}
 
 	snapshotID := amiState.VolumeConfig.AMIMetadata.SnapshotID
 	if snapshotID == "" {
-		slog.Error("AMI has no snapshot ID, cannot perform zero-copy clone", "imageId", *input.ImageId)
+		slog.Error("AMI has no snapshot ID, cannot clone", "imageId", imageID)
+		return "", errors.New(awserrors.ErrorServerInternal)
+	}
+	return snapshotID, nil
+}
+
+// copyAMIToVolume creates a new volume holding its own copy of every block
+// of an AMI, so it no longer depends on the AMI or its snapshot.
+func (s *InstanceServiceImpl) copyAMIToVolume(input *ec2.RunInstancesInput, volumeName string, size int, volumeConfig viperblock.VolumeConfig) error {
+	snapshotID, err := s.amiSnapshotID(*input.ImageId, size, volumeConfig)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Copying AMI via snapshot", "imageId", *input.ImageId, "snapshotID", snapshotID)
+
+	vbconfig, cfg := s.viperblockConfig(volumeName, size, volumeConfig)
+	if err := handlers_ec2_snapshot.CopyBlocks(snapshotID, vbconfig, cfg); err != nil {
+		slog.Error("Failed to copy AMI", "imageId", *input.ImageId, "snapshotID", snapshotID, "err", err)
 		return errors.New(awserrors.ErrorServerInternal)
 	}
+	return nil
+}
+
+// cloneAMIToVolume creates a new volume from an AMI using snapshot-based
+// zero-copy cloning. The destination volume points at the AMI's frozen block
+// map and reads on-demand from the AMI's chunks (copy-on-write).
+func (s *InstanceServiceImpl) cloneAMIToVolume(input *ec2.RunInstancesInput, size int, volumeConfig viperblock.VolumeConfig, destVb *viperblock.VB) error {
+	// Load AMI state to get the snapshot ID
+	snapshotID, err := s.amiSnapshotID(*input.ImageId, size, volumeConfig)
+	if err != nil {
+		return err
+	}
 
 	slog.Info("Cloning AMI via snapshot", "imageId", *input.ImageId, "snapshotID", snapshotID)
 
@@ -555,7 +768,10 @@ func (s *InstanceServiceImpl) prepareEFIVolume(imageId string, volumeConfig vipe
 // prepareCloudInitVolume creates cloud-init ISO with SSH keys and user data.
 // rootVolumeId is the per-instance root volume ID (not the AMI ID), ensuring
 // each instance gets its own cloud-init volume with fresh SSH keys and metadata.
-func (s *InstanceServiceImpl) prepareCloudInitVolume(input *ec2.RunInstancesInput, rootVolumeId string, volumeConfig viperblock.VolumeConfig, instance *vm.VM) error {
+func (s *InstanceServiceImpl) prepareCloudInitVolume(input *ec2.RunInstancesInput, rootVolumeId string, volumeConfig viperblock.VolumeConfig, instance *vm.VM) (err error) {
+	_, span := tracing.StartInstance(instance.ID, "cloud-init", true)
+	defer func() { tracing.End(span, err) }()
+
 	slog.Info("Creating cloud-init volume")
 
 	cloudInitVolumeName := fmt.Sprintf("%s-cloudinit", rootVolumeId)
@@ -639,7 +855,19 @@ func (s *InstanceServiceImpl) createCloudInitISO(input *ec2.RunInstancesInput, i
 	defer writer.Cleanup()
 
 	// Generate instance metadata
-	hostname := generateHostname(instance.ID)
+	hostnamePattern := ""
+	if s.config != nil {
+		hostnamePattern = s.config.Daemon.HostnamePattern
+	}
+	privateIP := ""
+	if instance.Instance != nil {
+		privateIP = aws.StringValue(instance.Instance.PrivateIpAddress)
+	}
+	hostname := guestHostname(instance.ID, utils.ExtractTags(input.TagSpecifications, "instance")["Name"], privateIP, hostnamePattern)
+	instance.Hostname = hostname
+	if s.config != nil {
+		instance.FQDN = s.config.Daemon.FQDN(hostname)
+	}
 
 	// Retrieve SSH pubkey from S3 — required for instance access.
 	// Password authentication is not supported; instances without a key
@@ -696,24 +924,34 @@ func (s *InstanceServiceImpl) createCloudInitISO(input *ec2.RunInstancesInput, i
 	}
 
 	userData := CloudInitData{
-		Username:  "ec2-user",
-		SSHKey:    string(sshKey),
-		Hostname:  hostname,
-		CACertPEM: caCertPEM,
+		Username:   "ec2-user",
+		SSHKey:     string(sshKey),
+		Hostname:   hostname,
+		FQDN:       instance.FQDN,
+		CACertPEM:  caCertPEM,
+		DNSServers: instance.DNSServers,
 	}
 
 	// Decode and classify user-data from RunInstances (base64-encoded).
+	// Formats cloud-init can't take merged into one cloud-config (MIME
+	// multi-part, #include, #cloud-config-archive) become extra parts.
+	var userParts []userDataPart
 	if input.UserData != nil && *input.UserData != "" {
 		decoded, decErr := base64.StdEncoding.DecodeString(*input.UserData)
 		if decErr != nil {
 			slog.Warn("Failed to decode user-data, ignoring", "err", decErr)
 		} else {
 			raw := string(decoded)
-			if after, ok := strings.CutPrefix(raw, "#cloud-config"); ok {
+			parts, partsErr := userDataParts(raw)
+			switch {
+			case partsErr != nil:
+				slog.Warn("Failed to parse multi-part user-data, ignoring", "err", partsErr)
+			case parts != nil:
+				userParts = parts
+			case strings.HasPrefix(raw, "#cloud-config"):
 				// Strip the #cloud-config header — the template already has it
-				stripped := after
-				userData.UserDataCloudConfig = strings.TrimSpace(stripped)
-			} else {
+				userData.UserDataCloudConfig = strings.TrimSpace(strings.TrimPrefix(raw, "#cloud-config"))
+			default:
 				// Script — indent each line by 4 spaces for YAML write_files block
 				var indented strings.Builder
 				for line := range strings.SplitSeq(raw, "\n") {
@@ -724,6 +962,13 @@ func (s *InstanceServiceImpl) createCloudInitISO(input *ec2.RunInstancesInput, i
 		}
 	}
 
+	// Inject phone_home unless the user's cloud-config already sets it — a
+	// duplicate top-level key would make the whole document invalid.
+	if s.canPhoneHome(input, instance.ID) && !definesPhoneHome(userData.UserDataCloudConfig) && !partsDefinePhoneHome(userParts) {
+		instance.PhoneHomeToken = rand.Text()
+		userData.PhoneHomeURL = fmt.Sprintf("%s/%s/%s", s.PhoneHomeURL, instance.ID, instance.PhoneHomeToken)
+	}
+
 	var buf bytes.Buffer
 	t := template.Must(template.New("cloud-init").Parse(cloudInitUserDataTemplate))
 
@@ -733,7 +978,15 @@ func (s *InstanceServiceImpl) createCloudInitISO(input *ec2.RunInstancesInput, i
 	}
 
 	// Add user-data
-	err = writer.AddFile(&buf, "user-data")
+	userDataFile := buf.Bytes()
+	if userParts != nil {
+		userDataFile, err = multipartUserData(buf.Bytes(), userParts)
+		if err != nil {
+			slog.Error("failed to build multi-part user-data", "err", err)
+			return errors.New(awserrors.ErrorServerInternal)
+		}
+	}
+	err = writer.AddFile(bytes.NewReader(userDataFile), "user-data")
 	if err != nil {
 		slog.Error("failed to add file", "err", err)
 		return errors.New(awserrors.ErrorServerInternal)
@@ -743,6 +996,7 @@ func (s *InstanceServiceImpl) createCloudInitISO(input *ec2.RunInstancesInput, i
 	metaData := CloudInitMetaData{
 		InstanceID: instance.ID,
 		Hostname:   hostname,
+		VirtioRNG:  instance.VirtioRNG,
 	}
 
 	t = template.Must(template.New("meta-data").Parse(cloudInitMetaTemplate))
@@ -766,7 +1020,7 @@ func (s *InstanceServiceImpl) createCloudInitISO(input *ec2.RunInstancesInput, i
 	for _, extra := range instance.ExtraENIs {
 		extraMACs = append(extraMACs, extra.ENIMac)
 	}
-	networkConfig := generateNetworkConfig(instance.ENIMac, instance.DevMAC, instance.MgmtMAC, instance.MgmtIP, extraMACs)
+	networkConfig := generateNetworkConfig(instance.ENIMac, instance.DevMAC, instance.MgmtMAC, instance.MgmtIP, extraMACs, instance.DNSServers)
 	err = writer.AddFile(strings.NewReader(networkConfig), "network-config")
 	if err != nil {
 		slog.Error("failed to add network-config file", "err", err)
@@ -844,3 +1098,50 @@ func generateHostname(instanceID string) string {
 	}
 	return "spinifex-vm-unknown"
 }
+
+// definesPhoneHome reports whether user cloud-config sets phone_home itself.
+func definesPhoneHome(cloudConfig string) bool {
+	for line := range strings.SplitSeq(cloudConfig, "\n") {
+		if strings.HasPrefix(line, "phone_home:") {
+			return true
+		}
+	}
+	return false
+}
+
+// guestHostname picks the guest hostname: the Name tag when it yields a valid
+// DNS label, else pattern with "{ip}" and "{id}" expanded. Patterns needing an
+// IP the instance doesn't have yet fall back to generateHostname.
+func guestHostname(instanceID, nameTag, privateIP, pattern string) string {
+	if name := hostnameLabel(nameTag); name != "" {
+		return name
+	}
+	if pattern == "" || (strings.Contains(pattern, "{ip}") && privateIP == "") {
+		return generateHostname(instanceID)
+	}
+	idPart := strings.TrimPrefix(generateHostname(instanceID), "spinifex-vm-")
+	expanded := strings.NewReplacer("{ip}", strings.ReplaceAll(privateIP, ".", "-"), "{id}", idPart).Replace(pattern)
+	if name := hostnameLabel(expanded); name != "" {
+		return name
+	}
+	return generateHostname(instanceID)
+}
+
+// hostnameLabel lowercases s and squashes anything outside [a-z0-9-] into
+// single hyphens, trimmed and capped at the 63-byte DNS label limit.
+func hostnameLabel(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case b.Len() > 0 && !strings.HasSuffix(b.String(), "-"):
+			b.WriteByte('-')
+		}
+	}
+	label := b.String()
+	if len(label) > 63 {
+		label = label[:63]
+	}
+	return strings.Trim(label, "-")
+}
@@ -6,10 +6,14 @@ import (
 	"strings"
 	"testing"
 	"text/template"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/config"
+	"github.com/mulgadc/spinifex/spinifex/instancetypes"
+	"github.com/mulgadc/spinifex/spinifex/testutil"
 	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/mulgadc/spinifex/spinifex/vm"
 	"github.com/stretchr/testify/assert"
@@ -52,6 +56,63 @@ func TestGenerateHostname(t *testing.T) {
 	}
 }
 
+func TestGuestHostname(t *testing.T) {
+	tests := []struct {
+		name      string
+		nameTag   string
+		privateIP string
+		pattern   string
+		want      string
+	}{
+		{"Default", "", "10.0.0.5", "", "spinifex-vm-01234567"},
+		{"IPPattern", "", "10.0.0.5", "ip-{ip}", "ip-10-0-0-5"},
+		{"IDPattern", "", "", "web-{id}", "web-01234567"},
+		{"IPPatternWithoutIP", "", "", "ip-{ip}", "spinifex-vm-01234567"},
+		{"NameTagWins", "web-1", "10.0.0.5", "ip-{ip}", "web-1"},
+		{"NameTagSanitized", "  My Web_Server.prod ", "", "", "my-web-server-prod"},
+		{"NameTagUnusable", "!!!", "10.0.0.5", "ip-{ip}", "ip-10-0-0-5"},
+		{"NameTagTruncated", strings.Repeat("a", 70), "", "", strings.Repeat("a", 63)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, guestHostname("i-0123456789abcdef0", tt.nameTag, tt.privateIP, tt.pattern))
+		})
+	}
+}
+
+func TestCloudInitHostnameAndDNS(t *testing.T) {
+	hostname := guestHostname("i-0123456789abcdef0", "", "10.0.0.5", "ip-{ip}")
+	dns := []string{"10.0.0.2", "1.1.1.1"}
+
+	tmpl := template.Must(template.New("cloud-init").Parse(cloudInitUserDataTemplate))
+	var buf bytes.Buffer
+	require.NoError(t, tmpl.Execute(&buf, CloudInitData{Username: "ec2-user", Hostname: hostname, DNSServers: dns}))
+	userData := buf.String()
+	assert.Contains(t, userData, "preserve_hostname: false\nhostname: ip-10-0-0-5\nmanage_etc_hosts: true\n")
+	assert.Contains(t, userData, "manage_resolv_conf: true\nresolv_conf:\n  nameservers:\n    - 10.0.0.2\n    - 1.1.1.1\n")
+
+	tmpl = template.Must(template.New("meta-data").Parse(cloudInitMetaTemplate))
+	buf.Reset()
+	require.NoError(t, tmpl.Execute(&buf, CloudInitMetaData{InstanceID: "i-0123456789abcdef0", Hostname: hostname}))
+	assert.Contains(t, buf.String(), "local-hostname: ip-10-0-0-5\n")
+
+	netCfg := generateNetworkConfig("02:00:00:aa:bb:cc", "", "", "", nil, dns)
+	assert.Contains(t, netCfg, "      nameservers:\n        addresses: [10.0.0.2, 1.1.1.1]\n")
+
+	// Without DHCP DNS (non-VPC) resolv.conf is left to the guest
+	buf.Reset()
+	tmpl = template.Must(template.New("cloud-init").Parse(cloudInitUserDataTemplate))
+	require.NoError(t, tmpl.Execute(&buf, CloudInitData{Username: "ec2-user", Hostname: hostname}))
+	assert.NotContains(t, buf.String(), "resolv_conf")
+	assert.NotContains(t, buf.String(), "fqdn:")
+	assert.NotContains(t, generateNetworkConfig("", "", "", "", nil, dns), "nameservers")
+
+	// A DNS zone adds the FQDN, which manage_etc_hosts maps to the hostname
+	buf.Reset()
+	require.NoError(t, tmpl.Execute(&buf, CloudInitData{Username: "ec2-user", Hostname: hostname, FQDN: hostname + ".compute.internal"}))
+	assert.Contains(t, buf.String(), "hostname: ip-10-0-0-5\nfqdn: ip-10-0-0-5.compute.internal\nmanage_etc_hosts: true\n")
+}
+
 func TestRunInstance_Success(t *testing.T) {
 	instanceTypes := map[string]*ec2.InstanceTypeInfo{
 		"t3.micro": {InstanceType: aws.String("t3.micro")},
@@ -91,6 +152,67 @@ func TestRunInstance_Success(t *testing.T) {
 	assert.NotNil(t, ec2Instance.LaunchTime)
 }
 
+func TestRunInstance_LaunchTime(t *testing.T) {
+	launched := time.Date(2026, 5, 1, 9, 30, 0, 0, time.UTC)
+	t.Cleanup(utils.SetClock(testutil.NewFakeClock(launched)))
+	svc := &InstanceServiceImpl{instanceTypes: map[string]*ec2.InstanceTypeInfo{
+		"t3.micro": {InstanceType: aws.String("t3.micro")},
+	}}
+
+	_, ec2Instance, err := svc.RunInstance(&ec2.RunInstancesInput{
+		ImageId:      aws.String("ami-012345"),
+		InstanceType: aws.String("t3.micro"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, launched, aws.TimeValue(ec2Instance.LaunchTime))
+}
+
+func TestRunInstance_Interruptible(t *testing.T) {
+	svc := &InstanceServiceImpl{instanceTypes: map[string]*ec2.InstanceTypeInfo{
+		"t3.micro": {InstanceType: aws.String("t3.micro")},
+	}}
+
+	instance, ec2Instance, err := svc.RunInstance(&ec2.RunInstancesInput{
+		ImageId:      aws.String("ami-012345"),
+		InstanceType: aws.String("t3.micro"),
+	})
+	require.NoError(t, err)
+	assert.False(t, instance.Interruptible)
+	assert.Nil(t, ec2Instance.InstanceLifecycle)
+
+	instance, ec2Instance, err = svc.RunInstance(&ec2.RunInstancesInput{
+		ImageId:               aws.String("ami-012345"),
+		InstanceType:          aws.String("t3.micro"),
+		InstanceMarketOptions: &ec2.InstanceMarketOptionsRequest{MarketType: aws.String(ec2.MarketTypeSpot)},
+	})
+	require.NoError(t, err)
+	assert.True(t, instance.Interruptible)
+	assert.Equal(t, ec2.InstanceLifecycleTypeSpot, aws.StringValue(ec2Instance.InstanceLifecycle))
+}
+
+func TestRunInstance_LaunchCPUCredits(t *testing.T) {
+	svc := &InstanceServiceImpl{instanceTypes: map[string]*ec2.InstanceTypeInfo{
+		"t2.micro": {InstanceType: aws.String("t2.micro"), VCpuInfo: &ec2.VCpuInfo{DefaultVCpus: aws.Int64(2)}},
+		"m5.large": {InstanceType: aws.String("m5.large"), VCpuInfo: &ec2.VCpuInfo{DefaultVCpus: aws.Int64(2)}},
+	}}
+
+	instance, _, err := svc.RunInstance(&ec2.RunInstancesInput{
+		ImageId:      aws.String("ami-012345"),
+		InstanceType: aws.String("t2.micro"),
+	})
+	require.NoError(t, err)
+	require.NotNil(t, instance.CPUCredits)
+	assert.Equal(t, instancetypes.CPUCreditsStandard, instance.CPUCredits.Mode)
+	assert.Equal(t, 60.0, instance.CPUCredits.Balance)
+
+	instance, _, err = svc.RunInstance(&ec2.RunInstancesInput{
+		ImageId:      aws.String("ami-012345"),
+		InstanceType: aws.String("m5.large"),
+	})
+	require.NoError(t, err)
+	assert.Nil(t, instance.CPUCredits)
+}
+
 func TestRunInstance_NoKeyName(t *testing.T) {
 	instanceTypes := map[string]*ec2.InstanceTypeInfo{
 		"t3.micro": {InstanceType: aws.String("t3.micro")},
@@ -217,6 +339,19 @@ func TestCloudInitTemplateRendering(t *testing.T) {
 				"MIIFazCCA1OgAwIBAgIUAbcdefg1234567890ABCDEFG=",
 			},
 		},
+		{
+			name: "With phone-home URL",
+			data: CloudInitData{
+				Username:     "ec2-user",
+				Hostname:     "spinifex-vm-phone",
+				PhoneHomeURL: "https://10.0.0.1:9999/phone-home/i-abc/tok",
+			},
+			contains: []string{
+				"phone_home:",
+				"url: https://10.0.0.1:9999/phone-home/i-abc/tok",
+				"post: [instance_id]",
+			},
+		},
 		{
 			name: "Without CA certificate PEM",
 			data: CloudInitData{
@@ -231,6 +366,7 @@ func TestCloudInitTemplateRendering(t *testing.T) {
 			notContains: []string{
 				"ca_certs:",
 				"trusted:",
+				"phone_home:",
 			},
 		},
 	}
@@ -253,6 +389,31 @@ func TestCloudInitTemplateRendering(t *testing.T) {
 	}
 }
 
+func TestDefinesPhoneHome(t *testing.T) {
+	assert.False(t, definesPhoneHome(""))
+	assert.False(t, definesPhoneHome("packages:\n  - nginx"))
+	assert.False(t, definesPhoneHome("runcmd:\n  - echo phone_home: x"))
+	assert.True(t, definesPhoneHome("packages:\n  - nginx\nphone_home:\n  url: http://example.com"))
+}
+
+func TestCanPhoneHome(t *testing.T) {
+	disabled := &ec2.RunInstancesInput{MetadataOptions: &ec2.InstanceMetadataOptionsRequest{
+		HttpEndpoint: aws.String(ec2.InstanceMetadataEndpointStateDisabled),
+	}}
+
+	svc := &InstanceServiceImpl{}
+	assert.False(t, svc.canPhoneHome(&ec2.RunInstancesInput{}, "i-abc"), "no URL")
+
+	svc.PhoneHomeURL = "https://10.0.0.1:9999/phone-home"
+	assert.True(t, svc.canPhoneHome(&ec2.RunInstancesInput{}, "i-abc"))
+	assert.True(t, svc.canPhoneHome(disabled, "i-abc"), "the gateway doesn't need the metadata endpoint")
+
+	svc.PhoneHomeURL = "http://169.254.169.254/phone-home"
+	svc.PhoneHomeViaIMDS = true
+	assert.True(t, svc.canPhoneHome(&ec2.RunInstancesInput{}, "i-abc"))
+	assert.False(t, svc.canPhoneHome(disabled, "i-abc"), "metadata endpoint disabled")
+}
+
 func TestCloudInitMetaTemplateRendering(t *testing.T) {
 	data := CloudInitMetaData{
 		InstanceID: "i-0123456789abcdef0",
@@ -269,6 +430,12 @@ func TestCloudInitMetaTemplateRendering(t *testing.T) {
 	assert.Contains(t, rendered, "spinifex-vm-01234567")
 	assert.Contains(t, rendered, "instance-id:")
 	assert.Contains(t, rendered, "local-hostname:")
+	assert.Contains(t, rendered, "virtio-rng: false")
+
+	data.VirtioRNG = true
+	buf.Reset()
+	require.NoError(t, tmpl.Execute(&buf, data))
+	assert.Contains(t, buf.String(), "virtio-rng: true")
 }
 
 // TestCloudInitVolumeNamePerInstance verifies that AMI-based launches produce
@@ -413,7 +580,7 @@ func TestMockInstanceService(t *testing.T) {
 
 func TestCloudInitNetworkConfigWildcard(t *testing.T) {
 	// No MACs → wildcard config (non-VPC or VPC without DEV_NETWORKING)
-	cfg := generateNetworkConfig("", "", "", "", nil)
+	cfg := generateNetworkConfig("", "", "", "", nil, nil)
 	assert.Contains(t, cfg, "version: 2")
 	assert.Contains(t, cfg, "dhcp4: true")
 	assert.Contains(t, cfg, "dhcp-identifier: mac")
@@ -425,7 +592,7 @@ func TestCloudInitNetworkConfigDualNIC(t *testing.T) {
 	eniMAC := "02:00:00:61:ef:c2"
 	devMAC := "02:de:00:60:83:0d"
 
-	cfg := generateNetworkConfig(eniMAC, devMAC, "", "", nil)
+	cfg := generateNetworkConfig(eniMAC, devMAC, "", "", nil, nil)
 
 	// Both MACs present in config
 	assert.Contains(t, cfg, eniMAC)
@@ -445,12 +612,12 @@ func TestCloudInitNetworkConfigDualNIC(t *testing.T) {
 
 func TestCloudInitNetworkConfigPartialMAC(t *testing.T) {
 	// Only ENI MAC (VPC without dev) → per-interface config with VPC NIC only
-	cfg := generateNetworkConfig("02:00:00:61:ef:c2", "", "", "", nil)
+	cfg := generateNetworkConfig("02:00:00:61:ef:c2", "", "", "", nil, nil)
 	assert.Contains(t, cfg, "vpc0:")
 	assert.NotContains(t, cfg, "dev0:")
 
 	// Only dev MAC (shouldn't happen, but defensive) → wildcard
-	cfg = generateNetworkConfig("", "02:de:00:60:83:0d", "", "", nil)
+	cfg = generateNetworkConfig("", "02:de:00:60:83:0d", "", "", nil, nil)
 	assert.Contains(t, cfg, `name: "e*"`)
 	assert.NotContains(t, cfg, "use-routes")
 }
@@ -461,7 +628,7 @@ func TestCloudInitNetworkConfigMultiVPCNICs(t *testing.T) {
 		"02:00:00:bb:bb:bb",
 		"02:00:00:cc:cc:cc",
 	}
-	cfg := generateNetworkConfig("02:00:00:aa:aa:aa", "", "", "", extras)
+	cfg := generateNetworkConfig("02:00:00:aa:aa:aa", "", "", "", extras, nil)
 
 	assert.Contains(t, cfg, "vpc0:")
 	assert.Contains(t, cfg, "vpc1:")
@@ -480,7 +647,7 @@ func TestCloudInitNetworkConfigMultiVPCNICs(t *testing.T) {
 func TestCloudInitNetworkConfigEmptyExtraMACSkipped(t *testing.T) {
 	// Empty strings inside the extras slice are ignored rather than producing
 	// a malformed ethernets block.
-	cfg := generateNetworkConfig("02:00:00:aa:aa:aa", "", "", "", []string{""})
+	cfg := generateNetworkConfig("02:00:00:aa:aa:aa", "", "", "", []string{""}, nil)
 	assert.Contains(t, cfg, "vpc0:")
 	assert.NotContains(t, cfg, "vpc1:")
 }
@@ -505,12 +672,95 @@ func TestRunInstance_WithTags(t *testing.T) {
 		},
 	}
 
-	instance, _, err := svc.RunInstance(input)
+	instance, ec2Instance, err := svc.RunInstance(input)
 	require.NoError(t, err)
 	// Tags are stored in RunInstancesInput which is preserved on the VM
 	assert.Equal(t, input, instance.RunInstancesInput)
 	assert.Len(t, input.TagSpecifications, 1)
 	assert.Len(t, input.TagSpecifications[0].Tags, 2)
+	// and reported on the instance for DescribeInstances
+	assert.ElementsMatch(t, input.TagSpecifications[0].Tags, ec2Instance.Tags)
+}
+
+func TestRunInstance_WatchdogActionTag(t *testing.T) {
+	svc := &InstanceServiceImpl{instanceTypes: map[string]*ec2.InstanceTypeInfo{
+		"t3.micro": {InstanceType: aws.String("t3.micro")},
+	}}
+
+	input := func(action string) *ec2.RunInstancesInput {
+		return &ec2.RunInstancesInput{
+			ImageId:      aws.String("ami-012345"),
+			InstanceType: aws.String("t3.micro"),
+			TagSpecifications: []*ec2.TagSpecification{{
+				ResourceType: aws.String("instance"),
+				Tags:         []*ec2.Tag{{Key: aws.String(vm.WatchdogActionTag), Value: aws.String(action)}},
+			}},
+		}
+	}
+
+	instance, _, err := svc.RunInstance(input(vm.WatchdogPoweroff))
+	require.NoError(t, err)
+	assert.Equal(t, vm.WatchdogPoweroff, instance.WatchdogAction)
+
+	_, _, err = svc.RunInstance(input("explode"))
+	assert.EqualError(t, err, awserrors.ErrorInvalidParameterValue)
+
+	// No tag → no watchdog
+	instance, _, err = svc.RunInstance(&ec2.RunInstancesInput{
+		ImageId:      aws.String("ami-012345"),
+		InstanceType: aws.String("t3.micro"),
+	})
+	require.NoError(t, err)
+	assert.Empty(t, instance.WatchdogAction)
+}
+
+func TestRunInstance_QEMUOptionsTag(t *testing.T) {
+	svc := &InstanceServiceImpl{instanceTypes: map[string]*ec2.InstanceTypeInfo{
+		"t3.micro": {InstanceType: aws.String("t3.micro")},
+	}}
+
+	input := func(options string) *ec2.RunInstancesInput {
+		return &ec2.RunInstancesInput{
+			ImageId:      aws.String("ami-012345"),
+			InstanceType: aws.String("t3.micro"),
+			TagSpecifications: []*ec2.TagSpecification{{
+				ResourceType: aws.String("instance"),
+				Tags:         []*ec2.Tag{{Key: aws.String(vm.QEMUOptionsTag), Value: aws.String(options)}},
+			}},
+		}
+	}
+
+	instance, _, err := svc.RunInstance(input("-cpu +avx2 -device virtio-balloon-pci"))
+	require.NoError(t, err)
+	assert.Equal(t, []vm.QEMUOption{
+		{Flag: "-cpu", Value: "+avx2"},
+		{Flag: "-device", Value: "virtio-balloon-pci"},
+	}, instance.QEMUOptions)
+
+	for _, denied := range []string{"-drive file=/etc/shadow", "-device vfio-pci,host=01:00.0", "-device usb-tablet,chardev=c0"} {
+		_, _, err = svc.RunInstance(input(denied))
+		assert.EqualError(t, err, awserrors.ErrorInvalidParameterValue, denied)
+	}
+}
+
+func TestRunInstance_VirtioRNG(t *testing.T) {
+	instanceTypes := map[string]*ec2.InstanceTypeInfo{
+		"t3.micro": {InstanceType: aws.String("t3.micro")},
+	}
+	input := &ec2.RunInstancesInput{
+		ImageId:      aws.String("ami-012345"),
+		InstanceType: aws.String("t3.micro"),
+	}
+
+	svc := &InstanceServiceImpl{config: &config.Config{}, instanceTypes: instanceTypes}
+	instance, _, err := svc.RunInstance(input)
+	require.NoError(t, err)
+	assert.True(t, instance.VirtioRNG, "virtio-rng should default to enabled")
+
+	svc.config.Daemon.VirtioRNG = aws.Bool(false)
+	instance, _, err = svc.RunInstance(input)
+	require.NoError(t, err)
+	assert.False(t, instance.VirtioRNG)
 }
 
 func TestRunInstance_WithPlacement(t *testing.T) {
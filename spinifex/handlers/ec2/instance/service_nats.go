@@ -6,6 +6,7 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
 	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/nats-io/nats.go"
 )
@@ -26,6 +27,6 @@ func (s *NATSInstanceService) RunInstances(input *ec2.RunInstancesInput, account
 	if input == nil || input.InstanceType == nil {
 		return nil, fmt.Errorf("instance type is required")
 	}
-	topic := fmt.Sprintf("ec2.RunInstances.%s", aws.StringValue(input.InstanceType))
+	topic := subjects.RunInstances(aws.StringValue(input.InstanceType))
 	return utils.NATSRequest[ec2.Reservation](s.natsConn, topic, input, 5*time.Minute, accountID)
 }
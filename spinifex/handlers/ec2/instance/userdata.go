@@ -0,0 +1,173 @@
+package handlers_ec2_instance
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+)
+
+// MaxUserDataSize is the most user data an instance accepts, in bytes before
+// base64 encoding, as on AWS.
+const MaxUserDataSize = 16 * 1024
+
+// Content types cloud-init understands for the user data formats that can't
+// be merged into the generated cloud-config.
+const (
+	contentTypeCloudConfig        = "text/cloud-config"
+	contentTypeCloudConfigArchive = "text/cloud-config-archive"
+	contentTypeIncludeURL         = "text/x-include-url"
+	contentTypeIncludeOnceURL     = "text/x-include-once-url"
+)
+
+// ValidateUserData checks that encoded is valid base64 within
+// MaxUserDataSize and, for MIME multi-part archives, that the archive parses.
+func ValidateUserData(encoded string) error {
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return awserrors.WithDetail(awserrors.ErrorInvalidParameterValue, "Invalid BASE64 encoding of user data.")
+	}
+	if err := ValidateUserDataSize(len(decoded)); err != nil {
+		return err
+	}
+	if _, err := userDataParts(string(decoded)); err != nil {
+		return awserrors.WithDetail(awserrors.ErrorInvalidParameterValue, "Invalid MIME multi-part user data: "+err.Error())
+	}
+	return nil
+}
+
+// ValidateUserDataSize checks decoded user data of size bytes fits within
+// MaxUserDataSize.
+func ValidateUserDataSize(size int) error {
+	if size > MaxUserDataSize {
+		return awserrors.WithDetail(awserrors.ErrorInvalidParameterValue,
+			fmt.Sprintf("User data is limited to %d bytes.", MaxUserDataSize))
+	}
+	return nil
+}
+
+// userDataPart is one part of the multi-part user data handed to cloud-init.
+type userDataPart struct {
+	header textproto.MIMEHeader
+	body   []byte
+}
+
+// userDataParts returns the parts raw user data is passed to cloud-init as,
+// or nil for a plain cloud-config or script, which is merged into the
+// generated cloud-config instead. MIME multi-part archives contribute each
+// of their parts; #include and #cloud-config-archive payloads are a single
+// part of their own type.
+func userDataParts(raw string) ([]userDataPart, error) {
+	switch firstLine := strings.ToLower(strings.TrimSpace(strings.SplitN(raw, "\n", 2)[0])); {
+	case firstLine == "#cloud-config-archive":
+		return []userDataPart{newUserDataPart(contentTypeCloudConfigArchive, "user-data-archive", raw)}, nil
+	case strings.HasPrefix(firstLine, "#include-once"):
+		return []userDataPart{newUserDataPart(contentTypeIncludeOnceURL, "user-data-include", raw)}, nil
+	case strings.HasPrefix(firstLine, "#include"):
+		return []userDataPart{newUserDataPart(contentTypeIncludeURL, "user-data-include", raw)}, nil
+	case strings.HasPrefix(firstLine, "content-type:"), strings.HasPrefix(firstLine, "mime-version:"):
+		return mimeUserDataParts(raw)
+	}
+	return nil, nil
+}
+
+func newUserDataPart(contentType, filename, body string) userDataPart {
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Type", contentType+`; charset="utf-8"`)
+	header.Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	return userDataPart{header: header, body: []byte(body)}
+}
+
+// mimeUserDataParts splits a MIME multi-part archive into its parts, keeping
+// each part's headers and encoded body as given.
+func mimeUserDataParts(raw string) ([]userDataPart, error) {
+	reader := textproto.NewReader(bufio.NewReader(strings.NewReader(raw)))
+	header, err := reader.ReadMIMEHeader()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("read headers: %w", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return nil, fmt.Errorf("content type: %w", err)
+	}
+	if !strings.HasPrefix(mediaType, "multipart/") {
+		// A single MIME part.
+		body, err := io.ReadAll(reader.R)
+		if err != nil {
+			return nil, err
+		}
+		return []userDataPart{{header: header, body: body}}, nil
+	}
+	if params["boundary"] == "" {
+		return nil, errors.New("multipart content type has no boundary")
+	}
+
+	var parts []userDataPart
+	mr := multipart.NewReader(reader.R, params["boundary"])
+	for {
+		part, err := mr.NextRawPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, userDataPart{header: part.Header, body: body})
+	}
+	if len(parts) == 0 {
+		return nil, errors.New("multipart archive has no parts")
+	}
+	return parts, nil
+}
+
+// partsDefinePhoneHome reports whether any plain cloud-config part sets
+// phone_home itself. cloud-init merges later parts over earlier ones, so the
+// user's setting would replace the generated one.
+func partsDefinePhoneHome(parts []userDataPart) bool {
+	for _, part := range parts {
+		mediaType, _, err := mime.ParseMediaType(part.header.Get("Content-Type"))
+		if err != nil || mediaType != contentTypeCloudConfig {
+			continue
+		}
+		if definesPhoneHome(string(part.body)) {
+			return true
+		}
+	}
+	return false
+}
+
+// multipartUserData builds a MIME multi-part archive from the generated
+// cloud-config followed by the user's parts. cloud-init merges the
+// cloud-config parts in order.
+func multipartUserData(cloudConfig []byte, parts []userDataPart) ([]byte, error) {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%q\r\nMIME-Version: 1.0\r\n\r\n", mw.Boundary())
+
+	parts = append([]userDataPart{newUserDataPart(contentTypeCloudConfig, "spinifex.cfg", string(cloudConfig))}, parts...)
+	for _, part := range parts {
+		w, err := mw.CreatePart(part.header)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,139 @@
+package handlers_ec2_instance
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testMultipartUserData = `Content-Type: multipart/mixed; boundary="==BOUNDARY=="
+MIME-Version: 1.0
+
+--==BOUNDARY==
+Content-Type: text/cloud-config; charset="us-ascii"
+
+packages:
+  - nginx
+
+--==BOUNDARY==
+Content-Type: text/x-shellscript; charset="us-ascii"
+
+#!/bin/sh
+echo hello
+--==BOUNDARY==--
+`
+
+func TestValidateUserData(t *testing.T) {
+	encode := func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) }
+
+	tests := []struct {
+		name    string
+		encoded string
+		detail  string
+	}{
+		{name: "Script", encoded: encode("#!/bin/sh\necho hi\n")},
+		{name: "AtLimit", encoded: encode(strings.Repeat("a", MaxUserDataSize))},
+		{name: "Multipart", encoded: encode(testMultipartUserData)},
+		{name: "NotBase64", encoded: "#!/bin/sh", detail: "BASE64"},
+		{name: "TooLarge", encoded: encode(strings.Repeat("a", MaxUserDataSize+1)), detail: "16384 bytes"},
+		{name: "MultipartWithoutBoundary", encoded: encode("Content-Type: multipart/mixed\n\nbody\n"), detail: "MIME"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateUserData(tt.encoded)
+			if tt.detail == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Equal(t, awserrors.ErrorInvalidParameterValue, err.Error())
+			assert.Contains(t, awserrors.Detail(err), tt.detail)
+		})
+	}
+}
+
+func TestUserDataParts(t *testing.T) {
+	tests := []struct {
+		name  string
+		raw   string
+		types []string
+	}{
+		{name: "CloudConfig", raw: "#cloud-config\npackages: [nginx]\n"},
+		{name: "Script", raw: "#!/bin/sh\necho hi\n"},
+		{name: "Archive", raw: "#cloud-config-archive\n- type: text/cloud-config\n  content: {}\n", types: []string{contentTypeCloudConfigArchive}},
+		{name: "Include", raw: "#include\nhttps://example.com/user-data\n", types: []string{contentTypeIncludeURL}},
+		{name: "IncludeOnce", raw: "#include-once\nhttps://example.com/user-data\n", types: []string{contentTypeIncludeOnceURL}},
+		{name: "Multipart", raw: testMultipartUserData, types: []string{"text/cloud-config", "text/x-shellscript"}},
+		{name: "SingleMIMEPart", raw: "Content-Type: text/x-shellscript\n\n#!/bin/sh\n", types: []string{"text/x-shellscript"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts, err := userDataParts(tt.raw)
+			require.NoError(t, err)
+			var types []string
+			for _, part := range parts {
+				mediaType, _, err := mime.ParseMediaType(part.header.Get("Content-Type"))
+				require.NoError(t, err)
+				types = append(types, mediaType)
+			}
+			assert.Equal(t, tt.types, types)
+		})
+	}
+}
+
+func TestMultipartUserData(t *testing.T) {
+	parts, err := userDataParts(testMultipartUserData)
+	require.NoError(t, err)
+
+	out, err := multipartUserData([]byte("#cloud-config\nhostname: web\n"), parts)
+	require.NoError(t, err)
+
+	reader := textproto.NewReader(bufio.NewReader(strings.NewReader(string(out))))
+	header, err := reader.ReadMIMEHeader()
+	require.NoError(t, err)
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	require.NoError(t, err)
+	assert.Equal(t, "multipart/mixed", mediaType)
+
+	var types, bodies []string
+	mr := multipart.NewReader(reader.R, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		body, err := io.ReadAll(part)
+		require.NoError(t, err)
+		mediaType, _, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		require.NoError(t, err)
+		types = append(types, mediaType)
+		bodies = append(bodies, string(body))
+	}
+
+	// The generated cloud-config comes first so the user's parts merge over it.
+	assert.Equal(t, []string{"text/cloud-config", "text/cloud-config", "text/x-shellscript"}, types)
+	assert.Contains(t, bodies[0], "hostname: web")
+	assert.Contains(t, bodies[1], "nginx")
+	assert.Contains(t, bodies[2], "echo hello")
+}
+
+func TestPartsDefinePhoneHome(t *testing.T) {
+	parts, err := userDataParts(testMultipartUserData)
+	require.NoError(t, err)
+	assert.False(t, partsDefinePhoneHome(parts))
+
+	parts, err = userDataParts(strings.Replace(testMultipartUserData, "packages:", "phone_home:\n  url: http://x\npackages:", 1))
+	require.NoError(t, err)
+	assert.True(t, partsDefinePhoneHome(parts))
+}
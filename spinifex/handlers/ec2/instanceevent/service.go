@@ -0,0 +1,38 @@
+package handlers_ec2_instanceevent
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// InstanceEventService defines the interface for scheduled instance event operations
+type InstanceEventService interface {
+	ScheduleInstanceEvent(input *ScheduleInstanceEventInput, accountID string) (*ec2.InstanceStatusEvent, error)
+	DescribeInstanceEvents(input *DescribeInstanceEventsInput, accountID string) (*DescribeInstanceEventsOutput, error)
+	ModifyInstanceEventStartTime(input *ec2.ModifyInstanceEventStartTimeInput, accountID string) (*ec2.ModifyInstanceEventStartTimeOutput, error)
+}
+
+// ScheduleInstanceEventInput posts a maintenance event against an instance.
+// accountID on the service call is the instance owner, not the scheduler.
+type ScheduleInstanceEventInput struct {
+	InstanceID  string    `json:"instance_id"`
+	Code        string    `json:"code"` // ec2.EventCodeInstanceReboot etc
+	Description string    `json:"description,omitempty"`
+	NotBefore   time.Time `json:"not_before"`
+	// NotBeforeDeadline is the latest start time the owner may reschedule to.
+	// Zero means the start time cannot be changed.
+	NotBeforeDeadline time.Time `json:"not_before_deadline,omitzero"`
+}
+
+// DescribeInstanceEventsInput lists events for the given instances, or for
+// every instance the caller owns when InstanceIDs is empty.
+type DescribeInstanceEventsInput struct {
+	InstanceIDs      []string `json:"instance_ids,omitempty"`
+	IncludeCompleted bool     `json:"include_completed,omitempty"`
+}
+
+// DescribeInstanceEventsOutput maps instance ID to its events, soonest first.
+type DescribeInstanceEventsOutput struct {
+	Events map[string][]*ec2.InstanceStatusEvent `json:"events"`
+}
@@ -0,0 +1,311 @@
+package handlers_ec2_instanceevent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/config"
+	"github.com/mulgadc/spinifex/spinifex/migrate"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+)
+
+// Ensure InstanceEventServiceImpl implements InstanceEventService
+var _ InstanceEventService = (*InstanceEventServiceImpl)(nil)
+
+const (
+	KVBucketInstanceEvents        = "spinifex-instance-events"
+	KVBucketInstanceEventsVersion = 1
+)
+
+// Event lifecycle states.
+const (
+	EventStateScheduled = "scheduled"
+	EventStateCompleted = "completed"
+	EventStateCanceled  = "canceled" // the instance was stopped or removed before the event ran
+)
+
+// eventDescriptions are the default descriptions for supported event codes.
+// Reboot codes reboot the instance; stop and retirement codes stop it.
+var eventDescriptions = map[string]string{
+	ec2.EventCodeInstanceReboot:     "The instance is scheduled for a reboot",
+	ec2.EventCodeSystemReboot:       "The instance is scheduled for a system reboot",
+	ec2.EventCodeInstanceStop:       "The instance is scheduled to be stopped",
+	ec2.EventCodeInstanceRetirement: "The instance is scheduled for retirement",
+}
+
+// IsRebootEvent reports whether code is executed as a reboot rather than a stop.
+func IsRebootEvent(code string) bool {
+	return code == ec2.EventCodeInstanceReboot || code == ec2.EventCodeSystemReboot
+}
+
+// InstanceEventRecord is a stored scheduled event.
+type InstanceEventRecord struct {
+	EventID           string    `json:"event_id"`
+	InstanceID        string    `json:"instance_id"`
+	AccountID         string    `json:"account_id"`
+	Code              string    `json:"code"`
+	Description       string    `json:"description"`
+	NotBefore         time.Time `json:"not_before"`
+	NotBeforeDeadline time.Time `json:"not_before_deadline,omitzero"`
+	State             string    `json:"state"`
+	CreatedAt         time.Time `json:"created_at"`
+	CompletedAt       time.Time `json:"completed_at,omitzero"`
+}
+
+// InstanceEventServiceImpl implements scheduled instance events with NATS JetStream persistence.
+type InstanceEventServiceImpl struct {
+	config *config.Config
+	kv     nats.KeyValue
+}
+
+// NewInstanceEventServiceImplWithNATS creates an instance event service with NATS JetStream.
+func NewInstanceEventServiceImplWithNATS(cfg *config.Config, natsConn *nats.Conn) (*InstanceEventServiceImpl, error) {
+	js, err := natsConn.JetStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get JetStream context: %w", err)
+	}
+
+	kv, err := utils.GetOrCreateKVBucket(js, KVBucketInstanceEvents, 10)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create KV bucket %s: %w", KVBucketInstanceEvents, err)
+	}
+	if err := migrate.DefaultRegistry.RunKV(KVBucketInstanceEvents, kv, KVBucketInstanceEventsVersion); err != nil {
+		return nil, fmt.Errorf("migrate %s: %w", KVBucketInstanceEvents, err)
+	}
+
+	slog.Info("Instance event service initialized with JetStream KV", "bucket", KVBucketInstanceEvents)
+
+	return &InstanceEventServiceImpl{
+		config: cfg,
+		kv:     kv,
+	}, nil
+}
+
+func eventKey(accountID, eventID string) string {
+	return accountID + "." + eventID
+}
+
+// ScheduleInstanceEvent records a new scheduled event for an instance owned by accountID.
+func (s *InstanceEventServiceImpl) ScheduleInstanceEvent(input *ScheduleInstanceEventInput, accountID string) (*ec2.InstanceStatusEvent, error) {
+	if input.InstanceID == "" || input.Code == "" || input.NotBefore.IsZero() {
+		return nil, errors.New(awserrors.ErrorMissingParameter)
+	}
+	if !strings.HasPrefix(input.InstanceID, "i-") {
+		return nil, errors.New(awserrors.ErrorInvalidInstanceIDMalformed)
+	}
+	defaultDescription, ok := eventDescriptions[input.Code]
+	if !ok {
+		return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if !input.NotBeforeDeadline.IsZero() && input.NotBeforeDeadline.Before(input.NotBefore) {
+		return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+
+	record := InstanceEventRecord{
+		EventID:           utils.GenerateResourceID("instance-event"),
+		InstanceID:        input.InstanceID,
+		AccountID:         accountID,
+		Code:              input.Code,
+		Description:       input.Description,
+		NotBefore:         input.NotBefore.UTC(),
+		NotBeforeDeadline: input.NotBeforeDeadline.UTC(),
+		State:             EventStateScheduled,
+		CreatedAt:         time.Now().UTC(),
+	}
+	if record.Description == "" {
+		record.Description = defaultDescription
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+	if _, err := s.kv.Create(eventKey(accountID, record.EventID), data); err != nil {
+		slog.Error("Failed to store instance event", "eventId", record.EventID, "err", err)
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+
+	slog.Info("Scheduled instance event", "eventId", record.EventID, "instanceId", record.InstanceID,
+		"code", record.Code, "notBefore", record.NotBefore)
+	return record.toEC2(), nil
+}
+
+// DescribeInstanceEvents returns the caller's events grouped by instance.
+func (s *InstanceEventServiceImpl) DescribeInstanceEvents(input *DescribeInstanceEventsInput, accountID string) (*DescribeInstanceEventsOutput, error) {
+	records, err := s.listRecords(accountID + ".")
+	if err != nil {
+		return nil, err
+	}
+
+	output := &DescribeInstanceEventsOutput{Events: make(map[string][]*ec2.InstanceStatusEvent)}
+	for _, record := range records {
+		if len(input.InstanceIDs) > 0 && !slices.Contains(input.InstanceIDs, record.InstanceID) {
+			continue
+		}
+		if record.State != EventStateScheduled && !input.IncludeCompleted {
+			continue
+		}
+		output.Events[record.InstanceID] = append(output.Events[record.InstanceID], record.toEC2())
+	}
+	for _, events := range output.Events {
+		slices.SortFunc(events, func(a, b *ec2.InstanceStatusEvent) int {
+			return aws.TimeValue(a.NotBefore).Compare(aws.TimeValue(b.NotBefore))
+		})
+	}
+	return output, nil
+}
+
+// ModifyInstanceEventStartTime reschedules an event. The new start must be in
+// the future and no later than the event's NotBeforeDeadline; events without
+// a deadline, or that are already due or finished, cannot be rescheduled.
+func (s *InstanceEventServiceImpl) ModifyInstanceEventStartTime(input *ec2.ModifyInstanceEventStartTimeInput, accountID string) (*ec2.ModifyInstanceEventStartTimeOutput, error) {
+	if input.InstanceId == nil || *input.InstanceId == "" ||
+		input.InstanceEventId == nil || *input.InstanceEventId == "" ||
+		input.NotBefore == nil {
+		return nil, errors.New(awserrors.ErrorMissingParameter)
+	}
+
+	key := eventKey(accountID, *input.InstanceEventId)
+	entry, err := s.kv.Get(key)
+	if err != nil {
+		if errors.Is(err, nats.ErrKeyNotFound) {
+			return nil, errors.New(awserrors.ErrorInvalidInstanceEventIDNotFound)
+		}
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+
+	var record InstanceEventRecord
+	if err := json.Unmarshal(entry.Value(), &record); err != nil {
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+	if record.InstanceID != *input.InstanceId {
+		return nil, errors.New(awserrors.ErrorInvalidInstanceEventIDNotFound)
+	}
+
+	now := time.Now()
+	if record.State != EventStateScheduled || record.NotBeforeDeadline.IsZero() || !now.Before(record.NotBefore) {
+		return nil, errors.New(awserrors.ErrorInstanceEventStartTimeCannotChange)
+	}
+	notBefore := input.NotBefore.UTC()
+	if !notBefore.After(now) || notBefore.After(record.NotBeforeDeadline) {
+		return nil, errors.New(awserrors.ErrorInvalidInstanceEventStartTime)
+	}
+
+	record.NotBefore = notBefore
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+	if _, err := s.kv.Update(key, data, entry.Revision()); err != nil {
+		slog.Error("Failed to update instance event", "eventId", record.EventID, "err", err)
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+
+	slog.Info("Rescheduled instance event", "eventId", record.EventID, "instanceId", record.InstanceID, "notBefore", notBefore)
+	return &ec2.ModifyInstanceEventStartTimeOutput{Event: record.toEC2()}, nil
+}
+
+// DueInstanceEvents returns every scheduled event, across all accounts, whose
+// start time is at or before now.
+func (s *InstanceEventServiceImpl) DueInstanceEvents(now time.Time) ([]InstanceEventRecord, error) {
+	records, err := s.listRecords("")
+	if err != nil {
+		return nil, err
+	}
+	var due []InstanceEventRecord
+	for _, record := range records {
+		if record.State == EventStateScheduled && !record.NotBefore.After(now) {
+			due = append(due, record)
+		}
+	}
+	slices.SortFunc(due, func(a, b InstanceEventRecord) int { return a.NotBefore.Compare(b.NotBefore) })
+	return due, nil
+}
+
+// FinishInstanceEvent moves a scheduled event to state (completed or canceled).
+func (s *InstanceEventServiceImpl) FinishInstanceEvent(accountID, eventID, state string) error {
+	key := eventKey(accountID, eventID)
+	entry, err := s.kv.Get(key)
+	if err != nil {
+		return fmt.Errorf("get instance event %s: %w", eventID, err)
+	}
+	var record InstanceEventRecord
+	if err := json.Unmarshal(entry.Value(), &record); err != nil {
+		return fmt.Errorf("unmarshal instance event %s: %w", eventID, err)
+	}
+	if record.State != EventStateScheduled {
+		return nil
+	}
+
+	record.State = state
+	record.CompletedAt = time.Now().UTC()
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("marshal instance event %s: %w", eventID, err)
+	}
+	if _, err := s.kv.Update(key, data, entry.Revision()); err != nil {
+		return fmt.Errorf("update instance event %s: %w", eventID, err)
+	}
+	return nil
+}
+
+// listRecords loads every event record whose key starts with prefix.
+func (s *InstanceEventServiceImpl) listRecords(prefix string) ([]InstanceEventRecord, error) {
+	keys, err := s.kv.Keys()
+	if err != nil && !errors.Is(err, nats.ErrNoKeysFound) {
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+
+	var records []InstanceEventRecord
+	for _, k := range keys {
+		if k == utils.VersionKey || !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		entry, err := s.kv.Get(k)
+		if err != nil {
+			slog.Warn("Failed to get instance event record", "key", k, "error", err)
+			continue
+		}
+		var record InstanceEventRecord
+		if err := json.Unmarshal(entry.Value(), &record); err != nil {
+			slog.Warn("Failed to unmarshal instance event record", "key", k, "error", err)
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// toEC2 converts the record to its API shape. Finished events keep their
+// description with the AWS "[Completed]" or "[Canceled]" prefix.
+func (r *InstanceEventRecord) toEC2() *ec2.InstanceStatusEvent {
+	description := r.Description
+	switch r.State {
+	case EventStateCompleted:
+		description = "[Completed] " + description
+	case EventStateCanceled:
+		description = "[Canceled] " + description
+	}
+	event := &ec2.InstanceStatusEvent{
+		InstanceEventId: aws.String(r.EventID),
+		Code:            aws.String(r.Code),
+		Description:     aws.String(description),
+		NotBefore:       aws.Time(r.NotBefore),
+	}
+	if !r.NotBeforeDeadline.IsZero() {
+		event.NotBeforeDeadline = aws.Time(r.NotBeforeDeadline)
+	}
+	if !r.CompletedAt.IsZero() {
+		event.NotAfter = aws.Time(r.CompletedAt)
+	}
+	return event
+}
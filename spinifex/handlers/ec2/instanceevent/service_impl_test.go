@@ -0,0 +1,210 @@
+package handlers_ec2_instanceevent
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAccountID = "123456789012"
+
+func setupTestService(t *testing.T) *InstanceEventServiceImpl {
+	t.Helper()
+	_, nc, _ := testutil.StartTestJetStream(t)
+
+	svc, err := NewInstanceEventServiceImplWithNATS(nil, nc)
+	require.NoError(t, err)
+	return svc
+}
+
+func scheduleTestEvent(t *testing.T, svc *InstanceEventServiceImpl, code string, notBefore, deadline time.Time) *ec2.InstanceStatusEvent {
+	t.Helper()
+	event, err := svc.ScheduleInstanceEvent(&ScheduleInstanceEventInput{
+		InstanceID:        "i-0123456789abcdef0",
+		Code:              code,
+		NotBefore:         notBefore,
+		NotBeforeDeadline: deadline,
+	}, testAccountID)
+	require.NoError(t, err)
+	return event
+}
+
+// --- ScheduleInstanceEvent Tests ---
+
+func TestScheduleInstanceEvent(t *testing.T) {
+	svc := setupTestService(t)
+	notBefore := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	deadline := notBefore.Add(24 * time.Hour)
+
+	event := scheduleTestEvent(t, svc, ec2.EventCodeInstanceReboot, notBefore, deadline)
+	assert.Contains(t, *event.InstanceEventId, "instance-event-")
+	assert.Equal(t, ec2.EventCodeInstanceReboot, *event.Code)
+	assert.Equal(t, "The instance is scheduled for a reboot", *event.Description)
+	assert.True(t, notBefore.Equal(*event.NotBefore))
+	assert.True(t, deadline.Equal(*event.NotBeforeDeadline))
+
+	out, err := svc.DescribeInstanceEvents(&DescribeInstanceEventsInput{}, testAccountID)
+	require.NoError(t, err)
+	require.Len(t, out.Events["i-0123456789abcdef0"], 1)
+	assert.Equal(t, *event.InstanceEventId, *out.Events["i-0123456789abcdef0"][0].InstanceEventId)
+
+	// Events are only visible to the instance owner
+	out, err = svc.DescribeInstanceEvents(&DescribeInstanceEventsInput{}, "999999999999")
+	require.NoError(t, err)
+	assert.Empty(t, out.Events)
+}
+
+func TestScheduleInstanceEvent_Invalid(t *testing.T) {
+	svc := setupTestService(t)
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		input   *ScheduleInstanceEventInput
+		wantErr string
+	}{
+		{"MissingInstance", &ScheduleInstanceEventInput{Code: ec2.EventCodeInstanceStop, NotBefore: now}, awserrors.ErrorMissingParameter},
+		{"MissingStart", &ScheduleInstanceEventInput{InstanceID: "i-1", Code: ec2.EventCodeInstanceStop}, awserrors.ErrorMissingParameter},
+		{"MalformedInstance", &ScheduleInstanceEventInput{InstanceID: "vol-1", Code: ec2.EventCodeInstanceStop, NotBefore: now}, awserrors.ErrorInvalidInstanceIDMalformed},
+		{"UnsupportedCode", &ScheduleInstanceEventInput{InstanceID: "i-1", Code: ec2.EventCodeSystemMaintenance, NotBefore: now}, awserrors.ErrorInvalidParameterValue},
+		{"DeadlineBeforeStart", &ScheduleInstanceEventInput{InstanceID: "i-1", Code: ec2.EventCodeInstanceStop, NotBefore: now, NotBeforeDeadline: now.Add(-time.Hour)}, awserrors.ErrorInvalidParameterValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.ScheduleInstanceEvent(tt.input, testAccountID)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+// --- ModifyInstanceEventStartTime Tests ---
+
+func TestModifyInstanceEventStartTime(t *testing.T) {
+	svc := setupTestService(t)
+	notBefore := time.Now().Add(time.Hour)
+	deadline := notBefore.Add(48 * time.Hour)
+	event := scheduleTestEvent(t, svc, ec2.EventCodeInstanceReboot, notBefore, deadline)
+
+	modify := func(start time.Time) (*ec2.ModifyInstanceEventStartTimeOutput, error) {
+		return svc.ModifyInstanceEventStartTime(&ec2.ModifyInstanceEventStartTimeInput{
+			InstanceId:      aws.String("i-0123456789abcdef0"),
+			InstanceEventId: event.InstanceEventId,
+			NotBefore:       aws.Time(start),
+		}, testAccountID)
+	}
+
+	newStart := notBefore.Add(24 * time.Hour).UTC().Truncate(time.Second)
+	out, err := modify(newStart)
+	require.NoError(t, err)
+	assert.True(t, newStart.Equal(*out.Event.NotBefore))
+
+	desc, err := svc.DescribeInstanceEvents(&DescribeInstanceEventsInput{InstanceIDs: []string{"i-0123456789abcdef0"}}, testAccountID)
+	require.NoError(t, err)
+	require.Len(t, desc.Events["i-0123456789abcdef0"], 1)
+	assert.True(t, newStart.Equal(*desc.Events["i-0123456789abcdef0"][0].NotBefore))
+
+	// Outside the allowed window
+	_, err = modify(time.Now().Add(-time.Minute))
+	assert.EqualError(t, err, awserrors.ErrorInvalidInstanceEventStartTime)
+	_, err = modify(deadline.Add(time.Minute))
+	assert.EqualError(t, err, awserrors.ErrorInvalidInstanceEventStartTime)
+
+	// Right at the deadline is allowed
+	_, err = modify(deadline)
+	assert.NoError(t, err)
+}
+
+func TestModifyInstanceEventStartTime_CannotChange(t *testing.T) {
+	svc := setupTestService(t)
+	later := time.Now().Add(2 * time.Hour)
+
+	modify := func(event *ec2.InstanceStatusEvent) error {
+		_, err := svc.ModifyInstanceEventStartTime(&ec2.ModifyInstanceEventStartTimeInput{
+			InstanceId:      aws.String("i-0123456789abcdef0"),
+			InstanceEventId: event.InstanceEventId,
+			NotBefore:       aws.Time(later),
+		}, testAccountID)
+		return err
+	}
+
+	t.Run("NoDeadline", func(t *testing.T) {
+		event := scheduleTestEvent(t, svc, ec2.EventCodeInstanceRetirement, time.Now().Add(time.Hour), time.Time{})
+		assert.EqualError(t, modify(event), awserrors.ErrorInstanceEventStartTimeCannotChange)
+	})
+
+	t.Run("AlreadyDue", func(t *testing.T) {
+		event := scheduleTestEvent(t, svc, ec2.EventCodeInstanceStop, time.Now().Add(-time.Minute), time.Now().Add(24*time.Hour))
+		assert.EqualError(t, modify(event), awserrors.ErrorInstanceEventStartTimeCannotChange)
+	})
+
+	t.Run("Completed", func(t *testing.T) {
+		event := scheduleTestEvent(t, svc, ec2.EventCodeInstanceStop, time.Now().Add(time.Hour), time.Now().Add(24*time.Hour))
+		require.NoError(t, svc.FinishInstanceEvent(testAccountID, *event.InstanceEventId, EventStateCompleted))
+		assert.EqualError(t, modify(event), awserrors.ErrorInstanceEventStartTimeCannotChange)
+	})
+}
+
+func TestModifyInstanceEventStartTime_NotFound(t *testing.T) {
+	svc := setupTestService(t)
+	event := scheduleTestEvent(t, svc, ec2.EventCodeInstanceReboot, time.Now().Add(time.Hour), time.Now().Add(24*time.Hour))
+
+	tests := []struct {
+		name       string
+		instanceID string
+		eventID    string
+		accountID  string
+	}{
+		{"UnknownEvent", "i-0123456789abcdef0", "instance-event-0000000000000000", testAccountID},
+		{"WrongInstance", "i-0fedcba9876543210", *event.InstanceEventId, testAccountID},
+		{"WrongAccount", "i-0123456789abcdef0", *event.InstanceEventId, "999999999999"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.ModifyInstanceEventStartTime(&ec2.ModifyInstanceEventStartTimeInput{
+				InstanceId:      aws.String(tt.instanceID),
+				InstanceEventId: aws.String(tt.eventID),
+				NotBefore:       aws.Time(time.Now().Add(2 * time.Hour)),
+			}, tt.accountID)
+			assert.EqualError(t, err, awserrors.ErrorInvalidInstanceEventIDNotFound)
+		})
+	}
+}
+
+// --- Due / Finish Tests ---
+
+func TestDueAndFinishInstanceEvents(t *testing.T) {
+	svc := setupTestService(t)
+	now := time.Now()
+	due := scheduleTestEvent(t, svc, ec2.EventCodeInstanceStop, now.Add(-time.Minute), time.Time{})
+	scheduleTestEvent(t, svc, ec2.EventCodeInstanceReboot, now.Add(time.Hour), time.Time{})
+
+	records, err := svc.DueInstanceEvents(now)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, *due.InstanceEventId, records[0].EventID)
+	assert.Equal(t, testAccountID, records[0].AccountID)
+
+	require.NoError(t, svc.FinishInstanceEvent(testAccountID, records[0].EventID, EventStateCompleted))
+
+	records, err = svc.DueInstanceEvents(now)
+	require.NoError(t, err)
+	assert.Empty(t, records)
+
+	// Completed events are hidden unless asked for, and carry the AWS prefix
+	out, err := svc.DescribeInstanceEvents(&DescribeInstanceEventsInput{}, testAccountID)
+	require.NoError(t, err)
+	assert.Len(t, out.Events["i-0123456789abcdef0"], 1)
+
+	out, err = svc.DescribeInstanceEvents(&DescribeInstanceEventsInput{IncludeCompleted: true}, testAccountID)
+	require.NoError(t, err)
+	events := out.Events["i-0123456789abcdef0"]
+	require.Len(t, events, 2)
+	assert.Equal(t, "[Completed] The instance is scheduled to be stopped", *events[0].Description)
+	assert.NotNil(t, events[0].NotAfter)
+}
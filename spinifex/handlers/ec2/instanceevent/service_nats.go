@@ -0,0 +1,33 @@
+package handlers_ec2_instanceevent
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+)
+
+// NATSInstanceEventService handles scheduled instance event operations via NATS messaging.
+type NATSInstanceEventService struct {
+	natsConn *nats.Conn
+}
+
+// NewNATSInstanceEventService creates a new NATS-based instance event service.
+func NewNATSInstanceEventService(conn *nats.Conn) InstanceEventService {
+	return &NATSInstanceEventService{natsConn: conn}
+}
+
+// ScheduleInstanceEvent is answered only by the node running the instance,
+// which records the event against the instance's owner.
+func (s *NATSInstanceEventService) ScheduleInstanceEvent(input *ScheduleInstanceEventInput, accountID string) (*ec2.InstanceStatusEvent, error) {
+	return utils.NATSRequest[ec2.InstanceStatusEvent](s.natsConn, "ec2.ScheduleInstanceEvent", input, 5*time.Second, accountID)
+}
+
+func (s *NATSInstanceEventService) DescribeInstanceEvents(input *DescribeInstanceEventsInput, accountID string) (*DescribeInstanceEventsOutput, error) {
+	return utils.NATSRequest[DescribeInstanceEventsOutput](s.natsConn, "ec2.DescribeInstanceEvents", input, 30*time.Second, accountID)
+}
+
+func (s *NATSInstanceEventService) ModifyInstanceEventStartTime(input *ec2.ModifyInstanceEventStartTimeInput, accountID string) (*ec2.ModifyInstanceEventStartTimeOutput, error) {
+	return utils.NATSRequest[ec2.ModifyInstanceEventStartTimeOutput](s.natsConn, "ec2.ModifyInstanceEventStartTime", input, 30*time.Second, accountID)
+}
@@ -0,0 +1,40 @@
+package handlers_ec2_instanceschedule
+
+// InstanceScheduleService defines the interface for recurring instance
+// start/stop schedule operations
+type InstanceScheduleService interface {
+	CreateInstanceSchedule(input *CreateInstanceScheduleInput, accountID string) (*InstanceSchedule, error)
+	DescribeInstanceSchedules(input *DescribeInstanceSchedulesInput, accountID string) (*DescribeInstanceSchedulesOutput, error)
+	DeleteInstanceSchedule(input *DeleteInstanceScheduleInput, accountID string) (*DeleteInstanceScheduleOutput, error)
+}
+
+// CreateInstanceScheduleInput starts or stops an instance whenever
+// ScheduleExpression, a five-field cron expression, fires in Timezone.
+type CreateInstanceScheduleInput struct {
+	InstanceID         string `locationName:"InstanceId" json:"instance_id"`
+	Action             string `json:"action"` // ScheduleActionStart or ScheduleActionStop
+	ScheduleExpression string `json:"schedule_expression"`
+	Timezone           string `json:"timezone,omitempty"` // IANA name, UTC when empty
+	Description        string `json:"description,omitempty"`
+}
+
+// DescribeInstanceSchedulesInput lists the caller's schedules, narrowed to
+// the given schedule and instance IDs when set.
+type DescribeInstanceSchedulesInput struct {
+	InstanceScheduleIDs []string `locationName:"InstanceScheduleId" json:"instance_schedule_ids,omitempty"`
+	InstanceIDs         []string `locationName:"InstanceId" json:"instance_ids,omitempty"`
+}
+
+// DescribeInstanceSchedulesOutput lists schedules ordered by instance, then
+// next run.
+type DescribeInstanceSchedulesOutput struct {
+	InstanceSchedules []*InstanceSchedule `json:"instance_schedules"`
+}
+
+type DeleteInstanceScheduleInput struct {
+	InstanceScheduleID string `locationName:"InstanceScheduleId" json:"instance_schedule_id"`
+}
+
+type DeleteInstanceScheduleOutput struct {
+	Return bool `json:"return"`
+}
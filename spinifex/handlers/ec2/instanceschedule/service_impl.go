@@ -0,0 +1,370 @@
+package handlers_ec2_instanceschedule
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/config"
+	"github.com/mulgadc/spinifex/spinifex/cron"
+	"github.com/mulgadc/spinifex/spinifex/migrate"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+)
+
+// Ensure InstanceScheduleServiceImpl implements InstanceScheduleService
+var _ InstanceScheduleService = (*InstanceScheduleServiceImpl)(nil)
+
+const (
+	KVBucketInstanceSchedules        = "spinifex-instance-schedules"
+	KVBucketInstanceSchedulesVersion = 1
+
+	// MaxSchedulesPerInstance caps the schedules on one instance.
+	MaxSchedulesPerInstance = 10
+
+	scheduleIDPrefix = "isch"
+)
+
+// Schedule actions.
+const (
+	ScheduleActionStart = "start"
+	ScheduleActionStop  = "stop"
+)
+
+// Outcomes of a schedule's most recent run.
+const (
+	ScheduleResultSucceeded = "succeeded"
+	ScheduleResultFailed    = "failed"
+	ScheduleResultSkipped   = "skipped" // the instance was already started or stopped
+	ScheduleResultMissed    = "missed"  // no leader ran it in time
+)
+
+// InstanceSchedule is a stored recurring start or stop of an instance.
+type InstanceSchedule struct {
+	InstanceScheduleID string    `json:"instance_schedule_id"`
+	InstanceID         string    `json:"instance_id"`
+	AccountID          string    `json:"account_id"`
+	Action             string    `json:"action"`
+	ScheduleExpression string    `json:"schedule_expression"`
+	Timezone           string    `json:"timezone"`
+	Description        string    `json:"description,omitempty"`
+	CreatedAt          time.Time `json:"created_at"`
+	// NextRun is zero once the expression can no longer fire.
+	NextRun    time.Time `json:"next_run,omitzero"`
+	LastRun    time.Time `json:"last_run,omitzero"`
+	LastResult string    `json:"last_result,omitempty"`
+	// LastError is the error code of a failed last run.
+	LastError string `json:"last_error,omitempty"`
+}
+
+// InstanceScheduleServiceImpl implements instance schedules with NATS JetStream persistence.
+type InstanceScheduleServiceImpl struct {
+	config *config.Config
+	kv     nats.KeyValue
+}
+
+// NewInstanceScheduleServiceImplWithNATS creates an instance schedule service with NATS JetStream.
+func NewInstanceScheduleServiceImplWithNATS(cfg *config.Config, natsConn *nats.Conn) (*InstanceScheduleServiceImpl, error) {
+	js, err := natsConn.JetStream()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get JetStream context: %w", err)
+	}
+
+	kv, err := utils.GetOrCreateKVBucket(js, KVBucketInstanceSchedules, 10)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create KV bucket %s: %w", KVBucketInstanceSchedules, err)
+	}
+	if err := migrate.DefaultRegistry.RunKV(KVBucketInstanceSchedules, kv, KVBucketInstanceSchedulesVersion); err != nil {
+		return nil, fmt.Errorf("migrate %s: %w", KVBucketInstanceSchedules, err)
+	}
+
+	slog.Info("Instance schedule service initialized with JetStream KV", "bucket", KVBucketInstanceSchedules)
+
+	return &InstanceScheduleServiceImpl{
+		config: cfg,
+		kv:     kv,
+	}, nil
+}
+
+func scheduleKey(accountID, scheduleID string) string {
+	return accountID + "." + scheduleID
+}
+
+// IsValidScheduleID reports whether id looks like an instance schedule ID.
+func IsValidScheduleID(id string) bool {
+	return strings.HasPrefix(id, scheduleIDPrefix+"-") && len(id) > len(scheduleIDPrefix)+1
+}
+
+// ParseSchedule parses a schedule expression in the named IANA time zone,
+// UTC when empty.
+func ParseSchedule(expression, timezone string) (*cron.Schedule, error) {
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", timezone)
+	}
+	return cron.Parse(expression, loc)
+}
+
+// CreateInstanceSchedule records a new schedule for an instance owned by
+// accountID. The caller checks the instance exists and is the account's.
+func (s *InstanceScheduleServiceImpl) CreateInstanceSchedule(input *CreateInstanceScheduleInput, accountID string) (*InstanceSchedule, error) {
+	if input.InstanceID == "" || input.Action == "" || input.ScheduleExpression == "" {
+		return nil, errors.New(awserrors.ErrorMissingParameter)
+	}
+	if !strings.HasPrefix(input.InstanceID, "i-") {
+		return nil, errors.New(awserrors.ErrorInvalidInstanceIDMalformed)
+	}
+	if input.Action != ScheduleActionStart && input.Action != ScheduleActionStop {
+		return nil, awserrors.WithDetail(awserrors.ErrorInvalidParameterValue, "Action must be start or stop")
+	}
+	schedule, err := ParseSchedule(input.ScheduleExpression, input.Timezone)
+	if err != nil {
+		return nil, awserrors.WithDetail(awserrors.ErrorInvalidParameterValue, err.Error())
+	}
+	now := time.Now()
+	nextRun := schedule.Next(now)
+	if nextRun.IsZero() {
+		return nil, awserrors.WithDetail(awserrors.ErrorInvalidParameterValue, "ScheduleExpression never fires")
+	}
+
+	existing, err := s.listRecords(accountID + ".")
+	if err != nil {
+		return nil, err
+	}
+	count := 0
+	for _, record := range existing {
+		if record.InstanceID == input.InstanceID {
+			count++
+		}
+	}
+	if count >= MaxSchedulesPerInstance {
+		return nil, errors.New(awserrors.ErrorInstanceScheduleLimitExceeded)
+	}
+
+	record := InstanceSchedule{
+		InstanceScheduleID: utils.GenerateResourceID(scheduleIDPrefix),
+		InstanceID:         input.InstanceID,
+		AccountID:          accountID,
+		Action:             input.Action,
+		ScheduleExpression: input.ScheduleExpression,
+		Timezone:           schedule.Location().String(),
+		Description:        input.Description,
+		CreatedAt:          now.UTC(),
+		NextRun:            nextRun.UTC(),
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+	if _, err := s.kv.Create(scheduleKey(accountID, record.InstanceScheduleID), data); err != nil {
+		slog.Error("Failed to store instance schedule", "scheduleId", record.InstanceScheduleID, "err", err)
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+
+	slog.Info("Created instance schedule", "scheduleId", record.InstanceScheduleID, "instanceId", record.InstanceID,
+		"action", record.Action, "expression", record.ScheduleExpression, "timezone", record.Timezone, "nextRun", record.NextRun)
+	return &record, nil
+}
+
+// DescribeInstanceSchedules returns the caller's schedules. Asking for a
+// schedule ID the caller doesn't have is an error, as for other EC2 IDs.
+func (s *InstanceScheduleServiceImpl) DescribeInstanceSchedules(input *DescribeInstanceSchedulesInput, accountID string) (*DescribeInstanceSchedulesOutput, error) {
+	for _, id := range input.InstanceScheduleIDs {
+		if !IsValidScheduleID(id) {
+			return nil, errors.New(awserrors.ErrorInvalidInstanceScheduleIDMalformed)
+		}
+	}
+
+	records, err := s.listRecords(accountID + ".")
+	if err != nil {
+		return nil, err
+	}
+
+	output := &DescribeInstanceSchedulesOutput{InstanceSchedules: []*InstanceSchedule{}}
+	found := make(map[string]bool)
+	for _, record := range records {
+		if len(input.InstanceScheduleIDs) > 0 && !slices.Contains(input.InstanceScheduleIDs, record.InstanceScheduleID) {
+			continue
+		}
+		found[record.InstanceScheduleID] = true
+		if len(input.InstanceIDs) > 0 && !slices.Contains(input.InstanceIDs, record.InstanceID) {
+			continue
+		}
+		output.InstanceSchedules = append(output.InstanceSchedules, &record)
+	}
+	for _, id := range input.InstanceScheduleIDs {
+		if !found[id] {
+			return nil, errors.New(awserrors.ErrorInvalidInstanceScheduleIDNotFound)
+		}
+	}
+
+	slices.SortFunc(output.InstanceSchedules, func(a, b *InstanceSchedule) int {
+		return cmp.Or(strings.Compare(a.InstanceID, b.InstanceID), a.NextRun.Compare(b.NextRun))
+	})
+	return output, nil
+}
+
+// DeleteInstanceSchedule removes one of the caller's schedules.
+func (s *InstanceScheduleServiceImpl) DeleteInstanceSchedule(input *DeleteInstanceScheduleInput, accountID string) (*DeleteInstanceScheduleOutput, error) {
+	if input.InstanceScheduleID == "" {
+		return nil, errors.New(awserrors.ErrorMissingParameter)
+	}
+	if !IsValidScheduleID(input.InstanceScheduleID) {
+		return nil, errors.New(awserrors.ErrorInvalidInstanceScheduleIDMalformed)
+	}
+
+	key := scheduleKey(accountID, input.InstanceScheduleID)
+	if _, err := s.kv.Get(key); err != nil {
+		if errors.Is(err, nats.ErrKeyNotFound) {
+			return nil, errors.New(awserrors.ErrorInvalidInstanceScheduleIDNotFound)
+		}
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+	if err := s.kv.Delete(key); err != nil {
+		slog.Error("Failed to delete instance schedule", "scheduleId", input.InstanceScheduleID, "err", err)
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+
+	slog.Info("Deleted instance schedule", "scheduleId", input.InstanceScheduleID)
+	return &DeleteInstanceScheduleOutput{Return: true}, nil
+}
+
+// DueInstanceSchedules returns every schedule, across all accounts, whose
+// next run is at or before now, soonest first.
+func (s *InstanceScheduleServiceImpl) DueInstanceSchedules(now time.Time) ([]InstanceSchedule, error) {
+	records, err := s.listRecords("")
+	if err != nil {
+		return nil, err
+	}
+	var due []InstanceSchedule
+	for _, record := range records {
+		if !record.NextRun.IsZero() && !record.NextRun.After(now) {
+			due = append(due, record)
+		}
+	}
+	slices.SortFunc(due, func(a, b InstanceSchedule) int { return a.NextRun.Compare(b.NextRun) })
+	return due, nil
+}
+
+// ClaimInstanceScheduleRun claims a due run by moving the schedule's next
+// run past now, before the action is taken. The update is conditional on the
+// stored revision, so a run claimed twice (say across a leader change) is
+// only executed once. It returns the claimed schedule with LastRun set to
+// the time the run was due, or nil if the run is no longer due.
+func (s *InstanceScheduleServiceImpl) ClaimInstanceScheduleRun(accountID, scheduleID string, now time.Time) (*InstanceSchedule, error) {
+	key := scheduleKey(accountID, scheduleID)
+	entry, err := s.kv.Get(key)
+	if err != nil {
+		if errors.Is(err, nats.ErrKeyNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("get instance schedule %s: %w", scheduleID, err)
+	}
+	var record InstanceSchedule
+	if err := json.Unmarshal(entry.Value(), &record); err != nil {
+		return nil, fmt.Errorf("unmarshal instance schedule %s: %w", scheduleID, err)
+	}
+	if record.NextRun.IsZero() || record.NextRun.After(now) {
+		return nil, nil
+	}
+
+	schedule, err := ParseSchedule(record.ScheduleExpression, record.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("parse instance schedule %s: %w", scheduleID, err)
+	}
+	record.LastRun = record.NextRun
+	record.NextRun = schedule.Next(now).UTC()
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("marshal instance schedule %s: %w", scheduleID, err)
+	}
+	if _, err := s.kv.Update(key, data, entry.Revision()); err != nil {
+		return nil, fmt.Errorf("claim instance schedule %s: %w", scheduleID, err)
+	}
+	return &record, nil
+}
+
+// RecordInstanceScheduleResult stores the outcome of a schedule's last run.
+// errCode is the error code of a failed run.
+func (s *InstanceScheduleServiceImpl) RecordInstanceScheduleResult(accountID, scheduleID, result, errCode string) error {
+	key := scheduleKey(accountID, scheduleID)
+	entry, err := s.kv.Get(key)
+	if err != nil {
+		if errors.Is(err, nats.ErrKeyNotFound) {
+			return nil // deleted while it ran
+		}
+		return fmt.Errorf("get instance schedule %s: %w", scheduleID, err)
+	}
+	var record InstanceSchedule
+	if err := json.Unmarshal(entry.Value(), &record); err != nil {
+		return fmt.Errorf("unmarshal instance schedule %s: %w", scheduleID, err)
+	}
+
+	record.LastResult = result
+	record.LastError = errCode
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("marshal instance schedule %s: %w", scheduleID, err)
+	}
+	if _, err := s.kv.Update(key, data, entry.Revision()); err != nil {
+		return fmt.Errorf("update instance schedule %s: %w", scheduleID, err)
+	}
+	return nil
+}
+
+// DeleteInstanceSchedulesForInstance removes every schedule on an instance,
+// once it is terminated.
+func (s *InstanceScheduleServiceImpl) DeleteInstanceSchedulesForInstance(accountID, instanceID string) error {
+	records, err := s.listRecords(accountID + ".")
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		if record.InstanceID != instanceID {
+			continue
+		}
+		if err := s.kv.Delete(scheduleKey(accountID, record.InstanceScheduleID)); err != nil {
+			return fmt.Errorf("delete instance schedule %s: %w", record.InstanceScheduleID, err)
+		}
+		slog.Info("Deleted schedule of terminated instance", "scheduleId", record.InstanceScheduleID, "instanceId", instanceID)
+	}
+	return nil
+}
+
+// listRecords loads every schedule whose key starts with prefix.
+func (s *InstanceScheduleServiceImpl) listRecords(prefix string) ([]InstanceSchedule, error) {
+	keys, err := s.kv.Keys()
+	if err != nil && !errors.Is(err, nats.ErrNoKeysFound) {
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+
+	var records []InstanceSchedule
+	for _, k := range keys {
+		if k == utils.VersionKey || !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		entry, err := s.kv.Get(k)
+		if err != nil {
+			slog.Warn("Failed to get instance schedule record", "key", k, "error", err)
+			continue
+		}
+		var record InstanceSchedule
+		if err := json.Unmarshal(entry.Value(), &record); err != nil {
+			slog.Warn("Failed to unmarshal instance schedule record", "key", k, "error", err)
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
@@ -0,0 +1,229 @@
+package handlers_ec2_instanceschedule
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testAccountID  = "123456789012"
+	testInstanceID = "i-0123456789abcdef0"
+)
+
+func setupTestService(t *testing.T) *InstanceScheduleServiceImpl {
+	t.Helper()
+	_, nc, _ := testutil.StartTestJetStream(t)
+
+	svc, err := NewInstanceScheduleServiceImplWithNATS(nil, nc)
+	require.NoError(t, err)
+	return svc
+}
+
+func createTestSchedule(t *testing.T, svc *InstanceScheduleServiceImpl, instanceID, action, expression string) *InstanceSchedule {
+	t.Helper()
+	schedule, err := svc.CreateInstanceSchedule(&CreateInstanceScheduleInput{
+		InstanceID:         instanceID,
+		Action:             action,
+		ScheduleExpression: expression,
+	}, testAccountID)
+	require.NoError(t, err)
+	return schedule
+}
+
+// setNextRun rewrites a stored schedule's next run, as if it had come due.
+func setNextRun(t *testing.T, svc *InstanceScheduleServiceImpl, schedule *InstanceSchedule, next time.Time) {
+	t.Helper()
+	schedule.NextRun = next
+	data, err := json.Marshal(schedule)
+	require.NoError(t, err)
+	_, err = svc.kv.Put(scheduleKey(schedule.AccountID, schedule.InstanceScheduleID), data)
+	require.NoError(t, err)
+}
+
+// --- CreateInstanceSchedule Tests ---
+
+func TestCreateInstanceSchedule(t *testing.T) {
+	svc := setupTestService(t)
+
+	schedule, err := svc.CreateInstanceSchedule(&CreateInstanceScheduleInput{
+		InstanceID:         testInstanceID,
+		Action:             ScheduleActionStart,
+		ScheduleExpression: "0 8 * * MON-FRI",
+		Timezone:           "Australia/Sydney",
+		Description:        "lab hours",
+	}, testAccountID)
+	require.NoError(t, err)
+	assert.Contains(t, schedule.InstanceScheduleID, "isch-")
+	assert.True(t, IsValidScheduleID(schedule.InstanceScheduleID))
+	assert.Equal(t, "Australia/Sydney", schedule.Timezone)
+	assert.Equal(t, testAccountID, schedule.AccountID)
+	require.False(t, schedule.NextRun.IsZero())
+	assert.True(t, schedule.NextRun.After(time.Now()))
+
+	loc, err := time.LoadLocation("Australia/Sydney")
+	require.NoError(t, err)
+	local := schedule.NextRun.In(loc)
+	assert.Equal(t, 8, local.Hour())
+	assert.Zero(t, local.Minute())
+	assert.NotContains(t, []time.Weekday{time.Saturday, time.Sunday}, local.Weekday())
+
+	// Timezone defaults to UTC
+	schedule = createTestSchedule(t, svc, testInstanceID, ScheduleActionStop, "@daily")
+	assert.Equal(t, "UTC", schedule.Timezone)
+}
+
+func TestCreateInstanceSchedule_Invalid(t *testing.T) {
+	svc := setupTestService(t)
+
+	tests := []struct {
+		name    string
+		input   *CreateInstanceScheduleInput
+		wantErr string
+	}{
+		{"MissingInstance", &CreateInstanceScheduleInput{Action: ScheduleActionStop, ScheduleExpression: "@daily"}, awserrors.ErrorMissingParameter},
+		{"MissingExpression", &CreateInstanceScheduleInput{InstanceID: testInstanceID, Action: ScheduleActionStop}, awserrors.ErrorMissingParameter},
+		{"MalformedInstance", &CreateInstanceScheduleInput{InstanceID: "vol-1", Action: ScheduleActionStop, ScheduleExpression: "@daily"}, awserrors.ErrorInvalidInstanceIDMalformed},
+		{"UnsupportedAction", &CreateInstanceScheduleInput{InstanceID: testInstanceID, Action: "reboot", ScheduleExpression: "@daily"}, awserrors.ErrorInvalidParameterValue},
+		{"BadExpression", &CreateInstanceScheduleInput{InstanceID: testInstanceID, Action: ScheduleActionStop, ScheduleExpression: "0 25 * * *"}, awserrors.ErrorInvalidParameterValue},
+		{"NeverFires", &CreateInstanceScheduleInput{InstanceID: testInstanceID, Action: ScheduleActionStop, ScheduleExpression: "0 0 31 2 *"}, awserrors.ErrorInvalidParameterValue},
+		{"BadTimezone", &CreateInstanceScheduleInput{InstanceID: testInstanceID, Action: ScheduleActionStop, ScheduleExpression: "@daily", Timezone: "Mars/Olympus"}, awserrors.ErrorInvalidParameterValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.CreateInstanceSchedule(tt.input, testAccountID)
+			assert.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestCreateInstanceSchedule_Limit(t *testing.T) {
+	svc := setupTestService(t)
+	for range MaxSchedulesPerInstance {
+		createTestSchedule(t, svc, testInstanceID, ScheduleActionStop, "0 20 * * *")
+	}
+
+	_, err := svc.CreateInstanceSchedule(&CreateInstanceScheduleInput{
+		InstanceID: testInstanceID, Action: ScheduleActionStop, ScheduleExpression: "0 20 * * *",
+	}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorInstanceScheduleLimitExceeded)
+
+	// The limit is per instance
+	createTestSchedule(t, svc, "i-0fedcba9876543210", ScheduleActionStop, "0 20 * * *")
+}
+
+// --- DescribeInstanceSchedules / DeleteInstanceSchedule Tests ---
+
+func TestDescribeInstanceSchedules(t *testing.T) {
+	svc := setupTestService(t)
+	stop := createTestSchedule(t, svc, testInstanceID, ScheduleActionStop, "0 20 * * *")
+	start := createTestSchedule(t, svc, testInstanceID, ScheduleActionStart, "0 8 * * 1-5")
+	other := createTestSchedule(t, svc, "i-0fedcba9876543210", ScheduleActionStop, "0 20 * * *")
+
+	out, err := svc.DescribeInstanceSchedules(&DescribeInstanceSchedulesInput{}, testAccountID)
+	require.NoError(t, err)
+	assert.Len(t, out.InstanceSchedules, 3)
+
+	out, err = svc.DescribeInstanceSchedules(&DescribeInstanceSchedulesInput{InstanceIDs: []string{testInstanceID}}, testAccountID)
+	require.NoError(t, err)
+	require.Len(t, out.InstanceSchedules, 2)
+	for _, s := range out.InstanceSchedules {
+		assert.Contains(t, []string{stop.InstanceScheduleID, start.InstanceScheduleID}, s.InstanceScheduleID)
+	}
+
+	out, err = svc.DescribeInstanceSchedules(&DescribeInstanceSchedulesInput{InstanceScheduleIDs: []string{other.InstanceScheduleID}}, testAccountID)
+	require.NoError(t, err)
+	require.Len(t, out.InstanceSchedules, 1)
+	assert.Equal(t, other.InstanceScheduleID, out.InstanceSchedules[0].InstanceScheduleID)
+
+	// Schedules are only visible to their owner
+	out, err = svc.DescribeInstanceSchedules(&DescribeInstanceSchedulesInput{}, "999999999999")
+	require.NoError(t, err)
+	assert.Empty(t, out.InstanceSchedules)
+	_, err = svc.DescribeInstanceSchedules(&DescribeInstanceSchedulesInput{InstanceScheduleIDs: []string{stop.InstanceScheduleID}}, "999999999999")
+	assert.EqualError(t, err, awserrors.ErrorInvalidInstanceScheduleIDNotFound)
+
+	_, err = svc.DescribeInstanceSchedules(&DescribeInstanceSchedulesInput{InstanceScheduleIDs: []string{"sched-1"}}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorInvalidInstanceScheduleIDMalformed)
+}
+
+func TestDeleteInstanceSchedule(t *testing.T) {
+	svc := setupTestService(t)
+	schedule := createTestSchedule(t, svc, testInstanceID, ScheduleActionStop, "0 20 * * *")
+
+	_, err := svc.DeleteInstanceSchedule(&DeleteInstanceScheduleInput{InstanceScheduleID: schedule.InstanceScheduleID}, "999999999999")
+	assert.EqualError(t, err, awserrors.ErrorInvalidInstanceScheduleIDNotFound)
+
+	out, err := svc.DeleteInstanceSchedule(&DeleteInstanceScheduleInput{InstanceScheduleID: schedule.InstanceScheduleID}, testAccountID)
+	require.NoError(t, err)
+	assert.True(t, out.Return)
+
+	_, err = svc.DeleteInstanceSchedule(&DeleteInstanceScheduleInput{InstanceScheduleID: schedule.InstanceScheduleID}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorInvalidInstanceScheduleIDNotFound)
+	_, err = svc.DeleteInstanceSchedule(&DeleteInstanceScheduleInput{}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorMissingParameter)
+	_, err = svc.DeleteInstanceSchedule(&DeleteInstanceScheduleInput{InstanceScheduleID: "i-1"}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorInvalidInstanceScheduleIDMalformed)
+}
+
+// --- Daemon-side run Tests ---
+
+func TestClaimInstanceScheduleRun(t *testing.T) {
+	svc := setupTestService(t)
+	schedule := createTestSchedule(t, svc, testInstanceID, ScheduleActionStop, "0 20 * * *")
+	createTestSchedule(t, svc, testInstanceID, ScheduleActionStart, "0 8 * * *")
+
+	now := time.Now().UTC()
+	due := now.Add(-time.Minute).Truncate(time.Minute)
+	setNextRun(t, svc, schedule, due)
+
+	dueSchedules, err := svc.DueInstanceSchedules(now)
+	require.NoError(t, err)
+	require.Len(t, dueSchedules, 1)
+	assert.Equal(t, schedule.InstanceScheduleID, dueSchedules[0].InstanceScheduleID)
+
+	claimed, err := svc.ClaimInstanceScheduleRun(testAccountID, schedule.InstanceScheduleID, now)
+	require.NoError(t, err)
+	require.NotNil(t, claimed)
+	assert.True(t, due.Equal(claimed.LastRun))
+	assert.True(t, claimed.NextRun.After(now))
+	assert.Equal(t, 20, claimed.NextRun.Hour())
+
+	// A second claim of the same run finds it no longer due
+	again, err := svc.ClaimInstanceScheduleRun(testAccountID, schedule.InstanceScheduleID, now)
+	require.NoError(t, err)
+	assert.Nil(t, again)
+	dueSchedules, err = svc.DueInstanceSchedules(now)
+	require.NoError(t, err)
+	assert.Empty(t, dueSchedules)
+
+	require.NoError(t, svc.RecordInstanceScheduleResult(testAccountID, schedule.InstanceScheduleID, ScheduleResultFailed, awserrors.ErrorOperationNotPermitted))
+	out, err := svc.DescribeInstanceSchedules(&DescribeInstanceSchedulesInput{InstanceScheduleIDs: []string{schedule.InstanceScheduleID}}, testAccountID)
+	require.NoError(t, err)
+	require.Len(t, out.InstanceSchedules, 1)
+	assert.Equal(t, ScheduleResultFailed, out.InstanceSchedules[0].LastResult)
+	assert.Equal(t, awserrors.ErrorOperationNotPermitted, out.InstanceSchedules[0].LastError)
+	assert.True(t, due.Equal(out.InstanceSchedules[0].LastRun))
+
+	// Recording against a deleted schedule is a no-op
+	assert.NoError(t, svc.RecordInstanceScheduleResult(testAccountID, "isch-gone", ScheduleResultSucceeded, ""))
+}
+
+func TestDeleteInstanceSchedulesForInstance(t *testing.T) {
+	svc := setupTestService(t)
+	createTestSchedule(t, svc, testInstanceID, ScheduleActionStop, "0 20 * * *")
+	createTestSchedule(t, svc, testInstanceID, ScheduleActionStart, "0 8 * * *")
+	other := createTestSchedule(t, svc, "i-0fedcba9876543210", ScheduleActionStop, "0 20 * * *")
+
+	require.NoError(t, svc.DeleteInstanceSchedulesForInstance(testAccountID, testInstanceID))
+
+	out, err := svc.DescribeInstanceSchedules(&DescribeInstanceSchedulesInput{}, testAccountID)
+	require.NoError(t, err)
+	require.Len(t, out.InstanceSchedules, 1)
+	assert.Equal(t, other.InstanceScheduleID, out.InstanceSchedules[0].InstanceScheduleID)
+}
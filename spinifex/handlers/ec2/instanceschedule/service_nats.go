@@ -0,0 +1,30 @@
+package handlers_ec2_instanceschedule
+
+import (
+	"time"
+
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+)
+
+// NATSInstanceScheduleService handles instance schedule operations via NATS messaging.
+type NATSInstanceScheduleService struct {
+	natsConn *nats.Conn
+}
+
+// NewNATSInstanceScheduleService creates a new NATS-based instance schedule service.
+func NewNATSInstanceScheduleService(conn *nats.Conn) InstanceScheduleService {
+	return &NATSInstanceScheduleService{natsConn: conn}
+}
+
+func (s *NATSInstanceScheduleService) CreateInstanceSchedule(input *CreateInstanceScheduleInput, accountID string) (*InstanceSchedule, error) {
+	return utils.NATSRequest[InstanceSchedule](s.natsConn, "ec2.CreateInstanceSchedule", input, 30*time.Second, accountID)
+}
+
+func (s *NATSInstanceScheduleService) DescribeInstanceSchedules(input *DescribeInstanceSchedulesInput, accountID string) (*DescribeInstanceSchedulesOutput, error) {
+	return utils.NATSRequest[DescribeInstanceSchedulesOutput](s.natsConn, "ec2.DescribeInstanceSchedules", input, 30*time.Second, accountID)
+}
+
+func (s *NATSInstanceScheduleService) DeleteInstanceSchedule(input *DeleteInstanceScheduleInput, accountID string) (*DeleteInstanceScheduleOutput, error) {
+	return utils.NATSRequest[DeleteInstanceScheduleOutput](s.natsConn, "ec2.DeleteInstanceSchedule", input, 30*time.Second, accountID)
+}
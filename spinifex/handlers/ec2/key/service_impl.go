@@ -36,15 +36,8 @@ type KeyServiceImpl struct {
 	bucketName string
 }
 
-// NewKeyServiceImpl creates a new daemon-side key service
-func NewKeyServiceImpl(cfg *config.Config) *KeyServiceImpl {
-	store := objectstore.NewS3ObjectStoreFromConfig(
-		cfg.Predastore.Host,
-		cfg.Predastore.Region,
-		cfg.Predastore.AccessKey,
-		cfg.Predastore.SecretKey,
-	)
-
+// NewKeyServiceImpl creates a new daemon-side key service on store
+func NewKeyServiceImpl(cfg *config.Config, store objectstore.ObjectStore) *KeyServiceImpl {
 	return &KeyServiceImpl{
 		config:     cfg,
 		store:      store,
@@ -596,6 +589,15 @@ func (s *KeyServiceImpl) DescribeKeyPairs(input *ec2.DescribeKeyPairsInput, acco
 			continue
 		}
 
+		if aws.BoolValue(input.IncludePublicKey) && metadata.KeyName != nil {
+			publicKey, err := s.getPublicKey(accountID, *metadata.KeyName)
+			if err != nil {
+				slog.Debug("Failed to read public key", "keyName", *metadata.KeyName, "err", err)
+			} else {
+				keyPairInfo.PublicKey = aws.String(publicKey)
+			}
+		}
+
 		keyPairs = append(keyPairs, keyPairInfo)
 	}
 
@@ -606,6 +608,24 @@ func (s *KeyServiceImpl) DescribeKeyPairs(input *ec2.DescribeKeyPairsInput, acco
 	}, nil
 }
 
+// getPublicKey returns the OpenSSH public key stored for keyName.
+func (s *KeyServiceImpl) getPublicKey(accountID, keyName string) (string, error) {
+	result, err := s.store.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(fmt.Sprintf("keys/%s/%s", accountID, keyName)),
+	})
+	if err != nil {
+		return "", err
+	}
+	defer result.Body.Close()
+
+	data, err := io.ReadAll(result.Body)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
 // keyPairMatchesFilters checks whether a KeyPairInfo satisfies all parsed filters.
 func keyPairMatchesFilters(kp *ec2.KeyPairInfo, filters map[string][]string) bool {
 	for name, values := range filters {
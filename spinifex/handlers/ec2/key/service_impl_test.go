@@ -481,6 +481,23 @@ func TestDescribeKeyPairs_FilterNoMatch(t *testing.T) {
 	assert.Empty(t, out.KeyPairs)
 }
 
+func TestDescribeKeyPairs_IncludePublicKey(t *testing.T) {
+	svc, _ := newTestKeyService()
+
+	importTestKey(t, svc, "with-public-key")
+
+	out, err := svc.DescribeKeyPairs(&ec2.DescribeKeyPairsInput{}, testAccountID)
+	require.NoError(t, err)
+	require.Len(t, out.KeyPairs, 1)
+	assert.Nil(t, out.KeyPairs[0].PublicKey, "public key only returned on request")
+
+	out, err = svc.DescribeKeyPairs(&ec2.DescribeKeyPairsInput{IncludePublicKey: aws.Bool(true)}, testAccountID)
+	require.NoError(t, err)
+	require.Len(t, out.KeyPairs, 1)
+	require.NotNil(t, out.KeyPairs[0].PublicKey)
+	assert.Equal(t, strings.TrimSpace(testED25519PubKey), *out.KeyPairs[0].PublicKey)
+}
+
 func TestDescribeKeyPairs_NilInput(t *testing.T) {
 	svc, _ := newTestKeyService()
 
@@ -0,0 +1,104 @@
+package handlers_ec2_launchtemplate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+)
+
+// ResolveRunInstances resolves the launch template version input refers to
+// (the template's default when none is given) and merges its data into
+// input, clearing input.LaunchTemplate. Inputs without a launch template are
+// left untouched.
+func ResolveRunInstances(svc LaunchTemplateService, input *ec2.RunInstancesInput, accountID string) error {
+	spec := input.LaunchTemplate
+	if spec == nil {
+		return nil
+	}
+	if err := ValidateTemplateRef(spec.LaunchTemplateId, spec.LaunchTemplateName); err != nil {
+		return err
+	}
+
+	version := VersionDefault
+	if aws.StringValue(spec.Version) != "" {
+		version = aws.StringValue(spec.Version)
+	}
+
+	out, err := svc.DescribeLaunchTemplateVersions(&ec2.DescribeLaunchTemplateVersionsInput{
+		LaunchTemplateId:   spec.LaunchTemplateId,
+		LaunchTemplateName: spec.LaunchTemplateName,
+		Versions:           []*string{aws.String(version)},
+	}, accountID)
+	if err != nil {
+		return err
+	}
+	if len(out.LaunchTemplateVersions) == 0 {
+		return errors.New(awserrors.ErrorInvalidLaunchTemplateIdVersionNotFound)
+	}
+
+	input.LaunchTemplate = nil
+	return ApplyToRunInstances(input, out.LaunchTemplateVersions[0].LaunchTemplateData)
+}
+
+// ApplyToRunInstances fills the RunInstances parameters left unset in input
+// from a launch template version's data. Parameters given to RunInstances
+// override the template's, as in EC2. Launch template data mirrors
+// RunInstancesInput field for field, so the merge goes through JSON; template
+// fields RunInstances has no counterpart for are ignored.
+func ApplyToRunInstances(input *ec2.RunInstancesInput, data *ec2.ResponseLaunchTemplateData) error {
+	if data == nil {
+		return nil
+	}
+
+	inputFields, err := jsonFields(input)
+	if err != nil {
+		return err
+	}
+	dataFields, err := jsonFields(data)
+	if err != nil {
+		return err
+	}
+
+	for name, value := range dataFields {
+		if isEmptyJSON(value) {
+			continue
+		}
+		if current, ok := inputFields[name]; ok && !isEmptyJSON(current) {
+			continue
+		}
+		inputFields[name] = value
+	}
+
+	raw, err := json.Marshal(inputFields)
+	if err != nil {
+		return fmt.Errorf("marshal merged RunInstances input: %w", err)
+	}
+	var merged ec2.RunInstancesInput
+	if err := json.Unmarshal(raw, &merged); err != nil {
+		return fmt.Errorf("unmarshal merged RunInstances input: %w", err)
+	}
+	*input = merged
+	return nil
+}
+
+func jsonFields(v any) (map[string]json.RawMessage, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// isEmptyJSON reports whether value is an unset field: null or an empty list.
+func isEmptyJSON(value json.RawMessage) bool {
+	s := string(value)
+	return s == "null" || s == "[]"
+}
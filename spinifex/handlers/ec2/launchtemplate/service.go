@@ -0,0 +1,13 @@
+package handlers_ec2_launchtemplate
+
+import "github.com/aws/aws-sdk-go/service/ec2"
+
+// LaunchTemplateService defines the interface for EC2 launch template operations
+type LaunchTemplateService interface {
+	CreateLaunchTemplate(input *ec2.CreateLaunchTemplateInput, accountID string) (*ec2.CreateLaunchTemplateOutput, error)
+	CreateLaunchTemplateVersion(input *ec2.CreateLaunchTemplateVersionInput, accountID string) (*ec2.CreateLaunchTemplateVersionOutput, error)
+	ModifyLaunchTemplate(input *ec2.ModifyLaunchTemplateInput, accountID string) (*ec2.ModifyLaunchTemplateOutput, error)
+	DeleteLaunchTemplate(input *ec2.DeleteLaunchTemplateInput, accountID string) (*ec2.DeleteLaunchTemplateOutput, error)
+	DescribeLaunchTemplates(input *ec2.DescribeLaunchTemplatesInput, accountID string) (*ec2.DescribeLaunchTemplatesOutput, error)
+	DescribeLaunchTemplateVersions(input *ec2.DescribeLaunchTemplateVersionsInput, accountID string) (*ec2.DescribeLaunchTemplateVersionsOutput, error)
+}
@@ -0,0 +1,634 @@
+package handlers_ec2_launchtemplate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/filterutil"
+	"github.com/mulgadc/spinifex/spinifex/objectstore"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+)
+
+// Ensure LaunchTemplateServiceImpl implements LaunchTemplateService
+var _ LaunchTemplateService = (*LaunchTemplateServiceImpl)(nil)
+
+const (
+	// VersionDefault and VersionLatest select a template's default and most
+	// recent versions wherever a version number is accepted.
+	VersionDefault = "$Default"
+	VersionLatest  = "$Latest"
+
+	maxNameLength = 128
+	minNameLength = 3
+)
+
+// LaunchTemplateServiceImpl stores launch templates in the object store, one
+// JSON object per template holding every version.
+type LaunchTemplateServiceImpl struct {
+	store      objectstore.ObjectStore
+	bucketName string
+	// mu serialises read-modify-write of template objects on this node.
+	mu sync.Mutex
+}
+
+// LaunchTemplateRecord is a launch template as stored in the object store.
+type LaunchTemplateRecord struct {
+	LaunchTemplateId   string            `json:"launch_template_id"`
+	LaunchTemplateName string            `json:"launch_template_name"`
+	CreateTime         time.Time         `json:"create_time"`
+	CreatedBy          string            `json:"created_by"`
+	DefaultVersion     int64             `json:"default_version"`
+	LatestVersion      int64             `json:"latest_version"`
+	Tags               map[string]string `json:"tags,omitempty"`
+	Versions           []VersionRecord   `json:"versions"`
+}
+
+// VersionRecord is one immutable version of a launch template.
+type VersionRecord struct {
+	VersionNumber      int64                           `json:"version_number"`
+	VersionDescription string                          `json:"version_description,omitempty"`
+	CreateTime         time.Time                       `json:"create_time"`
+	CreatedBy          string                          `json:"created_by"`
+	Data               *ec2.ResponseLaunchTemplateData `json:"data"`
+}
+
+// NewLaunchTemplateServiceImpl creates a launch template service backed by
+// bucketName in store.
+func NewLaunchTemplateServiceImpl(store objectstore.ObjectStore, bucketName string) *LaunchTemplateServiceImpl {
+	return &LaunchTemplateServiceImpl{
+		store:      store,
+		bucketName: bucketName,
+	}
+}
+
+func templatePrefix(accountID string) string {
+	return fmt.Sprintf("launch-templates/%s/", accountID)
+}
+
+func templateKey(accountID, templateID string) string {
+	return templatePrefix(accountID) + templateID + ".json"
+}
+
+// ValidateTemplateRef checks that exactly one of a launch template ID and
+// name is given, and that the ID is well formed.
+func ValidateTemplateRef(templateID, templateName *string) error {
+	id, name := aws.StringValue(templateID), aws.StringValue(templateName)
+	switch {
+	case id == "" && name == "":
+		return errors.New(awserrors.ErrorMissingParameter)
+	case id != "" && name != "":
+		return errors.New(awserrors.ErrorInvalidParameterCombination)
+	case id != "" && !strings.HasPrefix(id, "lt-"):
+		return errors.New(awserrors.ErrorInvalidLaunchTemplateIdMalformed)
+	}
+	return nil
+}
+
+// ValidateTemplateName checks a launch template name against the EC2 rules:
+// 3-128 characters of letters, digits and -_./()
+func ValidateTemplateName(name string) error {
+	if len(name) < minNameLength || len(name) > maxNameLength {
+		return errors.New(awserrors.ErrorInvalidLaunchTemplateNameMalformedException)
+	}
+	for _, r := range name {
+		valid := (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') ||
+			strings.ContainsRune("-_./()", r)
+		if !valid {
+			return errors.New(awserrors.ErrorInvalidLaunchTemplateNameMalformedException)
+		}
+	}
+	return nil
+}
+
+// version returns the version selected by spec: a version number,
+// VersionDefault, VersionLatest, or "" for the default.
+func (r *LaunchTemplateRecord) version(spec string) (*VersionRecord, error) {
+	var number int64
+	switch spec {
+	case "", VersionDefault:
+		number = r.DefaultVersion
+	case VersionLatest:
+		number = r.LatestVersion
+	default:
+		n, err := strconv.ParseInt(spec, 10, 64)
+		if err != nil {
+			return nil, errors.New(awserrors.ErrorInvalidLaunchTemplateIdVersionNotFound)
+		}
+		number = n
+	}
+	for i := range r.Versions {
+		if r.Versions[i].VersionNumber == number {
+			return &r.Versions[i], nil
+		}
+	}
+	return nil, errors.New(awserrors.ErrorInvalidLaunchTemplateIdVersionNotFound)
+}
+
+func (s *LaunchTemplateServiceImpl) getTemplate(accountID, templateID string) (*LaunchTemplateRecord, error) {
+	result, err := s.store.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(templateKey(accountID, templateID)),
+	})
+	if err != nil {
+		if objectstore.IsNoSuchKeyError(err) {
+			return nil, errors.New(awserrors.ErrorInvalidLaunchTemplateIdNotFound)
+		}
+		slog.Error("Failed to read launch template", "launchTemplateId", templateID, "err", err)
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+	defer result.Body.Close()
+
+	var record LaunchTemplateRecord
+	if err := json.NewDecoder(result.Body).Decode(&record); err != nil {
+		slog.Error("Failed to decode launch template", "launchTemplateId", templateID, "err", err)
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+	return &record, nil
+}
+
+func (s *LaunchTemplateServiceImpl) putTemplate(accountID string, record *LaunchTemplateRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("marshal launch template: %w", err)
+	}
+	if _, err := s.store.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(s.bucketName),
+		Key:         aws.String(templateKey(accountID, record.LaunchTemplateId)),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	}); err != nil {
+		slog.Error("Failed to write launch template", "launchTemplateId", record.LaunchTemplateId, "err", err)
+		return errors.New(awserrors.ErrorServerInternal)
+	}
+	return nil
+}
+
+// listTemplates returns every launch template owned by accountID.
+func (s *LaunchTemplateServiceImpl) listTemplates(accountID string) ([]*LaunchTemplateRecord, error) {
+	result, err := s.store.ListObjectsV2(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucketName),
+		Prefix: aws.String(templatePrefix(accountID)),
+	})
+	if err != nil {
+		slog.Error("Failed to list launch templates", "accountID", accountID, "err", err)
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+
+	var records []*LaunchTemplateRecord
+	for _, obj := range result.Contents {
+		if obj.Key == nil || !strings.HasSuffix(*obj.Key, ".json") {
+			continue
+		}
+		getResult, err := s.store.GetObject(&s3.GetObjectInput{
+			Bucket: aws.String(s.bucketName),
+			Key:    obj.Key,
+		})
+		if err != nil {
+			slog.Debug("Failed to get launch template", "key", *obj.Key, "err", err)
+			continue
+		}
+		body, err := io.ReadAll(getResult.Body)
+		_ = getResult.Body.Close()
+		if err != nil {
+			slog.Debug("Failed to read launch template", "key", *obj.Key, "err", err)
+			continue
+		}
+		var record LaunchTemplateRecord
+		if err := json.Unmarshal(body, &record); err != nil {
+			slog.Warn("Failed to unmarshal launch template", "key", *obj.Key, "err", err)
+			continue
+		}
+		records = append(records, &record)
+	}
+	slices.SortFunc(records, func(a, b *LaunchTemplateRecord) int {
+		return a.CreateTime.Compare(b.CreateTime)
+	})
+	return records, nil
+}
+
+// resolveTemplate loads the template named by exactly one of templateID and
+// templateName.
+func (s *LaunchTemplateServiceImpl) resolveTemplate(accountID string, templateID, templateName *string) (*LaunchTemplateRecord, error) {
+	if err := ValidateTemplateRef(templateID, templateName); err != nil {
+		return nil, err
+	}
+	if id := aws.StringValue(templateID); id != "" {
+		return s.getTemplate(accountID, id)
+	}
+
+	name := aws.StringValue(templateName)
+	records, err := s.listTemplates(accountID)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		if record.LaunchTemplateName == name {
+			return record, nil
+		}
+	}
+	return nil, errors.New(awserrors.ErrorInvalidLaunchTemplateNameNotFoundException)
+}
+
+// requestToResponseData converts request-shaped launch template data into
+// the response shape it is stored and returned in. The two mirror each other
+// field for field, so the conversion goes through JSON.
+func requestToResponseData(req *ec2.RequestLaunchTemplateData) (*ec2.ResponseLaunchTemplateData, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var resp ec2.ResponseLaunchTemplateData
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// overlayData returns base with every field set in overlay replacing its
+// counterpart, as CreateLaunchTemplateVersion does with a source version.
+func overlayData(base, overlay *ec2.ResponseLaunchTemplateData) (*ec2.ResponseLaunchTemplateData, error) {
+	merged := make(map[string]json.RawMessage)
+	for _, data := range []*ec2.ResponseLaunchTemplateData{base, overlay} {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return nil, err
+		}
+		for name, value := range fields {
+			if string(value) != "null" {
+				merged[name] = value
+			}
+		}
+	}
+	raw, err := json.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	var result ec2.ResponseLaunchTemplateData
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func createdBy(accountID string) string {
+	return fmt.Sprintf("arn:aws:iam::%s:root", accountID)
+}
+
+// CreateLaunchTemplate creates a launch template with its data as version 1.
+func (s *LaunchTemplateServiceImpl) CreateLaunchTemplate(input *ec2.CreateLaunchTemplateInput, accountID string) (*ec2.CreateLaunchTemplateOutput, error) {
+	if input == nil || input.LaunchTemplateName == nil || input.LaunchTemplateData == nil {
+		return nil, errors.New(awserrors.ErrorMissingParameter)
+	}
+	name := *input.LaunchTemplateName
+	if err := ValidateTemplateName(name); err != nil {
+		return nil, err
+	}
+
+	data, err := requestToResponseData(input.LaunchTemplateData)
+	if err != nil {
+		slog.Warn("CreateLaunchTemplate: invalid launch template data", "err", err)
+		return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records, err := s.listTemplates(accountID)
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		if record.LaunchTemplateName == name {
+			return nil, errors.New(awserrors.ErrorInvalidLaunchTemplateNameAlreadyExistsException)
+		}
+	}
+
+	now := time.Now().UTC()
+	record := &LaunchTemplateRecord{
+		LaunchTemplateId:   utils.GenerateResourceID("lt"),
+		LaunchTemplateName: name,
+		CreateTime:         now,
+		CreatedBy:          createdBy(accountID),
+		DefaultVersion:     1,
+		LatestVersion:      1,
+		Tags:               utils.ExtractTags(input.TagSpecifications, "launch-template"),
+		Versions: []VersionRecord{{
+			VersionNumber:      1,
+			VersionDescription: aws.StringValue(input.VersionDescription),
+			CreateTime:         now,
+			CreatedBy:          createdBy(accountID),
+			Data:               data,
+		}},
+	}
+	if err := s.putTemplate(accountID, record); err != nil {
+		return nil, err
+	}
+
+	slog.Info("CreateLaunchTemplate completed", "launchTemplateId", record.LaunchTemplateId, "name", name, "accountID", accountID)
+
+	return &ec2.CreateLaunchTemplateOutput{
+		LaunchTemplate: templateToEC2(record),
+	}, nil
+}
+
+// CreateLaunchTemplateVersion adds a version to a launch template. With a
+// SourceVersion the new data overlays that version's.
+func (s *LaunchTemplateServiceImpl) CreateLaunchTemplateVersion(input *ec2.CreateLaunchTemplateVersionInput, accountID string) (*ec2.CreateLaunchTemplateVersionOutput, error) {
+	if input == nil || input.LaunchTemplateData == nil {
+		return nil, errors.New(awserrors.ErrorMissingParameter)
+	}
+
+	data, err := requestToResponseData(input.LaunchTemplateData)
+	if err != nil {
+		slog.Warn("CreateLaunchTemplateVersion: invalid launch template data", "err", err)
+		return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, err := s.resolveTemplate(accountID, input.LaunchTemplateId, input.LaunchTemplateName)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.SourceVersion != nil {
+		source, err := record.version(*input.SourceVersion)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = overlayData(source.Data, data); err != nil {
+			slog.Error("CreateLaunchTemplateVersion: failed to merge source version", "err", err)
+			return nil, errors.New(awserrors.ErrorServerInternal)
+		}
+	}
+
+	record.LatestVersion++
+	record.Versions = append(record.Versions, VersionRecord{
+		VersionNumber:      record.LatestVersion,
+		VersionDescription: aws.StringValue(input.VersionDescription),
+		CreateTime:         time.Now().UTC(),
+		CreatedBy:          createdBy(accountID),
+		Data:               data,
+	})
+	if err := s.putTemplate(accountID, record); err != nil {
+		return nil, err
+	}
+
+	slog.Info("CreateLaunchTemplateVersion completed", "launchTemplateId", record.LaunchTemplateId, "version", record.LatestVersion, "accountID", accountID)
+
+	return &ec2.CreateLaunchTemplateVersionOutput{
+		LaunchTemplateVersion: versionToEC2(record, &record.Versions[len(record.Versions)-1]),
+	}, nil
+}
+
+// ModifyLaunchTemplate changes which version of a launch template is the default.
+func (s *LaunchTemplateServiceImpl) ModifyLaunchTemplate(input *ec2.ModifyLaunchTemplateInput, accountID string) (*ec2.ModifyLaunchTemplateOutput, error) {
+	if input == nil {
+		return nil, errors.New(awserrors.ErrorMissingParameter)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, err := s.resolveTemplate(accountID, input.LaunchTemplateId, input.LaunchTemplateName)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.DefaultVersion != nil {
+		// $Default would be a no-op and is rejected like an unknown version
+		if *input.DefaultVersion == VersionDefault {
+			return nil, errors.New(awserrors.ErrorInvalidLaunchTemplateIdVersionNotFound)
+		}
+		version, err := record.version(*input.DefaultVersion)
+		if err != nil {
+			return nil, err
+		}
+		record.DefaultVersion = version.VersionNumber
+		if err := s.putTemplate(accountID, record); err != nil {
+			return nil, err
+		}
+	}
+
+	slog.Info("ModifyLaunchTemplate completed", "launchTemplateId", record.LaunchTemplateId, "defaultVersion", record.DefaultVersion, "accountID", accountID)
+
+	return &ec2.ModifyLaunchTemplateOutput{
+		LaunchTemplate: templateToEC2(record),
+	}, nil
+}
+
+// DeleteLaunchTemplate deletes a launch template and all its versions.
+func (s *LaunchTemplateServiceImpl) DeleteLaunchTemplate(input *ec2.DeleteLaunchTemplateInput, accountID string) (*ec2.DeleteLaunchTemplateOutput, error) {
+	if input == nil {
+		return nil, errors.New(awserrors.ErrorMissingParameter)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, err := s.resolveTemplate(accountID, input.LaunchTemplateId, input.LaunchTemplateName)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.store.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(templateKey(accountID, record.LaunchTemplateId)),
+	}); err != nil {
+		slog.Error("Failed to delete launch template", "launchTemplateId", record.LaunchTemplateId, "err", err)
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+
+	slog.Info("DeleteLaunchTemplate completed", "launchTemplateId", record.LaunchTemplateId, "accountID", accountID)
+
+	return &ec2.DeleteLaunchTemplateOutput{
+		LaunchTemplate: templateToEC2(record),
+	}, nil
+}
+
+// describeLaunchTemplatesValidFilters defines the set of filter names accepted by DescribeLaunchTemplates.
+var describeLaunchTemplatesValidFilters = map[string]bool{
+	"launch-template-name": true,
+	"tag-key":              true,
+}
+
+// DescribeLaunchTemplates lists the account's launch templates.
+func (s *LaunchTemplateServiceImpl) DescribeLaunchTemplates(input *ec2.DescribeLaunchTemplatesInput, accountID string) (*ec2.DescribeLaunchTemplatesOutput, error) {
+	if input == nil {
+		input = &ec2.DescribeLaunchTemplatesInput{}
+	}
+
+	parsedFilters, err := filterutil.ParseFilters(input.Filters, describeLaunchTemplatesValidFilters)
+	if err != nil {
+		slog.Warn("DescribeLaunchTemplates: invalid filter", "err", err)
+		return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+
+	ids := aws.StringValueSlice(input.LaunchTemplateIds)
+	for _, id := range ids {
+		if !strings.HasPrefix(id, "lt-") {
+			return nil, errors.New(awserrors.ErrorInvalidLaunchTemplateIdMalformed)
+		}
+	}
+	names := aws.StringValueSlice(input.LaunchTemplateNames)
+
+	records, err := s.listTemplates(accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	var templates []*ec2.LaunchTemplate
+	foundIDs := make(map[string]bool)
+	foundNames := make(map[string]bool)
+	for _, record := range records {
+		if len(ids) > 0 && !slices.Contains(ids, record.LaunchTemplateId) {
+			continue
+		}
+		if len(names) > 0 && !slices.Contains(names, record.LaunchTemplateName) {
+			continue
+		}
+		foundIDs[record.LaunchTemplateId] = true
+		foundNames[record.LaunchTemplateName] = true
+		if len(parsedFilters) > 0 && !templateMatchesFilters(record, parsedFilters) {
+			continue
+		}
+		templates = append(templates, templateToEC2(record))
+	}
+
+	for _, id := range ids {
+		if !foundIDs[id] {
+			return nil, errors.New(awserrors.ErrorInvalidLaunchTemplateIdNotFound)
+		}
+	}
+	for _, name := range names {
+		if !foundNames[name] {
+			return nil, errors.New(awserrors.ErrorInvalidLaunchTemplateNameNotFoundException)
+		}
+	}
+
+	slog.Info("DescribeLaunchTemplates completed", "count", len(templates), "accountID", accountID)
+
+	return &ec2.DescribeLaunchTemplatesOutput{
+		LaunchTemplates: templates,
+	}, nil
+}
+
+// DescribeLaunchTemplateVersions lists versions of a launch template: those
+// named in Versions, or every version between MinVersion and MaxVersion.
+func (s *LaunchTemplateServiceImpl) DescribeLaunchTemplateVersions(input *ec2.DescribeLaunchTemplateVersionsInput, accountID string) (*ec2.DescribeLaunchTemplateVersionsOutput, error) {
+	if input == nil {
+		return nil, errors.New(awserrors.ErrorMissingParameter)
+	}
+
+	record, err := s.resolveTemplate(accountID, input.LaunchTemplateId, input.LaunchTemplateName)
+	if err != nil {
+		return nil, err
+	}
+
+	minVersion, maxVersion := int64(0), record.LatestVersion
+	for _, bound := range []struct {
+		spec  *string
+		value *int64
+	}{{input.MinVersion, &minVersion}, {input.MaxVersion, &maxVersion}} {
+		if bound.spec == nil {
+			continue
+		}
+		n, err := strconv.ParseInt(*bound.spec, 10, 64)
+		if err != nil {
+			return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+		}
+		*bound.value = n
+	}
+
+	var versions []*ec2.LaunchTemplateVersion
+	if len(input.Versions) > 0 {
+		seen := make(map[int64]bool)
+		for _, spec := range aws.StringValueSlice(input.Versions) {
+			version, err := record.version(spec)
+			if err != nil {
+				return nil, err
+			}
+			if !seen[version.VersionNumber] {
+				seen[version.VersionNumber] = true
+				versions = append(versions, versionToEC2(record, version))
+			}
+		}
+	} else {
+		for i := range record.Versions {
+			version := &record.Versions[i]
+			if version.VersionNumber < minVersion || version.VersionNumber > maxVersion {
+				continue
+			}
+			versions = append(versions, versionToEC2(record, version))
+		}
+	}
+
+	slog.Info("DescribeLaunchTemplateVersions completed", "launchTemplateId", record.LaunchTemplateId, "count", len(versions), "accountID", accountID)
+
+	return &ec2.DescribeLaunchTemplateVersionsOutput{
+		LaunchTemplateVersions: versions,
+	}, nil
+}
+
+// templateMatchesFilters checks whether a LaunchTemplateRecord satisfies all parsed filters.
+func templateMatchesFilters(record *LaunchTemplateRecord, filters map[string][]string) bool {
+	for name, values := range filters {
+		switch name {
+		case "launch-template-name":
+			if !filterutil.MatchesAny(values, record.LaunchTemplateName) {
+				return false
+			}
+		case "tag-key":
+			if !filterutil.MatchesTagKey(values, record.Tags) {
+				return false
+			}
+		}
+	}
+	return filterutil.MatchesTags(filters, record.Tags)
+}
+
+func templateToEC2(record *LaunchTemplateRecord) *ec2.LaunchTemplate {
+	return &ec2.LaunchTemplate{
+		LaunchTemplateId:     aws.String(record.LaunchTemplateId),
+		LaunchTemplateName:   aws.String(record.LaunchTemplateName),
+		CreateTime:           aws.Time(record.CreateTime),
+		CreatedBy:            aws.String(record.CreatedBy),
+		DefaultVersionNumber: aws.Int64(record.DefaultVersion),
+		LatestVersionNumber:  aws.Int64(record.LatestVersion),
+		Tags:                 utils.MapToEC2Tags(record.Tags),
+	}
+}
+
+func versionToEC2(record *LaunchTemplateRecord, version *VersionRecord) *ec2.LaunchTemplateVersion {
+	out := &ec2.LaunchTemplateVersion{
+		LaunchTemplateId:   aws.String(record.LaunchTemplateId),
+		LaunchTemplateName: aws.String(record.LaunchTemplateName),
+		VersionNumber:      aws.Int64(version.VersionNumber),
+		CreateTime:         aws.Time(version.CreateTime),
+		CreatedBy:          aws.String(version.CreatedBy),
+		DefaultVersion:     aws.Bool(version.VersionNumber == record.DefaultVersion),
+		LaunchTemplateData: version.Data,
+	}
+	if version.VersionDescription != "" {
+		out.VersionDescription = aws.String(version.VersionDescription)
+	}
+	return out
+}
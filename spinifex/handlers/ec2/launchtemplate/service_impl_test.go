@@ -0,0 +1,314 @@
+package handlers_ec2_launchtemplate
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/objectstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testBucket    = "test-bucket"
+	testAccountID = "123456789012"
+)
+
+func newTestService() *LaunchTemplateServiceImpl {
+	return NewLaunchTemplateServiceImpl(objectstore.NewMemoryObjectStore(), testBucket)
+}
+
+func createTestTemplate(t *testing.T, svc *LaunchTemplateServiceImpl, name string) *ec2.LaunchTemplate {
+	t.Helper()
+	out, err := svc.CreateLaunchTemplate(&ec2.CreateLaunchTemplateInput{
+		LaunchTemplateName: aws.String(name),
+		LaunchTemplateData: &ec2.RequestLaunchTemplateData{
+			ImageId:          aws.String("ami-0123456789abcdef0"),
+			InstanceType:     aws.String("t3.micro"),
+			KeyName:          aws.String("my-key"),
+			SecurityGroupIds: aws.StringSlice([]string{"sg-1"}),
+		},
+		TagSpecifications: []*ec2.TagSpecification{{
+			ResourceType: aws.String("launch-template"),
+			Tags:         []*ec2.Tag{{Key: aws.String("env"), Value: aws.String("test")}},
+		}},
+	}, testAccountID)
+	require.NoError(t, err)
+	return out.LaunchTemplate
+}
+
+func TestCreateLaunchTemplate(t *testing.T) {
+	svc := newTestService()
+	lt := createTestTemplate(t, svc, "web-servers")
+
+	assert.Regexp(t, `^lt-`, *lt.LaunchTemplateId)
+	assert.Equal(t, "web-servers", *lt.LaunchTemplateName)
+	assert.Equal(t, int64(1), *lt.DefaultVersionNumber)
+	assert.Equal(t, int64(1), *lt.LatestVersionNumber)
+	assert.Equal(t, "arn:aws:iam::123456789012:root", *lt.CreatedBy)
+	require.Len(t, lt.Tags, 1)
+
+	_, err := svc.CreateLaunchTemplate(&ec2.CreateLaunchTemplateInput{
+		LaunchTemplateName: aws.String("web-servers"),
+		LaunchTemplateData: &ec2.RequestLaunchTemplateData{},
+	}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorInvalidLaunchTemplateNameAlreadyExistsException)
+
+	// Names are per account
+	_, err = svc.CreateLaunchTemplate(&ec2.CreateLaunchTemplateInput{
+		LaunchTemplateName: aws.String("web-servers"),
+		LaunchTemplateData: &ec2.RequestLaunchTemplateData{},
+	}, "210987654321")
+	assert.NoError(t, err)
+}
+
+func TestCreateLaunchTemplate_Invalid(t *testing.T) {
+	svc := newTestService()
+
+	_, err := svc.CreateLaunchTemplate(&ec2.CreateLaunchTemplateInput{LaunchTemplateName: aws.String("web")}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorMissingParameter)
+
+	for _, name := range []string{"ab", "web servers", "web*"} {
+		_, err := svc.CreateLaunchTemplate(&ec2.CreateLaunchTemplateInput{
+			LaunchTemplateName: aws.String(name),
+			LaunchTemplateData: &ec2.RequestLaunchTemplateData{},
+		}, testAccountID)
+		assert.EqualError(t, err, awserrors.ErrorInvalidLaunchTemplateNameMalformedException, name)
+	}
+}
+
+func TestCreateLaunchTemplateVersion(t *testing.T) {
+	svc := newTestService()
+	lt := createTestTemplate(t, svc, "web-servers")
+
+	// From scratch: only the given data
+	out, err := svc.CreateLaunchTemplateVersion(&ec2.CreateLaunchTemplateVersionInput{
+		LaunchTemplateId:   lt.LaunchTemplateId,
+		LaunchTemplateData: &ec2.RequestLaunchTemplateData{InstanceType: aws.String("t3.large")},
+	}, testAccountID)
+	require.NoError(t, err)
+	v2 := out.LaunchTemplateVersion
+	assert.Equal(t, int64(2), *v2.VersionNumber)
+	assert.False(t, *v2.DefaultVersion)
+	assert.Nil(t, v2.LaunchTemplateData.ImageId)
+
+	// From a source version: overlays its data
+	out, err = svc.CreateLaunchTemplateVersion(&ec2.CreateLaunchTemplateVersionInput{
+		LaunchTemplateName: aws.String("web-servers"),
+		SourceVersion:      aws.String("1"),
+		VersionDescription: aws.String("bigger"),
+		LaunchTemplateData: &ec2.RequestLaunchTemplateData{InstanceType: aws.String("t3.large")},
+	}, testAccountID)
+	require.NoError(t, err)
+	v3 := out.LaunchTemplateVersion
+	assert.Equal(t, int64(3), *v3.VersionNumber)
+	assert.Equal(t, "bigger", *v3.VersionDescription)
+	assert.Equal(t, "t3.large", *v3.LaunchTemplateData.InstanceType)
+	assert.Equal(t, "ami-0123456789abcdef0", *v3.LaunchTemplateData.ImageId)
+	assert.Equal(t, []string{"sg-1"}, aws.StringValueSlice(v3.LaunchTemplateData.SecurityGroupIds))
+
+	_, err = svc.CreateLaunchTemplateVersion(&ec2.CreateLaunchTemplateVersionInput{
+		LaunchTemplateId:   lt.LaunchTemplateId,
+		SourceVersion:      aws.String("9"),
+		LaunchTemplateData: &ec2.RequestLaunchTemplateData{},
+	}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorInvalidLaunchTemplateIdVersionNotFound)
+
+	_, err = svc.CreateLaunchTemplateVersion(&ec2.CreateLaunchTemplateVersionInput{
+		LaunchTemplateId:   aws.String("lt-0000000000000000"),
+		LaunchTemplateData: &ec2.RequestLaunchTemplateData{},
+	}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorInvalidLaunchTemplateIdNotFound)
+
+	_, err = svc.CreateLaunchTemplateVersion(&ec2.CreateLaunchTemplateVersionInput{
+		LaunchTemplateName: aws.String("missing"),
+		LaunchTemplateData: &ec2.RequestLaunchTemplateData{},
+	}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorInvalidLaunchTemplateNameNotFoundException)
+}
+
+func TestModifyLaunchTemplate(t *testing.T) {
+	svc := newTestService()
+	lt := createTestTemplate(t, svc, "web-servers")
+	_, err := svc.CreateLaunchTemplateVersion(&ec2.CreateLaunchTemplateVersionInput{
+		LaunchTemplateId:   lt.LaunchTemplateId,
+		LaunchTemplateData: &ec2.RequestLaunchTemplateData{InstanceType: aws.String("t3.large")},
+	}, testAccountID)
+	require.NoError(t, err)
+
+	out, err := svc.ModifyLaunchTemplate(&ec2.ModifyLaunchTemplateInput{
+		LaunchTemplateId: lt.LaunchTemplateId,
+		DefaultVersion:   aws.String("2"),
+	}, testAccountID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), *out.LaunchTemplate.DefaultVersionNumber)
+
+	versions, err := svc.DescribeLaunchTemplateVersions(&ec2.DescribeLaunchTemplateVersionsInput{
+		LaunchTemplateId: lt.LaunchTemplateId,
+		Versions:         aws.StringSlice([]string{VersionDefault}),
+	}, testAccountID)
+	require.NoError(t, err)
+	require.Len(t, versions.LaunchTemplateVersions, 1)
+	assert.Equal(t, "t3.large", *versions.LaunchTemplateVersions[0].LaunchTemplateData.InstanceType)
+
+	_, err = svc.ModifyLaunchTemplate(&ec2.ModifyLaunchTemplateInput{
+		LaunchTemplateId: lt.LaunchTemplateId,
+		DefaultVersion:   aws.String("5"),
+	}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorInvalidLaunchTemplateIdVersionNotFound)
+}
+
+func TestDescribeLaunchTemplates(t *testing.T) {
+	svc := newTestService()
+	web := createTestTemplate(t, svc, "web-servers")
+	createTestTemplate(t, svc, "db-servers")
+
+	out, err := svc.DescribeLaunchTemplates(&ec2.DescribeLaunchTemplatesInput{}, testAccountID)
+	require.NoError(t, err)
+	assert.Len(t, out.LaunchTemplates, 2)
+
+	out, err = svc.DescribeLaunchTemplates(&ec2.DescribeLaunchTemplatesInput{
+		LaunchTemplateIds: []*string{web.LaunchTemplateId},
+	}, testAccountID)
+	require.NoError(t, err)
+	require.Len(t, out.LaunchTemplates, 1)
+	assert.Equal(t, "web-servers", *out.LaunchTemplates[0].LaunchTemplateName)
+
+	out, err = svc.DescribeLaunchTemplates(&ec2.DescribeLaunchTemplatesInput{
+		Filters: []*ec2.Filter{{Name: aws.String("launch-template-name"), Values: aws.StringSlice([]string{"db-*"})}},
+	}, testAccountID)
+	require.NoError(t, err)
+	require.Len(t, out.LaunchTemplates, 1)
+	assert.Equal(t, "db-servers", *out.LaunchTemplates[0].LaunchTemplateName)
+
+	_, err = svc.DescribeLaunchTemplates(&ec2.DescribeLaunchTemplatesInput{
+		LaunchTemplateIds: aws.StringSlice([]string{"lt-0000000000000000"}),
+	}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorInvalidLaunchTemplateIdNotFound)
+
+	_, err = svc.DescribeLaunchTemplates(&ec2.DescribeLaunchTemplatesInput{
+		LaunchTemplateIds: aws.StringSlice([]string{"web-servers"}),
+	}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorInvalidLaunchTemplateIdMalformed)
+
+	_, err = svc.DescribeLaunchTemplates(&ec2.DescribeLaunchTemplatesInput{
+		LaunchTemplateNames: aws.StringSlice([]string{"missing"}),
+	}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorInvalidLaunchTemplateNameNotFoundException)
+}
+
+func TestDescribeLaunchTemplateVersions(t *testing.T) {
+	svc := newTestService()
+	lt := createTestTemplate(t, svc, "web-servers")
+	for range 2 {
+		_, err := svc.CreateLaunchTemplateVersion(&ec2.CreateLaunchTemplateVersionInput{
+			LaunchTemplateId:   lt.LaunchTemplateId,
+			SourceVersion:      aws.String(VersionLatest),
+			LaunchTemplateData: &ec2.RequestLaunchTemplateData{},
+		}, testAccountID)
+		require.NoError(t, err)
+	}
+
+	out, err := svc.DescribeLaunchTemplateVersions(&ec2.DescribeLaunchTemplateVersionsInput{LaunchTemplateId: lt.LaunchTemplateId}, testAccountID)
+	require.NoError(t, err)
+	assert.Len(t, out.LaunchTemplateVersions, 3)
+	assert.True(t, *out.LaunchTemplateVersions[0].DefaultVersion)
+
+	out, err = svc.DescribeLaunchTemplateVersions(&ec2.DescribeLaunchTemplateVersionsInput{
+		LaunchTemplateName: aws.String("web-servers"),
+		MinVersion:         aws.String("2"),
+	}, testAccountID)
+	require.NoError(t, err)
+	assert.Len(t, out.LaunchTemplateVersions, 2)
+
+	out, err = svc.DescribeLaunchTemplateVersions(&ec2.DescribeLaunchTemplateVersionsInput{
+		LaunchTemplateId: lt.LaunchTemplateId,
+		Versions:         aws.StringSlice([]string{VersionLatest, "3"}),
+	}, testAccountID)
+	require.NoError(t, err)
+	require.Len(t, out.LaunchTemplateVersions, 1)
+	assert.Equal(t, int64(3), *out.LaunchTemplateVersions[0].VersionNumber)
+
+	_, err = svc.DescribeLaunchTemplateVersions(&ec2.DescribeLaunchTemplateVersionsInput{
+		LaunchTemplateId: lt.LaunchTemplateId,
+		Versions:         aws.StringSlice([]string{"7"}),
+	}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorInvalidLaunchTemplateIdVersionNotFound)
+
+	_, err = svc.DescribeLaunchTemplateVersions(&ec2.DescribeLaunchTemplateVersionsInput{}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorMissingParameter)
+}
+
+func TestDeleteLaunchTemplate(t *testing.T) {
+	svc := newTestService()
+	lt := createTestTemplate(t, svc, "web-servers")
+	createTestTemplate(t, svc, "db-servers")
+
+	out, err := svc.DeleteLaunchTemplate(&ec2.DeleteLaunchTemplateInput{LaunchTemplateId: lt.LaunchTemplateId}, testAccountID)
+	require.NoError(t, err)
+	assert.Equal(t, *lt.LaunchTemplateId, *out.LaunchTemplate.LaunchTemplateId)
+
+	_, err = svc.DeleteLaunchTemplate(&ec2.DeleteLaunchTemplateInput{LaunchTemplateName: aws.String("db-servers")}, testAccountID)
+	require.NoError(t, err)
+
+	_, err = svc.DeleteLaunchTemplate(&ec2.DeleteLaunchTemplateInput{LaunchTemplateId: lt.LaunchTemplateId}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorInvalidLaunchTemplateIdNotFound)
+
+	list, err := svc.DescribeLaunchTemplates(&ec2.DescribeLaunchTemplatesInput{}, testAccountID)
+	require.NoError(t, err)
+	assert.Empty(t, list.LaunchTemplates)
+}
+
+func TestValidateTemplateRef(t *testing.T) {
+	assert.EqualError(t, ValidateTemplateRef(nil, nil), awserrors.ErrorMissingParameter)
+	assert.EqualError(t, ValidateTemplateRef(aws.String("lt-1"), aws.String("web")), awserrors.ErrorInvalidParameterCombination)
+	assert.EqualError(t, ValidateTemplateRef(aws.String("web"), nil), awserrors.ErrorInvalidLaunchTemplateIdMalformed)
+	assert.NoError(t, ValidateTemplateRef(nil, aws.String("web")))
+}
+
+func TestApplyToRunInstances(t *testing.T) {
+	data := &ec2.ResponseLaunchTemplateData{
+		ImageId:          aws.String("ami-template"),
+		InstanceType:     aws.String("t3.micro"),
+		KeyName:          aws.String("template-key"),
+		SecurityGroupIds: aws.StringSlice([]string{"sg-template"}),
+		BlockDeviceMappings: []*ec2.LaunchTemplateBlockDeviceMapping{{
+			DeviceName: aws.String("/dev/sda1"),
+			Ebs:        &ec2.LaunchTemplateEbsBlockDevice{VolumeSize: aws.Int64(20), VolumeType: aws.String("gp3")},
+		}},
+		MetadataOptions: &ec2.LaunchTemplateInstanceMetadataOptions{HttpTokens: aws.String("required")},
+		TagSpecifications: []*ec2.LaunchTemplateTagSpecification{{
+			ResourceType: aws.String("instance"),
+			Tags:         []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String("web")}},
+		}},
+		NetworkInterfaces: []*ec2.LaunchTemplateInstanceNetworkInterfaceSpecification{{
+			DeviceIndex: aws.Int64(0), SubnetId: aws.String("subnet-template"),
+		}},
+	}
+	input := &ec2.RunInstancesInput{
+		MinCount:       aws.Int64(1),
+		MaxCount:       aws.Int64(2),
+		InstanceType:   aws.String("t3.large"),
+		LaunchTemplate: &ec2.LaunchTemplateSpecification{LaunchTemplateName: aws.String("web-servers")},
+	}
+
+	require.NoError(t, ApplyToRunInstances(input, data))
+
+	// RunInstances parameters win
+	assert.Equal(t, "t3.large", *input.InstanceType)
+	assert.Equal(t, int64(2), *input.MaxCount)
+	assert.Equal(t, "web-servers", *input.LaunchTemplate.LaunchTemplateName)
+
+	assert.Equal(t, "ami-template", *input.ImageId)
+	assert.Equal(t, "template-key", *input.KeyName)
+	assert.Equal(t, []string{"sg-template"}, aws.StringValueSlice(input.SecurityGroupIds))
+	require.Len(t, input.BlockDeviceMappings, 1)
+	assert.Equal(t, int64(20), *input.BlockDeviceMappings[0].Ebs.VolumeSize)
+	assert.Equal(t, "required", *input.MetadataOptions.HttpTokens)
+	require.Len(t, input.TagSpecifications, 1)
+	assert.Equal(t, "web", *input.TagSpecifications[0].Tags[0].Value)
+	require.Len(t, input.NetworkInterfaces, 1)
+	assert.Equal(t, "subnet-template", *input.NetworkInterfaces[0].SubnetId)
+}
@@ -0,0 +1,43 @@
+package handlers_ec2_launchtemplate
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+)
+
+// NATSLaunchTemplateService handles launch template operations via NATS messaging
+type NATSLaunchTemplateService struct {
+	natsConn *nats.Conn
+}
+
+// NewNATSLaunchTemplateService creates a new NATS-based launch template service
+func NewNATSLaunchTemplateService(conn *nats.Conn) LaunchTemplateService {
+	return &NATSLaunchTemplateService{natsConn: conn}
+}
+
+func (s *NATSLaunchTemplateService) CreateLaunchTemplate(input *ec2.CreateLaunchTemplateInput, accountID string) (*ec2.CreateLaunchTemplateOutput, error) {
+	return utils.NATSRequest[ec2.CreateLaunchTemplateOutput](s.natsConn, "ec2.CreateLaunchTemplate", input, 30*time.Second, accountID)
+}
+
+func (s *NATSLaunchTemplateService) CreateLaunchTemplateVersion(input *ec2.CreateLaunchTemplateVersionInput, accountID string) (*ec2.CreateLaunchTemplateVersionOutput, error) {
+	return utils.NATSRequest[ec2.CreateLaunchTemplateVersionOutput](s.natsConn, "ec2.CreateLaunchTemplateVersion", input, 30*time.Second, accountID)
+}
+
+func (s *NATSLaunchTemplateService) ModifyLaunchTemplate(input *ec2.ModifyLaunchTemplateInput, accountID string) (*ec2.ModifyLaunchTemplateOutput, error) {
+	return utils.NATSRequest[ec2.ModifyLaunchTemplateOutput](s.natsConn, "ec2.ModifyLaunchTemplate", input, 30*time.Second, accountID)
+}
+
+func (s *NATSLaunchTemplateService) DeleteLaunchTemplate(input *ec2.DeleteLaunchTemplateInput, accountID string) (*ec2.DeleteLaunchTemplateOutput, error) {
+	return utils.NATSRequest[ec2.DeleteLaunchTemplateOutput](s.natsConn, "ec2.DeleteLaunchTemplate", input, 30*time.Second, accountID)
+}
+
+func (s *NATSLaunchTemplateService) DescribeLaunchTemplates(input *ec2.DescribeLaunchTemplatesInput, accountID string) (*ec2.DescribeLaunchTemplatesOutput, error) {
+	return utils.NATSRequest[ec2.DescribeLaunchTemplatesOutput](s.natsConn, "ec2.DescribeLaunchTemplates", input, 30*time.Second, accountID)
+}
+
+func (s *NATSLaunchTemplateService) DescribeLaunchTemplateVersions(input *ec2.DescribeLaunchTemplateVersionsInput, accountID string) (*ec2.DescribeLaunchTemplateVersionsOutput, error) {
+	return utils.NATSRequest[ec2.DescribeLaunchTemplateVersionsOutput](s.natsConn, "ec2.DescribeLaunchTemplateVersions", input, 30*time.Second, accountID)
+}
@@ -976,7 +976,7 @@ func (s *RouteTableServiceImpl) publishNatGatewayEventForSubnet(accountID, topic
 		slog.Warn("NAT GW event: marshal failed", "topic", topic, "err", err)
 		return
 	}
-	if err := s.natsConn.Publish(topic, data); err != nil {
+	if err := s.natsConn.Publish(utils.Subject(topic), data); err != nil {
 		slog.Warn("NAT GW event: publish failed", "topic", topic, "subnetId", subnetID, "err", err)
 		return
 	}
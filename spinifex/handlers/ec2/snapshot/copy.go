@@ -0,0 +1,94 @@
+package handlers_ec2_snapshot
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+
+	vbtypes "github.com/mulgadc/viperblock/types"
+	"github.com/mulgadc/viperblock/viperblock"
+	s3backend "github.com/mulgadc/viperblock/viperblock/backends/s3"
+)
+
+// copyFlushBytes is how much of a volume is copied between writes of its
+// WAL to chunks.
+const copyFlushBytes = 4 * 1024 * 1024
+
+// CopyBlocks writes every block of snapshotID into the new volume vbconfig
+// and cfg describe, skipping zero blocks, so the volume holds its own copy
+// instead of reading the snapshot's blocks in place. vbconfig must not name
+// a snapshot. The volume's state is saved once the copy is complete. A
+// variable so tests can stand in for viperblock.
+var CopyBlocks = func(snapshotID string, vbconfig *viperblock.VB, cfg s3backend.S3Config) error {
+	// The source is only read, but keeps its local files apart from the
+	// volume's.
+	srcDir, err := os.MkdirTemp("", "spinifex-copy-")
+	if err != nil {
+		return fmt.Errorf("create source dir: %w", err)
+	}
+	defer os.RemoveAll(srcDir)
+
+	src, err := viperblock.New(&viperblock.VB{
+		VolumeName: vbconfig.VolumeName,
+		VolumeSize: vbconfig.VolumeSize,
+		BaseDir:    srcDir,
+		Cache:      viperblock.Cache{Config: viperblock.CacheConfig{Size: 0}},
+	}, "s3", cfg)
+	if err != nil {
+		return fmt.Errorf("create source viperblock instance: %w", err)
+	}
+	src.SetDebug(false)
+	if err := src.Backend.Init(); err != nil {
+		return fmt.Errorf("initialize source backend: %w", err)
+	}
+	if err := src.OpenFromSnapshot(snapshotID); err != nil {
+		return fmt.Errorf("open snapshot %s: %w", snapshotID, err)
+	}
+
+	dst, err := viperblock.New(vbconfig, "s3", cfg)
+	if err != nil {
+		return fmt.Errorf("create viperblock instance: %w", err)
+	}
+	dst.SetDebug(false)
+	if err := dst.Backend.Init(); err != nil {
+		return fmt.Errorf("initialize backend: %w", err)
+	}
+	if err := dst.OpenWAL(&dst.WAL, fmt.Sprintf("%s/%s", dst.WAL.BaseDir, vbtypes.GetFilePath(vbtypes.FileTypeWALChunk, dst.WAL.WallNum.Load(), dst.GetVolume()))); err != nil {
+		return fmt.Errorf("open WAL: %w", err)
+	}
+	if err := dst.OpenWAL(&dst.BlockToObjectWAL, fmt.Sprintf("%s/%s", dst.WAL.BaseDir, vbtypes.GetFilePath(vbtypes.FileTypeWALBlock, dst.BlockToObjectWAL.WallNum.Load(), dst.GetVolume()))); err != nil {
+		return fmt.Errorf("open block WAL: %w", err)
+	}
+
+	blockSize := uint64(dst.BlockSize)
+	zero := make([]byte, blockSize)
+	size := dst.GetVolumeSize()
+	for offset := uint64(0); offset < size; offset += copyFlushBytes {
+		n := min(copyFlushBytes, size-offset)
+		data, err := src.ReadAt(offset, n)
+		if err != nil && !errors.Is(err, viperblock.ErrZeroBlock) {
+			return fmt.Errorf("read at %d: %w", offset, err)
+		}
+		for i := uint64(0); i < n; i += blockSize {
+			block := data[i:min(i+blockSize, n)]
+			if bytes.Equal(block, zero[:len(block)]) {
+				continue
+			}
+			if err := dst.WriteAt(offset+i, block); err != nil {
+				return fmt.Errorf("write at %d: %w", offset+i, err)
+			}
+		}
+		if err := dst.Flush(); err != nil {
+			return fmt.Errorf("flush at %d: %w", offset, err)
+		}
+		if err := dst.WriteWALToChunk(true); err != nil {
+			return fmt.Errorf("write WAL to chunk at %d: %w", offset, err)
+		}
+	}
+
+	if err := dst.Close(); err != nil {
+		return fmt.Errorf("close volume: %w", err)
+	}
+	return nil
+}
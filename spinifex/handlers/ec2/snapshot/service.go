@@ -1,6 +1,10 @@
 package handlers_ec2_snapshot
 
-import "github.com/aws/aws-sdk-go/service/ec2"
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
 
 // SnapshotService defines the interface for EC2 snapshot operations
 type SnapshotService interface {
@@ -8,4 +12,53 @@ type SnapshotService interface {
 	DescribeSnapshots(input *ec2.DescribeSnapshotsInput, accountID string) (*ec2.DescribeSnapshotsOutput, error)
 	DeleteSnapshot(input *ec2.DeleteSnapshotInput, accountID string) (*ec2.DeleteSnapshotOutput, error)
 	CopySnapshot(input *ec2.CopySnapshotInput, accountID string) (*ec2.CopySnapshotOutput, error)
+	DescribeSnapshotTree(input *DescribeSnapshotTreeInput, accountID string) (*DescribeSnapshotTreeOutput, error)
+	CreateSnapshotsByTag(input *CreateSnapshotsByTagInput, accountID string) (*CreateSnapshotsByTagOutput, error)
+}
+
+// DescribeSnapshotTreeInput is the request for the DescribeSnapshotTree
+// spinifex extension. When SnapshotID is set only the lineage tree containing
+// that snapshot is returned; otherwise every tree owned by the caller is.
+type DescribeSnapshotTreeInput struct {
+	SnapshotID string `json:"snapshot_id,omitempty"`
+}
+
+// SnapshotTreeNode is a single snapshot in a lineage tree. Children are
+// snapshots taken from volumes restored from this snapshot, or copies of it.
+type SnapshotTreeNode struct {
+	SnapshotID       string              `json:"snapshot_id"`
+	VolumeID         string              `json:"volume_id"`
+	ParentSnapshotID string              `json:"parent_snapshot_id,omitempty"`
+	State            string              `json:"state"`
+	StartTime        time.Time           `json:"start_time"`
+	Volumes          []string            `json:"volumes,omitempty"` // volumes created from this snapshot
+	Children         []*SnapshotTreeNode `json:"children,omitempty"`
+}
+
+// DescribeSnapshotTreeOutput is the response for DescribeSnapshotTree.
+type DescribeSnapshotTreeOutput struct {
+	Roots []*SnapshotTreeNode `json:"roots"`
+}
+
+// CreateSnapshotsByTagInput is the request for the CreateSnapshotsByTag
+// spinifex extension. Every volume owned by the caller whose tags match all
+// of the tag:Key filters is snapshotted; Description and TagSpecifications
+// apply to each snapshot as they would to CreateSnapshot.
+type CreateSnapshotsByTagInput struct {
+	Filters           []*ec2.Filter           `locationName:"Filter" json:"filters"`
+	Description       *string                 `json:"description,omitempty"`
+	TagSpecifications []*ec2.TagSpecification `locationName:"TagSpecification" json:"tag_specifications,omitempty"`
+}
+
+// SnapshotResult reports the outcome for one volume in CreateSnapshotsByTag.
+// Error holds the AWS error code and is empty on success.
+type SnapshotResult struct {
+	SnapshotID string `json:"snapshot_id,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// CreateSnapshotsByTagOutput is the response for CreateSnapshotsByTag, keyed
+// by volume ID.
+type CreateSnapshotsByTagOutput struct {
+	Results map[string]SnapshotResult `json:"results"`
 }
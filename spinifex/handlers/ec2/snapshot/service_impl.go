@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log/slog"
 	"maps"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -22,6 +23,7 @@ import (
 	"github.com/mulgadc/spinifex/spinifex/objectstore"
 	"github.com/mulgadc/spinifex/spinifex/types"
 	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
 	"github.com/mulgadc/viperblock/viperblock"
 	"github.com/nats-io/nats.go"
 )
@@ -32,6 +34,16 @@ var _ SnapshotService = (*SnapshotServiceImpl)(nil)
 const (
 	KVBucketVolumeSnapshots        = "spinifex-volume-snapshots"
 	KVBucketVolumeSnapshotsVersion = 1
+
+	// maxConcurrentSnapshotsPerVolume caps the snapshots this node takes of
+	// one volume at once. Each one checkpoints the live viperblock block map,
+	// so a second request queues behind the first in the EBS daemon and only
+	// burns its timeout; it is rejected with ConcurrentSnapshotLimitExceeded.
+	maxConcurrentSnapshotsPerVolume = 1
+
+	// snapshotsByTagWorkers bounds how many volumes CreateSnapshotsByTag
+	// snapshots at once.
+	snapshotsByTagWorkers = 4
 )
 
 // SnapshotServiceImpl implements SnapshotService with S3-backed storage
@@ -41,6 +53,10 @@ type SnapshotServiceImpl struct {
 	natsConn *nats.Conn
 	snapKV   nats.KeyValue
 	mutex    sync.RWMutex
+
+	// inflight counts the snapshots in progress per volume ID.
+	inflightMu sync.Mutex
+	inflight   map[string]int
 }
 
 // SnapshotConfig represents snapshot metadata stored in S3
@@ -56,17 +72,17 @@ type SnapshotConfig struct {
 	OwnerID          string            `json:"owner_id"`
 	AvailabilityZone string            `json:"availability_zone"`
 	Tags             map[string]string `json:"tags"`
+	// ParentSnapshotID links this snapshot into its lineage: the snapshot the
+	// source volume was restored from, or the source of a CopySnapshot.
+	// Empty for root snapshots and for snapshots created before lineage tracking.
+	ParentSnapshotID string `json:"parent_snapshot_id,omitempty"`
+	// Encryption is the source volume's encryption record, so volumes
+	// restored from an encrypted snapshot can open its LUKS header.
+	Encryption *types.VolumeEncryption `json:"encryption,omitempty"`
 }
 
 // NewSnapshotServiceImplWithNATS creates a snapshot service with JetStream KV for volume-snapshot tracking
-func NewSnapshotServiceImplWithNATS(cfg *config.Config, natsConn *nats.Conn) (*SnapshotServiceImpl, nats.KeyValue, error) {
-	store := objectstore.NewS3ObjectStoreFromConfig(
-		cfg.Predastore.Host,
-		cfg.Predastore.Region,
-		cfg.Predastore.AccessKey,
-		cfg.Predastore.SecretKey,
-	)
-
+func NewSnapshotServiceImplWithNATS(cfg *config.Config, natsConn *nats.Conn, store objectstore.ObjectStore) (*SnapshotServiceImpl, nats.KeyValue, error) {
 	js, err := natsConn.JetStream()
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get JetStream context: %w", err)
@@ -162,6 +178,24 @@ func (s *SnapshotServiceImpl) getSnapshotConfig(snapshotID string) (*SnapshotCon
 	return cfg, nil
 }
 
+// readVolumeEncryption reads the encryption record of an encrypted volume.
+func (s *SnapshotServiceImpl) readVolumeEncryption(volumeID string) (*types.VolumeEncryption, error) {
+	result, err := s.store.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.config.Predastore.Bucket),
+		Key:    aws.String(types.VolumeEncryptionKey(volumeID)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer result.Body.Close()
+
+	var enc types.VolumeEncryption
+	if err := json.NewDecoder(result.Body).Decode(&enc); err != nil {
+		return nil, err
+	}
+	return &enc, nil
+}
+
 // putSnapshotConfig stores snapshot config to S3
 func (s *SnapshotServiceImpl) putSnapshotConfig(snapshotID string, cfg *SnapshotConfig) error {
 	return WriteSnapshotConfig(s.store, s.config.Predastore.Bucket, snapshotID, cfg)
@@ -180,6 +214,9 @@ func snapshotConfigToEC2(cfg *SnapshotConfig) *ec2.Snapshot {
 		Encrypted:   aws.Bool(cfg.Encrypted),
 		OwnerId:     aws.String(cfg.OwnerID),
 	}
+	if cfg.Encryption != nil {
+		snapshot.KmsKeyId = aws.String(cfg.Encryption.KmsKeyID)
+	}
 
 	if len(cfg.Tags) > 0 {
 		tags := make([]*ec2.Tag, 0, len(cfg.Tags))
@@ -203,8 +240,19 @@ func (s *SnapshotServiceImpl) CreateSnapshot(input *ec2.CreateSnapshotInput, acc
 
 	volumeID := *input.VolumeId
 
+	tags, err := utils.MergeDefaultTags(input.TagSpecifications, "snapshot", s.config.Daemon.DefaultTagsFor(accountID))
+	if err != nil {
+		return nil, err
+	}
+
 	slog.Info("CreateSnapshot request", "volumeId", volumeID)
 
+	if !s.beginSnapshot(volumeID) {
+		slog.Warn("CreateSnapshot: concurrent snapshot limit reached", "volumeId", volumeID, "limit", maxConcurrentSnapshotsPerVolume)
+		return nil, errors.New(awserrors.ErrorConcurrentSnapshotLimitExceeded)
+	}
+	defer s.endSnapshot(volumeID)
+
 	snapshotID := utils.GenerateResourceID("snap")
 
 	volumeConfigKey := fmt.Sprintf("%s/config.json", volumeID)
@@ -236,6 +284,14 @@ func (s *SnapshotServiceImpl) CreateSnapshot(input *ec2.CreateSnapshotInput, acc
 		return nil, errors.New(awserrors.ErrorServerInternal)
 	}
 
+	var encryption *types.VolumeEncryption
+	if volumeConfig.VolumeMetadata.IsEncrypted {
+		if encryption, err = s.readVolumeEncryption(volumeID); err != nil {
+			slog.Error("CreateSnapshot failed to read volume encryption record", "volumeId", volumeID, "err", err)
+			return nil, errors.New(awserrors.ErrorServerInternal)
+		}
+	}
+
 	// Trigger viperblock to flush data and create a frozen block map checkpoint.
 	// This sends a NATS message to the EBS daemon that owns the volume, which
 	// calls vb.CreateSnapshot() on the live viperblock instance.
@@ -247,7 +303,7 @@ func (s *SnapshotServiceImpl) CreateSnapshot(input *ec2.CreateSnapshotInput, acc
 			return nil, errors.New(awserrors.ErrorServerInternal)
 		}
 
-		msg, err := s.natsConn.Request(fmt.Sprintf("ebs.snapshot.%s", volumeID), snapData, 30*time.Second)
+		msg, err := s.natsConn.Request(utils.Subject(fmt.Sprintf("ebs.snapshot.%s", volumeID)), snapData, 30*time.Second)
 		if errors.Is(err, nats.ErrNoResponders) {
 			// Volume is not mounted — data is already persisted to S3, proceed with metadata-only snapshot.
 			slog.Info("CreateSnapshot: volume not mounted, creating metadata-only snapshot", "volumeId", volumeID, "snapshotId", snapshotID)
@@ -271,7 +327,7 @@ func (s *SnapshotServiceImpl) CreateSnapshot(input *ec2.CreateSnapshotInput, acc
 		slog.Warn("CreateSnapshot: natsConn is nil, skipping viperblock snapshot (metadata-only)", "volumeId", volumeID)
 	}
 
-	now := time.Now()
+	now := utils.Now()
 
 	snapshotCfg := &SnapshotConfig{
 		SnapshotID:       snapshotID,
@@ -283,7 +339,9 @@ func (s *SnapshotServiceImpl) CreateSnapshot(input *ec2.CreateSnapshotInput, acc
 		Encrypted:        volumeConfig.VolumeMetadata.IsEncrypted,
 		OwnerID:          accountID,
 		AvailabilityZone: volumeConfig.VolumeMetadata.AvailabilityZone,
-		Tags:             utils.ExtractTags(input.TagSpecifications, "snapshot"),
+		Tags:             tags,
+		ParentSnapshotID: volumeConfig.VolumeMetadata.SnapshotID,
+		Encryption:       encryption,
 	}
 
 	if input.Description != nil {
@@ -308,6 +366,139 @@ func (s *SnapshotServiceImpl) CreateSnapshot(input *ec2.CreateSnapshotInput, acc
 	return snapshotConfigToEC2(snapshotCfg), nil
 }
 
+// beginSnapshot reserves one of the volume's concurrent snapshot slots,
+// reporting false when they are all taken. A successful call must be paired
+// with endSnapshot.
+func (s *SnapshotServiceImpl) beginSnapshot(volumeID string) bool {
+	s.inflightMu.Lock()
+	defer s.inflightMu.Unlock()
+	if s.inflight[volumeID] >= maxConcurrentSnapshotsPerVolume {
+		return false
+	}
+	if s.inflight == nil {
+		s.inflight = make(map[string]int)
+	}
+	s.inflight[volumeID]++
+	return true
+}
+
+// endSnapshot releases a slot reserved by beginSnapshot.
+func (s *SnapshotServiceImpl) endSnapshot(volumeID string) {
+	s.inflightMu.Lock()
+	defer s.inflightMu.Unlock()
+	if s.inflight[volumeID]--; s.inflight[volumeID] <= 0 {
+		delete(s.inflight, volumeID)
+	}
+}
+
+// CreateSnapshotsByTag snapshots every volume owned by the caller whose tags
+// match the tag:Key filters. Volumes are snapshotted independently, a few at
+// a time, through CreateSnapshot, so each is subject to the per-volume
+// concurrent snapshot limit; a volume that fails is reported in the results
+// without stopping the rest.
+func (s *SnapshotServiceImpl) CreateSnapshotsByTag(input *CreateSnapshotsByTagInput, accountID string) (*CreateSnapshotsByTagOutput, error) {
+	if input == nil {
+		return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	filters, err := filterutil.ParseFilters(input.Filters, nil)
+	if err != nil {
+		return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	// Without a tag filter every volume would match.
+	if len(filters) == 0 {
+		return nil, errors.New(awserrors.ErrorMissingParameter)
+	}
+
+	volumeIDs, err := s.volumesMatchingTags(filters, accountID)
+	if err != nil {
+		slog.Error("CreateSnapshotsByTag failed to list volumes", "err", err)
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+
+	slog.Info("CreateSnapshotsByTag request", "volumes", len(volumeIDs), "accountID", accountID)
+
+	output := &CreateSnapshotsByTagOutput{Results: make(map[string]SnapshotResult, len(volumeIDs))}
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, snapshotsByTagWorkers)
+	)
+	for _, volumeID := range volumeIDs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			var result SnapshotResult
+			snap, err := s.CreateSnapshot(&ec2.CreateSnapshotInput{
+				VolumeId:          aws.String(volumeID),
+				Description:       input.Description,
+				TagSpecifications: input.TagSpecifications,
+			}, accountID)
+			if err != nil {
+				result.Error = err.Error()
+			} else {
+				result.SnapshotID = aws.StringValue(snap.SnapshotId)
+			}
+
+			mu.Lock()
+			output.Results[volumeID] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	return output, nil
+}
+
+// volumesMatchingTags returns the IDs of the caller's volumes whose tags
+// satisfy the tag:Key filters, in listing order.
+func (s *SnapshotServiceImpl) volumesMatchingTags(filters map[string][]string, accountID string) ([]string, error) {
+	listResult, err := s.store.ListObjectsV2(&s3.ListObjectsV2Input{
+		Bucket:    aws.String(s.config.Predastore.Bucket),
+		Prefix:    aws.String("vol-"),
+		Delimiter: aws.String("/"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volumes: %w", err)
+	}
+
+	var volumeIDs []string
+	for _, prefix := range listResult.CommonPrefixes {
+		if prefix.Prefix == nil {
+			continue
+		}
+		volumeID := strings.TrimSuffix(*prefix.Prefix, "/")
+
+		result, err := s.store.GetObject(&s3.GetObjectInput{
+			Bucket: aws.String(s.config.Predastore.Bucket),
+			Key:    aws.String(fmt.Sprintf("%s/config.json", volumeID)),
+		})
+		if err != nil {
+			continue // volume may not have a config yet
+		}
+
+		var state viperblock.VBState
+		decodeErr := json.NewDecoder(result.Body).Decode(&state)
+		_ = result.Body.Close()
+		if decodeErr != nil {
+			continue
+		}
+
+		metadata := state.VolumeConfig.VolumeMetadata
+		if accountID != "" && metadata.TenantID != "" && metadata.TenantID != accountID {
+			continue
+		}
+		if filterutil.MatchesTags(filters, metadata.Tags) {
+			volumeIDs = append(volumeIDs, volumeID)
+		}
+	}
+	return volumeIDs, nil
+}
+
 // describeSnapshotsValidFilters defines the set of filter names accepted by DescribeSnapshots.
 var describeSnapshotsValidFilters = map[string]bool{
 	"snapshot-id": true,
@@ -315,6 +506,7 @@ var describeSnapshotsValidFilters = map[string]bool{
 	"volume-id":   true,
 	"volume-size": true,
 	"owner-id":    true,
+	"tag-key":     true,
 }
 
 // DescribeSnapshots lists snapshots matching the specified criteria, scoped to the caller's account.
@@ -418,6 +610,11 @@ func snapshotMatchesFilters(cfg *SnapshotConfig, filters map[string][]string) bo
 			field = strconv.FormatInt(cfg.VolumeSize, 10)
 		case "owner-id":
 			field = cfg.OwnerID
+		case "tag-key":
+			if !filterutil.MatchesTagKey(values, cfg.Tags) {
+				return false
+			}
+			continue
 		default:
 			return false
 		}
@@ -432,15 +629,25 @@ func snapshotMatchesFilters(cfg *SnapshotConfig, filters map[string][]string) bo
 
 // snapshotInUseByVolumes checks if any volume was created from the given snapshot.
 func (s *SnapshotServiceImpl) snapshotInUseByVolumes(snapshotID string) (bool, error) {
+	volumes, err := s.volumesBySourceSnapshot()
+	if err != nil {
+		return false, fmt.Errorf("snapshotInUseByVolumes: %w", err)
+	}
+	return len(volumes[snapshotID]) > 0, nil
+}
+
+// volumesBySourceSnapshot maps each snapshot ID to the volumes created from it.
+func (s *SnapshotServiceImpl) volumesBySourceSnapshot() (map[string][]string, error) {
 	listResult, err := s.store.ListObjectsV2(&s3.ListObjectsV2Input{
 		Bucket:    aws.String(s.config.Predastore.Bucket),
 		Prefix:    aws.String("vol-"),
 		Delimiter: aws.String("/"),
 	})
 	if err != nil {
-		return false, fmt.Errorf("snapshotInUseByVolumes: failed to list volumes: %w", err)
+		return nil, fmt.Errorf("failed to list volumes: %w", err)
 	}
 
+	volumes := make(map[string][]string)
 	for _, prefix := range listResult.CommonPrefixes {
 		if prefix.Prefix == nil {
 			continue
@@ -463,11 +670,58 @@ func (s *SnapshotServiceImpl) snapshotInUseByVolumes(snapshotID string) (bool, e
 			continue
 		}
 
-		if state.VolumeConfig.VolumeMetadata.SnapshotID == snapshotID {
-			return true, nil
+		meta := state.VolumeConfig.VolumeMetadata
+		// A full copy reads the snapshot only while it is being created.
+		if meta.Tags[vm.CopyModeTag] == vm.CopyModeFull && meta.State != "creating" && state.SnapshotID == "" {
+			continue
+		}
+		if snapID := meta.SnapshotID; snapID != "" {
+			volumes[snapID] = append(volumes[snapID], volumeID)
+		}
+	}
+
+	return volumes, nil
+}
+
+// listSnapshotConfigs returns the metadata of every snapshot in the bucket.
+// Snapshots whose metadata cannot be read are skipped.
+func (s *SnapshotServiceImpl) listSnapshotConfigs() ([]*SnapshotConfig, error) {
+	listResult, err := s.store.ListObjectsV2(&s3.ListObjectsV2Input{
+		Bucket:    aws.String(s.config.Predastore.Bucket),
+		Prefix:    aws.String("snap-"),
+		Delimiter: aws.String("/"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+
+	var configs []*SnapshotConfig
+	for _, prefix := range listResult.CommonPrefixes {
+		if prefix.Prefix == nil {
+			continue
 		}
+		snapshotID := strings.TrimSuffix(*prefix.Prefix, "/")
+		cfg, err := s.getSnapshotConfig(snapshotID)
+		if err != nil {
+			slog.Warn("listSnapshotConfigs failed to get config", "snapshotId", snapshotID, "err", err)
+			continue
+		}
+		configs = append(configs, cfg)
 	}
+	return configs, nil
+}
 
+// snapshotHasChildren checks if any other snapshot lists snapshotID as its parent.
+func (s *SnapshotServiceImpl) snapshotHasChildren(snapshotID string) (bool, error) {
+	configs, err := s.listSnapshotConfigs()
+	if err != nil {
+		return false, fmt.Errorf("snapshotHasChildren: %w", err)
+	}
+	for _, cfg := range configs {
+		if cfg.ParentSnapshotID == snapshotID {
+			return true, nil
+		}
+	}
 	return false, nil
 }
 
@@ -504,6 +758,17 @@ func (s *SnapshotServiceImpl) DeleteSnapshot(input *ec2.DeleteSnapshotInput, acc
 		return nil, errors.New(awserrors.ErrorInvalidSnapshotInUse)
 	}
 
+	// Child snapshots share blocks with their parent, so the parent must outlive them.
+	hasChildren, err := s.snapshotHasChildren(snapshotID)
+	if err != nil {
+		slog.Error("DeleteSnapshot failed to check snapshot lineage", "snapshotId", snapshotID, "err", err)
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+	if hasChildren {
+		slog.Info("DeleteSnapshot blocked: snapshot has dependent snapshots", "snapshotId", snapshotID)
+		return nil, errors.New(awserrors.ErrorInvalidSnapshotInUse)
+	}
+
 	listResult, err := s.store.ListObjectsV2(&s3.ListObjectsV2Input{
 		Bucket: aws.String(s.config.Predastore.Bucket),
 		Prefix: aws.String(snapshotID + "/"),
@@ -568,12 +833,14 @@ func (s *SnapshotServiceImpl) CopySnapshot(input *ec2.CopySnapshotInput, account
 		VolumeSize:       sourceCfg.VolumeSize,
 		State:            "completed",
 		Progress:         "100%",
-		StartTime:        time.Now(),
+		StartTime:        utils.Now(),
 		Description:      sourceCfg.Description,
 		Encrypted:        sourceCfg.Encrypted,
 		OwnerID:          accountID,
 		AvailabilityZone: sourceCfg.AvailabilityZone,
 		Tags:             make(map[string]string),
+		ParentSnapshotID: sourceSnapshotID,
+		Encryption:       sourceCfg.Encryption,
 	}
 
 	if input.Description != nil {
@@ -601,6 +868,123 @@ func (s *SnapshotServiceImpl) CopySnapshot(input *ec2.CopySnapshotInput, account
 	}, nil
 }
 
+// DescribeSnapshotTree returns the snapshot lineage owned by the caller as a
+// forest of trees. A snapshot whose parent is missing or owned by another
+// account is treated as a root.
+func (s *SnapshotServiceImpl) DescribeSnapshotTree(input *DescribeSnapshotTreeInput, accountID string) (*DescribeSnapshotTreeOutput, error) {
+	if input == nil {
+		input = &DescribeSnapshotTreeInput{}
+	}
+
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	slog.Info("DescribeSnapshotTree request", "snapshotId", input.SnapshotID, "accountID", accountID)
+
+	configs, err := s.listSnapshotConfigs()
+	if err != nil {
+		slog.Error("DescribeSnapshotTree failed to list snapshots", "err", err)
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+
+	volumes, err := s.volumesBySourceSnapshot()
+	if err != nil {
+		slog.Error("DescribeSnapshotTree failed to list volumes", "err", err)
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+
+	nodes := make(map[string]*SnapshotTreeNode)
+	for _, cfg := range configs {
+		if accountID != "" && cfg.OwnerID != "" && cfg.OwnerID != accountID {
+			continue
+		}
+		nodes[cfg.SnapshotID] = &SnapshotTreeNode{
+			SnapshotID:       cfg.SnapshotID,
+			VolumeID:         cfg.VolumeID,
+			ParentSnapshotID: cfg.ParentSnapshotID,
+			State:            cfg.State,
+			StartTime:        cfg.StartTime,
+			Volumes:          volumes[cfg.SnapshotID],
+		}
+	}
+
+	// Link children in start-time order so the output is stable.
+	ordered := slices.Collect(maps.Values(nodes))
+	slices.SortFunc(ordered, func(a, b *SnapshotTreeNode) int {
+		if c := a.StartTime.Compare(b.StartTime); c != 0 {
+			return c
+		}
+		return strings.Compare(a.SnapshotID, b.SnapshotID)
+	})
+
+	cut := cutSnapshotCycles(nodes, ordered)
+	roots := []*SnapshotTreeNode{}
+	for _, node := range ordered {
+		parent, ok := nodes[node.ParentSnapshotID]
+		if !ok || cut[node.SnapshotID] {
+			roots = append(roots, node)
+			continue
+		}
+		parent.Children = append(parent.Children, node)
+	}
+
+	if input.SnapshotID == "" {
+		return &DescribeSnapshotTreeOutput{Roots: roots}, nil
+	}
+
+	node, ok := nodes[input.SnapshotID]
+	if !ok {
+		return nil, errors.New(awserrors.ErrorInvalidSnapshotNotFound)
+	}
+	for !cut[node.SnapshotID] {
+		parent, ok := nodes[node.ParentSnapshotID]
+		if !ok {
+			break
+		}
+		node = parent
+	}
+
+	return &DescribeSnapshotTreeOutput{Roots: []*SnapshotTreeNode{node}}, nil
+}
+
+// cutSnapshotCycles finds parent links that loop back on themselves, such as
+// a snapshot recorded as its own parent, which would otherwise never reach a
+// root and nest forever. Each cycle is cut at its earliest snapshot in
+// ordered, which is returned to be treated as a root.
+func cutSnapshotCycles(nodes map[string]*SnapshotTreeNode, ordered []*SnapshotTreeNode) map[string]bool {
+	rank := make(map[string]int, len(ordered))
+	for i, node := range ordered {
+		rank[node.SnapshotID] = i
+	}
+
+	cut := make(map[string]bool)
+	checked := make(map[string]bool) // chain from here reaches a root or a cut
+	for _, start := range ordered {
+		visited := make(map[string]bool)
+		node := start
+		for node != nil && !checked[node.SnapshotID] && !cut[node.SnapshotID] {
+			if visited[node.SnapshotID] {
+				// node is on a cycle; walk it once to find its earliest member.
+				earliest := node
+				for n := nodes[node.ParentSnapshotID]; n != node; n = nodes[n.ParentSnapshotID] {
+					if rank[n.SnapshotID] < rank[earliest.SnapshotID] {
+						earliest = n
+					}
+				}
+				slog.Warn("DescribeSnapshotTree: snapshot parents form a cycle, treating it as a root", "snapshotId", earliest.SnapshotID, "parentSnapshotId", earliest.ParentSnapshotID)
+				cut[earliest.SnapshotID] = true
+				break
+			}
+			visited[node.SnapshotID] = true
+			node = nodes[node.ParentSnapshotID]
+		}
+		for id := range visited {
+			checked[id] = true
+		}
+	}
+	return cut
+}
+
 // addSnapshotRef adds snapshotID to the volume's snapshot list in KV.
 // Uses CAS (Create/Update with revision) to prevent lost updates under concurrency.
 func (s *SnapshotServiceImpl) addSnapshotRef(volumeID, snapshotID string) error {
@@ -12,6 +12,10 @@ import (
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
 	"github.com/mulgadc/spinifex/spinifex/config"
 	"github.com/mulgadc/spinifex/spinifex/objectstore"
+	"github.com/mulgadc/spinifex/spinifex/testutil"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
 	"github.com/mulgadc/viperblock/viperblock"
 	"github.com/nats-io/nats-server/v2/server"
 	"github.com/nats-io/nats.go"
@@ -98,6 +102,33 @@ func TestCreateSnapshot(t *testing.T) {
 	assert.Equal(t, "test-snap", *result.Tags[0].Value)
 }
 
+func TestSnapshotTimestamps_FakeClock(t *testing.T) {
+	svc, store := setupTestSnapshotService(t)
+	createTestVolume(t, store, "vol-clock", 10)
+	started := time.Date(2026, 5, 1, 9, 30, 0, 0, time.UTC)
+	clock := testutil.NewFakeClock(started)
+	t.Cleanup(utils.SetClock(clock))
+
+	snap, err := svc.CreateSnapshot(&ec2.CreateSnapshotInput{VolumeId: aws.String("vol-clock")}, testAccountID)
+	require.NoError(t, err)
+	assert.Equal(t, started, aws.TimeValue(snap.StartTime))
+
+	clock.Advance(time.Hour)
+	copied, err := svc.CopySnapshot(&ec2.CopySnapshotInput{SourceSnapshotId: snap.SnapshotId}, testAccountID)
+	require.NoError(t, err)
+
+	out, err := svc.DescribeSnapshots(&ec2.DescribeSnapshotsInput{SnapshotIds: []*string{snap.SnapshotId, copied.SnapshotId}}, testAccountID)
+	require.NoError(t, err)
+	startTimes := map[string]time.Time{}
+	for _, s := range out.Snapshots {
+		startTimes[*s.SnapshotId] = aws.TimeValue(s.StartTime)
+	}
+	assert.Equal(t, map[string]time.Time{
+		*snap.SnapshotId:   started,
+		*copied.SnapshotId: started.Add(time.Hour),
+	}, startTimes)
+}
+
 // TestCreateSnapshot_MissingVolumeId tests creating a snapshot without volume ID
 func TestCreateSnapshot_MissingVolumeId(t *testing.T) {
 	svc, _ := setupTestSnapshotService(t)
@@ -353,6 +384,47 @@ func TestDeleteSnapshot_InUseByVolume(t *testing.T) {
 	assert.Len(t, result.Snapshots, 1)
 }
 
+// TestDeleteSnapshot_FullCopyVolume tests that a full copy holds its
+// snapshot only while it is being created
+func TestDeleteSnapshot_FullCopyVolume(t *testing.T) {
+	svc, store := setupTestSnapshotService(t)
+
+	createTestVolume(t, store, "vol-source", 50)
+	snap, err := svc.CreateSnapshot(&ec2.CreateSnapshotInput{
+		VolumeId: aws.String("vol-source"),
+	}, testAccountID)
+	require.NoError(t, err)
+
+	putCopy := func(state string) {
+		data, err := json.Marshal(viperblock.VBState{
+			VolumeConfig: viperblock.VolumeConfig{
+				VolumeMetadata: viperblock.VolumeMetadata{
+					SizeGiB:    50,
+					State:      state,
+					SnapshotID: *snap.SnapshotId,
+					Tags:       map[string]string{vm.CopyModeTag: vm.CopyModeFull},
+				},
+			},
+		})
+		require.NoError(t, err)
+		_, err = store.PutObject(&s3.PutObjectInput{
+			Bucket: aws.String("test-bucket"),
+			Key:    aws.String("vol-copy/config.json"),
+			Body:   strings.NewReader(string(data)),
+		})
+		require.NoError(t, err)
+	}
+
+	putCopy("creating")
+	_, err = svc.DeleteSnapshot(&ec2.DeleteSnapshotInput{SnapshotId: snap.SnapshotId}, testAccountID)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), awserrors.ErrorInvalidSnapshotInUse)
+
+	putCopy("available")
+	_, err = svc.DeleteSnapshot(&ec2.DeleteSnapshotInput{SnapshotId: snap.SnapshotId}, testAccountID)
+	require.NoError(t, err)
+}
+
 // TestDeleteSnapshot_NotFound tests deleting a non-existent snapshot
 func TestDeleteSnapshot_NotFound(t *testing.T) {
 	svc, _ := setupTestSnapshotService(t)
@@ -401,6 +473,35 @@ func TestCopySnapshot(t *testing.T) {
 	assert.Len(t, result.Snapshots, 2)
 }
 
+func TestCreateSnapshot_Encrypted(t *testing.T) {
+	svc, store := setupTestSnapshotService(t)
+
+	volumeState := viperblock.VBState{VolumeConfig: viperblock.VolumeConfig{
+		VolumeMetadata: viperblock.VolumeMetadata{SizeGiB: 10, IsEncrypted: true},
+	}}
+	data, err := json.Marshal(volumeState)
+	require.NoError(t, err)
+	_, err = store.PutObject(&s3.PutObjectInput{Bucket: aws.String("test-bucket"), Key: aws.String("vol-enc/config.json"), Body: strings.NewReader(string(data))})
+	require.NoError(t, err)
+	record := types.VolumeEncryption{KmsKeyID: "arn:aws:kms:ap-southeast-2:123456789012:key/k1", DataKey: "wrapped", Formatted: true}
+	data, err = json.Marshal(record)
+	require.NoError(t, err)
+	_, err = store.PutObject(&s3.PutObjectInput{Bucket: aws.String("test-bucket"), Key: aws.String(types.VolumeEncryptionKey("vol-enc")), Body: strings.NewReader(string(data))})
+	require.NoError(t, err)
+
+	snap, err := svc.CreateSnapshot(&ec2.CreateSnapshotInput{VolumeId: aws.String("vol-enc")}, testAccountID)
+	require.NoError(t, err)
+	assert.True(t, aws.BoolValue(snap.Encrypted))
+	assert.Equal(t, record.KmsKeyID, aws.StringValue(snap.KmsKeyId))
+
+	// Copies carry the record, so volumes restored from them can be opened.
+	copied, err := svc.CopySnapshot(&ec2.CopySnapshotInput{SourceSnapshotId: snap.SnapshotId}, testAccountID)
+	require.NoError(t, err)
+	cfg, err := svc.getSnapshotConfig(*copied.SnapshotId)
+	require.NoError(t, err)
+	assert.Equal(t, &record, cfg.Encryption)
+}
+
 // TestCopySnapshot_SetsCallerAsOwner tests that copied snapshot is owned by the caller
 func TestCopySnapshot_SetsCallerAsOwner(t *testing.T) {
 	svc, store := setupTestSnapshotService(t)
@@ -973,6 +1074,21 @@ func TestDescribeSnapshots_FilterByTag(t *testing.T) {
 	assert.Len(t, out.Snapshots, 1)
 }
 
+func TestDescribeSnapshots_FilterByTagKey(t *testing.T) {
+	svc, store := setupTestSnapshotService(t)
+	createTestSnapshot(t, svc, store, "vol-owned", 10, map[string]string{"Owner": "alice"})
+	createTestSnapshot(t, svc, store, "vol-env", 10, map[string]string{"Env": "prod"})
+
+	out, err := svc.DescribeSnapshots(&ec2.DescribeSnapshotsInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("tag-key"), Values: []*string{aws.String("Owner")}},
+		},
+	}, testAccountID)
+	require.NoError(t, err)
+	require.Len(t, out.Snapshots, 1)
+	assert.Equal(t, "vol-owned", *out.Snapshots[0].VolumeId)
+}
+
 func TestDescribeSnapshots_FilterNoFilters(t *testing.T) {
 	svc, store := setupTestSnapshotService(t)
 	createTestSnapshot(t, svc, store, "vol-1", 10, nil)
@@ -982,3 +1098,266 @@ func TestDescribeSnapshots_FilterNoFilters(t *testing.T) {
 	require.NoError(t, err)
 	assert.Len(t, out.Snapshots, 2)
 }
+
+// --- Snapshot lineage tests ---
+
+// createTestVolumeFromSnapshot stores a volume config that records snapshotID as its source.
+func createTestVolumeFromSnapshot(t *testing.T, store *objectstore.MemoryObjectStore, volumeID, snapshotID string, sizeGiB int) {
+	t.Helper()
+	volumeState := viperblock.VBState{
+		VolumeConfig: viperblock.VolumeConfig{
+			VolumeMetadata: viperblock.VolumeMetadata{
+				SizeGiB:    uint64(sizeGiB),
+				SnapshotID: snapshotID,
+			},
+		},
+	}
+	data, err := json.Marshal(volumeState)
+	require.NoError(t, err)
+	_, err = store.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String("test-bucket"),
+		Key:    aws.String(volumeID + "/config.json"),
+		Body:   strings.NewReader(string(data)),
+	})
+	require.NoError(t, err)
+}
+
+// TestDescribeSnapshotTree_Lineage builds root → restored volume → child snapshot → copy
+// and asserts the returned tree and that parents cannot be deleted out from under children.
+func TestDescribeSnapshotTree_Lineage(t *testing.T) {
+	svc, store := setupTestSnapshotService(t)
+
+	rootID := createTestSnapshot(t, svc, store, "vol-root", 20, nil)
+
+	createTestVolumeFromSnapshot(t, store, "vol-restored", rootID, 20)
+	child, err := svc.CreateSnapshot(&ec2.CreateSnapshotInput{
+		VolumeId: aws.String("vol-restored"),
+	}, testAccountID)
+	require.NoError(t, err)
+	childID := *child.SnapshotId
+
+	copyOut, err := svc.CopySnapshot(&ec2.CopySnapshotInput{
+		SourceSnapshotId: aws.String(childID),
+	}, testAccountID)
+	require.NoError(t, err)
+	copyID := *copyOut.SnapshotId
+
+	// An unrelated snapshot forms its own tree
+	otherID := createTestSnapshot(t, svc, store, "vol-other", 5, nil)
+
+	out, err := svc.DescribeSnapshotTree(&DescribeSnapshotTreeInput{}, testAccountID)
+	require.NoError(t, err)
+	require.Len(t, out.Roots, 2)
+
+	var root *SnapshotTreeNode
+	for _, r := range out.Roots {
+		if r.SnapshotID == rootID {
+			root = r
+		}
+	}
+	require.NotNil(t, root)
+	assert.Empty(t, root.ParentSnapshotID)
+	assert.Equal(t, []string{"vol-restored"}, root.Volumes)
+	require.Len(t, root.Children, 1)
+	assert.Equal(t, childID, root.Children[0].SnapshotID)
+	assert.Equal(t, rootID, root.Children[0].ParentSnapshotID)
+	require.Len(t, root.Children[0].Children, 1)
+	assert.Equal(t, copyID, root.Children[0].Children[0].SnapshotID)
+
+	// Querying from a leaf returns the whole tree containing it
+	out, err = svc.DescribeSnapshotTree(&DescribeSnapshotTreeInput{SnapshotID: copyID}, testAccountID)
+	require.NoError(t, err)
+	require.Len(t, out.Roots, 1)
+	assert.Equal(t, rootID, out.Roots[0].SnapshotID)
+
+	out, err = svc.DescribeSnapshotTree(&DescribeSnapshotTreeInput{SnapshotID: otherID}, testAccountID)
+	require.NoError(t, err)
+	require.Len(t, out.Roots, 1)
+	assert.Empty(t, out.Roots[0].Children)
+
+	// Remove the restored volume: the root is still protected by its child snapshot
+	_, err = store.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String("test-bucket"),
+		Key:    aws.String("vol-restored/config.json"),
+	})
+	require.NoError(t, err)
+
+	_, err = svc.DeleteSnapshot(&ec2.DeleteSnapshotInput{SnapshotId: aws.String(rootID)}, testAccountID)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), awserrors.ErrorInvalidSnapshotInUse)
+
+	_, err = svc.DeleteSnapshot(&ec2.DeleteSnapshotInput{SnapshotId: aws.String(childID)}, testAccountID)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), awserrors.ErrorInvalidSnapshotInUse)
+
+	// Deleting leaf-first unwinds the chain
+	_, err = svc.DeleteSnapshot(&ec2.DeleteSnapshotInput{SnapshotId: aws.String(copyID)}, testAccountID)
+	require.NoError(t, err)
+	_, err = svc.DeleteSnapshot(&ec2.DeleteSnapshotInput{SnapshotId: aws.String(childID)}, testAccountID)
+	require.NoError(t, err)
+	_, err = svc.DeleteSnapshot(&ec2.DeleteSnapshotInput{SnapshotId: aws.String(rootID)}, testAccountID)
+	require.NoError(t, err)
+}
+
+func TestDescribeSnapshotTree_NotFound(t *testing.T) {
+	svc, _ := setupTestSnapshotService(t)
+
+	_, err := svc.DescribeSnapshotTree(&DescribeSnapshotTreeInput{SnapshotID: "snap-missing"}, testAccountID)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), awserrors.ErrorInvalidSnapshotNotFound)
+}
+
+// setSnapshotParent rewrites a stored snapshot's parent, to simulate
+// corrupt lineage.
+func setSnapshotParent(t *testing.T, svc *SnapshotServiceImpl, snapshotID, parentID string) {
+	t.Helper()
+	cfg, err := svc.getSnapshotConfig(snapshotID)
+	require.NoError(t, err)
+	cfg.ParentSnapshotID = parentID
+	require.NoError(t, svc.putSnapshotConfig(snapshotID, cfg))
+}
+
+func TestDescribeSnapshotTree_ParentCycles(t *testing.T) {
+	svc, store := setupTestSnapshotService(t)
+
+	// A snapshot recorded as its own parent, with a child of its own.
+	selfID := createTestSnapshot(t, svc, store, "vol-self", 10, nil)
+	setSnapshotParent(t, svc, selfID, selfID)
+	childID := createTestSnapshot(t, svc, store, "vol-child", 10, nil)
+	setSnapshotParent(t, svc, childID, selfID)
+
+	// Two snapshots naming each other as parent.
+	loopA := createTestSnapshot(t, svc, store, "vol-loop-a", 10, nil)
+	loopB := createTestSnapshot(t, svc, store, "vol-loop-b", 10, nil)
+	setSnapshotParent(t, svc, loopA, loopB)
+	setSnapshotParent(t, svc, loopB, loopA)
+
+	done := make(chan struct{})
+	var out *DescribeSnapshotTreeOutput
+	var err error
+	go func() {
+		defer close(done)
+		out, err = svc.DescribeSnapshotTree(&DescribeSnapshotTreeInput{}, testAccountID)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("DescribeSnapshotTree did not return")
+	}
+	require.NoError(t, err)
+	require.Len(t, out.Roots, 2)
+
+	roots := make(map[string]*SnapshotTreeNode)
+	for _, r := range out.Roots {
+		roots[r.SnapshotID] = r
+	}
+	self := roots[selfID]
+	require.NotNil(t, self, "self-parented snapshot becomes a root")
+	require.Len(t, self.Children, 1)
+	assert.Equal(t, childID, self.Children[0].SnapshotID)
+	assert.Empty(t, self.Children[0].Children)
+
+	// The cycle is cut at its earliest snapshot; start times can tie, so
+	// either may be it.
+	cutID, otherID := loopA, loopB
+	if roots[loopA] == nil {
+		cutID, otherID = loopB, loopA
+	}
+	loop := roots[cutID]
+	require.NotNil(t, loop)
+	require.Len(t, loop.Children, 1)
+	assert.Equal(t, otherID, loop.Children[0].SnapshotID)
+	assert.Empty(t, loop.Children[0].Children)
+
+	// The output must serialize without nesting forever.
+	_, err = json.Marshal(out)
+	require.NoError(t, err)
+
+	// Walking up from inside a cycle stops at the cut.
+	for id, want := range map[string]string{selfID: selfID, childID: selfID, loopA: cutID, loopB: cutID} {
+		out, err := svc.DescribeSnapshotTree(&DescribeSnapshotTreeInput{SnapshotID: id}, testAccountID)
+		require.NoError(t, err)
+		require.Len(t, out.Roots, 1)
+		assert.Equal(t, want, out.Roots[0].SnapshotID, id)
+	}
+}
+
+func TestDescribeSnapshotTree_AccountScoping(t *testing.T) {
+	svc, store := setupTestSnapshotService(t)
+	snapID := createTestSnapshot(t, svc, store, "vol-1", 10, nil)
+
+	out, err := svc.DescribeSnapshotTree(&DescribeSnapshotTreeInput{}, otherAccountID)
+	require.NoError(t, err)
+	assert.Empty(t, out.Roots)
+
+	_, err = svc.DescribeSnapshotTree(&DescribeSnapshotTreeInput{SnapshotID: snapID}, otherAccountID)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), awserrors.ErrorInvalidSnapshotNotFound)
+}
+
+func createTaggedTestVolume(t *testing.T, store *objectstore.MemoryObjectStore, volumeID, tenantID string, tags map[string]string) {
+	t.Helper()
+	volumeState := viperblock.VBState{
+		VolumeConfig: viperblock.VolumeConfig{
+			VolumeMetadata: viperblock.VolumeMetadata{
+				SizeGiB:  10,
+				TenantID: tenantID,
+				Tags:     tags,
+			},
+		},
+	}
+	data, err := json.Marshal(volumeState)
+	require.NoError(t, err)
+	_, err = store.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String("test-bucket"),
+		Key:    aws.String(volumeID + "/config.json"),
+		Body:   strings.NewReader(string(data)),
+	})
+	require.NoError(t, err)
+}
+
+func TestCreateSnapshotsByTag(t *testing.T) {
+	svc, store := setupTestSnapshotService(t)
+	backup := map[string]string{"Backup": "daily", "Name": "db"}
+	createTaggedTestVolume(t, store, "vol-a", testAccountID, backup)
+	createTaggedTestVolume(t, store, "vol-b", testAccountID, backup)
+	createTaggedTestVolume(t, store, "vol-busy", testAccountID, backup)
+	createTaggedTestVolume(t, store, "vol-weekly", testAccountID, map[string]string{"Backup": "weekly"})
+	createTaggedTestVolume(t, store, "vol-untagged", testAccountID, nil)
+	createTaggedTestVolume(t, store, "vol-other", otherAccountID, backup)
+
+	// A snapshot of vol-busy is already in progress.
+	require.True(t, svc.beginSnapshot("vol-busy"))
+
+	out, err := svc.CreateSnapshotsByTag(&CreateSnapshotsByTagInput{
+		Filters:     []*ec2.Filter{{Name: aws.String("tag:Backup"), Values: []*string{aws.String("daily")}}},
+		Description: aws.String("nightly"),
+	}, testAccountID)
+	require.NoError(t, err)
+	require.Len(t, out.Results, 3)
+
+	assert.Equal(t, awserrors.ErrorConcurrentSnapshotLimitExceeded, out.Results["vol-busy"].Error)
+	assert.Empty(t, out.Results["vol-busy"].SnapshotID)
+
+	for _, volumeID := range []string{"vol-a", "vol-b"} {
+		result := out.Results[volumeID]
+		assert.Empty(t, result.Error, volumeID)
+		require.NotEmpty(t, result.SnapshotID, volumeID)
+
+		snaps, err := svc.DescribeSnapshots(&ec2.DescribeSnapshotsInput{
+			Filters: []*ec2.Filter{{Name: aws.String("volume-id"), Values: []*string{aws.String(volumeID)}}},
+		}, testAccountID)
+		require.NoError(t, err)
+		require.Len(t, snaps.Snapshots, 1, "one snapshot per matching volume")
+		assert.Equal(t, result.SnapshotID, aws.StringValue(snaps.Snapshots[0].SnapshotId))
+		assert.Equal(t, "nightly", aws.StringValue(snaps.Snapshots[0].Description))
+	}
+
+	// Once the in-progress snapshot finishes the volume can be snapshotted again.
+	svc.endSnapshot("vol-busy")
+	_, err = svc.CreateSnapshot(&ec2.CreateSnapshotInput{VolumeId: aws.String("vol-busy")}, testAccountID)
+	require.NoError(t, err)
+
+	_, err = svc.CreateSnapshotsByTag(&CreateSnapshotsByTagInput{}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorMissingParameter)
+}
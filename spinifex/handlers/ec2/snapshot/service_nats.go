@@ -33,3 +33,11 @@ func (s *NATSSnapshotService) DeleteSnapshot(input *ec2.DeleteSnapshotInput, acc
 func (s *NATSSnapshotService) CopySnapshot(input *ec2.CopySnapshotInput, accountID string) (*ec2.CopySnapshotOutput, error) {
 	return utils.NATSRequest[ec2.CopySnapshotOutput](s.natsConn, "ec2.CopySnapshot", input, 120*time.Second, accountID)
 }
+
+func (s *NATSSnapshotService) DescribeSnapshotTree(input *DescribeSnapshotTreeInput, accountID string) (*DescribeSnapshotTreeOutput, error) {
+	return utils.NATSRequest[DescribeSnapshotTreeOutput](s.natsConn, "ec2.DescribeSnapshotTree", input, 30*time.Second, accountID)
+}
+
+func (s *NATSSnapshotService) CreateSnapshotsByTag(input *CreateSnapshotsByTagInput, accountID string) (*CreateSnapshotsByTagOutput, error) {
+	return utils.NATSRequest[CreateSnapshotsByTagOutput](s.natsConn, "ec2.CreateSnapshotsByTag", input, 300*time.Second, accountID)
+}
@@ -7,4 +7,36 @@ type TagsService interface {
 	CreateTags(input *ec2.CreateTagsInput, accountID string) (*ec2.CreateTagsOutput, error)
 	DescribeTags(input *ec2.DescribeTagsInput, accountID string) (*ec2.DescribeTagsOutput, error)
 	DeleteTags(input *ec2.DeleteTagsInput, accountID string) (*ec2.DeleteTagsOutput, error)
+	BatchCreateTags(input *BatchCreateTagsInput, accountID string) (*BatchTagsOutput, error)
+	BatchDeleteTags(input *BatchDeleteTagsInput, accountID string) (*BatchTagsOutput, error)
+}
+
+// BatchCreateTagsInput is CreateTags with a choice of failure semantics.
+// When Atomic is set every resource and tag is validated before any write,
+// and writes already applied are rolled back if a later one fails. Otherwise
+// each resource is tagged independently and failures are reported per resource.
+type BatchCreateTagsInput struct {
+	Resources []*string  `locationName:"ResourceId" json:"resources"`
+	Tags      []*ec2.Tag `locationName:"Tag" json:"tags"`
+	Atomic    bool       `json:"atomic"`
+}
+
+// BatchDeleteTagsInput is DeleteTags with the same semantics as BatchCreateTagsInput.
+// An empty Tags list removes every tag from the listed resources.
+type BatchDeleteTagsInput struct {
+	Resources []*string  `locationName:"ResourceId" json:"resources"`
+	Tags      []*ec2.Tag `locationName:"Tag" json:"tags"`
+	Atomic    bool       `json:"atomic"`
+}
+
+// TagResourceResult reports the outcome for one resource in a batch.
+// Error holds the AWS error code and is empty on success.
+type TagResourceResult struct {
+	ResourceID string `json:"resource_id"`
+	Error      string `json:"error,omitempty"`
+}
+
+// BatchTagsOutput is the response for BatchCreateTags and BatchDeleteTags.
+type BatchTagsOutput struct {
+	Results []TagResourceResult `json:"results"`
 }
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"log/slog"
+	"maps"
 	"strings"
 	"sync"
 
@@ -15,6 +16,7 @@ import (
 	"github.com/mulgadc/spinifex/spinifex/config"
 	"github.com/mulgadc/spinifex/spinifex/filterutil"
 	"github.com/mulgadc/spinifex/spinifex/objectstore"
+	"github.com/mulgadc/spinifex/spinifex/utils"
 )
 
 // Ensure TagsServiceImpl implements TagsService
@@ -27,17 +29,18 @@ type TagsServiceImpl struct {
 	config *config.Config
 	store  objectstore.ObjectStore
 	mutex  sync.RWMutex
+	// volumeTags mirrors a volume's tags into its own metadata, which
+	// DescribeVolumes reads and filters on. It rejects volumes the account
+	// does not own.
+	volumeTags func(accountID, volumeID string, tags map[string]string) error
+	// resourceLookup checks that a resource kept outside the shared bucket,
+	// such as an instance or VPC, exists for an account, returning its
+	// NotFound error code when it doesn't.
+	resourceLookup func(accountID, resourceID string) error
 }
 
-// NewTagsServiceImpl creates a new tags service implementation
-func NewTagsServiceImpl(cfg *config.Config) *TagsServiceImpl {
-	store := objectstore.NewS3ObjectStoreFromConfig(
-		cfg.Predastore.Host,
-		cfg.Predastore.Region,
-		cfg.Predastore.AccessKey,
-		cfg.Predastore.SecretKey,
-	)
-
+// NewTagsServiceImpl creates a new tags service implementation on store
+func NewTagsServiceImpl(cfg *config.Config, store objectstore.ObjectStore) *TagsServiceImpl {
 	return &TagsServiceImpl{
 		config: cfg,
 		store:  store,
@@ -52,6 +55,19 @@ func NewTagsServiceImplWithStore(cfg *config.Config, store objectstore.ObjectSto
 	}
 }
 
+// SetVolumeTagWriter sets the function CreateTags and DeleteTags use to
+// mirror a volume's full tag set into the volume's metadata.
+func (s *TagsServiceImpl) SetVolumeTagWriter(fn func(accountID, volumeID string, tags map[string]string) error) {
+	s.volumeTags = fn
+}
+
+// SetResourceLookup sets the function atomic batches use to check that
+// instances, VPCs and other resources whose metadata is not in the shared
+// bucket exist.
+func (s *TagsServiceImpl) SetResourceLookup(fn func(accountID, resourceID string) error) {
+	s.resourceLookup = fn
+}
+
 // getResourceType extracts resource type from resource ID prefix
 func getResourceType(resourceID string) string {
 	if strings.HasPrefix(resourceID, "i-") {
@@ -121,18 +137,131 @@ func (s *TagsServiceImpl) getResourceTags(accountID, resourceID string) (map[str
 	return tags, nil
 }
 
-// putResourceTags stores tags for a specific resource in S3
+// putResourceTags stores tags for a specific resource in S3, mirroring a
+// volume's tags into its metadata first so a volume the account does not own
+// is rejected before anything is written.
 func (s *TagsServiceImpl) putResourceTags(accountID, resourceID string, tags map[string]string) error {
-	key := getTagsKey(accountID, resourceID)
+	if s.volumeTags != nil && getResourceType(resourceID) == "volume" {
+		if err := s.volumeTags(accountID, resourceID, tags); err != nil {
+			return err
+		}
+	}
+	return PutResourceTags(s.store, s.config.Predastore.Bucket, accountID, resourceID, tags)
+}
+
+// checkOwners rejects a request naming a resource in the shared bucket that
+// belongs to another account, before any of its resources are written.
+// Returns the resource type's NotFound error code, or "" if every resource
+// is the caller's. Resources without metadata are left to the write path.
+func (s *TagsServiceImpl) checkOwners(accountID string, resources []*string) string {
+	for _, resourceID := range resources {
+		if resourceID == nil {
+			continue
+		}
+		if errCode := s.checkOwner(accountID, *resourceID); errCode != "" {
+			return errCode
+		}
+	}
+	return ""
+}
+
+// checkOwner compares the owner recorded in a resource's metadata with
+// accountID. Returns the resource type's NotFound error code on a mismatch.
+func (s *TagsServiceImpl) checkOwner(accountID, resourceID string) string {
+	notFound, ok := ownedResourceNotFound[getResourceType(resourceID)]
+	if !ok {
+		return ""
+	}
+
+	owner, err := s.resourceOwner(resourceID)
+	if err != nil {
+		if objectstore.IsNoSuchKeyError(err) {
+			return ""
+		}
+		slog.Error("checkOwner failed to read resource metadata", "resourceId", resourceID, "err", err)
+		return awserrors.ErrorServerInternal
+	}
+	if !ownerMatches(getResourceType(resourceID), owner, accountID) {
+		slog.Warn("checkOwner: account does not own resource", "resourceId", resourceID, "accountID", accountID, "ownerID", owner)
+		return notFound
+	}
+	return ""
+}
+
+// ownedResourceNotFound maps the resource types whose metadata, including
+// the owning account, lives in the shared bucket to their NotFound codes.
+var ownedResourceNotFound = map[string]string{
+	"volume":   awserrors.ErrorInvalidVolumeNotFound,
+	"image":    awserrors.ErrorInvalidAMIIDNotFound,
+	"snapshot": awserrors.ErrorInvalidSnapshotNotFound,
+}
+
+// resourceOwner reads the owning account from a volume, image or snapshot's
+// metadata, returning the store's NoSuchKey error if it doesn't exist.
+func (s *TagsServiceImpl) resourceOwner(resourceID string) (string, error) {
+	key := resourceID + "/config.json"
+	if getResourceType(resourceID) == "snapshot" {
+		key = resourceID + "/metadata.json"
+	}
+
+	result, err := s.store.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.config.Predastore.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", err
+	}
+	defer result.Body.Close()
 
+	// Volumes and AMIs share the viperblock config layout; snapshots keep
+	// their own metadata.
+	var meta struct {
+		VolumeConfig struct {
+			VolumeMetadata struct {
+				TenantID string
+			}
+			AMIMetadata struct {
+				ImageOwnerAlias string
+			}
+		}
+		OwnerID string `json:"owner_id"`
+	}
+	if err := json.NewDecoder(result.Body).Decode(&meta); err != nil {
+		return "", err
+	}
+
+	switch getResourceType(resourceID) {
+	case "volume":
+		return meta.VolumeConfig.VolumeMetadata.TenantID, nil
+	case "image":
+		return meta.VolumeConfig.AMIMetadata.ImageOwnerAlias, nil
+	default:
+		return meta.OwnerID, nil
+	}
+}
+
+// ownerMatches reports whether accountID may tag a resource owned by owner.
+// Volumes and AMIs must name the account exactly, so system AMIs are not
+// taggable; snapshots created before ownership tracking have no owner and
+// are open to every account, as elsewhere in the snapshot service.
+func ownerMatches(resourceType, owner, accountID string) bool {
+	if resourceType == "snapshot" && owner == "" {
+		return true
+	}
+	return owner == accountID
+}
+
+// PutResourceTags stores the full tag set of a resource, for services that
+// create resources with tags so DescribeTags and CreateTags see them.
+func PutResourceTags(store objectstore.ObjectStore, bucket, accountID, resourceID string, tags map[string]string) error {
 	data, err := json.Marshal(tags)
 	if err != nil {
 		return err
 	}
 
-	_, err = s.store.PutObject(&s3.PutObjectInput{
-		Bucket:      aws.String(s.config.Predastore.Bucket),
-		Key:         aws.String(key),
+	_, err = store.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(getTagsKey(accountID, resourceID)),
 		Body:        bytes.NewReader(data),
 		ContentType: aws.String("application/json"),
 	})
@@ -159,6 +288,10 @@ func (s *TagsServiceImpl) CreateTags(input *ec2.CreateTagsInput, accountID strin
 
 	slog.Info("CreateTags request", "resources", len(input.Resources), "tags", len(input.Tags))
 
+	if errCode := s.checkOwners(accountID, input.Resources); errCode != "" {
+		return nil, errors.New(errCode)
+	}
+
 	for _, resourceID := range input.Resources {
 		if resourceID == nil {
 			continue
@@ -290,6 +423,10 @@ func (s *TagsServiceImpl) DeleteTags(input *ec2.DeleteTagsInput, accountID strin
 
 	slog.Info("DeleteTags request", "resources", len(input.Resources), "tags", len(input.Tags))
 
+	if errCode := s.checkOwners(accountID, input.Resources); errCode != "" {
+		return nil, errors.New(errCode)
+	}
+
 	for _, resourceID := range input.Resources {
 		if resourceID == nil {
 			continue
@@ -335,3 +472,210 @@ func (s *TagsServiceImpl) DeleteTags(input *ec2.DeleteTagsInput, accountID strin
 
 	return &ec2.DeleteTagsOutput{}, nil
 }
+
+// Tag limits enforced by the batch operations, matching AWS.
+const (
+	maxTagsPerResource = utils.MaxTagsPerResource
+	maxTagKeyLength    = 128
+	maxTagValueLength  = 256
+)
+
+// validateTags checks tag keys and values against the AWS tag restrictions.
+func validateTags(tags []*ec2.Tag) error {
+	for _, tag := range tags {
+		if tag == nil || tag.Key == nil || *tag.Key == "" {
+			return errors.New(awserrors.ErrorInvalidTagKeyMalformed)
+		}
+		if len(*tag.Key) > maxTagKeyLength || strings.HasPrefix(strings.ToLower(*tag.Key), "aws:") {
+			return errors.New(awserrors.ErrorInvalidTagKeyMalformed)
+		}
+		if tag.Value != nil && len(*tag.Value) > maxTagValueLength {
+			return errors.New(awserrors.ErrorInvalidParameterValue)
+		}
+	}
+	return nil
+}
+
+// validateResource checks that resourceID is a taggable resource and, for
+// resources whose metadata lives in the shared bucket, that it exists and is
+// owned by accountID. In atomic mode other resources are looked up too, so
+// the batch is only applied when every resource exists. Returns an AWS error
+// code, or "" if the resource is valid.
+func (s *TagsServiceImpl) validateResource(accountID, resourceID string, atomic bool) string {
+	resourceType := getResourceType(resourceID)
+	if resourceType == "unknown" {
+		return awserrors.ErrorInvalidID
+	}
+
+	notFound, ok := ownedResourceNotFound[resourceType]
+	if !ok {
+		if !atomic || s.resourceLookup == nil {
+			return ""
+		}
+		if err := s.resourceLookup(accountID, resourceID); err != nil {
+			return err.Error()
+		}
+		return ""
+	}
+
+	owner, err := s.resourceOwner(resourceID)
+	if err != nil {
+		if objectstore.IsNoSuchKeyError(err) {
+			return notFound
+		}
+		slog.Error("validateResource failed to read resource metadata", "resourceId", resourceID, "err", err)
+		return awserrors.ErrorServerInternal
+	}
+	if !ownerMatches(resourceType, owner, accountID) {
+		slog.Warn("validateResource: account does not own resource", "resourceId", resourceID, "accountID", accountID, "ownerID", owner)
+		return notFound
+	}
+	return ""
+}
+
+// tagChange is the planned before/after tag set for one resource in a batch.
+type tagChange struct {
+	resourceID string
+	before     map[string]string
+	after      map[string]string
+	errCode    string
+}
+
+// applyTagBatch plans mutate against every resource, then writes the results.
+// In atomic mode a single validation failure aborts the batch before any
+// write, and a write failure restores resources already written. In
+// best-effort mode failures are recorded per resource. Callers hold s.mutex.
+func (s *TagsServiceImpl) applyTagBatch(accountID string, resources []*string, atomic bool, mutate func(tags map[string]string) error) (*BatchTagsOutput, error) {
+	seen := make(map[string]bool)
+	var changes []*tagChange
+	for _, resourceID := range resources {
+		if resourceID == nil || seen[*resourceID] {
+			continue
+		}
+		seen[*resourceID] = true
+
+		change := &tagChange{resourceID: *resourceID}
+		changes = append(changes, change)
+
+		if change.errCode = s.validateResource(accountID, *resourceID, atomic); change.errCode != "" {
+			continue
+		}
+
+		existing, err := s.getResourceTags(accountID, *resourceID)
+		if err != nil {
+			slog.Error("applyTagBatch failed to get existing tags", "resourceId", *resourceID, "err", err)
+			change.errCode = awserrors.ErrorServerInternal
+			continue
+		}
+		change.before = existing
+		change.after = maps.Clone(existing)
+		if err := mutate(change.after); err != nil {
+			change.errCode = err.Error()
+		}
+	}
+
+	if atomic {
+		for _, change := range changes {
+			if change.errCode != "" {
+				slog.Info("applyTagBatch: atomic batch rejected", "resourceId", change.resourceID, "err", change.errCode)
+				return nil, errors.New(change.errCode)
+			}
+		}
+	}
+
+	var applied []*tagChange
+	for _, change := range changes {
+		if change.errCode != "" {
+			continue
+		}
+		if err := s.putResourceTags(accountID, change.resourceID, change.after); err != nil {
+			slog.Error("applyTagBatch failed to save tags", "resourceId", change.resourceID, "err", err)
+			change.errCode = awserrors.ErrorServerInternal
+			if atomic {
+				s.rollbackTagBatch(accountID, applied)
+				return nil, errors.New(awserrors.ErrorServerInternal)
+			}
+			continue
+		}
+		applied = append(applied, change)
+	}
+
+	output := &BatchTagsOutput{Results: make([]TagResourceResult, 0, len(changes))}
+	for _, change := range changes {
+		output.Results = append(output.Results, TagResourceResult{ResourceID: change.resourceID, Error: change.errCode})
+	}
+	return output, nil
+}
+
+// rollbackTagBatch restores the pre-batch tags of resources already written.
+func (s *TagsServiceImpl) rollbackTagBatch(accountID string, applied []*tagChange) {
+	for _, change := range applied {
+		if err := s.putResourceTags(accountID, change.resourceID, change.before); err != nil {
+			slog.Error("rollbackTagBatch failed to restore tags", "resourceId", change.resourceID, "err", err)
+			continue
+		}
+		slog.Info("rollbackTagBatch restored tags", "resourceId", change.resourceID)
+	}
+}
+
+// BatchCreateTags adds or overwrites tags on many resources with atomic or
+// best-effort semantics.
+func (s *TagsServiceImpl) BatchCreateTags(input *BatchCreateTagsInput, accountID string) (*BatchTagsOutput, error) {
+	if input == nil {
+		return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if len(input.Resources) == 0 || len(input.Tags) == 0 {
+		return nil, errors.New(awserrors.ErrorMissingParameter)
+	}
+	if err := validateTags(input.Tags); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	slog.Info("BatchCreateTags request", "resources", len(input.Resources), "tags", len(input.Tags), "atomic", input.Atomic)
+
+	return s.applyTagBatch(accountID, input.Resources, input.Atomic, func(tags map[string]string) error {
+		for _, tag := range input.Tags {
+			tags[*tag.Key] = aws.StringValue(tag.Value)
+		}
+		if len(tags) > maxTagsPerResource {
+			return errors.New(awserrors.ErrorTagLimitExceeded)
+		}
+		return nil
+	})
+}
+
+// BatchDeleteTags removes tags from many resources with atomic or best-effort
+// semantics. As with DeleteTags, a tag with a Value is only removed if the
+// stored value matches.
+func (s *TagsServiceImpl) BatchDeleteTags(input *BatchDeleteTagsInput, accountID string) (*BatchTagsOutput, error) {
+	if input == nil {
+		return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if len(input.Resources) == 0 {
+		return nil, errors.New(awserrors.ErrorMissingParameter)
+	}
+	if err := validateTags(input.Tags); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	slog.Info("BatchDeleteTags request", "resources", len(input.Resources), "tags", len(input.Tags), "atomic", input.Atomic)
+
+	return s.applyTagBatch(accountID, input.Resources, input.Atomic, func(tags map[string]string) error {
+		if len(input.Tags) == 0 {
+			clear(tags)
+			return nil
+		}
+		for _, tag := range input.Tags {
+			if current, ok := tags[*tag.Key]; ok && (tag.Value == nil || current == *tag.Value) {
+				delete(tags, *tag.Key)
+			}
+		}
+		return nil
+	})
+}
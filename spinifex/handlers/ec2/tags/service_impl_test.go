@@ -1,6 +1,9 @@
 package handlers_ec2_tags
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -573,3 +576,305 @@ func TestAccountIsolation_DeleteDoesNotAffectOtherAccount(t *testing.T) {
 	assert.Len(t, resultB.Tags, 1)
 	assert.Equal(t, "staging", *resultB.Tags[0].Value)
 }
+
+// failingPutStore wraps a memory store and fails PutObject for a single key.
+type failingPutStore struct {
+	*objectstore.MemoryObjectStore
+	failKey string
+}
+
+func (f *failingPutStore) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	if aws.StringValue(input.Key) == f.failKey {
+		return nil, errors.New("injected put failure")
+	}
+	return f.MemoryObjectStore.PutObject(input)
+}
+
+// putTestVolume writes a minimal volume config owned by testAccountID so the
+// resource passes existence and ownership checks.
+func putTestVolume(t *testing.T, store objectstore.ObjectStore, volumeID string) {
+	putTestVolumeOwnedBy(t, store, volumeID, testAccountID)
+}
+
+func putTestVolumeOwnedBy(t *testing.T, store objectstore.ObjectStore, volumeID, ownerID string) {
+	_, err := store.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String("test-bucket"),
+		Key:    aws.String(volumeID + "/config.json"),
+		Body:   strings.NewReader(`{"VolumeConfig":{"VolumeMetadata":{"TenantID":"` + ownerID + `"}}}`),
+	})
+	require.NoError(t, err)
+}
+
+func describeResourceTags(t *testing.T, svc *TagsServiceImpl, resourceID string) map[string]string {
+	out, err := svc.DescribeTags(&ec2.DescribeTagsInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("resource-id"), Values: []*string{aws.String(resourceID)}},
+		},
+	}, testAccountID)
+	require.NoError(t, err)
+	tags := make(map[string]string)
+	for _, tag := range out.Tags {
+		tags[*tag.Key] = *tag.Value
+	}
+	return tags
+}
+
+func TestBatchCreateTags_AtomicValidationFailureAppliesNothing(t *testing.T) {
+	svc, store := setupTestTagsService(t)
+	putTestVolume(t, store, "vol-exists")
+
+	_, err := svc.BatchCreateTags(&BatchCreateTagsInput{
+		Resources: []*string{aws.String("i-test1"), aws.String("vol-exists"), aws.String("vol-missing")},
+		Tags:      []*ec2.Tag{{Key: aws.String("Project"), Value: aws.String("alpha")}},
+		Atomic:    true,
+	}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorInvalidVolumeNotFound)
+
+	out, err := svc.DescribeTags(&ec2.DescribeTagsInput{}, testAccountID)
+	require.NoError(t, err)
+	assert.Empty(t, out.Tags)
+}
+
+func TestBatchCreateTags_AtomicInvalidTag(t *testing.T) {
+	svc, _ := setupTestTagsService(t)
+
+	_, err := svc.BatchCreateTags(&BatchCreateTagsInput{
+		Resources: []*string{aws.String("i-test1")},
+		Tags:      []*ec2.Tag{{Key: aws.String("aws:reserved"), Value: aws.String("x")}},
+		Atomic:    true,
+	}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorInvalidTagKeyMalformed)
+
+	_, err = svc.BatchCreateTags(&BatchCreateTagsInput{
+		Resources: []*string{aws.String("i-test1")},
+		Tags:      []*ec2.Tag{{Key: aws.String(strings.Repeat("k", 129)), Value: aws.String("x")}},
+	}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorInvalidTagKeyMalformed)
+}
+
+func TestBatchCreateTags_AtomicRollbackOnWriteFailure(t *testing.T) {
+	store := &failingPutStore{MemoryObjectStore: objectstore.NewMemoryObjectStore()}
+	cfg := &config.Config{Predastore: config.PredastoreConfig{Bucket: "test-bucket"}}
+	svc := NewTagsServiceImplWithStore(cfg, store)
+
+	_, err := svc.CreateTags(&ec2.CreateTagsInput{
+		Resources: []*string{aws.String("i-test1")},
+		Tags:      []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String("original")}},
+	}, testAccountID)
+	require.NoError(t, err)
+
+	store.failKey = getTagsKey(testAccountID, "i-test2")
+	_, err = svc.BatchCreateTags(&BatchCreateTagsInput{
+		Resources: []*string{aws.String("i-test1"), aws.String("i-test2")},
+		Tags: []*ec2.Tag{
+			{Key: aws.String("Name"), Value: aws.String("updated")},
+			{Key: aws.String("Project"), Value: aws.String("alpha")},
+		},
+		Atomic: true,
+	}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorServerInternal)
+
+	// i-test1 was written before i-test2 failed and must be restored
+	assert.Equal(t, map[string]string{"Name": "original"}, describeResourceTags(t, svc, "i-test1"))
+	assert.Empty(t, describeResourceTags(t, svc, "i-test2"))
+}
+
+func TestBatchCreateTags_BestEffortPartial(t *testing.T) {
+	store := &failingPutStore{MemoryObjectStore: objectstore.NewMemoryObjectStore()}
+	cfg := &config.Config{Predastore: config.PredastoreConfig{Bucket: "test-bucket"}}
+	svc := NewTagsServiceImplWithStore(cfg, store)
+	putTestVolume(t, store, "vol-exists")
+	store.failKey = getTagsKey(testAccountID, "i-fail")
+
+	out, err := svc.BatchCreateTags(&BatchCreateTagsInput{
+		Resources: []*string{
+			aws.String("i-test1"),
+			aws.String("vol-missing"),
+			aws.String("bogus-123"),
+			aws.String("i-fail"),
+			aws.String("vol-exists"),
+			aws.String("i-test1"),
+		},
+		Tags: []*ec2.Tag{{Key: aws.String("Project"), Value: aws.String("alpha")}},
+	}, testAccountID)
+	require.NoError(t, err)
+
+	assert.Equal(t, []TagResourceResult{
+		{ResourceID: "i-test1"},
+		{ResourceID: "vol-missing", Error: awserrors.ErrorInvalidVolumeNotFound},
+		{ResourceID: "bogus-123", Error: awserrors.ErrorInvalidID},
+		{ResourceID: "i-fail", Error: awserrors.ErrorServerInternal},
+		{ResourceID: "vol-exists"},
+	}, out.Results)
+
+	assert.Equal(t, map[string]string{"Project": "alpha"}, describeResourceTags(t, svc, "i-test1"))
+	assert.Equal(t, map[string]string{"Project": "alpha"}, describeResourceTags(t, svc, "vol-exists"))
+	assert.Empty(t, describeResourceTags(t, svc, "vol-missing"))
+}
+
+func TestBatchCreateTags_TagLimitExceeded(t *testing.T) {
+	svc, _ := setupTestTagsService(t)
+
+	tags := make([]*ec2.Tag, 0, maxTagsPerResource+1)
+	for i := range maxTagsPerResource + 1 {
+		tags = append(tags, &ec2.Tag{Key: aws.String(fmt.Sprintf("k%d", i)), Value: aws.String("v")})
+	}
+
+	out, err := svc.BatchCreateTags(&BatchCreateTagsInput{
+		Resources: []*string{aws.String("i-test1")},
+		Tags:      tags,
+	}, testAccountID)
+	require.NoError(t, err)
+	require.Len(t, out.Results, 1)
+	assert.Equal(t, awserrors.ErrorTagLimitExceeded, out.Results[0].Error)
+}
+
+func TestBatchDeleteTags_AtomicAndBestEffort(t *testing.T) {
+	svc, store := setupTestTagsService(t)
+	putTestVolume(t, store, "vol-exists")
+
+	_, err := svc.CreateTags(&ec2.CreateTagsInput{
+		Resources: []*string{aws.String("i-test1"), aws.String("vol-exists")},
+		Tags: []*ec2.Tag{
+			{Key: aws.String("Name"), Value: aws.String("n")},
+			{Key: aws.String("Project"), Value: aws.String("alpha")},
+		},
+	}, testAccountID)
+	require.NoError(t, err)
+
+	// Atomic delete with a missing snapshot leaves every tag in place
+	_, err = svc.BatchDeleteTags(&BatchDeleteTagsInput{
+		Resources: []*string{aws.String("i-test1"), aws.String("snap-missing")},
+		Tags:      []*ec2.Tag{{Key: aws.String("Project")}},
+		Atomic:    true,
+	}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorInvalidSnapshotNotFound)
+	assert.Len(t, describeResourceTags(t, svc, "i-test1"), 2)
+
+	// Best-effort removes from the resources that exist
+	out, err := svc.BatchDeleteTags(&BatchDeleteTagsInput{
+		Resources: []*string{aws.String("i-test1"), aws.String("snap-missing"), aws.String("vol-exists")},
+		Tags:      []*ec2.Tag{{Key: aws.String("Project")}},
+	}, testAccountID)
+	require.NoError(t, err)
+	assert.Equal(t, []TagResourceResult{
+		{ResourceID: "i-test1"},
+		{ResourceID: "snap-missing", Error: awserrors.ErrorInvalidSnapshotNotFound},
+		{ResourceID: "vol-exists"},
+	}, out.Results)
+	assert.Equal(t, map[string]string{"Name": "n"}, describeResourceTags(t, svc, "i-test1"))
+	assert.Equal(t, map[string]string{"Name": "n"}, describeResourceTags(t, svc, "vol-exists"))
+}
+
+func TestBatchCreateTags_AtomicResourceLookup(t *testing.T) {
+	svc, _ := setupTestTagsService(t)
+	var looked []string
+	svc.SetResourceLookup(func(accountID, resourceID string) error {
+		assert.Equal(t, testAccountID, accountID)
+		looked = append(looked, resourceID)
+		if resourceID == "i-missing" {
+			return errors.New(awserrors.ErrorInvalidInstanceIDNotFound)
+		}
+		return nil
+	})
+
+	_, err := svc.BatchCreateTags(&BatchCreateTagsInput{
+		Resources: []*string{aws.String("vpc-exists"), aws.String("i-missing")},
+		Tags:      []*ec2.Tag{{Key: aws.String("Project"), Value: aws.String("alpha")}},
+		Atomic:    true,
+	}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorInvalidInstanceIDNotFound)
+	assert.Equal(t, []string{"vpc-exists", "i-missing"}, looked)
+	assert.Empty(t, describeResourceTags(t, svc, "vpc-exists"))
+
+	// Best-effort batches skip the lookup and tag every resource
+	looked = nil
+	out, err := svc.BatchCreateTags(&BatchCreateTagsInput{
+		Resources: []*string{aws.String("vpc-exists"), aws.String("i-missing")},
+		Tags:      []*ec2.Tag{{Key: aws.String("Project"), Value: aws.String("alpha")}},
+	}, testAccountID)
+	require.NoError(t, err)
+	assert.Empty(t, looked)
+	assert.Equal(t, []TagResourceResult{{ResourceID: "vpc-exists"}, {ResourceID: "i-missing"}}, out.Results)
+}
+
+func TestCreateTags_CrossAccountVolume(t *testing.T) {
+	svc, store := setupTestTagsService(t)
+	putTestVolumeOwnedBy(t, store, "vol-other", "222222222222")
+	var mirrored []string
+	svc.SetVolumeTagWriter(func(accountID, volumeID string, tags map[string]string) error {
+		mirrored = append(mirrored, volumeID)
+		return nil
+	})
+
+	_, err := svc.CreateTags(&ec2.CreateTagsInput{
+		Resources: []*string{aws.String("i-test1"), aws.String("vol-other")},
+		Tags:      []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String("stolen")}},
+	}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorInvalidVolumeNotFound)
+
+	_, err = svc.DeleteTags(&ec2.DeleteTagsInput{
+		Resources: []*string{aws.String("vol-other")},
+	}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorInvalidVolumeNotFound)
+
+	// Ownership is checked before any resource in the request is written.
+	assert.Empty(t, describeResourceTags(t, svc, "i-test1"))
+	assert.Empty(t, mirrored)
+
+	// The owner can still tag it.
+	_, err = svc.CreateTags(&ec2.CreateTagsInput{
+		Resources: []*string{aws.String("vol-other")},
+		Tags:      []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String("mine")}},
+	}, "222222222222")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"vol-other"}, mirrored)
+}
+
+func TestBatchCreateTags_AtomicCrossAccountOwner(t *testing.T) {
+	svc, store := setupTestTagsService(t)
+	putObject := func(key, body string) {
+		_, err := store.PutObject(&s3.PutObjectInput{
+			Bucket: aws.String("test-bucket"),
+			Key:    aws.String(key),
+			Body:   strings.NewReader(body),
+		})
+		require.NoError(t, err)
+	}
+	putTestVolume(t, store, "vol-mine")
+	putTestVolumeOwnedBy(t, store, "vol-other", "222222222222")
+	putObject("ami-other/config.json", `{"VolumeConfig":{"AMIMetadata":{"ImageOwnerAlias":"222222222222"}}}`)
+	putObject("ami-system/config.json", `{"VolumeConfig":{"AMIMetadata":{"ImageOwnerAlias":"spinifex"}}}`)
+	putObject("snap-other/metadata.json", `{"owner_id":"222222222222"}`)
+	putObject("snap-legacy/metadata.json", `{}`)
+
+	tests := []struct {
+		resourceID string
+		want       string
+	}{
+		{"vol-other", awserrors.ErrorInvalidVolumeNotFound},
+		{"ami-other", awserrors.ErrorInvalidAMIIDNotFound},
+		{"ami-system", awserrors.ErrorInvalidAMIIDNotFound},
+		{"snap-other", awserrors.ErrorInvalidSnapshotNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.resourceID, func(t *testing.T) {
+			_, err := svc.BatchCreateTags(&BatchCreateTagsInput{
+				Resources: []*string{aws.String("vol-mine"), aws.String(tt.resourceID)},
+				Tags:      []*ec2.Tag{{Key: aws.String("Project"), Value: aws.String("alpha")}},
+				Atomic:    true,
+			}, testAccountID)
+			assert.EqualError(t, err, tt.want)
+			assert.Empty(t, describeResourceTags(t, svc, "vol-mine"))
+		})
+	}
+
+	// Snapshots with no recorded owner predate ownership tracking.
+	_, err := svc.BatchCreateTags(&BatchCreateTagsInput{
+		Resources: []*string{aws.String("vol-mine"), aws.String("snap-legacy")},
+		Tags:      []*ec2.Tag{{Key: aws.String("Project"), Value: aws.String("alpha")}},
+		Atomic:    true,
+	}, testAccountID)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"Project": "alpha"}, describeResourceTags(t, svc, "snap-legacy"))
+}
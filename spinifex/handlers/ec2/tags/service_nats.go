@@ -29,3 +29,11 @@ func (s *NATSTagsService) DescribeTags(input *ec2.DescribeTagsInput, accountID s
 func (s *NATSTagsService) DeleteTags(input *ec2.DeleteTagsInput, accountID string) (*ec2.DeleteTagsOutput, error) {
 	return utils.NATSRequest[ec2.DeleteTagsOutput](s.natsConn, "ec2.DeleteTags", input, 30*time.Second, accountID)
 }
+
+func (s *NATSTagsService) BatchCreateTags(input *BatchCreateTagsInput, accountID string) (*BatchTagsOutput, error) {
+	return utils.NATSRequest[BatchTagsOutput](s.natsConn, "ec2.BatchCreateTags", input, 30*time.Second, accountID)
+}
+
+func (s *NATSTagsService) BatchDeleteTags(input *BatchDeleteTagsInput, accountID string) (*BatchTagsOutput, error) {
+	return utils.NATSRequest[BatchTagsOutput](s.natsConn, "ec2.BatchDeleteTags", input, 30*time.Second, accountID)
+}
@@ -0,0 +1,197 @@
+package handlers_ec2_volume
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/config"
+	"github.com/mulgadc/spinifex/spinifex/objectstore"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+)
+
+const gibBytes = 1024 * 1024 * 1024
+
+// validVolumeTypes are the EBS volume types the API accepts. Whether a type
+// can be created here depends on the node's Config.VolumeBackends mapping.
+var validVolumeTypes = map[string]bool{
+	"gp2":      true,
+	"gp3":      true,
+	"io1":      true,
+	"io2":      true,
+	"st1":      true,
+	"sc1":      true,
+	"standard": true,
+}
+
+// IsValidVolumeType reports whether volumeType is an EBS volume type.
+func IsValidVolumeType(volumeType string) bool {
+	return validVolumeTypes[volumeType]
+}
+
+// volumeBackendFor picks the storage backend for a new volume of volumeType
+// and checks this node has room for sizeGiB more of it.
+func (s *VolumeServiceImpl) volumeBackendFor(volumeType string, sizeGiB uint64) (string, error) {
+	backend := s.config.VolumeBackend(volumeType)
+	switch backend {
+	case "":
+		slog.Warn("Volume type not offered on this node", "volumeType", volumeType, "az", s.config.AZ)
+		return "", errors.New(awserrors.ErrorVolumeTypeNotAvailableInZone)
+	case config.VolumeBackendLocal:
+		capacity := s.config.LocalVolumes.CapacityGiB
+		if capacity == 0 {
+			break
+		}
+		used, err := s.localVolumeUsageGiB()
+		if err != nil {
+			slog.Error("Failed to measure local volume usage", "dir", s.config.LocalVolumes.Dir, "err", err)
+			return "", errors.New(awserrors.ErrorServerInternal)
+		}
+		if used+sizeGiB > capacity {
+			slog.Warn("Local volume capacity exhausted", "usedGiB", used, "requestedGiB", sizeGiB, "capacityGiB", capacity)
+			return "", errors.New(awserrors.ErrorInsufficientVolumeCapacity)
+		}
+	}
+	return backend, nil
+}
+
+// checkLocalGrowth checks this node has room to grow a local volume by
+// growGiB.
+func (s *VolumeServiceImpl) checkLocalGrowth(growGiB uint64) error {
+	capacity := s.config.LocalVolumes.CapacityGiB
+	if capacity == 0 {
+		return nil
+	}
+	used, err := s.localVolumeUsageGiB()
+	if err != nil {
+		slog.Error("Failed to measure local volume usage", "dir", s.config.LocalVolumes.Dir, "err", err)
+		return errors.New(awserrors.ErrorServerInternal)
+	}
+	if used+growGiB > capacity {
+		slog.Warn("Local volume capacity exhausted", "usedGiB", used, "growGiB", growGiB, "capacityGiB", capacity)
+		return errors.New(awserrors.ErrorVolumeModificationSizeLimitExceeded)
+	}
+	return nil
+}
+
+// localVolumeUsageGiB sums the provisioned size of every local volume file.
+// Files are sparse, so this counts what has been promised, not what is used.
+func (s *VolumeServiceImpl) localVolumeUsageGiB() (uint64, error) {
+	entries, err := os.ReadDir(s.config.LocalVolumes.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var total uint64
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".raw") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return 0, err
+		}
+		total += utils.SafeInt64ToUint64(info.Size())
+	}
+	return (total + gibBytes - 1) / gibBytes, nil
+}
+
+// createLocalVolume allocates the sparse raw file backing a local volume.
+func (s *VolumeServiceImpl) createLocalVolume(volumeID string, sizeGiB uint64) error {
+	path := s.config.LocalVolumePath(volumeID)
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return fmt.Errorf("create local volume dir: %w", err)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("create local volume file: %w", err)
+	}
+	if err := f.Truncate(utils.SafeUint64ToInt64(sizeGiB * gibBytes)); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return fmt.Errorf("size local volume file: %w", err)
+	}
+	return f.Close()
+}
+
+// resizeLocalVolume grows a local volume file to sizeGiB.
+func (s *VolumeServiceImpl) resizeLocalVolume(volumeID string, sizeGiB uint64) error {
+	return os.Truncate(s.config.LocalVolumePath(volumeID), utils.SafeUint64ToInt64(sizeGiB*gibBytes))
+}
+
+// deleteLocalVolume removes a local volume file. A missing file is not an
+// error so a retried DeleteVolume can finish cleaning up metadata.
+func (s *VolumeServiceImpl) deleteLocalVolume(volumeID string) error {
+	err := os.Remove(s.config.LocalVolumePath(volumeID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// localVolumeRecord is kept beside a local volume's config and names the
+// node holding its file.
+type localVolumeRecord struct {
+	Node string `json:"Node"`
+}
+
+// localVolumeKey returns the object key of a local volume's record.
+func localVolumeKey(volumeID string) string {
+	return volumeID + "/local.json"
+}
+
+// putLocalVolumeNode records that this node holds volumeID's file.
+func (s *VolumeServiceImpl) putLocalVolumeNode(volumeID string) error {
+	data, err := json.Marshal(localVolumeRecord{Node: s.config.Node})
+	if err != nil {
+		return fmt.Errorf("failed to marshal local volume record: %w", err)
+	}
+	_, err = s.store.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(localVolumeKey(volumeID)),
+		Body:   bytes.NewReader(data),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write local volume record: %w", err)
+	}
+	return nil
+}
+
+// LocalVolumeNode returns the node holding a local volume's file. Volumes
+// created before the record was kept report "".
+func (s *VolumeServiceImpl) LocalVolumeNode(volumeID string) (string, error) {
+	getResult, err := s.store.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(localVolumeKey(volumeID)),
+	})
+	if err != nil {
+		if objectstore.IsNoSuchKeyError(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to get local volume record: %w", err)
+	}
+	defer getResult.Body.Close()
+
+	body, err := io.ReadAll(getResult.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read local volume record: %w", err)
+	}
+	var record localVolumeRecord
+	if err := json.Unmarshal(body, &record); err != nil {
+		return "", fmt.Errorf("failed to decode local volume record: %w", err)
+	}
+	return record.Node, nil
+}
@@ -0,0 +1,264 @@
+package handlers_ec2_volume
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/config"
+	"github.com/mulgadc/spinifex/spinifex/objectstore"
+	"github.com/mulgadc/spinifex/spinifex/testutil"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTieredVolumeService returns a service on a node that keeps gp3 on
+// viperblock and io2 on local disk with capacityGiB of room.
+func newTieredVolumeService(t *testing.T, capacityGiB uint64) *VolumeServiceImpl {
+	t.Helper()
+	svc := newTestVolumeServiceWithStore("ap-southeast-2a", objectstore.NewMemoryObjectStore())
+	svc.config.VolumeBackends = map[string]string{
+		"gp3": config.VolumeBackendViperblock,
+		"io2": config.VolumeBackendLocal,
+	}
+	svc.config.LocalVolumes = config.LocalVolumeConfig{Dir: t.TempDir(), CapacityGiB: capacityGiB}
+	return svc
+}
+
+func TestVolumeBackendFor(t *testing.T) {
+	svc := newTieredVolumeService(t, 0)
+
+	tests := []struct {
+		volumeType  string
+		wantBackend string
+		wantErr     string
+	}{
+		{volumeType: "", wantBackend: config.VolumeBackendViperblock},
+		{volumeType: "gp3", wantBackend: config.VolumeBackendViperblock},
+		{volumeType: "io2", wantBackend: config.VolumeBackendLocal},
+		{volumeType: "st1", wantErr: awserrors.ErrorVolumeTypeNotAvailableInZone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.volumeType, func(t *testing.T) {
+			backend, err := svc.volumeBackendFor(tt.volumeType, 10)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Equal(t, tt.wantErr, err.Error())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantBackend, backend)
+		})
+	}
+}
+
+func TestCreateVolume_LocalBackend(t *testing.T) {
+	svc := newTieredVolumeService(t, 0)
+	svc.config.Node = "node-a"
+
+	vol, err := svc.CreateVolume(&ec2.CreateVolumeInput{
+		Size:             aws.Int64(2),
+		AvailabilityZone: aws.String("ap-southeast-2a"),
+		VolumeType:       aws.String("io2"),
+		Iops:             aws.Int64(2000),
+	}, "123456789012")
+	require.NoError(t, err)
+	assert.Equal(t, "io2", *vol.VolumeType)
+	assert.Equal(t, int64(2000), *vol.Iops)
+
+	info, err := os.Stat(svc.config.LocalVolumePath(*vol.VolumeId))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2*gibBytes), info.Size())
+
+	cfg, err := svc.GetVolumeConfig(*vol.VolumeId)
+	require.NoError(t, err)
+	assert.Equal(t, "io2", cfg.VolumeMetadata.VolumeType)
+	assert.Equal(t, "available", cfg.VolumeMetadata.State)
+
+	node, err := svc.LocalVolumeNode(*vol.VolumeId)
+	require.NoError(t, err)
+	assert.Equal(t, "node-a", node, "attach checks the file is on the instance's node")
+
+	// Grow through ModifyVolume, then delete
+	_, err = svc.ModifyVolume(&ec2.ModifyVolumeInput{VolumeId: vol.VolumeId, Size: aws.Int64(4)}, "123456789012")
+	require.NoError(t, err)
+	info, err = os.Stat(svc.config.LocalVolumePath(*vol.VolumeId))
+	require.NoError(t, err)
+	assert.Equal(t, int64(4*gibBytes), info.Size())
+
+	svc.snapshotKV = setupTestVolumeKV(t)
+	_, err = svc.DeleteVolume(&ec2.DeleteVolumeInput{VolumeId: vol.VolumeId}, "123456789012")
+	require.NoError(t, err)
+	_, err = os.Stat(svc.config.LocalVolumePath(*vol.VolumeId))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestCreateVolume_DefaultTags(t *testing.T) {
+	svc := newTieredVolumeService(t, 0)
+	svc.config.Daemon.DefaultTags = []config.DefaultTag{
+		{Key: "owner", Value: "platform"},
+		{Key: "backup", Value: "daily"},
+	}
+
+	vol, err := svc.CreateVolume(&ec2.CreateVolumeInput{
+		Size:             aws.Int64(1),
+		AvailabilityZone: aws.String("ap-southeast-2a"),
+		VolumeType:       aws.String("io2"),
+		TagSpecifications: []*ec2.TagSpecification{{
+			ResourceType: aws.String("volume"),
+			Tags:         []*ec2.Tag{{Key: aws.String("backup"), Value: aws.String("none")}},
+		}},
+	}, "123456789012")
+	require.NoError(t, err)
+
+	want := map[string]string{"owner": "platform", "backup": "none"}
+	cfg, err := svc.GetVolumeConfig(*vol.VolumeId)
+	require.NoError(t, err)
+	assert.Equal(t, want, cfg.VolumeMetadata.Tags)
+	assert.Len(t, vol.Tags, 2)
+}
+
+func TestCreateVolume_LocalBackendCapacity(t *testing.T) {
+	svc := newTieredVolumeService(t, 5)
+
+	_, err := svc.CreateVolume(&ec2.CreateVolumeInput{
+		Size:             aws.Int64(3),
+		AvailabilityZone: aws.String("ap-southeast-2a"),
+		VolumeType:       aws.String("io2"),
+	}, "")
+	require.NoError(t, err)
+
+	_, err = svc.CreateVolume(&ec2.CreateVolumeInput{
+		Size:             aws.Int64(3),
+		AvailabilityZone: aws.String("ap-southeast-2a"),
+		VolumeType:       aws.String("io2"),
+	}, "")
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorInsufficientVolumeCapacity, err.Error())
+}
+
+func TestCreateVolume_LocalBackendRejectsSnapshot(t *testing.T) {
+	svc := newTieredVolumeService(t, 0)
+	snapData, err := json.Marshal(snapshotMetadata{VolumeID: "vol-src", VolumeSize: 2})
+	require.NoError(t, err)
+	_, err = svc.store.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String("test-bucket"),
+		Key:    aws.String("snap-local/metadata.json"),
+		Body:   bytes.NewReader(snapData),
+	})
+	require.NoError(t, err)
+
+	_, err = svc.CreateVolume(&ec2.CreateVolumeInput{
+		AvailabilityZone: aws.String("ap-southeast-2a"),
+		VolumeType:       aws.String("io2"),
+		SnapshotId:       aws.String("snap-local"),
+	}, "")
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorInvalidParameterCombination, err.Error())
+}
+
+func TestModifyVolume_RejectsBackendChange(t *testing.T) {
+	svc := newTieredVolumeService(t, 0)
+
+	vol, err := svc.CreateVolume(&ec2.CreateVolumeInput{
+		Size:             aws.Int64(1),
+		AvailabilityZone: aws.String("ap-southeast-2a"),
+		VolumeType:       aws.String("io2"),
+	}, "")
+	require.NoError(t, err)
+
+	_, err = svc.ModifyVolume(&ec2.ModifyVolumeInput{VolumeId: vol.VolumeId, VolumeType: aws.String("gp3")}, "")
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorInvalidParameterCombination, err.Error())
+}
+
+func TestModifyVolume_LocalCapacity(t *testing.T) {
+	svc := newTieredVolumeService(t, 4)
+
+	vol, err := svc.CreateVolume(&ec2.CreateVolumeInput{
+		Size:             aws.Int64(2),
+		AvailabilityZone: aws.String("ap-southeast-2a"),
+		VolumeType:       aws.String("io2"),
+	}, "")
+	require.NoError(t, err)
+
+	_, err = svc.ModifyVolume(&ec2.ModifyVolumeInput{VolumeId: vol.VolumeId, Size: aws.Int64(5)}, "")
+	assert.EqualError(t, err, awserrors.ErrorVolumeModificationSizeLimitExceeded)
+
+	_, err = svc.ModifyVolume(&ec2.ModifyVolumeInput{VolumeId: vol.VolumeId, Size: aws.Int64(4)}, "")
+	require.NoError(t, err)
+	info, err := os.Stat(svc.config.LocalVolumePath(*vol.VolumeId))
+	require.NoError(t, err)
+	assert.Equal(t, int64(4*gibBytes), info.Size())
+}
+
+func TestCreateVolume_CacheMode(t *testing.T) {
+	svc := newTieredVolumeService(t, 0)
+	cacheMode := func(mode string) []*ec2.TagSpecification {
+		return []*ec2.TagSpecification{{
+			ResourceType: aws.String("volume"),
+			Tags:         []*ec2.Tag{{Key: aws.String("spinifex:cache-mode"), Value: aws.String(mode)}},
+		}}
+	}
+
+	vol, err := svc.CreateVolume(&ec2.CreateVolumeInput{
+		Size:              aws.Int64(1),
+		AvailabilityZone:  aws.String("ap-southeast-2a"),
+		VolumeType:        aws.String("io2"),
+		TagSpecifications: cacheMode("writeback"),
+	}, "123456789012")
+	require.NoError(t, err)
+	cfg, err := svc.GetVolumeConfig(*vol.VolumeId)
+	require.NoError(t, err)
+	assert.Equal(t, "writeback", cfg.VolumeMetadata.Tags["spinifex:cache-mode"])
+
+	_, err = svc.CreateVolume(&ec2.CreateVolumeInput{
+		Size:              aws.Int64(1),
+		AvailabilityZone:  aws.String("ap-southeast-2a"),
+		VolumeType:        aws.String("io2"),
+		TagSpecifications: cacheMode("unsafe"),
+	}, "123456789012")
+	assert.EqualError(t, err, awserrors.ErrorInvalidParameterValue)
+
+	// A host-side write cache is not shared between attachments.
+	_, err = svc.CreateVolume(&ec2.CreateVolumeInput{
+		Size:               aws.Int64(1),
+		AvailabilityZone:   aws.String("ap-southeast-2a"),
+		VolumeType:         aws.String("io2"),
+		MultiAttachEnabled: aws.Bool(true),
+		TagSpecifications:  cacheMode("writeback"),
+	}, "123456789012")
+	assert.EqualError(t, err, awserrors.ErrorInvalidParameterCombination)
+}
+
+func TestVolumeTimestamps_FakeClock(t *testing.T) {
+	svc := newTieredVolumeService(t, 0)
+	created := time.Date(2026, 5, 1, 9, 30, 0, 0, time.UTC)
+	clock := testutil.NewFakeClock(created)
+	t.Cleanup(utils.SetClock(clock))
+
+	vol, err := svc.CreateVolume(&ec2.CreateVolumeInput{
+		Size:             aws.Int64(1),
+		AvailabilityZone: aws.String("ap-southeast-2a"),
+		VolumeType:       aws.String("io2"),
+	}, "123456789012")
+	require.NoError(t, err)
+	assert.Equal(t, created, aws.TimeValue(vol.CreateTime))
+
+	clock.Advance(5 * time.Minute)
+	require.NoError(t, svc.UpdateVolumeState(*vol.VolumeId, "in-use", "i-clock", "/dev/sdf"))
+
+	out, err := svc.DescribeVolumes(&ec2.DescribeVolumesInput{VolumeIds: []*string{vol.VolumeId}}, "123456789012")
+	require.NoError(t, err)
+	require.Len(t, out.Volumes, 1)
+	assert.Equal(t, created, aws.TimeValue(out.Volumes[0].CreateTime))
+	require.Len(t, out.Volumes[0].Attachments, 1)
+	assert.Equal(t, created.Add(5*time.Minute), aws.TimeValue(out.Volumes[0].Attachments[0].AttachTime))
+}
@@ -0,0 +1,155 @@
+package handlers_ec2_volume
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/kms"
+	"github.com/mulgadc/spinifex/spinifex/objectstore"
+	"github.com/mulgadc/spinifex/spinifex/types"
+)
+
+// newVolumeEncryption generates a data key for a new volume, wrapped by the
+// KMS key kmsKeyID names (the default key when empty).
+func (s *VolumeServiceImpl) newVolumeEncryption(kmsKeyID, accountID string) (*types.VolumeEncryption, error) {
+	if s.keys == nil {
+		slog.Error("CreateVolume: no KMS key store on this node")
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+	keyID, err := s.keys.ResolveKeyID(kmsKeyID)
+	if errors.Is(err, kms.ErrKeyNotFound) {
+		slog.Error("CreateVolume: KMS key not found", "kmsKeyId", kmsKeyID)
+		return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+	} else if err != nil {
+		slog.Error("CreateVolume: failed to resolve KMS key", "kmsKeyId", kmsKeyID, "err", err)
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+
+	_, wrapped, err := s.keys.GenerateDataKey(keyID)
+	if err != nil {
+		slog.Error("CreateVolume: failed to generate data key", "kmsKeyId", keyID, "err", err)
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+	return &types.VolumeEncryption{
+		KmsKeyID: kms.KeyARN(s.config.Region, accountID, keyID),
+		DataKey:  wrapped,
+	}, nil
+}
+
+// snapshotEncryption returns the encryption record of a volume restored from
+// a snapshot. The volume shares the snapshot's LUKS header, so it keeps the
+// snapshot's data key; re-encrypting under another key, or encrypting a
+// plaintext snapshot, would mean copying every block.
+func (s *VolumeServiceImpl) snapshotEncryption(snap *snapshotMetadata, encrypted bool, kmsKeyID string) (*types.VolumeEncryption, error) {
+	if snap.Encryption == nil {
+		if encrypted {
+			slog.Error("CreateVolume: cannot encrypt a volume restored from an unencrypted snapshot")
+			return nil, errors.New(awserrors.ErrorInvalidParameterCombination)
+		}
+		return nil, nil
+	}
+	if kmsKeyID != "" {
+		if s.keys == nil {
+			slog.Error("CreateVolume: no KMS key store on this node")
+			return nil, errors.New(awserrors.ErrorServerInternal)
+		}
+		want, err := s.keys.ResolveKeyID(kmsKeyID)
+		if err != nil {
+			return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+		}
+		got, err := s.keys.ResolveKeyID(snap.Encryption.KmsKeyID)
+		if err != nil || got != want {
+			slog.Error("CreateVolume: snapshot is encrypted under another KMS key", "kmsKeyId", kmsKeyID)
+			return nil, errors.New(awserrors.ErrorInvalidParameterCombination)
+		}
+	}
+	restored := *snap.Encryption
+	return &restored, nil
+}
+
+// getVolumeEncryption reads a volume's encryption record.
+func (s *VolumeServiceImpl) getVolumeEncryption(volumeID string) (*types.VolumeEncryption, error) {
+	getResult, err := s.store.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(types.VolumeEncryptionKey(volumeID)),
+	})
+	if err != nil {
+		if objectstore.IsNoSuchKeyError(err) {
+			return nil, errors.New(awserrors.ErrorInvalidVolumeNotFound)
+		}
+		return nil, fmt.Errorf("failed to get encryption record: %w", err)
+	}
+	defer getResult.Body.Close()
+
+	body, err := io.ReadAll(getResult.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encryption record: %w", err)
+	}
+	var enc types.VolumeEncryption
+	if err := json.Unmarshal(body, &enc); err != nil {
+		return nil, fmt.Errorf("failed to decode encryption record: %w", err)
+	}
+	return &enc, nil
+}
+
+// putVolumeEncryption writes a volume's encryption record.
+func (s *VolumeServiceImpl) putVolumeEncryption(volumeID string, enc *types.VolumeEncryption) error {
+	data, err := json.Marshal(enc)
+	if err != nil {
+		return fmt.Errorf("failed to marshal encryption record: %w", err)
+	}
+	_, err = s.store.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(types.VolumeEncryptionKey(volumeID)),
+		Body:   bytes.NewReader(data),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write encryption record: %w", err)
+	}
+	return nil
+}
+
+// SetKeyStore sets the KMS key store encrypted volumes' data keys are
+// wrapped with.
+func (s *VolumeServiceImpl) SetKeyStore(keys *kms.Store) {
+	s.keys = keys
+}
+
+// VolumeDataKey unwraps the data key of an encrypted volume for the daemon
+// attaching it, and reports whether the volume has been formatted yet.
+func (s *VolumeServiceImpl) VolumeDataKey(volumeID string) ([]byte, bool, error) {
+	enc, err := s.getVolumeEncryption(volumeID)
+	if err != nil {
+		return nil, false, err
+	}
+	if s.keys == nil {
+		return nil, false, errors.New("no KMS key store on this node")
+	}
+	keyID, err := s.keys.ResolveKeyID(enc.KmsKeyID)
+	if err != nil {
+		return nil, false, fmt.Errorf("KMS key %s: %w", enc.KmsKeyID, err)
+	}
+	key, err := s.keys.Decrypt(keyID, enc.DataKey)
+	if err != nil {
+		return nil, false, err
+	}
+	return key, enc.Formatted, nil
+}
+
+// MarkVolumeFormatted records that an encrypted volume's LUKS header has
+// been written.
+func (s *VolumeServiceImpl) MarkVolumeFormatted(volumeID string) error {
+	enc, err := s.getVolumeEncryption(volumeID)
+	if err != nil {
+		return err
+	}
+	enc.Formatted = true
+	return s.putVolumeEncryption(volumeID, enc)
+}
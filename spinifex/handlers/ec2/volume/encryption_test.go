@@ -0,0 +1,135 @@
+package handlers_ec2_volume
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/kms"
+	"github.com/mulgadc/spinifex/spinifex/testutil"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newEncryptingVolumeService(t *testing.T) *VolumeServiceImpl {
+	t.Helper()
+	svc := newTieredVolumeService(t, 0)
+	svc.config.Region = "ap-southeast-2"
+	_, _, js := testutil.StartTestJetStream(t)
+	keys, err := kms.OpenStore(js, bytes.Repeat([]byte{0x42}, 32))
+	require.NoError(t, err)
+	svc.SetKeyStore(keys)
+	return svc
+}
+
+func TestCreateVolume_Encrypted(t *testing.T) {
+	svc := newEncryptingVolumeService(t)
+
+	vol, err := svc.CreateVolume(&ec2.CreateVolumeInput{
+		Size:             aws.Int64(1),
+		AvailabilityZone: aws.String("ap-southeast-2a"),
+		VolumeType:       aws.String("io2"),
+		Encrypted:        aws.Bool(true),
+	}, "123456789012")
+	require.NoError(t, err)
+	assert.True(t, aws.BoolValue(vol.Encrypted))
+	assert.Regexp(t, `^arn:aws:kms:ap-southeast-2:123456789012:key/[0-9a-f-]{36}$`, aws.StringValue(vol.KmsKeyId))
+
+	// Only the wrapped data key is stored.
+	enc, err := svc.getVolumeEncryption(*vol.VolumeId)
+	require.NoError(t, err)
+	key, formatted, err := svc.VolumeDataKey(*vol.VolumeId)
+	require.NoError(t, err)
+	assert.Len(t, key, 32)
+	assert.False(t, formatted)
+	assert.NotContains(t, enc.DataKey, string(key))
+
+	require.NoError(t, svc.MarkVolumeFormatted(*vol.VolumeId))
+	again, formatted, err := svc.VolumeDataKey(*vol.VolumeId)
+	require.NoError(t, err)
+	assert.True(t, formatted)
+	assert.Equal(t, key, again)
+
+	out, err := svc.DescribeVolumes(&ec2.DescribeVolumesInput{VolumeIds: []*string{vol.VolumeId}}, "123456789012")
+	require.NoError(t, err)
+	require.Len(t, out.Volumes, 1)
+	assert.True(t, aws.BoolValue(out.Volumes[0].Encrypted))
+	assert.Equal(t, aws.StringValue(vol.KmsKeyId), aws.StringValue(out.Volumes[0].KmsKeyId))
+
+	// A named key is used as given.
+	keyID, err := svc.keys.CreateKey()
+	require.NoError(t, err)
+	vol, err = svc.CreateVolume(&ec2.CreateVolumeInput{
+		Size:             aws.Int64(1),
+		AvailabilityZone: aws.String("ap-southeast-2a"),
+		VolumeType:       aws.String("io2"),
+		Encrypted:        aws.Bool(true),
+		KmsKeyId:         aws.String(keyID),
+	}, "123456789012")
+	require.NoError(t, err)
+	assert.Equal(t, kms.KeyARN("ap-southeast-2", "123456789012", keyID), aws.StringValue(vol.KmsKeyId))
+}
+
+func TestCreateVolume_EncryptionErrors(t *testing.T) {
+	svc := newEncryptingVolumeService(t)
+
+	tests := []struct {
+		name      string
+		encrypted *bool
+		kmsKeyID  *string
+		want      string
+	}{
+		{"key without encryption", nil, aws.String(kms.DefaultKeyAlias), awserrors.ErrorInvalidParameterDependency},
+		{"unknown key", aws.Bool(true), aws.String("alias/missing"), awserrors.ErrorInvalidParameterValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.CreateVolume(&ec2.CreateVolumeInput{
+				Size:             aws.Int64(1),
+				AvailabilityZone: aws.String("ap-southeast-2a"),
+				VolumeType:       aws.String("io2"),
+				Encrypted:        tt.encrypted,
+				KmsKeyId:         tt.kmsKeyID,
+			}, "123456789012")
+			assert.EqualError(t, err, tt.want)
+		})
+	}
+}
+
+func TestSnapshotEncryption(t *testing.T) {
+	svc := newEncryptingVolumeService(t)
+	keyID, err := svc.keys.CreateKey()
+	require.NoError(t, err)
+	otherID, err := svc.keys.CreateKey()
+	require.NoError(t, err)
+	record := &types.VolumeEncryption{KmsKeyID: kms.KeyARN("ap-southeast-2", "123456789012", keyID), DataKey: "wrapped", Formatted: true}
+
+	tests := []struct {
+		name      string
+		snapshot  *types.VolumeEncryption
+		encrypted bool
+		kmsKeyID  string
+		want      *types.VolumeEncryption
+		wantErr   string
+	}{
+		{name: "plaintext", want: nil},
+		{name: "encrypt plaintext", encrypted: true, wantErr: awserrors.ErrorInvalidParameterCombination},
+		{name: "encrypted", snapshot: record, want: record},
+		{name: "same key", snapshot: record, encrypted: true, kmsKeyID: keyID, want: record},
+		{name: "other key", snapshot: record, encrypted: true, kmsKeyID: otherID, wantErr: awserrors.ErrorInvalidParameterCombination},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := svc.snapshotEncryption(&snapshotMetadata{Encryption: tt.snapshot}, tt.encrypted, tt.kmsKeyID)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
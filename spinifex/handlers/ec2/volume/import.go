@@ -0,0 +1,757 @@
+package handlers_ec2_volume
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/config"
+	handlers_ec2_snapshot "github.com/mulgadc/spinifex/spinifex/handlers/ec2/snapshot"
+	"github.com/mulgadc/spinifex/spinifex/objectstore"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	vbtypes "github.com/mulgadc/viperblock/types"
+	"github.com/mulgadc/viperblock/viperblock"
+	s3backend "github.com/mulgadc/viperblock/viperblock/backends/s3"
+)
+
+// Conversion task states as stored. DescribeConversionTasks reports a failed
+// volume import as cancelled, and DescribeImportSnapshotTasks a failed
+// snapshot import as deleted, as EC2 does.
+const (
+	conversionTaskActive    = "active"
+	conversionTaskCompleted = "completed"
+	conversionTaskFailed    = "failed"
+)
+
+const (
+	importVolumeTaskPrefix   = "import-vol"
+	importSnapshotTaskPrefix = "import-snap"
+
+	// importFlushBytes is how much of an image is written between flushes of
+	// the volume's WAL to chunks, and so between progress updates.
+	importFlushBytes = 4 * 1024 * 1024
+)
+
+// importFormats maps the image formats EC2 accepts, plus QCOW2, to their
+// qemu-img names.
+var importFormats = map[string]string{
+	"RAW":   "raw",
+	"QCOW2": "qcow2",
+	"VMDK":  "vmdk",
+}
+
+// conversionTask is an ImportVolume or ImportSnapshot task as stored in the
+// object store. The node running the import updates it as the image is
+// written, so any node can describe it.
+type conversionTask struct {
+	TaskID           string `json:"task_id"`
+	OwnerID          string `json:"owner_id"`
+	State            string `json:"state"`
+	StatusMessage    string `json:"status_message,omitempty"`
+	Description      string `json:"description,omitempty"`
+	Source           string `json:"source"`
+	Format           string `json:"format"`
+	AvailabilityZone string `json:"availability_zone"`
+	// ImageBytes is the size of the source image, RawBytes the size of its
+	// raw contents, and BytesConverted how much of those has been written.
+	ImageBytes     int64 `json:"image_bytes"`
+	RawBytes       int64 `json:"raw_bytes"`
+	BytesConverted int64 `json:"bytes_converted"`
+	// VolumeID is the imported volume, or for ImportSnapshot the hidden
+	// volume SnapshotID is taken of. VolumeSizeGiB is zero for snapshots
+	// until the image's size is known.
+	VolumeID      string            `json:"volume_id"`
+	VolumeSizeGiB int64             `json:"volume_size_gib"`
+	SnapshotID    string            `json:"snapshot_id,omitempty"`
+	Tags          map[string]string `json:"tags,omitempty"`
+	StartTime     time.Time         `json:"start_time"`
+}
+
+func (t *conversionTask) isSnapshotImport() bool {
+	return strings.HasPrefix(t.TaskID, importSnapshotTaskPrefix+"-")
+}
+
+// progress returns the percentage of the image written so far.
+func (t *conversionTask) progress() int64 {
+	if t.State == conversionTaskCompleted {
+		return 100
+	}
+	if t.RawBytes == 0 {
+		return 0
+	}
+	return t.BytesConverted * 100 / t.RawBytes
+}
+
+func conversionTaskPrefix(accountID string) string {
+	return fmt.Sprintf("conversion-tasks/%s/", accountID)
+}
+
+func conversionTaskKey(accountID, taskID string) string {
+	return conversionTaskPrefix(accountID) + taskID + ".json"
+}
+
+func (s *VolumeServiceImpl) putConversionTask(task *conversionTask) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("marshal conversion task: %w", err)
+	}
+	if _, err := s.store.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(s.bucketName),
+		Key:         aws.String(conversionTaskKey(task.OwnerID, task.TaskID)),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	}); err != nil {
+		return fmt.Errorf("write conversion task: %w", err)
+	}
+	return nil
+}
+
+func (s *VolumeServiceImpl) getConversionTask(accountID, taskID string) (*conversionTask, error) {
+	result, err := s.store.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(conversionTaskKey(accountID, taskID)),
+	})
+	if err != nil {
+		if objectstore.IsNoSuchKeyError(err) {
+			return nil, errors.New(awserrors.ErrorInvalidConversionTaskId)
+		}
+		slog.Error("Failed to read conversion task", "taskId", taskID, "err", err)
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+	defer result.Body.Close()
+
+	var task conversionTask
+	if err := json.NewDecoder(result.Body).Decode(&task); err != nil {
+		slog.Error("Failed to decode conversion task", "taskId", taskID, "err", err)
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+	return &task, nil
+}
+
+// listConversionTasks returns accountID's tasks whose IDs start with prefix.
+func (s *VolumeServiceImpl) listConversionTasks(accountID, prefix string) ([]*conversionTask, error) {
+	result, err := s.store.ListObjectsV2(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucketName),
+		Prefix: aws.String(conversionTaskPrefix(accountID) + prefix),
+	})
+	if err != nil {
+		slog.Error("Failed to list conversion tasks", "accountID", accountID, "err", err)
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+
+	var tasks []*conversionTask
+	for _, obj := range result.Contents {
+		if obj.Key == nil || !strings.HasSuffix(*obj.Key, ".json") {
+			continue
+		}
+		taskID := strings.TrimSuffix(strings.TrimPrefix(*obj.Key, conversionTaskPrefix(accountID)), ".json")
+		task, err := s.getConversionTask(accountID, taskID)
+		if err != nil {
+			slog.Debug("Failed to get conversion task", "key", *obj.Key, "err", err)
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+// getConversionTasks returns the tasks taskIDs name, or every task with the
+// given prefix when there are none.
+func (s *VolumeServiceImpl) getConversionTasks(accountID, prefix string, taskIDs []*string) ([]*conversionTask, error) {
+	if len(taskIDs) == 0 {
+		return s.listConversionTasks(accountID, prefix)
+	}
+	tasks := make([]*conversionTask, 0, len(taskIDs))
+	for _, id := range taskIDs {
+		if id == nil {
+			continue
+		}
+		if !strings.HasPrefix(*id, prefix+"-") {
+			return nil, errors.New(awserrors.ErrorInvalidConversionTaskIdMalformed)
+		}
+		task, err := s.getConversionTask(accountID, *id)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+// importSource is where an image is imported from: an object, or a file
+// under the node's import directory.
+type importSource struct {
+	bucket string
+	key    string
+	path   string
+}
+
+func (src importSource) String() string {
+	if src.path != "" {
+		return src.path
+	}
+	return "s3://" + src.bucket + "/" + src.key
+}
+
+// parseImportSource resolves an s3://bucket/key URL or a local path. The
+// object is read with the node's object store credentials, so the bucket
+// holding volumes is refused. Local paths, with or without file://, must
+// be under Config.ImportDir once symlinks are resolved.
+func (s *VolumeServiceImpl) parseImportSource(url string) (importSource, error) {
+	if rest, ok := strings.CutPrefix(url, "s3://"); ok {
+		bucket, key, _ := strings.Cut(rest, "/")
+		return s.bucketImportSource(bucket, key)
+	}
+
+	path := strings.TrimPrefix(url, "file://")
+	if !filepath.IsAbs(path) {
+		return importSource{}, errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		slog.Warn("Import image not found", "path", path, "err", err)
+		return importSource{}, errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	dir, err := filepath.EvalSymlinks(s.config.ImportDir())
+	if err != nil {
+		slog.Warn("Import directory not found", "dir", s.config.ImportDir(), "err", err)
+		return importSource{}, errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if rel, err := filepath.Rel(dir, resolved); err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		slog.Warn("Import image outside the import directory", "path", path, "dir", dir)
+		return importSource{}, errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	return importSource{path: resolved}, nil
+}
+
+func (s *VolumeServiceImpl) bucketImportSource(bucket, key string) (importSource, error) {
+	if bucket == "" || key == "" || bucket == s.bucketName {
+		return importSource{}, errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	return importSource{bucket: bucket, key: key}, nil
+}
+
+// parseImportFormat returns the qemu-img name of an image format.
+func parseImportFormat(format *string) (string, error) {
+	if format == nil || *format == "" {
+		return "", errors.New(awserrors.ErrorMissingParameter)
+	}
+	name, ok := importFormats[strings.ToUpper(*format)]
+	if !ok {
+		return "", errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	return name, nil
+}
+
+// ImportVolume starts importing a RAW, QCOW2 or VMDK image into a new gp3
+// volume of Volume.Size GiB. Image.ImportManifestUrl names the image itself,
+// as an s3:// URL or a local path, rather than a manifest. The volume
+// appears once the returned task completes.
+func (s *VolumeServiceImpl) ImportVolume(input *ec2.ImportVolumeInput, accountID string) (*ec2.ImportVolumeOutput, error) {
+	if input == nil {
+		return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if input.AvailabilityZone == nil || *input.AvailabilityZone == "" ||
+		input.Image == nil || input.Image.ImportManifestUrl == nil || input.Volume == nil || input.Volume.Size == nil {
+		return nil, errors.New(awserrors.ErrorMissingParameter)
+	}
+	if *input.AvailabilityZone != s.config.AZ {
+		return nil, errors.New(awserrors.ErrorInvalidAvailabilityZone)
+	}
+	size := *input.Volume.Size
+	if size < 1 || size > maxVolumeSizeGiB {
+		return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	format, err := parseImportFormat(input.Image.Format)
+	if err != nil {
+		return nil, err
+	}
+	src, err := s.parseImportSource(*input.Image.ImportManifestUrl)
+	if err != nil {
+		return nil, err
+	}
+	backend, err := s.volumeBackendFor(config.DefaultVolumeType, utils.SafeInt64ToUint64(size))
+	if err != nil {
+		return nil, err
+	}
+	if backend != config.VolumeBackendViperblock {
+		slog.Error("ImportVolume requires the viperblock backend", "type", config.DefaultVolumeType, "backend", backend)
+		return nil, errors.New(awserrors.ErrorInvalidParameterCombination)
+	}
+
+	task := &conversionTask{
+		TaskID:           utils.GenerateResourceID(importVolumeTaskPrefix),
+		OwnerID:          accountID,
+		State:            conversionTaskActive,
+		Description:      aws.StringValue(input.Description),
+		Source:           src.String(),
+		Format:           format,
+		AvailabilityZone: *input.AvailabilityZone,
+		VolumeID:         utils.GenerateResourceID("vol"),
+		VolumeSizeGiB:    size,
+		StartTime:        utils.Now(),
+	}
+	if err := s.startImport(task, src); err != nil {
+		return nil, err
+	}
+	return &ec2.ImportVolumeOutput{ConversionTask: task.toConversionTask()}, nil
+}
+
+// ImportSnapshot starts importing a RAW, QCOW2 or VMDK image into a new
+// snapshot, from DiskContainer.UserBucket or DiskContainer.Url, which takes
+// an s3:// URL or a local path. The snapshot is taken of a hidden volume
+// sized to fit the image.
+func (s *VolumeServiceImpl) ImportSnapshot(input *ec2.ImportSnapshotInput, accountID string) (*ec2.ImportSnapshotOutput, error) {
+	if input == nil {
+		return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if input.DiskContainer == nil {
+		return nil, errors.New(awserrors.ErrorMissingParameter)
+	}
+	// Imported blocks are written in the clear; volumes are only encrypted
+	// from their first attach.
+	if aws.BoolValue(input.Encrypted) || aws.StringValue(input.KmsKeyId) != "" {
+		return nil, errors.New(awserrors.ErrorUnsupportedOperation)
+	}
+	format, err := parseImportFormat(input.DiskContainer.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	var src importSource
+	disk := input.DiskContainer
+	switch {
+	case disk.UserBucket != nil && disk.Url != nil:
+		return nil, errors.New(awserrors.ErrorInvalidParameterCombination)
+	case disk.UserBucket != nil:
+		src, err = s.bucketImportSource(aws.StringValue(disk.UserBucket.S3Bucket), aws.StringValue(disk.UserBucket.S3Key))
+	case disk.Url != nil:
+		src, err = s.parseImportSource(*disk.Url)
+	default:
+		return nil, errors.New(awserrors.ErrorMissingParameter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	description := aws.StringValue(input.Description)
+	if description == "" {
+		description = aws.StringValue(disk.Description)
+	}
+	taskID := utils.GenerateResourceID(importSnapshotTaskPrefix)
+	task := &conversionTask{
+		TaskID:           taskID,
+		OwnerID:          accountID,
+		State:            conversionTaskActive,
+		Description:      description,
+		Source:           src.String(),
+		Format:           format,
+		AvailabilityZone: s.config.AZ,
+		VolumeID:         taskID,
+		SnapshotID:       utils.GenerateResourceID("snap"),
+		Tags:             utils.ExtractTags(input.TagSpecifications, "import-snapshot-task"),
+		StartTime:        utils.Now(),
+	}
+	if err := s.startImport(task, src); err != nil {
+		return nil, err
+	}
+	out := task.toImportSnapshotTask()
+	return &ec2.ImportSnapshotOutput{
+		Description:        out.Description,
+		ImportTaskId:       out.ImportTaskId,
+		SnapshotTaskDetail: out.SnapshotTaskDetail,
+		Tags:               out.Tags,
+	}, nil
+}
+
+// startImport records task and imports its image in the background.
+func (s *VolumeServiceImpl) startImport(task *conversionTask, src importSource) error {
+	if err := s.putConversionTask(task); err != nil {
+		slog.Error("Failed to save conversion task", "taskId", task.TaskID, "err", err)
+		return errors.New(awserrors.ErrorServerInternal)
+	}
+	slog.Info("Import started", "taskId", task.TaskID, "source", task.Source, "format", task.Format, "volumeId", task.VolumeID)
+	running := *task
+	go s.runImport(&running, src)
+	return nil
+}
+
+// runImport imports task's image and records how it ended.
+func (s *VolumeServiceImpl) runImport(task *conversionTask, src importSource) {
+	if err := s.importImage(task, src); err != nil {
+		slog.Error("Import failed", "taskId", task.TaskID, "source", task.Source, "err", err)
+		task.State = conversionTaskFailed
+		task.StatusMessage = err.Error()
+		if err := s.deleteS3Prefix(task.VolumeID + "/"); err != nil {
+			slog.Warn("Failed to remove partly imported volume", "taskId", task.TaskID, "volumeId", task.VolumeID, "err", err)
+		}
+	} else {
+		slog.Info("Import completed", "taskId", task.TaskID, "volumeId", task.VolumeID, "snapshotId", task.SnapshotID)
+		task.State = conversionTaskCompleted
+		task.StatusMessage = ""
+	}
+	if err := s.putConversionTask(task); err != nil {
+		slog.Error("Failed to save conversion task", "taskId", task.TaskID, "state", task.State, "err", err)
+	}
+}
+
+// importImage streams task's image into its volume, converting it to raw
+// first unless it already is, and snapshots the volume for ImportSnapshot.
+func (s *VolumeServiceImpl) importImage(task *conversionTask, src importSource) error {
+	workDir, err := os.MkdirTemp(s.config.WalDir, task.TaskID+"-")
+	if err != nil {
+		return fmt.Errorf("create work dir: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+
+	image, size, err := s.openImportSource(src)
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+	task.ImageBytes = size
+
+	raw, rawSize := image, size
+	if task.Format != "raw" {
+		task.StatusMessage = "converting"
+		if err := s.putConversionTask(task); err != nil {
+			slog.Warn("Failed to save conversion task", "taskId", task.TaskID, "err", err)
+		}
+		rawFile, err := convertImage(image, src, task.Format, workDir)
+		if err != nil {
+			return err
+		}
+		defer rawFile.Close()
+		info, err := rawFile.Stat()
+		if err != nil {
+			return fmt.Errorf("stat converted image: %w", err)
+		}
+		raw, rawSize = rawFile, info.Size()
+	}
+
+	needGiB := max((rawSize+gibBytes-1)/gibBytes, 1)
+	if task.VolumeSizeGiB == 0 {
+		task.VolumeSizeGiB = needGiB
+	}
+	if needGiB > task.VolumeSizeGiB || needGiB > maxVolumeSizeGiB {
+		return fmt.Errorf("image needs %d GiB, more than the %d GiB volume", needGiB, task.VolumeSizeGiB)
+	}
+	task.RawBytes = rawSize
+	task.StatusMessage = "writing"
+	if err := s.putConversionTask(task); err != nil {
+		slog.Warn("Failed to save conversion task", "taskId", task.TaskID, "err", err)
+	}
+
+	sizeGiB := utils.SafeInt64ToUint64(task.VolumeSizeGiB)
+	volumeSizeBytes := sizeGiB * gibBytes
+	vbconfig := viperblock.VB{
+		VolumeName: task.VolumeID,
+		VolumeSize: volumeSizeBytes,
+		BaseDir:    s.config.WalDir,
+		Cache:      viperblock.Cache{Config: viperblock.CacheConfig{Size: 0}},
+		VolumeConfig: viperblock.VolumeConfig{
+			VolumeMetadata: viperblock.VolumeMetadata{
+				VolumeID:         task.VolumeID,
+				TenantID:         task.OwnerID,
+				SizeGiB:          sizeGiB,
+				State:            "available",
+				CreatedAt:        utils.Now(),
+				AvailabilityZone: task.AvailabilityZone,
+				VolumeType:       config.DefaultVolumeType,
+				IOPS:             defaultGP3IOPS,
+			},
+		},
+	}
+	cfg := s3backend.S3Config{
+		VolumeName: task.VolumeID,
+		VolumeSize: volumeSizeBytes,
+		Bucket:     s.bucketName,
+		Region:     s.config.Predastore.Region,
+		AccessKey:  s.config.Predastore.AccessKey,
+		SecretKey:  s.config.Predastore.SecretKey,
+		Host:       s.config.Predastore.Host,
+	}
+
+	lastProgress := int64(0)
+	progress := func(written int64) {
+		task.BytesConverted = written
+		if p := task.progress(); p != lastProgress {
+			lastProgress = p
+			if err := s.putConversionTask(task); err != nil {
+				slog.Warn("Failed to save import progress", "taskId", task.TaskID, "err", err)
+			}
+		}
+	}
+	if err := writeImportedImage(&vbconfig, cfg, raw, task.SnapshotID, progress); err != nil {
+		return err
+	}
+
+	if !task.isSnapshotImport() {
+		return nil
+	}
+	snapshotCfg := &handlers_ec2_snapshot.SnapshotConfig{
+		SnapshotID:       task.SnapshotID,
+		VolumeID:         task.VolumeID,
+		VolumeSize:       task.VolumeSizeGiB,
+		State:            "completed",
+		Progress:         "100%",
+		StartTime:        task.StartTime,
+		Description:      task.Description,
+		OwnerID:          task.OwnerID,
+		AvailabilityZone: task.AvailabilityZone,
+	}
+	if err := handlers_ec2_snapshot.WriteSnapshotConfig(s.store, s.bucketName, task.SnapshotID, snapshotCfg); err != nil {
+		return fmt.Errorf("write snapshot metadata: %w", err)
+	}
+	return nil
+}
+
+// openImportSource opens an image and returns its size in bytes.
+func (s *VolumeServiceImpl) openImportSource(src importSource) (io.ReadCloser, int64, error) {
+	if src.path != "" {
+		f, err := os.Open(src.path)
+		if err != nil {
+			return nil, 0, fmt.Errorf("open image: %w", err)
+		}
+		info, err := f.Stat()
+		if err != nil {
+			_ = f.Close()
+			return nil, 0, fmt.Errorf("stat image: %w", err)
+		}
+		return f, info.Size(), nil
+	}
+
+	result, err := s.store.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(src.bucket),
+		Key:    aws.String(src.key),
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("get image: %w", err)
+	}
+	if result.ContentLength == nil {
+		_ = result.Body.Close()
+		return nil, 0, errors.New("get image: object has no length")
+	}
+	return result.Body, *result.ContentLength, nil
+}
+
+// convertImage converts image to a raw file in workDir. qemu-img needs to
+// seek, so an object is downloaded first.
+func convertImage(image io.Reader, src importSource, format, workDir string) (*os.File, error) {
+	path := src.path
+	if path == "" {
+		path = filepath.Join(workDir, "image."+format)
+		f, err := os.Create(path)
+		if err != nil {
+			return nil, fmt.Errorf("create image file: %w", err)
+		}
+		_, err = io.Copy(f, image)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("download image: %w", err)
+		}
+	}
+
+	rawPath := filepath.Join(workDir, "image.raw")
+	if err := convertImageToRaw(path, format, rawPath); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(rawPath)
+	if err != nil {
+		return nil, fmt.Errorf("open converted image: %w", err)
+	}
+	return f, nil
+}
+
+// convertImageToRaw converts the image at src from format to a raw image at
+// dst. A variable so tests can stand in for qemu-img.
+var convertImageToRaw = func(src, format, dst string) error {
+	if out, err := exec.Command("qemu-img", "convert", "-f", format, "-O", "raw", src, dst).CombinedOutput(); err != nil {
+		return fmt.Errorf("qemu-img convert: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// writeImportedImage writes the raw image read from r into the new
+// viperblock volume vbconfig and cfg describe, skipping zero blocks, and
+// snapshots it as snapshotID when that is set. progress is called with the
+// bytes read so far after each flush. A variable so tests can stand in for
+// viperblock.
+var writeImportedImage = func(vbconfig *viperblock.VB, cfg s3backend.S3Config, r io.Reader, snapshotID string, progress func(int64)) error {
+	vb, err := viperblock.New(vbconfig, "s3", cfg)
+	if err != nil {
+		return fmt.Errorf("create viperblock instance: %w", err)
+	}
+	vb.SetDebug(false)
+
+	if err := vb.Backend.Init(); err != nil {
+		return fmt.Errorf("initialize backend: %w", err)
+	}
+	if err := vb.OpenWAL(&vb.WAL, fmt.Sprintf("%s/%s", vb.WAL.BaseDir, vbtypes.GetFilePath(vbtypes.FileTypeWALChunk, vb.WAL.WallNum.Load(), vb.GetVolume()))); err != nil {
+		return fmt.Errorf("open WAL: %w", err)
+	}
+	if err := vb.OpenWAL(&vb.BlockToObjectWAL, fmt.Sprintf("%s/%s", vb.WAL.BaseDir, vbtypes.GetFilePath(vbtypes.FileTypeWALBlock, vb.BlockToObjectWAL.WallNum.Load(), vb.GetVolume()))); err != nil {
+		return fmt.Errorf("open block WAL: %w", err)
+	}
+
+	buf := make([]byte, vb.BlockSize)
+	zero := make([]byte, vb.BlockSize)
+	var offset uint64
+	for {
+		n, readErr := io.ReadFull(r, buf)
+		if n > 0 && !bytes.Equal(buf[:n], zero[:n]) {
+			if err := vb.WriteAt(offset, buf[:n]); err != nil {
+				return fmt.Errorf("write at %d: %w", offset, err)
+			}
+		}
+		offset += uint64(n)
+
+		done := readErr == io.EOF || readErr == io.ErrUnexpectedEOF
+		if readErr != nil && !done {
+			return fmt.Errorf("read image: %w", readErr)
+		}
+		if done || offset%importFlushBytes == 0 {
+			if err := vb.Flush(); err != nil {
+				return fmt.Errorf("flush at %d: %w", offset, err)
+			}
+			if err := vb.WriteWALToChunk(true); err != nil {
+				return fmt.Errorf("write WAL to chunk at %d: %w", offset, err)
+			}
+			progress(utils.SafeUint64ToInt64(offset))
+		}
+		if done {
+			break
+		}
+	}
+
+	if snapshotID != "" {
+		if _, err := vb.CreateSnapshot(snapshotID); err != nil {
+			return fmt.Errorf("create snapshot: %w", err)
+		}
+	}
+	if err := vb.Close(); err != nil {
+		return fmt.Errorf("close volume: %w", err)
+	}
+	if err := vb.RemoveLocalFiles(); err != nil {
+		slog.Warn("Failed to remove local files", "volume", vb.VolumeName, "err", err)
+	}
+	return nil
+}
+
+// DescribeConversionTasks reports the progress of ImportVolume tasks.
+func (s *VolumeServiceImpl) DescribeConversionTasks(input *ec2.DescribeConversionTasksInput, accountID string) (*ec2.DescribeConversionTasksOutput, error) {
+	if input == nil {
+		input = &ec2.DescribeConversionTasksInput{}
+	}
+	tasks, err := s.getConversionTasks(accountID, importVolumeTaskPrefix, input.ConversionTaskIds)
+	if err != nil {
+		return nil, err
+	}
+	out := &ec2.DescribeConversionTasksOutput{ConversionTasks: make([]*ec2.ConversionTask, 0, len(tasks))}
+	for _, task := range tasks {
+		out.ConversionTasks = append(out.ConversionTasks, task.toConversionTask())
+	}
+	return out, nil
+}
+
+// DescribeImportSnapshotTasks reports the progress of ImportSnapshot tasks.
+func (s *VolumeServiceImpl) DescribeImportSnapshotTasks(input *ec2.DescribeImportSnapshotTasksInput, accountID string) (*ec2.DescribeImportSnapshotTasksOutput, error) {
+	if input == nil {
+		input = &ec2.DescribeImportSnapshotTasksInput{}
+	}
+	if len(input.Filters) > 0 {
+		return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	tasks, err := s.getConversionTasks(accountID, importSnapshotTaskPrefix, input.ImportTaskIds)
+	if err != nil {
+		return nil, err
+	}
+	out := &ec2.DescribeImportSnapshotTasksOutput{ImportSnapshotTasks: make([]*ec2.ImportSnapshotTask, 0, len(tasks))}
+	for _, task := range tasks {
+		out.ImportSnapshotTasks = append(out.ImportSnapshotTasks, task.toImportSnapshotTask())
+	}
+	return out, nil
+}
+
+func (t *conversionTask) toConversionTask() *ec2.ConversionTask {
+	state := t.State
+	if state == conversionTaskFailed {
+		state = ec2.ConversionTaskStateCancelled
+	}
+	out := &ec2.ConversionTask{
+		ConversionTaskId: aws.String(t.TaskID),
+		State:            aws.String(state),
+		ImportVolume: &ec2.ImportVolumeTaskDetails{
+			AvailabilityZone: aws.String(t.AvailabilityZone),
+			BytesConverted:   aws.Int64(t.BytesConverted),
+			Description:      aws.String(t.Description),
+			Image: &ec2.DiskImageDescription{
+				Format:            aws.String(strings.ToUpper(t.Format)),
+				ImportManifestUrl: aws.String(t.Source),
+				Size:              aws.Int64(t.ImageBytes),
+			},
+			Volume: &ec2.DiskImageVolumeDescription{
+				Id:   aws.String(t.VolumeID),
+				Size: aws.Int64(t.VolumeSizeGiB),
+			},
+		},
+	}
+	if msg := t.statusMessage(); msg != "" {
+		out.StatusMessage = aws.String(msg)
+	}
+	return out
+}
+
+func (t *conversionTask) toImportSnapshotTask() *ec2.ImportSnapshotTask {
+	state := t.State
+	if state == conversionTaskFailed {
+		state = "deleted"
+	}
+	detail := &ec2.SnapshotTaskDetail{
+		Description:   aws.String(t.Description),
+		DiskImageSize: aws.Float64(float64(t.ImageBytes)),
+		Encrypted:     aws.Bool(false),
+		Format:        aws.String(strings.ToUpper(t.Format)),
+		Progress:      aws.String(fmt.Sprintf("%d", t.progress())),
+		Status:        aws.String(state),
+		Url:           aws.String(t.Source),
+	}
+	if msg := t.statusMessage(); msg != "" {
+		detail.StatusMessage = aws.String(msg)
+	}
+	if t.State == conversionTaskCompleted {
+		detail.SnapshotId = aws.String(t.SnapshotID)
+	}
+	out := &ec2.ImportSnapshotTask{
+		Description:        aws.String(t.Description),
+		ImportTaskId:       aws.String(t.TaskID),
+		SnapshotTaskDetail: detail,
+	}
+	if len(t.Tags) > 0 {
+		out.Tags = utils.MapToEC2Tags(t.Tags)
+	}
+	return out
+}
+
+// statusMessage is the task's status message, with its progress while the
+// image is written.
+func (t *conversionTask) statusMessage() string {
+	if t.State == conversionTaskActive && t.StatusMessage == "writing" {
+		return fmt.Sprintf("writing: %d%%", t.progress())
+	}
+	return t.StatusMessage
+}
@@ -0,0 +1,318 @@
+package handlers_ec2_volume
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	handlers_ec2_snapshot "github.com/mulgadc/spinifex/spinifex/handlers/ec2/snapshot"
+	"github.com/mulgadc/spinifex/spinifex/objectstore"
+	"github.com/mulgadc/viperblock/viperblock"
+	s3backend "github.com/mulgadc/viperblock/viperblock/backends/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// importedImage records what the stand-in for viperblock was given.
+type importedImage struct {
+	volumeName string
+	sizeGiB    uint64
+	snapshotID string
+	data       []byte
+}
+
+// stubImportWriter replaces viperblock for the test, reporting progress every
+// importFlushBytes as the real writer does, or failing with err.
+func stubImportWriter(t *testing.T, err error) chan importedImage {
+	t.Helper()
+	written := make(chan importedImage, 1)
+	orig := writeImportedImage
+	writeImportedImage = func(vbconfig *viperblock.VB, _ s3backend.S3Config, r io.Reader, snapshotID string, progress func(int64)) error {
+		if err != nil {
+			return err
+		}
+		data, readErr := io.ReadAll(r)
+		if readErr != nil {
+			return readErr
+		}
+		for n := int64(importFlushBytes); n < int64(len(data)); n += importFlushBytes {
+			progress(n)
+		}
+		progress(int64(len(data)))
+		written <- importedImage{
+			volumeName: vbconfig.VolumeName,
+			sizeGiB:    vbconfig.VolumeConfig.VolumeMetadata.SizeGiB,
+			snapshotID: snapshotID,
+			data:       data,
+		}
+		return nil
+	}
+	t.Cleanup(func() { writeImportedImage = orig })
+	return written
+}
+
+func newImportVolumeService(t *testing.T) (*VolumeServiceImpl, *objectstore.MemoryObjectStore) {
+	t.Helper()
+	store := objectstore.NewMemoryObjectStore()
+	svc := newTestVolumeServiceWithStore("ap-southeast-2a", store)
+	svc.config.WalDir = t.TempDir()
+	svc.config.ImageImportDir = t.TempDir()
+	return svc, store
+}
+
+func putImage(t *testing.T, store objectstore.ObjectStore, bucket, key string, data []byte) {
+	t.Helper()
+	_, err := store.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   bytes.NewReader(data),
+	})
+	require.NoError(t, err)
+}
+
+// waitForTask polls until taskID leaves the active state.
+func waitForTask(t *testing.T, svc *VolumeServiceImpl, taskID string) *conversionTask {
+	t.Helper()
+	var task *conversionTask
+	require.Eventually(t, func() bool {
+		var err error
+		task, err = svc.getConversionTask("123456789012", taskID)
+		return err == nil && task.State != conversionTaskActive
+	}, 5*time.Second, 10*time.Millisecond)
+	return task
+}
+
+func TestImportVolume_Validation(t *testing.T) {
+	svc, _ := newImportVolumeService(t)
+	outside := filepath.Join(t.TempDir(), "disk.raw")
+	require.NoError(t, os.WriteFile(outside, []byte("x"), 0o600))
+
+	valid := func() *ec2.ImportVolumeInput {
+		return &ec2.ImportVolumeInput{
+			AvailabilityZone: aws.String("ap-southeast-2a"),
+			Image:            &ec2.DiskImageDetail{Format: aws.String("RAW"), ImportManifestUrl: aws.String("s3://images/disk.raw")},
+			Volume:           &ec2.VolumeDetail{Size: aws.Int64(8)},
+		}
+	}
+	tests := []struct {
+		name    string
+		modify  func(*ec2.ImportVolumeInput)
+		wantErr string
+	}{
+		{name: "no volume", modify: func(in *ec2.ImportVolumeInput) { in.Volume = nil }, wantErr: awserrors.ErrorMissingParameter},
+		{name: "other AZ", modify: func(in *ec2.ImportVolumeInput) { in.AvailabilityZone = aws.String("us-east-1a") }, wantErr: awserrors.ErrorInvalidAvailabilityZone},
+		{name: "too large", modify: func(in *ec2.ImportVolumeInput) { in.Volume.Size = aws.Int64(16385) }, wantErr: awserrors.ErrorInvalidParameterValue},
+		{name: "VHD", modify: func(in *ec2.ImportVolumeInput) { in.Image.Format = aws.String("VHD") }, wantErr: awserrors.ErrorInvalidParameterValue},
+		{name: "volume bucket", modify: func(in *ec2.ImportVolumeInput) {
+			in.Image.ImportManifestUrl = aws.String("s3://test-bucket/vol-1/config.json")
+		}, wantErr: awserrors.ErrorInvalidParameterValue},
+		{name: "relative path", modify: func(in *ec2.ImportVolumeInput) { in.Image.ImportManifestUrl = aws.String("disk.raw") }, wantErr: awserrors.ErrorInvalidParameterValue},
+		{name: "outside import dir", modify: func(in *ec2.ImportVolumeInput) { in.Image.ImportManifestUrl = aws.String("file://" + outside) }, wantErr: awserrors.ErrorInvalidParameterValue},
+		{name: "https", modify: func(in *ec2.ImportVolumeInput) {
+			in.Image.ImportManifestUrl = aws.String("https://example.com/disk.raw")
+		}, wantErr: awserrors.ErrorInvalidParameterValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := valid()
+			tt.modify(input)
+			_, err := svc.ImportVolume(input, "123456789012")
+			require.Error(t, err)
+			assert.Equal(t, tt.wantErr, err.Error())
+		})
+	}
+}
+
+func TestImportVolume_FromObject(t *testing.T) {
+	svc, store := newImportVolumeService(t)
+	written := stubImportWriter(t, nil)
+
+	image := bytes.Repeat([]byte{0xab}, 3*importFlushBytes+512)
+	putImage(t, store, "images", "disks/web.raw", image)
+
+	out, err := svc.ImportVolume(&ec2.ImportVolumeInput{
+		AvailabilityZone: aws.String("ap-southeast-2a"),
+		Description:      aws.String("web root"),
+		Image:            &ec2.DiskImageDetail{Format: aws.String("raw"), ImportManifestUrl: aws.String("s3://images/disks/web.raw")},
+		Volume:           &ec2.VolumeDetail{Size: aws.Int64(2)},
+	}, "123456789012")
+	require.NoError(t, err)
+	taskID := aws.StringValue(out.ConversionTask.ConversionTaskId)
+	assert.Regexp(t, `^import-vol-[0-9a-f]{17}$`, taskID)
+	assert.Equal(t, ec2.ConversionTaskStateActive, aws.StringValue(out.ConversionTask.State))
+	volumeID := aws.StringValue(out.ConversionTask.ImportVolume.Volume.Id)
+
+	got := <-written
+	assert.Equal(t, volumeID, got.volumeName)
+	assert.Equal(t, uint64(2), got.sizeGiB)
+	assert.Empty(t, got.snapshotID)
+	assert.Equal(t, image, got.data, "raw images are streamed as they are")
+
+	task := waitForTask(t, svc, taskID)
+	assert.Equal(t, conversionTaskCompleted, task.State)
+
+	desc, err := svc.DescribeConversionTasks(&ec2.DescribeConversionTasksInput{}, "123456789012")
+	require.NoError(t, err)
+	require.Len(t, desc.ConversionTasks, 1)
+	ct := desc.ConversionTasks[0]
+	assert.Equal(t, ec2.ConversionTaskStateCompleted, aws.StringValue(ct.State))
+	assert.Equal(t, int64(len(image)), aws.Int64Value(ct.ImportVolume.BytesConverted))
+	assert.Equal(t, int64(len(image)), aws.Int64Value(ct.ImportVolume.Image.Size))
+	assert.Equal(t, "RAW", aws.StringValue(ct.ImportVolume.Image.Format))
+	assert.Equal(t, "web root", aws.StringValue(ct.ImportVolume.Description))
+
+	desc, err = svc.DescribeConversionTasks(&ec2.DescribeConversionTasksInput{}, "999999999999")
+	require.NoError(t, err)
+	assert.Empty(t, desc.ConversionTasks, "tasks are scoped to their account")
+
+	_, err = svc.DescribeConversionTasks(&ec2.DescribeConversionTasksInput{ConversionTaskIds: []*string{aws.String("import-vol-00000000000000000")}}, "123456789012")
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorInvalidConversionTaskId, err.Error())
+}
+
+func TestImportVolume_Failures(t *testing.T) {
+	t.Run("image larger than the volume", func(t *testing.T) {
+		svc, _ := newImportVolumeService(t)
+		stubImportWriter(t, nil)
+		path := filepath.Join(svc.config.ImportDir(), "big.raw")
+		require.NoError(t, os.WriteFile(path, nil, 0o600))
+		require.NoError(t, os.Truncate(path, 2*gibBytes+1))
+
+		out, err := svc.ImportVolume(&ec2.ImportVolumeInput{
+			AvailabilityZone: aws.String("ap-southeast-2a"),
+			Image:            &ec2.DiskImageDetail{Format: aws.String("RAW"), ImportManifestUrl: aws.String(path)},
+			Volume:           &ec2.VolumeDetail{Size: aws.Int64(2)},
+		}, "123456789012")
+		require.NoError(t, err)
+
+		task := waitForTask(t, svc, aws.StringValue(out.ConversionTask.ConversionTaskId))
+		ct := task.toConversionTask()
+		assert.Equal(t, ec2.ConversionTaskStateCancelled, aws.StringValue(ct.State))
+		assert.Contains(t, aws.StringValue(ct.StatusMessage), "needs 3 GiB")
+	})
+
+	t.Run("write fails", func(t *testing.T) {
+		svc, store := newImportVolumeService(t)
+		stubImportWriter(t, errors.New("backend unavailable"))
+		putImage(t, store, "images", "disk.raw", []byte("boot sector"))
+
+		out, err := svc.ImportVolume(&ec2.ImportVolumeInput{
+			AvailabilityZone: aws.String("ap-southeast-2a"),
+			Image:            &ec2.DiskImageDetail{Format: aws.String("RAW"), ImportManifestUrl: aws.String("s3://images/disk.raw")},
+			Volume:           &ec2.VolumeDetail{Size: aws.Int64(1)},
+		}, "123456789012")
+		require.NoError(t, err)
+
+		task := waitForTask(t, svc, aws.StringValue(out.ConversionTask.ConversionTaskId))
+		assert.Equal(t, conversionTaskFailed, task.State)
+		assert.Equal(t, "backend unavailable", task.StatusMessage)
+	})
+}
+
+func TestImportSnapshot_ConvertsImage(t *testing.T) {
+	svc, store := newImportVolumeService(t)
+	written := stubImportWriter(t, nil)
+
+	raw := bytes.Repeat([]byte{0x5a}, 4096)
+	var converted []string
+	orig := convertImageToRaw
+	convertImageToRaw = func(src, format, dst string) error {
+		converted = append(converted, format)
+		data, err := os.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		if string(data) != "QFI\xfb" {
+			return errors.New("not the source image")
+		}
+		return os.WriteFile(dst, raw, 0o600)
+	}
+	t.Cleanup(func() { convertImageToRaw = orig })
+
+	path := filepath.Join(svc.config.ImportDir(), "disk.qcow2")
+	require.NoError(t, os.WriteFile(path, []byte("QFI\xfb"), 0o600))
+
+	out, err := svc.ImportSnapshot(&ec2.ImportSnapshotInput{
+		Description: aws.String("golden image"),
+		DiskContainer: &ec2.SnapshotDiskContainer{
+			Format: aws.String("QCOW2"),
+			Url:    aws.String("file://" + path),
+		},
+		TagSpecifications: []*ec2.TagSpecification{{
+			ResourceType: aws.String("import-snapshot-task"),
+			Tags:         []*ec2.Tag{{Key: aws.String("team"), Value: aws.String("platform")}},
+		}},
+	}, "123456789012")
+	require.NoError(t, err)
+	taskID := aws.StringValue(out.ImportTaskId)
+	assert.Regexp(t, `^import-snap-`, taskID)
+	assert.Equal(t, "active", aws.StringValue(out.SnapshotTaskDetail.Status))
+	assert.Nil(t, out.SnapshotTaskDetail.SnapshotId, "reported once the import completes")
+
+	got := <-written
+	assert.Equal(t, taskID, got.volumeName, "the snapshot's volume is hidden from DescribeVolumes")
+	assert.Equal(t, uint64(1), got.sizeGiB)
+	assert.Equal(t, raw, got.data)
+	require.NotEmpty(t, got.snapshotID)
+	waitForTask(t, svc, taskID)
+	assert.Equal(t, []string{"qcow2"}, converted)
+
+	desc, err := svc.DescribeImportSnapshotTasks(&ec2.DescribeImportSnapshotTasksInput{ImportTaskIds: []*string{aws.String(taskID)}}, "123456789012")
+	require.NoError(t, err)
+	require.Len(t, desc.ImportSnapshotTasks, 1)
+	detail := desc.ImportSnapshotTasks[0].SnapshotTaskDetail
+	assert.Equal(t, "completed", aws.StringValue(detail.Status))
+	assert.Equal(t, "100", aws.StringValue(detail.Progress))
+	assert.Equal(t, got.snapshotID, aws.StringValue(detail.SnapshotId))
+	assert.Equal(t, "platform", aws.StringValue(desc.ImportSnapshotTasks[0].Tags[0].Value))
+
+	snap, err := handlers_ec2_snapshot.ReadSnapshotConfig(store, "test-bucket", got.snapshotID)
+	require.NoError(t, err)
+	assert.Equal(t, taskID, snap.VolumeID)
+	assert.Equal(t, int64(1), snap.VolumeSize)
+	assert.Equal(t, "golden image", snap.Description)
+	assert.Equal(t, "123456789012", snap.OwnerID)
+
+	// Volumes restored from it find the source volume in its metadata.
+	meta, err := svc.getSnapshotMetadata(got.snapshotID)
+	require.NoError(t, err)
+	assert.Equal(t, taskID, meta.VolumeID)
+
+	conv, err := svc.DescribeConversionTasks(nil, "123456789012")
+	require.NoError(t, err)
+	assert.Empty(t, conv.ConversionTasks, "snapshot imports are not conversion tasks")
+}
+
+func TestImportSnapshot_Validation(t *testing.T) {
+	svc, _ := newImportVolumeService(t)
+
+	_, err := svc.ImportSnapshot(&ec2.ImportSnapshotInput{
+		DiskContainer: &ec2.SnapshotDiskContainer{Format: aws.String("RAW"), Url: aws.String("s3://images/disk.raw")},
+		Encrypted:     aws.Bool(true),
+	}, "123456789012")
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorUnsupportedOperation, err.Error())
+
+	_, err = svc.ImportSnapshot(&ec2.ImportSnapshotInput{
+		DiskContainer: &ec2.SnapshotDiskContainer{Format: aws.String("RAW")},
+	}, "123456789012")
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorMissingParameter, err.Error())
+
+	_, err = svc.ImportSnapshot(&ec2.ImportSnapshotInput{
+		DiskContainer: &ec2.SnapshotDiskContainer{
+			Format:     aws.String("VMDK"),
+			UserBucket: &ec2.UserBucket{S3Bucket: aws.String("test-bucket"), S3Key: aws.String("keys/123456789012/key")},
+		},
+	}, "123456789012")
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorInvalidParameterValue, err.Error(), "the volume bucket is refused")
+}
@@ -0,0 +1,212 @@
+package handlers_ec2_volume
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/objectstore"
+	"github.com/mulgadc/viperblock/viperblock"
+)
+
+// performanceLimits bounds the IOPS, and for gp3 the throughput in MiB/s,
+// a volume type may be provisioned with.
+type performanceLimits struct {
+	minIOPS    int64
+	maxIOPS    int64
+	iopsPerGiB int64
+	// includedIOPS are provisioned whatever the volume's size. Only IOPS
+	// above them, and above minIOPS, are held to iopsPerGiB.
+	includedIOPS  int64
+	minThroughput int64
+	maxThroughput int64
+}
+
+// provisionedPerformance lists the volume types whose IOPS are provisioned
+// rather than fixed by their size, with EBS's limits for each.
+var provisionedPerformance = map[string]performanceLimits{
+	"gp3": {minIOPS: 3000, maxIOPS: 16000, iopsPerGiB: 500, includedIOPS: 3000, minThroughput: 125, maxThroughput: 1000},
+	"io1": {minIOPS: 100, maxIOPS: 64000, iopsPerGiB: 50},
+	"io2": {minIOPS: 100, maxIOPS: 256000, iopsPerGiB: 1000},
+}
+
+// gp3 throughput is limited to a quarter of a MiB/s per provisioned IOPS.
+const gp3IOPSPerMiBps = 4
+
+// ProvisionsIOPS reports whether volumes of volumeType have provisioned
+// IOPS.
+func ProvisionsIOPS(volumeType string) bool {
+	_, ok := provisionedPerformance[volumeType]
+	return ok
+}
+
+// defaultIOPS is the IOPS a volume of sizeGiB gets when none are requested:
+// 3000, or for io1 and io2 as many as their size allows.
+func (l performanceLimits) defaultIOPS(sizeGiB int64) int64 {
+	if l.includedIOPS > 0 {
+		return defaultGP3IOPS
+	}
+	return max(min(defaultGP3IOPS, sizeGiB*l.iopsPerGiB), l.minIOPS)
+}
+
+// QuotaIOPS returns the IOPS a volume of volumeType and sizeGiB counts
+// toward its account's provisioned IOPS quota: iops, or the type's default
+// when zero. gp3's IOPS are included in its price, so only io1 and io2
+// count.
+func QuotaIOPS(volumeType string, sizeGiB, iops int64) int64 {
+	if volumeType != "io1" && volumeType != "io2" {
+		return 0
+	}
+	if iops > 0 {
+		return iops
+	}
+	return provisionedPerformance[volumeType].defaultIOPS(sizeGiB)
+}
+
+// volumePerformance is the IOPS and throughput (MiB/s) provisioned for a
+// volume. Throughput is zero for types other than gp3.
+type volumePerformance struct {
+	IOPS       int64 `json:"Iops"`
+	Throughput int64 `json:"Throughput"`
+}
+
+// resolvePerformance validates the IOPS and throughput a request sets for a
+// volume of volumeType and sizeGiB. Zero leaves a value unset: it is kept
+// from current when the volume keeps its type, and otherwise defaults to
+// 3000 IOPS, or as many as an io1 or io2 volume's size allows, and 125 MiB/s.
+// Types without provisioned performance take neither.
+func (s *VolumeServiceImpl) resolvePerformance(volumeType string, sizeGiB, iops, throughput int64, current *volumePerformance) (volumePerformance, error) {
+	limits, ok := provisionedPerformance[volumeType]
+	if !ok {
+		if iops != 0 || throughput != 0 {
+			return volumePerformance{}, errors.New(awserrors.ErrorInvalidParameterCombination)
+		}
+		return volumePerformance{}, nil
+	}
+	if throughput != 0 && limits.maxThroughput == 0 {
+		return volumePerformance{}, errors.New(awserrors.ErrorInvalidParameterCombination)
+	}
+
+	perf := volumePerformance{IOPS: limits.defaultIOPS(sizeGiB), Throughput: limits.minThroughput}
+	if current != nil {
+		// Volumes created before IOPS were validated keep what they have.
+		if iops == 0 && throughput == 0 {
+			return *current, nil
+		}
+		perf = *current
+	}
+	if iops != 0 {
+		perf.IOPS = iops
+	}
+	if throughput != 0 {
+		perf.Throughput = throughput
+	}
+
+	if perf.IOPS < limits.minIOPS || perf.IOPS > limits.maxIOPS {
+		return volumePerformance{}, errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if perf.IOPS > max(limits.includedIOPS, limits.minIOPS) && perf.IOPS > sizeGiB*limits.iopsPerGiB {
+		slog.Warn("Volume IOPS too high for its size", "type", volumeType, "iops", perf.IOPS, "sizeGiB", sizeGiB)
+		return volumePerformance{}, errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if limits.maxThroughput > 0 {
+		if perf.Throughput < limits.minThroughput || perf.Throughput > limits.maxThroughput ||
+			(perf.Throughput > limits.minThroughput && perf.Throughput*gp3IOPSPerMiBps > perf.IOPS) {
+			return volumePerformance{}, errors.New(awserrors.ErrorInvalidParameterValue)
+		}
+	}
+
+	if s.config.MaxVolumeIOPS > 0 && perf.IOPS > int64(s.config.MaxVolumeIOPS) {
+		slog.Warn("Volume IOPS over the configured limit", "type", volumeType, "iops", perf.IOPS, "maxIOPS", s.config.MaxVolumeIOPS)
+		return volumePerformance{}, errors.New(awserrors.ErrorVolumeIOPSLimit)
+	}
+	return perf, nil
+}
+
+// volumePerformanceKey returns the object key of a gp3 volume's performance
+// record. Viperblock's volume metadata has no throughput, so it is kept
+// beside the config.
+func volumePerformanceKey(volumeID string) string {
+	return volumeID + "/performance.json"
+}
+
+// getVolumePerformance returns the IOPS and throughput provisioned for a
+// volume. gp3 volumes without a performance record have the default
+// 125 MiB/s.
+func (s *VolumeServiceImpl) getVolumePerformance(meta *viperblock.VolumeMetadata) (volumePerformance, error) {
+	volumeType := meta.VolumeType
+	if volumeType == "" {
+		volumeType = "gp3"
+	}
+	limits, ok := provisionedPerformance[volumeType]
+	if !ok {
+		return volumePerformance{}, nil
+	}
+	perf := volumePerformance{IOPS: int64(meta.IOPS), Throughput: limits.minThroughput}
+	if perf.IOPS == 0 {
+		perf.IOPS = limits.includedIOPS
+	}
+	if limits.maxThroughput == 0 {
+		return perf, nil
+	}
+
+	getResult, err := s.store.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(volumePerformanceKey(meta.VolumeID)),
+	})
+	if err != nil {
+		if objectstore.IsNoSuchKeyError(err) {
+			return perf, nil
+		}
+		return perf, fmt.Errorf("failed to get performance record: %w", err)
+	}
+	defer getResult.Body.Close()
+
+	body, err := io.ReadAll(getResult.Body)
+	if err != nil {
+		return perf, fmt.Errorf("failed to read performance record: %w", err)
+	}
+	var stored volumePerformance
+	if err := json.Unmarshal(body, &stored); err != nil {
+		return perf, fmt.Errorf("failed to decode performance record: %w", err)
+	}
+	if stored.Throughput > 0 {
+		perf.Throughput = stored.Throughput
+	}
+	return perf, nil
+}
+
+// putVolumePerformance writes a volume's performance record.
+func (s *VolumeServiceImpl) putVolumePerformance(volumeID string, perf volumePerformance) error {
+	data, err := json.Marshal(perf)
+	if err != nil {
+		return fmt.Errorf("failed to marshal performance record: %w", err)
+	}
+	_, err = s.store.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(volumePerformanceKey(volumeID)),
+		Body:   bytes.NewReader(data),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write performance record: %w", err)
+	}
+	return nil
+}
+
+// VolumePerformance returns the IOPS and throughput (MiB/s) provisioned for
+// the volume cfg describes, for the daemon to throttle it by when attached.
+// Both are zero for types without provisioned performance.
+func (s *VolumeServiceImpl) VolumePerformance(cfg *viperblock.VolumeConfig) (iops, throughput int64) {
+	perf, err := s.getVolumePerformance(&cfg.VolumeMetadata)
+	if err != nil {
+		slog.Warn("Failed to read volume performance record, using the default throughput",
+			"volumeId", cfg.VolumeMetadata.VolumeID, "err", err)
+	}
+	return perf.IOPS, perf.Throughput
+}
@@ -0,0 +1,107 @@
+package handlers_ec2_volume
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolvePerformance(t *testing.T) {
+	svc := newTieredVolumeService(t, 0)
+
+	tests := []struct {
+		name       string
+		volumeType string
+		sizeGiB    int64
+		iops       int64
+		throughput int64
+		want       volumePerformance
+		wantErr    string
+	}{
+		{name: "gp3 defaults", volumeType: "gp3", sizeGiB: 1, want: volumePerformance{IOPS: 3000, Throughput: 125}},
+		{name: "gp3 provisioned", volumeType: "gp3", sizeGiB: 100, iops: 16000, throughput: 1000, want: volumePerformance{IOPS: 16000, Throughput: 1000}},
+		{name: "gp3 over 500 IOPS/GiB", volumeType: "gp3", sizeGiB: 8, iops: 4001, wantErr: awserrors.ErrorInvalidParameterValue},
+		{name: "gp3 below minimum", volumeType: "gp3", sizeGiB: 100, iops: 2000, wantErr: awserrors.ErrorInvalidParameterValue},
+		{name: "gp3 throughput over IOPS/4", volumeType: "gp3", sizeGiB: 100, iops: 3000, throughput: 751, wantErr: awserrors.ErrorInvalidParameterValue},
+		{name: "gp3 throughput over maximum", volumeType: "gp3", sizeGiB: 100, iops: 16000, throughput: 1001, wantErr: awserrors.ErrorInvalidParameterValue},
+		{name: "io1 provisioned", volumeType: "io1", sizeGiB: 100, iops: 5000, want: volumePerformance{IOPS: 5000}},
+		{name: "io1 over 50 IOPS/GiB", volumeType: "io1", sizeGiB: 100, iops: 5001, wantErr: awserrors.ErrorInvalidParameterValue},
+		{name: "io1 default fits its size", volumeType: "io1", sizeGiB: 10, want: volumePerformance{IOPS: 500}},
+		{name: "io1 default floor", volumeType: "io1", sizeGiB: 1, want: volumePerformance{IOPS: 100}},
+		{name: "io1 throughput", volumeType: "io1", sizeGiB: 100, iops: 5000, throughput: 500, wantErr: awserrors.ErrorInvalidParameterCombination},
+		{name: "io2 provisioned", volumeType: "io2", sizeGiB: 64, iops: 64000, want: volumePerformance{IOPS: 64000}},
+		{name: "gp2 with IOPS", volumeType: "gp2", sizeGiB: 100, iops: 3000, wantErr: awserrors.ErrorInvalidParameterCombination},
+		{name: "gp2", volumeType: "gp2", sizeGiB: 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			perf, err := svc.resolvePerformance(tt.volumeType, tt.sizeGiB, tt.iops, tt.throughput, nil)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Equal(t, tt.wantErr, err.Error())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, perf)
+		})
+	}
+
+	current := &volumePerformance{IOPS: 6000, Throughput: 500}
+	perf, err := svc.resolvePerformance("gp3", 100, 0, 250, current)
+	require.NoError(t, err)
+	assert.Equal(t, volumePerformance{IOPS: 6000, Throughput: 250}, perf, "unset IOPS are kept")
+
+	svc.config.MaxVolumeIOPS = 10000
+	_, err = svc.resolvePerformance("io2", 100, 20000, 0, nil)
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorVolumeIOPSLimit, err.Error())
+}
+
+func TestCreateVolume_ProvisionedPerformance(t *testing.T) {
+	svc := newTieredVolumeService(t, 0)
+	svc.config.VolumeBackends["gp3"] = config.VolumeBackendLocal
+
+	vol, err := svc.CreateVolume(&ec2.CreateVolumeInput{
+		Size:             aws.Int64(20),
+		AvailabilityZone: aws.String("ap-southeast-2a"),
+		VolumeType:       aws.String("gp3"),
+		Iops:             aws.Int64(6000),
+		Throughput:       aws.Int64(500),
+	}, "123456789012")
+	require.NoError(t, err)
+	assert.Equal(t, int64(6000), aws.Int64Value(vol.Iops))
+	assert.Equal(t, int64(500), aws.Int64Value(vol.Throughput))
+
+	out, err := svc.DescribeVolumes(&ec2.DescribeVolumesInput{VolumeIds: []*string{vol.VolumeId}}, "123456789012")
+	require.NoError(t, err)
+	require.Len(t, out.Volumes, 1)
+	assert.Equal(t, int64(6000), aws.Int64Value(out.Volumes[0].Iops))
+	assert.Equal(t, int64(500), aws.Int64Value(out.Volumes[0].Throughput))
+
+	cfg, err := svc.GetVolumeConfig(*vol.VolumeId)
+	require.NoError(t, err)
+	iops, throughput := svc.VolumePerformance(cfg)
+	assert.Equal(t, int64(6000), iops)
+	assert.Equal(t, int64(500), throughput)
+
+	// Throughput alone changes; the IOPS are kept.
+	mod, err := svc.ModifyVolume(&ec2.ModifyVolumeInput{VolumeId: vol.VolumeId, Throughput: aws.Int64(750)}, "123456789012")
+	require.NoError(t, err)
+	assert.Equal(t, int64(500), aws.Int64Value(mod.VolumeModification.OriginalThroughput))
+	assert.Equal(t, int64(750), aws.Int64Value(mod.VolumeModification.TargetThroughput))
+	assert.Equal(t, int64(6000), aws.Int64Value(mod.VolumeModification.TargetIops))
+
+	_, err = svc.CreateVolume(&ec2.CreateVolumeInput{
+		Size:             aws.Int64(20),
+		AvailabilityZone: aws.String("ap-southeast-2a"),
+		VolumeType:       aws.String("io2"),
+		Iops:             aws.Int64(30000),
+	}, "123456789012")
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorInvalidParameterValue, err.Error(), "io2 allows 1000 IOPS/GiB")
+}
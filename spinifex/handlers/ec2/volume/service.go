@@ -10,4 +10,8 @@ type VolumeService interface {
 	DeleteVolume(input *ec2.DeleteVolumeInput, accountID string) (*ec2.DeleteVolumeOutput, error)
 	DescribeVolumeStatus(input *ec2.DescribeVolumeStatusInput, accountID string) (*ec2.DescribeVolumeStatusOutput, error)
 	DescribeVolumesModifications(input *ec2.DescribeVolumesModificationsInput, accountID string) (*ec2.DescribeVolumesModificationsOutput, error)
+	ImportVolume(input *ec2.ImportVolumeInput, accountID string) (*ec2.ImportVolumeOutput, error)
+	ImportSnapshot(input *ec2.ImportSnapshotInput, accountID string) (*ec2.ImportSnapshotOutput, error)
+	DescribeConversionTasks(input *ec2.DescribeConversionTasksInput, accountID string) (*ec2.DescribeConversionTasksOutput, error)
+	DescribeImportSnapshotTasks(input *ec2.DescribeImportSnapshotTasksInput, accountID string) (*ec2.DescribeImportSnapshotTasksOutput, error)
 }
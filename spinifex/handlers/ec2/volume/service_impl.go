@@ -19,9 +19,14 @@ import (
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
 	"github.com/mulgadc/spinifex/spinifex/config"
 	"github.com/mulgadc/spinifex/spinifex/filterutil"
+	handlers_ec2_snapshot "github.com/mulgadc/spinifex/spinifex/handlers/ec2/snapshot"
+	handlers_ec2_tags "github.com/mulgadc/spinifex/spinifex/handlers/ec2/tags"
+	"github.com/mulgadc/spinifex/spinifex/kms"
 	"github.com/mulgadc/spinifex/spinifex/objectstore"
+	"github.com/mulgadc/spinifex/spinifex/pagination"
 	"github.com/mulgadc/spinifex/spinifex/types"
 	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/mulgadc/spinifex/spinifex/vm"
 	"github.com/mulgadc/viperblock/viperblock"
 	s3backend "github.com/mulgadc/viperblock/viperblock/backends/s3"
 	"github.com/nats-io/nats.go"
@@ -39,25 +44,21 @@ type VolumeServiceImpl struct {
 	bucketName string
 	natsConn   *nats.Conn
 	snapshotKV nats.KeyValue
+	keys       *kms.Store
 }
 
 // NewVolumeServiceImpl creates a new daemon-side volume service.
 // snapshotKV is optional — when non-nil, DeleteVolume uses O(1) KV lookup
-// instead of scanning all snapshots in S3.
-func NewVolumeServiceImpl(cfg *config.Config, natsConn *nats.Conn, snapshotKV nats.KeyValue) *VolumeServiceImpl {
-	store := objectstore.NewS3ObjectStoreFromConfig(
-		cfg.Predastore.Host,
-		cfg.Predastore.Region,
-		cfg.Predastore.AccessKey,
-		cfg.Predastore.SecretKey,
-	)
-
+// instead of scanning all snapshots in S3. keys is the cluster's KMS key
+// store; without one, encrypted volumes can't be created or attached.
+func NewVolumeServiceImpl(cfg *config.Config, natsConn *nats.Conn, store objectstore.ObjectStore, snapshotKV nats.KeyValue, keys *kms.Store) *VolumeServiceImpl {
 	return &VolumeServiceImpl{
 		config:     cfg,
 		store:      store,
 		bucketName: cfg.Predastore.Bucket,
 		natsConn:   natsConn,
 		snapshotKV: snapshotKV,
+		keys:       keys,
 	}
 }
 
@@ -85,11 +86,15 @@ func (s *VolumeServiceImpl) CreateVolume(input *ec2.CreateVolumeInput, accountID
 		return nil, errors.New(awserrors.ErrorInvalidParameterValue)
 	}
 
-	// Validate volume type: only gp3 supported (or empty defaults to gp3)
-	if input.VolumeType != nil && *input.VolumeType != "" && *input.VolumeType != "gp3" {
-		return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+	// Validate volume type; empty defaults to gp3. Whether this node offers
+	// the type is checked below once the size is known.
+	volumeType := config.DefaultVolumeType
+	if input.VolumeType != nil && *input.VolumeType != "" {
+		if !validVolumeTypes[*input.VolumeType] {
+			return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+		}
+		volumeType = *input.VolumeType
 	}
-	volumeType := "gp3"
 
 	// Validate availability zone matches this node's AZ
 	if input.AvailabilityZone == nil || *input.AvailabilityZone == "" {
@@ -99,10 +104,44 @@ func (s *VolumeServiceImpl) CreateVolume(input *ec2.CreateVolumeInput, accountID
 		return nil, errors.New(awserrors.ErrorInvalidAvailabilityZone)
 	}
 
+	tags, err := utils.MergeDefaultTags(input.TagSpecifications, "volume", s.config.Daemon.DefaultTagsFor(accountID))
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate the requested cache mode. Writeback buffers writes in one
+	// host's page cache, which other attachments would not see.
+	cacheMode, err := vm.ParseCacheMode(tags[vm.CacheModeTag])
+	if err != nil {
+		slog.Error("CreateVolume: invalid cache mode", "err", err)
+		return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	if cacheMode == vm.CacheModeWriteback && aws.BoolValue(input.MultiAttachEnabled) {
+		return nil, errors.New(awserrors.ErrorInvalidParameterCombination)
+	}
+
+	if _, err := vm.ParseTrim(tags[vm.TrimTag], false); err != nil {
+		slog.Error("CreateVolume: invalid trim setting", "err", err)
+		return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+
+	copyMode, err := vm.ParseCopyMode(tags[vm.CopyModeTag])
+	if err != nil {
+		slog.Error("CreateVolume: invalid copy mode", "err", err)
+		return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+
+	encrypted := aws.BoolValue(input.Encrypted)
+	kmsKeyID := aws.StringValue(input.KmsKeyId)
+	if kmsKeyID != "" && !encrypted {
+		return nil, errors.New(awserrors.ErrorInvalidParameterDependency)
+	}
+
 	// If creating from snapshot, read snapshot metadata to get defaults
 	var snapshotID string
 	var sourceVolumeName string
 	var snapshotSizeGiB int64
+	var encryption *types.VolumeEncryption
 
 	if input.SnapshotId != nil && *input.SnapshotId != "" {
 		snapshotID = *input.SnapshotId
@@ -113,13 +152,20 @@ func (s *VolumeServiceImpl) CreateVolume(input *ec2.CreateVolumeInput, accountID
 		}
 		sourceVolumeName = snapMeta.VolumeID
 		snapshotSizeGiB = snapMeta.VolumeSize
+		if encryption, err = s.snapshotEncryption(snapMeta, encrypted, kmsKeyID); err != nil {
+			return nil, err
+		}
+	} else if encrypted {
+		if encryption, err = s.newVolumeEncryption(kmsKeyID, accountID); err != nil {
+			return nil, err
+		}
 	}
 
 	// Validate size (1-16384 GiB). When creating from snapshot, size can be
 	// omitted (defaults to snapshot size) or must be >= snapshot size.
 	var size int64
 	if input.Size != nil {
-		if *input.Size < 1 || *input.Size > 16384 {
+		if *input.Size < 1 || *input.Size > maxVolumeSizeGiB {
 			return nil, errors.New(awserrors.ErrorInvalidParameterValue)
 		}
 		if snapshotSizeGiB > 0 && *input.Size < snapshotSizeGiB {
@@ -133,34 +179,154 @@ func (s *VolumeServiceImpl) CreateVolume(input *ec2.CreateVolumeInput, accountID
 		return nil, errors.New(awserrors.ErrorInvalidParameterValue)
 	}
 
-	now := time.Now()
-	volumeID := utils.GenerateResourceID("vol")
+	sizeGiB := utils.SafeInt64ToUint64(size)
+	backend, err := s.volumeBackendFor(volumeType, sizeGiB)
+	if err != nil {
+		return nil, err
+	}
+	// Snapshots are viperblock block maps; other backends cannot restore them.
+	if snapshotID != "" && backend != config.VolumeBackendViperblock {
+		slog.Error("CreateVolume: snapshot restore requires the viperblock backend", "type", volumeType, "backend", backend)
+		return nil, errors.New(awserrors.ErrorInvalidParameterCombination)
+	}
 
+	perf, err := s.resolvePerformance(volumeType, size, aws.Int64Value(input.Iops), aws.Int64Value(input.Throughput), nil)
+	if err != nil {
+		return nil, err
+	}
+	// Types without provisioned IOPS keep reporting gp3's baseline.
 	iops := defaultGP3IOPS
+	if perf.IOPS > 0 {
+		iops = int(perf.IOPS)
+	}
+
+	now := utils.Now()
+	volumeID := utils.GenerateResourceID("vol")
 
-	slog.Info("CreateVolume", "volumeId", volumeID, "size", size, "type", volumeType,
+	slog.Info("CreateVolume", "volumeId", volumeID, "size", size, "type", volumeType, "backend", backend,
 		"az", *input.AvailabilityZone, "snapshotId", snapshotID)
 
 	// Volume size in bytes for viperblock
-	sizeGiB := utils.SafeInt64ToUint64(size)
 	volumeSizeBytes := sizeGiB * 1024 * 1024 * 1024
 
+	// A full copy is creating until every block of the snapshot is written.
+	fullCopy := snapshotID != "" && copyMode == vm.CopyModeFull
+	state := "available"
+	if fullCopy {
+		state = "creating"
+	}
+
 	// Build VolumeConfig with metadata
 	volumeConfig := viperblock.VolumeConfig{
 		VolumeMetadata: viperblock.VolumeMetadata{
 			VolumeID:         volumeID,
 			TenantID:         accountID,
 			SizeGiB:          sizeGiB,
-			State:            "available",
+			State:            state,
 			CreatedAt:        now,
 			AvailabilityZone: *input.AvailabilityZone,
 			VolumeType:       volumeType,
 			IOPS:             iops,
-			IsEncrypted:      false,
+			IsEncrypted:      encryption != nil,
 			SnapshotID:       snapshotID,
+			Tags:             tags,
 		},
 	}
 
+	// The wrapped data key is written first, so a volume never exists
+	// encrypted without the key to open it.
+	if encryption != nil {
+		if err := s.putVolumeEncryption(volumeID, encryption); err != nil {
+			slog.Error("CreateVolume failed to save encryption record", "volumeId", volumeID, "err", err)
+			return nil, errors.New(awserrors.ErrorServerInternal)
+		}
+	}
+
+	if perf.Throughput > 0 {
+		if err := s.putVolumePerformance(volumeID, perf); err != nil {
+			slog.Error("CreateVolume failed to save performance record", "volumeId", volumeID, "err", err)
+			return nil, errors.New(awserrors.ErrorServerInternal)
+		}
+	}
+
+	if backend == config.VolumeBackendLocal {
+		if err := s.createLocalVolumeWithConfig(volumeID, &volumeConfig); err != nil {
+			return nil, err
+		}
+	} else if fullCopy {
+		if err := s.putVolumeConfig(volumeID, &volumeConfig); err != nil {
+			slog.Error("CreateVolume failed to save volume config", "volumeId", volumeID, "err", err)
+			return nil, errors.New(awserrors.ErrorServerInternal)
+		}
+		go s.copySnapshotToVolume(volumeID, volumeSizeBytes, snapshotID, volumeConfig)
+	} else if err := s.createViperblockVolume(volumeID, volumeSizeBytes, snapshotID, sourceVolumeName, volumeConfig); err != nil {
+		return nil, err
+	}
+
+	if len(tags) > 0 {
+		if err := handlers_ec2_tags.PutResourceTags(s.store, s.bucketName, accountID, volumeID, tags); err != nil {
+			slog.Error("CreateVolume failed to record tags in the tag store", "volumeId", volumeID, "err", err)
+		}
+	}
+
+	slog.Info("CreateVolume completed", "volumeId", volumeID, "size", size, "type", volumeType)
+
+	vol := &ec2.Volume{
+		VolumeId:         aws.String(volumeID),
+		Size:             aws.Int64(size),
+		VolumeType:       aws.String(volumeType),
+		State:            aws.String(state),
+		AvailabilityZone: input.AvailabilityZone,
+		CreateTime:       aws.Time(now),
+		Iops:             aws.Int64(int64(iops)),
+		Encrypted:        aws.Bool(encryption != nil),
+	}
+	if perf.Throughput > 0 {
+		vol.Throughput = aws.Int64(perf.Throughput)
+	}
+	if encryption != nil {
+		vol.KmsKeyId = aws.String(encryption.KmsKeyID)
+	}
+	if len(tags) > 0 {
+		vol.Tags = utils.MapToEC2Tags(tags)
+	}
+
+	if snapshotID != "" {
+		vol.SnapshotId = aws.String(snapshotID)
+	}
+
+	return vol, nil
+}
+
+// createLocalVolumeWithConfig allocates a local volume file and records its
+// node and metadata in S3 alongside viperblock volumes so Describe* sees both.
+func (s *VolumeServiceImpl) createLocalVolumeWithConfig(volumeID string, volumeConfig *viperblock.VolumeConfig) error {
+	if err := s.createLocalVolume(volumeID, volumeConfig.VolumeMetadata.SizeGiB); err != nil {
+		slog.Error("CreateVolume failed to create local volume", "volumeId", volumeID, "err", err)
+		return errors.New(awserrors.ErrorServerInternal)
+	}
+	// The node is recorded before the config, so a local volume is never
+	// visible without saying where its file is.
+	if err := s.putLocalVolumeNode(volumeID); err != nil {
+		slog.Error("CreateVolume failed to save local volume record", "volumeId", volumeID, "err", err)
+		if rmErr := s.deleteLocalVolume(volumeID); rmErr != nil {
+			slog.Error("CreateVolume failed to remove local volume file", "volumeId", volumeID, "err", rmErr)
+		}
+		return errors.New(awserrors.ErrorServerInternal)
+	}
+	if err := s.putVolumeConfig(volumeID, volumeConfig); err != nil {
+		slog.Error("CreateVolume failed to save local volume config", "volumeId", volumeID, "err", err)
+		if rmErr := s.deleteLocalVolume(volumeID); rmErr != nil {
+			slog.Error("CreateVolume failed to remove local volume file", "volumeId", volumeID, "err", rmErr)
+		}
+		return errors.New(awserrors.ErrorServerInternal)
+	}
+	return nil
+}
+
+// createViperblockVolume creates a viperblock volume in S3 and writes its
+// config.json.
+func (s *VolumeServiceImpl) createViperblockVolume(volumeID string, volumeSizeBytes uint64, snapshotID, sourceVolumeName string, volumeConfig viperblock.VolumeConfig) error {
 	// Create S3 backend config
 	cfg := s3backend.S3Config{
 		VolumeName: volumeID,
@@ -190,7 +356,7 @@ func (s *VolumeServiceImpl) CreateVolume(input *ec2.CreateVolumeInput, accountID
 	vb, err := viperblock.New(&vbconfig, "s3", cfg)
 	if err != nil {
 		slog.Error("CreateVolume failed to create viperblock instance", "err", err)
-		return nil, errors.New(awserrors.ErrorServerInternal)
+		return errors.New(awserrors.ErrorServerInternal)
 	}
 
 	vb.SetDebug(false)
@@ -198,33 +364,50 @@ func (s *VolumeServiceImpl) CreateVolume(input *ec2.CreateVolumeInput, accountID
 	// Initialize the backend (creates bucket structure in S3)
 	if err := vb.Backend.Init(); err != nil {
 		slog.Error("CreateVolume failed to initialize backend", "err", err)
-		return nil, errors.New(awserrors.ErrorServerInternal)
+		return errors.New(awserrors.ErrorServerInternal)
 	}
 
 	// Persist volume state to S3 (writes config.json)
 	if err := vb.SaveState(); err != nil {
 		slog.Error("CreateVolume failed to save state", "err", err)
-		return nil, errors.New(awserrors.ErrorServerInternal)
+		return errors.New(awserrors.ErrorServerInternal)
 	}
+	return nil
+}
 
-	slog.Info("CreateVolume completed", "volumeId", volumeID, "size", size, "type", volumeType)
-
-	vol := &ec2.Volume{
-		VolumeId:         aws.String(volumeID),
-		Size:             aws.Int64(size),
-		VolumeType:       aws.String(volumeType),
-		State:            aws.String("available"),
-		AvailabilityZone: input.AvailabilityZone,
-		CreateTime:       aws.Time(now),
-		Iops:             aws.Int64(int64(iops)),
-		Encrypted:        aws.Bool(false),
+// copySnapshotToVolume writes every block of snapshotID into a full-copy
+// volume and marks it available, or marks it error if the copy fails. The
+// volume keeps SnapshotID in its metadata, which holds the snapshot in use
+// until the copy is done.
+func (s *VolumeServiceImpl) copySnapshotToVolume(volumeID string, volumeSizeBytes uint64, snapshotID string, volumeConfig viperblock.VolumeConfig) {
+	cfg := s3backend.S3Config{
+		VolumeName: volumeID,
+		VolumeSize: volumeSizeBytes,
+		Bucket:     s.bucketName,
+		Region:     s.config.Predastore.Region,
+		AccessKey:  s.config.Predastore.AccessKey,
+		SecretKey:  s.config.Predastore.SecretKey,
+		Host:       s.config.Predastore.Host,
 	}
 
-	if snapshotID != "" {
-		vol.SnapshotId = aws.String(snapshotID)
+	volumeConfig.VolumeMetadata.State = "available"
+	vbconfig := viperblock.VB{
+		VolumeName:   volumeID,
+		VolumeSize:   volumeSizeBytes,
+		BaseDir:      s.config.WalDir,
+		Cache:        viperblock.Cache{Config: viperblock.CacheConfig{Size: 0}},
+		VolumeConfig: volumeConfig,
 	}
 
-	return vol, nil
+	if err := handlers_ec2_snapshot.CopyBlocks(snapshotID, &vbconfig, cfg); err != nil {
+		slog.Error("CreateVolume failed to copy snapshot", "volumeId", volumeID, "snapshotId", snapshotID, "err", err)
+		volumeConfig.VolumeMetadata.State = "error"
+		if err := s.putVolumeConfig(volumeID, &volumeConfig); err != nil {
+			slog.Error("CreateVolume failed to mark volume error", "volumeId", volumeID, "err", err)
+		}
+		return
+	}
+	slog.Info("CreateVolume copy completed", "volumeId", volumeID, "snapshotId", snapshotID)
 }
 
 // describeVolumesValidFilters defines the set of filter names accepted by DescribeVolumes.
@@ -237,6 +420,7 @@ var describeVolumesValidFilters = map[string]bool{
 	"attachment.status":      true,
 	"attachment.device":      true,
 	"availability-zone":      true,
+	"tag-key":                true,
 }
 
 // DescribeVolumes lists EBS volumes by reading config.json files from S3
@@ -253,6 +437,11 @@ func (s *VolumeServiceImpl) DescribeVolumes(input *ec2.DescribeVolumesInput, acc
 		return nil, errors.New(awserrors.ErrorInvalidParameterValue)
 	}
 
+	page, err := pagination.Parse(input.MaxResults, input.NextToken, pagination.DescribeVolumesLimits)
+	if err != nil {
+		return nil, err
+	}
+
 	var volumes []*ec2.Volume
 
 	// Fast path: if specific volume IDs are requested, fetch them directly
@@ -299,8 +488,11 @@ func (s *VolumeServiceImpl) DescribeVolumes(input *ec2.DescribeVolumesInput, acc
 	}
 
 	for _, volumeID := range volumeIDs {
-		// Early skip: if volume-id filter is set, check the ID before
-		// fetching the full volume config from S3.
+		// Early skip: volumes on earlier pages, and those the volume-id
+		// filter excludes, are skipped before fetching their config from S3.
+		if page.After != "" && volumeID <= page.After {
+			continue
+		}
 		if len(volumeIDFilterValues) > 0 {
 			if !filterutil.MatchesAny(volumeIDFilterValues, volumeID) {
 				continue
@@ -325,11 +517,12 @@ func (s *VolumeServiceImpl) DescribeVolumes(input *ec2.DescribeVolumesInput, acc
 		volumes = append(volumes, result.volume)
 	}
 
-	slog.Info("DescribeVolumes completed", "count", len(volumes))
+	output := &ec2.DescribeVolumesOutput{}
+	output.Volumes, output.NextToken = pagination.Apply(page, volumes, func(vol *ec2.Volume) string { return aws.StringValue(vol.VolumeId) })
 
-	return &ec2.DescribeVolumesOutput{
-		Volumes: volumes,
-	}, nil
+	slog.Info("DescribeVolumes completed", "count", len(output.Volumes))
+
+	return output, nil
 }
 
 // volumeMatchesFilters checks whether an ec2.Volume satisfies all parsed filters.
@@ -391,6 +584,11 @@ func volumeMatchesFilters(vol *ec2.Volume, filters map[string][]string) bool {
 			if vol.AvailabilityZone != nil {
 				field = *vol.AvailabilityZone
 			}
+		case "tag-key":
+			if !filterutil.MatchesTagKey(values, filterutil.EC2TagsToMap(vol.Tags)) {
+				return false
+			}
+			continue
 		default:
 			return false
 		}
@@ -545,8 +743,19 @@ func volumeStatusMatchesFilters(item *ec2.VolumeStatusItem, filters map[string][
 	return true
 }
 
+// VolumeStateError marks an attached volume whose backend reported an I/O
+// error (QEMU BLOCK_IO_ERROR). It stays attached; DescribeVolumeStatus reports
+// it impaired until it is detached.
+const VolumeStateError = "error"
+
+// isAttachedState reports whether a volume in state is attached to an instance.
+func isAttachedState(state string) bool {
+	return state == "in-use" || state == VolumeStateError
+}
+
 // getVolumeStatusByID builds a VolumeStatusItem by reusing getVolumeByID
-// to validate the volume exists, then returning static health status.
+// to validate the volume exists. Volumes in VolumeStateError are impaired
+// with I/O disabled; all others report static healthy status.
 // Returns the status item, the tenant ID for account scoping, and any error.
 func (s *VolumeServiceImpl) getVolumeStatusByID(volumeID string) (*ec2.VolumeStatusItem, string, error) {
 	result, err := s.getVolumeByID(volumeID)
@@ -554,15 +763,20 @@ func (s *VolumeServiceImpl) getVolumeStatusByID(volumeID string) (*ec2.VolumeSta
 		return nil, "", err
 	}
 
+	status, ioEnabled := "ok", "passed"
+	if aws.StringValue(result.volume.State) == VolumeStateError {
+		status, ioEnabled = "impaired", "failed"
+	}
+
 	return &ec2.VolumeStatusItem{
 		VolumeId:         result.volume.VolumeId,
 		AvailabilityZone: result.volume.AvailabilityZone,
 		VolumeStatus: &ec2.VolumeStatusInfo{
-			Status: aws.String("ok"),
+			Status: aws.String(status),
 			Details: []*ec2.VolumeStatusDetails{
 				{
 					Name:   aws.String("io-enabled"),
-					Status: aws.String("passed"),
+					Status: aws.String(ioEnabled),
 				},
 				{
 					Name:   aws.String("io-performance"),
@@ -575,6 +789,20 @@ func (s *VolumeServiceImpl) getVolumeStatusByID(volumeID string) (*ec2.VolumeSta
 	}, result.tenantID, nil
 }
 
+// Volume modification states, as in ec2.VolumeModificationState_Values.
+const (
+	ModificationStateModifying  = "modifying"
+	ModificationStateOptimizing = "optimizing"
+	ModificationStateCompleted  = "completed"
+)
+
+// modificationTimeout is how long a modification may stay in progress
+// before another is allowed.
+const modificationTimeout = 10 * time.Minute
+
+// maxVolumeSizeGiB is the largest EBS volume.
+const maxVolumeSizeGiB = 16384
+
 // volumeModificationTimeFormat is the AWS-CLI compatible RFC3339-ish format
 // used both for response serialisation and for filter equality on time fields.
 // Round-tripping a value through this format and back into a filter must match.
@@ -930,6 +1158,21 @@ func (s *VolumeServiceImpl) getVolumeByID(volumeID string) (*volumeResult, error
 	if volMeta.IOPS > 0 {
 		volume.Iops = aws.Int64(int64(volMeta.IOPS))
 	}
+	if volumeType == "gp3" {
+		perf, err := s.getVolumePerformance(&volMeta)
+		if err != nil {
+			slog.Warn("Volume has no readable performance record", "volumeId", volumeID, "err", err)
+		}
+		volume.Throughput = aws.Int64(perf.Throughput)
+	}
+
+	if volMeta.IsEncrypted {
+		if enc, err := s.getVolumeEncryption(volumeID); err == nil {
+			volume.KmsKeyId = aws.String(enc.KmsKeyID)
+		} else {
+			slog.Warn("Encrypted volume has no readable encryption record", "volumeId", volumeID, "err", err)
+		}
+	}
 
 	if volMeta.SnapshotID != "" {
 		volume.SnapshotId = aws.String(volMeta.SnapshotID)
@@ -937,7 +1180,7 @@ func (s *VolumeServiceImpl) getVolumeByID(volumeID string) (*volumeResult, error
 
 	if volMeta.AttachedInstance != "" {
 		attachState := "attached"
-		if volMeta.State != "in-use" {
+		if !isAttachedState(volMeta.State) {
 			attachState = "detached"
 		}
 		volume.Attachments = []*ec2.VolumeAttachment{
@@ -1066,7 +1309,7 @@ func (s *VolumeServiceImpl) UpdateVolumeState(volumeID, state, attachedInstance,
 	cfg.VolumeMetadata.AttachedInstance = attachedInstance
 	cfg.VolumeMetadata.DeviceName = deviceName
 	if attachedInstance != "" {
-		cfg.VolumeMetadata.AttachedAt = time.Now()
+		cfg.VolumeMetadata.AttachedAt = utils.Now()
 	}
 
 	if err := s.putVolumeConfig(volumeID, cfg); err != nil {
@@ -1077,7 +1320,28 @@ func (s *VolumeServiceImpl) UpdateVolumeState(volumeID, state, attachedInstance,
 	return nil
 }
 
-// ModifyVolume modifies an EBS volume (grow-only, requires stopped instance)
+// SetVolumeTags replaces the tags recorded in the volume's metadata.
+// Volumes owned by another account are reported as not found.
+func (s *VolumeServiceImpl) SetVolumeTags(accountID, volumeID string, tags map[string]string) error {
+	cfg, err := s.GetVolumeConfig(volumeID)
+	if err != nil {
+		return fmt.Errorf("failed to get volume config for tag update: %w", err)
+	}
+	if cfg.VolumeMetadata.TenantID != accountID {
+		return errors.New(awserrors.ErrorInvalidVolumeNotFound)
+	}
+
+	cfg.VolumeMetadata.Tags = tags
+	if err := s.putVolumeConfig(volumeID, cfg); err != nil {
+		return fmt.Errorf("failed to write volume config for tag update: %w", err)
+	}
+	return nil
+}
+
+// ModifyVolume modifies an EBS volume (grow-only). Local volumes in use are
+// grown online; see CompleteVolumeModification. QEMU cannot grow an NBD
+// node, so a viperblock volume in use must be detached or its instance
+// stopped first.
 func (s *VolumeServiceImpl) ModifyVolume(input *ec2.ModifyVolumeInput, accountID string) (*ec2.ModifyVolumeOutput, error) {
 	if input.VolumeId == nil || *input.VolumeId == "" {
 		return nil, errors.New(awserrors.ErrorInvalidVolumeIDMalformed)
@@ -1107,16 +1371,78 @@ func (s *VolumeServiceImpl) ModifyVolume(input *ec2.ModifyVolumeInput, accountID
 	}
 	originalIOPS := int64(volMeta.IOPS)
 
-	// Validate: grow only (new size must be greater than current)
-	if input.Size != nil && *input.Size <= originalSize {
+	// Validate: one modification at a time
+	if modificationInProgress(cfg.Modification) {
+		return nil, errors.New(awserrors.ErrorIncorrectModificationState)
+	}
+
+	// Validate: grow only (new size must be greater than current), within
+	// the EBS maximum and this node's limit
+	if input.Size != nil && (*input.Size <= originalSize || *input.Size > maxVolumeSizeGiB) {
 		return nil, errors.New(awserrors.ErrorInvalidParameterValue)
 	}
+	if input.Size != nil && s.config.MaxVolumeSizeGiB > 0 && utils.SafeInt64ToUint64(*input.Size) > s.config.MaxVolumeSizeGiB {
+		slog.Warn("ModifyVolume: size over the configured limit", "volumeId", volumeID,
+			"size", *input.Size, "maxSizeGiB", s.config.MaxVolumeSizeGiB)
+		return nil, errors.New(awserrors.ErrorVolumeModificationSizeLimitExceeded)
+	}
+
+	// Validate: a type change must not move the volume onto or off the local
+	// backend; data is not migrated between backends. Other type changes
+	// only relabel a viperblock volume.
+	backend := s.config.VolumeBackend(originalType)
+	if input.VolumeType != nil && *input.VolumeType != originalType {
+		targetBackend := s.config.VolumeBackend(*input.VolumeType)
+		if (backend == config.VolumeBackendLocal) != (targetBackend == config.VolumeBackendLocal) {
+			slog.Error("ModifyVolume: type change would move volume between backends", "volumeId", volumeID,
+				"from", backend, "to", targetBackend)
+			return nil, errors.New(awserrors.ErrorInvalidParameterCombination)
+		}
+	}
 
-	// Validate: if volume is attached, instance must not be in-use (must be stopped)
-	if volMeta.AttachedInstance != "" && volMeta.State == "in-use" {
+	inUse := volMeta.AttachedInstance != "" && isAttachedState(volMeta.State)
+	if input.Size != nil && inUse && backend != config.VolumeBackendLocal {
+		slog.Info("ModifyVolume: cannot grow an NBD volume in use", "volumeId", volumeID,
+			"instanceId", volMeta.AttachedInstance)
 		return nil, errors.New(awserrors.ErrorIncorrectState)
 	}
 
+	// Validate the target IOPS and throughput against the target type and
+	// size. A volume that keeps its type keeps its performance unless the
+	// request changes it; one that changes type gets the new type's defaults.
+	targetType := originalType
+	if input.VolumeType != nil {
+		targetType = *input.VolumeType
+	}
+	targetSize := originalSize
+	if input.Size != nil {
+		targetSize = *input.Size
+	}
+	originalPerf, err := s.getVolumePerformance(volMeta)
+	if err != nil {
+		slog.Warn("ModifyVolume: volume has no readable performance record", "volumeId", volumeID, "err", err)
+	}
+	var current *volumePerformance
+	if targetType == originalType {
+		current = &originalPerf
+	}
+	perf, err := s.resolvePerformance(targetType, targetSize, aws.Int64Value(input.Iops), aws.Int64Value(input.Throughput), current)
+	if err != nil {
+		return nil, err
+	}
+
+	// Local volumes are plain files, so grow them here rather than leaving it
+	// to viperblockd's ebs.sync.
+	if input.Size != nil && backend == config.VolumeBackendLocal {
+		if err := s.checkLocalGrowth(utils.SafeInt64ToUint64(*input.Size - originalSize)); err != nil {
+			return nil, err
+		}
+		if err := s.resizeLocalVolume(volumeID, utils.SafeInt64ToUint64(*input.Size)); err != nil {
+			slog.Error("ModifyVolume failed to resize local volume", "volumeId", volumeID, "err", err)
+			return nil, errors.New(awserrors.ErrorServerInternal)
+		}
+	}
+
 	// Apply modifications
 	if input.Size != nil {
 		volMeta.SizeGiB = utils.SafeInt64ToUint64(*input.Size)
@@ -1124,26 +1450,26 @@ func (s *VolumeServiceImpl) ModifyVolume(input *ec2.ModifyVolumeInput, accountID
 	if input.VolumeType != nil {
 		volMeta.VolumeType = *input.VolumeType
 	}
-	if input.Iops != nil {
-		volMeta.IOPS = int(*input.Iops)
+	if perf.IOPS > 0 {
+		volMeta.IOPS = int(perf.IOPS)
 	}
-
-	// Build target values (after modification)
-	targetSize := utils.SafeUint64ToInt64(volMeta.SizeGiB)
-	targetType := volMeta.VolumeType
-	if targetType == "" {
-		targetType = "gp3"
+	if perf.Throughput > 0 && perf.Throughput != originalPerf.Throughput {
+		if err := s.putVolumePerformance(volumeID, perf); err != nil {
+			slog.Error("ModifyVolume failed to write performance record", "volumeId", volumeID, "err", err)
+			return nil, errors.New(awserrors.ErrorServerInternal)
+		}
 	}
 	targetIOPS := int64(volMeta.IOPS)
 
 	// Persist the modification record alongside the volume metadata so
-	// DescribeVolumesModifications can read it back. spinifex applies
-	// modifications synchronously, so the persisted state is always
-	// completed/100/EndTime==StartTime.
-	now := time.Now()
+	// DescribeVolumesModifications can read it back. Growing a volume in use
+	// stays modifying until the instance's node has resized its block device
+	// and the daemon calls CompleteVolumeModification; anything else applies
+	// synchronously and is completed/100/EndTime==StartTime.
+	now := utils.Now()
 	cfg.Modification = &viperblock.VolumeModification{
 		VolumeID:           volumeID,
-		ModificationState:  "completed",
+		ModificationState:  ModificationStateCompleted,
 		Progress:           100,
 		OriginalSize:       originalSize,
 		OriginalIops:       originalIOPS,
@@ -1154,6 +1480,11 @@ func (s *VolumeServiceImpl) ModifyVolume(input *ec2.ModifyVolumeInput, accountID
 		StartTime:          now,
 		EndTime:            now,
 	}
+	if targetSize > originalSize && inUse {
+		cfg.Modification.ModificationState = ModificationStateModifying
+		cfg.Modification.Progress = 0
+		cfg.Modification.EndTime = time.Time{}
+	}
 
 	// Persist updated config
 	if err := s.putVolumeConfig(volumeID, cfg); err != nil {
@@ -1161,7 +1492,14 @@ func (s *VolumeServiceImpl) ModifyVolume(input *ec2.ModifyVolumeInput, accountID
 		return nil, errors.New(awserrors.ErrorServerInternal)
 	}
 
+	// The stored modification has no throughput, so it is only reported here.
 	modification := vbModificationToEC2(cfg.Modification)
+	if originalPerf.Throughput > 0 {
+		modification.OriginalThroughput = aws.Int64(originalPerf.Throughput)
+	}
+	if perf.Throughput > 0 {
+		modification.TargetThroughput = aws.Int64(perf.Throughput)
+	}
 
 	slog.Info("ModifyVolume completed", "volumeId", volumeID,
 		"originalSize", originalSize, "targetSize", targetSize)
@@ -1171,6 +1509,38 @@ func (s *VolumeServiceImpl) ModifyVolume(input *ec2.ModifyVolumeInput, accountID
 	}, nil
 }
 
+// CompleteVolumeModification finishes a volume's modifying modification.
+// statusMessage is recorded when the resize did not fully apply, e.g. the
+// attached instance could not resize its block device online.
+func (s *VolumeServiceImpl) CompleteVolumeModification(volumeID, statusMessage string) error {
+	cfg, err := s.GetVolumeConfig(volumeID)
+	if err != nil {
+		return fmt.Errorf("failed to get volume config for modification update: %w", err)
+	}
+	if cfg.Modification == nil || cfg.Modification.ModificationState != ModificationStateModifying {
+		return nil
+	}
+
+	cfg.Modification.ModificationState = ModificationStateCompleted
+	cfg.Modification.Progress = 100
+	cfg.Modification.StatusMessage = statusMessage
+	cfg.Modification.EndTime = utils.Now()
+	if err := s.putVolumeConfig(volumeID, cfg); err != nil {
+		return fmt.Errorf("failed to write volume config for modification update: %w", err)
+	}
+	return nil
+}
+
+// modificationInProgress reports whether m still holds a volume. A
+// modification left modifying by a daemon that died mid-resize stops
+// counting after modificationTimeout, so the volume can be modified again.
+func modificationInProgress(m *viperblock.VolumeModification) bool {
+	if m == nil || (m.ModificationState != ModificationStateModifying && m.ModificationState != ModificationStateOptimizing) {
+		return false
+	}
+	return utils.Now().Sub(m.StartTime) < modificationTimeout
+}
+
 // DeleteVolume deletes an EBS volume: validates state, notifies viperblockd, and removes S3 data
 func (s *VolumeServiceImpl) DeleteVolume(input *ec2.DeleteVolumeInput, accountID string) (*ec2.DeleteVolumeOutput, error) {
 	if input == nil || input.VolumeId == nil || *input.VolumeId == "" {
@@ -1205,14 +1575,19 @@ func (s *VolumeServiceImpl) DeleteVolume(input *ec2.DeleteVolumeInput, accountID
 		return nil, err
 	}
 
-	// Notify viperblockd to stop nbdkit/WAL syncer (best-effort)
-	if s.natsConn != nil {
+	if s.config.VolumeBackend(cfg.VolumeMetadata.VolumeType) == config.VolumeBackendLocal {
+		if err := s.deleteLocalVolume(volumeID); err != nil {
+			slog.Error("DeleteVolume failed to remove local volume file", "volumeId", volumeID, "err", err)
+			return nil, errors.New(awserrors.ErrorServerInternal)
+		}
+	} else if s.natsConn != nil {
+		// Notify viperblockd to stop nbdkit/WAL syncer (best-effort)
 		deleteReq := types.EBSDeleteRequest{Volume: volumeID}
 		deleteData, err := json.Marshal(deleteReq)
 		if err != nil {
 			slog.Error("DeleteVolume failed to marshal ebs.delete request", "volumeId", volumeID, "err", err)
 		} else {
-			msg, err := s.natsConn.Request("ebs.delete", deleteData, 5*time.Second)
+			msg, err := s.natsConn.Request(utils.Subject("ebs.delete"), deleteData, 5*time.Second)
 			if err != nil {
 				slog.Warn("ebs.delete notification failed (volume may not be mounted)", "volumeId", volumeID, "err", err)
 			} else {
@@ -1289,8 +1664,9 @@ func (s *VolumeServiceImpl) deleteS3Prefix(prefix string) error {
 // snapshotMetadata holds the subset of snapshot metadata needed by CreateVolume.
 // Matches the JSON written by the snapshot service's SnapshotConfig.
 type snapshotMetadata struct {
-	VolumeID   string `json:"volume_id"`
-	VolumeSize int64  `json:"volume_size"`
+	VolumeID   string                  `json:"volume_id"`
+	VolumeSize int64                   `json:"volume_size"`
+	Encryption *types.VolumeEncryption `json:"encryption,omitempty"`
 }
 
 // getSnapshotMetadata reads snapshot metadata.json from S3 for CreateVolume.
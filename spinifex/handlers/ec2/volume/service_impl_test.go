@@ -2,6 +2,8 @@ package handlers_ec2_volume
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"strings"
 	"testing"
@@ -12,9 +14,13 @@ import (
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/mulgadc/spinifex/spinifex/awserrors"
 	"github.com/mulgadc/spinifex/spinifex/config"
+	handlers_ec2_snapshot "github.com/mulgadc/spinifex/spinifex/handlers/ec2/snapshot"
+	handlers_ec2_tags "github.com/mulgadc/spinifex/spinifex/handlers/ec2/tags"
 	"github.com/mulgadc/spinifex/spinifex/objectstore"
 	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/mulgadc/spinifex/spinifex/vm"
 	"github.com/mulgadc/viperblock/viperblock"
+	s3backend "github.com/mulgadc/viperblock/viperblock/backends/s3"
 	"github.com/nats-io/nats-server/v2/server"
 	"github.com/nats-io/nats.go"
 	"github.com/stretchr/testify/assert"
@@ -92,7 +98,7 @@ func TestCreateVolume_Validation(t *testing.T) {
 				AvailabilityZone: aws.String("ap-southeast-2a"),
 				VolumeType:       aws.String("io1"),
 			},
-			wantErr: awserrors.ErrorInvalidParameterValue,
+			wantErr: awserrors.ErrorVolumeTypeNotAvailableInZone,
 		},
 		{
 			name: "UnsupportedVolumeType_GP2",
@@ -102,7 +108,7 @@ func TestCreateVolume_Validation(t *testing.T) {
 				AvailabilityZone: aws.String("ap-southeast-2a"),
 				VolumeType:       aws.String("gp2"),
 			},
-			wantErr: awserrors.ErrorInvalidParameterValue,
+			wantErr: awserrors.ErrorVolumeTypeNotAvailableInZone,
 		},
 		{
 			name: "UnsupportedVolumeType_ST1",
@@ -112,6 +118,16 @@ func TestCreateVolume_Validation(t *testing.T) {
 				AvailabilityZone: aws.String("ap-southeast-2a"),
 				VolumeType:       aws.String("st1"),
 			},
+			wantErr: awserrors.ErrorVolumeTypeNotAvailableInZone,
+		},
+		{
+			name: "UnknownVolumeType",
+			az:   "ap-southeast-2a",
+			input: &ec2.CreateVolumeInput{
+				Size:             aws.Int64(80),
+				AvailabilityZone: aws.String("ap-southeast-2a"),
+				VolumeType:       aws.String("gp9"),
+			},
 			wantErr: awserrors.ErrorInvalidParameterValue,
 		},
 		{
@@ -436,6 +452,99 @@ func TestCreateVolume_FromSnapshot_CorruptMetadata(t *testing.T) {
 	require.Error(t, err)
 }
 
+func putTestSnapshotMetadata(t *testing.T, store objectstore.ObjectStore, snapshotID string, meta snapshotMetadata) {
+	t.Helper()
+	data, err := json.Marshal(meta)
+	require.NoError(t, err)
+	_, err = store.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String("test-bucket"),
+		Key:    aws.String(snapshotID + "/metadata.json"),
+		Body:   strings.NewReader(string(data)),
+	})
+	require.NoError(t, err)
+}
+
+func fullCopyInput(snapshotID string) *ec2.CreateVolumeInput {
+	return &ec2.CreateVolumeInput{
+		AvailabilityZone: aws.String("ap-southeast-2a"),
+		SnapshotId:       aws.String(snapshotID),
+		TagSpecifications: []*ec2.TagSpecification{{
+			ResourceType: aws.String("volume"),
+			Tags:         []*ec2.Tag{{Key: aws.String(vm.CopyModeTag), Value: aws.String(vm.CopyModeFull)}},
+		}},
+	}
+}
+
+func TestCreateVolume_FullCopy(t *testing.T) {
+	store := objectstore.NewMemoryObjectStore()
+	svc := newTestVolumeServiceWithStore("ap-southeast-2a", store)
+	putTestSnapshotMetadata(t, store, "snap-full", snapshotMetadata{VolumeID: "vol-source", VolumeSize: 8})
+
+	type copyCall struct {
+		snapshotID string
+		vb         *viperblock.VB
+	}
+	calls := make(chan copyCall, 1)
+	orig := handlers_ec2_snapshot.CopyBlocks
+	handlers_ec2_snapshot.CopyBlocks = func(snapshotID string, vbconfig *viperblock.VB, _ s3backend.S3Config) error {
+		calls <- copyCall{snapshotID, vbconfig}
+		return nil
+	}
+	t.Cleanup(func() { handlers_ec2_snapshot.CopyBlocks = orig })
+
+	vol, err := svc.CreateVolume(fullCopyInput("snap-full"), "")
+	require.NoError(t, err)
+	assert.Equal(t, "creating", *vol.State)
+	assert.Equal(t, "snap-full", *vol.SnapshotId)
+
+	result, err := svc.getVolumeByID(*vol.VolumeId)
+	require.NoError(t, err)
+	assert.Equal(t, "creating", *result.volume.State)
+
+	select {
+	case call := <-calls:
+		assert.Equal(t, "snap-full", call.snapshotID)
+		// The copy owns its blocks, so it must not open the snapshot.
+		assert.Empty(t, call.vb.SnapshotID)
+		assert.Equal(t, "available", call.vb.VolumeConfig.VolumeMetadata.State)
+		assert.Equal(t, "snap-full", call.vb.VolumeConfig.VolumeMetadata.SnapshotID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("CopyBlocks was not called")
+	}
+}
+
+func TestCreateVolume_FullCopyFailureMarksError(t *testing.T) {
+	store := objectstore.NewMemoryObjectStore()
+	svc := newTestVolumeServiceWithStore("ap-southeast-2a", store)
+	putTestSnapshotMetadata(t, store, "snap-full", snapshotMetadata{VolumeID: "vol-source", VolumeSize: 8})
+
+	orig := handlers_ec2_snapshot.CopyBlocks
+	handlers_ec2_snapshot.CopyBlocks = func(string, *viperblock.VB, s3backend.S3Config) error {
+		return errors.New("read failed")
+	}
+	t.Cleanup(func() { handlers_ec2_snapshot.CopyBlocks = orig })
+
+	vol, err := svc.CreateVolume(fullCopyInput("snap-full"), "")
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		result, err := svc.getVolumeByID(*vol.VolumeId)
+		return err == nil && *result.volume.State == "error"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestCreateVolume_InvalidCopyMode(t *testing.T) {
+	store := objectstore.NewMemoryObjectStore()
+	svc := newTestVolumeServiceWithStore("ap-southeast-2a", store)
+	putTestSnapshotMetadata(t, store, "snap-full", snapshotMetadata{VolumeID: "vol-source", VolumeSize: 8})
+
+	input := fullCopyInput("snap-full")
+	input.TagSpecifications[0].Tags[0].Value = aws.String("deep")
+	_, err := svc.CreateVolume(input, "")
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorInvalidParameterValue, err.Error())
+}
+
 // setupTestVolumeKV creates a NATS JetStream test server and returns a KV bucket.
 func setupTestVolumeKV(t *testing.T) nats.KeyValue {
 	t.Helper()
@@ -754,6 +863,35 @@ func TestDescribeVolumes_SlowPath_MultipleVolumes(t *testing.T) {
 	assert.Len(t, output.Volumes, 3)
 }
 
+func TestDescribeVolumes_Paginated(t *testing.T) {
+	store := objectstore.NewMemoryObjectStore()
+	svc := newTestVolumeServiceWithStore("ap-southeast-2a", store)
+
+	for i := range 7 {
+		id := fmt.Sprintf("vol-%d", i)
+		createVolumeInStoreWithMeta(t, store, id, viperblock.VolumeMetadata{
+			VolumeID: id, SizeGiB: 10, State: "available",
+		})
+	}
+
+	var ids []string
+	input := &ec2.DescribeVolumesInput{MaxResults: aws.Int64(5)}
+	for pages := 1; ; pages++ {
+		require.LessOrEqual(t, pages, 2, "pagination did not terminate")
+		output, err := svc.DescribeVolumes(input, "")
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(output.Volumes), 5)
+		for _, vol := range output.Volumes {
+			ids = append(ids, *vol.VolumeId)
+		}
+		if output.NextToken == nil {
+			break
+		}
+		input.NextToken = output.NextToken
+	}
+	assert.Equal(t, []string{"vol-0", "vol-1", "vol-2", "vol-3", "vol-4", "vol-5", "vol-6"}, ids)
+}
+
 func TestDescribeVolumes_FastPath_SpecificIDs(t *testing.T) {
 	store := objectstore.NewMemoryObjectStore()
 	svc := newTestVolumeServiceWithStore("ap-southeast-2a", store)
@@ -1038,12 +1176,126 @@ func TestModifyVolume_AttachedInUse(t *testing.T) {
 		AttachedInstance: "i-12345",
 	})
 
+	// QEMU cannot grow the NBD node a viperblock volume is attached through.
 	_, err := svc.ModifyVolume(&ec2.ModifyVolumeInput{
 		VolumeId: aws.String("vol-inuse"),
 		Size:     aws.Int64(20),
 	}, "")
 	require.Error(t, err)
 	assert.Equal(t, awserrors.ErrorIncorrectState, err.Error())
+
+	// Other changes still apply.
+	_, err = svc.ModifyVolume(&ec2.ModifyVolumeInput{
+		VolumeId: aws.String("vol-inuse"),
+		Iops:     aws.Int64(4000),
+	}, "")
+	require.NoError(t, err)
+}
+
+func TestModifyVolume_LocalInUse(t *testing.T) {
+	svc := newTieredVolumeService(t, 0)
+
+	vol, err := svc.CreateVolume(&ec2.CreateVolumeInput{
+		Size:             aws.Int64(1),
+		AvailabilityZone: aws.String("ap-southeast-2a"),
+		VolumeType:       aws.String("io2"),
+	}, "")
+	require.NoError(t, err)
+	cfg, err := svc.GetVolumeConfig(*vol.VolumeId)
+	require.NoError(t, err)
+	cfg.VolumeMetadata.State = "in-use"
+	cfg.VolumeMetadata.AttachedInstance = "i-12345"
+	require.NoError(t, svc.putVolumeConfig(*vol.VolumeId, cfg))
+
+	// Growing a volume in use stays modifying until the instance's node has
+	// resized it.
+	output, err := svc.ModifyVolume(&ec2.ModifyVolumeInput{
+		VolumeId: vol.VolumeId,
+		Size:     aws.Int64(2),
+	}, "")
+	require.NoError(t, err)
+	mod := output.VolumeModification
+	assert.Equal(t, ModificationStateModifying, *mod.ModificationState)
+	assert.Equal(t, int64(0), *mod.Progress)
+	assert.Nil(t, mod.EndTime)
+
+	// Only one modification at a time.
+	_, err = svc.ModifyVolume(&ec2.ModifyVolumeInput{
+		VolumeId: vol.VolumeId,
+		Size:     aws.Int64(3),
+	}, "")
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorIncorrectModificationState, err.Error())
+
+	require.NoError(t, svc.CompleteVolumeModification(*vol.VolumeId, ""))
+	described, err := svc.DescribeVolumesModifications(&ec2.DescribeVolumesModificationsInput{
+		VolumeIds: []*string{vol.VolumeId},
+	}, "")
+	require.NoError(t, err)
+	require.Len(t, described.VolumesModifications, 1)
+	mod = described.VolumesModifications[0]
+	assert.Equal(t, ModificationStateCompleted, *mod.ModificationState)
+	assert.Equal(t, int64(100), *mod.Progress)
+	assert.NotNil(t, mod.EndTime)
+
+	_, err = svc.ModifyVolume(&ec2.ModifyVolumeInput{
+		VolumeId: vol.VolumeId,
+		Size:     aws.Int64(3),
+	}, "")
+	require.NoError(t, err)
+}
+
+func TestModifyVolume_StaleModificationExpires(t *testing.T) {
+	store := objectstore.NewMemoryObjectStore()
+	svc := newTestVolumeServiceWithStore("ap-southeast-2a", store)
+
+	createVolumeInStoreWithMeta(t, store, "vol-stale", viperblock.VolumeMetadata{
+		VolumeID: "vol-stale", SizeGiB: 10, State: "available",
+	})
+	cfg, err := svc.GetVolumeConfig("vol-stale")
+	require.NoError(t, err)
+	cfg.Modification = &viperblock.VolumeModification{
+		VolumeID:          "vol-stale",
+		ModificationState: ModificationStateModifying,
+		StartTime:         time.Now().Add(-modificationTimeout - time.Minute),
+	}
+	require.NoError(t, svc.putVolumeConfig("vol-stale", cfg))
+
+	_, err = svc.ModifyVolume(&ec2.ModifyVolumeInput{
+		VolumeId: aws.String("vol-stale"),
+		Size:     aws.Int64(20),
+	}, "")
+	require.NoError(t, err)
+}
+
+func TestModifyVolume_SizeLimits(t *testing.T) {
+	store := objectstore.NewMemoryObjectStore()
+	svc := newTestVolumeServiceWithStore("ap-southeast-2a", store)
+
+	createVolumeInStoreWithMeta(t, store, "vol-limit", viperblock.VolumeMetadata{
+		VolumeID: "vol-limit", SizeGiB: 10, State: "available",
+	})
+
+	_, err := svc.ModifyVolume(&ec2.ModifyVolumeInput{
+		VolumeId: aws.String("vol-limit"),
+		Size:     aws.Int64(maxVolumeSizeGiB + 1),
+	}, "")
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorInvalidParameterValue, err.Error())
+
+	svc.config.MaxVolumeSizeGiB = 100
+	_, err = svc.ModifyVolume(&ec2.ModifyVolumeInput{
+		VolumeId: aws.String("vol-limit"),
+		Size:     aws.Int64(101),
+	}, "")
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorVolumeModificationSizeLimitExceeded, err.Error())
+
+	_, err = svc.ModifyVolume(&ec2.ModifyVolumeInput{
+		VolumeId: aws.String("vol-limit"),
+		Size:     aws.Int64(100),
+	}, "")
+	require.NoError(t, err)
 }
 
 func TestModifyVolume_SuccessfulGrow(t *testing.T) {
@@ -1093,7 +1345,7 @@ func TestModifyVolume_ModifyTypeAndIOPS(t *testing.T) {
 		VolumeId:   aws.String("vol-typemod"),
 		Size:       aws.Int64(20),
 		VolumeType: aws.String("io1"),
-		Iops:       aws.Int64(10000),
+		Iops:       aws.Int64(1000),
 	}, "")
 	require.NoError(t, err)
 
@@ -1101,7 +1353,7 @@ func TestModifyVolume_ModifyTypeAndIOPS(t *testing.T) {
 	assert.Equal(t, "gp3", *mod.OriginalVolumeType)
 	assert.Equal(t, "io1", *mod.TargetVolumeType)
 	assert.Equal(t, int64(3000), *mod.OriginalIops)
-	assert.Equal(t, int64(10000), *mod.TargetIops)
+	assert.Equal(t, int64(1000), *mod.TargetIops)
 }
 
 func TestModifyVolume_AvailableWithAttachment(t *testing.T) {
@@ -1408,6 +1660,37 @@ func TestDescribeVolumeStatus_FastPath_WithVolumes(t *testing.T) {
 	assert.Equal(t, "ok", *output.VolumeStatuses[0].VolumeStatus.Status)
 }
 
+func TestDescribeVolumeStatus_IOErrorImpaired(t *testing.T) {
+	store := objectstore.NewMemoryObjectStore()
+	svc := newTestVolumeServiceWithStore("ap-southeast-2a", store)
+
+	createVolumeInStoreWithMeta(t, store, "vol-ioerr", viperblock.VolumeMetadata{
+		VolumeID:         "vol-ioerr",
+		SizeGiB:          10,
+		State:            VolumeStateError,
+		AttachedInstance: "i-ioerr",
+		AvailabilityZone: "ap-southeast-2a",
+	})
+
+	output, err := svc.DescribeVolumeStatus(&ec2.DescribeVolumeStatusInput{
+		VolumeIds: []*string{aws.String("vol-ioerr")},
+	}, "")
+	require.NoError(t, err)
+	require.Len(t, output.VolumeStatuses, 1)
+	status := output.VolumeStatuses[0].VolumeStatus
+	assert.Equal(t, "impaired", *status.Status)
+	assert.Equal(t, "io-enabled", *status.Details[0].Name)
+	assert.Equal(t, "failed", *status.Details[0].Status)
+
+	// DescribeVolumes reports the error state and keeps the attachment
+	vols, err := svc.DescribeVolumes(&ec2.DescribeVolumesInput{VolumeIds: []*string{aws.String("vol-ioerr")}}, "")
+	require.NoError(t, err)
+	require.Len(t, vols.Volumes, 1)
+	assert.Equal(t, VolumeStateError, *vols.Volumes[0].State)
+	require.Len(t, vols.Volumes[0].Attachments, 1)
+	assert.Equal(t, "attached", *vols.Volumes[0].Attachments[0].State)
+}
+
 func TestDescribeVolumes_SlowPath_SkipsBrokenConfig(t *testing.T) {
 	store := objectstore.NewMemoryObjectStore()
 	svc := newTestVolumeServiceWithStore("ap-southeast-2a", store)
@@ -1801,6 +2084,32 @@ func TestDescribeVolumes_FilterByTag(t *testing.T) {
 	assert.Equal(t, "vol-tagged", *out.Volumes[0].VolumeId)
 }
 
+func TestDescribeVolumes_FilterByTagKey(t *testing.T) {
+	store := objectstore.NewMemoryObjectStore()
+	svc := newTestVolumeServiceWithStore("ap-southeast-2a", store)
+
+	createVolumeInStoreWithMeta(t, store, "vol-owned", viperblock.VolumeMetadata{
+		VolumeID: "vol-owned", SizeGiB: 10, State: "available", TenantID: "acct1",
+		Tags: map[string]string{"Owner": "alice"},
+	})
+	createVolumeInStoreWithMeta(t, store, "vol-env", viperblock.VolumeMetadata{
+		VolumeID: "vol-env", SizeGiB: 10, State: "available", TenantID: "acct1",
+		Tags: map[string]string{"Environment": "prod"},
+	})
+	createVolumeInStoreWithMeta(t, store, "vol-untagged", viperblock.VolumeMetadata{
+		VolumeID: "vol-untagged", SizeGiB: 10, State: "available", TenantID: "acct1",
+	})
+
+	out, err := svc.DescribeVolumes(&ec2.DescribeVolumesInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("tag-key"), Values: []*string{aws.String("Owner")}},
+		},
+	}, "acct1")
+	require.NoError(t, err)
+	require.Len(t, out.Volumes, 1)
+	assert.Equal(t, "vol-owned", *out.Volumes[0].VolumeId)
+}
+
 func TestDescribeVolumes_FilterWithVolumeIds(t *testing.T) {
 	store := objectstore.NewMemoryObjectStore()
 	svc := newTestVolumeServiceWithStore("ap-southeast-2a", store)
@@ -2168,7 +2477,7 @@ func TestDescribeVolumesModifications_FilterMatching(t *testing.T) {
 	}, "111111111111")
 	require.NoError(t, err)
 	_, err = svc.ModifyVolume(&ec2.ModifyVolumeInput{
-		VolumeId: aws.String("vol-fb"), Size: aws.Int64(100), VolumeType: aws.String("io1"), Iops: aws.Int64(8000),
+		VolumeId: aws.String("vol-fb"), Size: aws.Int64(100), VolumeType: aws.String("io1"), Iops: aws.Int64(5000),
 	}, "111111111111")
 	require.NoError(t, err)
 
@@ -2254,3 +2563,91 @@ func TestDescribeVolumesModifications_UnknownFilter(t *testing.T) {
 	require.Error(t, err)
 	assert.Equal(t, awserrors.ErrorInvalidParameterValue, err.Error())
 }
+
+func TestVolumeTags_CreateTagsFilterAndPersist(t *testing.T) {
+	const accountID = "123456789012"
+	svc := newTieredVolumeService(t, 0)
+	store := svc.store.(*objectstore.MemoryObjectStore)
+	tagsSvc := handlers_ec2_tags.NewTagsServiceImplWithStore(svc.config, store)
+	tagsSvc.SetVolumeTagWriter(svc.SetVolumeTags)
+
+	// Tags given at creation are visible to the tag store.
+	vol, err := svc.CreateVolume(&ec2.CreateVolumeInput{
+		Size:             aws.Int64(1),
+		AvailabilityZone: aws.String("ap-southeast-2a"),
+		VolumeType:       aws.String("io2"),
+		Iops:             aws.Int64(1000),
+		TagSpecifications: []*ec2.TagSpecification{{
+			ResourceType: aws.String("volume"),
+			Tags:         []*ec2.Tag{{Key: aws.String("team"), Value: aws.String("storage")}},
+		}},
+	}, accountID)
+	require.NoError(t, err)
+	volumeID := *vol.VolumeId
+	createVolumeInStoreWithVBState(t, store, "vol-untagged", viperblock.VolumeMetadata{
+		VolumeID: "vol-untagged", SizeGiB: 1, State: "available", TenantID: accountID,
+	}, 4096, 1)
+
+	_, err = tagsSvc.CreateTags(&ec2.CreateTagsInput{
+		Resources: []*string{aws.String(volumeID)},
+		Tags:      []*ec2.Tag{{Key: aws.String("backup"), Value: aws.String("daily")}},
+	}, accountID)
+	require.NoError(t, err)
+
+	describeTagged := func(svc *VolumeServiceImpl) []*ec2.Volume {
+		t.Helper()
+		out, err := svc.DescribeVolumes(&ec2.DescribeVolumesInput{
+			Filters: []*ec2.Filter{{Name: aws.String("tag:backup"), Values: []*string{aws.String("daily")}}},
+		}, accountID)
+		require.NoError(t, err)
+		return out.Volumes
+	}
+
+	volumes := describeTagged(svc)
+	require.Len(t, volumes, 1)
+	assert.Equal(t, volumeID, *volumes[0].VolumeId)
+	assert.ElementsMatch(t, []*ec2.Tag{
+		{Key: aws.String("team"), Value: aws.String("storage")},
+		{Key: aws.String("backup"), Value: aws.String("daily")},
+	}, volumes[0].Tags, "CreateTags merges with the tags given at creation")
+
+	// Tags survive attach and detach.
+	require.NoError(t, svc.UpdateVolumeState(volumeID, "in-use", "i-0123456789abcdef0", "/dev/sdf"))
+	require.Len(t, describeTagged(svc), 1)
+	require.NoError(t, svc.UpdateVolumeState(volumeID, "available", "", ""))
+
+	// A fresh service reading the same store sees them.
+	reloaded := NewVolumeServiceImplWithStore(svc.config, store, nil)
+	require.Len(t, describeTagged(reloaded), 1)
+
+	// DeleteTags removes the tag from the volume too.
+	_, err = tagsSvc.DeleteTags(&ec2.DeleteTagsInput{
+		Resources: []*string{aws.String(volumeID)},
+		Tags:      []*ec2.Tag{{Key: aws.String("backup")}},
+	}, accountID)
+	require.NoError(t, err)
+	assert.Empty(t, describeTagged(svc))
+
+	described, err := tagsSvc.DescribeTags(&ec2.DescribeTagsInput{
+		Filters: []*ec2.Filter{{Name: aws.String("resource-id"), Values: []*string{aws.String(volumeID)}}},
+	}, accountID)
+	require.NoError(t, err)
+	require.Len(t, described.Tags, 1)
+	assert.Equal(t, "team", *described.Tags[0].Key)
+}
+
+func TestSetVolumeTags_CrossAccount(t *testing.T) {
+	svc := newTieredVolumeService(t, 0)
+	store := svc.store.(*objectstore.MemoryObjectStore)
+	createVolumeInStoreWithVBState(t, store, "vol-owned", viperblock.VolumeMetadata{
+		VolumeID: "vol-owned", SizeGiB: 1, State: "available", TenantID: "123456789012",
+		Tags: map[string]string{"team": "storage"},
+	}, 4096, 1)
+
+	err := svc.SetVolumeTags("210987654321", "vol-owned", map[string]string{"team": "stolen"})
+	assert.EqualError(t, err, awserrors.ErrorInvalidVolumeNotFound)
+
+	cfg, err := svc.GetVolumeConfig("vol-owned")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "storage"}, cfg.VolumeMetadata.Tags)
+}
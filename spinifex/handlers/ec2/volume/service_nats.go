@@ -41,3 +41,19 @@ func (s *NATSVolumeService) DescribeVolumesModifications(input *ec2.DescribeVolu
 func (s *NATSVolumeService) DeleteVolume(input *ec2.DeleteVolumeInput, accountID string) (*ec2.DeleteVolumeOutput, error) {
 	return utils.NATSRequest[ec2.DeleteVolumeOutput](s.natsConn, "ec2.DeleteVolume", input, 30*time.Second, accountID)
 }
+
+func (s *NATSVolumeService) ImportVolume(input *ec2.ImportVolumeInput, accountID string) (*ec2.ImportVolumeOutput, error) {
+	return utils.NATSRequest[ec2.ImportVolumeOutput](s.natsConn, "ec2.ImportVolume", input, 30*time.Second, accountID)
+}
+
+func (s *NATSVolumeService) ImportSnapshot(input *ec2.ImportSnapshotInput, accountID string) (*ec2.ImportSnapshotOutput, error) {
+	return utils.NATSRequest[ec2.ImportSnapshotOutput](s.natsConn, "ec2.ImportSnapshot", input, 30*time.Second, accountID)
+}
+
+func (s *NATSVolumeService) DescribeConversionTasks(input *ec2.DescribeConversionTasksInput, accountID string) (*ec2.DescribeConversionTasksOutput, error) {
+	return utils.NATSRequest[ec2.DescribeConversionTasksOutput](s.natsConn, "ec2.DescribeConversionTasks", input, 30*time.Second, accountID)
+}
+
+func (s *NATSVolumeService) DescribeImportSnapshotTasks(input *ec2.DescribeImportSnapshotTasksInput, accountID string) (*ec2.DescribeImportSnapshotTasksOutput, error) {
+	return utils.NATSRequest[ec2.DescribeImportSnapshotTasksOutput](s.natsConn, "ec2.DescribeImportSnapshotTasks", input, 30*time.Second, accountID)
+}
@@ -0,0 +1,469 @@
+package handlers_ec2_vpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/config"
+	"github.com/mulgadc/spinifex/spinifex/filterutil"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	KVBucketDhcpOptions        = "spinifex-vpc-dhcp-options"
+	KVBucketDhcpOptionsVersion = 1
+
+	// DefaultDhcpOptionsID is the options set a VPC uses until another is
+	// associated. It is built in rather than stored, so it cannot be deleted.
+	DefaultDhcpOptionsID = "dopt-default"
+
+	// InternalDomain is the zone VPC instances are named in, e.g.
+	// "ip-10-0-0-12.spinifex.internal". vpcd answers for it on every subnet
+	// of the VPC, whichever resolver the guest sends the query to.
+	InternalDomain = "spinifex.internal"
+
+	// AmazonProvidedDNS as the domain-name-servers value stands for the
+	// cluster's guest resolvers.
+	AmazonProvidedDNS = "AmazonProvidedDNS"
+)
+
+// DHCP option keys accepted by CreateDhcpOptions.
+const (
+	DhcpOptionDomainName         = "domain-name"
+	DhcpOptionDomainNameServers  = "domain-name-servers"
+	DhcpOptionNtpServers         = "ntp-servers"
+	DhcpOptionNetbiosNameServers = "netbios-name-servers"
+	DhcpOptionNetbiosNodeType    = "netbios-node-type"
+)
+
+// maxDhcpServers is how many addresses EC2 accepts for a server option.
+const maxDhcpServers = 4
+
+// DhcpOptionsRecord represents a stored DHCP options set. Configurations maps
+// option keys such as "domain-name" to their values.
+type DhcpOptionsRecord struct {
+	DhcpOptionsId  string              `json:"dhcp_options_id"`
+	Configurations map[string][]string `json:"configurations"`
+	Tags           map[string]string   `json:"tags"`
+	CreatedAt      time.Time           `json:"created_at"`
+}
+
+// DHCPOptionsEvent is published on vpc.dhcp-options when a VPC's DHCP options
+// set changes, and carried on vpc.create-subnet, for vpcd to program subnet
+// DHCP. Empty DomainNameServers means AmazonProvidedDNS.
+type DHCPOptionsEvent struct {
+	VpcId             string   `json:"vpc_id"`
+	DomainName        string   `json:"domain_name,omitempty"`
+	DomainNameServers []string `json:"domain_name_servers,omitempty"`
+	NtpServers        []string `json:"ntp_servers,omitempty"`
+}
+
+// DefaultDhcpOptions returns the built-in options set: the internal domain
+// resolved by the provided DNS.
+func DefaultDhcpOptions() DhcpOptionsRecord {
+	return DhcpOptionsRecord{
+		DhcpOptionsId: DefaultDhcpOptionsID,
+		Configurations: map[string][]string{
+			DhcpOptionDomainName:        {InternalDomain},
+			DhcpOptionDomainNameServers: {AmazonProvidedDNS},
+		},
+	}
+}
+
+// PrivateDNSName is the internal DNS name for privateIP, or "" without one.
+func PrivateDNSName(privateIP string) string {
+	if privateIP == "" {
+		return ""
+	}
+	return "ip-" + strings.ReplaceAll(privateIP, ".", "-") + "." + InternalDomain
+}
+
+// Event returns what vpcd needs to serve record to the subnets of vpcID.
+// Options guests have no DHCP equivalent for, such as NetBIOS, are left out.
+func (record DhcpOptionsRecord) Event(vpcID string) DHCPOptionsEvent {
+	evt := DHCPOptionsEvent{
+		VpcId:      vpcID,
+		NtpServers: record.Configurations[DhcpOptionNtpServers],
+	}
+	if names := record.Configurations[DhcpOptionDomainName]; len(names) > 0 {
+		evt.DomainName = names[0]
+	}
+	if servers := record.Configurations[DhcpOptionDomainNameServers]; !slices.Contains(servers, AmazonProvidedDNS) {
+		evt.DomainNameServers = servers
+	}
+	return evt
+}
+
+// LookupDhcpOptions loads an account's DHCP options set from kv. An empty ID
+// or DefaultDhcpOptionsID gives the built-in set.
+func LookupDhcpOptions(kv nats.KeyValue, accountID, dhcpOptionsID string) (*DhcpOptionsRecord, error) {
+	if dhcpOptionsID == "" || dhcpOptionsID == DefaultDhcpOptionsID {
+		record := DefaultDhcpOptions()
+		return &record, nil
+	}
+	entry, err := kv.Get(utils.AccountKey(accountID, dhcpOptionsID))
+	if err != nil {
+		return nil, fmt.Errorf("DHCP options %s not found: %w", dhcpOptionsID, err)
+	}
+	var record DhcpOptionsRecord
+	if err := json.Unmarshal(entry.Value(), &record); err != nil {
+		return nil, fmt.Errorf("unmarshal DHCP options record: %w", err)
+	}
+	return &record, nil
+}
+
+// vpcDhcpOptions returns the options set associated with a VPC, falling back
+// to the built-in set if the stored one can't be read.
+func (s *VPCServiceImpl) vpcDhcpOptions(accountID string, vpc *VPCRecord) *DhcpOptionsRecord {
+	record, err := LookupDhcpOptions(s.dhcpKV, accountID, vpc.DhcpOptionsId)
+	if err != nil {
+		slog.Warn("Failed to load VPC DHCP options, using default", "vpcId", vpc.VpcId, "dhcpOptionsId", vpc.DhcpOptionsId, "err", err)
+		record, _ = LookupDhcpOptions(s.dhcpKV, accountID, "")
+	}
+	return record
+}
+
+// GetVPCDhcpOptions returns the DHCP options vpcd serves to the subnets of
+// an account's VPC.
+func (s *VPCServiceImpl) GetVPCDhcpOptions(accountID, vpcID string) (*DHCPOptionsEvent, error) {
+	entry, err := s.vpcKV.Get(utils.AccountKey(accountID, vpcID))
+	if err != nil {
+		return nil, fmt.Errorf("vpc %s not found: %w", vpcID, err)
+	}
+	var record VPCRecord
+	if err := json.Unmarshal(entry.Value(), &record); err != nil {
+		return nil, fmt.Errorf("unmarshal VPC record: %w", err)
+	}
+	evt := s.vpcDhcpOptions(accountID, &record).Event(vpcID)
+	return &evt, nil
+}
+
+// validateDhcpConfiguration checks the values given for one option key and
+// returns them normalised.
+func validateDhcpConfiguration(key string, values []string) ([]string, error) {
+	if len(values) == 0 {
+		return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+	switch key {
+	case DhcpOptionDomainName:
+		if len(values) != 1 || !config.ValidDomainName(values[0]) {
+			return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+		}
+		return []string{strings.ToLower(strings.TrimSuffix(values[0], "."))}, nil
+	case DhcpOptionDomainNameServers, DhcpOptionNtpServers, DhcpOptionNetbiosNameServers:
+		if key == DhcpOptionDomainNameServers && len(values) == 1 && values[0] == AmazonProvidedDNS {
+			return values, nil
+		}
+		if len(values) > maxDhcpServers {
+			return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+		}
+		for _, v := range values {
+			if ip := net.ParseIP(v); ip == nil || ip.To4() == nil {
+				return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+			}
+		}
+		return values, nil
+	case DhcpOptionNetbiosNodeType:
+		if len(values) != 1 || !slices.Contains([]string{"1", "2", "4", "8"}, values[0]) {
+			return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+		}
+		return values, nil
+	default:
+		return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+}
+
+// CreateDhcpOptions stores a new DHCP options set.
+func (s *VPCServiceImpl) CreateDhcpOptions(input *ec2.CreateDhcpOptionsInput, accountID string) (*ec2.CreateDhcpOptionsOutput, error) {
+	if len(input.DhcpConfigurations) == 0 {
+		return nil, errors.New(awserrors.ErrorMissingParameter)
+	}
+
+	configurations := make(map[string][]string, len(input.DhcpConfigurations))
+	for _, cfg := range input.DhcpConfigurations {
+		if cfg == nil || cfg.Key == nil || *cfg.Key == "" {
+			return nil, errors.New(awserrors.ErrorMissingParameter)
+		}
+		key := *cfg.Key
+		if _, dup := configurations[key]; dup {
+			return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+		}
+		values, err := validateDhcpConfiguration(key, aws.StringValueSlice(cfg.Values))
+		if err != nil {
+			return nil, err
+		}
+		configurations[key] = values
+	}
+
+	record := DhcpOptionsRecord{
+		DhcpOptionsId:  utils.GenerateResourceID("dopt"),
+		Configurations: configurations,
+		Tags:           utils.ExtractTags(input.TagSpecifications, "dhcp-options"),
+		CreatedAt:      time.Now(),
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal DHCP options record: %w", err)
+	}
+	if _, err := s.dhcpKV.Put(utils.AccountKey(accountID, record.DhcpOptionsId), data); err != nil {
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+
+	slog.Info("CreateDhcpOptions completed", "dhcpOptionsId", record.DhcpOptionsId, "accountID", accountID)
+
+	return &ec2.CreateDhcpOptionsOutput{
+		DhcpOptions: dhcpOptionsRecordToEC2(&record, accountID),
+	}, nil
+}
+
+// DeleteDhcpOptions deletes a DHCP options set no VPC is using.
+func (s *VPCServiceImpl) DeleteDhcpOptions(input *ec2.DeleteDhcpOptionsInput, accountID string) (*ec2.DeleteDhcpOptionsOutput, error) {
+	if input.DhcpOptionsId == nil || *input.DhcpOptionsId == "" {
+		return nil, errors.New(awserrors.ErrorMissingParameter)
+	}
+
+	dhcpOptionsID := *input.DhcpOptionsId
+	if dhcpOptionsID == DefaultDhcpOptionsID {
+		return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+
+	key := utils.AccountKey(accountID, dhcpOptionsID)
+	if _, err := s.dhcpKV.Get(key); err != nil {
+		return nil, errors.New(awserrors.ErrorInvalidDhcpOptionsIDNotFound)
+	}
+
+	vpcs, err := s.listVPCRecords(accountID)
+	if err != nil {
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+	for _, vpc := range vpcs {
+		if vpc.DhcpOptionsId == dhcpOptionsID {
+			return nil, errors.New(awserrors.ErrorDependencyViolation)
+		}
+	}
+
+	if err := s.dhcpKV.Delete(key); err != nil {
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+
+	slog.Info("DeleteDhcpOptions completed", "dhcpOptionsId", dhcpOptionsID, "accountID", accountID)
+
+	return &ec2.DeleteDhcpOptionsOutput{}, nil
+}
+
+// describeDhcpOptionsValidFilters defines the set of filter names accepted by DescribeDhcpOptions.
+var describeDhcpOptionsValidFilters = map[string]bool{
+	"dhcp-options-id": true,
+	"key":             true,
+	"value":           true,
+	"owner-id":        true,
+}
+
+// DescribeDhcpOptions lists the built-in options set and the account's own.
+func (s *VPCServiceImpl) DescribeDhcpOptions(input *ec2.DescribeDhcpOptionsInput, accountID string) (*ec2.DescribeDhcpOptionsOutput, error) {
+	ids := make(map[string]bool)
+	for _, id := range input.DhcpOptionsIds {
+		if id != nil {
+			ids[*id] = true
+		}
+	}
+
+	parsedFilters, err := filterutil.ParseFilters(input.Filters, describeDhcpOptionsValidFilters)
+	if err != nil {
+		slog.Warn("DescribeDhcpOptions: invalid filter", "err", err)
+		return nil, errors.New(awserrors.ErrorInvalidParameterValue)
+	}
+
+	records := []DhcpOptionsRecord{DefaultDhcpOptions()}
+
+	prefix := accountID + "."
+	keys, err := s.dhcpKV.Keys()
+	if err != nil && !errors.Is(err, nats.ErrNoKeysFound) {
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+	for _, key := range keys {
+		if key == utils.VersionKey || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		entry, err := s.dhcpKV.Get(key)
+		if err != nil {
+			slog.Warn("Failed to get DHCP options record", "key", key, "error", err)
+			continue
+		}
+		var record DhcpOptionsRecord
+		if err := json.Unmarshal(entry.Value(), &record); err != nil {
+			slog.Warn("Failed to unmarshal DHCP options record", "key", key, "error", err)
+			continue
+		}
+		records = append(records, record)
+	}
+
+	var options []*ec2.DhcpOptions
+	found := make(map[string]bool)
+	for i := range records {
+		record := &records[i]
+		if len(ids) > 0 && !ids[record.DhcpOptionsId] {
+			continue
+		}
+		found[record.DhcpOptionsId] = true
+		if len(parsedFilters) > 0 && !dhcpOptionsMatchesFilters(record, accountID, parsedFilters) {
+			continue
+		}
+		options = append(options, dhcpOptionsRecordToEC2(record, accountID))
+	}
+
+	for id := range ids {
+		if !found[id] {
+			return nil, errors.New(awserrors.ErrorInvalidDhcpOptionsIDNotFound)
+		}
+	}
+
+	slog.Info("DescribeDhcpOptions completed", "count", len(options), "accountID", accountID)
+
+	return &ec2.DescribeDhcpOptionsOutput{
+		DhcpOptions: options,
+	}, nil
+}
+
+// AssociateDhcpOptions points a VPC at a DHCP options set. "default" selects
+// the built-in set. Guests pick the change up when they renew their lease.
+func (s *VPCServiceImpl) AssociateDhcpOptions(input *ec2.AssociateDhcpOptionsInput, accountID string) (*ec2.AssociateDhcpOptionsOutput, error) {
+	if input.VpcId == nil || *input.VpcId == "" {
+		return nil, errors.New(awserrors.ErrorMissingParameter)
+	}
+	if input.DhcpOptionsId == nil || *input.DhcpOptionsId == "" {
+		return nil, errors.New(awserrors.ErrorMissingParameter)
+	}
+
+	dhcpOptionsID := *input.DhcpOptionsId
+	if dhcpOptionsID == "default" || dhcpOptionsID == DefaultDhcpOptionsID {
+		dhcpOptionsID = ""
+	}
+	options, err := LookupDhcpOptions(s.dhcpKV, accountID, dhcpOptionsID)
+	if err != nil {
+		return nil, errors.New(awserrors.ErrorInvalidDhcpOptionsIDNotFound)
+	}
+
+	vpcID := *input.VpcId
+	key := utils.AccountKey(accountID, vpcID)
+	entry, err := s.vpcKV.Get(key)
+	if err != nil {
+		return nil, errors.New(awserrors.ErrorInvalidVpcIDNotFound)
+	}
+	var record VPCRecord
+	if err := json.Unmarshal(entry.Value(), &record); err != nil {
+		slog.Error("AssociateDhcpOptions: corrupted VPC record", "vpcId", vpcID, "accountID", accountID, "err", err)
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+
+	record.DhcpOptionsId = dhcpOptionsID
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal VPC record: %w", err)
+	}
+	if _, err := s.vpcKV.Update(key, data, entry.Revision()); err != nil {
+		slog.Error("AssociateDhcpOptions: KV update failed", "vpcId", vpcID, "accountID", accountID, "err", err)
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+
+	slog.Info("AssociateDhcpOptions completed", "vpcId", vpcID, "dhcpOptionsId", options.DhcpOptionsId, "accountID", accountID)
+
+	// Publish vpc.dhcp-options event for vpcd to reprogram the VPC's subnets
+	utils.PublishEvent(s.natsConn, "vpc.dhcp-options", options.Event(vpcID))
+
+	return &ec2.AssociateDhcpOptionsOutput{}, nil
+}
+
+// listVPCRecords returns every VPC owned by accountID.
+func (s *VPCServiceImpl) listVPCRecords(accountID string) ([]VPCRecord, error) {
+	prefix := accountID + "."
+	keys, err := s.vpcKV.Keys()
+	if err != nil && !errors.Is(err, nats.ErrNoKeysFound) {
+		return nil, err
+	}
+	var records []VPCRecord
+	for _, key := range keys {
+		if key == utils.VersionKey || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		entry, err := s.vpcKV.Get(key)
+		if err != nil {
+			continue
+		}
+		var record VPCRecord
+		if err := json.Unmarshal(entry.Value(), &record); err != nil {
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// dhcpOptionsMatchesFilters checks whether a DhcpOptionsRecord satisfies all parsed filters.
+func dhcpOptionsMatchesFilters(record *DhcpOptionsRecord, accountID string, filters map[string][]string) bool {
+	for name, values := range filters {
+		if strings.HasPrefix(name, "tag:") {
+			continue
+		}
+
+		var fields []string
+		switch name {
+		case "dhcp-options-id":
+			fields = []string{record.DhcpOptionsId}
+		case "owner-id":
+			fields = []string{accountID}
+		case "key":
+			for key := range record.Configurations {
+				fields = append(fields, key)
+			}
+		case "value":
+			for _, vs := range record.Configurations {
+				fields = append(fields, vs...)
+			}
+		default:
+			return false
+		}
+
+		if !slices.ContainsFunc(fields, func(f string) bool { return filterutil.MatchesAny(values, f) }) {
+			return false
+		}
+	}
+
+	return filterutil.MatchesTags(filters, record.Tags)
+}
+
+func dhcpOptionsRecordToEC2(record *DhcpOptionsRecord, accountID string) *ec2.DhcpOptions {
+	keys := make([]string, 0, len(record.Configurations))
+	for key := range record.Configurations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	configurations := make([]*ec2.DhcpConfiguration, 0, len(keys))
+	for _, key := range keys {
+		cfg := &ec2.DhcpConfiguration{Key: aws.String(key)}
+		for _, v := range record.Configurations[key] {
+			cfg.Values = append(cfg.Values, &ec2.AttributeValue{Value: aws.String(v)})
+		}
+		configurations = append(configurations, cfg)
+	}
+
+	return &ec2.DhcpOptions{
+		DhcpOptionsId:      aws.String(record.DhcpOptionsId),
+		DhcpConfigurations: configurations,
+		OwnerId:            aws.String(accountID),
+		Tags:               utils.MapToEC2Tags(record.Tags),
+	}
+}
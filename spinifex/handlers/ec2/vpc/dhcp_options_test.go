@@ -0,0 +1,222 @@
+package handlers_ec2_vpc
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createTestDhcpOptions(t *testing.T, svc *VPCServiceImpl, configs map[string][]string) string {
+	t.Helper()
+	input := &ec2.CreateDhcpOptionsInput{}
+	for key, values := range configs {
+		input.DhcpConfigurations = append(input.DhcpConfigurations, &ec2.NewDhcpConfiguration{
+			Key: aws.String(key), Values: aws.StringSlice(values),
+		})
+	}
+	out, err := svc.CreateDhcpOptions(input, testAccountID)
+	require.NoError(t, err)
+	return *out.DhcpOptions.DhcpOptionsId
+}
+
+func TestCreateDhcpOptions(t *testing.T) {
+	svc := setupTestVPCService(t)
+
+	out, err := svc.CreateDhcpOptions(&ec2.CreateDhcpOptionsInput{
+		DhcpConfigurations: []*ec2.NewDhcpConfiguration{
+			{Key: aws.String("domain-name-servers"), Values: aws.StringSlice([]string{"10.0.0.2", "10.0.0.3"})},
+			{Key: aws.String("domain-name"), Values: aws.StringSlice([]string{"Corp.Example."})},
+		},
+	}, testAccountID)
+	require.NoError(t, err)
+
+	opts := out.DhcpOptions
+	assert.Regexp(t, `^dopt-`, *opts.DhcpOptionsId)
+	assert.Equal(t, testAccountID, *opts.OwnerId)
+	require.Len(t, opts.DhcpConfigurations, 2)
+	assert.Equal(t, "domain-name", *opts.DhcpConfigurations[0].Key)
+	assert.Equal(t, "corp.example", *opts.DhcpConfigurations[0].Values[0].Value)
+	assert.Equal(t, "domain-name-servers", *opts.DhcpConfigurations[1].Key)
+	assert.Len(t, opts.DhcpConfigurations[1].Values, 2)
+}
+
+func TestCreateDhcpOptions_Invalid(t *testing.T) {
+	svc := setupTestVPCService(t)
+
+	tests := []struct {
+		name    string
+		configs []*ec2.NewDhcpConfiguration
+		want    string
+	}{
+		{"empty", nil, awserrors.ErrorMissingParameter},
+		{"unknown key", []*ec2.NewDhcpConfiguration{{Key: aws.String("tftp-server"), Values: aws.StringSlice([]string{"x"})}}, awserrors.ErrorInvalidParameterValue},
+		{"bad domain", []*ec2.NewDhcpConfiguration{{Key: aws.String("domain-name"), Values: aws.StringSlice([]string{"-bad-.example"})}}, awserrors.ErrorInvalidParameterValue},
+		{"bad server", []*ec2.NewDhcpConfiguration{{Key: aws.String("ntp-servers"), Values: aws.StringSlice([]string{"ntp.example"})}}, awserrors.ErrorInvalidParameterValue},
+		{"too many servers", []*ec2.NewDhcpConfiguration{{Key: aws.String("domain-name-servers"), Values: aws.StringSlice([]string{"1.1.1.1", "1.1.1.2", "1.1.1.3", "1.1.1.4", "1.1.1.5"})}}, awserrors.ErrorInvalidParameterValue},
+		{"duplicate key", []*ec2.NewDhcpConfiguration{
+			{Key: aws.String("domain-name"), Values: aws.StringSlice([]string{"a.example"})},
+			{Key: aws.String("domain-name"), Values: aws.StringSlice([]string{"b.example"})},
+		}, awserrors.ErrorInvalidParameterValue},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.CreateDhcpOptions(&ec2.CreateDhcpOptionsInput{DhcpConfigurations: tt.configs}, testAccountID)
+			assert.EqualError(t, err, tt.want)
+		})
+	}
+}
+
+func TestDescribeDhcpOptions(t *testing.T) {
+	svc := setupTestVPCService(t)
+	doptID := createTestDhcpOptions(t, svc, map[string][]string{"ntp-servers": {"10.0.0.5"}})
+
+	out, err := svc.DescribeDhcpOptions(&ec2.DescribeDhcpOptionsInput{}, testAccountID)
+	require.NoError(t, err)
+	require.Len(t, out.DhcpOptions, 2)
+	assert.Equal(t, DefaultDhcpOptionsID, *out.DhcpOptions[0].DhcpOptionsId)
+	assert.Equal(t, doptID, *out.DhcpOptions[1].DhcpOptionsId)
+
+	// Other accounts only see the default set
+	out, err = svc.DescribeDhcpOptions(&ec2.DescribeDhcpOptionsInput{}, "210987654321")
+	require.NoError(t, err)
+	assert.Len(t, out.DhcpOptions, 1)
+
+	out, err = svc.DescribeDhcpOptions(&ec2.DescribeDhcpOptionsInput{
+		Filters: []*ec2.Filter{{Name: aws.String("key"), Values: aws.StringSlice([]string{"ntp-servers"})}},
+	}, testAccountID)
+	require.NoError(t, err)
+	require.Len(t, out.DhcpOptions, 1)
+	assert.Equal(t, doptID, *out.DhcpOptions[0].DhcpOptionsId)
+
+	_, err = svc.DescribeDhcpOptions(&ec2.DescribeDhcpOptionsInput{DhcpOptionsIds: aws.StringSlice([]string{"dopt-missing"})}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorInvalidDhcpOptionsIDNotFound)
+}
+
+func TestAssociateDhcpOptions(t *testing.T) {
+	svc, nc := setupTestVPCServiceWithNC(t)
+	vpcID := createTestVPC(t, svc, "10.0.0.0/16")
+	doptID := createTestDhcpOptions(t, svc, map[string][]string{
+		"domain-name":         {"corp.example"},
+		"domain-name-servers": {"10.0.0.2"},
+	})
+
+	events := make(chan DHCPOptionsEvent, 2)
+	sub, err := nc.Subscribe("vpc.dhcp-options", func(msg *nats.Msg) {
+		var evt DHCPOptionsEvent
+		_ = json.Unmarshal(msg.Data, &evt)
+		events <- evt
+	})
+	require.NoError(t, err)
+	defer func() { _ = sub.Unsubscribe() }()
+
+	_, err = svc.AssociateDhcpOptions(&ec2.AssociateDhcpOptionsInput{VpcId: aws.String(vpcID), DhcpOptionsId: aws.String(doptID)}, testAccountID)
+	require.NoError(t, err)
+
+	select {
+	case evt := <-events:
+		assert.Equal(t, DHCPOptionsEvent{VpcId: vpcID, DomainName: "corp.example", DomainNameServers: []string{"10.0.0.2"}}, evt)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for vpc.dhcp-options event")
+	}
+
+	vpcs, err := svc.DescribeVpcs(&ec2.DescribeVpcsInput{VpcIds: aws.StringSlice([]string{vpcID})}, testAccountID)
+	require.NoError(t, err)
+	assert.Equal(t, doptID, *vpcs.Vpcs[0].DhcpOptionsId)
+
+	// An options set in use can't be deleted
+	_, err = svc.DeleteDhcpOptions(&ec2.DeleteDhcpOptionsInput{DhcpOptionsId: aws.String(doptID)}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorDependencyViolation)
+
+	// Back to the default set, which serves the internal domain
+	_, err = svc.AssociateDhcpOptions(&ec2.AssociateDhcpOptionsInput{VpcId: aws.String(vpcID), DhcpOptionsId: aws.String("default")}, testAccountID)
+	require.NoError(t, err)
+	select {
+	case evt := <-events:
+		assert.Equal(t, DHCPOptionsEvent{VpcId: vpcID, DomainName: InternalDomain}, evt)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for vpc.dhcp-options event")
+	}
+
+	vpcs, err = svc.DescribeVpcs(&ec2.DescribeVpcsInput{VpcIds: aws.StringSlice([]string{vpcID})}, testAccountID)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultDhcpOptionsID, *vpcs.Vpcs[0].DhcpOptionsId)
+
+	_, err = svc.DeleteDhcpOptions(&ec2.DeleteDhcpOptionsInput{DhcpOptionsId: aws.String(doptID)}, testAccountID)
+	require.NoError(t, err)
+	_, err = svc.DeleteDhcpOptions(&ec2.DeleteDhcpOptionsInput{DhcpOptionsId: aws.String(doptID)}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorInvalidDhcpOptionsIDNotFound)
+}
+
+func TestAssociateDhcpOptions_NotFound(t *testing.T) {
+	svc := setupTestVPCService(t)
+	vpcID := createTestVPC(t, svc, "10.0.0.0/16")
+
+	_, err := svc.AssociateDhcpOptions(&ec2.AssociateDhcpOptionsInput{VpcId: aws.String(vpcID), DhcpOptionsId: aws.String("dopt-missing")}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorInvalidDhcpOptionsIDNotFound)
+
+	_, err = svc.AssociateDhcpOptions(&ec2.AssociateDhcpOptionsInput{VpcId: aws.String("vpc-missing"), DhcpOptionsId: aws.String("default")}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorInvalidVpcIDNotFound)
+}
+
+func TestDeleteDhcpOptions_Default(t *testing.T) {
+	svc := setupTestVPCService(t)
+	_, err := svc.DeleteDhcpOptions(&ec2.DeleteDhcpOptionsInput{DhcpOptionsId: aws.String(DefaultDhcpOptionsID)}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorInvalidParameterValue)
+}
+
+func TestCreateSubnet_CarriesDhcpOptions(t *testing.T) {
+	svc, nc := setupTestVPCServiceWithNC(t)
+	vpcID := createTestVPC(t, svc, "10.0.0.0/16")
+	doptID := createTestDhcpOptions(t, svc, map[string][]string{"domain-name": {"corp.example"}, "ntp-servers": {"10.0.0.5"}})
+	_, err := svc.AssociateDhcpOptions(&ec2.AssociateDhcpOptionsInput{VpcId: aws.String(vpcID), DhcpOptionsId: aws.String(doptID)}, testAccountID)
+	require.NoError(t, err)
+
+	eventCh := make(chan DHCPOptionsEvent, 1)
+	sub, err := nc.Subscribe("vpc.create-subnet", func(msg *nats.Msg) {
+		var evt DHCPOptionsEvent
+		_ = json.Unmarshal(msg.Data, &evt)
+		eventCh <- evt
+	})
+	require.NoError(t, err)
+	defer func() { _ = sub.Unsubscribe() }()
+
+	createTestSubnet(t, svc, vpcID, "10.0.1.0/24")
+	select {
+	case evt := <-eventCh:
+		assert.Equal(t, DHCPOptionsEvent{VpcId: vpcID, DomainName: "corp.example", NtpServers: []string{"10.0.0.5"}}, evt)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for vpc.create-subnet event")
+	}
+}
+
+func TestGetVPCDhcpOptions(t *testing.T) {
+	svc := setupTestVPCService(t)
+	vpcID := createTestVPC(t, svc, "10.0.0.0/16")
+
+	opts, err := svc.GetVPCDhcpOptions(testAccountID, vpcID)
+	require.NoError(t, err)
+	assert.Equal(t, &DHCPOptionsEvent{VpcId: vpcID, DomainName: InternalDomain}, opts)
+
+	doptID := createTestDhcpOptions(t, svc, map[string][]string{"domain-name-servers": {"10.0.0.2", "10.0.0.3"}})
+	_, err = svc.AssociateDhcpOptions(&ec2.AssociateDhcpOptionsInput{VpcId: aws.String(vpcID), DhcpOptionsId: aws.String(doptID)}, testAccountID)
+	require.NoError(t, err)
+
+	opts, err = svc.GetVPCDhcpOptions(testAccountID, vpcID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10.0.0.2", "10.0.0.3"}, opts.DomainNameServers)
+
+	_, err = svc.GetVPCDhcpOptions(testAccountID, "vpc-missing")
+	assert.Error(t, err)
+}
+
+func TestPrivateDNSName(t *testing.T) {
+	assert.Equal(t, "ip-10-0-1-4.spinifex.internal", PrivateDNSName("10.0.1.4"))
+	assert.Empty(t, PrivateDNSName(""))
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"strings"
 	"time"
 
@@ -34,11 +35,16 @@ type ENIRecord struct {
 	AttachmentId       string            `json:"attachment_id,omitempty"`
 	InstanceId         string            `json:"instance_id,omitempty"`
 	DeviceIndex        int64             `json:"device_index"`
+	AttachTime         time.Time         `json:"attach_time,omitempty"`
 	PublicIpAddress    string            `json:"public_ip_address,omitempty"` // Auto-assigned or EIP
 	PublicIpPool       string            `json:"public_ip_pool,omitempty"`    // Pool name the public IP came from
 	SecurityGroupIds   []string          `json:"security_group_ids,omitempty"`
 	Tags               map[string]string `json:"tags"`
 	CreatedAt          time.Time         `json:"created_at"`
+
+	// DeleteOnTermination is set on a secondary interface that is deleted,
+	// rather than detached, when its instance terminates.
+	DeleteOnTermination bool `json:"delete_on_termination,omitempty"`
 }
 
 // CreateNetworkInterface creates a new ENI in the specified subnet
@@ -60,6 +66,13 @@ func (s *VPCServiceImpl) CreateNetworkInterface(input *ec2.CreateNetworkInterfac
 		return nil, errors.New(awserrors.ErrorServerInternal)
 	}
 
+	// Pick the ENI ID before allocating an IP so a MAC clash leaves nothing
+	// to release.
+	eniId, macAddr, err := s.newENIIdentity()
+	if err != nil {
+		return nil, err
+	}
+
 	// Allocate IP from subnet
 	var privateIP string
 	if input.PrivateIpAddress != nil && *input.PrivateIpAddress != "" {
@@ -73,11 +86,6 @@ func (s *VPCServiceImpl) CreateNetworkInterface(input *ec2.CreateNetworkInterfac
 		privateIP = ip
 	}
 
-	eniId := utils.GenerateResourceID("eni")
-
-	// Generate a deterministic MAC address
-	macAddr := generateENIMac(eniId)
-
 	description := ""
 	if input.Description != nil {
 		description = *input.Description
@@ -398,7 +406,8 @@ func eniMatchesFilters(record *ENIRecord, filters map[string][]string) bool {
 	return filterutil.MatchesTags(filters, record.Tags)
 }
 
-// AttachENI marks an ENI as attached to an instance (internal use by RunInstances).
+// AttachENI marks an ENI as attached to an instance (used by RunInstances and
+// AttachNetworkInterface).
 // accountID scopes the lookup to the correct KV key.
 func (s *VPCServiceImpl) AttachENI(accountID, eniId, instanceId string, deviceIndex int64) (string, error) {
 	key := utils.AccountKey(accountID, eniId)
@@ -421,6 +430,8 @@ func (s *VPCServiceImpl) AttachENI(accountID, eniId, instanceId string, deviceIn
 	record.AttachmentId = attachmentId
 	record.InstanceId = instanceId
 	record.DeviceIndex = deviceIndex
+	record.AttachTime = time.Now()
+	record.DeleteOnTermination = false
 
 	data, err := json.Marshal(record)
 	if err != nil {
@@ -434,7 +445,8 @@ func (s *VPCServiceImpl) AttachENI(accountID, eniId, instanceId string, deviceIn
 	return attachmentId, nil
 }
 
-// DetachENI marks an ENI as detached from an instance (internal use by TerminateInstances).
+// DetachENI marks an ENI as detached from an instance (used by TerminateInstances
+// and DetachNetworkInterface).
 // accountID scopes the lookup to the correct KV key.
 func (s *VPCServiceImpl) DetachENI(accountID, eniId string) error {
 	key := utils.AccountKey(accountID, eniId)
@@ -452,6 +464,8 @@ func (s *VPCServiceImpl) DetachENI(accountID, eniId string) error {
 	record.AttachmentId = ""
 	record.InstanceId = ""
 	record.DeviceIndex = 0
+	record.AttachTime = time.Time{}
+	record.DeleteOnTermination = false
 
 	data, err := json.Marshal(record)
 	if err != nil {
@@ -465,6 +479,43 @@ func (s *VPCServiceImpl) DetachENI(accountID, eniId string) error {
 	return nil
 }
 
+// SetENIDeleteOnTermination sets whether the secondary interface eniId is
+// deleted, rather than detached, when the instance it is attached to by
+// attachmentId terminates. The primary interface always goes with its
+// instance.
+func (s *VPCServiceImpl) SetENIDeleteOnTermination(accountID, eniId, attachmentId string, deleteOnTermination bool) error {
+	key := utils.AccountKey(accountID, eniId)
+	entry, err := s.eniKV.Get(key)
+	if err != nil {
+		return errors.New(awserrors.ErrorInvalidNetworkInterfaceIDNotFound)
+	}
+
+	var record ENIRecord
+	if err := json.Unmarshal(entry.Value(), &record); err != nil {
+		return errors.New(awserrors.ErrorServerInternal)
+	}
+
+	if record.AttachmentId == "" || record.AttachmentId != attachmentId {
+		return errors.New(awserrors.ErrorInvalidAttachmentIDNotFound)
+	}
+	if record.DeviceIndex == 0 {
+		return awserrors.WithDetail(awserrors.ErrorOperationNotPermitted, "the primary network interface is always deleted with its instance")
+	}
+
+	record.DeleteOnTermination = deleteOnTermination
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal ENI record: %w", err)
+	}
+	if _, err := s.eniKV.Update(key, data, entry.Revision()); err != nil {
+		return errors.New(awserrors.ErrorServerInternal)
+	}
+
+	slog.Info("ENI delete on termination set", "eniId", eniId, "attachmentId", attachmentId, "deleteOnTermination", deleteOnTermination)
+	return nil
+}
+
 // UpdateENIPublicIP updates the PublicIpAddress and PublicIpPool on an ENI record.
 func (s *VPCServiceImpl) UpdateENIPublicIP(accountID, eniId, publicIP, poolName string) error {
 	key := utils.AccountKey(accountID, eniId)
@@ -504,6 +555,7 @@ func (s *VPCServiceImpl) eniRecordToEC2(record *ENIRecord, accountID string) *ec
 		VpcId:              aws.String(record.VpcId),
 		AvailabilityZone:   aws.String(record.AvailabilityZone),
 		PrivateIpAddress:   aws.String(record.PrivateIpAddress),
+		PrivateDnsName:     aws.String(PrivateDNSName(record.PrivateIpAddress)),
 		MacAddress:         aws.String(record.MacAddress),
 		Description:        aws.String(record.Description),
 		Status:             aws.String(record.Status),
@@ -515,6 +567,7 @@ func (s *VPCServiceImpl) eniRecordToEC2(record *ENIRecord, accountID string) *ec
 			{
 				Primary:          aws.Bool(true),
 				PrivateIpAddress: aws.String(record.PrivateIpAddress),
+				PrivateDnsName:   aws.String(PrivateDNSName(record.PrivateIpAddress)),
 			},
 		},
 		Groups: []*ec2.GroupIdentifier{},
@@ -537,12 +590,17 @@ func (s *VPCServiceImpl) eniRecordToEC2(record *ENIRecord, accountID string) *ec
 	}
 
 	if record.AttachmentId != "" {
+		// Primary interfaces go with their instance; secondary ones are
+		// detached and left available unless set to be deleted.
 		eni.Attachment = &ec2.NetworkInterfaceAttachment{
 			AttachmentId:        aws.String(record.AttachmentId),
 			InstanceId:          aws.String(record.InstanceId),
 			DeviceIndex:         aws.Int64(record.DeviceIndex),
 			Status:              aws.String("attached"),
-			DeleteOnTermination: aws.Bool(true),
+			DeleteOnTermination: aws.Bool(record.DeviceIndex == 0 || record.DeleteOnTermination),
+		}
+		if !record.AttachTime.IsZero() {
+			eni.Attachment.AttachTime = aws.Time(record.AttachTime)
 		}
 	}
 
@@ -551,9 +609,71 @@ func (s *VPCServiceImpl) eniRecordToEC2(record *ENIRecord, accountID string) *ec
 	return eni
 }
 
-// generateENIMac creates a locally-administered unicast MAC address from an ENI ID.
-func generateENIMac(eniId string) string {
-	return utils.HashMAC(eniId)
+// maxENIMacAttempts bounds how many ENI IDs newENIIdentity tries before
+// giving up on finding a MAC no other interface has.
+const maxENIMacAttempts = 8
+
+// newENIID generates ENI IDs; tests replace it to force MAC clashes.
+var newENIID = func() string {
+	return utils.GenerateResourceID("eni")
+}
+
+// newENIIdentity returns a fresh ENI ID and its MAC, drawing a new ID when
+// the derived MAC is already held by another interface. Hash collisions are
+// rare with the default scheme but likely within a few thousand ENIs under a
+// 3-octet OUI, and two ports sharing a MAC break forwarding for both.
+func (s *VPCServiceImpl) newENIIdentity() (string, string, error) {
+	used, err := s.usedENIMacs()
+	if err != nil {
+		return "", "", err
+	}
+	oui := s.config.MACPrefix()
+	for range maxENIMacAttempts {
+		eniId := newENIID()
+		macAddr := generateENIMac(oui, eniId)
+		if !used[macAddr] {
+			return eniId, macAddr, nil
+		}
+		slog.Warn("ENI MAC already in use, retrying with a new ID", "eniId", eniId, "mac", macAddr)
+	}
+	slog.Error("newENIIdentity: no free MAC address", "attempts", maxENIMacAttempts)
+	return "", "", errors.New(awserrors.ErrorServerInternal)
+}
+
+// usedENIMacs returns the MAC of every ENI in the cluster. It spans accounts
+// because their ports share the same host bridges.
+func (s *VPCServiceImpl) usedENIMacs() (map[string]bool, error) {
+	keys, err := s.eniKV.Keys()
+	if err != nil && !errors.Is(err, nats.ErrNoKeysFound) {
+		slog.Error("usedENIMacs: failed to list ENIs", "err", err)
+		return nil, errors.New(awserrors.ErrorServerInternal)
+	}
+
+	used := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if key == utils.VersionKey {
+			continue
+		}
+		entry, err := s.eniKV.Get(key)
+		if err != nil {
+			slog.Warn("Failed to get ENI record", "key", key, "error", err)
+			continue
+		}
+		var record ENIRecord
+		if err := json.Unmarshal(entry.Value(), &record); err != nil {
+			slog.Warn("Failed to unmarshal ENI record", "key", key, "error", err)
+			continue
+		}
+		used[record.MacAddress] = true
+	}
+	return used, nil
+}
+
+// generateENIMac creates a locally-administered unicast MAC address from an
+// ENI ID, under the configured OUI if one is set. The same ENI ID always
+// yields the same MAC, so a re-adopted or restarted instance keeps its address.
+func generateENIMac(oui net.HardwareAddr, eniId string) string {
+	return utils.HashMACWithOUI(oui, eniId)
 }
 
 // publishENIEvent publishes an ENI lifecycle event to NATS for vpcd consumption.
@@ -1,27 +1,34 @@
 package handlers_ec2_vpc
 
 import (
+	"fmt"
 	"net"
+	"strings"
 	"testing"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/config"
+	"github.com/mulgadc/spinifex/spinifex/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func TestGenerateENIMac_Deterministic(t *testing.T) {
-	mac1 := generateENIMac("eni-abc123")
-	mac2 := generateENIMac("eni-abc123")
+	mac1 := generateENIMac(nil, "eni-abc123")
+	mac2 := generateENIMac(nil, "eni-abc123")
 	assert.Equal(t, mac1, mac2, "same input must produce same MAC")
 }
 
 func TestGenerateENIMac_DifferentInputs(t *testing.T) {
-	mac1 := generateENIMac("eni-aaa")
-	mac2 := generateENIMac("eni-bbb")
+	mac1 := generateENIMac(nil, "eni-aaa")
+	mac2 := generateENIMac(nil, "eni-bbb")
 	assert.NotEqual(t, mac1, mac2, "different inputs should produce different MACs")
 }
 
 func TestGenerateENIMac_LocallyAdministered(t *testing.T) {
-	mac := generateENIMac("eni-test123")
+	mac := generateENIMac(nil, "eni-test123")
 	hw, err := net.ParseMAC(mac)
 	require.NoError(t, err)
 	// IEEE 802 reserved bits on first octet: bit0=0 unicast, bit1=1 LAA.
@@ -29,7 +36,7 @@ func TestGenerateENIMac_LocallyAdministered(t *testing.T) {
 }
 
 func TestGenerateENIMac_EmptyString(t *testing.T) {
-	mac := generateENIMac("")
+	mac := generateENIMac(nil, "")
 	hw, err := net.ParseMAC(mac)
 	require.NoError(t, err)
 	assert.Equal(t, byte(0x02), hw[0]&0x03)
@@ -37,3 +44,79 @@ func TestGenerateENIMac_EmptyString(t *testing.T) {
 	// the degenerate 02:00:00:00:00:00 of the old 24-bit impl.
 	assert.NotEqual(t, "02:00:00:00:00:00", hw.String())
 }
+
+func TestGenerateENIMac_ConfiguredOUI(t *testing.T) {
+	oui, err := config.ParseMACOUI("0a:5f:00")
+	require.NoError(t, err)
+
+	mac := generateENIMac(oui, "eni-abc123")
+	assert.True(t, strings.HasPrefix(mac, "0a:5f:00:"), "MAC %s should carry the configured OUI", mac)
+	assert.Equal(t, mac, generateENIMac(oui, "eni-abc123"), "same ENI ID must always yield the same MAC")
+	assert.NotEqual(t, generateENIMac(nil, "eni-abc123"), mac, "OUI must change the derived MAC")
+}
+
+func TestGenerateENIMac_NoCollisionsAcrossInstances(t *testing.T) {
+	oui, err := config.ParseMACOUI("0a:5f:00")
+	require.NoError(t, err)
+
+	for _, prefix := range []net.HardwareAddr{nil, oui} {
+		seen := make(map[string]string)
+		for i := range 200 {
+			eniId := fmt.Sprintf("eni-%017x", i)
+			mac := generateENIMac(prefix, eniId)
+			if prev, ok := seen[mac]; ok {
+				t.Fatalf("MAC %s collides between %s and %s", mac, prev, eniId)
+			}
+			seen[mac] = eniId
+		}
+	}
+}
+
+func TestCreateNetworkInterface_UsesConfiguredOUI(t *testing.T) {
+	_, nc, _ := testutil.StartTestJetStream(t)
+	svc, err := NewVPCServiceImplWithNATS(&config.Config{MACOUI: "0a:5f:00"}, nc)
+	require.NoError(t, err)
+
+	vpcId := createTestVPC(t, svc, "10.0.0.0/16")
+	subnetId := createTestSubnet(t, svc, vpcId, "10.0.1.0/24")
+	out, err := svc.CreateNetworkInterface(&ec2.CreateNetworkInterfaceInput{
+		SubnetId: aws.String(subnetId),
+	}, testAccountID)
+	require.NoError(t, err)
+
+	eniId := *out.NetworkInterface.NetworkInterfaceId
+	assert.Equal(t, generateENIMac(svc.config.MACPrefix(), eniId), *out.NetworkInterface.MacAddress)
+	assert.True(t, strings.HasPrefix(*out.NetworkInterface.MacAddress, "0a:5f:00:"))
+}
+
+func TestCreateNetworkInterface_RetriesDuplicateMAC(t *testing.T) {
+	_, nc, _ := testutil.StartTestJetStream(t)
+	svc, err := NewVPCServiceImplWithNATS(&config.Config{}, nc)
+	require.NoError(t, err)
+
+	vpcId := createTestVPC(t, svc, "10.0.0.0/16")
+	subnetId := createTestSubnet(t, svc, vpcId, "10.0.1.0/24")
+
+	// The second ENI's first ID repeats the first ENI's, so its MAC clashes
+	ids := []string{"eni-0000000000000000a", "eni-0000000000000000a", "eni-0000000000000000b"}
+	orig := newENIID
+	newENIID = func() string {
+		id := ids[0]
+		ids = ids[1:]
+		return id
+	}
+	t.Cleanup(func() { newENIID = orig })
+
+	first, err := svc.CreateNetworkInterface(&ec2.CreateNetworkInterfaceInput{SubnetId: aws.String(subnetId)}, testAccountID)
+	require.NoError(t, err)
+	second, err := svc.CreateNetworkInterface(&ec2.CreateNetworkInterfaceInput{SubnetId: aws.String(subnetId)}, testAccountID)
+	require.NoError(t, err)
+
+	assert.Equal(t, "eni-0000000000000000b", *second.NetworkInterface.NetworkInterfaceId)
+	assert.NotEqual(t, *first.NetworkInterface.MacAddress, *second.NetworkInterface.MacAddress)
+
+	// Every ID drawn clashes: give up rather than hand out a duplicate
+	newENIID = func() string { return "eni-0000000000000000a" }
+	_, err = svc.CreateNetworkInterface(&ec2.CreateNetworkInterfaceInput{SubnetId: aws.String(subnetId)}, testAccountID)
+	assert.EqualError(t, err, awserrors.ErrorServerInternal)
+}
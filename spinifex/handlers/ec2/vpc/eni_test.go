@@ -40,6 +40,7 @@ func TestCreateNetworkInterface(t *testing.T) {
 	assert.Equal(t, vpcId, *eni.VpcId)
 	assert.Equal(t, "available", *eni.Status)
 	assert.Equal(t, "10.0.1.4", *eni.PrivateIpAddress)
+	assert.Equal(t, "ip-10-0-1-4.spinifex.internal", *eni.PrivateDnsName)
 	assert.NotEmpty(t, *eni.MacAddress)
 }
 
@@ -243,6 +244,18 @@ func TestAttachENI(t *testing.T) {
 	assert.NotNil(t, eni.Attachment)
 	assert.Equal(t, "i-test123", *eni.Attachment.InstanceId)
 	assert.Equal(t, int64(0), *eni.Attachment.DeviceIndex)
+	assert.NotNil(t, eni.Attachment.AttachTime)
+	assert.True(t, *eni.Attachment.DeleteOnTermination, "primary interfaces go with the instance")
+
+	// Secondary interfaces survive termination
+	secondId := createTestENI(t, svc, subnetId)
+	_, err = svc.AttachENI(testAccountID, secondId, "i-test123", 1)
+	require.NoError(t, err)
+	out, err = svc.DescribeNetworkInterfaces(&ec2.DescribeNetworkInterfacesInput{
+		NetworkInterfaceIds: []*string{aws.String(secondId)},
+	}, testAccountID)
+	require.NoError(t, err)
+	assert.False(t, *out.NetworkInterfaces[0].Attachment.DeleteOnTermination)
 }
 
 func TestAttachENI_AlreadyAttached(t *testing.T) {
@@ -280,17 +293,51 @@ func TestDetachENI(t *testing.T) {
 	assert.Nil(t, out.NetworkInterfaces[0].Attachment)
 }
 
+func TestSetENIDeleteOnTermination(t *testing.T) {
+	svc := setupTestVPCService(t)
+	vpcId := createTestVPC(t, svc, "10.0.0.0/16")
+	subnetId := createTestSubnet(t, svc, vpcId, "10.0.1.0/24")
+	primaryId := createTestENI(t, svc, subnetId)
+	eniId := createTestENI(t, svc, subnetId)
+
+	primaryAttach, err := svc.AttachENI(testAccountID, primaryId, "i-test123", 0)
+	require.NoError(t, err)
+	attachId, err := svc.AttachENI(testAccountID, eniId, "i-test123", 1)
+	require.NoError(t, err)
+
+	deleteOnTermination := func() bool {
+		out, err := svc.DescribeNetworkInterfaces(&ec2.DescribeNetworkInterfacesInput{
+			NetworkInterfaceIds: []*string{aws.String(eniId)},
+		}, testAccountID)
+		require.NoError(t, err)
+		return *out.NetworkInterfaces[0].Attachment.DeleteOnTermination
+	}
+
+	require.NoError(t, svc.SetENIDeleteOnTermination(testAccountID, eniId, attachId, true))
+	assert.True(t, deleteOnTermination())
+
+	assert.ErrorContains(t, svc.SetENIDeleteOnTermination(testAccountID, eniId, "eni-attach-other", false), "InvalidAttachmentID.NotFound")
+	assert.ErrorContains(t, svc.SetENIDeleteOnTermination(testAccountID, primaryId, primaryAttach, false), "OperationNotPermitted")
+	assert.ErrorContains(t, svc.SetENIDeleteOnTermination(testAccountID, "eni-nonexistent", attachId, false), "InvalidNetworkInterfaceID.NotFound")
+
+	// A new attachment starts over
+	require.NoError(t, svc.DetachENI(testAccountID, eniId))
+	attachId, err = svc.AttachENI(testAccountID, eniId, "i-test456", 1)
+	require.NoError(t, err)
+	assert.False(t, deleteOnTermination())
+}
+
 func TestGenerateENIMac(t *testing.T) {
-	mac := generateENIMac("eni-test123")
+	mac := generateENIMac(nil, "eni-test123")
 	hw, err := net.ParseMAC(mac)
 	require.NoError(t, err)
 	assert.Equal(t, byte(0x02), hw[0]&0x03)
 
 	// Same input produces same MAC
-	assert.Equal(t, mac, generateENIMac("eni-test123"))
+	assert.Equal(t, mac, generateENIMac(nil, "eni-test123"))
 
 	// Different input produces different MAC
-	assert.NotEqual(t, mac, generateENIMac("eni-test456"))
+	assert.NotEqual(t, mac, generateENIMac(nil, "eni-test456"))
 }
 
 // --- Filter tests ---
@@ -2,7 +2,7 @@ package handlers_ec2_vpc
 
 import "github.com/aws/aws-sdk-go/service/ec2"
 
-// VPCService defines the interface for VPC, Subnet, ENI, and Security Group operations
+// VPCService defines the interface for VPC, Subnet, DHCP options, ENI, and Security Group operations
 type VPCService interface {
 	CreateVpc(input *ec2.CreateVpcInput, accountID string) (*ec2.CreateVpcOutput, error)
 	DeleteVpc(input *ec2.DeleteVpcInput, accountID string) (*ec2.DeleteVpcOutput, error)
@@ -13,6 +13,10 @@ type VPCService interface {
 	ModifySubnetAttribute(input *ec2.ModifySubnetAttributeInput, accountID string) (*ec2.ModifySubnetAttributeOutput, error)
 	ModifyVpcAttribute(input *ec2.ModifyVpcAttributeInput, accountID string) (*ec2.ModifyVpcAttributeOutput, error)
 	DescribeVpcAttribute(input *ec2.DescribeVpcAttributeInput, accountID string) (*ec2.DescribeVpcAttributeOutput, error)
+	CreateDhcpOptions(input *ec2.CreateDhcpOptionsInput, accountID string) (*ec2.CreateDhcpOptionsOutput, error)
+	DeleteDhcpOptions(input *ec2.DeleteDhcpOptionsInput, accountID string) (*ec2.DeleteDhcpOptionsOutput, error)
+	DescribeDhcpOptions(input *ec2.DescribeDhcpOptionsInput, accountID string) (*ec2.DescribeDhcpOptionsOutput, error)
+	AssociateDhcpOptions(input *ec2.AssociateDhcpOptionsInput, accountID string) (*ec2.AssociateDhcpOptionsOutput, error)
 	CreateNetworkInterface(input *ec2.CreateNetworkInterfaceInput, accountID string) (*ec2.CreateNetworkInterfaceOutput, error)
 	DeleteNetworkInterface(input *ec2.DeleteNetworkInterfaceInput, accountID string) (*ec2.DeleteNetworkInterfaceOutput, error)
 	DescribeNetworkInterfaces(input *ec2.DescribeNetworkInterfacesInput, accountID string) (*ec2.DescribeNetworkInterfacesOutput, error)
@@ -45,6 +45,7 @@ type VPCRecord struct {
 	EnableDnsHostnames               bool              `json:"enable_dns_hostnames"`
 	EnableDnsSupport                 bool              `json:"enable_dns_support"`
 	EnableNetworkAddressUsageMetrics bool              `json:"enable_network_address_usage_metrics"`
+	DhcpOptionsId                    string            `json:"dhcp_options_id,omitempty"` // Empty for the built-in set
 	Tags                             map[string]string `json:"tags"`
 	CreatedAt                        time.Time         `json:"created_at"`
 }
@@ -72,6 +73,7 @@ type VPCServiceImpl struct {
 	eniKV    nats.KeyValue
 	sgKV     nats.KeyValue
 	rtbKV    nats.KeyValue // route table bucket for auto-creating main route table
+	dhcpKV   nats.KeyValue
 	ipam     *IPAM
 
 	// Optional: injected after construction for public IP cleanup in DeleteNetworkInterface.
@@ -138,6 +140,14 @@ func NewVPCServiceImplWithNATS(cfg *config.Config, natsConn *nats.Conn) (*VPCSer
 		return nil, fmt.Errorf("failed to create KV bucket spinifex-vpc-route-tables: %w", err)
 	}
 
+	dhcpKV, err := utils.GetOrCreateKVBucket(js, KVBucketDhcpOptions, 10)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create KV bucket %s: %w", KVBucketDhcpOptions, err)
+	}
+	if err := migrate.DefaultRegistry.RunKV(KVBucketDhcpOptions, dhcpKV, KVBucketDhcpOptionsVersion); err != nil {
+		return nil, fmt.Errorf("migrate %s: %w", KVBucketDhcpOptions, err)
+	}
+
 	ipam, err := NewIPAM(js)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize IPAM: %w", err)
@@ -148,7 +158,8 @@ func NewVPCServiceImplWithNATS(cfg *config.Config, natsConn *nats.Conn) (*VPCSer
 		"subnetBucket", KVBucketSubnets,
 		"vniBucket", KVBucketVNICounter,
 		"eniBucket", KVBucketENIs,
-		"sgBucket", KVBucketSecurityGroups)
+		"sgBucket", KVBucketSecurityGroups,
+		"dhcpOptionsBucket", KVBucketDhcpOptions)
 
 	return &VPCServiceImpl{
 		config:   cfg,
@@ -159,6 +170,7 @@ func NewVPCServiceImplWithNATS(cfg *config.Config, natsConn *nats.Conn) (*VPCSer
 		eniKV:    eniKV,
 		sgKV:     sgKV,
 		rtbKV:    rtbKV,
+		dhcpKV:   dhcpKV,
 		ipam:     ipam,
 	}, nil
 }
@@ -512,7 +524,7 @@ func (s *VPCServiceImpl) CreateSubnet(input *ec2.CreateSubnetInput, accountID st
 	slog.Info("CreateSubnet completed", "subnetId", subnetID, "vpcId", vpcID, "cidrBlock", record.CidrBlock, "accountID", accountID)
 
 	// Publish vpc.create-subnet event for vpcd topology translation
-	s.publishSubnetEvent("vpc.create-subnet", record.SubnetId, record.VpcId, record.CidrBlock)
+	s.publishSubnetEvent("vpc.create-subnet", record.SubnetId, record.VpcId, record.CidrBlock, s.vpcDhcpOptions(accountID, &vpcRecord))
 
 	return &ec2.CreateSubnetOutput{
 		Subnet: s.subnetRecordToEC2(&record, totalHosts, accountID),
@@ -543,7 +555,7 @@ func (s *VPCServiceImpl) DeleteSubnet(input *ec2.DeleteSubnetInput, accountID st
 	slog.Info("DeleteSubnet completed", "subnetId", subnetID, "accountID", accountID)
 
 	// Publish vpc.delete-subnet event for vpcd topology cleanup
-	s.publishSubnetEvent("vpc.delete-subnet", subnetID, subnetRecord.VpcId, subnetRecord.CidrBlock)
+	s.publishSubnetEvent("vpc.delete-subnet", subnetID, subnetRecord.VpcId, subnetRecord.CidrBlock, nil)
 
 	return &ec2.DeleteSubnetOutput{}, nil
 }
@@ -722,10 +734,14 @@ func (s *VPCServiceImpl) vpcRecordToEC2(record *VPCRecord, accountID string) *ec
 				AssociationId: aws.String(fmt.Sprintf("vpc-cidr-assoc-%s", record.VpcId[4:])),
 			},
 		},
-		DhcpOptionsId:   aws.String("dopt-default"),
+		DhcpOptionsId:   aws.String(DefaultDhcpOptionsID),
 		InstanceTenancy: aws.String("default"),
 	}
 
+	if record.DhcpOptionsId != "" {
+		vpc.DhcpOptionsId = aws.String(record.DhcpOptionsId)
+	}
+
 	vpc.Tags = utils.MapToEC2Tags(record.Tags)
 
 	return vpc
@@ -1003,7 +1019,7 @@ func (s *VPCServiceImpl) EnsureDefaultVPC(accountID string, bootstrap ...Bootstr
 		return nil, fmt.Errorf("store default subnet: %w", err)
 	}
 
-	s.publishSubnetEvent("vpc.create-subnet", subnetID, vpcID, DefaultSubnetCidr)
+	s.publishSubnetEvent("vpc.create-subnet", subnetID, vpcID, DefaultSubnetCidr, s.vpcDhcpOptions(accountID, &vpcRecord))
 
 	// Create main route table with local route (written directly to KV to avoid circular import)
 	if s.rtbKV != nil {
@@ -1145,10 +1161,16 @@ func (s *VPCServiceImpl) publishVPCEvent(topic, vpcId, cidrBlock string, vni int
 }
 
 // publishSubnetEvent publishes a subnet lifecycle event to NATS for vpcd consumption.
-func (s *VPCServiceImpl) publishSubnetEvent(topic, subnetId, vpcId, cidrBlock string) {
-	utils.PublishEvent(s.natsConn, topic, struct {
+// options is the VPC's DHCP options set for a new subnet, nil otherwise.
+func (s *VPCServiceImpl) publishSubnetEvent(topic, subnetId, vpcId, cidrBlock string, options *DhcpOptionsRecord) {
+	evt := struct {
 		SubnetId  string `json:"subnet_id"`
 		VpcId     string `json:"vpc_id"`
 		CidrBlock string `json:"cidr_block"`
-	}{SubnetId: subnetId, VpcId: vpcId, CidrBlock: cidrBlock})
+		DHCPOptionsEvent
+	}{SubnetId: subnetId, VpcId: vpcId, CidrBlock: cidrBlock}
+	if options != nil {
+		evt.DHCPOptionsEvent = options.Event(vpcId)
+	}
+	utils.PublishEvent(s.natsConn, topic, evt)
 }
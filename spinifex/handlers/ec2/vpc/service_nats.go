@@ -54,6 +54,22 @@ func (s *NATSVPCService) DescribeVpcAttribute(input *ec2.DescribeVpcAttributeInp
 	return utils.NATSRequest[ec2.DescribeVpcAttributeOutput](s.natsConn, "ec2.DescribeVpcAttribute", input, 30*time.Second, accountID)
 }
 
+func (s *NATSVPCService) CreateDhcpOptions(input *ec2.CreateDhcpOptionsInput, accountID string) (*ec2.CreateDhcpOptionsOutput, error) {
+	return utils.NATSRequest[ec2.CreateDhcpOptionsOutput](s.natsConn, "ec2.CreateDhcpOptions", input, 30*time.Second, accountID)
+}
+
+func (s *NATSVPCService) DeleteDhcpOptions(input *ec2.DeleteDhcpOptionsInput, accountID string) (*ec2.DeleteDhcpOptionsOutput, error) {
+	return utils.NATSRequest[ec2.DeleteDhcpOptionsOutput](s.natsConn, "ec2.DeleteDhcpOptions", input, 30*time.Second, accountID)
+}
+
+func (s *NATSVPCService) DescribeDhcpOptions(input *ec2.DescribeDhcpOptionsInput, accountID string) (*ec2.DescribeDhcpOptionsOutput, error) {
+	return utils.NATSRequest[ec2.DescribeDhcpOptionsOutput](s.natsConn, "ec2.DescribeDhcpOptions", input, 30*time.Second, accountID)
+}
+
+func (s *NATSVPCService) AssociateDhcpOptions(input *ec2.AssociateDhcpOptionsInput, accountID string) (*ec2.AssociateDhcpOptionsOutput, error) {
+	return utils.NATSRequest[ec2.AssociateDhcpOptionsOutput](s.natsConn, "ec2.AssociateDhcpOptions", input, 30*time.Second, accountID)
+}
+
 func (s *NATSVPCService) CreateNetworkInterface(input *ec2.CreateNetworkInterfaceInput, accountID string) (*ec2.CreateNetworkInterfaceOutput, error) {
 	return utils.NATSRequest[ec2.CreateNetworkInterfaceOutput](s.natsConn, "ec2.CreateNetworkInterface", input, 30*time.Second, accountID)
 }
@@ -4,7 +4,9 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -119,6 +121,13 @@ func DecryptSecret(ciphertext string, key []byte) (string, error) {
 	return d.Decrypt(ciphertext)
 }
 
+// HashSessionToken returns the hex-encoded SHA-256 of an STS session token.
+// Only the hash is stored; requests present the token itself.
+func HashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 // SaveBootstrapData writes bootstrap data as JSON to disk with 0600 permissions.
 // It always sets the version to BootstrapVersion.
 func SaveBootstrapData(path string, data *BootstrapData) error {
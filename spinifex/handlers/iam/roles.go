@@ -0,0 +1,633 @@
+package handlers_iam
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// Role MaxSessionDuration bounds, in seconds, as on AWS.
+	defaultRoleSessionDuration = 3600
+	maxRoleSessionDuration     = 43200
+
+	maxTrustPolicyDocumentSize = 2048
+
+	// ec2ServicePrincipal is the service a role's trust policy must name for
+	// the role to be passed to instances through an instance profile.
+	ec2ServicePrincipal = "ec2.amazonaws.com"
+)
+
+// ---------------------------------------------------------------------------
+// Role CRUD
+// ---------------------------------------------------------------------------
+
+func (s *IAMServiceImpl) CreateRole(accountID string, input *iam.CreateRoleInput) (*iam.CreateRoleOutput, error) {
+	roleName := *input.RoleName
+	if err := validateUserName(roleName); err != nil {
+		return nil, errors.New(awserrors.ErrorIAMInvalidInput)
+	}
+
+	path := "/"
+	if input.Path != nil {
+		path = *input.Path
+		if err := validatePath(path); err != nil {
+			return nil, errors.New(awserrors.ErrorIAMInvalidInput)
+		}
+	}
+
+	if _, err := ValidateTrustPolicyDocument(*input.AssumeRolePolicyDocument); err != nil {
+		slog.Debug("CreateRole: invalid trust policy", "err", err)
+		return nil, errors.New(awserrors.ErrorIAMMalformedPolicyDocument)
+	}
+
+	maxSession := int64(defaultRoleSessionDuration)
+	if input.MaxSessionDuration != nil {
+		maxSession = *input.MaxSessionDuration
+		if maxSession < defaultRoleSessionDuration || maxSession > maxRoleSessionDuration {
+			return nil, errors.New(awserrors.ErrorValidationError)
+		}
+	}
+
+	roleID, err := generateIAMID("AROA")
+	if err != nil {
+		return nil, fmt.Errorf("generate role ID: %w", err)
+	}
+
+	role := Role{
+		RoleName:                 roleName,
+		RoleID:                   roleID,
+		AccountID:                accountID,
+		ARN:                      fmt.Sprintf("arn:aws:iam::%s:role%s%s", accountID, path, roleName),
+		Path:                     path,
+		Description:              aws.StringValue(input.Description),
+		AssumeRolePolicyDocument: *input.AssumeRolePolicyDocument,
+		MaxSessionDuration:       maxSession,
+		CreatedAt:                time.Now().UTC().Format(time.RFC3339),
+		Tags:                     []Tag{},
+		AttachedPolicies:         []string{},
+	}
+
+	for _, tag := range input.Tags {
+		if tag.Key != nil && tag.Value != nil {
+			role.Tags = append(role.Tags, Tag{Key: *tag.Key, Value: *tag.Value})
+		}
+	}
+
+	data, err := json.Marshal(role)
+	if err != nil {
+		return nil, fmt.Errorf("marshal role: %w", err)
+	}
+
+	if _, err := s.rolesBucket.Create(accountID+"."+roleName, data); err != nil {
+		if errors.Is(err, nats.ErrKeyExists) {
+			return nil, errors.New(awserrors.ErrorIAMEntityAlreadyExists)
+		}
+		return nil, fmt.Errorf("store role: %w", err)
+	}
+
+	slog.Info("IAM role created", "accountID", accountID, "roleName", roleName, "roleID", role.RoleID)
+	return &iam.CreateRoleOutput{Role: role.toIAM()}, nil
+}
+
+func (s *IAMServiceImpl) GetRole(accountID string, input *iam.GetRoleInput) (*iam.GetRoleOutput, error) {
+	role, err := s.getRole(accountID, *input.RoleName)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.GetRoleOutput{Role: role.toIAM()}, nil
+}
+
+func (s *IAMServiceImpl) ListRoles(accountID string, input *iam.ListRolesInput) (*iam.ListRolesOutput, error) {
+	pathPrefix := "/"
+	if input.PathPrefix != nil {
+		pathPrefix = *input.PathPrefix
+	}
+
+	var roles []*iam.Role
+	err := listAccountEntries(s.rolesBucket, accountID, func(key string, value []byte) {
+		var role Role
+		if err := json.Unmarshal(value, &role); err != nil {
+			slog.Warn("ListRoles: failed to unmarshal role", "key", key, "err", err)
+			return
+		}
+		if strings.HasPrefix(role.Path, pathPrefix) {
+			roles = append(roles, role.toIAM())
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list roles: %w", err)
+	}
+
+	return &iam.ListRolesOutput{
+		Roles:       roles,
+		IsTruncated: aws.Bool(false),
+	}, nil
+}
+
+func (s *IAMServiceImpl) DeleteRole(accountID string, input *iam.DeleteRoleInput) (*iam.DeleteRoleOutput, error) {
+	roleName := *input.RoleName
+
+	role, err := s.getRole(accountID, roleName)
+	if err != nil {
+		return nil, err
+	}
+	if len(role.AttachedPolicies) > 0 {
+		return nil, errors.New(awserrors.ErrorIAMDeleteConflict)
+	}
+
+	// A role still in an instance profile must be removed from it first.
+	inProfile := false
+	err = listAccountEntries(s.profilesBucket, accountID, func(key string, value []byte) {
+		var profile InstanceProfile
+		if err := json.Unmarshal(value, &profile); err != nil {
+			slog.Warn("DeleteRole: failed to unmarshal instance profile", "key", key, "err", err)
+			return
+		}
+		if slices.Contains(profile.Roles, roleName) {
+			inProfile = true
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("check instance profiles: %w", err)
+	}
+	if inProfile {
+		return nil, errors.New(awserrors.ErrorIAMDeleteConflict)
+	}
+
+	if err := s.rolesBucket.Delete(accountID + "." + roleName); err != nil {
+		return nil, fmt.Errorf("delete role: %w", err)
+	}
+
+	slog.Info("IAM role deleted", "accountID", accountID, "roleName", roleName)
+	return &iam.DeleteRoleOutput{}, nil
+}
+
+// ---------------------------------------------------------------------------
+// Role Policy Attachment
+// ---------------------------------------------------------------------------
+
+func (s *IAMServiceImpl) AttachRolePolicy(accountID string, input *iam.AttachRolePolicyInput) (*iam.AttachRolePolicyOutput, error) {
+	roleName := *input.RoleName
+	policyARN := *input.PolicyArn
+
+	if _, err := s.getPolicyByARN(accountID, policyARN); err != nil {
+		return nil, err
+	}
+
+	role, err := s.getRole(accountID, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Idempotent — if already attached, succeed silently
+	if slices.Contains(role.AttachedPolicies, policyARN) {
+		return &iam.AttachRolePolicyOutput{}, nil
+	}
+
+	role.AttachedPolicies = append(role.AttachedPolicies, policyARN)
+	if err := s.putRole(role); err != nil {
+		return nil, err
+	}
+
+	slog.Info("IAM policy attached to role", "accountID", accountID, "roleName", roleName, "policyArn", policyARN)
+	return &iam.AttachRolePolicyOutput{}, nil
+}
+
+func (s *IAMServiceImpl) DetachRolePolicy(accountID string, input *iam.DetachRolePolicyInput) (*iam.DetachRolePolicyOutput, error) {
+	roleName := *input.RoleName
+	policyARN := *input.PolicyArn
+
+	role, err := s.getRole(accountID, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := slices.DeleteFunc(slices.Clone(role.AttachedPolicies), func(arn string) bool {
+		return arn == policyARN
+	})
+	if len(remaining) == len(role.AttachedPolicies) {
+		return nil, errors.New(awserrors.ErrorIAMNoSuchEntity)
+	}
+
+	role.AttachedPolicies = remaining
+	if err := s.putRole(role); err != nil {
+		return nil, err
+	}
+
+	slog.Info("IAM policy detached from role", "accountID", accountID, "roleName", roleName, "policyArn", policyARN)
+	return &iam.DetachRolePolicyOutput{}, nil
+}
+
+func (s *IAMServiceImpl) ListAttachedRolePolicies(accountID string, input *iam.ListAttachedRolePoliciesInput) (*iam.ListAttachedRolePoliciesOutput, error) {
+	role, err := s.getRole(accountID, *input.RoleName)
+	if err != nil {
+		return nil, err
+	}
+
+	var attached []*iam.AttachedPolicy
+	for _, arn := range role.AttachedPolicies {
+		policy, err := s.getPolicyByARN(accountID, arn)
+		if err != nil {
+			slog.Warn("ListAttachedRolePolicies: policy not found for ARN", "arn", arn, "err", err)
+			continue
+		}
+		attached = append(attached, &iam.AttachedPolicy{
+			PolicyArn:  aws.String(policy.ARN),
+			PolicyName: aws.String(policy.PolicyName),
+		})
+	}
+
+	return &iam.ListAttachedRolePoliciesOutput{
+		AttachedPolicies: attached,
+		IsTruncated:      aws.Bool(false),
+	}, nil
+}
+
+// GetRolePolicies resolves all policy documents attached to a role, for
+// evaluating requests made with the role's session credentials.
+func (s *IAMServiceImpl) GetRolePolicies(accountID, roleName string) ([]PolicyDocument, error) {
+	role, err := s.getRole(accountID, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []PolicyDocument
+	for _, arn := range role.AttachedPolicies {
+		policy, err := s.getPolicyByARN(accountID, arn)
+		if err != nil {
+			// Fail closed, as in GetUserPolicies.
+			return nil, fmt.Errorf("resolve policy %s: %w", arn, err)
+		}
+		var doc PolicyDocument
+		if err := json.Unmarshal([]byte(policy.PolicyDocument), &doc); err != nil {
+			return nil, fmt.Errorf("parse policy %s: %w", policy.PolicyName, err)
+		}
+		docs = append(docs, doc)
+	}
+
+	return docs, nil
+}
+
+// ---------------------------------------------------------------------------
+// Instance Profiles
+// ---------------------------------------------------------------------------
+
+func (s *IAMServiceImpl) CreateInstanceProfile(accountID string, input *iam.CreateInstanceProfileInput) (*iam.CreateInstanceProfileOutput, error) {
+	profileName := *input.InstanceProfileName
+	if err := validateUserName(profileName); err != nil {
+		return nil, errors.New(awserrors.ErrorIAMInvalidInput)
+	}
+
+	path := "/"
+	if input.Path != nil {
+		path = *input.Path
+		if err := validatePath(path); err != nil {
+			return nil, errors.New(awserrors.ErrorIAMInvalidInput)
+		}
+	}
+
+	profileID, err := generateIAMID("AIPA")
+	if err != nil {
+		return nil, fmt.Errorf("generate instance profile ID: %w", err)
+	}
+
+	profile := InstanceProfile{
+		InstanceProfileName: profileName,
+		InstanceProfileID:   profileID,
+		AccountID:           accountID,
+		ARN:                 fmt.Sprintf("arn:aws:iam::%s:instance-profile%s%s", accountID, path, profileName),
+		Path:                path,
+		CreatedAt:           time.Now().UTC().Format(time.RFC3339),
+		Roles:               []string{},
+	}
+
+	data, err := json.Marshal(profile)
+	if err != nil {
+		return nil, fmt.Errorf("marshal instance profile: %w", err)
+	}
+
+	if _, err := s.profilesBucket.Create(accountID+"."+profileName, data); err != nil {
+		if errors.Is(err, nats.ErrKeyExists) {
+			return nil, errors.New(awserrors.ErrorIAMEntityAlreadyExists)
+		}
+		return nil, fmt.Errorf("store instance profile: %w", err)
+	}
+
+	slog.Info("IAM instance profile created", "accountID", accountID, "instanceProfileName", profileName)
+	return &iam.CreateInstanceProfileOutput{InstanceProfile: s.instanceProfileToIAM(&profile)}, nil
+}
+
+func (s *IAMServiceImpl) GetInstanceProfile(accountID string, input *iam.GetInstanceProfileInput) (*iam.GetInstanceProfileOutput, error) {
+	profile, err := s.getInstanceProfile(accountID, *input.InstanceProfileName)
+	if err != nil {
+		return nil, err
+	}
+	return &iam.GetInstanceProfileOutput{InstanceProfile: s.instanceProfileToIAM(profile)}, nil
+}
+
+func (s *IAMServiceImpl) ListInstanceProfiles(accountID string, input *iam.ListInstanceProfilesInput) (*iam.ListInstanceProfilesOutput, error) {
+	pathPrefix := "/"
+	if input.PathPrefix != nil {
+		pathPrefix = *input.PathPrefix
+	}
+
+	var profiles []*iam.InstanceProfile
+	err := listAccountEntries(s.profilesBucket, accountID, func(key string, value []byte) {
+		var profile InstanceProfile
+		if err := json.Unmarshal(value, &profile); err != nil {
+			slog.Warn("ListInstanceProfiles: failed to unmarshal instance profile", "key", key, "err", err)
+			return
+		}
+		if strings.HasPrefix(profile.Path, pathPrefix) {
+			profiles = append(profiles, s.instanceProfileToIAM(&profile))
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("list instance profiles: %w", err)
+	}
+
+	return &iam.ListInstanceProfilesOutput{
+		InstanceProfiles: profiles,
+		IsTruncated:      aws.Bool(false),
+	}, nil
+}
+
+func (s *IAMServiceImpl) DeleteInstanceProfile(accountID string, input *iam.DeleteInstanceProfileInput) (*iam.DeleteInstanceProfileOutput, error) {
+	profileName := *input.InstanceProfileName
+
+	profile, err := s.getInstanceProfile(accountID, profileName)
+	if err != nil {
+		return nil, err
+	}
+	if len(profile.Roles) > 0 {
+		return nil, errors.New(awserrors.ErrorIAMDeleteConflict)
+	}
+
+	if err := s.profilesBucket.Delete(accountID + "." + profileName); err != nil {
+		return nil, fmt.Errorf("delete instance profile: %w", err)
+	}
+
+	slog.Info("IAM instance profile deleted", "accountID", accountID, "instanceProfileName", profileName)
+	return &iam.DeleteInstanceProfileOutput{}, nil
+}
+
+func (s *IAMServiceImpl) AddRoleToInstanceProfile(accountID string, input *iam.AddRoleToInstanceProfileInput) (*iam.AddRoleToInstanceProfileOutput, error) {
+	profileName := *input.InstanceProfileName
+	roleName := *input.RoleName
+
+	if _, err := s.getRole(accountID, roleName); err != nil {
+		return nil, err
+	}
+	profile, err := s.getInstanceProfile(accountID, profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	// An instance profile holds a single role, as on AWS.
+	if len(profile.Roles) > 0 {
+		return nil, errors.New(awserrors.ErrorIAMLimitExceeded)
+	}
+
+	profile.Roles = append(profile.Roles, roleName)
+	if err := s.putInstanceProfile(profile); err != nil {
+		return nil, err
+	}
+
+	slog.Info("IAM role added to instance profile", "accountID", accountID, "instanceProfileName", profileName, "roleName", roleName)
+	return &iam.AddRoleToInstanceProfileOutput{}, nil
+}
+
+func (s *IAMServiceImpl) RemoveRoleFromInstanceProfile(accountID string, input *iam.RemoveRoleFromInstanceProfileInput) (*iam.RemoveRoleFromInstanceProfileOutput, error) {
+	profileName := *input.InstanceProfileName
+	roleName := *input.RoleName
+
+	profile, err := s.getInstanceProfile(accountID, profileName)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(profile.Roles, roleName) {
+		return nil, errors.New(awserrors.ErrorIAMNoSuchEntity)
+	}
+
+	profile.Roles = slices.DeleteFunc(profile.Roles, func(name string) bool { return name == roleName })
+	if err := s.putInstanceProfile(profile); err != nil {
+		return nil, err
+	}
+
+	slog.Info("IAM role removed from instance profile", "accountID", accountID, "instanceProfileName", profileName, "roleName", roleName)
+	return &iam.RemoveRoleFromInstanceProfileOutput{}, nil
+}
+
+// ResolveInstanceProfile returns the instance profile named by ARN, or by
+// name within accountID, for launching instances with it.
+func (s *IAMServiceImpl) ResolveInstanceProfile(accountID, arn, name string) (*InstanceProfile, error) {
+	if arn != "" {
+		ownerID, profileName, ok := parseEntityARN(arn, "instance-profile")
+		if !ok {
+			return nil, errors.New(awserrors.ErrorInvalidIamInstanceProfileArnMalformed)
+		}
+		profile, err := s.getInstanceProfile(ownerID, profileName)
+		if err != nil {
+			return nil, err
+		}
+		if profile.ARN != arn {
+			return nil, errors.New(awserrors.ErrorIAMNoSuchEntity)
+		}
+		return profile, nil
+	}
+	return s.getInstanceProfile(accountID, name)
+}
+
+// ---------------------------------------------------------------------------
+// Helpers
+// ---------------------------------------------------------------------------
+
+func (s *IAMServiceImpl) getRole(accountID, roleName string) (*Role, error) {
+	entry, err := s.rolesBucket.Get(accountID + "." + roleName)
+	if err != nil {
+		if errors.Is(err, nats.ErrKeyNotFound) {
+			return nil, errors.New(awserrors.ErrorIAMNoSuchEntity)
+		}
+		return nil, fmt.Errorf("get role: %w", err)
+	}
+
+	var role Role
+	if err := json.Unmarshal(entry.Value(), &role); err != nil {
+		return nil, fmt.Errorf("unmarshal role: %w", err)
+	}
+	return &role, nil
+}
+
+func (s *IAMServiceImpl) putRole(role *Role) error {
+	data, err := json.Marshal(role)
+	if err != nil {
+		return fmt.Errorf("marshal role: %w", err)
+	}
+	if _, err := s.rolesBucket.Put(role.AccountID+"."+role.RoleName, data); err != nil {
+		return fmt.Errorf("update role: %w", err)
+	}
+	return nil
+}
+
+func (s *IAMServiceImpl) getInstanceProfile(accountID, profileName string) (*InstanceProfile, error) {
+	entry, err := s.profilesBucket.Get(accountID + "." + profileName)
+	if err != nil {
+		if errors.Is(err, nats.ErrKeyNotFound) {
+			return nil, errors.New(awserrors.ErrorIAMNoSuchEntity)
+		}
+		return nil, fmt.Errorf("get instance profile: %w", err)
+	}
+
+	var profile InstanceProfile
+	if err := json.Unmarshal(entry.Value(), &profile); err != nil {
+		return nil, fmt.Errorf("unmarshal instance profile: %w", err)
+	}
+	return &profile, nil
+}
+
+func (s *IAMServiceImpl) putInstanceProfile(profile *InstanceProfile) error {
+	data, err := json.Marshal(profile)
+	if err != nil {
+		return fmt.Errorf("marshal instance profile: %w", err)
+	}
+	if _, err := s.profilesBucket.Put(profile.AccountID+"."+profile.InstanceProfileName, data); err != nil {
+		return fmt.Errorf("update instance profile: %w", err)
+	}
+	return nil
+}
+
+// instanceProfileToIAM converts a stored instance profile to its API shape,
+// including the role it holds. A role deleted from under the profile is
+// left out.
+func (s *IAMServiceImpl) instanceProfileToIAM(profile *InstanceProfile) *iam.InstanceProfile {
+	roles := []*iam.Role{}
+	for _, roleName := range profile.Roles {
+		role, err := s.getRole(profile.AccountID, roleName)
+		if err != nil {
+			slog.Warn("instance profile role not found", "instanceProfileName", profile.InstanceProfileName, "roleName", roleName, "err", err)
+			continue
+		}
+		roles = append(roles, role.toIAM())
+	}
+	return &iam.InstanceProfile{
+		InstanceProfileName: aws.String(profile.InstanceProfileName),
+		InstanceProfileId:   aws.String(profile.InstanceProfileID),
+		Arn:                 aws.String(profile.ARN),
+		Path:                aws.String(profile.Path),
+		CreateDate:          aws.Time(parseCreatedAt(profile.CreatedAt)),
+		Roles:               roles,
+	}
+}
+
+func (role *Role) toIAM() *iam.Role {
+	out := &iam.Role{
+		RoleName:                 aws.String(role.RoleName),
+		RoleId:                   aws.String(role.RoleID),
+		Arn:                      aws.String(role.ARN),
+		Path:                     aws.String(role.Path),
+		AssumeRolePolicyDocument: aws.String(role.AssumeRolePolicyDocument),
+		MaxSessionDuration:       aws.Int64(role.MaxSessionDuration),
+		CreateDate:               aws.Time(parseCreatedAt(role.CreatedAt)),
+	}
+	if role.Description != "" {
+		out.Description = aws.String(role.Description)
+	}
+	return out
+}
+
+// listAccountEntries calls fn with every entry of bucket that belongs to
+// accountID. Entries deleted while listing are skipped.
+func listAccountEntries(bucket nats.KeyValue, accountID string, fn func(key string, value []byte)) error {
+	keys, err := bucket.Keys()
+	if err != nil {
+		if errors.Is(err, nats.ErrNoKeysFound) {
+			return nil
+		}
+		return err
+	}
+
+	keyPrefix := accountID + "."
+	for _, key := range keys {
+		if key == utils.VersionKey || !strings.HasPrefix(key, keyPrefix) {
+			continue
+		}
+		entry, err := bucket.Get(key)
+		if err != nil {
+			if !errors.Is(err, nats.ErrKeyNotFound) {
+				slog.Warn("listAccountEntries: failed to get entry", "key", key, "err", err)
+			}
+			continue
+		}
+		fn(key, entry.Value())
+	}
+	return nil
+}
+
+// parseEntityARN splits an IAM ARN such as
+// arn:aws:iam::123456789012:role/path/Name into its account ID and the
+// entity name, checking the resource type.
+func parseEntityARN(arn, resourceType string) (accountID, name string, ok bool) {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" || parts[2] != "iam" || parts[4] == "" {
+		return "", "", false
+	}
+	resource, found := strings.CutPrefix(parts[5], resourceType+"/")
+	if !found {
+		return "", "", false
+	}
+	name = resource[strings.LastIndex(resource, "/")+1:]
+	if name == "" {
+		return "", "", false
+	}
+	return parts[4], name, true
+}
+
+// ValidateTrustPolicyDocument parses and validates a role trust policy: every
+// statement must name a principal and allow or deny assuming the role.
+func ValidateTrustPolicyDocument(docJSON string) (*TrustPolicyDocument, error) {
+	if len(docJSON) > maxTrustPolicyDocumentSize {
+		return nil, fmt.Errorf("trust policy exceeds maximum size of %d bytes", maxTrustPolicyDocumentSize)
+	}
+
+	var doc TrustPolicyDocument
+	if err := json.Unmarshal([]byte(docJSON), &doc); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	if doc.Version != "2012-10-17" {
+		return nil, fmt.Errorf("unsupported policy version: %q", doc.Version)
+	}
+	if len(doc.Statement) == 0 {
+		return nil, fmt.Errorf("policy must contain at least one statement")
+	}
+
+	for i, stmt := range doc.Statement {
+		if stmt.Effect != PolicyEffectAllow && stmt.Effect != PolicyEffectDeny {
+			return nil, fmt.Errorf("statement %d: Effect must be Allow or Deny, got %q", i, stmt.Effect)
+		}
+		if len(stmt.Action) == 0 {
+			return nil, fmt.Errorf("statement %d: Action is required", i)
+		}
+		for _, action := range stmt.Action {
+			if !strings.HasPrefix(strings.ToLower(action), "sts:") {
+				return nil, fmt.Errorf("statement %d: trust policy action %q is not an STS action", i, action)
+			}
+		}
+		if len(stmt.Principal.AWS) == 0 && len(stmt.Principal.Service) == 0 {
+			return nil, fmt.Errorf("statement %d: Principal is required", i)
+		}
+	}
+
+	return &doc, nil
+}
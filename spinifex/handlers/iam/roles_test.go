@@ -0,0 +1,215 @@
+package handlers_iam
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const ec2TrustPolicy = `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole"}]}`
+
+func createTestRole(t *testing.T, svc *IAMServiceImpl, roleName, trustPolicy string) *iam.Role {
+	t.Helper()
+	out, err := svc.CreateRole(testAccountID, &iam.CreateRoleInput{
+		RoleName:                 aws.String(roleName),
+		AssumeRolePolicyDocument: aws.String(trustPolicy),
+	})
+	require.NoError(t, err)
+	return out.Role
+}
+
+func createTestInstanceProfile(t *testing.T, svc *IAMServiceImpl, profileName, roleName string) *iam.InstanceProfile {
+	t.Helper()
+	out, err := svc.CreateInstanceProfile(testAccountID, &iam.CreateInstanceProfileInput{
+		InstanceProfileName: aws.String(profileName),
+	})
+	require.NoError(t, err)
+	if roleName != "" {
+		_, err = svc.AddRoleToInstanceProfile(testAccountID, &iam.AddRoleToInstanceProfileInput{
+			InstanceProfileName: aws.String(profileName),
+			RoleName:            aws.String(roleName),
+		})
+		require.NoError(t, err)
+	}
+	return out.InstanceProfile
+}
+
+// ============================================================================
+// Role CRUD Tests
+// ============================================================================
+
+func TestCreateRole(t *testing.T) {
+	svc := setupTestIAMService(t)
+
+	role := createTestRole(t, svc, "app-role", ec2TrustPolicy)
+	assert.Equal(t, "app-role", *role.RoleName)
+	assert.Equal(t, "arn:aws:iam::"+testAccountID+":role/app-role", *role.Arn)
+	assert.Equal(t, "AROA", (*role.RoleId)[:4])
+	assert.Equal(t, int64(3600), *role.MaxSessionDuration)
+
+	got, err := svc.GetRole(testAccountID, &iam.GetRoleInput{RoleName: aws.String("app-role")})
+	require.NoError(t, err)
+	assert.Equal(t, *role.RoleId, *got.Role.RoleId)
+}
+
+func TestCreateRole_Duplicate(t *testing.T) {
+	svc := setupTestIAMService(t)
+	createTestRole(t, svc, "dup-role", ec2TrustPolicy)
+
+	_, err := svc.CreateRole(testAccountID, &iam.CreateRoleInput{
+		RoleName:                 aws.String("dup-role"),
+		AssumeRolePolicyDocument: aws.String(ec2TrustPolicy),
+	})
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorIAMEntityAlreadyExists, err.Error())
+}
+
+func TestCreateRole_InvalidTrustPolicy(t *testing.T) {
+	svc := setupTestIAMService(t)
+
+	for name, doc := range map[string]string{
+		"not json":     `{`,
+		"no principal": `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"sts:AssumeRole"}]}`,
+		"no action":    `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"}}]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := svc.CreateRole(testAccountID, &iam.CreateRoleInput{
+				RoleName:                 aws.String("bad-trust"),
+				AssumeRolePolicyDocument: aws.String(doc),
+			})
+			require.Error(t, err)
+			assert.Equal(t, awserrors.ErrorIAMMalformedPolicyDocument, err.Error())
+		})
+	}
+}
+
+func TestCreateRole_MaxSessionDurationOutOfRange(t *testing.T) {
+	svc := setupTestIAMService(t)
+
+	_, err := svc.CreateRole(testAccountID, &iam.CreateRoleInput{
+		RoleName:                 aws.String("long-role"),
+		AssumeRolePolicyDocument: aws.String(ec2TrustPolicy),
+		MaxSessionDuration:       aws.Int64(50000),
+	})
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorValidationError, err.Error())
+}
+
+func TestListRoles(t *testing.T) {
+	svc := setupTestIAMService(t)
+	createTestRole(t, svc, "role-a", ec2TrustPolicy)
+	createTestRole(t, svc, "role-b", ec2TrustPolicy)
+
+	out, err := svc.ListRoles(testAccountID, &iam.ListRolesInput{})
+	require.NoError(t, err)
+	assert.Len(t, out.Roles, 2)
+
+	other, err := svc.ListRoles("000000000002", &iam.ListRolesInput{})
+	require.NoError(t, err)
+	assert.Empty(t, other.Roles)
+}
+
+func TestDeleteRole_WithAttachedPolicy(t *testing.T) {
+	svc := setupTestIAMService(t)
+	createTestRole(t, svc, "attached-role", ec2TrustPolicy)
+
+	_, err := svc.CreatePolicy(testAccountID, &iam.CreatePolicyInput{
+		PolicyName:     aws.String("ReadOnly"),
+		PolicyDocument: aws.String(`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"ec2:Describe*","Resource":"*"}]}`),
+	})
+	require.NoError(t, err)
+	policyARN := "arn:aws:iam::" + testAccountID + ":policy/ReadOnly"
+	_, err = svc.AttachRolePolicy(testAccountID, &iam.AttachRolePolicyInput{
+		RoleName:  aws.String("attached-role"),
+		PolicyArn: aws.String(policyARN),
+	})
+	require.NoError(t, err)
+
+	docs, err := svc.GetRolePolicies(testAccountID, "attached-role")
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+
+	_, err = svc.DeleteRole(testAccountID, &iam.DeleteRoleInput{RoleName: aws.String("attached-role")})
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorIAMDeleteConflict, err.Error())
+
+	// The policy is in use by the role, so it cannot be deleted either.
+	_, err = svc.DeletePolicy(testAccountID, &iam.DeletePolicyInput{PolicyArn: aws.String(policyARN)})
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorIAMDeleteConflict, err.Error())
+
+	_, err = svc.DetachRolePolicy(testAccountID, &iam.DetachRolePolicyInput{
+		RoleName:  aws.String("attached-role"),
+		PolicyArn: aws.String(policyARN),
+	})
+	require.NoError(t, err)
+	_, err = svc.DeleteRole(testAccountID, &iam.DeleteRoleInput{RoleName: aws.String("attached-role")})
+	require.NoError(t, err)
+}
+
+// ============================================================================
+// Instance Profile Tests
+// ============================================================================
+
+func TestInstanceProfile_SingleRole(t *testing.T) {
+	svc := setupTestIAMService(t)
+	createTestRole(t, svc, "role-a", ec2TrustPolicy)
+	createTestRole(t, svc, "role-b", ec2TrustPolicy)
+	profile := createTestInstanceProfile(t, svc, "web", "role-a")
+	assert.Equal(t, "AIPA", (*profile.InstanceProfileId)[:4])
+
+	_, err := svc.AddRoleToInstanceProfile(testAccountID, &iam.AddRoleToInstanceProfileInput{
+		InstanceProfileName: aws.String("web"),
+		RoleName:            aws.String("role-b"),
+	})
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorIAMLimitExceeded, err.Error())
+
+	got, err := svc.GetInstanceProfile(testAccountID, &iam.GetInstanceProfileInput{InstanceProfileName: aws.String("web")})
+	require.NoError(t, err)
+	require.Len(t, got.InstanceProfile.Roles, 1)
+	assert.Equal(t, "role-a", *got.InstanceProfile.Roles[0].RoleName)
+}
+
+func TestDeleteRole_InInstanceProfile(t *testing.T) {
+	svc := setupTestIAMService(t)
+	createTestRole(t, svc, "profile-role", ec2TrustPolicy)
+	createTestInstanceProfile(t, svc, "web", "profile-role")
+
+	_, err := svc.DeleteRole(testAccountID, &iam.DeleteRoleInput{RoleName: aws.String("profile-role")})
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorIAMDeleteConflict, err.Error())
+
+	_, err = svc.RemoveRoleFromInstanceProfile(testAccountID, &iam.RemoveRoleFromInstanceProfileInput{
+		InstanceProfileName: aws.String("web"),
+		RoleName:            aws.String("profile-role"),
+	})
+	require.NoError(t, err)
+	_, err = svc.DeleteRole(testAccountID, &iam.DeleteRoleInput{RoleName: aws.String("profile-role")})
+	require.NoError(t, err)
+}
+
+func TestResolveInstanceProfile(t *testing.T) {
+	svc := setupTestIAMService(t)
+	profile := createTestInstanceProfile(t, svc, "web", "")
+
+	byName, err := svc.ResolveInstanceProfile(testAccountID, "", "web")
+	require.NoError(t, err)
+	assert.Equal(t, *profile.Arn, byName.ARN)
+
+	byARN, err := svc.ResolveInstanceProfile("000000000002", *profile.Arn, "")
+	require.NoError(t, err)
+	assert.Equal(t, testAccountID, byARN.AccountID)
+
+	_, err = svc.ResolveInstanceProfile(testAccountID, "arn:aws:iam::bad", "")
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorInvalidIamInstanceProfileArnMalformed, err.Error())
+
+	_, err = svc.ResolveInstanceProfile(testAccountID, "", "missing")
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorIAMNoSuchEntity, err.Error())
+}
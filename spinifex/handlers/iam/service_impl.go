@@ -27,12 +27,18 @@ const (
 	KVBucketPolicies       = "spinifex-iam-policies"
 	KVBucketAccounts       = "spinifex-accounts"
 	KVBucketAccountCounter = "spinifex-account-counter"
+	KVBucketRoles          = "spinifex-iam-roles"
+	KVBucketProfiles       = "spinifex-iam-instance-profiles"
+	KVBucketSessions       = "spinifex-iam-sessions"
 
 	KVBucketUsersVersion          = 1
 	KVBucketAccessKeysVersion     = 1
 	KVBucketPoliciesVersion       = 1
 	KVBucketAccountsVersion       = 1
 	KVBucketAccountCounterVersion = 1
+	KVBucketRolesVersion          = 1
+	KVBucketProfilesVersion       = 1
+	KVBucketSessionsVersion       = 1
 
 	maxAccessKeysPerUser = 2
 )
@@ -46,6 +52,9 @@ type IAMServiceImpl struct {
 	policiesBucket       nats.KeyValue
 	accountsBucket       nats.KeyValue
 	accountCounterBucket nats.KeyValue
+	rolesBucket          nats.KeyValue
+	profilesBucket       nats.KeyValue
+	sessionsBucket       nats.KeyValue
 	masterKey            []byte
 	decrypter            *Decrypter
 }
@@ -108,6 +117,32 @@ func NewIAMServiceImpl(natsConn *nats.Conn, masterKey []byte, clusterSize int) (
 		return nil, fmt.Errorf("migrate %s: %w", KVBucketAccountCounter, err)
 	}
 
+	rolesBucket, err := getOrCreateBucket(js, KVBucketRoles, 10, replicas)
+	if err != nil {
+		return nil, fmt.Errorf("init roles bucket: %w", err)
+	}
+	if err := migrate.DefaultRegistry.RunKV(KVBucketRoles, rolesBucket, KVBucketRolesVersion); err != nil {
+		return nil, fmt.Errorf("migrate %s: %w", KVBucketRoles, err)
+	}
+
+	profilesBucket, err := getOrCreateBucket(js, KVBucketProfiles, 10, replicas)
+	if err != nil {
+		return nil, fmt.Errorf("init instance profiles bucket: %w", err)
+	}
+	if err := migrate.DefaultRegistry.RunKV(KVBucketProfiles, profilesBucket, KVBucketProfilesVersion); err != nil {
+		return nil, fmt.Errorf("migrate %s: %w", KVBucketProfiles, err)
+	}
+
+	// Session credentials expire on their own; the bucket TTL only reclaims
+	// the records once no session can still be valid.
+	sessionsBucket, err := getOrCreateBucketTTL(js, KVBucketSessions, 1, replicas, maxSessionDuration)
+	if err != nil {
+		return nil, fmt.Errorf("init sessions bucket: %w", err)
+	}
+	if err := migrate.DefaultRegistry.RunKV(KVBucketSessions, sessionsBucket, KVBucketSessionsVersion); err != nil {
+		return nil, fmt.Errorf("migrate %s: %w", KVBucketSessions, err)
+	}
+
 	decrypter, err := NewDecrypter(masterKey)
 	if err != nil {
 		return nil, fmt.Errorf("init decrypter: %w", err)
@@ -118,6 +153,9 @@ func NewIAMServiceImpl(natsConn *nats.Conn, masterKey []byte, clusterSize int) (
 		"access_keys_bucket", KVBucketAccessKeys,
 		"policies_bucket", KVBucketPolicies,
 		"accounts_bucket", KVBucketAccounts,
+		"roles_bucket", KVBucketRoles,
+		"instance_profiles_bucket", KVBucketProfiles,
+		"sessions_bucket", KVBucketSessions,
 		"replicas", replicas)
 
 	return &IAMServiceImpl{
@@ -128,16 +166,26 @@ func NewIAMServiceImpl(natsConn *nats.Conn, masterKey []byte, clusterSize int) (
 		policiesBucket:       policiesBucket,
 		accountsBucket:       accountsBucket,
 		accountCounterBucket: accountCounterBucket,
+		rolesBucket:          rolesBucket,
+		profilesBucket:       profilesBucket,
+		sessionsBucket:       sessionsBucket,
 		masterKey:            masterKey,
 		decrypter:            decrypter,
 	}, nil
 }
 
 func getOrCreateBucket(js nats.JetStreamContext, name string, history uint8, replicas int) (nats.KeyValue, error) {
+	return getOrCreateBucketTTL(js, name, history, replicas, 0)
+}
+
+// getOrCreateBucketTTL is getOrCreateBucket for a bucket whose entries are
+// removed ttl after their last update. A zero ttl keeps entries forever.
+func getOrCreateBucketTTL(js nats.JetStreamContext, name string, history uint8, replicas int, ttl time.Duration) (nats.KeyValue, error) {
 	kv, err := js.CreateKeyValue(&nats.KeyValueConfig{
 		Bucket:   name,
 		History:  history,
 		Replicas: replicas,
+		TTL:      ttl,
 	})
 	if err != nil {
 		kv, err = js.KeyValue(name)
@@ -529,9 +577,13 @@ func (s *IAMServiceImpl) UpdateAccessKey(accountID string, input *iam.UpdateAcce
 // Auth (internal — used by SigV4 middleware and bootstrap)
 // ---------------------------------------------------------------------------
 
-// LookupAccessKey retrieves an access key by its ID. Returns the full record
-// including the encrypted secret, for use by the SigV4 middleware.
+// LookupAccessKey retrieves an access key by its ID, long-term or temporary.
+// Returns the full record including the encrypted secret, for use by the
+// SigV4 middleware.
 func (s *IAMServiceImpl) LookupAccessKey(accessKeyID string) (*AccessKey, error) {
+	if strings.HasPrefix(accessKeyID, SessionAccessKeyPrefix) {
+		return s.lookupSession(accessKeyID)
+	}
 	entry, err := s.accessKeysBucket.Get(accessKeyID)
 	if err != nil {
 		if errors.Is(err, nats.ErrKeyNotFound) {
@@ -744,7 +796,7 @@ func (s *IAMServiceImpl) seedAdminAccount(admin *AdminBootstrapData) error {
 			slog.Warn("Failed to marshal account creation event", "accountID", admin.AccountID, "error", err)
 			return nil
 		}
-		if err := s.natsConn.Publish("iam.account.created", evt); err != nil {
+		if err := s.natsConn.Publish(utils.Subject("iam.account.created"), evt); err != nil {
 			slog.Warn("Failed to publish account creation event for admin account", "accountID", admin.AccountID, "error", err)
 		}
 	}
@@ -841,7 +893,7 @@ func (s *IAMServiceImpl) CreateAccount(name string) (*Account, error) {
 		}{AccountID: accountID, AccountName: name})
 		if err != nil {
 			slog.Error("Failed to marshal account creation event", "accountID", accountID, "error", err)
-		} else if err := s.natsConn.Publish("iam.account.created", evt); err != nil {
+		} else if err := s.natsConn.Publish(utils.Subject("iam.account.created"), evt); err != nil {
 			slog.Error("Failed to publish account creation event", "accountID", accountID, "error", err)
 		}
 	}
@@ -1272,15 +1324,12 @@ func (s *IAMServiceImpl) getPolicyByARN(accountID, policyARN string) (*Policy, e
 	return &policy, nil
 }
 
-// buildAttachmentCounts fetches all users for the account once and returns a
-// map of policyARN -> number of users that have it attached. This avoids the
-// N+1 pattern of calling countPolicyAttachments per policy in ListPolicies.
+// buildAttachmentCounts fetches all users and roles for the account once and
+// returns a map of policyARN -> number of users and roles that have it
+// attached. This avoids the N+1 pattern of calling countPolicyAttachments per policy in ListPolicies.
 func (s *IAMServiceImpl) buildAttachmentCounts(accountID string) (map[string]int64, error) {
 	keys, err := s.usersBucket.Keys()
-	if err != nil {
-		if errors.Is(err, nats.ErrNoKeysFound) {
-			return nil, nil
-		}
+	if err != nil && !errors.Is(err, nats.ErrNoKeysFound) {
 		return nil, fmt.Errorf("build attachment counts: %w", err)
 	}
 
@@ -1312,16 +1361,28 @@ func (s *IAMServiceImpl) buildAttachmentCounts(accountID string) (map[string]int
 			counts[arn]++
 		}
 	}
+
+	err = listAccountEntries(s.rolesBucket, accountID, func(key string, value []byte) {
+		var role Role
+		if err := json.Unmarshal(value, &role); err != nil {
+			slog.Warn("buildAttachmentCounts: failed to unmarshal role", "key", key, "err", err)
+			return
+		}
+		for _, arn := range role.AttachedPolicies {
+			counts[arn]++
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("build attachment counts: %w", err)
+	}
 	return counts, nil
 }
 
-// countPolicyAttachments counts how many users in this account have this policy attached.
+// countPolicyAttachments counts how many users and roles in this account have
+// this policy attached.
 func (s *IAMServiceImpl) countPolicyAttachments(accountID, policyARN string) (int64, error) {
 	keys, err := s.usersBucket.Keys()
-	if err != nil {
-		if errors.Is(err, nats.ErrNoKeysFound) {
-			return 0, nil
-		}
+	if err != nil && !errors.Is(err, nats.ErrNoKeysFound) {
 		return 0, fmt.Errorf("count policy attachments: %w", err)
 	}
 
@@ -1353,6 +1414,20 @@ func (s *IAMServiceImpl) countPolicyAttachments(accountID, policyARN string) (in
 			count++
 		}
 	}
+
+	err = listAccountEntries(s.rolesBucket, accountID, func(key string, value []byte) {
+		var role Role
+		if err := json.Unmarshal(value, &role); err != nil {
+			slog.Warn("countPolicyAttachments: failed to unmarshal role", "key", key, "err", err)
+			return
+		}
+		if slices.Contains(role.AttachedPolicies, policyARN) {
+			count++
+		}
+	})
+	if err != nil {
+		return 0, fmt.Errorf("count policy attachments: %w", err)
+	}
 	return count, nil
 }
 
@@ -0,0 +1,360 @@
+package handlers_iam
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/mulgadc/spinifex/spinifex/admin"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+)
+
+// Session duration bounds, as on AWS. Instance profile credentials are
+// issued for a fixed period and refreshed by the metadata service well
+// before they expire.
+const (
+	minSessionDuration          = 15 * time.Minute
+	defaultSessionTokenDuration = 12 * time.Hour
+	maxSessionDuration          = 36 * time.Hour
+	instanceCredentialsDuration = 6 * time.Hour
+
+	// SessionAccessKeyPrefix starts the ID of every temporary access key.
+	SessionAccessKeyPrefix = "ASIA"
+)
+
+// GetSessionToken issues temporary credentials for an IAM user. Requests made
+// with them carry the user's permissions.
+func (s *IAMServiceImpl) GetSessionToken(accountID, userName string, input *sts.GetSessionTokenInput) (*sts.GetSessionTokenOutput, error) {
+	duration, err := sessionDuration(input.DurationSeconds, defaultSessionTokenDuration, maxSessionDuration)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := s.getUser(accountID, userName); err != nil {
+		return nil, err
+	}
+
+	creds, err := s.issueSession(AccessKey{UserName: userName, AccountID: accountID}, duration)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("STS session token issued", "accountID", accountID, "userName", userName, "accessKeyID", *creds.AccessKeyId)
+	return &sts.GetSessionTokenOutput{Credentials: creds}, nil
+}
+
+// AssumeRole issues temporary credentials for the role named by
+// input.RoleArn, which may belong to another account, if its trust policy
+// allows the caller: callerARN in account callerAccountID.
+func (s *IAMServiceImpl) AssumeRole(callerAccountID, callerARN string, input *sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error) {
+	sessionName := *input.RoleSessionName
+	if err := validateRoleSessionName(sessionName); err != nil {
+		return nil, errors.New(awserrors.ErrorValidationError)
+	}
+
+	ownerID, roleName, ok := parseEntityARN(*input.RoleArn, "role")
+	if !ok {
+		return nil, errors.New(awserrors.ErrorValidationError)
+	}
+	role, err := s.getRole(ownerID, roleName)
+	if err != nil {
+		// Unknown roles are indistinguishable from ones the caller may not
+		// assume, as on AWS.
+		if err.Error() == awserrors.ErrorIAMNoSuchEntity {
+			return nil, errors.New(awserrors.ErrorAccessDenied)
+		}
+		return nil, err
+	}
+	if role.ARN != *input.RoleArn {
+		return nil, errors.New(awserrors.ErrorAccessDenied)
+	}
+
+	trust, err := ValidateTrustPolicyDocument(role.AssumeRolePolicyDocument)
+	if err != nil {
+		return nil, fmt.Errorf("parse trust policy of role %s: %w", role.ARN, err)
+	}
+	if !trust.Allows(func(p Principal) bool { return p.matchesAWS(callerAccountID, callerARN) }) {
+		slog.Info("AssumeRole denied by trust policy", "roleArn", role.ARN, "caller", callerARN)
+		return nil, errors.New(awserrors.ErrorAccessDenied)
+	}
+
+	maxDuration := time.Duration(role.MaxSessionDuration) * time.Second
+	duration, err := sessionDuration(input.DurationSeconds, time.Hour, maxDuration)
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := s.issueSession(AccessKey{
+		AccountID:   role.AccountID,
+		RoleName:    role.RoleName,
+		SessionName: sessionName,
+	}, duration)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("STS role assumed", "roleArn", role.ARN, "caller", callerARN, "sessionName", sessionName, "accessKeyID", *creds.AccessKeyId)
+	return &sts.AssumeRoleOutput{
+		Credentials: creds,
+		AssumedRoleUser: &sts.AssumedRoleUser{
+			Arn:           aws.String(AssumedRoleARN(role.AccountID, role.RoleName, sessionName)),
+			AssumedRoleId: aws.String(role.RoleID + ":" + sessionName),
+		},
+	}, nil
+}
+
+// InstanceProfileCredentials issues credentials for the role of the instance
+// profile an instance was launched with. The role's trust policy must allow
+// the EC2 service to assume it.
+func (s *IAMServiceImpl) InstanceProfileCredentials(req *InstanceCredentialsRequest) (*InstanceCredentials, error) {
+	ownerID, profileName, ok := parseEntityARN(req.InstanceProfileArn, "instance-profile")
+	if !ok {
+		return nil, errors.New(awserrors.ErrorInvalidIamInstanceProfileArnMalformed)
+	}
+	profile, err := s.getInstanceProfile(ownerID, profileName)
+	if err != nil {
+		return nil, err
+	}
+	if len(profile.Roles) == 0 {
+		return nil, errors.New(awserrors.ErrorIAMNoSuchEntity)
+	}
+	role, err := s.getRole(ownerID, profile.Roles[0])
+	if err != nil {
+		return nil, err
+	}
+
+	trust, err := ValidateTrustPolicyDocument(role.AssumeRolePolicyDocument)
+	if err != nil {
+		return nil, fmt.Errorf("parse trust policy of role %s: %w", role.ARN, err)
+	}
+	if !trust.Allows(func(p Principal) bool { return p.matchesService(ec2ServicePrincipal) }) {
+		slog.Info("Instance profile role does not trust EC2", "roleArn", role.ARN, "instanceID", req.InstanceID)
+		return nil, errors.New(awserrors.ErrorAccessDenied)
+	}
+
+	creds, err := s.issueSession(AccessKey{
+		AccountID:   role.AccountID,
+		RoleName:    role.RoleName,
+		SessionName: req.InstanceID,
+	}, instanceCredentialsDuration)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Instance profile credentials issued", "instanceID", req.InstanceID, "roleArn", role.ARN, "accessKeyID", *creds.AccessKeyId)
+	return &InstanceCredentials{
+		RoleName:        role.RoleName,
+		AccessKeyID:     *creds.AccessKeyId,
+		SecretAccessKey: *creds.SecretAccessKey,
+		SessionToken:    *creds.SessionToken,
+		Expiration:      creds.Expiration.Format(time.RFC3339),
+	}, nil
+}
+
+// issueSession stores a temporary access key for the principal in template
+// and returns its credentials, the only time the secret and session token
+// are revealed.
+func (s *IAMServiceImpl) issueSession(template AccessKey, duration time.Duration) (*sts.Credentials, error) {
+	accessKeyID, err := generateSessionAccessKeyID()
+	if err != nil {
+		return nil, fmt.Errorf("generate access key ID: %w", err)
+	}
+	secretAccessKey, err := admin.GenerateAWSSecretKey()
+	if err != nil {
+		return nil, fmt.Errorf("generate secret key: %w", err)
+	}
+	sessionToken, err := generateSessionToken()
+	if err != nil {
+		return nil, fmt.Errorf("generate session token: %w", err)
+	}
+	encryptedSecret, err := EncryptSecret(secretAccessKey, s.masterKey)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt secret: %w", err)
+	}
+
+	now := time.Now().UTC()
+	expiration := now.Add(duration).Truncate(time.Second)
+
+	ak := template
+	ak.AccessKeyID = accessKeyID
+	ak.SecretAccessKey = encryptedSecret
+	ak.Status = AccessKeyStatusActive
+	ak.CreatedAt = now.Format(time.RFC3339)
+	ak.SessionTokenHash = HashSessionToken(sessionToken)
+	ak.Expiration = expiration.Format(time.RFC3339)
+
+	data, err := json.Marshal(ak)
+	if err != nil {
+		return nil, fmt.Errorf("marshal session: %w", err)
+	}
+	if _, err := s.sessionsBucket.Create(accessKeyID, data); err != nil {
+		return nil, fmt.Errorf("store session: %w", err)
+	}
+
+	return &sts.Credentials{
+		AccessKeyId:     aws.String(accessKeyID),
+		SecretAccessKey: aws.String(secretAccessKey),
+		SessionToken:    aws.String(sessionToken),
+		Expiration:      aws.Time(expiration),
+	}, nil
+}
+
+// lookupSession retrieves the temporary access key with the given ID.
+func (s *IAMServiceImpl) lookupSession(accessKeyID string) (*AccessKey, error) {
+	entry, err := s.sessionsBucket.Get(accessKeyID)
+	if err != nil {
+		if errors.Is(err, nats.ErrKeyNotFound) {
+			return nil, errors.New(awserrors.ErrorIAMNoSuchEntity)
+		}
+		return nil, fmt.Errorf("lookup session: %w", err)
+	}
+
+	var ak AccessKey
+	if err := json.Unmarshal(entry.Value(), &ak); err != nil {
+		return nil, fmt.Errorf("unmarshal session: %w", err)
+	}
+	return &ak, nil
+}
+
+// AssumedRoleARN returns the ARN of a role session, the identity requests
+// made with its credentials run as.
+func AssumedRoleARN(accountID, roleName, sessionName string) string {
+	return fmt.Sprintf("arn:aws:sts::%s:assumed-role/%s/%s", accountID, roleName, sessionName)
+}
+
+// Allows reports whether the trust policy lets a principal for which match
+// is true assume the role. An explicit Deny wins over any Allow.
+func (doc *TrustPolicyDocument) Allows(match func(Principal) bool) bool {
+	allowed := false
+	for _, stmt := range doc.Statement {
+		if !stmt.allowsAction("sts:AssumeRole") || !match(stmt.Principal) {
+			continue
+		}
+		if stmt.Effect == PolicyEffectDeny {
+			return false
+		}
+		allowed = true
+	}
+	return allowed
+}
+
+func (stmt *TrustStatement) allowsAction(action string) bool {
+	for _, a := range stmt.Action {
+		if strings.EqualFold(a, action) || strings.EqualFold(a, "sts:*") {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesAWS reports whether the principal names the caller: by its ARN, by
+// its account, or as any AWS principal.
+func (p Principal) matchesAWS(accountID, callerARN string) bool {
+	for _, entry := range p.AWS {
+		if entry == "*" || entry == accountID || entry == callerARN ||
+			entry == "arn:aws:iam::"+accountID+":root" {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Principal) matchesService(service string) bool {
+	for _, entry := range p.Service {
+		if entry == service {
+			return true
+		}
+	}
+	return false
+}
+
+// sessionDuration returns the DurationSeconds of a request, or def when it
+// is unset, failing with ValidationError outside [minSessionDuration, maxDur].
+func sessionDuration(seconds *int64, def, maxDur time.Duration) (time.Duration, error) {
+	if seconds == nil {
+		return min(def, maxDur), nil
+	}
+	d := time.Duration(*seconds) * time.Second
+	if d < minSessionDuration || d > maxDur {
+		return 0, errors.New(awserrors.ErrorValidationError)
+	}
+	return d, nil
+}
+
+func validateRoleSessionName(name string) error {
+	if len(name) < 2 || len(name) > 64 {
+		return fmt.Errorf("role session name must be between 2 and 64 characters")
+	}
+	for i := range len(name) {
+		if !isIAMNameChar(name[i]) {
+			return fmt.Errorf("role session name contains invalid character: %q", name[i])
+		}
+	}
+	return nil
+}
+
+func generateSessionAccessKeyID() (string, error) {
+	id, err := generateAccessKeyID()
+	if err != nil {
+		return "", err
+	}
+	return SessionAccessKeyPrefix + strings.TrimPrefix(id, "AKIA"), nil
+}
+
+func generateSessionToken() (string, error) {
+	b := make([]byte, 96)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("crypto/rand failure: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// InstanceCredentialsSubject is the NATS subject daemons request instance
+// profile credentials on, to serve them from the instance metadata service.
+const InstanceCredentialsSubject = "iam.InstanceCredentials"
+
+// SubscribeInstanceCredentials answers InstanceCredentialsRequests with the
+// credentials of the requested instance profile's role. Every gateway
+// subscribes in one queue group, so each request is answered once.
+func SubscribeInstanceCredentials(nc *nats.Conn, svc IAMService) (*nats.Subscription, error) {
+	return nc.QueueSubscribe(utils.Subject(InstanceCredentialsSubject), "spinifex-iam-workers", func(msg *nats.Msg) {
+		var req InstanceCredentialsRequest
+		if err := json.Unmarshal(msg.Data, &req); err != nil || req.InstanceProfileArn == "" {
+			respondInstanceCredentials(msg, utils.GenerateErrorPayload(awserrors.ErrorInvalidParameterValue))
+			return
+		}
+
+		creds, err := svc.InstanceProfileCredentials(&req)
+		if err != nil {
+			code := err.Error()
+			if _, known := awserrors.ErrorLookup[code]; !known {
+				slog.Error("Instance credentials request failed", "instanceID", req.InstanceID, "err", err)
+				code = awserrors.ErrorServerInternal
+			}
+			respondInstanceCredentials(msg, utils.GenerateErrorPayload(code))
+			return
+		}
+
+		data, err := json.Marshal(creds)
+		if err != nil {
+			respondInstanceCredentials(msg, utils.GenerateErrorPayload(awserrors.ErrorServerInternal))
+			return
+		}
+		respondInstanceCredentials(msg, data)
+	})
+}
+
+func respondInstanceCredentials(msg *nats.Msg, data []byte) {
+	if err := msg.Respond(data); err != nil {
+		slog.Error("Failed to respond to instance credentials request", "err", err)
+	}
+}
@@ -0,0 +1,208 @@
+package handlers_iam
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func accountTrustPolicy(accountID string) string {
+	return `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::` + accountID + `:root"},"Action":"sts:AssumeRole"}]}`
+}
+
+// ============================================================================
+// GetSessionToken Tests
+// ============================================================================
+
+func TestGetSessionToken(t *testing.T) {
+	svc := setupTestIAMService(t)
+	createTestUser(t, svc, "alice")
+
+	out, err := svc.GetSessionToken(testAccountID, "alice", &sts.GetSessionTokenInput{})
+	require.NoError(t, err)
+	creds := out.Credentials
+	assert.True(t, strings.HasPrefix(*creds.AccessKeyId, SessionAccessKeyPrefix))
+	assert.NotEmpty(t, *creds.SessionToken)
+	assert.WithinDuration(t, time.Now().Add(12*time.Hour), *creds.Expiration, time.Minute)
+
+	ak, err := svc.LookupAccessKey(*creds.AccessKeyId)
+	require.NoError(t, err)
+	assert.True(t, ak.Temporary())
+	assert.Equal(t, "alice", ak.UserName)
+	assert.Equal(t, HashSessionToken(*creds.SessionToken), ak.SessionTokenHash)
+	assert.NotEqual(t, *creds.SecretAccessKey, ak.SecretAccessKey, "secret must be stored encrypted")
+}
+
+func TestGetSessionToken_DurationOutOfRange(t *testing.T) {
+	svc := setupTestIAMService(t)
+	createTestUser(t, svc, "alice")
+
+	for _, seconds := range []int64{60, 200000} {
+		_, err := svc.GetSessionToken(testAccountID, "alice", &sts.GetSessionTokenInput{DurationSeconds: aws.Int64(seconds)})
+		require.Error(t, err)
+		assert.Equal(t, awserrors.ErrorValidationError, err.Error())
+	}
+}
+
+// ============================================================================
+// AssumeRole Tests
+// ============================================================================
+
+func TestAssumeRole(t *testing.T) {
+	svc := setupTestIAMService(t)
+	role := createTestRole(t, svc, "deployer", accountTrustPolicy(testAccountID))
+
+	out, err := svc.AssumeRole(testAccountID, "arn:aws:iam::"+testAccountID+":user/alice", &sts.AssumeRoleInput{
+		RoleArn:         role.Arn,
+		RoleSessionName: aws.String("ci-run"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "arn:aws:sts::"+testAccountID+":assumed-role/deployer/ci-run", *out.AssumedRoleUser.Arn)
+	assert.Equal(t, *role.RoleId+":ci-run", *out.AssumedRoleUser.AssumedRoleId)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), *out.Credentials.Expiration, time.Minute)
+
+	ak, err := svc.LookupAccessKey(*out.Credentials.AccessKeyId)
+	require.NoError(t, err)
+	assert.Equal(t, "deployer", ak.RoleName)
+	assert.Equal(t, "ci-run", ak.SessionName)
+	assert.Equal(t, testAccountID, ak.AccountID)
+}
+
+func TestAssumeRole_CrossAccount(t *testing.T) {
+	svc := setupTestIAMService(t)
+	const otherAccount = "000000000002"
+	role := createTestRole(t, svc, "shared", accountTrustPolicy(otherAccount))
+
+	_, err := svc.AssumeRole(otherAccount, "arn:aws:iam::"+otherAccount+":user/bob", &sts.AssumeRoleInput{
+		RoleArn:         role.Arn,
+		RoleSessionName: aws.String("bob"),
+	})
+	require.NoError(t, err)
+
+	// The role's own account is not trusted, only the other one.
+	_, err = svc.AssumeRole(testAccountID, "arn:aws:iam::"+testAccountID+":user/alice", &sts.AssumeRoleInput{
+		RoleArn:         role.Arn,
+		RoleSessionName: aws.String("alice"),
+	})
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorAccessDenied, err.Error())
+}
+
+func TestAssumeRole_Denied(t *testing.T) {
+	svc := setupTestIAMService(t)
+	role := createTestRole(t, svc, "ec2-only", ec2TrustPolicy)
+
+	tests := map[string]*sts.AssumeRoleInput{
+		"untrusted caller": {RoleArn: role.Arn, RoleSessionName: aws.String("session")},
+		"unknown role":     {RoleArn: aws.String("arn:aws:iam::" + testAccountID + ":role/missing"), RoleSessionName: aws.String("session")},
+	}
+	for name, input := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := svc.AssumeRole(testAccountID, "arn:aws:iam::"+testAccountID+":user/alice", input)
+			require.Error(t, err)
+			assert.Equal(t, awserrors.ErrorAccessDenied, err.Error())
+		})
+	}
+}
+
+func TestAssumeRole_DurationAboveRoleMaximum(t *testing.T) {
+	svc := setupTestIAMService(t)
+	role := createTestRole(t, svc, "short", accountTrustPolicy(testAccountID))
+
+	_, err := svc.AssumeRole(testAccountID, "arn:aws:iam::"+testAccountID+":user/alice", &sts.AssumeRoleInput{
+		RoleArn:         role.Arn,
+		RoleSessionName: aws.String("session"),
+		DurationSeconds: aws.Int64(7200),
+	})
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorValidationError, err.Error())
+}
+
+// ============================================================================
+// Instance Profile Credentials Tests
+// ============================================================================
+
+func TestInstanceProfileCredentials(t *testing.T) {
+	svc := setupTestIAMService(t)
+	createTestRole(t, svc, "web-role", ec2TrustPolicy)
+	profile := createTestInstanceProfile(t, svc, "web", "web-role")
+
+	creds, err := svc.InstanceProfileCredentials(&InstanceCredentialsRequest{
+		InstanceID:         "i-0123456789abcdef0",
+		InstanceProfileArn: *profile.Arn,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "web-role", creds.RoleName)
+	assert.True(t, strings.HasPrefix(creds.AccessKeyID, SessionAccessKeyPrefix))
+
+	ak, err := svc.LookupAccessKey(creds.AccessKeyID)
+	require.NoError(t, err)
+	assert.Equal(t, "i-0123456789abcdef0", ak.SessionName)
+}
+
+func TestInstanceProfileCredentials_RoleNotTrustingEC2(t *testing.T) {
+	svc := setupTestIAMService(t)
+	createTestRole(t, svc, "user-role", accountTrustPolicy(testAccountID))
+	profile := createTestInstanceProfile(t, svc, "web", "user-role")
+
+	_, err := svc.InstanceProfileCredentials(&InstanceCredentialsRequest{
+		InstanceID:         "i-0123456789abcdef0",
+		InstanceProfileArn: *profile.Arn,
+	})
+	require.Error(t, err)
+	assert.Equal(t, awserrors.ErrorAccessDenied, err.Error())
+}
+
+func TestSubscribeInstanceCredentials(t *testing.T) {
+	svc := setupTestIAMService(t)
+	createTestRole(t, svc, "web-role", ec2TrustPolicy)
+	profile := createTestInstanceProfile(t, svc, "web", "web-role")
+
+	sub, err := SubscribeInstanceCredentials(svc.natsConn, svc)
+	require.NoError(t, err)
+	defer func() { _ = sub.Unsubscribe() }()
+
+	creds, err := utils.NATSRequest[InstanceCredentials](svc.natsConn, InstanceCredentialsSubject,
+		InstanceCredentialsRequest{InstanceID: "i-0123456789abcdef0", InstanceProfileArn: *profile.Arn},
+		5*time.Second, testAccountID)
+	require.NoError(t, err)
+	assert.Equal(t, "web-role", creds.RoleName)
+
+	req, err := json.Marshal(InstanceCredentialsRequest{InstanceID: "i-1", InstanceProfileArn: "bogus"})
+	require.NoError(t, err)
+	msg, err := svc.natsConn.Request(utils.Subject(InstanceCredentialsSubject), req, 5*time.Second)
+	require.NoError(t, err)
+	assert.Contains(t, string(msg.Data), awserrors.ErrorInvalidIamInstanceProfileArnMalformed)
+}
+
+// ============================================================================
+// Trust Policy Tests
+// ============================================================================
+
+func TestPrincipal_UnmarshalWildcard(t *testing.T) {
+	var doc TrustPolicyDocument
+	require.NoError(t, json.Unmarshal([]byte(`{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":"*","Action":"sts:AssumeRole"}]}`), &doc))
+	require.Len(t, doc.Statement, 1)
+	assert.True(t, doc.Statement[0].Principal.matchesAWS("000000000009", "arn:aws:iam::000000000009:user/x"))
+}
+
+func TestTrustPolicy_DenyOverridesAllow(t *testing.T) {
+	doc, err := ValidateTrustPolicyDocument(`{"Version":"2012-10-17","Statement":[
+		{"Effect":"Allow","Principal":{"AWS":"*"},"Action":"sts:AssumeRole"},
+		{"Effect":"Deny","Principal":{"AWS":"arn:aws:iam::` + testAccountID + `:user/mallory"},"Action":"sts:AssumeRole"}]}`)
+	require.NoError(t, err)
+
+	allows := func(arn string) bool {
+		return doc.Allows(func(p Principal) bool { return p.matchesAWS(testAccountID, arn) })
+	}
+	assert.True(t, allows("arn:aws:iam::"+testAccountID+":user/alice"))
+	assert.False(t, allows("arn:aws:iam::"+testAccountID+":user/mallory"))
+}
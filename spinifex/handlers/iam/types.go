@@ -1,6 +1,9 @@
 package handlers_iam
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+)
 
 const (
 	AccessKeyStatusActive   = "Active"
@@ -36,6 +39,19 @@ type AccessKey struct {
 	AccountID       string `json:"account_id"`
 	Status          string `json:"status"` // Active or Inactive
 	CreatedAt       string `json:"created_at"`
+
+	// Temporary credentials issued by STS also carry the hash of their
+	// session token, which requests must present, and an expiry. RoleName
+	// and SessionName are set when a role was assumed; UserName is then empty.
+	SessionTokenHash string `json:"session_token_hash,omitempty"` // SHA-256, hex-encoded
+	Expiration       string `json:"expiration,omitempty"`         // RFC3339
+	RoleName         string `json:"role_name,omitempty"`
+	SessionName      string `json:"session_name,omitempty"`
+}
+
+// Temporary reports whether the key is a set of STS session credentials.
+func (ak *AccessKey) Temporary() bool {
+	return ak.SessionTokenHash != ""
 }
 
 // Tag represents a key-value tag on an IAM resource.
@@ -57,6 +73,53 @@ type Policy struct {
 	Tags           []Tag  `json:"tags"`
 }
 
+// Role represents an IAM role stored in JetStream KV. A role has no
+// long-term credentials: principals its trust policy names assume it through
+// STS, and instances through an instance profile, for temporary credentials
+// carrying the role's attached policies.
+type Role struct {
+	RoleName                 string   `json:"role_name"`
+	RoleID                   string   `json:"role_id"`
+	AccountID                string   `json:"account_id"`
+	ARN                      string   `json:"arn"`
+	Path                     string   `json:"path"`
+	Description              string   `json:"description,omitempty"`
+	AssumeRolePolicyDocument string   `json:"assume_role_policy_document"` // JSON string
+	MaxSessionDuration       int64    `json:"max_session_duration"`        // seconds
+	CreatedAt                string   `json:"created_at"`
+	Tags                     []Tag    `json:"tags"`
+	AttachedPolicies         []string `json:"attached_policies"` // policy ARNs
+}
+
+// InstanceProfile represents an IAM instance profile stored in JetStream KV.
+// It passes at most one role to the instances launched with it.
+type InstanceProfile struct {
+	InstanceProfileName string   `json:"instance_profile_name"`
+	InstanceProfileID   string   `json:"instance_profile_id"`
+	AccountID           string   `json:"account_id"`
+	ARN                 string   `json:"arn"`
+	Path                string   `json:"path"`
+	CreatedAt           string   `json:"created_at"`
+	Roles               []string `json:"roles"` // role names
+}
+
+// InstanceCredentials are the temporary credentials of the role behind an
+// instance's instance profile, as served by the instance metadata service.
+type InstanceCredentials struct {
+	RoleName        string `json:"role_name"`
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+	SessionToken    string `json:"session_token"`
+	Expiration      string `json:"expiration"` // RFC3339
+}
+
+// InstanceCredentialsRequest asks for the credentials of an instance's
+// instance profile role.
+type InstanceCredentialsRequest struct {
+	InstanceID         string `json:"instance_id"`
+	InstanceProfileArn string `json:"instance_profile_arn"`
+}
+
 // PolicyDocument is the parsed IAM policy JSON structure.
 type PolicyDocument struct {
 	Version   string      `json:"Version"`
@@ -71,6 +134,43 @@ type Statement struct {
 	Resource StringOrArr `json:"Resource"`
 }
 
+// TrustPolicyDocument is the parsed JSON of a role's trust policy, which
+// names the principals allowed to assume the role.
+type TrustPolicyDocument struct {
+	Version   string           `json:"Version"`
+	Statement []TrustStatement `json:"Statement"`
+}
+
+// TrustStatement is a single statement within a trust policy.
+type TrustStatement struct {
+	Sid       string      `json:"Sid,omitempty"`
+	Effect    string      `json:"Effect"`
+	Action    StringOrArr `json:"Action"`
+	Principal Principal   `json:"Principal"`
+}
+
+// Principal names who a trust statement applies to: AWS principals by ARN
+// or account ID, and AWS services such as ec2.amazonaws.com. The JSON
+// string "*" is read as every AWS principal.
+type Principal struct {
+	AWS     StringOrArr `json:"AWS,omitempty"`
+	Service StringOrArr `json:"Service,omitempty"`
+}
+
+// UnmarshalJSON implements custom unmarshaling for the "*" shorthand.
+func (p *Principal) UnmarshalJSON(data []byte) error {
+	var wildcard string
+	if err := json.Unmarshal(data, &wildcard); err == nil {
+		if wildcard != "*" {
+			return fmt.Errorf("invalid principal %q", wildcard)
+		}
+		*p = Principal{AWS: StringOrArr{"*"}}
+		return nil
+	}
+	type principal Principal
+	return json.Unmarshal(data, (*principal)(p))
+}
+
 // StringOrArr handles JSON fields that can be either a string or an array of strings.
 type StringOrArr []string
 
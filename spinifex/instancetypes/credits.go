@@ -0,0 +1,57 @@
+package instancetypes
+
+import "strings"
+
+// CPU credit modes of a burstable instance. In standard mode an instance
+// that has spent its credits is held to its baseline; in unlimited mode it
+// keeps bursting and runs up a surplus.
+const (
+	CPUCreditsStandard  = "standard"
+	CPUCreditsUnlimited = "unlimited"
+)
+
+// LaunchCreditsPerVCPU is the balance a burstable instance launches with
+// for each of its vCPUs, as AWS grants T2 instances.
+const LaunchCreditsPerVCPU = 30
+
+// burstableBaseline is the share of each vCPU a burstable size may use
+// indefinitely, as AWS publishes it for T3. An instance earns credits at
+// this rate: baseline × vCPUs × 60 credits an hour.
+var burstableBaseline = map[string]float64{
+	"nano":    0.05,
+	"micro":   0.10,
+	"small":   0.20,
+	"medium":  0.20,
+	"large":   0.30,
+	"xlarge":  0.40,
+	"2xlarge": 0.40,
+}
+
+// BaselineCPUUtilization returns the per-vCPU baseline of a burstable
+// instance type, and false for types that don't use CPU credits.
+func BaselineCPUUtilization(instanceType string) (float64, bool) {
+	family, size, ok := strings.Cut(instanceType, ".")
+	if !ok || !strings.HasPrefix(family, "t") {
+		return 0, false
+	}
+	baseline, ok := burstableBaseline[size]
+	return baseline, ok
+}
+
+// DefaultCPUCredits returns the credit mode a burstable type launches in
+// when none is requested: standard for t2, unlimited for later families.
+// It returns false for types that don't use CPU credits.
+func DefaultCPUCredits(instanceType string) (string, bool) {
+	if _, ok := BaselineCPUUtilization(instanceType); !ok {
+		return "", false
+	}
+	if strings.HasPrefix(instanceType, "t2.") {
+		return CPUCreditsStandard, true
+	}
+	return CPUCreditsUnlimited, true
+}
+
+// ValidCPUCredits reports whether mode is a CPU credit mode.
+func ValidCPUCredits(mode string) bool {
+	return mode == CPUCreditsStandard || mode == CPUCreditsUnlimited
+}
@@ -0,0 +1,67 @@
+package instancetypes
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// ebsLimits are the EBS-optimized bandwidth and IOPS figures for one size,
+// as AWS publishes them (bandwidth in Mbps).
+type ebsLimits struct {
+	baselineMbps, maximumMbps float64
+	baselineIOPS, maximumIOPS int64
+}
+
+// Every family shares one table per category: AWS's figures only vary a
+// little between generations, and the host disk is the real bottleneck here.
+var burstableEBSLimits = map[string]ebsLimits{
+	"nano":    {43, 2085, 250, 11800},
+	"micro":   {87, 2085, 500, 11800},
+	"small":   {174, 2085, 1000, 11800},
+	"medium":  {347, 2085, 2000, 11800},
+	"large":   {695, 2780, 4000, 15700},
+	"xlarge":  {695, 2780, 4000, 15700},
+	"2xlarge": {695, 2780, 4000, 15700},
+}
+
+var standardEBSLimits = map[string]ebsLimits{
+	"large":    {650, 4750, 3600, 18750},
+	"xlarge":   {1150, 4750, 6000, 18750},
+	"2xlarge":  {2300, 4750, 12000, 18750},
+	"4xlarge":  {4750, 4750, 18750, 18750},
+	"8xlarge":  {6800, 6800, 30000, 30000},
+	"12xlarge": {9500, 9500, 40000, 40000},
+	"16xlarge": {13600, 13600, 60000, 60000},
+	"24xlarge": {19000, 19000, 80000, 80000},
+}
+
+// ebsInfo returns the EbsInfo for a family and size. t2 predates
+// EBS-optimized instances and reports it as unsupported.
+func ebsInfo(family, size string) *ec2.EbsInfo {
+	if family == "t2" {
+		return &ec2.EbsInfo{EbsOptimizedSupport: aws.String(ec2.EbsOptimizedSupportUnsupported)}
+	}
+
+	table := standardEBSLimits
+	if strings.HasPrefix(family, "t") {
+		table = burstableEBSLimits
+	}
+	limits, ok := table[size]
+	if !ok {
+		return &ec2.EbsInfo{EbsOptimizedSupport: aws.String(ec2.EbsOptimizedSupportUnsupported)}
+	}
+
+	return &ec2.EbsInfo{
+		EbsOptimizedSupport: aws.String(ec2.EbsOptimizedSupportDefault),
+		EbsOptimizedInfo: &ec2.EbsOptimizedInfo{
+			BaselineBandwidthInMbps:  aws.Int64(int64(limits.baselineMbps)),
+			MaximumBandwidthInMbps:   aws.Int64(int64(limits.maximumMbps)),
+			BaselineThroughputInMBps: aws.Float64(limits.baselineMbps / 8),
+			MaximumThroughputInMBps:  aws.Float64(limits.maximumMbps / 8),
+			BaselineIops:             aws.Int64(limits.baselineIOPS),
+			MaximumIops:              aws.Int64(limits.maximumIOPS),
+		},
+	}
+}
@@ -51,6 +51,8 @@ func generateForGeneration(gen cpuGeneration, arch string) map[string]*ec2.Insta
 				Hypervisor:                    aws.String("kvm"),
 				SupportedVirtualizationTypes:  []*string{aws.String("hvm")},
 				SupportedRootDeviceTypes:      []*string{aws.String("ebs")},
+				EbsInfo:                       ebsInfo(def.name, size.suffix),
+				NetworkInfo:                   networkInfo(def.name, size.suffix),
 				PlacementGroupInfo: &ec2.PlacementGroupInfo{
 					SupportedStrategies: []*string{
 						aws.String("cluster"),
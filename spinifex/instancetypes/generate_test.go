@@ -366,3 +366,39 @@ func TestGenerateInstanceTypes_PlacementGroupInfo(t *testing.T) {
 		assert.True(t, strategies["spread"], "%s should support spread", name)
 	}
 }
+
+func TestGenerateInstanceTypes_EbsInfo(t *testing.T) {
+	types := generateForGeneration(genIntelSkylake, "x86_64")
+	for name, info := range types {
+		require.NotNil(t, info.EbsInfo, "%s should have EbsInfo", name)
+		assert.Equal(t, ec2.EbsOptimizedSupportDefault, *info.EbsInfo.EbsOptimizedSupport, name)
+		opt := info.EbsInfo.EbsOptimizedInfo
+		require.NotNil(t, opt, name)
+		assert.LessOrEqual(t, *opt.BaselineThroughputInMBps, *opt.MaximumThroughputInMBps, name)
+	}
+
+	m5 := types["m5.large"].EbsInfo.EbsOptimizedInfo
+	assert.Equal(t, int64(650), *m5.BaselineBandwidthInMbps)
+	assert.InDelta(t, 81.25, *m5.BaselineThroughputInMBps, 0.001)
+	assert.InDelta(t, 593.75, *m5.MaximumThroughputInMBps, 0.001)
+
+	t2 := generateForGeneration(genIntelBroadwell, "x86_64")["t2.micro"]
+	assert.Equal(t, ec2.EbsOptimizedSupportUnsupported, *t2.EbsInfo.EbsOptimizedSupport)
+	assert.Nil(t, t2.EbsInfo.EbsOptimizedInfo)
+}
+
+func TestGenerateInstanceTypes_NetworkInfo(t *testing.T) {
+	types := generateForGeneration(genIntelIceLake, "x86_64")
+	for name, info := range types {
+		require.NotNil(t, info.NetworkInfo, "%s should have NetworkInfo", name)
+	}
+
+	assert.Equal(t, "Up to 5 Gigabit", *types["t3.micro"].NetworkInfo.NetworkPerformance)
+	assert.Equal(t, "Up to 12.5 Gigabit", *types["m6i.large"].NetworkInfo.NetworkPerformance)
+	assert.Equal(t, "25 Gigabit", *types["c6i.16xlarge"].NetworkInfo.NetworkPerformance)
+
+	assert.False(t, DedicatedNetworking(types["t3.2xlarge"]))
+	assert.False(t, DedicatedNetworking(types["m6i.4xlarge"]))
+	assert.True(t, DedicatedNetworking(types["m6i.8xlarge"]))
+	assert.False(t, DedicatedNetworking(generateSystemTypes("x86_64")["sys.micro"]), "system types have no NetworkInfo")
+}
@@ -0,0 +1,58 @@
+package instancetypes
+
+import "strings"
+
+// Running instances of a hot-pluggable family can be resized to another
+// size of the same family: QEMU starts them with room for the family's
+// largest size, and the daemon plugs in vCPUs and memory as the size grows.
+// Burstable and previous-generation families, and the Graviton families
+// (QEMU cannot hot-plug vCPUs into arm64 guests), change size only while
+// stopped.
+
+// familyDef returns the definition of instanceType's family.
+func familyDef(instanceType string) (instanceFamilyDef, bool) {
+	family, _, ok := strings.Cut(instanceType, ".")
+	if !ok {
+		return instanceFamilyDef{}, false
+	}
+	for _, def := range instanceFamilyDefs {
+		if def.name == family {
+			return def, true
+		}
+	}
+	return instanceFamilyDef{}, false
+}
+
+// hotpluggable reports whether running instances of def can be resized.
+func (def instanceFamilyDef) hotpluggable() bool {
+	if !def.currentGen || strings.HasSuffix(def.name, "g") {
+		return false
+	}
+	switch def.name[0] {
+	case 'm', 'c', 'r':
+		return true
+	}
+	return false
+}
+
+// HotplugCeiling returns the vCPUs and memory, in MiB, of the largest size
+// a running instance of instanceType can be resized to. ok is false for
+// types that can only be resized while stopped.
+func HotplugCeiling(instanceType string) (vcpus int, memMiB int64, ok bool) {
+	def, found := familyDef(instanceType)
+	if !found || !def.hotpluggable() {
+		return 0, 0, false
+	}
+	for _, size := range def.sizes {
+		vcpus = max(vcpus, size.vcpus)
+		memMiB = max(memMiB, int64(size.memoryGB*1024))
+	}
+	return vcpus, memMiB, true
+}
+
+// SameFamily reports whether instance types a and b are sizes of one family.
+func SameFamily(a, b string) bool {
+	familyA, _, okA := strings.Cut(a, ".")
+	familyB, _, okB := strings.Cut(b, ".")
+	return okA && okB && familyA == familyB
+}
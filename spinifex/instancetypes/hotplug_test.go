@@ -0,0 +1,37 @@
+package instancetypes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHotplugCeiling(t *testing.T) {
+	for _, tc := range []struct {
+		instanceType string
+		vcpus        int
+		memMiB       int64
+		ok           bool
+	}{
+		{"m6i.large", 96, 384 * 1024, true},
+		{"c7a.xlarge", 96, 192 * 1024, true},
+		{"r5.2xlarge", 96, 768 * 1024, true},
+		{"t3.micro", 0, 0, false},
+		{"m4.large", 0, 0, false},
+		{"m7g.large", 0, 0, false},
+		{"sys.micro", 0, 0, false},
+		{"x9.large", 0, 0, false},
+		{"m6i", 0, 0, false},
+	} {
+		vcpus, memMiB, ok := HotplugCeiling(tc.instanceType)
+		assert.Equal(t, tc.ok, ok, tc.instanceType)
+		assert.Equal(t, tc.vcpus, vcpus, tc.instanceType)
+		assert.Equal(t, tc.memMiB, memMiB, tc.instanceType)
+	}
+}
+
+func TestSameFamily(t *testing.T) {
+	assert.True(t, SameFamily("m6i.large", "m6i.4xlarge"))
+	assert.False(t, SameFamily("m6i.large", "m6a.large"))
+	assert.False(t, SameFamily("m6i.large", "m6i"))
+}
@@ -0,0 +1,46 @@
+package instancetypes
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// Network performance as AWS publishes it for each size. Sizes quoted "Up
+// to" burst on a shared link; the rest have dedicated bandwidth, which the
+// daemon backs with an SR-IOV virtual function when the host has one free.
+const burstableNetworkPerformance = "Up to 5 Gigabit"
+
+var standardNetworkPerformance = map[string]string{
+	"large":    "Up to 12.5 Gigabit",
+	"xlarge":   "Up to 12.5 Gigabit",
+	"2xlarge":  "Up to 12.5 Gigabit",
+	"4xlarge":  "Up to 12.5 Gigabit",
+	"8xlarge":  "12.5 Gigabit",
+	"12xlarge": "18.75 Gigabit",
+	"16xlarge": "25 Gigabit",
+	"24xlarge": "37.5 Gigabit",
+}
+
+// networkInfo returns the NetworkInfo for a family and size.
+func networkInfo(family, size string) *ec2.NetworkInfo {
+	performance := burstableNetworkPerformance
+	if !strings.HasPrefix(family, "t") {
+		performance = standardNetworkPerformance[size]
+	}
+	if performance == "" {
+		return nil
+	}
+	return &ec2.NetworkInfo{NetworkPerformance: aws.String(performance)}
+}
+
+// DedicatedNetworking reports whether info's network bandwidth is dedicated
+// rather than burst on a shared link, so its instances may be given an
+// SR-IOV virtual function instead of a tap.
+func DedicatedNetworking(info *ec2.InstanceTypeInfo) bool {
+	if info == nil || info.NetworkInfo == nil || info.NetworkInfo.NetworkPerformance == nil {
+		return false
+	}
+	return !strings.HasPrefix(*info.NetworkInfo.NetworkPerformance, "Up to")
+}
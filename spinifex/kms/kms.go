@@ -0,0 +1,295 @@
+// Package kms is a minimal key store for EBS encryption. Each KMS key is 32
+// random bytes, and wraps the per-volume data keys that unlock LUKS volumes.
+// Keys are kept cluster-wide in a JetStream KV bucket, sealed with the
+// cluster's master key, so any node can unwrap any volume's data key. Data
+// keys are only stored wrapped.
+package kms
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/mulgadc/spinifex/spinifex/migrate"
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/nats-io/nats.go"
+)
+
+// DefaultKeyAlias names the key used when a volume asks for encryption
+// without a KmsKeyId. It is created on first use.
+const DefaultKeyAlias = "alias/aws/ebs"
+
+const (
+	// KVBucket holds the cluster's KMS keys, sealed with the master key.
+	KVBucket        = "spinifex-kms-keys"
+	KVBucketVersion = 1
+
+	keySize     = 32 // AES-256
+	dataKeySize = 32
+
+	keyPrefix = "key."
+	// defaultKeyEntry holds the ID of the key DefaultKeyAlias points at.
+	defaultKeyEntry = "alias.aws.ebs"
+	// defaultKeyFile is where key directories from before the KV store kept
+	// the default key's ID.
+	defaultKeyFile = "alias-aws-ebs"
+)
+
+// ErrKeyNotFound is returned for a KmsKeyId that names no key in the store.
+var ErrKeyNotFound = errors.New("kms key not found")
+
+var keyIDPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// Store holds KMS keys in a KV bucket, each sealed with the master key
+// under its key ID.
+type Store struct {
+	kv     nats.KeyValue
+	sealer cipher.AEAD
+}
+
+// NewStore returns a store keeping its keys in kv, sealed with masterKey.
+func NewStore(kv nats.KeyValue, masterKey []byte) (*Store, error) {
+	if len(masterKey) != keySize {
+		return nil, fmt.Errorf("master key must be %d bytes, got %d", keySize, len(masterKey))
+	}
+	sealer, err := newGCM(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{kv: kv, sealer: sealer}, nil
+}
+
+// OpenStore returns the cluster's key store, creating its bucket if needed.
+func OpenStore(js nats.JetStreamContext, masterKey []byte) (*Store, error) {
+	kv, err := utils.GetOrCreateKVBucket(js, KVBucket, 1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create KV bucket %s: %w", KVBucket, err)
+	}
+	if err := migrate.DefaultRegistry.RunKV(KVBucket, kv, KVBucketVersion); err != nil {
+		return nil, fmt.Errorf("migrate %s: %w", KVBucket, err)
+	}
+	return NewStore(kv, masterKey)
+}
+
+// KeyARN returns the ARN a key is reported under.
+func KeyARN(region, accountID, keyID string) string {
+	return fmt.Sprintf("arn:aws:kms:%s:%s:key/%s", region, accountID, keyID)
+}
+
+// ResolveKeyID maps a KmsKeyId - empty, DefaultKeyAlias, a key ID or a key
+// ARN - to the ID of a key in the store.
+func (s *Store) ResolveKeyID(kmsKeyID string) (string, error) {
+	switch {
+	case kmsKeyID == "" || kmsKeyID == DefaultKeyAlias:
+		return s.defaultKeyID()
+	case strings.HasPrefix(kmsKeyID, "arn:aws:kms:"):
+		_, keyID, ok := strings.Cut(kmsKeyID, ":key/")
+		if !ok {
+			return "", ErrKeyNotFound
+		}
+		kmsKeyID = keyID
+	}
+	if !keyIDPattern.MatchString(kmsKeyID) {
+		return "", ErrKeyNotFound
+	}
+	if _, err := s.kv.Get(keyPrefix + kmsKeyID); err != nil {
+		if errors.Is(err, nats.ErrKeyNotFound) {
+			return "", ErrKeyNotFound
+		}
+		return "", fmt.Errorf("read key: %w", err)
+	}
+	return kmsKeyID, nil
+}
+
+// CreateKey generates a new key and returns its ID.
+func (s *Store) CreateKey() (string, error) {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("generate key: %w", err)
+	}
+	keyID := uuid.NewString()
+	if err := s.putKey(keyID, key); err != nil {
+		return "", err
+	}
+	return keyID, nil
+}
+
+// GenerateDataKey returns a new data key in the clear and wrapped by keyID.
+func (s *Store) GenerateDataKey(keyID string) (plaintext []byte, wrapped string, err error) {
+	plaintext = make([]byte, dataKeySize)
+	if _, err := rand.Read(plaintext); err != nil {
+		return nil, "", fmt.Errorf("generate data key: %w", err)
+	}
+	gcm, err := s.cipher(keyID)
+	if err != nil {
+		return nil, "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, "", fmt.Errorf("generate nonce: %w", err)
+	}
+	sealed := gcm.Seal(nonce, nonce, plaintext, nil)
+	return plaintext, base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt unwraps a data key wrapped by keyID.
+func (s *Store) Decrypt(keyID, wrapped string) ([]byte, error) {
+	gcm, err := s.cipher(keyID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("base64 decode: %w", err)
+	}
+	if len(data) < gcm.NonceSize() {
+		return nil, fmt.Errorf("wrapped data key too short")
+	}
+	nonce, sealed := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key: %w", err)
+	}
+	return plaintext, nil
+}
+
+// ImportDir adds the keys of a key directory from before the KV store to
+// the store, along with its default key when the cluster has none yet, so
+// volumes encrypted under them can still be unwrapped on every node. Keys
+// already in the store are left as they are. A missing dir is not an error.
+func (s *Store) ImportDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("read key dir: %w", err)
+	}
+
+	for _, entry := range entries {
+		keyID, ok := strings.CutSuffix(entry.Name(), ".key")
+		if !ok || !keyIDPattern.MatchString(keyID) {
+			continue
+		}
+		key, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("read key %s: %w", keyID, err)
+		}
+		if len(key) != keySize {
+			slog.Warn("Skipping malformed KMS key file", "keyId", keyID, "bytes", len(key))
+			continue
+		}
+		err = s.putKey(keyID, key)
+		if errors.Is(err, nats.ErrKeyExists) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		slog.Info("Imported KMS key into the cluster key store", "keyId", keyID)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, defaultKeyFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("read default key: %w", err)
+	}
+	keyID := strings.TrimSpace(string(data))
+	if !keyIDPattern.MatchString(keyID) {
+		return nil
+	}
+	if _, err := s.kv.Create(defaultKeyEntry, []byte(keyID)); err != nil && !errors.Is(err, nats.ErrKeyExists) {
+		return fmt.Errorf("write default key alias: %w", err)
+	}
+	return nil
+}
+
+// defaultKeyID returns the key DefaultKeyAlias points at, creating it the
+// first time any node asks. Nodes racing to create it agree on whichever
+// alias was written first.
+func (s *Store) defaultKeyID() (string, error) {
+	entry, err := s.kv.Get(defaultKeyEntry)
+	if err == nil {
+		return string(entry.Value()), nil
+	}
+	if !errors.Is(err, nats.ErrKeyNotFound) {
+		return "", fmt.Errorf("read default key: %w", err)
+	}
+
+	keyID, err := s.CreateKey()
+	if err != nil {
+		return "", err
+	}
+	if _, err := s.kv.Create(defaultKeyEntry, []byte(keyID)); err != nil {
+		_ = s.kv.Delete(keyPrefix + keyID)
+		if !errors.Is(err, nats.ErrKeyExists) {
+			return "", fmt.Errorf("write default key alias: %w", err)
+		}
+		entry, err := s.kv.Get(defaultKeyEntry)
+		if err != nil {
+			return "", fmt.Errorf("read default key: %w", err)
+		}
+		return string(entry.Value()), nil
+	}
+	return keyID, nil
+}
+
+// putKey seals key with the master key and stores it under keyID. It
+// fails with nats.ErrKeyExists if the ID is taken.
+func (s *Store) putKey(keyID string, key []byte) error {
+	nonce := make([]byte, s.sealer.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("generate nonce: %w", err)
+	}
+	// The key ID is authenticated, so a sealed key can't be moved to
+	// another ID.
+	sealed := s.sealer.Seal(nonce, nonce, key, []byte(keyID))
+	if _, err := s.kv.Create(keyPrefix+keyID, sealed); err != nil {
+		if errors.Is(err, nats.ErrKeyExists) {
+			return err
+		}
+		return fmt.Errorf("write key: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) cipher(keyID string) (cipher.AEAD, error) {
+	if !keyIDPattern.MatchString(keyID) {
+		return nil, ErrKeyNotFound
+	}
+	entry, err := s.kv.Get(keyPrefix + keyID)
+	if errors.Is(err, nats.ErrKeyNotFound) {
+		return nil, ErrKeyNotFound
+	} else if err != nil {
+		return nil, fmt.Errorf("read key: %w", err)
+	}
+	sealed := entry.Value()
+	if len(sealed) < s.sealer.NonceSize() {
+		return nil, fmt.Errorf("key %s is malformed", keyID)
+	}
+	nonce, sealed := sealed[:s.sealer.NonceSize()], sealed[s.sealer.NonceSize():]
+	key, err := s.sealer.Open(nil, nonce, sealed, []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("unseal key %s: %w", keyID, err)
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("key %s must be %d bytes, got %d", keyID, keySize, len(key))
+	}
+	return newGCM(key)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,137 @@
+package kms
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mulgadc/spinifex/spinifex/testutil"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testMasterKey = bytes.Repeat([]byte{0x42}, keySize)
+
+// newTestStore returns a store on its own JetStream server.
+func newTestStore(t *testing.T) (*Store, nats.JetStreamContext) {
+	t.Helper()
+	_, _, js := testutil.StartTestJetStream(t)
+	store, err := OpenStore(js, testMasterKey)
+	require.NoError(t, err)
+	return store, js
+}
+
+func TestResolveKeyID(t *testing.T) {
+	store, js := newTestStore(t)
+
+	// The default key is created once and reused, by every node.
+	defaultID, err := store.ResolveKeyID("")
+	require.NoError(t, err)
+	again, err := store.ResolveKeyID(DefaultKeyAlias)
+	require.NoError(t, err)
+	assert.Equal(t, defaultID, again)
+
+	otherNode, err := OpenStore(js, testMasterKey)
+	require.NoError(t, err)
+	fromOther, err := otherNode.ResolveKeyID("")
+	require.NoError(t, err)
+	assert.Equal(t, defaultID, fromOther)
+
+	keyID, err := store.CreateKey()
+	require.NoError(t, err)
+	assert.NotEqual(t, defaultID, keyID)
+
+	for _, ref := range []string{keyID, KeyARN("ap-southeast-2", "123456789012", keyID)} {
+		got, err := otherNode.ResolveKeyID(ref)
+		require.NoError(t, err)
+		assert.Equal(t, keyID, got)
+	}
+
+	for _, ref := range []string{
+		"alias/other",
+		"00000000-0000-4000-8000-000000000000",
+		"arn:aws:kms:ap-southeast-2:123456789012:alias/other",
+		"../" + keyID,
+	} {
+		_, err := store.ResolveKeyID(ref)
+		assert.ErrorIs(t, err, ErrKeyNotFound, ref)
+	}
+}
+
+func TestDataKeyRoundTrip(t *testing.T) {
+	store, js := newTestStore(t)
+	keyID, err := store.CreateKey()
+	require.NoError(t, err)
+
+	// The key is stored sealed, never in the clear.
+	kv, err := js.KeyValue(KVBucket)
+	require.NoError(t, err)
+	entry, err := kv.Get(keyPrefix + keyID)
+	require.NoError(t, err)
+	assert.Greater(t, len(entry.Value()), keySize)
+
+	plaintext, wrapped, err := store.GenerateDataKey(keyID)
+	require.NoError(t, err)
+	assert.Len(t, plaintext, dataKeySize)
+	assert.NotContains(t, wrapped, string(plaintext))
+
+	// Another node unwraps it.
+	otherNode, err := OpenStore(js, testMasterKey)
+	require.NoError(t, err)
+	got, err := otherNode.Decrypt(keyID, wrapped)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext, got)
+
+	// Another key can't unwrap it.
+	otherID, err := store.CreateKey()
+	require.NoError(t, err)
+	_, err = store.Decrypt(otherID, wrapped)
+	assert.Error(t, err)
+
+	_, err = store.Decrypt("00000000-0000-4000-8000-000000000000", wrapped)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	// Nor can a cluster with a different master key.
+	foreign, err := OpenStore(js, bytes.Repeat([]byte{0x17}, keySize))
+	require.NoError(t, err)
+	_, err = foreign.Decrypt(keyID, wrapped)
+	assert.ErrorContains(t, err, "unseal key")
+}
+
+func TestNewStore_MasterKeySize(t *testing.T) {
+	_, err := NewStore(nil, []byte("short"))
+	assert.ErrorContains(t, err, "master key must be 32 bytes")
+}
+
+func TestImportDir(t *testing.T) {
+	store, _ := newTestStore(t)
+
+	// A key directory as nodes kept them before the KV store.
+	dir := t.TempDir()
+	const keyID = "0f8fad5b-d9cb-469f-a165-70867728950e"
+	key := bytes.Repeat([]byte{0x01}, keySize)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, keyID+".key"), key, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, defaultKeyFile), []byte(keyID), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "not-a-key.txt"), []byte("x"), 0600))
+
+	require.NoError(t, store.ImportDir(dir))
+	require.NoError(t, store.ImportDir(dir), "importing twice is a no-op")
+
+	got, err := store.ResolveKeyID("")
+	require.NoError(t, err)
+	assert.Equal(t, keyID, got)
+
+	// Data keys wrapped with the file key before still unwrap.
+	gcm, err := newGCM(key)
+	require.NoError(t, err)
+	nonce := make([]byte, gcm.NonceSize())
+	wrapped := gcm.Seal(nonce, nonce, []byte("data-key"), nil)
+	plaintext, err := store.Decrypt(keyID, base64.StdEncoding.EncodeToString(wrapped))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("data-key"), plaintext)
+
+	assert.NoError(t, store.ImportDir(filepath.Join(dir, "missing")))
+}
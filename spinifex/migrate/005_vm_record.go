@@ -0,0 +1,16 @@
+package migrate
+
+// RecordVM is the record kind of an instance as the daemon stores it in
+// JetStream: in a node's state, as a stopped instance, or as a terminated one.
+const RecordVM = "vm"
+
+func init() {
+	DefaultRegistry.RegisterRecord(RecordVM, RecordMigration{
+		FromVersion: 0,
+		ToVersion:   1,
+		Description: "Adopt instance records written before schema versioning",
+		// Records from before versioning have the version 1 layout; they only
+		// lack the version, which UpgradeRecord stamps.
+		Run: func(map[string]any) error { return nil },
+	})
+}
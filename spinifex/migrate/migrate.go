@@ -60,6 +60,7 @@ type Registry struct {
 	kvMigrations     map[string][]KVMigration
 	configMigrations map[string][]ConfigMigration
 	configTargets    map[string]configTarget
+	recordMigrations map[string][]RecordMigration
 }
 
 // DefaultRegistry is the global migration registry. Migrations self-register
@@ -72,6 +73,7 @@ func NewRegistry() *Registry {
 		kvMigrations:     make(map[string][]KVMigration),
 		configMigrations: make(map[string][]ConfigMigration),
 		configTargets:    make(map[string]configTarget),
+		recordMigrations: make(map[string][]RecordMigration),
 	}
 }
 
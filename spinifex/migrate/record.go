@@ -0,0 +1,105 @@
+package migrate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// RecordVersionField is the JSON field a versioned record keeps its schema
+// version in. Records written before versioning lack it, and are version 0.
+const RecordVersionField = "schema_version"
+
+// RecordMigration upgrades one stored record from one schema version to the
+// next. Run edits the record, decoded as a JSON object, in place; numbers
+// are json.Number so large integers survive.
+type RecordMigration struct {
+	FromVersion int
+	ToVersion   int
+	Description string
+	Run         func(record map[string]any) error
+}
+
+// RegisterRecord adds a migration for records of kind. Migrations are kept
+// sorted by FromVersion.
+func (r *Registry) RegisterRecord(kind string, m RecordMigration) {
+	r.recordMigrations[kind] = append(r.recordMigrations[kind], m)
+	sort.Slice(r.recordMigrations[kind], func(i, j int) bool {
+		return r.recordMigrations[kind][i].FromVersion < r.recordMigrations[kind][j].FromVersion
+	})
+}
+
+// UpgradeRecord upgrades data, a JSON record of kind, to targetVersion and
+// stamps targetVersion on it. Unlike a KV bucket migration nothing is
+// written back: callers upgrade records as they load them, and the record
+// is stored at the new version the next time it is written.
+//
+// A record already at targetVersion is returned as is. So is one from a
+// newer release, which this release decodes as it did before versioning,
+// ignoring the fields it doesn't know. Otherwise every version from the
+// record's to targetVersion needs a registered migration, including 0 to 1
+// for records written before versioning.
+func (r *Registry) UpgradeRecord(kind string, data []byte, targetVersion int) ([]byte, error) {
+	var record map[string]any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&record); err != nil {
+		return nil, fmt.Errorf("decode %s record: %w", kind, err)
+	}
+	if record == nil {
+		return nil, fmt.Errorf("decode %s record: not a JSON object", kind)
+	}
+
+	current, err := recordVersion(record)
+	if err != nil {
+		return nil, fmt.Errorf("%s record: %w", kind, err)
+	}
+	if current >= targetVersion {
+		return data, nil
+	}
+
+	expected := current
+	var pending []RecordMigration
+	for _, m := range r.recordMigrations[kind] {
+		if m.FromVersion < current || m.ToVersion > targetVersion {
+			continue
+		}
+		if m.FromVersion != expected {
+			return nil, fmt.Errorf("record migration chain gap for %s: expected from %d, got from %d", kind, expected, m.FromVersion)
+		}
+		pending = append(pending, m)
+		expected = m.ToVersion
+	}
+	if len(pending) == 0 {
+		return nil, fmt.Errorf("no record migrations registered for %s from version %d to %d", kind, current, targetVersion)
+	}
+	if expected != targetVersion {
+		return nil, fmt.Errorf("record migration chain for %s ends at version %d, target is %d", kind, expected, targetVersion)
+	}
+
+	for _, m := range pending {
+		if err := m.Run(record); err != nil {
+			return nil, fmt.Errorf("record migration %s %d→%d failed: %w", kind, m.FromVersion, m.ToVersion, err)
+		}
+		record[RecordVersionField] = m.ToVersion
+	}
+	return json.Marshal(record)
+}
+
+// recordVersion returns the schema version a decoded record was written at.
+func recordVersion(record map[string]any) (int, error) {
+	raw, ok := record[RecordVersionField]
+	if !ok || raw == nil {
+		return 0, nil
+	}
+	n, ok := raw.(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("%s is %T, not a number", RecordVersionField, raw)
+	}
+	v, err := n.Int64()
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid %s %s", RecordVersionField, n)
+	}
+	return int(v), nil
+}
@@ -0,0 +1,127 @@
+package migrate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpgradeRecord_ExecutesMigrationsInOrder(t *testing.T) {
+	r := NewRegistry()
+	var order []int
+	// Registered out of order; the registry sorts them
+	r.RegisterRecord("vm", RecordMigration{FromVersion: 1, ToVersion: 2, Run: func(rec map[string]any) error {
+		order = append(order, 1)
+		rec["state"] = strings.ToLower(rec["state"].(string))
+		return nil
+	}})
+	r.RegisterRecord("vm", RecordMigration{FromVersion: 0, ToVersion: 1, Run: func(rec map[string]any) error {
+		order = append(order, 0)
+		rec["state"] = rec["status"]
+		delete(rec, "status")
+		return nil
+	}})
+
+	out, err := r.UpgradeRecord("vm", []byte(`{"id":"i-0123","status":"RUNNING"}`), 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int{0, 1}, order)
+	assert.JSONEq(t, `{"id":"i-0123","state":"running","schema_version":2}`, string(out))
+
+	// Resumes from the record's version
+	order = nil
+	out, err = r.UpgradeRecord("vm", []byte(`{"state":"RUNNING","schema_version":1}`), 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1}, order)
+	assert.JSONEq(t, `{"state":"running","schema_version":2}`, string(out))
+}
+
+func TestUpgradeRecord_CurrentOrNewerUnchanged(t *testing.T) {
+	r := NewRegistry()
+	r.RegisterRecord("vm", RecordMigration{FromVersion: 0, ToVersion: 1, Run: func(map[string]any) error {
+		t.Fatal("migration ran on an up to date record")
+		return nil
+	}})
+
+	for _, data := range []string{
+		`{"id":"i-0123","schema_version":1}`,
+		`{"id":"i-0123","schema_version":2,"added_later":true}`,
+	} {
+		out, err := r.UpgradeRecord("vm", []byte(data), 1)
+		require.NoError(t, err)
+		assert.Equal(t, data, string(out))
+	}
+}
+
+func TestUpgradeRecord_KeepsIntegerPrecision(t *testing.T) {
+	r := NewRegistry()
+	r.RegisterRecord("vm", RecordMigration{FromVersion: 0, ToVersion: 1, Run: func(map[string]any) error { return nil }})
+
+	out, err := r.UpgradeRecord("vm", []byte(`{"size":9007199254740993}`), 1)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"size":9007199254740993,"schema_version":1}`, string(out))
+}
+
+func TestUpgradeRecord_Errors(t *testing.T) {
+	noop := func(map[string]any) error { return nil }
+
+	tests := []struct {
+		name       string
+		migrations []RecordMigration
+		data       string
+		wantErr    string
+	}{
+		{
+			name:    "none registered",
+			data:    `{}`,
+			wantErr: "no record migrations registered for vm from version 0 to 2",
+		},
+		{
+			name:       "gap",
+			migrations: []RecordMigration{{FromVersion: 1, ToVersion: 2, Run: noop}},
+			data:       `{}`,
+			wantErr:    "record migration chain gap for vm: expected from 0, got from 1",
+		},
+		{
+			name:       "chain short of target",
+			migrations: []RecordMigration{{FromVersion: 0, ToVersion: 1, Run: noop}},
+			data:       `{}`,
+			wantErr:    "record migration chain for vm ends at version 1, target is 2",
+		},
+		{
+			name: "migration fails",
+			migrations: []RecordMigration{{FromVersion: 0, ToVersion: 2, Run: func(map[string]any) error {
+				return errors.New("boom")
+			}}},
+			data:    `{}`,
+			wantErr: "record migration vm 0→2 failed: boom",
+		},
+		{
+			name:    "not an object",
+			data:    `[1]`,
+			wantErr: "decode vm record",
+		},
+		{
+			name:    "null",
+			data:    `null`,
+			wantErr: "decode vm record: not a JSON object",
+		},
+		{
+			name:    "bad version",
+			data:    `{"schema_version":"1"}`,
+			wantErr: "schema_version is string, not a number",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry()
+			for _, m := range tt.migrations {
+				r.RegisterRecord("vm", m)
+			}
+			_, err := r.UpgradeRecord("vm", []byte(tt.data), 2)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package objectstore
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// tmpDirName holds objects while they are written, so a reader never sees
+// a partial object. Bucket names can't start with a dot, so it can't clash.
+const tmpDirName = ".tmp"
+
+// FilesystemObjectStore implements ObjectStore on a local directory. Each
+// bucket is a subdirectory and each object a file at its key's path, so a
+// key can't be both an object and the prefix of another ("a" and "a/b").
+type FilesystemObjectStore struct {
+	dir string
+	// mu orders writes against deletes, which prune emptied directories
+	// a concurrent write may be about to use.
+	mu sync.Mutex
+}
+
+var _ ObjectStore = (*FilesystemObjectStore)(nil)
+
+// NewFilesystemObjectStore creates an ObjectStore in dir, creating it if needed.
+func NewFilesystemObjectStore(dir string) (*FilesystemObjectStore, error) {
+	if err := os.MkdirAll(filepath.Join(dir, tmpDirName), 0o750); err != nil {
+		return nil, fmt.Errorf("create object store directory: %w", err)
+	}
+	return &FilesystemObjectStore{dir: dir}, nil
+}
+
+// bucketPath returns the directory holding bucket.
+func (f *FilesystemObjectStore) bucketPath(bucket string) (string, error) {
+	if bucket == "" || strings.HasPrefix(bucket, ".") || strings.ContainsAny(bucket, `/\`) {
+		return "", fmt.Errorf("invalid bucket name %q", bucket)
+	}
+	return filepath.Join(f.dir, bucket), nil
+}
+
+// objectPath returns the file holding key. Keys are split on "/" and may not
+// have empty, "." or ".." segments, so every object stays inside its bucket.
+func (f *FilesystemObjectStore) objectPath(bucket, key string) (string, error) {
+	bucketDir, err := f.bucketPath(bucket)
+	if err != nil {
+		return "", err
+	}
+	segments := strings.Split(key, "/")
+	for _, segment := range segments {
+		if segment == "" || segment == "." || segment == ".." || strings.Contains(segment, `\`) {
+			return "", fmt.Errorf("invalid object key %q", key)
+		}
+	}
+	return filepath.Join(append([]string{bucketDir}, segments...)...), nil
+}
+
+func (f *FilesystemObjectStore) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	key := aws.StringValue(input.Key)
+	p, err := f.objectPath(aws.StringValue(input.Bucket), key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(p) //nolint:gosec // path is confined to the store directory by objectPath
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrInvalid) || isNotDirError(err) {
+			return nil, &NoSuchKeyError{Key: key}
+		}
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		_ = file.Close()
+		return nil, &NoSuchKeyError{Key: key}
+	}
+
+	return &s3.GetObjectOutput{
+		Body:          file,
+		ContentLength: aws.Int64(info.Size()),
+		LastModified:  aws.Time(info.ModTime()),
+	}, nil
+}
+
+func (f *FilesystemObjectStore) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	p, err := f.objectPath(aws.StringValue(input.Bucket), aws.StringValue(input.Key))
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Join(f.dir, tmpDirName), "put-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed into place
+	if input.Body != nil {
+		if _, err := io.Copy(tmp, input.Body); err != nil {
+			_ = tmp.Close()
+			return nil, err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return nil, err
+	}
+	return &s3.PutObjectOutput{}, nil
+}
+
+// DeleteObject removes an object, and any directories that leaves empty.
+// As in S3, deleting a missing object succeeds.
+func (f *FilesystemObjectStore) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	bucketDir, err := f.bucketPath(aws.StringValue(input.Bucket))
+	if err != nil {
+		return nil, err
+	}
+	p, err := f.objectPath(aws.StringValue(input.Bucket), aws.StringValue(input.Key))
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if info, err := os.Stat(p); err == nil && info.IsDir() {
+		return &s3.DeleteObjectOutput{}, nil
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) && !isNotDirError(err) {
+		return nil, err
+	}
+	for dir := filepath.Dir(p); dir != bucketDir; dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break // not empty
+		}
+	}
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+// ListObjectsV2 lists a bucket in key order. Like MemoryObjectStore it
+// returns every match in one page.
+func (f *FilesystemObjectStore) ListObjectsV2(input *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error) {
+	bucketDir, err := f.bucketPath(aws.StringValue(input.Bucket))
+	if err != nil {
+		return nil, err
+	}
+	prefix := aws.StringValue(input.Prefix)
+	delimiter := aws.StringValue(input.Delimiter)
+
+	var contents []*s3.Object
+	prefixes := make(map[string]bool)
+	err = filepath.WalkDir(bucketDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			// Skip directories that can't hold a match
+			rel, _ := filepath.Rel(bucketDir, p)
+			dirPrefix := filepath.ToSlash(rel) + "/"
+			if rel != "." && !strings.HasPrefix(dirPrefix, prefix) && !strings.HasPrefix(prefix, dirPrefix) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(bucketDir, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		if delimiter != "" {
+			if idx := strings.Index(key[len(prefix):], delimiter); idx >= 0 {
+				prefixes[key[:len(prefix)+idx+len(delimiter)]] = true
+				return nil
+			}
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		contents = append(contents, &s3.Object{
+			Key:          aws.String(key),
+			Size:         aws.Int64(info.Size()),
+			LastModified: aws.Time(info.ModTime()),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// WalkDir visits in lexical order of path segments, which differs from
+	// S3's key order when a name sorts below "/"
+	slices.SortFunc(contents, func(a, b *s3.Object) int { return strings.Compare(*a.Key, *b.Key) })
+	commonPrefixes := make([]*s3.CommonPrefix, 0, len(prefixes))
+	for _, p := range slices.Sorted(maps.Keys(prefixes)) {
+		commonPrefixes = append(commonPrefixes, &s3.CommonPrefix{Prefix: aws.String(p)})
+	}
+
+	return &s3.ListObjectsV2Output{
+		Contents:       contents,
+		CommonPrefixes: commonPrefixes,
+		Name:           input.Bucket,
+		Prefix:         input.Prefix,
+		KeyCount:       aws.Int64(int64(len(contents))),
+	}, nil
+}
+
+// isNotDirError reports whether err came from treating an object as a
+// directory, as looking up "a/b" does when "a" is an object.
+func isNotDirError(err error) bool {
+	return errors.Is(err, syscall.ENOTDIR)
+}
@@ -0,0 +1,213 @@
+package objectstore
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/mulgadc/spinifex/spinifex/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestObjectStoreConformance runs the same behaviour checks against every
+// local backend, so callers can swap one for another.
+func TestObjectStoreConformance(t *testing.T) {
+	backends := map[string]func(t *testing.T) ObjectStore{
+		"memory": func(t *testing.T) ObjectStore {
+			store, err := New(config.ObjectStoreConfig{Backend: "memory"})
+			require.NoError(t, err)
+			return store
+		},
+		"filesystem": func(t *testing.T) ObjectStore {
+			store, err := New(config.ObjectStoreConfig{Backend: "filesystem", Dir: t.TempDir()})
+			require.NoError(t, err)
+			return store
+		},
+	}
+
+	for name, newStore := range backends {
+		t.Run(name, func(t *testing.T) {
+			t.Run("PutGetOverwrite", func(t *testing.T) {
+				store := newStore(t)
+				put(t, store, "bucket", "a/b/c.json", "one")
+				put(t, store, "bucket", "a/b/c.json", "two")
+				assert.Equal(t, "two", get(t, store, "bucket", "a/b/c.json"))
+
+				out, err := store.GetObject(&s3.GetObjectInput{Bucket: aws.String("bucket"), Key: aws.String("a/b/c.json")})
+				require.NoError(t, err)
+				defer out.Body.Close()
+				assert.Equal(t, int64(3), aws.Int64Value(out.ContentLength))
+			})
+
+			t.Run("GetMissing", func(t *testing.T) {
+				store := newStore(t)
+				put(t, store, "bucket", "a/b", "x")
+				for _, key := range []string{"missing", "a", "a/b/c"} {
+					_, err := store.GetObject(&s3.GetObjectInput{Bucket: aws.String("bucket"), Key: aws.String(key)})
+					assert.True(t, IsNoSuchKeyError(err), "key %s: %v", key, err)
+				}
+				_, err := store.GetObject(&s3.GetObjectInput{Bucket: aws.String("other"), Key: aws.String("a/b")})
+				assert.True(t, IsNoSuchKeyError(err))
+			})
+
+			t.Run("Delete", func(t *testing.T) {
+				store := newStore(t)
+				put(t, store, "bucket", "a/b", "x")
+				_, err := store.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String("bucket"), Key: aws.String("a/b")})
+				require.NoError(t, err)
+				_, err = store.GetObject(&s3.GetObjectInput{Bucket: aws.String("bucket"), Key: aws.String("a/b")})
+				assert.True(t, IsNoSuchKeyError(err))
+
+				_, err = store.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String("bucket"), Key: aws.String("a/b")})
+				assert.NoError(t, err, "deleting a missing key succeeds")
+			})
+
+			t.Run("List", func(t *testing.T) {
+				store := newStore(t)
+				for _, key := range []string{"root.json", "images/ami-2.json", "images/ami-1.json", "images-old.json", "volumes/snapshots/snap-1.json"} {
+					put(t, store, "bucket", key, "{}")
+				}
+				put(t, store, "other", "images/ami-9.json", "{}")
+
+				out, err := store.ListObjectsV2(&s3.ListObjectsV2Input{Bucket: aws.String("bucket"), Prefix: aws.String("images")})
+				require.NoError(t, err)
+				assert.ElementsMatch(t, []string{"images-old.json", "images/ami-1.json", "images/ami-2.json"}, listedKeys(out))
+
+				out, err = store.ListObjectsV2(&s3.ListObjectsV2Input{Bucket: aws.String("bucket"), Delimiter: aws.String("/")})
+				require.NoError(t, err)
+				assert.ElementsMatch(t, []string{"images-old.json", "root.json"}, listedKeys(out))
+				assert.ElementsMatch(t, []string{"images/", "volumes/"}, listedPrefixes(out))
+
+				out, err = store.ListObjectsV2(&s3.ListObjectsV2Input{Bucket: aws.String("empty")})
+				require.NoError(t, err)
+				assert.Empty(t, out.Contents)
+			})
+		})
+	}
+}
+
+func TestFilesystemObjectStore_Layout(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFilesystemObjectStore(dir)
+	require.NoError(t, err)
+
+	put(t, store, "audit", "2026/10/17/events.json", "{}")
+	data, err := os.ReadFile(filepath.Join(dir, "audit", "2026", "10", "17", "events.json"))
+	require.NoError(t, err)
+	assert.Equal(t, "{}", string(data))
+
+	// Deleting the last object prunes the directories it leaves empty
+	_, err = store.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String("audit"), Key: aws.String("2026/10/17/events.json")})
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dir, "audit", "2026"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "audit"))
+	assert.NoError(t, err, "bucket directory is kept")
+
+	// Nothing is left behind in the staging directory
+	entries, err := os.ReadDir(filepath.Join(dir, tmpDirName))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestFilesystemObjectStore_ListOrder(t *testing.T) {
+	store, err := NewFilesystemObjectStore(t.TempDir())
+	require.NoError(t, err)
+
+	// "images-old.json" sorts before "images/..." as a key, though the
+	// images directory sorts first on disk
+	for _, key := range []string{"images/ami-2.json", "images/ami-1.json", "images-old.json"} {
+		put(t, store, "bucket", key, "{}")
+	}
+	out, err := store.ListObjectsV2(&s3.ListObjectsV2Input{Bucket: aws.String("bucket")})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"images-old.json", "images/ami-1.json", "images/ami-2.json"}, listedKeys(out))
+	assert.Equal(t, int64(3), aws.Int64Value(out.KeyCount))
+}
+
+func TestFilesystemObjectStore_RejectsEscapingPaths(t *testing.T) {
+	store, err := NewFilesystemObjectStore(t.TempDir())
+	require.NoError(t, err)
+
+	tests := []struct{ bucket, key string }{
+		{"", "key"},
+		{".tmp", "key"},
+		{"../etc", "key"},
+		{"a/b", "key"},
+		{"bucket", ""},
+		{"bucket", "../key"},
+		{"bucket", "a/../../key"},
+		{"bucket", "a//b"},
+		{"bucket", "/abs"},
+		{"bucket", "a/./b"},
+	}
+	for _, tt := range tests {
+		_, err := store.PutObject(&s3.PutObjectInput{Bucket: aws.String(tt.bucket), Key: aws.String(tt.key), Body: bytes.NewReader(nil)})
+		assert.Error(t, err, "bucket %q key %q", tt.bucket, tt.key)
+	}
+}
+
+func TestFilesystemObjectStore_ConcurrentAccess(t *testing.T) {
+	store, err := NewFilesystemObjectStore(t.TempDir())
+	require.NoError(t, err)
+
+	// Writers and deleters share parent directories, so a delete pruning a
+	// directory mustn't break a write into it
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			key := "shared/dir/" + string(rune('a'+i))
+			for range 10 {
+				if _, err := store.PutObject(&s3.PutObjectInput{Bucket: aws.String("bucket"), Key: aws.String(key), Body: bytes.NewReader([]byte("x"))}); err != nil {
+					t.Error(err)
+					return
+				}
+				if _, err := store.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String("bucket"), Key: aws.String(key)}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func put(t *testing.T, store ObjectStore, bucket, key, body string) {
+	t.Helper()
+	_, err := store.PutObject(&s3.PutObjectInput{Bucket: aws.String(bucket), Key: aws.String(key), Body: bytes.NewReader([]byte(body))})
+	require.NoError(t, err)
+}
+
+func get(t *testing.T, store ObjectStore, bucket, key string) string {
+	t.Helper()
+	out, err := store.GetObject(&s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	require.NoError(t, err)
+	defer out.Body.Close()
+	data, err := io.ReadAll(out.Body)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func listedKeys(out *s3.ListObjectsV2Output) []string {
+	keys := make([]string, 0, len(out.Contents))
+	for _, obj := range out.Contents {
+		keys = append(keys, aws.StringValue(obj.Key))
+	}
+	return keys
+}
+
+func listedPrefixes(out *s3.ListObjectsV2Output) []string {
+	prefixes := make([]string, 0, len(out.CommonPrefixes))
+	for _, p := range out.CommonPrefixes {
+		prefixes = append(prefixes, aws.StringValue(p.Prefix))
+	}
+	return prefixes
+}
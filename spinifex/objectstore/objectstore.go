@@ -9,6 +9,7 @@ import (
 	"io"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
@@ -58,13 +59,69 @@ func NewS3ObjectStoreFromConfig(host, region, accessKey, secretKey string) *S3Ob
 	sess := session.Must(session.NewSession(&aws.Config{
 		Endpoint:         aws.String(host),
 		Region:           aws.String(region),
-		Credentials:      credentials.NewStaticCredentials(accessKey, secretKey, ""),
+		Credentials:      credentials.NewCredentials(newRotatingProvider(accessKey, secretKey)),
 		S3ForcePathStyle: aws.Bool(true),
 	}))
 
 	return NewS3ObjectStore(s3.New(sess))
 }
 
+// credentialRotations maps the access key a store was created with to the
+// key pair that has since replaced it, so stores created before a config
+// reload sign with the rotated Predastore credentials without being rebuilt.
+var (
+	rotationMu          sync.RWMutex
+	credentialRotations = make(map[string]credentials.Value)
+	rotationGeneration  atomic.Uint64
+)
+
+// RotateCredentials makes every store created with oldAccessKey, or with a
+// key already rotated to it, sign with accessKey and secretKey from its next
+// request on.
+func RotateCredentials(oldAccessKey, accessKey, secretKey string) {
+	rotationMu.Lock()
+	defer rotationMu.Unlock()
+
+	v := credentials.Value{AccessKeyID: accessKey, SecretAccessKey: secretKey, ProviderName: rotatingProviderName}
+	for k, r := range credentialRotations {
+		if r.AccessKeyID == oldAccessKey {
+			credentialRotations[k] = v
+		}
+	}
+	credentialRotations[oldAccessKey] = v
+	rotationGeneration.Add(1)
+}
+
+const rotatingProviderName = "RotatingProvider"
+
+// rotatingProvider serves a store's original credentials until they are
+// rotated, and expires whenever any rotation happens so the SDK re-reads them.
+type rotatingProvider struct {
+	initial    credentials.Value
+	generation atomic.Uint64
+}
+
+func newRotatingProvider(accessKey, secretKey string) *rotatingProvider {
+	p := &rotatingProvider{initial: credentials.Value{AccessKeyID: accessKey, SecretAccessKey: secretKey, ProviderName: rotatingProviderName}}
+	p.generation.Store(rotationGeneration.Load())
+	return p
+}
+
+func (p *rotatingProvider) Retrieve() (credentials.Value, error) {
+	rotationMu.RLock()
+	defer rotationMu.RUnlock()
+
+	p.generation.Store(rotationGeneration.Load())
+	if v, ok := credentialRotations[p.initial.AccessKeyID]; ok {
+		return v, nil
+	}
+	return p.initial, nil
+}
+
+func (p *rotatingProvider) IsExpired() bool {
+	return p.generation.Load() != rotationGeneration.Load()
+}
+
 // S3ObjectStore wraps the AWS S3 client to implement ObjectStore
 type S3ObjectStore struct {
 	client *s3.S3
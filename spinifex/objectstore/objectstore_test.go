@@ -332,3 +332,31 @@ func TestIsNoSuchKeyError_WithWrappedError(t *testing.T) {
 // Test that the interface is properly defined
 var _ ObjectStore = (*MemoryObjectStore)(nil)
 var _ ObjectStore = (*S3ObjectStore)(nil)
+
+func TestRotateCredentials(t *testing.T) {
+	store := NewS3ObjectStoreFromConfig("https://127.0.0.1:8443", "ap-southeast-2", "rotate-a", "secret-a")
+	creds := store.client.Config.Credentials
+
+	v, err := creds.Get()
+	require.NoError(t, err)
+	assert.Equal(t, "rotate-a", v.AccessKeyID)
+	assert.Equal(t, "secret-a", v.SecretAccessKey)
+
+	RotateCredentials("rotate-a", "rotate-b", "secret-b")
+	v, err = creds.Get()
+	require.NoError(t, err)
+	assert.Equal(t, "rotate-b", v.AccessKeyID)
+	assert.Equal(t, "secret-b", v.SecretAccessKey)
+
+	// A second rotation follows the chain back to the original store.
+	RotateCredentials("rotate-b", "rotate-c", "secret-c")
+	v, err = creds.Get()
+	require.NoError(t, err)
+	assert.Equal(t, "rotate-c", v.AccessKeyID)
+
+	// Stores created with unrelated keys are untouched.
+	other := NewS3ObjectStoreFromConfig("https://127.0.0.1:8443", "ap-southeast-2", "rotate-other", "secret-other")
+	v, err = other.client.Config.Credentials.Get()
+	require.NoError(t, err)
+	assert.Equal(t, "rotate-other", v.AccessKeyID)
+}
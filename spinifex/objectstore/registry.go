@@ -0,0 +1,85 @@
+package objectstore
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/mulgadc/spinifex/spinifex/config"
+)
+
+// Factory creates an ObjectStore from its configuration.
+type Factory func(cfg config.ObjectStoreConfig) (ObjectStore, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+func init() {
+	Register("s3", newS3FromConfig)
+	Register("filesystem", newFilesystemFromConfig)
+	Register("memory", func(config.ObjectStoreConfig) (ObjectStore, error) {
+		return NewMemoryObjectStore(), nil
+	})
+}
+
+// Register makes a backend available to New under name. It panics if name
+// is empty or already registered, as two backends claiming one name is a
+// programming error.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if name == "" || factory == nil {
+		panic("objectstore: Register needs a name and a factory")
+	}
+	if _, dup := registry[name]; dup {
+		panic("objectstore: backend " + name + " registered twice")
+	}
+	registry[name] = factory
+}
+
+// Backends returns the names of the registered backends, sorted.
+func Backends() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// New creates a store with the backend cfg selects.
+func New(cfg config.ObjectStoreConfig) (ObjectStore, error) {
+	registryMu.RLock()
+	factory, ok := registry[cfg.Backend]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown object store backend %q (have %v)", cfg.Backend, Backends())
+	}
+
+	store, err := factory(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("object store backend %s: %w", cfg.Backend, err)
+	}
+	return store, nil
+}
+
+func newS3FromConfig(cfg config.ObjectStoreConfig) (ObjectStore, error) {
+	if cfg.Endpoint == "" {
+		return nil, errors.New("endpoint is required")
+	}
+	return NewS3ObjectStoreFromConfig(cfg.Endpoint, cfg.Region, cfg.AccessKey, cfg.SecretKey), nil
+}
+
+func newFilesystemFromConfig(cfg config.ObjectStoreConfig) (ObjectStore, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("dir is required")
+	}
+	return NewFilesystemObjectStore(cfg.Dir)
+}
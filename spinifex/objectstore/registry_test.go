@@ -0,0 +1,68 @@
+package objectstore
+
+import (
+	"testing"
+
+	"github.com/mulgadc/spinifex/spinifex/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew_BuiltinBackends(t *testing.T) {
+	assert.Subset(t, Backends(), []string{"filesystem", "memory", "s3"})
+
+	store, err := New(config.ObjectStoreConfig{Backend: "memory"})
+	require.NoError(t, err)
+	assert.IsType(t, &MemoryObjectStore{}, store)
+
+	store, err = New(config.ObjectStoreConfig{Backend: "filesystem", Dir: t.TempDir()})
+	require.NoError(t, err)
+	assert.IsType(t, &FilesystemObjectStore{}, store)
+
+	store, err = New(config.ObjectStoreConfig{Backend: "s3", Endpoint: "https://localhost:8443", Region: "ap-southeast-2"})
+	require.NoError(t, err)
+	assert.IsType(t, &S3ObjectStore{}, store)
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.ObjectStoreConfig
+		wantErr string
+	}{
+		{"no backend", config.ObjectStoreConfig{}, `unknown object store backend ""`},
+		{"unknown backend", config.ObjectStoreConfig{Backend: "gcs"}, `unknown object store backend "gcs"`},
+		{"filesystem without dir", config.ObjectStoreConfig{Backend: "filesystem"}, "dir is required"},
+		{"s3 without endpoint", config.ObjectStoreConfig{Backend: "s3"}, "endpoint is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.cfg)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	custom := NewMemoryObjectStore()
+	Register("test-custom", func(cfg config.ObjectStoreConfig) (ObjectStore, error) {
+		assert.Equal(t, "/data", cfg.Dir)
+		return custom, nil
+	})
+	t.Cleanup(func() {
+		registryMu.Lock()
+		delete(registry, "test-custom")
+		registryMu.Unlock()
+	})
+
+	store, err := New(config.ObjectStoreConfig{Backend: "test-custom", Dir: "/data"})
+	require.NoError(t, err)
+	assert.Same(t, custom, store)
+	assert.Contains(t, Backends(), "test-custom")
+
+	assert.Panics(t, func() {
+		Register("test-custom", func(config.ObjectStoreConfig) (ObjectStore, error) { return nil, nil })
+	})
+	assert.Panics(t, func() { Register("", nil) })
+}
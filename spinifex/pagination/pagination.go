@@ -0,0 +1,190 @@
+// Package pagination implements MaxResults/NextToken paging for Describe
+// actions. Results are ordered by resource ID and the NextToken is an opaque
+// cursor holding the ID of the last resource on the previous page, so a token
+// stays valid as resources are added or removed between calls.
+package pagination
+
+import (
+	"encoding/base64"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+)
+
+// tokenPrefix versions the cursor encoding so a token from elsewhere is
+// rejected rather than misread.
+const tokenPrefix = "v1:"
+
+// Limits bound the MaxResults an action accepts.
+type Limits struct {
+	Min, Max int64
+}
+
+// MaxResults ranges for the paginated Describe actions, as on AWS.
+var (
+	DescribeInstancesLimits     = Limits{Min: 5, Max: 1000}
+	DescribeVolumesLimits       = Limits{Min: 5, Max: 500}
+	DescribeImagesLimits        = Limits{Min: 6, Max: 1000}
+	DescribeInstanceTypesLimits = Limits{Min: 5, Max: 100}
+)
+
+// Page is a parsed MaxResults/NextToken pair. The zero Page is unpaginated.
+type Page struct {
+	// Limit is the most results to return, or 0 for no limit.
+	Limit int
+	// After is the resource ID the previous page ended at, or "" for the
+	// first page.
+	After string
+}
+
+// Parse validates maxResults against limits and decodes nextToken. It fails
+// with InvalidMaxResults or InvalidNextToken.
+func Parse(maxResults *int64, nextToken *string, limits Limits) (Page, error) {
+	var page Page
+	if maxResults != nil {
+		if *maxResults < limits.Min || *maxResults > limits.Max {
+			return Page{}, errors.New(awserrors.ErrorInvalidMaxResults)
+		}
+		page.Limit = int(*maxResults)
+	}
+	if token := aws.StringValue(nextToken); token != "" {
+		after, err := decodeToken(token)
+		if err != nil {
+			return Page{}, errors.New(awserrors.ErrorInvalidNextToken)
+		}
+		page.After = after
+	}
+	return page, nil
+}
+
+// Paginated reports whether the request asked for paging at all.
+func (p Page) Paginated() bool {
+	return p.Limit > 0 || p.After != ""
+}
+
+// EncodeToken returns the NextToken for a page ending at resource ID id.
+func EncodeToken(id string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(tokenPrefix + id))
+}
+
+func decodeToken(token string) (string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", err
+	}
+	id, ok := strings.CutPrefix(string(raw), tokenPrefix)
+	if !ok || id == "" {
+		return "", errors.New("malformed token")
+	}
+	return id, nil
+}
+
+// Apply returns the page of items after the cursor, ordered by id, and the
+// NextToken for the following page, nil on the last. Unpaginated requests
+// get items back unchanged.
+func Apply[T any](p Page, items []T, id func(T) string) ([]T, *string) {
+	if !p.Paginated() {
+		return items, nil
+	}
+	items = after(p, items, id)
+	if p.Limit == 0 || len(items) <= p.Limit {
+		return items, nil
+	}
+	items = items[:p.Limit]
+	return items, aws.String(EncodeToken(id(items[len(items)-1])))
+}
+
+// Prefetch returns what one node contributes to a page gathered from many:
+// the first Limit+1 items after the cursor, ordered by id. The extra item
+// lets the aggregating Apply tell whether another page follows.
+func Prefetch[T any](p Page, items []T, id func(T) string) []T {
+	if !p.Paginated() {
+		return items
+	}
+	items = after(p, items, id)
+	if p.Limit > 0 && len(items) > p.Limit+1 {
+		items = items[:p.Limit+1]
+	}
+	return items
+}
+
+// after sorts a copy of items by id and drops those up to the cursor.
+func after[T any](p Page, items []T, id func(T) string) []T {
+	sorted := slices.Clone(items)
+	slices.SortStableFunc(sorted, func(a, b T) int { return strings.Compare(id(a), id(b)) })
+	start, _ := slices.BinarySearchFunc(sorted, p.After, func(item T, target string) int {
+		if c := strings.Compare(id(item), target); c != 0 {
+			return c
+		}
+		return -1 // land after every item equal to the cursor
+	})
+	return sorted[start:]
+}
+
+// reservedInstance is an instance paired with the reservation it belongs to.
+type reservedInstance struct {
+	reservation *ec2.Reservation
+	instance    *ec2.Instance
+}
+
+func reservedInstanceID(ri reservedInstance) string {
+	return aws.StringValue(ri.instance.InstanceId)
+}
+
+// ApplyReservations pages reservations by the instances in them, as
+// DescribeInstances counts MaxResults in instances. A reservation whose
+// instances straddle a page boundary appears on both pages with the
+// instances on each.
+func ApplyReservations(p Page, reservations []*ec2.Reservation) ([]*ec2.Reservation, *string) {
+	if !p.Paginated() {
+		return reservations, nil
+	}
+	page, next := Apply(p, flattenReservations(reservations), reservedInstanceID)
+	return regroupReservations(page), next
+}
+
+// PrefetchReservations is Prefetch for reservations, counting instances.
+func PrefetchReservations(p Page, reservations []*ec2.Reservation) []*ec2.Reservation {
+	if !p.Paginated() {
+		return reservations
+	}
+	return regroupReservations(Prefetch(p, flattenReservations(reservations), reservedInstanceID))
+}
+
+func flattenReservations(reservations []*ec2.Reservation) []reservedInstance {
+	var flat []reservedInstance
+	for _, reservation := range reservations {
+		if reservation == nil {
+			continue
+		}
+		for _, instance := range reservation.Instances {
+			if instance != nil {
+				flat = append(flat, reservedInstance{reservation: reservation, instance: instance})
+			}
+		}
+	}
+	return flat
+}
+
+// regroupReservations rebuilds reservations holding just the given
+// instances, in the order each reservation's first instance appears.
+func regroupReservations(flat []reservedInstance) []*ec2.Reservation {
+	reservations := []*ec2.Reservation{}
+	byReservation := make(map[*ec2.Reservation]*ec2.Reservation)
+	for _, ri := range flat {
+		out, ok := byReservation[ri.reservation]
+		if !ok {
+			copied := *ri.reservation
+			copied.Instances = nil
+			out = &copied
+			byReservation[ri.reservation] = out
+			reservations = append(reservations, out)
+		}
+		out.Instances = append(out.Instances, ri.instance)
+	}
+	return reservations
+}
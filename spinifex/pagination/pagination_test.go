@@ -0,0 +1,158 @@
+package pagination
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func identity(s string) string { return s }
+
+func TestParse(t *testing.T) {
+	limits := Limits{Min: 5, Max: 10}
+
+	tests := []struct {
+		name       string
+		maxResults *int64
+		nextToken  *string
+		want       Page
+		err        string
+	}{
+		{name: "Unpaginated"},
+		{name: "EmptyToken", nextToken: aws.String("")},
+		{name: "Min", maxResults: aws.Int64(5), want: Page{Limit: 5}},
+		{name: "Max", maxResults: aws.Int64(10), want: Page{Limit: 10}},
+		{name: "BelowMin", maxResults: aws.Int64(4), err: awserrors.ErrorInvalidMaxResults},
+		{name: "AboveMax", maxResults: aws.Int64(11), err: awserrors.ErrorInvalidMaxResults},
+		{name: "Token", maxResults: aws.Int64(5), nextToken: aws.String(EncodeToken("i-abc")), want: Page{Limit: 5, After: "i-abc"}},
+		{name: "TokenWithoutMaxResults", nextToken: aws.String(EncodeToken("vol-1")), want: Page{After: "vol-1"}},
+		{name: "GarbageToken", nextToken: aws.String("not a token!"), err: awserrors.ErrorInvalidNextToken},
+		{name: "UnversionedToken", nextToken: aws.String("aS1hYmM"), err: awserrors.ErrorInvalidNextToken},
+		{name: "EmptyCursor", nextToken: aws.String(EncodeToken("")), err: awserrors.ErrorInvalidNextToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := Parse(tt.maxResults, tt.nextToken, limits)
+			if tt.err != "" {
+				require.Error(t, err)
+				assert.Equal(t, tt.err, err.Error())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, page)
+		})
+	}
+}
+
+func TestApply_Unpaginated(t *testing.T) {
+	items := []string{"c", "a", "b"}
+	page, next := Apply(Page{}, items, identity)
+	assert.Equal(t, []string{"c", "a", "b"}, page, "order is kept when not paginating")
+	assert.Nil(t, next)
+}
+
+func TestApply_WalksAllPages(t *testing.T) {
+	var items []string
+	for i := 11; i >= 0; i-- {
+		items = append(items, fmt.Sprintf("vol-%02d", i))
+	}
+
+	var seen []string
+	var token *string
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 5, "pagination did not terminate")
+		page, err := Parse(aws.Int64(5), token, Limits{Min: 5, Max: 5})
+		require.NoError(t, err)
+
+		var got []string
+		got, token = Apply(page, items, identity)
+		assert.LessOrEqual(t, len(got), 5)
+		seen = append(seen, got...)
+		if token == nil {
+			break
+		}
+	}
+
+	assert.Len(t, seen, 12)
+	assert.IsIncreasing(t, seen)
+	assert.Equal(t, "vol-00", seen[0])
+}
+
+func TestApply_ExactFitHasNoNextToken(t *testing.T) {
+	page, next := Apply(Page{Limit: 3}, []string{"b", "c", "a"}, identity)
+	assert.Equal(t, []string{"a", "b", "c"}, page)
+	assert.Nil(t, next)
+}
+
+func TestApply_CursorOnRemovedItem(t *testing.T) {
+	// The resource the previous page ended at was deleted since.
+	page, next := Apply(Page{Limit: 2, After: "b"}, []string{"a", "c", "d", "e"}, identity)
+	assert.Equal(t, []string{"c", "d"}, page)
+	require.NotNil(t, next)
+	assert.Equal(t, EncodeToken("d"), *next)
+}
+
+func TestPrefetch(t *testing.T) {
+	items := []string{"e", "a", "d", "b", "c"}
+	assert.Equal(t, []string{"b", "c", "d"}, Prefetch(Page{Limit: 2, After: "a"}, items, identity))
+	assert.Equal(t, items, Prefetch(Page{}, items, identity))
+}
+
+func TestPrefetch_MergedAcrossNodes(t *testing.T) {
+	// Each node sends its share; the page cut from the merge matches paging
+	// the union directly.
+	nodes := [][]string{{"a", "d", "g", "h"}, {"b", "c"}, {"e", "f", "i"}}
+	p := Page{Limit: 3, After: "b"}
+
+	var merged, union []string
+	for _, node := range nodes {
+		merged = append(merged, Prefetch(p, node, identity)...)
+		union = append(union, node...)
+	}
+
+	gotPage, gotNext := Apply(p, merged, identity)
+	wantPage, wantNext := Apply(p, union, identity)
+	assert.Equal(t, wantPage, gotPage)
+	assert.Equal(t, wantNext, gotNext)
+}
+
+func TestApplyReservations(t *testing.T) {
+	instances := func(ids ...string) []*ec2.Instance {
+		var out []*ec2.Instance
+		for _, id := range ids {
+			out = append(out, &ec2.Instance{InstanceId: aws.String(id)})
+		}
+		return out
+	}
+	reservations := []*ec2.Reservation{
+		{ReservationId: aws.String("r-2"), OwnerId: aws.String("000000000000"), Instances: instances("i-04", "i-02")},
+		{ReservationId: aws.String("r-1"), Instances: instances("i-03", "i-01", "i-05")},
+	}
+
+	page, next := ApplyReservations(Page{Limit: 3}, reservations)
+	require.NotNil(t, next)
+	require.Len(t, page, 2)
+	assert.Equal(t, "r-1", aws.StringValue(page[0].ReservationId))
+	assert.Equal(t, []*ec2.Instance{reservations[1].Instances[1], reservations[1].Instances[0]}, page[0].Instances)
+	assert.Equal(t, "r-2", aws.StringValue(page[1].ReservationId))
+	assert.Equal(t, "000000000000", aws.StringValue(page[1].OwnerId))
+	assert.Equal(t, []*ec2.Instance{reservations[0].Instances[1]}, page[1].Instances)
+
+	// The inputs are left intact.
+	assert.Len(t, reservations[0].Instances, 2)
+
+	after, err := Parse(nil, next, Limits{})
+	require.NoError(t, err)
+	page, next = ApplyReservations(Page{Limit: 3, After: after.After}, reservations)
+	assert.Nil(t, next)
+	require.Len(t, page, 2)
+	assert.Equal(t, "r-2", aws.StringValue(page[0].ReservationId))
+	assert.Equal(t, "i-04", aws.StringValue(page[0].Instances[0].InstanceId))
+	assert.Equal(t, "r-1", aws.StringValue(page[1].ReservationId))
+	assert.Equal(t, "i-05", aws.StringValue(page[1].Instances[0].InstanceId))
+}
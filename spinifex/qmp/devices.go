@@ -0,0 +1,98 @@
+package qmp
+
+import "maps"
+
+// Commands that hot-plug and unplug guest devices. Each returns the command
+// for the daemon to send with its usual QMP error handling.
+
+// NetdevAdd returns the netdev_add command that opens the host tap device
+// ifname as netdev id. QEMU runs no ifup or ifdown script: the daemon sets
+// the tap up on the bridge before the netdev is added.
+func NetdevAdd(id, ifname string) QMPCommand {
+	return QMPCommand{
+		Execute: "netdev_add",
+		Arguments: map[string]any{
+			"type":       "tap",
+			"id":         id,
+			"ifname":     ifname,
+			"script":     "no",
+			"downscript": "no",
+		},
+	}
+}
+
+// NetdevDel returns the netdev_del command that closes netdev id. The guest
+// NIC using it must have been removed first.
+func NetdevDel(id string) QMPCommand {
+	return QMPCommand{Execute: "netdev_del", Arguments: map[string]any{"id": id}}
+}
+
+// DeviceAddNIC returns the device_add command that plugs a virtio-net PCI
+// NIC with id and MAC address mac, backed by netdev, into the guest.
+func DeviceAddNIC(id, netdev, mac string) QMPCommand {
+	return QMPCommand{
+		Execute: "device_add",
+		Arguments: map[string]any{
+			"driver": "virtio-net-pci",
+			"id":     id,
+			"netdev": netdev,
+			"mac":    mac,
+		},
+	}
+}
+
+// DeviceDel returns the device_del command that asks the guest to release
+// device id. QEMU answers before the guest does; the device is gone once
+// the guest acknowledges the unplug.
+func DeviceDel(id string) QMPCommand {
+	return QMPCommand{Execute: "device_del", Arguments: map[string]any{"id": id}}
+}
+
+// HotpluggableCPU is a vCPU slot as query-hotpluggable-cpus reports it.
+// QOMPath is empty while no vCPU is plugged into the slot; vCPUs plugged in
+// with device_add sit under /machine/peripheral/.
+type HotpluggableCPU struct {
+	Type       string         `json:"type"`
+	VCPUsCount int            `json:"vcpus-count"`
+	Props      map[string]any `json:"props"`
+	QOMPath    string         `json:"qom-path,omitempty"`
+}
+
+// QueryHotpluggableCPUs returns the query-hotpluggable-cpus command, which
+// replies with a []HotpluggableCPU covering every slot up to -smp maxcpus.
+func QueryHotpluggableCPUs() QMPCommand {
+	return QMPCommand{Execute: "query-hotpluggable-cpus"}
+}
+
+// DeviceAddCPU returns the device_add command that plugs a vCPU with id into
+// the empty slot cpu.
+func DeviceAddCPU(id string, cpu HotpluggableCPU) QMPCommand {
+	args := map[string]any{"driver": cpu.Type, "id": id}
+	maps.Copy(args, cpu.Props)
+	return QMPCommand{Execute: "device_add", Arguments: args}
+}
+
+// QOMSet returns the qom-set command that sets property of the object at
+// path, such as the requested-size of a virtio-mem device.
+func QOMSet(path, property string, value any) QMPCommand {
+	return QMPCommand{Execute: "qom-set", Arguments: map[string]any{"path": path, "property": property, "value": value}}
+}
+
+// QOMGet returns the qom-get command that reads property of the object at
+// path.
+func QOMGet(path, property string) QMPCommand {
+	return QMPCommand{Execute: "qom-get", Arguments: map[string]any{"path": path, "property": property}}
+}
+
+// CPUInfoFast is a vCPU as query-cpus-fast reports it: its index and the
+// host thread that runs it.
+type CPUInfoFast struct {
+	CPUIndex int `json:"cpu-index"`
+	ThreadID int `json:"thread-id"`
+}
+
+// QueryCPUsFast returns the query-cpus-fast command, which replies with a
+// []CPUInfoFast for every plugged vCPU.
+func QueryCPUsFast() QMPCommand {
+	return QMPCommand{Execute: "query-cpus-fast"}
+}
@@ -0,0 +1,33 @@
+package qmp
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceCommands(t *testing.T) {
+	for _, tc := range []struct {
+		cmd  QMPCommand
+		want string
+	}{
+		{NetdevAdd("net-eni-1", "tapeni-1"), `{"execute":"netdev_add","arguments":{"downscript":"no","id":"net-eni-1","ifname":"tapeni-1","script":"no","type":"tap"}}`},
+		{NetdevDel("net-eni-1"), `{"execute":"netdev_del","arguments":{"id":"net-eni-1"}}`},
+		{DeviceAddNIC("nic-eni-1", "net-eni-1", "02:00:00:00:00:01"), `{"execute":"device_add","arguments":{"driver":"virtio-net-pci","id":"nic-eni-1","mac":"02:00:00:00:00:01","netdev":"net-eni-1"}}`},
+		{DeviceDel("nic-eni-1"), `{"execute":"device_del","arguments":{"id":"nic-eni-1"}}`},
+		{QueryHotpluggableCPUs(), `{"execute":"query-hotpluggable-cpus"}`},
+		{QueryCPUsFast(), `{"execute":"query-cpus-fast"}`},
+		{DeviceAddCPU("vcpu2", HotpluggableCPU{Type: "host-x86_64-cpu", Props: map[string]any{"socket-id": 2, "core-id": 0, "thread-id": 0}}),
+			`{"execute":"device_add","arguments":{"driver":"host-x86_64-cpu","id":"vcpu2","socket-id":2,"core-id":0,"thread-id":0}}`},
+		{QOMSet("/machine/peripheral/hotmem0-dev", "requested-size", 1073741824),
+			`{"execute":"qom-set","arguments":{"path":"/machine/peripheral/hotmem0-dev","property":"requested-size","value":1073741824}}`},
+		{QOMGet("/machine/peripheral/hotmem0-dev", "size"),
+			`{"execute":"qom-get","arguments":{"path":"/machine/peripheral/hotmem0-dev","property":"size"}}`},
+	} {
+		data, err := json.Marshal(tc.cmd)
+		require.NoError(t, err)
+		assert.JSONEq(t, tc.want, string(data))
+	}
+}
@@ -0,0 +1,99 @@
+package qmp
+
+import (
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeGuestAgent answers guest agent commands on a unix socket, replying to
+// guest-sync with its id and to everything else from replies.
+type fakeGuestAgent struct {
+	mu       sync.Mutex
+	commands []string
+	replies  map[string]map[string]any
+}
+
+func serveFakeGuestAgent(t *testing.T, replies map[string]map[string]any) (string, *fakeGuestAgent) {
+	t.Helper()
+	agent := &fakeGuestAgent{replies: replies}
+	path := filepath.Join(t.TempDir(), "qga.sock")
+	ln, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				decoder := json.NewDecoder(conn)
+				encoder := json.NewEncoder(conn)
+				for {
+					var cmd QMPCommand
+					if err := decoder.Decode(&cmd); err != nil {
+						return
+					}
+					agent.mu.Lock()
+					agent.commands = append(agent.commands, cmd.Execute)
+					agent.mu.Unlock()
+					reply := agent.replies[cmd.Execute]
+					if cmd.Execute == "guest-sync" {
+						// A stale reply from an earlier request comes first
+						_ = encoder.Encode(map[string]any{"return": 0})
+						reply = map[string]any{"return": cmd.Arguments["id"]}
+					}
+					_ = encoder.Encode(reply)
+				}
+			}()
+		}
+	}()
+	return path, agent
+}
+
+func (a *fakeGuestAgent) received() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]string(nil), a.commands...)
+}
+
+func TestGuestFsFreezeAndThaw(t *testing.T) {
+	path, agent := serveFakeGuestAgent(t, map[string]map[string]any{
+		"guest-fsfreeze-freeze": {"return": 2},
+		"guest-fsfreeze-thaw":   {"return": 2},
+	})
+
+	frozen, err := GuestFsFreeze(path, 41, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 2, frozen)
+
+	thawed, err := GuestFsThaw(path, 42, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 2, thawed)
+
+	assert.Equal(t, []string{"guest-sync", "guest-fsfreeze-freeze", "guest-sync", "guest-fsfreeze-thaw"}, agent.received())
+}
+
+func TestGuestFsFreeze_AgentError(t *testing.T) {
+	path, _ := serveFakeGuestAgent(t, map[string]map[string]any{
+		"guest-fsfreeze-freeze": {"error": map[string]any{"class": "GenericError", "desc": "failed to freeze /: Operation not supported"}},
+	})
+
+	_, err := GuestFsFreeze(path, 7, time.Second)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to freeze")
+}
+
+func TestGuestSync_NoAgent(t *testing.T) {
+	err := GuestSync(filepath.Join(t.TempDir(), "missing.sock"), 1, 100*time.Millisecond)
+	assert.Error(t, err)
+}
@@ -83,6 +83,19 @@ type QMPError struct {
 	Desc  string `json:"desc"`
 }
 
+// QMP error classes (qapi/error.json)
+const (
+	ErrorClassGenericError    = "GenericError"
+	ErrorClassCommandNotFound = "CommandNotFound"
+	ErrorClassDeviceNotActive = "DeviceNotActive"
+	ErrorClassDeviceNotFound  = "DeviceNotFound"
+	ErrorClassKVMMissingCap   = "KVMMissingCap"
+)
+
+func (e *QMPError) Error() string {
+	return fmt.Sprintf("QMP error: %s: %s", e.Class, e.Desc)
+}
+
 // QMP greeting on connect
 type QMPGreeting struct {
 	QMP struct {
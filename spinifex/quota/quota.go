@@ -0,0 +1,115 @@
+// Package quota checks requests against the per-account resource limits set
+// by config.AccountQuota, and reports each limit against an account's usage.
+package quota
+
+import (
+	"fmt"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/config"
+)
+
+// Usage is how much of each limited resource an account holds, or how much a
+// request adds.
+type Usage struct {
+	VCPUs     int `json:"vcpus"`
+	Instances int `json:"instances"`
+	Volumes   int `json:"volumes"`
+	VolumeGiB int `json:"volume_gib"`
+	Addresses int `json:"addresses"`
+	// ProvisionedIOPS is the IOPS provisioned on io1 and io2 volumes.
+	ProvisionedIOPS int `json:"provisioned_iops"`
+}
+
+// limit is one quota: the most an account may hold, what it holds, and the
+// error EC2 returns for a request that would go over.
+type limit struct {
+	name string
+	unit string
+	max  int
+	used int
+	code string
+}
+
+// limits pairs each of q's limits with the usage it bounds, instances and
+// vCPUs first.
+func limits(q config.AccountQuota, usage Usage) []limit {
+	return []limit{
+		{"max-instances", "instances", q.MaxInstances, usage.Instances, awserrors.ErrorInstanceLimitExceeded},
+		{"max-vcpus", "vCPUs", q.MaxVCPUs, usage.VCPUs, awserrors.ErrorVcpuLimitExceeded},
+		{"max-volumes", "volumes", q.MaxVolumes, usage.Volumes, awserrors.ErrorVolumeLimitExceeded},
+		{"max-volume-gib", "GiB of volume storage", q.MaxVolumeGiB, usage.VolumeGiB, awserrors.ErrorVolumeLimitExceeded},
+		{"max-elastic-ips", "Elastic IP addresses", q.MaxAddresses, usage.Addresses, awserrors.ErrorAddressLimitExceeded},
+		{"max-provisioned-iops", "provisioned IOPS", q.MaxProvisionedIOPS, usage.ProvisionedIOPS, awserrors.ErrorMaxIOPSLimitExceeded},
+	}
+}
+
+func (l limit) exceeded(accountID string) error {
+	return awserrors.WithDetail(l.code, fmt.Sprintf("account %s is limited to %d %s and holds %d", accountID, l.max, l.unit, l.used))
+}
+
+// Check returns the error for the first of q's limits that adding add to
+// usage would exceed, or nil when the request fits.
+func Check(q config.AccountQuota, usage, add Usage) error {
+	after := limits(q, Usage{
+		VCPUs:           usage.VCPUs + add.VCPUs,
+		Instances:       usage.Instances + add.Instances,
+		Volumes:         usage.Volumes + add.Volumes,
+		VolumeGiB:       usage.VolumeGiB + add.VolumeGiB,
+		Addresses:       usage.Addresses + add.Addresses,
+		ProvisionedIOPS: usage.ProvisionedIOPS + add.ProvisionedIOPS,
+	})
+	for i, l := range limits(q, usage) {
+		if l.max > 0 && after[i].used > l.max {
+			return l.exceeded(q.AccountID)
+		}
+	}
+	return nil
+}
+
+// Launchable returns how many instances of vcpus each, up to count, fit in
+// q's instance and vCPU limits. When fewer than count fit, err is the error
+// for the limit that stopped them.
+func Launchable(q config.AccountQuota, usage Usage, vcpus, count int) (n int, err error) {
+	all := limits(q, usage)
+	n = count
+	for _, c := range []struct {
+		l   limit
+		per int
+	}{{all[0], 1}, {all[1], vcpus}} {
+		if c.l.max == 0 || c.per == 0 {
+			continue
+		}
+		if fit := max((c.l.max-c.l.used)/c.per, 0); fit < n {
+			n, err = fit, c.l.exceeded(q.AccountID)
+		}
+	}
+	return n, err
+}
+
+// Quota is one of an account's limits and how much of it is used. Limit is
+// omitted when there is no limit.
+type Quota struct {
+	Name  string `json:"name"`
+	Limit int    `json:"limit,omitempty"`
+	Usage int    `json:"usage"`
+}
+
+// DescribeAccountQuotasInput is the request for the DescribeAccountQuotas
+// spinifex extension, which reports the caller's own account.
+type DescribeAccountQuotasInput struct{}
+
+// DescribeAccountQuotasOutput is the response for DescribeAccountQuotas.
+type DescribeAccountQuotasOutput struct {
+	AccountID string  `json:"account_id"`
+	Quotas    []Quota `json:"quotas"`
+}
+
+// Describe reports each of q's limits against usage.
+func Describe(q config.AccountQuota, usage Usage) *DescribeAccountQuotasOutput {
+	out := &DescribeAccountQuotasOutput{AccountID: q.AccountID}
+	for _, l := range limits(q, usage) {
+		out.Quotas = append(out.Quotas, Quota{Name: l.name, Limit: l.max, Usage: l.used})
+	}
+	return out
+}
@@ -0,0 +1,76 @@
+package quota
+
+import (
+	"testing"
+
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	q := config.AccountQuota{AccountID: "000000000002", MaxVolumes: 10, MaxVolumeGiB: 100, MaxAddresses: 2, MaxProvisionedIOPS: 20000}
+	usage := Usage{Volumes: 4, VolumeGiB: 80, Addresses: 2, ProvisionedIOPS: 16000}
+
+	assert.NoError(t, Check(q, usage, Usage{Volumes: 1, VolumeGiB: 20}))
+	assert.NoError(t, Check(q, usage, Usage{Instances: 500, VCPUs: 2000}), "unset limits")
+
+	tests := map[string]struct {
+		add  Usage
+		code string
+	}{
+		"volume storage":   {Usage{Volumes: 1, VolumeGiB: 21}, awserrors.ErrorVolumeLimitExceeded},
+		"volumes":          {Usage{Volumes: 7}, awserrors.ErrorVolumeLimitExceeded},
+		"addresses":        {Usage{Addresses: 1}, awserrors.ErrorAddressLimitExceeded},
+		"provisioned IOPS": {Usage{Volumes: 1, VolumeGiB: 10, ProvisionedIOPS: 5000}, awserrors.ErrorMaxIOPSLimitExceeded},
+	}
+	for name, tt := range tests {
+		err := Check(q, usage, tt.add)
+		require.Error(t, err, name)
+		assert.Equal(t, tt.code, err.Error(), name)
+	}
+
+	err := Check(q, usage, Usage{Addresses: 1})
+	assert.Equal(t, "account 000000000002 is limited to 2 Elastic IP addresses and holds 2", awserrors.Detail(err))
+}
+
+func TestLaunchable(t *testing.T) {
+	q := config.AccountQuota{MaxInstances: 10, MaxVCPUs: 16}
+
+	n, err := Launchable(q, Usage{Instances: 2, VCPUs: 4}, 2, 3)
+	assert.Equal(t, 3, n)
+	assert.NoError(t, err)
+
+	n, err = Launchable(q, Usage{Instances: 2, VCPUs: 4}, 4, 5)
+	assert.Equal(t, 3, n, "12 vCPUs left fit three 4-vCPU instances")
+	assert.Equal(t, awserrors.ErrorVcpuLimitExceeded, err.Error())
+
+	n, err = Launchable(q, Usage{Instances: 9, VCPUs: 9}, 1, 4)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, awserrors.ErrorInstanceLimitExceeded, err.Error())
+
+	n, err = Launchable(q, Usage{Instances: 12, VCPUs: 20}, 1, 1)
+	assert.Equal(t, 0, n, "usage over a lowered limit")
+	assert.Error(t, err)
+
+	n, err = Launchable(config.AccountQuota{}, Usage{Instances: 1000}, 8, 50)
+	assert.Equal(t, 50, n)
+	assert.NoError(t, err)
+}
+
+func TestDescribe(t *testing.T) {
+	out := Describe(config.AccountQuota{AccountID: "000000000002", MaxVCPUs: 64, MaxAddresses: 5},
+		Usage{VCPUs: 6, Instances: 3, Volumes: 3, VolumeGiB: 24, Addresses: 1})
+	assert.Equal(t, &DescribeAccountQuotasOutput{
+		AccountID: "000000000002",
+		Quotas: []Quota{
+			{Name: "max-instances", Usage: 3},
+			{Name: "max-vcpus", Limit: 64, Usage: 6},
+			{Name: "max-volumes", Usage: 3},
+			{Name: "max-volume-gib", Usage: 24},
+			{Name: "max-elastic-ips", Limit: 5, Usage: 1},
+			{Name: "max-provisioned-iops", Usage: 0},
+		},
+	}, out)
+}
@@ -1,6 +1,7 @@
 package awsgw
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"log/slog"
@@ -12,9 +13,12 @@ import (
 
 	"github.com/mulgadc/predastore/ratelimit"
 	"github.com/mulgadc/spinifex/spinifex/admin"
+	"github.com/mulgadc/spinifex/spinifex/audit"
 	"github.com/mulgadc/spinifex/spinifex/config"
 	"github.com/mulgadc/spinifex/spinifex/gateway"
 	handlers_iam "github.com/mulgadc/spinifex/spinifex/handlers/iam"
+	"github.com/mulgadc/spinifex/spinifex/objectstore"
+	"github.com/mulgadc/spinifex/spinifex/tracing"
 	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/nats-io/nats.go"
 	toml "github.com/pelletier/go-toml/v2"
@@ -101,8 +105,19 @@ func loadThrottleConfig(path string) (ratelimit.Config, error) {
 func launchService(config *config.ClusterConfig) error {
 	nodeConfig := config.Nodes[config.Node]
 
+	shutdownTracing, err := tracing.Init("spinifex-awsgw", config.Node, nodeConfig.Tracing)
+	if err != nil {
+		return fmt.Errorf("initialize tracing: %w", err)
+	}
+	defer func() {
+		if err := shutdownTracing(context.Background()); err != nil {
+			slog.Warn("Failed to flush traces", "err", err)
+		}
+	}()
+
 	// Connect to NATS for service communication. On concurrent startup the
 	// local NATS server may not be listening yet, so retry with backoff.
+	utils.SetSubjectPrefix(nodeConfig.NATS.SubjectPrefix)
 	natsConn, err := utils.ConnectNATSWithRetry(admin.DialTarget(nodeConfig.NATS.Host), nodeConfig.NATS.ACL.Token, nodeConfig.NATS.CACert)
 	if err != nil {
 		return err
@@ -115,7 +130,7 @@ func launchService(config *config.ClusterConfig) error {
 	}
 
 	// Load IAM master key from disk (required for all authenticated requests)
-	masterKeyPath := filepath.Join(nodeConfig.BaseDir, "config", "master.key")
+	masterKeyPath := nodeConfig.MasterKeyPath()
 	masterKey, err := handlers_iam.LoadMasterKey(masterKeyPath)
 	if err != nil {
 		return fmt.Errorf("load IAM master key from %s: %w", masterKeyPath, err)
@@ -129,6 +144,13 @@ func launchService(config *config.ClusterConfig) error {
 		return fmt.Errorf("initialize IAM service: %w", err)
 	}
 
+	// Serve instance profile credentials to the daemons' metadata services.
+	credsSub, err := handlers_iam.SubscribeInstanceCredentials(natsConn, iamService)
+	if err != nil {
+		return fmt.Errorf("subscribe to instance credentials requests: %w", err)
+	}
+	defer func() { _ = credsSub.Unsubscribe() }()
+
 	// First boot: consume bootstrap.json → seed IAM users into NATS KV → delete file.
 	// Check data directory first (production: /var/lib/spinifex/awsgw/), then
 	// awsgw subdir (dev: ~/spinifex/awsgw/), then legacy config dir.
@@ -158,6 +180,29 @@ func launchService(config *config.ClusterConfig) error {
 		slog.Warn("Failed to load throttle config, throttling disabled", "err", err)
 	}
 
+	// Audit log of mutating API calls. The stream shares the IAM buckets'
+	// replication; a gateway whose stream is unavailable keeps serving.
+	js, err := natsConn.JetStream()
+	if err != nil {
+		return fmt.Errorf("create JetStream context: %w", err)
+	}
+	retention := time.Duration(nodeConfig.AWSGW.AuditRetentionDays) * 24 * time.Hour
+	if err := audit.InitStream(js, max(len(config.Nodes), 1), retention); err != nil {
+		slog.Warn("Failed to initialize audit stream, audit events will not be retained", "err", err)
+	}
+	var archive objectstore.ObjectStore
+	if nodeConfig.AWSGW.AuditBucket != "" {
+		storeCfg := nodeConfig.AWSGW.AuditStore
+		if storeCfg.Backend == "" {
+			storeCfg = nodeConfig.Predastore.ObjectStore()
+		}
+		if archive, err = objectstore.New(storeCfg); err != nil {
+			return fmt.Errorf("create audit archive store: %w", err)
+		}
+	}
+	auditRecorder := audit.NewRecorder(natsConn, archive, nodeConfig.AWSGW.AuditBucket)
+	defer auditRecorder.Close()
+
 	// Create gateway with NATS connection
 	gw := gateway.GatewayConfig{
 		Debug:          nodeConfig.AWSGW.Debug,
@@ -168,6 +213,7 @@ func launchService(config *config.ClusterConfig) error {
 		Region:         nodeConfig.Region,
 		AZ:             nodeConfig.AZ,
 		IAMService:     iamService,
+		Audit:          auditRecorder,
 		Version:        version,
 		Commit:         commit,
 	}
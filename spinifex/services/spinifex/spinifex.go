@@ -3,7 +3,9 @@ package spinifex
 import (
 	"fmt"
 	"log/slog"
+	"maps"
 	"os"
+	"slices"
 
 	"github.com/mulgadc/spinifex/spinifex/config"
 	"github.com/mulgadc/spinifex/spinifex/daemon"
@@ -61,6 +63,12 @@ func (svc *Service) Reload() (err error) {
 }
 
 func launchService(config *config.ClusterConfig, configPath string) (err error) {
+	// Tag every ID this node generates so it can't collide with another
+	// node's.
+	idTag := utils.NodeIDTag(config.Node, slices.Collect(maps.Keys(config.Nodes)))
+	utils.SetResourceIDNode(idTag)
+	slog.Info("Resource ID node tag set", "node", config.Node, "tag", fmt.Sprintf("%04x", idTag))
+
 	d, err := daemon.NewDaemon(config)
 	if err != nil {
 		return fmt.Errorf("create daemon: %w", err)
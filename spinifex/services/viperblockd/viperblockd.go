@@ -14,6 +14,7 @@ import (
 
 	"github.com/mulgadc/spinifex/spinifex/admin"
 	"github.com/mulgadc/spinifex/spinifex/nbd"
+	"github.com/mulgadc/spinifex/spinifex/subjects"
 	"github.com/mulgadc/spinifex/spinifex/types"
 	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/mulgadc/viperblock/viperblock"
@@ -35,19 +36,22 @@ type MountedVolume struct {
 }
 
 type Config struct {
-	ConfigPath     string
-	PluginPath     string
-	Debug          bool
-	NatsHost       string
-	NatsToken      string
-	NatsCACert     string
-	MountedVolumes []MountedVolume
-	S3Host         string
-	Bucket         string
-	Region         string
-	AccessKey      string
-	SecretKey      string
-	BaseDir        string
+	ConfigPath string
+	PluginPath string
+	Debug      bool
+	NatsHost   string
+	NatsToken  string
+	NatsCACert string
+	// NatsSubjectPrefix is prepended to every NATS subject (see
+	// config.NATSConfig.SubjectPrefix).
+	NatsSubjectPrefix string
+	MountedVolumes    []MountedVolume
+	S3Host            string
+	Bucket            string
+	Region            string
+	AccessKey         string
+	SecretKey         string
+	BaseDir           string
 
 	// NodeName identifies this node in the cluster (e.g. "node1").
 	// Used for node-specific NATS topics: ebs.{NodeName}.mount / ebs.{NodeName}.unmount.
@@ -134,7 +138,7 @@ func respondAndPublish(msg *nats.Msg, nc *nats.Conn, topic string, data any) {
 	if err := msg.Respond(response); err != nil {
 		slog.Error("Failed to respond to NATS request", "err", err)
 	}
-	if err := nc.Publish(topic, response); err != nil {
+	if err := nc.Publish(utils.Subject(topic), response); err != nil {
 		slog.Error("Failed to publish response", "topic", topic, "err", err)
 	}
 }
@@ -171,6 +175,7 @@ func (svc *Service) Reload() (err error) {
 
 func launchService(cfg *Config) (err error) {
 	// Connect to NATS
+	utils.SetSubjectPrefix(cfg.NatsSubjectPrefix)
 	nc, err := utils.ConnectNATSWithRetry(admin.DialTarget(cfg.NatsHost), cfg.NatsToken, cfg.NatsCACert)
 	if err != nil {
 		slog.Error("Failed to connect to NATS", "err", err)
@@ -185,7 +190,7 @@ func launchService(cfg *Config) (err error) {
 		slog.Info("Waiting for EBS events (single-node mode)")
 	}
 
-	if _, err := nc.QueueSubscribe("ebs.delete", "spinifex-workers", func(msg *nats.Msg) {
+	if _, err := nc.QueueSubscribe(utils.Subject("ebs.delete"), "spinifex-workers", func(msg *nats.Msg) {
 		slog.Info("Received ebs.delete message", "data", string(msg.Data))
 
 		var ebsRequest types.EBSDeleteRequest
@@ -248,13 +253,13 @@ func launchService(cfg *Config) (err error) {
 	// Subscribe to node-specific unmount topic if NodeName is set, otherwise fall back to generic queue group
 	unmountTopic := "ebs.unmount"
 	if cfg.NodeName != "" {
-		unmountTopic = fmt.Sprintf("ebs.%s.unmount", cfg.NodeName)
+		unmountTopic = subjects.EBSUnmount(cfg.NodeName)
 	}
 	unmountSubscribe := func(topic string, handler nats.MsgHandler) (*nats.Subscription, error) {
 		if cfg.NodeName != "" {
-			return nc.Subscribe(topic, handler)
+			return nc.Subscribe(utils.Subject(topic), handler)
 		}
-		return nc.QueueSubscribe(topic, "spinifex-workers", handler)
+		return nc.QueueSubscribe(utils.Subject(topic), "spinifex-workers", handler)
 	}
 	if _, err := unmountSubscribe(unmountTopic, func(msg *nats.Msg) {
 		slog.Info("Received message", "data", string(msg.Data))
@@ -328,7 +333,7 @@ func launchService(cfg *Config) (err error) {
 		return fmt.Errorf("failed to subscribe to %s: %w", unmountTopic, err)
 	}
 
-	if _, err := nc.QueueSubscribe("ebs.sync", "spinifex-workers", func(msg *nats.Msg) {
+	if _, err := nc.QueueSubscribe(utils.Subject("ebs.sync"), "spinifex-workers", func(msg *nats.Msg) {
 		slog.Info("Received ebs.sync message", "data", string(msg.Data))
 
 		var syncRequest types.EBSSyncRequest
@@ -375,13 +380,13 @@ func launchService(cfg *Config) (err error) {
 	// Subscribe to node-specific mount topic if NodeName is set, otherwise fall back to generic queue group
 	mountTopic := "ebs.mount"
 	if cfg.NodeName != "" {
-		mountTopic = fmt.Sprintf("ebs.%s.mount", cfg.NodeName)
+		mountTopic = subjects.EBSMount(cfg.NodeName)
 	}
 	mountSubscribe := func(topic string, handler nats.MsgHandler) (*nats.Subscription, error) {
 		if cfg.NodeName != "" {
-			return nc.Subscribe(topic, handler)
+			return nc.Subscribe(utils.Subject(topic), handler)
 		}
-		return nc.QueueSubscribe(topic, "spinifex-workers", handler)
+		return nc.QueueSubscribe(utils.Subject(topic), "spinifex-workers", handler)
 	}
 	if _, err := mountSubscribe(mountTopic, func(msg *nats.Msg) {
 		slog.Info("Received message:", "data", string(msg.Data))
@@ -615,7 +620,7 @@ func launchService(cfg *Config) (err error) {
 		ebsResponse.URI = nbdURI
 
 		// Subscribe to volume-specific snapshot topic so requests route to this node
-		snapSub, err := nc.Subscribe(fmt.Sprintf("ebs.snapshot.%s", ebsRequest.Name), makeSnapshotHandler(vb, ebsRequest.Name))
+		snapSub, err := nc.Subscribe(utils.Subject(fmt.Sprintf("ebs.snapshot.%s", ebsRequest.Name)), makeSnapshotHandler(vb, ebsRequest.Name))
 		if err != nil {
 			slog.Error("Failed to subscribe to volume snapshot topic", "volume", ebsRequest.Name, "err", err)
 		}
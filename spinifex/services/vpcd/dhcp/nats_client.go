@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/mulgadc/spinifex/spinifex/utils"
 	"github.com/nats-io/nats.go"
 )
 
@@ -74,7 +75,7 @@ func RequestAcquire(nc *nats.Conn, bridge, clientID, hostname, vendorClass, pool
 	maxAttempts := AcquireMaxAttempts
 
 	for attempt := 1; attempt <= maxAttempts; attempt++ {
-		msg, err := nc.Request(TopicAcquire, data, NATSTimeout)
+		msg, err := nc.Request(utils.Subject(TopicAcquire), data, NATSTimeout)
 		if err != nil {
 			if attempt == maxAttempts {
 				return LeaseResult{}, fmt.Errorf(
@@ -133,7 +134,7 @@ func RequestRelease(nc *nats.Conn, clientID string) error {
 		return fmt.Errorf("marshal dhcp release request: %w", err)
 	}
 
-	msg, err := nc.Request(TopicRelease, data, NATSTimeout)
+	msg, err := nc.Request(utils.Subject(TopicRelease), data, NATSTimeout)
 	if err != nil {
 		return fmt.Errorf("dhcp release NATS request (client %s): %w", clientID, err)
 	}
@@ -206,14 +206,14 @@ func (m *DHCPManager) Bootstrap(ctx context.Context) error {
 func (m *DHCPManager) Subscribe(nc *nats.Conn) ([]*nats.Subscription, error) {
 	var subs []*nats.Subscription
 
-	acquire, err := nc.QueueSubscribe(dhcp.TopicAcquire, "vpcd-dhcp-workers", m.handleAcquire)
+	acquire, err := nc.QueueSubscribe(utils.Subject(dhcp.TopicAcquire), "vpcd-dhcp-workers", m.handleAcquire)
 	if err != nil {
 		return nil, fmt.Errorf("subscribe %s: %w", dhcp.TopicAcquire, err)
 	}
 	subs = append(subs, acquire)
 	slog.Info("DHCP Manager subscribed", "topic", dhcp.TopicAcquire)
 
-	release, err := nc.QueueSubscribe(dhcp.TopicRelease, "vpcd-dhcp-workers", m.handleRelease)
+	release, err := nc.QueueSubscribe(utils.Subject(dhcp.TopicRelease), "vpcd-dhcp-workers", m.handleRelease)
 	if err != nil {
 		_ = acquire.Unsubscribe()
 		return nil, fmt.Errorf("subscribe %s: %w", dhcp.TopicRelease, err)
@@ -567,7 +567,7 @@ func (m *DHCPManager) publishExpired(lease *dhcp.Lease, poolName, reason string)
 		slog.Warn("DHCP Manager: marshal lease-expired event failed", "client_id", lease.ClientID, "err", err)
 		return
 	}
-	if err := m.nc.Publish(dhcp.TopicLeaseExpired, data); err != nil {
+	if err := m.nc.Publish(utils.Subject(dhcp.TopicLeaseExpired), data); err != nil {
 		slog.Warn("DHCP Manager: publish lease-expired failed", "client_id", lease.ClientID, "err", err)
 	}
 }
@@ -0,0 +1,232 @@
+package vpcd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"strings"
+
+	handlers_ec2_vpc "github.com/mulgadc/spinifex/spinifex/handlers/ec2/vpc"
+	"github.com/mulgadc/spinifex/spinifex/services/vpcd/nbdb"
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/nats-io/nats.go"
+)
+
+// NATS topics for VPC DHCP options and internal DNS.
+const (
+	TopicDHCPOptions = "vpc.dhcp-options"
+	TopicDNSRegister = "vpc.dns-register"
+)
+
+// dhcpManagedOptions are the OVN DHCP options that follow a VPC's DHCP
+// options set. The rest are fixed per subnet.
+var dhcpManagedOptions = []string{"domain_name", "dns_server", "ntp_server"}
+
+// subnetDHCPOptions builds the OVN DHCP options for a subnet whose router
+// port has gwIP and routerMAC, serving the VPC's options set.
+func (h *TopologyHandler) subnetDHCPOptions(gwIP, routerMAC string, opts handlers_ec2_vpc.DHCPOptionsEvent) map[string]string {
+	options := map[string]string{
+		"server_id":  gwIP,
+		"server_mac": routerMAC,
+		"lease_time": "3600",
+		"router":     gwIP,
+		"mtu":        "1442", // Geneve overhead
+	}
+	maps.Copy(options, h.vpcDHCPOptions(opts))
+	return options
+}
+
+// vpcDHCPOptions maps a VPC's options set onto OVN DHCP options. Without
+// custom name servers guests get the cluster resolvers; either way OVN
+// answers internal names before the query leaves the host.
+func (h *TopologyHandler) vpcDHCPOptions(opts handlers_ec2_vpc.DHCPOptionsEvent) map[string]string {
+	options := map[string]string{"dns_server": h.dnsServer()}
+	if len(opts.DomainNameServers) > 0 {
+		options["dns_server"] = "{" + strings.Join(opts.DomainNameServers, ", ") + "}"
+	}
+	if opts.DomainName != "" {
+		// OVN string options are quoted.
+		options["domain_name"] = `"` + opts.DomainName + `"`
+	}
+	if len(opts.NtpServers) > 0 {
+		options["ntp_server"] = "{" + strings.Join(opts.NtpServers, ", ") + "}"
+	}
+	return options
+}
+
+// applyDHCPOptions reprograms the DHCP options of every subnet in the VPC.
+func (h *TopologyHandler) applyDHCPOptions(ctx context.Context, opts handlers_ec2_vpc.DHCPOptionsEvent) error {
+	rows, err := h.ovn.ListDHCPOptions(ctx)
+	if err != nil {
+		return fmt.Errorf("list DHCP options: %w", err)
+	}
+	want := h.vpcDHCPOptions(opts)
+	for i := range rows {
+		row := &rows[i]
+		if row.ExternalIDs["spinifex:vpc_id"] != opts.VpcId {
+			continue
+		}
+		options := maps.Clone(row.Options)
+		if options == nil {
+			options = make(map[string]string)
+		}
+		for _, key := range dhcpManagedOptions {
+			delete(options, key)
+		}
+		maps.Copy(options, want)
+		if maps.Equal(options, row.Options) {
+			continue
+		}
+		row.Options = options
+		if err := h.ovn.UpdateDHCPOptions(ctx, row); err != nil {
+			return fmt.Errorf("update DHCP options %s: %w", row.CIDR, err)
+		}
+	}
+	return nil
+}
+
+// vpcDNS returns the VPC's DNS row, creating it and attaching it to the
+// VPC's subnets if it doesn't exist yet.
+func (h *TopologyHandler) vpcDNS(ctx context.Context, vpcId string) (*nbdb.DNS, error) {
+	h.dnsMu.Lock()
+	defer h.dnsMu.Unlock()
+
+	if dns, err := h.ovn.FindDNSByExternalID(ctx, "spinifex:vpc_id", vpcId); err == nil {
+		return dns, nil
+	}
+
+	dns := &nbdb.DNS{
+		Records:     map[string]string{},
+		ExternalIDs: map[string]string{"spinifex:vpc_id": vpcId},
+	}
+	uuid, err := h.ovn.CreateDNS(ctx, dns)
+	if err != nil {
+		return nil, fmt.Errorf("create DNS for vpc %s: %w", vpcId, err)
+	}
+	dns.UUID = uuid
+
+	switches, err := h.ovn.ListLogicalSwitches(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list switches: %w", err)
+	}
+	for _, ls := range switches {
+		if ls.ExternalIDs["spinifex:vpc_id"] != vpcId || ls.ExternalIDs["spinifex:subnet_id"] == "" {
+			continue
+		}
+		if err := h.ovn.AttachSwitchDNS(ctx, ls.Name, uuid); err != nil {
+			return nil, fmt.Errorf("attach DNS to %s: %w", ls.Name, err)
+		}
+	}
+	slog.Info("vpcd: created DNS for VPC", "vpc_id", vpcId)
+	return dns, nil
+}
+
+// attachSubnetDNS serves the VPC's DNS records on a subnet's switch, so
+// instances resolve names across all subnets of their VPC.
+func (h *TopologyHandler) attachSubnetDNS(ctx context.Context, vpcId, switchName string) error {
+	dns, err := h.vpcDNS(ctx, vpcId)
+	if err != nil {
+		return err
+	}
+	return h.ovn.AttachSwitchDNS(ctx, switchName, dns.UUID)
+}
+
+// setDNSRecords upserts name-to-address records in the VPC's DNS.
+func (h *TopologyHandler) setDNSRecords(ctx context.Context, vpcId string, records map[string]string) error {
+	dns, err := h.vpcDNS(ctx, vpcId)
+	if err != nil {
+		return err
+	}
+	return h.ovn.UpdateDNSRecords(ctx, dns.UUID, records, nil)
+}
+
+// removeDNSAddress drops every record in the VPC's DNS that points at ip,
+// the private DNS name and any hostnames alike.
+func (h *TopologyHandler) removeDNSAddress(ctx context.Context, vpcId, ip string) error {
+	dns, err := h.ovn.FindDNSByExternalID(ctx, "spinifex:vpc_id", vpcId)
+	if err != nil {
+		return nil // nothing registered
+	}
+	stale := make(map[string]string)
+	for name, addr := range dns.Records {
+		if addr == ip {
+			stale[name] = addr
+		}
+	}
+	if len(stale) == 0 {
+		return nil
+	}
+	return h.ovn.UpdateDNSRecords(ctx, dns.UUID, nil, stale)
+}
+
+// deleteVPCDNS removes the VPC's DNS row along with its records.
+func (h *TopologyHandler) deleteVPCDNS(ctx context.Context, vpcId string) {
+	dns, err := h.ovn.FindDNSByExternalID(ctx, "spinifex:vpc_id", vpcId)
+	if err != nil {
+		return
+	}
+	if err := h.ovn.DeleteDNS(ctx, dns.UUID); err != nil {
+		slog.Warn("vpcd: failed to delete DNS during VPC cascade", "vpc_id", vpcId, "err", err)
+	}
+}
+
+// handleDHCPOptions applies a VPC's newly associated DHCP options set to its
+// subnets. Guests pick it up when they next renew their lease.
+func (h *TopologyHandler) handleDHCPOptions(msg *nats.Msg) {
+	if h.ovn == nil {
+		respond(msg, fmt.Errorf("OVN client not connected"))
+		return
+	}
+
+	var evt handlers_ec2_vpc.DHCPOptionsEvent
+	if err := json.Unmarshal(msg.Data, &evt); err != nil {
+		slog.Error("vpcd: failed to unmarshal vpc.dhcp-options event", "err", err)
+		respond(msg, err)
+		return
+	}
+
+	if err := h.applyDHCPOptions(context.Background(), evt); err != nil {
+		slog.Error("vpcd: failed to apply DHCP options", "vpc_id", evt.VpcId, "err", err)
+		respond(msg, err)
+		return
+	}
+
+	slog.Info("vpcd: applied DHCP options to VPC subnets", "vpc_id", evt.VpcId, "domain_name", evt.DomainName)
+	respond(msg, nil)
+}
+
+// handleDNSRegister adds an instance's hostname, and its FQDN when it has
+// one, to its VPC's DNS, so they resolve alongside the private DNS name.
+func (h *TopologyHandler) handleDNSRegister(msg *nats.Msg) {
+	if h.ovn == nil {
+		respond(msg, fmt.Errorf("OVN client not connected"))
+		return
+	}
+
+	var evt types.DNSRecordEvent
+	if err := json.Unmarshal(msg.Data, &evt); err != nil {
+		slog.Error("vpcd: failed to unmarshal vpc.dns-register event", "err", err)
+		respond(msg, err)
+		return
+	}
+	if evt.VpcId == "" || evt.Hostname == "" || evt.PrivateIP == "" {
+		respond(msg, fmt.Errorf("vpc.dns-register needs vpc_id, hostname and private_ip"))
+		return
+	}
+
+	name := strings.ToLower(evt.Hostname) + "." + handlers_ec2_vpc.InternalDomain
+	records := map[string]string{name: evt.PrivateIP}
+	if evt.FQDN != "" {
+		records[strings.ToLower(strings.TrimSuffix(evt.FQDN, "."))] = evt.PrivateIP
+	}
+	if err := h.setDNSRecords(context.Background(), evt.VpcId, records); err != nil {
+		slog.Error("vpcd: failed to register instance hostname", "name", name, "err", err)
+		respond(msg, err)
+		return
+	}
+
+	slog.Info("vpcd: registered instance hostname", "name", name, "fqdn", evt.FQDN, "ip", evt.PrivateIP, "instance_id", evt.InstanceID)
+	respond(msg, nil)
+}
@@ -0,0 +1,139 @@
+package vpcd
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	handlers_ec2_vpc "github.com/mulgadc/spinifex/spinifex/handlers/ec2/vpc"
+	"github.com/mulgadc/spinifex/spinifex/types"
+)
+
+func TestTopologyHandler_VPCDNS(t *testing.T) {
+	_, nc := startTestNATS(t)
+	mock := NewMockOVNClient()
+	_ = mock.Connect(context.Background())
+	ctx := context.Background()
+
+	topo := NewTopologyHandler(mock)
+	subs, err := topo.Subscribe(nc)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	defer func() {
+		for _, s := range subs {
+			_ = s.Unsubscribe()
+		}
+	}()
+
+	request := func(topic string, evt any) {
+		t.Helper()
+		data, _ := json.Marshal(evt)
+		resp, err := nc.Request(topic, data, 5_000_000_000)
+		if err != nil {
+			t.Fatalf("request %s: %v", topic, err)
+		}
+		assertSuccess(t, resp, topic)
+	}
+	records := func() map[string]string {
+		t.Helper()
+		dns, err := mock.FindDNSByExternalID(ctx, "spinifex:vpc_id", "vpc-dns")
+		if err != nil {
+			t.Fatalf("expected VPC DNS: %v", err)
+		}
+		return dns.Records
+	}
+
+	_ = mock.CreateLogicalRouter(ctx, nbdbLogicalRouter("vpc-vpc-dns", "vpc-dns"))
+
+	// The subnet serves the VPC's options set and DNS
+	request(TopicSubnetCreate, SubnetEvent{
+		SubnetId: "subnet-dns1", VpcId: "vpc-dns", CidrBlock: "10.0.1.0/24",
+		DomainName: "corp.example", DomainNameServers: []string{"10.0.0.2", "10.0.0.3"},
+	})
+	dhcpOpts, err := mock.FindDHCPOptionsByCIDR(ctx, "10.0.1.0/24")
+	if err != nil {
+		t.Fatalf("expected DHCP options: %v", err)
+	}
+	if got := dhcpOpts.Options["domain_name"]; got != `"corp.example"` {
+		t.Errorf("expected domain_name \"corp.example\", got %s", got)
+	}
+	if got := dhcpOpts.Options["dns_server"]; got != "{10.0.0.2, 10.0.0.3}" {
+		t.Errorf("expected dns_server {10.0.0.2, 10.0.0.3}, got %s", got)
+	}
+	dns, err := mock.FindDNSByExternalID(ctx, "spinifex:vpc_id", "vpc-dns")
+	if err != nil {
+		t.Fatalf("expected VPC DNS: %v", err)
+	}
+	ls, _ := mock.GetLogicalSwitch(ctx, "subnet-subnet-dns1")
+	if len(ls.DNSRecords) != 1 || ls.DNSRecords[0] != dns.UUID {
+		t.Errorf("expected switch to reference DNS %s, got %v", dns.UUID, ls.DNSRecords)
+	}
+
+	// Ports resolve by private DNS name, instances by hostname
+	request(TopicCreatePort, PortEvent{
+		NetworkInterfaceId: "eni-dns1", SubnetId: "subnet-dns1", VpcId: "vpc-dns",
+		PrivateIpAddress: "10.0.1.4", MacAddress: "02:00:00:11:22:33",
+	})
+	request(TopicDNSRegister, types.DNSRecordEvent{InstanceID: "i-dns1", VpcId: "vpc-dns", Hostname: "Web-1", FQDN: "web-1.corp.example", PrivateIP: "10.0.1.4"})
+	got := records()
+	if got["ip-10-0-1-4.spinifex.internal"] != "10.0.1.4" || got["web-1.spinifex.internal"] != "10.0.1.4" || got["web-1.corp.example"] != "10.0.1.4" {
+		t.Errorf("expected private DNS name, hostname and FQDN records, got %v", got)
+	}
+
+	// Back to the default set: internal domain, cluster resolvers
+	request(TopicDHCPOptions, handlers_ec2_vpc.DefaultDhcpOptions().Event("vpc-dns"))
+	dhcpOpts, _ = mock.FindDHCPOptionsByCIDR(ctx, "10.0.1.0/24")
+	if got := dhcpOpts.Options["domain_name"]; got != `"spinifex.internal"` {
+		t.Errorf("expected domain_name \"spinifex.internal\", got %s", got)
+	}
+	if got := dhcpOpts.Options["dns_server"]; got != topo.dnsServer() {
+		t.Errorf("expected dns_server %s, got %s", topo.dnsServer(), got)
+	}
+	if dhcpOpts.Options["router"] != "10.0.1.1" {
+		t.Errorf("expected subnet options kept, got %v", dhcpOpts.Options)
+	}
+
+	// Deleting the port drops every name for its address
+	request(TopicDeletePort, PortEvent{
+		NetworkInterfaceId: "eni-dns1", SubnetId: "subnet-dns1", VpcId: "vpc-dns", PrivateIpAddress: "10.0.1.4",
+	})
+	if got := records(); len(got) != 0 {
+		t.Errorf("expected no records after port delete, got %v", got)
+	}
+
+	request(TopicVPCDelete, VPCEvent{VpcId: "vpc-dns"})
+	if _, err := mock.FindDNSByExternalID(ctx, "spinifex:vpc_id", "vpc-dns"); err == nil {
+		t.Error("expected VPC DNS to be deleted")
+	}
+}
+
+func TestTopologyHandler_DNSRegisterInvalid(t *testing.T) {
+	_, nc := startTestNATS(t)
+	mock := NewMockOVNClient()
+	_ = mock.Connect(context.Background())
+
+	topo := NewTopologyHandler(mock)
+	subs, err := topo.Subscribe(nc)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	defer func() {
+		for _, s := range subs {
+			_ = s.Unsubscribe()
+		}
+	}()
+
+	data, _ := json.Marshal(types.DNSRecordEvent{InstanceID: "i-dns2", Hostname: "web-2"})
+	resp, err := nc.Request(TopicDNSRegister, data, 5_000_000_000)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	var result struct {
+		Success bool `json:"success"`
+	}
+	_ = json.Unmarshal(resp.Data, &result)
+	if result.Success {
+		t.Error("expected vpc.dns-register without a VPC to fail")
+	}
+}
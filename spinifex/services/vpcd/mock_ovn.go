@@ -3,6 +3,8 @@ package vpcd
 import (
 	"context"
 	"fmt"
+	"maps"
+	"slices"
 	"sync"
 
 	"github.com/mulgadc/spinifex/spinifex/services/vpcd/nbdb"
@@ -19,6 +21,7 @@ type MockOVNClient struct {
 	routers        map[string]*nbdb.LogicalRouter
 	routerPorts    map[string]*nbdb.LogicalRouterPort
 	dhcpOpts       map[string]*nbdb.DHCPOptions
+	dns            map[string]*nbdb.DNS                      // keyed by UUID
 	nats           map[string]*nbdb.NAT                      // keyed by UUID
 	staticRoutes   map[string]*nbdb.LogicalRouterStaticRoute // keyed by UUID
 	portGroups     map[string]*nbdb.PortGroup                // keyed by name
@@ -54,6 +57,7 @@ func NewMockOVNClient() *MockOVNClient {
 		routers:        make(map[string]*nbdb.LogicalRouter),
 		routerPorts:    make(map[string]*nbdb.LogicalRouterPort),
 		dhcpOpts:       make(map[string]*nbdb.DHCPOptions),
+		dns:            make(map[string]*nbdb.DNS),
 		nats:           make(map[string]*nbdb.NAT),
 		staticRoutes:   make(map[string]*nbdb.LogicalRouterStaticRoute),
 		portGroups:     make(map[string]*nbdb.PortGroup),
@@ -363,6 +367,89 @@ func (m *MockOVNClient) ListDHCPOptions(_ context.Context) ([]nbdb.DHCPOptions,
 	return result, nil
 }
 
+func (m *MockOVNClient) UpdateDHCPOptions(_ context.Context, opts *nbdb.DHCPOptions) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.dhcpOpts[opts.UUID]; !exists {
+		return fmt.Errorf("DHCP options %q not found", opts.UUID)
+	}
+	stored := *opts
+	m.dhcpOpts[opts.UUID] = &stored
+	return nil
+}
+
+// DNS
+
+func (m *MockOVNClient) CreateDNS(_ context.Context, dns *nbdb.DNS) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if dns.UUID == "" {
+		dns.UUID = utils.GenerateResourceID("dns")
+	}
+	stored := *dns
+	stored.Records = maps.Clone(dns.Records)
+	if stored.Records == nil {
+		stored.Records = make(map[string]string)
+	}
+	m.dns[dns.UUID] = &stored
+	return dns.UUID, nil
+}
+
+func (m *MockOVNClient) DeleteDNS(_ context.Context, uuid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.dns[uuid]; !exists {
+		return fmt.Errorf("DNS %q not found", uuid)
+	}
+	delete(m.dns, uuid)
+	for _, ls := range m.switches {
+		ls.DNSRecords = slices.DeleteFunc(ls.DNSRecords, func(u string) bool { return u == uuid })
+	}
+	return nil
+}
+
+func (m *MockOVNClient) FindDNSByExternalID(_ context.Context, key, value string) (*nbdb.DNS, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, dns := range m.dns {
+		if dns.ExternalIDs[key] == value {
+			result := *dns
+			result.Records = maps.Clone(dns.Records)
+			return &result, nil
+		}
+	}
+	return nil, fmt.Errorf("DNS with external_id %s=%s not found", key, value)
+}
+
+func (m *MockOVNClient) UpdateDNSRecords(_ context.Context, uuid string, set, remove map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dns, exists := m.dns[uuid]
+	if !exists {
+		return fmt.Errorf("DNS %q not found", uuid)
+	}
+	for name, addr := range remove {
+		if dns.Records[name] == addr {
+			delete(dns.Records, name)
+		}
+	}
+	maps.Copy(dns.Records, set)
+	return nil
+}
+
+func (m *MockOVNClient) AttachSwitchDNS(_ context.Context, switchName, dnsUUID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ls, exists := m.switches[switchName]
+	if !exists {
+		return fmt.Errorf("logical switch %q not found", switchName)
+	}
+	if !slices.Contains(ls.DNSRecords, dnsUUID) {
+		ls.DNSRecords = append(ls.DNSRecords, dnsUUID)
+	}
+	return nil
+}
+
 // NAT
 
 func (m *MockOVNClient) AddNAT(_ context.Context, routerName string, nat *nbdb.NAT) error {
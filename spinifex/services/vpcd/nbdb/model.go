@@ -2,7 +2,7 @@
 // These models are used with libovsdb to interact with the OVN NB DB.
 //
 // The structs cover the core tables needed for Spinifex VPC networking:
-// LogicalSwitch, LogicalSwitchPort, LogicalRouter, LogicalRouterPort, and DHCPOptions.
+// LogicalSwitch, LogicalSwitchPort, LogicalRouter, LogicalRouterPort, DHCPOptions, and DNS.
 //
 // To regenerate from the full OVN NB schema (requires OVN installed):
 //
@@ -69,6 +69,14 @@ type DHCPOptions struct {
 	ExternalIDs map[string]string `ovsdb:"external_ids"`
 }
 
+// DNS represents an OVN DNS row: name-to-address records that ovn-controller
+// answers for ports on the logical switches referencing it.
+type DNS struct {
+	UUID        string            `ovsdb:"_uuid"`
+	Records     map[string]string `ovsdb:"records"`
+	ExternalIDs map[string]string `ovsdb:"external_ids"`
+}
+
 // NAT represents an OVN NAT rule on a Logical_Router.
 type NAT struct {
 	UUID        string            `ovsdb:"_uuid"`
@@ -134,6 +142,7 @@ func FullDatabaseModel() (model.ClientDBModel, error) {
 		"Logical_Router":              &LogicalRouter{},
 		"Logical_Router_Port":         &LogicalRouterPort{},
 		"DHCP_Options":                &DHCPOptions{},
+		"DNS":                         &DNS{},
 		"NAT":                         &NAT{},
 		"Logical_Router_Static_Route": &LogicalRouterStaticRoute{},
 		"Gateway_Chassis":             &GatewayChassis{},
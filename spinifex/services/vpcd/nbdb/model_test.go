@@ -20,6 +20,7 @@ func TestFullDatabaseModel(t *testing.T) {
 		"Logical_Router",
 		"Logical_Router_Port",
 		"DHCP_Options",
+		"DNS",
 		"NAT",
 		"Logical_Router_Static_Route",
 		"Gateway_Chassis",
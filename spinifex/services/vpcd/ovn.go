@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"maps"
 
 	"github.com/mulgadc/spinifex/spinifex/services/vpcd/nbdb"
 	"github.com/ovn-kubernetes/libovsdb/client"
@@ -85,6 +86,14 @@ type OVNClient interface {
 	FindDHCPOptionsByCIDR(ctx context.Context, cidr string) (*nbdb.DHCPOptions, error)
 	FindDHCPOptionsByExternalID(ctx context.Context, key, value string) (*nbdb.DHCPOptions, error)
 	ListDHCPOptions(ctx context.Context) ([]nbdb.DHCPOptions, error)
+	UpdateDHCPOptions(ctx context.Context, opts *nbdb.DHCPOptions) error
+
+	// DNS (internal name resolution)
+	CreateDNS(ctx context.Context, dns *nbdb.DNS) (string, error)
+	DeleteDNS(ctx context.Context, uuid string) error
+	FindDNSByExternalID(ctx context.Context, key, value string) (*nbdb.DNS, error)
+	UpdateDNSRecords(ctx context.Context, uuid string, set, remove map[string]string) error
+	AttachSwitchDNS(ctx context.Context, switchName, dnsUUID string) error
 
 	// NAT rules
 	AddNAT(ctx context.Context, routerName string, nat *nbdb.NAT) error
@@ -698,6 +707,127 @@ func (c *LiveOVNClient) ListDHCPOptions(ctx context.Context) ([]nbdb.DHCPOptions
 	return options, nil
 }
 
+func (c *LiveOVNClient) UpdateDHCPOptions(ctx context.Context, opts *nbdb.DHCPOptions) error {
+	ops, err := c.client.Where(opts).Update(opts)
+	if err != nil {
+		return fmt.Errorf("update DHCP options ops: %w", err)
+	}
+	err = c.transactOps(ctx, ops)
+	if err != nil {
+		return fmt.Errorf("update DHCP options transact: %w", err)
+	}
+	return nil
+}
+
+func (c *LiveOVNClient) CreateDNS(ctx context.Context, dns *nbdb.DNS) (string, error) {
+	ops, err := c.client.Create(dns)
+	if err != nil {
+		return "", fmt.Errorf("create DNS ops: %w", err)
+	}
+	results, err := c.client.Transact(ctx, ops...)
+	if err != nil {
+		return "", fmt.Errorf("create DNS transact: %w", err)
+	}
+	if _, err := ovsdb.CheckOperationResults(results, ops); err != nil {
+		return "", fmt.Errorf("create DNS check: %w", err)
+	}
+	if len(results) > 0 {
+		return results[0].UUID.GoUUID, nil
+	}
+	return "", nil
+}
+
+// DeleteDNS removes a DNS row. Logical_Switch.dns_records holds weak
+// references, so switches drop it without a separate mutation.
+func (c *LiveOVNClient) DeleteDNS(ctx context.Context, uuid string) error {
+	dns := &nbdb.DNS{UUID: uuid}
+	ops, err := c.client.Where(dns).Delete()
+	if err != nil {
+		return fmt.Errorf("delete DNS ops: %w", err)
+	}
+	err = c.transactOps(ctx, ops)
+	if err != nil {
+		return fmt.Errorf("delete DNS transact: %w", err)
+	}
+	return nil
+}
+
+func (c *LiveOVNClient) FindDNSByExternalID(ctx context.Context, key, value string) (*nbdb.DNS, error) {
+	var rows []nbdb.DNS
+	err := c.client.WhereCache(func(d *nbdb.DNS) bool {
+		return d.ExternalIDs[key] == value
+	}).List(ctx, &rows)
+	if err != nil {
+		return nil, fmt.Errorf("find DNS by external_id %s=%s: %w", key, value, err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("DNS with external_id %s=%s not found", key, value)
+	}
+	return &rows[0], nil
+}
+
+// UpdateDNSRecords upserts set and deletes the exact name/address pairs in
+// remove, as mutations so concurrent updates to other names are kept.
+func (c *LiveOVNClient) UpdateDNSRecords(ctx context.Context, uuid string, set, remove map[string]string) error {
+	var rows []nbdb.DNS
+	if err := c.client.WhereCache(func(d *nbdb.DNS) bool { return d.UUID == uuid }).List(ctx, &rows); err != nil {
+		return fmt.Errorf("get DNS for update: %w", err)
+	}
+	if len(rows) == 0 {
+		return fmt.Errorf("DNS %q not found", uuid)
+	}
+
+	// Map inserts don't overwrite, so names changing address are deleted first.
+	stale := make(map[string]string, len(remove))
+	maps.Copy(stale, remove)
+	for name, addr := range set {
+		if old, ok := rows[0].Records[name]; ok && old != addr {
+			stale[name] = old
+		}
+	}
+
+	dns := &nbdb.DNS{UUID: uuid}
+	var mutations []model.Mutation
+	if len(stale) > 0 {
+		mutations = append(mutations, model.Mutation{Field: &dns.Records, Mutator: "delete", Value: stale})
+	}
+	if len(set) > 0 {
+		mutations = append(mutations, model.Mutation{Field: &dns.Records, Mutator: "insert", Value: set})
+	}
+	if len(mutations) == 0 {
+		return nil
+	}
+	ops, err := c.client.Where(dns).Mutate(dns, mutations...)
+	if err != nil {
+		return fmt.Errorf("mutate DNS records ops: %w", err)
+	}
+	err = c.transactOps(ctx, ops)
+	if err != nil {
+		return fmt.Errorf("mutate DNS records transact: %w", err)
+	}
+	return nil
+}
+
+func (c *LiveOVNClient) AttachSwitchDNS(ctx context.Context, switchName, dnsUUID string) error {
+	ls, err := c.GetLogicalSwitch(ctx, switchName)
+	if err != nil {
+		return fmt.Errorf("get logical switch for DNS attach: %w", err)
+	}
+	ops, err := c.client.Where(ls).Mutate(ls, model.Mutation{
+		Field:   &ls.DNSRecords,
+		Mutator: "insert",
+		Value:   []string{dnsUUID},
+	})
+	if err != nil {
+		return fmt.Errorf("mutate logical switch dns_records ops: %w", err)
+	}
+	err = c.transactOps(ctx, ops)
+	if err != nil {
+		return fmt.Errorf("mutate logical switch dns_records transact: %w", err)
+	}
+	return nil
+}
+
 func (c *LiveOVNClient) AddNAT(ctx context.Context, routerName string, nat *nbdb.NAT) error {
 	// Set a named UUID so the NAT can be referenced in the same transaction
 	if nat.UUID == "" {
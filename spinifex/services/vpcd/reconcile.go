@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"log/slog"
+	"strings"
 	"time"
 
 	handlers_ec2_igw "github.com/mulgadc/spinifex/spinifex/handlers/ec2/igw"
@@ -101,7 +102,8 @@ func Reconcile(ctx context.Context, topo *TopologyHandler, bootstrap *BootstrapV
 		switchName := "subnet-" + bootstrap.SubnetId
 		if _, err := topo.ovn.GetLogicalSwitch(ctx, switchName); err != nil {
 			slog.Info("vpcd reconcile: creating subnet topology", "switch", switchName)
-			if err := topo.reconcileSubnet(ctx, bootstrap.SubnetId, bootstrap.VpcId, bootstrap.SubnetCidr); err != nil {
+			if err := topo.reconcileSubnet(ctx, bootstrap.SubnetId, bootstrap.VpcId, bootstrap.SubnetCidr,
+				handlers_ec2_vpc.DefaultDhcpOptions().Event(bootstrap.VpcId)); err != nil {
 				slog.Error("vpcd reconcile: failed to create subnet topology", "err", err)
 			} else {
 				result.SwitchesCreated++
@@ -165,10 +167,18 @@ func ReconcileFromKV(ctx context.Context, nc *nats.Conn, topo *TopologyHandler,
 		return result
 	}
 
+	// DHCP options sets are optional: without the bucket every VPC uses the
+	// default set.
+	dhcpKV, err := js.KeyValue(handlers_ec2_vpc.KVBucketDhcpOptions)
+	if err != nil {
+		dhcpKV = nil
+	}
+
 	// Build a map of VPC ID → CIDR for subnet/IGW reconciliation
 	type vpcInfo struct {
 		VpcId     string
 		CidrBlock string
+		Dhcp      handlers_ec2_vpc.DHCPOptionsEvent
 	}
 	vpcMap := make(map[string]vpcInfo)
 
@@ -189,7 +199,7 @@ func ReconcileFromKV(ctx context.Context, nc *nats.Conn, topo *TopologyHandler,
 			slog.Warn("vpcd reconcile-kv: failed to unmarshal VPC record", "key", key, "err", err)
 			continue
 		}
-		vpcMap[rec.VpcId] = vpcInfo{VpcId: rec.VpcId, CidrBlock: rec.CidrBlock}
+		vpcMap[rec.VpcId] = vpcInfo{VpcId: rec.VpcId, CidrBlock: rec.CidrBlock, Dhcp: reconcileDhcpOptions(dhcpKV, key, &rec)}
 
 		routerName := "vpc-" + rec.VpcId
 		if _, err := topo.ovn.GetLogicalRouter(ctx, routerName); err != nil {
@@ -225,18 +235,32 @@ func ReconcileFromKV(ctx context.Context, nc *nats.Conn, topo *TopologyHandler,
 				continue
 			}
 
+			vpc, ok := vpcMap[rec.VpcId]
+			if !ok {
+				vpc.Dhcp = handlers_ec2_vpc.DefaultDhcpOptions().Event(rec.VpcId)
+			}
+
 			switchName := "subnet-" + rec.SubnetId
 			if _, err := topo.ovn.GetLogicalSwitch(ctx, switchName); err != nil {
 				slog.Info("vpcd reconcile-kv: creating subnet topology", "switch", switchName)
-				if err := topo.reconcileSubnet(ctx, rec.SubnetId, rec.VpcId, rec.CidrBlock); err != nil {
+				if err := topo.reconcileSubnet(ctx, rec.SubnetId, rec.VpcId, rec.CidrBlock, vpc.Dhcp); err != nil {
 					slog.Error("vpcd reconcile-kv: failed to create subnet topology", "err", err)
 				} else {
 					result.SwitchesCreated++
 				}
+			} else if err := topo.attachSubnetDNS(ctx, rec.VpcId, switchName); err != nil {
+				slog.Warn("vpcd reconcile-kv: failed to attach VPC DNS", "switch", switchName, "err", err)
 			}
 		}
 	}
 
+	// Existing subnets pick up DHCP options sets associated while vpcd was down
+	for _, vpc := range vpcMap {
+		if err := topo.applyDHCPOptions(ctx, vpc.Dhcp); err != nil {
+			slog.Warn("vpcd reconcile-kv: failed to apply DHCP options", "vpc_id", vpc.VpcId, "err", err)
+		}
+	}
+
 	// 3. Reconcile IGW attachments: ensure attached IGWs have external switch + SNAT
 	igwKV, err := js.KeyValue(handlers_ec2_igw.KVBucketIGW)
 	if err != nil {
@@ -299,6 +323,13 @@ func ReconcileFromKV(ctx context.Context, nc *nats.Conn, topo *TopologyHandler,
 				continue
 			}
 
+			if rec.PrivateIpAddress != "" {
+				records := map[string]string{handlers_ec2_vpc.PrivateDNSName(rec.PrivateIpAddress): rec.PrivateIpAddress}
+				if err := topo.setDNSRecords(ctx, rec.VpcId, records); err != nil {
+					slog.Warn("vpcd reconcile-kv: failed to set ENI DNS record", "eni_id", rec.NetworkInterfaceId, "err", err)
+				}
+			}
+
 			portName := "port-" + rec.NetworkInterfaceId
 			if _, err := topo.ovn.GetLogicalSwitchPort(ctx, portName); err != nil {
 				switchName := "subnet-" + rec.SubnetId
@@ -339,3 +370,18 @@ func ReconcileFromKV(ctx context.Context, nc *nats.Conn, topo *TopologyHandler,
 
 	return result
 }
+
+// reconcileDhcpOptions resolves the DHCP options set of the VPC stored under
+// key, falling back to the default set when it can't be read.
+func reconcileDhcpOptions(dhcpKV nats.KeyValue, key string, rec *handlers_ec2_vpc.VPCRecord) handlers_ec2_vpc.DHCPOptionsEvent {
+	if rec.DhcpOptionsId == "" || dhcpKV == nil {
+		return handlers_ec2_vpc.DefaultDhcpOptions().Event(rec.VpcId)
+	}
+	accountID, _, _ := strings.Cut(key, ".")
+	options, err := handlers_ec2_vpc.LookupDhcpOptions(dhcpKV, accountID, rec.DhcpOptionsId)
+	if err != nil {
+		slog.Warn("vpcd reconcile-kv: failed to load DHCP options, using default", "vpc_id", rec.VpcId, "err", err)
+		return handlers_ec2_vpc.DefaultDhcpOptions().Event(rec.VpcId)
+	}
+	return options.Event(rec.VpcId)
+}
@@ -8,7 +8,9 @@ import (
 	"net"
 	"strconv"
 	"strings"
+	"sync"
 
+	handlers_ec2_vpc "github.com/mulgadc/spinifex/spinifex/handlers/ec2/vpc"
 	"github.com/mulgadc/spinifex/spinifex/services/vpcd/dhcp"
 	"github.com/mulgadc/spinifex/spinifex/services/vpcd/nbdb"
 	"github.com/mulgadc/spinifex/spinifex/types"
@@ -57,11 +59,25 @@ type VPCEvent struct {
 	VNI       int64  `json:"vni"`
 }
 
-// SubnetEvent is published on vpc.create-subnet / vpc.delete-subnet.
+// SubnetEvent is published on vpc.create-subnet / vpc.delete-subnet. The
+// VPC's DHCP options ride along on create.
 type SubnetEvent struct {
-	SubnetId  string `json:"subnet_id"`
-	VpcId     string `json:"vpc_id"`
-	CidrBlock string `json:"cidr_block"`
+	SubnetId          string   `json:"subnet_id"`
+	VpcId             string   `json:"vpc_id"`
+	CidrBlock         string   `json:"cidr_block"`
+	DomainName        string   `json:"domain_name,omitempty"`
+	DomainNameServers []string `json:"domain_name_servers,omitempty"`
+	NtpServers        []string `json:"ntp_servers,omitempty"`
+}
+
+// dhcpOptions returns the VPC DHCP options carried by the event.
+func (evt *SubnetEvent) dhcpOptions() handlers_ec2_vpc.DHCPOptionsEvent {
+	return handlers_ec2_vpc.DHCPOptionsEvent{
+		VpcId:             evt.VpcId,
+		DomainName:        evt.DomainName,
+		DomainNameServers: evt.DomainNameServers,
+		NtpServers:        evt.NtpServers,
+	}
 }
 
 // PortEvent is published on vpc.create-port / vpc.delete-port.
@@ -123,6 +139,9 @@ type TopologyHandler struct {
 	// source="dhcp" pools (mulga-siv-38). nil when no DHCP pool is wired or
 	// the test stack supplies a static-only mock.
 	nc *nats.Conn
+	// dnsMu serialises creating a VPC's DNS row, which port, subnet and
+	// hostname events can all race to do.
+	dnsMu sync.Mutex
 }
 
 // NewTopologyHandler creates a new TopologyHandler with optional external network config.
@@ -426,6 +445,8 @@ func (h *TopologyHandler) Subscribe(nc *nats.Conn) ([]*nats.Subscription, error)
 		{TopicCreateSG, h.handleCreateSG, true},
 		{TopicDeleteSG, h.handleDeleteSG, true},
 		{TopicUpdateSG, h.handleUpdateSG, true},
+		{TopicDHCPOptions, h.handleDHCPOptions, true},
+		{TopicDNSRegister, h.handleDNSRegister, true},
 	}
 
 	var result []*nats.Subscription
@@ -433,9 +454,9 @@ func (h *TopologyHandler) Subscribe(nc *nats.Conn) ([]*nats.Subscription, error)
 		var natsSub *nats.Subscription
 		var err error
 		if s.queue {
-			natsSub, err = nc.QueueSubscribe(s.topic, "vpcd-workers", s.handler)
+			natsSub, err = nc.QueueSubscribe(utils.Subject(s.topic), "vpcd-workers", s.handler)
 		} else {
-			natsSub, err = nc.Subscribe(s.topic, s.handler)
+			natsSub, err = nc.Subscribe(utils.Subject(s.topic), s.handler)
 		}
 		if err != nil {
 			for _, r := range result {
@@ -541,6 +562,8 @@ func (h *TopologyHandler) handleVPCDelete(msg *nats.Msg) {
 		}
 	}
 
+	h.deleteVPCDNS(ctx, evt.VpcId)
+
 	if err := h.ovn.DeleteLogicalRouter(ctx, routerName); err != nil {
 		slog.Error("vpcd: failed to delete logical router", "router", routerName, "err", err)
 		respond(msg, err)
@@ -646,15 +669,8 @@ func (h *TopologyHandler) handleSubnetCreate(msg *nats.Msg) {
 
 	// 4. Create DHCP_Options for the subnet
 	dhcpOpts := &nbdb.DHCPOptions{
-		CIDR: evt.CidrBlock,
-		Options: map[string]string{
-			"server_id":  gwIP,
-			"server_mac": routerMAC,
-			"lease_time": "3600",
-			"router":     gwIP,
-			"dns_server": h.dnsServer(),
-			"mtu":        "1442", // Geneve overhead
-		},
+		CIDR:    evt.CidrBlock,
+		Options: h.subnetDHCPOptions(gwIP, routerMAC, evt.dhcpOptions()),
 		ExternalIDs: map[string]string{
 			"spinifex:subnet_id": evt.SubnetId,
 			"spinifex:vpc_id":    evt.VpcId,
@@ -665,6 +681,12 @@ func (h *TopologyHandler) handleSubnetCreate(msg *nats.Msg) {
 		// Non-fatal: switch and router port are still useful
 	}
 
+	// 5. Serve the VPC's internal DNS on the subnet
+	if err := h.attachSubnetDNS(ctx, evt.VpcId, switchName); err != nil {
+		slog.Error("vpcd: failed to attach VPC DNS to subnet", "switch", switchName, "err", err)
+		// Non-fatal: instances still reach the upstream resolvers
+	}
+
 	slog.Info("vpcd: created subnet topology",
 		"switch", switchName,
 		"router_port", routerPortName,
@@ -741,6 +763,14 @@ func (h *TopologyHandler) handleCreatePort(msg *nats.Msg) {
 	portName := "port-" + evt.NetworkInterfaceId
 	switchName := "subnet-" + evt.SubnetId
 
+	// The private DNS name resolves once the port exists, and is re-added on
+	// replays in case the DNS row was lost.
+	if err := h.setDNSRecords(ctx, evt.VpcId, map[string]string{
+		handlers_ec2_vpc.PrivateDNSName(evt.PrivateIpAddress): evt.PrivateIpAddress,
+	}); err != nil {
+		slog.Warn("vpcd: failed to register private DNS name", "eni_id", evt.NetworkInterfaceId, "err", err)
+	}
+
 	// Idempotent: skip if port already exists
 	if _, err := h.ovn.GetLogicalSwitchPort(ctx, portName); err == nil {
 		slog.Debug("vpcd: logical switch port already exists, skipping", "port", portName)
@@ -807,6 +837,12 @@ func (h *TopologyHandler) handleDeletePort(msg *nats.Msg) {
 		return
 	}
 
+	if evt.PrivateIpAddress != "" {
+		if err := h.removeDNSAddress(ctx, evt.VpcId, evt.PrivateIpAddress); err != nil {
+			slog.Warn("vpcd: failed to remove DNS records for port", "eni_id", evt.NetworkInterfaceId, "err", err)
+		}
+	}
+
 	slog.Info("vpcd: deleted logical switch port for ENI",
 		"port", portName,
 		"switch", switchName,
@@ -1218,7 +1254,7 @@ func (h *TopologyHandler) reconcileVPC(ctx context.Context, vpcId, cidr string)
 }
 
 // reconcileSubnet creates the OVN logical switch, router port, and DHCP options for a subnet.
-func (h *TopologyHandler) reconcileSubnet(ctx context.Context, subnetId, vpcId, cidr string) error {
+func (h *TopologyHandler) reconcileSubnet(ctx context.Context, subnetId, vpcId, cidr string, opts handlers_ec2_vpc.DHCPOptionsEvent) error {
 	switchName := "subnet-" + subnetId
 	routerName := "vpc-" + vpcId
 	routerPortName := "rtr-" + subnetId
@@ -1277,15 +1313,8 @@ func (h *TopologyHandler) reconcileSubnet(ctx context.Context, subnetId, vpcId,
 
 	// 4. Create DHCP options
 	dhcpOpts := &nbdb.DHCPOptions{
-		CIDR: cidr,
-		Options: map[string]string{
-			"server_id":  gwIP,
-			"server_mac": routerMAC,
-			"lease_time": "3600",
-			"router":     gwIP,
-			"dns_server": h.dnsServer(),
-			"mtu":        "1442",
-		},
+		CIDR:    cidr,
+		Options: h.subnetDHCPOptions(gwIP, routerMAC, opts),
 		ExternalIDs: map[string]string{
 			"spinifex:subnet_id": subnetId,
 			"spinifex:vpc_id":    vpcId,
@@ -1295,6 +1324,11 @@ func (h *TopologyHandler) reconcileSubnet(ctx context.Context, subnetId, vpcId,
 		slog.Warn("vpcd reconcile: failed to create DHCP options (non-fatal)", "cidr", cidr, "err", err)
 	}
 
+	// 5. Attach VPC DNS
+	if err := h.attachSubnetDNS(ctx, vpcId, switchName); err != nil {
+		slog.Warn("vpcd reconcile: failed to attach VPC DNS (non-fatal)", "switch", switchName, "err", err)
+	}
+
 	slog.Info("vpcd reconcile: created subnet topology",
 		"switch", switchName, "router_port", routerPortName, "gateway", gwCIDR)
 	return nil
@@ -50,6 +50,9 @@ type Config struct {
 	NatsToken string
 	// NatsCACert is the path to the CA certificate for NATS TLS.
 	NatsCACert string
+	// NatsSubjectPrefix is prepended to every NATS subject (see
+	// config.NATSConfig.SubjectPrefix).
+	NatsSubjectPrefix string
 	// OVNNBAddr is the OVN Northbound DB address (e.g., "tcp:127.0.0.1:6641").
 	OVNNBAddr string
 	// OVNSBAddr is the OVN Southbound DB address (e.g., "tcp:127.0.0.1:6642"), used for monitoring.
@@ -301,6 +304,7 @@ func launchService(cfg *Config) error {
 	slog.Info("OVN preflight passed (br-int exists, ovn-controller running)")
 
 	// Connect to NATS
+	utils.SetSubjectPrefix(cfg.NatsSubjectPrefix)
 	nc, err := utils.ConnectNATSWithRetry(admin.DialTarget(cfg.NatsHost), cfg.NatsToken, cfg.NatsCACert)
 	if err != nil {
 		slog.Error("Failed to connect to NATS", "err", err)
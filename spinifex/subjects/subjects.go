@@ -0,0 +1,147 @@
+// Package subjects builds the NATS subjects that carry a per-instance,
+// per-node or per-instance-type token, so they are spelled in one place.
+//
+// Builders return the unprefixed subject. The deployment's subject prefix is
+// added where the subject is used, by utils.Subject or the utils NATS
+// helpers.
+package subjects
+
+import (
+	"strings"
+
+	"github.com/mulgadc/spinifex/spinifex/utils"
+)
+
+// NodeStatus is the fan-out subject every daemon answers with its node's
+// status and resource stats.
+const NodeStatus = "spinifex.node.status"
+
+// NodeHeartbeat is the subject every daemon publishes its Heartbeat on and
+// every daemon's node registry listens to.
+const NodeHeartbeat = "spinifex.nodes.heartbeat"
+
+// DescribeHosts is the queue subject a daemon answers with the node
+// registry's view of every node.
+const DescribeHosts = "spinifex.nodes.hosts"
+
+// ConfigReload is the fan-out subject every daemon re-reads its config file
+// on, answering with the changes it applied and rejected.
+const ConfigReload = "spinifex.admin.reload"
+
+// ForceTerminate is the queue subject a daemon terminates an orphaned
+// instance on for an operator: one whose node is lost or gone.
+const ForceTerminate = "spinifex.admin.terminate"
+
+// StateExport and StateImport are the queue subjects a daemon exports the
+// cluster state to, and restores it from, an archive in the Predastore
+// bucket on.
+const (
+	StateExport = "spinifex.admin.state.export"
+	StateImport = "spinifex.admin.state.import"
+)
+
+const instanceCmdPrefix = "ec2.cmd."
+
+// Event subjects. Daemons publish a types.Event on these as instances change
+// state and volumes attach and detach; the events stream keeps them for
+// replay. Events matches all of them.
+const (
+	Events                   = "spinifex.events.>"
+	EventInstanceStateChange = "spinifex.events.ec2.instance-state-change"
+	EventVolumeNotification  = "spinifex.events.ec2.volume-notification"
+	EventSpotInterruption    = "spinifex.events.ec2.spot-instance-interruption-warning"
+)
+
+// Metrics matches the subjects the daemons publish their instances' metric
+// samples on; the metrics stream keeps them for the retention window.
+const Metrics = "spinifex.metrics.>"
+
+// MetricSamples is the subject node's daemon publishes each minute's metric
+// samples on.
+func MetricSamples(node string) string {
+	return "spinifex.metrics." + node
+}
+
+// Audit matches the subjects the gateways publish audit.Event records on,
+// one per account; the audit stream keeps them.
+const Audit = "spinifex.audit.>"
+
+// AuditEvent is the subject a mutating API call by accountID is recorded on.
+func AuditEvent(accountID string) string {
+	return "spinifex.audit." + accountID
+}
+
+// RunInstances is the queue subject the daemons with capacity for
+// instanceType subscribe to.
+func RunInstances(instanceType string) string {
+	return "ec2.RunInstances." + instanceType
+}
+
+// RunInstancesOnNode targets RunInstances for instanceType at one node.
+func RunInstancesOnNode(instanceType, node string) string {
+	return RunInstances(instanceType) + "." + node
+}
+
+// ReclaimCapacity is the subject node's daemon interrupts interruptible
+// instances on to make room for an on-demand launch.
+func ReclaimCapacity(node string) string {
+	return "ec2.ReclaimCapacity." + node
+}
+
+// InstanceCmd is the subject the daemon running an instance takes its
+// lifecycle commands on: stop, terminate, reboot, volume attach and detach,
+// and scheduled instance events.
+func InstanceCmd(instanceID string) string {
+	return instanceCmdPrefix + instanceID
+}
+
+// ParseInstanceCmd returns the instance ID from an InstanceCmd subject, with
+// or without the configured subject prefix.
+func ParseInstanceCmd(subject string) (instanceID string, ok bool) {
+	if prefix := utils.SubjectPrefix(); prefix != "" {
+		subject = strings.TrimPrefix(subject, prefix+".")
+	}
+	instanceID, ok = strings.CutPrefix(subject, instanceCmdPrefix)
+	if !ok || instanceID == "" || strings.Contains(instanceID, ".") {
+		return "", false
+	}
+	return instanceID, true
+}
+
+// ConsoleOutput is the subject the daemon running an instance answers
+// GetConsoleOutput on.
+func ConsoleOutput(instanceID string) string {
+	return "ec2." + instanceID + ".GetConsoleOutput"
+}
+
+// EBSMount is the subject node's viperblockd mounts volumes on. Mount and
+// unmount are node-specific because the NBD sockets they hand out are local.
+// ConsoleIn carries a console session's input from the gateway to the node
+// hosting the instance.
+func ConsoleIn(sessionID string) string {
+	return "spinifex.console." + sessionID + ".in"
+}
+
+// ConsoleOut carries a console session's output from the node to the gateway.
+func ConsoleOut(sessionID string) string {
+	return "spinifex.console." + sessionID + ".out"
+}
+
+func EBSMount(node string) string {
+	return "ebs." + node + ".mount"
+}
+
+// EBSUnmount is the subject node's viperblockd unmounts volumes on.
+func EBSUnmount(node string) string {
+	return "ebs." + node + ".unmount"
+}
+
+// NodeHealth is the subject node's daemon answers health checks on.
+func NodeHealth(node string) string {
+	return "spinifex.admin." + node + ".health"
+}
+
+// NodeDrain is the subject node's daemon drains and exits on.
+func NodeDrain(node string) string {
+	return "spinifex.admin." + node + ".drain"
+}
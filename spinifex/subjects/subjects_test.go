@@ -0,0 +1,50 @@
+package subjects
+
+import (
+	"testing"
+
+	"github.com/mulgadc/spinifex/spinifex/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuilders(t *testing.T) {
+	assert.Equal(t, "ec2.RunInstances.t3.micro", RunInstances("t3.micro"))
+	assert.Equal(t, "ec2.RunInstances.t3.micro.node-1", RunInstancesOnNode("t3.micro", "node-1"))
+	assert.Equal(t, "ec2.ReclaimCapacity.node-1", ReclaimCapacity("node-1"))
+	assert.Equal(t, "ec2.cmd.i-0123456789abcdef0", InstanceCmd("i-0123456789abcdef0"))
+	assert.Equal(t, "ec2.i-0123456789abcdef0.GetConsoleOutput", ConsoleOutput("i-0123456789abcdef0"))
+	assert.Equal(t, "ebs.node-1.mount", EBSMount("node-1"))
+	assert.Equal(t, "ebs.node-1.unmount", EBSUnmount("node-1"))
+	assert.Equal(t, "spinifex.admin.node-1.health", NodeHealth("node-1"))
+	assert.Equal(t, "spinifex.admin.node-1.drain", NodeDrain("node-1"))
+	assert.Equal(t, "spinifex.audit.000000000001", AuditEvent("000000000001"))
+	assert.Equal(t, "spinifex.node.status", NodeStatus)
+	assert.Equal(t, "spinifex.nodes.heartbeat", NodeHeartbeat)
+	assert.Equal(t, "spinifex.nodes.hosts", DescribeHosts)
+	assert.Equal(t, "spinifex.admin.reload", ConfigReload)
+	assert.Equal(t, "spinifex.admin.terminate", ForceTerminate)
+	assert.Equal(t, "spinifex.admin.state.export", StateExport)
+	assert.Equal(t, "spinifex.admin.state.import", StateImport)
+}
+
+func TestParseInstanceCmd(t *testing.T) {
+	for _, id := range []string{"i-0123456789abcdef0", "i-test"} {
+		got, ok := ParseInstanceCmd(InstanceCmd(id))
+		assert.True(t, ok, id)
+		assert.Equal(t, id, got)
+	}
+
+	for _, subject := range []string{"", "ec2.cmd.", "ec2.cmd.i-1.extra", "ec2.RunInstances.t3.micro", "ec2.i-1.GetConsoleOutput"} {
+		_, ok := ParseInstanceCmd(subject)
+		assert.False(t, ok, subject)
+	}
+
+	restore := utils.SetSubjectPrefix("acme")
+	defer restore()
+	got, ok := ParseInstanceCmd(utils.Subject(InstanceCmd("i-prefixed")))
+	assert.True(t, ok)
+	assert.Equal(t, "i-prefixed", got)
+	got, ok = ParseInstanceCmd(InstanceCmd("i-unprefixed"))
+	assert.True(t, ok)
+	assert.Equal(t, "i-unprefixed", got)
+}
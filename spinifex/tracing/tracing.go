@@ -0,0 +1,144 @@
+// Package tracing sends OpenTelemetry traces of API requests and instance
+// launches to an OTLP collector. A trace starts at the gateway, crosses NATS
+// in the W3C traceparent message header and continues in the daemon's
+// handlers, volume mounts, cloud-init generation, QEMU launch and QMP
+// commands.
+//
+// Until Init is called with an endpoint the OpenTelemetry no-op provider is
+// in place, so spans cost next to nothing and nothing is exported.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/mulgadc/spinifex/spinifex/config"
+	"github.com/nats-io/nats.go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/mulgadc/spinifex"
+
+// propagator carries trace context in NATS and HTTP headers. It is used
+// whether or not Init has been called, so a component without tracing
+// still passes on the trace context it receives.
+var propagator = propagation.TraceContext{}
+
+// Init exports the spans of service, running on node, to the OTLP/HTTP
+// collector in cfg. It returns a function that flushes and stops the
+// exporter. With no endpoint configured it does nothing.
+func Init(service, node string, cfg config.TracingConfig) (shutdown func(context.Context) error, err error) {
+	if cfg.Endpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(cfg.Endpoint)}
+	if cfg.Insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("create OTLP exporter: %w", err)
+	}
+
+	ratio := cfg.SampleRatio
+	if ratio == 0 {
+		ratio = 1
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewSchemaless(
+			semconv.ServiceName(service),
+			semconv.HostName(node),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagator)
+	return provider.Shutdown, nil
+}
+
+// Start starts a span named name as a child of any span in ctx.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err, if any, on span and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Inject writes the trace context of ctx into NATS message headers.
+func Inject(ctx context.Context, header nats.Header) {
+	propagator.Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// Extract returns ctx carrying the trace context of a NATS message, if it
+// has one.
+func Extract(ctx context.Context, msg *nats.Msg) context.Context {
+	if msg == nil || msg.Header == nil {
+		return ctx
+	}
+	return propagator.Extract(ctx, propagation.HeaderCarrier(msg.Header))
+}
+
+// ExtractHTTP returns ctx carrying the trace context of HTTP request
+// headers, so a client that traces its calls sees the gateway's spans in
+// its own trace.
+func ExtractHTTP(ctx context.Context, header map[string][]string) context.Context {
+	return propagator.Extract(ctx, propagation.HeaderCarrier(header))
+}
+
+// instances holds the trace context of each instance launch in progress, so
+// the steps of a launch, which are passed the instance rather than a
+// context, add their spans to the launch's trace.
+var instances sync.Map
+
+// SetInstance records ctx as the trace context of instanceID's launch. A
+// ctx without a sampled span is not recorded.
+func SetInstance(ctx context.Context, instanceID string) {
+	if !trace.SpanContextFromContext(ctx).IsSampled() {
+		return
+	}
+	instances.Store(instanceID, ctx)
+}
+
+// Instance returns the trace context of instanceID's launch, or
+// context.Background when none is in progress.
+func Instance(instanceID string) context.Context {
+	if ctx, ok := instances.Load(instanceID); ok {
+		return ctx.(context.Context)
+	}
+	return context.Background()
+}
+
+// ClearInstance forgets the trace context of instanceID's launch.
+func ClearInstance(instanceID string) {
+	instances.Delete(instanceID)
+}
+
+// StartInstance starts a span in instanceID's launch trace. Outside a
+// traced launch, when parentOnly is set, it returns a span that is not
+// recorded, so that work repeated all the time, such as QMP polling, does
+// not produce a trace of its own.
+func StartInstance(instanceID, name string, parentOnly bool, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx := Instance(instanceID)
+	if parentOnly && !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+	attrs = append(attrs, attribute.String("spinifex.instance_id", instanceID))
+	return Start(ctx, name, attrs...)
+}
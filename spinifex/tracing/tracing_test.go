@@ -0,0 +1,93 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mulgadc/spinifex/spinifex/config"
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordSpans installs a tracer provider that keeps ended spans in memory
+// for the duration of the test.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+	return recorder
+}
+
+func TestInit_NoEndpoint(t *testing.T) {
+	shutdown, err := Init("spinifex-test", "n1", config.TracingConfig{})
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+}
+
+func TestInjectExtract(t *testing.T) {
+	recordSpans(t)
+	ctx, span := Start(context.Background(), "gateway")
+	defer span.End()
+
+	msg := nats.NewMsg("test.subject")
+	Inject(ctx, msg.Header)
+	assert.NotEmpty(t, msg.Header.Get("Traceparent"))
+
+	got := trace.SpanContextFromContext(Extract(context.Background(), msg))
+	assert.Equal(t, span.SpanContext().TraceID(), got.TraceID())
+	assert.Equal(t, span.SpanContext().SpanID(), got.SpanID())
+	assert.True(t, got.IsRemote())
+}
+
+func TestExtract_NoHeader(t *testing.T) {
+	ctx := Extract(context.Background(), &nats.Msg{Subject: "test.subject"})
+	assert.False(t, trace.SpanContextFromContext(ctx).IsValid())
+}
+
+func TestEnd_RecordsError(t *testing.T) {
+	recorder := recordSpans(t)
+	_, span := Start(context.Background(), "mount")
+	End(span, errors.New("mount failed"))
+
+	ended := recorder.Ended()
+	require.Len(t, ended, 1)
+	assert.Equal(t, codes.Error, ended[0].Status().Code)
+	assert.Equal(t, "mount failed", ended[0].Status().Description)
+}
+
+func TestStartInstance(t *testing.T) {
+	recorder := recordSpans(t)
+
+	// Outside a launch, parentOnly work is not recorded.
+	_, span := StartInstance("i-test", "qmp query-status", true)
+	span.End()
+	assert.Empty(t, recorder.Ended())
+
+	ctx, launch := Start(context.Background(), "LaunchInstance")
+	SetInstance(ctx, "i-test")
+	_, span = StartInstance("i-test", "qmp query-status", true)
+	span.End()
+	launch.End()
+	ClearInstance("i-test")
+
+	ended := recorder.Ended()
+	require.Len(t, ended, 2)
+	assert.Equal(t, "qmp query-status", ended[0].Name())
+	assert.Equal(t, launch.SpanContext().SpanID(), ended[0].Parent().SpanID())
+	assert.False(t, trace.SpanContextFromContext(Instance("i-test")).IsValid())
+}
+
+func TestSetInstance_IgnoresUntraced(t *testing.T) {
+	SetInstance(context.Background(), "i-untraced")
+	_, ok := instances.Load("i-untraced")
+	assert.False(t, ok)
+}
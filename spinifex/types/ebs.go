@@ -16,6 +16,40 @@ type EBSRequest struct {
 	DeleteOnTermination bool   `json:"DeleteOnTermination"`
 	NBDURI              string `json:"NBDURI"`     // NBD URI - socket path (nbd:unix:/path.sock) or TCP (nbd://host:port)
 	DeviceName          string `json:"DeviceName"` // AWS API device name (e.g. /dev/sdf) for hot-plugged volumes
+	// Backend is the storage backend holding the volume. Empty means
+	// viperblock, served over NBD; "local" volumes are files QEMU opens
+	// directly and are never sent to viperblockd.
+	Backend string `json:"Backend,omitempty"`
+	// CacheMode is the QEMU cache mode for the volume, from its
+	// vm.CacheModeTag tag at attach. Empty means none.
+	CacheMode string `json:"CacheMode,omitempty"`
+	// Trim passes guest discards through to the volume, from its
+	// vm.TrimTag tag or the node's default for its type.
+	Trim bool `json:"Trim,omitempty"`
+	// Encrypted volumes hold a LUKS container that QEMU opens with the
+	// volume's data key, so the backend only ever sees ciphertext.
+	Encrypted bool `json:"Encrypted,omitempty"`
+	// IOPS and Throughput (MiB/s) are the volume's provisioned performance,
+	// which its instance's EBS throttle group allows for in place of the
+	// type's baseline. Zero means the baseline.
+	IOPS       int64 `json:"IOPS,omitempty"`
+	Throughput int64 `json:"Throughput,omitempty"`
+}
+
+// VolumeEncryption is the encryption record of an encrypted volume, kept in
+// the object store beside its config. DataKey is the LUKS passphrase wrapped
+// by the KMS key; the unwrapped key is never stored.
+type VolumeEncryption struct {
+	KmsKeyID string `json:"KmsKeyId"`
+	DataKey  string `json:"DataKey"`
+	// Formatted is set once the LUKS header has been written. Volumes
+	// restored from a snapshot inherit it.
+	Formatted bool `json:"Formatted,omitempty"`
+}
+
+// VolumeEncryptionKey returns the object key of a volume's encryption record.
+func VolumeEncryptionKey(volumeID string) string {
+	return volumeID + "/encryption.json"
 }
 
 // NBDTransport defines the transport type for NBD connections
@@ -1,13 +1,25 @@
 package types
 
+import "time"
+
 // EC2InstanceCommand is the NATS wire format for EC2 instance commands
-// (stop, terminate, start, attach-volume, detach-volume).
+// (stop, terminate, start, attach-volume, detach-volume, resize-volume,
+// attach/detach-network-interface, modify-metadata-options).
 // It replaces direct use of qmp.Command on the gateway→daemon boundary.
 type EC2InstanceCommand struct {
-	ID               string               `json:"id"`
-	Attributes       EC2CommandAttributes `json:"attributes"`
-	AttachVolumeData *AttachVolumeData    `json:"attach_volume_data,omitempty"`
-	DetachVolumeData *DetachVolumeData    `json:"detach_volume_data,omitempty"`
+	ID                 string                  `json:"id"`
+	Attributes         EC2CommandAttributes    `json:"attributes"`
+	AttachVolumeData   *AttachVolumeData       `json:"attach_volume_data,omitempty"`
+	DetachVolumeData   *DetachVolumeData       `json:"detach_volume_data,omitempty"`
+	ResizeVolumeData   *ResizeVolumeData       `json:"resize_volume_data,omitempty"`
+	AttachENIData      *AttachENIData          `json:"attach_eni_data,omitempty"`
+	DetachENIData      *DetachENIData          `json:"detach_eni_data,omitempty"`
+	ModifyENIData      *ModifyENIData          `json:"modify_eni_data,omitempty"`
+	ResizeInstanceData *ResizeInstanceData     `json:"resize_instance_data,omitempty"`
+	MetadataOptions    *MetadataOptionsData    `json:"metadata_options,omitempty"`
+	MaintenanceOptions *MaintenanceOptionsData `json:"maintenance_options,omitempty"`
+	Protection         *ProtectionData         `json:"protection,omitempty"`
+	ConsoleSession     *ConsoleSessionData     `json:"console_session,omitempty"`
 }
 
 // EC2CommandAttributes indicates which action the daemon should perform.
@@ -18,6 +30,53 @@ type EC2CommandAttributes struct {
 	AttachVolume      bool `json:"attach_volume"`
 	DetachVolume      bool `json:"detach_volume"`
 	RebootInstance    bool `json:"reboot_instance"`
+	// ModifyMetadataOptions applies MetadataOptions to a running instance.
+	ModifyMetadataOptions bool `json:"modify_metadata_options,omitempty"`
+	// ModifyProtection applies Protection to a running instance.
+	ModifyProtection bool `json:"modify_protection,omitempty"`
+	// ModifyMaintenanceOptions applies MaintenanceOptions to a running instance.
+	ModifyMaintenanceOptions bool `json:"modify_maintenance_options,omitempty"`
+	// ResizeVolume grows an attached volume's block device to ResizeVolumeData.
+	ResizeVolume bool `json:"resize_volume,omitempty"`
+	// AttachENI hot-plugs the network interface in AttachENIData.
+	AttachENI bool `json:"attach_eni,omitempty"`
+	// DetachENI hot-unplugs the network interface in DetachENIData.
+	DetachENI bool `json:"detach_eni,omitempty"`
+	// ModifyENI applies ModifyENIData to a network interface attached to
+	// the instance.
+	ModifyENI bool `json:"modify_eni,omitempty"`
+	// ResizeInstance hot-plugs vCPUs and memory to bring a running instance
+	// to the instance type in ResizeInstanceData.
+	ResizeInstance bool `json:"resize_instance,omitempty"`
+	// ConsoleScreenshot captures the display of a running instance.
+	ConsoleScreenshot bool `json:"console_screenshot,omitempty"`
+	// GetPasswordData returns the password data the guest agent posted.
+	GetPasswordData bool `json:"get_password_data,omitempty"`
+	// OpenConsole relays the console in ConsoleSession between the
+	// instance and the gateway's websocket proxy.
+	OpenConsole bool `json:"open_console,omitempty"`
+	// StateReason is the Server.* state reason code of a stop or terminate
+	// the platform initiates. Empty means the user asked for it.
+	StateReason string `json:"state_reason,omitempty"`
+}
+
+// Console types a ConsoleSessionData can open.
+const (
+	ConsoleSerial = "serial"
+	ConsoleVNC    = "vnc"
+)
+
+// ConsoleCloseHeader marks the message that ends a console session, sent by
+// either side on its subject. Messages with no data and no header keep an
+// idle session open.
+const ConsoleCloseHeader = "Spinifex-Console-Close"
+
+// ConsoleSessionData carries parameters for an open-console command. The
+// gateway publishes the client's input on subjects.ConsoleIn(SessionID) and
+// the node publishes the console's output on subjects.ConsoleOut(SessionID).
+type ConsoleSessionData struct {
+	SessionID string `json:"session_id"`
+	Type      string `json:"type"`
 }
 
 // AttachVolumeData carries parameters for an attach-volume command.
@@ -32,3 +91,93 @@ type DetachVolumeData struct {
 	Device   string `json:"device,omitempty"`
 	Force    bool   `json:"force,omitempty"`
 }
+
+// ResizeVolumeData carries parameters for a resize-volume command.
+type ResizeVolumeData struct {
+	VolumeID string `json:"volume_id"`
+	SizeGiB  int64  `json:"size_gib"`
+}
+
+// AttachENIData carries parameters for an attach-network-interface command.
+type AttachENIData struct {
+	NetworkInterfaceID string `json:"network_interface_id"`
+	DeviceIndex        int64  `json:"device_index"`
+}
+
+// DetachENIData carries parameters for a detach-network-interface command.
+type DetachENIData struct {
+	NetworkInterfaceID string `json:"network_interface_id"`
+	AttachmentID       string `json:"attachment_id"`
+	Force              bool   `json:"force,omitempty"`
+}
+
+// ModifyENIData carries the attachment attributes of a
+// modify-network-interface-attribute command.
+type ModifyENIData struct {
+	NetworkInterfaceID  string `json:"network_interface_id"`
+	AttachmentID        string `json:"attachment_id"`
+	DeleteOnTermination bool   `json:"delete_on_termination"`
+}
+
+// ResizeInstanceData carries the target of a resize-instance command.
+type ResizeInstanceData struct {
+	InstanceType string `json:"instance_type"`
+}
+
+// MetadataOptionsData carries parameters for a modify-metadata-options
+// command. Empty fields are left unchanged.
+type MetadataOptionsData struct {
+	HttpEndpoint            string `json:"http_endpoint,omitempty"`
+	HttpTokens              string `json:"http_tokens,omitempty"`
+	HttpPutResponseHopLimit int64  `json:"http_put_response_hop_limit,omitempty"`
+}
+
+// MaintenanceOptionsData carries parameters for a modify-maintenance-options
+// command. Empty fields are left unchanged.
+type MaintenanceOptionsData struct {
+	AutoRecovery string `json:"auto_recovery,omitempty"`
+}
+
+// ProtectionData carries parameters for a modify-protection command. Nil
+// fields are left unchanged.
+type ProtectionData struct {
+	DisableApiTermination *bool `json:"disable_api_termination,omitempty"`
+	DisableApiStop        *bool `json:"disable_api_stop,omitempty"`
+}
+
+// PhoneHomeInput is forwarded by the gateway when a guest's cloud-init
+// phone_home module reports that boot has finished.
+type PhoneHomeInput struct {
+	InstanceID string `json:"instance_id"`
+	Token      string `json:"token"`
+}
+
+// DescribeInstanceBootStatusInput asks every node for the boot milestone and
+// reachability checks of the given instances, or of all the caller's
+// instances when empty.
+type DescribeInstanceBootStatusInput struct {
+	InstanceIDs []string `json:"instance_ids,omitempty"`
+}
+
+// DescribeInstanceBootStatusOutput maps instance ID to its boot milestone.
+// Only instances that were given a phone-home URL are listed; BootedAt is
+// zero until the guest has phoned home. Reachability lists every running
+// instance on the node.
+type DescribeInstanceBootStatusOutput struct {
+	Instances    map[string]InstanceBootStatus   `json:"instances"`
+	Reachability map[string]InstanceReachability `json:"reachability,omitempty"`
+}
+
+// InstanceReachability is a node's health checks of a running instance. A
+// check passes while its ImpairedSince is zero. GuestAgent is false for a
+// guest whose agent has never answered, which can't be checked.
+type InstanceReachability struct {
+	SystemImpairedSince   time.Time `json:"system_impaired_since,omitzero"`
+	GuestAgent            bool      `json:"guest_agent,omitempty"`
+	InstanceImpairedSince time.Time `json:"instance_impaired_since,omitzero"`
+}
+
+// InstanceBootStatus is the boot milestone of a single instance.
+type InstanceBootStatus struct {
+	BootedAt time.Time `json:"booted_at,omitzero"`
+}
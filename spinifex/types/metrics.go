@@ -0,0 +1,65 @@
+package types
+
+import "time"
+
+// MetricSample is one sample of an instance metric: the average over the
+// sampling interval for CPUUtilization, the total for the counters.
+type MetricSample struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// GetInstanceMetricsInput asks every node for the metric samples it holds
+// for the caller's instances. Empty InstanceIDs or MetricName match all;
+// a zero StartTime or EndTime leaves that end open. With NamesOnly, nodes
+// list the metrics with samples in the window without the samples, for
+// ListMetrics.
+type GetInstanceMetricsInput struct {
+	InstanceIDs []string  `json:"instance_ids,omitempty"`
+	MetricName  string    `json:"metric_name,omitempty"`
+	StartTime   time.Time `json:"start_time,omitzero"`
+	EndTime     time.Time `json:"end_time,omitzero"`
+	NamesOnly   bool      `json:"names_only,omitempty"`
+}
+
+// GetInstanceMetricsOutput maps instance ID to metric name to samples, oldest
+// first. A node holding more samples than fit one reply sends those taken
+// before NextStartTime; asking again from there returns the rest.
+type GetInstanceMetricsOutput struct {
+	Instances     map[string]map[string][]MetricSample `json:"instances"`
+	NextStartTime time.Time                            `json:"next_start_time,omitzero"`
+}
+
+// InstanceMetricNamespace is the CloudWatch namespace of instance metrics.
+const InstanceMetricNamespace = "AWS/EC2"
+
+// Instance metric names, as CloudWatch names them in the AWS/EC2 namespace.
+// MemoryUtilization has no AWS/EC2 equivalent, as EC2 can't see into the
+// guest; here it is the share of the instance's memory QEMU holds resident,
+// i.e. memory the guest has touched.
+const (
+	MetricCPUUtilization    = "CPUUtilization"
+	MetricMemoryUtilization = "MemoryUtilization"
+	MetricNetworkIn         = "NetworkIn"
+	MetricNetworkOut        = "NetworkOut"
+	MetricNetworkPacketsIn  = "NetworkPacketsIn"
+	MetricNetworkPacketsOut = "NetworkPacketsOut"
+	MetricDiskReadBytes     = "DiskReadBytes"
+	MetricDiskWriteBytes    = "DiskWriteBytes"
+	MetricDiskReadOps       = "DiskReadOps"
+	MetricDiskWriteOps      = "DiskWriteOps"
+)
+
+// InstanceMetricUnits maps each instance metric to its CloudWatch unit.
+var InstanceMetricUnits = map[string]string{
+	MetricCPUUtilization:    "Percent",
+	MetricMemoryUtilization: "Percent",
+	MetricNetworkIn:         "Bytes",
+	MetricNetworkOut:        "Bytes",
+	MetricNetworkPacketsIn:  "Count",
+	MetricNetworkPacketsOut: "Count",
+	MetricDiskReadBytes:     "Bytes",
+	MetricDiskWriteBytes:    "Bytes",
+	MetricDiskReadOps:       "Count",
+	MetricDiskWriteOps:      "Count",
+}
@@ -1,5 +1,7 @@
 package types
 
+import "time"
+
 // NodeDiscoverResponse is the response for node discovery requests.
 type NodeDiscoverResponse struct {
 	Node string `json:"node"`
@@ -34,11 +36,28 @@ type NodeStatusResponse struct {
 }
 
 // InstanceTypeCap describes available capacity for one instance type on a node.
+// Reclaimable is how many more instances of the type would fit once the
+// node's interruptible instances were reclaimed.
 type InstanceTypeCap struct {
-	Name      string  `json:"name"`
-	VCPU      int     `json:"vcpu"`
-	MemoryGB  float64 `json:"memory_gb"`
-	Available int     `json:"available"`
+	Name        string  `json:"name"`
+	VCPU        int     `json:"vcpu"`
+	MemoryGB    float64 `json:"memory_gb"`
+	Available   int     `json:"available"`
+	Reclaimable int     `json:"reclaimable,omitempty"`
+}
+
+// ReclaimCapacityRequest asks a node to interrupt interruptible instances
+// until Count instances of InstanceType fit.
+type ReclaimCapacityRequest struct {
+	InstanceType string `json:"instance_type"`
+	Count        int    `json:"count"`
+}
+
+// ReclaimCapacityResponse lists the instances the node gave interruption
+// notice to and how many instances of the type fit once they are gone.
+type ReclaimCapacityResponse struct {
+	Interrupted []string `json:"interrupted"`
+	Available   int      `json:"available"`
 }
 
 // VMInfo describes a single VM for the cluster stats CLI.
@@ -53,6 +72,24 @@ type VMInfo struct {
 	// (e.g. "elbv2"). Empty for customer VMs. The UI uses this to filter
 	// system-managed resources out of customer-facing listings.
 	ManagedBy string `json:"managed_by,omitempty"`
+	// CPUCreditMode, CPUCreditBalance and CPUThrottled describe a burstable
+	// instance's CPU credits. The mode is empty for other types.
+	CPUCreditMode    string  `json:"cpu_credit_mode,omitempty"`
+	CPUCreditBalance float64 `json:"cpu_credit_balance,omitempty"`
+	CPUThrottled     bool    `json:"cpu_throttled,omitempty"`
+	// AccountID is the account that owns the instance, empty for instances
+	// that predate accounts.
+	AccountID string     `json:"account_id,omitempty"`
+	Volumes   []VMVolume `json:"volumes,omitempty"`
+}
+
+// VMVolume is an EBS volume attached to an instance. The instance's internal
+// EFI and cloud-init volumes are not listed.
+type VMVolume struct {
+	VolumeID            string `json:"volume_id"`
+	DeviceName          string `json:"device_name,omitempty"`
+	Boot                bool   `json:"boot,omitempty"`
+	DeleteOnTermination bool   `json:"delete_on_termination,omitempty"`
 }
 
 // NodeVMsResponse is returned by the spinifex.node.vms NATS topic (fan-out).
@@ -61,3 +98,32 @@ type NodeVMsResponse struct {
 	Host string   `json:"host"`
 	VMs  []VMInfo `json:"vms"`
 }
+
+// Host states reported by DescribeHosts.
+const (
+	HostStateAvailable = "available"
+	HostStateDraining  = "draining"
+	HostStateLost      = "lost"
+)
+
+// HostInfo describes one node as the node registry last heard from it.
+// ImpairedInstances lists the instances that were running on a lost node.
+type HostInfo struct {
+	Node              string    `json:"node"`
+	State             string    `json:"state"`
+	Version           string    `json:"version"`
+	LastHeartbeat     time.Time `json:"last_heartbeat"`
+	LostSince         time.Time `json:"lost_since,omitzero"`
+	TotalVCPU         int       `json:"total_vcpu"`
+	TotalMemGB        float64   `json:"total_mem_gb"`
+	AllocVCPU         int       `json:"alloc_vcpu"`
+	AllocMemGB        float64   `json:"alloc_mem_gb"`
+	RunningInstances  int       `json:"running_instances"`
+	ImpairedInstances []string  `json:"impaired_instances,omitempty"`
+}
+
+// DescribeHostsOutput is returned by the spinifex.nodes.hosts NATS topic,
+// sorted by node name.
+type DescribeHostsOutput struct {
+	Hosts []HostInfo `json:"hosts"`
+}
@@ -5,3 +5,67 @@ type IGWEvent struct {
 	InternetGatewayId string `json:"internet_gateway_id"`
 	VpcId             string `json:"vpc_id"`
 }
+
+// DNSRecordEvent is published on vpc.dns-register when a VPC instance starts
+// running, for vpcd to resolve its Hostname and, when the node has a DNS
+// zone, its FQDN to PrivateIP inside the VPC. Register is an upsert; vpcd
+// drops the records with the instance's network interface.
+type DNSRecordEvent struct {
+	InstanceID string `json:"instance_id"`
+	AccountID  string `json:"account_id"`
+	FQDN       string `json:"fqdn,omitempty"`
+	PrivateIP  string `json:"private_ip,omitempty"`
+	VpcId      string `json:"vpc_id,omitempty"`
+	Hostname   string `json:"hostname,omitempty"`
+}
+
+// Event is the EventBridge-style envelope the daemon publishes on the
+// subjects.Events* subjects, e.g. detail-type "EC2 Instance State-change
+// Notification" with an InstanceStateChangeDetail.
+type Event struct {
+	Version    string   `json:"version"`
+	ID         string   `json:"id"`
+	DetailType string   `json:"detail-type"`
+	Source     string   `json:"source"`
+	Account    string   `json:"account"`
+	Time       string   `json:"time"`
+	Region     string   `json:"region"`
+	Resources  []string `json:"resources"`
+	Detail     any      `json:"detail"`
+}
+
+// InstanceStateChangeDetail is the detail of an instance state-change event.
+// StateReason is the state reason code, e.g. "Server.InternalError" when the
+// instance crashed.
+type InstanceStateChangeDetail struct {
+	InstanceID    string `json:"instance-id"`
+	State         string `json:"state"`
+	PreviousState string `json:"previous-state"`
+	StateReason   string `json:"state-reason,omitempty"`
+}
+
+// SpotInterruptionDetail is the detail of an interruption warning, sent
+// when an interruptible instance is given notice.
+type SpotInterruptionDetail struct {
+	InstanceID     string `json:"instance-id"`
+	InstanceAction string `json:"instance-action"`
+}
+
+// SpotInstanceAction is the spot/instance-action metadata document of an
+// interruptible instance that has been given notice: the action taken and
+// when, in RFC 3339.
+type SpotInstanceAction struct {
+	Action string `json:"action"`
+	Time   string `json:"time"`
+}
+
+// VolumeNotificationDetail is the detail of a volume attach or detach event.
+// Event is "attachVolume" or "detachVolume"; Result is "attached" or
+// "available".
+type VolumeNotificationDetail struct {
+	Event      string `json:"event"`
+	Result     string `json:"result"`
+	VolumeID   string `json:"volume-id"`
+	InstanceID string `json:"instance-id"`
+	Device     string `json:"device,omitempty"`
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Clock is the source of the current time for timestamps reported by the
+// API, such as LaunchTime, volume CreateTime and attachment AttachTime.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock reads the host clock.
+type SystemClock struct{}
+
+// Now returns the current time in UTC, truncated to the millisecond
+// precision EC2 timestamps carry, so JSON and XML responses serialize the
+// same RFC3339 value.
+func (SystemClock) Now() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+var apiClock atomic.Value // of clockHolder
+
+// clockHolder lets apiClock hold Clocks of different concrete types.
+type clockHolder struct{ Clock }
+
+func init() {
+	apiClock.Store(clockHolder{SystemClock{}})
+}
+
+// Now returns the current time from the API clock. Use it for every
+// timestamp a response reports.
+func Now() time.Time {
+	return apiClock.Load().(clockHolder).Now()
+}
+
+// SetClock replaces the API clock and returns a function restoring the
+// previous one. It is meant for tests.
+func SetClock(c Clock) (restore func()) {
+	prev := apiClock.Swap(clockHolder{c})
+	return func() { apiClock.Store(prev) }
+}
@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSystemClock(t *testing.T) {
+	now := SystemClock{}.Now()
+	assert.Equal(t, time.UTC, now.Location())
+	assert.Equal(t, now, now.Truncate(time.Millisecond))
+	assert.WithinDuration(t, time.Now(), now, time.Second)
+}
+
+func TestSetClock(t *testing.T) {
+	fixed := time.Date(2026, 3, 4, 5, 6, 7, 890_000_000, time.UTC)
+	restore := SetClock(testutil.NewFakeClock(fixed))
+	assert.Equal(t, fixed, Now())
+	restore()
+	assert.WithinDuration(t, time.Now(), Now(), time.Second)
+}
+
+func TestClockTimestampsSerializeAsRFC3339UTC(t *testing.T) {
+	defer SetClock(testutil.NewFakeClock(time.Date(2026, 3, 4, 5, 6, 7, 890_000_000, time.UTC)))()
+	vol := ec2.Volume{VolumeId: aws.String("vol-1"), CreateTime: aws.Time(Now())}
+
+	data, err := json.Marshal(vol)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"CreateTime":"2026-03-04T05:06:07.89Z"`)
+
+	data, err = MarshalToXML(GenerateXMLPayload("CreateVolumeResponse", vol))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "<createTime>2026-03-04T05:06:07.89Z</createTime>")
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
@@ -10,6 +11,8 @@ import (
 	"os"
 	"time"
 
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
+	"github.com/mulgadc/spinifex/spinifex/tracing"
 	"github.com/nats-io/nats.go"
 )
 
@@ -25,6 +28,12 @@ var (
 // handling and logging. If token is non-empty, token authentication is used.
 // If caCertPath is non-empty, TLS is enabled using the given CA certificate.
 func ConnectNATS(host, token, caCertPath string) (*nats.Conn, error) {
+	return connectNATS(host, token, caCertPath, nil)
+}
+
+// connectNATS is ConnectNATS with an optional token source, which replaces
+// token when set.
+func connectNATS(host, token, caCertPath string, tokenFn func() string) (*nats.Conn, error) {
 	opts := []nats.Option{
 		nats.ReconnectWait(time.Second),
 		nats.MaxReconnects(-1),
@@ -36,7 +45,9 @@ func ConnectNATS(host, token, caCertPath string) (*nats.Conn, error) {
 		}),
 	}
 
-	if token != "" {
+	if tokenFn != nil {
+		opts = append(opts, nats.TokenHandler(tokenFn))
+	} else if token != "" {
 		opts = append(opts, nats.Token(token))
 	}
 
@@ -67,6 +78,7 @@ func ConnectNATS(host, token, caCertPath string) (*nats.Conn, error) {
 type retryConfig struct {
 	maxWait    time.Duration
 	retryDelay time.Duration
+	tokenFn    func() string
 }
 
 // RetryOption configures ConnectNATSWithRetry behavior.
@@ -82,6 +94,13 @@ func WithRetryDelay(d time.Duration) RetryOption {
 	return func(c *retryConfig) { c.retryDelay = d }
 }
 
+// WithTokenSource has the connection read its token from fn on every
+// connect and reconnect instead of using a fixed token, so a rotated token
+// is picked up without building a new connection.
+func WithTokenSource(fn func() string) RetryOption {
+	return func(c *retryConfig) { c.tokenFn = fn }
+}
+
 // ConnectNATSWithRetry calls ConnectNATS in a retry loop with exponential
 // backoff. It retries for up to 5 minutes (default) before giving up. TLS
 // configuration errors (ErrCACertRead, ErrCACertParse) are permanent and
@@ -97,7 +116,7 @@ func ConnectNATSWithRetry(host, token, caCertPath string, opts ...RetryOption) (
 
 	start := time.Now()
 	for {
-		nc, err := ConnectNATS(host, token, caCertPath)
+		nc, err := connectNATS(host, token, caCertPath, cfg.tokenFn)
 		if err == nil {
 			if time.Since(start) > time.Second {
 				slog.Info("NATS connection established", "elapsed", time.Since(start).Round(time.Second))
@@ -125,20 +144,92 @@ func ConnectNATSWithRetry(host, token, caCertPath string, opts ...RetryOption) (
 // AWS account ID from the gateway to daemon handlers.
 const AccountIDHeader = "X-Account-ID"
 
+// RequestIDHeader is the NATS message header key carrying the ID of the API
+// request a message serves, which error replies echo back and handlers log.
+const RequestIDHeader = "X-Request-ID"
+
+type requestIDKey struct{}
+
+// WithRequestID returns ctx carrying the ID of the API request it serves.
+// NATSRequestContext passes it on in RequestIDHeader.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestIDFromContext returns the API request ID ctx carries, or empty
+// string if it has none.
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// Respond answers msg with reply, marking it with awserrors.ReplyHeader so
+// the requester can tell a result from an error without inspecting it.
+func Respond(msg *nats.Msg, reply awserrors.Reply) error {
+	kind, data, err := reply.Body()
+	if err != nil {
+		return fmt.Errorf("marshal reply: %w", err)
+	}
+	out := nats.NewMsg(msg.Reply)
+	out.Header.Set(awserrors.ReplyHeader, kind)
+	out.Data = data
+	return msg.RespondMsg(out)
+}
+
+// RespondResult answers msg with v as the result.
+func RespondResult(msg *nats.Msg, v any) error {
+	return Respond(msg, awserrors.ResultReply(v))
+}
+
+// RespondError answers msg with err as an AWS error carrying msg's request
+// ID. Errors that are not AWS error codes are sent as InternalError.
+func RespondError(msg *nats.Msg, err error) error {
+	return Respond(msg, awserrors.ErrorReply(err, RequestIDFromMsg(msg)))
+}
+
+// DecodeReply returns the reply envelope of a NATS response. A response
+// without awserrors.ReplyHeader, from a service that predates the envelope,
+// is an error when its body is an error payload and a result otherwise.
+func DecodeReply(msg *nats.Msg) awserrors.Reply {
+	if kind := msg.Header.Get(awserrors.ReplyHeader); kind != "" {
+		reply, err := awserrors.ParseReply(kind, msg.Data)
+		if err != nil {
+			slog.Warn("Malformed NATS reply", "subject", msg.Subject, "err", err)
+			return awserrors.Reply{Err: &awserrors.Error{Code: awserrors.ErrorServerInternal}}
+		}
+		return reply
+	}
+	if responseError, err := ValidateErrorPayload(msg.Data); err != nil {
+		return awserrors.Reply{Err: ResponseErrorToError(responseError)}
+	}
+	return awserrors.Reply{Result: msg.Data}
+}
+
 // NATSRequest performs a NATS request-response with JSON marshaling.
 // It marshals the input, sends to the given subject with the X-Account-ID
 // header, validates the response for error payloads, and unmarshals the
 // successful response into Out. Handlers can ignore the account ID if the
 // operation is unscoped (e.g. DescribeInstanceTypes).
 func NATSRequest[Out any](conn *nats.Conn, subject string, input any, timeout time.Duration, accountID string) (*Out, error) {
+	return NATSRequestContext[Out](context.Background(), conn, subject, input, timeout, accountID)
+}
+
+// NATSRequestContext is NATSRequest carrying the trace context and request ID
+// of ctx in the request's headers, so the handler's spans join the caller's
+// trace and its logs and errors name the API request.
+func NATSRequestContext[Out any](ctx context.Context, conn *nats.Conn, subject string, input any, timeout time.Duration, accountID string) (*Out, error) {
 	jsonData, err := json.Marshal(input)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal input: %w", err)
 	}
 
-	reqMsg := nats.NewMsg(subject)
+	reqMsg := nats.NewMsg(Subject(subject))
 	reqMsg.Data = jsonData
 	reqMsg.Header.Set(AccountIDHeader, accountID)
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		reqMsg.Header.Set(RequestIDHeader, requestID)
+	}
+	tracing.Inject(ctx, reqMsg.Header)
 
 	msg, err := conn.RequestMsg(reqMsg, timeout)
 	if err != nil {
@@ -148,16 +239,10 @@ func NATSRequest[Out any](conn *nats.Conn, subject string, input any, timeout ti
 		return nil, fmt.Errorf("NATS request failed: %w", err)
 	}
 
-	responseError, err := ValidateErrorPayload(msg.Data)
-	if err != nil {
-		return nil, errors.New(*responseError.Code)
-	}
-
 	var output Out
-	if err := json.Unmarshal(msg.Data, &output); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	if err := DecodeReply(msg).Decode(&output); err != nil {
+		return nil, err
 	}
-
 	return &output, nil
 }
 
@@ -191,7 +276,7 @@ func NATSScatterGather[Out any](conn *nats.Conn, subject string, input any, time
 	}
 	defer sub.Unsubscribe()
 
-	pubMsg := nats.NewMsg(subject)
+	pubMsg := nats.NewMsg(Subject(subject))
 	pubMsg.Reply = inbox
 	pubMsg.Data = jsonData
 	pubMsg.Header.Set(AccountIDHeader, accountID)
@@ -233,17 +318,17 @@ func NATSScatterGather[Out any](conn *nats.Conn, subject string, input any, time
 
 		responsesReceived++
 
-		responseError, err := ValidateErrorPayload(msg.Data)
-		if err != nil {
-			slog.Debug("ScatterGather: skipping error response", "code", *responseError.Code, "subject", subject)
-			lastErr = errors.New(*responseError.Code)
+		reply := DecodeReply(msg)
+		if reply.Err != nil {
+			slog.Debug("ScatterGather: skipping error response", "code", reply.Err.Code, "subject", subject)
+			lastErr = reply.Err
 			continue
 		}
 
 		var output Out
-		if err := json.Unmarshal(msg.Data, &output); err != nil {
+		if err := reply.Decode(&output); err != nil {
 			slog.Debug("ScatterGather: skipping malformed response", "subject", subject, "err", err)
-			lastErr = fmt.Errorf("failed to unmarshal response: %w", err)
+			lastErr = err
 			continue
 		}
 
@@ -267,7 +352,7 @@ func PublishEvent(nc *nats.Conn, topic string, event any) {
 		slog.Warn("Failed to marshal event", "topic", topic, "error", err)
 		return
 	}
-	if err := nc.Publish(topic, data); err != nil {
+	if err := nc.Publish(Subject(topic), data); err != nil {
 		slog.Warn("Failed to publish event", "topic", topic, "error", err)
 	}
 }
@@ -284,7 +369,7 @@ func RequestEvent(nc *nats.Conn, topic string, event any, timeout time.Duration)
 	if err != nil {
 		return fmt.Errorf("marshal %s event: %w", topic, err)
 	}
-	resp, err := nc.Request(topic, data, timeout)
+	resp, err := nc.Request(Subject(topic), data, timeout)
 	if err != nil {
 		return fmt.Errorf("%s request: %w", topic, err)
 	}
@@ -310,3 +395,12 @@ func AccountIDFromMsg(msg *nats.Msg) string {
 	}
 	return msg.Header.Get(AccountIDHeader)
 }
+
+// RequestIDFromMsg returns the ID of the API request a NATS message serves,
+// or empty string if the header is not set.
+func RequestIDFromMsg(msg *nats.Msg) string {
+	if msg == nil || msg.Header == nil {
+		return ""
+	}
+	return msg.Header.Get(RequestIDHeader)
+}
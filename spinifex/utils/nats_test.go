@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"crypto/rand"
@@ -16,6 +17,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
 	"github.com/mulgadc/spinifex/spinifex/testutil"
 	"github.com/nats-io/nats-server/v2/server"
 	"github.com/nats-io/nats.go"
@@ -326,6 +328,77 @@ func TestNATSRequest_InvalidUnmarshal(t *testing.T) {
 	assert.Contains(t, err.Error(), "unmarshal")
 }
 
+func TestRespond_ReplyEnvelope(t *testing.T) {
+	ns := startTestNATSServer(t)
+
+	nc, err := nats.Connect(ns.ClientURL())
+	require.NoError(t, err)
+	defer nc.Close()
+
+	_, err = nc.Subscribe("test.envelope", func(msg *nats.Msg) {
+		if string(msg.Data) == `"fail"` {
+			RespondError(msg, awserrors.WithDetail(awserrors.ErrorInvalidInstanceIDNotFound, "i-missing"))
+			return
+		}
+		RespondResult(msg, map[string]string{"status": "ok"})
+	})
+	require.NoError(t, err)
+
+	req := nats.NewMsg("test.envelope")
+	req.Header.Set(RequestIDHeader, "req-1")
+	req.Data = []byte(`"fail"`)
+	resp, err := nc.RequestMsg(req, 2*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, awserrors.ReplyError, resp.Header.Get(awserrors.ReplyHeader))
+	reply := DecodeReply(resp)
+	require.NotNil(t, reply.Err)
+	assert.Equal(t, awserrors.ErrorInvalidInstanceIDNotFound, reply.Err.Code)
+	assert.Equal(t, "i-missing", reply.Err.Message)
+	assert.Equal(t, "req-1", reply.Err.RequestID)
+
+	result, err := NATSRequest[map[string]string](nc, "test.envelope", "ok", 2*time.Second, "")
+	require.NoError(t, err)
+	assert.Equal(t, "ok", (*result)["status"])
+}
+
+func TestNATSRequestContext_RequestID(t *testing.T) {
+	ns := startTestNATSServer(t)
+
+	nc, err := nats.Connect(ns.ClientURL())
+	require.NoError(t, err)
+	defer nc.Close()
+
+	_, err = nc.Subscribe("test.reqid", func(msg *nats.Msg) {
+		RespondResult(msg, RequestIDFromMsg(msg))
+	})
+	require.NoError(t, err)
+
+	ctx := WithRequestID(context.Background(), "req-1")
+	result, err := NATSRequestContext[string](ctx, nc, "test.reqid", struct{}{}, 2*time.Second, "")
+	require.NoError(t, err)
+	assert.Equal(t, "req-1", *result)
+
+	result, err = NATSRequest[string](nc, "test.reqid", struct{}{}, 2*time.Second, "")
+	require.NoError(t, err)
+	assert.Empty(t, *result)
+}
+
+func TestDecodeReply_Legacy(t *testing.T) {
+	reply := DecodeReply(&nats.Msg{Data: GenerateErrorPayload(awserrors.ErrorAuthFailure)})
+	require.NotNil(t, reply.Err)
+	assert.Equal(t, awserrors.ErrorAuthFailure, reply.Err.Code)
+
+	reply = DecodeReply(&nats.Msg{Data: []byte(`{"status":"running"}`)})
+	assert.Nil(t, reply.Err)
+	assert.JSONEq(t, `{"status":"running"}`, string(reply.Result))
+
+	msg := nats.NewMsg("test")
+	msg.Header.Set(awserrors.ReplyHeader, "bogus")
+	reply = DecodeReply(msg)
+	require.NotNil(t, reply.Err)
+	assert.Equal(t, awserrors.ErrorServerInternal, reply.Err.Code)
+}
+
 // --- NATSRequest with account ID tests ---
 
 func TestNATSRequest_AccountIDHeader(t *testing.T) {
@@ -573,3 +646,28 @@ func TestConnectNATSWithRetry_TLSErrorNoRetry(t *testing.T) {
 	assert.Contains(t, err.Error(), "NATS TLS configuration error")
 	assert.Less(t, elapsed, time.Second, "should fail immediately without retrying")
 }
+
+func TestConnectNATSWithRetry_TokenSource(t *testing.T) {
+	opts := &server.Options{
+		Host:          "127.0.0.1",
+		Port:          -1,
+		NoLog:         true,
+		NoSigs:        true,
+		Authorization: "rotated-token",
+	}
+
+	ns, err := server.NewServer(opts)
+	require.NoError(t, err)
+	go ns.Start()
+	require.True(t, ns.ReadyForConnections(5*time.Second))
+	t.Cleanup(func() { ns.Shutdown() })
+
+	// The source wins over the fixed token.
+	nc, err := ConnectNATSWithRetry(ns.ClientURL(), "stale-token", "",
+		WithTokenSource(func() string { return "rotated-token" }),
+		WithMaxWait(time.Second),
+	)
+	require.NoError(t, err)
+	defer nc.Close()
+	assert.True(t, nc.IsConnected())
+}
@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"sync/atomic"
+)
+
+// Resource IDs are {prefix}-{17 hex chars}, as in AWS. The 68 bits behind
+// the hex are split so that IDs generated on different nodes can't collide:
+// the first 16 bits are the node's tag and the remaining 52 are a counter
+// private to the process, scrambled so consecutive IDs don't look
+// sequential.
+const (
+	idSeqBits = 52
+	idSeqMask = 1<<idSeqBits - 1
+)
+
+// ResourceIDGenerator hands out resource IDs for one node. Its IDs never
+// repeat until the 52-bit counter wraps, and never match those of a
+// generator with a different node tag.
+type ResourceIDGenerator struct {
+	node uint16
+	seq  atomic.Uint64
+}
+
+// NewResourceIDGenerator returns a generator for the node with the given
+// tag. The counter starts at a random point, so a restarted process is as
+// unlikely to reissue an old ID as random IDs were to collide.
+func NewResourceIDGenerator(node uint16) *ResourceIDGenerator {
+	g := &ResourceIDGenerator{node: node}
+	g.seq.Store(randomUint64() & idSeqMask)
+	return g
+}
+
+// Generate returns a new resource ID with the given prefix.
+func (g *ResourceIDGenerator) Generate(prefix string) string {
+	n := g.seq.Add(1) & idSeqMask
+	return fmt.Sprintf("%s-%04x%013x", prefix, g.node, scrambleIDSeq(n))
+}
+
+// scrambleIDSeq maps the counter onto 52 bits that look random. Each step
+// (multiplying by an odd constant modulo 2^52, xoring with a right shift)
+// is a bijection, so distinct counters always give distinct results.
+func scrambleIDSeq(n uint64) uint64 {
+	n = (n * 0x9E3779B97F4A7) & idSeqMask
+	n ^= n >> 26
+	n = (n * 0xBF58476D1CE4D) & idSeqMask
+	n ^= n >> 23
+	return n
+}
+
+// defaultIDGenerator backs GenerateResourceID. It starts with a random node
+// tag so processes that never call SetResourceIDNode, such as the CLI,
+// still get unpredictable IDs.
+var defaultIDGenerator atomic.Pointer[ResourceIDGenerator]
+
+func init() {
+	defaultIDGenerator.Store(NewResourceIDGenerator(uint16(randomUint64())))
+}
+
+// SetResourceIDNode sets the node tag of the IDs GenerateResourceID returns.
+// The daemon calls it at startup with the tag from NodeIDTag.
+func SetResourceIDNode(node uint16) {
+	defaultIDGenerator.Store(NewResourceIDGenerator(node))
+}
+
+// GenerateResourceID generates a unique resource ID with the given prefix.
+// Format: {prefix}-{17 hex chars}, unique across the cluster once the
+// node tag has been set with SetResourceIDNode.
+func GenerateResourceID(prefix string) string {
+	return defaultIDGenerator.Load().Generate(prefix)
+}
+
+// NodeIDTag returns the ID tag of node in a cluster of the given nodes.
+// Tags come from a hash of the node name; when two names hash alike, the
+// one sorting later takes the next free tag. Every node computes the same
+// tags from the same node list, so no two nodes share one.
+func NodeIDTag(node string, nodes []string) uint16 {
+	names := slices.Clone(nodes)
+	if !slices.Contains(names, node) {
+		names = append(names, node)
+	}
+	slices.Sort(names)
+
+	taken := make(map[uint16]bool, len(names))
+	for _, name := range names {
+		tag := hashNodeName(name)
+		for taken[tag] {
+			tag++
+		}
+		taken[tag] = true
+		if name == node {
+			return tag
+		}
+	}
+	return hashNodeName(node)
+}
+
+func hashNodeName(name string) uint16 {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	sum := h.Sum32()
+	return uint16(sum>>16 ^ sum)
+}
+
+func randomUint64() uint64 {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic("crypto/rand failed: " + err.Error())
+	}
+	return binary.LittleEndian.Uint64(b[:])
+}
@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourceIDGenerator_NodesNeverCollide(t *testing.T) {
+	nodes := []string{"node-1", "node-2"}
+	gens := []*ResourceIDGenerator{
+		NewResourceIDGenerator(NodeIDTag("node-1", nodes)),
+		NewResourceIDGenerator(NodeIDTag("node-2", nodes)),
+	}
+	// Start both counters at the same point, the worst case for collisions.
+	for _, g := range gens {
+		g.seq.Store(0)
+	}
+
+	const workers, perWorker = 4, 25_000
+	var mu sync.Mutex
+	seen := make(map[string]bool, len(gens)*workers*perWorker)
+	var wg sync.WaitGroup
+	for _, g := range gens {
+		for range workers {
+			wg.Go(func() {
+				ids := make([]string, 0, perWorker)
+				for range perWorker {
+					ids = append(ids, g.Generate("i"))
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				for _, id := range ids {
+					if seen[id] {
+						t.Errorf("duplicate ID %s", id)
+					}
+					seen[id] = true
+				}
+			})
+		}
+	}
+	wg.Wait()
+	assert.Len(t, seen, len(gens)*workers*perWorker)
+}
+
+func TestResourceIDGenerator_Format(t *testing.T) {
+	g := NewResourceIDGenerator(0xab12)
+	id := g.Generate("vol")
+	require.Len(t, id, len("vol-")+17)
+	assert.Equal(t, "vol-ab12", id[:8], "IDs lead with the node tag")
+	assert.Regexp(t, `^vol-[0-9a-f]{17}$`, id)
+
+	// Consecutive counters don't give consecutive-looking IDs.
+	g.seq.Store(0)
+	a, b := g.Generate("i"), g.Generate("i")
+	assert.NotEqual(t, a[:len(a)-1], b[:len(b)-1])
+}
+
+func TestScrambleIDSeq_Bijective(t *testing.T) {
+	seen := make(map[uint64]bool, 1<<16)
+	for n := range uint64(1 << 16) {
+		s := scrambleIDSeq(n)
+		require.LessOrEqual(t, s, uint64(idSeqMask))
+		require.False(t, seen[s], "scramble collision at %d", n)
+		seen[s] = true
+	}
+}
+
+func TestNodeIDTag(t *testing.T) {
+	nodes := make([]string, 0, 500)
+	for i := range cap(nodes) {
+		nodes = append(nodes, fmt.Sprintf("node-%d", i))
+	}
+
+	tags := make(map[uint16]string, len(nodes))
+	for _, node := range nodes {
+		tag := NodeIDTag(node, nodes)
+		if prev, ok := tags[tag]; ok {
+			t.Fatalf("nodes %s and %s share tag %04x", prev, node, tag)
+		}
+		tags[tag] = node
+	}
+
+	// The tag doesn't depend on the order nodes are listed in.
+	reversed := make([]string, len(nodes))
+	for i, node := range nodes {
+		reversed[len(nodes)-1-i] = node
+	}
+	assert.Equal(t, NodeIDTag("node-7", nodes), NodeIDTag("node-7", reversed))
+
+	// A node missing from the list still gets its own hash.
+	assert.Equal(t, hashNodeName("solo"), NodeIDTag("solo", nil))
+}
@@ -0,0 +1,36 @@
+package utils
+
+import "sync/atomic"
+
+var subjectPrefix atomic.Value // of string
+
+func init() {
+	subjectPrefix.Store("")
+}
+
+// Subject qualifies a NATS subject with the deployment's subject prefix, so
+// that several clusters can share one NATS system: with prefix "acme",
+// "ec2.RunInstances" becomes "acme.ec2.RunInstances". Every subject a
+// service subscribes, publishes or sends a request to goes through Subject;
+// the NATS helpers in this package apply it themselves.
+func Subject(subject string) string {
+	prefix := subjectPrefix.Load().(string)
+	if prefix == "" {
+		return subject
+	}
+	return prefix + "." + subject
+}
+
+// SubjectPrefix returns the configured subject prefix, or "" when there is
+// none.
+func SubjectPrefix() string {
+	return subjectPrefix.Load().(string)
+}
+
+// SetSubjectPrefix sets the prefix Subject adds. Services call it once at
+// startup, before connecting to NATS, with the configured NATS subject
+// prefix. It returns a function restoring the previous prefix.
+func SetSubjectPrefix(prefix string) (restore func()) {
+	prev := subjectPrefix.Swap(prefix)
+	return func() { subjectPrefix.Store(prev) }
+}
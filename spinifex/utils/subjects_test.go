@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubject(t *testing.T) {
+	assert.Equal(t, "ec2.RunInstances", Subject("ec2.RunInstances"))
+
+	restore := SetSubjectPrefix("acme")
+	assert.Equal(t, "acme", SubjectPrefix())
+	assert.Equal(t, "acme.ec2.RunInstances", Subject("ec2.RunInstances"))
+
+	restore()
+	assert.Equal(t, "", SubjectPrefix())
+	assert.Equal(t, "ec2.RunInstances", Subject("ec2.RunInstances"))
+}
+
+func TestSubjectPrefix_Isolation(t *testing.T) {
+	ns := startTestNATSServer(t)
+	nc, err := nats.Connect(ns.ClientURL())
+	require.NoError(t, err)
+	defer nc.Close()
+
+	type Resp struct {
+		Cluster string `json:"cluster"`
+	}
+
+	// respond subscribes a responder for ec2.Ping under the current prefix,
+	// recording the subjects it receives.
+	respond := func(cluster string) chan string {
+		subjects := make(chan string, 10)
+		_, err := nc.Subscribe(Subject("ec2.Ping"), func(msg *nats.Msg) {
+			subjects <- msg.Subject
+			data, _ := json.Marshal(Resp{Cluster: cluster})
+			msg.Respond(data)
+		})
+		require.NoError(t, err)
+		return subjects
+	}
+
+	restore := SetSubjectPrefix("cluster-a")
+	defer restore()
+	seenA := respond("a")
+
+	result, err := NATSRequest[Resp](nc, "ec2.Ping", struct{}{}, time.Second, "")
+	require.NoError(t, err)
+	assert.Equal(t, "a", result.Cluster)
+	assert.Equal(t, "cluster-a.ec2.Ping", <-seenA)
+
+	// A second cluster on the same NATS system doesn't reach the first.
+	SetSubjectPrefix("cluster-b")
+	_, err = NATSRequest[Resp](nc, "ec2.Ping", struct{}{}, time.Second, "")
+	require.ErrorIs(t, err, nats.ErrNoResponders)
+
+	seenB := respond("b")
+	result, err = NATSRequest[Resp](nc, "ec2.Ping", struct{}{}, time.Second, "")
+	require.NoError(t, err)
+	assert.Equal(t, "b", result.Cluster)
+	assert.Equal(t, "cluster-b.ec2.Ping", <-seenB)
+
+	// Events are prefixed the same way.
+	events, err := nc.SubscribeSync("*.vpc.>")
+	require.NoError(t, err)
+	PublishEvent(nc, "vpc.create", struct{}{})
+	msg, err := events.NextMsg(time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "cluster-b.vpc.create", msg.Subject)
+
+	require.NoError(t, nc.Flush())
+	assert.Empty(t, seenA, "cluster-a responder received cluster-b traffic")
+}
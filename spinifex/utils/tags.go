@@ -1,8 +1,13 @@
 package utils
 
 import (
+	"errors"
+	"maps"
+	"slices"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
 )
 
 // MapToEC2Tags converts a map[string]string to a slice of EC2 Tag pointers.
@@ -34,3 +39,45 @@ func ExtractTags(tagSpecs []*ec2.TagSpecification, resourceType string) map[stri
 	}
 	return tags
 }
+
+// MaxTagsPerResource is the AWS limit on tags per resource.
+const MaxTagsPerResource = 50
+
+// MergeDefaultTags returns the tags for a new resource of resourceType: the
+// defaults overlaid with the resource's TagSpecifications, so an explicit tag
+// wins over a default with the same key. Defaults count toward the tag limit.
+func MergeDefaultTags(tagSpecs []*ec2.TagSpecification, resourceType string, defaults map[string]string) (map[string]string, error) {
+	tags := make(map[string]string, len(defaults))
+	maps.Copy(tags, defaults)
+	maps.Copy(tags, ExtractTags(tagSpecs, resourceType))
+	if len(tags) > MaxTagsPerResource {
+		return nil, errors.New(awserrors.ErrorTagLimitExceeded)
+	}
+	return tags, nil
+}
+
+// WithDefaultTags returns tagSpecs with the defaults merged into the
+// specification for each of resourceTypes, as MergeDefaultTags does.
+// Specifications for other resource types are kept as they are.
+func WithDefaultTags(tagSpecs []*ec2.TagSpecification, defaults map[string]string, resourceTypes ...string) ([]*ec2.TagSpecification, error) {
+	if len(defaults) == 0 {
+		return tagSpecs, nil
+	}
+	merged := make([]*ec2.TagSpecification, 0, len(tagSpecs)+len(resourceTypes))
+	for _, spec := range tagSpecs {
+		if spec == nil || !slices.Contains(resourceTypes, aws.StringValue(spec.ResourceType)) {
+			merged = append(merged, spec)
+		}
+	}
+	for _, resourceType := range resourceTypes {
+		tags, err := MergeDefaultTags(tagSpecs, resourceType, defaults)
+		if err != nil {
+			return nil, err
+		}
+		merged = append(merged, &ec2.TagSpecification{
+			ResourceType: aws.String(resourceType),
+			Tags:         MapToEC2Tags(tags),
+		})
+	}
+	return merged, nil
+}
@@ -1,11 +1,14 @@
 package utils
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/awserrors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestExtractTags(t *testing.T) {
@@ -34,3 +37,53 @@ func TestExtractTags(t *testing.T) {
 	assert.NotNil(t, empty)
 	assert.Empty(t, empty)
 }
+
+func TestMergeDefaultTags(t *testing.T) {
+	specs := []*ec2.TagSpecification{{
+		ResourceType: aws.String("volume"),
+		Tags:         []*ec2.Tag{{Key: aws.String("team"), Value: aws.String("storage")}},
+	}}
+	defaults := map[string]string{"team": "platform", "cost-centre": "1234"}
+
+	got, err := MergeDefaultTags(specs, "volume", defaults)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "storage", "cost-centre": "1234"}, got)
+	assert.Equal(t, "platform", defaults["team"], "defaults must not be modified")
+
+	got, err = MergeDefaultTags(specs, "snapshot", nil)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+
+	// Defaults count toward the per-resource limit.
+	many := make(map[string]string, MaxTagsPerResource)
+	for i := range MaxTagsPerResource {
+		many[fmt.Sprintf("default-%d", i)] = "x"
+	}
+	_, err = MergeDefaultTags(specs, "volume", many)
+	assert.EqualError(t, err, awserrors.ErrorTagLimitExceeded)
+}
+
+func TestWithDefaultTags(t *testing.T) {
+	specs := []*ec2.TagSpecification{
+		{
+			ResourceType: aws.String("instance"),
+			Tags:         []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String("web-1")}},
+		},
+		{
+			ResourceType: aws.String("network-interface"),
+			Tags:         []*ec2.Tag{{Key: aws.String("Name"), Value: aws.String("eni-web-1")}},
+		},
+	}
+
+	// Nothing to merge leaves the specifications untouched.
+	got, err := WithDefaultTags(specs, nil, "instance", "volume")
+	require.NoError(t, err)
+	assert.Equal(t, specs, got)
+
+	got, err = WithDefaultTags(specs, map[string]string{"Name": "unnamed", "owner": "ops"}, "instance", "volume")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"Name": "web-1", "owner": "ops"}, ExtractTags(got, "instance"))
+	assert.Equal(t, map[string]string{"Name": "unnamed", "owner": "ops"}, ExtractTags(got, "volume"))
+	assert.Equal(t, map[string]string{"Name": "eni-web-1"}, ExtractTags(got, "network-interface"))
+	assert.Len(t, got, 3)
+}
@@ -3,9 +3,7 @@ package utils
 import (
 	"bytes"
 	"context"
-	"crypto/rand"
 	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
@@ -30,16 +28,6 @@ import (
 	"github.com/pterm/pterm"
 )
 
-// GenerateResourceID generates a unique resource ID with the given prefix.
-// Format: {prefix}-{17 hex chars} using crypto/rand.
-func GenerateResourceID(prefix string) string {
-	b := make([]byte, 9)
-	if _, err := rand.Read(b); err != nil {
-		panic("crypto/rand failed: " + err.Error())
-	}
-	return prefix + "-" + hex.EncodeToString(b)[:17]
-}
-
 // Convert interface to XML
 func MarshalToXML(payload any) ([]byte, error) {
 	var buf bytes.Buffer
@@ -60,11 +48,21 @@ func MarshalToXML(payload any) ([]byte, error) {
 
 // wrapWithLocation decorates payload with the requested locationName tag.
 func GenerateXMLPayload(locationName string, payload any) any {
+	return GenerateNamespacedXMLPayload(locationName, "", payload)
+}
+
+// GenerateNamespacedXMLPayload is GenerateXMLPayload with the element in the
+// XML namespace namespace, as EC2 query protocol responses are.
+func GenerateNamespacedXMLPayload(locationName, namespace string, payload any) any {
+	tag := `locationName:"` + locationName + `"`
+	if namespace != "" {
+		tag += ` xmlURI:"` + namespace + `"`
+	}
 	t := reflect.StructOf([]reflect.StructField{
 		{
 			Name: "Value",
 			Type: reflect.TypeOf(payload),
-			Tag:  reflect.StructTag(`locationName:"` + locationName + `"`),
+			Tag:  reflect.StructTag(tag),
 		},
 	})
 
@@ -118,16 +116,51 @@ func GenerateErrorPayload(code string) (jsonResponse []byte) {
 	return jsonResponse
 }
 
-// Validate the payload is an ec2.ResponseError
+// GenerateErrorPayloadWithDetail is GenerateErrorPayload with a client-safe
+// detail message carried in the Message field.
+func GenerateErrorPayloadWithDetail(code, detail string) (jsonResponse []byte) {
+	var responseError ec2.ResponseError
+	responseError.Code = aws.String(code)
+	if detail != "" {
+		responseError.Message = aws.String(detail)
+	}
+
+	jsonResponse, err := json.Marshal(responseError)
+	if err != nil {
+		slog.Error("GenerateErrorPayloadWithDetail could not marshal JSON payload", "err", err)
+		return nil
+	}
+
+	return jsonResponse
+}
+
+// ResponseErrorToError converts a decoded error payload back into an
+// *awserrors.Error, keeping any detail message (see awserrors.Detail).
+func ResponseErrorToError(responseError ec2.ResponseError) *awserrors.Error {
+	if responseError.Code == nil {
+		return &awserrors.Error{Code: awserrors.ErrorServerInternal}
+	}
+	return &awserrors.Error{Code: *responseError.Code, Message: aws.StringValue(responseError.Message)}
+}
+
+// Validate the payload is an ec2.ResponseError. The error bodies of reply
+// envelopes (awserrors.Error) are recognised too, without their request ID.
 func ValidateErrorPayload(payload []byte) (responseError ec2.ResponseError, err error) {
 	decoder := json.NewDecoder(bytes.NewReader(payload))
 	decoder.DisallowUnknownFields()
 
-	err = decoder.Decode(&responseError)
+	var payloadError struct {
+		Code      *string
+		Message   *string
+		RequestId *string
+	}
+	err = decoder.Decode(&payloadError)
 
-	if err == nil && responseError.Code != nil {
+	if err == nil && payloadError.Code != nil {
 		// Successfully decoded as ResponseError AND has a non-nil Code field
 		// This is a real error response
+		responseError.Code = payloadError.Code
+		responseError.Message = payloadError.Message
 		return responseError, errors.New("ResponseError detected")
 	}
 
@@ -324,6 +357,21 @@ func HashMAC(id string) string {
 	return net.HardwareAddr(b).String()
 }
 
+// HashMACWithOUI returns a deterministic MAC for id under the given 3-octet
+// OUI, with the low 24 bits SHA-256-derived. A nil OUI falls back to HashMAC.
+// The smaller hash space means collisions are more likely than with HashMAC:
+// 1% at ~580 ids, 50% at ~4.8k.
+func HashMACWithOUI(oui net.HardwareAddr, id string) string {
+	if len(oui) != 3 {
+		return HashMAC(id)
+	}
+	sum := sha256.Sum256([]byte(id))
+	b := make([]byte, 6)
+	copy(b, oui)
+	copy(b[3:], sum[:3])
+	return net.HardwareAddr(b).String()
+}
+
 func dirExists(path string) bool {
 	info, err := os.Stat(path)
 	if os.IsNotExist(err) {
@@ -741,6 +741,16 @@ func TestGenerateXMLPayload(t *testing.T) {
 	assert.Contains(t, xmlStr, "test")
 }
 
+func TestGenerateNamespacedXMLPayload(t *testing.T) {
+	type Inner struct {
+		Name string `locationName:"name" type:"string"`
+	}
+
+	xmlBytes, err := MarshalToXML(GenerateNamespacedXMLPayload("DescribeInstancesResponse", "http://ec2.amazonaws.com/doc/2016-11-15/", Inner{Name: "test"}))
+	require.NoError(t, err)
+	assert.Equal(t, `<DescribeInstancesResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/"><name>test</name></DescribeInstancesResponse>`, string(xmlBytes))
+}
+
 func TestHumanBytes(t *testing.T) {
 	tests := []struct {
 		name string
@@ -1045,6 +1055,17 @@ func TestHashMAC_IdSeparates(t *testing.T) {
 	assert.NotEqual(t, a, b)
 }
 
+func TestHashMACWithOUI(t *testing.T) {
+	oui := net.HardwareAddr{0x0a, 0x5f, 0x00}
+	mac := HashMACWithOUI(oui, "eni-abc123")
+	assert.Equal(t, "0a:5f:00", mac[:8])
+	assert.Equal(t, mac, HashMACWithOUI(oui, "eni-abc123"))
+	assert.NotEqual(t, mac, HashMACWithOUI(oui, "eni-def456"))
+
+	// No OUI falls back to the default 02: scheme
+	assert.Equal(t, HashMAC("eni-abc123"), HashMACWithOUI(nil, "eni-abc123"))
+}
+
 func TestHashMAC_Distribution(t *testing.T) {
 	// 100k random ids — 0 collisions expected. 46-bit space, birthday-
 	// paradox 1% at ~1.2M; 100k is well below.
@@ -0,0 +1,32 @@
+package vm
+
+import (
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+// BootPriorityTag is the instance tag ranking instances for restore when a
+// node comes back with less capacity than its instances need, e.g.
+// Key=spinifex:boot-priority, Value=10. Higher values are restored first;
+// untagged instances have priority 0.
+const BootPriorityTag = "spinifex:boot-priority"
+
+// BootPriority returns the instance's BootPriorityTag value, or 0 when the
+// tag is unset or not an integer.
+func (v *VM) BootPriority() int {
+	if v.Instance == nil {
+		return 0
+	}
+	for _, tag := range v.Instance.Tags {
+		if aws.StringValue(tag.Key) != BootPriorityTag {
+			continue
+		}
+		priority, err := strconv.Atoi(aws.StringValue(tag.Value))
+		if err != nil {
+			return 0
+		}
+		return priority
+	}
+	return 0
+}
@@ -0,0 +1,50 @@
+package vm
+
+import "fmt"
+
+// CacheModeTag is the volume tag selecting the host cache mode QEMU uses for
+// the volume, e.g. Key=spinifex:cache-mode, Value=writeback. It is read when
+// the volume is attached, so a change takes effect on the next attach or
+// instance start.
+const CacheModeTag = "spinifex:cache-mode"
+
+// Volume cache modes, named as QEMU's -drive cache= option.
+const (
+	// CacheModeNone bypasses the host page cache and reports a volatile write
+	// cache to the guest, so guest flushes reach storage. The default.
+	CacheModeNone = "none"
+	// CacheModeWriteback buffers writes in the host page cache until the
+	// guest flushes.
+	CacheModeWriteback = "writeback"
+	// CacheModeWritethrough reads through the host page cache and completes
+	// each write only once it is on storage.
+	CacheModeWritethrough = "writethrough"
+	// CacheModeDirectSync bypasses the host page cache and completes each
+	// write only once it is on storage.
+	CacheModeDirectSync = "directsync"
+)
+
+// ParseCacheMode validates a CacheModeTag value, returning CacheModeNone for
+// an empty value. QEMU's unsafe mode, which ignores guest flushes, is not
+// offered.
+func ParseCacheMode(value string) (string, error) {
+	switch value {
+	case "":
+		return CacheModeNone, nil
+	case CacheModeNone, CacheModeWriteback, CacheModeWritethrough, CacheModeDirectSync:
+		return value, nil
+	}
+	return "", fmt.Errorf("unsupported cache mode %q", value)
+}
+
+// CacheModeBlockdevArgs returns the blockdev-add "cache" options and the
+// virtio-blk "write-cache" property that together make up mode, the split
+// QEMU applies to a -drive cache= mode.
+func CacheModeBlockdevArgs(mode string) (cache map[string]any, writeCache string) {
+	direct := mode == CacheModeNone || mode == CacheModeDirectSync || mode == ""
+	writeCache = "off"
+	if mode == CacheModeNone || mode == CacheModeWriteback || mode == "" {
+		writeCache = "on"
+	}
+	return map[string]any{"direct": direct, "no-flush": false}, writeCache
+}
@@ -0,0 +1,45 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCacheMode(t *testing.T) {
+	mode, err := ParseCacheMode("")
+	require.NoError(t, err)
+	assert.Equal(t, CacheModeNone, mode)
+
+	for _, value := range []string{"none", "writeback", "writethrough", "directsync"} {
+		mode, err := ParseCacheMode(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, value, mode)
+	}
+
+	for _, value := range []string{"unsafe", "WriteBack", "direct"} {
+		_, err := ParseCacheMode(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestCacheModeBlockdevArgs(t *testing.T) {
+	tests := []struct {
+		mode       string
+		direct     bool
+		writeCache string
+	}{
+		{mode: CacheModeNone, direct: true, writeCache: "on"},
+		{mode: CacheModeWriteback, direct: false, writeCache: "on"},
+		{mode: CacheModeWritethrough, direct: false, writeCache: "off"},
+		{mode: CacheModeDirectSync, direct: true, writeCache: "off"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			cache, writeCache := CacheModeBlockdevArgs(tt.mode)
+			assert.Equal(t, map[string]any{"direct": tt.direct, "no-flush": false}, cache)
+			assert.Equal(t, tt.writeCache, writeCache)
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package vm
+
+import "fmt"
+
+// CopyModeTag is the volume tag selecting how a volume created from a
+// snapshot or AMI gets its blocks, e.g. Key=spinifex:copy-mode, Value=full.
+// A copy-on-write volume, the default, reads the snapshot's blocks in place
+// and only writes its own; a full copy writes every block of the snapshot
+// into the volume, so it no longer depends on the snapshot or the volume the
+// snapshot was taken from. It is read when the volume is created.
+const CopyModeTag = "spinifex:copy-mode"
+
+// CopyModeTag values.
+const (
+	CopyModeCopyOnWrite = "copy-on-write"
+	CopyModeFull        = "full"
+)
+
+// ParseCopyMode validates a CopyModeTag value, returning CopyModeCopyOnWrite
+// for an empty value.
+func ParseCopyMode(value string) (string, error) {
+	switch value {
+	case "", CopyModeCopyOnWrite:
+		return CopyModeCopyOnWrite, nil
+	case CopyModeFull:
+		return CopyModeFull, nil
+	}
+	return "", fmt.Errorf("unsupported copy mode %q", value)
+}
@@ -0,0 +1,25 @@
+package vm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCopyMode(t *testing.T) {
+	mode, err := ParseCopyMode("")
+	require.NoError(t, err)
+	assert.Equal(t, CopyModeCopyOnWrite, mode)
+
+	for _, value := range []string{CopyModeCopyOnWrite, CopyModeFull} {
+		mode, err := ParseCopyMode(value)
+		require.NoError(t, err, value)
+		assert.Equal(t, value, mode)
+	}
+
+	for _, value := range []string{"Full", "deep", "cow"} {
+		_, err := ParseCopyMode(value)
+		assert.Error(t, err, value)
+	}
+}
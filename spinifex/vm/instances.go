@@ -0,0 +1,146 @@
+package vm
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/mulgadc/spinifex/spinifex/types"
+)
+
+// Instances is the set of VMs a daemon tracks, keyed by instance ID.
+//
+// Mu guards both the map and the mutable fields of every VM in it (Status,
+// Instance, and so on). Prefer the accessor methods, which take Mu for the
+// duration of the call; hold Mu directly only to read or write fields of a
+// VM pointer already obtained from an accessor. The VMs the accessors return
+// are shared, not copies.
+//
+// Each VM's EBSRequests.Mu is ordered after Mu: take Mu first, never the
+// other way round. Code that needs both uses WithVolumes or LockAll. Code
+// holding only EBSRequests.Mu must not call anything that takes Mu
+// (including state persistence) and should not hold it across blocking I/O,
+// since LockAll waits on it while holding Mu; use SnapshotEBSRequests instead.
+type Instances struct {
+	VMS map[string]*VM `json:"vms"`
+	Mu  sync.Mutex     `json:"-"`
+}
+
+// GetVM returns the instance with the given ID.
+func (in *Instances) GetVM(id string) (*VM, bool) {
+	in.Mu.Lock()
+	defer in.Mu.Unlock()
+	v, ok := in.VMS[id]
+	return v, ok
+}
+
+// ListVMs returns a snapshot of the tracked instances sorted by ID. The
+// slice is the caller's to keep; later inserts and deletes do not affect it.
+func (in *Instances) ListVMs() []*VM {
+	in.Mu.Lock()
+	defer in.Mu.Unlock()
+	return slices.SortedFunc(maps.Values(in.VMS), func(a, b *VM) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+}
+
+// Len returns the number of tracked instances.
+func (in *Instances) Len() int {
+	in.Mu.Lock()
+	defer in.Mu.Unlock()
+	return len(in.VMS)
+}
+
+// UpsertVM starts tracking v, replacing any instance with the same ID.
+func (in *Instances) UpsertVM(v *VM) {
+	in.Mu.Lock()
+	defer in.Mu.Unlock()
+	if in.VMS == nil {
+		in.VMS = make(map[string]*VM)
+	}
+	in.VMS[v.ID] = v
+}
+
+// InsertVM starts tracking v unless an instance with its ID is already
+// tracked, and reports whether v was added. Rollback paths use it to put an
+// instance back without clobbering one that has since claimed the ID.
+func (in *Instances) InsertVM(v *VM) bool {
+	in.Mu.Lock()
+	defer in.Mu.Unlock()
+	if _, exists := in.VMS[v.ID]; exists {
+		return false
+	}
+	if in.VMS == nil {
+		in.VMS = make(map[string]*VM)
+	}
+	in.VMS[v.ID] = v
+	return true
+}
+
+// DeleteVM stops tracking the instance with the given ID and returns it.
+func (in *Instances) DeleteVM(id string) (*VM, bool) {
+	in.Mu.Lock()
+	defer in.Mu.Unlock()
+	v, ok := in.VMS[id]
+	delete(in.VMS, id)
+	return v, ok
+}
+
+// DeleteVMIfCurrent stops tracking v only if it is still the instance
+// tracked under its ID, and reports whether it was removed. This keeps a
+// stale pointer from evicting a newer VM that reused the ID.
+func (in *Instances) DeleteVMIfCurrent(v *VM) bool {
+	in.Mu.Lock()
+	defer in.Mu.Unlock()
+	if in.VMS[v.ID] != v {
+		return false
+	}
+	delete(in.VMS, v.ID)
+	return true
+}
+
+// WithVM runs fn on the instance with the given ID while holding Mu, and
+// reports whether the instance exists. fn must not call other Instances
+// methods or block on I/O.
+func (in *Instances) WithVM(id string, fn func(v *VM)) bool {
+	in.Mu.Lock()
+	defer in.Mu.Unlock()
+	v, ok := in.VMS[id]
+	if !ok {
+		return false
+	}
+	fn(v)
+	return true
+}
+
+// WithVolumes runs fn on v's EBS requests while holding Mu and then
+// v.EBSRequests.Mu, so fn may update the volume list and other VM fields
+// (such as BlockDeviceMappings) as one change. v need not be tracked. fn
+// must not call other Instances methods or block on I/O.
+func (in *Instances) WithVolumes(v *VM, fn func(reqs *types.EBSRequests)) {
+	in.Mu.Lock()
+	defer in.Mu.Unlock()
+	v.EBSRequests.Mu.Lock()
+	defer v.EBSRequests.Mu.Unlock()
+	fn(&v.EBSRequests)
+}
+
+// LockAll takes Mu and then every tracked VM's EBSRequests.Mu in ID order,
+// giving the caller a consistent view of all instances for serialisation.
+// The returned func releases them in reverse.
+func (in *Instances) LockAll() (unlock func()) {
+	in.Mu.Lock()
+	vms := slices.SortedFunc(maps.Values(in.VMS), func(a, b *VM) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	for _, v := range vms {
+		v.EBSRequests.Mu.Lock()
+	}
+	return func() {
+		for _, v := range slices.Backward(vms) {
+			v.EBSRequests.Mu.Unlock()
+		}
+		in.Mu.Unlock()
+	}
+}
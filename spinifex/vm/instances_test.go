@@ -0,0 +1,147 @@
+package vm
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/mulgadc/spinifex/spinifex/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstances_Accessors(t *testing.T) {
+	var in Instances // zero value: nil map
+
+	_, ok := in.GetVM("i-a")
+	assert.False(t, ok)
+	assert.Equal(t, 0, in.Len())
+	assert.Empty(t, in.ListVMs())
+
+	a := &VM{ID: "i-a"}
+	b := &VM{ID: "i-b"}
+	in.UpsertVM(b)
+	in.UpsertVM(a)
+	assert.Equal(t, 2, in.Len())
+
+	got, ok := in.GetVM("i-a")
+	require.True(t, ok)
+	assert.Same(t, a, got)
+
+	list := in.ListVMs()
+	require.Len(t, list, 2)
+	assert.Equal(t, "i-a", list[0].ID)
+	assert.Equal(t, "i-b", list[1].ID)
+
+	// InsertVM must not replace a tracked instance.
+	a2 := &VM{ID: "i-a"}
+	assert.False(t, in.InsertVM(a2))
+	got, _ = in.GetVM("i-a")
+	assert.Same(t, a, got)
+
+	// DeleteVMIfCurrent ignores stale pointers.
+	assert.False(t, in.DeleteVMIfCurrent(a2))
+	assert.True(t, in.DeleteVMIfCurrent(a))
+	assert.True(t, in.InsertVM(a2))
+
+	assert.True(t, in.WithVM("i-a", func(v *VM) { v.Status = StateRunning }))
+	assert.Equal(t, StateRunning, a2.Status)
+	assert.False(t, in.WithVM("i-missing", func(*VM) { t.Fatal("fn called for missing instance") }))
+
+	removed, ok := in.DeleteVM("i-b")
+	require.True(t, ok)
+	assert.Same(t, b, removed)
+	_, ok = in.DeleteVM("i-b")
+	assert.False(t, ok)
+
+	// ListVMs returns a snapshot.
+	assert.Len(t, list, 2)
+	assert.Equal(t, 1, in.Len())
+}
+
+func TestInstances_VolumeLocks(t *testing.T) {
+	in := Instances{VMS: make(map[string]*VM)}
+	a := &VM{ID: "i-a"}
+	b := &VM{ID: "i-b"}
+	in.UpsertVM(a)
+	in.UpsertVM(b)
+
+	in.WithVolumes(a, func(reqs *types.EBSRequests) {
+		reqs.Requests = append(reqs.Requests, types.EBSRequest{Name: "vol-1"})
+	})
+	snap := a.SnapshotEBSRequests()
+	require.Len(t, snap, 1)
+	snap[0].Name = "changed"
+	assert.Equal(t, "vol-1", a.EBSRequests.Requests[0].Name, "snapshot must be a copy")
+
+	unlock := in.LockAll()
+	assert.False(t, in.Mu.TryLock())
+	assert.False(t, a.EBSRequests.Mu.TryLock())
+	assert.False(t, b.EBSRequests.Mu.TryLock())
+	unlock()
+	assert.True(t, b.EBSRequests.Mu.TryLock())
+	b.EBSRequests.Mu.Unlock()
+	assert.True(t, in.Mu.TryLock())
+	in.Mu.Unlock()
+}
+
+// TestInstances_ConcurrentAccess hammers every accessor from many goroutines.
+// Run with -race to catch unsynchronised map or field access.
+func TestInstances_ConcurrentAccess(t *testing.T) {
+	in := Instances{VMS: make(map[string]*VM)}
+
+	const workers = 8
+	const iterations = 500
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range iterations {
+				id := fmt.Sprintf("i-%d", (w*iterations+i)%16)
+				v := &VM{ID: id}
+				switch i % 10 {
+				case 0:
+					in.UpsertVM(v)
+				case 1:
+					in.InsertVM(v)
+				case 2:
+					in.GetVM(id)
+				case 3:
+					for _, listed := range in.ListVMs() {
+						in.WithVM(listed.ID, func(v *VM) { _ = v.Status })
+					}
+				case 4:
+					in.WithVM(id, func(v *VM) { v.Status = StateRunning })
+				case 5:
+					if cur, ok := in.GetVM(id); ok {
+						in.DeleteVMIfCurrent(cur)
+					}
+				case 6:
+					in.DeleteVM(id)
+					in.Len()
+				case 7:
+					if cur, ok := in.GetVM(id); ok {
+						in.WithVolumes(cur, func(reqs *types.EBSRequests) {
+							reqs.Requests = append(reqs.Requests, types.EBSRequest{Name: "vol"})
+						})
+					}
+				case 8:
+					if cur, ok := in.GetVM(id); ok {
+						cur.SnapshotEBSRequests()
+					}
+				case 9:
+					unlock := in.LockAll()
+					unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, v := range in.ListVMs() {
+		got, ok := in.GetVM(v.ID)
+		require.True(t, ok)
+		assert.Same(t, v, got)
+	}
+}
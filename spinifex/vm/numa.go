@@ -0,0 +1,33 @@
+package vm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// NUMAPlacement pins an instance to one host NUMA node: its memory is
+// allocated from HostNode and vCPU i runs on host CPU CPUs[i].
+type NUMAPlacement struct {
+	HostNode int   `json:"host_node"`
+	CPUs     []int `json:"cpus"`
+}
+
+// numaMemoryBackend is the ID of the memory backend that holds a pinned
+// guest's boot memory.
+const numaMemoryBackend = "ram-node0"
+
+// hostNodesArg returns the memory-backend options that bind its memory to
+// the placement's host node.
+func (p NUMAPlacement) hostNodesArg() string {
+	return fmt.Sprintf("host-nodes=%d,policy=bind", p.HostNode)
+}
+
+// CPUList renders the placement's CPUs as a cpuset list, e.g. "8,9,10".
+func (p NUMAPlacement) CPUList() string {
+	cpus := make([]string, len(p.CPUs))
+	for i, cpu := range p.CPUs {
+		cpus[i] = strconv.Itoa(cpu)
+	}
+	return strings.Join(cpus, ",")
+}
@@ -0,0 +1,171 @@
+package vm
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// QEMUOptionsTag is the instance tag carrying advanced QEMU passthrough
+// options, as whitespace-separated flag/value pairs, e.g.
+// Key=spinifex:qemu-options, Value="-cpu +avx2,-svm -device virtio-balloon-pci".
+const QEMUOptionsTag = "spinifex:qemu-options"
+
+// maxQEMUOptions caps how many passthrough options one instance may set.
+const maxQEMUOptions = 16
+
+// QEMUOption is a single passthrough flag and its value.
+type QEMUOption struct {
+	Flag  string `json:"flag"`
+	Value string `json:"value"`
+}
+
+// qemuOptionValidators is the allowlist of passthrough flags. Anything else
+// (-drive, -chardev, -netdev, -object, -monitor, -kernel, -runas, ...) can
+// reach host files, sockets or the control plane and is rejected.
+var qemuOptionValidators = map[string]func(string) error{
+	"-cpu":    validateCPUFlags,
+	"-device": validateDeviceOption,
+	"-global": validateGlobalOption,
+	"-rtc":    validateRTCOption,
+	"-smbios": validateSMBIOSOption,
+}
+
+// qemuPassthroughDevices are the -device drivers guests may add. None of them
+// take a host backend (chardev, netdev, drive, file).
+var qemuPassthroughDevices = []string{
+	"virtio-balloon-pci",
+	"virtio-keyboard-pci",
+	"virtio-mouse-pci",
+	"virtio-tablet-pci",
+	"qemu-xhci",
+	"usb-kbd",
+	"usb-mouse",
+	"usb-tablet",
+	"pvpanic",
+}
+
+// qemuGlobalDrivers are the drivers -global may tune, beyond qemuPassthroughDevices.
+var qemuGlobalDrivers = []string{"kvm-pit", "mc146818rtc", "ICH9-LPC"}
+
+// deniedQEMUProperties are property keys rejected in every passthrough value
+// because they bind a host resource or a control-plane backend.
+var deniedQEMUProperties = []string{
+	"chardev", "netdev", "drive", "memdev", "rng", "iothread",
+	"file", "filename", "path", "romfile", "fd", "vhostfd", "script", "socket",
+}
+
+var (
+	cpuFlagPattern  = regexp.MustCompile(`^([+-][a-z0-9_.-]+|[a-z0-9_.-]+=(on|off))$`)
+	qemuNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+)
+
+// ParseQEMUOptions parses and validates a QEMUOptionsTag value.
+func ParseQEMUOptions(s string) ([]QEMUOption, error) {
+	fields := strings.Fields(s)
+	if len(fields)%2 != 0 {
+		return nil, fmt.Errorf("qemu options must be flag/value pairs")
+	}
+	if len(fields)/2 > maxQEMUOptions {
+		return nil, fmt.Errorf("at most %d qemu options are allowed", maxQEMUOptions)
+	}
+
+	opts := make([]QEMUOption, 0, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		opt := QEMUOption{Flag: fields[i], Value: fields[i+1]}
+		if err := ValidateQEMUOption(opt); err != nil {
+			return nil, err
+		}
+		opts = append(opts, opt)
+	}
+	return opts, nil
+}
+
+// ValidateQEMUOption checks opt against the passthrough allowlist and the
+// property denylist.
+func ValidateQEMUOption(opt QEMUOption) error {
+	validate, ok := qemuOptionValidators[opt.Flag]
+	if !ok {
+		return fmt.Errorf("qemu option %q is not allowed", opt.Flag)
+	}
+	if opt.Value == "" {
+		return fmt.Errorf("qemu option %q requires a value", opt.Flag)
+	}
+	// ",," is QEMU's escaped comma; refusing it keeps property splitting unambiguous.
+	if strings.Contains(opt.Value, ",,") {
+		return fmt.Errorf("qemu option %q value must not contain escaped commas", opt.Flag)
+	}
+	return validate(opt.Value)
+}
+
+// validateCPUFlags accepts CPU feature toggles only (+avx2, -svm, pmu=off);
+// the CPU model itself is chosen by the instance type.
+func validateCPUFlags(value string) error {
+	for flag := range strings.SplitSeq(value, ",") {
+		if !cpuFlagPattern.MatchString(flag) {
+			return fmt.Errorf("invalid cpu flag %q", flag)
+		}
+	}
+	return nil
+}
+
+func validateDeviceOption(value string) error {
+	driver, props, _ := strings.Cut(value, ",")
+	if !slices.Contains(qemuPassthroughDevices, driver) {
+		return fmt.Errorf("device %q is not allowed", driver)
+	}
+	return validateQEMUProperties(props, nil)
+}
+
+func validateGlobalOption(value string) error {
+	driver, prop, found := strings.Cut(value, ".")
+	if !found || !strings.Contains(prop, "=") || strings.Contains(prop, ",") {
+		return fmt.Errorf("global option %q must be driver.property=value", value)
+	}
+	if !slices.Contains(qemuPassthroughDevices, driver) && !slices.Contains(qemuGlobalDrivers, driver) {
+		return fmt.Errorf("global driver %q is not allowed", driver)
+	}
+	return validateQEMUProperties(prop, nil)
+}
+
+func validateRTCOption(value string) error {
+	return validateQEMUProperties(value, []string{"base", "clock", "driftfix"})
+}
+
+func validateSMBIOSOption(value string) error {
+	return validateQEMUProperties(value, nil)
+}
+
+// validateQEMUProperties checks a comma-separated key=value list. Keys must be
+// plain names, not on the denylist and, when allowed is non-nil, in allowed.
+func validateQEMUProperties(props string, allowed []string) error {
+	if props == "" {
+		return nil
+	}
+	for prop := range strings.SplitSeq(props, ",") {
+		key, _, ok := strings.Cut(prop, "=")
+		if !ok || !qemuNamePattern.MatchString(key) {
+			return fmt.Errorf("invalid qemu property %q", prop)
+		}
+		if slices.Contains(deniedQEMUProperties, strings.ToLower(key)) {
+			return fmt.Errorf("qemu property %q is not allowed", key)
+		}
+		if allowed != nil && !slices.Contains(allowed, key) {
+			return fmt.Errorf("qemu property %q is not allowed", key)
+		}
+	}
+	return nil
+}
+
+// cpuModel returns the -cpu value: the configured model plus any passthrough
+// CPU feature flags.
+func (cfg *Config) cpuModel() string {
+	model := cfg.CPUType
+	for _, opt := range cfg.QEMUOptions {
+		if opt.Flag == "-cpu" {
+			model += "," + opt.Value
+		}
+	}
+	return model
+}
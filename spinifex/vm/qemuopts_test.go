@@ -0,0 +1,98 @@
+package vm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseQEMUOptions_Allowed(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []QEMUOption
+	}{
+		{name: "Empty", input: "", want: []QEMUOption{}},
+		{name: "CPUFlags", input: "-cpu +avx2,-svm,pmu=off", want: []QEMUOption{{Flag: "-cpu", Value: "+avx2,-svm,pmu=off"}}},
+		{name: "Device", input: "-device virtio-balloon-pci", want: []QEMUOption{{Flag: "-device", Value: "virtio-balloon-pci"}}},
+		{name: "DeviceWithProps", input: "-device usb-tablet,bus=usb.0", want: []QEMUOption{{Flag: "-device", Value: "usb-tablet,bus=usb.0"}}},
+		{name: "Global", input: "-global kvm-pit.lost_tick_policy=delay", want: []QEMUOption{{Flag: "-global", Value: "kvm-pit.lost_tick_policy=delay"}}},
+		{name: "RTC", input: "-rtc base=localtime,driftfix=slew", want: []QEMUOption{{Flag: "-rtc", Value: "base=localtime,driftfix=slew"}}},
+		{name: "SMBIOS", input: "-smbios type=1,serial=abc123", want: []QEMUOption{{Flag: "-smbios", Value: "type=1,serial=abc123"}}},
+		{
+			name:  "Multiple",
+			input: "  -cpu +avx2   -device pvpanic ",
+			want:  []QEMUOption{{Flag: "-cpu", Value: "+avx2"}, {Flag: "-device", Value: "pvpanic"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseQEMUOptions(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseQEMUOptions_Rejected(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "UnpairedFlag", input: "-device"},
+		{name: "Drive", input: "-drive file=/etc/shadow,format=raw"},
+		{name: "Chardev", input: "-chardev socket,id=x,path=/tmp/x"},
+		{name: "Monitor", input: "-monitor stdio"},
+		{name: "Object", input: "-object memory-backend-file,id=m,mem-path=/dev/shm"},
+		{name: "Kernel", input: "-kernel /boot/vmlinuz"},
+		{name: "RunAs", input: "-runas root"},
+		{name: "HostPassthroughDevice", input: "-device vfio-pci,host=01:00.0"},
+		{name: "UsbHost", input: "-device usb-host,hostbus=1"},
+		{name: "DeviceWithChardev", input: "-device usb-tablet,chardev=c0"},
+		{name: "DeviceWithROMFile", input: "-device virtio-balloon-pci,romfile=/etc/passwd"},
+		{name: "EscapedComma", input: "-device usb-tablet,serial=a,,drive=x"},
+		{name: "CPUModelOverride", input: "-cpu host"},
+		{name: "CPUFlagInjection", input: "-cpu +avx2,model=x"},
+		{name: "GlobalUnknownDriver", input: "-global virtio-blk-pci.drive=x"},
+		{name: "GlobalDeniedProperty", input: "-global pvpanic.file=x"},
+		{name: "GlobalMalformed", input: "-global kvm-pit"},
+		{name: "RTCUnknownKey", input: "-rtc base=utc,evil=1"},
+		{name: "SMBIOSFile", input: "-smbios file=/etc/passwd"},
+		{name: "TooMany", input: strings.Repeat("-device pvpanic ", maxQEMUOptions+1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseQEMUOptions(tt.input)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestExecute_QEMUOptions(t *testing.T) {
+	cfg := Config{
+		CPUCount:     1,
+		Memory:       512,
+		CPUType:      "host",
+		Architecture: "x86_64",
+		Drives:       []Drive{{File: "disk.img", Format: "raw"}},
+		QEMUOptions: []QEMUOption{
+			{Flag: "-cpu", Value: "+avx2"},
+			{Flag: "-device", Value: "virtio-balloon-pci"},
+		},
+	}
+
+	assert.Equal(t, "host,+avx2", cfg.cpuModel())
+
+	cmd, err := cfg.Execute()
+	require.NoError(t, err)
+	args := cmd.Args[1:]
+	assert.Contains(t, args, "virtio-balloon-pci")
+	assert.NotContains(t, args, "+avx2", "cpu flags are merged into -cpu, not passed separately")
+
+	// Options are re-validated before launch, e.g. after a state file edit.
+	cfg.QEMUOptions = []QEMUOption{{Flag: "-monitor", Value: "stdio"}}
+	_, err = cfg.Execute()
+	assert.ErrorContains(t, err, "not allowed")
+}
@@ -0,0 +1,75 @@
+package vm
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/mulgadc/spinifex/spinifex/migrate"
+)
+
+// SchemaVersion is the version of the VM record layout this release writes.
+// Bump it, and register a migrate.RecordVM migration to it, whenever a
+// change to VM or a type it holds would misload records an older release
+// wrote.
+const SchemaVersion = 1
+
+// storedVM is a VM as it is stored, stamped with the schema version.
+type storedVM struct {
+	*VM
+	SchemaVersion int `json:"schema_version"`
+}
+
+// EncodeVM encodes v for storage. The caller must hold whatever locks guard
+// v's fields, as for json.Marshal.
+func EncodeVM(v *VM) ([]byte, error) {
+	return json.Marshal(storedVM{VM: v, SchemaVersion: SchemaVersion})
+}
+
+// EncodeInstances encodes a node's instance state for storage. The caller
+// must hold the locks LockAll takes.
+func EncodeInstances(in *Instances) ([]byte, error) {
+	state := struct {
+		VMS map[string]storedVM `json:"vms"`
+	}{
+		VMS: make(map[string]storedVM, len(in.VMS)),
+	}
+	for id, v := range in.VMS {
+		state.VMS[id] = storedVM{VM: v, SchemaVersion: SchemaVersion}
+	}
+	return json.Marshal(state)
+}
+
+// DecodeVM decodes a stored VM record, upgrading it from the schema version
+// it was written at.
+func DecodeVM(data []byte) (*VM, error) {
+	data, err := migrate.DefaultRegistry.UpgradeRecord(migrate.RecordVM, data, SchemaVersion)
+	if err != nil {
+		return nil, err
+	}
+	var v VM
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// DecodeInstances decodes a node's stored instance state, upgrading each VM
+// in it as DecodeVM does.
+func DecodeInstances(data []byte) (*Instances, error) {
+	var state struct {
+		VMS map[string]json.RawMessage `json:"vms"`
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+
+	instances := &Instances{VMS: make(map[string]*VM, len(state.VMS))}
+	for id, raw := range state.VMS {
+		v, err := DecodeVM(raw)
+		if err != nil {
+			return nil, fmt.Errorf("instance %s: %w", id, err)
+		}
+		instances.VMS[id] = v
+	}
+	return instances, nil
+}
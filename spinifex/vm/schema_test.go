@@ -0,0 +1,103 @@
+package vm
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// storedSchemaVersion returns the schema version recorded in a stored VM.
+func storedSchemaVersion(t *testing.T, data []byte) int {
+	t.Helper()
+	var record struct {
+		SchemaVersion int `json:"schema_version"`
+	}
+	require.NoError(t, json.Unmarshal(data, &record))
+	return record.SchemaVersion
+}
+
+func TestDecodeVM_Unversioned(t *testing.T) {
+	// Written by a release from before schema versioning
+	data, err := os.ReadFile("testdata/vm-v0-running.json")
+	require.NoError(t, err)
+
+	v, err := DecodeVM(data)
+	require.NoError(t, err)
+	assert.Equal(t, "i-0a1b2c3d4e5f60718", v.ID)
+	assert.Equal(t, StateRunning, v.Status)
+	assert.Equal(t, "000000000001", v.AccountID)
+	assert.Equal(t, "r-0a1b2c3d4e5f60718", aws.StringValue(v.Reservation.ReservationId))
+	assert.Equal(t, "10.0.1.14", aws.StringValue(v.Instance.PrivateIpAddress))
+	require.Len(t, v.EBSRequests.Requests, 2)
+	assert.Equal(t, "vol-0a1b2c3d4e5f60718", v.EBSRequests.Requests[0].Name)
+	assert.True(t, v.EBSRequests.Requests[0].Boot)
+	assert.Equal(t, "/dev/sda1", v.EBSRequests.Requests[0].DeviceName)
+	assert.True(t, v.EBSRequests.Requests[1].CloudInit)
+
+	// Stored again, it is at the current version and decodes the same
+	encoded, err := EncodeVM(v)
+	require.NoError(t, err)
+	assert.Equal(t, SchemaVersion, storedSchemaVersion(t, encoded))
+	again, err := DecodeVM(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, v.EBSRequests.Requests, again.EBSRequests.Requests)
+	assert.Equal(t, v.Instance, again.Instance)
+}
+
+func TestDecodeVM_NewerVersion(t *testing.T) {
+	// A rolling upgrade can leave records from a newer release; they decode
+	// as before, ignoring what this release doesn't know.
+	v, err := DecodeVM([]byte(`{"schema_version":99,"id":"i-0123","status":"stopped","added_later":{"x":1}}`))
+	require.NoError(t, err)
+	assert.Equal(t, "i-0123", v.ID)
+	assert.Equal(t, StateStopped, v.Status)
+}
+
+func TestDecodeInstances_Unversioned(t *testing.T) {
+	data, err := os.ReadFile("testdata/instances-v0.json")
+	require.NoError(t, err)
+
+	instances, err := DecodeInstances(data)
+	require.NoError(t, err)
+	require.Len(t, instances.VMS, 2)
+
+	running := instances.VMS["i-0a1b2c3d4e5f60718"]
+	require.NotNil(t, running)
+	assert.Equal(t, StateRunning, running.Status)
+	require.Len(t, running.EBSRequests.Requests, 1)
+	assert.Equal(t, "gp3", running.EBSRequests.Requests[0].VolType)
+
+	stopping := instances.VMS["i-0f1e2d3c4b5a69788"]
+	require.NotNil(t, stopping)
+	assert.Equal(t, StateStopping, stopping.Status)
+	assert.True(t, stopping.Attributes.StopInstance)
+	assert.Equal(t, 2, stopping.Health.CrashCount)
+	assert.Empty(t, stopping.EBSRequests.Requests)
+
+	encoded, err := EncodeInstances(instances)
+	require.NoError(t, err)
+	var state struct {
+		VMS map[string]json.RawMessage `json:"vms"`
+	}
+	require.NoError(t, json.Unmarshal(encoded, &state))
+	require.Len(t, state.VMS, 2)
+	for id, raw := range state.VMS {
+		assert.Equal(t, SchemaVersion, storedSchemaVersion(t, raw), id)
+	}
+}
+
+func TestDecodeInstances_Empty(t *testing.T) {
+	instances, err := DecodeInstances([]byte(`{}`))
+	require.NoError(t, err)
+	assert.NotNil(t, instances.VMS)
+	assert.Empty(t, instances.VMS)
+}
+
+func TestDecodeInstances_BadRecord(t *testing.T) {
+	_, err := DecodeInstances([]byte(`{"vms":{"i-0123":null}}`))
+	assert.ErrorContains(t, err, "instance i-0123")
+}
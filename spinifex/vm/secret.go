@@ -0,0 +1,49 @@
+package vm
+
+import (
+	"fmt"
+	"os"
+)
+
+// Secret is a QEMU secret object, such as the passphrase of an encrypted
+// volume. Data is base64 encoded.
+type Secret struct {
+	ID   string
+	Data string
+}
+
+// SecretPipes hands each secret to a QEMU process through a pipe it
+// inherits, so the data never appears on the command line or on disk. It
+// returns the read ends, to pass as the command's ExtraFiles, and the secret
+// object definitions naming them.
+func SecretPipes(secrets []Secret) ([]*os.File, []string, error) {
+	var files []*os.File
+	var objects []string
+	for i, secret := range secrets {
+		r, w, err := os.Pipe()
+		if err != nil {
+			CloseFiles(files)
+			return nil, nil, fmt.Errorf("secret pipe: %w", err)
+		}
+		// Secrets are far smaller than the pipe buffer, so the write
+		// completes before QEMU reads.
+		_, err = w.WriteString(secret.Data)
+		w.Close()
+		if err != nil {
+			r.Close()
+			CloseFiles(files)
+			return nil, nil, fmt.Errorf("write secret %s: %w", secret.ID, err)
+		}
+		files = append(files, r)
+		// ExtraFiles start at fd 3 in the child
+		objects = append(objects, fmt.Sprintf("secret,id=%s,file=/dev/fd/%d,format=base64", secret.ID, 3+i))
+	}
+	return files, objects, nil
+}
+
+// CloseFiles closes files, ignoring errors.
+func CloseFiles(files []*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
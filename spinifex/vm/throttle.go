@@ -0,0 +1,58 @@
+package vm
+
+import "fmt"
+
+// ThrottleGroup is a QEMU throttle-group object. Drives that join it share
+// its limits, so the group caps their combined I/O rather than each drive's.
+type ThrottleGroup struct {
+	ID string `json:"id"`
+	// BPSTotal is the sustained read+write rate in bytes/s.
+	BPSTotal int64 `json:"bps_total"`
+	// BPSTotalMax is the burst rate in bytes/s, held for at most
+	// BPSTotalMaxLength seconds. Zero disables bursting.
+	BPSTotalMax       int64 `json:"bps_total_max,omitempty"`
+	BPSTotalMaxLength int64 `json:"bps_total_max_length,omitempty"`
+	// IOPSTotal is the sustained read+write operations/s, with bursts to
+	// IOPSTotalMax for at most IOPSTotalMaxLength seconds. Zero leaves
+	// operations unlimited.
+	IOPSTotal          int64 `json:"iops_total,omitempty"`
+	IOPSTotalMax       int64 `json:"iops_total_max,omitempty"`
+	IOPSTotalMaxLength int64 `json:"iops_total_max_length,omitempty"`
+}
+
+// objectArg renders the group as a -object argument.
+func (g ThrottleGroup) objectArg() string {
+	arg := fmt.Sprintf("throttle-group,id=%s,x-bps-total=%d", g.ID, g.BPSTotal)
+	if g.BPSTotalMax > 0 {
+		arg += fmt.Sprintf(",x-bps-total-max=%d,x-bps-total-max-length=%d", g.BPSTotalMax, g.BPSTotalMaxLength)
+	}
+	if g.IOPSTotal > 0 {
+		arg += fmt.Sprintf(",x-iops-total=%d", g.IOPSTotal)
+		if g.IOPSTotalMax > 0 {
+			arg += fmt.Sprintf(",x-iops-total-max=%d,x-iops-total-max-length=%d", g.IOPSTotalMax, g.IOPSTotalMaxLength)
+		}
+	}
+	return arg
+}
+
+// QMPLimits renders the group's limits for qom-set on its "limits"
+// property. Every field is sent so a burst that no longer applies is cleared.
+func (g ThrottleGroup) QMPLimits() map[string]any {
+	// QEMU rejects a burst length above 1 without a burst rate.
+	maxLength := g.BPSTotalMaxLength
+	if g.BPSTotalMax == 0 {
+		maxLength = 1
+	}
+	iopsMaxLength := g.IOPSTotalMaxLength
+	if g.IOPSTotalMax == 0 {
+		iopsMaxLength = 1
+	}
+	return map[string]any{
+		"bps-total":             g.BPSTotal,
+		"bps-total-max":         g.BPSTotalMax,
+		"bps-total-max-length":  maxLength,
+		"iops-total":            g.IOPSTotal,
+		"iops-total-max":        g.IOPSTotalMax,
+		"iops-total-max-length": iopsMaxLength,
+	}
+}
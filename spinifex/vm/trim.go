@@ -0,0 +1,42 @@
+package vm
+
+import "fmt"
+
+// TrimTag is the volume tag selecting whether guest discards (fstrim) are
+// passed through to the volume, so a thin-provisioned volume gives back the
+// space the guest frees, e.g. Key=spinifex:trim, Value=off. Without it the
+// node's default for the volume type applies (config.VolumeTrimEnabled).
+// It is read when the volume is attached, so a change takes effect on the
+// next attach or instance start.
+const TrimTag = "spinifex:trim"
+
+// TrimTag values.
+const (
+	TrimOn  = "on"
+	TrimOff = "off"
+)
+
+// ParseTrim validates a TrimTag value, returning def for an empty value.
+func ParseTrim(value string, def bool) (bool, error) {
+	switch value {
+	case "":
+		return def, nil
+	case TrimOn:
+		return true, nil
+	case TrimOff:
+		return false, nil
+	}
+	return false, fmt.Errorf("unsupported trim setting %q", value)
+}
+
+// TrimBlockdevArgs enables discard on blockdev-add arguments: guest discards
+// are unmapped on the volume, and writes of zeroes become discards too.
+// Children of the node inherit the discard setting, so it belongs on the
+// node the guest device attaches to. Discard is independent of the cache
+// mode: QEMU orders a discard after the writes it overlaps whether or not
+// they went through the host page cache, and none of the offered modes
+// drop guest flushes.
+func TrimBlockdevArgs(args map[string]any) {
+	args["discard"] = "unmap"
+	args["detect-zeroes"] = "unmap"
+}
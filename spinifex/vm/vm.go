@@ -5,6 +5,7 @@ import (
 	"log/slog"
 	"os"
 	"os/exec"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -15,6 +16,10 @@ import (
 	"github.com/mulgadc/spinifex/spinifex/types"
 )
 
+// AgentChannelName is the virtio-serial port name of the Spinifex agent
+// channel, under /dev/virtio-ports in the guest.
+const AgentChannelName = "org.spinifex.agent.0"
+
 // InstanceHealthState tracks crash detection and auto-restart metadata for a VM.
 type InstanceHealthState struct {
 	CrashCount      int       `json:"crash_count"`
@@ -22,15 +27,64 @@ type InstanceHealthState struct {
 	LastCrashReason string    `json:"last_crash_reason,omitempty"`
 	RestartCount    int       `json:"restart_count"`
 	FirstCrashTime  time.Time `json:"first_crash_time"`
+
+	// Watchdog tracks guest hangs detected by the QEMU watchdog device
+	WatchdogCount      int       `json:"watchdog_count,omitempty"`
+	LastWatchdogTime   time.Time `json:"last_watchdog_time"`
+	LastWatchdogAction string    `json:"last_watchdog_action,omitempty"`
+}
+
+// CPUCredits tracks the CPU credit balance of a burstable instance. One
+// credit is one vCPU at full utilization for one minute.
+type CPUCredits struct {
+	// Mode is "standard" or "unlimited".
+	Mode    string  `json:"mode"`
+	Balance float64 `json:"balance"`
+	// Surplus is what an unlimited instance has spent beyond an empty
+	// balance. Later earnings repay it before adding to the balance.
+	Surplus float64 `json:"surplus,omitempty"`
+	// Throttled is set while a standard instance is held to its baseline.
+	Throttled bool `json:"throttled,omitempty"`
+
+	// The QEMU process and its CPU time at the last sample, where the next
+	// sample's accounting starts from.
+	PID        int       `json:"pid,omitempty"`
+	CPUSeconds float64   `json:"cpu_seconds,omitempty"`
+	SampledAt  time.Time `json:"sampled_at,omitzero"`
+}
+
+// Reachability tracks the heartbeat's checks of a running instance: the
+// system check that QEMU answers QMP in a healthy run state, and the instance
+// check that the QEMU guest agent inside the guest answers. Failures counts
+// consecutive failed heartbeats, and ImpairedSince is when the first of them
+// ran.
+type Reachability struct {
+	CheckedAt time.Time
+
+	SystemFailures      int
+	SystemImpairedSince time.Time
+
+	// GuestAgent is set once the guest agent has answered. Guests without
+	// one can't be checked, so their instance check is never failed.
+	GuestAgent              bool
+	GuestAgentFailures      int
+	GuestAgentImpairedSince time.Time
 }
 
 // ExtraENI describes an additional VPC network interface attached to a VM
-// beyond the primary ENI. Only system VMs (ALBs) use multiple ENIs today.
+// beyond the primary ENI: the subnets of a multi-AZ system VM (ALB), or an
+// interface AttachNetworkInterface hot-plugged into an instance.
 type ExtraENI struct {
-	ENIID    string `json:"eni_id"`
-	ENIMac   string `json:"eni_mac"`
-	ENIIP    string `json:"eni_ip"`
-	SubnetID string `json:"subnet_id,omitempty"`
+	ENIID       string `json:"eni_id"`
+	ENIMac      string `json:"eni_mac"`
+	ENIIP       string `json:"eni_ip"`
+	SubnetID    string `json:"subnet_id,omitempty"`
+	DeviceIndex int64  `json:"device_index,omitempty"`
+	// AttachmentID is set for interfaces attached by AttachNetworkInterface,
+	// which are detached when the instance terminates, or deleted if
+	// DeleteOnTermination is set.
+	AttachmentID        string `json:"attachment_id,omitempty"`
+	DeleteOnTermination bool   `json:"delete_on_termination,omitempty"`
 }
 
 type VM struct {
@@ -69,6 +123,28 @@ type VM struct {
 	// Health tracks crash detection and auto-restart state
 	Health InstanceHealthState `json:"health"`
 
+	// CPUCredits is the credit state of a burstable instance, nil for
+	// types that don't use CPU credits.
+	CPUCredits *CPUCredits `json:"cpu_credits,omitempty"`
+
+	// PhoneHomeToken authenticates the guest's cloud-init phone_home POST.
+	// Empty when no phone-home URL was injected into cloud-init.
+	PhoneHomeToken string `json:"phone_home_token,omitempty"`
+	// BootedAt is when the guest phoned home. cloud-init only phones home
+	// on an instance's first boot, so this survives stop/start.
+	BootedAt time.Time `json:"booted_at,omitzero"`
+	// TerminatedAt is when the instance was terminated. DescribeInstances
+	// stops listing it once the terminated visibility window has passed.
+	TerminatedAt time.Time `json:"terminated_at,omitzero"`
+
+	// FQDN is the guest hostname qualified with the node's DNS zone, kept so
+	// the VPC DNS record stays the same across restarts even if the Name tag
+	// changes. Empty when no zone is configured.
+	FQDN string `json:"fqdn,omitempty"`
+	// Hostname is the guest hostname picked at launch. VPC instances also
+	// resolve by it inside their VPC.
+	Hostname string `json:"hostname,omitempty"`
+
 	// AccountID is the AWS account that owns this instance.
 	// Empty for pre-Phase4 resources (treated as visible to all accounts).
 	AccountID string `json:"account_id,omitempty"`
@@ -76,11 +152,14 @@ type VM struct {
 	// VPC networking: ENI attached to this instance (set by RunInstances when VPC mode is active)
 	ENIId  string `json:"eni_id,omitempty"`
 	ENIMac string `json:"eni_mac,omitempty"`
+	// SRIOVVF is the PCI address of the SR-IOV virtual function passed
+	// through as the primary ENI's NIC, or empty when it uses a tap.
+	SRIOVVF string `json:"sriov_vf,omitempty"`
 
 	// ExtraENIs lists additional VPC NICs beyond the primary ENIId/ENIMac.
-	// Used by multi-AZ system VMs (ALBs with subnets in multiple subnets) —
-	// each entry gets its own tap device on br-int and its own QEMU NIC.
-	// Empty for customer EC2 instances and single-subnet ALBs.
+	// Used by multi-AZ system VMs (ALBs with subnets in multiple subnets) and
+	// by interfaces attached with AttachNetworkInterface — each entry gets
+	// its own tap device on br-int and its own QEMU NIC.
 	ExtraENIs []ExtraENI `json:"extra_enis,omitempty"`
 
 	// Public IP auto-assigned from external IPAM pool (released on termination)
@@ -104,6 +183,11 @@ type VM struct {
 	MgmtIP  string `json:"mgmt_ip,omitempty"`  // Static IP on management subnet
 	MgmtTap string `json:"mgmt_tap,omitempty"` // TAP device name on host
 
+	// DNSServers are the resolvers the VPC subnet advertises via DHCP.
+	// Set before cloud-init ISO generation so resolv.conf is written even on
+	// images that ignore DHCP-supplied DNS.
+	DNSServers []string `json:"dns_servers,omitempty"`
+
 	// Placement group tracking (set during RunInstances when a placement group is specified)
 	PlacementGroupName string `json:"placement_group_name,omitempty"`
 	PlacementGroupNode string `json:"placement_group_node,omitempty"`
@@ -113,12 +197,84 @@ type VM struct {
 	// Maps guest port → host port (host port filled in by StartInstance).
 	ExtraHostfwd map[int]int `json:"extra_hostfwd,omitempty"`
 
+	// WatchdogAction is the QEMU action taken when the guest stops petting the
+	// watchdog (see WatchdogReset etc). Empty means no watchdog device.
+	// Set at launch from the WatchdogActionTag instance tag.
+	WatchdogAction string `json:"watchdog_action,omitempty"`
+
+	// DisableApiTermination and DisableApiStop protect the instance from
+	// TerminateInstances and StopInstances respectively. Set at launch and
+	// changed with ModifyInstanceAttribute.
+	DisableApiTermination bool `json:"disable_api_termination,omitempty"`
+	DisableApiStop        bool `json:"disable_api_stop,omitempty"`
+
+	// Interruptible instances (market type spot) may be reclaimed to make
+	// room for on-demand launches. InterruptionTime is set when the node
+	// gives an instance notice; the instance is terminated at that time.
+	Interruptible    bool      `json:"interruptible,omitempty"`
+	InterruptionTime time.Time `json:"interruption_time,omitzero"`
+
+	// PasswordData is the base64 password the guest agent posted, encrypted
+	// by the guest with the instance key pair, as GetPasswordData returns it.
+	PasswordData     string    `json:"password_data,omitempty"`
+	PasswordDataTime time.Time `json:"password_data_time,omitzero"`
+
+	// VirtioRNG records whether the guest was given a virtio-rng entropy
+	// device, per the launching node's Daemon.VirtioRNG setting.
+	VirtioRNG bool `json:"virtio_rng,omitempty"`
+
+	// Reachability is the outcome of the heartbeat's health checks while
+	// QEMU runs on this node. It isn't persisted.
+	Reachability Reachability `json:"-"`
+
+	// QEMUOptions are advanced passthrough options from the QEMUOptionsTag
+	// instance tag, validated at launch.
+	QEMUOptions []QEMUOption `json:"qemu_options,omitempty"`
+
 	// ManagedBy identifies the Spinifex platform component that owns this
 	// VM (e.g. "elbv2"). Empty for customer-launched instances. The UI
 	// filters out tagged VMs from customer-facing listings.
 	ManagedBy string `json:"managed_by,omitempty"`
 }
 
+// InstanceAction returns the spot/instance-action metadata document for an
+// interruptible instance that has been given notice, or nil.
+func (v *VM) InstanceAction() *types.SpotInstanceAction {
+	if !v.Interruptible || v.InterruptionTime.IsZero() {
+		return nil
+	}
+	return &types.SpotInstanceAction{
+		Action: "terminate",
+		Time:   v.InterruptionTime.UTC().Format(time.RFC3339),
+	}
+}
+
+// SnapshotEBSRequests returns a copy of the VM's EBS requests, taken under
+// EBSRequests.Mu, for callers that go on to do blocking I/O per volume.
+func (v *VM) SnapshotEBSRequests() []types.EBSRequest {
+	v.EBSRequests.Mu.Lock()
+	defer v.EBSRequests.Mu.Unlock()
+	return slices.Clone(v.EBSRequests.Requests)
+}
+
+// AttachedVolumes lists the VM's EBS volumes, leaving out its internal EFI
+// and cloud-init volumes.
+func (v *VM) AttachedVolumes() []types.VMVolume {
+	var volumes []types.VMVolume
+	for _, req := range v.SnapshotEBSRequests() {
+		if req.EFI || req.CloudInit {
+			continue
+		}
+		volumes = append(volumes, types.VMVolume{
+			VolumeID:            req.Name,
+			DeviceName:          req.DeviceName,
+			Boot:                req.Boot,
+			DeleteOnTermination: req.DeleteOnTermination,
+		})
+	}
+	return volumes
+}
+
 // ResetNodeLocalState zeroes out fields that are specific to the daemon node
 // that last ran this instance. Must be called after deserializing a VM from
 // shared KV before launching it on a new node.
@@ -127,14 +283,10 @@ func (v *VM) ResetNodeLocalState() {
 	v.Running = false
 	v.MetadataServerAddress = ""
 	v.QMPClient = &qmp.QMPClient{}
+	v.Reachability = Reachability{}
 	v.EBSRequests.Mu = sync.Mutex{}
 }
 
-type Instances struct {
-	VMS map[string]*VM `json:"vms"`
-	Mu  sync.Mutex     `json:"-"`
-}
-
 type NetDev struct {
 	Value string `json:"value"`
 }
@@ -150,6 +302,14 @@ type Drive struct {
 	Media  string `json:"media"`
 	ID     string `json:"id"`
 	Cache  string `json:"cache,omitempty"`
+	// ThrottleGroup is the ID of a Config.ThrottleGroups entry the drive joins
+	ThrottleGroup string `json:"throttle_group,omitempty"`
+	// Discard passes guest discards through and unmaps zero writes, as
+	// TrimBlockdevArgs does for hot-plugged volumes.
+	Discard bool `json:"discard,omitempty"`
+	// KeySecret is the ID of the Config.Secrets entry unlocking a drive
+	// in luks format.
+	KeySecret string `json:"key_secret,omitempty"`
 }
 
 type IOThread struct {
@@ -165,12 +325,26 @@ type Config struct {
 	MachineType    string `json:"machine_type"`
 	ConsoleLogPath string `json:"console_log_path,omitempty"`
 	SerialSocket   string `json:"serial_socket,omitempty"`
-	CPUType        string `json:"cpu_type"`
-	CPUCount       int    `json:"cpu_count"`
-	Memory         int    `json:"memory"`
-
-	Drives    []Drive    `json:"drives"`
-	IOThreads []IOThread `json:"io_threads,omitempty"`
+	// VNCSocket is the unix socket QEMU serves the display on over VNC,
+	// for the gateway's console proxy.
+	VNCSocket string `json:"vnc_socket,omitempty"`
+	CPUType   string `json:"cpu_type"`
+	CPUCount  int    `json:"cpu_count"`
+	Memory    int    `json:"memory"`
+
+	// MaxCPUCount and MaxMemory (MiB), when above CPUCount and Memory, give
+	// the guest room to have vCPUs and memory hot-plugged up to them. The
+	// memory above Memory is a virtio-mem device that starts empty.
+	MaxCPUCount int `json:"max_cpu_count,omitempty"`
+	MaxMemory   int `json:"max_memory,omitempty"`
+	// NUMA, when set, binds the guest's memory to one host NUMA node, which
+	// the guest sees as its single node, and gives its vCPUs dedicated
+	// host CPUs.
+	NUMA *NUMAPlacement `json:"numa,omitempty"`
+
+	Drives         []Drive         `json:"drives"`
+	IOThreads      []IOThread      `json:"io_threads,omitempty"`
+	ThrottleGroups []ThrottleGroup `json:"throttle_groups,omitempty"`
 
 	Devices []Device `json:"devices"`
 	NetDevs []NetDev `json:"net_devs"`
@@ -178,8 +352,35 @@ type Config struct {
 	// InstanceType is a friendly name (e.g., t3.micro, t4g.micro)
 	InstanceType string `json:"instance_type"`
 	Architecture string `json:"architecture"`
+
+	// WatchdogAction adds an i6300esb watchdog device with this action when set
+	WatchdogAction string `json:"watchdog_action,omitempty"`
+
+	// VirtioRNG adds a virtio-rng device sourcing entropy from host /dev/urandom
+	VirtioRNG bool `json:"virtio_rng,omitempty"`
+
+	// GuestAgentSocket adds a virtio-serial channel for the QEMU guest agent,
+	// served on this host socket, when set
+	GuestAgentSocket string `json:"guest_agent_socket,omitempty"`
+
+	// AgentSocket adds the Spinifex agent channel, on which the guest posts
+	// data such as its generated password, served on this host socket, when set
+	AgentSocket string `json:"agent_socket,omitempty"`
+
+	// QEMUOptions are allowlisted passthrough options; -cpu values extend CPUType
+	QEMUOptions []QEMUOption `json:"qemu_options,omitempty"`
+
+	// Secrets are passed to QEMU through pipes and never saved
+	Secrets []Secret `json:"-"`
 }
 
+// IDs of the memory backend and virtio-mem device that hold a guest's
+// hot-plugged memory.
+const (
+	HotplugMemoryBackend = "hotmem0"
+	HotplugMemoryDevice  = "hotmem0-dev"
+)
+
 func (cfg *Config) Execute() (*exec.Cmd, error) {
 	args := []string{}
 
@@ -187,6 +388,12 @@ func (cfg *Config) Execute() (*exec.Cmd, error) {
 		args = append(args, "-pidfile", cfg.PIDFile)
 	}
 
+	for _, opt := range cfg.QEMUOptions {
+		if err := ValidateQEMUOption(opt); err != nil {
+			return nil, err
+		}
+	}
+
 	if cfg.QMPSocket != "" {
 		args = append(args, "-qmp", fmt.Sprintf("unix:%s,server,nowait", cfg.QMPSocket))
 	}
@@ -205,13 +412,16 @@ func (cfg *Config) Execute() (*exec.Cmd, error) {
 		}
 
 		if cfg.CPUType != "" {
-			args = append(args, "-cpu", cfg.CPUType)
+			args = append(args, "-cpu", cfg.cpuModel())
 		}
 	}
 
 	if cfg.NoGraphic {
 		args = append(args, "-display", "none")
 	}
+	if cfg.VNCSocket != "" {
+		args = append(args, "-vnc", "unix:"+cfg.VNCSocket)
+	}
 
 	if cfg.SerialSocket != "" && cfg.ConsoleLogPath != "" {
 		chardevOpts := fmt.Sprintf("socket,id=console0,path=%s,server=on,wait=off,logfile=%s",
@@ -220,13 +430,36 @@ func (cfg *Config) Execute() (*exec.Cmd, error) {
 	}
 
 	if cfg.CPUCount > 0 {
-		args = append(args, "-smp", strconv.Itoa(cfg.CPUCount))
+		smp := strconv.Itoa(cfg.CPUCount)
+		if cfg.MaxCPUCount > cfg.CPUCount {
+			smp += ",maxcpus=" + strconv.Itoa(cfg.MaxCPUCount)
+		}
+		args = append(args, "-smp", smp)
 	} else {
 		return nil, fmt.Errorf("cpu count is required")
 	}
 
 	if cfg.Memory > 0 {
-		args = append(args, "-m", strconv.Itoa(cfg.Memory))
+		if cfg.MaxMemory > cfg.Memory {
+			args = append(args, "-m", fmt.Sprintf("%d,maxmem=%dM", cfg.Memory, cfg.MaxMemory))
+		} else {
+			args = append(args, "-m", strconv.Itoa(cfg.Memory))
+		}
+		if cfg.NUMA != nil {
+			args = append(args,
+				"-object", fmt.Sprintf("memory-backend-ram,id=%s,size=%dM,%s", numaMemoryBackend, cfg.Memory, cfg.NUMA.hostNodesArg()),
+				"-numa", "node,nodeid=0,memdev="+numaMemoryBackend,
+			)
+		}
+		if cfg.MaxMemory > cfg.Memory {
+			backend := fmt.Sprintf("memory-backend-ram,id=%s,size=%dM", HotplugMemoryBackend, cfg.MaxMemory-cfg.Memory)
+			device := fmt.Sprintf("virtio-mem-pci,id=%s,memdev=%s,requested-size=0", HotplugMemoryDevice, HotplugMemoryBackend)
+			if cfg.NUMA != nil {
+				backend += "," + cfg.NUMA.hostNodesArg()
+				device += ",node=0"
+			}
+			args = append(args, "-object", backend, "-device", device)
+		}
 	} else {
 		return nil, fmt.Errorf("memory is required")
 	}
@@ -235,6 +468,10 @@ func (cfg *Config) Execute() (*exec.Cmd, error) {
 		args = append(args, "-object", fmt.Sprintf("iothread,id=%s", iot.ID))
 	}
 
+	for _, tg := range cfg.ThrottleGroups {
+		args = append(args, "-object", tg.objectArg())
+	}
+
 	if len(cfg.Drives) == 0 {
 		return nil, fmt.Errorf("at least one drive is required")
 	}
@@ -268,6 +505,18 @@ func (cfg *Config) Execute() (*exec.Cmd, error) {
 			opts = append(opts, fmt.Sprintf("cache=%s", drive.Cache))
 		}
 
+		if drive.ThrottleGroup != "" {
+			opts = append(opts, fmt.Sprintf("throttling.group=%s", drive.ThrottleGroup))
+		}
+
+		if drive.Discard {
+			opts = append(opts, "discard=unmap", "detect-zeroes=unmap")
+		}
+
+		if drive.KeySecret != "" {
+			opts = append(opts, fmt.Sprintf("key-secret=%s", drive.KeySecret))
+		}
+
 		args = append(args, "-drive", strings.Join(opts, ","))
 	}
 
@@ -279,6 +528,42 @@ func (cfg *Config) Execute() (*exec.Cmd, error) {
 		args = append(args, "-netdev", netdev.Value)
 	}
 
+	if cfg.WatchdogAction != "" {
+		if !IsValidWatchdogAction(cfg.WatchdogAction) {
+			return nil, fmt.Errorf("invalid watchdog action %q", cfg.WatchdogAction)
+		}
+		args = append(args, "-device", "i6300esb", "-watchdog-action", cfg.WatchdogAction)
+	}
+
+	if cfg.VirtioRNG {
+		args = append(args,
+			"-object", "rng-random,id=rng0,filename=/dev/urandom",
+			"-device", "virtio-rng-pci,rng=rng0",
+		)
+	}
+
+	if cfg.GuestAgentSocket != "" || cfg.AgentSocket != "" {
+		args = append(args, "-device", "virtio-serial")
+	}
+	if cfg.GuestAgentSocket != "" {
+		args = append(args,
+			"-chardev", fmt.Sprintf("socket,id=qga0,path=%s,server=on,wait=off", cfg.GuestAgentSocket),
+			"-device", "virtserialport,chardev=qga0,name=org.qemu.guest_agent.0",
+		)
+	}
+	if cfg.AgentSocket != "" {
+		args = append(args,
+			"-chardev", fmt.Sprintf("socket,id=agent0,path=%s,server=on,wait=off", cfg.AgentSocket),
+			"-device", "virtserialport,chardev=agent0,name="+AgentChannelName,
+		)
+	}
+
+	for _, opt := range cfg.QEMUOptions {
+		if opt.Flag != "-cpu" {
+			args = append(args, opt.Flag, opt.Value)
+		}
+	}
+
 	var qemuArchitecture string
 
 	switch cfg.Architecture {
@@ -311,9 +596,19 @@ func (cfg *Config) Execute() (*exec.Cmd, error) {
 		args = append(args, "-M", cfg.MachineType)
 	}
 
+	// The caller closes the read ends once QEMU has started
+	secretFiles, secretObjects, err := SecretPipes(cfg.Secrets)
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range secretObjects {
+		args = append(args, "-object", obj)
+	}
+
 	slog.Info("Executing QEMU command:", "cmd", qemuArchitecture, "args", args)
 
 	cmd := exec.Command(qemuArchitecture, args...)
+	cmd.ExtraFiles = secretFiles
 
 	//cmd.Stdout = os.Stdout
 	//cmd.Stderr = os.Stderr
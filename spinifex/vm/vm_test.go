@@ -1,11 +1,18 @@
 package vm
 
 import (
+	"io"
 	"os"
 	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/mulgadc/spinifex/spinifex/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestExecute(t *testing.T) {
@@ -141,6 +148,66 @@ func TestExecute_IOThreadAndCache(t *testing.T) {
 	assert.Equal(t, "virtio-blk-pci,drive=os,iothread=ioth-os,num-queues=2,bootindex=1", args[deviceIdx+1])
 }
 
+func TestExecute_ThrottleGroup(t *testing.T) {
+	cfg := Config{
+		CPUCount:     2,
+		Memory:       4096,
+		Architecture: "x86_64",
+		ThrottleGroups: []ThrottleGroup{
+			{ID: "ebs-throttle", BPSTotal: 100, BPSTotalMax: 400, BPSTotalMaxLength: 1800},
+		},
+		Drives: []Drive{
+			{File: "nbd:unix:/run/os.sock", Format: "raw", If: "none", ID: "os", ThrottleGroup: "ebs-throttle", Discard: true},
+			{File: "nbd:unix:/run/ci.sock", Format: "raw", If: "virtio", ID: "cloudinit"},
+		},
+	}
+
+	cmd, err := cfg.Execute()
+	require.NoError(t, err)
+	args := strings.Join(cmd.Args[1:], " ")
+
+	assert.Contains(t, args, "-object throttle-group,id=ebs-throttle,x-bps-total=100,x-bps-total-max=400,x-bps-total-max-length=1800")
+	assert.Contains(t, args, "-drive file=nbd:unix:/run/os.sock,format=raw,if=none,id=os,throttling.group=ebs-throttle,discard=unmap,detect-zeroes=unmap")
+	assert.True(t, slices.Contains(cmd.Args, "file=nbd:unix:/run/ci.sock,format=raw,if=virtio,id=cloudinit"), "cloud-init drive is not throttled")
+	assert.Less(t, strings.Index(args, "throttle-group"), strings.Index(args, "-drive"), "group must exist before drives join it")
+
+	assert.Equal(t, "throttle-group,id=tg,x-bps-total=50", ThrottleGroup{ID: "tg", BPSTotal: 50}.objectArg())
+	assert.Equal(t, map[string]any{"bps-total": int64(50), "bps-total-max": int64(0), "bps-total-max-length": int64(1),
+		"iops-total": int64(0), "iops-total-max": int64(0), "iops-total-max-length": int64(1)},
+		ThrottleGroup{ID: "tg", BPSTotal: 50}.QMPLimits())
+
+	iops := ThrottleGroup{ID: "tg", BPSTotal: 50, IOPSTotal: 3000, IOPSTotalMax: 12000, IOPSTotalMaxLength: 1800}
+	assert.Equal(t, "throttle-group,id=tg,x-bps-total=50,x-iops-total=3000,x-iops-total-max=12000,x-iops-total-max-length=1800", iops.objectArg())
+	assert.Equal(t, int64(1800), iops.QMPLimits()["iops-total-max-length"])
+}
+
+func TestExecute_EncryptedDrive(t *testing.T) {
+	cfg := Config{
+		CPUCount:     1,
+		Memory:       512,
+		Architecture: "x86_64",
+		Drives: []Drive{
+			{File: "nbd:unix:/run/vol-enc.sock", Format: "luks", If: "none", ID: "os", KeySecret: "sec-vol-enc"},
+		},
+		Secrets: []Secret{{ID: "sec-vol-enc", Data: "c2VjcmV0"}},
+	}
+
+	cmd, err := cfg.Execute()
+	require.NoError(t, err)
+	t.Cleanup(func() { CloseFiles(cmd.ExtraFiles) })
+	args := strings.Join(cmd.Args[1:], " ")
+
+	assert.Contains(t, args, "-drive file=nbd:unix:/run/vol-enc.sock,format=luks,if=none,id=os,key-secret=sec-vol-enc")
+	assert.Contains(t, args, "-object secret,id=sec-vol-enc,file=/dev/fd/3,format=base64")
+	assert.NotContains(t, args, "c2VjcmV0", "secret data must not reach the command line")
+
+	// QEMU reads the secret from the inherited pipe.
+	require.Len(t, cmd.ExtraFiles, 1)
+	data, err := io.ReadAll(cmd.ExtraFiles[0])
+	require.NoError(t, err)
+	assert.Equal(t, "c2VjcmV0", string(data))
+}
+
 func TestExecute_NoCacheWhenEmpty(t *testing.T) {
 	cfg := Config{
 		CPUCount:     1,
@@ -237,6 +304,7 @@ func TestResetNodeLocalState(t *testing.T) {
 		Running:               true,
 		MetadataServerAddress: "127.0.0.1:9999",
 		Status:                StateRunning,
+		Reachability:          Reachability{GuestAgent: true, SystemFailures: 2},
 	}
 
 	v.ResetNodeLocalState()
@@ -245,11 +313,41 @@ func TestResetNodeLocalState(t *testing.T) {
 	assert.False(t, v.Running)
 	assert.Empty(t, v.MetadataServerAddress)
 	assert.NotNil(t, v.QMPClient)
+	assert.Zero(t, v.Reachability)
 	// ID and Status should be unchanged
 	assert.Equal(t, "i-abc123", v.ID)
 	assert.Equal(t, StateRunning, v.Status)
 }
 
+func TestAttachedVolumes(t *testing.T) {
+	v := &VM{EBSRequests: types.EBSRequests{Requests: []types.EBSRequest{
+		{Name: "vol-root", Boot: true, DeleteOnTermination: true},
+		{Name: "vol-efi", EFI: true},
+		{Name: "vol-cloudinit", CloudInit: true},
+		{Name: "vol-data", DeviceName: "/dev/sdf"},
+	}}}
+
+	assert.Equal(t, []types.VMVolume{
+		{VolumeID: "vol-root", Boot: true, DeleteOnTermination: true},
+		{VolumeID: "vol-data", DeviceName: "/dev/sdf"},
+	}, v.AttachedVolumes())
+	assert.Nil(t, (&VM{}).AttachedVolumes())
+}
+
+func TestInstanceAction(t *testing.T) {
+	v := &VM{ID: "i-abc123"}
+	assert.Nil(t, v.InstanceAction())
+
+	v.Interruptible = true
+	assert.Nil(t, v.InstanceAction(), "no notice given yet")
+
+	v.InterruptionTime = time.Date(2026, 10, 17, 12, 2, 0, 0, time.UTC)
+	action := v.InstanceAction()
+	require.NotNil(t, action)
+	assert.Equal(t, "terminate", action.Action)
+	assert.Equal(t, "2026-10-17T12:02:00Z", action.Time)
+}
+
 func TestExecute_PIDFileAndQMPSocket(t *testing.T) {
 	cfg := Config{
 		CPUCount:     1,
@@ -343,6 +441,28 @@ func TestExecute_SerialSocketAndConsoleLog(t *testing.T) {
 	})
 }
 
+func TestExecute_VNCSocket(t *testing.T) {
+	cfg := Config{
+		CPUCount:     1,
+		Memory:       512,
+		Architecture: "x86_64",
+		NoGraphic:    true,
+		VNCSocket:    "/run/vnc.sock",
+		Drives:       []Drive{{File: "disk.img", Format: "raw"}},
+	}
+
+	cmd, err := cfg.Execute()
+	require.NoError(t, err)
+	args := cmd.Args[1:]
+	assert.Equal(t, "none", argValue(args, "-display"))
+	assert.Equal(t, "unix:/run/vnc.sock", argValue(args, "-vnc"))
+
+	cfg.VNCSocket = ""
+	cmd, err = cfg.Execute()
+	require.NoError(t, err)
+	assert.Empty(t, argValue(cmd.Args[1:], "-vnc"))
+}
+
 func TestExecute_NetDevs(t *testing.T) {
 	cfg := Config{
 		CPUCount:     1,
@@ -361,6 +481,158 @@ func TestExecute_NetDevs(t *testing.T) {
 	assert.Equal(t, "tap,id=net0,ifname=tap0,script=no", argValue(args, "-netdev"))
 }
 
+func TestExecute_Watchdog(t *testing.T) {
+	cfg := Config{
+		CPUCount:       1,
+		Memory:         512,
+		Architecture:   "x86_64",
+		Drives:         []Drive{{File: "disk.img", Format: "raw"}},
+		WatchdogAction: WatchdogPoweroff,
+	}
+
+	cmd, err := cfg.Execute()
+	assert.NoError(t, err)
+
+	args := cmd.Args[1:]
+	assert.Contains(t, args, "i6300esb")
+	assert.Equal(t, "poweroff", argValue(args, "-watchdog-action"))
+
+	// No action → no watchdog device
+	cfg.WatchdogAction = ""
+	cmd, err = cfg.Execute()
+	assert.NoError(t, err)
+	assert.NotContains(t, cmd.Args, "i6300esb")
+	assert.Empty(t, argValue(cmd.Args[1:], "-watchdog-action"))
+
+	cfg.WatchdogAction = "explode"
+	_, err = cfg.Execute()
+	assert.ErrorContains(t, err, "invalid watchdog action")
+}
+
+func TestExecute_VirtioRNG(t *testing.T) {
+	cfg := Config{
+		CPUCount:     1,
+		Memory:       512,
+		Architecture: "x86_64",
+		Drives:       []Drive{{File: "disk.img", Format: "raw"}},
+		VirtioRNG:    true,
+	}
+
+	cmd, err := cfg.Execute()
+	assert.NoError(t, err)
+
+	args := cmd.Args[1:]
+	assert.Equal(t, "rng-random,id=rng0,filename=/dev/urandom", argValue(args, "-object"))
+	assert.Contains(t, args, "virtio-rng-pci,rng=rng0")
+
+	cfg.VirtioRNG = false
+	cmd, err = cfg.Execute()
+	assert.NoError(t, err)
+	assert.Empty(t, argValue(cmd.Args[1:], "-object"))
+	assert.NotContains(t, cmd.Args, "virtio-rng-pci,rng=rng0")
+}
+
+func TestExecute_Hotplug(t *testing.T) {
+	cfg := Config{
+		CPUCount:     2,
+		Memory:       8192,
+		MaxCPUCount:  8,
+		MaxMemory:    32768,
+		Architecture: "x86_64",
+		Drives:       []Drive{{File: "disk.img", Format: "raw"}},
+	}
+
+	cmd, err := cfg.Execute()
+	require.NoError(t, err)
+	args := cmd.Args[1:]
+	assert.Equal(t, "2,maxcpus=8", argValue(args, "-smp"))
+	assert.Equal(t, "8192,maxmem=32768M", argValue(args, "-m"))
+	assert.Equal(t, "memory-backend-ram,id=hotmem0,size=24576M", argValue(args, "-object"))
+	assert.Contains(t, args, "virtio-mem-pci,id=hotmem0-dev,memdev=hotmem0,requested-size=0")
+
+	// No room above the boot size means no hotplug
+	cfg.MaxCPUCount, cfg.MaxMemory = 2, 8192
+	cmd, err = cfg.Execute()
+	require.NoError(t, err)
+	args = cmd.Args[1:]
+	assert.Equal(t, "2", argValue(args, "-smp"))
+	assert.Equal(t, "8192", argValue(args, "-m"))
+	assert.Empty(t, argValue(args, "-object"))
+}
+
+func TestExecute_NUMA(t *testing.T) {
+	cfg := Config{
+		CPUCount:     4,
+		Memory:       16384,
+		Architecture: "x86_64",
+		Drives:       []Drive{{File: "disk.img", Format: "raw"}},
+		NUMA:         &NUMAPlacement{HostNode: 1, CPUs: []int{8, 9, 10, 11}},
+	}
+
+	cmd, err := cfg.Execute()
+	require.NoError(t, err)
+	args := strings.Join(cmd.Args[1:], " ")
+	assert.Contains(t, args, "-m 16384 -object memory-backend-ram,id=ram-node0,size=16384M,host-nodes=1,policy=bind -numa node,nodeid=0,memdev=ram-node0")
+	assert.Equal(t, "8,9,10,11", cfg.NUMA.CPUList())
+
+	// Hot-plugged memory comes from the same host node.
+	cfg.MaxMemory = 32768
+	cmd, err = cfg.Execute()
+	require.NoError(t, err)
+	args = strings.Join(cmd.Args[1:], " ")
+	assert.Contains(t, args, "-object memory-backend-ram,id=hotmem0,size=16384M,host-nodes=1,policy=bind")
+	assert.Contains(t, args, "virtio-mem-pci,id=hotmem0-dev,memdev=hotmem0,requested-size=0,node=0")
+}
+
+func TestExecute_GuestAgent(t *testing.T) {
+	cfg := Config{
+		CPUCount:         1,
+		Memory:           512,
+		Architecture:     "x86_64",
+		Drives:           []Drive{{File: "disk.img", Format: "raw"}},
+		GuestAgentSocket: "/run/qga.sock",
+	}
+
+	cmd, err := cfg.Execute()
+	assert.NoError(t, err)
+
+	args := cmd.Args[1:]
+	assert.Equal(t, "socket,id=qga0,path=/run/qga.sock,server=on,wait=off", argValue(args, "-chardev"))
+	assert.Contains(t, args, "virtio-serial")
+	assert.Contains(t, args, "virtserialport,chardev=qga0,name=org.qemu.guest_agent.0")
+
+	cfg.GuestAgentSocket = ""
+	cmd, err = cfg.Execute()
+	assert.NoError(t, err)
+	assert.Empty(t, argValue(cmd.Args[1:], "-chardev"))
+	assert.NotContains(t, cmd.Args, "virtio-serial")
+}
+
+func TestExecute_AgentChannel(t *testing.T) {
+	cfg := Config{
+		CPUCount:         1,
+		Memory:           512,
+		Architecture:     "x86_64",
+		Drives:           []Drive{{File: "disk.img", Format: "raw"}},
+		GuestAgentSocket: "/run/qga.sock",
+		AgentSocket:      "/run/agent.sock",
+	}
+
+	cmd, err := cfg.Execute()
+	assert.NoError(t, err)
+
+	args := cmd.Args[1:]
+	assert.Contains(t, args, "socket,id=agent0,path=/run/agent.sock,server=on,wait=off")
+	assert.Contains(t, args, "virtserialport,chardev=agent0,name=org.spinifex.agent.0")
+	count := 0
+	for _, arg := range args {
+		if arg == "virtio-serial" {
+			count++
+		}
+	}
+	assert.Equal(t, 1, count, "one virtio-serial controller serves both ports")
+}
+
 func TestExecute_MachineType_x86(t *testing.T) {
 	cfg := Config{
 		CPUCount:     1,
@@ -483,3 +755,17 @@ func TestExecute_FullConfig(t *testing.T) {
 	assert.Equal(t, "iothread,id=io0", argValue(args, "-object"))
 	assert.Equal(t, "user,id=net0", argValue(args, "-netdev"))
 }
+
+func TestBootPriority(t *testing.T) {
+	tagged := func(value string) *VM {
+		return &VM{Instance: &ec2.Instance{Tags: []*ec2.Tag{
+			{Key: aws.String("Name"), Value: aws.String("web")},
+			{Key: aws.String(BootPriorityTag), Value: aws.String(value)},
+		}}}
+	}
+	assert.Equal(t, 10, tagged("10").BootPriority())
+	assert.Equal(t, -5, tagged("-5").BootPriority())
+	assert.Equal(t, 0, tagged("high").BootPriority())
+	assert.Equal(t, 0, (&VM{Instance: &ec2.Instance{}}).BootPriority())
+	assert.Equal(t, 0, (&VM{}).BootPriority())
+}
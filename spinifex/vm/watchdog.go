@@ -0,0 +1,21 @@
+package vm
+
+import "slices"
+
+// WatchdogActionTag is the instance tag that enables the guest watchdog at
+// launch, e.g. TagSpecification ResourceType=instance, Key=spinifex:watchdog-action, Value=reset.
+const WatchdogActionTag = "spinifex:watchdog-action"
+
+// QEMU -watchdog-action values supported per instance.
+const (
+	WatchdogReset    = "reset"    // hard-reset the guest; instance stays running
+	WatchdogPoweroff = "poweroff" // power off the guest; instance is stopped
+	WatchdogNone     = "none"     // only report the WATCHDOG event
+)
+
+var watchdogActions = []string{WatchdogReset, WatchdogPoweroff, WatchdogNone}
+
+// IsValidWatchdogAction reports whether action is a supported watchdog action.
+func IsValidWatchdogAction(action string) bool {
+	return slices.Contains(watchdogActions, action)
+}
@@ -1659,7 +1659,7 @@ expect_error "NoSuchEntity" aws iam attach-user-policy --user-name ghost \
 
 # Default Deny — charlie has no policies
 echo "  Testing default deny (charlie, no policies)..."
-expect_error "AccessDenied" \
+expect_error "UnauthorizedOperation" \
     aws ec2 describe-instances --profile spx-charlie
 expect_error "AccessDenied" \
     aws iam list-users --profile spx-charlie
@@ -1675,7 +1675,7 @@ aws iam list-users --profile spx-alice > /dev/null
 echo "    iam:ListUsers — allowed"
 
 # Actions NOT in alice's policies → denied
-expect_error "AccessDenied" \
+expect_error "UnauthorizedOperation" \
     aws ec2 describe-key-pairs --profile spx-alice
 echo "    ec2:DescribeKeyPairs — denied (not in policy)"
 expect_error "AccessDenied" \
@@ -1689,7 +1689,7 @@ aws ec2 describe-instances --profile spx-bob > /dev/null
 echo "    ec2:DescribeInstances — allowed (ec2:* wildcard)"
 aws ec2 describe-key-pairs --profile spx-bob > /dev/null
 echo "    ec2:DescribeKeyPairs — allowed (ec2:* wildcard)"
-expect_error "AccessDenied" \
+expect_error "UnauthorizedOperation" \
     aws ec2 terminate-instances --instance-ids i-fake --profile spx-bob
 echo "    ec2:TerminateInstances — denied (explicit Deny overrides Allow)"
 expect_error "AccessDenied" \
@@ -1718,7 +1718,7 @@ aws ec2 describe-instances --profile spx-alice > /dev/null
 echo "    ec2:DescribeInstances — allowed (Describe*)"
 aws ec2 describe-key-pairs --profile spx-alice > /dev/null
 echo "    ec2:DescribeKeyPairs — allowed (Describe*)"
-expect_error "AccessDenied" \
+expect_error "UnauthorizedOperation" \
     aws ec2 create-key-pair --key-name x --profile spx-alice
 echo "    ec2:CreateKeyPair — denied (not Describe*)"
 expect_error "AccessDenied" \
@@ -1746,7 +1746,7 @@ echo "IAM Phase 6: Policy Lifecycle — Detach & Delete"
 echo "  Detaching EC2DescribeAll from alice..."
 aws iam detach-user-policy --user-name alice \
     --policy-arn "arn:aws:iam::${ADMIN_ACCOUNT}:policy/EC2DescribeAll"
-expect_error "AccessDenied" \
+expect_error "UnauthorizedOperation" \
     aws ec2 describe-instances --profile spx-alice
 echo "  Alice lost access after detach"
 